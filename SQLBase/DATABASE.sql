@@ -14,17 +14,150 @@ CREATE TABLE users (
     last_name VARCHAR(50),
     middle_name VARCHAR(50),
     inn VARCHAR(12) UNIQUE NOT NULL CHECK (LENGTH(inn) = 10 OR LENGTH(inn) = 12),
-    telegram_id BIGINT UNIQUE NOT NULL,
+    telegram_id BIGINT UNIQUE,
+    telegram_id_hash TEXT,
     email VARCHAR(100) CHECK (email ~* '^[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}$'),
     username VARCHAR(50),
+    organization_name TEXT,
     is_admin BOOLEAN DEFAULT FALSE,
-    api_key VARCHAR(64) UNIQUE,
     registered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     last_active TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    CONSTRAINT user_identity CHECK (telegram_id > 0)
+    deleted_at TIMESTAMP,
+    purged_at TIMESTAMP,
+    CONSTRAINT user_identity CHECK (telegram_id > 0 OR deleted_at IS NOT NULL)
 );
 COMMENT ON TABLE users IS 'Таблица пользователей системы';
 
+-- API ключи пользователей. Хранится только SHA-256 хэш ключа
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key_hash CHAR(64) UNIQUE NOT NULL,
+    prefix VARCHAR(8) NOT NULL,
+    label VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+COMMENT ON TABLE api_keys IS 'API ключи пользователей для программного доступа';
+
+-- Сеансы имперсонации: администратор поддержки вызывает API от имени пользователя
+-- по временному токену. Хранится только SHA-256 хэш токена
+CREATE TABLE impersonations (
+    id SERIAL PRIMARY KEY,
+    admin_user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    reason TEXT NOT NULL,
+    allow_write BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+COMMENT ON TABLE impersonations IS 'Сеансы имперсонации пользователей администраторами поддержки';
+
+-- Настройки email-уведомлений пользователей
+CREATE TABLE notification_preferences (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    kiz_files BOOLEAN NOT NULL DEFAULT TRUE,
+    payment_receipts BOOLEAN NOT NULL DEFAULT TRUE,
+    failures BOOLEAN NOT NULL DEFAULT TRUE,
+    announcements BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+COMMENT ON TABLE notification_preferences IS 'Настройки email-уведомлений пользователей';
+
+CREATE TABLE label_settings (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    template TEXT NOT NULL,
+    fields JSONB NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+COMMENT ON TABLE label_settings IS 'Шаблон этикеток PDF с кодами маркировки, выбранный пользователем';
+
+-- Создание таблицы организаций
+CREATE TABLE organizations (
+    id SERIAL PRIMARY KEY,
+    inn VARCHAR(12) UNIQUE NOT NULL CHECK (LENGTH(inn) = 10 OR LENGTH(inn) = 12),
+    name TEXT,
+    kpp VARCHAR(9) CHECK (kpp ~ '^[0-9]{9}$'),
+    address TEXT,
+    bank_name TEXT,
+    bik VARCHAR(9) CHECK (bik ~ '^[0-9]{9}$'),
+    bank_account VARCHAR(20) CHECK (bank_account ~ '^[0-9]{20}$'),
+    corr_account VARCHAR(20) CHECK (corr_account ~ '^[0-9]{20}$'),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+COMMENT ON TABLE organizations IS 'Юридические лица и ИП, от имени которых работают пользователи';
+
+-- Создание таблицы участников организаций
+CREATE TABLE organization_members (
+    organization_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'viewer' CHECK (role IN ('owner', 'accountant', 'operator', 'viewer')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+COMMENT ON TABLE organization_members IS 'Участие пользователей в организациях и их роли';
+
+-- Создание таблиц ролей и разрешений
+CREATE TABLE roles (
+    name VARCHAR(20) PRIMARY KEY,
+    description TEXT
+);
+
+CREATE TABLE role_permissions (
+    role VARCHAR(20) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission VARCHAR(50) NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+COMMENT ON TABLE role_permissions IS 'Разрешения ролей участников организаций';
+
+INSERT INTO roles (name, description) VALUES
+    ('owner', 'Владелец организации'),
+    ('accountant', 'Бухгалтер'),
+    ('operator', 'Оператор'),
+    ('viewer', 'Наблюдатель');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('owner', 'organization.view'), ('owner', 'members.manage'),
+    ('owner', 'orders.view'), ('owner', 'orders.create'), ('owner', 'orders.cancel'),
+    ('owner', 'payments.view'), ('owner', 'payments.create'), ('owner', 'payments.refund'),
+    ('owner', 'kiz.request'),
+    ('accountant', 'organization.view'), ('accountant', 'orders.view'),
+    ('accountant', 'payments.view'), ('accountant', 'payments.create'),
+    ('operator', 'organization.view'), ('operator', 'orders.view'), ('operator', 'orders.create'),
+    ('operator', 'orders.cancel'), ('operator', 'kiz.request'),
+    ('viewer', 'organization.view'), ('viewer', 'orders.view'), ('viewer', 'payments.view');
+
+-- Журнал аудита изменений (только добавление записей)
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_user_id INT,
+    telegram_id BIGINT,
+    action TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    ip TEXT,
+    impersonator_id INT,
+    before_data JSONB,
+    after_data JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+COMMENT ON TABLE audit_log IS 'Журнал аудита изменяющих операций';
+
+CREATE OR REPLACE FUNCTION audit_log_immutable() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'журнал аудита доступен только для добавления записей';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_modify
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW
+EXECUTE FUNCTION audit_log_immutable();
+
 -- Создание перечисления статусов заказа
 CREATE TYPE order_status AS ENUM (
     'created', 'pending', 'paid', 'processed', 'completed', 'cancelled', 'refunded'
@@ -34,6 +167,8 @@ CREATE TYPE order_status AS ENUM (
 CREATE TABLE orders (
     id SERIAL PRIMARY KEY,
     user_id INT NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    organization_id INT REFERENCES organizations(id),
+    product_group VARCHAR(50),
     total_amount DECIMAL(10, 2) NOT NULL CHECK (total_amount > 0),
     status order_status DEFAULT 'created',
     payment_id VARCHAR(50),
@@ -49,13 +184,75 @@ CREATE TABLE order_items (
     order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
     gtin VARCHAR(14) NOT NULL CHECK (LENGTH(gtin) = 14),
     quantity INT NOT NULL CHECK (quantity > 0),
-    price DECIMAL(10, 2) CHECK (price >= 0)
+    price DECIMAL(10, 2) CHECK (price >= 0),
+    product_name TEXT,
+    product_group VARCHAR(50)
 );
 COMMENT ON TABLE order_items IS 'Детали заказов - товарные позиции';
 
 -- Создание или обновление таблицы order_items с колонкой price если таблица уже существует
 ALTER TABLE IF EXISTS order_items ADD COLUMN IF NOT EXISTS price DECIMAL(10, 2) CHECK (price >= 0);
 
+-- Создание таблицы шаблонов заказов
+CREATE TABLE order_templates (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    organization_id INT REFERENCES organizations(id) ON DELETE SET NULL,
+    name VARCHAR(100) NOT NULL,
+    product_group VARCHAR(50),
+    items JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+COMMENT ON TABLE order_templates IS 'Шаблоны повторяющихся заказов: GTIN и количество кодов';
+
+-- Создание таблицы расписаний повторяющихся заказов
+CREATE TABLE order_schedules (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    organization_id INT REFERENCES organizations(id) ON DELETE SET NULL,
+    name VARCHAR(100) NOT NULL,
+    cron VARCHAR(100) NOT NULL,
+    product_group VARCHAR(50),
+    items JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'paused')),
+    next_run_at TIMESTAMP,
+    last_run_at TIMESTAMP,
+    last_order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    version INT NOT NULL DEFAULT 1
+);
+COMMENT ON TABLE order_schedules IS 'Расписания повторяющихся заказов с оплатой с бонусного баланса';
+
+-- Создание таблицы аренд для координации экземпляров сервиса
+CREATE TABLE leases (
+    name VARCHAR(100) PRIMARY KEY,
+    owner VARCHAR(255) NOT NULL,
+    acquired_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL
+);
+COMMENT ON TABLE leases IS 'Аренды для координации экземпляров сервиса: фоновые задачи выполняет владелец аренды leader';
+
+-- Создание таблицы корзин пользователей
+CREATE TABLE carts (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    organization_id INT REFERENCES organizations(id) ON DELETE SET NULL,
+    product_group VARCHAR(50),
+    items JSONB NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+COMMENT ON TABLE carts IS 'Корзины пользователей - позиции будущего заказа';
+
+-- Создание таблицы тарифов: стоимость кода маркировки по товарным группам
+CREATE TABLE tariffs (
+    product_group VARCHAR(50) PRIMARY KEY,
+    unit_price DECIMAL(10, 2) NOT NULL CHECK (unit_price > 0),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+COMMENT ON TABLE tariffs IS 'Стоимость кода маркировки для товарных групп';
+
 -- Создание перечисления статусов платежа
 CREATE TYPE payment_status AS ENUM (
     'pending', 'processing', 'completed', 'failed', 'refunded', 'cancelled'
@@ -65,12 +262,16 @@ CREATE TYPE payment_status AS ENUM (
 CREATE TABLE payments (
     id SERIAL PRIMARY KEY,
     order_id INT NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    organization_id INT REFERENCES organizations(id),
     amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
     status payment_status DEFAULT 'pending',
     transaction_id VARCHAR(100) UNIQUE,
     currency VARCHAR(3) DEFAULT 'RUB',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     completed_at TIMESTAMP,
+    reconciled_at TIMESTAMP,
+    needs_review BOOLEAN NOT NULL DEFAULT FALSE,
+    review_reason TEXT,
     CONSTRAINT payment_amount_positive CHECK (amount > 0)
 );
 COMMENT ON TABLE payments IS 'Платежные операции';
@@ -78,6 +279,162 @@ COMMENT ON TABLE payments IS 'Платежные операции';
 -- Обновление таблицы payments для согласования с моделями если колонка существует
 ALTER TABLE IF EXISTS payments RENAME COLUMN IF EXISTS robokassa_id TO transaction_id;
 
+-- Создание таблицы счетов на оплату банковским переводом
+CREATE TABLE invoices (
+    id SERIAL PRIMARY KEY,
+    number TEXT UNIQUE NOT NULL,
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    organization_id INT REFERENCES organizations(id),
+    user_id INT NOT NULL REFERENCES users(id),
+    payment_id INT REFERENCES payments(id),
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    status TEXT NOT NULL DEFAULT 'issued' CHECK (status IN ('issued', 'paid', 'cancelled')),
+    due_date DATE NOT NULL,
+    payment_order_number TEXT,
+    paid_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+COMMENT ON TABLE invoices IS 'Счета на оплату заказов банковским переводом';
+
+-- Создание таблицы исходящих уведомлений (transactional outbox)
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    channel TEXT NOT NULL CHECK (channel IN ('webhook', 'telegram', 'email')),
+    user_id INT,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP
+);
+COMMENT ON TABLE outbox IS 'Уведомления, записанные вместе с изменением состояния и ожидающие доставки';
+
+-- Создание таблицы объявлений
+CREATE TABLE announcements (
+    id SERIAL PRIMARY KEY,
+    title TEXT NOT NULL,
+    text TEXT NOT NULL,
+    level TEXT NOT NULL DEFAULT 'info' CHECK (level IN ('info', 'warning', 'critical')),
+    starts_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    ends_at TIMESTAMP,
+    broadcast BOOLEAN NOT NULL DEFAULT FALSE,
+    broadcast_cursor INT NOT NULL DEFAULT 0,
+    broadcast_count INT NOT NULL DEFAULT 0,
+    broadcast_done_at TIMESTAMP,
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+COMMENT ON TABLE announcements IS 'Объявления для пользователей: показываются в клиентах и рассылаются в Telegram';
+
+-- Создание таблиц страницы статуса
+CREATE TABLE status_components (
+    component TEXT PRIMARY KEY,
+    status TEXT NOT NULL CHECK (status IN ('ok', 'degraded', 'error', 'disabled')),
+    backlog INT NOT NULL DEFAULT 0,
+    checked_at TIMESTAMP NOT NULL,
+    changed_at TIMESTAMP NOT NULL
+);
+COMMENT ON TABLE status_components IS 'Последний результат проверки компонентов сервиса для страницы статуса';
+
+CREATE TABLE status_incidents (
+    id SERIAL PRIMARY KEY,
+    component TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('degraded', 'error')),
+    message TEXT,
+    started_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP
+);
+COMMENT ON TABLE status_incidents IS 'Периоды недоступности компонентов сервиса';
+
+-- Создание таблицы выгрузок данных пользователей
+CREATE TABLE data_exports (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    file_path TEXT,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP
+);
+COMMENT ON TABLE data_exports IS 'Выгрузки персональных данных по запросам пользователей';
+
+-- Создание таблицы кассовых чеков по платежам (54-ФЗ)
+CREATE TABLE fiscal_receipts (
+    id SERIAL PRIMARY KEY,
+    payment_id INT UNIQUE NOT NULL REFERENCES payments(id) ON DELETE RESTRICT,
+    provider TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'registered', 'failed')),
+    external_id TEXT,
+    provider_id TEXT,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    error TEXT,
+    fiscal_document_number TEXT,
+    fiscal_document_attribute TEXT,
+    fn_number TEXT,
+    receipt_number TEXT,
+    shift_number TEXT,
+    registration_number TEXT,
+    fns_site TEXT,
+    registered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+COMMENT ON TABLE fiscal_receipts IS 'Кассовые чеки по платежам, зарегистрированные в онлайн-кассе';
+
+-- Создание таблицы документов ввода в оборот
+CREATE TABLE introduction_documents (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    organization_id INT REFERENCES organizations(id),
+    user_id INT NOT NULL REFERENCES users(id),
+    participant_inn TEXT NOT NULL,
+    product_group VARCHAR(50),
+    production_type TEXT NOT NULL CHECK (production_type IN ('produced', 'imported')),
+    production_date DATE NOT NULL,
+    declaration_number TEXT,
+    declaration_date DATE,
+    codes JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'submitted', 'accepted', 'rejected')),
+    external_id TEXT,
+    error TEXT,
+    ticket TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    submitted_at TIMESTAMP,
+    processed_at TIMESTAMP,
+    status_checks INT NOT NULL DEFAULT 0,
+    next_status_check_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+COMMENT ON TABLE introduction_documents IS 'Документы ввода в оборот, отправляемые в Честный ЗНАК';
+
+-- Создание таблицы документов вывода из оборота
+CREATE TABLE retirement_documents (
+    id SERIAL PRIMARY KEY,
+    organization_id INT REFERENCES organizations(id),
+    user_id INT NOT NULL REFERENCES users(id),
+    participant_inn TEXT NOT NULL,
+    product_group VARCHAR(50),
+    reason TEXT NOT NULL CHECK (reason IN ('retail', 'export', 'write_off')),
+    action_date DATE NOT NULL,
+    primary_document_number TEXT,
+    primary_document_date DATE,
+    codes JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'submitted', 'accepted', 'rejected')),
+    external_id TEXT,
+    error TEXT,
+    ticket TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    submitted_at TIMESTAMP,
+    processed_at TIMESTAMP,
+    status_checks INT NOT NULL DEFAULT 0,
+    next_status_check_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+COMMENT ON TABLE retirement_documents IS 'Документы вывода кодов маркировки из оборота';
+
 -- Триггерная функция для обновления updated_at
 CREATE OR REPLACE FUNCTION update_modified_column()
 RETURNS TRIGGER AS $$
@@ -114,10 +471,28 @@ EXECUTE FUNCTION update_order_status_on_payment();
 -- Индексы для ускорения часто используемых запросов
 CREATE INDEX idx_users_telegram ON users(telegram_id);
 CREATE INDEX idx_users_inn ON users(inn);
+CREATE INDEX idx_users_deleted ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_api_keys_user ON api_keys(user_id);
+CREATE INDEX idx_status_incidents_open ON status_incidents(component) WHERE resolved_at IS NULL;
 CREATE INDEX idx_orders_user ON orders(user_id);
 CREATE INDEX idx_orders_status ON orders(status);
+CREATE INDEX idx_orders_organization ON orders(organization_id);
+CREATE INDEX idx_order_templates_user ON order_templates(user_id);
+CREATE INDEX idx_order_schedules_user ON order_schedules(user_id);
+CREATE INDEX idx_order_schedules_due ON order_schedules(next_run_at) WHERE status = 'active';
+CREATE INDEX idx_organization_members_user ON organization_members(user_id);
 CREATE INDEX idx_payments_order ON payments(order_id);
 CREATE INDEX idx_payments_status ON payments(status);
+CREATE INDEX idx_invoices_order ON invoices(order_id);
+CREATE INDEX idx_outbox_pending ON outbox(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_data_exports_user ON data_exports(user_id, created_at);
+CREATE INDEX idx_fiscal_receipts_status ON fiscal_receipts(status, next_attempt_at);
+CREATE INDEX idx_audit_log_entity ON audit_log(entity_type, entity_id);
+CREATE INDEX idx_audit_log_created ON audit_log(created_at);
+CREATE INDEX idx_introduction_documents_order ON introduction_documents(order_id);
+CREATE INDEX idx_introduction_documents_status ON introduction_documents(status);
+CREATE INDEX idx_retirement_documents_user ON retirement_documents(user_id);
+CREATE INDEX idx_retirement_documents_status ON retirement_documents(status);
 
 -- Представление для активных заказов
 CREATE VIEW active_orders AS
@@ -0,0 +1,99 @@
+// Команда sandbox запускает имитацию API Честного ЗНАКа, СУЗ и Robokassa для проверки фоновой
+// обработки запросов КИЗ, документов и платежей без доступа к внешним системам. Сбои задаются
+// флагом -fault или через управляющий API /sandbox/faults.
+//
+//	go run ./cmd/sandbox -keys=.sandbox -fault=chestnyznak.kizs=throttle*3
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"project-znak/internal/sandbox"
+)
+
+// Правила сбоя из повторяющегося флага -fault
+type faultFlags []sandbox.Fault
+
+func (f *faultFlags) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *faultFlags) Set(value string) error {
+	for _, spec := range strings.Split(value, ",") {
+		fault, err := sandbox.ParseFault(strings.TrimSpace(spec))
+		if err != nil {
+			return err
+		}
+		*f = append(*f, fault)
+	}
+	return nil
+}
+
+func main() {
+	addr := flag.String("addr", ":8090", "адрес песочницы")
+	resultURL := flag.String("result-url", "http://localhost:8080/api/payments/callback", "адрес уведомлений ResultURL сервиса")
+	password2 := flag.String("password2", os.Getenv("ROBOKASSA_PASSWORD2"), "пароль #2 Robokassa (по умолчанию ROBOKASSA_PASSWORD2)")
+	delay := flag.Duration("delay", 2*time.Second, "время обработки документов и формирования кодов СУЗ")
+	timeout := flag.Duration("timeout", 2*time.Minute, "задержка ответа в режиме сбоя timeout")
+	keysDir := flag.String("keys", "", "каталог, в котором создаются ключ и сертификат ЭЦП для KEYSTORE_DRIVER=pem")
+	var faults faultFlags
+	flag.Var(&faults, "fault", "правило сбоя система.операция=режим*число; флаг можно повторять")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "[SANDBOX] ", log.LstdFlags)
+	if *password2 == "" {
+		logger.Fatal("Укажите пароль #2 Robokassa флагом -password2 или ROBOKASSA_PASSWORD2")
+	}
+	if *keysDir != "" {
+		keyPath, certPath, err := sandbox.WriteKeys(*keysDir)
+		if err != nil {
+			logger.Fatalf("Ошибка создания ключа ЭЦП: %v", err)
+		}
+		logger.Printf("KEYSTORE_DRIVER=pem PRIVATE_KEY_PATH=%s CERTIFICATE_PATH=%s", keyPath, certPath)
+	}
+
+	sb := sandbox.New(sandbox.Config{
+		ResultURL:       *resultURL,
+		Password2:       *password2,
+		ProcessingDelay: *delay,
+		TimeoutDelay:    *timeout,
+	}, logger)
+	for _, fault := range faults {
+		if err := sb.AddFault(fault); err != nil {
+			logger.Fatalf("Некорректное правило сбоя: %v", err)
+		}
+	}
+
+	server := &http.Server{Addr: *addr, Handler: sb.Handler()}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalf("Ошибка запуска песочницы: %v", err)
+		}
+	}()
+
+	base := "http://localhost" + *addr
+	if !strings.HasPrefix(*addr, ":") {
+		base = "http://" + *addr
+	}
+	logger.Printf("Песочница запущена на %s", *addr)
+	logger.Printf("CHESTNY_ZNAK_API_URL=%s/chestnyznak OMS_URL=%s/oms", base, base)
+	logger.Printf("ROBOKASSA_OPSTATE_URL=%s/robokassa ROBOKASSA_PAYMENT_URL=%s/robokassa/Merchant/Index.aspx", base, base)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+}
@@ -0,0 +1,290 @@
+// Команда seed заполняет настроенную БД данными для разработки: пользователями с API ключами,
+// организацией с участниками, тарифами, заказами, платежом и выданными кодами маркировки.
+//
+//	go run ./cmd/seed -db=sqlite
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"project-znak/internal/config"
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+	"project-znak/internal/repository"
+)
+
+// Telegram ID пользователя-владельца: по нему проверяется, загружены ли данные
+const ownerTelegramID = 100001
+
+// Пользователь для разработки
+type seedUser struct {
+	user models.User
+	role string // Роль в организации; пусто - пользователь вне организации
+	note string
+}
+
+// Товары тестовых заказов
+var seedProducts = []struct {
+	gtin  string
+	group string
+	name  string
+	price float64
+}{
+	{"04601234567893", "milk", "Молоко 3,2% 1 л", 100},
+	{gtinWithCheckDigit("0460123456790"), "milk", "Кефир 1% 0,9 л", 100},
+	{gtinWithCheckDigit("0460123456791"), "shoes", "Кроссовки беговые", 150},
+}
+
+func main() {
+	// Время в БД хранится в UTC, как и в cmd/server
+	time.Local = time.UTC
+
+	dbDriver := flag.String("db", "", "драйвер БД: postgres или sqlite (по умолчанию DB_DRIVER)")
+	flag.Parse()
+	if *dbDriver != "" {
+		os.Setenv("DB_DRIVER", *dbDriver)
+	}
+
+	logger := log.New(os.Stderr, "[SEED] ", log.LstdFlags)
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+
+	ctx := context.Background()
+	var repo *repository.Repository
+	switch cfg.Database.Driver {
+	case config.DatabaseDriverSQLite:
+		if cfg.Database.SQLitePath == ":memory:" {
+			logger.Fatal("БД в памяти существует только в процессе сервиса: укажите файл DB_SQLITE_PATH")
+		}
+		db, err := repository.OpenSQLite(ctx, cfg.Database.SQLitePath)
+		if err != nil {
+			logger.Fatalf("Ошибка инициализации БД: %v", err)
+		}
+		defer db.Close()
+		repo = repository.New(db)
+	default:
+		db, err := repository.Open(ctx, cfg.Database.DSN(), func() string {
+			return cfg.Secrets.Get("DB_PASSWORD")
+		})
+		if err != nil {
+			logger.Fatalf("Ошибка инициализации БД: %v", err)
+		}
+		defer db.Close()
+		repo = repository.New(db)
+	}
+
+	if err := repo.Migrate(ctx); err != nil {
+		logger.Fatalf("Ошибка создания таблиц: %v", err)
+	}
+
+	if userID, err := repo.UserIDByTelegram(ctx, ownerTelegramID); err != nil {
+		logger.Fatalf("Ошибка проверки данных: %v", err)
+	} else if userID > 0 {
+		logger.Printf("Данные для разработки уже загружены (пользователь %d существует)", ownerTelegramID)
+		return
+	}
+
+	if err := seed(ctx, repo); err != nil {
+		logger.Fatalf("Ошибка загрузки данных: %v", err)
+	}
+}
+
+// Загрузка данных. API ключи выводятся один раз: в БД хранятся только их хэши.
+func seed(ctx context.Context, repo *repository.Repository) error {
+	users := []*seedUser{
+		{user: models.User{TelegramID: ownerTelegramID, INN: "7707083893", Email: "owner@example.com",
+			FirstName: "Иван", LastName: "Петров", Username: "owner"}, role: models.OrgRoleOwner, note: "владелец организации"},
+		{user: models.User{TelegramID: 100002, INN: "7707083893", Email: "operator@example.com",
+			FirstName: "Анна", LastName: "Смирнова", Username: "operator"}, role: models.OrgRoleOperator, note: "оператор"},
+		{user: models.User{TelegramID: 100003, INN: "7707083893", Email: "accountant@example.com",
+			FirstName: "Ольга", LastName: "Иванова", Username: "accountant"}, role: models.OrgRoleAccountant, note: "бухгалтер"},
+		{user: models.User{TelegramID: 100004, INN: "7736207543", Email: "admin@example.com",
+			FirstName: "Сергей", LastName: "Кузнецов", Username: "admin", IsAdmin: true}, note: "администратор системы"},
+	}
+
+	keys := make([]string, len(users))
+	for i, u := range users {
+		if err := repo.CreateUser(ctx, &u.user); err != nil {
+			return fmt.Errorf("ошибка создания пользователя %d: %w", u.user.TelegramID, err)
+		}
+		if u.user.IsAdmin {
+			if err := repo.SetAdmin(ctx, u.user.ID, true); err != nil {
+				return fmt.Errorf("ошибка назначения администратора: %w", err)
+			}
+		}
+		key, err := createAPIKey(ctx, repo, u.user.ID)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+
+	owner := users[0].user
+	organizationID, err := repo.CreateOrganization(ctx, owner.ID, owner.INN, "ООО «Молочная ферма»")
+	if err != nil {
+		return err
+	}
+	for _, u := range users[1:] {
+		if u.role == "" {
+			continue
+		}
+		member := models.OrganizationMember{OrganizationID: organizationID, UserID: u.user.ID, Role: u.role}
+		if err := repo.SaveOrganizationMember(ctx, &member); err != nil {
+			return fmt.Errorf("ошибка добавления участника организации: %w", err)
+		}
+	}
+	if err := repo.SaveOrganizationRequisites(ctx, organizationID, models.Requisites{
+		KPP:         "773601001",
+		Address:     "г. Москва, ул. Примерная, д. 1",
+		BankName:    "ПАО Сбербанк",
+		BIK:         "044525225",
+		BankAccount: "40702810900000000001",
+		CorrAccount: "30101810400000000225",
+	}); err != nil {
+		return fmt.Errorf("ошибка сохранения реквизитов: %w", err)
+	}
+
+	for group, price := range map[string]float64{"milk": 100, "shoes": 150, "water": 80} {
+		feeCost := 0.6
+		if err := repo.SetTariff(ctx, &models.Tariff{ProductGroup: group, UnitPrice: price, FeeCost: &feeCost}); err != nil {
+			return fmt.Errorf("ошибка сохранения тарифа %s: %w", group, err)
+		}
+	}
+
+	// Оплаченный заказ с выданными кодами, новый заказ и отмененный заказ
+	paid, err := createOrder(ctx, repo, owner.ID, organizationID, "milk", map[int]int{0: 5, 1: 3})
+	if err != nil {
+		return err
+	}
+	if err := payOrder(ctx, repo, paid); err != nil {
+		return err
+	}
+	if err := issueCodes(ctx, repo, paid, owner); err != nil {
+		return err
+	}
+	if _, err := createOrder(ctx, repo, owner.ID, organizationID, "milk", map[int]int{0: 10}); err != nil {
+		return err
+	}
+	cancelled, err := createOrder(ctx, repo, owner.ID, organizationID, "shoes", map[int]int{2: 2})
+	if err != nil {
+		return err
+	}
+	if _, err := repo.CancelOrder(ctx, cancelled.ID, owner.ID, cancelled.Version); err != nil {
+		return fmt.Errorf("ошибка отмены заказа: %w", err)
+	}
+
+	fmt.Printf("Организация %d, ИНН %s\n\n", organizationID, owner.INN)
+	fmt.Println("Пользователи (API ключ передается в заголовке X-API-Key):")
+	for i, u := range users {
+		fmt.Printf("  %-22s telegram_id=%d  X-API-Key: %s\n", u.note, u.user.TelegramID, keys[i])
+	}
+	return nil
+}
+
+// Создание API ключа пользователя в формате ключей сервиса
+func createAPIKey(ctx context.Context, repo *repository.Repository, userID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(b)
+	sum := sha256.Sum256([]byte(key))
+	apiKey := models.APIKey{UserID: userID, Prefix: key[:8], Label: "seed"}
+	if err := repo.CreateAPIKey(ctx, &apiKey, hex.EncodeToString(sum[:])); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Создание заказа из товаров seedProducts: номер товара -> количество
+func createOrder(ctx context.Context, repo *repository.Repository, userID, organizationID int, group string,
+	quantities map[int]int) (*models.Order, error) {
+	order := models.Order{UserID: userID, OrganizationID: organizationID, ProductGroup: group, Status: models.OrderStatusCreated}
+	for product, quantity := range quantities {
+		item := models.OrderItem{
+			GTIN:         seedProducts[product].gtin,
+			Quantity:     quantity,
+			Price:        seedProducts[product].price,
+			ProductName:  seedProducts[product].name,
+			ProductGroup: seedProducts[product].group,
+		}
+		item.SetCost(0.6)
+		order.Items = append(order.Items, item)
+		order.TotalAmount += item.Price * float64(quantity)
+	}
+	if err := repo.CreateOrder(ctx, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// Проведенный платеж по заказу
+func payOrder(ctx context.Context, repo *repository.Repository, order *models.Order) error {
+	paymentID, err := repo.CreatePayment(ctx, order.UserID, order.ID, order.OrganizationID,
+		money.FromFloat(order.TotalAmount, money.RUB), "robokassa")
+	if err != nil {
+		return fmt.Errorf("ошибка создания платежа: %w", err)
+	}
+	_, err = repo.CompletePayment(ctx, paymentID, 0, fmt.Sprintf("seed-%d", paymentID), time.Now(),
+		func(*repository.CompletedPayment) ([]models.OutboxMessage, error) { return nil, nil })
+	if err != nil {
+		return fmt.Errorf("ошибка проведения платежа: %w", err)
+	}
+	return nil
+}
+
+// Выполненный запрос КИЗ по заказу с кодами в формате GS1: 01 + GTIN + 21 + серийный номер
+func issueCodes(ctx context.Context, repo *repository.Repository, order *models.Order, user models.User) error {
+	var gtins, codes []string
+	for _, item := range order.Items {
+		gtins = append(gtins, item.GTIN)
+		for i := 0; i < item.Quantity; i++ {
+			serial := make([]byte, 4)
+			if _, err := rand.Read(serial); err != nil {
+				return err
+			}
+			codes = append(codes, "01"+item.GTIN+"21SEED"+hex.EncodeToString(serial))
+		}
+	}
+
+	requestID, err := repo.CreateKIZRequest(ctx, repository.NewKIZRequest{
+		UserID:         user.ID,
+		TelegramID:     user.TelegramID,
+		INN:            user.INN,
+		OrderID:        order.ID,
+		OrganizationID: order.OrganizationID,
+		ProductGroup:   order.ProductGroup,
+		RequestTime:    time.Now(),
+		RequestData:    map[string]any{"gtins": gtins},
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса КИЗ: %w", err)
+	}
+	if _, err := repo.SaveKIZResult(ctx, requestID, codes, ""); err != nil {
+		return fmt.Errorf("ошибка сохранения кодов: %w", err)
+	}
+	return nil
+}
+
+// GTIN-14 с контрольной цифрой по первым 13 цифрам
+func gtinWithCheckDigit(digits string) string {
+	sum := 0
+	for i, c := range digits {
+		weight := 1
+		if i%2 == 0 {
+			weight = 3
+		}
+		sum += int(c-'0') * weight
+	}
+	return digits + string(rune('0'+(10-sum%10)%10))
+}
@@ -0,0 +1,2131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"project-znak/internal/config"
+	"project-znak/internal/dto"
+	httpapi "project-znak/internal/http"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/sandbox"
+	"project-znak/internal/service"
+)
+
+// Контрактные тесты REST API проходят сценарии бота через полный обработчик запросов сервиса,
+// собранный так же, как в main: БД SQLite в памяти, Честный ЗНАК, СУЗ и Robokassa - песочница
+// internal/sandbox. Тесты проверяют коды ответов и поля, на которые опирается бот.
+
+const (
+	contractPassword2      = "contract-password2"
+	contractDownloadSecret = "contract-download-secret"
+	contractINN            = "7707083893"
+	contractGTIN           = "04601234567893"
+)
+
+// Окружение контрактного теста: адрес API, репозиторий для подготовки данных
+// и песочница внешних систем
+type contractEnv struct {
+	t       *testing.T
+	url     string
+	repo    *repository.Repository
+	svc     *service.Service
+	sandbox *sandbox.Server
+}
+
+func newContractEnv(t *testing.T) *contractEnv {
+	ctx := context.Background()
+
+	// Адрес API нужен песочнице для уведомлений Robokassa до сборки сервиса
+	startup := httpapi.NewStartupHandler()
+	api := httptest.NewServer(startup)
+	t.Cleanup(api.Close)
+
+	sb := sandbox.New(sandbox.Config{
+		ResultURL:    api.URL + "/api/payments/callback",
+		Password2:    contractPassword2,
+		TimeoutDelay: time.Second,
+	}, log.New(io.Discard, "", 0))
+	upstream := httptest.NewServer(sb.Handler())
+	t.Cleanup(upstream.Close)
+
+	keyPath, certPath, err := sandbox.WriteKeys(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{
+		"CONFIG_FILE":            "",
+		"SECRETS_PROVIDER":       "",
+		"DB_DRIVER":              config.DatabaseDriverSQLite,
+		"DB_SQLITE_PATH":         ":memory:",
+		"REDIS_ADDR":             "",
+		"CHESTNY_ZNAK_API_URL":   upstream.URL + "/chestnyznak",
+		"KEYSTORE_DRIVER":        "pem",
+		"PRIVATE_KEY_PATH":       keyPath,
+		"CERTIFICATE_PATH":       certPath,
+		"OMS_URL":                upstream.URL + "/oms",
+		"OMS_ID":                 "contract",
+		"OMS_CLIENT_TOKEN_MILK":  "contract",
+		"OMS_CLIENT_TOKEN_SHOES": "contract",
+		"ROBOKASSA_LOGIN":        "shop",
+		"ROBOKASSA_PASSWORD":     "contract-password1",
+		"ROBOKASSA_PASSWORD2":    contractPassword2,
+		"ROBOKASSA_OPSTATE_URL":  upstream.URL + "/robokassa",
+		"ROBOKASSA_PAYMENT_URL":  upstream.URL + "/robokassa/Merchant/Index.aspx",
+		"PUBLIC_BASE_URL":        api.URL,
+		"DOWNLOAD_LINK_SECRET":   contractDownloadSecret,
+	} {
+		t.Setenv(name, value)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+
+	db, err := repository.OpenSQLite(ctx, cfg.Database.SQLitePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := repository.New(db)
+	if err := repo.Migrate(ctx); err != nil {
+		t.Fatalf("Ошибка создания таблиц: %v", err)
+	}
+
+	logger := log.New(io.Discard, "", 0)
+	opts, err := serviceOptions(cfg, nil, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.TempDir = t.TempDir()
+	svc := service.New(repo, logger, opts)
+
+	accessLog := logrus.New()
+	accessLog.SetOutput(io.Discard)
+	startup.Ready(httpapi.NewHandler(svc, logger, accessLog, cfg.RateLimit, cfg.Compression, cfg.RequestLimits, cfg.APIVersions, cfg.Proxies, nil))
+
+	return &contractEnv{t: t, url: api.URL, repo: repo, svc: svc, sandbox: sb}
+}
+
+// Запрос к API с ключом apiKey. Тело кодируется в JSON, ответ декодируется в out, если он
+// передан. Возвращает код ответа и тело.
+func (e *contractEnv) call(method, path, apiKey string, body, out any) (int, []byte) {
+	e.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			e.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, e.url+path, reader)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			e.t.Fatalf("%s %s: ответ не в формате JSON: %v, тело: %s", method, path, err, data)
+		}
+	}
+	return resp.StatusCode, data
+}
+
+// Запрос, который должен завершиться с кодом want
+func (e *contractEnv) expect(want int, method, path, apiKey string, body, out any) {
+	e.t.Helper()
+	if status, data := e.call(method, path, apiKey, body, out); status != want {
+		e.t.Fatalf("%s %s: код ответа %d, ожидался %d, тело: %s", method, path, status, want, data)
+	}
+}
+
+// Регистрация пользователя; возвращает выданный API ключ
+func (e *contractEnv) register(telegramID int64) string {
+	e.t.Helper()
+	var resp struct {
+		Status string `json:"status"`
+		UserID int    `json:"user_id"`
+		APIKey string `json:"api_key"`
+	}
+	e.expect(http.StatusOK, http.MethodPost, "/api/users/register", "",
+		map[string]any{"telegram_id": telegramID, "inn": contractINN}, &resp)
+	if resp.Status != "success" || resp.UserID == 0 || resp.APIKey == "" {
+		e.t.Fatalf("Неверный ответ регистрации: %+v", resp)
+	}
+	return resp.APIKey
+}
+
+// Ответ на запрос КИЗ
+type contractKIZResponse struct {
+	Status    string   `json:"status"`
+	RequestID int      `json:"request_id"`
+	KIZs      []string `json:"kizs"`
+	FilePath  string   `json:"file_path"`
+	Error     string   `json:"error"`
+}
+
+// Регистрация, заказ, оплата через Robokassa, запрос КИЗ и скачивание файла с кодами
+func TestContractGoldenFlow(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300001
+	apiKey := env.register(telegramID)
+
+	// Запрос без ключа отклоняется
+	if status, _ := env.call(http.MethodGet, "/api/orders", "", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Запрос без API ключа: код %d, ожидался 401", status)
+	}
+
+	var order struct {
+		Status string `json:"status"`
+		Order  struct {
+			ID           int     `json:"id"`
+			Status       string  `json:"status"`
+			ProductGroup string  `json:"product_group"`
+			TotalAmount  float64 `json:"total_amount"`
+			Version      int     `json:"version"`
+		} `json:"order"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/orders", apiKey, map[string]any{
+		"telegram_id":   telegramID,
+		"product_group": "milk",
+		"items":         []map[string]any{{"gtin": contractGTIN, "quantity": 3}},
+	}, &order)
+	if order.Order.ID == 0 || order.Order.Status != "created" || order.Order.TotalAmount != 300 || order.Order.Version != 1 {
+		t.Fatalf("Неверный заказ: %+v", order.Order)
+	}
+
+	var payment struct {
+		Status      string `json:"status"`
+		RedirectURL string `json:"redirect_url"`
+		PaymentID   int    `json:"payment_id"`
+	}
+	env.expect(http.StatusOK, http.MethodPost, "/api/payments/create", apiKey, map[string]any{
+		"telegram_id": telegramID,
+		"amount":      order.Order.TotalAmount,
+		"order_id":    order.Order.ID,
+	}, &payment)
+	if payment.PaymentID == 0 || !strings.Contains(payment.RedirectURL, "InvId="+strconv.Itoa(payment.PaymentID)) {
+		t.Fatalf("Неверный ответ создания платежа: %+v", payment)
+	}
+
+	// Покупатель переходит по ссылке на оплату; песочница отправляет уведомление ResultURL
+	resp, err := http.Get(strings.ReplaceAll(payment.RedirectURL, " ", "%20"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "OK"+strconv.Itoa(payment.PaymentID)) {
+		t.Fatalf("Уведомление ResultURL не принято: %s", page)
+	}
+
+	var paymentStatus struct {
+		Payment struct {
+			Status        string `json:"status"`
+			TransactionID string `json:"transaction_id"`
+			OrderID       int    `json:"order_id"`
+		} `json:"payment"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, fmt.Sprintf("/api/payments/status?id=%d&telegram_id=%d", payment.PaymentID, telegramID),
+		apiKey, nil, &paymentStatus)
+	if paymentStatus.Payment.Status != "completed" || paymentStatus.Payment.TransactionID == "" ||
+		paymentStatus.Payment.OrderID != order.Order.ID {
+		t.Fatalf("Платеж должен быть проведен: %+v", paymentStatus.Payment)
+	}
+
+	var kiz contractKIZResponse
+	env.expect(http.StatusOK, http.MethodPost, "/api/kizs", apiKey, map[string]any{
+		"telegram_id":   telegramID,
+		"inn":           contractINN,
+		"order_id":      order.Order.ID,
+		"product_group": "milk",
+		"gtins":         []string{contractGTIN, contractGTIN, contractGTIN},
+	}, &kiz)
+	if kiz.Status != "success" || kiz.RequestID == 0 || len(kiz.KIZs) != 3 || kiz.FilePath == "" {
+		t.Fatalf("Неверный ответ запроса КИЗ: %+v", kiz)
+	}
+	if !strings.HasPrefix(kiz.KIZs[0], "01"+contractGTIN+"21") {
+		t.Errorf("Код не в формате GS1: %s", kiz.KIZs[0])
+	}
+
+	var request struct {
+		StatusCode      string   `json:"status_code"`
+		KIZData         []string `json:"kiz_data"`
+		CodesRequested  int      `json:"codes_requested"`
+		CodesDownloaded int      `json:"codes_downloaded"`
+		FilesGenerated  int      `json:"files_generated"`
+		Message         string   `json:"message"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, fmt.Sprintf("/api/requests/status?id=%d", kiz.RequestID), apiKey, nil, &request)
+	if request.StatusCode != "completed" || len(request.KIZData) != 3 || request.CodesRequested != 3 ||
+		request.CodesDownloaded != 3 || request.FilesGenerated != 1 || request.Message != "3 из 3 кодов получено" {
+		t.Errorf("Неверный статус запроса КИЗ: %+v", request)
+	}
+	var byPath struct {
+		StatusCode string `json:"status_code"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, fmt.Sprintf("/api/requests/%d", kiz.RequestID), apiKey, nil, &byPath)
+	if byPath.StatusCode != request.StatusCode {
+		t.Errorf("GET /api/requests/{id} должен возвращать статус запроса, получено: %+v", byPath)
+	}
+	env.expect(http.StatusMethodNotAllowed, http.MethodDelete, fmt.Sprintf("/api/requests/%d", kiz.RequestID), apiKey, nil, nil)
+
+	// Поток событий выполненного запроса состоит из одного события done
+	status, events := env.call(http.MethodGet, fmt.Sprintf("/api/requests/events?id=%d", kiz.RequestID), apiKey, nil, nil)
+	if status != http.StatusOK || !strings.HasPrefix(string(events), "event: done\ndata: {") ||
+		!strings.Contains(string(events), `"codes_received":3`) || strings.Count(string(events), "event:") != 1 {
+		t.Errorf("Неверный поток событий запроса КИЗ: код %d, тело: %s", status, events)
+	}
+
+	_, pdf := env.call(http.MethodGet, fmt.Sprintf("/api/requests/status?id=%d&format=pdf", kiz.RequestID), apiKey, nil, nil)
+	if !bytes.HasPrefix(pdf, []byte("%PDF")) {
+		t.Errorf("Ожидался PDF с этикетками, получено: %.100s", pdf)
+	}
+
+	// Ссылка на скачивание, которую бот отправляет, если файл не удалось передать в Telegram:
+	// подпись HMAC-SHA256 от "id:expires" ключом DOWNLOAD_LINK_SECRET, без API ключа
+	expires := time.Now().Add(time.Hour).Unix()
+	mac := hmac.New(sha256.New, []byte(contractDownloadSecret))
+	fmt.Fprintf(mac, "%d:%d", kiz.RequestID, expires)
+	link := fmt.Sprintf("/api/requests/download?id=%d&expires=%d&signature=%s", kiz.RequestID, expires, hex.EncodeToString(mac.Sum(nil)))
+	status, pdf = env.call(http.MethodGet, link, "", nil, nil)
+	if status != http.StatusOK || !bytes.HasPrefix(pdf, []byte("%PDF")) {
+		t.Errorf("Скачивание по подписанной ссылке: код %d, тело: %.100s", status, pdf)
+	}
+	if status, _ := env.call(http.MethodGet, link+"0", "", nil, nil); status != http.StatusForbidden {
+		t.Errorf("Ссылка с неверной подписью: код %d, ожидался 403", status)
+	}
+}
+
+// Разрешения ролей участников организации: наблюдатель видит организацию, но не управляет
+// участниками и реквизитами
+func TestContractRolePermissions(t *testing.T) {
+	env := newContractEnv(t)
+	const ownerTelegramID, viewerTelegramID, otherTelegramID = 300034, 300035, 300036
+	ownerKey := env.register(ownerTelegramID)
+	viewerKey := env.register(viewerTelegramID)
+	env.register(otherTelegramID)
+
+	var organizations struct {
+		Organizations []models.Organization `json:"organizations"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/organizations", ownerKey, nil, &organizations)
+	if len(organizations.Organizations) != 1 || organizations.Organizations[0].Role != models.OrgRoleOwner {
+		t.Fatalf("Зарегистрировавший должен быть владельцем организации: %+v", organizations.Organizations)
+	}
+	path := fmt.Sprintf("/api/organizations/%d", organizations.Organizations[0].ID)
+
+	// Участник вне организации не видит ее
+	env.expect(http.StatusNotFound, http.MethodGet, path, viewerKey, nil, nil)
+
+	env.expect(http.StatusOK, http.MethodPost, path+"/members", ownerKey,
+		map[string]any{"member_telegram_id": viewerTelegramID, "role": models.OrgRoleViewer}, nil)
+	env.expect(http.StatusOK, http.MethodGet, path, viewerKey, nil, nil)
+	env.expect(http.StatusForbidden, http.MethodPost, path+"/members", viewerKey,
+		map[string]any{"member_telegram_id": otherTelegramID, "role": models.OrgRoleViewer}, nil)
+	env.expect(http.StatusForbidden, http.MethodPost, path+"/requisites", viewerKey,
+		map[string]any{"bank_name": "Банк"}, nil)
+}
+
+// Управление API ключами только по API ключу: по одному telegram_id ключ не выдается,
+// не ротируется и не отзывается
+func TestContractAPIKeysRequireKey(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300037
+	apiKey := env.register(telegramID)
+
+	var keys struct {
+		Keys []models.APIKey `json:"keys"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/keys", apiKey, nil, &keys)
+	if len(keys.Keys) != 1 {
+		t.Fatalf("Ожидался ключ, выданный при регистрации: %+v", keys.Keys)
+	}
+	keyPath := fmt.Sprintf("/api/keys/%d", keys.Keys[0].ID)
+
+	for _, tc := range []struct {
+		method, path string
+		body         any
+	}{
+		{http.MethodGet, fmt.Sprintf("/api/keys?telegram_id=%d", telegramID), nil},
+		{http.MethodPost, "/api/keys", map[string]any{"telegram_id": telegramID, "label": "чужой"}},
+		{http.MethodPost, fmt.Sprintf("%s/rotate?telegram_id=%d", keyPath, telegramID), nil},
+		{http.MethodPost, fmt.Sprintf("%s/revoke?telegram_id=%d", keyPath, telegramID), nil},
+	} {
+		env.expect(http.StatusUnauthorized, tc.method, tc.path, "", tc.body, nil)
+	}
+
+	var created struct {
+		APIKey string `json:"api_key"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/keys", apiKey, map[string]any{"label": "интеграция"}, &created)
+	if created.APIKey == "" {
+		t.Fatal("Ключ не выдан авторизованному пользователю")
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/keys", apiKey, nil, &keys)
+	if len(keys.Keys) != 2 {
+		t.Errorf("Ключ без авторизации не должен создаваться: %+v", keys.Keys)
+	}
+}
+
+// Удаление аккаунта только по API ключу пользователя
+func TestContractDeleteAccountRequiresKey(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300038
+	apiKey := env.register(telegramID)
+
+	env.expect(http.StatusUnauthorized, http.MethodDelete, fmt.Sprintf("/api/users/me?telegram_id=%d", telegramID), "", nil, nil)
+	env.expect(http.StatusOK, http.MethodGet, "/api/keys", apiKey, nil, nil)
+
+	env.expect(http.StatusOK, http.MethodDelete, "/api/users/me", apiKey, nil, nil)
+	env.expect(http.StatusUnauthorized, http.MethodGet, "/api/keys", apiKey, nil, nil)
+}
+
+// Выгрузка данных только по API ключу пользователя
+func TestContractExportRequiresKey(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300039
+	apiKey := env.register(telegramID)
+
+	env.expect(http.StatusUnauthorized, http.MethodGet, fmt.Sprintf("/api/users/me/export?telegram_id=%d", telegramID), "", nil, nil)
+	env.expect(http.StatusAccepted, http.MethodGet, "/api/users/me/export", apiKey, nil, nil)
+}
+
+// Токеном Wildberries управляет только пользователь, авторизованный по API ключу
+func TestContractWildberriesTokenRequiresKey(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300046
+	apiKey := env.register(telegramID)
+
+	env.expect(http.StatusUnauthorized, http.MethodPost, "/api/users/wildberries", "",
+		map[string]any{"telegram_id": telegramID, "token": "чужой"}, nil)
+	env.expect(http.StatusUnauthorized, http.MethodGet, fmt.Sprintf("/api/users/wildberries?telegram_id=%d", telegramID), "", nil, nil)
+
+	env.expect(http.StatusOK, http.MethodPost, "/api/users/wildberries", apiKey, map[string]any{"token": "wb-token-0123456789"}, nil)
+	env.expect(http.StatusUnauthorized, http.MethodDelete, fmt.Sprintf("/api/users/wildberries?telegram_id=%d", telegramID), "", nil, nil)
+	var settings struct {
+		Wildberries models.WildberriesSettings `json:"wildberries"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/users/wildberries", apiKey, nil, &settings)
+	if !settings.Wildberries.Configured {
+		t.Fatal("Токен не должен удаляться без API ключа")
+	}
+	env.expect(http.StatusOK, http.MethodDelete, "/api/users/wildberries", apiKey, nil, nil)
+}
+
+// Ключом Ozon Seller API управляет только пользователь, авторизованный по API ключу
+func TestContractOzonCredentialsRequireKey(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300047
+	apiKey := env.register(telegramID)
+
+	env.expect(http.StatusUnauthorized, http.MethodPost, "/api/users/ozon", "",
+		map[string]any{"telegram_id": telegramID, "client_id": "1", "api_key": "чужой"}, nil)
+	env.expect(http.StatusUnauthorized, http.MethodGet, fmt.Sprintf("/api/users/ozon?telegram_id=%d", telegramID), "", nil, nil)
+
+	env.expect(http.StatusOK, http.MethodPost, "/api/users/ozon", apiKey,
+		map[string]any{"client_id": "123456", "api_key": "ozon-key-0123456789"}, nil)
+	env.expect(http.StatusUnauthorized, http.MethodDelete, fmt.Sprintf("/api/users/ozon?telegram_id=%d", telegramID), "", nil, nil)
+	var settings struct {
+		Ozon models.OzonSettings `json:"ozon"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/users/ozon", apiKey, nil, &settings)
+	if !settings.Ozon.Configured {
+		t.Fatal("Ключ не должен удаляться без API ключа")
+	}
+	env.expect(http.StatusOK, http.MethodDelete, "/api/users/ozon", apiKey, nil, nil)
+}
+
+// Если Stripe не создал сессию оплаты, платеж переводится на следующий провайдер маршрута
+func TestContractPaymentFailover(t *testing.T) {
+	stripeAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"unavailable"}}`, http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(stripeAPI.Close)
+	t.Setenv("STRIPE_URL", stripeAPI.URL)
+	t.Setenv("STRIPE_SECRET_KEY", "sk_test_contract")
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_contract")
+	t.Setenv("STRIPE_CURRENCIES", "RUB,USD")
+	t.Setenv("STRIPE_RETURN_URL", "https://example.com/return")
+	t.Setenv("PAYMENT_PROVIDERS", "stripe,robokassa")
+
+	env := newContractEnv(t)
+	const telegramID = 300040
+	apiKey := env.register(telegramID)
+
+	var payment struct {
+		RedirectURL string `json:"redirect_url"`
+		PaymentID   int    `json:"payment_id"`
+	}
+	env.expect(http.StatusOK, http.MethodPost, "/api/payments/create", apiKey, map[string]any{
+		"telegram_id": telegramID,
+		"amount":      150,
+	}, &payment)
+	if payment.PaymentID == 0 || !strings.Contains(payment.RedirectURL, "InvId="+strconv.Itoa(payment.PaymentID)) {
+		t.Fatalf("Платеж должен перейти на Robokassa: %+v", payment)
+	}
+	var status struct {
+		Payment models.Payment `json:"payment"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, fmt.Sprintf("/api/payments/%d?telegram_id=%d", payment.PaymentID, telegramID), apiKey, nil, &status)
+	if status.Payment.Provider != models.PaymentProviderRobokassa || status.Payment.Status != models.PaymentStatusPending {
+		t.Fatalf("Неверный платеж: %+v", status.Payment)
+	}
+
+	// Валюту принимает только Stripe: резервного провайдера нет, платеж отменяется
+	env.expect(http.StatusServiceUnavailable, http.MethodPost, "/api/payments/create", apiKey, map[string]any{
+		"telegram_id": telegramID,
+		"amount":      10,
+		"currency":    "USD",
+	}, nil)
+}
+
+// Партнер создает субаккаунт клиента, оплачивает заказ от его имени и получает сводку
+// оплат с вознаграждением; остальным пользователям операции партнера недоступны
+func TestContractPartners(t *testing.T) {
+	env := newContractEnv(t)
+	const partnerTelegramID, adminTelegramID = 300041, 300042
+	partnerKey := env.register(partnerTelegramID)
+	adminKey := env.register(adminTelegramID)
+	adminID, err := env.repo.UserIDByTelegram(context.Background(), adminTelegramID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.repo.SetAdmin(context.Background(), adminID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	env.expect(http.StatusForbidden, http.MethodGet, "/api/partners/accounts", partnerKey, nil, nil)
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/admin/partners", adminKey,
+		map[string]any{"telegram_id": partnerTelegramID, "name": "Агентство", "revenue_share": 120}, nil)
+	env.expect(http.StatusOK, http.MethodPost, "/api/admin/partners", adminKey,
+		map[string]any{"telegram_id": partnerTelegramID, "name": "Агентство", "revenue_share": 10}, nil)
+
+	// ИНН уже зарегистрированной организации нельзя взять в субаккаунт
+	env.expect(http.StatusConflict, http.MethodPost, "/api/partners/accounts", partnerKey,
+		map[string]any{"inn": contractINN}, nil)
+	var created struct {
+		Organization models.Organization `json:"organization"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/partners/accounts", partnerKey,
+		map[string]any{"inn": "500100732259"}, &created)
+	if created.Organization.ID == 0 || created.Organization.Role != models.OrgRoleOwner {
+		t.Fatalf("Партнер должен стать владельцем субаккаунта: %+v", created.Organization)
+	}
+
+	var accounts struct {
+		Accounts []models.PartnerAccount `json:"accounts"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/partners/accounts", partnerKey, nil, &accounts)
+	if len(accounts.Accounts) != 1 || accounts.Accounts[0].ID != created.Organization.ID || accounts.Accounts[0].Members != 1 {
+		t.Fatalf("Неверные субаккаунты: %+v", accounts.Accounts)
+	}
+
+	var payment struct {
+		RedirectURL string `json:"redirect_url"`
+		PaymentID   int    `json:"payment_id"`
+	}
+	env.expect(http.StatusOK, http.MethodPost, "/api/payments/create", partnerKey, map[string]any{
+		"telegram_id":     partnerTelegramID,
+		"amount":          1500,
+		"organization_id": created.Organization.ID,
+	}, &payment)
+	resp, err := http.Get(strings.ReplaceAll(payment.RedirectURL, " ", "%20"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "OK"+strconv.Itoa(payment.PaymentID)) {
+		t.Fatalf("Уведомление ResultURL не принято: %s", page)
+	}
+
+	today := time.Now().Format("2006-01-02")
+	billingPath := fmt.Sprintf("/api/partners/billing?from=%s&to=%s", today, today)
+	var billing struct {
+		Billing models.PartnerBilling `json:"billing"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, billingPath, partnerKey, nil, &billing)
+	lines, totals := billing.Billing.Lines, billing.Billing.Totals
+	if len(lines) != 1 || lines[0].OrganizationID != created.Organization.ID || lines[0].Payments != 1 ||
+		lines[0].Paid.String() != "1500.00" || lines[0].Share.String() != "150.00" ||
+		len(totals) != 1 || totals[0].Share.String() != "150.00" {
+		t.Fatalf("Неверная сводка оплат: %+v", billing.Billing)
+	}
+	status, data := env.call(http.MethodGet, billingPath+"&format=csv", partnerKey, nil, nil)
+	if status != http.StatusOK || !strings.Contains(string(data), "500100732259") {
+		t.Fatalf("Неверная сводка в CSV: %d %s", status, data)
+	}
+
+	env.expect(http.StatusForbidden, http.MethodGet, billingPath, adminKey, nil, nil)
+	env.expect(http.StatusBadRequest, http.MethodGet,
+		fmt.Sprintf("/api/partners/billing?from=%s&to=2020-01-01", today), partnerKey, nil, nil)
+
+	// Границы дней периода - по часовому поясу партнера, а не сервера
+	serverLocation := time.Local
+	t.Cleanup(func() { time.Local = serverLocation })
+	if time.Local, err = time.LoadLocation("Pacific/Pago_Pago"); err != nil {
+		t.Fatal(err)
+	}
+	kiritimati, err := time.LoadLocation("Pacific/Kiritimati")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.expect(http.StatusOK, http.MethodPost, "/api/users/timezone", partnerKey,
+		map[string]any{"timezone": kiritimati.String()}, nil)
+	for _, tc := range []struct {
+		day      time.Time
+		payments int
+	}{
+		{time.Now().In(kiritimati), 1},
+		{time.Now().In(kiritimati).AddDate(0, 0, -1), 0},
+	} {
+		day := tc.day.Format("2006-01-02")
+		env.expect(http.StatusOK, http.MethodGet, fmt.Sprintf("/api/partners/billing?from=%s&to=%s", day, day),
+			partnerKey, nil, &billing)
+		if len(billing.Billing.Lines) != tc.payments {
+			t.Errorf("За %s по часовому поясу партнера ожидалось платежей: %d, получена сводка %+v", day, tc.payments, billing.Billing)
+		}
+	}
+}
+
+// Сеансами управляет только пользователь, авторизованный по API ключу: по одному
+// telegram_id сеансы не показываются и не завершаются
+func TestContractSessionsRequireKey(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300043
+	apiKey := env.register(telegramID)
+	var created struct {
+		APIKey string `json:"api_key"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/keys", apiKey, map[string]any{"label": "второе устройство"}, &created)
+
+	env.expect(http.StatusUnauthorized, http.MethodGet, fmt.Sprintf("/api/sessions?telegram_id=%d", telegramID), "", nil, nil)
+	env.expect(http.StatusUnauthorized, http.MethodPost, fmt.Sprintf("/api/sessions/revoke-all?telegram_id=%d", telegramID), "", nil, nil)
+	env.expect(http.StatusOK, http.MethodGet, "/api/keys", created.APIKey, nil, nil)
+
+	var sessions struct {
+		Sessions []models.Session `json:"sessions"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/sessions", apiKey, nil, &sessions)
+	if len(sessions.Sessions) != 2 {
+		t.Fatalf("Ожидалось два сеанса: %+v", sessions.Sessions)
+	}
+	var revoked struct {
+		Revoked int `json:"revoked"`
+	}
+	env.expect(http.StatusOK, http.MethodPost, "/api/sessions/revoke-all", apiKey, nil, &revoked)
+	if revoked.Revoked != 1 {
+		t.Errorf("Ожидался один завершенный сеанс, получено %d", revoked.Revoked)
+	}
+	env.expect(http.StatusUnauthorized, http.MethodGet, "/api/keys", created.APIKey, nil, nil)
+	env.expect(http.StatusOK, http.MethodGet, "/api/keys", apiKey, nil, nil)
+}
+
+// Перебор telegram_id без API ключа блокирует адрес для запросов без ключа; запросы
+// с ключом не блокируются, администратор снимает блокировку
+func TestContractTelegramIDLockout(t *testing.T) {
+	t.Setenv("AUTH_MAX_FAILURES", "3")
+	env := newContractEnv(t)
+	const telegramID, adminTelegramID = 300044, 300045
+	env.register(telegramID)
+	adminKey := env.register(adminTelegramID)
+	adminID, err := env.repo.UserIDByTelegram(context.Background(), adminTelegramID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.repo.SetAdmin(context.Background(), adminID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	orders := func(telegramID int64) string { return fmt.Sprintf("/api/orders?telegram_id=%d", telegramID) }
+	env.expect(http.StatusOK, http.MethodGet, orders(telegramID), "", nil, nil)
+	for i := int64(1); i < 3; i++ {
+		if status, _ := env.call(http.MethodGet, orders(399000+i), "", nil, nil); status == http.StatusTooManyRequests {
+			t.Fatalf("Попытка %d не должна блокировать адрес", i)
+		}
+	}
+	env.expect(http.StatusTooManyRequests, http.MethodPost, "/api/orders", "",
+		map[string]any{"telegram_id": 399003, "items": []any{}}, nil)
+	env.expect(http.StatusTooManyRequests, http.MethodGet, orders(telegramID), "", nil, nil)
+	env.expect(http.StatusOK, http.MethodGet, "/api/organizations", adminKey, nil, nil)
+
+	var lockouts struct {
+		Lockouts []models.AuthFailure `json:"lockouts"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/admin/lockouts", adminKey, nil, &lockouts)
+	if len(lockouts.Lockouts) != 1 || lockouts.Lockouts[0].Scope != models.AuthScopeTelegramID {
+		t.Fatalf("Ожидалась блокировка адреса по telegram_id: %+v", lockouts.Lockouts)
+	}
+	env.expect(http.StatusOK, http.MethodDelete, "/api/admin/lockouts?ip="+lockouts.Lockouts[0].IP, adminKey, nil, nil)
+	env.expect(http.StatusOK, http.MethodGet, orders(telegramID), "", nil, nil)
+}
+
+// Организация запроса КИЗ определяется и по полям формы, и по JSON-объекту больше 1 МБ:
+// наблюдатель не запрашивает коды ни одним из способов
+func TestContractKIZRequestPermission(t *testing.T) {
+	env := newContractEnv(t)
+	const ownerTelegramID, viewerTelegramID = 300052, 300053
+	ownerKey := env.register(ownerTelegramID)
+	viewerKey := env.register(viewerTelegramID)
+
+	var organizations struct {
+		Organizations []models.Organization `json:"organizations"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/organizations", ownerKey, nil, &organizations)
+	organizationID := organizations.Organizations[0].ID
+	env.expect(http.StatusOK, http.MethodPost, fmt.Sprintf("/api/organizations/%d/members", organizationID), ownerKey,
+		map[string]any{"member_telegram_id": viewerTelegramID, "role": models.OrgRoleViewer}, nil)
+
+	post := func(contentType string, body io.Reader, apiKey string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, env.url+"/api/kizs", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, apiKey := range []string{viewerKey, ""} {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("telegram_id", strconv.Itoa(viewerTelegramID))
+		form.WriteField("organization_id", strconv.Itoa(organizationID))
+		part, err := form.CreateFormFile("file", "gtins.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(contractGTIN + "\n"))
+		form.Close()
+		if status := post(form.FormDataContentType(), &body, apiKey); status != http.StatusForbidden {
+			t.Errorf("Запрос КИЗ формой наблюдателем: код ответа %d, ожидался %d", status, http.StatusForbidden)
+		}
+	}
+
+	padded := fmt.Sprintf(`{"inn": "%s", "gtins": ["%s"], "batch": "%s", "telegram_id": %d, "organization_id": %d}`,
+		contractINN, contractGTIN, strings.Repeat("0", 2<<20), viewerTelegramID, organizationID)
+	if status := post("application/json", strings.NewReader(padded), ""); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Поля после 1 МБ: код ответа %d, ожидался %d", status, http.StatusRequestEntityTooLarge)
+	}
+}
+
+// Наблюдатель в организации видит шаблоны заказов организации, но не создает и не изменяет их
+func TestContractOrderTemplatePermissions(t *testing.T) {
+	env := newContractEnv(t)
+	const ownerTelegramID, memberTelegramID = 300048, 300049
+	ownerKey := env.register(ownerTelegramID)
+	memberKey := env.register(memberTelegramID)
+
+	var organizations struct {
+		Organizations []models.Organization `json:"organizations"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/organizations", ownerKey, nil, &organizations)
+	organizationID := organizations.Organizations[0].ID
+	setRole := func(role string) {
+		env.expect(http.StatusOK, http.MethodPost, fmt.Sprintf("/api/organizations/%d/members", organizationID), ownerKey,
+			map[string]any{"member_telegram_id": memberTelegramID, "role": role}, nil)
+	}
+
+	request := map[string]any{
+		"name":            "Молоко",
+		"organization_id": organizationID,
+		"product_group":   "milk",
+		"items":           []map[string]any{{"gtin": contractGTIN, "quantity": 2}},
+	}
+	setRole(models.OrgRoleOperator)
+	var created struct {
+		Template models.OrderTemplate `json:"template"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/orders/templates", memberKey, request, &created)
+	path := fmt.Sprintf("/api/orders/templates/%d", created.Template.ID)
+
+	setRole(models.OrgRoleViewer)
+	env.expect(http.StatusOK, http.MethodGet, path, memberKey, nil, nil)
+	env.expect(http.StatusForbidden, http.MethodPost, "/api/orders/templates", memberKey, request, nil)
+	env.expect(http.StatusForbidden, http.MethodPut, path, memberKey, request, nil)
+	env.expect(http.StatusForbidden, http.MethodDelete, path, memberKey, nil, nil)
+	env.expect(http.StatusForbidden, http.MethodPost, path+"/order", memberKey, nil, nil)
+}
+
+// Наблюдатель в организации видит расписания заказов организации, но не приостанавливает
+// и не удаляет их
+func TestContractOrderSchedulePermissions(t *testing.T) {
+	env := newContractEnv(t)
+	const ownerTelegramID, memberTelegramID = 300050, 300051
+	ownerKey := env.register(ownerTelegramID)
+	memberKey := env.register(memberTelegramID)
+
+	var organizations struct {
+		Organizations []models.Organization `json:"organizations"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/organizations", ownerKey, nil, &organizations)
+	organizationID := organizations.Organizations[0].ID
+	setRole := func(role string) {
+		env.expect(http.StatusOK, http.MethodPost, fmt.Sprintf("/api/organizations/%d/members", organizationID), ownerKey,
+			map[string]any{"member_telegram_id": memberTelegramID, "role": role}, nil)
+	}
+
+	setRole(models.OrgRoleOperator)
+	var created struct {
+		Schedule models.OrderSchedule `json:"schedule"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/orders/schedules", memberKey, map[string]any{
+		"name":            "Молоко по понедельникам",
+		"cron":            "0 9 * * MON",
+		"organization_id": organizationID,
+		"product_group":   "milk",
+		"items":           []map[string]any{{"gtin": contractGTIN, "quantity": 10}},
+	}, &created)
+	path := fmt.Sprintf("/api/orders/schedules/%d", created.Schedule.ID)
+
+	setRole(models.OrgRoleViewer)
+	env.expect(http.StatusOK, http.MethodGet, path, memberKey, nil, nil)
+	env.expect(http.StatusForbidden, http.MethodPost, path+"/pause", memberKey, nil, nil)
+	env.expect(http.StatusForbidden, http.MethodPost, path+"/resume", memberKey, nil, nil)
+	env.expect(http.StatusForbidden, http.MethodDelete, path, memberKey, nil, nil)
+
+	var schedule struct {
+		Schedule models.OrderSchedule `json:"schedule"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, path, memberKey, nil, &schedule)
+	if schedule.Schedule.Status != models.OrderScheduleStatusActive {
+		t.Errorf("Наблюдатель не должен менять статус расписания: %+v", schedule.Schedule)
+	}
+}
+
+// Временная ошибка Честного ЗНАКа: запрос КИЗ без товарной группы сохраняется
+// и повторяется по номеру
+func TestContractKIZRetry(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300002
+	apiKey := env.register(telegramID)
+	env.sandbox.AddFault(sandbox.Fault{Service: sandbox.ServiceChestnyZnak, Operation: "kizs", Mode: sandbox.FaultThrottle, Count: 1})
+
+	var failed contractKIZResponse
+	status, data := env.call(http.MethodPost, "/api/kizs", apiKey, map[string]any{
+		"telegram_id": telegramID,
+		"inn":         contractINN,
+		"gtins":       []string{contractGTIN},
+	}, &failed)
+	if status < 500 || failed.Status != "error" || failed.RequestID == 0 {
+		t.Fatalf("Ожидалась временная ошибка с номером запроса, код %d, тело: %s", status, data)
+	}
+
+	var retried contractKIZResponse
+	env.expect(http.StatusOK, http.MethodPost, fmt.Sprintf("/api/requests/%d/retry", failed.RequestID), apiKey, nil, &retried)
+	if retried.Status != "success" || retried.RequestID != failed.RequestID || len(retried.KIZs) != 1 {
+		t.Errorf("Неверный ответ повтора запроса: %+v", retried)
+	}
+}
+
+// Статус нескольких запросов одним вызовом: чужие и несуществующие запросы попадают в missing
+func TestContractRequestStatusBatch(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID, otherTelegramID = 300004, 300005
+	apiKey := env.register(telegramID)
+	otherKey := env.register(otherTelegramID)
+	kizRequest := func(key string, telegramID int64) contractKIZResponse {
+		var kiz contractKIZResponse
+		env.call(http.MethodPost, "/api/kizs", key, map[string]any{
+			"telegram_id": telegramID,
+			"inn":         contractINN,
+			"gtins":       []string{contractGTIN, contractGTIN},
+		}, &kiz)
+		if kiz.RequestID == 0 {
+			t.Fatalf("Запрос КИЗ не сохранен: %+v", kiz)
+		}
+		return kiz
+	}
+
+	completed := kizRequest(apiKey, telegramID)
+	env.sandbox.AddFault(sandbox.Fault{Service: sandbox.ServiceChestnyZnak, Operation: "kizs", Mode: sandbox.FaultThrottle, Count: 1})
+	failed := kizRequest(apiKey, telegramID)
+	foreign := kizRequest(otherKey, otherTelegramID)
+
+	var batch struct {
+		Requests []struct {
+			RequestID      int    `json:"request_id"`
+			Status         string `json:"status"`
+			CodesRequested int    `json:"codes_requested"`
+			CodesReceived  int    `json:"codes_received"`
+			Progress       int    `json:"progress"`
+			FileAvailable  bool   `json:"file_available"`
+		} `json:"requests"`
+		Missing []int `json:"missing"`
+	}
+	env.expect(http.StatusOK, http.MethodPost, "/api/requests/status/batch", apiKey, map[string]any{
+		"telegram_id": telegramID,
+		"ids":         []int{failed.RequestID, foreign.RequestID, completed.RequestID, 999999},
+	}, &batch)
+	if len(batch.Requests) != 2 || batch.Requests[0].RequestID != failed.RequestID || batch.Requests[1].RequestID != completed.RequestID {
+		t.Fatalf("Ожидались статусы двух своих запросов в порядке ids: %+v", batch.Requests)
+	}
+	if r := batch.Requests[0]; r.Status != "failed" || r.CodesRequested != 2 || r.Progress != 0 || r.FileAvailable {
+		t.Errorf("Неверный статус запроса с ошибкой: %+v", r)
+	}
+	if r := batch.Requests[1]; r.Status != "completed" || r.CodesReceived != 2 || r.Progress != 100 || !r.FileAvailable {
+		t.Errorf("Неверный статус выполненного запроса: %+v", r)
+	}
+	if len(batch.Missing) != 2 || batch.Missing[0] != foreign.RequestID || batch.Missing[1] != 999999 {
+		t.Errorf("Чужой и несуществующий запросы должны быть в missing: %v", batch.Missing)
+	}
+
+	// Чужой запрос не найден и по отдельности: ни статус с кодами, ни этикетки, ни ход выполнения
+	for _, path := range []string{
+		fmt.Sprintf("/api/requests/%d", foreign.RequestID),
+		fmt.Sprintf("/api/requests/status?id=%d&format=pdf", foreign.RequestID),
+		fmt.Sprintf("/api/requests/%d/status", foreign.RequestID),
+		fmt.Sprintf("/api/requests/events?id=%d", foreign.RequestID),
+	} {
+		env.expect(http.StatusNotFound, http.MethodGet, path, apiKey, nil, nil)
+	}
+
+	ids := make([]int, 101)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/requests/status/batch", apiKey, map[string]any{
+		"telegram_id": telegramID,
+		"ids":         ids,
+	}, nil)
+}
+
+// Условные запросы: статус запроса КИЗ и файл с этикетками передаются с ETag, неизменившийся
+// ответ - кодом 304 без тела
+func TestContractConditionalRequests(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300030
+	apiKey := env.register(telegramID)
+	env.sandbox.AddFault(sandbox.Fault{Service: sandbox.ServiceChestnyZnak, Operation: "kizs", Mode: sandbox.FaultThrottle, Count: 1})
+
+	var kiz contractKIZResponse
+	env.call(http.MethodPost, "/api/kizs", apiKey, map[string]any{
+		"telegram_id": telegramID,
+		"inn":         contractINN,
+		"gtins":       []string{contractGTIN},
+	}, &kiz)
+	if kiz.RequestID == 0 {
+		t.Fatalf("Запрос КИЗ не сохранен: %+v", kiz)
+	}
+
+	get := func(path string, header map[string]string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, env.url+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", apiKey)
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, data
+	}
+
+	statusPath := fmt.Sprintf("/api/requests/%d", kiz.RequestID)
+	resp, _ := get(statusPath, nil)
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("Статус запроса должен передаваться с ETag и Last-Modified: %d %v", resp.StatusCode, resp.Header)
+	}
+	resp, data := get(statusPath, map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusNotModified || len(data) != 0 || resp.Header.Get("ETag") != etag {
+		t.Errorf("If-None-Match с текущим ETag: код %d, тело: %s", resp.StatusCode, data)
+	}
+	if resp, _ = get(statusPath, map[string]string{"If-Modified-Since": lastModified}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-Modified-Since с текущим Last-Modified: код %d, ожидался 304", resp.StatusCode)
+	}
+	if resp, _ = get(statusPath, map[string]string{"If-None-Match": etag, "Accept-Language": "en"}); resp.StatusCode != http.StatusOK {
+		t.Errorf("Ответ на другом языке не должен совпадать по ETag: код %d", resp.StatusCode)
+	}
+
+	env.expect(http.StatusOK, http.MethodPost, fmt.Sprintf("/api/requests/%d/retry", kiz.RequestID), apiKey, nil, nil)
+	resp, _ = get(statusPath, map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("Измененный статус должен передаваться с новым ETag: код %d, ETag %s", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+
+	labelsPath := fmt.Sprintf("/api/requests/status?id=%d&format=pdf", kiz.RequestID)
+	resp, pdf := get(labelsPath, nil)
+	if resp.StatusCode != http.StatusOK || !bytes.HasPrefix(pdf, []byte("%PDF")) || resp.Header.Get("ETag") == "" {
+		t.Fatalf("Файл с этикетками должен передаваться с ETag: код %d, %v", resp.StatusCode, resp.Header)
+	}
+	resp, data = get(labelsPath, map[string]string{"If-None-Match": resp.Header.Get("ETag")})
+	if resp.StatusCode != http.StatusNotModified || len(data) != 0 {
+		t.Errorf("Повторное скачивание файла с ETag: код %d, ожидался 304", resp.StatusCode)
+	}
+}
+
+// Ожидание изменения статуса запроса КИЗ (long polling): ответ отправляется при изменении хода
+// выполнения, завершенный запрос - сразу, неизменившийся за время ожидания - кодом 304
+func TestContractRequestStatusWait(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300031
+	apiKey := env.register(telegramID)
+	ctx := context.Background()
+
+	userID, err := env.repo.UserIDByTelegram(ctx, telegramID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestID, err := env.repo.CreateKIZRequest(ctx, repository.NewKIZRequest{
+		UserID: userID, TelegramID: telegramID, INN: contractINN, RequestTime: time.Now(), CodesRequested: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type progress struct {
+		Message string `json:"message"`
+		Request struct {
+			Status        string `json:"status"`
+			CodesReceived int    `json:"codes_received"`
+		} `json:"request"`
+	}
+	get := func(path, etag string) (*http.Response, progress) {
+		req, err := http.NewRequest(http.MethodGet, env.url+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", apiKey)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body progress
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp, body
+	}
+
+	statusPath := fmt.Sprintf("/api/requests/%d/status", requestID)
+	resp, current := get(statusPath, "")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || current.Request.Status != "pending" || current.Message != "0 из 4 кодов получено" || etag == "" {
+		t.Fatalf("Статус без ожидания: код %d, %+v", resp.StatusCode, current)
+	}
+
+	start := time.Now()
+	if resp, _ = get(statusPath+"?wait=1s", etag); resp.StatusCode != http.StatusNotModified || time.Since(start) < time.Second {
+		t.Errorf("Неизменившийся статус: код %d через %v, ожидался 304 после ожидания", resp.StatusCode, time.Since(start))
+	}
+
+	// Ход выполнения сохраняет обработчик запроса; ожидающий клиент получает изменение
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		env.repo.SaveKIZProgress(ctx, requestID, repository.KIZProgress{CodesEmitted: 4, CodesDownloaded: 2})
+	}()
+	start = time.Now()
+	resp, current = get(statusPath+"?wait=30s", etag)
+	if resp.StatusCode != http.StatusOK || current.Request.CodesReceived != 2 || time.Since(start) > 10*time.Second {
+		t.Errorf("Изменение хода выполнения: код %d через %v, %+v", resp.StatusCode, time.Since(start), current)
+	}
+
+	// Известное клиенту состояние устарело: ответ отправляется без ожидания
+	start = time.Now()
+	if resp, _ = get(statusPath+"?wait=30s", etag); resp.StatusCode != http.StatusOK || time.Since(start) > 5*time.Second {
+		t.Errorf("Устаревший ETag: код %d через %v", resp.StatusCode, time.Since(start))
+	}
+
+	if status, _ := env.call(http.MethodGet, statusPath+"?wait=soon", apiKey, nil, nil); status != http.StatusBadRequest {
+		t.Errorf("Некорректное время ожидания: код %d, ожидался 400", status)
+	}
+}
+
+// Коды товарной группы выпускаются через заказ СУЗ; отказ СУЗ возвращается как ошибка запроса
+func TestContractOMSCodes(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300003
+	apiKey := env.register(telegramID)
+	request := map[string]any{
+		"telegram_id":   telegramID,
+		"inn":           contractINN,
+		"product_group": "shoes",
+		"gtins":         []string{contractGTIN, contractGTIN},
+	}
+
+	var kiz contractKIZResponse
+	env.expect(http.StatusOK, http.MethodPost, "/api/kizs", apiKey, request, &kiz)
+	if len(kiz.KIZs) != 2 {
+		t.Fatalf("Ожидалось 2 кода СУЗ: %+v", kiz)
+	}
+
+	env.sandbox.AddFault(sandbox.Fault{Service: sandbox.ServiceOMS, Operation: "order", Mode: sandbox.FaultReject, Count: 1})
+	status, data := env.call(http.MethodPost, "/api/kizs", apiKey, request, &kiz)
+	if status == http.StatusOK || kiz.Status != "error" {
+		t.Errorf("Отказ СУЗ должен возвращаться ошибкой, код %d, тело: %s", status, data)
+	}
+}
+
+// Повтор запроса после сбоя СУЗ продолжает прежний заказ с контрольной точки: новый заказ
+// не создается, а полученные коды не запрашиваются повторно
+func TestContractOMSResume(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300019
+	apiKey := env.register(telegramID)
+	env.sandbox.AddFault(sandbox.Fault{Service: sandbox.ServiceOMS, Operation: "close", Mode: sandbox.FaultError, Count: 1})
+
+	var failed contractKIZResponse
+	status, data := env.call(http.MethodPost, "/api/kizs", apiKey, map[string]any{
+		"telegram_id":   telegramID,
+		"inn":           contractINN,
+		"product_group": "shoes",
+		"gtins":         []string{contractGTIN, contractGTIN},
+	}, &failed)
+	if status < 500 || failed.RequestID == 0 {
+		t.Fatalf("Ожидалась временная ошибка с номером запроса, код %d, тело: %s", status, data)
+	}
+
+	// Новый заказ был бы отклонен
+	env.sandbox.AddFault(sandbox.Fault{Service: sandbox.ServiceOMS, Operation: "order", Mode: sandbox.FaultReject, Count: 1})
+	var retried contractKIZResponse
+	env.expect(http.StatusOK, http.MethodPost, fmt.Sprintf("/api/requests/%d/retry", failed.RequestID), apiKey, nil, &retried)
+	if retried.Status != "success" || len(retried.KIZs) != 2 {
+		t.Fatalf("Неверный ответ повтора запроса: %+v", retried)
+	}
+
+	checkpoints, err := env.repo.KIZCheckpoints(context.Background(), failed.RequestID)
+	if err != nil || len(checkpoints) != 0 {
+		t.Errorf("Контрольные точки выполненного запроса не удалены: %v, %v", checkpoints, err)
+	}
+}
+
+// Квоты тарифного плана: превышение месячной квоты кодов - 402, суточной квоты
+// запросов - 429; потребление доступно в GET /api/usage и после исчерпания квоты
+func TestContractPlanQuotas(t *testing.T) {
+	t.Setenv("DEFAULT_PLAN", "start")
+	env := newContractEnv(t)
+	if err := env.repo.SetPlan(context.Background(), &models.Plan{Name: "start", Title: "Старт", MonthlyCodes: 3, DailyRequests: 3}); err != nil {
+		t.Fatal(err)
+	}
+	const telegramID = 300004
+	apiKey := env.register(telegramID)
+	request := map[string]any{
+		"telegram_id": telegramID,
+		"inn":         contractINN,
+		"gtins":       []string{contractGTIN, contractGTIN},
+	}
+
+	env.expect(http.StatusOK, http.MethodPost, "/api/kizs", apiKey, request, nil)
+
+	var rejected struct {
+		Status string       `json:"status"`
+		Code   string       `json:"code"`
+		Quota  models.Quota `json:"quota"`
+	}
+	env.expect(http.StatusPaymentRequired, http.MethodPost, "/api/kizs", apiKey, request, &rejected)
+	if rejected.Code != "quota_exceeded" || rejected.Quota.Metric != models.QuotaCodes || rejected.Quota.Used != 2 ||
+		rejected.Quota.Remaining == nil || *rejected.Quota.Remaining != 1 {
+		t.Errorf("Неверный ответ при исчерпании квоты кодов: %+v", rejected)
+	}
+
+	env.expect(http.StatusOK, http.MethodGet, "/api/tariffs", apiKey, nil, nil)
+	status, data := env.call(http.MethodGet, "/api/tariffs", apiKey, nil, &rejected)
+	if status != http.StatusTooManyRequests || rejected.Quota.Metric != models.QuotaRequests || rejected.Quota.Used != 3 {
+		t.Errorf("Ожидалось исчерпание суточной квоты запросов, код %d, тело: %s", status, data)
+	}
+
+	var usage struct {
+		Plan   models.Plan    `json:"plan"`
+		Quotas []models.Quota `json:"quotas"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/usage", apiKey, nil, &usage)
+	if usage.Plan.Name != "start" || len(usage.Quotas) != 2 || usage.Quotas[0].Used != 2 || usage.Quotas[0].Limit != 3 {
+		t.Errorf("Неверное потребление: %+v", usage)
+	}
+}
+
+// Запрос пользователя приоритетного тарифного плана выполняется в приоритетной полосе очереди
+func TestContractKIZQueueLanes(t *testing.T) {
+	t.Setenv("DEFAULT_PLAN", "business")
+	env := newContractEnv(t)
+	const telegramID = 300018
+	apiKey := env.register(telegramID)
+	env.expect(http.StatusOK, http.MethodPost, "/api/kizs", apiKey,
+		map[string]any{"telegram_id": telegramID, "inn": contractINN, "gtins": []string{contractGTIN}}, nil)
+
+	_, metrics := env.call(http.MethodGet, "/metrics", "", nil, nil)
+	for _, line := range []string{
+		`znak_kiz_queue_wait_seconds_count{lane="premium"} 1`,
+		`znak_kiz_queue_wait_seconds_count{lane="standard"} 0`,
+		`znak_kiz_queue_depth{lane="premium"} 0`,
+		`znak_kiz_queue_workers{lane="standard"} 4`,
+	} {
+		if !strings.Contains(string(metrics), line) {
+			t.Errorf("В метриках нет строки %s", line)
+		}
+	}
+}
+
+// Фоновые задачи выполняет один экземпляр; остановленный ведущий уступает аренду другому
+func TestContractLeaderElection(t *testing.T) {
+	env := newContractEnv(t)
+	ctx := context.Background()
+	logger := log.New(io.Discard, "", 0)
+	first := service.New(env.repo, logger, service.Options{InstanceID: "first", LeaderTTL: time.Minute})
+	second := service.New(env.repo, logger, service.Options{InstanceID: "second", LeaderTTL: time.Minute})
+
+	if !first.ElectLeader(ctx) || !first.IsLeader() {
+		t.Fatal("Первый экземпляр не стал ведущим")
+	}
+	if second.ElectLeader(ctx) || second.IsLeader() {
+		t.Fatal("Второй экземпляр стал ведущим при действующей аренде первого")
+	}
+	if !first.ElectLeader(ctx) {
+		t.Error("Ведущий экземпляр не продлил аренду")
+	}
+
+	stopped, cancel := context.WithCancel(ctx)
+	cancel()
+	first.RunLeaderElection(stopped)
+	if first.IsLeader() {
+		t.Error("Остановленный экземпляр остался ведущим")
+	}
+	if !second.ElectLeader(ctx) {
+		t.Error("Второй экземпляр не захватил освобожденную аренду")
+	}
+}
+
+func TestContractUserLanguage(t *testing.T) {
+	env := newContractEnv(t)
+	apiKey := env.register(300005)
+
+	var failed struct {
+		Message string `json:"message"`
+	}
+	env.expect(http.StatusNotFound, http.MethodGet, "/api/orders/999999", apiKey, nil, &failed)
+	if failed.Message != "Заказ не найден" {
+		t.Errorf("По умолчанию сообщения должны быть на русском, получено: %q", failed.Message)
+	}
+
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/users/language", apiKey, map[string]string{"language": "de"}, nil)
+	env.expect(http.StatusOK, http.MethodPost, "/api/users/language", apiKey, map[string]string{"language": "en"}, nil)
+
+	env.expect(http.StatusNotFound, http.MethodGet, "/api/orders/999999", apiKey, nil, &failed)
+	if failed.Message != "Order not found" {
+		t.Errorf("Сообщение должно быть на выбранном пользователем языке, получено: %q", failed.Message)
+	}
+	if status, data := env.call(http.MethodDelete, "/api/usage", apiKey, nil, nil); status != http.StatusMethodNotAllowed ||
+		string(data) != "Method not allowed\n" {
+		t.Errorf("Текстовая ошибка должна быть переведена, код %d, тело: %q", status, data)
+	}
+}
+
+// Часовой пояс пользователя: по умолчанию DEFAULT_TIMEZONE, неизвестный пояс - 400
+func TestContractUserTimezone(t *testing.T) {
+	env := newContractEnv(t)
+	apiKey := env.register(300006)
+
+	var response struct {
+		Timezone string `json:"timezone"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/users/timezone", apiKey, nil, &response)
+	if response.Timezone != "Europe/Moscow" {
+		t.Errorf("Часовой пояс по умолчанию: %q, ожидался Europe/Moscow", response.Timezone)
+	}
+
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/users/timezone", apiKey, map[string]string{"timezone": "Mars/Olympus"}, nil)
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/users/timezone", apiKey, map[string]string{"timezone": "Local"}, nil)
+	env.expect(http.StatusOK, http.MethodPost, "/api/users/timezone", apiKey, map[string]string{"timezone": "Asia/Vladivostok"}, nil)
+
+	env.expect(http.StatusOK, http.MethodGet, "/api/users/timezone", apiKey, nil, &response)
+	if response.Timezone != "Asia/Vladivostok" {
+		t.Errorf("Сохраненный часовой пояс: %q, ожидался Asia/Vladivostok", response.Timezone)
+	}
+}
+
+// Импорт пользователей администратором и регистрация приглашенного по параметру start ссылки
+func TestContractUserInvitation(t *testing.T) {
+	env := newContractEnv(t)
+	adminKey := env.register(300007)
+	adminID, err := env.repo.UserIDByTelegram(context.Background(), 300007)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.repo.SetAdmin(context.Background(), adminID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	csv := "ИНН;Email;Telegram\n500100732259;client@example.com;@client_one\n" + contractINN + ";;\n"
+	req, err := http.NewRequest(http.MethodPost, env.url+"/api/admin/users/import", strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("X-API-Key", adminKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var imported struct {
+		Users []service.UserImportResult `json:"users"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&imported); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Импорт: код ответа %d, ошибка %v", resp.StatusCode, err)
+	}
+	if len(imported.Users) != 2 || imported.Users[0].UserID == 0 || imported.Users[0].Code == "" {
+		t.Fatalf("Неверный итог импорта: %+v", imported.Users)
+	}
+	if imported.Users[1].Error == "" {
+		t.Errorf("Строка с ИНН зарегистрированной организации должна быть отклонена: %+v", imported.Users[1])
+	}
+
+	var registered struct {
+		UserID int    `json:"user_id"`
+		APIKey string `json:"api_key"`
+	}
+	env.expect(http.StatusOK, http.MethodPost, "/api/users/register", "",
+		map[string]any{"telegram_id": 300008, "referral_code": imported.Users[0].Code}, &registered)
+	if registered.UserID != imported.Users[0].UserID || registered.APIKey == "" {
+		t.Errorf("Аккаунт Telegram должен быть привязан к созданному пользователю %d: %+v", imported.Users[0].UserID, registered)
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/organizations", registered.APIKey, nil, nil)
+
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/users/register", "",
+		map[string]any{"telegram_id": 300009, "invitation": imported.Users[0].Code}, nil)
+}
+
+// Объединение повторно зарегистрированного пользователя с основным: заказы и API ключи
+// переносятся, аккаунт Telegram присоединенного привязывается к основному
+func TestContractUserMerge(t *testing.T) {
+	env := newContractEnv(t)
+	ctx := context.Background()
+	adminKey := env.register(300010)
+	targetKey := env.register(300011)
+	sourceKey := env.register(300012)
+	userID := func(telegramID int64) int {
+		id, err := env.repo.UserIDByTelegram(ctx, telegramID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	adminID, targetID, sourceID := userID(300010), userID(300011), userID(300012)
+	if err := env.repo.SetAdmin(ctx, adminID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	env.expect(http.StatusCreated, http.MethodPost, "/api/orders", sourceKey, map[string]any{
+		"telegram_id":   300012,
+		"product_group": "milk",
+		"items":         []map[string]any{{"gtin": contractGTIN, "quantity": 1}},
+	}, nil)
+
+	merge := map[string]any{"source_user_id": sourceID, "target_user_id": targetID, "use_source_telegram": true}
+	var merged struct {
+		UserID     int              `json:"user_id"`
+		TelegramID int64            `json:"telegram_id"`
+		Moved      map[string]int64 `json:"moved"`
+	}
+	env.expect(http.StatusOK, http.MethodPost, "/api/admin/users/merge", adminKey, merge, &merged)
+	if merged.UserID != targetID || merged.TelegramID != 300012 || merged.Moved["orders"] != 1 || merged.Moved["api_keys"] != 1 {
+		t.Errorf("Неверный итог объединения: %+v", merged)
+	}
+	if userID(300012) != targetID || userID(300011) != 0 {
+		t.Errorf("Аккаунт Telegram присоединенного пользователя должен быть привязан к основному %d", targetID)
+	}
+
+	for _, apiKey := range []string{targetKey, sourceKey} {
+		var orders struct {
+			Orders []struct {
+				ID int `json:"id"`
+			} `json:"orders"`
+		}
+		env.expect(http.StatusOK, http.MethodGet, "/api/orders", apiKey, nil, &orders)
+		if len(orders.Orders) != 1 {
+			t.Errorf("Заказ присоединенного пользователя должен быть доступен по ключам основного: %+v", orders)
+		}
+	}
+
+	env.expect(http.StatusNotFound, http.MethodPost, "/api/admin/users/merge", adminKey, merge, nil)
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/admin/users/merge", adminKey,
+		map[string]any{"source_user_id": targetID, "target_user_id": targetID}, nil)
+}
+
+// Объявления: действующие возвращаются клиентам, рассылка ставится в outbox порциями
+// только пользователям, согласившимся на нее
+func TestContractAnnouncements(t *testing.T) {
+	// Сообщения Telegram только ставятся в outbox: фоновая доставка в тесте не запущена
+	t.Setenv("TELEGRAM_BOT_TOKEN", "contract")
+	env := newContractEnv(t)
+	ctx := context.Background()
+	adminKey := env.register(300022)
+	subscriberKey := env.register(300023)
+	otherKey := env.register(300024)
+	adminID, err := env.repo.UserIDByTelegram(ctx, 300022)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.repo.SetAdmin(ctx, adminID, true); err != nil {
+		t.Fatal(err)
+	}
+	env.expect(http.StatusOK, http.MethodPost, "/api/users/notifications", subscriberKey,
+		map[string]any{"announcements": true}, nil)
+	env.expect(http.StatusOK, http.MethodPost, "/api/users/notifications", otherKey,
+		map[string]any{"failures": false}, nil)
+
+	announcement := map[string]any{
+		"title":     "Плановые работы Честного ЗНАКа",
+		"text":      "С 22:00 до 23:00 заказ кодов недоступен",
+		"level":     "warning",
+		"broadcast": true,
+	}
+	env.expect(http.StatusForbidden, http.MethodPost, "/api/admin/announcements", subscriberKey, announcement, nil)
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/admin/announcements", adminKey,
+		map[string]any{"title": "Без текста", "level": "urgent"}, nil)
+
+	var created struct {
+		Announcement models.Announcement `json:"announcement"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/admin/announcements", adminKey, announcement, &created)
+	env.expect(http.StatusCreated, http.MethodPost, "/api/admin/announcements", adminKey, map[string]any{
+		"title":     "Новая товарная группа",
+		"text":      "Скоро",
+		"starts_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+		"broadcast": true,
+	}, nil)
+
+	var active struct {
+		Announcements []models.Announcement `json:"announcements"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/announcements", "", nil, &active)
+	if len(active.Announcements) != 1 || active.Announcements[0].ID != created.Announcement.ID {
+		t.Fatalf("Запланированное объявление не должно возвращаться до начала: %+v", active.Announcements)
+	}
+
+	if queued := env.svc.BroadcastAnnouncements(ctx, 1); queued != 1 {
+		t.Errorf("Поставлено сообщений: %d, ожидалось 1", queued)
+	}
+	if queued := env.svc.BroadcastAnnouncements(ctx, 1); queued != 0 {
+		t.Errorf("Рассылка должна завершиться после всех получателей, поставлено еще %d", queued)
+	}
+	var outbox struct {
+		Messages []models.OutboxMessage `json:"messages"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/admin/outbox?status=pending", adminKey, nil, &outbox)
+	subscriberID, err := env.repo.UserIDByTelegram(ctx, 300023)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox.Messages) != 1 || outbox.Messages[0].UserID != subscriberID ||
+		!strings.Contains(string(outbox.Messages[0].Payload), "Плановые работы") {
+		t.Errorf("Объявление должно быть поставлено в очередь только подписчику %d: %+v", subscriberID, outbox.Messages)
+	}
+
+	path := "/api/admin/announcements/" + strconv.Itoa(created.Announcement.ID)
+	env.expect(http.StatusOK, http.MethodDelete, path, adminKey, nil, nil)
+	env.expect(http.StatusNotFound, http.MethodDelete, path, adminKey, nil, nil)
+	env.expect(http.StatusOK, http.MethodGet, "/api/announcements", "", nil, &active)
+	if len(active.Announcements) != 0 {
+		t.Errorf("Снятое объявление не должно возвращаться: %+v", active.Announcements)
+	}
+}
+
+// Обращения в поддержку: пользователь видит только свои обращения, ответ поддержки
+// ставится в outbox сообщением пользователю
+func TestContractSupportTickets(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "contract")
+	env := newContractEnv(t)
+	ctx := context.Background()
+	userKey := env.register(300025)
+	adminKey := env.register(300026)
+	adminID, err := env.repo.UserIDByTelegram(ctx, 300026)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.repo.SetAdmin(ctx, adminID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/support/tickets", userKey,
+		map[string]any{"description": " "}, nil)
+	env.expect(http.StatusNotFound, http.MethodPost, "/api/support/tickets", userKey,
+		map[string]any{"description": "Коды не пришли", "request_id": 999999}, nil)
+
+	var created struct {
+		Ticket models.SupportTicket `json:"ticket"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/support/tickets", userKey,
+		map[string]any{"description": "Не могу скачать коды"}, &created)
+	if created.Ticket.Status != models.SupportTicketStatusOpen {
+		t.Errorf("Статус нового обращения: %q, ожидался open", created.Ticket.Status)
+	}
+
+	path := "/api/support/tickets/" + strconv.Itoa(created.Ticket.ID)
+	env.expect(http.StatusOK, http.MethodGet, path, userKey, nil, nil)
+	env.expect(http.StatusNotFound, http.MethodGet, path, adminKey, nil, nil)
+	env.expect(http.StatusForbidden, http.MethodGet, "/api/admin/support/tickets", userKey, nil, nil)
+
+	adminPath := "/api/admin/support/tickets/" + strconv.Itoa(created.Ticket.ID)
+	env.expect(http.StatusBadRequest, http.MethodPost, adminPath, adminKey,
+		map[string]any{"status": "closed"}, nil)
+	env.expect(http.StatusOK, http.MethodPost, adminPath, adminKey,
+		map[string]any{"status": "resolved", "reply": "Ссылка на скачивание обновлена"}, nil)
+
+	var ticket struct {
+		Ticket models.SupportTicket `json:"ticket"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, path, userKey, nil, &ticket)
+	if ticket.Ticket.Status != models.SupportTicketStatusResolved || ticket.Ticket.Reply == "" {
+		t.Errorf("Статус и ответ поддержки не сохранены: %+v", ticket.Ticket)
+	}
+
+	var outbox struct {
+		Messages []models.OutboxMessage `json:"messages"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/admin/outbox?status=pending", adminKey, nil, &outbox)
+	if len(outbox.Messages) != 1 || outbox.Messages[0].UserID != created.Ticket.UserID ||
+		!strings.Contains(string(outbox.Messages[0].Payload), "Ссылка на скачивание обновлена") {
+		t.Errorf("Ответ поддержки должен быть поставлен в очередь пользователю %d: %+v", created.Ticket.UserID, outbox.Messages)
+	}
+}
+
+// Страница статуса: зависший запрос КИЗ открывает инцидент, который закрывается после
+// получения кодов и остается в истории
+func TestContractStatusPage(t *testing.T) {
+	env := newContractEnv(t)
+	ctx := context.Background()
+
+	type statusPage struct {
+		Status     string                   `json:"status"`
+		Components []models.ComponentStatus `json:"components"`
+		Incidents  []models.StatusIncident  `json:"incidents"`
+	}
+	component := func(page statusPage, name string) string {
+		for _, c := range page.Components {
+			if c.Component == name {
+				return c.Status
+			}
+		}
+		return ""
+	}
+
+	env.svc.RefreshStatus(ctx)
+	var page statusPage
+	env.expect(http.StatusOK, http.MethodGet, "/api/status", "", nil, &page)
+	if page.Status != models.ComponentStatusOK || component(page, service.StatusComponentKIZQueue) != models.ComponentStatusOK ||
+		component(page, service.StatusComponentOMS) != models.ComponentStatusOK {
+		t.Fatalf("Без нагрузки все компоненты должны работать: %+v", page)
+	}
+
+	requestID, err := env.repo.CreateKIZRequest(ctx, repository.NewKIZRequest{
+		TelegramID:  300027,
+		INN:         "7707083893",
+		RequestTime: time.Now().Add(-2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.svc.RefreshStatus(ctx)
+	env.expect(http.StatusOK, http.MethodGet, "/api/status", "", nil, &page)
+	if page.Status != models.ComponentStatusError || len(page.Incidents) != 1 ||
+		page.Incidents[0].Component != service.StatusComponentKIZQueue || page.Incidents[0].ResolvedAt != nil {
+		t.Fatalf("Запрос КИЗ без кодов два часа должен открыть инцидент: %+v", page)
+	}
+
+	if _, err := env.repo.SaveKIZResult(ctx, requestID, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	env.svc.RefreshStatus(ctx)
+	env.expect(http.StatusOK, http.MethodGet, "/api/status", "", nil, &page)
+	if page.Status != models.ComponentStatusOK || len(page.Incidents) != 1 || page.Incidents[0].ResolvedAt == nil {
+		t.Errorf("После выдачи кодов инцидент должен закрыться и остаться в истории: %+v", page)
+	}
+}
+
+// Версии API: /api/v2 обслуживает те же ресурсы с единым форматом ошибок, прежние
+// эндпоинты бота объявлены устаревшими и недоступны в /api/v2
+func TestContractAPIVersions(t *testing.T) {
+	env := newContractEnv(t)
+	apiKey := env.register(300028)
+
+	var usage struct {
+		Status string `json:"status"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/v2/usage", apiKey, nil, &usage)
+	if usage.Status != "success" {
+		t.Errorf("Ресурсы версии 1 должны быть доступны в /api/v2: %+v", usage)
+	}
+
+	var failed struct {
+		Status  string `json:"status"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	env.expect(http.StatusMethodNotAllowed, http.MethodDelete, "/api/v2/usage", apiKey, nil, &failed)
+	if failed.Status != "error" || failed.Code != "method_not_allowed" || failed.Message != "Метод не поддерживается" {
+		t.Errorf("Текстовая ошибка в /api/v2 должна возвращаться в JSON: %+v", failed)
+	}
+	env.expect(http.StatusNotFound, http.MethodGet, "/api/v2/orders/999999", apiKey, nil, &failed)
+	if failed.Code != "not_found" || failed.Message != "Заказ не найден" {
+		t.Errorf("Ошибка сервиса в /api/v2 должна содержать код: %+v", failed)
+	}
+	env.expect(http.StatusNotFound, http.MethodPost, "/api/v2/v1/payments", apiKey, map[string]any{}, nil)
+
+	for path, successor := range map[string]string{"/pay": "/api/v2/payments/create", "/api/usage": ""} {
+		req, err := http.NewRequest(http.MethodPost, env.url+path+"?telegram_id=300028", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		deprecated := resp.Header.Get("Deprecation") != "" && resp.Header.Get("Sunset") != ""
+		if deprecated != (successor != "") || !strings.Contains(resp.Header.Get("Link"), successor) {
+			t.Errorf("%s: неверные заголовки устаревшего эндпоинта: %v", path, resp.Header)
+		}
+	}
+}
+
+// Ответы в XML для учетных систем: формат выбирается заголовком Accept, ответ содержит те же
+// поля, что и JSON, ошибки /api/v2 передаются в едином формате
+func TestContractXMLResponses(t *testing.T) {
+	env := newContractEnv(t)
+	apiKey := env.register(300029)
+
+	get := func(path, accept string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, env.url+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", apiKey)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, data
+	}
+
+	resp, data := get("/api/usage", "application/xml")
+	var usage dto.Usage
+	if err := dto.DecodeXML(bytes.NewReader(data), &usage); err != nil {
+		t.Fatalf("Ответ не в формате XML: %v, тело: %s", err, data)
+	}
+	if resp.StatusCode != http.StatusOK || usage.Status != "success" ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "application/xml") || !strings.Contains(resp.Header.Get("Vary"), "Accept") {
+		t.Errorf("Неверный ответ в XML: %d %v %s", resp.StatusCode, resp.Header, data)
+	}
+
+	resp, data = get("/api/usage", "application/xml;q=0.5, application/json")
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		t.Errorf("Предпочтительный формат JSON не выбран: %s", data)
+	}
+
+	var failed dto.Error
+	resp, data = get("/api/v2/orders/999999", "text/xml")
+	if err := dto.DecodeXML(bytes.NewReader(data), &failed); err != nil {
+		t.Fatalf("Ошибка не в формате XML: %v, тело: %s", err, data)
+	}
+	if resp.StatusCode != http.StatusNotFound || failed.Status != "error" || failed.Code != "not_found" || failed.Message != "Заказ не найден" {
+		t.Errorf("Неверная ошибка в XML: %d %+v", resp.StatusCode, failed)
+	}
+
+	failed = dto.Error{}
+	resp, data = get("/api/v2/unknown", "application/xml")
+	if err := dto.DecodeXML(bytes.NewReader(data), &failed); err != nil {
+		t.Fatalf("Текстовая ошибка не в формате XML: %v, тело: %s", err, data)
+	}
+	if resp.StatusCode != http.StatusNotFound || failed.Status != "error" || failed.Code != "not_found" {
+		t.Errorf("Неверная текстовая ошибка в XML: %d %s", resp.StatusCode, data)
+	}
+}
+
+// Имперсонация: администратор вызывает API от имени пользователя по временному токену,
+// изменения без разрешения на запись и управление ключами недоступны, запросы записываются в аудит
+func TestContractImpersonation(t *testing.T) {
+	env := newContractEnv(t)
+	ctx := context.Background()
+	adminKey := env.register(300020)
+	userKey := env.register(300021)
+	adminID, err := env.repo.UserIDByTelegram(ctx, 300020)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.repo.SetAdmin(ctx, adminID, true); err != nil {
+		t.Fatal(err)
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/orders", userKey, map[string]any{
+		"telegram_id":   300021,
+		"product_group": "milk",
+		"items":         []map[string]any{{"gtin": contractGTIN, "quantity": 1}},
+	}, nil)
+
+	start := map[string]any{"telegram_id": 300021, "reason": "Обращение №42"}
+	env.expect(http.StatusForbidden, http.MethodPost, "/api/admin/impersonations", userKey, start, nil)
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/admin/impersonations", adminKey,
+		map[string]any{"telegram_id": 300020, "reason": "Проверка"}, nil)
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/admin/impersonations", adminKey,
+		map[string]any{"telegram_id": 300021, "reason": "Обращение №42", "expires_in": "24h"}, nil)
+
+	var started struct {
+		Token         string               `json:"token"`
+		Impersonation models.Impersonation `json:"impersonation"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/admin/impersonations", adminKey, start, &started)
+	if started.Token == "" || started.Impersonation.AllowWrite {
+		t.Fatalf("Неверный ответ начала имперсонации: %+v", started)
+	}
+
+	impersonated := func(method, path, apiKey string) *http.Response {
+		req, err := http.NewRequest(method, env.url+path, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+		req.Header.Set("X-Impersonation-Token", started.Token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := impersonated(http.MethodGet, "/api/orders", adminKey)
+	var orders struct {
+		Orders []struct {
+			ID int `json:"id"`
+		} `json:"orders"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&orders); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Заказы пользователя: код ответа %d, ошибка %v", resp.StatusCode, err)
+	}
+	if len(orders.Orders) != 1 || resp.Header.Get("X-Impersonated-User") != strconv.Itoa(started.Impersonation.UserID) {
+		t.Errorf("Запрос должен выполняться от имени пользователя: %+v, заголовок %q",
+			orders, resp.Header.Get("X-Impersonated-User"))
+	}
+
+	for _, denied := range []struct{ method, path string }{
+		{http.MethodPost, "/api/orders"},
+		{http.MethodGet, "/api/keys"},
+		{http.MethodGet, "/api/admin/audit"},
+	} {
+		if resp := impersonated(denied.method, denied.path, adminKey); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s %s в режиме имперсонации: код ответа %d, ожидался 403", denied.method, denied.path, resp.StatusCode)
+		}
+	}
+	if resp := impersonated(http.MethodGet, "/api/orders", userKey); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Токен должен действовать только с ключом выдавшего его администратора: код ответа %d", resp.StatusCode)
+	}
+
+	var audit struct {
+		Entries []repository.AuditEntry `json:"entries"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/admin/audit?action=impersonate", adminKey, nil, &audit)
+	if len(audit.Entries) != 4 || audit.Entries[len(audit.Entries)-1].After == nil {
+		t.Errorf("Каждый запрос в режиме имперсонации должен быть записан в аудит: %+v", audit.Entries)
+	}
+
+	path := "/api/admin/impersonations/" + strconv.Itoa(started.Impersonation.ID)
+	env.expect(http.StatusOK, http.MethodDelete, path, adminKey, nil, nil)
+	env.expect(http.StatusNotFound, http.MethodDelete, path, adminKey, nil, nil)
+	if resp := impersonated(http.MethodGet, "/api/orders", adminKey); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Завершенный сеанс не должен действовать: код ответа %d", resp.StatusCode)
+	}
+}
+
+// Заказ по файлу со списком GTIN: проверка файла со стоимостью и создание заказа по
+// идентификатору проверки
+func TestContractOrderUpload(t *testing.T) {
+	env := newContractEnv(t)
+	apiKey := env.register(300012)
+
+	upload := func(file string, fields map[string]string, out any) int {
+		t.Helper()
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for name, value := range fields {
+			form.WriteField(name, value)
+		}
+		part, err := form.CreateFormFile("file", "gtins.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(file))
+		form.Close()
+
+		req, err := http.NewRequest(http.MethodPost, env.url+"/api/kizs/upload", &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("X-API-Key", apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("ответ не в формате JSON: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	var checked struct {
+		Preview service.OrderPreview `json:"preview"`
+	}
+	if status := upload("gtin;count\n"+contractGTIN+";5\n04601234567890;1\n"+contractGTIN+";2\n", nil, &checked); status != http.StatusOK {
+		t.Fatalf("Проверка файла: код ответа %d", status)
+	}
+	preview := checked.Preview
+	if preview.PreviewID != "" || len(preview.Errors) != 1 || preview.Errors[0].Row != 3 {
+		t.Errorf("Строка с неверным GTIN должна быть отмечена ошибкой: %+v", preview)
+	}
+	if len(preview.Items) != 1 || preview.TotalCodes != 7 || preview.TotalAmount <= 0 {
+		t.Errorf("Повторяющиеся GTIN должны объединяться в позицию с расчетом стоимости: %+v", preview)
+	}
+
+	file := "gtin;count\n" + contractGTIN + ";7\n"
+	if status := upload(file, nil, &checked); status != http.StatusOK || checked.Preview.PreviewID == "" {
+		t.Fatalf("Проверка файла без ошибок: код ответа %d, %+v", status, checked.Preview)
+	}
+
+	var failed map[string]any
+	if status := upload(file+contractGTIN+";1\n", map[string]string{"preview_id": checked.Preview.PreviewID}, &failed); status != http.StatusConflict {
+		t.Errorf("Измененный после проверки файл должен отклоняться: код ответа %d", status)
+	}
+
+	var created struct {
+		Order models.Order `json:"order"`
+	}
+	if status := upload(file, map[string]string{"preview_id": checked.Preview.PreviewID}, &created); status != http.StatusCreated {
+		t.Fatalf("Создание заказа: код ответа %d", status)
+	}
+	if created.Order.ID == 0 || created.Order.TotalAmount != checked.Preview.TotalAmount {
+		t.Errorf("Заказ должен соответствовать проверенному файлу: %+v", created.Order)
+	}
+}
+
+// Шаблоны заказов и повтор заказа: новый заказ с позициями шаблона или прежнего заказа
+func TestContractOrderTemplates(t *testing.T) {
+	env := newContractEnv(t)
+	apiKey := env.register(300013)
+	otherKey := env.register(300014)
+
+	var created struct {
+		Template models.OrderTemplate `json:"template"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/orders/templates", apiKey, map[string]any{
+		"name":          "Молоко еженедельно",
+		"product_group": "milk",
+		"items":         []map[string]any{{"gtin": contractGTIN, "quantity": 4}},
+	}, &created)
+	template := created.Template
+	if template.ID == 0 || len(template.Items) != 1 || template.Items[0].Quantity != 4 {
+		t.Fatalf("Неверный шаблон: %+v", template)
+	}
+
+	path := fmt.Sprintf("/api/orders/templates/%d", template.ID)
+	env.expect(http.StatusNotFound, http.MethodGet, path, otherKey, nil, nil)
+	env.expect(http.StatusOK, http.MethodPut, path, apiKey, map[string]any{
+		"name":          "Молоко",
+		"product_group": "milk",
+		"items":         []map[string]any{{"gtin": contractGTIN, "quantity": 2}},
+	}, &created)
+	if created.Template.Name != "Молоко" || created.Template.Items[0].Quantity != 2 {
+		t.Errorf("Шаблон не изменен: %+v", created.Template)
+	}
+
+	var order struct {
+		Order models.Order `json:"order"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, path+"/order", apiKey, nil, &order)
+	if order.Order.ID == 0 || order.Order.Status != "created" || order.Order.ProductGroup != "milk" ||
+		len(order.Order.Items) != 1 || order.Order.Items[0].Quantity != 2 {
+		t.Fatalf("Неверный заказ по шаблону: %+v", order.Order)
+	}
+
+	var repeated struct {
+		Order models.Order `json:"order"`
+	}
+	env.expect(http.StatusNotFound, http.MethodPost, fmt.Sprintf("/api/orders/%d/reorder", order.Order.ID), otherKey, nil, nil)
+	env.expect(http.StatusCreated, http.MethodPost, fmt.Sprintf("/api/orders/%d/reorder", order.Order.ID), apiKey, nil, &repeated)
+	if repeated.Order.ID == order.Order.ID || repeated.Order.TotalAmount != order.Order.TotalAmount ||
+		len(repeated.Order.Items) != 1 || repeated.Order.Items[0].GTIN != order.Order.Items[0].GTIN {
+		t.Errorf("Повтор должен создавать новый заказ с теми же позициями: %+v", repeated.Order)
+	}
+
+	var list struct {
+		Templates []models.OrderTemplate `json:"templates"`
+	}
+	env.expect(http.StatusOK, http.MethodDelete, path, apiKey, nil, nil)
+	env.expect(http.StatusOK, http.MethodGet, "/api/orders/templates", apiKey, nil, &list)
+	if len(list.Templates) != 0 {
+		t.Errorf("Удаленный шаблон остался в списке: %+v", list.Templates)
+	}
+}
+
+// Расписания заказов: проверка выражения cron, пауза и возобновление
+func TestContractOrderSchedules(t *testing.T) {
+	env := newContractEnv(t)
+	apiKey := env.register(300016)
+	otherKey := env.register(300017)
+
+	request := map[string]any{
+		"name":          "Молоко по понедельникам",
+		"cron":          "0 9 * * MON",
+		"product_group": "milk",
+		"items":         []map[string]any{{"gtin": contractGTIN, "quantity": 10}},
+	}
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/orders/schedules", apiKey, map[string]any{
+		"name":  "Неверное",
+		"cron":  "0 25 * * *",
+		"items": request["items"],
+	}, nil)
+
+	var resp struct {
+		Schedule models.OrderSchedule `json:"schedule"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/orders/schedules", apiKey, request, &resp)
+	schedule := resp.Schedule
+	if schedule.ID == 0 || schedule.Status != models.OrderScheduleStatusActive || schedule.NextRunAt == nil ||
+		!schedule.NextRunAt.After(time.Now()) {
+		t.Fatalf("Неверное расписание: %+v", schedule)
+	}
+	if weekday := schedule.NextRunAt.In(time.FixedZone("MSK", 3*60*60)).Weekday(); weekday != time.Monday {
+		t.Errorf("Следующий запуск должен быть в понедельник, получено %s", weekday)
+	}
+
+	path := fmt.Sprintf("/api/orders/schedules/%d", schedule.ID)
+	env.expect(http.StatusNotFound, http.MethodGet, path, otherKey, nil, nil)
+	env.expect(http.StatusNotFound, http.MethodPost, path+"/pause", otherKey, nil, nil)
+
+	var paused struct {
+		Schedule models.OrderSchedule `json:"schedule"`
+	}
+	env.expect(http.StatusOK, http.MethodPost, path+"/pause", apiKey, nil, &paused)
+	if paused.Schedule.Status != models.OrderScheduleStatusPaused || paused.Schedule.NextRunAt != nil {
+		t.Errorf("Приостановленное расписание не должно иметь следующего запуска: %+v", paused.Schedule)
+	}
+	env.expect(http.StatusConflict, http.MethodPost, path+"/pause", apiKey, nil, nil)
+
+	request["cron"] = "@daily"
+	request["version"] = schedule.Version
+	env.expect(http.StatusConflict, http.MethodPut, path, apiKey, request, nil)
+	delete(request, "version")
+	env.expect(http.StatusOK, http.MethodPut, path, apiKey, request, &paused)
+	if paused.Schedule.Cron != "@daily" || paused.Schedule.Status != models.OrderScheduleStatusPaused ||
+		paused.Schedule.NextRunAt != nil {
+		t.Errorf("Изменение не должно возобновлять расписание: %+v", paused.Schedule)
+	}
+
+	env.expect(http.StatusOK, http.MethodPost, path+"/resume", apiKey, nil, &resp)
+	if resp.Schedule.Status != models.OrderScheduleStatusActive || resp.Schedule.NextRunAt == nil {
+		t.Errorf("Возобновленное расписание должно иметь следующий запуск: %+v", resp.Schedule)
+	}
+
+	var list struct {
+		Schedules []models.OrderSchedule `json:"schedules"`
+	}
+	env.expect(http.StatusOK, http.MethodDelete, path, apiKey, nil, nil)
+	env.expect(http.StatusOK, http.MethodGet, "/api/orders/schedules", apiKey, nil, &list)
+	if len(list.Schedules) != 0 {
+		t.Errorf("Удаленное расписание осталось в списке: %+v", list.Schedules)
+	}
+}
+
+// Корзина: позиции сохраняются между запросами, оформление создает заказ и платеж
+func TestContractCart(t *testing.T) {
+	env := newContractEnv(t)
+	apiKey := env.register(300015)
+
+	var resp struct {
+		Cart models.Cart `json:"cart"`
+	}
+	for _, quantity := range []int{2, 3} {
+		env.expect(http.StatusOK, http.MethodPost, "/api/cart/items", apiKey,
+			map[string]any{"gtin": contractGTIN, "quantity": quantity}, &resp)
+	}
+	env.expect(http.StatusOK, http.MethodGet, "/api/cart", apiKey, nil, &resp)
+	if len(resp.Cart.Items) != 1 || resp.Cart.TotalCodes != 5 || resp.Cart.TotalAmount <= 0 {
+		t.Fatalf("Коды одного GTIN должны складываться в одну позицию: %+v", resp.Cart)
+	}
+	total := resp.Cart.TotalAmount
+	env.expect(http.StatusNotFound, http.MethodDelete, "/api/cart/items/04601234567894", apiKey, nil, nil)
+
+	var checkout struct {
+		Order       models.Order `json:"order"`
+		PaymentID   int          `json:"payment_id"`
+		RedirectURL string       `json:"redirect_url"`
+	}
+	env.expect(http.StatusCreated, http.MethodPost, "/api/cart/checkout", apiKey, nil, &checkout)
+	if checkout.Order.ID == 0 || checkout.Order.TotalAmount != total || checkout.PaymentID == 0 || checkout.RedirectURL == "" {
+		t.Fatalf("Оформление должно создавать заказ и платеж: %+v", checkout)
+	}
+
+	env.expect(http.StatusOK, http.MethodGet, "/api/cart", apiKey, nil, &resp)
+	if len(resp.Cart.Items) != 0 || resp.Cart.TotalAmount != 0 {
+		t.Errorf("После оформления корзина должна быть пустой: %+v", resp.Cart)
+	}
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/cart/checkout", apiKey, nil, nil)
+}
+
+// Пакетный платеж: один платеж Robokassa на два заказа, доли заказов в статусе платежа
+func TestContractBatchPayment(t *testing.T) {
+	env := newContractEnv(t)
+	const telegramID = 300032
+	apiKey := env.register(telegramID)
+	otherKey := env.register(300033)
+
+	createOrder := func(apiKey string, telegramID int64, quantity int) int {
+		var resp struct {
+			Order models.Order `json:"order"`
+		}
+		env.expect(http.StatusCreated, http.MethodPost, "/api/orders", apiKey, map[string]any{
+			"telegram_id":   telegramID,
+			"product_group": "milk",
+			"items":         []map[string]any{{"gtin": contractGTIN, "quantity": quantity}},
+		}, &resp)
+		return resp.Order.ID
+	}
+	first, second := createOrder(apiKey, telegramID, 3), createOrder(apiKey, telegramID, 2)
+	foreign := createOrder(otherKey, 300033, 1)
+
+	batch := func(orders ...[2]any) map[string]any {
+		items := make([]map[string]any, len(orders))
+		for i, order := range orders {
+			items[i] = map[string]any{"order_id": order[0], "amount": order[1]}
+		}
+		return map[string]any{"telegram_id": telegramID, "orders": items}
+	}
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/payments/batch", apiKey, batch(), nil)
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/payments/batch", apiKey,
+		batch([2]any{first, 300}, [2]any{first, 300}), nil)
+	env.expect(http.StatusNotFound, http.MethodPost, "/api/payments/batch", apiKey,
+		batch([2]any{first, 300}, [2]any{foreign, 100}), nil)
+	// Сумма по заказу положительна и не больше его неоплаченного остатка
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/payments/batch", apiKey,
+		batch([2]any{first, 0}, [2]any{second, 100}), nil)
+	env.expect(http.StatusBadRequest, http.MethodPost, "/api/payments/batch", apiKey,
+		batch([2]any{first, 300.01}), nil)
+
+	var payment struct {
+		PaymentID   int    `json:"payment_id"`
+		RedirectURL string `json:"redirect_url"`
+	}
+	env.expect(http.StatusOK, http.MethodPost, "/api/payments/batch", apiKey,
+		batch([2]any{first, 300}, [2]any{second, 199.99}), &payment)
+	if payment.PaymentID == 0 || !strings.Contains(payment.RedirectURL, "OutSum=499.99&") {
+		t.Fatalf("Сумма пакетного платежа должна быть суммой заказов: %+v", payment)
+	}
+
+	resp, err := http.Get(strings.ReplaceAll(payment.RedirectURL, " ", "%20"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "OK"+strconv.Itoa(payment.PaymentID)) {
+		t.Fatalf("Уведомление ResultURL не принято: %s", page)
+	}
+
+	var status struct {
+		Payment models.Payment `json:"payment"`
+	}
+	env.expect(http.StatusOK, http.MethodGet, fmt.Sprintf("/api/payments/%d?telegram_id=%d", payment.PaymentID, telegramID),
+		apiKey, nil, &status)
+	orders := status.Payment.Orders
+	if status.Payment.Status != models.PaymentStatusCompleted || status.Payment.OrderID != 0 || len(orders) != 2 ||
+		orders[0].OrderID != first || orders[0].Amount.String() != "300.00" || orders[1].OrderID != second ||
+		orders[1].Amount.String() != "199.99" || !orders[0].Refunded.IsZero() || !orders[1].Refunded.IsZero() {
+		t.Fatalf("Неверный пакетный платеж: %+v", status.Payment)
+	}
+
+	// Оплаченный заказ нельзя оплатить повторно; без суммы оплачивается остаток заказа,
+	// а доля ожидающего оплаты платежа тоже уменьшает остаток
+	env.expect(http.StatusConflict, http.MethodPost, "/api/payments/batch", apiKey, map[string]any{
+		"telegram_id": telegramID, "orders": []map[string]any{{"order_id": first}},
+	}, nil)
+	var rest struct {
+		RedirectURL string `json:"redirect_url"`
+	}
+	env.expect(http.StatusOK, http.MethodPost, "/api/payments/batch", apiKey, map[string]any{
+		"telegram_id": telegramID, "orders": []map[string]any{{"order_id": second}},
+	}, &rest)
+	if !strings.Contains(rest.RedirectURL, "OutSum=0.01&") {
+		t.Fatalf("Без суммы должен оплачиваться остаток заказа: %s", rest.RedirectURL)
+	}
+	env.expect(http.StatusConflict, http.MethodPost, "/api/payments/batch", apiKey,
+		batch([2]any{second, 0.01}), nil)
+
+	// Возврат по заказу поддерживается только для платежей Stripe
+	adminID, err := env.repo.UserIDByTelegram(context.Background(), 300033)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.repo.SetAdmin(context.Background(), adminID, true); err != nil {
+		t.Fatal(err)
+	}
+	refund := fmt.Sprintf("/api/admin/payments/%d/orders/%d/refund", payment.PaymentID, second)
+	env.expect(http.StatusForbidden, http.MethodPost, refund, apiKey, nil, nil)
+	env.expect(http.StatusConflict, http.MethodPost, refund, otherKey, map[string]any{"amount": 100}, nil)
+}
+
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata" // Часовые пояса пользователей не зависят от zoneinfo образа
+
+	"project-znak/internal/cache"
+	"project-znak/internal/catalog"
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/config"
+	"project-znak/internal/dadata"
+	"project-znak/internal/edo"
+	"project-znak/internal/fiscal"
+	grpcapi "project-znak/internal/grpc"
+	httpapi "project-znak/internal/http"
+	"project-znak/internal/keystore"
+	"project-znak/internal/labels"
+	"project-znak/internal/mailer"
+	"project-znak/internal/oms"
+	"project-znak/internal/ozon"
+	"project-znak/internal/repository"
+	"project-znak/internal/robokassa"
+	"project-znak/internal/service"
+	"project-znak/internal/stripe"
+	"project-znak/internal/telegram"
+	"project-znak/internal/tracing"
+	"project-znak/internal/transport"
+	"project-znak/internal/webhook"
+	"project-znak/internal/wildberries"
+	applog "project-znak/pkg/logger"
+	"project-znak/pkg/middleware"
+)
+
+// Период запуска очистки временных файлов
+const tempCleanupInterval = time.Hour
+
+// Период поиска запросов КИЗ, прерванных сбоем процесса
+const kizRecoveryInterval = time.Minute
+
+// Наибольшая пауза между попытками подключения к зависимостям при запуске
+const maxStartupRetryInterval = 15 * time.Second
+
+func main() {
+	// Время хранится в БД и возвращается API в UTC независимо от часового пояса сервера;
+	// в часовой пояс пользователя оно переводится только при отображении
+	time.Local = time.UTC
+
+	// Настройка логгера
+	logger := log.New(os.Stdout, "[API] ", log.LstdFlags|log.Lshortfile)
+
+	// Драйвер БД из командной строки: go run ./cmd/server -db=sqlite
+	dbDriver := flag.String("db", "", "драйвер БД: postgres или sqlite (по умолчанию DB_DRIVER)")
+	flag.Parse()
+	if *dbDriver != "" {
+		os.Setenv("DB_DRIVER", *dbDriver)
+	}
+
+	// Загрузка конфигурации
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+
+	// Значения секретов не должны попадать в журнал
+	logger.SetOutput(cfg.Secrets.RedactWriter(os.Stdout))
+	log.SetOutput(cfg.Secrets.RedactWriter(os.Stderr))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Трассировка OpenTelemetry
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Endpoint:    cfg.Observability.OTLPEndpoint,
+		ServiceName: cfg.Observability.ServiceName,
+		SampleRatio: cfg.Observability.SampleRatio,
+	})
+	if err != nil {
+		logger.Fatalf("Ошибка настройки трассировки: %v", err)
+	}
+
+	// Журнал доступа в формате JSON для сбора в ELK
+	if err := applog.Init(cfg.Logging.Level, cfg.Logging.File); err != nil {
+		logger.Fatalf("Ошибка настройки журнала: %v", err)
+	}
+	accessLog := applog.GetLogger()
+	accessLog.SetOutput(cfg.Secrets.RedactWriter(accessLog.Out))
+
+	// Отчеты об ошибках и паниках отправляются в Sentry, если задан SENTRY_DSN
+	if err := applog.InitSentry(applog.SentryConfig{
+		DSN:         cfg.Logging.SentryDSN,
+		Environment: cfg.Logging.SentryEnvironment,
+		Release:     cfg.Logging.SentryRelease,
+		SampleRate:  cfg.Logging.SentrySampleRate,
+	}); err != nil {
+		logger.Fatal(err)
+	}
+	var panicReporter middleware.PanicReporter
+	if applog.SentryEnabled() {
+		panicReporter = middleware.SentryReporter
+	}
+
+	// HTTP сервер запускается сразу: пока сервис ожидает БД и Redis, проверка готовности
+	// возвращает статус starting, а запросы к API - 503
+	startup := httpapi.NewStartupHandler()
+	server := &http.Server{
+		Addr:         ":" + cfg.Server.Port,
+		Handler:      startup,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+
+	go func() {
+		logger.Printf("Сервер запущен на порту %s", cfg.Server.Port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatalf("Ошибка сервера: %v", err)
+		}
+	}()
+
+	// Внешние клиенты
+	cacheClient := cache.New(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB, cfg.Redis.Timeout, func(err error) {
+		logger.Printf("Redis недоступен, кэш временно отключен: %v", err)
+	})
+	defer cacheClient.Close()
+
+	// Без Redis сервис работает без кэша, поэтому Redis ожидается параллельно с остальным
+	// запуском и его недоступность запуск не прерывает
+	if cacheClient.Enabled() {
+		go func() {
+			if err := waitFor(ctx, logger, "Redis", cfg.Startup, cacheClient.Ping); err != nil && ctx.Err() == nil {
+				logger.Printf("ВНИМАНИЕ: Redis недоступен при запуске, кэш временно отключен: %v", err)
+			}
+		}()
+	}
+
+	// Инициализация базы данных. Postgres может запускаться одновременно с сервисом
+	// (docker-compose), поэтому подключение повторяется до истечения STARTUP_MAX_WAIT.
+	// SQLite для локальной разработки открывается сразу.
+	var db *sql.DB
+	if cfg.Database.Driver == config.DatabaseDriverSQLite {
+		logger.Printf("ВНИМАНИЕ: БД SQLite %s предназначена только для разработки и демонстрации", cfg.Database.SQLitePath)
+		db, err = repository.OpenSQLite(ctx, cfg.Database.SQLitePath)
+	} else {
+		err = waitFor(ctx, logger, "БД", cfg.Startup, func(ctx context.Context) error {
+			var err error
+			db, err = repository.Open(ctx, cfg.Database.DSN(), func() string {
+				return cfg.Secrets.Get("DB_PASSWORD")
+			})
+			return err
+		})
+	}
+	if ctx.Err() != nil {
+		logger.Println("Запуск прерван")
+		return
+	} else if err != nil {
+		logger.Fatalf("Ошибка инициализации БД: %v", err)
+	}
+	defer db.Close()
+	repo := repository.New(db)
+
+	// Реплика для тяжелых запросов чтения; при ее недоступности чтение идет на основной сервер
+	if dsn := cfg.Database.ReplicaDSN(); dsn != "" {
+		replica, err := repository.OpenReplica(dsn, func() string {
+			return cfg.Secrets.Get("DB_PASSWORD")
+		})
+		if err != nil {
+			logger.Fatalf("Ошибка подключения к реплике БД: %v", err)
+		}
+		defer replica.Close()
+		repo.SetReplica(replica)
+	}
+
+	// Создание таблиц, если они не существуют
+	if err := repo.Migrate(ctx); err != nil {
+		logger.Fatalf("Ошибка создания таблиц: %v", err)
+	}
+
+	// Архив запросов к Честному ЗНАКу и СУЗ
+	var archive func(context.Context, transport.Exchange)
+	if cfg.Archive.Retention > 0 {
+		archive = service.ArchiveExchanges(repo, logger)
+	}
+
+	opts, err := serviceOptions(cfg, cacheClient, archive, logger)
+	if err != nil {
+		logger.Fatalf("Ошибка инициализации сервиса: %v", err)
+	}
+	svc := service.New(repo, logger, opts)
+
+	// Запуск завершен: запросы передаются обработчику REST API
+	handler := httpapi.NewHandler(svc, logger, accessLog, cfg.RateLimit, cfg.Compression, cfg.RequestLimits, cfg.APIVersions, cfg.Proxies, panicReporter)
+	startup.Ready(handler)
+	logger.Print("Сервис готов к обработке запросов")
+
+	// Запуск gRPC сервера на отдельном порту
+	grpcServer, grpcHealth := grpcapi.NewServer(svc, logger)
+	grpcListener, err := net.Listen("tcp", ":"+cfg.Server.GRPCPort)
+	if err != nil {
+		logger.Fatalf("Ошибка запуска gRPC сервера: %v", err)
+	}
+	go func() {
+		logger.Printf("gRPC сервер запущен на порту %s", cfg.Server.GRPCPort)
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			logger.Fatalf("Ошибка gRPC сервера: %v", err)
+		}
+	}()
+
+	// Выбор ведущего экземпляра: фоновые задачи ниже выполняет только он
+	svc.ElectLeader(ctx)
+	go svc.RunLeaderElection(ctx)
+
+	// Периодическая очистка временных файлов
+	go svc.RunTempCleanup(ctx, tempCleanupInterval, cfg.TempFileTTL)
+
+	// Продолжение запросов КИЗ, прерванных сбоем процесса, с контрольных точек эмиссии
+	go svc.RunKIZRecovery(ctx, kizRecoveryInterval)
+
+	// Опрос результатов обработки документов, отправленных в Честный ЗНАК
+	go svc.RunDocumentStatusPolling(ctx, cfg.DocumentPollInterval)
+
+	// Сверка платежей, по которым не пришло уведомление Robokassa
+	go svc.RunPaymentReconciliation(ctx, cfg.Payment.ReconcileInterval, cfg.Payment.ReconcileAfter)
+
+	// Отмена платежей, не оплаченных в срок
+	go svc.RunPaymentExpiration(ctx, cfg.Payment.ExpirationInterval)
+
+	// Регистрация чеков по проведенным платежам в онлайн-кассе
+	go svc.RunFiscalization(ctx, cfg.Fiscal.Interval)
+
+	// Проверка ответа покупателей на УПД, отправленные через ЭДО
+	go svc.RunUPDStatusPolling(ctx, cfg.EDO.PollInterval)
+
+	// Безвозвратное удаление аккаунтов по истечении срока хранения
+	go svc.RunUserPurge(ctx, cfg.Erasure.PurgeInterval)
+
+	// Удаление записей архива запросов по истечении срока хранения
+	if cfg.Archive.Retention > 0 {
+		go svc.RunArchiveCleanup(ctx, cfg.Archive.CleanupInterval, cfg.Archive.Retention)
+	}
+
+	// Доставка уведомлений, записанных в outbox вместе с изменением состояния
+	go svc.RunOutboxDispatcher(ctx, cfg.Outbox.Interval)
+
+	// Рассылка объявлений в Telegram порциями через outbox
+	go svc.RunAnnouncementBroadcast(ctx, cfg.Announcements.Interval, cfg.Announcements.Batch)
+
+	// Проверка компонентов и учет инцидентов для страницы статуса
+	go svc.RunStatusMonitor(ctx, cfg.StatusInterval)
+
+	// Ежедневные и еженедельные отчеты пользователей
+	go svc.RunReportScheduler(ctx, cfg.ReportInterval)
+
+	// Повторяющиеся заказы по расписаниям пользователей
+	go svc.RunOrderScheduler(ctx, cfg.OrderScheduleInterval)
+
+	// Обновление дневных сводок аналитики
+	if cfg.AnalyticsRefreshInterval > 0 {
+		go svc.RunAnalyticsRefresh(ctx, cfg.AnalyticsRefreshInterval)
+	}
+
+	// Предупреждения об окончании срока действия сертификата ЭЦП
+	go svc.RunCertificateMonitor(ctx, cfg.API.CertCheckInterval)
+
+	// Обновление секретов из хранилища. Пароли БД и Robokassa применяются без перезапуска,
+	// остальные секреты - после перезапуска сервиса.
+	cfg.Secrets.OnChange("DB_PASSWORD", func(string) {
+		logger.Print("Пароль БД обновлен, новые соединения открываются с новым паролем")
+	})
+	cfg.Secrets.OnChange("ROBOKASSA_PASSWORD", func(password string) {
+		svc.SetRobokassaPassword(password)
+		logger.Print("Пароль Robokassa обновлен")
+	})
+	cfg.Secrets.OnChange("ROBOKASSA_PASSWORD2", func(password string) {
+		svc.SetRobokassaResultPassword(password)
+		logger.Print("Пароль #2 Robokassa обновлен")
+	})
+	go cfg.Secrets.Run(ctx, cfg.SecretsRefreshInterval, func(err error) {
+		logger.Printf("Ошибка обновления секретов: %v", err)
+	})
+
+	// Перечитывание конфигурации по SIGHUP
+	go reloadConfig(ctx, logger, handler)
+
+	// Ожидание сигнала остановки
+	<-ctx.Done()
+	logger.Println("Завершение работы сервера...")
+
+	// Graceful shutdown
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	grpcHealth.Shutdown()
+	grpcServer.GracefulStop()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Printf("Ошибка завершения: %v", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Printf("Ошибка отправки трассировок: %v", err)
+	}
+	applog.FlushSentry(5 * time.Second)
+	logger.Println("Сервер остановлен")
+}
+
+// Настройки сервиса: клиенты внешних систем и параметры из конфигурации. Используются
+// сервером и контрактными тестами REST API.
+func serviceOptions(cfg *config.Config, cacheClient *cache.Cache, archive func(context.Context, transport.Exchange), logger *log.Logger) (service.Options, error) {
+	var keys keystore.Keystore
+	var err error
+	switch cfg.Keystore.Driver {
+	case keystore.DriverPEM:
+		keys, err = keystore.OpenPEM(cfg.API.PrivateKeyPath, cfg.API.CertPath)
+	case keystore.DriverPKCS11:
+		keys, err = keystore.OpenPKCS11(keystore.PKCS11Config{
+			Module:    cfg.Keystore.PKCS11Module,
+			KeyID:     cfg.Keystore.PKCS11KeyID,
+			PIN:       cfg.Keystore.PIN,
+			Mechanism: cfg.Keystore.PKCS11Mechanism,
+			CertPath:  cfg.API.CertPath,
+			Tool:      cfg.Keystore.PKCS11Tool,
+			Timeout:   cfg.Keystore.Timeout,
+		})
+	case keystore.DriverCryptoPro:
+		keys, err = keystore.OpenCryptoPro(keystore.CryptoProConfig{
+			Thumbprint: cfg.Keystore.CryptoProThumbprint,
+			PIN:        cfg.Keystore.PIN,
+			CertPath:   cfg.API.CertPath,
+			BinDir:     cfg.Keystore.CryptoProBinDir,
+			Timeout:    cfg.Keystore.Timeout,
+		})
+	}
+	if err != nil {
+		return service.Options{}, fmt.Errorf("ошибка открытия хранилища ключа ЭЦП %s: %w", cfg.Keystore.Driver, err)
+	}
+	// Прокси-сервер и настройки TLS для соединений с Честным ЗНАКом и СУЗ
+	var chestnyZnakTransport, omsTransport http.RoundTripper
+	chestnyZnakTransport, err = transport.New(transport.Config(cfg.API.Transport))
+	if err != nil {
+		return service.Options{}, fmt.Errorf("ошибка настройки соединений с Честным ЗНАКом: %w", err)
+	}
+	omsTransport, err = transport.New(transport.Config(cfg.OMS.Transport))
+	if err != nil {
+		return service.Options{}, fmt.Errorf("ошибка настройки соединений с СУЗ: %w", err)
+	}
+	if archive != nil {
+		chestnyZnakTransport = transport.Archive("chestnyznak", chestnyZnakTransport, archive)
+		omsTransport = transport.Archive("oms", omsTransport, archive)
+	}
+	defaultTimezone, err := time.LoadLocation(cfg.DefaultTimezone)
+	if err != nil {
+		return service.Options{}, fmt.Errorf("ошибка загрузки часового пояса %s: %w", cfg.DefaultTimezone, err)
+	}
+
+	chestnyZnakClient := chestnyznak.NewClient(cfg.API.URL, keys, cfg.API.Timeout, chestnyZnakTransport)
+	if !chestnyZnakClient.Enabled() {
+		logger.Print("ВНИМАНИЕ: Хранилище ключа ЭЦП не настроено, коды маркировки генерируются заглушкой")
+	}
+
+	// Эмиссия кодов через СУЗ подписывается той же ЭЦП, что и запросы к Честному ЗНАКу
+	omsGroups := make(map[string]oms.ProductGroup)
+	for group, token := range cfg.OMS.ClientTokens {
+		omsGroups[group] = oms.ProductGroup{ClientToken: token, TemplateID: cfg.OMS.TemplateIDs[group]}
+	}
+	var omsSigner oms.Signer
+	if chestnyZnakClient.Enabled() {
+		omsSigner = chestnyZnakClient
+	}
+	omsClient := oms.NewClient(cfg.OMS.URL, cfg.OMS.OMSID, omsGroups, omsSigner, cfg.OMS.Timeout, omsTransport)
+
+	// Онлайн-касса для чеков по 54-ФЗ; без настройки чеки не регистрируются
+	var fiscalProvider fiscal.Provider
+	if cfg.Fiscal.Provider == fiscal.ProviderATOL {
+		fiscalProvider = fiscal.NewATOLClient(cfg.Fiscal.URL, cfg.Fiscal.Login, cfg.Fiscal.Password, cfg.Fiscal.GroupCode,
+			fiscal.Company{
+				INN:            cfg.Fiscal.INN,
+				Email:          cfg.Fiscal.Email,
+				PaymentAddress: cfg.Fiscal.PaymentAddress,
+				TaxSystem:      cfg.Fiscal.TaxSystem,
+				VAT:            cfg.Fiscal.VAT,
+			}, cfg.Fiscal.Timeout)
+	}
+
+	// Оператор ЭДО для отправки УПД; без настройки УПД не формируются
+	var edoProvider edo.Provider
+	switch cfg.EDO.Provider {
+	case edo.ProviderDiadoc:
+		edoProvider = edo.NewDiadocClient(cfg.EDO.URL, cfg.EDO.ClientID, cfg.EDO.Login, cfg.EDO.Password, cfg.EDO.Timeout)
+	case edo.ProviderSBIS:
+		edoProvider = edo.NewSBISClient(cfg.EDO.URL, cfg.EDO.Login, cfg.EDO.Password, cfg.EDO.Timeout)
+	}
+
+	return service.Options{
+		Cache:       cacheClient,
+		Catalog:     catalog.NewClient(cfg.Catalog.URL, cfg.Catalog.APIKey, cfg.Catalog.Timeout),
+		DaData:      dadata.NewClient(cfg.DaData.URL, cfg.DaData.APIKey, cfg.DaData.Timeout),
+		Mailer:      mailer.NewClient(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From),
+		ChestnyZnak: chestnyZnakClient,
+		OMS:         omsClient,
+		Robokassa:   robokassa.NewClient(cfg.Payment.OpStateURL, cfg.Payment.RobokassaLogin, cfg.Payment.RobokassaPassword, cfg.Payment.Timeout),
+		Stripe:      stripe.NewClient(cfg.Payment.StripeURL, cfg.Payment.StripeSecretKey, cfg.Payment.StripeWebhookSecret, cfg.Payment.StripeTimeout),
+		Telegram:    telegram.NewClient(cfg.Telegram.BotToken, cfg.Telegram.Timeout),
+		Webhook:     webhook.NewClient(cfg.Webhook.URL, cfg.Webhook.Secret, cfg.Webhook.Timeout),
+		Wildberries: wildberries.NewClient(cfg.Wildberries.URL, cfg.Wildberries.Timeout),
+		Ozon:        ozon.NewClient(cfg.Ozon.URL, cfg.Ozon.Timeout),
+		Payment:     cfg.Payment,
+		Downloads:   cfg.Downloads,
+		Invoice:     cfg.Invoice,
+		Referral:    cfg.Referral,
+		Erasure:     cfg.Erasure,
+
+		Confirmation: cfg.Confirmation,
+		AuthGuard:    cfg.AuthGuard,
+
+		OMSEmitTimeout:    cfg.OMS.EmitTimeout,
+		KIZOrders:         cfg.KIZOrders,
+		InventoryLowStock: cfg.InventoryLowStock,
+		DefaultPlan:       cfg.DefaultPlan,
+		DefaultTimezone:   defaultTimezone,
+		Printer: labels.Printer{
+			DPI:      cfg.Printer.DPI,
+			Darkness: cfg.Printer.Darkness,
+			Speed:    cfg.Printer.Speed,
+		},
+		Fiscal:            fiscalProvider,
+		FiscalMaxAttempts: cfg.Fiscal.MaxAttempts,
+		EDO:               edoProvider,
+		OutboxMaxAttempts: cfg.Outbox.MaxAttempts,
+		AdminChatID:       cfg.Telegram.AdminChatID,
+		InstanceID:        cfg.InstanceID,
+		LeaderTTL:         cfg.LeaderLeaseTTL,
+
+		AnalyticsMaterialized: cfg.AnalyticsRefreshInterval > 0,
+	}, nil
+}
+
+// Ожидание зависимости name при запуске: connect повторяется, пока не завершится успешно,
+// но не дольше startup.MaxWait. Первая пауза между попытками - startup.RetryInterval, каждая
+// следующая вдвое дольше, но не больше maxStartupRetryInterval. Возвращает последнюю
+// ошибку connect.
+func waitFor(ctx context.Context, logger *log.Logger, name string, startup config.StartupConfig,
+	connect func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, startup.MaxWait)
+	defer cancel()
+
+	interval := startup.RetryInterval
+	for attempt := 1; ; attempt++ {
+		err := connect(ctx)
+		if err == nil {
+			if attempt > 1 {
+				logger.Printf("%s: подключение установлено с попытки %d", name, attempt)
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		logger.Printf("%s: подключение не удалось (попытка %d), повтор через %s: %v", name, attempt, interval, err)
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		interval = min(interval*2, maxStartupRetryInterval)
+	}
+}
+
+// Перечитывание конфигурации по сигналу SIGHUP. Уровень журнала и лимиты запросов
+// применяются сразу, остальные параметры - после перезапуска. Если конфигурация
+// содержит ошибки, продолжают действовать прежние значения.
+func reloadConfig(ctx context.Context, logger *log.Logger, handler *httpapi.Handler) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			logger.Printf("Конфигурация не перечитана: %v", err)
+			continue
+		}
+		handler.Reload(cfg.RateLimit)
+		if err := applog.SetLevel(cfg.Logging.Level); err != nil {
+			logger.Printf("Уровень журнала не изменен: %v", err)
+		}
+		logger.Printf("Конфигурация перечитана: LOG_LEVEL=%s, RATE_LIMIT_RPS=%d, RATE_LIMIT_BURST=%d",
+			cfg.Logging.Level, cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
+	}
+}
@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Время, на которое кэш отключается после ошибки Redis, чтобы не замедлять запросы
+const retryInterval = 30 * time.Second
+
+// Cache - необязательный кэш в Redis. Ошибки Redis не возвращаются вызывающему коду:
+// при недоступности Redis кэш ведет себя как пустой, и данные берутся из основного источника.
+type Cache struct {
+	client  *redis.Client
+	timeout time.Duration
+	onError func(error)
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+// New создает кэш. Если адрес не указан, кэш отключен.
+// onError вызывается при ошибках Redis, может быть nil.
+func New(addr, password string, db int, timeout time.Duration, onError func(error)) *Cache {
+	if addr == "" {
+		return nil
+	}
+	return &Cache{
+		client: redis.NewClient(&redis.Options{
+			Addr:         addr,
+			Password:     password,
+			DB:           db,
+			DialTimeout:  timeout,
+			ReadTimeout:  timeout,
+			WriteTimeout: timeout,
+			MaxRetries:   -1,
+		}),
+		timeout: timeout,
+		onError: onError,
+	}
+}
+
+// Enabled сообщает, настроен ли кэш
+func (c *Cache) Enabled() bool {
+	return c != nil
+}
+
+// Ping проверяет соединение с Redis без учета паузы после ошибки
+func (c *Cache) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.client.Ping(ctx).Err()
+}
+
+// Проверка доступности Redis с учетом паузы после ошибки
+func (c *Cache) available() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().After(c.downUntil)
+}
+
+// Обработка ошибки Redis: отсутствие ключа ошибкой не считается
+func (c *Cache) fail(err error) {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return
+	}
+	c.mu.Lock()
+	c.downUntil = time.Now().Add(retryInterval)
+	c.mu.Unlock()
+	if c.onError != nil {
+		c.onError(err)
+	}
+}
+
+// Get читает значение по ключу в dest. Возвращает false, если значения нет или Redis недоступен.
+func (c *Cache) Get(ctx context.Context, key string, dest any) bool {
+	if !c.available() {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		c.fail(err)
+		return false
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		c.Delete(ctx, key)
+		return false
+	}
+	return true
+}
+
+// Set сохраняет значение по ключу на время ttl
+func (c *Cache) Set(ctx context.Context, key string, value any, ttl time.Duration) {
+	if !c.available() {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	c.fail(c.client.Set(ctx, key, data, ttl).Err())
+}
+
+// SetOnce сохраняет отметку по ключу на время ttl, если ее еще нет.
+// Возвращает true, если отметка установлена или кэш недоступен.
+func (c *Cache) SetOnce(ctx context.Context, key string, ttl time.Duration) bool {
+	if !c.available() {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	ok, err := c.client.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		c.fail(err)
+		return true
+	}
+	return ok
+}
+
+// Delete удаляет ключи
+func (c *Cache) Delete(ctx context.Context, keys ...string) {
+	if !c.available() || len(keys) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	c.fail(c.client.Del(ctx, keys...).Err())
+}
+
+// Close закрывает соединение с Redis
+func (c *Cache) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.client.Close()
+}
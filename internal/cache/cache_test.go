@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDisabledCache(t *testing.T) {
+	c := New("", "", 0, time.Second, nil)
+	if c.Enabled() {
+		t.Fatal("Кэш без адреса должен быть отключен")
+	}
+
+	var value int
+	if c.Get(context.Background(), "key", &value) {
+		t.Error("Отключенный кэш не должен возвращать значения")
+	}
+	c.Set(context.Background(), "key", 1, time.Minute)
+	if !c.SetOnce(context.Background(), "key", time.Minute) {
+		t.Error("Без кэша SetOnce должен разрешать действие")
+	}
+}
+
+func TestUnavailableRedis(t *testing.T) {
+	errors := 0
+	c := New("127.0.0.1:1", "", 0, 100*time.Millisecond, func(error) { errors++ })
+
+	var value int
+	if c.Get(context.Background(), "key", &value) {
+		t.Error("Недоступный Redis не должен возвращать значения")
+	}
+	if errors != 1 {
+		t.Fatalf("Ожидалась 1 ошибка Redis, получено %d", errors)
+	}
+
+	// После ошибки кэш временно отключается и не обращается к Redis
+	c.Set(context.Background(), "key", 1, time.Minute)
+	if !c.SetOnce(context.Background(), "key", time.Minute) {
+		t.Error("При недоступном Redis SetOnce должен разрешать действие")
+	}
+	if errors != 1 {
+		t.Errorf("После ошибки запросы к Redis не должны выполняться, ошибок: %d", errors)
+	}
+}
@@ -0,0 +1,112 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"project-znak/internal/tracing"
+)
+
+// ErrNotFound возвращается, если товар с указанным GTIN отсутствует в Национальном каталоге
+var ErrNotFound = errors.New("товар не найден в Национальном каталоге")
+
+// Product описывает карточку товара из Национального каталога
+type Product struct {
+	GTIN         string `json:"gtin"`
+	Name         string `json:"name"`
+	ProductGroup string `json:"product_group,omitempty"`
+	TNVED        string `json:"tnved,omitempty"`
+	Status       string `json:"status,omitempty"`
+}
+
+// Client выполняет запросы к API Национального каталога
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewClient создает клиент Национального каталога
+func NewClient(baseURL, apiKey string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: timeout, Transport: tracing.Transport("catalog")},
+	}
+}
+
+// Enabled сообщает, настроен ли доступ к каталогу
+func (c *Client) Enabled() bool {
+	return c != nil && c.apiKey != ""
+}
+
+// Ответ API Национального каталога на запрос карточки товара
+type productResponse struct {
+	Result []struct {
+		GoodName     string `json:"good_name"`
+		GoodStatus   string `json:"good_status"`
+		TNVED        string `json:"tnved"`
+		ProductGroup string `json:"product_group_code"`
+	} `json:"result"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Lookup получает наименование и товарную группу по GTIN
+func (c *Client) Lookup(ctx context.Context, gtin string) (*Product, error) {
+	params := url.Values{}
+	params.Set("gtin", gtin)
+	params.Set("apikey", c.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/v3/product?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к Национальному каталогу: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("Национальный каталог вернул ошибку: %d, тело: %s", resp.StatusCode, string(body))
+	}
+
+	var result productResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования ответа: %w", err)
+	}
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("Национальный каталог вернул ошибку: %d %s", result.Error.Code, result.Error.Message)
+	}
+
+	if len(result.Result) == 0 {
+		return nil, ErrNotFound
+	}
+
+	good := result.Result[0]
+	return &Product{
+		GTIN:         gtin,
+		Name:         good.GoodName,
+		ProductGroup: good.ProductGroup,
+		TNVED:        good.TNVED,
+		Status:       good.GoodStatus,
+	}, nil
+}
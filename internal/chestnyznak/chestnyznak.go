@@ -0,0 +1,432 @@
+package chestnyznak
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"project-znak/internal/keystore"
+	"project-znak/internal/tracing"
+)
+
+// GTINData - количество кодов маркировки, запрашиваемых для GTIN
+type GTINData struct {
+	GTIN  string `json:"gtin"`
+	Count int    `json:"count"`
+}
+
+// Тело запроса кодов маркировки
+type kizRequest struct {
+	GTINData     []GTINData `json:"gtin_data"`
+	INN          string     `json:"inn"`
+	ProductGroup string     `json:"product_group,omitempty"`
+}
+
+// Ответ API на запрос кодов маркировки
+type kizResponse struct {
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	KIZs    []string `json:"kizs"`
+}
+
+// Типы документов ввода в оборот
+const (
+	DocumentTypeIntroduceGoods = "LP_INTRODUCE_GOODS" // Ввод в оборот товаров, произведенных в РФ
+	DocumentTypeGoodsImport    = "LP_GOODS_IMPORT"    // Ввод в оборот товаров, ввезенных в РФ
+	DocumentTypeRetirement     = "LK_RECEIPT"         // Вывод из оборота
+	DocumentTypeAcceptGoods    = "LP_ACCEPT_GOODS"    // Приемка товаров от другого участника оборота
+)
+
+// Причины вывода из оборота
+const (
+	RetirementActionRetail = "RETAIL"
+	RetirementActionExport = "BEYOND_EEC_EXPORT"
+	RetirementActionDamage = "DAMAGE_LOSS"
+)
+
+// Состояния обработки документа в Честном ЗНАКе. Окончательными считаются
+// PROCESSED и CHECKED_OK (документ принят), FAILED и CHECKED_NOT_OK (отклонен).
+const (
+	DocumentStateInProgress = "IN_PROGRESS"
+	DocumentStateCheckedOK  = "CHECKED_OK"
+	DocumentStateCheckedErr = "CHECKED_NOT_OK"
+	DocumentStateProcessed  = "PROCESSED"
+	DocumentStateFailed     = "FAILED"
+)
+
+// DocumentProduct - товар в документе ввода в оборот
+type DocumentProduct struct {
+	UIT            string `json:"uit_code"`
+	ProductionDate string `json:"production_date"`
+}
+
+// IntroductionDocument - документ ввода в оборот в формате API. Даты передаются в формате ГГГГ-ММ-ДД.
+type IntroductionDocument struct {
+	DocumentType      string            `json:"document_type"`
+	ParticipantINN    string            `json:"participant_inn"`
+	ProductGroup      string            `json:"product_group,omitempty"`
+	ProductionDate    string            `json:"production_date"`
+	DeclarationNumber string            `json:"declaration_number,omitempty"`
+	DeclarationDate   string            `json:"declaration_date,omitempty"`
+	Products          []DocumentProduct `json:"products"`
+}
+
+// RetirementDocument - документ вывода из оборота в формате API. Даты передаются в формате ГГГГ-ММ-ДД.
+type RetirementDocument struct {
+	DocumentType          string   `json:"document_type"`
+	ParticipantINN        string   `json:"participant_inn"`
+	ProductGroup          string   `json:"product_group,omitempty"`
+	Action                string   `json:"action"`
+	ActionDate            string   `json:"action_date"`
+	PrimaryDocumentNumber string   `json:"primary_document_number,omitempty"`
+	PrimaryDocumentDate   string   `json:"primary_document_date,omitempty"`
+	Codes                 []string `json:"cises"`
+}
+
+// AcceptanceProduct - товар в документе приемки; Accepted - товар принят покупателем
+type AcceptanceProduct struct {
+	UIT      string `json:"uit_code"`
+	Accepted bool   `json:"accept_type"`
+}
+
+// AcceptanceDocument - документ приемки товаров, переданных другим участником оборота,
+// в формате API. Даты передаются в формате ГГГГ-ММ-ДД.
+type AcceptanceDocument struct {
+	DocumentType   string              `json:"document_type"`
+	SenderINN      string              `json:"trade_participant_inn_sender"`
+	ReceiverINN    string              `json:"trade_participant_inn_receiver"`
+	ProductGroup   string              `json:"product_group,omitempty"`
+	DocumentNumber string              `json:"release_order_number"`
+	TransferDate   string              `json:"transfer_date"`
+	AcceptanceDate string              `json:"acceptance_date"`
+	TurnoverType   string              `json:"turnover_type"` // SELLING - продажа
+	Products       []AcceptanceProduct `json:"products"`
+}
+
+// DocumentStatus - состояние обработки документа, ошибки проверки и квитанция
+type DocumentStatus struct {
+	State  string
+	Errors []string
+	Ticket string
+}
+
+// DocumentReceipt - квитанция о результате обработки документа, подписанная Честным
+// ЗНАКом, в том виде, в котором ее вернуло API
+type DocumentReceipt struct {
+	Content     []byte
+	ContentType string
+}
+
+// Наибольший размер квитанции о результате обработки документа
+const maxReceiptSize = 10 << 20
+
+// Ответ API на отправку документа
+type submitResponse struct {
+	Status     string `json:"status"`
+	Message    string `json:"message"`
+	DocumentID string `json:"document_id"`
+}
+
+// Ответ API на запрос состояния документа
+type documentStatusResponse struct {
+	Status         string   `json:"status"`
+	Message        string   `json:"message"`
+	DocumentStatus string   `json:"document_status"`
+	Errors         []string `json:"errors"`
+	Ticket         string   `json:"ticket"`
+}
+
+// Статусы кода маркировки в Честном ЗНАКе
+const (
+	CodeStatusEmitted    = "EMITTED"     // Эмитирован
+	CodeStatusApplied    = "APPLIED"     // Нанесен
+	CodeStatusIntroduced = "INTRODUCED"  // В обороте
+	CodeStatusWrittenOff = "WRITTEN_OFF" // Списан
+	CodeStatusRetired    = "RETIRED"     // Выведен из оборота
+)
+
+// CodeInfo - сведения о коде маркировки
+type CodeInfo struct {
+	CIS            string `json:"cis" xml:"cis"`
+	GTIN           string `json:"gtin" xml:"gtin"`
+	Status         string `json:"status" xml:"status"`
+	OwnerINN       string `json:"owner_inn,omitempty" xml:"owner_inn,omitempty"`
+	ProductGroup   string `json:"product_group,omitempty" xml:"product_group,omitempty"`
+	EmissionDate   string `json:"emission_date,omitempty" xml:"emission_date,omitempty"`
+	IntroducedDate string `json:"introduced_date,omitempty" xml:"introduced_date,omitempty"`
+}
+
+// Ответ API на запрос сведений о кодах
+type codeInfoResponse struct {
+	Status  string     `json:"status"`
+	Message string     `json:"message"`
+	Cises   []CodeInfo `json:"cises"`
+}
+
+// APIError - отказ API Честного ЗНАКа с телом ответа
+type APIError struct {
+	StatusCode int    // HTTP-код ответа; 200, если ошибка передана в теле успешного ответа
+	Message    string // Описание ошибки
+	Payload    []byte // Тело ответа
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode == http.StatusOK {
+		return "API Честного ЗНАКа вернуло ошибку: " + e.Message
+	}
+	return fmt.Sprintf("API Честного ЗНАКа вернуло ошибку: %d, тело: %s", e.StatusCode, e.Message)
+}
+
+// Permanent сообщает, что запрос отклонен по существу и повторять его без изменений
+// бессмысленно. Ошибки сервера, превышение лимита и таймаут считаются временными.
+func (e *APIError) Permanent() bool {
+	switch {
+	case e.StatusCode == http.StatusOK:
+		return true
+	case e.StatusCode == http.StatusRequestTimeout, e.StatusCode == http.StatusTooManyRequests:
+		return false
+	}
+	return e.StatusCode >= 400 && e.StatusCode < 500
+}
+
+// ErrCertificateExpired - срок действия сертификата ЭЦП истек. Запросы не подписываются
+// и не отправляются, пока сертификат не будет заменен.
+var ErrCertificateExpired = errors.New("срок действия сертификата ЭЦП истек")
+
+// Client выполняет подписанные запросы к API Честного ЗНАКа
+type Client struct {
+	baseURL    string
+	keys       keystore.Keystore
+	httpClient *http.Client
+}
+
+// NewClient создает клиент API Честного ЗНАКа, подписывающий запросы ключом из хранилища
+// keys. Если хранилище не задано, возвращается отключенный клиент. Транспорт transport
+// задает прокси-сервер и настройки TLS; nil - http.DefaultTransport.
+func NewClient(baseURL string, keys keystore.Keystore, timeout time.Duration, transport http.RoundTripper) *Client {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/") + "/",
+		keys:       keys,
+		httpClient: &http.Client{Timeout: timeout, Transport: tracing.WrapTransport("chestnyznak", transport)},
+	}
+}
+
+// Enabled сообщает, настроена ли ЭЦП для запросов к API
+func (c *Client) Enabled() bool {
+	return c != nil && c.keys != nil
+}
+
+// Certificate возвращает сертификат ЭЦП; nil, если клиент отключен
+func (c *Client) Certificate() *x509.Certificate {
+	if !c.Enabled() {
+		return nil
+	}
+	return c.keys.Certificate()
+}
+
+// Ping проверяет доступность API. Запрос не подписывается: успешным считается любой
+// ответ сервера, кроме ошибки 5xx.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса к API Честного ЗНАКа: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &APIError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// Sign подписывает данные ключом ЭЦП из хранилища. Если срок действия сертификата истек,
+// возвращает ErrCertificateExpired.
+func (c *Client) Sign(data []byte) ([]byte, error) {
+	cert := c.keys.Certificate()
+	if time.Now().After(cert.NotAfter) {
+		return nil, fmt.Errorf("%w %s", ErrCertificateExpired, cert.NotAfter.Format("02.01.2006"))
+	}
+	return c.keys.Sign(data)
+}
+
+// RequestKIZs запрашивает коды маркировки товарной группы для организации с указанным ИНН
+func (c *Client) RequestKIZs(ctx context.Context, inn, productGroup string, gtinData []GTINData) ([]string, error) {
+	body, err := json.Marshal(kizRequest{GTINData: gtinData, INN: inn, ProductGroup: productGroup})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка формирования запроса: %w", err)
+	}
+
+	var result kizResponse
+	var raw json.RawMessage
+	if err := c.do(ctx, http.MethodPost, withProductGroup("kizs", productGroup), body, &raw); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования ответа: %w", err)
+	}
+	if result.Status == "error" {
+		return nil, &APIError{StatusCode: http.StatusOK, Message: result.Message, Payload: raw}
+	}
+
+	return result.KIZs, nil
+}
+
+// SubmitDocument подписывает и отправляет документ (IntroductionDocument, RetirementDocument
+// или AcceptanceDocument) товарной группы. Возвращает идентификатор документа в Честном ЗНАКе.
+func (c *Client) SubmitDocument(ctx context.Context, productGroup string, document any) (string, error) {
+	body, err := json.Marshal(document)
+	if err != nil {
+		return "", fmt.Errorf("ошибка формирования документа: %w", err)
+	}
+
+	var result submitResponse
+	if err := c.do(ctx, http.MethodPost, withProductGroup("documents", productGroup), body, &result); err != nil {
+		return "", err
+	}
+	if result.Status == "error" {
+		return "", fmt.Errorf("API Честного ЗНАКа вернуло ошибку: %s", result.Message)
+	}
+	if result.DocumentID == "" {
+		return "", fmt.Errorf("API Честного ЗНАКа не вернуло идентификатор документа")
+	}
+
+	return result.DocumentID, nil
+}
+
+// DocumentStatus возвращает состояние обработки отправленного документа товарной группы
+func (c *Client) DocumentStatus(ctx context.Context, productGroup, documentID string) (*DocumentStatus, error) {
+	var result documentStatusResponse
+	path := withProductGroup("documents/"+url.PathEscape(documentID), productGroup)
+	if err := c.do(ctx, http.MethodGet, path, []byte(documentID), &result); err != nil {
+		return nil, err
+	}
+	if result.Status == "error" {
+		return nil, fmt.Errorf("API Честного ЗНАКа вернуло ошибку: %s", result.Message)
+	}
+
+	return &DocumentStatus{State: result.DocumentStatus, Errors: result.Errors, Ticket: result.Ticket}, nil
+}
+
+// DocumentReceipt возвращает подписанную квитанцию о результате обработки документа
+// товарной группы. Квитанция формируется после окончания обработки документа.
+func (c *Client) DocumentReceipt(ctx context.Context, productGroup, documentID string) (*DocumentReceipt, error) {
+	path := withProductGroup("documents/"+url.PathEscape(documentID)+"/ticket", productGroup)
+	resp, err := c.send(ctx, http.MethodGet, path, []byte(documentID))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxReceiptSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения квитанции: %w", err)
+	}
+	if len(content) == 0 {
+		return nil, fmt.Errorf("API Честного ЗНАКа вернуло пустую квитанцию")
+	}
+	if len(content) > maxReceiptSize {
+		return nil, fmt.Errorf("размер квитанции превышает %d байт", maxReceiptSize)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	return &DocumentReceipt{Content: content, ContentType: contentType}, nil
+}
+
+// CodesInfo возвращает сведения о кодах маркировки. Коды, неизвестные Честному ЗНАКу,
+// в ответ не включаются.
+func (c *Client) CodesInfo(ctx context.Context, codes []string) ([]CodeInfo, error) {
+	body, err := json.Marshal(codes)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка формирования запроса: %w", err)
+	}
+
+	var result codeInfoResponse
+	var raw json.RawMessage
+	if err := c.do(ctx, http.MethodPost, "cises/info", body, &raw); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования ответа: %w", err)
+	}
+	if result.Status == "error" {
+		return nil, &APIError{StatusCode: http.StatusOK, Message: result.Message, Payload: raw}
+	}
+
+	return result.Cises, nil
+}
+
+// Путь запроса с товарной группой: методы API для разных групп различаются параметром pg
+func withProductGroup(path, productGroup string) string {
+	if productGroup == "" {
+		return path
+	}
+	return path + "?pg=" + url.QueryEscape(productGroup)
+}
+
+// Выполнение подписанного запроса к API с декодированием ответа JSON в out
+func (c *Client) do(ctx context.Context, method, path string, signed []byte, out any) error {
+	resp, err := c.send(ctx, method, path, signed)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("ошибка декодирования ответа: %w", err)
+	}
+	return nil
+}
+
+// Отправка подписанного запроса к API. Подписываются переданные данные: тело запроса
+// или, для запросов без тела, идентификатор запрашиваемого объекта. Ответ с кодом,
+// отличным от 200, возвращается как *APIError; тело успешного ответа закрывает вызывающий.
+func (c *Client) send(ctx context.Context, method, path string, signed []byte) (*http.Response, error) {
+	signature, err := c.Sign(signed)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if method != http.MethodGet {
+		body = bytes.NewReader(signed)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Signature", base64.StdEncoding.EncodeToString(signature))
+	req.Header.Set("X-Certificate", base64.StdEncoding.EncodeToString(c.keys.Certificate().Raw))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к API Честного ЗНАКа: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: string(body), Payload: body}
+	}
+	return resp, nil
+}
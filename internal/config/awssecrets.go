@@ -0,0 +1,140 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSSecretsProvider читает секрет из AWS Secrets Manager. Значение секрета должно быть
+// JSON-объектом с парами "имя переменной окружения - значение". Запросы подписываются
+// по AWS Signature Version 4.
+type AWSSecretsProvider struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Временные учетные данные STS
+	SecretID        string // Имя или ARN секрета
+	Endpoint        string // Адрес API; по умолчанию https://secretsmanager.<регион>.amazonaws.com
+	Timeout         time.Duration
+
+	httpClient *http.Client
+}
+
+// Fetch возвращает текущую версию секрета
+func (p *AWSSecretsProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	if p.httpClient == nil {
+		p.httpClient = &http.Client{Timeout: p.Timeout}
+	}
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + p.Region + ".amazonaws.com"
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": p.SecretID})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка формирования запроса к AWS Secrets Manager: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса к AWS Secrets Manager: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	p.sign(req, body, time.Now().UTC())
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к AWS Secrets Manager: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("AWS Secrets Manager вернул статус %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var result struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ошибка разбора ответа AWS Secrets Manager: %w", err)
+	}
+	var data map[string]any
+	if err := json.Unmarshal([]byte(result.SecretString), &data); err != nil {
+		return nil, fmt.Errorf("значение секрета %s не является JSON-объектом", p.SecretID)
+	}
+	return secretStrings(data), nil
+}
+
+// Подпись запроса по AWS Signature Version 4
+func (p *AWSSecretsProvider) sign(req *http.Request, body []byte, now time.Time) {
+	const service = "secretsmanager"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if p.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.SessionToken)
+	}
+
+	// Заголовки подписываются в алфавитном порядке имен
+	headers := map[string]string{
+		"content-type": req.Header.Get("Content-Type"),
+		"host":         req.URL.Host,
+		"x-amz-date":   amzDate,
+		"x-amz-target": req.Header.Get("X-Amz-Target"),
+	}
+	if p.SessionToken != "" {
+		headers["x-amz-security-token"] = p.SessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + p.Region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+p.SecretAccessKey), date)
+	key = hmacSHA256(key, p.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+p.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -2,100 +2,1268 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	API      APIConfig
-	Logging  LoggingConfig
+	Server         ServerConfig
+	Database       DatabaseConfig
+	API            APIConfig
+	Keystore       KeystoreConfig
+	OMS            OMSConfig
+	Logging        LoggingConfig
+	Observability  ObservabilityConfig
+	Payment        PaymentConfig
+	Catalog        CatalogConfig
+	DaData         DaDataConfig
+	Wildberries    WildberriesConfig
+	Ozon           OzonConfig
+	SMTP           SMTPConfig
+	Redis          RedisConfig
+	RateLimit      RateLimitConfig
+	AuthGuard      AuthGuardConfig
+	Proxies        ProxyConfig
+	Compression    CompressionConfig
+	RequestLimits  RequestLimitsConfig
+	APIVersions    APIVersionsConfig
+	KIZOrders      KIZOrderConfig
+	Telegram       TelegramConfig
+	Webhook        WebhookConfig
+	Printer        PrinterConfig
+	Downloads      DownloadConfig
+	Invoice        InvoiceConfig
+	Referral       ReferralConfig
+	Confirmation   ConfirmationConfig
+	Fiscal         FiscalConfig
+	EDO            EDOConfig
+	Erasure        ErasureConfig
+	Outbox         OutboxConfig
+	Announcements  AnnouncementConfig
+	StatusInterval time.Duration // Период проверки компонентов для страницы статуса
+	Archive        ArchiveConfig
+	Startup        StartupConfig
+	TempFileTTL    time.Duration
+
+	// Секреты из переменных окружения или хранилища SECRETS_PROVIDER и период
+	// их обновления из хранилища
+	Secrets                *Secrets
+	SecretsRefreshInterval time.Duration
+
+	// Период опроса статусов документов, отправленных в Честный ЗНАК
+	DocumentPollInterval time.Duration
+
+	// Число доступных кодов GTIN, при снижении ниже которого пользователь получает
+	// предупреждение в Telegram; 0 - не предупреждать
+	InventoryLowStock int
+
+	// Период проверки, каким пользователям пора сформировать ежедневный или еженедельный отчет
+	ReportInterval time.Duration
+
+	// Период проверки расписаний повторяющихся заказов
+	OrderScheduleInterval time.Duration
+
+	// Тарифный план пользователей, которым план не назначен; пусто - потребление
+	// таких пользователей не ограничивается
+	DefaultPlan string
+
+	// Часовой пояс пользователей, не выбравших свой, для отображения времени в сообщениях
+	// бота, документах и отчетах. Время в БД и API хранится в UTC.
+	DefaultTimezone string
+
+	// Период обновления материализованных представлений аналитики; 0 - аналитика
+	// считается по исходным таблицам при каждом запросе
+	AnalyticsRefreshInterval time.Duration
+
+	// Идентификатор экземпляра сервиса; по умолчанию - имя хоста и номер процесса
+	InstanceID string
+
+	// Срок аренды ведущего экземпляра: при нескольких экземплярах фоновые задачи выполняет
+	// один, захвативший аренду в БД; 0 - каждый экземпляр выполняет все фоновые задачи
+	LeaderLeaseTTL time.Duration
 }
 
 type ServerConfig struct {
 	Port         string
+	GRPCPort     string
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
 }
 
+// Драйверы БД
+const (
+	DatabaseDriverPostgres = "postgres"
+	DatabaseDriverSQLite   = "sqlite"
+)
+
+// Настройки БД. Драйвер sqlite предназначен для локальной разработки и демонстрации:
+// БД хранится в файле SQLitePath или в памяти (":memory:"), остальные параметры
+// подключения не используются.
 type DatabaseConfig struct {
+	Driver     string
+	SQLitePath string
+
 	Host     string
 	Port     string
 	User     string
 	Password string
 	Name     string
 	SSLMode  string
+
+	// Реплика для тяжелых запросов чтения; подключается с теми же пользователем, паролем и БД.
+	// Если адрес не задан, все запросы выполняются на основном сервере.
+	ReplicaHost string
+	ReplicaPort string
 }
 
+// Настройки API Честного ЗНАКа. Если пути к ключу и сертификату не заданы,
+// коды маркировки генерируются заглушкой.
 type APIConfig struct {
-	URL     string
-	APIKey  string
-	Timeout time.Duration
+	URL            string
+	APIKey         string
+	Timeout        time.Duration
+	PrivateKeyPath string
+	CertPath       string
+
+	// Период проверки срока действия сертификата ЭЦП
+	CertCheckInterval time.Duration
+
+	Transport TransportConfig
 }
 
+// Параметры исходящих соединений с Честным ЗНАКом (CHESTNY_ZNAK_PROXY_URL,
+// CHESTNY_ZNAK_CA_FILE, CHESTNY_ZNAK_CLIENT_CERT_FILE, CHESTNY_ZNAK_CLIENT_KEY_FILE,
+// CHESTNY_ZNAK_TLS_MIN_VERSION) и СУЗ (те же переменные с префиксом OMS_, по умолчанию
+// совпадают с настройками Честного ЗНАКа). Если прокси-сервер не задан, используются
+// HTTPS_PROXY и NO_PROXY; если не заданы корневые сертификаты - системные.
+type TransportConfig struct {
+	ProxyURL       string
+	CAFile         string
+	ClientCertFile string
+	ClientKeyFile  string
+	MinTLSVersion  string
+}
+
+// Хранилище ключа ЭЦП для запросов к Честному ЗНАКу и СУЗ:
+//   - pem - ключ PKCS#8 и сертификат в файлах PRIVATE_KEY_PATH и CERTIFICATE_PATH;
+//     используется по умолчанию, если задан PRIVATE_KEY_PATH;
+//   - pkcs11 - ключ на токене (Рутокен, JaCarta), подпись выполняет pkcs11-tool;
+//   - cryptopro - контейнер КриптоПро CSP, подпись выполняет cryptcp.
+//
+// Для pkcs11 и cryptopro сертификат читается с токена или из хранилища КриптоПро,
+// если не задан CERTIFICATE_PATH.
+type KeystoreConfig struct {
+	Driver              string
+	PIN                 string
+	Timeout             time.Duration
+	PKCS11Module        string
+	PKCS11KeyID         string
+	PKCS11Mechanism     string
+	PKCS11Tool          string
+	CryptoProThumbprint string
+	CryptoProBinDir     string
+}
+
+// Настройки станции управления заказами (СУЗ) для эмиссии кодов маркировки.
+// Токены устройств и шаблоны кодов задаются по товарным группам переменными
+// OMS_CLIENT_TOKEN_<ГРУППА> и OMS_TEMPLATE_ID_<ГРУППА>, например OMS_CLIENT_TOKEN_MILK.
+type OMSConfig struct {
+	URL          string
+	OMSID        string
+	Timeout      time.Duration
+	EmitTimeout  time.Duration
+	ClientTokens map[string]string
+	TemplateIDs  map[string]int
+	Transport    TransportConfig
+}
+
+// Ограничения размера заказа кодов в Честном ЗНАКе и СУЗ. Запрос, превышающий их,
+// разбивается на несколько заказов, которые выполняются по Concurrency одновременно.
+type KIZOrderConfig struct {
+	MaxCodes     int // Кодов в одном заказе
+	MaxGTINCodes int // Кодов одного GTIN в одном заказе
+	MaxProducts  int // Различных GTIN в одном заказе
+	Concurrency  int
+}
+
+// Настройки журнала. Ошибки и паники отправляются в Sentry, если задан SentryDSN;
+// SentrySampleRate - доля отправляемых событий от 0 до 1.
 type LoggingConfig struct {
 	Level string
 	File  string
+
+	SentryDSN         string
+	SentryEnvironment string
+	SentryRelease     string
+	SentrySampleRate  float64
+}
+
+// Распределенная трассировка OpenTelemetry. Спаны экспортируются по OTLP/HTTP на адрес
+// OTLPEndpoint; если он не задан, спаны не записываются.
+type ObservabilityConfig struct {
+	OTLPEndpoint string
+	ServiceName  string
+	SampleRatio  float64
+}
+
+// Настройки Robokassa. Пароль #1 подписывает ссылки на оплату и запросы OpState,
+// пароль #2 - уведомления ResultURL. PaymentURL - страница оплаты, на которую перенаправляется
+// покупатель. Платежи, ожидающие оплаты дольше ReconcileAfter, каждые
+// ReconcileInterval сверяются через XML-интерфейс OpState. Платежи, не оплаченные
+// за TTL, отменяются при проверке раз в ExpirationInterval.
+type PaymentConfig struct {
+	RobokassaLogin     string
+	RobokassaPassword  string
+	RobokassaPassword2 string
+	OpStateURL         string
+	PaymentURL         string
+	Timeout            time.Duration
+	ReconcileInterval  time.Duration
+	ReconcileAfter     time.Duration
+	TTL                time.Duration
+	ExpirationInterval time.Duration
+
+	// Stripe принимает оплату в валютах StripeCurrencies; без секретного ключа платежи
+	// в иностранной валюте не принимаются. StripeReturnURL - страница возврата покупателя
+	// после оплаты, если она не передана в запросе.
+	StripeSecretKey     string
+	StripeWebhookSecret string
+	StripeURL           string
+	StripeTimeout       time.Duration
+	StripeCurrencies    []string
+	StripeReturnURL     string
+
+	// Маршрутизация платежей: провайдеры пробуются в порядке Providers (основной, затем
+	// резервные). Правило пользователя из UserRoutes, а без него - правило с наибольшим
+	// порогом AmountRoutes, не превышающим сумму платежа (в основных единицах валюты),
+	// задает другой порядок. Провайдер, не принимающий валюту платежа, пропускается.
+	Providers    []string
+	AmountRoutes map[int][]string
+	UserRoutes   map[int][]string
+}
+
+// Платежные провайдеры, которые можно указать в маршрутах платежей
+var paymentProviders = []string{"robokassa", "stripe"}
+
+// Настройки Национального каталога
+type CatalogConfig struct {
+	URL     string
+	APIKey  string
+	Timeout time.Duration
+}
+
+// Настройки DaData для проверки ИНН
+type DaDataConfig struct {
+	URL     string
+	APIKey  string
+	Timeout time.Duration
+}
+
+// Настройки API маркетплейса Wildberries. Токены API хранятся у каждого пользователя.
+type WildberriesConfig struct {
+	URL     string
+	Timeout time.Duration
+}
+
+// Настройки Ozon Seller API. Client-Id и API-ключи хранятся у каждого пользователя.
+type OzonConfig struct {
+	URL     string
+	Timeout time.Duration
+}
+
+// Настройки SMTP для отправки уведомлений
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Настройки Redis для кэширования. Если адрес не указан, кэш отключен.
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+	Timeout  time.Duration
+}
+
+// Настройки Telegram-бота для уведомлений. Если токен не задан, уведомления в Telegram не отправляются.
+// AdminChatID - чат администраторов для служебных предупреждений; 0 - не отправлять.
+type TelegramConfig struct {
+	BotToken    string
+	Timeout     time.Duration
+	AdminChatID int64
+}
+
+// Настройки вебхука для событий обработки документов. Если адрес не задан, вебхук отключен.
+type WebhookConfig struct {
+	URL     string
+	Secret  string
+	Timeout time.Duration
+}
+
+// Параметры термопринтера для выгрузки этикеток в ZPL и EPL. Размер этикетки
+// задается шаблоном или параметрами запроса.
+type PrinterConfig struct {
+	DPI      int
+	Darkness int
+	Speed    int
+}
+
+// Ссылки на скачивание файлов, отправляемые, если файл не удалось доставить в Telegram.
+// Если адрес или ключ подписи не задан, ссылки не формируются.
+type DownloadConfig struct {
+	BaseURL string
+	Secret  string
+	LinkTTL time.Duration
+}
+
+// Реквизиты поставщика для счетов на оплату банковским переводом. VATRate - ставка НДС
+// в процентах, включенного в цену; 0 означает работу без НДС. Если ИНН или расчетный
+// счет не заданы, счета не выставляются.
+type InvoiceConfig struct {
+	SellerName  string
+	INN         string
+	KPP         string
+	Address     string
+	BankName    string
+	BIK         string
+	BankAccount string
+	CorrAccount string
+	DueDays     int
+	VATRate     float64
+}
+
+// Реферальная программа: пригласившему начисляется Bonus рублей и BonusPercent процентов
+// от первого платежа в рублях приглашенного пользователя. BotUsername - имя Telegram-бота
+// для реферальных ссылок; если не задано, пользователю показывается только код.
+type ReferralConfig struct {
+	Bonus        float64
+	BonusPercent float64
+	BotUsername  string
 }
 
+// Подтверждение операций кодом из Telegram: возврат платежа, ротация API ключа и заказ
+// на сумму от OrderThreshold рублей (0 - заказы не подтверждаются). Код действует TTL,
+// после MaxAttempts неверных кодов подтверждение отклоняется. Без токена бота подтверждение
+// не запрашивается.
+type ConfirmationConfig struct {
+	TTL            time.Duration
+	OrderThreshold float64
+	MaxAttempts    int
+}
+
+// Настройки фискализации платежей (54-ФЗ). Если оператор не задан, чеки не формируются.
+// Незарегистрированные чеки обрабатываются каждые Interval; после MaxAttempts неудачных
+// попыток чек ожидает повторного запуска администратором.
+type FiscalConfig struct {
+	Provider       string
+	URL            string
+	Login          string
+	Password       string
+	GroupCode      string
+	INN            string
+	Email          string
+	PaymentAddress string
+	TaxSystem      string
+	VAT            string
+	Timeout        time.Duration
+	Interval       time.Duration
+	MaxAttempts    int
+}
+
+// Настройки отправки УПД через оператора ЭДО: diadoc или sbis. Если оператор не задан,
+// УПД не формируются. ClientID - ключ разработчика Диадока. Ответ покупателя на отправленные
+// документы проверяется не чаще PollInterval.
+type EDOConfig struct {
+	Provider     string
+	URL          string
+	ClientID     string
+	Login        string
+	Password     string
+	Timeout      time.Duration
+	PollInterval time.Duration
+}
+
+// Удаление аккаунтов пользователей. Хэш telegram_id, документы и запросы КИЗ удаленного
+// пользователя хранятся Retention с момента удаления, затем удаляются; финансовые документы
+// сохраняются.
+// HashSecret - ключ HMAC, под которым хранится telegram_id удаленного пользователя.
+type ErasureConfig struct {
+	Retention     time.Duration
+	PurgeInterval time.Duration
+	HashSecret    string
+}
+
+// Архив запросов к Честному ЗНАКу и СУЗ и ответов на них для разбора спорных ситуаций.
+// Записи хранятся Retention (0 - запросы не сохраняются), устаревшие удаляются
+// раз в CleanupInterval.
+type ArchiveConfig struct {
+	Retention       time.Duration
+	CleanupInterval time.Duration
+}
+
+// Доставка уведомлений из outbox: период опроса и число попыток, после которого
+// сообщение переводится в недоставленные
+type OutboxConfig struct {
+	Interval    time.Duration
+	MaxAttempts int
+}
+
+// Рассылка объявлений в Telegram: раз в Interval в outbox ставится не более Batch сообщений
+// каждого объявления
+type AnnouncementConfig struct {
+	Interval time.Duration
+	Batch    int
+}
+
+// Ожидание зависимостей при запуске: сколько всего ждать БД и Redis и пауза перед первой
+// повторной попыткой подключения (каждая следующая пауза вдвое дольше)
+type StartupConfig struct {
+	MaxWait       time.Duration
+	RetryInterval time.Duration
+}
+
+// Ограничение частоты запросов к REST API
+type RateLimitConfig struct {
+	RequestsPerSecond int
+	Burst             int
+}
+
+// Защита от подбора API ключей: после MaxFailures неверных ключей за Window адрес клиента
+// блокируется на Lockout, каждая следующая блокировка вдвое дольше предыдущей, но не дольше
+// MaxLockout. RegistrationLimit ограничивает число регистраций новых пользователей с одного
+// адреса за Window (0 - без ограничения). Адреса TrustedIPs, например Telegram-бота,
+// не блокируются.
+type AuthGuardConfig struct {
+	MaxFailures       int
+	Window            time.Duration
+	Lockout           time.Duration
+	MaxLockout        time.Duration
+	RegistrationLimit int
+	TrustedIPs        []string
+}
+
+// Обратные прокси перед REST API. Адрес клиента берется из X-Forwarded-For, только если
+// запрос пришел с адреса или подсети из TrustedProxies; иначе используется адрес соединения.
+type ProxyConfig struct {
+	TrustedProxies []string
+}
+
+// Сжатие ответов REST API. Сжимаются ответы не короче MinSize байт с типом содержимого
+// из ContentTypes.
+type CompressionConfig struct {
+	MinSize      int
+	ContentTypes []string
+}
+
+// Ограничения обработки запросов REST API. Timeout действует для всех маршрутов, кроме
+// запроса КИЗ, для которого задан KIZTimeout. Запросы КИЗ выполняются по очереди с двумя
+// полосами: KIZConcurrency - число одновременно обрабатываемых запросов обычной полосы,
+// KIZPremiumConcurrency - приоритетной полосы пользователей тарифных планов KIZPremiumPlans,
+// KIZQueueSize - наибольшее число ожидающих запросов каждой полосы. Ограничения времени должны быть меньше SERVER_WRITE_TIMEOUT,
+// иначе соединение закрывается раньше, чем клиент получит ответ 504. MaxBodySize - наибольший
+// размер тела запроса в байтах, MaxUploadSize - то же для маршрутов загрузки файлов.
+type RequestLimitsConfig struct {
+	Timeout        time.Duration
+	KIZTimeout     time.Duration
+	KIZConcurrency int
+	MaxBodySize    int64
+	MaxUploadSize  int64
+
+	KIZPremiumConcurrency int
+	KIZPremiumPlans       []string
+	KIZQueueSize          int
+}
+
+// Сроки прежнего API Telegram-бота (/api/v1/kizs, /kizs, /api/v1/payments, /pay):
+// LegacyDeprecated (LEGACY_API_DEPRECATED) - дата объявления устаревшим, LegacySunset
+// (LEGACY_API_SUNSET) - дата отключения. Даты задаются в формате ГГГГ-ММ-ДД, время - UTC.
+type APIVersionsConfig struct {
+	LegacyDeprecated time.Time
+	LegacySunset     time.Time
+}
+
+// ValidationError перечисляет все ошибки значений конфигурации
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "ошибка валидации конфигурации:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load читает конфигурацию. Параметры задаются переменными окружения или файлом
+// конфигурации CONFIG_FILE в формате YAML; переменные окружения имеют приоритет над
+// файлом, секреты из хранилища SECRETS_PROVIDER - над переменными окружения.
+// Возвращает *ValidationError со всеми ошибками, если значения некорректны.
 func Load() (*Config, error) {
+	l := newLoader()
+	if name := os.Getenv("CONFIG_FILE"); name != "" {
+		file, err := readConfigFile(name)
+		if err != nil {
+			return nil, err
+		}
+		l.file = file
+	}
+
+	secrets, err := l.loadSecrets()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки секретов: %w", err)
+	}
+
+	chestnyZnakTransport := l.getTransportConfig("CHESTNY_ZNAK_", TransportConfig{MinTLSVersion: "1.2"})
 	cfg := &Config{
 		Server: ServerConfig{
-			Port:         getEnv("SERVER_PORT", "8080"),
-			ReadTimeout:  getDurationEnv("SERVER_READ_TIMEOUT", 15*time.Second),
-			WriteTimeout: getDurationEnv("SERVER_WRITE_TIMEOUT", 15*time.Second),
-			IdleTimeout:  getDurationEnv("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			// HTTP_PORT поддерживается для совместимости с прежним cmd/api
+			Port:         l.getEnv("SERVER_PORT", l.getEnv("HTTP_PORT", "8080")),
+			GRPCPort:     l.getEnv("GRPC_PORT", "9090"),
+			ReadTimeout:  l.getDurationEnv("SERVER_READ_TIMEOUT", 15*time.Second),
+			WriteTimeout: l.getDurationEnv("SERVER_WRITE_TIMEOUT", 15*time.Second),
+			IdleTimeout:  l.getDurationEnv("SERVER_IDLE_TIMEOUT", 120*time.Second),
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", ""),
-			Name:     getEnv("DB_NAME", "znak_db"),
-			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+			Driver:     l.getEnv("DB_DRIVER", DatabaseDriverPostgres),
+			SQLitePath: l.getEnv("DB_SQLITE_PATH", "znak.db"),
+
+			Host:     l.getEnv("DB_HOST", "localhost"),
+			Port:     l.getEnv("DB_PORT", "5432"),
+			User:     l.getEnv("DB_USER", "postgres"),
+			Password: l.getEnv("DB_PASSWORD", ""),
+			Name:     l.getEnv("DB_NAME", "my_bot_db"),
+			SSLMode:  l.getEnv("DB_SSL_MODE", "disable"),
+
+			ReplicaHost: l.getEnv("DB_REPLICA_HOST", ""),
+			ReplicaPort: l.getEnv("DB_REPLICA_PORT", l.getEnv("DB_PORT", "5432")),
 		},
 		API: APIConfig{
-			URL:     getEnv("CHESTNY_ZNAK_API_URL", "https://api.stage.mdlp.crpt.ru"),
-			APIKey:  getEnv("CHESTNY_ZNAK_API_KEY", ""),
-			Timeout: getDurationEnv("API_TIMEOUT", 30*time.Second),
+			URL:            l.getEnv("CHESTNY_ZNAK_API_URL", l.getEnv("CHESTNY_ZNAK_URL", "https://api.stage.mdlp.crpt.ru")),
+			APIKey:         l.getEnv("CHESTNY_ZNAK_API_KEY", ""),
+			Timeout:        l.getDurationEnv("API_TIMEOUT", 30*time.Second),
+			PrivateKeyPath: l.getEnv("PRIVATE_KEY_PATH", ""),
+			CertPath:       l.getEnv("CERTIFICATE_PATH", ""),
+
+			CertCheckInterval: l.getDurationEnv("CERTIFICATE_CHECK_INTERVAL", time.Hour),
+			Transport:         chestnyZnakTransport,
+		},
+		Keystore: KeystoreConfig{
+			Driver:              l.getEnv("KEYSTORE_DRIVER", ""),
+			PIN:                 l.getEnv("KEYSTORE_PIN", ""),
+			Timeout:             l.getDurationEnv("KEYSTORE_TIMEOUT", 30*time.Second),
+			PKCS11Module:        l.getEnv("PKCS11_MODULE", ""),
+			PKCS11KeyID:         l.getEnv("PKCS11_KEY_ID", ""),
+			PKCS11Mechanism:     l.getEnv("PKCS11_MECHANISM", "SHA256-RSA-PKCS"),
+			PKCS11Tool:          l.getEnv("PKCS11_TOOL", "pkcs11-tool"),
+			CryptoProThumbprint: l.getEnv("CRYPTOPRO_THUMBPRINT", ""),
+			CryptoProBinDir:     l.getEnv("CRYPTOPRO_BIN_DIR", "/opt/cprocsp/bin/amd64"),
+		},
+		OMS: OMSConfig{
+			URL:          l.getEnv("OMS_URL", "https://suzgrid.crpt.ru/api/v3"),
+			OMSID:        l.getEnv("OMS_ID", ""),
+			Timeout:      l.getDurationEnv("OMS_TIMEOUT", 30*time.Second),
+			EmitTimeout:  l.getDurationEnv("OMS_EMIT_TIMEOUT", 2*time.Minute),
+			ClientTokens: l.getPrefixedEnv("OMS_CLIENT_TOKEN_"),
+			TemplateIDs:  l.getPrefixedIntEnv("OMS_TEMPLATE_ID_"),
+			Transport:    l.getTransportConfig("OMS_", chestnyZnakTransport),
+		},
+		KIZOrders: KIZOrderConfig{
+			MaxCodes:     l.getIntEnv("KIZ_ORDER_MAX_CODES", 150000),
+			MaxGTINCodes: l.getIntEnv("KIZ_ORDER_MAX_GTIN_CODES", 30000),
+			MaxProducts:  l.getIntEnv("KIZ_ORDER_MAX_PRODUCTS", 10),
+			Concurrency:  l.getIntEnv("KIZ_ORDER_CONCURRENCY", 3),
 		},
 		Logging: LoggingConfig{
-			Level: getEnv("LOG_LEVEL", "info"),
-			File:  getEnv("LOG_FILE", ""),
+			Level: l.getEnv("LOG_LEVEL", "info"),
+			File:  l.getEnv("LOG_FILE", ""),
+
+			SentryDSN:         l.getEnv("SENTRY_DSN", ""),
+			SentryEnvironment: l.getEnv("SENTRY_ENVIRONMENT", "production"),
+			SentryRelease:     l.getEnv("SENTRY_RELEASE", ""),
+			SentrySampleRate:  l.getFloatEnv("SENTRY_SAMPLE_RATE", 1),
+		},
+		Observability: ObservabilityConfig{
+			OTLPEndpoint: l.getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			ServiceName:  l.getEnv("OTEL_SERVICE_NAME", "project-znak"),
+			SampleRatio:  l.getFloatEnv("OTEL_TRACES_SAMPLE_RATIO", 1),
+		},
+		Payment: PaymentConfig{
+			RobokassaLogin:     l.getEnv("ROBOKASSA_LOGIN", ""),
+			RobokassaPassword:  l.getEnv("ROBOKASSA_PASSWORD", ""),
+			RobokassaPassword2: l.getEnv("ROBOKASSA_PASSWORD2", ""),
+			OpStateURL:         l.getEnv("ROBOKASSA_OPSTATE_URL", ""),
+			PaymentURL:         l.getEnv("ROBOKASSA_PAYMENT_URL", "https://auth.robokassa.ru/Merchant/Index.aspx"),
+			Timeout:            l.getDurationEnv("ROBOKASSA_TIMEOUT", 30*time.Second),
+			ReconcileInterval:  l.getDurationEnv("PAYMENT_RECONCILE_INTERVAL", 5*time.Minute),
+			ReconcileAfter:     l.getDurationEnv("PAYMENT_RECONCILE_AFTER", 15*time.Minute),
+			TTL:                l.getDurationEnv("PAYMENT_TTL", 24*time.Hour),
+			ExpirationInterval: l.getDurationEnv("PAYMENT_EXPIRATION_INTERVAL", 10*time.Minute),
+
+			StripeSecretKey:     l.getEnv("STRIPE_SECRET_KEY", ""),
+			StripeWebhookSecret: l.getEnv("STRIPE_WEBHOOK_SECRET", ""),
+			StripeURL:           l.getEnv("STRIPE_URL", ""),
+			StripeTimeout:       l.getDurationEnv("STRIPE_TIMEOUT", 30*time.Second),
+			StripeCurrencies:    l.getListEnv("STRIPE_CURRENCIES", "USD,EUR"),
+			StripeReturnURL:     l.getEnv("STRIPE_RETURN_URL", ""),
+
+			Providers:    l.getListEnv("PAYMENT_PROVIDERS", "robokassa,stripe"),
+			AmountRoutes: l.getRoutesEnv("PAYMENT_ROUTE_AMOUNT_"),
+			UserRoutes:   l.getRoutesEnv("PAYMENT_ROUTE_USER_"),
+		},
+		Catalog: CatalogConfig{
+			URL:     l.getEnv("NATIONAL_CATALOG_URL", "https://xn--80aqu.xn----7sbabas4ajkhfocclk9d3cvfsa.xn--p1ai"),
+			APIKey:  l.getEnv("NATIONAL_CATALOG_API_KEY", ""),
+			Timeout: l.getDurationEnv("NATIONAL_CATALOG_TIMEOUT", 10*time.Second),
+		},
+		DaData: DaDataConfig{
+			URL:     l.getEnv("DADATA_URL", "https://suggestions.dadata.ru"),
+			APIKey:  l.getEnv("DADATA_API_KEY", ""),
+			Timeout: l.getDurationEnv("DADATA_TIMEOUT", 5*time.Second),
+		},
+		Wildberries: WildberriesConfig{
+			URL:     l.getEnv("WILDBERRIES_URL", "https://marketplace-api.wildberries.ru"),
+			Timeout: l.getDurationEnv("WILDBERRIES_TIMEOUT", 10*time.Second),
+		},
+		Ozon: OzonConfig{
+			URL:     l.getEnv("OZON_URL", "https://api-seller.ozon.ru"),
+			Timeout: l.getDurationEnv("OZON_TIMEOUT", 10*time.Second),
+		},
+		SMTP: SMTPConfig{
+			Host:     l.getEnv("SMTP_HOST", ""),
+			Port:     l.getEnv("SMTP_PORT", "587"),
+			Username: l.getEnv("SMTP_USERNAME", ""),
+			Password: l.getEnv("SMTP_PASSWORD", ""),
+			From:     l.getEnv("SMTP_FROM", ""),
+		},
+		Redis: RedisConfig{
+			Addr:     l.getEnv("REDIS_ADDR", ""),
+			Password: l.getEnv("REDIS_PASSWORD", ""),
+			DB:       l.getIntEnv("REDIS_DB", 0),
+			Timeout:  l.getDurationEnv("REDIS_TIMEOUT", 200*time.Millisecond),
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerSecond: l.getIntEnv("RATE_LIMIT_RPS", 10),
+			Burst:             l.getIntEnv("RATE_LIMIT_BURST", 20),
+		},
+		AuthGuard: AuthGuardConfig{
+			MaxFailures:       l.getIntEnv("AUTH_MAX_FAILURES", 10),
+			Window:            l.getDurationEnv("AUTH_FAILURE_WINDOW", 15*time.Minute),
+			Lockout:           l.getDurationEnv("AUTH_LOCKOUT", time.Minute),
+			MaxLockout:        l.getDurationEnv("AUTH_MAX_LOCKOUT", 24*time.Hour),
+			RegistrationLimit: l.getIntEnv("AUTH_REGISTRATION_LIMIT", 0),
+			TrustedIPs:        l.getListEnv("AUTH_TRUSTED_IPS", ""),
+		},
+		Proxies: ProxyConfig{
+			TrustedProxies: l.getListEnv("TRUSTED_PROXIES", ""),
+		},
+		RequestLimits: RequestLimitsConfig{
+			Timeout:        l.getDurationEnv("REQUEST_TIMEOUT", 10*time.Second),
+			KIZTimeout:     l.getDurationEnv("KIZ_REQUEST_TIMEOUT", 14*time.Second),
+			KIZConcurrency: l.getIntEnv("KIZ_MAX_CONCURRENT", 4),
+			MaxBodySize:    l.getInt64Env("REQUEST_MAX_BODY_SIZE", 1<<20),
+			MaxUploadSize:  l.getInt64Env("REQUEST_MAX_UPLOAD_SIZE", 10<<20),
+
+			KIZPremiumConcurrency: l.getIntEnv("KIZ_PREMIUM_MAX_CONCURRENT", 2),
+			KIZPremiumPlans:       l.getListEnv("KIZ_PREMIUM_PLANS", "business,enterprise"),
+			KIZQueueSize:          l.getIntEnv("KIZ_QUEUE_SIZE", 20),
+		},
+		APIVersions: APIVersionsConfig{
+			LegacyDeprecated: l.getDateEnv("LEGACY_API_DEPRECATED", "2026-10-16"),
+			LegacySunset:     l.getDateEnv("LEGACY_API_SUNSET", "2027-04-01"),
+		},
+		Compression: CompressionConfig{
+			MinSize:      l.getIntEnv("COMPRESSION_MIN_SIZE", 1024),
+			ContentTypes: l.getListEnv("COMPRESSION_CONTENT_TYPES", "application/json,text/plain,text/csv,text/html,application/xml"),
+		},
+		Telegram: TelegramConfig{
+			BotToken:    l.getEnv("TELEGRAM_BOT_TOKEN", ""),
+			Timeout:     l.getDurationEnv("TELEGRAM_TIMEOUT", 10*time.Second),
+			AdminChatID: l.getInt64Env("TELEGRAM_ADMIN_CHAT_ID", 0),
+		},
+		Webhook: WebhookConfig{
+			URL:     l.getEnv("DOCUMENT_WEBHOOK_URL", ""),
+			Secret:  l.getEnv("DOCUMENT_WEBHOOK_SECRET", ""),
+			Timeout: l.getDurationEnv("DOCUMENT_WEBHOOK_TIMEOUT", 10*time.Second),
+		},
+		Printer: PrinterConfig{
+			DPI:      l.getIntEnv("PRINTER_DPI", 203),
+			Darkness: l.getIntEnv("PRINTER_DARKNESS", 15),
+			Speed:    l.getIntEnv("PRINTER_SPEED", 4),
+		},
+		Downloads: DownloadConfig{
+			BaseURL: l.getEnv("PUBLIC_BASE_URL", ""),
+			Secret:  l.getEnv("DOWNLOAD_LINK_SECRET", ""),
+			LinkTTL: l.getDurationEnv("DOWNLOAD_LINK_TTL", 24*time.Hour),
+		},
+		Invoice: InvoiceConfig{
+			SellerName:  l.getEnv("INVOICE_SELLER_NAME", ""),
+			INN:         l.getEnv("INVOICE_SELLER_INN", ""),
+			KPP:         l.getEnv("INVOICE_SELLER_KPP", ""),
+			Address:     l.getEnv("INVOICE_SELLER_ADDRESS", ""),
+			BankName:    l.getEnv("INVOICE_BANK_NAME", ""),
+			BIK:         l.getEnv("INVOICE_BANK_BIK", ""),
+			BankAccount: l.getEnv("INVOICE_BANK_ACCOUNT", ""),
+			CorrAccount: l.getEnv("INVOICE_CORR_ACCOUNT", ""),
+			DueDays:     l.getIntEnv("INVOICE_DUE_DAYS", 5),
+			VATRate:     l.getFloatEnv("INVOICE_VAT_RATE", 0),
+		},
+		Referral: ReferralConfig{
+			Bonus:        l.getFloatEnv("REFERRAL_BONUS", 0),
+			BonusPercent: l.getFloatEnv("REFERRAL_BONUS_PERCENT", 0),
+			BotUsername:  strings.TrimPrefix(l.getEnv("TELEGRAM_BOT_USERNAME", ""), "@"),
+		},
+		Confirmation: ConfirmationConfig{
+			TTL:            l.getDurationEnv("CONFIRMATION_TTL", 10*time.Minute),
+			OrderThreshold: l.getFloatEnv("CONFIRMATION_ORDER_THRESHOLD", 0),
+			MaxAttempts:    l.getIntEnv("CONFIRMATION_MAX_ATTEMPTS", 5),
+		},
+		Fiscal: FiscalConfig{
+			Provider:       l.getEnv("FISCAL_PROVIDER", ""),
+			URL:            l.getEnv("ATOL_URL", ""),
+			Login:          l.getEnv("ATOL_LOGIN", ""),
+			Password:       l.getEnv("ATOL_PASSWORD", ""),
+			GroupCode:      l.getEnv("ATOL_GROUP_CODE", ""),
+			INN:            l.getEnv("FISCAL_INN", ""),
+			Email:          l.getEnv("FISCAL_EMAIL", ""),
+			PaymentAddress: l.getEnv("FISCAL_PAYMENT_ADDRESS", ""),
+			TaxSystem:      l.getEnv("FISCAL_TAX_SYSTEM", "usn_income"),
+			VAT:            l.getEnv("FISCAL_VAT", "none"),
+			Timeout:        l.getDurationEnv("FISCAL_TIMEOUT", 30*time.Second),
+			Interval:       l.getDurationEnv("FISCAL_INTERVAL", time.Minute),
+			MaxAttempts:    l.getIntEnv("FISCAL_MAX_ATTEMPTS", 10),
+		},
+		EDO: EDOConfig{
+			Provider:     l.getEnv("EDO_PROVIDER", ""),
+			URL:          l.getEnv("EDO_URL", ""),
+			ClientID:     l.getEnv("DIADOC_CLIENT_ID", ""),
+			Login:        l.getEnv("EDO_LOGIN", ""),
+			Password:     l.getEnv("EDO_PASSWORD", ""),
+			Timeout:      l.getDurationEnv("EDO_TIMEOUT", 30*time.Second),
+			PollInterval: l.getDurationEnv("EDO_POLL_INTERVAL", 5*time.Minute),
+		},
+		Erasure: ErasureConfig{
+			// Первичные учетные документы хранятся не менее пяти лет (402-ФЗ, ст. 29)
+			Retention:     l.getDurationEnv("USER_RETENTION_PERIOD", 5*365*24*time.Hour),
+			PurgeInterval: l.getDurationEnv("USER_PURGE_INTERVAL", 24*time.Hour),
+			HashSecret:    l.getEnv("USER_HASH_SECRET", ""),
+		},
+		Outbox: OutboxConfig{
+			Interval:    l.getDurationEnv("OUTBOX_INTERVAL", 10*time.Second),
+			MaxAttempts: l.getIntEnv("OUTBOX_MAX_ATTEMPTS", 10),
+		},
+		Announcements: AnnouncementConfig{
+			Interval: l.getDurationEnv("ANNOUNCEMENT_INTERVAL", 10*time.Second),
+			Batch:    l.getIntEnv("ANNOUNCEMENT_BATCH", 20),
+		},
+		StatusInterval: l.getDurationEnv("STATUS_INTERVAL", time.Minute),
+		Archive: ArchiveConfig{
+			Retention:       l.getDurationEnv("ARCHIVE_RETENTION", 90*24*time.Hour),
+			CleanupInterval: l.getDurationEnv("ARCHIVE_CLEANUP_INTERVAL", time.Hour),
 		},
+		Startup: StartupConfig{
+			MaxWait:       l.getDurationEnv("STARTUP_MAX_WAIT", time.Minute),
+			RetryInterval: l.getDurationEnv("STARTUP_RETRY_INTERVAL", time.Second),
+		},
+		TempFileTTL:           l.getDurationEnv("TEMP_FILE_TTL", 24*time.Hour),
+		DocumentPollInterval:  l.getDurationEnv("DOCUMENT_POLL_INTERVAL", time.Minute),
+		InventoryLowStock:     l.getIntEnv("INVENTORY_LOW_STOCK", 100),
+		ReportInterval:        l.getDurationEnv("REPORT_INTERVAL", 15*time.Minute),
+		OrderScheduleInterval: l.getDurationEnv("ORDER_SCHEDULE_INTERVAL", time.Minute),
+		DefaultPlan:           l.getEnv("DEFAULT_PLAN", ""),
+		DefaultTimezone:       l.getEnv("DEFAULT_TIMEZONE", "Europe/Moscow"),
+
+		AnalyticsRefreshInterval: l.getDurationEnv("ANALYTICS_REFRESH_INTERVAL", 0),
+
+		InstanceID:     l.getEnv("INSTANCE_ID", defaultInstanceID()),
+		LeaderLeaseTTL: l.getDurationEnv("LEADER_LEASE_TTL", 30*time.Second),
+
+		Secrets:                secrets,
+		SecretsRefreshInterval: l.getDurationEnv("SECRETS_REFRESH_INTERVAL", 5*time.Minute),
+	}
+	if cfg.Keystore.Driver == "" && cfg.API.PrivateKeyPath != "" {
+		cfg.Keystore.Driver = "pem"
 	}
 
-	if err := cfg.validate(); err != nil {
-		return nil, fmt.Errorf("ошибка валидации конфигурации: %w", err)
+	l.checkUnknownFileKeys()
+	sort.Strings(l.problems)
+	if problems := append(l.problems, cfg.validate()...); len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
 	}
 
 	return cfg, nil
 }
 
-func (c *Config) validate() error {
-	if c.Database.Password == "" {
-		return fmt.Errorf("пароль базы данных не указан")
+// Проверка значений конфигурации; возвращает описания всех найденных ошибок
+func (c *Config) validate() []string {
+	var problems []string
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("уровень журнала LOG_LEVEL должен быть debug, info, warn или error: %s", c.Logging.Level))
+	}
+	switch c.Database.Driver {
+	case DatabaseDriverPostgres:
+		if c.Database.Password == "" {
+			problems = append(problems, "пароль базы данных DB_PASSWORD не указан")
+		}
+	case DatabaseDriverSQLite:
+		if c.Database.SQLitePath == "" {
+			problems = append(problems, "для драйвера sqlite необходимо указать файл БД DB_SQLITE_PATH")
+		}
+		if c.Database.ReplicaHost != "" {
+			problems = append(problems, "реплика DB_REPLICA_HOST не поддерживается драйвером sqlite")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("неизвестный драйвер БД DB_DRIVER: %s", c.Database.Driver))
+	}
+	switch c.Keystore.Driver {
+	case "":
+		if c.API.CertPath != "" {
+			problems = append(problems, "для API Честного ЗНАКа необходимо указать и ключ PRIVATE_KEY_PATH, и сертификат CERTIFICATE_PATH")
+		}
+	case "pem":
+		if c.API.PrivateKeyPath == "" || c.API.CertPath == "" {
+			problems = append(problems, "для API Честного ЗНАКа необходимо указать и ключ PRIVATE_KEY_PATH, и сертификат CERTIFICATE_PATH")
+		}
+	case "pkcs11":
+		if c.Keystore.PKCS11Module == "" || c.Keystore.PKCS11KeyID == "" {
+			problems = append(problems, "для хранилища pkcs11 необходимо указать PKCS11_MODULE и PKCS11_KEY_ID")
+		}
+	case "cryptopro":
+		if c.Keystore.CryptoProThumbprint == "" {
+			problems = append(problems, "для хранилища cryptopro необходимо указать CRYPTOPRO_THUMBPRINT")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("неизвестное хранилище ключа KEYSTORE_DRIVER: %s", c.Keystore.Driver))
+	}
+	if c.Observability.SampleRatio < 0 || c.Observability.SampleRatio > 1 {
+		problems = append(problems, "доля трассировок OTEL_TRACES_SAMPLE_RATIO должна быть от 0 до 1")
+	}
+	if c.Logging.SentrySampleRate < 0 || c.Logging.SentrySampleRate > 1 {
+		problems = append(problems, "доля событий SENTRY_SAMPLE_RATE должна быть от 0 до 1")
+	}
+	if c.RequestLimits.Timeout < 0 || c.RequestLimits.Timeout >= c.Server.WriteTimeout {
+		problems = append(problems, "ограничение REQUEST_TIMEOUT должно быть неотрицательным и меньше SERVER_WRITE_TIMEOUT")
+	}
+	if c.RequestLimits.KIZTimeout < 0 || c.RequestLimits.KIZTimeout >= c.Server.WriteTimeout {
+		problems = append(problems, "ограничение KIZ_REQUEST_TIMEOUT должно быть неотрицательным и меньше SERVER_WRITE_TIMEOUT")
+	}
+	if c.RequestLimits.KIZConcurrency <= 0 {
+		problems = append(problems, "число одновременных запросов KIZ_MAX_CONCURRENT должно быть положительным")
+	}
+	if c.RequestLimits.KIZPremiumConcurrency < 0 {
+		problems = append(problems, "число одновременных запросов KIZ_PREMIUM_MAX_CONCURRENT не может быть отрицательным")
+	}
+	if c.RequestLimits.KIZQueueSize < 0 {
+		problems = append(problems, "размер очереди KIZ_QUEUE_SIZE не может быть отрицательным")
+	}
+	if c.RequestLimits.MaxBodySize <= 0 || c.RequestLimits.MaxUploadSize < c.RequestLimits.MaxBodySize {
+		problems = append(problems, "размер REQUEST_MAX_BODY_SIZE должен быть положительным, REQUEST_MAX_UPLOAD_SIZE - не меньше него")
+	}
+	if c.KIZOrders.MaxCodes <= 0 || c.KIZOrders.MaxGTINCodes <= 0 || c.KIZOrders.MaxProducts <= 0 || c.KIZOrders.Concurrency <= 0 {
+		problems = append(problems, "KIZ_ORDER_MAX_CODES, KIZ_ORDER_MAX_GTIN_CODES, KIZ_ORDER_MAX_PRODUCTS и KIZ_ORDER_CONCURRENCY должны быть положительными")
+	}
+	if c.InventoryLowStock < 0 {
+		problems = append(problems, "порог INVENTORY_LOW_STOCK не может быть отрицательным")
+	}
+	if c.ReportInterval <= 0 {
+		problems = append(problems, "период REPORT_INTERVAL должен быть положительным")
+	}
+	if c.OrderScheduleInterval <= 0 {
+		problems = append(problems, "период ORDER_SCHEDULE_INTERVAL должен быть положительным")
+	}
+	if _, err := time.LoadLocation(c.DefaultTimezone); err != nil || c.DefaultTimezone == "" {
+		problems = append(problems, fmt.Sprintf("неизвестный часовой пояс DEFAULT_TIMEZONE: %s", c.DefaultTimezone))
+	}
+	if c.AnalyticsRefreshInterval < 0 {
+		problems = append(problems, "период ANALYTICS_REFRESH_INTERVAL не может быть отрицательным")
+	}
+	if c.LeaderLeaseTTL != 0 && c.LeaderLeaseTTL < 3*time.Second {
+		problems = append(problems, "срок аренды LEADER_LEASE_TTL должен быть 0 или не меньше 3s")
+	}
+	if c.Compression.MinSize < 0 {
+		problems = append(problems, "размер COMPRESSION_MIN_SIZE не может быть отрицательным")
+	}
+	if c.RateLimit.RequestsPerSecond <= 0 || c.RateLimit.Burst <= 0 {
+		problems = append(problems, "RATE_LIMIT_RPS и RATE_LIMIT_BURST должны быть положительными")
+	}
+	if c.AuthGuard.MaxFailures <= 0 || c.AuthGuard.Window <= 0 || c.AuthGuard.Lockout <= 0 {
+		problems = append(problems, "AUTH_MAX_FAILURES, AUTH_FAILURE_WINDOW и AUTH_LOCKOUT должны быть положительными")
+	}
+	if c.AuthGuard.MaxLockout < c.AuthGuard.Lockout {
+		problems = append(problems, "AUTH_MAX_LOCKOUT не может быть меньше AUTH_LOCKOUT")
+	}
+	if c.AuthGuard.RegistrationLimit < 0 {
+		problems = append(problems, "AUTH_REGISTRATION_LIMIT не может быть отрицательным")
+	}
+	for _, proxy := range c.Proxies.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(proxy); err != nil {
+			problems = append(problems, fmt.Sprintf("TRUSTED_PROXIES: ожидается IP-адрес или подсеть, получено %q", proxy))
+		}
+	}
+	if c.API.CertCheckInterval <= 0 {
+		problems = append(problems, "период CERTIFICATE_CHECK_INTERVAL должен быть положительным")
+	}
+	problems = append(problems, c.API.Transport.validate("CHESTNY_ZNAK_")...)
+	problems = append(problems, c.OMS.Transport.validate("OMS_")...)
+	if c.Invoice.DueDays <= 0 {
+		problems = append(problems, "срок оплаты счета INVOICE_DUE_DAYS должен быть положительным")
+	}
+	if c.Invoice.VATRate < 0 || c.Invoice.VATRate > 100 {
+		problems = append(problems, "ставка НДС INVOICE_VAT_RATE должна быть от 0 до 100")
+	}
+	if c.Referral.Bonus < 0 {
+		problems = append(problems, "бонус REFERRAL_BONUS не может быть отрицательным")
+	}
+	if c.Referral.BonusPercent < 0 || c.Referral.BonusPercent > 100 {
+		problems = append(problems, "процент бонуса REFERRAL_BONUS_PERCENT должен быть от 0 до 100")
+	}
+	if c.Confirmation.TTL <= 0 || c.Confirmation.MaxAttempts <= 0 {
+		problems = append(problems, "CONFIRMATION_TTL и CONFIRMATION_MAX_ATTEMPTS должны быть положительными")
+	}
+	if c.Confirmation.OrderThreshold < 0 {
+		problems = append(problems, "порог суммы заказа CONFIRMATION_ORDER_THRESHOLD не может быть отрицательным")
+	}
+	if c.Fiscal.Provider != "" {
+		if c.Fiscal.Provider != "atol" {
+			problems = append(problems, fmt.Sprintf("неизвестный оператор фискальных данных FISCAL_PROVIDER: %s", c.Fiscal.Provider))
+		}
+		if c.Fiscal.Login == "" || c.Fiscal.GroupCode == "" || c.Fiscal.INN == "" || c.Fiscal.Email == "" {
+			problems = append(problems, "для фискализации необходимо указать ATOL_LOGIN, ATOL_GROUP_CODE, FISCAL_INN и FISCAL_EMAIL")
+		}
+		if c.Fiscal.MaxAttempts <= 0 {
+			problems = append(problems, "число попыток FISCAL_MAX_ATTEMPTS должно быть положительным")
+		}
+		if c.Fiscal.Interval <= 0 {
+			problems = append(problems, "период FISCAL_INTERVAL должен быть положительным")
+		}
+	}
+	if c.EDO.Provider != "" {
+		if c.EDO.Provider != "diadoc" && c.EDO.Provider != "sbis" {
+			problems = append(problems, fmt.Sprintf("неизвестный оператор ЭДО EDO_PROVIDER: %s", c.EDO.Provider))
+		}
+		if c.EDO.Login == "" || c.EDO.Password == "" {
+			problems = append(problems, "для отправки УПД необходимо указать EDO_LOGIN и EDO_PASSWORD")
+		}
+		if c.EDO.Provider == "diadoc" && c.EDO.ClientID == "" {
+			problems = append(problems, "для работы с Диадоком необходимо указать DIADOC_CLIENT_ID")
+		}
+		if c.EDO.PollInterval <= 0 {
+			problems = append(problems, "период EDO_POLL_INTERVAL должен быть положительным")
+		}
+	}
+	if c.Erasure.Retention <= 0 || c.Erasure.PurgeInterval <= 0 {
+		problems = append(problems, "USER_RETENTION_PERIOD и USER_PURGE_INTERVAL должны быть положительными")
+	}
+	if c.Archive.Retention < 0 || c.Archive.CleanupInterval <= 0 {
+		problems = append(problems, "ARCHIVE_RETENTION не может быть отрицательным, а ARCHIVE_CLEANUP_INTERVAL должен быть положительным")
+	}
+	if c.Outbox.Interval <= 0 || c.Outbox.MaxAttempts <= 0 {
+		problems = append(problems, "OUTBOX_INTERVAL и OUTBOX_MAX_ATTEMPTS должны быть положительными")
+	}
+	if c.Announcements.Interval <= 0 || c.Announcements.Batch <= 0 {
+		problems = append(problems, "ANNOUNCEMENT_INTERVAL и ANNOUNCEMENT_BATCH должны быть положительными")
+	}
+	if !c.APIVersions.LegacySunset.After(c.APIVersions.LegacyDeprecated) {
+		problems = append(problems, "LEGACY_API_SUNSET должна быть позже LEGACY_API_DEPRECATED")
+	}
+	if c.StatusInterval <= 0 {
+		problems = append(problems, "STATUS_INTERVAL должен быть положительным")
+	}
+	if c.Startup.MaxWait <= 0 || c.Startup.RetryInterval <= 0 {
+		problems = append(problems, "STARTUP_MAX_WAIT и STARTUP_RETRY_INTERVAL должны быть положительными")
+	}
+	if c.Payment.TTL <= 0 {
+		problems = append(problems, "срок оплаты PAYMENT_TTL должен быть положительным")
+	}
+	if c.Payment.RobokassaLogin != "" && c.Payment.RobokassaPassword2 == "" {
+		problems = append(problems, "для приема уведомлений Robokassa необходимо указать ROBOKASSA_PASSWORD2")
+	}
+	if c.Payment.StripeSecretKey != "" {
+		if c.Payment.StripeWebhookSecret == "" {
+			problems = append(problems, "для приема платежей Stripe необходимо указать STRIPE_WEBHOOK_SECRET")
+		}
+		for _, currency := range c.Payment.StripeCurrencies {
+			if len(currency) != 3 {
+				problems = append(problems, fmt.Sprintf("некорректная валюта STRIPE_CURRENCIES: %s", currency))
+			}
+		}
+	}
+	if len(c.Payment.Providers) == 0 {
+		problems = append(problems, "PAYMENT_PROVIDERS должен содержать хотя бы одного провайдера")
+	}
+	problems = append(problems, validatePaymentRoute("PAYMENT_PROVIDERS", c.Payment.Providers)...)
+	problems = append(problems, validatePaymentRoutes("PAYMENT_ROUTE_AMOUNT_", c.Payment.AmountRoutes)...)
+	problems = append(problems, validatePaymentRoutes("PAYMENT_ROUTE_USER_", c.Payment.UserRoutes)...)
+	if c.Secrets.Enabled() && c.SecretsRefreshInterval <= 0 {
+		problems = append(problems, "период SECRETS_REFRESH_INTERVAL должен быть положительным")
+	}
+	return problems
+}
+
+// Проверка провайдеров маршрута платежей; name - имя параметра
+func validatePaymentRoute(name string, route []string) []string {
+	var problems []string
+	for _, provider := range route {
+		if !slices.Contains(paymentProviders, provider) {
+			problems = append(problems, fmt.Sprintf("%s: неизвестный платежный провайдер %q, допустимы: %s",
+				name, provider, strings.Join(paymentProviders, ", ")))
+		}
+	}
+	return problems
+}
+
+// Проверка маршрутов платежей из переменных с префиксом prefix
+func validatePaymentRoutes(prefix string, routes map[int][]string) []string {
+	keys := make([]int, 0, len(routes))
+	for key := range routes {
+		keys = append(keys, key)
 	}
-	if c.API.APIKey == "" {
-		return fmt.Errorf("API ключ не указан")
+	sort.Ints(keys)
+	var problems []string
+	for _, key := range keys {
+		problems = append(problems, validatePaymentRoute(fmt.Sprintf("%s%d", prefix, key), routes[key])...)
 	}
-	return nil
+	return problems
 }
 
-func getEnv(key, defaultValue string) string {
+// DSN возвращает строку подключения к PostgreSQL
+// Проверка параметров соединений; prefix - префикс переменных окружения
+func (c TransportConfig) validate(prefix string) []string {
+	var problems []string
+	if c.ProxyURL != "" {
+		proxy, err := url.Parse(c.ProxyURL)
+		if err != nil || proxy.Host == "" || (proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5") {
+			problems = append(problems, fmt.Sprintf("адрес прокси-сервера %sPROXY_URL должен иметь схему http, https или socks5: %s", prefix, c.ProxyURL))
+		}
+	}
+	if (c.ClientCertFile == "") != (c.ClientKeyFile == "") {
+		problems = append(problems, fmt.Sprintf("для клиентского сертификата TLS необходимо указать и %sCLIENT_CERT_FILE, и %sCLIENT_KEY_FILE", prefix, prefix))
+	}
+	if c.MinTLSVersion != "1.2" && c.MinTLSVersion != "1.3" {
+		problems = append(problems, fmt.Sprintf("версия %sTLS_MIN_VERSION должна быть 1.2 или 1.3: %s", prefix, c.MinTLSVersion))
+	}
+	return problems
+}
+
+func (c DatabaseConfig) DSN() string {
+	return c.dsn(c.Host, c.Port)
+}
+
+// ReplicaDSN возвращает строку подключения к реплике; пустую строку, если реплика не настроена
+func (c DatabaseConfig) ReplicaDSN() string {
+	if c.ReplicaHost == "" {
+		return ""
+	}
+	return c.dsn(c.ReplicaHost, c.ReplicaPort)
+}
+
+func (c DatabaseConfig) dsn(host, port string) string {
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		host, port, c.User, c.Password, c.Name, c.SSLMode,
+	)
+}
+
+// Идентификатор экземпляра по умолчанию: имя хоста (в Kubernetes - имя пода) и номер процесса
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Источник параметров конфигурации. Значение параметра ищется в секретах из хранилища,
+// переменных окружения и файле конфигурации по порядку; если параметр не задан,
+// используется значение по умолчанию. Некорректные значения собираются в problems.
+type loader struct {
+	secrets  map[string]string
+	file     *fileValues
+	used     map[string]bool
+	prefixes []string
+	problems []string
+}
+
+func newLoader() *loader {
+	return &loader{file: &fileValues{}, used: make(map[string]bool)}
+}
+
+func (l *loader) lookup(key string) string {
+	l.used[key] = true
+	if value := l.secrets[key]; value != "" {
+		return value
+	}
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
+	return l.file.values[key]
+}
+
+func (l *loader) problem(format string, args ...any) {
+	l.problems = append(l.problems, fmt.Sprintf(format, args...))
+}
+
+func (l *loader) getEnv(key, defaultValue string) string {
+	if value := l.lookup(key); value != "" {
+		return value
+	}
 	return defaultValue
 }
 
-func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
+func (l *loader) getIntEnv(key string, defaultValue int) int {
+	if value := l.lookup(key); value != "" {
+		number, err := strconv.Atoi(value)
+		if err == nil {
+			return number
+		}
+		l.problem("%s: ожидается целое число, получено %q", key, value)
+	}
+	return defaultValue
+}
+
+func (l *loader) getInt64Env(key string, defaultValue int64) int64 {
+	if value := l.lookup(key); value != "" {
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			return number
+		}
+		l.problem("%s: ожидается целое число, получено %q", key, value)
+	}
+	return defaultValue
+}
+
+func (l *loader) getFloatEnv(key string, defaultValue float64) float64 {
+	if value := l.lookup(key); value != "" {
+		number, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return number
+		}
+		l.problem("%s: ожидается число, получено %q", key, value)
+	}
+	return defaultValue
+}
+
+func (l *loader) getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := l.lookup(key); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err == nil {
 			return duration
 		}
+		l.problem("%s: ожидается длительность, например \"30s\" или \"5m\", получено %q", key, value)
 	}
 	return defaultValue
 }
+
+// Дата в формате ГГГГ-ММ-ДД, полночь UTC
+func (l *loader) getDateEnv(key, defaultValue string) time.Time {
+	value := l.getEnv(key, defaultValue)
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		l.problem("%s: ожидается дата в формате ГГГГ-ММ-ДД, получено %q", key, value)
+		date, _ = time.Parse(time.DateOnly, defaultValue)
+	}
+	return date
+}
+
+// Список значений, разделенных запятыми; пустые элементы пропускаются
+func (l *loader) getListEnv(key, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(l.getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Значения параметров с общим префиксом из переменных окружения и файла конфигурации.
+// Ключ - остаток имени параметра в нижнем регистре.
+// Параметры соединений из переменных с префиксом prefix; незаданные берутся из defaults
+func (l *loader) getTransportConfig(prefix string, defaults TransportConfig) TransportConfig {
+	return TransportConfig{
+		ProxyURL:       l.getEnv(prefix+"PROXY_URL", defaults.ProxyURL),
+		CAFile:         l.getEnv(prefix+"CA_FILE", defaults.CAFile),
+		ClientCertFile: l.getEnv(prefix+"CLIENT_CERT_FILE", defaults.ClientCertFile),
+		ClientKeyFile:  l.getEnv(prefix+"CLIENT_KEY_FILE", defaults.ClientKeyFile),
+		MinTLSVersion:  l.getEnv(prefix+"TLS_MIN_VERSION", defaults.MinTLSVersion),
+	}
+}
+
+func (l *loader) getPrefixedEnv(prefix string) map[string]string {
+	l.prefixes = append(l.prefixes, prefix)
+	values := make(map[string]string)
+	for key, value := range l.file.values {
+		if name, ok := strings.CutPrefix(key, prefix); ok && name != "" && value != "" {
+			values[strings.ToLower(name)] = value
+		}
+	}
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		if name, ok := strings.CutPrefix(key, prefix); ok && name != "" && value != "" {
+			values[strings.ToLower(name)] = value
+		}
+	}
+	return values
+}
+
+// Списки из переменных с префиксом prefix и целым числом после него, например
+// PAYMENT_ROUTE_USER_42=stripe,robokassa
+func (l *loader) getRoutesEnv(prefix string) map[int][]string {
+	routes := make(map[int][]string)
+	for name, value := range l.getPrefixedEnv(prefix) {
+		key, err := strconv.Atoi(name)
+		if err != nil || key < 0 {
+			l.problem("%s%s: ожидается неотрицательное целое число после %s", prefix, strings.ToUpper(name), prefix)
+			continue
+		}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				routes[key] = append(routes[key], item)
+			}
+		}
+	}
+	return routes
+}
+
+func (l *loader) getPrefixedIntEnv(prefix string) map[string]int {
+	values := make(map[string]int)
+	for name, value := range l.getPrefixedEnv(prefix) {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			l.problem("%s%s: ожидается целое число, получено %q", prefix, strings.ToUpper(name), value)
+			continue
+		}
+		values[name] = number
+	}
+	return values
+}
+
+// Параметры файла конфигурации, не соответствующие ни одному параметру сервиса
+func (l *loader) checkUnknownFileKeys() {
+	for key, path := range l.file.paths {
+		if l.used[key] {
+			continue
+		}
+		known := false
+		for _, prefix := range l.prefixes {
+			if strings.HasPrefix(key, prefix) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			l.problem("%s: неизвестный параметр в файле конфигурации %s", path, l.file.name)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -64,3 +65,126 @@ func TestLoadConfig(t *testing.T) {
 		t.Errorf("Ожидался SSLMode disable, получен %s", cfg.Database.SSLMode)
 	}
 }
+
+func TestLoadConfigGRPC(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if cfg.Server.GRPCPort != "9090" {
+		t.Errorf("Ожидался gRPC порт 9090, получен %s", cfg.Server.GRPCPort)
+	}
+}
+
+func TestLoadConfigDocumentPolling(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if cfg.DocumentPollInterval != time.Minute {
+		t.Errorf("Ожидался DocumentPollInterval 1m, получен %v", cfg.DocumentPollInterval)
+	}
+}
+
+func TestLoadConfigOMS(t *testing.T) {
+	t.Setenv("OMS_CLIENT_TOKEN_MILK", "milk_token")
+	t.Setenv("OMS_TEMPLATE_ID_MILK", "20")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if cfg.OMS.ClientTokens["milk"] != "milk_token" {
+		t.Errorf("Ожидался токен СУЗ milk_token для молочной продукции, получен %q", cfg.OMS.ClientTokens["milk"])
+	}
+	if cfg.OMS.TemplateIDs["milk"] != 20 {
+		t.Errorf("Ожидался шаблон СУЗ 20 для молочной продукции, получен %d", cfg.OMS.TemplateIDs["milk"])
+	}
+}
+
+func TestLoadConfigReplica(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if cfg.Database.ReplicaDSN() != "" {
+		t.Errorf("Реплика БД не настроена, но получена строка подключения %s", cfg.Database.ReplicaDSN())
+	}
+}
+
+func TestLoadConfigDatabaseDriver(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if cfg.Database.Driver != DatabaseDriverPostgres {
+		t.Errorf("Ожидался драйвер БД postgres, получен %s", cfg.Database.Driver)
+	}
+}
+
+func TestLoadConfigTransport(t *testing.T) {
+	t.Setenv("CHESTNY_ZNAK_PROXY_URL", "http://proxy.local:3128")
+	t.Setenv("OMS_TLS_MIN_VERSION", "1.3")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if cfg.OMS.Transport.ProxyURL != "http://proxy.local:3128" || cfg.OMS.Transport.MinTLSVersion != "1.3" {
+		t.Errorf("Прокси-сервер СУЗ должен по умолчанию совпадать с прокси Честного ЗНАКа: %+v", cfg.OMS.Transport)
+	}
+	if cfg.API.Transport.MinTLSVersion != "1.2" {
+		t.Errorf("Ожидалась минимальная версия TLS 1.2, получена %s", cfg.API.Transport.MinTLSVersion)
+	}
+}
+
+func TestLoadConfigRequestLimits(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if cfg.RequestLimits.MaxBodySize != 1<<20 || cfg.RequestLimits.MaxUploadSize != 10<<20 {
+		t.Errorf("Ожидались ограничения размера запроса 1 МБ и 10 МБ, получены %d и %d",
+			cfg.RequestLimits.MaxBodySize, cfg.RequestLimits.MaxUploadSize)
+	}
+}
+
+func TestLoadConfigLegacySunset(t *testing.T) {
+	t.Setenv("LEGACY_API_SUNSET", "2026-01-01")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "LEGACY_API_SUNSET") {
+		t.Errorf("Дата отключения раньше даты объявления должна быть ошибкой, получено %v", err)
+	}
+
+	t.Setenv("LEGACY_API_SUNSET", "2027-12-31")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if want := time.Date(2027, 12, 31, 0, 0, 0, 0, time.UTC); !cfg.APIVersions.LegacySunset.Equal(want) {
+		t.Errorf("Ожидалась дата отключения %s, получена %s", want, cfg.APIVersions.LegacySunset)
+	}
+}
+
+func TestLoadConfigPaymentRoutes(t *testing.T) {
+	t.Setenv("PAYMENT_PROVIDERS", "stripe, robokassa")
+	t.Setenv("PAYMENT_ROUTE_AMOUNT_100000", "robokassa")
+	t.Setenv("PAYMENT_ROUTE_USER_42", "stripe")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if got := cfg.Payment.Providers; len(got) != 2 || got[0] != "stripe" || got[1] != "robokassa" {
+		t.Errorf("Ожидался порядок провайдеров stripe, robokassa, получен %v", got)
+	}
+	if got := cfg.Payment.AmountRoutes[100000]; len(got) != 1 || got[0] != "robokassa" {
+		t.Errorf("Ожидался маршрут robokassa для сумм от 100000, получен %v", got)
+	}
+	if got := cfg.Payment.UserRoutes[42]; len(got) != 1 || got[0] != "stripe" {
+		t.Errorf("Ожидался маршрут stripe для пользователя 42, получен %v", got)
+	}
+
+	t.Setenv("PAYMENT_ROUTE_USER_42", "paypal")
+	t.Setenv("PAYMENT_ROUTE_AMOUNT_LARGE", "stripe")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "PAYMENT_ROUTE_USER_42") || !strings.Contains(err.Error(), "PAYMENT_ROUTE_AMOUNT_LARGE") {
+		t.Errorf("Неизвестный провайдер и порог не числом должны быть ошибками, получено %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Параметры из файла конфигурации по имени переменной окружения
+type fileValues struct {
+	name   string
+	values map[string]string
+	paths  map[string]string // Путь параметра в файле, например db.host
+}
+
+// Чтение файла конфигурации в формате YAML. Вложенные ключи соответствуют переменным
+// окружения: имена уровней объединяются через "_" и переводятся в верхний регистр,
+// поэтому db.host задает DB_HOST, а rate_limit.rps - RATE_LIMIT_RPS.
+func readConfigFile(name string) (*fileValues, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла конфигурации: %w", err)
+	}
+
+	var root map[string]any
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла конфигурации %s: %w", name, err)
+	}
+
+	file := &fileValues{name: name, values: make(map[string]string), paths: make(map[string]string)}
+	var problems []string
+	file.flatten(root, "", "", &problems)
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("ошибка разбора файла конфигурации %s: %s", name, strings.Join(problems, "; "))
+	}
+	return file, nil
+}
+
+func (f *fileValues) flatten(node map[string]any, key, path string, problems *[]string) {
+	for name, value := range node {
+		childKey := strings.ToUpper(name)
+		childPath := name
+		if key != "" {
+			childKey = key + "_" + childKey
+			childPath = path + "." + name
+		}
+
+		switch value := value.(type) {
+		case nil:
+		case map[string]any:
+			f.flatten(value, childKey, childPath, problems)
+		case []any:
+			*problems = append(*problems, childPath+": списки не поддерживаются")
+		default:
+			if previous, ok := f.paths[childKey]; ok {
+				*problems = append(*problems, fmt.Sprintf("%s: повторяет параметр %s", childPath, previous))
+				continue
+			}
+			f.values[childKey] = fmt.Sprint(value)
+			f.paths[childKey] = childPath
+		}
+	}
+}
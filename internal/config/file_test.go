@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, `
+server:
+  port: 8082
+  read_timeout: 20s
+db:
+  host: file_host
+  password: file_password
+rate_limit:
+  rps: 50
+oms:
+  client_token:
+    milk: file_token
+`))
+	t.Setenv("SERVER_PORT", "")
+	t.Setenv("DB_HOST", "env_host")
+	t.Setenv("DB_PASSWORD", "")
+	t.Setenv("OMS_CLIENT_TOKEN_MILK", "")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	if cfg.Server.Port != "8082" || cfg.Server.ReadTimeout != 20*time.Second || cfg.Database.Password != "file_password" {
+		t.Errorf("Параметры файла не применены: %+v, %+v", cfg.Server, cfg.Database)
+	}
+	if cfg.Database.Host != "env_host" {
+		t.Errorf("Переменная окружения должна иметь приоритет над файлом, получен хост %s", cfg.Database.Host)
+	}
+	if cfg.RateLimit.RequestsPerSecond != 50 || cfg.OMS.ClientTokens["milk"] != "file_token" {
+		t.Errorf("Неверные лимиты или токены СУЗ: %+v, %v", cfg.RateLimit, cfg.OMS.ClientTokens)
+	}
+}
+
+func TestLoadConfigFileProblems(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, `
+db:
+  hots: typo
+  password: secret
+server:
+  read_timeout: soon
+log_level: verbose
+`))
+	t.Setenv("SERVER_READ_TIMEOUT", "")
+	t.Setenv("LOG_LEVEL", "")
+
+	_, err := Load()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Ожидалась ошибка валидации, получено %v", err)
+	}
+	message := err.Error()
+	for _, want := range []string{"db.hots", "SERVER_READ_TIMEOUT", "LOG_LEVEL"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("Ошибка не содержит %s: %s", want, message)
+		}
+	}
+	if len(validationErr.Problems) != 3 {
+		t.Errorf("Ожидалось 3 ошибки, получено %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Хранилища секретов
+const (
+	SecretsVault = "vault" // HashiCorp Vault, механизм KV версии 2
+	SecretsAWS   = "aws"   // AWS Secrets Manager
+)
+
+// Переменные окружения, значения которых являются секретами и скрываются в журнале
+var secretKeys = []string{
+	"DB_PASSWORD",
+	"CHESTNY_ZNAK_API_KEY",
+	"KEYSTORE_PIN",
+	"ROBOKASSA_PASSWORD",
+	"ROBOKASSA_PASSWORD2",
+	"STRIPE_SECRET_KEY",
+	"STRIPE_WEBHOOK_SECRET",
+	"NATIONAL_CATALOG_API_KEY",
+	"DADATA_API_KEY",
+	"SMTP_PASSWORD",
+	"REDIS_PASSWORD",
+	"TELEGRAM_BOT_TOKEN",
+	"DOCUMENT_WEBHOOK_SECRET",
+	"DOWNLOAD_LINK_SECRET",
+	"ATOL_PASSWORD",
+	"EDO_PASSWORD",
+	"USER_HASH_SECRET",
+}
+
+// Значения короче этой длины не скрываются в журнале, чтобы не искажать его текст
+const minRedactedLength = 4
+
+// SecretsProvider загружает секреты из внешнего хранилища. Имена секретов совпадают
+// с именами переменных окружения, например DB_PASSWORD.
+type SecretsProvider interface {
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+// Secrets хранит текущие значения секретов. Значения из хранилища периодически
+// перечитываются в Run; подписчики OnChange получают новые значения после ротации.
+type Secrets struct {
+	provider SecretsProvider
+
+	mu       sync.RWMutex
+	values   map[string]string
+	handlers map[string][]func(value string)
+	replacer *strings.Replacer
+}
+
+// Загрузка секретов из хранилища SECRETS_PROVIDER. Если хранилище не задано, секреты
+// берутся только из переменных окружения и файла конфигурации.
+func (l *loader) loadSecrets() (*Secrets, error) {
+	timeout := l.getDurationEnv("SECRETS_TIMEOUT", 10*time.Second)
+
+	var provider SecretsProvider
+	switch name := l.getEnv("SECRETS_PROVIDER", ""); name {
+	case "":
+	case SecretsVault:
+		vault := &VaultProvider{
+			Addr:      l.getEnv("VAULT_ADDR", ""),
+			Token:     l.getEnv("VAULT_TOKEN", ""),
+			Namespace: l.getEnv("VAULT_NAMESPACE", ""),
+			Mount:     l.getEnv("VAULT_MOUNT", "secret"),
+			Path:      l.getEnv("VAULT_SECRET_PATH", ""),
+			Timeout:   timeout,
+		}
+		if vault.Addr == "" || vault.Token == "" || vault.Path == "" {
+			return nil, fmt.Errorf("для хранилища vault необходимо указать VAULT_ADDR, VAULT_TOKEN и VAULT_SECRET_PATH")
+		}
+		provider = vault
+	case SecretsAWS:
+		aws := &AWSSecretsProvider{
+			Region:          l.getEnv("AWS_REGION", l.getEnv("AWS_DEFAULT_REGION", "")),
+			AccessKeyID:     l.getEnv("AWS_ACCESS_KEY_ID", ""),
+			SecretAccessKey: l.getEnv("AWS_SECRET_ACCESS_KEY", ""),
+			SessionToken:    l.getEnv("AWS_SESSION_TOKEN", ""),
+			SecretID:        l.getEnv("AWS_SECRET_ID", ""),
+			Endpoint:        l.getEnv("AWS_SECRETS_ENDPOINT", ""),
+			Timeout:         timeout,
+		}
+		if aws.Region == "" || aws.AccessKeyID == "" || aws.SecretAccessKey == "" || aws.SecretID == "" {
+			return nil, fmt.Errorf("для хранилища aws необходимо указать AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY и AWS_SECRET_ID")
+		}
+		provider = aws
+	default:
+		return nil, fmt.Errorf("неизвестное хранилище секретов SECRETS_PROVIDER: %s", name)
+	}
+
+	secrets := &Secrets{provider: provider, values: make(map[string]string)}
+	for _, key := range secretKeys {
+		if value := l.getEnv(key, ""); value != "" {
+			secrets.values[key] = value
+		}
+	}
+	if provider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		values, err := provider.Fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			secrets.values[key] = value
+		}
+		l.secrets = values
+	}
+	secrets.replacer = newRedactReplacer(secrets.values)
+	return secrets, nil
+}
+
+// Enabled сообщает, загружаются ли секреты из внешнего хранилища
+func (s *Secrets) Enabled() bool {
+	return s != nil && s.provider != nil
+}
+
+// Get возвращает текущее значение секрета
+func (s *Secrets) Get(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[key]
+}
+
+// OnChange регистрирует обработчик нового значения секрета key после ротации
+func (s *Secrets) OnChange(key string, handler func(value string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[string][]func(string))
+	}
+	s.handlers[key] = append(s.handlers[key], handler)
+}
+
+// Refresh перечитывает секреты из хранилища и возвращает имена изменившихся секретов.
+// Секреты, удаленные из хранилища, сохраняют прежние значения.
+func (s *Secrets) Refresh(ctx context.Context) ([]string, error) {
+	if !s.Enabled() {
+		return nil, nil
+	}
+	values, err := s.provider.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	var handlers []func()
+	s.mu.Lock()
+	for key, value := range values {
+		if s.values[key] == value {
+			continue
+		}
+		s.values[key] = value
+		changed = append(changed, key)
+		for _, handler := range s.handlers[key] {
+			handler, value := handler, value
+			handlers = append(handlers, func() { handler(value) })
+		}
+	}
+	if len(changed) > 0 {
+		s.replacer = newRedactReplacer(s.values)
+	}
+	s.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler()
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// Run перечитывает секреты из хранилища каждые interval до отмены контекста. Ошибки
+// загрузки передаются в onError, секреты сохраняют прежние значения. Если хранилище
+// не задано, сразу завершается.
+func (s *Secrets) Run(ctx context.Context, interval time.Duration, onError func(err error)) {
+	if !s.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Refresh(ctx); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Redact заменяет значения секретов в тексте на ***
+func (s *Secrets) Redact(text string) string {
+	s.mu.RLock()
+	replacer := s.replacer
+	s.mu.RUnlock()
+	return replacer.Replace(text)
+}
+
+// RedactWriter возвращает io.Writer, скрывающий значения секретов в записываемых в w данных.
+// Значения скрываются только внутри одной записи, поэтому подходит для журнала,
+// записывающего каждое сообщение целиком.
+func (s *Secrets) RedactWriter(w io.Writer) io.Writer {
+	return redactWriter{secrets: s, w: w}
+}
+
+type redactWriter struct {
+	secrets *Secrets
+	w       io.Writer
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, r.secrets.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Замена значений секретов; более длинные значения заменяются первыми, чтобы секрет,
+// содержащий другой секрет, был скрыт целиком
+func newRedactReplacer(values map[string]string) *strings.Replacer {
+	var secrets []string
+	for _, value := range values {
+		if len(value) >= minRedactedLength {
+			secrets = append(secrets, value)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+
+	pairs := make([]string, 0, len(secrets)*2)
+	for _, value := range secrets {
+		pairs = append(pairs, value, "***")
+	}
+	return strings.NewReplacer(pairs...)
+}
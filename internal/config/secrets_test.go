@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVaultProvider(t *testing.T) {
+	password := "first-password"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/project-znak" || r.Header.Get("X-Vault-Token") != "token" {
+			t.Errorf("неверный запрос к Vault: %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"data": {"data": {"DB_PASSWORD": "` + password + `", "DB_PORT": 6432}, "metadata": {"version": 2}}}`))
+	}))
+	defer server.Close()
+
+	secrets := &Secrets{
+		provider: &VaultProvider{Addr: server.URL, Token: "token", Mount: "secret", Path: "project-znak"},
+		values:   map[string]string{"DB_PASSWORD": "env-password"},
+	}
+	var rotated string
+	secrets.OnChange("DB_PASSWORD", func(value string) { rotated = value })
+
+	changed, err := secrets.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("ошибка загрузки секретов: %v", err)
+	}
+	if len(changed) != 2 || rotated != "first-password" || secrets.Get("DB_PORT") != "6432" {
+		t.Errorf("неверные секреты после загрузки: %v, %q", changed, rotated)
+	}
+
+	password = "second-password"
+	if changed, _ := secrets.Refresh(context.Background()); len(changed) != 1 || changed[0] != "DB_PASSWORD" {
+		t.Errorf("ожидалось изменение DB_PASSWORD, получено %v", changed)
+	}
+	if rotated != "second-password" || secrets.Get("DB_PASSWORD") != "second-password" {
+		t.Errorf("пароль не обновлен: %q", rotated)
+	}
+}
+
+func TestAWSSecretsProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(authorization, "/eu-central-1/secretsmanager/aws4_request") ||
+			!strings.Contains(authorization, "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target") {
+			t.Errorf("неверная подпись запроса: %s", authorization)
+		}
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			t.Errorf("неверная операция: %s", r.Header.Get("X-Amz-Target"))
+		}
+		w.Write([]byte(`{"Name": "znak", "SecretString": "{\"ROBOKASSA_PASSWORD\": \"shop-secret\"}"}`))
+	}))
+	defer server.Close()
+
+	provider := &AWSSecretsProvider{
+		Region:          "eu-central-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		SessionToken:    "session",
+		SecretID:        "znak",
+		Endpoint:        server.URL,
+	}
+	values, err := provider.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("ошибка загрузки секрета: %v", err)
+	}
+	if values["ROBOKASSA_PASSWORD"] != "shop-secret" {
+		t.Errorf("неверные секреты: %v", values)
+	}
+}
+
+func TestRedactWriter(t *testing.T) {
+	secrets := &Secrets{values: map[string]string{"DB_PASSWORD": "s3cr3t", "DB_PASSWORD_OLD": "s3cr3t-old", "SHORT": "abc"}}
+	secrets.replacer = newRedactReplacer(secrets.values)
+
+	var output bytes.Buffer
+	line := "dsn password=s3cr3t-old, retry with s3cr3t, abc\n"
+	n, err := secrets.RedactWriter(&output).Write([]byte(line))
+	if err != nil || n != len(line) {
+		t.Fatalf("ошибка записи: %d, %v", n, err)
+	}
+	if got := output.String(); got != "dsn password=***, retry with ***, abc\n" {
+		t.Errorf("секреты не скрыты: %q", got)
+	}
+}
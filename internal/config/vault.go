@@ -0,0 +1,78 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultProvider читает секреты из HashiCorp Vault (механизм KV версии 2). Секрет Path
+// должен содержать пары "имя переменной окружения - значение".
+type VaultProvider struct {
+	Addr      string // Адрес Vault, например https://vault.example.com:8200
+	Token     string
+	Namespace string // Пространство имен Vault Enterprise
+	Mount     string // Точка монтирования KV, по умолчанию secret
+	Path      string // Путь к секрету внутри точки монтирования
+	Timeout   time.Duration
+
+	httpClient *http.Client
+}
+
+// Fetch возвращает последнюю версию секрета
+func (p *VaultProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	if p.httpClient == nil {
+		p.httpClient = &http.Client{Timeout: p.Timeout}
+	}
+
+	url := strings.TrimRight(p.Addr, "/") + "/v1/" + strings.Trim(p.Mount, "/") + "/data/" + strings.Trim(p.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса к Vault: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к Vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("Vault вернул статус %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ошибка разбора ответа Vault: %w", err)
+	}
+	return secretStrings(result.Data.Data), nil
+}
+
+// Приведение значений секрета к строкам; числа и логические значения записываются
+// так же, как в переменных окружения
+func secretStrings(data map[string]any) map[string]string {
+	values := make(map[string]string, len(data))
+	for key, value := range data {
+		switch value := value.(type) {
+		case nil:
+		case string:
+			values[key] = value
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,194 @@
+// Package cron разбирает выражения расписания cron из пяти полей (минута, час, день месяца,
+// месяц, день недели) и вычисляет ближайшее время запуска в часовом поясе переданного времени.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Наибольший срок поиска следующего запуска: выражение вроде "0 0 30 2 *" не срабатывает никогда
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+// Сокращения для часто используемых расписаний
+var macros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// Поле выражения: допустимый диапазон значений и английские сокращения названий
+type field struct {
+	name     string
+	min, max int
+	names    []string // Названия значений начиная с min
+}
+
+var (
+	minuteField = field{name: "минута", min: 0, max: 59}
+	hourField   = field{name: "час", min: 0, max: 23}
+	dayField    = field{name: "день месяца", min: 1, max: 31}
+	monthField  = field{name: "месяц", min: 1, max: 12,
+		names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}}
+	// Воскресенье обозначается 0 или 7
+	weekdayField = field{name: "день недели", min: 0, max: 7,
+		names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}}
+)
+
+// Schedule - разобранное выражение cron. Значения полей хранятся битовыми масками.
+type Schedule struct {
+	minute, hour, day, month, weekday uint64
+	// День месяца и день недели заданы звездочкой. Если ограничены оба поля, достаточно
+	// совпадения любого из них, как в классическом cron.
+	anyDay, anyWeekday bool
+}
+
+// Parse разбирает выражение cron: пять полей через пробел, в каждом - список через запятую
+// из значений, диапазонов "a-b" и звездочки с необязательным шагом "/n". Месяцы и дни
+// недели можно указывать сокращениями JAN-DEC и SUN-SAT. Поддерживаются также @hourly,
+// @daily, @weekly, @monthly и @yearly.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := macros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("ожидается 5 полей, указано %d", len(fields))
+	}
+
+	var s Schedule
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if s.day, err = dayField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.weekday, err = weekdayField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if s.weekday&(1<<7) != 0 {
+		s.weekday |= 1
+	}
+	s.anyDay = strings.HasPrefix(fields[2], "*")
+	s.anyWeekday = strings.HasPrefix(fields[4], "*")
+	return &s, nil
+}
+
+// Разбор поля в битовую маску значений
+func (f field) parse(value string) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(value, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+				return 0, fmt.Errorf("некорректный шаг %q в поле «%s»", stepText, f.name)
+			}
+		}
+
+		low, high := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			from, to, _ := strings.Cut(rng, "-")
+			var err error
+			if low, err = f.value(from); err != nil {
+				return 0, err
+			}
+			if high, err = f.value(to); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("некорректный диапазон %q в поле «%s»", rng, f.name)
+			}
+		default:
+			var err error
+			if low, err = f.value(rng); err != nil {
+				return 0, err
+			}
+			// Значение с шагом "5/15" означает "5-max/15"
+			if hasStep {
+				high = f.max
+			} else {
+				high = low
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			mask |= 1 << v
+		}
+	}
+	return mask, nil
+}
+
+// Разбор значения поля: числа или сокращения названия
+func (f field) value(text string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(text, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("некорректное значение %q в поле «%s», допустимо %d-%d", text, f.name, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next возвращает ближайшее время запуска строго позже after в часовом поясе after.
+// Если расписание не срабатывает в ближайшие пять лет, возвращается нулевое время.
+// Время, пропущенное при переводе часов вперед, не срабатывает, а повторившееся при переводе
+// назад срабатывает один раз.
+func (s *Schedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(searchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			// Переход к началу следующего часа отсчитывается от t, а не через time.Date:
+			// при переводе часов назад time.Date выбирает второе из двух одинаковых времен
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			// При переводе часов назад время повторяется: срабатывает только первое
+			if prev := t.Add(-time.Hour); prev.Hour() == t.Hour() && prev.Minute() == t.Minute() {
+				t = t.Add(time.Minute)
+				continue
+			}
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Совпадение дня месяца и дня недели
+func (s *Schedule) dayMatches(t time.Time) bool {
+	day := s.day&(1<<uint(t.Day())) != 0
+	weekday := s.weekday&(1<<uint(t.Weekday())) != 0
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
@@ -0,0 +1,101 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * * MOO",
+		"1,,2 * * * *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): ожидалась ошибка", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("нет данных часового пояса: %v", err)
+	}
+	// Среда, 15 мая 2024 года
+	after := time.Date(2024, 5, 15, 10, 30, 15, 0, moscow)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 9 * * MON", time.Date(2024, 5, 20, 9, 0, 0, 0, moscow)},
+		{"0 9 * * 1", time.Date(2024, 5, 20, 9, 0, 0, 0, moscow)},
+		{"*/15 * * * *", time.Date(2024, 5, 15, 10, 45, 0, 0, moscow)},
+		{"30 10 * * *", time.Date(2024, 5, 16, 10, 30, 0, 0, moscow)},
+		{"31 10 * * *", time.Date(2024, 5, 15, 10, 31, 0, 0, moscow)},
+		{"0 0 31 * *", time.Date(2024, 5, 31, 0, 0, 0, 0, moscow)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, moscow)},
+		{"0 8 1-7 * 1-5", time.Date(2024, 5, 16, 8, 0, 0, 0, moscow)},
+		{"0 8 1 * sun", time.Date(2024, 5, 19, 8, 0, 0, 0, moscow)},
+		{"0 12 * * 7", time.Date(2024, 5, 19, 12, 0, 0, 0, moscow)},
+		{"0 0 * JUN-AUG/2 *", time.Date(2024, 6, 1, 0, 0, 0, 0, moscow)},
+		{"@weekly", time.Date(2024, 5, 19, 0, 0, 0, 0, moscow)},
+		{"@monthly", time.Date(2024, 6, 1, 0, 0, 0, 0, moscow)},
+	}
+	for _, tt := range tests {
+		schedule, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.Next(after); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, ожидалось %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	schedule, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := schedule.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next = %v, ожидалось нулевое время", got)
+	}
+}
+
+func TestNextDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("нет данных часового пояса: %v", err)
+	}
+	schedule, err := Parse("30 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 31 марта 2024 года 02:30 в Берлине не существует: запуск переносится на следующий день
+	got := schedule.Next(time.Date(2024, 3, 31, 1, 0, 0, 0, berlin))
+	if want := time.Date(2024, 4, 1, 2, 30, 0, 0, berlin); !got.Equal(want) {
+		t.Errorf("Next при переходе на летнее время = %v, ожидалось %v", got, want)
+	}
+
+	// 27 октября 2024 года 02:30 наступает дважды: следующий запуск после первого - на следующий день
+	first := schedule.Next(time.Date(2024, 10, 27, 1, 0, 0, 0, berlin))
+	if want := time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC); !first.Equal(want) {
+		t.Fatalf("Next при переходе на зимнее время = %v, ожидалось %v", first, want)
+	}
+	if second := schedule.Next(first); second.Before(first.Add(24 * time.Hour)) {
+		t.Errorf("Next после %v = %v, ожидался запуск на следующий день", first, second)
+	}
+}
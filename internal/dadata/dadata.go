@@ -0,0 +1,138 @@
+package dadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"project-znak/internal/tracing"
+)
+
+// ErrNotFound возвращается, если организация с указанным ИНН не найдена
+var ErrNotFound = errors.New("организация не найдена")
+
+// Статусы организации в ЕГРЮЛ/ЕГРИП
+const (
+	StatusActive      = "ACTIVE"
+	StatusLiquidating = "LIQUIDATING"
+	StatusLiquidated  = "LIQUIDATED"
+	StatusBankrupt    = "BANKRUPT"
+)
+
+// Party описывает организацию или ИП, найденные по ИНН
+type Party struct {
+	INN      string `json:"inn"`
+	KPP      string `json:"kpp,omitempty"`
+	OGRN     string `json:"ogrn,omitempty"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name,omitempty"`
+	Address  string `json:"address,omitempty"`
+	Status   string `json:"status"`
+}
+
+// IsActive сообщает, является ли организация действующей
+func (p *Party) IsActive() bool {
+	return p.Status == StatusActive
+}
+
+// Client выполняет запросы к API DaData
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewClient создает клиент DaData
+func NewClient(baseURL, apiKey string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: timeout, Transport: tracing.Transport("dadata")},
+	}
+}
+
+// Enabled сообщает, настроен ли доступ к DaData
+func (c *Client) Enabled() bool {
+	return c != nil && c.apiKey != ""
+}
+
+// Ответ метода findById/party
+type findPartyResponse struct {
+	Suggestions []struct {
+		Value string `json:"value"`
+		Data  struct {
+			INN   string `json:"inn"`
+			KPP   string `json:"kpp"`
+			OGRN  string `json:"ogrn"`
+			State struct {
+				Status string `json:"status"`
+			} `json:"state"`
+			Name struct {
+				FullWithOPF  string `json:"full_with_opf"`
+				ShortWithOPF string `json:"short_with_opf"`
+			} `json:"name"`
+			Address struct {
+				Value string `json:"value"`
+			} `json:"address"`
+		} `json:"data"`
+	} `json:"suggestions"`
+}
+
+// FindByINN находит организацию или ИП по ИНН
+func (c *Client) FindByINN(ctx context.Context, inn string) (*Party, error) {
+	body, err := json.Marshal(map[string]string{"query": inn})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка формирования запроса: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.baseURL+"/suggestions/api/4_1/rs/findById/party", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Token "+c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к DaData: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("DaData вернула ошибку: %d, тело: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result findPartyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования ответа: %w", err)
+	}
+
+	if len(result.Suggestions) == 0 {
+		return nil, ErrNotFound
+	}
+
+	s := result.Suggestions[0]
+	name := s.Data.Name.ShortWithOPF
+	if name == "" {
+		name = s.Value
+	}
+
+	return &Party{
+		INN:      s.Data.INN,
+		KPP:      s.Data.KPP,
+		OGRN:     s.Data.OGRN,
+		Name:     name,
+		FullName: s.Data.Name.FullWithOPF,
+		Address:  s.Data.Address.Value,
+		Status:   s.Data.State.Status,
+	}, nil
+}
@@ -0,0 +1,70 @@
+package dto
+
+import (
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/service"
+)
+
+// Roles - роли участников организаций с их разрешениями
+type Roles struct {
+	Envelope
+	Roles []*repository.Role `json:"roles" xml:"roles>role"`
+}
+
+// AuditEntries - записи журнала аудита
+type AuditEntries struct {
+	Envelope
+	Entries []repository.AuditEntry `json:"entries" xml:"entries>entry"`
+}
+
+// APIExchanges - архив запросов к Честному ЗНАКу и СУЗ
+type APIExchanges struct {
+	Envelope
+	Exchanges []repository.APIExchange `json:"exchanges" xml:"exchanges>exchange"`
+}
+
+// Analytics - сводные показатели сервиса за период
+type Analytics struct {
+	Envelope
+	Analytics *repository.Analytics `json:"analytics" xml:"analytics"`
+}
+
+// Lockouts - неудачные попытки авторизации и блокировки адресов клиентов
+type Lockouts struct {
+	Envelope
+	Lockouts []models.AuthFailure `json:"lockouts" xml:"lockouts>lockout"`
+}
+
+// UserImport - результат массового приглашения пользователей
+type UserImport struct {
+	Envelope
+	Users []service.UserImportResult `json:"users" xml:"users>user"`
+}
+
+// UserMerge - объединение пользователей
+type UserMerge struct {
+	Envelope
+	UserID     int    `json:"user_id" xml:"user_id"`
+	TelegramID int64  `json:"telegram_id" xml:"telegram_id"`
+	Moved      Counts `json:"moved" xml:"moved"` // Число перенесенных записей по таблицам
+}
+
+// OutboxMessages - уведомления в outbox
+type OutboxMessages struct {
+	Envelope
+	Messages []models.OutboxMessage `json:"messages" xml:"messages>message"`
+}
+
+// Impersonation - сеанс имперсонации. Токен возвращается один раз при начале сеанса.
+type Impersonation struct {
+	Envelope
+	Token         string                `json:"token,omitempty" xml:"token,omitempty"`
+	Impersonation *models.Impersonation `json:"impersonation" xml:"impersonation"`
+}
+
+// Impersonations - список сеансов имперсонации
+type Impersonations struct {
+	Envelope
+	Impersonations []models.Impersonation `json:"impersonations" xml:"impersonations>impersonation"`
+}
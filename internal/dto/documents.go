@@ -0,0 +1,60 @@
+package dto
+
+import (
+	"project-znak/internal/models"
+	"project-znak/internal/service"
+)
+
+// IntroductionDocument - документ ввода в оборот
+type IntroductionDocument struct {
+	Envelope
+	Document *models.IntroductionDocument `json:"document" xml:"document"`
+}
+
+// IntroductionDocuments - список документов ввода в оборот
+type IntroductionDocuments struct {
+	Envelope
+	Documents []models.IntroductionDocument `json:"documents" xml:"documents>document"`
+}
+
+// RetirementDocument - документ вывода из оборота
+type RetirementDocument struct {
+	Envelope
+	Document *models.RetirementDocument `json:"document" xml:"document"`
+}
+
+// RetirementDocuments - список документов вывода из оборота
+type RetirementDocuments struct {
+	Envelope
+	Documents []models.RetirementDocument `json:"documents" xml:"documents>document"`
+}
+
+// UPD - исходящий УПД
+type UPD struct {
+	Envelope
+	Document *models.UPDDocument `json:"document" xml:"document"`
+}
+
+// UPDs - список исходящих УПД
+type UPDs struct {
+	Envelope
+	Documents []models.UPDDocument `json:"documents" xml:"documents>document"`
+}
+
+// IncomingUPD - входящий УПД
+type IncomingUPD struct {
+	Envelope
+	Document *models.IncomingUPD `json:"document" xml:"document"`
+}
+
+// IncomingUPDs - список входящих УПД
+type IncomingUPDs struct {
+	Envelope
+	Documents []models.IncomingUPD `json:"documents" xml:"documents>document"`
+}
+
+// RetailSales - результат загрузки розничных продаж из 1С
+type RetailSales struct {
+	Envelope
+	Sales []service.RetailSaleResult `json:"sales" xml:"sales>sale"`
+}
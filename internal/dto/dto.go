@@ -0,0 +1,73 @@
+// Package dto описывает ответы REST API. Каждый ответ - структура со встроенным Envelope:
+// поле status ("success" или "error") и необязательное сообщение message, которое
+// переводится на язык пользователя. Данные ответа передаются в полях, названных по ресурсу:
+// order, orders, document. Состояние ресурса передается внутри ресурса или в поле с
+// префиксом, например status_code у статуса запроса КИЗ: поле status зарезервировано за
+// конвертом.
+//
+// Исключения из соглашения - ответы проверок работоспособности (Health) и страницы статуса
+// (ServiceStatus): в поле status передается состояние сервиса, как ожидают системы
+// мониторинга.
+package dto
+
+import (
+	"project-znak/internal/models"
+	"project-znak/internal/validate"
+)
+
+// Значения поля status конверта
+const (
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
+// Envelope - общие поля всех ответов API
+type Envelope struct {
+	Status  string `json:"status" xml:"status"`
+	Message string `json:"message,omitempty" xml:"message,omitempty"`
+}
+
+func (e Envelope) envelope() Envelope { return e }
+
+// Response - ответ API. Реализуется встраиванием Envelope.
+type Response interface {
+	envelope() Envelope
+}
+
+// Успешный ответ без сообщения
+func OK() Envelope {
+	return Envelope{Status: StatusSuccess}
+}
+
+// Успешный ответ с сообщением для пользователя
+func Done(message string) Envelope {
+	return Envelope{Status: StatusSuccess, Message: message}
+}
+
+// Ответ с ошибкой
+func Fail(message string) Envelope {
+	return Envelope{Status: StatusError, Message: message}
+}
+
+// Message - ответ только с сообщением: {"status": "success", "message": "Корзина очищена"}
+type Message struct {
+	Envelope
+}
+
+// Error - ответ с ошибкой. Код ошибки, ошибки полей, подтверждение и квота передаются,
+// если относятся к ошибке.
+type Error struct {
+	Envelope
+	Code         string               `json:"code,omitempty" xml:"code,omitempty"`                 // Код ошибки, например certificate_expired
+	Errors       validate.Errors      `json:"errors,omitempty" xml:"errors>error,omitempty"`       // Ошибки проверки полей: поле, код правила и описание
+	Confirmation *models.Confirmation `json:"confirmation,omitempty" xml:"confirmation,omitempty"` // Подтверждение, с ID которого повторяется операция
+	Quota        *models.Quota        `json:"quota,omitempty" xml:"quota,omitempty"`               // Исчерпанная квота тарифного плана
+	RetryAfter   int                  `json:"retry_after,omitempty" xml:"retry_after,omitempty"`   // Секунд до повтора для ответов 429
+	Permission   string               `json:"permission,omitempty" xml:"permission,omitempty"`     // Недостающее разрешение
+	Detail       string               `json:"error,omitempty" xml:"error,omitempty"`               // Описание причины, например ошибка разбора JSON
+}
+
+// Ответ с ошибкой с сообщением message
+func NewError(message string) Error {
+	return Error{Envelope: Fail(message)}
+}
@@ -0,0 +1,101 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/service"
+	"project-znak/internal/validate"
+)
+
+// KIZ - результат запроса КИЗ. При ошибке возвращается номер сохраненного запроса,
+// по которому его можно повторить.
+type KIZ struct {
+	Envelope
+	RequestID int             `json:"request_id,omitempty" xml:"request_id,omitempty"`
+	KIZs      []string        `json:"kizs,omitempty" xml:"kizs>kiz,omitempty"`
+	FilePath  string          `json:"file_path,omitempty" xml:"file_path,omitempty"`
+	Detail    string          `json:"error,omitempty" xml:"error,omitempty"`
+	Code      string          `json:"code,omitempty" xml:"code,omitempty"`           // Код ошибки, например certificate_expired
+	Errors    validate.Errors `json:"errors,omitempty" xml:"errors>error,omitempty"` // Ошибки проверки полей запроса
+	Quota     *models.Quota   `json:"quota,omitempty" xml:"quota,omitempty"`         // Исчерпанная квота тарифного плана
+}
+
+// KIZRequests - список запросов КИЗ
+type KIZRequests struct {
+	Envelope
+	Requests []repository.KIZRequestRecord `json:"requests" xml:"requests>request"`
+}
+
+// KIZRequestStatus - состояние запроса КИЗ. Статус запроса передается в поле status_code.
+type KIZRequestStatus struct {
+	Envelope
+	RequestID         int             `json:"request_id" xml:"request_id"`
+	TelegramID        int64           `json:"telegram_id" xml:"telegram_id"`
+	INN               string          `json:"inn" xml:"inn"`
+	RequestTime       time.Time       `json:"request_time" xml:"request_time"`
+	StatusCode        string          `json:"status_code" xml:"status_code"`
+	CodesRequested    int             `json:"codes_requested" xml:"codes_requested"`
+	CodesEmitted      int             `json:"codes_emitted" xml:"codes_emitted"`
+	CodesDownloaded   int             `json:"codes_downloaded" xml:"codes_downloaded"`
+	FilesGenerated    int             `json:"files_generated" xml:"files_generated"`
+	Progress          int             `json:"progress" xml:"progress"` // Доля полученных кодов, процентов
+	RequestData       json.RawMessage `json:"request_data,omitempty" xml:"request_data,omitempty"`
+	FilePath          string          `json:"file_path,omitempty" xml:"file_path,omitempty"`
+	KIZData           json.RawMessage `json:"kiz_data,omitempty" xml:"kiz_data,omitempty"`
+	TelegramMessageID int64           `json:"telegram_message_id,omitempty" xml:"telegram_message_id,omitempty"`
+	Error             string          `json:"error,omitempty" xml:"error,omitempty"`
+	Attempts          int             `json:"attempts,omitempty" xml:"attempts,omitempty"`
+	ErrorPayload      string          `json:"error_payload,omitempty" xml:"error_payload,omitempty"`
+}
+
+// KIZRequestProgress - состояние и ход выполнения запроса КИЗ; сообщение - описание хода
+// выполнения
+type KIZRequestProgress struct {
+	Envelope
+	Request *service.KIZRequestStatus `json:"request" xml:"request"`
+}
+
+// KIZRequestStatuses - статусы нескольких запросов КИЗ и номера ненайденных запросов
+type KIZRequestStatuses struct {
+	Envelope
+	Requests []service.KIZRequestStatus `json:"requests" xml:"requests>request"`
+	Missing  []int                      `json:"missing" xml:"missing>id"`
+}
+
+// KIZCodes - коды маркировки
+type KIZCodes struct {
+	Envelope
+	Codes []models.KIZCode `json:"codes" xml:"codes>code"`
+}
+
+// KIZCodeLookup - найденные коды маркировки и коды, не выпущенные для пользователя
+type KIZCodeLookup struct {
+	Envelope
+	Codes   []models.KIZCode `json:"codes" xml:"codes>code"`
+	Missing []string         `json:"missing" xml:"missing>code"`
+}
+
+// CodeStatus - состояние кода маркировки по данным Честного ЗНАКа
+type CodeStatus struct {
+	Envelope
+	Code *service.CodeStatus `json:"code" xml:"code"`
+}
+
+// CodeStatuses - состояние кодов маркировки и коды, не найденные у пользователя
+type CodeStatuses struct {
+	Envelope
+	Codes   []service.CodeStatus `json:"codes" xml:"codes>code"`
+	Missing []string             `json:"missing" xml:"missing>code"`
+}
+
+// LegacyKIZ - ответ на запрос КИЗ прежнего API
+type LegacyKIZ struct {
+	Envelope
+	KIZs      []string        `json:"kizs,omitempty" xml:"kizs>kiz,omitempty"`
+	FilePaths []string        `json:"file_paths,omitempty" xml:"file_paths>file_path,omitempty"`
+	Code      string          `json:"code,omitempty" xml:"code,omitempty"`
+	Errors    validate.Errors `json:"errors,omitempty" xml:"errors>error,omitempty"`
+}
@@ -0,0 +1,54 @@
+package dto
+
+import (
+	"project-znak/internal/models"
+	"project-znak/internal/service"
+)
+
+// OzonSettings - настройки интеграции с Ozon
+type OzonSettings struct {
+	Envelope
+	Ozon models.OzonSettings `json:"ozon" xml:"ozon"`
+}
+
+// OzonMapping - соответствие SKU Ozon и GTIN
+type OzonMapping struct {
+	Envelope
+	Mapping *models.OzonSKUMapping `json:"mapping" xml:"mapping"`
+}
+
+// OzonMappings - список соответствий SKU Ozon и GTIN
+type OzonMappings struct {
+	Envelope
+	Mappings []models.OzonSKUMapping `json:"mappings" xml:"mappings>mapping"`
+}
+
+// OzonSubmission - передача кодов маркировки отправления Ozon
+type OzonSubmission struct {
+	Envelope
+	Submission *models.OzonSubmission `json:"submission" xml:"submission"`
+}
+
+// OzonSubmissions - список передач кодов маркировки в Ozon
+type OzonSubmissions struct {
+	Envelope
+	Submissions []models.OzonSubmission `json:"submissions" xml:"submissions>submission"`
+}
+
+// WildberriesSettings - настройки интеграции с Wildberries
+type WildberriesSettings struct {
+	Envelope
+	Wildberries models.WildberriesSettings `json:"wildberries" xml:"wildberries"`
+}
+
+// WildberriesBind - привязка кодов маркировки к поставке Wildberries
+type WildberriesBind struct {
+	Envelope
+	Result *service.WBBindResult `json:"result" xml:"result"`
+}
+
+// WildberriesBindings - список привязок кодов к поставкам Wildberries
+type WildberriesBindings struct {
+	Envelope
+	Bindings []models.WBBinding `json:"bindings" xml:"bindings>binding"`
+}
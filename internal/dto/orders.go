@@ -0,0 +1,112 @@
+package dto
+
+import (
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/service"
+)
+
+// Order - заказ
+type Order struct {
+	Envelope
+	Order *models.Order `json:"order" xml:"order"`
+}
+
+// OrderDetails - заказ с позициями, платежами и запросами КИЗ
+type OrderDetails struct {
+	Envelope
+	Order *repository.OrderDetails `json:"order" xml:"order"`
+}
+
+// Orders - список заказов
+type Orders struct {
+	Envelope
+	Orders []models.Order `json:"orders" xml:"orders>order"`
+}
+
+// OrderCanceled - отмена заказа
+type OrderCanceled struct {
+	Envelope
+	OrderID int `json:"order_id" xml:"order_id"`
+}
+
+// OrderPreview - проверка загруженного файла заказа до его создания
+type OrderPreview struct {
+	Envelope
+	Preview *service.OrderPreview `json:"preview" xml:"preview"`
+}
+
+// OrderTemplate - шаблон заказа
+type OrderTemplate struct {
+	Envelope
+	Template *models.OrderTemplate `json:"template" xml:"template"`
+}
+
+// OrderTemplates - список шаблонов заказов
+type OrderTemplates struct {
+	Envelope
+	Templates []models.OrderTemplate `json:"templates" xml:"templates>template"`
+}
+
+// OrderTemplateDeleted - удаление шаблона заказа
+type OrderTemplateDeleted struct {
+	Envelope
+	TemplateID int `json:"template_id" xml:"template_id"`
+}
+
+// OrderSchedule - расписание заказов
+type OrderSchedule struct {
+	Envelope
+	Schedule *models.OrderSchedule `json:"schedule" xml:"schedule"`
+}
+
+// OrderSchedules - список расписаний заказов
+type OrderSchedules struct {
+	Envelope
+	Schedules []models.OrderSchedule `json:"schedules" xml:"schedules>schedule"`
+}
+
+// OrderScheduleDeleted - удаление расписания заказов
+type OrderScheduleDeleted struct {
+	Envelope
+	ScheduleID int `json:"schedule_id" xml:"schedule_id"`
+}
+
+// Cart - корзина
+type Cart struct {
+	Envelope
+	Cart *models.Cart `json:"cart" xml:"cart"`
+}
+
+// Checkout - оформление корзины: заказ и платеж по нему. Если платеж создать не удалось,
+// поля платежа не заполняются, причина передается в message.
+type Checkout struct {
+	Envelope
+	Order       *models.Order `json:"order" xml:"order"`
+	PaymentID   int           `json:"payment_id,omitempty" xml:"payment_id,omitempty"`
+	RedirectURL string        `json:"redirect_url,omitempty" xml:"redirect_url,omitempty"`
+}
+
+// Invoice - счет на оплату
+type Invoice struct {
+	Envelope
+	Invoice *models.Invoice `json:"invoice" xml:"invoice"`
+}
+
+// Invoices - список счетов
+type Invoices struct {
+	Envelope
+	Invoices []models.Invoice `json:"invoices" xml:"invoices>invoice"`
+}
+
+// Inventory - остатки кодов маркировки организации
+type Inventory struct {
+	Envelope
+	Items []models.InventoryItem `json:"items" xml:"items>item"`
+}
+
+// Reservation - резерв кодов маркировки
+type Reservation struct {
+	Envelope
+	Reservation *models.KIZReservation `json:"reservation" xml:"reservation"`
+}
@@ -0,0 +1,54 @@
+package dto
+
+import (
+	"project-znak/internal/models"
+	"project-znak/internal/service"
+)
+
+// Organization - организация
+type Organization struct {
+	Envelope
+	Organization *models.Organization `json:"organization" xml:"organization"`
+}
+
+// OrganizationDetails - организация со списком участников
+type OrganizationDetails struct {
+	Envelope
+	Organization *service.OrganizationDetails `json:"organization" xml:"organization"`
+}
+
+// Organizations - список организаций
+type Organizations struct {
+	Envelope
+	Organizations []models.Organization `json:"organizations" xml:"organizations>organization"`
+}
+
+// Member - участник организации
+type Member struct {
+	Envelope
+	Member *models.OrganizationMember `json:"member" xml:"member"`
+}
+
+// Partner - партнер
+type Partner struct {
+	Envelope
+	Partner *models.Partner `json:"partner" xml:"partner"`
+}
+
+// Partners - список партнеров
+type Partners struct {
+	Envelope
+	Partners []models.Partner `json:"partners" xml:"partners>partner"`
+}
+
+// PartnerAccounts - субаккаунты партнера
+type PartnerAccounts struct {
+	Envelope
+	Accounts []models.PartnerAccount `json:"accounts" xml:"accounts>account"`
+}
+
+// PartnerBilling - оплаты клиентов партнера за период и вознаграждение партнера
+type PartnerBilling struct {
+	Envelope
+	Billing *models.PartnerBilling `json:"billing" xml:"billing"`
+}
@@ -0,0 +1,89 @@
+package dto
+
+import (
+	"project-znak/internal/models"
+	"project-znak/internal/service"
+	"project-znak/internal/validate"
+)
+
+// PaymentCreated - созданный платеж и адрес страницы оплаты
+type PaymentCreated struct {
+	Envelope
+	RedirectURL string `json:"redirect_url,omitempty" xml:"redirect_url,omitempty"`
+	PaymentID   int    `json:"payment_id,omitempty" xml:"payment_id,omitempty"`
+}
+
+// Payment - платеж
+type Payment struct {
+	Envelope
+	Payment *models.Payment `json:"payment" xml:"payment"`
+}
+
+// Payments - список платежей
+type Payments struct {
+	Envelope
+	Payments []models.Payment `json:"payments" xml:"payments>payment"`
+}
+
+// PaymentProviders - состояние платежных провайдеров
+type PaymentProviders struct {
+	Envelope
+	Providers []service.PaymentProviderHealth `json:"providers" xml:"providers>provider"`
+}
+
+// Receipt - фискальный чек
+type Receipt struct {
+	Envelope
+	Receipt *models.FiscalReceipt `json:"receipt" xml:"receipt"`
+}
+
+// Receipts - список фискальных чеков
+type Receipts struct {
+	Envelope
+	Receipts []models.FiscalReceipt `json:"receipts" xml:"receipts>receipt"`
+}
+
+// Tariff - тариф
+type Tariff struct {
+	Envelope
+	Tariff *models.Tariff `json:"tariff" xml:"tariff"`
+}
+
+// Tariffs - список тарифов
+type Tariffs struct {
+	Envelope
+	Tariffs []models.Tariff `json:"tariffs" xml:"tariffs>tariff"`
+}
+
+// Plan - тарифный план
+type Plan struct {
+	Envelope
+	Plan *models.Plan `json:"plan" xml:"plan"`
+}
+
+// Plans - список тарифных планов
+type Plans struct {
+	Envelope
+	Plans []models.Plan `json:"plans" xml:"plans>plan"`
+}
+
+// Usage - тарифный план пользователя и потребление квот
+type Usage struct {
+	Envelope
+	Plan   *models.Plan   `json:"plan" xml:"plan"` // null - план не назначен, потребление не ограничено
+	Quotas []models.Quota `json:"quotas" xml:"quotas>quota"`
+}
+
+// UserPlan - назначение тарифного плана пользователю
+type UserPlan struct {
+	Envelope
+	TelegramID int64  `json:"telegram_id" xml:"telegram_id"`
+	Plan       string `json:"plan" xml:"plan"`
+}
+
+// LegacyPayment - ответ на запрос платежа прежнего API
+type LegacyPayment struct {
+	Envelope
+	PaymentURL string          `json:"payment_url,omitempty" xml:"payment_url,omitempty"`
+	Errors     validate.Errors `json:"errors,omitempty" xml:"errors>error,omitempty"`
+}
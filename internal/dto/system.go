@@ -0,0 +1,53 @@
+package dto
+
+import (
+	"project-znak/internal/models"
+	"project-znak/internal/service"
+)
+
+// Health - ответ проверки работоспособности. Поле status конверта содержит состояние
+// сервиса: ok, degraded, error или starting.
+type Health struct {
+	Envelope
+	Timestamp string `json:"timestamp" xml:"timestamp"`
+	Version   string `json:"version" xml:"version"`
+}
+
+// Readiness - ответ проверки готовности с результатами проверок зависимостей
+type Readiness struct {
+	Health
+	Checks []service.HealthCheck `json:"checks" xml:"checks>check"`
+}
+
+// ServiceStatus - публичная страница статуса. Поле status конверта содержит общее
+// состояние сервиса: ok, degraded или error.
+type ServiceStatus struct {
+	Envelope
+	Components []models.ComponentStatus `json:"components" xml:"components>component"`
+	Incidents  []models.StatusIncident  `json:"incidents" xml:"incidents>incident"`
+}
+
+// DBPool - метрики пула соединений с БД
+type DBPool struct {
+	MaxOpenConnections int   `json:"max_open_connections" xml:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections" xml:"open_connections"`
+	InUse              int   `json:"in_use" xml:"in_use"`
+	Idle               int   `json:"idle" xml:"idle"`
+	WaitCount          int64 `json:"wait_count" xml:"wait_count"`
+	WaitDurationMS     int64 `json:"wait_duration_ms" xml:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed" xml:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed" xml:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed" xml:"max_lifetime_closed"`
+
+	// Только для реплики: реплика используется для чтения, число запросов чтения,
+	// переключенных на основной пул
+	Available *bool  `json:"available,omitempty" xml:"available,omitempty"`
+	Fallbacks *int64 `json:"fallbacks,omitempty" xml:"fallbacks,omitempty"`
+}
+
+// DBStats - метрики основного пула (pool) и реплики, если она подключена
+type DBStats struct {
+	Envelope
+	Pool    *DBPool `json:"pool,omitempty" xml:"pool,omitempty"`
+	Replica *DBPool `json:"replica,omitempty" xml:"replica,omitempty"`
+}
@@ -0,0 +1,138 @@
+package dto
+
+import (
+	"project-znak/internal/i18n"
+	"project-znak/internal/labels"
+	"project-znak/internal/models"
+)
+
+// Registration - регистрация пользователя. API ключ возвращается, если создан при регистрации.
+type Registration struct {
+	Envelope
+	UserID           int    `json:"user_id" xml:"user_id"`
+	OrganizationName string `json:"organization_name" xml:"organization_name"`
+	APIKey           string `json:"api_key,omitempty" xml:"api_key,omitempty"`
+}
+
+// User - пользователь
+type User struct {
+	Envelope
+	User *models.User `json:"user" xml:"user"`
+}
+
+// Referrals - реферальная ссылка пользователя и приглашенные им пользователи
+type Referrals struct {
+	Envelope
+	Referrals *models.ReferralStats `json:"referrals" xml:"referrals"`
+}
+
+// NotificationPreferences - настройки уведомлений
+type NotificationPreferences struct {
+	Envelope
+	Notifications models.NotificationPreferences `json:"notifications" xml:"notifications"`
+}
+
+// DataExport - выгрузка данных пользователя
+type DataExport struct {
+	Envelope
+	Export *models.DataExport `json:"export" xml:"export"`
+}
+
+// Language - язык пользователя
+type Language struct {
+	Envelope
+	Language i18n.Language `json:"language" xml:"language"`
+}
+
+// Timezone - часовой пояс пользователя, например Europe/Moscow
+type Timezone struct {
+	Envelope
+	Timezone string `json:"timezone" xml:"timezone"`
+}
+
+// LabelTemplates - шаблоны этикеток
+type LabelTemplates struct {
+	Envelope
+	Templates []labels.Template `json:"templates" xml:"templates>template"`
+}
+
+// LabelSettings - настройки печати этикеток
+type LabelSettings struct {
+	Envelope
+	Labels models.LabelSettings `json:"labels" xml:"labels"`
+}
+
+// Report - отчет
+type Report struct {
+	Envelope
+	Report *models.Report `json:"report" xml:"report"`
+}
+
+// Reports - список отчетов
+type Reports struct {
+	Envelope
+	Reports []models.Report `json:"reports" xml:"reports>report"`
+}
+
+// ReportSettings - настройки регулярных отчетов
+type ReportSettings struct {
+	Envelope
+	Reports models.ReportSettings `json:"reports" xml:"reports"`
+}
+
+// APIKey - API ключ. Значение ключа (api_key) возвращается один раз при создании и
+// ротации, при ротации также возвращается прежний ключ с новым сроком действия.
+type APIKey struct {
+	Envelope
+	APIKey      string         `json:"api_key,omitempty" xml:"api_key,omitempty"`
+	Key         *models.APIKey `json:"key" xml:"key"`
+	PreviousKey *models.APIKey `json:"previous_key,omitempty" xml:"previous_key,omitempty"`
+}
+
+// APIKeys - список API ключей
+type APIKeys struct {
+	Envelope
+	Keys []models.APIKey `json:"keys" xml:"keys>key"`
+}
+
+// Sessions - сеансы пользователя
+type Sessions struct {
+	Envelope
+	Sessions []models.Session `json:"sessions" xml:"sessions>session"`
+}
+
+// SessionsRevoked - завершение сеансов
+type SessionsRevoked struct {
+	Envelope
+	Revoked int `json:"revoked" xml:"revoked"`
+}
+
+// Confirmation - подтверждение операции
+type Confirmation struct {
+	Envelope
+	Confirmation *models.Confirmation `json:"confirmation" xml:"confirmation"`
+}
+
+// SupportTicket - обращение в поддержку
+type SupportTicket struct {
+	Envelope
+	Ticket *models.SupportTicket `json:"ticket" xml:"ticket"`
+}
+
+// SupportTickets - список обращений в поддержку
+type SupportTickets struct {
+	Envelope
+	Tickets []models.SupportTicket `json:"tickets" xml:"tickets>ticket"`
+}
+
+// Announcement - объявление
+type Announcement struct {
+	Envelope
+	Announcement *models.Announcement `json:"announcement" xml:"announcement"`
+}
+
+// Announcements - список объявлений
+type Announcements struct {
+	Envelope
+	Announcements []models.Announcement `json:"announcements" xml:"announcements>announcement"`
+}
@@ -0,0 +1,67 @@
+package dto
+
+import (
+	"encoding/xml"
+	"io"
+	"maps"
+	"slices"
+)
+
+// Корневой элемент ответа в формате XML
+const xmlRoot = "response"
+
+// EncodeXML записывает ответ в формате XML: элемент <response> с полями ответа под теми же
+// именами, что и в JSON. Элементы списков вложены в элемент списка:
+// <orders><order>...</order></orders>.
+func EncodeXML(w io.Writer, response any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	if err := encoder.EncodeElement(response, xml.StartElement{Name: xml.Name{Local: xmlRoot}}); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// DecodeXML читает ответ, записанный EncodeXML
+func DecodeXML(r io.Reader, response Response) error {
+	return xml.NewDecoder(r).Decode(response)
+}
+
+// Counts - число записей по названиям: {"orders": 3}. В XML записывается элементами
+// <count name="orders">3</count> в порядке названий.
+type Counts map[string]int64
+
+func (c Counts) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(c)) {
+		element := xml.StartElement{
+			Name: xml.Name{Local: "count"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: name}},
+		}
+		if err := e.EncodeElement(c[name], element); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+func (c *Counts) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var counts struct {
+		Items []struct {
+			Name  string `xml:"name,attr"`
+			Value int64  `xml:",chardata"`
+		} `xml:"count"`
+	}
+	if err := d.DecodeElement(&counts, &start); err != nil {
+		return err
+	}
+	*c = make(Counts, len(counts.Items))
+	for _, item := range counts.Items {
+		(*c)[item.Name] = item.Value
+	}
+	return nil
+}
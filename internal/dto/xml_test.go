@@ -0,0 +1,75 @@
+package dto
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+	"project-znak/internal/service"
+	"project-znak/internal/validate"
+)
+
+func TestXMLRoundTrip(t *testing.T) {
+	created := time.Date(2026, 3, 14, 10, 30, 0, 0, time.UTC)
+	remaining := int64(40)
+
+	for _, response := range []Response{
+		Message{Envelope: Done("Корзина очищена")},
+		Error{
+			Envelope: Fail("Некорректные параметры запроса"),
+			Code:     "invalid",
+			Errors:   validate.Errors{{Field: "inn", Code: "required", Message: "обязательное поле"}},
+			Quota:    &models.Quota{Metric: "codes", Period: "month", Limit: 100, Used: 60, Remaining: &remaining, ResetsAt: created},
+		},
+		Orders{Envelope: OK(), Orders: []models.Order{{
+			ID:          7,
+			UserID:      3,
+			Items:       []models.OrderItem{{ID: 1, GTIN: "04601234567893", Quantity: 10, Price: 12.5}},
+			TotalAmount: 125,
+			Status:      "paid",
+			CreatedAt:   created,
+			Version:     2,
+		}}},
+		Payment{Envelope: OK(), Payment: &models.Payment{ID: 5, OrderID: 7, Amount: money.Rubles(12550), Status: "completed", CreatedAt: created}},
+		KIZRequestStatuses{
+			Envelope: OK(),
+			Requests: []service.KIZRequestStatus{{RequestID: 9, Status: "completed", RequestTime: created, CodesRequested: 10, Progress: 100}},
+			Missing:  []int{11, 12},
+		},
+		UserMerge{Envelope: Done("Пользователи объединены"), UserID: 3, TelegramID: 100, Moved: Counts{"orders": 2, "payments": 1}},
+	} {
+		var buf bytes.Buffer
+		if err := EncodeXML(&buf, response); err != nil {
+			t.Fatalf("%T: ошибка записи XML: %v", response, err)
+		}
+		if !strings.HasPrefix(buf.String(), `<?xml version="1.0" encoding="UTF-8"?>`+"\n<response>") {
+			t.Errorf("%T: ответ без заголовка XML или корневого элемента: %s", response, buf.String())
+		}
+
+		decoded := reflect.New(reflect.TypeOf(response))
+		if err := DecodeXML(bytes.NewReader(buf.Bytes()), decoded.Interface().(Response)); err != nil {
+			t.Fatalf("%T: ошибка чтения XML: %v, тело: %s", response, err, buf.String())
+		}
+		if got := decoded.Elem().Interface(); !reflect.DeepEqual(got, response) {
+			t.Errorf("%T: ответ изменился после записи и чтения XML:\n%+v\n%+v\n%s", response, got, response, buf.String())
+		}
+	}
+}
+
+func TestXMLLists(t *testing.T) {
+	var buf bytes.Buffer
+	EncodeXML(&buf, UserMerge{Envelope: OK(), Moved: Counts{"payments": 1, "orders": 2}})
+	if !strings.Contains(buf.String(), `<moved><count name="orders">2</count><count name="payments">1</count></moved>`) {
+		t.Errorf("счетчики записаны неверно: %s", buf.String())
+	}
+
+	buf.Reset()
+	EncodeXML(&buf, KIZRequestStatuses{Envelope: OK(), Missing: []int{11}})
+	if !strings.Contains(buf.String(), "<missing><id>11</id></missing>") {
+		t.Errorf("элементы списка должны быть вложены в элемент списка: %s", buf.String())
+	}
+}
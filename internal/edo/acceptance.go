@@ -0,0 +1,220 @@
+package edo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Титул покупателя УПД: приказ ФНС № ММВ-7-15/820@, версия 5.01
+const (
+	acceptancePrefix = "ON_NSCHFDOPPOK"
+	acceptanceKND    = "1115132"
+)
+
+// Наименование первичного документа в титуле покупателя для функции СЧФДОП
+const updDocumentName = "Документ об отгрузке товаров (выполнении работ), передаче имущественных прав " +
+	"(документ об оказании услуг)"
+
+type acceptanceFile struct {
+	XMLName  xml.Name           `xml:"Файл"`
+	ID       string             `xml:"ИдФайл,attr"`
+	Version  string             `xml:"ВерсФорм,attr"`
+	Program  string             `xml:"ВерсПрог,attr"`
+	Exchange updExchange        `xml:"СвУчДокОбор"`
+	Document acceptanceDocument `xml:"ИнфПок"`
+}
+
+type acceptanceDocument struct {
+	KND       string            `xml:"КНД,attr"`
+	Date      string            `xml:"ДатаИнфПок,attr"`
+	Time      string            `xml:"ВремИнфПок,attr"`
+	Composer  string            `xml:"НаимЭконСубСост,attr"`
+	Seller    acceptanceSource  `xml:"ИдИнфПрод"`
+	Content   acceptanceContent `xml:"СодФХЖ4"`
+	Signatory updSignatory      `xml:"Подписант"`
+}
+
+type acceptanceSource struct {
+	FileID string `xml:"ИдФайлИнфПр,attr"`
+	Date   string `xml:"ДатаФайлИнфПр,attr"`
+	Time   string `xml:"ВремФайлИнфПр,attr"`
+}
+
+type acceptanceContent struct {
+	DocumentName string           `xml:"НаимДокОпрПр,attr"`
+	Function     string           `xml:"Функция,attr"`
+	Number       string           `xml:"НомСчФИнфПр,attr"`
+	Date         string           `xml:"ДатаСчФИнфПр,attr"`
+	Receipt      acceptanceResult `xml:"СвПрин"`
+}
+
+type acceptanceResult struct {
+	Operation string `xml:"СодОпер,attr"`
+	Date      string `xml:"ДатаПрин,attr"`
+}
+
+// ParseUPD читает титул продавца УПД в формате ФНС 5.01: реквизиты документа, стороны
+// и строки с кодами маркировки. Цена строки вычисляется из стоимости с налогом.
+func ParseUPD(content []byte) (*Received, error) {
+	var file updFile
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if !strings.EqualFold(charset, "windows-1251") {
+			return nil, fmt.Errorf("неподдерживаемая кодировка %s", charset)
+		}
+		return charmap.Windows1251.NewDecoder().Reader(input), nil
+	}
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("ошибка разбора УПД: %w", err)
+	}
+	if file.Document.KND != updKND {
+		return nil, fmt.Errorf("файл не является титулом продавца УПД (КНД %s)", file.Document.KND)
+	}
+
+	invoice := file.Document.Invoice
+	received := &Received{
+		UPD: UPD{
+			Number: invoice.Number,
+			Seller: partyOf(file.Exchange.Sender, invoice.Seller),
+			Buyer:  partyOf(file.Exchange.Recipient, invoice.Buyer),
+		},
+		FileID: file.ID,
+	}
+	var err error
+	if received.Date, err = time.ParseInLocation("02.01.2006", invoice.Date, time.Local); err != nil {
+		return nil, fmt.Errorf("некорректная дата УПД %q", invoice.Date)
+	}
+	if received.Created, err = time.ParseInLocation("02.01.2006 15.04.05",
+		file.Document.Date+" "+file.Document.Time, time.Local); err != nil {
+		return nil, fmt.Errorf("некорректное время формирования УПД %q", file.Document.Date+" "+file.Document.Time)
+	}
+
+	for _, row := range file.Document.Table.Items {
+		quantity, err := strconv.ParseFloat(row.Quantity, 64)
+		if err != nil || quantity <= 0 || quantity != float64(int(quantity)) {
+			return nil, fmt.Errorf("строка %d: некорректное количество %q", row.Line, row.Quantity)
+		}
+		amount, err := strconv.ParseFloat(row.Amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: некорректная стоимость %q", row.Line, row.Amount)
+		}
+
+		item := Item{
+			GTIN:     row.Extra.GTIN,
+			Name:     row.Name,
+			Quantity: int(quantity),
+			Price:    round(amount / quantity),
+			VATRate:  strings.TrimSuffix(row.VATRate, "%"),
+			Codes:    row.Extra.Codes,
+		}
+		if row.VATRate == "без НДС" {
+			item.VATRate = "none"
+		}
+		received.Items = append(received.Items, item)
+	}
+	if len(received.Items) == 0 {
+		return nil, errors.New("в УПД нет строк")
+	}
+	return received, nil
+}
+
+func partyOf(id string, party updParty) Party {
+	result := Party{
+		ID:   id,
+		Name: party.Organization.Name,
+		INN:  party.Organization.INN,
+		KPP:  party.Organization.KPP,
+	}
+	if party.Address != nil {
+		result.Address = party.Address.Text
+	}
+	return result
+}
+
+// BuildAcceptance формирует титул покупателя полученного УПД: товары приняты без
+// претензий в день date. Файл подписывается от имени signatory.
+func BuildAcceptance(received *Received, date time.Time, signatory Signatory, signer Signer) (*Document, error) {
+	if received.Seller.ID == "" || received.Buyer.ID == "" {
+		return nil, errors.New("не указаны идентификаторы участников ЭДО")
+	}
+
+	guid, err := newGUID()
+	if err != nil {
+		return nil, err
+	}
+	fileID := strings.Join([]string{acceptancePrefix, received.Seller.ID, received.Buyer.ID, date.Format("20060102"), guid}, "_")
+
+	file := acceptanceFile{
+		ID:       fileID,
+		Version:  updVersion,
+		Program:  updProgram,
+		Exchange: updExchange{Sender: received.Buyer.ID, Recipient: received.Seller.ID},
+		Document: acceptanceDocument{
+			KND:      acceptanceKND,
+			Date:     date.Format("02.01.2006"),
+			Time:     date.Format("15.04.05"),
+			Composer: received.Buyer.Name,
+			Seller: acceptanceSource{
+				FileID: received.FileID,
+				Date:   received.Created.Format("02.01.2006"),
+				Time:   received.Created.Format("15.04.05"),
+			},
+			Content: acceptanceContent{
+				DocumentName: updDocumentName,
+				Function:     updFunction,
+				Number:       received.Number,
+				Date:         received.Date.Format("02.01.2006"),
+				Receipt: acceptanceResult{
+					Operation: "Перечисленные в документе ценности приняты без претензий",
+					Date:      date.Format("02.01.2006"),
+				},
+			},
+			Signatory: updSignatory{
+				// 2 - лицо, совершившее сделку, операцию; 1 - работник организации-покупателя
+				Scope:     "2",
+				Status:    "1",
+				Authority: "Должностные обязанности",
+				Person: updSignPerson{
+					INN:          received.Buyer.INN,
+					Organization: received.Buyer.Name,
+					Position:     signatory.Position,
+					Name: updName{
+						LastName:   signatory.LastName,
+						FirstName:  signatory.FirstName,
+						MiddleName: signatory.MiddleName,
+					},
+				},
+			},
+		},
+	}
+	if file.Document.Signatory.Person.Position == "" {
+		file.Document.Signatory.Person.Position = "Руководитель"
+	}
+
+	content, err := marshalXML(file)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка формирования титула покупателя: %w", err)
+	}
+	signature, err := signer.Sign(content)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подписи титула покупателя: %w", err)
+	}
+
+	return &Document{
+		FileName:  fileID + ".xml",
+		Number:    received.Number,
+		Date:      date,
+		Content:   content,
+		Signature: signature,
+		Sender:    received.Buyer,
+		Recipient: received.Seller,
+	}, nil
+}
@@ -0,0 +1,428 @@
+package edo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"project-znak/internal/text"
+	"project-znak/internal/tracing"
+)
+
+// Адрес API Контур.Диадок
+const defaultDiadocURL = "https://diadoc-api.kontur.ru"
+
+// Срок использования авторизационного токена Диадока; обновляется заранее
+const diadocTokenTTL = time.Hour
+
+// Статусы ответа получателя на документ в Диадоке
+const (
+	diadocWaitingForSignature = "WaitingForRecipientSignature"
+	diadocWithSignature       = "WithRecipientSignature"
+	diadocSignatureRejected   = "RecipientSignatureRequestRejected"
+)
+
+type diadocOrganizationsResponse struct {
+	Organizations []struct {
+		FnsParticipantID string `json:"FnsParticipantId"`
+		Boxes            []struct {
+			BoxIDGuid string `json:"BoxIdGuid"`
+		} `json:"Boxes"`
+	} `json:"Organizations"`
+}
+
+type diadocSignedContent struct {
+	Content   []byte `json:"Content"`
+	Signature []byte `json:"Signature"`
+}
+
+type diadocAttachment struct {
+	SignedContent    diadocSignedContent `json:"SignedContent"`
+	TypeNamedID      string              `json:"TypeNamedId"`
+	Function         string              `json:"Function"`
+	Version          string              `json:"Version"`
+	CustomDocumentID string              `json:"CustomDocumentId"`
+}
+
+type diadocMessageToPost struct {
+	FromBoxID           string             `json:"FromBoxId"`
+	ToBoxID             string             `json:"ToBoxId"`
+	DocumentAttachments []diadocAttachment `json:"DocumentAttachments"`
+}
+
+type diadocMessage struct {
+	MessageID string `json:"MessageId"`
+	Entities  []struct {
+		EntityID string `json:"EntityId"`
+	} `json:"Entities"`
+}
+
+type diadocDocument struct {
+	RecipientResponseStatus string `json:"RecipientResponseStatus"`
+	DocflowStatus           *struct {
+		PrimaryStatus *struct {
+			StatusText string `json:"StatusText"`
+		} `json:"PrimaryStatus"`
+	} `json:"DocflowStatus"`
+}
+
+type diadocDocumentList struct {
+	Documents []struct {
+		MessageID string `json:"MessageId"`
+		EntityID  string `json:"EntityId"`
+		FileName  string `json:"FileName"`
+	} `json:"Documents"`
+}
+
+type diadocRecipientTitle struct {
+	ParentEntityID string              `json:"ParentEntityId"`
+	SignedContent  diadocSignedContent `json:"SignedContent"`
+}
+
+type diadocMessagePatch struct {
+	BoxID                  string                 `json:"BoxId"`
+	MessageID              string                 `json:"MessageId"`
+	RecipientTitles        []diadocRecipientTitle `json:"RecipientTitles,omitempty"`
+	XMLSignatureRejections []diadocRecipientTitle `json:"XmlSignatureRejections,omitempty"`
+}
+
+// DiadocClient отправляет документы через API Контур.Диадок
+type DiadocClient struct {
+	baseURL    string
+	clientID   string
+	login      string
+	password   string
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	boxes       map[string]string
+}
+
+// NewDiadocClient создает клиент Диадока. clientID - ключ разработчика, выданный Контуром.
+// Если адрес не задан, используется рабочий адрес API.
+func NewDiadocClient(baseURL, clientID, login, password string, timeout time.Duration) *DiadocClient {
+	if baseURL == "" {
+		baseURL = defaultDiadocURL
+	}
+	return &DiadocClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		clientID:   clientID,
+		login:      login,
+		password:   password,
+		httpClient: &http.Client{Timeout: timeout, Transport: tracing.Transport("diadoc")},
+		boxes:      make(map[string]string),
+	}
+}
+
+// Name возвращает идентификатор оператора
+func (c *DiadocClient) Name() string {
+	return ProviderDiadoc
+}
+
+// Participant возвращает идентификатор участника ЭДО организации
+func (c *DiadocClient) Participant(ctx context.Context, inn, kpp string) (string, error) {
+	participantID, _, err := c.organization(ctx, inn, kpp)
+	return participantID, err
+}
+
+// Send отправляет подписанный УПД из ящика продавца в ящик покупателя. Возвращаемый
+// идентификатор содержит ящик, сообщение и сущность документа.
+func (c *DiadocClient) Send(ctx context.Context, doc Document) (string, error) {
+	fromBox, err := c.box(ctx, doc.Sender)
+	if err != nil {
+		return "", err
+	}
+	toBox, err := c.box(ctx, doc.Recipient)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(diadocMessageToPost{
+		FromBoxID: fromBox,
+		ToBoxID:   toBox,
+		DocumentAttachments: []diadocAttachment{{
+			SignedContent:    diadocSignedContent{Content: doc.Content, Signature: doc.Signature},
+			TypeNamedID:      "UniversalTransferDocument",
+			Function:         updFunction,
+			Version:          "utd820_05_01_01_hyphen",
+			CustomDocumentID: doc.Number,
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("ошибка формирования сообщения: %w", err)
+	}
+
+	var message diadocMessage
+	if err := c.do(ctx, http.MethodPost, "/V3/PostMessage", nil, body, &message); err != nil {
+		return "", err
+	}
+	if message.MessageID == "" || len(message.Entities) == 0 {
+		return "", fmt.Errorf("Диадок не вернул идентификатор документа")
+	}
+	return strings.Join([]string{fromBox, message.MessageID, message.Entities[0].EntityID}, "/"), nil
+}
+
+// Status возвращает состояние документа по ответу получателя
+func (c *DiadocClient) Status(ctx context.Context, id string) (*Status, error) {
+	parts, err := diadocDocumentID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc diadocDocument
+	query := url.Values{"boxId": {parts[0]}, "messageId": {parts[1]}, "entityId": {parts[2]}}
+	if err := c.do(ctx, http.MethodGet, "/V3/GetDocument", query, nil, &doc); err != nil {
+		return nil, err
+	}
+
+	status := &Status{State: StateSent}
+	switch doc.RecipientResponseStatus {
+	case diadocWaitingForSignature:
+		status.State = StateDelivered
+	case diadocWithSignature:
+		status.State = StateAccepted
+	case diadocSignatureRejected:
+		status.State = StateRejected
+		if doc.DocflowStatus != nil && doc.DocflowStatus.PrimaryStatus != nil {
+			status.Comment = doc.DocflowStatus.PrimaryStatus.StatusText
+		}
+	}
+	return status, nil
+}
+
+// Incoming возвращает УПД в ящике получателя, ожидающие его подписи. Запрашивается
+// первая страница списка; остальные документы вернутся после обработки первых.
+func (c *DiadocClient) Incoming(ctx context.Context, recipient Party) ([]Incoming, error) {
+	box, err := c.box(ctx, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	var list diadocDocumentList
+	query := url.Values{"boxId": {box}, "filterCategory": {"UniversalTransferDocument.InboundWaitingForRecipientSignature"}}
+	if err := c.do(ctx, http.MethodGet, "/V3/GetDocuments", query, nil, &list); err != nil {
+		return nil, err
+	}
+
+	token, err := c.authToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var documents []Incoming
+	for _, doc := range list.Documents {
+		query := url.Values{"boxId": {box}, "messageId": {doc.MessageID}, "entityId": {doc.EntityID}}
+		content, err := c.send(ctx, http.MethodGet, "/V4/GetEntityContent?"+query.Encode(), token, nil)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения документа %s: %w", doc.EntityID, err)
+		}
+		documents = append(documents, Incoming{
+			ID:       strings.Join([]string{box, doc.MessageID, doc.EntityID}, "/"),
+			FileName: doc.FileName,
+			Content:  content,
+		})
+	}
+	return documents, nil
+}
+
+// Accept отправляет подписанный титул покупателя входящего документа
+func (c *DiadocClient) Accept(ctx context.Context, id string, title Document) error {
+	parts, err := diadocDocumentID(id)
+	if err != nil {
+		return err
+	}
+	return c.patch(ctx, diadocMessagePatch{
+		BoxID:     parts[0],
+		MessageID: parts[1],
+		RecipientTitles: []diadocRecipientTitle{{
+			ParentEntityID: parts[2],
+			SignedContent:  diadocSignedContent{Content: title.Content, Signature: title.Signature},
+		}},
+	})
+}
+
+// Reject отказывает в подписи входящего документа. Уведомление об уточнении формирует
+// Диадок, оно подписывается signer.
+func (c *DiadocClient) Reject(ctx context.Context, id, comment string, signer Signer) error {
+	parts, err := diadocDocumentID(id)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{"ErrorMessage": comment})
+	if err != nil {
+		return fmt.Errorf("ошибка формирования запроса: %w", err)
+	}
+	token, err := c.authToken(ctx)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"boxId": {parts[0]}, "messageId": {parts[1]}, "attachmentId": {parts[2]}}
+	content, err := c.send(ctx, http.MethodPost, "/V3/GenerateSignatureRejectionXml?"+query.Encode(), token, body)
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign(content)
+	if err != nil {
+		return fmt.Errorf("ошибка подписи отказа: %w", err)
+	}
+
+	return c.patch(ctx, diadocMessagePatch{
+		BoxID:     parts[0],
+		MessageID: parts[1],
+		XMLSignatureRejections: []diadocRecipientTitle{{
+			ParentEntityID: parts[2],
+			SignedContent:  diadocSignedContent{Content: content, Signature: signature},
+		}},
+	})
+}
+
+// Дополнение сообщения ответом получателя
+func (c *DiadocClient) patch(ctx context.Context, patch diadocMessagePatch) error {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("ошибка формирования ответа: %w", err)
+	}
+	var result json.RawMessage
+	return c.do(ctx, http.MethodPost, "/V3/PostMessagePatch", nil, body, &result)
+}
+
+// Идентификатор документа Диадока: ящик, сообщение и сущность
+func diadocDocumentID(id string) ([]string, error) {
+	parts := strings.Split(id, "/")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("некорректный идентификатор документа Диадока %q", id)
+	}
+	return parts, nil
+}
+
+// Организация по ИНН и КПП: идентификатор участника ЭДО и ящик
+func (c *DiadocClient) organization(ctx context.Context, inn, kpp string) (string, string, error) {
+	query := url.Values{"inn": {inn}}
+	if kpp != "" {
+		query.Set("kpp", kpp)
+	}
+	var response diadocOrganizationsResponse
+	if err := c.do(ctx, http.MethodGet, "/GetOrganizationsByInnKpp", query, nil, &response); err != nil {
+		return "", "", err
+	}
+	for _, org := range response.Organizations {
+		if org.FnsParticipantID != "" && len(org.Boxes) > 0 {
+			return org.FnsParticipantID, org.Boxes[0].BoxIDGuid, nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: ИНН %s", ErrParticipantNotFound, inn)
+}
+
+// Ящик организации; ящики не меняются и запоминаются
+func (c *DiadocClient) box(ctx context.Context, party Party) (string, error) {
+	key := party.INN + "/" + party.KPP
+	c.mu.Lock()
+	box, ok := c.boxes[key]
+	c.mu.Unlock()
+	if ok {
+		return box, nil
+	}
+
+	_, box, err := c.organization(ctx, party.INN, party.KPP)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.boxes[key] = box
+	c.mu.Unlock()
+	return box, nil
+}
+
+// Токен авторизации; запрашивается повторно по истечении срока действия
+func (c *DiadocClient) authToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"login": c.login, "password": c.password})
+	if err != nil {
+		return "", fmt.Errorf("ошибка формирования запроса токена: %w", err)
+	}
+	data, err := c.send(ctx, http.MethodPost, "/V3/Authenticate?type=password", "", body)
+	if err != nil {
+		return "", fmt.Errorf("ошибка авторизации в Диадоке: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("Диадок не вернул токен")
+	}
+
+	c.token, c.tokenExpiry = token, time.Now().Add(diadocTokenTTL)
+	return c.token, nil
+}
+
+// Выполнение авторизованного запроса к API
+func (c *DiadocClient) do(ctx context.Context, method, path string, query url.Values, body []byte, out any) error {
+	token, err := c.authToken(ctx)
+	if err != nil {
+		return err
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	data, err := c.send(ctx, method, path, token, body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("ошибка декодирования ответа Диадока: %w", err)
+	}
+	return nil
+}
+
+func (c *DiadocClient) send(ctx context.Context, method, path, token string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	req.Header.Set("Accept", "application/json")
+	authorization := "DiadocAuth ddauth_api_client_id=" + c.clientID
+	if token != "" {
+		authorization += ",ddauth_token=" + token
+	}
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к Диадоку: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1048576))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения ответа Диадока: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized && token != "" {
+		// Токен отозван раньше срока; следующий запрос получит новый
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Диадок вернул ошибку: %d, тело: %s", resp.StatusCode, text.Truncate(string(data), 1024))
+	}
+	return data, nil
+}
@@ -0,0 +1,116 @@
+package edo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Поддерживаемые операторы ЭДО
+const (
+	ProviderDiadoc = "diadoc" // Контур.Диадок
+	ProviderSBIS   = "sbis"   // СБИС
+)
+
+// Состояния документооборота УПД у контрагента
+const (
+	StateSent      = "sent"      // Документ принят оператором
+	StateDelivered = "delivered" // Документ доставлен контрагенту и ожидает подписи
+	StateAccepted  = "accepted"  // Контрагент подписал документ
+	StateRejected  = "rejected"  // Контрагент отказал в подписи
+)
+
+// ErrParticipantNotFound возвращается, если организация не подключена к оператору ЭДО
+var ErrParticipantNotFound = errors.New("организация не найдена у оператора ЭДО")
+
+// Party - участник документооборота. ID - идентификатор участника ЭДО, присвоенный оператором.
+type Party struct {
+	ID      string
+	Name    string
+	INN     string
+	KPP     string
+	Address string
+}
+
+// Item - строка УПД. Цена включает НДС; VATRate - ставка НДС: none, 0, 10 или 20.
+// Codes - коды маркировки переданных единиц товара.
+type Item struct {
+	GTIN     string
+	Name     string
+	Quantity int
+	Price    float64
+	VATRate  string
+	Codes    []string
+}
+
+// Signatory - лицо, подписывающее титул продавца или покупателя УПД
+type Signatory struct {
+	LastName   string
+	FirstName  string
+	MiddleName string
+	Position   string
+}
+
+// UPD - универсальный передаточный документ (счет-фактура и документ об отгрузке)
+type UPD struct {
+	Number    string
+	Date      time.Time
+	Seller    Party
+	Buyer     Party
+	Signatory Signatory
+	Items     []Item
+}
+
+// Document - подписанный файл УПД для отправки оператору
+type Document struct {
+	FileName  string
+	Number    string
+	Date      time.Time
+	Content   []byte
+	Signature []byte // Открепленная подпись файла
+	Sender    Party
+	Recipient Party
+}
+
+// Received - УПД, полученный от продавца. FileID и Created - идентификатор и время
+// формирования файла титула продавца, на который ссылается титул покупателя.
+type Received struct {
+	UPD
+	FileID  string
+	Created time.Time
+}
+
+// Incoming - входящий документ, ожидающий подписи получателя
+type Incoming struct {
+	ID       string // Идентификатор документа у оператора
+	FileName string
+	Content  []byte // Файл титула продавца
+}
+
+// Status - состояние отправленного документа у контрагента
+type Status struct {
+	State   string
+	Comment string // Причина отказа в подписи
+}
+
+// Signer подписывает файл документа открепленной подписью
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// Provider отправляет и принимает документы через оператора ЭДО. Participant возвращает
+// идентификатор участника ЭДО по ИНН и КПП, Send - идентификатор отправленного документа
+// у оператора, по которому Status возвращает состояние документооборота.
+//
+// Incoming возвращает входящие УПД получателя, ожидающие подписи. Accept отправляет
+// подписанный титул покупателя входящего документа, Reject - отказ в подписи с причиной;
+// уведомление об отказе подписывается signer, если оператор требует подписи.
+type Provider interface {
+	Name() string
+	Participant(ctx context.Context, inn, kpp string) (string, error)
+	Send(ctx context.Context, doc Document) (string, error)
+	Status(ctx context.Context, id string) (*Status, error)
+	Incoming(ctx context.Context, recipient Party) ([]Incoming, error)
+	Accept(ctx context.Context, id string, title Document) error
+	Reject(ctx context.Context, id, comment string, signer Signer) error
+}
@@ -0,0 +1,373 @@
+package edo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+type testSigner struct{}
+
+func (testSigner) Sign(data []byte) ([]byte, error) {
+	return []byte("signature"), nil
+}
+
+func testUPD() *UPD {
+	return &UPD{
+		Number: "15",
+		Date:   time.Date(2026, 3, 1, 10, 30, 0, 0, time.Local),
+		Seller: Party{ID: "2BM-7707083893-770701001", Name: "ООО «Продавец»", INN: "7707083893", KPP: "770701001",
+			Address: "г. Москва, ул. Тверская, д. 1"},
+		Buyer:     Party{ID: "2BE-7728168971-772801001", Name: "ООО «Покупатель»", INN: "7728168971", KPP: "772801001"},
+		Signatory: Signatory{LastName: "Иванов", FirstName: "Иван", MiddleName: "Иванович", Position: "Директор"},
+		Items: []Item{
+			{GTIN: "04601234567893", Name: "Кроссовки", Quantity: 2, Price: 1200, VATRate: "20", Codes: []string{
+				"010460123456789321abc\x1d91EE06\x1d92signature", "010460123456789321def",
+			}},
+		},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	doc, err := Build(testUPD(), testSigner{})
+	if err != nil {
+		t.Fatalf("Build() вернул ошибку: %v", err)
+	}
+	if !strings.HasPrefix(doc.FileName, "ON_NSCHFDOPPR_2BE-7728168971-772801001_2BM-7707083893-770701001_20260301_") ||
+		!strings.HasSuffix(doc.FileName, ".xml") {
+		t.Errorf("неверное имя файла: %s", doc.FileName)
+	}
+	if string(doc.Signature) != "signature" {
+		t.Errorf("неверная подпись: %q", doc.Signature)
+	}
+	if !bytes.HasPrefix(doc.Content, []byte(`<?xml version="1.0" encoding="windows-1251"?>`)) {
+		t.Fatalf("неверный заголовок файла: %s", doc.Content[:60])
+	}
+
+	var file updFile
+	decoder := xml.NewDecoder(bytes.NewReader(doc.Content))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return charmap.Windows1251.NewDecoder().Reader(input), nil
+	}
+	if err := decoder.Decode(&file); err != nil {
+		t.Fatalf("ошибка разбора УПД: %v", err)
+	}
+
+	if file.Version != "5.01" || file.Document.Function != "СЧФДОП" || file.Document.Invoice.Number != "15" ||
+		file.Document.Invoice.Date != "01.03.2026" {
+		t.Errorf("неверные реквизиты документа: %+v", file.Document.Invoice)
+	}
+	if file.Document.Invoice.Seller.Organization.Name != "ООО «Продавец»" ||
+		file.Document.Invoice.Seller.Address == nil || file.Document.Invoice.Buyer.Address != nil {
+		t.Errorf("неверные стороны: %+v", file.Document.Invoice)
+	}
+	if len(file.Document.Table.Items) != 1 {
+		t.Fatalf("ожидалась одна строка, получено %d", len(file.Document.Table.Items))
+	}
+	item := file.Document.Table.Items[0]
+	if item.Amount != "2400.00" || item.VAT.Amount != "400.00" || item.NetAmount != "2000.00" ||
+		item.Price != "1000.00" || item.VATRate != "20%" {
+		t.Errorf("неверные суммы строки: %+v", item)
+	}
+	codes := item.Extra.Codes
+	if len(codes) != 2 || codes[0] != "010460123456789321abc" || codes[1] != "010460123456789321def" {
+		t.Errorf("неверные коды маркировки: %q", codes)
+	}
+	if file.Document.Table.Total.Amount != "2400.00" || file.Document.Table.Total.VAT.Amount != "400.00" {
+		t.Errorf("неверные итоги: %+v", file.Document.Table.Total)
+	}
+	if file.Document.Signatory.Person.Name.LastName != "Иванов" {
+		t.Errorf("неверный подписант: %+v", file.Document.Signatory)
+	}
+}
+
+func TestBuildValidation(t *testing.T) {
+	upd := testUPD()
+	upd.Items[0].Quantity = 3
+	if _, err := Build(upd, testSigner{}); err == nil {
+		t.Error("ожидалась ошибка при несовпадении количества и кодов")
+	}
+
+	upd = testUPD()
+	upd.Items[0].VATRate = "18"
+	if _, err := Build(upd, testSigner{}); err == nil {
+		t.Error("ожидалась ошибка при неподдерживаемой ставке НДС")
+	}
+}
+
+func TestParseUPD(t *testing.T) {
+	doc, err := Build(testUPD(), testSigner{})
+	if err != nil {
+		t.Fatalf("Build() вернул ошибку: %v", err)
+	}
+
+	received, err := ParseUPD(doc.Content)
+	if err != nil {
+		t.Fatalf("ParseUPD() вернул ошибку: %v", err)
+	}
+	if received.FileID+".xml" != doc.FileName || received.Number != "15" ||
+		!received.Date.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)) ||
+		!received.Created.Equal(time.Date(2026, 3, 1, 10, 30, 0, 0, time.Local)) {
+		t.Errorf("неверные реквизиты документа: %+v", received)
+	}
+	if received.Seller.ID != "2BM-7707083893-770701001" || received.Seller.INN != "7707083893" ||
+		received.Buyer.Name != "ООО «Покупатель»" || received.Buyer.KPP != "772801001" {
+		t.Errorf("неверные стороны: %+v, %+v", received.Seller, received.Buyer)
+	}
+	if len(received.Items) != 1 {
+		t.Fatalf("ожидалась одна строка, получено %d", len(received.Items))
+	}
+	item := received.Items[0]
+	if item.GTIN != "04601234567893" || item.Quantity != 2 || item.Price != 1200 || item.VATRate != "20" ||
+		len(item.Codes) != 2 || item.Codes[0] != "010460123456789321abc" {
+		t.Errorf("неверная строка: %+v", item)
+	}
+
+	if _, err := ParseUPD([]byte("<Файл/>")); err == nil {
+		t.Error("ожидалась ошибка для файла без титула продавца")
+	}
+}
+
+func TestBuildAcceptance(t *testing.T) {
+	doc, err := Build(testUPD(), testSigner{})
+	if err != nil {
+		t.Fatalf("Build() вернул ошибку: %v", err)
+	}
+	received, err := ParseUPD(doc.Content)
+	if err != nil {
+		t.Fatalf("ParseUPD() вернул ошибку: %v", err)
+	}
+
+	title, err := BuildAcceptance(received, time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local),
+		Signatory{LastName: "Петров", FirstName: "Петр"}, testSigner{})
+	if err != nil {
+		t.Fatalf("BuildAcceptance() вернул ошибку: %v", err)
+	}
+	if !strings.HasPrefix(title.FileName, "ON_NSCHFDOPPOK_2BM-7707083893-770701001_2BE-7728168971-772801001_20260302_") {
+		t.Errorf("неверное имя файла: %s", title.FileName)
+	}
+	if title.Sender.INN != "7728168971" || title.Recipient.INN != "7707083893" {
+		t.Errorf("неверные стороны: %+v, %+v", title.Sender, title.Recipient)
+	}
+
+	var file acceptanceFile
+	decoder := xml.NewDecoder(bytes.NewReader(title.Content))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return charmap.Windows1251.NewDecoder().Reader(input), nil
+	}
+	if err := decoder.Decode(&file); err != nil {
+		t.Fatalf("ошибка разбора титула покупателя: %v", err)
+	}
+	if file.Document.KND != "1115132" || file.Document.Seller.FileID != received.FileID ||
+		file.Document.Seller.Time != "10.30.00" || file.Document.Content.Number != "15" ||
+		file.Document.Content.Receipt.Date != "02.03.2026" {
+		t.Errorf("неверный титул покупателя: %+v", file.Document)
+	}
+	if file.Document.Signatory.Person.Name.LastName != "Петров" || file.Document.Signatory.Person.Position != "Руководитель" {
+		t.Errorf("неверный подписант: %+v", file.Document.Signatory)
+	}
+}
+
+func TestDiadocClient(t *testing.T) {
+	var patches []diadocMessagePatch
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/V3/Authenticate" {
+			w.Write([]byte("tok"))
+			return
+		}
+		if r.Header.Get("Authorization") != "DiadocAuth ddauth_api_client_id=key,ddauth_token=tok" {
+			t.Errorf("запрос %s без токена: %s", r.URL.Path, r.Header.Get("Authorization"))
+		}
+
+		switch r.URL.Path {
+		case "/GetOrganizationsByInnKpp":
+			switch r.URL.Query().Get("inn") {
+			case "7707083893":
+				w.Write([]byte(`{"Organizations": [{"FnsParticipantId": "2BM-seller", "Boxes": [{"BoxIdGuid": "box-seller"}]}]}`))
+			case "7728168971":
+				w.Write([]byte(`{"Organizations": [{"FnsParticipantId": "2BM-buyer", "Boxes": [{"BoxIdGuid": "box-buyer"}]}]}`))
+			default:
+				w.Write([]byte(`{"Organizations": []}`))
+			}
+		case "/V3/PostMessage":
+			var message diadocMessageToPost
+			if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+				t.Fatalf("ошибка разбора сообщения: %v", err)
+			}
+			if message.FromBoxID != "box-seller" || message.ToBoxID != "box-buyer" ||
+				len(message.DocumentAttachments) != 1 ||
+				string(message.DocumentAttachments[0].SignedContent.Signature) != "sig" {
+				t.Errorf("неверное сообщение: %+v", message)
+			}
+			w.Write([]byte(`{"MessageId": "msg", "Entities": [{"EntityId": "ent"}]}`))
+		case "/V3/GetDocuments":
+			if r.URL.Query().Get("boxId") != "box-buyer" {
+				t.Errorf("неверный ящик: %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"Documents": [{"MessageId": "in-msg", "EntityId": "in-ent", "FileName": "in.xml"}]}`))
+		case "/V4/GetEntityContent":
+			w.Write([]byte("<Файл/>"))
+		case "/V3/GenerateSignatureRejectionXml":
+			w.Write([]byte("<Отказ/>"))
+		case "/V3/PostMessagePatch":
+			var patch diadocMessagePatch
+			if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+				t.Fatalf("ошибка разбора ответа: %v", err)
+			}
+			patches = append(patches, patch)
+			w.Write([]byte(`{}`))
+		case "/V3/GetDocument":
+			if r.URL.Query().Get("entityId") != "ent" {
+				t.Errorf("неверный запрос документа: %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"RecipientResponseStatus": "RecipientSignatureRequestRejected",
+				"DocflowStatus": {"PrimaryStatus": {"StatusText": "Неверная цена"}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewDiadocClient(server.URL, "key", "login", "pass", time.Second)
+
+	if id, err := client.Participant(context.Background(), "7707083893", "770701001"); err != nil || id != "2BM-seller" {
+		t.Errorf("Participant() = %q, %v", id, err)
+	}
+	if _, err := client.Participant(context.Background(), "500100732259", ""); !errors.Is(err, ErrParticipantNotFound) {
+		t.Errorf("ожидалась ошибка ErrParticipantNotFound, получено: %v", err)
+	}
+
+	id, err := client.Send(context.Background(), Document{
+		FileName: "upd.xml", Number: "15", Content: []byte("<Файл/>"), Signature: []byte("sig"),
+		Sender:    Party{INN: "7707083893", KPP: "770701001"},
+		Recipient: Party{INN: "7728168971", KPP: "772801001"},
+	})
+	if err != nil || id != "box-seller/msg/ent" {
+		t.Fatalf("Send() = %q, %v", id, err)
+	}
+
+	status, err := client.Status(context.Background(), id)
+	if err != nil || status.State != StateRejected || status.Comment != "Неверная цена" {
+		t.Errorf("Status() = %+v, %v", status, err)
+	}
+
+	incoming, err := client.Incoming(context.Background(), Party{INN: "7728168971", KPP: "772801001"})
+	if err != nil || len(incoming) != 1 || incoming[0].ID != "box-buyer/in-msg/in-ent" ||
+		string(incoming[0].Content) != "<Файл/>" {
+		t.Fatalf("Incoming() = %+v, %v", incoming, err)
+	}
+	if err := client.Accept(context.Background(), incoming[0].ID, Document{Content: []byte("title"), Signature: []byte("sig")}); err != nil {
+		t.Errorf("Accept() вернул ошибку: %v", err)
+	}
+	if err := client.Reject(context.Background(), incoming[0].ID, "Пересорт", testSigner{}); err != nil {
+		t.Errorf("Reject() вернул ошибку: %v", err)
+	}
+	if len(patches) != 2 || len(patches[0].RecipientTitles) != 1 || patches[0].RecipientTitles[0].ParentEntityID != "in-ent" ||
+		len(patches[1].XMLSignatureRejections) != 1 || string(patches[1].XMLSignatureRejections[0].SignedContent.Content) != "<Отказ/>" {
+		t.Errorf("неверные ответы получателя: %+v", patches)
+	}
+}
+
+func TestSBISClient(t *testing.T) {
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file/in-1" {
+			if r.Header.Get("X-SBISSessionID") != "session" {
+				t.Error("загрузка файла без сессии")
+			}
+			w.Write([]byte("<Файл/>"))
+			return
+		}
+
+		var request struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatalf("ошибка разбора запроса: %v", err)
+		}
+		methods = append(methods, request.Method)
+
+		if request.Method == "СБИС.Аутентифицировать" {
+			w.Write([]byte(`{"jsonrpc": "2.0", "result": "session", "id": 0}`))
+			return
+		}
+		if r.Header.Get("X-SBISSessionID") != "session" {
+			t.Errorf("вызов %s без сессии", request.Method)
+		}
+
+		switch request.Method {
+		case "СБИС.ИнформацияОКонтрагенте":
+			w.Write([]byte(`{"jsonrpc": "2.0", "result": {"Идентификатор": "2BE-buyer"}, "id": 0}`))
+		case "СБИС.ЗаписатьДокумент":
+			if !strings.Contains(string(request.Params), `"ДокОтгрИсх"`) {
+				t.Errorf("неверный документ: %s", request.Params)
+			}
+			w.Write([]byte(`{"jsonrpc": "2.0", "result": {}, "id": 0}`))
+		case "СБИС.ВыполнитьДействие":
+			w.Write([]byte(`{"jsonrpc": "2.0", "result": {}, "id": 0}`))
+		case "СБИС.ПрочитатьДокумент":
+			if strings.Contains(string(request.Params), "in-1") {
+				w.Write([]byte(`{"jsonrpc": "2.0", "result": {"Вложение": [{"Файл": {"Имя": "in.xml", "Ссылка": "/file/in-1"}}]}, "id": 0}`))
+				return
+			}
+			w.Write([]byte(`{"jsonrpc": "2.0", "result": {"Состояние": {"Код": "7", "Название": "Выполнение завершено успешно"}}, "id": 0}`))
+		case "СБИС.СписокДокументов":
+			w.Write([]byte(`{"jsonrpc": "2.0", "result": {"Документ": [{"Идентификатор": "in-1", "Состояние": {"Код": "3"}},
+				{"Идентификатор": "in-2", "Состояние": {"Код": "7"}}]}, "id": 0}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"jsonrpc": "2.0", "error": {"code": -32601, "message": "Метод не найден", "details": ""}, "id": 0}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewSBISClient(server.URL, "login", "pass", time.Second)
+
+	if id, err := client.Participant(context.Background(), "7728168971", "772801001"); err != nil || id != "2BE-buyer" {
+		t.Errorf("Participant() = %q, %v", id, err)
+	}
+
+	id, err := client.Send(context.Background(), Document{
+		FileName: "upd.xml", Number: "15", Content: []byte("<Файл/>"), Signature: []byte("sig"),
+		Sender:    Party{INN: "7707083893", KPP: "770701001"},
+		Recipient: Party{INN: "7728168971", KPP: "772801001"},
+	})
+	if err != nil || id == "" {
+		t.Fatalf("Send() = %q, %v", id, err)
+	}
+
+	status, err := client.Status(context.Background(), id)
+	if err != nil || status.State != StateAccepted {
+		t.Errorf("Status() = %+v, %v", status, err)
+	}
+
+	incoming, err := client.Incoming(context.Background(), Party{INN: "7728168971", KPP: "772801001"})
+	if err != nil || len(incoming) != 1 || incoming[0].ID != "in-1" || incoming[0].FileName != "in.xml" ||
+		string(incoming[0].Content) != "<Файл/>" {
+		t.Fatalf("Incoming() = %+v, %v", incoming, err)
+	}
+	if err := client.Accept(context.Background(), "in-1", Document{FileName: "title.xml", Content: []byte("title")}); err != nil {
+		t.Errorf("Accept() вернул ошибку: %v", err)
+	}
+	if err := client.Reject(context.Background(), "in-1", "Пересорт", nil); err != nil {
+		t.Errorf("Reject() вернул ошибку: %v", err)
+	}
+
+	expected := []string{"СБИС.Аутентифицировать", "СБИС.ИнформацияОКонтрагенте", "СБИС.ЗаписатьДокумент",
+		"СБИС.ВыполнитьДействие", "СБИС.ПрочитатьДокумент", "СБИС.СписокДокументов", "СБИС.ПрочитатьДокумент",
+		"СБИС.ВыполнитьДействие", "СБИС.ВыполнитьДействие"}
+	if strings.Join(methods, ",") != strings.Join(expected, ",") {
+		t.Errorf("неверная последовательность вызовов: %v", methods)
+	}
+}
@@ -0,0 +1,383 @@
+package edo
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"project-znak/internal/text"
+	"project-znak/internal/tracing"
+)
+
+// Адрес API СБИС
+const defaultSBISURL = "https://online.sbis.ru"
+
+// Коды состояния документа СБИС
+const (
+	sbisStateDelivered = "2" // Доставлен получателю
+	sbisStateReceived  = "3" // Получен, ожидает подписи
+	sbisStateRejected  = "6" // Получатель отказал в подписи
+	sbisStateCompleted = "7" // Документооборот завершен: получатель подписал документ
+)
+
+type sbisRequest struct {
+	JSONRPC  string `json:"jsonrpc"`
+	Method   string `json:"method"`
+	Params   any    `json:"params"`
+	Protocol int    `json:"protocol"`
+	ID       int    `json:"id"`
+}
+
+type sbisResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Details string `json:"details"`
+	} `json:"error"`
+}
+
+type sbisLegalEntity struct {
+	INN string `json:"ИНН"`
+	KPP string `json:"КПП,omitempty"`
+}
+
+type sbisParty struct {
+	LegalEntity sbisLegalEntity `json:"СвЮЛ"`
+}
+
+type sbisFile struct {
+	Name string `json:"Имя"`
+	Data string `json:"ДвоичныеДанные"`
+}
+
+type sbisSignature struct {
+	File sbisFile `json:"Файл"`
+}
+
+type sbisAttachment struct {
+	File       sbisFile        `json:"Файл"`
+	Signatures []sbisSignature `json:"Подпись"`
+}
+
+type sbisDocument struct {
+	ID           string           `json:"Идентификатор"`
+	Type         string           `json:"Тип,omitempty"`
+	Number       string           `json:"Номер,omitempty"`
+	Date         string           `json:"Дата,omitempty"`
+	Organization *sbisParty       `json:"НашаОрганизация,omitempty"`
+	Counterparty *sbisParty       `json:"Контрагент,omitempty"`
+	Attachments  []sbisAttachment `json:"Вложение,omitempty"`
+	Stage        *sbisStage       `json:"Этап,omitempty"`
+}
+
+type sbisStage struct {
+	Name        string           `json:"Название"`
+	Attachments []sbisAttachment `json:"Вложение,omitempty"`
+	Action      struct {
+		Name    string `json:"Название"`
+		Comment string `json:"Комментарий,omitempty"`
+	} `json:"Действие"`
+}
+
+type sbisDocumentList struct {
+	Documents []struct {
+		ID    string `json:"Идентификатор"`
+		State struct {
+			Code string `json:"Код"`
+		} `json:"Состояние"`
+	} `json:"Документ"`
+}
+
+type sbisDocumentFiles struct {
+	Attachments []struct {
+		File struct {
+			Name string `json:"Имя"`
+			Link string `json:"Ссылка"`
+		} `json:"Файл"`
+	} `json:"Вложение"`
+}
+
+type sbisState struct {
+	State struct {
+		Code    string `json:"Код"`
+		Name    string `json:"Название"`
+		Comment string `json:"Примечание"`
+	} `json:"Состояние"`
+}
+
+// SBISClient отправляет документы через JSON-RPC API СБИС
+type SBISClient struct {
+	baseURL    string
+	login      string
+	password   string
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	session string
+}
+
+// NewSBISClient создает клиент СБИС. Если адрес не задан, используется рабочий адрес API.
+func NewSBISClient(baseURL, login, password string, timeout time.Duration) *SBISClient {
+	if baseURL == "" {
+		baseURL = defaultSBISURL
+	}
+	return &SBISClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		login:      login,
+		password:   password,
+		httpClient: &http.Client{Timeout: timeout, Transport: tracing.Transport("sbis")},
+	}
+}
+
+// Name возвращает идентификатор оператора
+func (c *SBISClient) Name() string {
+	return ProviderSBIS
+}
+
+// Participant возвращает идентификатор участника ЭДО организации
+func (c *SBISClient) Participant(ctx context.Context, inn, kpp string) (string, error) {
+	var result struct {
+		ID string `json:"Идентификатор"`
+	}
+	params := map[string]any{"Участник": sbisParty{LegalEntity: sbisLegalEntity{INN: inn, KPP: kpp}}}
+	if err := c.call(ctx, "СБИС.ИнформацияОКонтрагенте", params, &result); err != nil {
+		return "", err
+	}
+	if result.ID == "" {
+		return "", fmt.Errorf("%w: ИНН %s", ErrParticipantNotFound, inn)
+	}
+	return result.ID, nil
+}
+
+// Send создает исходящий документ отгрузки с подписанным УПД и отправляет его контрагенту.
+// Документ создается с собственным идентификатором, который и возвращается.
+func (c *SBISClient) Send(ctx context.Context, doc Document) (string, error) {
+	id, err := newGUID()
+	if err != nil {
+		return "", err
+	}
+
+	document := sbisDocument{
+		ID:           id,
+		Type:         "ДокОтгрИсх",
+		Number:       doc.Number,
+		Date:         doc.Date.Format("02.01.2006"),
+		Organization: &sbisParty{LegalEntity: sbisLegalEntity{INN: doc.Sender.INN, KPP: doc.Sender.KPP}},
+		Counterparty: &sbisParty{LegalEntity: sbisLegalEntity{INN: doc.Recipient.INN, KPP: doc.Recipient.KPP}},
+		Attachments: []sbisAttachment{{
+			File: sbisFile{Name: doc.FileName, Data: base64.StdEncoding.EncodeToString(doc.Content)},
+			Signatures: []sbisSignature{{
+				File: sbisFile{Name: doc.FileName + ".sgn", Data: base64.StdEncoding.EncodeToString(doc.Signature)},
+			}},
+		}},
+	}
+	if err := c.call(ctx, "СБИС.ЗаписатьДокумент", map[string]any{"Документ": document}, nil); err != nil {
+		return "", err
+	}
+
+	action := sbisDocument{ID: id, Stage: &sbisStage{Name: "Отправка"}}
+	action.Stage.Action.Name = "Отправить"
+	if err := c.call(ctx, "СБИС.ВыполнитьДействие", map[string]any{"Документ": action}, nil); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Status возвращает состояние документа по коду состояния СБИС
+func (c *SBISClient) Status(ctx context.Context, id string) (*Status, error) {
+	var result sbisState
+	if err := c.call(ctx, "СБИС.ПрочитатьДокумент", map[string]any{"Документ": sbisDocument{ID: id}}, &result); err != nil {
+		return nil, err
+	}
+
+	status := &Status{State: StateSent}
+	switch result.State.Code {
+	case sbisStateDelivered, sbisStateReceived:
+		status.State = StateDelivered
+	case sbisStateCompleted:
+		status.State = StateAccepted
+	case sbisStateRejected:
+		status.State = StateRejected
+		status.Comment = result.State.Comment
+		if status.Comment == "" {
+			status.Comment = result.State.Name
+		}
+	}
+	return status, nil
+}
+
+// Incoming возвращает входящие документы отгрузки организации, ожидающие подписи.
+// Файл УПД - первое вложение документа.
+func (c *SBISClient) Incoming(ctx context.Context, recipient Party) ([]Incoming, error) {
+	var list sbisDocumentList
+	params := map[string]any{"Фильтр": map[string]any{
+		"Тип":             "ДокОтгрВх",
+		"НашаОрганизация": sbisParty{LegalEntity: sbisLegalEntity{INN: recipient.INN, KPP: recipient.KPP}},
+	}}
+	if err := c.call(ctx, "СБИС.СписокДокументов", params, &list); err != nil {
+		return nil, err
+	}
+
+	var documents []Incoming
+	for _, doc := range list.Documents {
+		if doc.State.Code != sbisStateDelivered && doc.State.Code != sbisStateReceived {
+			continue
+		}
+		var files sbisDocumentFiles
+		if err := c.call(ctx, "СБИС.ПрочитатьДокумент", map[string]any{"Документ": sbisDocument{ID: doc.ID}}, &files); err != nil {
+			return nil, err
+		}
+		if len(files.Attachments) == 0 {
+			continue
+		}
+		file := files.Attachments[0].File
+		content, err := c.download(ctx, file.Link)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения документа %s: %w", doc.ID, err)
+		}
+		documents = append(documents, Incoming{ID: doc.ID, FileName: file.Name, Content: content})
+	}
+	return documents, nil
+}
+
+// Accept утверждает входящий документ, прикладывая подписанный титул покупателя
+func (c *SBISClient) Accept(ctx context.Context, id string, title Document) error {
+	action := sbisDocument{ID: id, Stage: &sbisStage{Name: "Утверждение", Attachments: []sbisAttachment{{
+		File: sbisFile{Name: title.FileName, Data: base64.StdEncoding.EncodeToString(title.Content)},
+		Signatures: []sbisSignature{{
+			File: sbisFile{Name: title.FileName + ".sgn", Data: base64.StdEncoding.EncodeToString(title.Signature)},
+		}},
+	}}}}
+	action.Stage.Action.Name = "Утвердить"
+	return c.call(ctx, "СБИС.ВыполнитьДействие", map[string]any{"Документ": action}, nil)
+}
+
+// Reject отклоняет входящий документ с комментарием. Уведомление об уточнении
+// формирует и подписывает СБИС, поэтому signer не используется.
+func (c *SBISClient) Reject(ctx context.Context, id, comment string, signer Signer) error {
+	action := sbisDocument{ID: id, Stage: &sbisStage{Name: "Утверждение"}}
+	action.Stage.Action.Name = "Отклонить"
+	action.Stage.Action.Comment = comment
+	return c.call(ctx, "СБИС.ВыполнитьДействие", map[string]any{"Документ": action}, nil)
+}
+
+// Загрузка файла вложения по ссылке в авторизованной сессии
+func (c *SBISClient) download(ctx context.Context, link string) ([]byte, error) {
+	session, err := c.sessionID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(link, "/") {
+		link = c.baseURL + link
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("X-SBISSessionID", session)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к СБИС: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1048576))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения ответа СБИС: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("СБИС вернул ошибку: %d, тело: %s", resp.StatusCode, text.Truncate(string(data), 1024))
+	}
+	return data, nil
+}
+
+// Идентификатор сессии; при истечении сессии запрашивается повторно
+func (c *SBISClient) sessionID(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session != "" {
+		return c.session, nil
+	}
+
+	var session string
+	params := map[string]any{"Параметр": map[string]string{"Логин": c.login, "Пароль": c.password}}
+	if err := c.send(ctx, "/auth/service/", "", "СБИС.Аутентифицировать", params, &session); err != nil {
+		return "", fmt.Errorf("ошибка авторизации в СБИС: %w", err)
+	}
+	if session == "" {
+		return "", fmt.Errorf("СБИС не вернул идентификатор сессии")
+	}
+	c.session = session
+	return session, nil
+}
+
+// Вызов метода API в авторизованной сессии
+func (c *SBISClient) call(ctx context.Context, method string, params, out any) error {
+	session, err := c.sessionID(ctx)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, "/service/?srv=1", session, method, params, out)
+}
+
+func (c *SBISClient) send(ctx context.Context, path, session, method string, params, out any) error {
+	body, err := json.Marshal(sbisRequest{JSONRPC: "2.0", Method: method, Params: params, Protocol: 4})
+	if err != nil {
+		return fmt.Errorf("ошибка формирования запроса %s: %w", method, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json-rpc; charset=utf-8")
+	if session != "" {
+		req.Header.Set("X-SBISSessionID", session)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса к СБИС: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1048576))
+	if err != nil {
+		return fmt.Errorf("ошибка чтения ответа СБИС: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized && session != "" {
+		// Сессия истекла; следующий запрос авторизуется заново
+		c.mu.Lock()
+		c.session = ""
+		c.mu.Unlock()
+	}
+
+	// Ошибки методов возвращаются в теле ответа JSON-RPC, в том числе с кодом 500
+	var response sbisResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("СБИС вернул ошибку: %d, тело: %s", resp.StatusCode, text.Truncate(string(data), 1024))
+		}
+		return fmt.Errorf("ошибка декодирования ответа СБИС: %w", err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("СБИС вернул ошибку %s: %s %s", method, response.Error.Message, response.Error.Details)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("СБИС вернул ошибку: %d, тело: %s", resp.StatusCode, text.Truncate(string(data), 1024))
+	}
+	if out != nil {
+		if err := json.Unmarshal(response.Result, out); err != nil {
+			return fmt.Errorf("ошибка декодирования ответа СБИС: %w", err)
+		}
+	}
+	return nil
+}
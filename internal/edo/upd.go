@@ -0,0 +1,329 @@
+package edo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Формат УПД: приказ ФНС № ММВ-7-15/820@, версия 5.01, функция СЧФДОП -
+// счет-фактура и документ об отгрузке товаров
+const (
+	updPrefix   = "ON_NSCHFDOPPR"
+	updVersion  = "5.01"
+	updKND      = "1115131"
+	updFunction = "СЧФДОП"
+	updProgram  = "Project Znak"
+)
+
+// Разделитель GS в коде маркировки; в УПД код передается без криптохвоста
+const groupSeparator = "\x1d"
+
+type updFile struct {
+	XMLName  xml.Name    `xml:"Файл"`
+	ID       string      `xml:"ИдФайл,attr"`
+	Version  string      `xml:"ВерсФорм,attr"`
+	Program  string      `xml:"ВерсПрог,attr"`
+	Exchange updExchange `xml:"СвУчДокОбор"`
+	Document updDocument `xml:"Документ"`
+}
+
+type updExchange struct {
+	Sender    string `xml:"ИдОтпр,attr"`
+	Recipient string `xml:"ИдПол,attr"`
+}
+
+type updDocument struct {
+	KND       string       `xml:"КНД,attr"`
+	Function  string       `xml:"Функция,attr"`
+	Date      string       `xml:"ДатаИнфПр,attr"`
+	Time      string       `xml:"ВремИнфПр,attr"`
+	Composer  string       `xml:"НаимЭконСубСост,attr"`
+	Invoice   updInvoice   `xml:"СвСчФакт"`
+	Table     updTable     `xml:"ТаблСчФакт"`
+	Transfer  updTransfer  `xml:"СвПродПер>СвПер"`
+	Signatory updSignatory `xml:"Подписант"`
+}
+
+type updInvoice struct {
+	Number   string   `xml:"НомерСчФ,attr"`
+	Date     string   `xml:"ДатаСчФ,attr"`
+	Currency string   `xml:"КодОКВ,attr"`
+	Seller   updParty `xml:"СвПрод"`
+	Buyer    updParty `xml:"СвПокуп"`
+}
+
+type updParty struct {
+	Organization updOrganization `xml:"ИдСв>СвЮЛУч"`
+	Address      *updAddress     `xml:"Адрес>АдрИнф"`
+}
+
+type updOrganization struct {
+	Name string `xml:"НаимОрг,attr"`
+	INN  string `xml:"ИННЮЛ,attr"`
+	KPP  string `xml:"КПП,attr,omitempty"`
+}
+
+type updAddress struct {
+	Country string `xml:"КодСтр,attr"`
+	Text    string `xml:"АдрТекст,attr"`
+}
+
+type updTable struct {
+	Items []updItem `xml:"СведТов"`
+	Total updTotal  `xml:"ВсегоОпл"`
+}
+
+type updItem struct {
+	Line      int          `xml:"НомСтр,attr"`
+	Name      string       `xml:"НаимТов,attr"`
+	Unit      string       `xml:"ОКЕИ_Тов,attr"`
+	Quantity  string       `xml:"КолТов,attr"`
+	Price     string       `xml:"ЦенаТов,attr"`
+	NetAmount string       `xml:"СтТовБезНДС,attr"`
+	VATRate   string       `xml:"НалСт,attr"`
+	Amount    string       `xml:"СтТовУчНал,attr"`
+	Excise    string       `xml:"Акциз>БезАкциз"`
+	VAT       updVAT       `xml:"СумНал"`
+	Extra     updItemExtra `xml:"ДопСведТов"`
+}
+
+type updVAT struct {
+	Amount  string `xml:"СумНал,omitempty"`
+	Without string `xml:"БезНДС,omitempty"`
+}
+
+type updItemExtra struct {
+	Kind  string   `xml:"ПрТовРаб,attr"`
+	GTIN  string   `xml:"КодТов,attr,omitempty"`
+	Codes []string `xml:"НомСредИдентТов>КИЗ"`
+}
+
+type updTotal struct {
+	NetAmount string `xml:"СтТовБезНДСВсего,attr"`
+	Amount    string `xml:"СтТовУчНалВсего,attr"`
+	VAT       updVAT `xml:"СумНалВсего"`
+}
+
+type updTransfer struct {
+	Operation string   `xml:"СодОпер,attr"`
+	Basis     updBasis `xml:"ОснПер"`
+}
+
+type updBasis struct {
+	Name string `xml:"НаимОсн,attr"`
+}
+
+type updSignatory struct {
+	Scope     string        `xml:"ОблПолн,attr"`
+	Status    string        `xml:"Статус,attr"`
+	Authority string        `xml:"ОснПолн,attr"`
+	Person    updSignPerson `xml:"ЮЛ"`
+}
+
+type updSignPerson struct {
+	INN          string  `xml:"ИННЮЛ,attr"`
+	Organization string  `xml:"НаимОрг,attr"`
+	Position     string  `xml:"Должн,attr"`
+	Name         updName `xml:"ФИО"`
+}
+
+type updName struct {
+	LastName   string `xml:"Фамилия,attr"`
+	FirstName  string `xml:"Имя,attr"`
+	MiddleName string `xml:"Отчество,attr,omitempty"`
+}
+
+// Build формирует файл УПД в формате ФНС 5.01 с перечнем кодов маркировки в строках
+// и подписывает его. Файл записывается в кодировке windows-1251, как требует формат.
+func Build(upd *UPD, signer Signer) (*Document, error) {
+	if upd.Seller.ID == "" || upd.Buyer.ID == "" {
+		return nil, errors.New("не указаны идентификаторы участников ЭДО")
+	}
+	if len(upd.Items) == 0 {
+		return nil, errors.New("в УПД нет строк")
+	}
+
+	guid, err := newGUID()
+	if err != nil {
+		return nil, err
+	}
+	fileID := strings.Join([]string{updPrefix, upd.Buyer.ID, upd.Seller.ID, upd.Date.Format("20060102"), guid}, "_")
+
+	file := updFile{
+		ID:       fileID,
+		Version:  updVersion,
+		Program:  updProgram,
+		Exchange: updExchange{Sender: upd.Seller.ID, Recipient: upd.Buyer.ID},
+		Document: updDocument{
+			KND:      updKND,
+			Function: updFunction,
+			Date:     upd.Date.Format("02.01.2006"),
+			Time:     upd.Date.Format("15.04.05"),
+			Composer: upd.Seller.Name,
+			Invoice: updInvoice{
+				Number:   upd.Number,
+				Date:     upd.Date.Format("02.01.2006"),
+				Currency: "643",
+				Seller:   updPartyOf(upd.Seller),
+				Buyer:    updPartyOf(upd.Buyer),
+			},
+			Transfer: updTransfer{Operation: "Товары переданы", Basis: updBasis{Name: "Без документа-основания"}},
+			Signatory: updSignatory{
+				// 6 - лицо, ответственное за оформление счета-фактуры и за совершение операции;
+				// 1 - работник организации-продавца
+				Scope:     "6",
+				Status:    "1",
+				Authority: "Должностные обязанности",
+				Person: updSignPerson{
+					INN:          upd.Seller.INN,
+					Organization: upd.Seller.Name,
+					Position:     upd.Signatory.Position,
+					Name: updName{
+						LastName:   upd.Signatory.LastName,
+						FirstName:  upd.Signatory.FirstName,
+						MiddleName: upd.Signatory.MiddleName,
+					},
+				},
+			},
+		},
+	}
+	if file.Document.Signatory.Person.Position == "" {
+		file.Document.Signatory.Person.Position = "Руководитель"
+	}
+
+	var totalNet, totalVAT, total float64
+	vatTotal := false
+	for i, item := range upd.Items {
+		if item.Quantity <= 0 || len(item.Codes) != item.Quantity {
+			return nil, fmt.Errorf("строка %d: число кодов маркировки не совпадает с количеством товара", i+1)
+		}
+		rate, percent, err := vatRate(item.VATRate)
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %w", i+1, err)
+		}
+
+		amount := round(item.Price * float64(item.Quantity))
+		vat := round(amount * percent / (100 + percent))
+		net := round(amount - vat)
+		row := updItem{
+			Line:      i + 1,
+			Name:      item.Name,
+			Unit:      "796", // ОКЕИ: штука
+			Quantity:  strconv.Itoa(item.Quantity),
+			Price:     strconv.FormatFloat(net/float64(item.Quantity), 'f', 2, 64),
+			NetAmount: formatAmount(net),
+			VATRate:   rate,
+			Amount:    formatAmount(amount),
+			Excise:    "без акциза",
+			Extra:     updItemExtra{Kind: "1", GTIN: item.GTIN}, // 1 - товар
+		}
+		if row.Name == "" {
+			row.Name = "GTIN " + item.GTIN
+		}
+		if item.VATRate == "none" {
+			row.VAT.Without = "без НДС"
+		} else {
+			row.VAT.Amount = formatAmount(vat)
+			vatTotal = true
+		}
+		for _, code := range item.Codes {
+			code, _, _ = strings.Cut(code, groupSeparator)
+			row.Extra.Codes = append(row.Extra.Codes, code)
+		}
+		file.Document.Table.Items = append(file.Document.Table.Items, row)
+
+		totalNet += net
+		totalVAT += vat
+		total += amount
+	}
+	file.Document.Table.Total = updTotal{NetAmount: formatAmount(totalNet), Amount: formatAmount(total)}
+	if vatTotal {
+		file.Document.Table.Total.VAT.Amount = formatAmount(totalVAT)
+	} else {
+		file.Document.Table.Total.VAT.Without = "без НДС"
+	}
+
+	content, err := marshalXML(file)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка формирования УПД: %w", err)
+	}
+
+	signature, err := signer.Sign(content)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подписи УПД: %w", err)
+	}
+
+	return &Document{
+		FileName:  fileID + ".xml",
+		Number:    upd.Number,
+		Date:      upd.Date,
+		Content:   content,
+		Signature: signature,
+		Sender:    upd.Seller,
+		Recipient: upd.Buyer,
+	}, nil
+}
+
+// Файл в формате ФНС: XML в кодировке windows-1251. Символы, отсутствующие
+// в windows-1251, заменяются.
+func marshalXML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="windows-1251"?>` + "\n")
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return encoding.ReplaceUnsupported(charmap.Windows1251.NewEncoder()).Bytes(buf.Bytes())
+}
+
+func updPartyOf(party Party) updParty {
+	result := updParty{Organization: updOrganization{Name: party.Name, INN: party.INN, KPP: party.KPP}}
+	if party.Address != "" {
+		result.Address = &updAddress{Country: "643", Text: party.Address}
+	}
+	return result
+}
+
+// Ставка НДС для УПД и ее значение в процентах
+func vatRate(rate string) (string, float64, error) {
+	switch rate {
+	case "none":
+		return "без НДС", 0, nil
+	case "0":
+		return "0%", 0, nil
+	case "10":
+		return "10%", 10, nil
+	case "20":
+		return "20%", 20, nil
+	}
+	return "", 0, fmt.Errorf("неподдерживаемая ставка НДС %q", rate)
+}
+
+// Идентификатор файла в формате GUID
+func newGUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("ошибка генерации идентификатора файла: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
@@ -0,0 +1,320 @@
+package fiscal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"project-znak/internal/text"
+	"project-znak/internal/tracing"
+)
+
+// Адрес API АТОЛ Онлайн версии 4
+const defaultATOLURL = "https://online.atol.ru/possystem/v4"
+
+// Токен АТОЛ Онлайн действует сутки; обновляется заранее
+const atolTokenTTL = 23 * time.Hour
+
+// Статусы обработки чека АТОЛ Онлайн
+const (
+	atolStatusWait = "wait"
+	atolStatusDone = "done"
+	atolStatusFail = "fail"
+)
+
+// Company - данные продавца, указываемые в чеке
+type Company struct {
+	INN            string
+	Email          string
+	PaymentAddress string // Адрес сайта, на котором принимается оплата
+	TaxSystem      string // Система налогообложения: osn, usn_income, usn_income_outcome, patent
+	VAT            string // Ставка НДС позиций: none, vat0, vat10, vat20
+}
+
+// Ошибка в ответе АТОЛ Онлайн
+type atolError struct {
+	Code int    `json:"code"`
+	Text string `json:"text"`
+}
+
+type atolTokenResponse struct {
+	Error *atolError `json:"error"`
+	Token string     `json:"token"`
+}
+
+type atolVAT struct {
+	Type string `json:"type"`
+}
+
+type atolItem struct {
+	Name            string  `json:"name"`
+	Price           float64 `json:"price"`
+	Quantity        float64 `json:"quantity"`
+	Sum             float64 `json:"sum"`
+	MeasurementUnit string  `json:"measurement_unit"`
+	PaymentMethod   string  `json:"payment_method"`
+	PaymentObject   string  `json:"payment_object"`
+	VAT             atolVAT `json:"vat"`
+}
+
+type atolPayment struct {
+	Type int     `json:"type"`
+	Sum  float64 `json:"sum"`
+}
+
+type atolReceipt struct {
+	Client struct {
+		Email string `json:"email"`
+	} `json:"client"`
+	Company struct {
+		Email          string `json:"email"`
+		SNO            string `json:"sno"`
+		INN            string `json:"inn"`
+		PaymentAddress string `json:"payment_address"`
+	} `json:"company"`
+	Items    []atolItem    `json:"items"`
+	Payments []atolPayment `json:"payments"`
+	Total    float64       `json:"total"`
+}
+
+type atolSellRequest struct {
+	ExternalID string      `json:"external_id"`
+	Receipt    atolReceipt `json:"receipt"`
+	Timestamp  string      `json:"timestamp"`
+}
+
+type atolSellResponse struct {
+	UUID   string     `json:"uuid"`
+	Error  *atolError `json:"error"`
+	Status string     `json:"status"`
+}
+
+type atolReportResponse struct {
+	UUID    string     `json:"uuid"`
+	Error   *atolError `json:"error"`
+	Status  string     `json:"status"`
+	Payload *struct {
+		Total                   float64 `json:"total"`
+		FNSSite                 string  `json:"fns_site"`
+		FNNumber                string  `json:"fn_number"`
+		ShiftNumber             int     `json:"shift_number"`
+		ReceiptDatetime         string  `json:"receipt_datetime"`
+		FiscalReceiptNumber     int     `json:"fiscal_receipt_number"`
+		FiscalDocumentNumber    int     `json:"fiscal_document_number"`
+		ECRRegistrationNumber   string  `json:"ecr_registration_number"`
+		FiscalDocumentAttribute int64   `json:"fiscal_document_attribute"`
+	} `json:"payload"`
+}
+
+// ATOLClient регистрирует чеки через API АТОЛ Онлайн v4
+type ATOLClient struct {
+	baseURL    string
+	login      string
+	password   string
+	groupCode  string
+	company    Company
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewATOLClient создает клиент АТОЛ Онлайн. Если адрес не задан, используется рабочий адрес API.
+func NewATOLClient(baseURL, login, password, groupCode string, company Company, timeout time.Duration) *ATOLClient {
+	if baseURL == "" {
+		baseURL = defaultATOLURL
+	}
+	return &ATOLClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		login:      login,
+		password:   password,
+		groupCode:  groupCode,
+		company:    company,
+		httpClient: &http.Client{Timeout: timeout, Transport: tracing.Transport("atol")},
+	}
+}
+
+// Name возвращает идентификатор оператора
+func (c *ATOLClient) Name() string {
+	return ProviderATOL
+}
+
+// Register передает чек прихода в очередь кассы и возвращает его идентификатор в АТОЛ Онлайн
+func (c *ATOLClient) Register(ctx context.Context, receipt Receipt) (string, error) {
+	request := atolSellRequest{
+		ExternalID: receipt.ExternalID,
+		Timestamp:  time.Now().Format("02.01.2006 15:04:05"),
+	}
+	// Электронный чек отправляется покупателю; если его адрес неизвестен, - продавцу
+	request.Receipt.Client.Email = receipt.Email
+	if request.Receipt.Client.Email == "" {
+		request.Receipt.Client.Email = c.company.Email
+	}
+	request.Receipt.Company.Email = c.company.Email
+	request.Receipt.Company.SNO = c.company.TaxSystem
+	request.Receipt.Company.INN = c.company.INN
+	request.Receipt.Company.PaymentAddress = c.company.PaymentAddress
+	for _, item := range receipt.Items {
+		request.Receipt.Items = append(request.Receipt.Items, atolItem{
+			Name:            text.Truncate(item.Name, 128),
+			Price:           roundAmount(item.Price),
+			Quantity:        item.Quantity,
+			Sum:             roundAmount(item.Sum),
+			MeasurementUnit: "шт",
+			PaymentMethod:   "full_payment",
+			PaymentObject:   "service",
+			VAT:             atolVAT{Type: c.company.VAT},
+		})
+	}
+	// Тип 1 - безналичная оплата
+	request.Receipt.Payments = []atolPayment{{Type: 1, Sum: roundAmount(receipt.Total)}}
+	request.Receipt.Total = roundAmount(receipt.Total)
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("ошибка формирования чека: %w", err)
+	}
+
+	var response atolSellResponse
+	if err := c.do(ctx, http.MethodPost, "/"+url.PathEscape(c.groupCode)+"/sell", body, &response); err != nil {
+		return "", err
+	}
+	// Чек с уже переданным external_id не создается повторно: возвращается ошибка
+	// с идентификатором ранее принятого чека
+	if response.Error != nil && response.UUID == "" {
+		return "", fmt.Errorf("АТОЛ Онлайн отклонил чек: %d %s", response.Error.Code, response.Error.Text)
+	}
+	if response.UUID == "" {
+		return "", fmt.Errorf("АТОЛ Онлайн не вернул идентификатор чека")
+	}
+	return response.UUID, nil
+}
+
+// Status возвращает фискальные реквизиты чека или ErrPending, если чек еще обрабатывается
+func (c *ATOLClient) Status(ctx context.Context, id string) (*Document, error) {
+	var response atolReportResponse
+	path := "/" + url.PathEscape(c.groupCode) + "/report/" + url.PathEscape(id)
+	if err := c.do(ctx, http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+
+	switch response.Status {
+	case atolStatusWait:
+		return nil, ErrPending
+	case atolStatusFail:
+		if response.Error != nil {
+			return nil, fmt.Errorf("%w: %d %s", ErrRejected, response.Error.Code, response.Error.Text)
+		}
+		return nil, ErrRejected
+	case atolStatusDone:
+	default:
+		return nil, fmt.Errorf("неизвестный статус чека АТОЛ Онлайн: %q", response.Status)
+	}
+	if response.Payload == nil {
+		return nil, fmt.Errorf("АТОЛ Онлайн не вернул реквизиты чека")
+	}
+
+	payload := response.Payload
+	doc := &Document{
+		FiscalDocumentNumber:    fmt.Sprint(payload.FiscalDocumentNumber),
+		FiscalDocumentAttribute: fmt.Sprint(payload.FiscalDocumentAttribute),
+		FNNumber:                payload.FNNumber,
+		ReceiptNumber:           fmt.Sprint(payload.FiscalReceiptNumber),
+		ShiftNumber:             fmt.Sprint(payload.ShiftNumber),
+		RegistrationNumber:      payload.ECRRegistrationNumber,
+		FNSSite:                 payload.FNSSite,
+		Total:                   payload.Total,
+	}
+	if t, err := time.Parse("02.01.2006 15:04:05", payload.ReceiptDatetime); err == nil {
+		doc.RegisteredAt = t
+	} else {
+		doc.RegisteredAt = time.Now()
+	}
+	return doc, nil
+}
+
+// Токен авторизации; запрашивается повторно по истечении срока действия
+func (c *ATOLClient) authToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"login": c.login, "pass": c.password})
+	if err != nil {
+		return "", fmt.Errorf("ошибка формирования запроса токена: %w", err)
+	}
+
+	var response atolTokenResponse
+	if err := c.send(ctx, http.MethodPost, "/getToken", "", body, &response); err != nil {
+		return "", err
+	}
+	if response.Error != nil {
+		return "", fmt.Errorf("ошибка авторизации в АТОЛ Онлайн: %d %s", response.Error.Code, response.Error.Text)
+	}
+	if response.Token == "" {
+		return "", fmt.Errorf("АТОЛ Онлайн не вернул токен")
+	}
+
+	c.token, c.tokenExpiry = response.Token, time.Now().Add(atolTokenTTL)
+	return c.token, nil
+}
+
+// Выполнение авторизованного запроса к API
+func (c *ATOLClient) do(ctx context.Context, method, path string, body []byte, out any) error {
+	token, err := c.authToken(ctx)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, method, path, token, body, out)
+}
+
+func (c *ATOLClient) send(ctx context.Context, method, path, token string, body []byte, out any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	if token != "" {
+		req.Header.Set("Token", token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса к АТОЛ Онлайн: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1048576))
+	if err != nil {
+		return fmt.Errorf("ошибка чтения ответа АТОЛ Онлайн: %w", err)
+	}
+	// Ошибки бизнес-логики возвращаются с кодом 400 и описанием в теле
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return fmt.Errorf("АТОЛ Онлайн вернул ошибку: %d, тело: %s", resp.StatusCode, text.Truncate(string(data), 1024))
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("ошибка декодирования ответа АТОЛ Онлайн: %w", err)
+	}
+	return nil
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,86 @@
+package fiscal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestATOLClient(t *testing.T) {
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/getToken" {
+			tokenRequests++
+			w.Write([]byte(`{"error": null, "token": "tok", "timestamp": "01.03.2026 10:00:00"}`))
+			return
+		}
+		if r.Header.Get("Token") != "tok" {
+			t.Errorf("запрос %s без токена", r.URL.Path)
+		}
+
+		switch r.URL.Path {
+		case "/group/sell":
+			var request atolSellRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				t.Fatalf("ошибка разбора чека: %v", err)
+			}
+			if request.ExternalID != "payment-7" || request.Receipt.Client.Email != "buyer@example.com" ||
+				request.Receipt.Company.INN != "7707083893" || request.Receipt.Total != 150 ||
+				len(request.Receipt.Items) != 1 || request.Receipt.Items[0].VAT.Type != "none" {
+				t.Errorf("неверный чек: %+v", request)
+			}
+			w.Write([]byte(`{"uuid": "uuid-1", "status": "wait", "error": null}`))
+		case "/group/report/uuid-1":
+			w.Write([]byte(`{"uuid": "uuid-1", "status": "done", "error": null, "payload": {
+				"total": 150, "fns_site": "www.nalog.gov.ru", "fn_number": "9999078900004792",
+				"shift_number": 12, "receipt_datetime": "01.03.2026 10:00:05", "fiscal_receipt_number": 3,
+				"fiscal_document_number": 145, "ecr_registration_number": "0000000001002292",
+				"fiscal_document_attribute": 3449555941}}`))
+		case "/group/report/uuid-2":
+			w.Write([]byte(`{"uuid": "uuid-2", "status": "wait", "error": null}`))
+		case "/group/report/uuid-3":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"uuid": "uuid-3", "status": "fail", "error": {"code": 34, "text": "Ошибка ККТ"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewATOLClient(server.URL, "login", "pass", "group",
+		Company{INN: "7707083893", Email: "shop@example.com", TaxSystem: "usn_income", VAT: "none"}, time.Second)
+
+	id, err := client.Register(context.Background(), Receipt{
+		ExternalID: "payment-7",
+		Email:      "buyer@example.com",
+		Items:      []Item{{Name: "Коды маркировки", Price: 1.5, Quantity: 100, Sum: 150}},
+		Total:      150,
+	})
+	if err != nil || id != "uuid-1" {
+		t.Fatalf("Register() = %q, %v", id, err)
+	}
+
+	doc, err := client.Status(context.Background(), "uuid-1")
+	if err != nil {
+		t.Fatalf("Status() вернул ошибку: %v", err)
+	}
+	if doc.FiscalDocumentNumber != "145" || doc.FiscalDocumentAttribute != "3449555941" ||
+		doc.FNNumber != "9999078900004792" || doc.RegisteredAt.IsZero() {
+		t.Errorf("неверные реквизиты чека: %+v", doc)
+	}
+
+	if _, err := client.Status(context.Background(), "uuid-2"); !errors.Is(err, ErrPending) {
+		t.Errorf("ожидалась ошибка ErrPending, получено: %v", err)
+	}
+	if _, err := client.Status(context.Background(), "uuid-3"); !errors.Is(err, ErrRejected) {
+		t.Errorf("ожидалась ошибка ErrRejected, получено: %v", err)
+	}
+
+	if tokenRequests != 1 {
+		t.Errorf("токен запрошен %d раз, ожидался 1", tokenRequests)
+	}
+}
@@ -0,0 +1,59 @@
+package fiscal
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Поддерживаемые операторы фискальных данных
+const (
+	ProviderATOL = "atol" // АТОЛ Онлайн
+)
+
+// Ошибки регистрации чека
+var (
+	// ErrPending возвращается, пока чек обрабатывается кассой
+	ErrPending = errors.New("чек еще не зарегистрирован")
+	// ErrRejected возвращается, если касса отклонила чек; его нужно отправить повторно
+	// с новым идентификатором
+	ErrRejected = errors.New("касса не зарегистрировала чек")
+)
+
+// Item - позиция чека. Цена и сумма включают НДС.
+type Item struct {
+	Name     string
+	Price    float64
+	Quantity float64
+	Sum      float64
+}
+
+// Receipt - чек прихода. ExternalID должен быть уникальным для каждой попытки регистрации:
+// касса не принимает повторно чек с тем же идентификатором.
+type Receipt struct {
+	ExternalID string
+	Email      string // Адрес покупателя для отправки электронного чека
+	Items      []Item
+	Total      float64
+}
+
+// Document - фискальные реквизиты зарегистрированного чека
+type Document struct {
+	FiscalDocumentNumber    string    // ФД - номер фискального документа
+	FiscalDocumentAttribute string    // ФПД - фискальный признак документа
+	FNNumber                string    // ФН - номер фискального накопителя
+	ReceiptNumber           string    // Номер чека в смене
+	ShiftNumber             string    // Номер смены
+	RegistrationNumber      string    // Регистрационный номер ККТ
+	FNSSite                 string    // Сайт ФНС для проверки чека
+	Total                   float64   // Сумма чека
+	RegisteredAt            time.Time // Дата и время регистрации чека
+}
+
+// Provider регистрирует чеки через онлайн-кассу. Регистрация асинхронная: Register
+// передает чек в очередь кассы, Status возвращает реквизиты или ErrPending.
+type Provider interface {
+	Name() string
+	Register(ctx context.Context, receipt Receipt) (string, error)
+	Status(ctx context.Context, id string) (*Document, error)
+}
@@ -0,0 +1,265 @@
+package grpc
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+
+	"project-znak/internal/models"
+	pb "project-znak/internal/pb/znakv1"
+	"project-znak/internal/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// NewServer создает gRPC-сервер с сервисами КИЗ, платежей и пользователей,
+// health-сервисом и reflection
+func NewServer(svc *service.Service, logger *log.Logger) (*grpc.Server, *health.Server) {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		logInterceptor(logger),
+		authInterceptor(svc, logger),
+	))
+
+	pb.RegisterKIZServiceServer(server, &kizService{svc: svc, logger: logger})
+	pb.RegisterPaymentServiceServer(server, &paymentService{svc: svc, logger: logger})
+	pb.RegisterUserServiceServer(server, &userService{svc: svc, logger: logger})
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	for name := range server.GetServiceInfo() {
+		healthServer.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+
+	reflection.Register(server)
+
+	return server, healthServer
+}
+
+// Логирование gRPC-вызовов
+func logInterceptor(logger *log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		logger.Printf("gRPC запрос: %s", info.FullMethod)
+		resp, err := handler(ctx, req)
+		logger.Printf("gRPC запрос обработан за %v: %s (%s)", time.Since(start), info.FullMethod, status.Code(err))
+		return resp, err
+	}
+}
+
+// Авторизация gRPC-вызовов по API ключу из метаданных x-api-key.
+// Как и в REST API, вызовы без ключа допускаются.
+func authInterceptor(svc *service.Service, logger *log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		keys := md.Get("x-api-key")
+		if len(keys) == 0 || keys[0] == "" {
+			return handler(ctx, req)
+		}
+
+		client := service.ClientInfo{IP: actor(ctx, 0).IP}
+		if agents := md.Get("user-agent"); len(agents) > 0 {
+			client.UserAgent = agents[0]
+		}
+		userID, keyID, err := svc.AuthenticateAPIKey(ctx, keys[0], client)
+		if err != nil {
+			return nil, toStatus(logger, err)
+		}
+		if userID == 0 {
+			return nil, status.Error(codes.Unauthenticated, "Неавторизованный доступ")
+		}
+
+		return handler(service.WithAPIKeyID(service.WithUserID(ctx, userID), keyID), req)
+	}
+}
+
+// Инициатор gRPC-вызова для журнала аудита
+func actor(ctx context.Context, telegramID int64) service.Actor {
+	a := service.Actor{UserID: service.UserIDFromContext(ctx), TelegramID: telegramID}
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			a.IP = host
+		}
+	}
+	return a
+}
+
+// Проверка разрешения роли пользователя в организации, аналог проверки разрешений маршрутов REST API
+func authorize(ctx context.Context, svc *service.Service, logger *log.Logger, telegramID int64, requestedOrganizationID int, permission string) error {
+	userID := service.UserIDFromContext(ctx)
+	if userID == 0 && telegramID > 0 {
+		var err error
+		if userID, err = svc.UserIDByTelegram(ctx, telegramID); err != nil {
+			return toStatus(logger, err)
+		}
+	}
+	if userID == 0 {
+		return nil
+	}
+
+	if err := svc.Authorize(ctx, userID, requestedOrganizationID, permission); err != nil {
+		return toStatus(logger, err)
+	}
+	return nil
+}
+
+// Преобразование ошибки сервисного слоя в gRPC-статус
+func toStatus(logger *log.Logger, err error) error {
+	serviceErr := service.AsError(err)
+
+	code := codes.Internal
+	switch serviceErr.Kind {
+	case service.KindInvalid:
+		code = codes.InvalidArgument
+	case service.KindNotFound:
+		code = codes.NotFound
+	case service.KindForbidden:
+		code = codes.PermissionDenied
+	case service.KindConflict, service.KindConfirmationRequired:
+		code = codes.FailedPrecondition
+	case service.KindUnavailable:
+		code = codes.Unavailable
+	case service.KindTooManyRequests, service.KindPaymentRequired:
+		code = codes.ResourceExhausted
+	default:
+		logger.Printf("Ошибка обработки gRPC запроса: %v", err)
+		return status.Error(code, serviceErr.Message)
+	}
+
+	if detail := serviceErr.Detail(); detail != "" {
+		return status.Errorf(code, "%s: %s", serviceErr.Message, detail)
+	}
+	return status.Error(code, serviceErr.Message)
+}
+
+// Преобразование времени в protobuf; нулевое время передается как отсутствующее значение
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// gRPC-сервис заказа КИЗ
+type kizService struct {
+	pb.UnimplementedKIZServiceServer
+	svc    *service.Service
+	logger *log.Logger
+}
+
+func (s *kizService) RequestKIZ(ctx context.Context, req *pb.RequestKIZRequest) (*pb.RequestKIZResponse, error) {
+	if err := authorize(ctx, s.svc, s.logger, req.GetTelegramId(), int(req.GetOrganizationId()), models.PermKIZRequest); err != nil {
+		return nil, err
+	}
+
+	result, err := s.svc.RequestKIZs(ctx, actor(ctx, req.GetTelegramId()), service.KIZRequest{
+		TelegramID:     req.GetTelegramId(),
+		GTINs:          req.GetGtins(),
+		INN:            req.GetInn(),
+		OrderID:        int(req.GetOrderId()),
+		OrganizationID: int(req.GetOrganizationId()),
+	})
+	if err != nil {
+		return nil, toStatus(s.logger, err)
+	}
+
+	return &pb.RequestKIZResponse{
+		RequestId: int32(result.RequestID),
+		Kizs:      result.KIZs,
+		FilePath:  result.FilePath,
+	}, nil
+}
+
+// gRPC-сервис платежей
+type paymentService struct {
+	pb.UnimplementedPaymentServiceServer
+	svc    *service.Service
+	logger *log.Logger
+}
+
+func (s *paymentService) CreatePayment(ctx context.Context, req *pb.CreatePaymentRequest) (*pb.CreatePaymentResponse, error) {
+	if err := authorize(ctx, s.svc, s.logger, req.GetTelegramId(), int(req.GetOrganizationId()), models.PermPaymentsCreate); err != nil {
+		return nil, err
+	}
+
+	result, err := s.svc.CreatePayment(ctx, actor(ctx, req.GetTelegramId()), service.PaymentRequest{
+		TelegramID:     req.GetTelegramId(),
+		Amount:         req.GetAmount(),
+		OrderID:        int(req.GetOrderId()),
+		OrganizationID: int(req.GetOrganizationId()),
+		ReturnURL:      req.GetReturnUrl(),
+	})
+	if err != nil {
+		return nil, toStatus(s.logger, err)
+	}
+
+	return &pb.CreatePaymentResponse{
+		PaymentId:   int32(result.PaymentID),
+		RedirectUrl: result.RedirectURL,
+	}, nil
+}
+
+func (s *paymentService) GetPayment(ctx context.Context, req *pb.GetPaymentRequest) (*pb.Payment, error) {
+	if req.GetId() <= 0 || req.GetTelegramId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "Необходимо указать id платежа и telegram_id")
+	}
+	if err := authorize(ctx, s.svc, s.logger, req.GetTelegramId(), 0, models.PermPaymentsView); err != nil {
+		return nil, err
+	}
+
+	payment, err := s.svc.GetPayment(ctx, int(req.GetId()), req.GetTelegramId())
+	if err != nil {
+		return nil, toStatus(s.logger, err)
+	}
+
+	response := &pb.Payment{
+		Id:            int32(payment.ID),
+		OrderId:       int32(payment.OrderID),
+		Amount:        payment.Amount.Float64(),
+		Status:        payment.Status,
+		TransactionId: payment.TransactionID,
+		Currency:      payment.Currency,
+		CreatedAt:     timestamp(payment.CreatedAt),
+	}
+	if payment.CompletedAt != nil {
+		response.CompletedAt = timestamp(*payment.CompletedAt)
+	}
+
+	return response, nil
+}
+
+// gRPC-сервис пользователей
+type userService struct {
+	pb.UnimplementedUserServiceServer
+	svc    *service.Service
+	logger *log.Logger
+}
+
+func (s *userService) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.User, error) {
+	if req.GetTelegramId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "Необходимо указать telegram_id")
+	}
+
+	user, err := s.svc.GetUser(ctx, req.GetTelegramId())
+	if err != nil {
+		return nil, toStatus(s.logger, err)
+	}
+
+	return &pb.User{
+		Id:               int32(user.ID),
+		TelegramId:       user.TelegramID,
+		Inn:              user.INN,
+		Email:            user.Email,
+		OrganizationName: user.OrganizationName,
+		RegisteredAt:     timestamp(user.RegisteredAt),
+		LastActive:       timestamp(user.LastActive),
+	}, nil
+}
@@ -0,0 +1,327 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/repository"
+	"project-znak/internal/service"
+)
+
+// Обработчик метрик пулов соединений с БД: pool - основной пул, replica - реплика,
+// если она подключена
+func (s *Server) dbStatsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := dto.DBStats{Envelope: dto.OK()}
+		for _, stats := range s.svc.DBStats() {
+			pool := &dto.DBPool{
+				MaxOpenConnections: stats.MaxOpenConnections,
+				OpenConnections:    stats.OpenConnections,
+				InUse:              stats.InUse,
+				Idle:               stats.Idle,
+				WaitCount:          stats.WaitCount,
+				WaitDurationMS:     stats.WaitDuration.Milliseconds(),
+				MaxIdleClosed:      stats.MaxIdleClosed,
+				MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+				MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+			}
+			if stats.Name == "primary" {
+				response.Pool = pool
+				continue
+			}
+			pool.Available = &stats.Available
+			pool.Fallbacks = &stats.Fallbacks
+			response.Replica = pool
+		}
+		sendResponse(w, response, http.StatusOK)
+	}
+}
+
+// Обработчик списка ролей и их разрешений
+func (s *Server) adminRolesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roles, err := s.svc.ListRoles(r.Context())
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Roles{
+			Envelope: dto.OK(),
+			Roles:    roles,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик назначения роли участнику организации администратором:
+// POST /api/admin/organizations/{id}/roles
+func (s *Server) adminAssignRoleHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		organizationID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		var request struct {
+			MemberTelegramID int64  `json:"member_telegram_id"`
+			Role             string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		member, err := s.svc.AssignRole(r.Context(), requestActor(r, 0), organizationID, request.MemberTelegramID, request.Role)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Member{
+			Envelope: dto.OK(),
+			Member:   member,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик просмотра журнала аудита с фильтрацией
+func (s *Server) adminAuditHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		filter := repository.AuditFilter{
+			ActorUserID:    params.Get("actor_user_id"),
+			TelegramID:     params.Get("telegram_id"),
+			Action:         params.Get("action"),
+			EntityType:     params.Get("entity_type"),
+			EntityID:       params.Get("entity_id"),
+			ImpersonatorID: params.Get("impersonator_id"),
+			Limit:          100,
+		}
+
+		for _, bound := range []struct {
+			param string
+			dest  **time.Time
+		}{{"from", &filter.From}, {"to", &filter.To}} {
+			value := params.Get(bound.param)
+			if value == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				sendErrorMessage(w, fmt.Sprintf("Параметр %s должен быть в формате RFC3339", bound.param), http.StatusBadRequest)
+				return
+			}
+			t = t.UTC()
+			*bound.dest = &t
+		}
+
+		if value, err := strconv.Atoi(params.Get("limit")); err == nil && value > 0 && value <= 1000 {
+			filter.Limit = value
+		}
+		if value, err := strconv.Atoi(params.Get("offset")); err == nil && value > 0 {
+			filter.Offset = value
+		}
+
+		entries, err := s.svc.ListAudit(r.Context(), filter)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.AuditEntries{
+			Envelope: dto.OK(),
+			Entries:  entries,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик архива запросов к Честному ЗНАКу и СУЗ:
+// GET /api/admin/exchanges?system=&subject_type=&subject_id=&from=&to=&limit=&offset=
+func (s *Server) adminExchangesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		filter := repository.APIExchangeFilter{
+			System:      params.Get("system"),
+			SubjectType: params.Get("subject_type"),
+			Limit:       20,
+		}
+		if value := params.Get("subject_id"); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil || id <= 0 {
+				sendErrorMessage(w, "Параметр subject_id должен быть положительным числом", http.StatusBadRequest)
+				return
+			}
+			filter.SubjectID = id
+		}
+
+		for _, bound := range []struct {
+			param string
+			dest  **time.Time
+		}{{"from", &filter.From}, {"to", &filter.To}} {
+			value := params.Get(bound.param)
+			if value == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				sendErrorMessage(w, fmt.Sprintf("Параметр %s должен быть в формате RFC3339", bound.param), http.StatusBadRequest)
+				return
+			}
+			t = t.UTC()
+			*bound.dest = &t
+		}
+
+		// Записи содержат тела запросов и ответов, поэтому страница меньше, чем у журнала аудита
+		if value, err := strconv.Atoi(params.Get("limit")); err == nil && value > 0 && value <= 100 {
+			filter.Limit = value
+		}
+		if value, err := strconv.Atoi(params.Get("offset")); err == nil && value > 0 {
+			filter.Offset = value
+		}
+
+		exchanges, err := s.svc.ListAPIExchanges(r.Context(), filter)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.APIExchanges{
+			Envelope:  dto.OK(),
+			Exchanges: exchanges,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик аналитики для администратора: GET /api/admin/analytics?from=&to=&interval=&top=
+func (s *Server) adminAnalyticsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		request := service.AnalyticsRequest{
+			From:     params.Get("from"),
+			To:       params.Get("to"),
+			Interval: params.Get("interval"),
+		}
+		if value := params.Get("top"); value != "" {
+			top, err := strconv.Atoi(value)
+			if err != nil || top <= 0 {
+				sendErrorMessage(w, "Параметр top должен быть положительным числом", http.StatusBadRequest)
+				return
+			}
+			request.Top = top
+		}
+
+		analytics, err := s.svc.Analytics(r.Context(), request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Analytics{
+			Envelope:  dto.OK(),
+			Analytics: analytics,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик блокировок защиты от подбора: GET /api/admin/lockouts - заблокированные адреса,
+// DELETE /api/admin/lockouts?ip= - снятие блокировки
+func (s *Server) adminLockoutsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			lockouts, err := s.svc.AuthLockouts(r.Context())
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.Lockouts{
+				Envelope: dto.OK(),
+				Lockouts: lockouts,
+			}, http.StatusOK)
+
+		case http.MethodDelete:
+			if err := s.svc.Unlock(r.Context(), requestActor(r, 0), r.URL.Query().Get("ip")); err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.Message{Envelope: dto.Done("Блокировка снята")}, http.StatusOK)
+		}
+	}
+}
+
+// Обработчик импорта пользователей: POST /api/admin/users/import. Файл CSV или XLSX
+// передается полем file формы multipart/form-data или телом запроса; partner_telegram_id -
+// партнер, субаккаунтами которого станут организации приглашенных пользователей.
+func (s *Server) adminUserImportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var partnerTelegramID int64
+		if value := r.URL.Query().Get("partner_telegram_id"); value != "" {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				sendErrorMessage(w, "Параметр partner_telegram_id должен быть положительным числом", http.StatusBadRequest)
+				return
+			}
+			partnerTelegramID = id
+		}
+
+		file, err := openUpload(r, spreadsheetUpload)
+		if err != nil {
+			s.sendUploadError(w, err)
+			return
+		}
+		data, err := io.ReadAll(file)
+		r.Body.Close()
+		if err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+
+		results, err := s.svc.ImportUsers(r.Context(), requestActor(r, 0), data, partnerTelegramID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		created := 0
+		for _, result := range results {
+			if result.InvitationID > 0 {
+				created++
+			}
+		}
+		sendResponse(w, dto.UserImport{
+			Envelope: dto.Done(fmt.Sprintf("Создано приглашений: %d из %d", created, len(results))),
+			Users:    results,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик объединения пользователей: POST /api/admin/users/merge
+func (s *Server) adminUserMergeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request service.UserMergeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		result, err := s.svc.MergeUsers(r.Context(), requestActor(r, 0), request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.UserMerge{
+			Envelope:   dto.Done("Пользователи объединены"),
+			UserID:     result.UserID,
+			TelegramID: result.TelegramID,
+			Moved:      result.Moved,
+		}, http.StatusOK)
+	}
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик действующих объявлений для клиентов: GET /api/announcements
+func (s *Server) announcementsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		announcements, err := s.svc.ActiveAnnouncements(r.Context())
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Announcements{
+			Envelope:      dto.OK(),
+			Announcements: announcements,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик объявлений для администратора: GET /api/admin/announcements - последние
+// объявления, POST /api/admin/announcements - создание объявления
+func (s *Server) adminAnnouncementsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			announcements, err := s.svc.ListAnnouncements(r.Context())
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			sendResponse(w, dto.Announcements{
+				Envelope:      dto.OK(),
+				Announcements: announcements,
+			}, http.StatusOK)
+
+		case http.MethodPost:
+			var request service.AnnouncementRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+
+			announcement, err := s.svc.CreateAnnouncement(r.Context(), requestActor(r, 0), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			sendResponse(w, dto.Announcement{
+				Envelope:     dto.Done("Объявление создано"),
+				Announcement: announcement,
+			}, http.StatusCreated)
+		}
+	}
+}
+
+// Обработчик снятия объявления: DELETE /api/admin/announcements/{id}
+func (s *Server) adminAnnouncementHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		announcementID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		announcement, err := s.svc.EndAnnouncement(r.Context(), requestActor(r, 0), announcementID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Announcement{
+			Envelope:     dto.Done("Объявление снято"),
+			Announcement: announcement,
+		}, http.StatusOK)
+	}
+}
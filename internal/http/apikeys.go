@@ -0,0 +1,174 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Список API ключей пользователя: GET /api/keys. Ключами управляет только пользователь,
+// авторизованный по API ключу.
+func (s *Server) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID := requireAuthenticatedUserID(w, r)
+	if userID == 0 {
+		return
+	}
+
+	keys, err := s.svc.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.APIKeys{
+		Envelope: dto.OK(),
+		Keys:     keys,
+	}, http.StatusOK)
+}
+
+// Создание API ключа: POST /api/keys
+func (s *Server) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var request service.APIKeyCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+	if requireAuthenticatedUserID(w, r) == 0 {
+		return
+	}
+
+	key, apiKey, err := s.svc.CreateAPIKey(r.Context(), requestActor(r, 0), request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.APIKey{
+		Envelope: dto.Done("Ключ показывается один раз, сохраните его"),
+		APIKey:   apiKey,
+		Key:      key,
+	}, http.StatusCreated)
+}
+
+// Ротация API ключа: POST /api/keys/{id}/rotate - создание нового ключа с тем же названием.
+// Прежний ключ действует еще overlap (по умолчанию 24 часа), чтобы клиенты успели перейти на новый.
+func (s *Server) rotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	userID := requireAuthenticatedUserID(w, r)
+	if userID == 0 {
+		return
+	}
+
+	overlap := service.DefaultAPIKeyRotationOverlap
+	if value := r.URL.Query().Get("overlap"); value != "" {
+		var err error
+		overlap, err = time.ParseDuration(value)
+		if err != nil {
+			sendErrorMessage(w, fmt.Sprintf("Некорректный период перекрытия, допускается от 0 до %v",
+				service.MaxAPIKeyRotationOverlap), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rotation, err := s.svc.RotateAPIKey(r.Context(), requestActor(r, 0), userID, keyID, overlap)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.APIKey{
+		Envelope:    dto.Done("Ключ показывается один раз, сохраните его"),
+		APIKey:      rotation.APIKey,
+		Key:         rotation.Key,
+		PreviousKey: &rotation.Previous,
+	}, http.StatusCreated)
+}
+
+// Отзыв API ключа: POST /api/keys/{id}/revoke или завершение сеанса DELETE /api/sessions/{id}.
+// Отозванный ключ перестает действовать сразу.
+func (s *Server) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	userID := requireAuthenticatedUserID(w, r)
+	if userID == 0 {
+		return
+	}
+
+	key, err := s.svc.RevokeAPIKey(r.Context(), requestActor(r, 0), userID, keyID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.APIKey{
+		Envelope: dto.Done("Ключ отозван"),
+		Key:      key,
+	}, http.StatusOK)
+}
+
+// Обработчик списка сеансов: GET /api/sessions - действующие API ключи с устройством последнего использования
+func (s *Server) sessionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, keyID := requireSession(w, r)
+		if userID == 0 {
+			return
+		}
+
+		sessions, err := s.svc.ListSessions(r.Context(), userID, keyID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Sessions{
+			Envelope: dto.OK(),
+			Sessions: sessions,
+		}, http.StatusOK)
+	}
+}
+
+// Завершение всех сеансов пользователя, кроме сеанса текущего запроса:
+// POST /api/sessions/revoke-all
+func (s *Server) revokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID, keyID := requireSession(w, r)
+	if userID == 0 {
+		return
+	}
+
+	revoked, err := s.svc.RevokeOtherSessions(r.Context(), requestActor(r, 0), userID, keyID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.SessionsRevoked{
+		Envelope: dto.Done(fmt.Sprintf("Завершено сеансов: %d", revoked)),
+		Revoked:  revoked,
+	}, http.StatusOK)
+}
+
+// Сеанс текущего запроса: пользователь и API ключ, по которому авторизован запрос. Запрос
+// без ключа, в том числе от имени пользователя через администратора, отклоняется с кодом 401.
+// Возвращает нули, если ответ уже отправлен.
+func requireSession(w http.ResponseWriter, r *http.Request) (int, int) {
+	userID := requireAuthenticatedUserID(w, r)
+	if userID == 0 {
+		return 0, 0
+	}
+	keyID := service.APIKeyIDFromContext(r.Context())
+	if keyID == 0 {
+		sendErrorMessage(w, "Необходим API ключ", http.StatusUnauthorized)
+		return 0, 0
+	}
+	return userID, keyID
+}
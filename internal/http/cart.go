@@ -0,0 +1,116 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик корзины: GET - корзина с ценами, PUT - замена позиций, DELETE - очистка
+func (s *Server) cartHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userID := s.requireUserID(w, r, http.StatusUnauthorized)
+			if userID == 0 {
+				return
+			}
+
+			cart, err := s.svc.GetCart(r.Context(), userID)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.Cart{
+				Envelope: dto.OK(),
+				Cart:     cart,
+			}, http.StatusOK)
+		case http.MethodPut:
+			var request service.CartRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+
+			cart, err := s.svc.ReplaceCart(r.Context(), requestActor(r, request.TelegramID), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.Cart{
+				Envelope: dto.OK(),
+				Cart:     cart,
+			}, http.StatusOK)
+		case http.MethodDelete:
+			if err := s.svc.ClearCart(r.Context(), requestActor(r, queryTelegramID(r))); err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.Message{Envelope: dto.Done("Корзина очищена")}, http.StatusOK)
+		}
+	}
+}
+
+// Обработчик добавления кодов в корзину: POST /api/cart/items
+func (s *Server) cartItemsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request service.CartItemRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		cart, err := s.svc.AddCartItem(r.Context(), requestActor(r, request.TelegramID), request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Cart{
+			Envelope: dto.OK(),
+			Cart:     cart,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик удаления позиции корзины: DELETE /api/cart/items/{gtin}
+func (s *Server) cartItemHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cart, err := s.svc.RemoveCartItem(r.Context(), requestActor(r, queryTelegramID(r)), r.PathValue("gtin"))
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Cart{
+			Envelope: dto.OK(),
+			Cart:     cart,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик оформления корзины: POST /api/cart/checkout создает заказ и платеж по нему.
+// Если платеж создать не удалось, заказ возвращается с причиной в message и оплачивается
+// через POST /api/payments/create.
+func (s *Server) cartCheckoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := s.svc.CheckoutCart(r.Context(), requestActor(r, queryTelegramID(r)))
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		response := dto.Checkout{Envelope: dto.Done("Заказ создан"), Order: result.Order}
+		if result.PaymentErr != nil {
+			response.Message = s.serviceError(r, result.PaymentErr).Message
+		} else {
+			response.PaymentID = result.PaymentID
+			response.RedirectURL = result.RedirectURL
+		}
+		sendResponse(w, response, http.StatusCreated)
+	}
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"project-znak/pkg/middleware"
+)
+
+// Адреса и подсети доверенных прокси из TRUSTED_PROXIES. Адрес без маски - подсеть из
+// одного адреса; значения проверены при загрузке конфигурации.
+func parseTrustedProxies(proxies []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(proxy); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return prefixes
+}
+
+// Адрес входит в доверенные прокси
+func trustedProxy(addr netip.Addr, proxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Адрес клиента запроса. X-Forwarded-For учитывается, только если соединение пришло от
+// доверенного прокси: тогда адресом клиента считается самый правый адрес цепочки, не
+// являющийся доверенным прокси. Левые адреса цепочки клиент может подставить сам.
+func resolveClientIP(r *http.Request, proxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	host = peer.Unmap().String()
+	if !trustedProxy(peer, proxies) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// Испорченная цепочка: дальше адресам доверять нельзя
+			break
+		}
+		host = addr.Unmap().String()
+		if !trustedProxy(addr, proxies) {
+			break
+		}
+	}
+	return host
+}
+
+// Определение адреса клиента с учетом доверенных прокси для всех обработчиков запроса
+func clientIPMiddleware(proxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := middleware.WithClientIP(r.Context(), resolveClientIP(r, proxies))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// IP-адрес клиента, определенный clientIPMiddleware; без middleware - адрес соединения.
+// Тот же адрес записывается в журнал доступа.
+func clientIP(r *http.Request) string {
+	return middleware.ClientIP(r)
+}
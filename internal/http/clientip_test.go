@@ -0,0 +1,63 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	got := parseTrustedProxies([]string{"10.1.2.3/8", "192.0.2.10", "::ffff:192.0.2.11", "2001:db8::/32", "proxy.local"})
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.10/32"),
+		netip.MustParsePrefix("192.0.2.11/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("получено %v, ожидалось %v", got, want)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.10"})
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"без прокси", "203.0.113.5:4000", nil, "203.0.113.5"},
+		{"поддельный X-Forwarded-For от клиента", "203.0.113.5:4000", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"доверенный адрес в X-Forwarded-For от клиента", "203.0.113.5:4000", []string{"192.0.2.10"}, "203.0.113.5"},
+		{"доверенный прокси", "10.1.2.3:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"подделка левее доверенного прокси", "10.1.2.3:4000", []string{"192.0.2.10, 198.51.100.1"}, "198.51.100.1"},
+		{"цепочка прокси", "10.1.2.3:4000", []string{"198.51.100.1, 192.0.2.10", "10.0.0.7"}, "198.51.100.1"},
+		{"испорченная цепочка", "10.1.2.3:4000", []string{"198.51.100.1, unknown, 10.0.0.7"}, "10.0.0.7"},
+		{"прокси без X-Forwarded-For", "192.0.2.10:4000", nil, "192.0.2.10"},
+		{"IPv4 в IPv6 без прокси", "[::ffff:203.0.113.5]:4000", nil, "203.0.113.5"},
+		{"доверенный прокси IPv4 в IPv6", "[::ffff:10.1.2.3]:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"клиент IPv4 в IPv6 за прокси", "10.1.2.3:4000", []string{"::ffff:198.51.100.1"}, "198.51.100.1"},
+		{"клиент IPv6 за прокси", "10.1.2.3:4000", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"адрес без порта", "203.0.113.5", nil, "203.0.113.5"},
+	}
+
+	for _, tt := range tests {
+		var got string
+		handler := clientIPMiddleware(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = clientIP(r)
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+		r.RemoteAddr = tt.remote
+		for _, value := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if got != tt.want {
+			t.Errorf("%s: адрес клиента %q, ожидался %q", tt.name, got, tt.want)
+		}
+	}
+}
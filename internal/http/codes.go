@@ -0,0 +1,76 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project-znak/internal/dto"
+)
+
+// Обработчик статуса кода маркировки: GET /api/codes/{cis}/status.
+// Код передается в пути в URL-кодировке: он может содержать символы "/" и "%".
+// ServeMux сопоставляет сегменты пути до декодирования, поэтому закодированный "/" не
+// разделяет сегменты.
+func (s *Server) codeStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := r.PathValue("cis")
+
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		status, err := s.svc.GetCodeStatus(r.Context(), userID, code)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.CodeStatus{
+			Envelope: dto.OK(),
+			Code:     status,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик статуса нескольких кодов маркировки: POST /api/codes/status
+func (s *Server) codeStatusesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Codes []string `json:"codes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		statuses, err := s.svc.CodeStatuses(r.Context(), userID, request.Codes)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		found := make(map[string]bool, len(statuses))
+		for _, status := range statuses {
+			found[status.CIS] = true
+		}
+		missing := []string{}
+		for _, code := range request.Codes {
+			if !found[code] {
+				missing = append(missing, code)
+			}
+		}
+
+		sendResponse(w, dto.CodeStatuses{
+			Envelope: dto.OK(),
+			Codes:    statuses,
+			Missing:  missing,
+		}, http.StatusOK)
+	}
+}
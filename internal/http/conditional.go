@@ -0,0 +1,98 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/i18n"
+)
+
+// Условные запросы (RFC 9110): ответ о статусе запроса КИЗ и файлы с кодами передаются
+// с валидатором ETag - хешем тела ответа, статус также с Last-Modified. Клиент, который
+// опрашивает статус или повторно скачивает файл, передает If-None-Match или
+// If-Modified-Since и получает 304 без тела, если ответ не изменился.
+
+// Отправка ответа API с валидаторами ETag и Last-Modified (modified; нулевое время - без
+// Last-Modified). Хеш считается по телу ответа на языке и в формате клиента.
+func sendConditionalResponse(w http.ResponseWriter, r *http.Request, response dto.Response, modified time.Time) {
+	sendContent(w, r, encodeResponse(w, response), modified)
+}
+
+// Тело ответа API на языке и в формате клиента; задает Content-Type ответа
+func encodeResponse(w http.ResponseWriter, response dto.Response) []byte {
+	if lang := responseLanguage(w); lang != i18n.Default {
+		response = localizeResponse(lang, response)
+	}
+	var body bytes.Buffer
+	if responseFormat(w) == formatXML {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		dto.EncodeXML(&body, response)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(&body).Encode(response)
+	}
+	return body.Bytes()
+}
+
+// Отправка тела data с валидаторами ETag и Last-Modified или ответа 304, если валидаторы
+// клиента совпадают. Content-Type задается вызывающим.
+func sendContent(w http.ResponseWriter, r *http.Request, data []byte, modified time.Time) {
+	etag := contentETag(data)
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, etag, modified) {
+		w.Header().Del("Content-Type")
+		w.Header().Del("Content-Disposition")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// Сильный валидатор по содержимому: первые 16 байт SHA-256 в шестнадцатеричном виде
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Проверка условий запроса GET: If-None-Match сравнивается с etag слабым сравнением
+// (сжатый ответ передается со слабым валидатором W/"..."), If-Modified-Since учитывается,
+// только если If-None-Match не передан
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return matchETag(header, etag)
+	}
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// Совпадение etag со значением заголовка If-None-Match: список валидаторов или "*"
+func matchETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Подтверждение, с которым клиент повторяет операцию, из заголовков X-Confirmation-ID
+// и X-Confirmation-Code
+func confirmationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get("X-Confirmation-ID")
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			sendErrorMessage(w, "Некорректный ID подтверждения", http.StatusBadRequest)
+			return
+		}
+
+		token := service.ConfirmationToken{ID: id, Code: r.Header.Get("X-Confirmation-Code")}
+		next.ServeHTTP(w, r.WithContext(service.WithConfirmation(r.Context(), token)))
+	})
+}
+
+// Статус подтверждения операции: GET /api/confirmations/{id}
+func (s *Server) getConfirmation(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	confirmation, err := s.svc.Confirmation(r.Context(), userID, id)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Confirmation{
+		Envelope:     dto.OK(),
+		Confirmation: confirmation,
+	}, http.StatusOK)
+}
+
+// Подтверждение или отклонение операции кодом из Telegram: POST /api/confirmations/{id}/approve
+// и POST /api/confirmations/{id}/reject
+func (s *Server) confirmationDecisionHandler(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		s.approveConfirmation(w, r, id, approve)
+	}
+}
+
+func (s *Server) approveConfirmation(w http.ResponseWriter, r *http.Request, id int, approve bool) {
+	var request service.ConfirmationCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	confirmation, err := s.svc.ApproveConfirmation(r.Context(), requestActor(r, request.TelegramID), id, request, approve)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	message := "Операция подтверждена, повторите запрос"
+	if !approve {
+		message = "Операция отклонена"
+	}
+	sendResponse(w, dto.Confirmation{
+		Envelope:     dto.Done(message),
+		Confirmation: confirmation,
+	}, http.StatusOK)
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/repository"
+	"project-znak/internal/service"
+)
+
+// Создание черновика документа ввода в оборот по кодам заказа
+func (s *Server) createDocument(w http.ResponseWriter, r *http.Request) {
+	var request service.IntroductionDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	doc, err := s.svc.CreateIntroductionDocument(r.Context(), requestActor(r, request.TelegramID), request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.IntroductionDocument{
+		Envelope: dto.OK(),
+		Document: doc,
+	}, http.StatusCreated)
+}
+
+// Список документов ввода в оборот пользователя
+func (s *Server) listDocuments(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	limit := 10 // По умолчанию 10 записей
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		if _, err := fmt.Sscanf(limitParam, "%d", &limit); err != nil || limit <= 0 {
+			limit = 10
+		}
+	}
+
+	var orderID int
+	if orderParam := r.URL.Query().Get("order_id"); orderParam != "" {
+		var err error
+		orderID, err = strconv.Atoi(orderParam)
+		if err != nil {
+			sendErrorMessage(w, "Некорректный ID заказа", http.StatusBadRequest)
+			return
+		}
+	}
+
+	docs, err := s.svc.ListIntroductionDocuments(r.Context(), userID, orderID, limit)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.IntroductionDocuments{
+		Envelope:  dto.OK(),
+		Documents: docs,
+	}, http.StatusOK)
+}
+
+// Получение документа с актуальным статусом обработки
+func (s *Server) getDocument(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	doc, err := s.svc.GetIntroductionDocument(r.Context(), userID, documentID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.IntroductionDocument{
+		Envelope: dto.OK(),
+		Document: doc,
+	}, http.StatusOK)
+}
+
+// Подписание и отправка документа в Честный ЗНАК
+func (s *Server) submitDocument(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	doc, err := s.svc.SubmitIntroductionDocument(r.Context(), requestActor(r, queryTelegramID(r)), userID, documentID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.IntroductionDocument{
+		Envelope: dto.Done("Документ отправлен в Честный ЗНАК"),
+		Document: doc,
+	}, http.StatusOK)
+}
+
+// Выгрузка квитанции о вводе в оборот: подписанной квитанции Честного ЗНАКа
+// или, с параметром format=pdf, PDF-квитанции сервиса
+func (s *Server) documentReceipt(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "":
+		receipt, err := s.svc.SignedIntroductionReceipt(r.Context(), userID, documentID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+		sendSignedReceipt(w, receipt)
+		return
+	case "pdf":
+	default:
+		sendErrorMessage(w, "Параметр format может принимать только значение pdf", http.StatusBadRequest)
+		return
+	}
+
+	receipt, err := s.svc.IntroductionDocumentReceipt(r.Context(), userID, documentID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="receipt_%d.pdf"`, documentID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(receipt)))
+	w.Write(receipt)
+}
+
+// Выгрузка подписанной квитанции Честного ЗНАКа в исходном виде. Идентификатор квитанции
+// и хэш SHA-256 содержимого передаются в заголовках для сверки.
+func sendSignedReceipt(w http.ResponseWriter, receipt *repository.DocumentReceipt) {
+	extension := ".bin"
+	switch mediaType, _, _ := mime.ParseMediaType(receipt.ContentType); {
+	case strings.HasSuffix(mediaType, "xml"):
+		extension = ".xml"
+	case strings.HasSuffix(mediaType, "json"):
+		extension = ".json"
+	case mediaType == "application/pdf":
+		extension = ".pdf"
+	case mediaType == "application/pkcs7-signature":
+		extension = ".p7s"
+	}
+
+	w.Header().Set("Content-Type", receipt.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="ticket_%s_%d%s"`,
+		receipt.DocumentType, receipt.DocumentID, extension))
+	w.Header().Set("Content-Length", strconv.Itoa(len(receipt.Content)))
+	w.Header().Set("X-Receipt-Ticket", receipt.Ticket)
+	w.Header().Set("X-Receipt-SHA256", receipt.SHA256)
+	w.Write(receipt.Content)
+}
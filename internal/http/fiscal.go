@@ -0,0 +1,73 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+)
+
+// Обработчик кассового чека по платежу: GET /api/payments/{id}/receipt
+func (s *Server) paymentReceiptHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paymentID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		receipt, err := s.svc.PaymentReceipt(r.Context(), userID, paymentID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Receipt{
+			Envelope: dto.OK(),
+			Receipt:  receipt,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик списка кассовых чеков для администратора
+func (s *Server) adminFiscalReceiptsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= 1000 {
+			limit = value
+		}
+
+		receipts, err := s.svc.ListFiscalReceipts(r.Context(), r.URL.Query().Get("status"), limit)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Receipts{
+			Envelope: dto.OK(),
+			Receipts: receipts,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик повторной фискализации платежа администратором:
+// POST /api/admin/payments/{id}/receipt/retry
+func (s *Server) adminFiscalRetryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paymentID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		if err := s.svc.RetryFiscalReceipt(r.Context(), requestActor(r, 0), paymentID); err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Message{Envelope: dto.Done("Чек поставлен в очередь на регистрацию")}, http.StatusOK)
+	}
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик сеансов имперсонации: GET /api/admin/impersonations - последние сеансы,
+// POST /api/admin/impersonations - выдача токена для вызова API от имени пользователя
+func (s *Server) adminImpersonationsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			impersonations, err := s.svc.ListImpersonations(r.Context())
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			sendResponse(w, dto.Impersonations{
+				Envelope:       dto.OK(),
+				Impersonations: impersonations,
+			}, http.StatusOK)
+
+		case http.MethodPost:
+			var request service.ImpersonationRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+
+			impersonation, token, err := s.svc.StartImpersonation(r.Context(), requestActor(r, 0), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			// Токен возвращается только при создании, в БД хранится его хэш
+			sendResponse(w, dto.Impersonation{
+				Envelope:      dto.Done("Сеанс имперсонации начат"),
+				Token:         token,
+				Impersonation: impersonation,
+			}, http.StatusCreated)
+		}
+	}
+}
+
+// Обработчик досрочного завершения сеанса имперсонации: DELETE /api/admin/impersonations/{id}
+func (s *Server) adminImpersonationHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		impersonationID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		impersonation, err := s.svc.StopImpersonation(r.Context(), requestActor(r, 0), impersonationID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Impersonation{
+			Envelope:      dto.Done("Сеанс имперсонации завершен"),
+			Impersonation: impersonation,
+		}, http.StatusOK)
+	}
+}
@@ -0,0 +1,145 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик остатков кодов: GET /api/inventory?organization_id=
+func (s *Server) inventoryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		// Остаток организации доступен всем ее участникам, без организации - личный остаток
+		var organizationID int
+		if organizationParam := r.URL.Query().Get("organization_id"); organizationParam != "" {
+			var err error
+			organizationID, err = strconv.Atoi(organizationParam)
+			if err != nil {
+				sendErrorMessage(w, "Некорректный ID организации", http.StatusBadRequest)
+				return
+			}
+		}
+
+		items, err := s.svc.Inventory(r.Context(), userID, organizationID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Inventory{
+			Envelope: dto.OK(),
+			Items:    items,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик создания резерва: POST /api/inventory/reservations
+func (s *Server) reservationsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request service.ReservationRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		reservation, err := s.svc.CreateReservation(r.Context(), requestActor(r, request.TelegramID), request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Reservation{
+			Envelope:    dto.Done("Коды зарезервированы"),
+			Reservation: reservation,
+		}, http.StatusCreated)
+	}
+}
+
+// Обработчик резерва: GET /api/inventory/reservations/{id}
+func (s *Server) reservationHandler() http.HandlerFunc {
+	return withPathID(func(w http.ResponseWriter, r *http.Request, reservationID int) {
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		reservation, err := s.svc.GetReservation(r.Context(), userID, reservationID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Reservation{
+			Envelope:    dto.OK(),
+			Reservation: reservation,
+		}, http.StatusOK)
+	})
+}
+
+// Обработчик снятия резерва: POST /api/inventory/reservations/{id}/release
+func (s *Server) reservationReleaseHandler() http.HandlerFunc {
+	return withPathID(func(w http.ResponseWriter, r *http.Request, reservationID int) {
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		reservation, err := s.svc.ReleaseReservation(r.Context(), requestActor(r, queryTelegramID(r)), userID, reservationID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Reservation{
+			Envelope:    dto.OK(),
+			Reservation: reservation,
+		}, http.StatusOK)
+	})
+}
+
+// Обработчик отметки кодов использованными или испорченными: POST /api/inventory/codes
+func (s *Server) inventoryCodesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request service.MarkCodesRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		marked, err := s.svc.MarkCodes(r.Context(), requestActor(r, request.TelegramID), request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.KIZCodes{
+			Envelope: dto.OK(),
+			Codes:    marked,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик повтора последнего запроса кодов GTIN: POST /api/inventory/reorder
+func (s *Server) reorderHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request service.ReorderRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		result, err := s.svc.ReorderKIZs(r.Context(), requestActor(r, request.TelegramID), request)
+		s.sendKIZResult(w, r, result, err)
+	}
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Выставление счета на оплату заказа банковским переводом
+func (s *Server) issueInvoice(w http.ResponseWriter, r *http.Request, orderID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	invoice, err := s.svc.IssueInvoice(r.Context(), requestActor(r, 0), orderID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Invoice{
+		Envelope: dto.OK(),
+		Invoice:  invoice,
+	}, http.StatusOK)
+}
+
+// Выгрузка PDF счета на оплату заказа
+func (s *Server) invoicePDF(w http.ResponseWriter, r *http.Request, orderID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	invoice, data, err := s.svc.InvoicePDF(r.Context(), userID, orderID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="invoice_%s.pdf"`, invoice.Number))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// Обработчик списка счетов для администратора
+func (s *Server) adminInvoicesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= 1000 {
+			limit = value
+		}
+
+		invoices, err := s.svc.ListInvoices(r.Context(), r.URL.Query().Get("status"), limit)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Invoices{
+			Envelope: dto.OK(),
+			Invoices: invoices,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик подтверждения оплаты счета администратором: POST /api/admin/invoices/{id}/paid
+func (s *Server) adminInvoicePaidHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoiceID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		var request service.InvoicePaidRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		invoice, err := s.svc.MarkInvoicePaid(r.Context(), requestActor(r, 0), invoiceID, request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Invoice{
+			Envelope: dto.OK(),
+			Invoice:  invoice,
+		}, http.StatusOK)
+	}
+}
@@ -0,0 +1,704 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/i18n"
+	"project-znak/internal/labels"
+	"project-znak/internal/service"
+	"project-znak/pkg/middleware"
+)
+
+// Обработчик запросов КИЗ. Параметры передаются JSON или формой multipart/form-data
+// с файлом CSV списка GTIN в поле file.
+func (s *Server) kizHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Проверка метода
+		var request service.KIZRequest
+		if isMultipart(r) {
+			var err error
+			if request, err = decodeKIZUpload(r); err != nil {
+				s.sendKIZUploadError(w, err)
+				return
+			}
+		} else if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.logger.Printf("Ошибка декодирования JSON: %v", err)
+			sendResponse(w, dto.KIZ{
+				Envelope: dto.Fail("Неверный формат запроса"),
+				Detail:   err.Error(),
+			}, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		result, err := s.svc.RequestKIZs(r.Context(), requestActor(r, request.TelegramID), request)
+		s.sendKIZResult(w, r, result, err)
+	}
+}
+
+// Обработчик заказа кодов по файлу со списком GTIN: POST /api/kizs/upload. Файл CSV или XLSX
+// передается полем file формы, телом запроса или параметром file_id - документом, который
+// пользователь отправил боту. Без preview_id файл проверяется и рассчитывается стоимость
+// заказа, с preview_id из ответа проверки создается заказ.
+func (s *Server) kizUploadHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request service.OrderUploadRequest
+		var data []byte
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			r.Body.Close()
+		} else {
+			file, err := openUpload(r, spreadsheetUpload)
+			if err != nil {
+				s.sendUploadError(w, err)
+				return
+			}
+			if data, err = io.ReadAll(file); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			r.Body.Close()
+			if request, err = orderUploadRequest(r, file.Fields); err != nil {
+				s.sendUploadError(w, err)
+				return
+			}
+		}
+
+		actor := requestActor(r, request.TelegramID)
+		if request.PreviewID != "" {
+			order, err := s.svc.ConfirmOrderUpload(r.Context(), actor, request, data)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.Order{
+				Envelope: dto.OK(),
+				Order:    order,
+			}, http.StatusCreated)
+			return
+		}
+
+		preview, err := s.svc.PreviewOrderUpload(r.Context(), actor, request, data)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+		message := fmt.Sprintf("Кодов: %d на сумму %.2f ₽", preview.TotalCodes, preview.TotalAmount)
+		if len(preview.Errors) > 0 {
+			message = fmt.Sprintf("Ошибок в файле: %d", len(preview.Errors))
+		}
+		sendResponse(w, dto.OrderPreview{
+			Envelope: dto.Done(message),
+			Preview:  preview,
+		}, http.StatusOK)
+	}
+}
+
+// Параметры заказа по файлу из полей формы или параметров запроса
+func orderUploadRequest(r *http.Request, fields map[string]string) (service.OrderUploadRequest, error) {
+	value := func(name string) string {
+		if value, ok := fields[name]; ok {
+			return strings.TrimSpace(value)
+		}
+		return r.URL.Query().Get(name)
+	}
+	request := service.OrderUploadRequest{
+		ProductGroup: value("product_group"),
+		FileID:       value("file_id"),
+		PreviewID:    value("preview_id"),
+	}
+	var err error
+	if id := value("telegram_id"); id != "" {
+		if request.TelegramID, err = strconv.ParseInt(id, 10, 64); err != nil {
+			return request, &uploadError{http.StatusBadRequest, "Некорректное значение поля telegram_id"}
+		}
+	}
+	if id := value("organization_id"); id != "" {
+		if request.OrganizationID, err = strconv.Atoi(id); err != nil {
+			return request, &uploadError{http.StatusBadRequest, "Некорректное значение поля organization_id"}
+		}
+	}
+	return request, nil
+}
+
+// Чтение запроса КИЗ из формы: поля запроса передаются перед файлом GTIN, поле
+// label_fields - через запятую
+func decodeKIZUpload(r *http.Request) (service.KIZRequest, error) {
+	file, err := openUpload(r, csvUpload)
+	if err != nil {
+		return service.KIZRequest{}, err
+	}
+	defer r.Body.Close()
+
+	fields := file.Fields
+	request := service.KIZRequest{
+		INN:           fields["inn"],
+		ProductGroup:  fields["product_group"],
+		LabelTemplate: fields["label_template"],
+		Batch:         fields["batch"],
+		LabelDate:     fields["label_date"],
+	}
+	if value := strings.TrimSpace(fields["label_fields"]); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			request.LabelFields = append(request.LabelFields, strings.TrimSpace(field))
+		}
+	}
+	if value := fields["telegram_id"]; value != "" {
+		if request.TelegramID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return request, &uploadError{http.StatusBadRequest, "Некорректное значение поля telegram_id"}
+		}
+	}
+	for name, target := range map[string]*int{"order_id": &request.OrderID, "organization_id": &request.OrganizationID} {
+		if value := fields[name]; value != "" {
+			if *target, err = strconv.Atoi(value); err != nil {
+				return request, &uploadError{http.StatusBadRequest, fmt.Sprintf("Некорректное значение поля %s", name)}
+			}
+		}
+	}
+
+	request.GTINs, err = readGTINs(file)
+	return request, err
+}
+
+// Ответ с ошибкой загрузки файла GTIN в формате ответа на запрос КИЗ
+func (s *Server) sendKIZUploadError(w http.ResponseWriter, err error) {
+	var uploadErr *uploadError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &uploadErr):
+		sendResponse(w, dto.KIZ{Envelope: dto.Fail(uploadErr.message)}, uploadErr.status)
+	case errors.As(err, &tooLarge):
+		sendResponse(w, dto.KIZ{Envelope: dto.Fail(middleware.TooLargeMessage(tooLarge.Limit))},
+			http.StatusRequestEntityTooLarge)
+	default:
+		s.logger.Printf("Ошибка чтения файла GTIN: %v", err)
+		sendResponse(w, dto.KIZ{Envelope: dto.Fail("Неверный формат запроса"), Detail: err.Error()},
+			http.StatusBadRequest)
+	}
+}
+
+// Ответ с результатом запроса КИЗ. При ошибке возвращается номер сохраненного запроса,
+// по которому его можно повторить.
+func (s *Server) sendKIZResult(w http.ResponseWriter, r *http.Request, result *service.KIZResult, err error) {
+	if err != nil {
+		serviceErr := s.serviceError(r, err)
+		response := dto.KIZ{
+			Envelope: dto.Fail(serviceErr.Message),
+			Detail:   serviceErr.Detail(),
+			Code:     serviceErr.Code,
+			Errors:   serviceErr.Fields,
+			Quota:    serviceErr.Quota,
+		}
+		if result != nil {
+			response.RequestID = result.RequestID
+		}
+		sendResponse(w, response, httpStatus(serviceErr.Kind))
+		return
+	}
+
+	sendResponse(w, dto.KIZ{
+		Envelope:  dto.Done("КИЗы успешно сгенерированы"),
+		RequestID: result.RequestID,
+		KIZs:      result.KIZs,
+		FilePath:  result.FilePath,
+	}, http.StatusOK)
+}
+
+// Обработчик проверки выдачи кодов: GET /api/kizs/codes?code=...&code=...
+func (s *Server) kizCodesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		codes := r.URL.Query()["code"]
+		issued, err := s.svc.LookupKIZCodes(r.Context(), userID, codes)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		found := make(map[string]bool, len(issued))
+		for _, code := range issued {
+			found[code.Code] = true
+		}
+		missing := []string{}
+		for _, code := range codes {
+			if !found[code] {
+				missing = append(missing, code)
+			}
+		}
+
+		sendResponse(w, dto.KIZCodeLookup{
+			Envelope: dto.OK(),
+			Codes:    issued,
+			Missing:  missing,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик повтора запроса КИЗ с ошибкой: POST /api/requests/{id}/retry
+func (s *Server) requestRetryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		result, err := s.svc.RetryKIZRequest(r.Context(), requestActor(r, queryTelegramID(r)), userID, requestID, false)
+		s.sendKIZResult(w, r, result, err)
+	}
+}
+
+// Обработчик списка запросов КИЗ с ошибкой для администратора: GET /api/admin/requests?status=
+func (s *Server) adminFailedRequestsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= 1000 {
+			limit = value
+		}
+
+		requests, err := s.svc.ListFailedKIZRequests(r.Context(), r.URL.Query().Get("status"), limit)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.KIZRequests{
+			Envelope: dto.OK(),
+			Requests: requests,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик повтора запроса КИЗ администратором, в том числе отклоненного:
+// POST /api/admin/requests/{id}/retry
+func (s *Server) adminRequestRetryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		result, err := s.svc.RetryKIZRequest(r.Context(), requestActor(r, 0), 0, requestID, true)
+		s.sendKIZResult(w, r, result, err)
+	}
+}
+
+// Обработчик для истории запросов
+func (s *Server) requestsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		telegramIDStr := r.URL.Query().Get("telegram_id")
+		if telegramIDStr == "" {
+			sendErrorMessage(w, "Необходимо указать telegram_id", http.StatusBadRequest)
+			return
+		}
+
+		telegramID, err := strconv.ParseInt(telegramIDStr, 10, 64)
+		if err != nil {
+			sendErrorMessage(w, "Некорректный telegram_id", http.StatusBadRequest)
+			return
+		}
+
+		limit := 10 // По умолчанию 10 записей
+		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+			if _, err := fmt.Sscanf(limitParam, "%d", &limit); err != nil {
+				limit = 10
+			}
+		}
+
+		requests, err := s.svc.ListKIZRequests(r.Context(), telegramID, limit)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.KIZRequests{
+			Envelope: dto.OK(),
+			Requests: requests,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик статуса запроса: GET /api/requests/{id} или GET /api/requests/status?id=.
+// Доступен только запрос пользователя или его организации, чужой запрос не найден (404).
+func (s *Server) requestStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// ID передается в пути (/api/requests/{id}) или параметром (/api/requests/status?id=)
+		requestIDStr := r.PathValue("id")
+		if requestIDStr == "" {
+			requestIDStr = r.URL.Query().Get("id")
+		}
+		if requestIDStr == "" {
+			sendErrorMessage(w, "Необходимо указать id запроса", http.StatusBadRequest)
+			return
+		}
+
+		requestID, err := strconv.Atoi(requestIDStr)
+		if err != nil {
+			sendErrorMessage(w, "Некорректный id запроса", http.StatusBadRequest)
+			return
+		}
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		if r.URL.Query().Get("format") != "" {
+			s.kizLabels(w, r, userID, requestID)
+			return
+		}
+
+		req, err := s.svc.GetKIZRequest(r.Context(), userID, requestID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		progress := s.svc.StatusOfKIZRequest(req)
+		response := dto.KIZRequestStatus{
+			Envelope:          dto.Done(progress.ProgressMessage),
+			RequestID:         req.ID,
+			TelegramID:        req.TelegramID,
+			INN:               req.INN,
+			RequestTime:       req.RequestTime,
+			StatusCode:        req.Status,
+			CodesRequested:    progress.CodesRequested,
+			CodesEmitted:      progress.CodesEmitted,
+			CodesDownloaded:   progress.CodesReceived,
+			FilesGenerated:    progress.FilesGenerated,
+			Progress:          progress.Progress,
+			RequestData:       req.RequestData,
+			FilePath:          req.FilePath,
+			KIZData:           req.KIZData,
+			TelegramMessageID: req.TelegramMessageID,
+		}
+		if req.Error != "" {
+			response.Error = req.Error
+			response.Attempts = req.Attempts
+			response.ErrorPayload = req.ErrorPayload
+		}
+
+		// Клиенты опрашивают статус: неизменившийся ответ передается без тела (304)
+		sendConditionalResponse(w, r, response, req.UpdatedAt)
+	}
+}
+
+// Обработчик статуса нескольких запросов КИЗ: POST /api/requests/status/batch.
+// Возвращает статусы, долю полученных кодов и доступность файла до 100 запросов пользователя.
+func (s *Server) requestStatusBatchHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			IDs []int `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		statuses, err := s.svc.KIZRequestStatuses(r.Context(), userID, request.IDs)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		lang := responseLanguage(w)
+		found := make(map[int]bool, len(statuses))
+		for i, status := range statuses {
+			found[status.RequestID] = true
+			statuses[i].ProgressMessage = i18n.Translate(lang, status.ProgressMessage)
+		}
+		missing := []int{}
+		for _, id := range request.IDs {
+			if !found[id] {
+				found[id] = true
+				missing = append(missing, id)
+			}
+		}
+
+		sendResponse(w, dto.KIZRequestStatuses{
+			Envelope: dto.OK(),
+			Requests: statuses,
+			Missing:  missing,
+		}, http.StatusOK)
+	}
+}
+
+// Интервал проверки хода выполнения запроса КИЗ в потоке событий
+const requestEventsInterval = time.Second
+
+// Наибольшая длительность потока событий; после нее клиент переподключается
+const requestEventsMaxDuration = 10 * time.Minute
+
+// Обработчик потока событий хода выполнения запроса КИЗ (Server-Sent Events):
+// GET /api/requests/events?id=. Доступен только запрос пользователя или его организации.
+// Событие progress отправляется при каждом изменении хода выполнения, событие done - после
+// завершения запроса, после чего поток закрывается.
+func (s *Server) requestEventsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil || requestID <= 0 {
+			sendErrorMessage(w, "Некорректный id запроса", http.StatusBadRequest)
+			return
+		}
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		status, err := s.svc.KIZRequestProgress(r.Context(), userID, requestID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		// Поток не ограничен таймаутом записи сервера
+		controller := http.NewResponseController(w)
+		controller.SetWriteDeadline(time.Time{})
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		lang := responseLanguage(w)
+		send := func(event string, data any) bool {
+			payload, _ := json.Marshal(data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+			return controller.Flush() == nil
+		}
+
+		ticker := time.NewTicker(requestEventsInterval)
+		defer ticker.Stop()
+		deadline := time.After(requestEventsMaxDuration)
+		var last *service.KIZRequestStatus
+		for {
+			if last == nil || status.ChangedFrom(*last) {
+				event := "progress"
+				if status.Done() {
+					event = "done"
+				}
+				localized := *status
+				localized.ProgressMessage = i18n.Translate(lang, status.ProgressMessage)
+				if !send(event, localized) {
+					return
+				}
+				last = status
+			}
+			if status.Done() {
+				return
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-deadline:
+				return
+			case <-ticker.C:
+			}
+			if status, err = s.svc.KIZRequestProgress(r.Context(), userID, requestID); err != nil {
+				send("error", map[string]string{"message": i18n.Translate(lang, service.AsError(err).Message)})
+				return
+			}
+		}
+	}
+}
+
+// Наибольшее время ожидания изменения статуса запроса КИЗ
+const requestStatusMaxWait = time.Minute
+
+// Запас времени записи ответа после ожидания изменения статуса
+const requestStatusWriteMargin = 10 * time.Second
+
+// Обработчик ожидания изменения статуса запроса КИЗ (long polling) для клиентов без
+// Server-Sent Events: GET /api/requests/{id}/status?wait=30s. Запрос другого пользователя
+// не найден (404). Ответ отправляется при изменении статуса или хода выполнения либо по
+// истечении wait (не более минуты); без wait - сразу.
+// Известное клиенту состояние задается ETag предыдущего ответа в If-None-Match: если
+// состояние уже изменилось, ответ отправляется сразу, если не изменилось за время ожидания -
+// ответ 304.
+func (s *Server) requestStatusWaitHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || requestID <= 0 {
+			sendErrorMessage(w, "Некорректный id запроса", http.StatusBadRequest)
+			return
+		}
+		var wait time.Duration
+		if value := r.URL.Query().Get("wait"); value != "" {
+			// Длительность (30s) или число секунд
+			wait, err = time.ParseDuration(value)
+			if seconds, atoiErr := strconv.Atoi(value); atoiErr == nil {
+				wait, err = time.Duration(seconds)*time.Second, nil
+			}
+			if err != nil || wait < 0 {
+				sendErrorMessage(w, "Некорректное время ожидания", http.StatusBadRequest)
+				return
+			}
+			wait = min(wait, requestStatusMaxWait)
+		}
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		status, err := s.svc.KIZRequestProgress(r.Context(), userID, requestID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+		lang := responseLanguage(w)
+		body := encodeResponse(w, requestProgressResponse(lang, status))
+
+		known := r.Header.Get("If-None-Match")
+		if wait > 0 && !status.Done() && (known == "" || matchETag(known, contentETag(body))) {
+			// Ответ передается после ожидания: таймаут записи сервера продлевается на время ожидания
+			http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + requestStatusWriteMargin))
+			if status, err = s.svc.WaitKIZRequestProgress(r.Context(), userID, requestID, *status, wait); err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			body = encodeResponse(w, requestProgressResponse(lang, status))
+		}
+		sendContent(w, r, body, time.Time{})
+	}
+}
+
+// Ответ о ходе выполнения запроса КИЗ с описанием на языке lang
+func requestProgressResponse(lang i18n.Language, status *service.KIZRequestStatus) dto.KIZRequestProgress {
+	localized := *status
+	localized.ProgressMessage = i18n.Translate(lang, status.ProgressMessage)
+	return dto.KIZRequestProgress{
+		Envelope: dto.Done(status.ProgressMessage),
+		Request:  &localized,
+	}
+}
+
+// Обработчик скачивания PDF с кодами по подписанной ссылке. Доступен без авторизации:
+// ссылка отправляется пользователю в Telegram, если файл не удалось доставить.
+func (s *Server) kizDownloadHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		requestID, err := strconv.Atoi(query.Get("id"))
+		if err != nil {
+			sendErrorMessage(w, "Некорректный id запроса", http.StatusBadRequest)
+			return
+		}
+		expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+		if err != nil {
+			sendErrorMessage(w, "Некорректная ссылка", http.StatusBadRequest)
+			return
+		}
+
+		data, err := s.svc.DownloadKIZFile(r.Context(), requestID, expires, query.Get("signature"))
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="kizs_%d.pdf"`, requestID))
+		sendContent(w, r, data, time.Time{})
+	}
+}
+
+// Типы содержимого выгружаемых этикеток
+var labelContentTypes = map[string]string{
+	labels.FormatPDF: "application/pdf",
+	labels.FormatZPL: "application/x-zpl",
+	labels.FormatEPL: "application/x-epl",
+}
+
+// Выгрузка этикеток с кодами запроса в формате pdf, zpl или epl. Шаблон, поля и параметры
+// печати (width, height в мм, dpi, darkness, speed) передаются в параметрах запроса.
+func (s *Server) kizLabels(w http.ResponseWriter, r *http.Request, userID, requestID int) {
+	query := r.URL.Query()
+	request := service.KIZLabelsRequest{
+		UserID:    userID,
+		RequestID: requestID,
+		Format:    query.Get("format"),
+		Template:  query.Get("template"),
+	}
+	if fields := query.Get("fields"); fields != "" {
+		request.Fields = strings.Split(fields, ",")
+	}
+
+	printer, err := parsePrinter(query)
+	if err != nil {
+		sendErrorMessage(w, "Некорректные параметры печати", http.StatusBadRequest)
+		return
+	}
+	request.Printer = printer
+
+	data, err := s.svc.KIZLabels(r.Context(), request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", labelContentTypes[request.Format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="kizs_%d.%s"`, requestID, request.Format))
+	// Файл формируется заново при каждом запросе и зависит от настроек этикеток, поэтому
+	// передается только с ETag по содержимому, без Last-Modified
+	sendContent(w, r, data, time.Time{})
+}
+
+// Разбор параметров печати; незаданные параметры остаются нулевыми
+func parsePrinter(query url.Values) (labels.Printer, error) {
+	var printer labels.Printer
+	var err error
+	if printer.Width, err = parseOptionalFloat(query.Get("width")); err != nil {
+		return printer, err
+	}
+	if printer.Height, err = parseOptionalFloat(query.Get("height")); err != nil {
+		return printer, err
+	}
+	if printer.DPI, err = parseOptionalInt(query.Get("dpi")); err != nil {
+		return printer, err
+	}
+	if printer.Darkness, err = parseOptionalInt(query.Get("darkness")); err != nil {
+		return printer, err
+	}
+	printer.Speed, err = parseOptionalInt(query.Get("speed"))
+	return printer, err
+}
+
+// Разбор необязательного целого параметра; пустое значение - ноль
+func parseOptionalInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// Разбор необязательного дробного параметра; пустое значение - ноль
+func parseOptionalFloat(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик списка шаблонов этикеток
+func (s *Server) labelTemplatesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendResponse(w, dto.LabelTemplates{
+			Envelope:  dto.OK(),
+			Templates: s.svc.ListLabelTemplates(),
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик шаблона этикеток пользователя
+func (s *Server) labelSettingsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.getLabelSettings(w, r)
+		case http.MethodPost:
+			s.updateLabelSettings(w, r)
+		}
+	}
+}
+
+// Получение шаблона этикеток
+func (s *Server) getLabelSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.resolveUserID(r)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+	if userID == 0 {
+		sendErrorMessage(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+
+	settings, err := s.svc.LabelSettings(r.Context(), userID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.LabelSettings{
+		Envelope: dto.OK(),
+		Labels:   settings,
+	}, http.StatusOK)
+}
+
+// Изменение шаблона этикеток
+func (s *Server) updateLabelSettings(w http.ResponseWriter, r *http.Request) {
+	var request service.LabelSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	settings, err := s.svc.UpdateLabelSettings(r.Context(), requestActor(r, request.TelegramID), request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.LabelSettings{
+		Envelope: dto.OK(),
+		Labels:   settings,
+	}, http.StatusOK)
+}
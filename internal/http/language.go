@@ -0,0 +1,176 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/i18n"
+	"project-znak/internal/validate"
+)
+
+// localizedWriter хранит язык ответа и переводит текстовые ответы об ошибках,
+// отправленные через http.Error. Ответы API переводит sendResponse.
+type localizedWriter struct {
+	http.ResponseWriter
+	lang        i18n.Language
+	explicit    bool // Язык указан в Accept-Language и не заменяется настройкой пользователя
+	wroteHeader bool
+	plainError  bool
+}
+
+func (lw *localizedWriter) WriteHeader(code int) {
+	if lw.wroteHeader {
+		return
+	}
+	lw.wroteHeader = true
+	lw.plainError = code >= http.StatusBadRequest && strings.HasPrefix(lw.Header().Get("Content-Type"), "text/plain")
+	lw.Header().Set("Content-Language", string(lw.lang))
+	lw.ResponseWriter.WriteHeader(code)
+}
+
+func (lw *localizedWriter) Write(p []byte) (int, error) {
+	if !lw.wroteHeader {
+		lw.WriteHeader(http.StatusOK)
+	}
+	if lw.plainError && lw.lang != i18n.Default {
+		message := strings.TrimSuffix(string(p), "\n")
+		if translated := i18n.Translate(lw.lang, message); translated != message {
+			_, err := io.WriteString(lw.ResponseWriter, translated+"\n")
+			return len(p), err
+		}
+	}
+	return lw.ResponseWriter.Write(p)
+}
+
+func (lw *localizedWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// Промежуточное ПО для выбора языка ответа по заголовку Accept-Language. Без заголовка
+// язык определяется настройкой пользователя после авторизации (applyUserLanguage).
+func languageMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang, explicit := i18n.Parse(r.Header.Get("Accept-Language"))
+		if !explicit {
+			lang = i18n.Default
+		}
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(&localizedWriter{ResponseWriter: w, lang: lang, explicit: explicit}, r)
+	})
+}
+
+// Поиск localizedWriter в цепочке оберток ResponseWriter
+func findLocalizedWriter(w http.ResponseWriter) *localizedWriter {
+	for {
+		switch writer := w.(type) {
+		case *localizedWriter:
+			return writer
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// Язык ответа; без languageMiddleware - язык по умолчанию
+func responseLanguage(w http.ResponseWriter) i18n.Language {
+	if lw := findLocalizedWriter(w); lw != nil {
+		return lw.lang
+	}
+	return i18n.Default
+}
+
+// Выбор языка ответа по настройке пользователя, если язык не указан в Accept-Language
+func (s *Server) applyUserLanguage(w http.ResponseWriter, r *http.Request, userID int) {
+	if lw := findLocalizedWriter(w); lw != nil && !lw.explicit && !lw.wroteHeader {
+		lw.lang = s.svc.UserLanguage(r.Context(), userID)
+	}
+}
+
+// Перевод сообщения ответа и описаний ошибок полей на язык lang. Ответ копируется, чтобы
+// не изменять значение обработчика.
+func localizeResponse(lang i18n.Language, response dto.Response) dto.Response {
+	v := reflect.ValueOf(response)
+	pointer := v.Kind() == reflect.Pointer
+	if pointer {
+		if v.IsNil() {
+			return response
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return response
+	}
+
+	localized := reflect.New(v.Type()).Elem()
+	localized.Set(v)
+	if message := localized.FieldByName("Message"); message.Kind() == reflect.String {
+		message.SetString(i18n.Translate(lang, message.String()))
+	}
+	if field := localized.FieldByName("Errors"); field.IsValid() {
+		if errors, ok := field.Addr().Interface().(*validate.Errors); ok && len(*errors) > 0 {
+			translated := make(validate.Errors, len(*errors))
+			for i, fieldErr := range *errors {
+				fieldErr.Message = i18n.Translate(lang, fieldErr.Message)
+				translated[i] = fieldErr
+			}
+			*errors = translated
+		}
+	}
+	if pointer {
+		return localized.Addr().Interface().(dto.Response)
+	}
+	return localized.Interface().(dto.Response)
+}
+
+// Обработчик языка сообщений пользователя
+func (s *Server) userLanguageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userID := s.requireUserID(w, r, http.StatusBadRequest)
+			if userID == 0 {
+				return
+			}
+			sendResponse(w, dto.Language{
+				Envelope: dto.OK(),
+				Language: s.svc.UserLanguage(r.Context(), userID),
+			}, http.StatusOK)
+		case http.MethodPost:
+			s.updateUserLanguage(w, r)
+		}
+	}
+}
+
+// Изменение языка сообщений пользователя
+func (s *Server) updateUserLanguage(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		TelegramID int64  `json:"telegram_id"`
+		Language   string `json:"language"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	lang, err := s.svc.SetUserLanguage(r.Context(), requestActor(r, request.TelegramID), request.Language)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	// Ответ на новом языке, если он не указан в Accept-Language
+	if lw := findLocalizedWriter(w); lw != nil && !lw.explicit {
+		lw.lang = lang
+	}
+	sendResponse(w, dto.Language{
+		Envelope: dto.OK(),
+		Language: lang,
+	}, http.StatusOK)
+}
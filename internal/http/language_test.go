@@ -0,0 +1,30 @@
+package http
+
+import (
+	"testing"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/i18n"
+	"project-znak/internal/validate"
+)
+
+func TestLocalizeResponse(t *testing.T) {
+	response := dto.NewError("Некорректные параметры запроса")
+	response.Errors = validate.Errors{{Field: "inn", Code: "required", Message: "обязательное поле"}}
+
+	localized, ok := localizeResponse(i18n.EN, response).(dto.Error)
+	if !ok {
+		t.Fatalf("ответ изменил тип: %T", localizeResponse(i18n.EN, response))
+	}
+	if localized.Message != "Invalid request parameters" || localized.Errors[0].Message != "required field" {
+		t.Errorf("ответ не переведен: %q, %q", localized.Message, localized.Errors[0].Message)
+	}
+	if response.Message != "Некорректные параметры запроса" || response.Errors[0].Message != "обязательное поле" {
+		t.Errorf("перевод изменил исходный ответ: %q, %q", response.Message, response.Errors[0].Message)
+	}
+
+	canceled, _ := localizeResponse(i18n.EN, &dto.OrderCanceled{Envelope: dto.Done("Заказ отменен"), OrderID: 7}).(*dto.OrderCanceled)
+	if canceled == nil || canceled.Message != "Order cancelled" || canceled.OrderID != 7 {
+		t.Errorf("ответ-указатель переведен неверно: %+v", canceled)
+	}
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Эндпоинты прежнего API (/api/v1/kizs, /kizs, /api/v1/payments, /pay), которые
+// вызывает Telegram-бот. telegram_id передается в параметрах запроса, формат тела
+// и ответа сохранен; обработка выполняется тем же сервисным слоем, что и в /api.
+
+// Позиция запроса КИЗ прежнего API
+type legacyGTINData struct {
+	GTIN  string `json:"gtin" validate:"required,gtin"`
+	Count int    `json:"count" validate:"required,min=1"`
+}
+
+// Запрос КИЗ прежнего API
+type legacyKIZRequest struct {
+	GTINData []legacyGTINData `json:"gtin_data" validate:"required"`
+	INN      string           `json:"inn" validate:"required,inn"`
+}
+
+// Запрос платежа прежнего API
+type legacyPaymentRequest struct {
+	Amount  float64 `json:"amount"`
+	OrderID string  `json:"order_id"`
+}
+
+// Разбор telegram_id из параметров запроса; при ошибке возвращает 0
+func queryTelegramID(r *http.Request) int64 {
+	telegramID, _ := strconv.ParseInt(r.URL.Query().Get("telegram_id"), 10, 64)
+	return telegramID
+}
+
+// Обработчик запроса КИЗ прежнего API
+func (s *Server) legacyKIZHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data legacyKIZRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			s.logger.Printf("Ошибка декодирования запроса: %v", err)
+			http.Error(w, "Некорректный формат запроса", http.StatusBadRequest)
+			return
+		}
+
+		// Каждая позиция разворачивается в count вхождений GTIN
+		request := service.KIZRequest{TelegramID: queryTelegramID(r), INN: data.INN}
+		for _, item := range data.GTINData {
+			for i := 0; i < item.Count; i++ {
+				request.GTINs = append(request.GTINs, item.GTIN)
+			}
+		}
+
+		// Поля проверяются в формате прежнего API, чтобы ошибки указывали на gtin_data
+		err := service.ValidateRequest(data)
+		var result *service.KIZResult
+		if err == nil {
+			result, err = s.svc.RequestKIZs(r.Context(), requestActor(r, request.TelegramID), request)
+		}
+		if err != nil {
+			serviceErr := s.serviceError(r, err)
+			sendResponse(w, dto.LegacyKIZ{
+				Envelope: dto.Fail(serviceErr.Message),
+				Code:     serviceErr.Code,
+				Errors:   serviceErr.Fields,
+			}, httpStatus(serviceErr.Kind))
+			return
+		}
+
+		sendResponse(w, dto.LegacyKIZ{
+			Envelope:  dto.Done("КИЗы успешно сгенерированы"),
+			KIZs:      result.KIZs,
+			FilePaths: []string{result.FilePath},
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик создания платежа прежнего API
+func (s *Server) legacyPaymentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var data legacyPaymentRequest
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			s.logger.Printf("Ошибка декодирования запроса: %v", err)
+			http.Error(w, "Некорректный формат запроса", http.StatusBadRequest)
+			return
+		}
+
+		// Нечисловой order_id прежних клиентов не связан с заказами и не учитывается
+		request := service.PaymentRequest{TelegramID: queryTelegramID(r), Amount: data.Amount}
+		request.OrderID, _ = strconv.Atoi(data.OrderID)
+
+		result, err := s.svc.CreatePayment(r.Context(), requestActor(r, request.TelegramID), request)
+		if err != nil {
+			serviceErr := s.serviceError(r, err)
+			sendResponse(w, dto.LegacyPayment{
+				Envelope: dto.Fail(serviceErr.Message),
+				Errors:   serviceErr.Fields,
+			}, httpStatus(serviceErr.Kind))
+			return
+		}
+
+		sendResponse(w, dto.LegacyPayment{
+			Envelope:   dto.Done("URL для оплаты сформирован"),
+			PaymentURL: result.RedirectURL,
+		}, http.StatusOK)
+	}
+}
@@ -0,0 +1,493 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+	applog "project-znak/pkg/logger"
+	"project-znak/pkg/middleware"
+)
+
+// Поля тела запроса, по которым определяются пользователь и организация
+type requestIdentity struct {
+	TelegramID     int64 `json:"telegram_id"`
+	OrganizationID int   `json:"organization_id"`
+	OrderID        int   `json:"order_id"`
+}
+
+// Наибольший размер начала тела запроса, в котором ищутся поля requestIdentity
+const identityPeekSize = 1 << 20
+
+// errIdentityTooLarge - JSON-объект или поля формы перед файлом не поместились в начало
+// тела размером identityPeekSize
+var errIdentityTooLarge = errors.New("поля запроса не помещаются в начало тела")
+
+// Ключ контекста для полей requestIdentity
+type identityKey struct{}
+
+// Чтение telegram_id, organization_id и order_id из JSON-объекта или полей формы
+// multipart/form-data без потери тела для обработчика. Обработчики декодируют JSON
+// независимо от Content-Type, поэтому JSON-объектом считается любое тело, кроме формы,
+// начинающееся с "{". Читается только начало тела размером до identityPeekSize: если объект
+// или поля формы перед файлом в нем не закончились, возвращается errIdentityTooLarge, так как
+// обработчик прочитал бы поля, не проверенные при авторизации.
+func peekRequestIdentity(r *http.Request) (requestIdentity, error) {
+	var identity requestIdentity
+	if r.Body == nil || r.Body == http.NoBody {
+		return identity, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, identityPeekSize))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return identity, err
+	}
+	truncated := len(body) == identityPeekSize
+
+	if mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		return decodeFormIdentity(body, params["boundary"], truncated)
+	}
+	if trimmed := bytes.TrimLeft(body, " \t\r\n"); len(trimmed) == 0 || trimmed[0] != '{' {
+		return identity, nil
+	}
+	// Некорректный JSON отклонит сам обработчик
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&identity); truncated && errors.Is(err, io.ErrUnexpectedEOF) {
+		return requestIdentity{}, errIdentityTooLarge
+	}
+	return identity, nil
+}
+
+// Поля requestIdentity из полей формы, которые, как и в openUpload, читаются до файла.
+// truncated - начало тела body обрезано.
+func decodeFormIdentity(body []byte, boundary string, truncated bool) (requestIdentity, error) {
+	var identity requestIdentity
+	if boundary == "" {
+		return identity, nil
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return identity, nil
+		} else if err != nil {
+			if truncated {
+				return requestIdentity{}, errIdentityTooLarge
+			}
+			// Некорректную форму отклонит сам обработчик
+			return identity, nil
+		}
+		if part.FormName() == uploadFileField && part.FileName() != "" {
+			return identity, nil
+		}
+		if part.FileName() != "" {
+			continue
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxUploadFieldSize+1))
+		if err != nil {
+			if truncated {
+				return requestIdentity{}, errIdentityTooLarge
+			}
+			return identity, nil
+		}
+		switch part.FormName() {
+		case "telegram_id":
+			identity.TelegramID, _ = strconv.ParseInt(strings.TrimSpace(string(value)), 10, 64)
+		case "organization_id":
+			identity.OrganizationID, _ = strconv.Atoi(strings.TrimSpace(string(value)))
+		case "order_id":
+			identity.OrderID, _ = strconv.Atoi(strings.TrimSpace(string(value)))
+		}
+	}
+}
+
+// Промежуточное ПО, которое один раз до авторизации читает поля requestIdentity из тела
+// и сохраняет их в контексте запроса. Запрос, поля которого не удалось прочитать целиком,
+// отклоняется: иначе обработчик выполнил бы его от имени, не проверенного авторизацией.
+func identityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := peekRequestIdentity(r)
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.Is(err, errIdentityTooLarge):
+			sendErrorMessage(w, middleware.TooLargeMessage(identityPeekSize), http.StatusRequestEntityTooLarge)
+			return
+		case errors.As(err, &tooLarge):
+			sendErrorMessage(w, middleware.TooLargeMessage(tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			sendErrorMessage(w, "Неверный формат запроса", http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+	})
+}
+
+// Поля requestIdentity, прочитанные identityMiddleware
+func identityFromContext(r *http.Request) requestIdentity {
+	identity, _ := r.Context().Value(identityKey{}).(requestIdentity)
+	return identity
+}
+
+// telegram_id запроса без API ключа: из параметра запроса или тела
+func requestTelegramID(r *http.Request) int64 {
+	if value := r.URL.Query().Get("telegram_id"); value != "" {
+		telegramID, _ := strconv.ParseInt(value, 10, 64)
+		return telegramID
+	}
+	return identityFromContext(r).TelegramID
+}
+
+// Полосы очереди запросов КИЗ
+const (
+	kizLanePremium  = "premium"
+	kizLaneStandard = "standard"
+)
+
+// Определение полосы очереди запроса КИЗ по тарифному плану пользователя. Ключ справедливого
+// распределения внутри полосы - пользователь, для неизвестного пользователя - IP-адрес клиента.
+// При ошибке определения плана запрос обслуживается в обычной полосе.
+func (s *Server) kizQueueLane(premiumPlans []string) func(r *http.Request) (string, string) {
+	return func(r *http.Request) (string, string) {
+		userID, err := s.resolveUserID(r)
+		if err == nil && userID == 0 {
+			if identity := identityFromContext(r); identity.TelegramID > 0 {
+				userID, err = s.svc.UserIDByTelegram(r.Context(), identity.TelegramID)
+			}
+		}
+		if err != nil {
+			s.logger.Printf("Ошибка получения пользователя для очереди запросов КИЗ: %v", err)
+		}
+		if userID == 0 {
+			return kizLaneStandard, "ip:" + clientIP(r)
+		}
+
+		key := "user:" + strconv.Itoa(userID)
+		plan, err := s.svc.UserPlanName(r.Context(), userID)
+		if err != nil {
+			s.logger.Printf("Ошибка получения тарифного плана для очереди запросов КИЗ: %v", err)
+			return kizLaneStandard, key
+		}
+		if plan != "" && slices.Contains(premiumPlans, plan) {
+			return kizLanePremium, key
+		}
+		return kizLaneStandard, key
+	}
+}
+
+// Определение организации, в рамках которой выполняется запрос, по шаблону маршрута
+func (s *Server) requestOrganizationID(r *http.Request, userID int, identity requestIdentity) (int, error) {
+	route := routePath(r)
+	pathID, _ := strconv.Atoi(r.PathValue("id"))
+	switch {
+	case strings.HasPrefix(route, "/api/organizations/{id}"):
+		return pathID, nil
+	case strings.HasPrefix(route, "/api/orders/templates/{id}"):
+		return s.svc.OrderTemplateOrganizationID(r.Context(), userID, pathID)
+	case strings.HasPrefix(route, "/api/orders/schedules/{id}"):
+		return s.svc.OrderScheduleOrganizationID(r.Context(), userID, pathID)
+	case strings.HasPrefix(route, "/api/orders/{id}"):
+		return s.svc.OrderOrganizationID(r.Context(), pathID)
+	case strings.HasPrefix(route, "/api/payments/{id}"):
+		return s.svc.PaymentOrganizationID(r.Context(), pathID)
+	case strings.HasPrefix(route, "/api/requests/{id}"):
+		return s.svc.KIZRequestOrganizationID(r.Context(), pathID)
+	case route == "/api/requests/status" || route == "/api/requests/events":
+		// ID запроса КИЗ передается параметром: права проверяются в организации запроса
+		queryID, _ := strconv.Atoi(r.URL.Query().Get("id"))
+		return s.svc.KIZRequestOrganizationID(r.Context(), queryID)
+	case strings.HasPrefix(route, "/api/documents/retirement/{id}"):
+		return s.svc.RetirementDocumentOrganizationID(r.Context(), pathID)
+	case strings.HasPrefix(route, "/api/documents/upd/incoming/{id}"):
+		return s.svc.IncomingUPDOrganizationID(r.Context(), pathID)
+	case strings.HasPrefix(route, "/api/documents/upd/{id}"):
+		return s.svc.UPDOrganizationID(r.Context(), pathID)
+	case strings.HasPrefix(route, "/api/inventory/reservations/{id}"):
+		return s.svc.ReservationOrganizationID(r.Context(), pathID)
+	case strings.HasPrefix(route, "/api/ozon/submissions/{id}"):
+		return s.svc.OzonSubmissionOrganizationID(r.Context(), pathID)
+	case strings.HasPrefix(route, "/api/documents/{id}"):
+		return s.svc.DocumentOrganizationID(r.Context(), pathID)
+	case route == "/api/cart/checkout":
+		return s.svc.CartOrganizationID(r.Context(), userID)
+	case route == "/api/documents" && identity.OrderID > 0:
+		return s.svc.OrderOrganizationID(r.Context(), identity.OrderID)
+	}
+
+	requestedID := identity.OrganizationID
+	if header := r.Header.Get("X-Organization-ID"); header != "" {
+		requestedID, _ = strconv.Atoi(header)
+	} else if param := r.URL.Query().Get("organization_id"); param != "" {
+		requestedID, _ = strconv.Atoi(param)
+	}
+
+	return s.svc.RequestOrganizationID(r.Context(), userID, requestedID)
+}
+
+// Middleware маршрута, требующего разрешения роли пользователя в организации.
+// Запросы вне организации и запросы пользователей, не состоящих в ней,
+// передаются обработчику, который сам проверяет доступ к данным.
+func (s *Server) permission(permission string) routeMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := identityFromContext(r)
+
+			userID, err := s.resolveUserID(r)
+			if err == nil && userID == 0 && identity.TelegramID > 0 {
+				userID, err = s.svc.UserIDByTelegram(r.Context(), identity.TelegramID)
+			}
+			if err != nil {
+				s.logger.Printf("Ошибка получения пользователя: %v", err)
+				http.Error(w, "Ошибка проверки прав доступа", http.StatusInternalServerError)
+				return
+			}
+			if userID == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			applog.SetTag(r.Context(), applog.TagUserID, strconv.Itoa(userID))
+			middleware.AccessInfoFromContext(r.Context()).SetUser(userID, identity.TelegramID)
+			s.applyUserLanguage(w, r, userID)
+
+			organizationID, err := s.requestOrganizationID(r, userID, identity)
+			if err != nil {
+				s.logger.Printf("Ошибка определения организации: %v", err)
+				http.Error(w, "Ошибка проверки прав доступа", http.StatusInternalServerError)
+				return
+			}
+			if organizationID == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, err := s.svc.AuthorizeOrganization(r.Context(), userID, organizationID, permission)
+			if err != nil {
+				s.logger.Printf("Ошибка проверки разрешения %s: %v", permission, err)
+				http.Error(w, "Ошибка проверки прав доступа", http.StatusInternalServerError)
+				return
+			}
+
+			if !allowed {
+				response := dto.NewError("Недостаточно прав для выполнения операции")
+				response.Permission = permission
+				sendResponse(w, response, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Middleware для административных эндпоинтов: доступ только по API ключу администратора
+func (s *Server) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := service.UserIDFromContext(r.Context())
+		if userID == 0 {
+			http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+			return
+		}
+
+		admin, err := s.svc.IsAdmin(r.Context(), userID)
+		if err != nil {
+			s.logger.Printf("Ошибка проверки прав администратора: %v", err)
+			http.Error(w, "Ошибка проверки прав доступа", http.StatusInternalServerError)
+			return
+		}
+		if !admin {
+			http.Error(w, "Доступ запрещен", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware для авторизации
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	// Публичные маршруты, не требующие авторизации
+	publicPaths := map[string]bool{
+		"/health":                      true,
+		"/healthz":                     true,
+		"/readyz":                      true,
+		"/metrics":                     true,
+		"/api/users/register":          true,
+		"/api/payments/callback":       true,
+		"/api/payments/stripe/webhook": true,
+		"/api/requests/download":       true,
+		"/api/announcements":           true,
+		"/api/status":                  true,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/docs/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Без API ключа запрос обрабатывается по telegram_id,
+		// доступ к данным проверяют middleware разрешений маршрутов и обработчики.
+		// Перебор telegram_id ограничивается так же, как перебор ключей.
+		apiKey := r.Header.Get("X-API-Key")
+		if apiKey == "" {
+			if telegramID := requestTelegramID(r); telegramID > 0 {
+				_, err := s.svc.AuthenticateTelegramID(r.Context(), telegramID,
+					service.ClientInfo{IP: clientIP(r), UserAgent: r.UserAgent()})
+				if err != nil {
+					s.sendError(w, r, err)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID, keyID, err := s.svc.AuthenticateAPIKey(r.Context(), apiKey,
+			service.ClientInfo{IP: clientIP(r), UserAgent: r.UserAgent()})
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+		if userID == 0 {
+			// Не сообщаем клиенту о конкретной ошибке для безопасности
+			http.Error(w, "Неавторизованный доступ", http.StatusUnauthorized)
+			return
+		}
+
+		s.applyUserLanguage(w, r, userID)
+
+		// Запрос потребления не учитывается в квоте, чтобы его можно было проверить
+		// и после исчерпания квоты
+		if r.URL.Path != "/api/usage" {
+			quota, err := s.svc.ConsumeRequestQuota(r.Context(), userID)
+			setQuotaHeaders(w, quota)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+		}
+
+		if token := r.Header.Get("X-Impersonation-Token"); token != "" {
+			s.serveImpersonated(w, r, next, userID, token)
+			return
+		}
+
+		// Установка ID пользователя в контекст запроса
+		applog.SetTag(r.Context(), applog.TagUserID, strconv.Itoa(userID))
+		middleware.AccessInfoFromContext(r.Context()).SetUser(userID, 0)
+		ctx := service.WithAPIKeyID(service.WithUserID(r.Context(), userID), keyID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Маршруты, недоступные в сеансе имперсонации: управление доступом к аккаунту,
+// удаление и выгрузка данных пользователя, учетные данные маркетплейсов
+var impersonationDeniedPaths = []string{
+	"/api/keys",
+	"/api/sessions",
+	"/api/confirmations/",
+	"/api/users/me",
+	"/api/users/wildberries",
+	"/api/users/ozon",
+}
+
+func impersonationDenied(path string) bool {
+	for _, denied := range impersonationDeniedPaths {
+		if path == denied || strings.HasPrefix(path, strings.TrimSuffix(denied, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Запись кода ответа для журнала аудита имперсонации
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// Обработка запроса администратора adminUserID от имени пользователя по токену имперсонации.
+// Запрос выполняется с правами пользователя и записывается в журнал аудита с кодом ответа.
+// Без разрешения на запись доступны только запросы на чтение.
+func (s *Server) serveImpersonated(w http.ResponseWriter, r *http.Request, next http.Handler, adminUserID int, token string) {
+	impersonation, err := s.svc.AuthenticateImpersonation(r.Context(), adminUserID, token)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if impersonationDenied(r.URL.Path) || (!readOnly && !impersonation.AllowWrite) {
+		s.svc.RecordImpersonatedRequest(r.Context(), impersonation, clientIP(r), r.Method, r.URL.Path, http.StatusForbidden)
+		sendErrorMessage(w, "Операция недоступна в режиме имперсонации", http.StatusForbidden)
+		return
+	}
+
+	userID := impersonation.UserID
+	applog.SetTag(r.Context(), applog.TagUserID, strconv.Itoa(userID))
+	middleware.AccessInfoFromContext(r.Context()).SetUser(userID, 0)
+	w.Header().Set("X-Impersonated-User", strconv.Itoa(userID))
+
+	// Запрос выполняется без API ключа: изменения не привязываются к ключу администратора
+	ctx := service.WithImpersonation(service.WithUserID(r.Context(), userID), impersonation)
+	sw := &statusWriter{ResponseWriter: w}
+	next.ServeHTTP(sw, r.WithContext(ctx))
+
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	s.svc.RecordImpersonatedRequest(r.Context(), impersonation, clientIP(r), r.Method, r.URL.Path, sw.status)
+}
+
+// Промежуточное ПО для CORS
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Organization-ID, X-Confirmation-ID, X-Confirmation-Code, X-Impersonation-Token, "+
+			"If-None-Match, If-Modified-Since")
+		// Состояние лимитов доступно скриптам в браузере для ограничения частоты запросов,
+		// реквизиты квитанций - для сверки выгруженного файла, ETag - для условных запросов
+		w.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, "+
+			"X-Quota-Limit, X-Quota-Remaining, X-Quota-Reset, X-Receipt-Ticket, X-Receipt-SHA256, X-Impersonated-User, ETag")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
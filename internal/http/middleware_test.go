@@ -0,0 +1,90 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPeekRequestIdentity(t *testing.T) {
+	large := `"items": ["` + strings.Repeat("0", 2*identityPeekSize) + `"]`
+	form := func(fields ...string) string {
+		var body strings.Builder
+		for i := 0; i < len(fields); i += 2 {
+			body.WriteString("--b\r\nContent-Disposition: form-data; name=\"" + fields[i] + "\"")
+			if fields[i] == "file" {
+				body.WriteString("; filename=\"gtins.csv\"")
+			}
+			body.WriteString("\r\n\r\n" + fields[i+1] + "\r\n")
+		}
+		return body.String() + "--b--\r\n"
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        requestIdentity
+		wantErr     error
+	}{
+		{"небольшое тело", "application/json", `{"organization_id": 7, "telegram_id": 42}`,
+			requestIdentity{TelegramID: 42, OrganizationID: 7}, nil},
+		{"JSON без типа содержимого", "text/plain", ` {"telegram_id": 42}`, requestIdentity{TelegramID: 42}, nil},
+		{"объект больше 1 МБ", "application/json", `{"telegram_id": 42, "order_id": 5, ` + large + `}`,
+			requestIdentity{}, errIdentityTooLarge},
+		{"не JSON-объект", "application/json", `[1, 2]`, requestIdentity{}, nil},
+		{"файл телом запроса", "text/csv", strings.Repeat("04601234567893;1\n", identityPeekSize/8), requestIdentity{}, nil},
+		{"поля формы", "multipart/form-data; boundary=b",
+			form("telegram_id", "42", "organization_id", "7", "order_id", "5", "file", "04601234567893", "telegram_id", "1"),
+			requestIdentity{TelegramID: 42, OrganizationID: 7, OrderID: 5}, nil},
+		{"файл формы больше 1 МБ", "multipart/form-data; boundary=b",
+			form("telegram_id", "42", "file", strings.Repeat("04601234567893\n", identityPeekSize/8)),
+			requestIdentity{TelegramID: 42}, nil},
+		{"поля формы после 1 МБ", "multipart/form-data; boundary=b",
+			form("padding", strings.Repeat("0", 2*identityPeekSize), "telegram_id", "42", "file", "04601234567893"),
+			requestIdentity{}, errIdentityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/kizs", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			got, err := peekRequestIdentity(r)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("получено %+v, %v, ожидалось %+v, %v", got, err, tt.want, tt.wantErr)
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(body, []byte(tt.body)) {
+				t.Errorf("обработчик получил тело из %d байт, ожидалось %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+// Предварительный запрос браузера разрешает все методы API, включая PUT
+func TestCORSPreflight(t *testing.T) {
+	handler := corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("предварительный запрос не должен передаваться обработчику")
+	}))
+	r := httptest.NewRequest(http.MethodOptions, "/api/orders/templates/1", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("код ответа %d, ожидался %d", w.Code, http.StatusOK)
+	}
+	methods := strings.Split(w.Header().Get("Access-Control-Allow-Methods"), ", ")
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		if !slices.Contains(methods, method) {
+			t.Errorf("метод %s не разрешен: %v", method, methods)
+		}
+	}
+}
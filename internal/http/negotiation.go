@@ -0,0 +1,78 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Форматы ответов API. По умолчанию ответы передаются в JSON; клиенты, которые не умеют
+// разбирать JSON (учетные системы), запрашивают XML заголовком Accept: application/xml.
+const (
+	formatJSON = "json"
+	formatXML  = "xml"
+)
+
+// Выбор формата ответа по заголовку Accept. XML выбирается, только если клиент предпочитает
+// его JSON: при равных весах и без заголовка ответ передается в JSON.
+func negotiateFormat(accept string) string {
+	jsonQ, xmlQ := 0.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					q = 0
+				} else {
+					q = parsed
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "application/xml", "text/xml":
+			xmlQ = max(xmlQ, q)
+		case "application/*", "*/*":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+	if xmlQ > jsonQ {
+		return formatXML
+	}
+	return formatJSON
+}
+
+// formatWriter хранит формат ответа, выбранный по заголовку Accept
+type formatWriter struct {
+	http.ResponseWriter
+	format string
+}
+
+func (fw *formatWriter) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
+
+// Промежуточное ПО для выбора формата ответа по заголовку Accept
+func formatMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		next.ServeHTTP(&formatWriter{ResponseWriter: w, format: negotiateFormat(r.Header.Get("Accept"))}, r)
+	})
+}
+
+// Формат ответа; без formatMiddleware - JSON
+func responseFormat(w http.ResponseWriter) string {
+	for {
+		switch writer := w.(type) {
+		case *formatWriter:
+			return writer.format
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return formatJSON
+		}
+	}
+}
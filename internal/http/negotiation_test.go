@@ -0,0 +1,22 @@
+package http
+
+import "testing"
+
+func TestNegotiateFormat(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                                  formatJSON,
+		"*/*":                               formatJSON,
+		"application/json":                  formatJSON,
+		"application/xml":                   formatXML,
+		"text/xml; charset=utf-8":           formatXML,
+		"application/xml, */*;q=0.1":        formatXML,
+		"application/xml;q=0.5, */*":        formatJSON,
+		"application/json, application/xml": formatJSON,
+		"application/*":                     formatJSON,
+		"application/xml;q=abc":             formatJSON,
+	} {
+		if got := negotiateFormat(accept); got != want {
+			t.Errorf("negotiateFormat(%q) = %s, ожидался %s", accept, got, want)
+		}
+	}
+}
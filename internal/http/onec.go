@@ -0,0 +1,91 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/onec"
+	"project-znak/internal/service"
+)
+
+// Тип содержимого и расширение файла выгрузки для 1С
+var oneCExportFiles = map[string]struct{ contentType, extension string }{
+	onec.FormatCommerceML: {"application/xml; charset=utf-8", "xml"},
+	onec.FormatCSV:        {"application/zip", "zip"},
+}
+
+// Обработчик выгрузки для 1С: GET /api/integrations/1c/export?from=&to=&organization_id=&format=
+func (s *Server) oneCExportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		params := r.URL.Query()
+		organizationID, err := parseOptionalInt(params.Get("organization_id"))
+		if err != nil {
+			sendErrorMessage(w, "Некорректный ID организации", http.StatusBadRequest)
+			return
+		}
+		request := service.OneCExportRequest{
+			OrganizationID: organizationID,
+			From:           params.Get("from"),
+			To:             params.Get("to"),
+			Format:         params.Get("format"),
+		}
+		if request.Format == "" {
+			request.Format = onec.FormatCommerceML
+		}
+
+		data, err := s.svc.ExportOneC(r.Context(), userID, request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		file := oneCExportFiles[request.Format]
+		w.Header().Set("Content-Type", file.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="1c_%s_%s.%s"`, request.From, request.To, file.extension))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	}
+}
+
+// Обработчик загрузки отчета о розничных продажах из 1С: POST /api/integrations/1c/retail-sales.
+// Файл CommerceML или CSV передается полем file формы multipart/form-data или телом запроса.
+func (s *Server) oneCRetailSalesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		file, err := openUpload(r, retailSalesUpload)
+		if err != nil {
+			s.sendUploadError(w, err)
+			return
+		}
+		data, err := io.ReadAll(file)
+		r.Body.Close()
+		if err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+
+		results, err := s.svc.ImportRetailSales(r.Context(), requestActor(r, queryTelegramID(r)), data)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		created := 0
+		for _, result := range results {
+			if result.DocumentID > 0 {
+				created++
+			}
+		}
+		sendResponse(w, dto.RetailSales{
+			Envelope: dto.Done(fmt.Sprintf("Создано документов вывода из оборота: %d из %d", created, len(results))),
+			Sales:    results,
+		}, http.StatusOK)
+	}
+}
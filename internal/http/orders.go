@@ -0,0 +1,245 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Создание заказа
+func (s *Server) createOrder(w http.ResponseWriter, r *http.Request) {
+	var request service.OrderCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	order, err := s.svc.CreateOrder(r.Context(), requestActor(r, request.TelegramID), request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Order{
+		Envelope: dto.OK(),
+		Order:    order,
+	}, http.StatusCreated)
+}
+
+// Список заказов пользователя
+func (s *Server) listOrders(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	limit := 10 // По умолчанию 10 записей
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		if _, err := fmt.Sscanf(limitParam, "%d", &limit); err != nil || limit <= 0 {
+			limit = 10
+		}
+	}
+
+	// Заказы организации доступны всем ее участникам, без организации - только личные заказы
+	var organizationID int
+	if organizationParam := r.URL.Query().Get("organization_id"); organizationParam != "" {
+		var err error
+		organizationID, err = strconv.Atoi(organizationParam)
+		if err != nil {
+			sendErrorMessage(w, "Некорректный ID организации", http.StatusBadRequest)
+			return
+		}
+	}
+
+	orders, err := s.svc.ListOrders(r.Context(), userID, organizationID, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Orders{
+		Envelope: dto.OK(),
+		Orders:   orders,
+	}, http.StatusOK)
+}
+
+// Получение заказа с позициями, платежами и запросами КИЗ
+func (s *Server) getOrder(w http.ResponseWriter, r *http.Request, orderID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	details, err := s.svc.GetOrder(r.Context(), userID, orderID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.OrderDetails{
+		Envelope: dto.OK(),
+		Order:    details,
+	}, http.StatusOK)
+}
+
+// Отмена заказа. Параметр version - версия заказа, прочитанная клиентом: если заказ
+// изменился после чтения, возвращается 409 с кодом version_conflict.
+func (s *Server) cancelOrder(w http.ResponseWriter, r *http.Request, orderID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	var version int
+	if versionParam := r.URL.Query().Get("version"); versionParam != "" {
+		var err error
+		version, err = strconv.Atoi(versionParam)
+		if err != nil || version <= 0 {
+			sendErrorMessage(w, "Некорректная версия заказа", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.svc.CancelOrder(r.Context(), requestActor(r, 0), userID, orderID, version); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.OrderCanceled{
+		Envelope: dto.Done("Заказ отменен"),
+		OrderID:  orderID,
+	}, http.StatusOK)
+}
+
+// Повтор заказа: новый заказ с теми же позициями по текущим ценам
+func (s *Server) reorder(w http.ResponseWriter, r *http.Request, orderID int) {
+	order, err := s.svc.Reorder(r.Context(), requestActor(r, queryTelegramID(r)), orderID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Order{
+		Envelope: dto.OK(),
+		Order:    order,
+	}, http.StatusCreated)
+}
+
+// Обработчик шаблонов заказов: GET - список, POST - создание шаблона
+func (s *Server) orderTemplatesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userID := s.requireUserID(w, r, http.StatusUnauthorized)
+			if userID == 0 {
+				return
+			}
+
+			templates, err := s.svc.ListOrderTemplates(r.Context(), userID)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			sendResponse(w, dto.OrderTemplates{
+				Envelope:  dto.OK(),
+				Templates: templates,
+			}, http.StatusOK)
+		case http.MethodPost:
+			var request service.OrderTemplateRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+
+			template, err := s.svc.CreateOrderTemplate(r.Context(), requestActor(r, request.TelegramID), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			sendResponse(w, dto.OrderTemplate{
+				Envelope: dto.OK(),
+				Template: template,
+			}, http.StatusCreated)
+		}
+	}
+}
+
+// Заказ по шаблону: новый заказ с позициями шаблона по текущим ценам
+func (s *Server) orderFromTemplate(w http.ResponseWriter, r *http.Request, templateID int) {
+	order, err := s.svc.OrderFromTemplate(r.Context(), requestActor(r, queryTelegramID(r)), templateID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Order{
+		Envelope: dto.OK(),
+		Order:    order,
+	}, http.StatusCreated)
+}
+
+// Получение шаблона заказа
+func (s *Server) getOrderTemplate(w http.ResponseWriter, r *http.Request, templateID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	template, err := s.svc.GetOrderTemplate(r.Context(), userID, templateID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.OrderTemplate{
+		Envelope: dto.OK(),
+		Template: template,
+	}, http.StatusOK)
+}
+
+// Изменение шаблона заказа: название, организация и позиции заменяются целиком
+func (s *Server) updateOrderTemplate(w http.ResponseWriter, r *http.Request, templateID int) {
+	var request service.OrderTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	template, err := s.svc.UpdateOrderTemplate(r.Context(), requestActor(r, request.TelegramID), templateID, request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.OrderTemplate{
+		Envelope: dto.OK(),
+		Template: template,
+	}, http.StatusOK)
+}
+
+// Удаление шаблона заказа
+func (s *Server) deleteOrderTemplate(w http.ResponseWriter, r *http.Request, templateID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	if err := s.svc.DeleteOrderTemplate(r.Context(), requestActor(r, queryTelegramID(r)), userID, templateID); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.OrderTemplateDeleted{
+		Envelope:   dto.Done("Шаблон заказа удален"),
+		TemplateID: templateID,
+	}, http.StatusOK)
+}
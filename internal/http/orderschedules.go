@@ -0,0 +1,136 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик расписаний заказов: GET - список, POST - создание расписания
+func (s *Server) orderSchedulesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userID := s.requireUserID(w, r, http.StatusUnauthorized)
+			if userID == 0 {
+				return
+			}
+
+			schedules, err := s.svc.ListOrderSchedules(r.Context(), userID)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			sendResponse(w, dto.OrderSchedules{
+				Envelope:  dto.OK(),
+				Schedules: schedules,
+			}, http.StatusOK)
+		case http.MethodPost:
+			var request service.OrderScheduleRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+
+			schedule, err := s.svc.CreateOrderSchedule(r.Context(), requestActor(r, request.TelegramID), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			sendResponse(w, dto.OrderSchedule{
+				Envelope: dto.OK(),
+				Schedule: schedule,
+			}, http.StatusCreated)
+		}
+	}
+}
+
+// Получение расписания заказов
+func (s *Server) getOrderSchedule(w http.ResponseWriter, r *http.Request, scheduleID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	schedule, err := s.svc.GetOrderSchedule(r.Context(), userID, scheduleID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.OrderSchedule{
+		Envelope: dto.OK(),
+		Schedule: schedule,
+	}, http.StatusOK)
+}
+
+// Изменение расписания заказов: название, расписание, организация и позиции заменяются целиком
+func (s *Server) updateOrderSchedule(w http.ResponseWriter, r *http.Request, scheduleID int) {
+	var request service.OrderScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	schedule, err := s.svc.UpdateOrderSchedule(r.Context(), requestActor(r, request.TelegramID), scheduleID, request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.OrderSchedule{
+		Envelope: dto.OK(),
+		Schedule: schedule,
+	}, http.StatusOK)
+}
+
+// Обработчик приостановки или возобновления расписания заказов:
+// POST /api/orders/schedules/{id}/pause и POST /api/orders/schedules/{id}/resume
+func (s *Server) orderScheduleStatusHandler(resume bool) http.HandlerFunc {
+	return withPathID(func(w http.ResponseWriter, r *http.Request, scheduleID int) {
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		actor := requestActor(r, queryTelegramID(r))
+		update := s.svc.PauseOrderSchedule
+		if resume {
+			update = s.svc.ResumeOrderSchedule
+		}
+		schedule, err := update(r.Context(), actor, userID, scheduleID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.OrderSchedule{
+			Envelope: dto.OK(),
+			Schedule: schedule,
+		}, http.StatusOK)
+	})
+}
+
+// Удаление расписания заказов
+func (s *Server) deleteOrderSchedule(w http.ResponseWriter, r *http.Request, scheduleID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	if err := s.svc.DeleteOrderSchedule(r.Context(), requestActor(r, queryTelegramID(r)), userID, scheduleID); err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.OrderScheduleDeleted{
+		Envelope:   dto.Done("Расписание заказов удалено"),
+		ScheduleID: scheduleID,
+	}, http.StatusOK)
+}
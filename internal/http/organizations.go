@@ -0,0 +1,119 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/models"
+	"project-znak/internal/service"
+)
+
+// Список организаций пользователя
+func (s *Server) listOrganizations(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	organizations, err := s.svc.ListOrganizations(r.Context(), userID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Organizations{
+		Envelope:      dto.OK(),
+		Organizations: organizations,
+	}, http.StatusOK)
+}
+
+// Создание организации. Создатель становится ее владельцем.
+func (s *Server) createOrganization(w http.ResponseWriter, r *http.Request) {
+	var request service.OrganizationCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	org, err := s.svc.CreateOrganization(r.Context(), requestActor(r, request.TelegramID), request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Organization{
+		Envelope:     dto.OK(),
+		Organization: org,
+	}, http.StatusCreated)
+}
+
+// Получение организации со списком участников
+func (s *Server) getOrganization(w http.ResponseWriter, r *http.Request, organizationID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	details, err := s.svc.GetOrganization(r.Context(), userID, organizationID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.OrganizationDetails{
+		Envelope:     dto.OK(),
+		Organization: details,
+	}, http.StatusOK)
+}
+
+// Добавление участника организации или изменение его роли
+func (s *Server) addOrganizationMember(w http.ResponseWriter, r *http.Request, organizationID int) {
+	var request service.OrganizationMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	// Разрешение на управление участниками проверяется middleware маршрута
+	member, err := s.svc.AddOrganizationMember(r.Context(), requestActor(r, request.TelegramID), organizationID, request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Member{
+		Envelope: dto.OK(),
+		Member:   member,
+	}, http.StatusOK)
+}
+
+// Запрос на изменение реквизитов организации
+type requisitesRequest struct {
+	TelegramID int64 `json:"telegram_id"`
+	models.Requisites
+}
+
+// Изменение реквизитов организации для счетов на оплату
+func (s *Server) updateRequisites(w http.ResponseWriter, r *http.Request, organizationID int) {
+	var request requisitesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	// Разрешение на выставление счетов проверяется middleware маршрута
+	org, err := s.svc.UpdateRequisites(r.Context(), requestActor(r, request.TelegramID), organizationID, request.Requisites)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Organization{
+		Envelope:     dto.OK(),
+		Organization: org,
+	}, http.StatusOK)
+}
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+)
+
+// Обработчик списка уведомлений outbox для администратора: GET /api/admin/outbox?status=
+func (s *Server) adminOutboxHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= 1000 {
+			limit = value
+		}
+
+		messages, err := s.svc.ListOutboxMessages(r.Context(), r.URL.Query().Get("status"), limit)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.OutboxMessages{
+			Envelope: dto.OK(),
+			Messages: messages,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик повторной доставки уведомления администратором: POST /api/admin/outbox/{id}/retry
+func (s *Server) adminOutboxRetryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		messageID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		if err := s.svc.RetryOutboxMessage(r.Context(), requestActor(r, 0), messageID); err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Message{Envelope: dto.Done("Уведомление поставлено в очередь на доставку")}, http.StatusOK)
+	}
+}
@@ -0,0 +1,201 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик ключа Ozon Seller API: GET/POST/DELETE /api/users/ozon. Ключом управляет
+// только пользователь, авторизованный по API ключу.
+func (s *Server) ozonCredentialsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userID := requireAuthenticatedUserID(w, r)
+			if userID == 0 {
+				return
+			}
+			settings, err := s.svc.OzonSettings(r.Context(), userID)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.OzonSettings{
+				Envelope: dto.OK(),
+				Ozon:     settings,
+			}, http.StatusOK)
+
+		case http.MethodPost:
+			var request service.OzonCredentialsRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+			if requireAuthenticatedUserID(w, r) == 0 {
+				return
+			}
+
+			settings, err := s.svc.SaveOzonCredentials(r.Context(), requestActor(r, 0), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.OzonSettings{
+				Envelope: dto.OK(),
+				Ozon:     settings,
+			}, http.StatusOK)
+
+		case http.MethodDelete:
+			userID := requireAuthenticatedUserID(w, r)
+			if userID == 0 {
+				return
+			}
+			if err := s.svc.DeleteOzonCredentials(r.Context(), requestActor(r, 0), userID); err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.Message{Envelope: dto.Done("Ключ Ozon удален")}, http.StatusOK)
+		}
+	}
+}
+
+// Обработчик соответствий SKU Ozon и GTIN: GET /api/ozon/mappings?organization_id=,
+// POST /api/ozon/mappings, DELETE /api/ozon/mappings?sku=&organization_id=
+func (s *Server) ozonMappingsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var request service.OzonMappingRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+
+			mapping, err := s.svc.SaveOzonMapping(r.Context(), requestActor(r, request.TelegramID), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.OzonMapping{
+				Envelope: dto.OK(),
+				Mapping:  mapping,
+			}, http.StatusOK)
+			return
+		}
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+		params := r.URL.Query()
+		organizationID, err := parseOptionalInt(params.Get("organization_id"))
+		if err != nil {
+			sendErrorMessage(w, "Некорректный ID организации", http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			mappings, err := s.svc.OzonMappings(r.Context(), userID, organizationID)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.OzonMappings{
+				Envelope: dto.OK(),
+				Mappings: mappings,
+			}, http.StatusOK)
+			return
+		}
+
+		sku, err := strconv.ParseInt(params.Get("sku"), 10, 64)
+		if err != nil || sku <= 0 {
+			sendErrorMessage(w, "Некорректный SKU", http.StatusBadRequest)
+			return
+		}
+		if err := s.svc.DeleteOzonMapping(r.Context(), requestActor(r, queryTelegramID(r)), userID, organizationID, sku); err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+		sendResponse(w, dto.Message{Envelope: dto.Done("Соответствие SKU удалено")}, http.StatusOK)
+	}
+}
+
+// Обработчик передач кодов в отправления Ozon: POST /api/ozon/submissions,
+// GET /api/ozon/submissions?organization_id=&limit=
+func (s *Server) ozonSubmissionsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var request service.OzonSubmitRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+
+			submission, err := s.svc.SubmitOzonPosting(r.Context(), requestActor(r, request.TelegramID), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.OzonSubmission{
+				Envelope:   dto.OK(),
+				Submission: submission,
+			}, http.StatusCreated)
+
+		case http.MethodGet:
+			userID := s.requireUserID(w, r, http.StatusUnauthorized)
+			if userID == 0 {
+				return
+			}
+			params := r.URL.Query()
+			organizationID, err := parseOptionalInt(params.Get("organization_id"))
+			if err != nil {
+				sendErrorMessage(w, "Некорректный ID организации", http.StatusBadRequest)
+				return
+			}
+			limit := 100
+			if value, err := strconv.Atoi(params.Get("limit")); err == nil && value > 0 && value <= 1000 {
+				limit = value
+			}
+
+			submissions, err := s.svc.ListOzonSubmissions(r.Context(), userID, organizationID, limit)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.OzonSubmissions{
+				Envelope:    dto.OK(),
+				Submissions: submissions,
+			}, http.StatusOK)
+		}
+	}
+}
+
+// Обработчик передачи кодов в отправление Ozon: GET /api/ozon/submissions/{id}
+func (s *Server) ozonSubmissionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		submissionID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		submission, err := s.svc.GetOzonSubmission(r.Context(), userID, submissionID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+		sendResponse(w, dto.OzonSubmission{
+			Envelope:   dto.OK(),
+			Submission: submission,
+		}, http.StatusOK)
+	}
+}
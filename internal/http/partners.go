@@ -0,0 +1,159 @@
+package http
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/models"
+	"project-znak/internal/service"
+)
+
+// Обработчик субаккаунтов партнера: GET - список, POST - создание организации клиента
+func (s *Server) partnerAccountsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.listPartnerAccounts(w, r)
+		case http.MethodPost:
+			s.createPartnerAccount(w, r)
+		}
+	}
+}
+
+// Список субаккаунтов партнера
+func (s *Server) listPartnerAccounts(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	accounts, err := s.svc.PartnerAccounts(r.Context(), userID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.PartnerAccounts{
+		Envelope: dto.OK(),
+		Accounts: accounts,
+	}, http.StatusOK)
+}
+
+// Создание субаккаунта партнера
+func (s *Server) createPartnerAccount(w http.ResponseWriter, r *http.Request) {
+	var request service.OrganizationCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	org, err := s.svc.CreatePartnerAccount(r.Context(), requestActor(r, request.TelegramID), request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Organization{
+		Envelope:     dto.OK(),
+		Organization: org,
+	}, http.StatusCreated)
+}
+
+// Обработчик сводки оплат клиентов партнера: GET /api/partners/billing?from=&to=&format=
+func (s *Server) partnerBillingHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		params := r.URL.Query()
+		format := params.Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			sendErrorMessage(w, "Формат должен быть json или csv", http.StatusBadRequest)
+			return
+		}
+
+		request := service.PartnerBillingRequest{From: params.Get("from"), To: params.Get("to")}
+		billing, err := s.svc.PartnerBilling(r.Context(), userID, request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		if format != "csv" {
+			sendResponse(w, dto.PartnerBilling{
+				Envelope: dto.OK(),
+				Billing:  billing,
+			}, http.StatusOK)
+			return
+		}
+
+		data, err := partnerBillingCSV(billing)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="partner_%s_%s.csv"`, request.From, request.To))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	}
+}
+
+// Сводка оплат клиентов партнера в CSV: строка на организацию и валюту
+func partnerBillingCSV(billing *models.PartnerBilling) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = ';'
+	writer.Write([]string{"ИНН", "Организация", "Валюта", "Платежей", "Оплачено", "Вознаграждение"})
+	for _, line := range billing.Lines {
+		writer.Write([]string{line.INN, line.Name, line.Currency, strconv.Itoa(line.Payments),
+			line.Paid.String(), line.Share.String()})
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// Обработчик партнеров для администратора: GET - список, POST - подключение партнера
+// или изменение его условий
+func (s *Server) adminPartnersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			partners, err := s.svc.ListPartners(r.Context())
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.Partners{
+				Envelope: dto.OK(),
+				Partners: partners,
+			}, http.StatusOK)
+
+		case http.MethodPost:
+			var request service.PartnerRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+
+			partner, err := s.svc.SavePartner(r.Context(), requestActor(r, 0), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.Partner{
+				Envelope: dto.OK(),
+				Partner:  partner,
+			}, http.StatusOK)
+		}
+	}
+}
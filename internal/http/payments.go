@@ -0,0 +1,375 @@
+package http
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/models"
+	"project-znak/internal/service"
+	"project-znak/internal/xlsx"
+)
+
+// Наибольший размер уведомления Stripe
+const stripeWebhookMaxSize = 1 << 20
+
+// Обработчик создания платежа
+func (s *Server) createPaymentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request service.PaymentRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.logger.Printf("Ошибка декодирования JSON: %v", err)
+			response := dto.NewError("Неверный формат запроса")
+			response.Detail = err.Error()
+			sendResponse(w, response, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		result, err := s.svc.CreatePayment(r.Context(), requestActor(r, request.TelegramID), request)
+		if err != nil {
+			serviceErr := s.serviceError(r, err)
+			sendErrorMessage(w, serviceErr.Message, httpStatus(serviceErr.Kind))
+			return
+		}
+
+		sendResponse(w, dto.PaymentCreated{
+			Envelope:    dto.Done("Платеж создан"),
+			PaymentID:   result.PaymentID,
+			RedirectURL: result.RedirectURL,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик POST /api/payments/batch - один платеж на несколько заказов
+func (s *Server) createBatchPaymentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request service.BatchPaymentRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		result, err := s.svc.CreateBatchPayment(r.Context(), requestActor(r, request.TelegramID), request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.PaymentCreated{
+			Envelope:    dto.Done("Платеж создан"),
+			PaymentID:   result.PaymentID,
+			RedirectURL: result.RedirectURL,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик истории платежей: GET /api/payments?status=&from=&to=&organization_id=&limit=&offset=.
+// С параметром format=csv или format=xlsx возвращает выписку за период файлом.
+func (s *Server) paymentsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		params := r.URL.Query()
+		format := params.Get("format")
+		if format != "" && format != "json" && format != "csv" && format != "xlsx" {
+			sendErrorMessage(w, "Формат должен быть json, csv или xlsx", http.StatusBadRequest)
+			return
+		}
+
+		request := service.PaymentListRequest{
+			Status: params.Get("status"),
+			From:   params.Get("from"),
+			To:     params.Get("to"),
+		}
+		for _, param := range []struct {
+			name string
+			dest *int
+		}{{"organization_id", &request.OrganizationID}, {"limit", &request.Limit}, {"offset", &request.Offset}} {
+			value := params.Get(param.name)
+			if value == "" {
+				continue
+			}
+			number, err := strconv.Atoi(value)
+			if err != nil || number < 0 {
+				sendErrorMessage(w, fmt.Sprintf("Параметр %s должен быть неотрицательным числом", param.name), http.StatusBadRequest)
+				return
+			}
+			*param.dest = number
+		}
+
+		if format == "" || format == "json" {
+			payments, err := s.svc.ListPayments(r.Context(), userID, request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.Payments{
+				Envelope: dto.OK(),
+				Payments: payments,
+			}, http.StatusOK)
+			return
+		}
+
+		payments, err := s.svc.PaymentStatement(r.Context(), userID, request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		rows := paymentStatementRows(payments, s.svc.UserLocation(r.Context(), userID))
+		var buf bytes.Buffer
+		contentType := "text/csv; charset=utf-8"
+		if format == "xlsx" {
+			contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+			err = xlsx.Write(&buf, "Платежи", rows)
+		} else {
+			err = writePaymentStatementCSV(&buf, rows)
+		}
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="payments_%s_%s.%s"`, request.From, request.To, format))
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.Write(buf.Bytes())
+	}
+}
+
+// Строки выписки по платежам с заголовком. Суммы записываются числами, даты - в часовом
+// поясе loc, отсутствующие заказ, счет и дата проведения - пустыми ячейками.
+func paymentStatementRows(payments []models.Payment, loc *time.Location) [][]any {
+	rows := [][]any{{"Платеж", "Дата", "Заказ", "Счет", "Сумма", "Валюта", "Статус", "Провайдер",
+		"Транзакция", "Дата проведения"}}
+	for _, payment := range payments {
+		row := []any{payment.ID, payment.CreatedAt.In(loc), nil, payment.InvoiceNumber, payment.Amount.Float64(),
+			payment.Currency, payment.Status, payment.Provider, payment.TransactionID, nil}
+		if payment.OrderID > 0 {
+			row[2] = payment.OrderID
+		}
+		if payment.CompletedAt != nil {
+			row[9] = payment.CompletedAt.In(loc)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Выписка по платежам в CSV с разделителем ";" и датами в формате ДД.ММ.ГГГГ ЧЧ:ММ
+func writePaymentStatementCSV(w io.Writer, rows [][]any) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = ';'
+	for _, row := range rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			switch v := value.(type) {
+			case nil:
+			case time.Time:
+				record[i] = v.Format("02.01.2006 15:04")
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Обработчик уведомления ResultURL от Robokassa. На принятое уведомление, в том числе
+// повторное по уже проведенному платежу, отвечаем OK<InvId>, иначе Robokassa повторяет его.
+func (s *Server) robokassaCallbackHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Получение параметров
+		r.ParseForm()
+
+		callback := service.RobokassaCallback{
+			InvID:          r.FormValue("InvId"),
+			OutSum:         r.FormValue("OutSum"),
+			SignatureValue: r.FormValue("SignatureValue"),
+			TransactionID:  r.FormValue("Shp_TransactionId"),
+			Params:         make(map[string]string),
+		}
+		for name := range r.Form {
+			if strings.HasPrefix(name, "Shp_") {
+				callback.Params[name] = r.FormValue(name)
+			}
+		}
+
+		if err := s.svc.CompletePayment(r.Context(), requestActor(r, 0), callback); err != nil {
+			// Robokassa ожидает текстовый ответ
+			serviceErr := service.AsError(err)
+			s.logger.Printf("Ошибка обработки callback Robokassa: %v", err)
+			http.Error(w, serviceErr.Message, httpStatus(serviceErr.Kind))
+			return
+		}
+
+		// Ответ для Robokassa
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("OK" + callback.InvID))
+	}
+}
+
+// Обработчик уведомлений Stripe: POST /api/payments/stripe/webhook. Подпись проверяется
+// по исходному телу запроса, поэтому тело читается целиком.
+func (s *Server) stripeWebhookHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(io.LimitReader(r.Body, stripeWebhookMaxSize))
+		if err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := s.svc.HandleStripeEvent(r.Context(), requestActor(r, 0), payload, r.Header.Get("Stripe-Signature")); err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+		sendResponse(w, dto.Message{Envelope: dto.OK()}, http.StatusOK)
+	}
+}
+
+// Обработчик статуса платежа: GET /api/payments/{id} или GET /api/payments/status?id=
+func (s *Server) paymentStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// ID передается в пути (/api/payments/{id}) или параметром (/api/payments/status?id=)
+		paymentIDStr := r.PathValue("id")
+		if paymentIDStr == "" {
+			paymentIDStr = r.URL.Query().Get("id")
+		}
+		if paymentIDStr == "" {
+			sendErrorMessage(w, "Необходимо указать id платежа", http.StatusBadRequest)
+			return
+		}
+
+		paymentID, err := strconv.Atoi(paymentIDStr)
+		if err != nil {
+			sendErrorMessage(w, "Некорректный ID платежа", http.StatusBadRequest)
+			return
+		}
+
+		telegramIDStr := r.URL.Query().Get("telegram_id")
+		if telegramIDStr == "" {
+			sendErrorMessage(w, "Необходимо указать telegram_id", http.StatusBadRequest)
+			return
+		}
+
+		telegramID, err := strconv.ParseInt(telegramIDStr, 10, 64)
+		if err != nil {
+			sendErrorMessage(w, "Некорректный telegram_id", http.StatusBadRequest)
+			return
+		}
+
+		payment, err := s.svc.GetPayment(r.Context(), paymentID, telegramID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Payment{
+			Envelope: dto.OK(),
+			Payment:  payment,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик списка платежей, отмеченных при сверке с Robokassa для проверки администратором
+func (s *Server) adminPaymentsReviewHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= 1000 {
+			limit = value
+		}
+
+		payments, err := s.svc.ListPaymentsForReview(r.Context(), limit)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Payments{
+			Envelope: dto.OK(),
+			Payments: payments,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик GET /api/admin/payments/providers - доступность платежных провайдеров
+func (s *Server) adminPaymentProvidersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendResponse(w, dto.PaymentProviders{
+			Envelope:  dto.OK(),
+			Providers: s.svc.PaymentProviders(),
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик POST /api/admin/payments/{id}/refund - возврат платежа Stripe
+func (s *Server) adminPaymentRefundHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paymentID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		payment, err := s.svc.RefundPayment(r.Context(), requestActor(r, 0), paymentID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+		sendResponse(w, dto.Payment{
+			Envelope: dto.Done("Платеж возвращен покупателю"),
+			Payment:  payment,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик POST /api/admin/payments/{id}/orders/{order_id}/refund - возврат по заказу
+// пакетного платежа Stripe
+func (s *Server) adminPaymentOrderRefundHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		paymentID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+		orderID, err := strconv.Atoi(r.PathValue("order_id"))
+		if err != nil || orderID <= 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		var request service.PaymentOrderRefund
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+		}
+
+		payment, err := s.svc.RefundPaymentOrder(r.Context(), requestActor(r, 0), paymentID, orderID, request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+		sendResponse(w, dto.Payment{
+			Envelope: dto.Done("Возврат по заказу проведен"),
+			Payment:  payment,
+		}, http.StatusOK)
+	}
+}
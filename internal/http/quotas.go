@@ -0,0 +1,115 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/models"
+)
+
+// Заголовки с состоянием суточной квоты запросов тарифного плана
+const (
+	headerQuotaLimit     = "X-Quota-Limit"
+	headerQuotaRemaining = "X-Quota-Remaining"
+	headerQuotaReset     = "X-Quota-Reset" // Unix-время начала следующего периода
+)
+
+// Передача состояния суточной квоты запросов в заголовках X-Quota-*; квота кодов
+// и неограниченная квота не передаются
+func setQuotaHeaders(w http.ResponseWriter, quota *models.Quota) {
+	if quota == nil || quota.Metric != models.QuotaRequests || quota.Remaining == nil {
+		return
+	}
+	w.Header().Set(headerQuotaLimit, strconv.FormatInt(quota.Limit, 10))
+	w.Header().Set(headerQuotaRemaining, strconv.FormatInt(*quota.Remaining, 10))
+	w.Header().Set(headerQuotaReset, strconv.FormatInt(quota.ResetsAt.Unix(), 10))
+}
+
+// Обработчик потребления по квотам тарифного плана пользователя
+func (s *Server) usageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := s.requireUserID(w, r, http.StatusBadRequest)
+		if userID == 0 {
+			return
+		}
+
+		usage, err := s.svc.Usage(r.Context(), userID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Usage{
+			Envelope: dto.OK(),
+			Plan:     usage.Plan,
+			Quotas:   usage.Quotas,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик списка тарифных планов
+func (s *Server) plansHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		plans, err := s.svc.ListPlans(r.Context())
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Plans{
+			Envelope: dto.OK(),
+			Plans:    plans,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик создания и изменения тарифного плана администратором
+func (s *Server) adminPlansHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var plan models.Plan
+		if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		updated, err := s.svc.SetPlan(r.Context(), requestActor(r, 0), plan)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Plan{
+			Envelope: dto.OK(),
+			Plan:     updated,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик назначения тарифного плана пользователю администратором
+func (s *Server) adminUserPlanHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			TelegramID int64  `json:"telegram_id"`
+			Plan       string `json:"plan"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		if err := s.svc.SetUserPlan(r.Context(), requestActor(r, 0), request.TelegramID, request.Plan); err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.UserPlan{
+			Envelope:   dto.OK(),
+			TelegramID: request.TelegramID,
+			Plan:       request.Plan,
+		}, http.StatusOK)
+	}
+}
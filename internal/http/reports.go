@@ -0,0 +1,119 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик списка отчетов пользователя: GET /api/reports?telegram_id=&limit=
+func (s *Server) reportsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		limit := 30
+		if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= 1000 {
+			limit = value
+		}
+
+		reports, err := s.svc.ListReports(r.Context(), userID, limit)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Reports{
+			Envelope: dto.OK(),
+			Reports:  reports,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик отчета: GET /api/reports/{id}
+func (s *Server) reportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reportID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		report, err := s.svc.GetReport(r.Context(), userID, reportID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Report{
+			Envelope: dto.OK(),
+			Report:   report,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик настроек отчетов: GET/POST /api/users/reports
+func (s *Server) reportSettingsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.getReportSettings(w, r)
+		case http.MethodPost:
+			s.updateReportSettings(w, r)
+		}
+	}
+}
+
+// Получение настроек отчетов
+func (s *Server) getReportSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.resolveUserID(r)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+	if userID == 0 {
+		sendErrorMessage(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+
+	settings, err := s.svc.ReportSettings(r.Context(), userID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.ReportSettings{
+		Envelope: dto.OK(),
+		Reports:  settings,
+	}, http.StatusOK)
+}
+
+// Изменение настроек отчетов
+func (s *Server) updateReportSettings(w http.ResponseWriter, r *http.Request) {
+	var request service.ReportSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	settings, err := s.svc.UpdateReportSettings(r.Context(), requestActor(r, request.TelegramID), request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.ReportSettings{
+		Envelope: dto.OK(),
+		Reports:  settings,
+	}, http.StatusOK)
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Создание и отправка документа вывода из оборота
+func (s *Server) createRetirementDocument(w http.ResponseWriter, r *http.Request) {
+	var request service.RetirementRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	doc, err := s.svc.CreateRetirementDocument(r.Context(), requestActor(r, request.TelegramID), request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.RetirementDocument{
+		Envelope: dto.Done("Документ отправлен в Честный ЗНАК"),
+		Document: doc,
+	}, http.StatusCreated)
+}
+
+// Список документов вывода из оборота пользователя
+func (s *Server) listRetirementDocuments(w http.ResponseWriter, r *http.Request) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	limit := 10 // По умолчанию 10 записей
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		if _, err := fmt.Sscanf(limitParam, "%d", &limit); err != nil || limit <= 0 {
+			limit = 10
+		}
+	}
+
+	docs, err := s.svc.ListRetirementDocuments(r.Context(), userID, limit)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.RetirementDocuments{
+		Envelope:  dto.OK(),
+		Documents: docs,
+	}, http.StatusOK)
+}
+
+// Получение документа вывода из оборота с актуальным статусом обработки
+func (s *Server) getRetirementDocument(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	doc, err := s.svc.GetRetirementDocument(r.Context(), userID, documentID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.RetirementDocument{
+		Envelope: dto.OK(),
+		Document: doc,
+	}, http.StatusOK)
+}
+
+// Повторная отправка документа, который не удалось отправить при создании
+func (s *Server) submitRetirementDocument(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	doc, err := s.svc.SubmitRetirementDocument(r.Context(), requestActor(r, queryTelegramID(r)), userID, documentID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.RetirementDocument{
+		Envelope: dto.Done("Документ отправлен в Честный ЗНАК"),
+		Document: doc,
+	}, http.StatusOK)
+}
+
+// Выгрузка подписанной квитанции Честного ЗНАКа о выводе из оборота
+func (s *Server) retirementReceipt(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	receipt, err := s.svc.SignedRetirementReceipt(r.Context(), userID, documentID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+	sendSignedReceipt(w, receipt)
+}
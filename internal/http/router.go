@@ -0,0 +1,121 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"project-znak/pkg/middleware"
+)
+
+// Промежуточное ПО отдельного маршрута
+type routeMiddleware func(http.Handler) http.Handler
+
+// router - маршрутизатор на шаблонах ServeMux вида "GET /api/orders/{id}". Метод проверяется
+// при сопоставлении маршрута (шаблон GET обслуживает и HEAD): на запрос другим методом
+// ServeMux отвечает 405 с допустимыми методами в заголовке Allow.
+type router struct {
+	mux    *http.ServeMux
+	groups []routeGroup
+}
+
+// Группа маршрутов с общим префиксом пути
+type routeGroup struct {
+	prefix string
+	router *router
+}
+
+func newRouter() *router {
+	return &router{mux: http.NewServeMux()}
+}
+
+// handle регистрирует обработчик маршрута. Middleware маршрута применяются в указанном
+// порядке: первый выполняется первым.
+func (rt *router) handle(pattern string, handler http.Handler, middlewares ...routeMiddleware) {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	rt.mux.Handle(pattern, handler)
+}
+
+// group возвращает маршрутизатор для пути prefix и путей под ним. ServeMux не допускает
+// пересекающихся шаблонов, из которых ни один не специфичнее другого, например
+// GET /api/orders/{id}/invoice и GET /api/orders/schedules/{id}: маршруты вложенной
+// коллекции регистрируются в группе, которая проверяется раньше остальных маршрутов.
+func (rt *router) group(prefix string) *router {
+	group := newRouter()
+	rt.groups = append(rt.groups, routeGroup{prefix: prefix, router: group})
+	return group
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, group := range rt.groups {
+		if r.URL.Path == group.prefix || strings.HasPrefix(r.URL.Path, group.prefix+"/") {
+			group.router.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	if _, pattern := rt.mux.Handler(r); pattern != "" {
+		// Шаблон маршрута для журнала доступа
+		middleware.AccessInfoFromContext(r.Context()).SetRoute(pattern)
+	}
+	rt.mux.ServeHTTP(&methodNotAllowedWriter{ResponseWriter: w}, r)
+}
+
+// methodNotAllowedWriter заменяет текст ответа 405 от ServeMux на сообщение, которое
+// переводится на язык пользователя, как остальные текстовые ошибки
+type methodNotAllowedWriter struct {
+	http.ResponseWriter
+	replaced bool
+}
+
+func (mw *methodNotAllowedWriter) WriteHeader(code int) {
+	if code == http.StatusMethodNotAllowed && !mw.replaced {
+		mw.replaced = true
+		http.Error(mw.ResponseWriter, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	mw.ResponseWriter.WriteHeader(code)
+}
+
+func (mw *methodNotAllowedWriter) Write(p []byte) (int, error) {
+	if mw.replaced {
+		return len(p), nil
+	}
+	return mw.ResponseWriter.Write(p)
+}
+
+func (mw *methodNotAllowedWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+// Числовой параметр {id} пути запроса. Если параметр не является положительным числом,
+// отвечает 404, как на несуществующий маршрут.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return 0, false
+	}
+	return id, true
+}
+
+// Шаблон пути маршрута, обслуживающего запрос, без метода: "/api/orders/{id}"
+func routePath(r *http.Request) string {
+	if _, path, ok := strings.Cut(r.Pattern, " "); ok {
+		return path
+	}
+	return r.Pattern
+}
+
+// Обработчик маршрута с числовым параметром {id}
+func withPathID(handle func(w http.ResponseWriter, r *http.Request, id int)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+		handle(w, r, id)
+	}
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	rt := newRouter()
+	route := func(w http.ResponseWriter, r *http.Request, id int) {
+		fmt.Fprintf(w, "%s %d", routePath(r), id)
+	}
+	rt.handle("GET /api/orders/{id}", withPathID(route))
+	rt.handle("POST /api/orders/{id}/cancel", withPathID(route))
+	rt.handle("GET /api/orders/{id}/invoice", withPathID(route))
+	schedules := rt.group("/api/orders/schedules")
+	schedules.handle("GET /api/orders/schedules", withPathID(route))
+	schedules.handle("GET /api/orders/schedules/{id}", withPathID(route))
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "/api/orders/42", http.StatusOK, "/api/orders/{id} 42"},
+		{http.MethodPost, "/api/orders/7/cancel", http.StatusOK, "/api/orders/{id}/cancel 7"},
+		{http.MethodGet, "/api/orders/7/invoice", http.StatusOK, "/api/orders/{id}/invoice 7"},
+		{http.MethodGet, "/api/orders/schedules/3", http.StatusOK, "/api/orders/schedules/{id} 3"},
+		{http.MethodGet, "/api/orders/schedules/invoice", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/orders/abc", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/orders/0", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/orders/7/unknown", http.StatusNotFound, ""},
+		{http.MethodDelete, "/api/orders/7", http.StatusMethodNotAllowed, "Метод не поддерживается\n"},
+		{http.MethodGet, "/api/orders/7/cancel", http.StatusMethodNotAllowed, "Метод не поддерживается\n"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: статус %d, ожидался %d", tt.method, tt.path, w.Code, tt.status)
+			continue
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s %s: ответ %q, ожидался %q", tt.method, tt.path, w.Body.String(), tt.body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/orders/7", nil))
+	if allow := w.Header().Get("Allow"); !strings.Contains(allow, http.MethodGet) {
+		t.Errorf("Allow = %q, ожидался метод GET", allow)
+	}
+}
@@ -0,0 +1,629 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"project-znak/internal/config"
+	"project-znak/internal/dto"
+	"project-znak/internal/i18n"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/service"
+	"project-znak/internal/tracing"
+	applog "project-znak/pkg/logger"
+	"project-znak/pkg/middleware"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Server - обработчики REST API поверх сервисного слоя
+type Server struct {
+	svc      *service.Service
+	logger   *log.Logger
+	kizQueue *middleware.LaneQueue
+	versions config.APIVersionsConfig
+}
+
+// Handler - обработчик REST API. Лимиты запросов меняются без перезапуска через Reload.
+type Handler struct {
+	http.Handler
+	server  *Server
+	limiter *middleware.Limiter
+}
+
+// NewHandler создает обработчик REST API со всеми маршрутами и middleware. Запросы
+// записываются в журнал доступа accessLog. Адрес клиента берется из X-Forwarded-For
+// только за доверенными прокси proxies. Паники в обработчиках дополнительно
+// передаются в report, если он задан.
+func NewHandler(svc *service.Service, logger *log.Logger, accessLog *logrus.Logger, rateLimit config.RateLimitConfig,
+	compression config.CompressionConfig, limits config.RequestLimitsConfig, versions config.APIVersionsConfig,
+	proxies config.ProxyConfig, report middleware.PanicReporter) *Handler {
+	s := &Server{svc: svc, logger: logger, versions: versions}
+	rt := newRouter()
+
+	// Запросы КИЗ всех версий API делят общую очередь: пользователи приоритетных тарифных
+	// планов обслуживаются в первую очередь и имеют собственный пул обработчиков
+	s.kizQueue = middleware.NewLaneQueue([]middleware.Lane{
+		{Name: kizLanePremium, Workers: limits.KIZPremiumConcurrency, QueueSize: limits.KIZQueueSize},
+		{Name: kizLaneStandard, Workers: limits.KIZConcurrency, QueueSize: limits.KIZQueueSize},
+	}, s.kizQueueLane(limits.KIZPremiumPlans))
+	kizLimit := s.kizQueue.Middleware
+
+	// Маршруты регистрируются с методом: на запрос другим методом отвечает маршрутизатор.
+	// Разрешение в организации проверяется middleware маршрута s.permission, доступ
+	// администратора - s.adminOnly.
+	rt.handle("POST /api/kizs", s.kizHandler(), s.permission(models.PermKIZRequest), kizLimit)
+	rt.handle("GET /api/kizs/codes", s.kizCodesHandler(), s.permission(models.PermOrdersView))
+	rt.handle("POST /api/kizs/upload", s.kizUploadHandler(), s.permission(models.PermOrdersCreate))
+	rt.handle("POST /api/codes/status", s.codeStatusesHandler(), s.permission(models.PermOrdersView))
+	rt.handle("GET /api/codes/{cis}/status", s.codeStatusHandler())
+
+	// Эндпоинты для учета остатков кодов
+	rt.handle("GET /api/inventory", s.inventoryHandler(), s.permission(models.PermOrdersView))
+	rt.handle("POST /api/inventory/codes", s.inventoryCodesHandler(), s.permission(models.PermKIZRequest))
+	rt.handle("POST /api/inventory/reservations", s.reservationsHandler(), s.permission(models.PermKIZRequest))
+	rt.handle("GET /api/inventory/reservations/{id}", s.reservationHandler(), s.permission(models.PermOrdersView))
+	rt.handle("POST /api/inventory/reservations/{id}/release", s.reservationReleaseHandler(), s.permission(models.PermKIZRequest))
+	rt.handle("POST /api/inventory/reorder", s.reorderHandler(), s.permission(models.PermKIZRequest), kizLimit)
+
+	// Эндпоинты интеграции с Wildberries
+	rt.handle("POST /api/wildberries/bind", s.wildberriesBindHandler(), s.permission(models.PermKIZRequest))
+	rt.handle("GET /api/wildberries/bindings", s.wildberriesBindingsHandler(), s.permission(models.PermOrdersView))
+
+	// Эндпоинты интеграции с Ozon
+	rt.handle("GET /api/ozon/mappings", s.ozonMappingsHandler(), s.permission(models.PermOrdersView))
+	rt.handle("POST /api/ozon/mappings", s.ozonMappingsHandler(), s.permission(models.PermKIZRequest))
+	rt.handle("DELETE /api/ozon/mappings", s.ozonMappingsHandler(), s.permission(models.PermKIZRequest))
+	rt.handle("GET /api/ozon/submissions", s.ozonSubmissionsHandler(), s.permission(models.PermOrdersView))
+	rt.handle("POST /api/ozon/submissions", s.ozonSubmissionsHandler(), s.permission(models.PermKIZRequest))
+	rt.handle("GET /api/ozon/submissions/{id}", s.ozonSubmissionHandler(), s.permission(models.PermOrdersView))
+
+	// Эндпоинты обмена с 1С
+	rt.handle("GET /api/integrations/1c/export", s.oneCExportHandler(), s.permission(models.PermPaymentsView))
+	rt.handle("POST /api/integrations/1c/retail-sales", s.oneCRetailSalesHandler())
+
+	// Эндпоинты для отчетов пользователя
+	rt.handle("GET /api/reports", s.reportsHandler())
+	rt.handle("GET /api/reports/{id}", s.reportHandler())
+
+	// Шаблон GET обслуживает и HEAD
+	rt.handle("GET /healthz", s.livenessHandler())
+	rt.handle("GET /readyz", s.readinessHandler())
+	rt.handle("GET /health", s.readinessHandler())
+	rt.handle("GET /metrics", s.metricsHandler())
+	rt.handle("GET /api/status", s.statusHandler())
+
+	// Эндпоинты для пользователей
+	rt.handle("GET /api/users", s.usersHandler())
+	rt.handle("POST /api/users/register", s.registerUserHandler())
+	rt.handle("GET /api/users/notifications", s.notificationPreferencesHandler())
+	rt.handle("POST /api/users/notifications", s.notificationPreferencesHandler())
+	rt.handle("GET /api/users/language", s.userLanguageHandler())
+	rt.handle("POST /api/users/language", s.userLanguageHandler())
+	rt.handle("GET /api/users/timezone", s.userTimezoneHandler())
+	rt.handle("POST /api/users/timezone", s.userTimezoneHandler())
+	rt.handle("GET /api/users/labels", s.labelSettingsHandler())
+	rt.handle("POST /api/users/labels", s.labelSettingsHandler())
+	rt.handle("GET /api/users/reports", s.reportSettingsHandler())
+	rt.handle("POST /api/users/reports", s.reportSettingsHandler())
+	rt.handle("GET /api/users/wildberries", s.wildberriesTokenHandler())
+	rt.handle("POST /api/users/wildberries", s.wildberriesTokenHandler())
+	rt.handle("DELETE /api/users/wildberries", s.wildberriesTokenHandler())
+	rt.handle("GET /api/users/ozon", s.ozonCredentialsHandler())
+	rt.handle("POST /api/users/ozon", s.ozonCredentialsHandler())
+	rt.handle("DELETE /api/users/ozon", s.ozonCredentialsHandler())
+	rt.handle("DELETE /api/users/me", s.deleteAccountHandler())
+	rt.handle("GET /api/users/me/export", s.exportUserDataHandler())
+	rt.handle("GET /api/referrals", s.referralsHandler())
+	rt.handle("GET /api/usage", s.usageHandler())
+	rt.handle("GET /api/labels/templates", s.labelTemplatesHandler())
+	rt.handle("GET /api/announcements", s.announcementsHandler())
+	rt.handle("GET /api/support/tickets", s.supportTicketsHandler())
+	rt.handle("POST /api/support/tickets", s.supportTicketsHandler())
+	rt.handle("GET /api/support/tickets/{id}", s.supportTicketHandler())
+	rt.handle("GET /api/keys", http.HandlerFunc(s.listAPIKeys))
+	rt.handle("POST /api/keys", http.HandlerFunc(s.createAPIKey))
+	rt.handle("POST /api/keys/{id}/rotate", http.HandlerFunc(s.rotateAPIKey))
+	rt.handle("POST /api/keys/{id}/revoke", http.HandlerFunc(s.revokeAPIKey))
+	rt.handle("GET /api/sessions", s.sessionsHandler())
+	rt.handle("POST /api/sessions/revoke-all", http.HandlerFunc(s.revokeOtherSessions))
+	rt.handle("DELETE /api/sessions/{id}", http.HandlerFunc(s.revokeAPIKey))
+	rt.handle("GET /api/confirmations/{id}", http.HandlerFunc(s.getConfirmation))
+	rt.handle("POST /api/confirmations/{id}/approve", s.confirmationDecisionHandler(true))
+	rt.handle("POST /api/confirmations/{id}/reject", s.confirmationDecisionHandler(false))
+
+	// Эндпоинты для работы с организациями
+	rt.handle("GET /api/organizations", http.HandlerFunc(s.listOrganizations))
+	rt.handle("POST /api/organizations", http.HandlerFunc(s.createOrganization))
+	rt.handle("GET /api/organizations/{id}", withPathID(s.getOrganization), s.permission(models.PermOrganizationView))
+	rt.handle("POST /api/organizations/{id}/members", withPathID(s.addOrganizationMember), s.permission(models.PermMembersManage))
+	rt.handle("POST /api/organizations/{id}/requisites", withPathID(s.updateRequisites), s.permission(models.PermPaymentsCreate))
+	rt.handle("GET /api/partners/accounts", s.partnerAccountsHandler())
+	rt.handle("POST /api/partners/accounts", s.partnerAccountsHandler())
+	rt.handle("GET /api/partners/billing", s.partnerBillingHandler())
+
+	// Административные эндпоинты
+	rt.handle("GET /api/admin/roles", s.adminRolesHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/audit", s.adminAuditHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/exchanges", s.adminExchangesHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/lockouts", s.adminLockoutsHandler(), s.adminOnly)
+	rt.handle("DELETE /api/admin/lockouts", s.adminLockoutsHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/db/stats", s.dbStatsHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/analytics", s.adminAnalyticsHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/organizations/{id}/roles", s.adminAssignRoleHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/tariffs", s.adminTariffsHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/plans", s.adminPlansHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/users/plan", s.adminUserPlanHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/users/import", s.adminUserImportHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/users/merge", s.adminUserMergeHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/partners", s.adminPartnersHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/partners", s.adminPartnersHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/payments/review", s.adminPaymentsReviewHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/payments/providers", s.adminPaymentProvidersHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/payments/{id}/refund", s.adminPaymentRefundHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/payments/{id}/orders/{order_id}/refund", s.adminPaymentOrderRefundHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/payments/{id}/receipt/retry", s.adminFiscalRetryHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/invoices", s.adminInvoicesHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/invoices/{id}/paid", s.adminInvoicePaidHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/fiscal", s.adminFiscalReceiptsHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/outbox", s.adminOutboxHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/outbox/{id}/retry", s.adminOutboxRetryHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/requests", s.adminFailedRequestsHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/requests/{id}/retry", s.adminRequestRetryHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/impersonations", s.adminImpersonationsHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/impersonations", s.adminImpersonationsHandler(), s.adminOnly)
+	rt.handle("DELETE /api/admin/impersonations/{id}", s.adminImpersonationHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/announcements", s.adminAnnouncementsHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/announcements", s.adminAnnouncementsHandler(), s.adminOnly)
+	rt.handle("DELETE /api/admin/announcements/{id}", s.adminAnnouncementHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/support/tickets", s.adminSupportTicketsHandler(), s.adminOnly)
+	rt.handle("GET /api/admin/support/tickets/{id}", s.adminSupportTicketHandler(), s.adminOnly)
+	rt.handle("POST /api/admin/support/tickets/{id}", s.adminSupportTicketHandler(), s.adminOnly)
+
+	// Эндпоинты для работы с историей запросов
+	rt.handle("GET /api/requests", s.requestsHandler())
+	rt.handle("GET /api/requests/{id}", s.requestStatusHandler(), s.permission(models.PermOrdersView))
+	rt.handle("GET /api/requests/status", s.requestStatusHandler(), s.permission(models.PermOrdersView))
+	rt.handle("GET /api/requests/{id}/status", s.requestStatusWaitHandler(), s.permission(models.PermOrdersView))
+	rt.handle("POST /api/requests/status/batch", s.requestStatusBatchHandler(), s.permission(models.PermOrdersView))
+	rt.handle("GET /api/requests/events", s.requestEventsHandler(), s.permission(models.PermOrdersView))
+	rt.handle("GET /api/requests/download", s.kizDownloadHandler())
+	rt.handle("POST /api/requests/{id}/retry", s.requestRetryHandler(), s.permission(models.PermKIZRequest))
+
+	// Тарифы по товарным группам и тарифные планы
+	rt.handle("GET /api/tariffs", s.tariffsHandler())
+	rt.handle("GET /api/plans", s.plansHandler())
+
+	// Эндпоинты для работы с заказами. Шаблоны и расписания - вложенные коллекции заказов,
+	// поэтому их маршруты зарегистрированы в отдельных группах.
+	rt.handle("GET /api/orders", http.HandlerFunc(s.listOrders), s.permission(models.PermOrdersView))
+	rt.handle("POST /api/orders", http.HandlerFunc(s.createOrder), s.permission(models.PermOrdersCreate))
+	rt.handle("GET /api/orders/{id}", withPathID(s.getOrder), s.permission(models.PermOrdersView))
+	rt.handle("POST /api/orders/{id}/cancel", withPathID(s.cancelOrder), s.permission(models.PermOrdersCancel))
+	rt.handle("POST /api/orders/{id}/reorder", withPathID(s.reorder), s.permission(models.PermOrdersCreate))
+	rt.handle("POST /api/orders/{id}/invoice", withPathID(s.issueInvoice), s.permission(models.PermPaymentsCreate))
+	rt.handle("GET /api/orders/{id}/invoice", withPathID(s.invoicePDF), s.permission(models.PermPaymentsView))
+	templates := rt.group("/api/orders/templates")
+	templates.handle("GET /api/orders/templates", s.orderTemplatesHandler(), s.permission(models.PermOrdersView))
+	templates.handle("POST /api/orders/templates", s.orderTemplatesHandler(), s.permission(models.PermOrdersCreate))
+	templates.handle("GET /api/orders/templates/{id}", withPathID(s.getOrderTemplate), s.permission(models.PermOrdersView))
+	templates.handle("PUT /api/orders/templates/{id}", withPathID(s.updateOrderTemplate), s.permission(models.PermOrdersCreate))
+	templates.handle("DELETE /api/orders/templates/{id}", withPathID(s.deleteOrderTemplate), s.permission(models.PermOrdersCreate))
+	templates.handle("POST /api/orders/templates/{id}/order", withPathID(s.orderFromTemplate), s.permission(models.PermOrdersCreate))
+	schedules := rt.group("/api/orders/schedules")
+	schedules.handle("GET /api/orders/schedules", s.orderSchedulesHandler(), s.permission(models.PermOrdersView))
+	schedules.handle("POST /api/orders/schedules", s.orderSchedulesHandler(), s.permission(models.PermOrdersCreate))
+	schedules.handle("GET /api/orders/schedules/{id}", withPathID(s.getOrderSchedule), s.permission(models.PermOrdersView))
+	schedules.handle("PUT /api/orders/schedules/{id}", withPathID(s.updateOrderSchedule), s.permission(models.PermOrdersCreate))
+	schedules.handle("DELETE /api/orders/schedules/{id}", withPathID(s.deleteOrderSchedule), s.permission(models.PermOrdersCreate))
+	schedules.handle("POST /api/orders/schedules/{id}/pause", s.orderScheduleStatusHandler(false), s.permission(models.PermOrdersCreate))
+	schedules.handle("POST /api/orders/schedules/{id}/resume", s.orderScheduleStatusHandler(true), s.permission(models.PermOrdersCreate))
+	rt.handle("GET /api/cart", s.cartHandler())
+	rt.handle("PUT /api/cart", s.cartHandler())
+	rt.handle("DELETE /api/cart", s.cartHandler())
+	rt.handle("POST /api/cart/items", s.cartItemsHandler())
+	rt.handle("DELETE /api/cart/items/{gtin}", s.cartItemHandler())
+	rt.handle("POST /api/cart/checkout", s.cartCheckoutHandler(), s.permission(models.PermOrdersCreate))
+
+	// Эндпоинты для ввода товаров в оборот и вывода из оборота
+	rt.handle("GET /api/documents", http.HandlerFunc(s.listDocuments), s.permission(models.PermOrdersView))
+	rt.handle("POST /api/documents", http.HandlerFunc(s.createDocument), s.permission(models.PermKIZRequest))
+	rt.handle("GET /api/documents/{id}", withPathID(s.getDocument), s.permission(models.PermOrdersView))
+	rt.handle("POST /api/documents/{id}/submit", withPathID(s.submitDocument), s.permission(models.PermKIZRequest))
+	rt.handle("GET /api/documents/{id}/receipt", withPathID(s.documentReceipt), s.permission(models.PermOrdersView))
+	retirement := rt.group("/api/documents/retirement")
+	retirement.handle("GET /api/documents/retirement", http.HandlerFunc(s.listRetirementDocuments), s.permission(models.PermOrdersView))
+	retirement.handle("POST /api/documents/retirement", http.HandlerFunc(s.createRetirementDocument), s.permission(models.PermKIZRequest))
+	retirement.handle("GET /api/documents/retirement/{id}", withPathID(s.getRetirementDocument), s.permission(models.PermOrdersView))
+	retirement.handle("POST /api/documents/retirement/{id}/submit", withPathID(s.submitRetirementDocument), s.permission(models.PermKIZRequest))
+	retirement.handle("GET /api/documents/retirement/{id}/receipt", withPathID(s.retirementReceipt), s.permission(models.PermOrdersView))
+
+	// Эндпоинты УПД на оптовую отгрузку через ЭДО
+	upd := rt.group("/api/documents/upd")
+	upd.handle("GET /api/documents/upd", s.updDocumentsHandler(), s.permission(models.PermOrdersView))
+	upd.handle("POST /api/documents/upd", s.updDocumentsHandler(), s.permission(models.PermKIZRequest))
+	upd.handle("GET /api/documents/upd/{id}", withPathID(s.getUPD), s.permission(models.PermOrdersView))
+	upd.handle("GET /api/documents/upd/{id}/file", withPathID(s.updFile), s.permission(models.PermOrdersView))
+	incoming := upd.group("/api/documents/upd/incoming")
+	incoming.handle("GET /api/documents/upd/incoming", s.incomingUPDDocumentsHandler(), s.permission(models.PermOrdersView))
+	incoming.handle("POST /api/documents/upd/incoming", s.incomingUPDDocumentsHandler(), s.permission(models.PermKIZRequest))
+	incoming.handle("GET /api/documents/upd/incoming/{id}", withPathID(s.getIncomingUPD), s.permission(models.PermOrdersView))
+	incoming.handle("GET /api/documents/upd/incoming/{id}/file", withPathID(s.incomingUPDFile), s.permission(models.PermOrdersView))
+	incoming.handle("POST /api/documents/upd/incoming/{id}/accept", withPathID(s.acceptIncomingUPD), s.permission(models.PermKIZRequest))
+	incoming.handle("POST /api/documents/upd/incoming/{id}/reject", withPathID(s.rejectIncomingUPD), s.permission(models.PermKIZRequest))
+
+	// Эндпоинты для оплаты
+	rt.handle("GET /api/payments", s.paymentsHandler())
+	rt.handle("POST /api/payments/create", s.createPaymentHandler(), s.permission(models.PermPaymentsCreate))
+	rt.handle("POST /api/payments/batch", s.createBatchPaymentHandler(), s.permission(models.PermPaymentsCreate))
+	rt.handle("GET /api/payments/callback", s.robokassaCallbackHandler())
+	rt.handle("POST /api/payments/callback", s.robokassaCallbackHandler())
+	rt.handle("POST /api/payments/stripe/webhook", s.stripeWebhookHandler())
+	rt.handle("GET /api/payments/{id}", s.paymentStatusHandler(), s.permission(models.PermPaymentsView))
+	rt.handle("GET /api/payments/status", s.paymentStatusHandler(), s.permission(models.PermPaymentsView))
+	rt.handle("GET /api/payments/{id}/receipt", s.paymentReceiptHandler(), s.permission(models.PermPaymentsView))
+
+	// Эндпоинты прежнего API для Telegram-бота, устаревшие с LEGACY_API_DEPRECATED
+	rt.handle("POST /api/v1/kizs", s.legacyKIZHandler(),
+		s.deprecated("/api/v2/kizs"), s.permission(models.PermKIZRequest), kizLimit)
+	rt.handle("POST /kizs", s.legacyKIZHandler(),
+		s.deprecated("/api/v2/kizs"), s.permission(models.PermKIZRequest), kizLimit)
+	rt.handle("POST /api/v1/payments", s.legacyPaymentHandler(),
+		s.deprecated("/api/v2/payments/create"), s.permission(models.PermPaymentsCreate))
+	rt.handle("POST /pay", s.legacyPaymentHandler(),
+		s.deprecated("/api/v2/payments/create"), s.permission(models.PermPaymentsCreate))
+
+	// Статическая документация API
+	fileServer := http.FileServer(http.Dir("./docs"))
+	rt.handle("GET /docs/", http.StripPrefix("/docs/", fileServer))
+
+	// Применение middleware
+	handler := confirmationMiddleware(rt)
+	handler = s.authMiddleware(handler)
+	handler = identityMiddleware(handler)
+	handler = languageMiddleware(handler)
+	handler = formatMiddleware(handler)
+	// Загрузка файлов допускает тело запроса больше обычного
+	handler = middleware.BodyLimit(limits.MaxBodySize, map[string]int64{
+		"/api/kizs":                         limits.MaxUploadSize,
+		"/api/kizs/upload":                  limits.MaxUploadSize,
+		"/api/documents/upd/incoming":       limits.MaxUploadSize,
+		"/api/integrations/1c/retail-sales": limits.MaxUploadSize,
+		"/api/admin/users/import":           limits.MaxUploadSize,
+	})(handler)
+	// Выгрузка файлов, поток событий и документация передаются потоком, без ограничения времени
+	handler = middleware.Timeout(limits.Timeout, map[string]time.Duration{
+		"/api/kizs":                         limits.KIZTimeout,
+		"/api/v1/kizs":                      limits.KIZTimeout,
+		"/kizs":                             limits.KIZTimeout,
+		"/api/kizs/upload":                  limits.KIZTimeout,
+		"/api/inventory/reorder":            limits.KIZTimeout,
+		"/api/wildberries/bind":             limits.KIZTimeout,
+		"/api/ozon/submissions":             limits.KIZTimeout,
+		"/api/integrations/1c/retail-sales": limits.KIZTimeout,
+		"/api/documents/upd":                limits.KIZTimeout,
+		"/api/documents/upd/incoming":       limits.KIZTimeout,
+		"/api/documents/upd/incoming/":      limits.KIZTimeout,
+		"/api/requests/download":            0,
+		"/api/requests/events":              0,
+		"/api/requests/*/status":            0,
+		"/docs/":                            0,
+	})(handler)
+	// Версия API определяется до middleware, которые выбирают ограничения по пути: запросы
+	// к /api/v2 обрабатываются ими по путям /api, а их ошибки приводятся к единому формату
+	handler = apiVersionMiddleware(handler)
+	handler = middleware.Compression(compression.MinSize, compression.ContentTypes)(handler)
+	handler = middleware.LoggingMiddleware(accessLog)(handler)
+	handler = corsMiddleware(handler)
+	limiter := middleware.NewLimiter(rateLimit.RequestsPerSecond, rateLimit.Burst)
+	handler = limiter.Middleware(handler)
+	handler = clientIPMiddleware(parseTrustedProxies(proxies.TrustedProxies))(handler)
+	handler = middleware.Recovery(logger, report)(handler)
+	handler = middleware.SentryScope(handler)
+	handler = tracing.Handler(handler)
+
+	return &Handler{Handler: handler, server: s, limiter: limiter}
+}
+
+// Reload применяет новые лимиты запросов
+func (h *Handler) Reload(rateLimit config.RateLimitConfig) {
+	h.limiter.SetLimit(rateLimit.RequestsPerSecond, rateLimit.Burst)
+}
+
+// Обработчик проверки жизнеспособности: процесс запущен и обрабатывает запросы.
+// Зависимости не проверяются, чтобы сбой БД не приводил к перезапуску сервиса.
+func (s *Server) livenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendResponse(w, healthResponse(service.HealthStatusOK), http.StatusOK)
+	}
+}
+
+// Обработчик проверки готовности: состояние и время проверки каждой зависимости.
+// Если недоступна обязательная зависимость, возвращается 503.
+func (s *Server) readinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := s.svc.Readiness(r.Context())
+		statusCode := http.StatusOK
+		if !report.Ready() {
+			statusCode = http.StatusServiceUnavailable
+		}
+		sendResponse(w, dto.Readiness{
+			Health: healthResponse(report.Status),
+			Checks: report.Checks,
+		}, statusCode)
+	}
+}
+
+// Ответ проверки работоспособности с состоянием сервиса status
+func healthResponse(status string) dto.Health {
+	return dto.Health{
+		Envelope:  dto.Envelope{Status: status},
+		Timestamp: time.Now().Format(time.RFC3339),
+		Version:   "1.0.0",
+	}
+}
+
+// Обработчик метрик в текстовом формате Prometheus
+func (s *Server) metricsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if notAfter, ok := s.svc.CertificateExpiry(); ok {
+			fmt.Fprintln(w, "# HELP znak_certificate_expiry_days Дней до окончания действия сертификата ЭЦП; отрицательное значение - срок истек")
+			fmt.Fprintln(w, "# TYPE znak_certificate_expiry_days gauge")
+			fmt.Fprintf(w, "znak_certificate_expiry_days %.2f\n", time.Until(notAfter).Hours()/24)
+			fmt.Fprintln(w, "# HELP znak_certificate_not_after_seconds Время окончания действия сертификата ЭЦП, Unix time")
+			fmt.Fprintln(w, "# TYPE znak_certificate_not_after_seconds gauge")
+			fmt.Fprintf(w, "znak_certificate_not_after_seconds %d\n", notAfter.Unix())
+		}
+		leader := 0
+		if s.svc.IsLeader() {
+			leader = 1
+		}
+		fmt.Fprintln(w, "# HELP znak_leader Экземпляр выполняет фоновые задачи: 1 - ведущий, 0 - нет")
+		fmt.Fprintln(w, "# TYPE znak_leader gauge")
+		fmt.Fprintf(w, "znak_leader %d\n", leader)
+		writeDBMetrics(w, s.svc.DBStats())
+		if s.kizQueue != nil {
+			writeQueueMetrics(w, s.kizQueue.Stats())
+		}
+	}
+}
+
+// Метрики пулов соединений с БД с меткой pool (primary, replica)
+func writeDBMetrics(w io.Writer, pools []repository.PoolStats) {
+	metrics := []struct {
+		name, help, kind string
+		value            func(stats repository.PoolStats) float64
+	}{
+		{"znak_db_open_connections", "Открытые соединения пула", "gauge",
+			func(stats repository.PoolStats) float64 { return float64(stats.OpenConnections) }},
+		{"znak_db_in_use_connections", "Соединения пула, занятые запросами", "gauge",
+			func(stats repository.PoolStats) float64 { return float64(stats.InUse) }},
+		{"znak_db_idle_connections", "Свободные соединения пула", "gauge",
+			func(stats repository.PoolStats) float64 { return float64(stats.Idle) }},
+		{"znak_db_wait_count_total", "Число ожиданий свободного соединения", "counter",
+			func(stats repository.PoolStats) float64 { return float64(stats.WaitCount) }},
+		{"znak_db_wait_seconds_total", "Суммарное время ожидания свободного соединения", "counter",
+			func(stats repository.PoolStats) float64 { return stats.WaitDuration.Seconds() }},
+		{"znak_db_pool_available", "Пул используется для запросов: 1 - да, 0 - реплика исключена после ошибки", "gauge",
+			func(stats repository.PoolStats) float64 {
+				if stats.Available {
+					return 1
+				}
+				return 0
+			}},
+		{"znak_db_replica_fallbacks_total", "Запросы чтения, переключенные с реплики на основной пул", "counter",
+			func(stats repository.PoolStats) float64 { return float64(stats.Fallbacks) }},
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric.name, metric.kind)
+		for _, stats := range pools {
+			fmt.Fprintf(w, "%s{pool=%q} %g\n", metric.name, stats.Name, metric.value(stats))
+		}
+	}
+}
+
+// Метрики очереди запросов КИЗ с меткой lane (premium, standard)
+func writeQueueMetrics(w io.Writer, lanes []middleware.LaneStats) {
+	metrics := []struct {
+		name, help, kind string
+		value            func(stats middleware.LaneStats) float64
+	}{
+		{"znak_kiz_queue_workers", "Размер пула обработчиков полосы", "gauge",
+			func(stats middleware.LaneStats) float64 { return float64(stats.Workers) }},
+		{"znak_kiz_queue_busy_workers", "Занятые обработчики пула полосы", "gauge",
+			func(stats middleware.LaneStats) float64 { return float64(stats.Busy) }},
+		{"znak_kiz_queue_active", "Выполняемые запросы полосы", "gauge",
+			func(stats middleware.LaneStats) float64 { return float64(stats.Active) }},
+		{"znak_kiz_queue_depth", "Запросы полосы, ожидающие обработчика", "gauge",
+			func(stats middleware.LaneStats) float64 { return float64(stats.Queued) }},
+		{"znak_kiz_queue_rejected_total", "Запросы, отклоненные при заполненной очереди полосы", "counter",
+			func(stats middleware.LaneStats) float64 { return float64(stats.Rejected) }},
+		{"znak_kiz_queue_abandoned_total", "Запросы, отмененные до получения обработчика", "counter",
+			func(stats middleware.LaneStats) float64 { return float64(stats.Abandoned) }},
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric.name, metric.kind)
+		for _, stats := range lanes {
+			fmt.Fprintf(w, "%s{lane=%q} %g\n", metric.name, stats.Name, metric.value(stats))
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP znak_kiz_queue_wait_seconds Время ожидания обработчика принятыми запросами")
+	fmt.Fprintln(w, "# TYPE znak_kiz_queue_wait_seconds histogram")
+	for _, stats := range lanes {
+		for i, bound := range stats.WaitBuckets {
+			fmt.Fprintf(w, "znak_kiz_queue_wait_seconds_bucket{lane=%q,le=\"%g\"} %d\n", stats.Name, bound, stats.WaitCounts[i])
+		}
+		fmt.Fprintf(w, "znak_kiz_queue_wait_seconds_bucket{lane=%q,le=\"+Inf\"} %d\n", stats.Name, stats.Admitted)
+		fmt.Fprintf(w, "znak_kiz_queue_wait_seconds_sum{lane=%q} %g\n", stats.Name, stats.WaitSeconds)
+		fmt.Fprintf(w, "znak_kiz_queue_wait_seconds_count{lane=%q} %d\n", stats.Name, stats.Admitted)
+	}
+}
+
+// Отправка ответа API в формате, выбранном по заголовку Accept: сообщение и ошибки полей
+// переводятся на язык ответа
+func sendResponse(w http.ResponseWriter, response dto.Response, statusCode int) {
+	if lang := responseLanguage(w); lang != i18n.Default {
+		response = localizeResponse(lang, response)
+	}
+	if responseFormat(w) == formatXML {
+		writeXML(w, response, statusCode)
+		return
+	}
+	writeJSON(w, response, statusCode)
+}
+
+// Отправка ошибки с сообщением: {"status": "error", "message": ...}
+func sendErrorMessage(w http.ResponseWriter, message string, statusCode int) {
+	sendResponse(w, dto.NewError(message), statusCode)
+}
+
+// Запись значения в формате JSON
+func writeJSON(w http.ResponseWriter, value any, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
+
+// Запись значения в формате XML с корневым элементом <response>
+func writeXML(w http.ResponseWriter, value any, statusCode int) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(statusCode)
+	dto.EncodeXML(w, value)
+}
+
+// HTTP-статус, соответствующий категории ошибки сервиса
+func httpStatus(kind service.Kind) int {
+	switch kind {
+	case service.KindInvalid:
+		return http.StatusBadRequest
+	case service.KindNotFound:
+		return http.StatusNotFound
+	case service.KindForbidden:
+		return http.StatusForbidden
+	case service.KindConflict:
+		return http.StatusConflict
+	case service.KindUnavailable:
+		return http.StatusServiceUnavailable
+	case service.KindConfirmationRequired:
+		return http.StatusPreconditionRequired
+	case service.KindTooManyRequests:
+		return http.StatusTooManyRequests
+	case service.KindPaymentRequired:
+		return http.StatusPaymentRequired
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Приведение ошибки к ошибке сервиса; внутренние ошибки логируются
+func (s *Server) serviceError(r *http.Request, err error) *service.Error {
+	serviceErr := service.AsError(err)
+	if serviceErr.Kind == service.KindInternal {
+		s.logger.Printf("Ошибка обработки запроса %s %s: %v", r.Method, r.URL.Path, err)
+		applog.ReportError(r.Context(), err)
+	}
+	return serviceErr
+}
+
+// Отправка ошибки сервиса в формате {"status": "error", "message": ...}
+func (s *Server) sendError(w http.ResponseWriter, r *http.Request, err error) {
+	serviceErr := s.serviceError(r, err)
+	response := dto.Error{
+		Envelope: dto.Fail(serviceErr.Message),
+		Code:     serviceErr.Code,
+		// Ошибки проверки полей передаются списком: поле, код правила и описание
+		Errors: serviceErr.Fields,
+		// Клиент повторяет операцию с ID подтверждения после ввода кода из Telegram
+		Confirmation: serviceErr.Confirmation,
+		// Исчерпанная квота тарифного плана: лимит, потребление и начало следующего периода
+		Quota: serviceErr.Quota,
+	}
+	// Все ответы 429 содержат время до повтора в заголовке Retry-After и в поле retry_after
+	if serviceErr.RetryAfter > 0 {
+		retryAfter := int(serviceErr.RetryAfter.Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		if serviceErr.Kind == service.KindTooManyRequests {
+			response.RetryAfter = retryAfter
+		}
+	}
+	sendResponse(w, response, httpStatus(serviceErr.Kind))
+}
+
+// Отправка ошибки разбора тела запроса; тело больше допустимого размера - ответ 413
+func (s *Server) sendDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		sendErrorMessage(w, middleware.TooLargeMessage(tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	s.logger.Printf("Ошибка декодирования JSON: %v", err)
+	response := dto.NewError("Неверный формат запроса")
+	response.Detail = err.Error()
+	sendResponse(w, response, http.StatusBadRequest)
+}
+
+// Определение пользователя запроса: по API ключу (из контекста) или по telegram_id.
+// Возвращает 0, если пользователь не найден.
+func (s *Server) resolveUserID(r *http.Request) (int, error) {
+	if userID := service.UserIDFromContext(r.Context()); userID > 0 {
+		return userID, nil
+	}
+
+	telegramIDStr := r.URL.Query().Get("telegram_id")
+	if telegramIDStr == "" {
+		return 0, nil
+	}
+
+	telegramID, err := strconv.ParseInt(telegramIDStr, 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+
+	return s.svc.UserIDByTelegram(r.Context(), telegramID)
+}
+
+// Определение пользователя запроса с отправкой ответа, если он не найден.
+// Возвращает 0, если ответ уже отправлен.
+func (s *Server) requireUserID(w http.ResponseWriter, r *http.Request, missingStatus int) int {
+	userID, err := s.resolveUserID(r)
+	if err != nil {
+		s.sendError(w, r, err)
+		return 0
+	}
+	if userID == 0 {
+		sendErrorMessage(w, "Необходимо указать telegram_id или API ключ", missingStatus)
+	}
+	return userID
+}
+
+// Пользователь, авторизованный по API ключу, с ответом 401 для запроса без ключа: доступ
+// к аккаунту по одному telegram_id не выдается. Возвращает 0, если ответ уже отправлен.
+func requireAuthenticatedUserID(w http.ResponseWriter, r *http.Request) int {
+	userID := service.UserIDFromContext(r.Context())
+	if userID == 0 {
+		sendErrorMessage(w, "Необходим API ключ", http.StatusUnauthorized)
+	}
+	return userID
+}
+
+// Инициатор изменения по HTTP-запросу. Если пользователь не авторизован по API ключу,
+// в качестве инициатора используется переданный telegram_id.
+func requestActor(r *http.Request, telegramID int64) service.Actor {
+	middleware.AccessInfoFromContext(r.Context()).SetUser(service.UserIDFromContext(r.Context()), telegramID)
+	return service.Actor{
+		UserID:     service.UserIDFromContext(r.Context()),
+		TelegramID: telegramID,
+		IP:         clientIP(r),
+	}
+}
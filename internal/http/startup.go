@@ -0,0 +1,50 @@
+package http
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Через сколько секунд клиенту предлагается повторить запрос, пока сервис запускается
+const startupRetryAfter = "5"
+
+// StartupHandler принимает запросы с момента запуска процесса, пока сервис ожидает БД
+// и Redis. До вызова Ready проверка жизнеспособности проходит, проверка готовности
+// возвращает 503 со статусом starting, остальные запросы - 503 с заголовком Retry-After.
+// После Ready все запросы передаются обработчику REST API.
+type StartupHandler struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+// NewStartupHandler создает обработчик в состоянии запуска
+func NewStartupHandler() *StartupHandler {
+	return &StartupHandler{}
+}
+
+// Ready завершает запуск: дальнейшие запросы обрабатывает handler
+func (h *StartupHandler) Ready(handler http.Handler) {
+	h.handler.Store(&handler)
+}
+
+func (h *StartupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler := h.handler.Load(); handler != nil {
+		(*handler).ServeHTTP(w, r)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/healthz":
+		sendResponse(w, healthResponse(service.HealthStatusOK), http.StatusOK)
+	case "/readyz", "/health":
+		sendResponse(w, dto.Readiness{
+			Health: healthResponse(service.HealthStatusStarting),
+			Checks: []service.HealthCheck{},
+		}, http.StatusServiceUnavailable)
+	default:
+		w.Header().Set("Retry-After", startupRetryAfter)
+		sendErrorMessage(w, "Сервис запускается, повторите запрос позже", http.StatusServiceUnavailable)
+	}
+}
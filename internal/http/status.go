@@ -0,0 +1,31 @@
+package http
+
+import (
+	"net/http"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/i18n"
+)
+
+// Обработчик публичной страницы статуса: GET /api/status - состояние компонентов по последней
+// проверке и недавние инциденты. Не выполняет проверок сам и не требует авторизации.
+func (s *Server) statusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := s.svc.PublicStatus(r.Context())
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		lang := responseLanguage(w)
+		for i := range status.Incidents {
+			status.Incidents[i].Message = i18n.Translate(lang, status.Incidents[i].Message)
+		}
+
+		sendResponse(w, dto.ServiceStatus{
+			Envelope:   dto.Envelope{Status: status.Status},
+			Components: status.Components,
+			Incidents:  status.Incidents,
+		}, http.StatusOK)
+	}
+}
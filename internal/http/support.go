@@ -0,0 +1,139 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик обращений в поддержку: GET /api/support/tickets - обращения пользователя,
+// POST /api/support/tickets - новое обращение со ссылкой на запрос КИЗ или платеж
+func (s *Server) supportTicketsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userID := s.requireUserID(w, r, http.StatusUnauthorized)
+			if userID == 0 {
+				return
+			}
+
+			tickets, err := s.svc.ListSupportTickets(r.Context(), userID)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			sendResponse(w, dto.SupportTickets{
+				Envelope: dto.OK(),
+				Tickets:  tickets,
+			}, http.StatusOK)
+
+		case http.MethodPost:
+			var request service.SupportTicketRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+
+			ticket, err := s.svc.CreateSupportTicket(r.Context(), requestActor(r, request.TelegramID), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			sendResponse(w, dto.SupportTicket{
+				Envelope: dto.Done("Обращение отправлено в поддержку"),
+				Ticket:   ticket,
+			}, http.StatusCreated)
+		}
+	}
+}
+
+// Обработчик отдельного обращения пользователя: GET /api/support/tickets/{id}
+func (s *Server) supportTicketHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticketID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		ticket, err := s.svc.GetSupportTicket(r.Context(), userID, ticketID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.SupportTicket{
+			Envelope: dto.OK(),
+			Ticket:   ticket,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик обращений для поддержки: GET /api/admin/support/tickets?status=open
+func (s *Server) adminSupportTicketsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tickets, err := s.svc.ListAllSupportTickets(r.Context(), r.URL.Query().Get("status"))
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.SupportTickets{
+			Envelope: dto.OK(),
+			Tickets:  tickets,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик отдельного обращения для поддержки: GET /api/admin/support/tickets/{id},
+// POST /api/admin/support/tickets/{id} - смена статуса и ответ пользователю
+func (s *Server) adminSupportTicketHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticketID, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			ticket, err := s.svc.GetSupportTicket(r.Context(), 0, ticketID)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			sendResponse(w, dto.SupportTicket{
+				Envelope: dto.OK(),
+				Ticket:   ticket,
+			}, http.StatusOK)
+
+		case http.MethodPost:
+			var request service.SupportTicketUpdateRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+
+			ticket, err := s.svc.UpdateSupportTicket(r.Context(), requestActor(r, 0), ticketID, request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+
+			sendResponse(w, dto.SupportTicket{
+				Envelope: dto.Done("Обращение обновлено"),
+				Ticket:   ticket,
+			}, http.StatusOK)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/models"
+)
+
+// Обработчик списка тарифов по товарным группам
+func (s *Server) tariffsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tariffs, err := s.svc.ListTariffs(r.Context())
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Tariffs{
+			Envelope: dto.OK(),
+			Tariffs:  tariffs,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик изменения тарифа товарной группы администратором
+func (s *Server) adminTariffsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var tariff models.Tariff
+		if err := json.NewDecoder(r.Body).Decode(&tariff); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		updated, err := s.svc.SetTariff(r.Context(), requestActor(r, 0), tariff)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Tariff{
+			Envelope: dto.OK(),
+			Tariff:   updated,
+		}, http.StatusOK)
+	}
+}
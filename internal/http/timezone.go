@@ -0,0 +1,51 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project-znak/internal/dto"
+)
+
+// Обработчик часового пояса пользователя
+func (s *Server) userTimezoneHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userID := s.requireUserID(w, r, http.StatusBadRequest)
+			if userID == 0 {
+				return
+			}
+			sendResponse(w, dto.Timezone{
+				Envelope: dto.OK(),
+				Timezone: s.svc.UserLocation(r.Context(), userID).String(),
+			}, http.StatusOK)
+		case http.MethodPost:
+			s.updateUserTimezone(w, r)
+		}
+	}
+}
+
+// Изменение часового пояса пользователя
+func (s *Server) updateUserTimezone(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		TelegramID int64  `json:"telegram_id"`
+		Timezone   string `json:"timezone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	loc, err := s.svc.SetUserTimezone(r.Context(), requestActor(r, request.TelegramID), request.Timezone)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.Timezone{
+		Envelope: dto.OK(),
+		Timezone: loc.String(),
+	}, http.StatusOK)
+}
@@ -0,0 +1,254 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик УПД: POST /api/documents/upd - формирование и отправка через ЭДО,
+// GET /api/documents/upd?organization_id= - список документов организации
+func (s *Server) updDocumentsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var request service.UPDRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+
+			doc, err := s.svc.CreateUPD(r.Context(), requestActor(r, request.TelegramID), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.UPD{
+				Envelope: dto.Done("УПД отправлен покупателю"),
+				Document: doc,
+			}, http.StatusCreated)
+
+		case http.MethodGet:
+			userID := s.requireUserID(w, r, http.StatusUnauthorized)
+			if userID == 0 {
+				return
+			}
+			params := r.URL.Query()
+			organizationID, err := parseOptionalInt(params.Get("organization_id"))
+			if err != nil {
+				sendErrorMessage(w, "Некорректный ID организации", http.StatusBadRequest)
+				return
+			}
+			limit := 100
+			if value, err := strconv.Atoi(params.Get("limit")); err == nil && value > 0 && value <= 1000 {
+				limit = value
+			}
+
+			docs, err := s.svc.ListUPD(r.Context(), userID, organizationID, limit)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.UPDs{
+				Envelope:  dto.OK(),
+				Documents: docs,
+			}, http.StatusOK)
+		}
+	}
+}
+
+// Получение УПД с ответом покупателя: GET /api/documents/upd/{id}
+func (s *Server) getUPD(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	doc, err := s.svc.GetUPD(r.Context(), userID, documentID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+	sendResponse(w, dto.UPD{
+		Envelope: dto.OK(),
+		Document: doc,
+	}, http.StatusOK)
+}
+
+// Выгрузка подписанного файла УПД: GET /api/documents/upd/{id}/file
+func (s *Server) updFile(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	name, data, err := s.svc.UPDFile(r.Context(), userID, documentID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+	sendUPDFile(w, name, data)
+}
+
+// Обработчик входящих УПД: GET /api/documents/upd/incoming?organization_id=&status= -
+// загрузка новых документов от оператора ЭДО и список документов организации,
+// POST /api/documents/upd/incoming?organization_id= - загрузка файла УПД, полученного
+// вне оператора ЭДО
+func (s *Server) incomingUPDDocumentsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+		if r.Method == http.MethodPost {
+			s.uploadIncomingUPD(w, r, userID)
+			return
+		}
+		params := r.URL.Query()
+		organizationID, err := parseOptionalInt(params.Get("organization_id"))
+		if err != nil {
+			sendErrorMessage(w, "Некорректный ID организации", http.StatusBadRequest)
+			return
+		}
+		limit := 100
+		if value, err := strconv.Atoi(params.Get("limit")); err == nil && value > 0 && value <= 1000 {
+			limit = value
+		}
+
+		docs, err := s.svc.ListIncomingUPD(r.Context(), userID, organizationID, params.Get("status"), limit)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+		sendResponse(w, dto.IncomingUPDs{
+			Envelope:  dto.OK(),
+			Documents: docs,
+		}, http.StatusOK)
+	}
+}
+
+// Загрузка файла входящего УПД XML полем file формы multipart/form-data или телом запроса.
+// ID организации передается параметром или полем формы organization_id.
+func (s *Server) uploadIncomingUPD(w http.ResponseWriter, r *http.Request, userID int) {
+	file, err := openUpload(r, xmlUpload)
+	if err != nil {
+		s.sendUploadError(w, err)
+		return
+	}
+	content, err := io.ReadAll(file)
+	r.Body.Close()
+	if err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+
+	value := r.URL.Query().Get("organization_id")
+	if value == "" {
+		value = file.Fields["organization_id"]
+	}
+	organizationID, err := parseOptionalInt(value)
+	if err != nil {
+		sendErrorMessage(w, "Некорректный ID организации", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := s.svc.UploadIncomingUPD(r.Context(), requestActor(r, 0), userID, organizationID, file.Name, content)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+	sendResponse(w, dto.IncomingUPD{
+		Envelope: dto.Done("УПД загружен"),
+		Document: doc,
+	}, http.StatusCreated)
+}
+
+// Получение входящего УПД с кодами маркировки: GET /api/documents/upd/incoming/{id}
+func (s *Server) getIncomingUPD(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	doc, err := s.svc.GetIncomingUPD(r.Context(), userID, documentID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+	sendResponse(w, dto.IncomingUPD{
+		Envelope: dto.OK(),
+		Document: doc,
+	}, http.StatusOK)
+}
+
+// Выгрузка файла входящего УПД: GET /api/documents/upd/incoming/{id}/file
+func (s *Server) incomingUPDFile(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	name, data, err := s.svc.IncomingUPDFile(r.Context(), userID, documentID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+	sendUPDFile(w, name, data)
+}
+
+// Приемка товаров по входящему УПД: POST /api/documents/upd/incoming/{id}/accept
+func (s *Server) acceptIncomingUPD(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	doc, err := s.svc.AcceptIncomingUPD(r.Context(), requestActor(r, queryTelegramID(r)), userID, documentID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+	sendResponse(w, dto.IncomingUPD{
+		Envelope: dto.Done("Товары приняты, титул покупателя отправлен поставщику"),
+		Document: doc,
+	}, http.StatusOK)
+}
+
+// Отказ в подписи входящего УПД: POST /api/documents/upd/incoming/{id}/reject
+func (s *Server) rejectIncomingUPD(w http.ResponseWriter, r *http.Request, documentID int) {
+	userID := s.requireUserID(w, r, http.StatusUnauthorized)
+	if userID == 0 {
+		return
+	}
+
+	var request service.RejectUPDRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	doc, err := s.svc.RejectIncomingUPD(r.Context(), requestActor(r, queryTelegramID(r)), userID, documentID, request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+	sendResponse(w, dto.IncomingUPD{
+		Envelope: dto.Done("Отказ в подписи отправлен поставщику"),
+		Document: doc,
+	}, http.StatusOK)
+}
+
+// Выгрузка файла УПД XML в кодировке windows-1251
+func sendUPDFile(w http.ResponseWriter, name string, data []byte) {
+	w.Header().Set("Content-Type", "application/xml; charset=windows-1251")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
@@ -0,0 +1,210 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Поле формы multipart/form-data с загружаемым файлом
+const uploadFileField = "file"
+
+// Наибольшая длина значения текстового поля формы
+const maxUploadFieldSize = 64 << 10 // 64KB
+
+// Наибольшее число кодов в файле GTIN для запроса КИЗ
+const maxUploadGTINCodes = 100000
+
+// uploadType - допустимые расширения имени и типы содержимого загружаемого файла
+type uploadType struct {
+	name         string // Название форматов для сообщения об ошибке
+	extensions   []string
+	contentTypes []string
+}
+
+var (
+	csvUpload = uploadType{"CSV", []string{".csv", ".txt"},
+		[]string{"text/csv", "text/plain", "application/csv", "application/vnd.ms-excel"}}
+	xmlUpload = uploadType{"XML", []string{".xml"},
+		[]string{"application/xml", "text/xml"}}
+	spreadsheetUpload = uploadType{"CSV, XLSX", []string{".csv", ".txt", ".xlsx"},
+		[]string{"text/csv", "text/plain", "application/csv", "application/vnd.ms-excel",
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "application/zip"}}
+	retailSalesUpload = uploadType{"CommerceML, CSV", []string{".xml", ".csv", ".txt"},
+		[]string{"application/xml", "text/xml", "text/csv", "text/plain", "application/csv", "application/vnd.ms-excel"}}
+)
+
+// Проверка имени и типа содержимого файла. Пустые значения и application/octet-stream,
+// который браузеры указывают для неизвестных расширений, не проверяются.
+func (t uploadType) check(name, contentType string) error {
+	if ext := strings.ToLower(filepath.Ext(name)); name != "" && !slices.Contains(t.extensions, ext) {
+		return &uploadError{http.StatusUnsupportedMediaType, fmt.Sprintf("Недопустимый тип файла, ожидается %s", t.name)}
+	}
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != "application/octet-stream" && !slices.Contains(t.contentTypes, mediaType)) {
+		return &uploadError{http.StatusUnsupportedMediaType, fmt.Sprintf("Недопустимый тип файла, ожидается %s", t.name)}
+	}
+	return nil
+}
+
+// uploadError - ошибка загрузки файла, о которой сообщается клиенту
+type uploadError struct {
+	status  int
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return e.message
+}
+
+// upload - загружаемый файл, который читается потоком из тела запроса
+type upload struct {
+	io.Reader
+	Name   string            // Имя файла; пустое, если файл передан телом запроса
+	Fields map[string]string // Текстовые поля формы, переданные перед файлом
+}
+
+// Передан ли запрос формой multipart/form-data
+func isMultipart(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "multipart/form-data"
+}
+
+// Открытие загружаемого файла. Файл передается полем file формы multipart/form-data
+// или телом запроса; в форме текстовые поля должны предшествовать файлу, поля после
+// файла не читаются. Тип содержимого проверяется только у файла формы, так как
+// клиенты, передающие файл телом запроса, часто указывают произвольный тип.
+func openUpload(r *http.Request, kind uploadType) (*upload, error) {
+	if !isMultipart(r) {
+		return &upload{Reader: r.Body, Fields: map[string]string{}}, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, &uploadError{http.StatusBadRequest, "Неверный формат запроса"}
+	}
+	fields := make(map[string]string)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, &uploadError{http.StatusBadRequest, "Не передан файл в поле file"}
+		} else if err != nil {
+			return nil, uploadReadError(err)
+		}
+
+		if part.FormName() == uploadFileField && part.FileName() != "" {
+			if err := kind.check(part.FileName(), part.Header.Get("Content-Type")); err != nil {
+				return nil, err
+			}
+			return &upload{Reader: part, Name: part.FileName(), Fields: fields}, nil
+		}
+		if part.FileName() != "" {
+			continue
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxUploadFieldSize+1))
+		if err != nil {
+			return nil, uploadReadError(err)
+		}
+		if len(value) > maxUploadFieldSize {
+			return nil, &uploadError{http.StatusBadRequest, fmt.Sprintf("Слишком длинное значение поля %s", part.FormName())}
+		}
+		fields[part.FormName()] = string(value)
+	}
+}
+
+// Ошибка чтения тела запроса: превышение размера передается как есть для ответа 413
+func uploadReadError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	return &uploadError{http.StatusBadRequest, "Неверный формат запроса"}
+}
+
+// Ответ с ошибкой загрузки файла
+func (s *Server) sendUploadError(w http.ResponseWriter, err error) {
+	var uploadErr *uploadError
+	if errors.As(err, &uploadErr) {
+		sendErrorMessage(w, uploadErr.message, uploadErr.status)
+		return
+	}
+	s.sendDecodeError(w, err)
+}
+
+// Чтение списка GTIN из CSV: в строке GTIN и необязательное количество кодов (по умолчанию 1),
+// разделитель - точка с запятой, запятая или табуляция. Первая строка пропускается, если
+// вместо GTIN в ней заголовок. GTIN повторяется по числу кодов, как в запросе КИЗ.
+func readGTINs(r io.Reader) ([]string, error) {
+	reader := bufio.NewReader(r)
+	head, _ := reader.Peek(4096)
+	if bom := []byte("\uFEFF"); bytes.HasPrefix(head, bom) {
+		reader.Discard(len(bom))
+		head = head[len(bom):]
+	}
+	if end := bytes.IndexByte(head, '\n'); end >= 0 {
+		head = head[:end]
+	}
+
+	records := csv.NewReader(reader)
+	records.FieldsPerRecord = -1
+	records.TrimLeadingSpace = true
+	switch {
+	case bytes.IndexByte(head, ';') >= 0:
+		records.Comma = ';'
+	case bytes.IndexByte(head, '\t') >= 0:
+		records.Comma = '\t'
+	}
+
+	var gtins []string
+	for first := true; ; first = false {
+		record, err := records.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, &uploadError{http.StatusBadRequest, fmt.Sprintf("Ошибка чтения CSV в строке %d", parseErr.Line)}
+			}
+			return nil, uploadReadError(err)
+		}
+		row, _ := records.FieldPos(0)
+
+		gtin := strings.TrimSpace(record[0])
+		if gtin == "" {
+			continue
+		}
+		if first && strings.IndexFunc(gtin, func(c rune) bool { return c < '0' || c > '9' }) >= 0 {
+			continue
+		}
+		count := 1
+		if len(record) > 1 && strings.TrimSpace(record[1]) != "" {
+			count, err = strconv.Atoi(strings.TrimSpace(record[1]))
+			if err != nil || count <= 0 {
+				return nil, &uploadError{http.StatusBadRequest, fmt.Sprintf("Некорректное количество кодов в строке %d", row)}
+			}
+		}
+		if len(gtins)+count > maxUploadGTINCodes {
+			return nil, &uploadError{http.StatusBadRequest, fmt.Sprintf("В файле больше %d кодов", maxUploadGTINCodes)}
+		}
+		for i := 0; i < count; i++ {
+			gtins = append(gtins, gtin)
+		}
+	}
+	if len(gtins) == 0 {
+		return nil, &uploadError{http.StatusBadRequest, "В файле нет GTIN"}
+	}
+	return gtins, nil
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadGTINs(t *testing.T) {
+	gtins, err := readGTINs(strings.NewReader("\uFEFFGTIN;Количество\n04600000000012;2\n\n04600000000029\n"))
+	if err != nil {
+		t.Fatalf("ошибка чтения списка GTIN: %v", err)
+	}
+	want := []string{"04600000000012", "04600000000012", "04600000000029"}
+	if !slices.Equal(gtins, want) {
+		t.Errorf("получены GTIN %v, ожидались %v", gtins, want)
+	}
+
+	gtins, err = readGTINs(strings.NewReader("04600000000012,1\n04600000000029,3\n"))
+	if err != nil || len(gtins) != 4 {
+		t.Errorf("список с разделителем запятая прочитан неверно: %v %v", gtins, err)
+	}
+
+	var uploadErr *uploadError
+	if _, err := readGTINs(strings.NewReader("04600000000012;0\n")); !errors.As(err, &uploadErr) ||
+		uploadErr.message != "Некорректное количество кодов в строке 1" {
+		t.Errorf("ожидалась ошибка количества кодов, получена %v", err)
+	}
+	if _, err := readGTINs(strings.NewReader("GTIN\n")); !errors.As(err, &uploadErr) {
+		t.Errorf("ожидалась ошибка пустого списка, получена %v", err)
+	}
+}
+
+func TestOpenUpload(t *testing.T) {
+	form := func(fileName, contentType string) *http.Request {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("organization_id", "7")
+		header := make(map[string][]string)
+		header["Content-Disposition"] = []string{`form-data; name="file"; filename="` + fileName + `"`}
+		header["Content-Type"] = []string{contentType}
+		part, _ := writer.CreatePart(header)
+		part.Write([]byte("<Файл/>"))
+		writer.Close()
+		r := httptest.NewRequest(http.MethodPost, "/api/documents/upd/incoming", &body)
+		r.Header.Set("Content-Type", writer.FormDataContentType())
+		return r
+	}
+
+	file, err := openUpload(form("upd.xml", "text/xml"), xmlUpload)
+	if err != nil {
+		t.Fatalf("ошибка открытия файла формы: %v", err)
+	}
+	content, _ := io.ReadAll(file)
+	if file.Name != "upd.xml" || file.Fields["organization_id"] != "7" || string(content) != "<Файл/>" {
+		t.Errorf("файл формы прочитан неверно: %q %v %q", file.Name, file.Fields, content)
+	}
+
+	var uploadErr *uploadError
+	if _, err := openUpload(form("upd.pdf", "application/pdf"), xmlUpload); !errors.As(err, &uploadErr) ||
+		uploadErr.status != http.StatusUnsupportedMediaType {
+		t.Errorf("ожидалась ошибка 415 для файла PDF, получена %v", err)
+	}
+	if _, err := openUpload(form("upd.xml", "application/pdf"), xmlUpload); !errors.As(err, &uploadErr) {
+		t.Errorf("ожидалась ошибка типа содержимого, получена %v", err)
+	}
+
+	raw := httptest.NewRequest(http.MethodPost, "/api/documents/upd/incoming", strings.NewReader("<Файл/>"))
+	raw.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if file, err := openUpload(raw, xmlUpload); err != nil || file.Name != "" {
+		t.Errorf("файл в теле запроса не открыт: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик для регистрации пользователей
+func (s *Server) registerUserHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request service.UserRegistrationRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		result, err := s.svc.RegisterUser(r.Context(), requestActor(r, request.TelegramID), request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Registration{
+			Envelope:         dto.Done("Пользователь успешно зарегистрирован"),
+			UserID:           result.UserID,
+			OrganizationName: result.OrganizationName,
+			APIKey:           result.APIKey,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик для управления пользователями
+func (s *Server) usersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Получение информации о пользователе по TelegramID
+		telegramID := r.URL.Query().Get("telegram_id")
+		if telegramID == "" {
+			sendErrorMessage(w, "Необходимо указать telegram_id", http.StatusBadRequest)
+			return
+		}
+
+		tgID, err := strconv.ParseInt(telegramID, 10, 64)
+		if err != nil {
+			sendErrorMessage(w, "Некорректный telegram_id", http.StatusBadRequest)
+			return
+		}
+
+		user, err := s.svc.GetUser(r.Context(), tgID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.User{
+			Envelope: dto.OK(),
+			User:     user,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик реферальной программы: ссылка, приглашенные пользователи и бонусный баланс
+func (s *Server) referralsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := s.requireUserID(w, r, http.StatusBadRequest)
+		if userID == 0 {
+			return
+		}
+
+		stats, err := s.svc.ReferralStats(r.Context(), userID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Referrals{
+			Envelope:  dto.OK(),
+			Referrals: stats,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик настроек email-уведомлений пользователя
+func (s *Server) notificationPreferencesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.getNotificationPreferences(w, r)
+		case http.MethodPost:
+			s.updateNotificationPreferences(w, r)
+		}
+	}
+}
+
+// Получение настроек уведомлений
+func (s *Server) getNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.resolveUserID(r)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+	if userID == 0 {
+		sendErrorMessage(w, "Пользователь не найден", http.StatusNotFound)
+		return
+	}
+
+	prefs, err := s.svc.NotificationPreferences(r.Context(), userID)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.NotificationPreferences{
+		Envelope:      dto.OK(),
+		Notifications: prefs,
+	}, http.StatusOK)
+}
+
+// Изменение настроек уведомлений
+func (s *Server) updateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	var request service.NotificationPreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendDecodeError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	prefs, err := s.svc.UpdateNotificationPreferences(r.Context(), requestActor(r, request.TelegramID), request)
+	if err != nil {
+		s.sendError(w, r, err)
+		return
+	}
+
+	sendResponse(w, dto.NotificationPreferences{
+		Envelope:      dto.OK(),
+		Notifications: prefs,
+	}, http.StatusOK)
+}
+
+// Обработчик удаления аккаунта текущего пользователя: DELETE /api/users/me.
+// Аккаунт удаляется только по API ключу пользователя.
+func (s *Server) deleteAccountHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := requireAuthenticatedUserID(w, r)
+		if userID == 0 {
+			return
+		}
+
+		if err := s.svc.DeleteAccount(r.Context(), requestActor(r, 0), userID); err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.Message{Envelope: dto.Done("Аккаунт удален")}, http.StatusOK)
+	}
+}
+
+// Обработчик выгрузки данных текущего пользователя: GET /api/users/me/export.
+// Возвращает готовый ZIP-архив или 202, пока архив формируется. Данные выгружаются только
+// по API ключу пользователя.
+func (s *Server) exportUserDataHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := requireAuthenticatedUserID(w, r)
+		if userID == 0 {
+			return
+		}
+
+		export, data, err := s.svc.ExportUserData(r.Context(), requestActor(r, 0), userID)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		if data == nil {
+			sendResponse(w, dto.DataExport{
+				Envelope: dto.Done("Архив формируется, о готовности придет уведомление"),
+				Export:   export,
+			}, http.StatusAccepted)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export_%d.zip"`, export.ID))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	}
+}
@@ -0,0 +1,226 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Версии REST API. Версия 1 - пути /api/... с прежним форматом ответов. Версия 2 - те же
+// ресурсы по путям /api/v2/... с единым форматом ошибок: любая ошибка, в том числе 404, 405
+// и ошибки middleware, возвращается с полями status, code и message. Номер версии
+// передается в заголовке API-Version ответов на запросы к /api.
+const (
+	apiVersion1 = 1
+	apiVersion2 = 2
+
+	apiV2Prefix = "/api/v2"
+)
+
+type apiVersionKey struct{}
+
+// Версия API запроса
+func requestAPIVersion(r *http.Request) int {
+	if version, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return version
+	}
+	return apiVersion1
+}
+
+// apiVersionMiddleware определяет версию API по пути запроса. Запрос к /api/v2/... передается
+// дальше с путем /api/..., чтобы маршруты и ограничения по путям действовали для обеих версий,
+// а ошибки ответа приводятся к единому формату.
+func apiVersionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, apiV2Prefix)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			if r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/") {
+				w.Header().Set("API-Version", strconv.Itoa(apiVersion1))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("API-Version", strconv.Itoa(apiVersion2))
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/api" + rest
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = "/api" + strings.TrimPrefix(r.URL.RawPath, apiV2Prefix)
+		}
+		r2 = r2.WithContext(context.WithValue(r.Context(), apiVersionKey{}, apiVersion2))
+
+		uw := &unifiedErrorWriter{ResponseWriter: w, format: negotiateFormat(r.Header.Get("Accept"))}
+		next.ServeHTTP(uw, r2)
+		uw.finish()
+	})
+}
+
+// unifiedErrorWriter собирает ответ с ошибкой (код 400 и выше) и отправляет его в едином
+// формате: текстовое сообщение переносится в поле message, поле code заполняется по коду
+// ответа, если обработчик его не указал. Ошибка передается в формате, выбранном по заголовку
+// Accept, в том числе ошибки middleware, которые отвечают в JSON. Успешные ответы передаются
+// без изменений.
+type unifiedErrorWriter struct {
+	http.ResponseWriter
+	format string
+	status int
+	body   bytes.Buffer
+}
+
+func (uw *unifiedErrorWriter) WriteHeader(code int) {
+	if uw.status != 0 {
+		return
+	}
+	uw.status = code
+	if code < http.StatusBadRequest {
+		uw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (uw *unifiedErrorWriter) Write(p []byte) (int, error) {
+	if uw.status == 0 {
+		uw.WriteHeader(http.StatusOK)
+	}
+	if uw.status >= http.StatusBadRequest {
+		return uw.body.Write(p)
+	}
+	return uw.ResponseWriter.Write(p)
+}
+
+func (uw *unifiedErrorWriter) Unwrap() http.ResponseWriter {
+	return uw.ResponseWriter
+}
+
+func (uw *unifiedErrorWriter) finish() {
+	if uw.status < http.StatusBadRequest {
+		return
+	}
+
+	uw.Header().Del("Content-Length")
+	if uw.format == formatXML {
+		writeXML(uw.ResponseWriter, uw.xmlError(), uw.status)
+		return
+	}
+
+	response := map[string]any{}
+	if !strings.HasPrefix(uw.Header().Get("Content-Type"), "application/json") ||
+		json.Unmarshal(uw.body.Bytes(), &response) != nil {
+		response = map[string]any{"message": strings.TrimSpace(uw.body.String())}
+	}
+	response["status"] = "error"
+	if code, _ := response["code"].(string); code == "" {
+		response["code"] = errorCode(uw.status)
+	}
+	writeJSON(uw.ResponseWriter, response, uw.status)
+}
+
+// Ошибка в формате XML: ответ обработчика в XML дополняется полями status и code, ответ
+// в JSON преобразуется в XML с теми же именами полей, текст переносится в поле message
+func (uw *unifiedErrorWriter) xmlError() xmlNode {
+	contentType := uw.Header().Get("Content-Type")
+	var response xmlNode
+	var fields map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(uw.body.Bytes()))
+	decoder.UseNumber()
+	switch {
+	case strings.HasPrefix(contentType, "application/xml") && xml.Unmarshal(uw.body.Bytes(), &response) == nil:
+	case strings.HasPrefix(contentType, "application/json") && decoder.Decode(&fields) == nil:
+		response = jsonToXML("response", fields)
+	default:
+		response = xmlNode{Nodes: []xmlNode{{XMLName: xml.Name{Local: "message"}, Content: strings.TrimSpace(uw.body.String())}}}
+	}
+	response.XMLName = xml.Name{Local: "response"}
+
+	if status := response.child("status"); status != nil {
+		status.Content = "error"
+	} else {
+		response.Nodes = append([]xmlNode{{XMLName: xml.Name{Local: "status"}, Content: "error"}}, response.Nodes...)
+	}
+	if code := response.child("code"); code == nil || code.Content == "" {
+		response.Nodes = append(response.Nodes, xmlNode{XMLName: xml.Name{Local: "code"}, Content: errorCode(uw.status)})
+	}
+	return response
+}
+
+// xmlNode - элемент XML произвольной структуры
+type xmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",chardata"`
+	Nodes   []xmlNode  `xml:",any"`
+}
+
+// Первый дочерний элемент с именем name
+func (n *xmlNode) child(name string) *xmlNode {
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == name {
+			return &n.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// Преобразование значения JSON в элемент XML: поля объекта - в дочерние элементы в порядке
+// имен, элементы массива - в дочерние элементы <item>
+func jsonToXML(name string, value any) xmlNode {
+	node := xmlNode{XMLName: xml.Name{Local: name}}
+	switch value := value.(type) {
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(value)) {
+			node.Nodes = append(node.Nodes, jsonToXML(key, value[key]))
+		}
+	case []any:
+		for _, item := range value {
+			node.Nodes = append(node.Nodes, jsonToXML("item", item))
+		}
+	case nil:
+	default:
+		node.Content = fmt.Sprint(value)
+	}
+	return node
+}
+
+// Код ошибки по коду ответа: "not_found", "method_not_allowed"
+func errorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
+
+// deprecated помечает маршрут прежнего API устаревшим: ответ содержит дату объявления
+// (Deprecation, RFC 9745), дату отключения (Sunset, RFC 8594) и ссылку на путь, который его
+// заменяет. После даты отключения маршрут отвечает 410. В версии 2 прежние маршруты недоступны.
+func (s *Server) deprecated(successor string) routeMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requestAPIVersion(r) != apiVersion1 {
+				http.NotFound(w, r)
+				return
+			}
+
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", s.versions.LegacyDeprecated.Unix()))
+			w.Header().Set("Sunset", s.versions.LegacySunset.UTC().Format(http.TimeFormat))
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+			if !time.Now().Before(s.versions.LegacySunset) {
+				sendErrorMessage(w, fmt.Sprintf("Эндпоинт отключен %s, используйте %s",
+					s.versions.LegacySunset.Format(time.DateOnly), successor), http.StatusGone)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"project-znak/internal/dto"
+	"project-znak/internal/service"
+)
+
+// Обработчик токена API Wildberries: GET/POST/DELETE /api/users/wildberries. Токеном
+// управляет только пользователь, авторизованный по API ключу.
+func (s *Server) wildberriesTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userID := requireAuthenticatedUserID(w, r)
+			if userID == 0 {
+				return
+			}
+			settings, err := s.svc.WildberriesSettings(r.Context(), userID)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.WildberriesSettings{
+				Envelope:    dto.OK(),
+				Wildberries: settings,
+			}, http.StatusOK)
+
+		case http.MethodPost:
+			var request service.WildberriesTokenRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				s.sendDecodeError(w, err)
+				return
+			}
+			defer r.Body.Close()
+			if requireAuthenticatedUserID(w, r) == 0 {
+				return
+			}
+
+			settings, err := s.svc.SaveWildberriesToken(r.Context(), requestActor(r, 0), request)
+			if err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.WildberriesSettings{
+				Envelope:    dto.OK(),
+				Wildberries: settings,
+			}, http.StatusOK)
+
+		case http.MethodDelete:
+			userID := requireAuthenticatedUserID(w, r)
+			if userID == 0 {
+				return
+			}
+			if err := s.svc.DeleteWildberriesToken(r.Context(), requestActor(r, 0), userID); err != nil {
+				s.sendError(w, r, err)
+				return
+			}
+			sendResponse(w, dto.Message{Envelope: dto.Done("Токен Wildberries удален")}, http.StatusOK)
+		}
+	}
+}
+
+// Обработчик привязки кодов к поставке Wildberries: POST /api/wildberries/bind
+func (s *Server) wildberriesBindHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request service.WBBindRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			s.sendDecodeError(w, err)
+			return
+		}
+		defer r.Body.Close()
+
+		result, err := s.svc.BindWildberriesSupply(r.Context(), requestActor(r, request.TelegramID), request)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.WildberriesBind{
+			Envelope: dto.OK(),
+			Result:   result,
+		}, http.StatusOK)
+	}
+}
+
+// Обработчик результатов привязки: GET /api/wildberries/bindings?supply_id=&organization_id=&limit=
+func (s *Server) wildberriesBindingsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := s.requireUserID(w, r, http.StatusUnauthorized)
+		if userID == 0 {
+			return
+		}
+
+		params := r.URL.Query()
+		var organizationID int
+		if organizationParam := params.Get("organization_id"); organizationParam != "" {
+			var err error
+			organizationID, err = strconv.Atoi(organizationParam)
+			if err != nil {
+				sendErrorMessage(w, "Некорректный ID организации", http.StatusBadRequest)
+				return
+			}
+		}
+		limit := 100
+		if value, err := strconv.Atoi(params.Get("limit")); err == nil && value > 0 && value <= 1000 {
+			limit = value
+		}
+
+		bindings, err := s.svc.WildberriesBindings(r.Context(), userID, organizationID, params.Get("supply_id"), limit)
+		if err != nil {
+			s.sendError(w, r, err)
+			return
+		}
+
+		sendResponse(w, dto.WildberriesBindings{
+			Envelope: dto.OK(),
+			Bindings: bindings,
+		}, http.StatusOK)
+	}
+}
@@ -0,0 +1,246 @@
+// Package i18n переводит сообщения REST API и Telegram-бота на язык пользователя.
+// Исходные сообщения написаны на русском и служат ключами каталогов переводов
+// locales/<язык>.json; сообщение без перевода возвращается без изменений.
+//
+// Ключ каталога может содержать глаголы форматирования fmt (%s, %d, %q и т.п.):
+// такой ключ сопоставляется с уже сформированным сообщением, а подставленные значения
+// переносятся в перевод в том же порядке или по индексу %[n]s. Значения %s и %v,
+// для которых в каталоге есть точный перевод, тоже переводятся.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Language - код языка ISO 639-1
+type Language string
+
+// Поддерживаемые языки
+const (
+	RU Language = "ru"
+	EN Language = "en"
+)
+
+// Default - язык исходных сообщений, используется без Accept-Language и настройки пользователя
+const Default = RU
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// Каталоги переводов по языкам; для языка исходных сообщений каталога нет
+var catalogs = mustLoadCatalogs()
+
+// catalog - переводы сообщений на один язык
+type catalog struct {
+	messages map[string]string
+	patterns []pattern
+}
+
+// pattern - ключ каталога с глаголами форматирования
+type pattern struct {
+	re          *regexp.Regexp
+	literal     int // Длина ключа без глаголов: более конкретные ключи проверяются первыми
+	translation string
+}
+
+// Параметры глагола форматирования: флаги, ширина и точность
+const verbFlags = "+-# 0123456789."
+
+func mustLoadCatalogs() map[Language]*catalog {
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	catalogs := make(map[Language]*catalog, len(files))
+	for _, file := range files {
+		data, err := locales.ReadFile("locales/" + file.Name())
+		if err != nil {
+			panic(err)
+		}
+		c, err := parseCatalog(data)
+		if err != nil {
+			panic(fmt.Sprintf("i18n: ошибка в каталоге %s: %v", file.Name(), err))
+		}
+		catalogs[Language(strings.TrimSuffix(file.Name(), path.Ext(file.Name())))] = c
+	}
+	return catalogs
+}
+
+func parseCatalog(data []byte) (*catalog, error) {
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+
+	c := &catalog{messages: messages}
+	for key, translation := range messages {
+		if !strings.Contains(strings.ReplaceAll(key, "%%", ""), "%") {
+			continue
+		}
+		expr, literal := compilePattern(key)
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("ключ %q: %w", key, err)
+		}
+		c.patterns = append(c.patterns, pattern{re: re, literal: literal, translation: translation})
+	}
+	sort.Slice(c.patterns, func(i, j int) bool {
+		if c.patterns[i].literal != c.patterns[j].literal {
+			return c.patterns[i].literal > c.patterns[j].literal
+		}
+		return c.patterns[i].re.String() < c.patterns[j].re.String()
+	})
+	return c, nil
+}
+
+// Регулярное выражение для ключа с глаголами форматирования и длина ключа без глаголов
+func compilePattern(key string) (string, int) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	literal := 0
+	for i := 0; i < len(key); i++ {
+		if key[i] != '%' || i+1 == len(key) {
+			expr.WriteString(regexp.QuoteMeta(key[i : i+1]))
+			literal++
+			continue
+		}
+		i++
+		for i < len(key)-1 && strings.IndexByte(verbFlags, key[i]) >= 0 {
+			i++
+		}
+		switch key[i] {
+		case '%':
+			expr.WriteString("%")
+			literal++
+		case 'd':
+			expr.WriteString(`(-?\d+)`)
+		case 'q':
+			expr.WriteString(`("(?:[^"\\]|\\.)*")`)
+		default:
+			expr.WriteString("(.+?)")
+		}
+	}
+	expr.WriteString("$")
+	return expr.String(), literal
+}
+
+// Translate возвращает перевод сообщения на язык lang. Сначала ищется точный перевод,
+// затем ключ с глаголами форматирования; многострочное сообщение без перевода
+// переводится построчно.
+func Translate(lang Language, message string) string {
+	c := catalogs[lang]
+	if c == nil || message == "" {
+		return message
+	}
+	if translated, ok := c.translate(message); ok {
+		return translated
+	}
+	if !strings.Contains(message, "\n") {
+		return message
+	}
+	lines := strings.Split(message, "\n")
+	for i, line := range lines {
+		if translated, ok := c.translate(line); ok {
+			lines[i] = translated
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *catalog) translate(message string) (string, bool) {
+	if translated, ok := c.messages[message]; ok {
+		return translated, true
+	}
+	for _, p := range c.patterns {
+		match := p.re.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		args := match[1:]
+		for i, arg := range args {
+			if translated, ok := c.messages[arg]; ok {
+				args[i] = translated
+			}
+		}
+		return expand(p.translation, args), true
+	}
+	return "", false
+}
+
+// Подстановка значений в перевод вместо глаголов форматирования. Как и в fmt, глагол
+// без индекса получает значение, следующее за предыдущим.
+func expand(translation string, args []string) string {
+	var out strings.Builder
+	next := 0
+	for i := 0; i < len(translation); i++ {
+		if translation[i] != '%' || i+1 == len(translation) {
+			out.WriteByte(translation[i])
+			continue
+		}
+		i++
+		if translation[i] == '%' {
+			out.WriteByte('%')
+			continue
+		}
+		if translation[i] == '[' {
+			if end := strings.IndexByte(translation[i:], ']'); end > 0 {
+				if n, err := strconv.Atoi(translation[i+1 : i+end]); err == nil {
+					next = n - 1
+				}
+				i += end + 1
+			}
+		}
+		for i < len(translation)-1 && strings.IndexByte(verbFlags, translation[i]) >= 0 {
+			i++
+		}
+		if next >= 0 && next < len(args) {
+			out.WriteString(args[next])
+		}
+		next++
+	}
+	return out.String()
+}
+
+// Supported возвращает язык по коду, например "en" или "en-US", и false для
+// неподдерживаемого языка
+func Supported(code string) (Language, bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	lang := Language(code)
+	if lang == Default || catalogs[lang] != nil {
+		return lang, true
+	}
+	return "", false
+}
+
+// Parse выбирает из заголовка Accept-Language поддерживаемый язык с наибольшим весом q.
+// Возвращает false, если заголовок пуст или ни один из языков не поддерживается.
+func Parse(acceptLanguage string) (Language, bool) {
+	var best Language
+	bestQ := 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		lang, ok := Supported(tag)
+		if ok && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best, bestQ > 0
+}
@@ -0,0 +1,54 @@
+package i18n
+
+import "testing"
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		lang     Language
+		message  string
+		expected string
+	}{
+		{EN, "Заказ не найден", "Order not found"},
+		{RU, "Заказ не найден", "Заказ не найден"},
+		{EN, "Сообщение без перевода", "Сообщение без перевода"},
+		{EN, "Период выгрузки не может превышать 92 дней", "The export period cannot exceed 92 days"},
+		{EN, "Неизвестный тарифный план \"gold\"", "Unknown billing plan \"gold\""},
+		{EN, "Заказ изменен другим запросом: получите актуальные данные и повторите запрос",
+			"The order was modified by another request: fetch the current data and retry the request"},
+		{EN, "Ввод в оборот: документ №7 принят Честным ЗНАКом",
+			"Introduction into circulation: document #7 was accepted by Chestny ZNAK"},
+		{EN, "Отчет за 01.03.2026\n\nЗапросов кодов: 3 (с ошибкой: 1)\nПолучено кодов: 20",
+			"Report for 01.03.2026\n\nCode requests: 3 (failed: 1)\nCodes received: 20"},
+	}
+	for _, tt := range tests {
+		if got := Translate(tt.lang, tt.message); got != tt.expected {
+			t.Errorf("Translate(%s, %q) = %q, ожидалось %q", tt.lang, tt.message, got, tt.expected)
+		}
+	}
+}
+
+func TestExpandIndex(t *testing.T) {
+	if got := expand("%[2]s, %[1]s, %s", []string{"a", "b"}); got != "b, a, b" {
+		t.Errorf("Неверная подстановка по индексу: %q", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected Language
+		ok       bool
+	}{
+		{"en-US,en;q=0.9", EN, true},
+		{"de-DE, ru;q=0.5, en;q=0.8", EN, true},
+		{"RU", RU, true},
+		{"de, fr;q=0.7", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		lang, ok := Parse(tt.header)
+		if lang != tt.expected || ok != tt.ok {
+			t.Errorf("Parse(%q) = %q, %v, ожидалось %q, %v", tt.header, lang, ok, tt.expected, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package invoice
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Party - сторона счета: поставщик или покупатель с банковскими реквизитами
+type Party struct {
+	Name        string
+	INN         string
+	KPP         string
+	Address     string
+	BankName    string
+	BIK         string
+	BankAccount string
+	CorrAccount string
+}
+
+// Описание стороны для строк "Поставщик" и "Покупатель"
+func (p Party) description() string {
+	parts := []string{p.Name, "ИНН " + p.INN}
+	if p.KPP != "" {
+		parts = append(parts, "КПП "+p.KPP)
+	}
+	if p.Address != "" {
+		parts = append(parts, p.Address)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Item - строка счета
+type Item struct {
+	Name     string
+	Quantity int
+	Price    float64
+}
+
+// Invoice - счет на оплату. VATRate - ставка НДС в процентах, включенного в цену;
+// 0 означает, что поставщик работает без НДС.
+type Invoice struct {
+	Number  string
+	Date    time.Time
+	DueDate time.Time
+	Seller  Party
+	Buyer   Party
+	Items   []Item
+	VATRate float64
+}
+
+// Total возвращает сумму счета
+func (inv *Invoice) Total() float64 {
+	var kopecks int64
+	for _, item := range inv.Items {
+		kopecks += toKopecks(item.Price * float64(item.Quantity))
+	}
+	return float64(kopecks) / 100
+}
+
+// VAT возвращает сумму НДС, включенного в сумму счета
+func (inv *Invoice) VAT() float64 {
+	if inv.VATRate <= 0 {
+		return 0
+	}
+	return float64(toKopecks(inv.Total()*inv.VATRate/(100+inv.VATRate))) / 100
+}
+
+func toKopecks(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// Сумма с разделителем разрядов: 12 345,60
+func formatAmount(amount float64) string {
+	kopecks := toKopecks(amount)
+	rubles := fmt.Sprint(kopecks / 100)
+	var b strings.Builder
+	for i, digit := range rubles {
+		if i > 0 && (len(rubles)-i)%3 == 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(digit)
+	}
+	return fmt.Sprintf("%s,%02d", b.String(), kopecks%100)
+}
+
+// Render выводит счет на оплату в PDF формата A4 по унифицированной форме:
+// банковские реквизиты поставщика, стороны, таблица товаров, итоги и сумма прописью
+func Render(w io.Writer, inv *Invoice) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.AddPage()
+
+	// Банковские реквизиты получателя платежа
+	pdf.SetFont("Arial", "", 9)
+	pdf.CellFormat(100, 6, inv.Seller.BankName, "LTR", 0, "L", false, 0, "")
+	pdf.CellFormat(20, 6, "БИК", "LTR", 0, "L", false, 0, "")
+	pdf.CellFormat(60, 6, inv.Seller.BIK, "LTR", 1, "L", false, 0, "")
+	pdf.CellFormat(100, 6, "Банк получателя", "LBR", 0, "L", false, 0, "")
+	pdf.CellFormat(20, 6, "Сч. №", "LBR", 0, "L", false, 0, "")
+	pdf.CellFormat(60, 6, inv.Seller.CorrAccount, "LBR", 1, "L", false, 0, "")
+	pdf.CellFormat(50, 6, "ИНН "+inv.Seller.INN, "1", 0, "L", false, 0, "")
+	pdf.CellFormat(50, 6, "КПП "+inv.Seller.KPP, "1", 0, "L", false, 0, "")
+	pdf.CellFormat(20, 6, "Сч. №", "LTR", 0, "L", false, 0, "")
+	pdf.CellFormat(60, 6, inv.Seller.BankAccount, "LTR", 1, "L", false, 0, "")
+	pdf.CellFormat(100, 6, inv.Seller.Name, "LR", 0, "L", false, 0, "")
+	pdf.CellFormat(20, 6, "", "LR", 0, "L", false, 0, "")
+	pdf.CellFormat(60, 6, "", "LR", 1, "L", false, 0, "")
+	pdf.CellFormat(100, 6, "Получатель", "LBR", 0, "L", false, 0, "")
+	pdf.CellFormat(20, 6, "", "LBR", 0, "L", false, 0, "")
+	pdf.CellFormat(60, 6, "", "LBR", 1, "L", false, 0, "")
+	pdf.Ln(6)
+
+	pdf.SetFont("Arial", "B", 14)
+	pdf.CellFormat(0, 8, fmt.Sprintf("Счет на оплату № %s от %s", inv.Number, inv.Date.Format("02.01.2006")),
+		"B", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	pdf.SetFont("Arial", "", 9)
+	for _, party := range []struct{ caption, text string }{
+		{"Поставщик:", inv.Seller.description()},
+		{"Покупатель:", inv.Buyer.description()},
+	} {
+		y := pdf.GetY()
+		pdf.CellFormat(25, 5, party.caption, "", 0, "L", false, 0, "")
+		pdf.SetFont("Arial", "B", 9)
+		pdf.MultiCell(155, 5, party.text, "", "L", false)
+		pdf.SetFont("Arial", "", 9)
+		pdf.SetY(max(pdf.GetY(), y+5) + 2)
+	}
+	pdf.Ln(2)
+
+	// Таблица товаров
+	widths := []float64{10, 95, 15, 10, 25, 25}
+	pdf.SetFont("Arial", "B", 9)
+	for i, caption := range []string{"№", "Товары (работы, услуги)", "Кол-во", "Ед.", "Цена", "Сумма"} {
+		pdf.CellFormat(widths[i], 7, caption, "1", 0, "C", false, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Arial", "", 9)
+	for i, item := range inv.Items {
+		pdf.CellFormat(widths[0], 6, fmt.Sprint(i+1), "1", 0, "C", false, 0, "")
+		pdf.CellFormat(widths[1], 6, item.Name, "1", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[2], 6, fmt.Sprint(item.Quantity), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 6, "шт", "1", 0, "C", false, 0, "")
+		pdf.CellFormat(widths[4], 6, formatAmount(item.Price), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[5], 6, formatAmount(item.Price*float64(item.Quantity)), "1", 1, "R", false, 0, "")
+	}
+
+	// Итоги
+	total := inv.Total()
+	vat := "Без налога (НДС):"
+	vatAmount := "-"
+	if inv.VATRate > 0 {
+		vat = fmt.Sprintf("В том числе НДС %g%%:", inv.VATRate)
+		vatAmount = formatAmount(inv.VAT())
+	}
+	pdf.SetFont("Arial", "B", 9)
+	for _, line := range [][2]string{
+		{"Итого:", formatAmount(total)},
+		{vat, vatAmount},
+		{"Всего к оплате:", formatAmount(total)},
+	} {
+		pdf.CellFormat(155, 6, line[0], "", 0, "R", false, 0, "")
+		pdf.CellFormat(25, 6, line[1], "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(2)
+
+	pdf.SetFont("Arial", "", 9)
+	pdf.CellFormat(0, 5, fmt.Sprintf("Всего наименований %d, на сумму %s руб.", len(inv.Items), formatAmount(total)),
+		"", 1, "L", false, 0, "")
+	pdf.SetFont("Arial", "B", 9)
+	pdf.CellFormat(0, 5, AmountInWords(total), "B", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	pdf.SetFont("Arial", "", 9)
+	if !inv.DueDate.IsZero() {
+		pdf.CellFormat(0, 5, "Оплатить не позднее "+inv.DueDate.Format("02.01.2006"), "", 1, "L", false, 0, "")
+	}
+	pdf.CellFormat(0, 5, fmt.Sprintf("В назначении платежа укажите: Оплата по счету № %s.", inv.Number),
+		"", 1, "L", false, 0, "")
+	pdf.Ln(10)
+
+	pdf.CellFormat(30, 6, "Руководитель", "", 0, "L", false, 0, "")
+	pdf.CellFormat(55, 6, "", "B", 0, "L", false, 0, "")
+	pdf.CellFormat(10, 6, "", "", 0, "L", false, 0, "")
+	pdf.CellFormat(30, 6, "Бухгалтер", "", 0, "L", false, 0, "")
+	pdf.CellFormat(55, 6, "", "B", 1, "L", false, 0, "")
+
+	return pdf.Output(w)
+}
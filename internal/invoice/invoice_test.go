@@ -0,0 +1,75 @@
+package invoice
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestAmountInWords(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   string
+	}{
+		{0, "Ноль рублей 00 копеек"},
+		{1, "Один рубль 00 копеек"},
+		{2.01, "Два рубля 01 копейка"},
+		{11.12, "Одиннадцать рублей 12 копеек"},
+		{1000, "Одна тысяча рублей 00 копеек"},
+		{2345.5, "Две тысячи триста сорок пять рублей 50 копеек"},
+		{21000000, "Двадцать один миллион рублей 00 копеек"},
+		{1002003.99, "Один миллион две тысячи три рубля 99 копеек"},
+	}
+
+	for _, test := range tests {
+		if got := AmountInWords(test.amount); got != test.want {
+			t.Errorf("AmountInWords(%v) = %q, ожидалось %q", test.amount, got, test.want)
+		}
+	}
+}
+
+func TestInvoiceTotals(t *testing.T) {
+	inv := Invoice{
+		Items:   []Item{{Name: "Коды маркировки", Quantity: 100, Price: 0.5}, {Name: "Услуга", Quantity: 1, Price: 70}},
+		VATRate: 20,
+	}
+	if total := inv.Total(); total != 120 {
+		t.Errorf("сумма счета %v, ожидалось 120", total)
+	}
+	if vat := inv.VAT(); vat != 20 {
+		t.Errorf("НДС %v, ожидалось 20", vat)
+	}
+
+	inv.VATRate = 0
+	if vat := inv.VAT(); vat != 0 {
+		t.Errorf("НДС без налога %v, ожидалось 0", vat)
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	if got := formatAmount(1234567.8); got != "1 234 567,80" {
+		t.Errorf("formatAmount = %q", got)
+	}
+	if got := formatAmount(999); got != "999,00" {
+		t.Errorf("formatAmount = %q", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	inv := &Invoice{
+		Number:  "2026-00001",
+		Date:    time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		DueDate: time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC),
+		Seller:  Party{Name: "ООО Знак", INN: "7707083893", KPP: "770701001", BIK: "044525225"},
+		Buyer:   Party{Name: "ООО Покупатель", INN: "5001012345"},
+		Items:   []Item{{Name: "Коды маркировки", Quantity: 10, Price: 0.6}},
+	}
+
+	var buf bytes.Buffer
+	if err := Render(&buf, inv); err != nil {
+		t.Fatalf("ошибка формирования счета: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF")) {
+		t.Errorf("результат не является PDF")
+	}
+}
@@ -0,0 +1,101 @@
+package invoice
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	unitsMasculine = []string{"", "один", "два", "три", "четыре", "пять", "шесть", "семь", "восемь", "девять"}
+	unitsFeminine  = []string{"", "одна", "две", "три", "четыре", "пять", "шесть", "семь", "восемь", "девять"}
+	teens          = []string{"десять", "одиннадцать", "двенадцать", "тринадцать", "четырнадцать",
+		"пятнадцать", "шестнадцать", "семнадцать", "восемнадцать", "девятнадцать"}
+	tens     = []string{"", "", "двадцать", "тридцать", "сорок", "пятьдесят", "шестьдесят", "семьдесят", "восемьдесят", "девяносто"}
+	hundreds = []string{"", "сто", "двести", "триста", "четыреста", "пятьсот", "шестьсот", "семьсот", "восемьсот", "девятьсот"}
+)
+
+// Разряды числа начиная с тысяч: род и формы слова для 1, 2-4 и 5-0
+var scales = []struct {
+	feminine bool
+	forms    [3]string
+}{
+	{true, [3]string{"тысяча", "тысячи", "тысяч"}},
+	{false, [3]string{"миллион", "миллиона", "миллионов"}},
+	{false, [3]string{"миллиард", "миллиарда", "миллиардов"}},
+}
+
+// AmountInWords возвращает сумму прописью для счета: рубли словами, копейки цифрами,
+// например "Одна тысяча двести рублей 50 копеек"
+func AmountInWords(amount float64) string {
+	kopecks := int64(math.Round(math.Abs(amount) * 100))
+	rubles := kopecks / 100
+
+	words := numberInWords(rubles)
+	words = strings.ToUpper(words[:2]) + words[2:] // первая буква кириллицы занимает два байта
+	return fmt.Sprintf("%s %s %02d %s", words, plural(rubles, "рубль", "рубля", "рублей"),
+		kopecks%100, plural(kopecks%100, "копейка", "копейки", "копеек"))
+}
+
+// Целое число прописью в мужском роде
+func numberInWords(n int64) string {
+	if n == 0 {
+		return "ноль"
+	}
+
+	var groups []string
+	for scale := -1; n > 0 && scale < len(scales); scale++ {
+		group := n % 1000
+		n /= 1000
+		if group == 0 {
+			continue
+		}
+
+		feminine := scale >= 0 && scales[scale].feminine
+		words := groupInWords(group, feminine)
+		if scale >= 0 {
+			forms := scales[scale].forms
+			words = append(words, plural(group, forms[0], forms[1], forms[2]))
+		}
+		groups = append([]string{strings.Join(words, " ")}, groups...)
+	}
+	return strings.Join(groups, " ")
+}
+
+// Число от 1 до 999 прописью
+func groupInWords(n int64, feminine bool) []string {
+	var words []string
+	if n >= 100 {
+		words = append(words, hundreds[n/100])
+	}
+	switch rest := n % 100; {
+	case rest >= 10 && rest < 20:
+		words = append(words, teens[rest-10])
+	default:
+		if rest >= 20 {
+			words = append(words, tens[rest/10])
+		}
+		if unit := rest % 10; unit > 0 {
+			if feminine {
+				words = append(words, unitsFeminine[unit])
+			} else {
+				words = append(words, unitsMasculine[unit])
+			}
+		}
+	}
+	return words
+}
+
+// Форма слова для числа: 1 рубль, 2 рубля, 5 рублей
+func plural(n int64, one, few, many string) string {
+	n %= 100
+	switch {
+	case n >= 11 && n <= 19:
+		return many
+	case n%10 == 1:
+		return one
+	case n%10 >= 2 && n%10 <= 4:
+		return few
+	}
+	return many
+}
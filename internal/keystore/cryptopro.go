@@ -0,0 +1,74 @@
+package keystore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// CryptoProConfig - параметры доступа к контейнеру КриптоПро CSP
+type CryptoProConfig struct {
+	Thumbprint string        // SHA-1 отпечаток сертификата в хранилище пользователя
+	PIN        string        // Пароль контейнера закрытого ключа
+	CertPath   string        // Файл сертификата; если не задан, сертификат выгружается из хранилища
+	BinDir     string        // Директория утилит cryptcp и certmgr, например /opt/cprocsp/bin/amd64
+	Timeout    time.Duration // Ограничение времени операции с контейнером
+}
+
+// CryptoProKeystore подписывает данные ключом из контейнера КриптоПро CSP (в том числе
+// на токене). Подпись формируется утилитой cryptcp в формате открепленной CMS (DER),
+// которую принимает API Честного ЗНАКа для сертификатов ГОСТ.
+type CryptoProKeystore struct {
+	cfg     CryptoProConfig
+	cryptcp tool
+	cert    *x509.Certificate
+}
+
+// OpenCryptoPro находит сертификат в хранилище КриптоПро по отпечатку
+func OpenCryptoPro(cfg CryptoProConfig) (*CryptoProKeystore, error) {
+	if cfg.Thumbprint == "" {
+		return nil, fmt.Errorf("не указан отпечаток сертификата КриптоПро")
+	}
+
+	k := &CryptoProKeystore{
+		cfg:     cfg,
+		cryptcp: tool{path: cryptoProTool(cfg.BinDir, "cryptcp"), timeout: cfg.Timeout},
+	}
+	var err error
+	if cfg.CertPath != "" {
+		k.cert, err = loadCertificate(cfg.CertPath)
+	} else {
+		certmgr := tool{path: cryptoProTool(cfg.BinDir, "certmgr"), timeout: cfg.Timeout}
+		k.cert, err = certmgr.certificate(func(output string) []string {
+			return []string{"-export", "-thumbprint", cfg.Thumbprint, "-dest", output}
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Sign формирует открепленную подпись CMS данных
+func (k *CryptoProKeystore) Sign(data []byte) ([]byte, error) {
+	return k.cryptcp.sign(data, func(input, output string) []string {
+		args := []string{"-sign", "-thumbprint", k.cfg.Thumbprint, "-detached", "-der", "-nochain"}
+		if k.cfg.PIN != "" {
+			args = append(args, "-pin", k.cfg.PIN)
+		}
+		return append(args, input, output)
+	})
+}
+
+// Certificate возвращает сертификат ключа
+func (k *CryptoProKeystore) Certificate() *x509.Certificate {
+	return k.cert
+}
+
+func cryptoProTool(binDir, name string) string {
+	if binDir == "" {
+		return name
+	}
+	return filepath.Join(binDir, name)
+}
@@ -0,0 +1,120 @@
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"project-znak/internal/text"
+)
+
+// Поддерживаемые хранилища ключа ЭЦП
+const (
+	DriverPEM       = "pem"       // Ключ PKCS#8 и сертификат в PEM-файлах
+	DriverPKCS11    = "pkcs11"    // Ключ на токене PKCS#11 (Рутокен, JaCarta)
+	DriverCryptoPro = "cryptopro" // Контейнер КриптоПро CSP
+)
+
+// Ограничение времени операции внешней утилиты по умолчанию
+const defaultToolTimeout = 30 * time.Second
+
+// Keystore подписывает данные ключом ЭЦП и возвращает сертификат этого ключа.
+// Ключ может не покидать хранилища: подпись выполняется токеном или криптопровайдером.
+type Keystore interface {
+	Sign(data []byte) ([]byte, error)
+	Certificate() *x509.Certificate
+}
+
+// Разбор сертификата в формате PEM или DER
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка парсинга сертификата: %w", err)
+	}
+	return cert, nil
+}
+
+// Загрузка сертификата из файла
+func loadCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения сертификата: %w", err)
+	}
+	return parseCertificate(data)
+}
+
+// Вызов внешней утилиты хранилища. В тексте ошибки вывод утилиты приводится без
+// аргументов команды, чтобы не раскрывать PIN-код.
+type tool struct {
+	path    string
+	timeout time.Duration
+}
+
+func (t tool) run(args ...string) error {
+	timeout := t.timeout
+	if timeout <= 0 {
+		timeout = defaultToolTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.path, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ошибка выполнения %s: %w: %s", t.path, err, text.Truncate(strings.TrimSpace(output.String()), 512))
+	}
+	return nil
+}
+
+// Подпись через внешнюю утилиту: данные записываются во временный файл, утилита
+// сохраняет подпись в другой файл. args формирует аргументы по путям файлов.
+func (t tool) sign(data []byte, args func(input, output string) []string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "keystore-*")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания временной директории: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	input, output := dir+"/data", dir+"/data.sig"
+	if err := os.WriteFile(input, data, 0600); err != nil {
+		return nil, fmt.Errorf("ошибка записи данных для подписи: %w", err)
+	}
+	if err := t.run(args(input, output)...); err != nil {
+		return nil, fmt.Errorf("ошибка подписи данных: %w", err)
+	}
+	signature, err := os.ReadFile(output)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения подписи: %w", err)
+	}
+	return signature, nil
+}
+
+// Выгрузка сертификата через внешнюю утилиту в файл, путь к которому передается в args
+func (t tool) certificate(args func(output string) []string) (*x509.Certificate, error) {
+	dir, err := os.MkdirTemp("", "keystore-*")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания временной директории: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := dir + "/cert"
+	if err := t.run(args(output)...); err != nil {
+		return nil, fmt.Errorf("ошибка выгрузки сертификата: %w", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения сертификата: %w", err)
+	}
+	return parseCertificate(data)
+}
@@ -0,0 +1,122 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Создание ключа и самоподписанного сертификата в PEM-файлах
+func writeTestKey(t *testing.T, dir string) (*ecdsa.PrivateKey, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath, certPath := filepath.Join(dir, "key.pem"), filepath.Join(dir, "cert.pem")
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600)
+	return key, keyPath, certPath
+}
+
+func TestPEMKeystore(t *testing.T) {
+	key, keyPath, certPath := writeTestKey(t, t.TempDir())
+
+	keys, err := OpenPEM(keyPath, certPath)
+	if err != nil {
+		t.Fatalf("ошибка открытия хранилища: %v", err)
+	}
+	if keys.Certificate().Subject.CommonName != "test" {
+		t.Errorf("неверный сертификат: %v", keys.Certificate().Subject)
+	}
+
+	signature, err := keys.Sign([]byte("data"))
+	if err != nil {
+		t.Fatalf("ошибка подписи: %v", err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature) {
+		t.Error("подпись не проходит проверку")
+	}
+
+	if _, err := OpenPEM(certPath, certPath); err == nil {
+		t.Error("сертификат вместо ключа должен вызывать ошибку")
+	}
+}
+
+func TestPKCS11Keystore(t *testing.T) {
+	dir := t.TempDir()
+	_, _, certPath := writeTestKey(t, dir)
+
+	// Имитация pkcs11-tool: сертификат копируется из файла, подписью служит хэш данных
+	tool := filepath.Join(dir, "pkcs11-tool")
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--read-object) mode=cert ;;
+	--sign) mode=sign ;;
+	--pin) pin="$2"; shift ;;
+	--input-file) input="$2"; shift ;;
+	--output-file) output="$2"; shift ;;
+	esac
+	shift
+done
+if [ "$mode" = cert ]; then cp "` + certPath + `" "$output"; exit 0; fi
+if [ "$pin" != 1234 ]; then echo "CKR_PIN_INCORRECT" >&2; exit 1; fi
+sha256sum "$input" | cut -c1-64 > "$output"
+`
+	if err := os.WriteFile(tool, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := PKCS11Config{Module: "librtpkcs11ecp.so", KeyID: "01", PIN: "1234", Tool: tool, Timeout: 5 * time.Second}
+	keys, err := OpenPKCS11(cfg)
+	if err != nil {
+		t.Fatalf("ошибка открытия хранилища: %v", err)
+	}
+	if keys.Certificate().Subject.CommonName != "test" {
+		t.Errorf("неверный сертификат: %v", keys.Certificate().Subject)
+	}
+
+	signature, err := keys.Sign([]byte("data"))
+	if err != nil {
+		t.Fatalf("ошибка подписи: %v", err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	if got := strings.TrimSpace(string(signature)); got != hex.EncodeToString(digest[:]) {
+		t.Errorf("неверная подпись: %s", got)
+	}
+
+	cfg.PIN = "0000"
+	keys, _ = OpenPKCS11(cfg)
+	if _, err := keys.Sign([]byte("data")); err == nil || strings.Contains(err.Error(), "0000") ||
+		!strings.Contains(err.Error(), "CKR_PIN_INCORRECT") {
+		t.Errorf("неверная ошибка подписи с неверным PIN-кодом: %v", err)
+	}
+}
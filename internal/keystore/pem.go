@@ -0,0 +1,71 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// PEMKeystore хранит ключ PKCS#8 и сертификат, загруженные из PEM-файлов
+type PEMKeystore struct {
+	privateKey crypto.Signer
+	cert       *x509.Certificate
+}
+
+// OpenPEM загружает ключ и сертификат из файлов
+func OpenPEM(privateKeyPath, certPath string) (*PEMKeystore, error) {
+	privateKey, err := loadPrivateKey(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := loadCertificate(certPath)
+	if err != nil {
+		return nil, err
+	}
+	return &PEMKeystore{privateKey: privateKey, cert: cert}, nil
+}
+
+// Sign подписывает хэш SHA-256 данных
+func (k *PEMKeystore) Sign(data []byte) ([]byte, error) {
+	hashed := crypto.SHA256.New()
+	hashed.Write(data)
+
+	signature, err := k.privateKey.Sign(rand.Reader, hashed.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подписи данных: %w", err)
+	}
+	return signature, nil
+}
+
+// Certificate возвращает сертификат ключа
+func (k *PEMKeystore) Certificate() *x509.Certificate {
+	return k.cert
+}
+
+// Загрузка приватного ключа из файла
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения ключа: %w", err)
+	}
+
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, fmt.Errorf("неверный PEM-формат")
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка парсинга ключа: %w", err)
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("неподдерживаемый тип ключа")
+	}
+
+	return signer, nil
+}
@@ -0,0 +1,80 @@
+package keystore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// Механизм подписи PKCS#11 по умолчанию: хэширование SHA-256 и подпись RSA PKCS#1 v1.5
+// выполняются токеном, подпись совпадает с подписью ключа RSA из PEM-файла
+const DefaultPKCS11Mechanism = "SHA256-RSA-PKCS"
+
+// PKCS11Config - параметры доступа к ключу на токене PKCS#11
+type PKCS11Config struct {
+	Module    string        // Путь к библиотеке PKCS#11 токена, например /usr/lib/librtpkcs11ecp.so
+	KeyID     string        // Идентификатор (CKA_ID) ключа и сертификата на токене в hex
+	PIN       string        // PIN-код пользователя токена
+	Mechanism string        // Механизм подписи; по умолчанию DefaultPKCS11Mechanism
+	CertPath  string        // Файл сертификата; если не задан, сертификат читается с токена
+	Tool      string        // Путь к утилите pkcs11-tool из OpenSC
+	Timeout   time.Duration // Ограничение времени операции с токеном
+}
+
+// PKCS11Keystore подписывает данные ключом, хранящимся на токене PKCS#11 (Рутокен,
+// JaCarta). Ключ не извлекается с токена: подпись выполняет утилита pkcs11-tool.
+type PKCS11Keystore struct {
+	cfg  PKCS11Config
+	tool tool
+	cert *x509.Certificate
+}
+
+// OpenPKCS11 подключается к токену и загружает сертификат ключа
+func OpenPKCS11(cfg PKCS11Config) (*PKCS11Keystore, error) {
+	if cfg.Module == "" || cfg.KeyID == "" {
+		return nil, fmt.Errorf("не указаны библиотека PKCS#11 или идентификатор ключа")
+	}
+	if cfg.Mechanism == "" {
+		cfg.Mechanism = DefaultPKCS11Mechanism
+	}
+	if cfg.Tool == "" {
+		cfg.Tool = "pkcs11-tool"
+	}
+
+	k := &PKCS11Keystore{cfg: cfg, tool: tool{path: cfg.Tool, timeout: cfg.Timeout}}
+	var err error
+	if cfg.CertPath != "" {
+		k.cert, err = loadCertificate(cfg.CertPath)
+	} else {
+		k.cert, err = k.tool.certificate(func(output string) []string {
+			return []string{
+				"--module", cfg.Module,
+				"--read-object", "--type", "cert", "--id", cfg.KeyID,
+				"--output-file", output,
+			}
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Sign подписывает данные на токене
+func (k *PKCS11Keystore) Sign(data []byte) ([]byte, error) {
+	return k.tool.sign(data, func(input, output string) []string {
+		return []string{
+			"--module", k.cfg.Module,
+			"--login", "--pin", k.cfg.PIN,
+			"--sign", "--id", k.cfg.KeyID,
+			"--mechanism", k.cfg.Mechanism,
+			"--input-file", input,
+			"--output-file", output,
+		}
+	})
+}
+
+// Certificate возвращает сертификат ключа
+func (k *PKCS11Keystore) Certificate() *x509.Certificate {
+	return k.cert
+}
@@ -0,0 +1,192 @@
+package labels
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Поля, которые можно вывести на этикетке
+const (
+	FieldCode  = "code"  // Код маркировки
+	FieldGTIN  = "gtin"  // GTIN товара
+	FieldName  = "name"  // Наименование товара
+	FieldBatch = "batch" // Номер партии
+	FieldDate  = "date"  // Дата производства
+)
+
+// DefaultTemplate - шаблон по умолчанию: список кодов на листе A4
+const DefaultTemplate = "a4-list"
+
+// DefaultFields - поля этикетки по умолчанию
+var DefaultFields = []string{FieldCode}
+
+// Подписи полей на этикетке; код маркировки и наименование выводятся без подписи
+var fieldCaptions = map[string]string{
+	FieldCode:  "",
+	FieldGTIN:  "GTIN: ",
+	FieldName:  "",
+	FieldBatch: "Партия: ",
+	FieldDate:  "Дата: ",
+}
+
+// Template - шаблон листа этикеток. Размеры указываются в миллиметрах; лист делится
+// на Columns x Rows одинаковых этикеток.
+type Template struct {
+	Name       string  `json:"name" xml:"name"`
+	Title      string  `json:"title" xml:"title"`
+	PageWidth  float64 `json:"page_width" xml:"page_width"`
+	PageHeight float64 `json:"page_height" xml:"page_height"`
+	Columns    int     `json:"columns" xml:"columns"`
+	Rows       int     `json:"rows" xml:"rows"`
+	Margin     float64 `json:"margin" xml:"margin"`
+	FontSize   float64 `json:"font_size" xml:"font_size"`
+}
+
+// Предопределенные шаблоны
+var templates = map[string]Template{
+	"a4-list": {Name: "a4-list", Title: "Список кодов, A4", PageWidth: 210, PageHeight: 297,
+		Columns: 1, Rows: 28, Margin: 10, FontSize: 11},
+	"a4-3x8": {Name: "a4-3x8", Title: "Лист A4, 3x8 этикеток", PageWidth: 210, PageHeight: 297,
+		Columns: 3, Rows: 8, Margin: 5, FontSize: 8},
+	"58x40": {Name: "58x40", Title: "Термоэтикетка 58x40 мм", PageWidth: 58, PageHeight: 40,
+		Columns: 1, Rows: 1, Margin: 2, FontSize: 8},
+	"58x60": {Name: "58x60", Title: "Термоэтикетка 58x60 мм", PageWidth: 58, PageHeight: 60,
+		Columns: 1, Rows: 1, Margin: 2, FontSize: 9},
+}
+
+// Label - данные одной этикетки
+type Label struct {
+	Code  string
+	GTIN  string
+	Name  string
+	Batch string
+	Date  string
+}
+
+// Значение поля этикетки
+func (l Label) field(name string) string {
+	switch name {
+	case FieldCode:
+		return l.Code
+	case FieldGTIN:
+		return l.GTIN
+	case FieldName:
+		return l.Name
+	case FieldBatch:
+		return l.Batch
+	case FieldDate:
+		return l.Date
+	}
+	return ""
+}
+
+// Lookup возвращает предопределенный шаблон по имени
+func Lookup(name string) (Template, bool) {
+	tmpl, ok := templates[name]
+	return tmpl, ok
+}
+
+// Templates возвращает предопределенные шаблоны, упорядоченные по имени
+func Templates() []Template {
+	list := make([]Template, 0, len(templates))
+	for _, tmpl := range templates {
+		list = append(list, tmpl)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ValidateFields проверяет, что все поля поддерживаются и не повторяются
+func ValidateFields(fields []string) error {
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if _, ok := fieldCaptions[field]; !ok {
+			return fmt.Errorf("неизвестное поле этикетки %q", field)
+		}
+		if seen[field] {
+			return fmt.Errorf("поле этикетки %q указано дважды", field)
+		}
+		seen[field] = true
+	}
+	return nil
+}
+
+// GTINFromCode извлекает GTIN из кода маркировки формата 01<GTIN>21<серийный номер>.
+// Возвращает пустую строку, если код имеет другой формат.
+func GTINFromCode(code string) string {
+	if len(code) < 16 || code[:2] != "01" {
+		return ""
+	}
+	for _, c := range code[2:16] {
+		if c < '0' || c > '9' {
+			return ""
+		}
+	}
+	return code[2:16]
+}
+
+// Render выводит этикетки в PDF по шаблону. Каждая этикетка содержит указанные поля
+// по одному на строку; строки, не помещающиеся по ширине, выводятся уменьшенным шрифтом.
+func Render(w io.Writer, tmpl Template, fields []string, labels []Label) error {
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		UnitStr: "mm",
+		Size:    gofpdf.SizeType{Wd: tmpl.PageWidth, Ht: tmpl.PageHeight},
+	})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+
+	cellWidth := (tmpl.PageWidth - 2*tmpl.Margin) / float64(tmpl.Columns)
+	cellHeight := (tmpl.PageHeight - 2*tmpl.Margin) / float64(tmpl.Rows)
+	perPage := tmpl.Columns * tmpl.Rows
+	// Высота строки в мм: размер шрифта в пунктах с межстрочным интервалом 1.2
+	lineHeight := tmpl.FontSize * 0.3528 * 1.2
+
+	for i, label := range labels {
+		if i%perPage == 0 {
+			pdf.AddPage()
+		}
+		position := i % perPage
+		x := tmpl.Margin + float64(position%tmpl.Columns)*cellWidth
+		y := tmpl.Margin + float64(position/tmpl.Columns)*cellHeight
+
+		// Поля выравниваются по вертикали относительно центра этикетки
+		top := y + (cellHeight-lineHeight*float64(len(fields)))/2
+		if top < y {
+			top = y
+		}
+
+		for j, field := range fields {
+			value := label.field(field)
+			if value == "" {
+				continue
+			}
+			text := fieldCaptions[field] + value
+
+			fontSize := tmpl.FontSize
+			style := ""
+			if field == FieldCode {
+				style = "B"
+			}
+			pdf.SetFont("Arial", style, fontSize)
+			for fontSize > 4 && pdf.GetStringWidth(text) > cellWidth-2 {
+				fontSize -= 0.5
+				pdf.SetFontSize(fontSize)
+			}
+
+			pdf.SetXY(x+1, top+float64(j)*lineHeight)
+			pdf.CellFormat(cellWidth-2, lineHeight, text, "", 0, "L", false, 0, "")
+		}
+	}
+
+	if len(labels) == 0 {
+		pdf.AddPage()
+	}
+	return pdf.Output(w)
+}
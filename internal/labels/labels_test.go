@@ -0,0 +1,52 @@
+package labels
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGTINFromCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"010460712345678921abcdEFG", "04607123456789"},
+		{"KIZ123456", ""},
+		{"01046071234A678921abc", ""},
+	}
+
+	for _, tt := range tests {
+		if got := GTINFromCode(tt.code); got != tt.want {
+			t.Errorf("GTINFromCode(%q) = %q, ожидалось %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestValidateFields(t *testing.T) {
+	if err := ValidateFields([]string{FieldCode, FieldGTIN, FieldBatch}); err != nil {
+		t.Errorf("Неожиданная ошибка: %v", err)
+	}
+	if err := ValidateFields([]string{FieldCode, "price"}); err == nil {
+		t.Error("Ожидалась ошибка для неизвестного поля")
+	}
+	if err := ValidateFields([]string{FieldCode, FieldCode}); err == nil {
+		t.Error("Ожидалась ошибка для повторяющегося поля")
+	}
+}
+
+func TestRenderTemplates(t *testing.T) {
+	labels := make([]Label, 30)
+	for i := range labels {
+		labels[i] = Label{Code: "010460712345678921abcdEFG", GTIN: "04607123456789", Batch: "42", Date: "01.02.2025"}
+	}
+
+	for _, tmpl := range Templates() {
+		var buf bytes.Buffer
+		if err := Render(&buf, tmpl, []string{FieldCode, FieldGTIN, FieldBatch, FieldDate}, labels); err != nil {
+			t.Errorf("%s: Render() вернул ошибку: %v", tmpl.Name, err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF")) {
+			t.Errorf("%s: результат не является PDF", tmpl.Name)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package labels
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Форматы выгрузки этикеток
+const (
+	FormatPDF = "pdf" // PDF по шаблону листа этикеток
+	FormatZPL = "zpl" // Команды принтеров Zebra
+	FormatEPL = "epl" // Команды принтеров Zebra/TSC с языком EPL2
+)
+
+// Printer - параметры печати на термопринтере этикеток
+type Printer struct {
+	Width    float64 `json:"width"`    // Ширина этикетки, мм
+	Height   float64 `json:"height"`   // Высота этикетки, мм
+	DPI      int     `json:"dpi"`      // Разрешение печатающей головки: 203, 300 или 600
+	Darkness int     `json:"darkness"` // Плотность печати, 0-30; для EPL делится пополам
+	Speed    int     `json:"speed"`    // Скорость печати, дюймов в секунду
+}
+
+// DefaultPrinter - параметры печати по умолчанию: термоэтикетка 58x40 мм на принтере 203 dpi
+var DefaultPrinter = Printer{Width: 58, Height: 40, DPI: 203, Darkness: 15, Speed: 4}
+
+// WithDefaults возвращает параметры, в которых незаданные значения заменены значениями defaults
+func (p Printer) WithDefaults(defaults Printer) Printer {
+	if p.Width == 0 {
+		p.Width = defaults.Width
+	}
+	if p.Height == 0 {
+		p.Height = defaults.Height
+	}
+	if p.DPI == 0 {
+		p.DPI = defaults.DPI
+	}
+	if p.Darkness == 0 {
+		p.Darkness = defaults.Darkness
+	}
+	if p.Speed == 0 {
+		p.Speed = defaults.Speed
+	}
+	return p
+}
+
+// Validate проверяет параметры печати
+func (p Printer) Validate() error {
+	if p.Width < 20 || p.Width > 120 || p.Height < 15 || p.Height > 300 {
+		return fmt.Errorf("размер этикетки должен быть от 20x15 до 120x300 мм")
+	}
+	if p.DPI != 203 && p.DPI != 300 && p.DPI != 600 {
+		return fmt.Errorf("разрешение принтера должно быть 203, 300 или 600 dpi")
+	}
+	if p.Darkness < 0 || p.Darkness > 30 {
+		return fmt.Errorf("плотность печати должна быть от 0 до 30")
+	}
+	if p.Speed < 1 || p.Speed > 14 {
+		return fmt.Errorf("скорость печати должна быть от 1 до 14 дюймов в секунду")
+	}
+	return nil
+}
+
+// Перевод миллиметров в точки печатающей головки
+func (p Printer) dots(mm float64) int {
+	return int(mm * float64(p.DPI) / 25.4)
+}
+
+// Расположение элементов этикетки в точках: DataMatrix слева, поля справа от него
+type printerLayout struct {
+	margin, module, textX, textWidth, lineHeight int
+}
+
+func (p Printer) layout(fields []string) printerLayout {
+	l := printerLayout{margin: p.dots(2)}
+	width, height := p.dots(p.Width), p.dots(p.Height)
+
+	// Код маркировки Честного ЗНАКа умещается в символ DataMatrix 26x26 модулей
+	symbol := min(height-2*l.margin, width/2)
+	l.module = max(symbol/26, 1)
+	l.textX = l.margin + 26*l.module + l.margin
+	l.textWidth = max(width-l.textX-l.margin, 0)
+
+	l.lineHeight = p.dots(3)
+	if lines := len(fields); lines > 0 && lines*l.lineHeight > height-2*l.margin {
+		l.lineHeight = max((height-2*l.margin)/lines, p.dots(1.5))
+	}
+	return l
+}
+
+// RenderZPL выводит этикетки командами ZPL II: по одной этикетке с символом DataMatrix
+// (GS1, разделитель GS кодируется как FNC1) и указанными полями справа от него
+func RenderZPL(w io.Writer, p Printer, fields []string, labels []Label) error {
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	l := p.layout(fields)
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, "~SD%02d\n", p.Darkness)
+	for _, label := range labels {
+		out.WriteString("^XA\n^CI28\n")
+		fmt.Fprintf(out, "^PW%d\n^LL%d\n^PR%d\n", p.dots(p.Width), p.dots(p.Height), p.Speed)
+		fmt.Fprintf(out, "^FO%d,%d^BXN,%d,200,,,,_^FD_1%s^FS\n", l.margin, l.margin, l.module, zplBarcodeData(label.Code))
+
+		line := 0
+		for _, field := range fields {
+			value := label.field(field)
+			if value == "" || l.textWidth == 0 {
+				continue
+			}
+			fmt.Fprintf(out, "^FO%d,%d^A0N,%d,%d^FB%d,1,0,L^FH^FD%s^FS\n",
+				l.textX, l.margin+line*l.lineHeight, l.lineHeight*4/5, l.lineHeight*2/3, l.textWidth,
+				zplText(fieldCaptions[field]+value))
+			line++
+		}
+		out.WriteString("^XZ\n")
+	}
+	return out.Flush()
+}
+
+// RenderEPL выводит этикетки командами EPL2. Текст передается в кодировке Windows-1251.
+func RenderEPL(w io.Writer, p Printer, fields []string, labels []Label) error {
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	l := p.layout(fields)
+	out := bufio.NewWriter(w)
+
+	out.WriteString("\nI8,C,001\n")
+	for _, label := range labels {
+		fmt.Fprintf(out, "N\nq%d\nQ%d,%d\nS%d\nD%d\n", p.dots(p.Width), p.dots(p.Height), p.dots(3), min(p.Speed, 6), p.Darkness/2)
+		fmt.Fprintf(out, "b%d,%d,D,h%d,\"%s\"\n", l.margin, l.margin, l.module, eplString(label.Code))
+
+		font := eplFont(l.lineHeight)
+		line := 0
+		for _, field := range fields {
+			value := label.field(field)
+			if value == "" || l.textWidth == 0 {
+				continue
+			}
+			fmt.Fprintf(out, "A%d,%d,0,%d,1,1,N,\"", l.textX, l.margin+line*l.lineHeight, font)
+			out.Write(windows1251(eplString(fieldCaptions[field] + value)))
+			out.WriteString("\"\n")
+			line++
+		}
+		out.WriteString("P1\n")
+	}
+	return out.Flush()
+}
+
+// Данные DataMatrix для ZPL: служебные символы передаются через escape-последовательности
+// символа "_", разделитель групп GS заменяется на FNC1
+func zplBarcodeData(code string) string {
+	var b strings.Builder
+	for _, r := range code {
+		switch r {
+		case '\x1d':
+			b.WriteString("_1")
+		case '_', '^', '~':
+			fmt.Fprintf(&b, "_d%03d", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Текст поля ZPL: служебные символы передаются в шестнадцатеричном виде (^FH)
+func zplText(text string) string {
+	return strings.NewReplacer("_", "_5F", "^", "_5E", "~", "_7E").Replace(text)
+}
+
+// Строка в кавычках EPL
+func eplString(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text)
+}
+
+// Наибольший встроенный шрифт EPL, умещающийся в высоту строки в точках
+func eplFont(lineHeight int) int {
+	// Высота символов шрифтов 1-5 в точках для 203 dpi
+	heights := []int{12, 16, 20, 24, 48}
+	font := 1
+	for i, height := range heights {
+		if height <= lineHeight {
+			font = i + 1
+		}
+	}
+	return font
+}
+
+// Перекодировка текста в Windows-1251; символы вне кодировки заменяются на "?"
+func windows1251(text string) []byte {
+	result := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r < 0x80:
+			result = append(result, byte(r))
+		case r >= 'А' && r <= 'я':
+			result = append(result, byte(r-'А'+0xC0))
+		case r == 'Ё':
+			result = append(result, 0xA8)
+		case r == 'ё':
+			result = append(result, 0xB8)
+		case r == '№':
+			result = append(result, 0xB9)
+		default:
+			result = append(result, '?')
+		}
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+package labels
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRenderZPL(t *testing.T) {
+	var buf bytes.Buffer
+	labels := []Label{
+		{Code: "0104607123456789215abc_\x1d93XYZ", GTIN: "04607123456789", Name: "Молоко"},
+		{Code: "0104607123456789215def\x1d93XYZ", GTIN: "04607123456789", Name: "Молоко"},
+	}
+	if err := RenderZPL(&buf, DefaultPrinter, []string{FieldCode, FieldName}, labels); err != nil {
+		t.Fatalf("RenderZPL() вернул ошибку: %v", err)
+	}
+
+	out := buf.String()
+	if n := strings.Count(out, "^XA"); n != 2 {
+		t.Errorf("в потоке %d этикеток, ожидалось 2", n)
+	}
+	if !strings.Contains(out, "~SD15") || !strings.Contains(out, "^PW463") || !strings.Contains(out, "^PR4") {
+		t.Errorf("не заданы плотность, ширина или скорость печати:\n%s", out)
+	}
+	if !strings.Contains(out, "^FD_10104607123456789215abc_d095_193XYZ^FS") {
+		t.Errorf("неверные данные DataMatrix:\n%s", out)
+	}
+	if !strings.Contains(out, "Молоко") {
+		t.Error("на этикетке нет наименования товара")
+	}
+}
+
+func TestRenderEPL(t *testing.T) {
+	var buf bytes.Buffer
+	printer := Printer{Width: 58, Height: 60, DPI: 203, Darkness: 20, Speed: 3}
+	labels := []Label{{Code: "0104607123456789215abc", Batch: "Б-1"}}
+	if err := RenderEPL(&buf, printer, []string{FieldCode, FieldBatch}, labels); err != nil {
+		t.Fatalf("RenderEPL() вернул ошибку: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"q463\n", "Q479,", "S3\n", "D10\n", `"0104607123456789215abc"`, "P1\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("в потоке нет %q:\n%s", want, out)
+		}
+	}
+	if !bytes.Contains(buf.Bytes(), []byte{0xCF, 0xE0, 0xF0, 0xF2, 0xE8, 0xFF, ':', ' ', 0xC1, '-', '1'}) {
+		t.Error("подпись и партия не перекодированы в Windows-1251")
+	}
+}
+
+func TestPrinterValidate(t *testing.T) {
+	if err := DefaultPrinter.Validate(); err != nil {
+		t.Errorf("параметры по умолчанию не прошли проверку: %v", err)
+	}
+	if err := (Printer{Width: 58, Height: 40, DPI: 150, Darkness: 15, Speed: 4}).Validate(); err == nil {
+		t.Error("ожидалась ошибка для разрешения 150 dpi")
+	}
+	if p := (Printer{Darkness: 25}).WithDefaults(DefaultPrinter); p.Darkness != 25 || p.Width != 58 || p.DPI != 203 {
+		t.Errorf("WithDefaults() = %+v", p)
+	}
+}
@@ -0,0 +1,185 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(timeFuncs(time.UTC)).ParseFS(templateFS, "templates/*.html"))
+
+// Функции шаблонов для вывода времени в часовом поясе получателя
+func timeFuncs(loc *time.Location) template.FuncMap {
+	return template.FuncMap{
+		"datetime": func(t time.Time) string { return t.In(loc).Format("02.01.2006 15:04") },
+		"date":     func(t time.Time) string { return t.In(loc).Format("02.01.2006") },
+	}
+}
+
+// Шаблоны писем
+const (
+	TemplateKIZReady       = "kiz_ready.html"
+	TemplatePaymentReceipt = "payment_receipt.html"
+	TemplateFailure        = "failure.html"
+	TemplateDataExport     = "data_export.html"
+	TemplateReport         = "report.html"
+	TemplateInvitation     = "invitation.html"
+)
+
+// Attachment описывает вложение письма
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message описывает письмо в формате HTML
+type Message struct {
+	To          string
+	Subject     string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Client отправляет письма через SMTP-сервер
+type Client struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// NewClient создает SMTP-клиент
+func NewClient(host, port, username, password, from string) *Client {
+	return &Client{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+// Enabled сообщает, настроена ли отправка писем
+func (c *Client) Enabled() bool {
+	return c != nil && c.host != "" && c.from != ""
+}
+
+// Render формирует HTML письма по шаблону; время выводится в часовом поясе loc
+func Render(name string, data any, loc *time.Location) (string, error) {
+	tmpl, err := templates.Clone()
+	if err != nil {
+		return "", fmt.Errorf("ошибка формирования письма %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Funcs(timeFuncs(loc)).ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("ошибка формирования письма %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// Send отправляет письмо
+func (c *Client) Send(msg Message) error {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return fmt.Errorf("некорректный адрес получателя %q: %w", msg.To, err)
+	}
+
+	body, err := buildMessage(c.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if c.username != "" {
+		auth = smtp.PlainAuth("", c.username, c.password, c.host)
+	}
+
+	if err := smtp.SendMail(net.JoinHostPort(c.host, c.port), auth, c.from, []string{msg.To}, body); err != nil {
+		return fmt.Errorf("ошибка отправки письма: %w", err)
+	}
+	return nil
+}
+
+// Формирование MIME-сообщения с HTML-телом и вложениями
+func buildMessage(from string, msg Message, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	headers := []string{
+		"From: " + from,
+		"To: " + msg.To,
+		"Subject: " + mime.BEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + date.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/mixed; boundary=" + writer.Boundary(),
+	}
+	header := strings.Join(headers, "\r\n") + "\r\n\r\n"
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBase64(part, []byte(msg.HTML)); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range msg.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, attachment.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return append([]byte(header), buf.Bytes()...), nil
+}
+
+// Запись данных в base64 со строками по 76 символов
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := fmt.Fprintf(w, "%s\r\n", encoded[:76]); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := fmt.Fprintf(w, "%s\r\n", encoded)
+	return err
+}
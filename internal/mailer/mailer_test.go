@@ -0,0 +1,118 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage(t *testing.T) {
+	msg := Message{
+		To:      "user@example.com",
+		Subject: "Коды маркировки готовы",
+		HTML:    "<p>Готово</p>",
+		Attachments: []Attachment{
+			{Filename: "kizs.pdf", Data: []byte("%PDF-1.3")},
+		},
+	}
+
+	body, err := buildMessage("noreply@example.com", msg, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Ошибка формирования письма: %v", err)
+	}
+
+	text := string(body)
+	for _, want := range []string{
+		"From: noreply@example.com\r\n",
+		"To: user@example.com\r\n",
+		"Subject: =?utf-8?b?",
+		"Content-Type: multipart/mixed; boundary=",
+		"Content-Type: text/html; charset=utf-8",
+		"Content-Type: application/pdf",
+		`Content-Disposition: attachment; filename=kizs.pdf`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("В письме отсутствует %q", want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	html, err := Render(TemplateKIZReady, map[string]any{
+		"RequestID": 42,
+		"INN":       "7707083893",
+		"KIZs":      []string{"KIZ1", "<KIZ2>"},
+	}, time.UTC)
+	if err != nil {
+		t.Fatalf("Ошибка формирования письма: %v", err)
+	}
+
+	if !strings.Contains(html, "Запрос №42 для ИНН 7707083893") {
+		t.Errorf("Письмо не содержит данных запроса: %s", html)
+	}
+	if !strings.Contains(html, "<li>&lt;KIZ2&gt;</li>") {
+		t.Errorf("Код маркировки не экранирован: %s", html)
+	}
+}
+
+func TestRenderDataExport(t *testing.T) {
+	created := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	html, err := Render(TemplateDataExport, map[string]any{
+		"ExportID":  7,
+		"CreatedAt": created,
+		"ExpiresAt": created.Add(24 * time.Hour),
+	}, time.FixedZone("MSK", 3*60*60))
+	if err != nil {
+		t.Fatalf("Ошибка формирования письма: %v", err)
+	}
+
+	if !strings.Contains(html, "запросу №7 от 01.03.2026 13:00") || !strings.Contains(html, "до 02.03.2026 13:00") {
+		t.Errorf("Письмо не содержит данных выгрузки: %s", html)
+	}
+}
+
+func TestRenderInvitation(t *testing.T) {
+	html, err := Render(TemplateInvitation, map[string]any{
+		"INN":         "7707083893",
+		"PartnerName": "Агентство",
+		"Link":        "https://t.me/znak_bot?start=inv_abc",
+		"ExpiresAt":   time.Date(2026, 11, 15, 22, 0, 0, 0, time.UTC),
+	}, time.FixedZone("MSK", 3*60*60))
+	if err != nil {
+		t.Fatalf("Ошибка формирования письма: %v", err)
+	}
+
+	if !strings.Contains(html, "Агентство приглашает") || !strings.Contains(html, `href="https://t.me/znak_bot?start=inv_abc"`) ||
+		!strings.Contains(html, "до 16.11.2026") {
+		t.Errorf("Письмо не содержит данных приглашения: %s", html)
+	}
+}
+
+func TestRenderReport(t *testing.T) {
+	html, err := Render(TemplateReport, map[string]any{
+		"Title": "Отчет за неделю",
+		"From":  time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC),
+		"To":    time.Date(2026, 10, 11, 0, 0, 0, 0, time.UTC),
+		"Summary": map[string]any{
+			"KIZRequests":        3,
+			"CodesOrdered":       1500,
+			"Payments":           1,
+			"AmountSpent":        1234.5,
+			"DocumentsSubmitted": 2,
+			"DocumentsRejected":  0,
+			"FailedRequests":     1,
+		},
+	}, time.UTC)
+	if err != nil {
+		t.Fatalf("Ошибка формирования письма: %v", err)
+	}
+
+	for _, want := range []string{"05.10.2026 – 11.10.2026", "<td>1500</td>", "1 на сумму 1234.50 RUB", "с ошибкой"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("В отчете отсутствует %q: %s", want, html)
+		}
+	}
+	if strings.Contains(html, "Отклонено документов") {
+		t.Errorf("Отчет содержит пустую строку отклоненных документов: %s", html)
+	}
+}
@@ -1,10 +1,16 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"project-znak/internal/money"
 )
 
 // Константы для статусов заказа
@@ -28,20 +34,190 @@ const (
 	PaymentStatusCancelled  = "cancelled"
 )
 
+// Платежные провайдеры: Robokassa принимает оплату в рублях, Stripe - в иностранной валюте
+const (
+	PaymentProviderRobokassa = "robokassa"
+	PaymentProviderStripe    = "stripe"
+	PaymentProviderInvoice   = "invoice" // Оплата по счету банковским переводом
+	PaymentProviderBalance   = "balance" // Оплата с бонусного баланса
+)
+
+// Виды записей журнала платежей: поступление по заказу при проведении платежа и возврат
+// по заказу (с отрицательной суммой)
+const (
+	PaymentLedgerPayment = "payment"
+	PaymentLedgerRefund  = "refund"
+)
+
+// Константы для статусов документа ввода в оборот
+const (
+	DocumentStatusDraft     = "draft"
+	DocumentStatusSubmitted = "submitted"
+	DocumentStatusAccepted  = "accepted"
+	DocumentStatusRejected  = "rejected"
+)
+
+// Статусы запроса кодов маркировки
+const (
+	KIZRequestStatusPending   = "pending"   // Коды запрашиваются
+	KIZRequestStatusCompleted = "completed" // Коды получены
+	KIZRequestStatusFailed    = "failed"    // Временная ошибка; запрос можно повторить
+	KIZRequestStatusDead      = "dead"      // Запрос отклонен или попытки исчерпаны
+	KIZRequestStatusReceived  = "received"  // Коды товаров, принятых от поставщика по УПД
+)
+
+// Статусы выданного кода маркировки
+const (
+	KIZCodeStatusIssued     = "issued"     // Код получен по запросу КИЗ и не использован
+	KIZCodeStatusReserved   = "reserved"   // Код зарезервирован для отгрузки
+	KIZCodeStatusUsed       = "used"       // Код нанесен на товар
+	KIZCodeStatusSpoiled    = "spoiled"    // Код испорчен и не может быть нанесен
+	KIZCodeStatusIntroduced = "introduced" // Товар с кодом введен в оборот
+	KIZCodeStatusRetired    = "retired"    // Товар с кодом выведен из оборота
+)
+
+// KIZCode - код маркировки, выданный по запросу КИЗ
+type KIZCode struct {
+	Code      string    `json:"code" xml:"code"`
+	GTIN      string    `json:"gtin,omitempty" xml:"gtin,omitempty"`
+	RequestID int       `json:"request_id" xml:"request_id"`
+	Status    string    `json:"status" xml:"status"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+}
+
+// InventoryItem - остаток кодов маркировки GTIN. Использованными считаются нанесенные коды,
+// в том числе введенные в оборот и выведенные из оборота. Коды товаров, принятых от
+// поставщиков, учитываются отдельно, пока товар в обороте.
+type InventoryItem struct {
+	GTIN      string `json:"gtin" xml:"gtin"`
+	Available int    `json:"available" xml:"available"`
+	Reserved  int    `json:"reserved" xml:"reserved"`
+	Used      int    `json:"used" xml:"used"`
+	Spoiled   int    `json:"spoiled" xml:"spoiled"`
+	Received  int    `json:"received" xml:"received"` // Товары в обороте, принятые от поставщиков по УПД
+}
+
+// Статусы резерва кодов маркировки
+const (
+	ReservationStatusActive   = "active"   // Коды зарезервированы
+	ReservationStatusReleased = "released" // Резерв снят, неиспользованные коды возвращены в остаток
+)
+
+// KIZReservation - резерв кодов маркировки для отгрузки
+type KIZReservation struct {
+	ID             int        `json:"id" xml:"id"`
+	UserID         int        `json:"user_id" xml:"user_id"`
+	OrganizationID int        `json:"organization_id,omitempty" xml:"organization_id,omitempty"`
+	Reference      string     `json:"reference,omitempty" xml:"reference,omitempty"` // Номер отгрузки или заказа покупателя
+	Status         string     `json:"status" xml:"status"`
+	Codes          []KIZCode  `json:"codes" xml:"codes>code"`
+	CreatedAt      time.Time  `json:"created_at" xml:"created_at"`
+	ReleasedAt     *time.Time `json:"released_at,omitempty" xml:"released_at,omitempty"`
+}
+
+// Константы для способов производства товаров, вводимых в оборот
+const (
+	ProductionTypeProduced = "produced" // Произведен в РФ
+	ProductionTypeImported = "imported" // Ввезен в РФ
+)
+
+// Константы для причин вывода кодов из оборота
+const (
+	RetirementReasonRetail   = "retail"    // Продажа через кассу
+	RetirementReasonExport   = "export"    // Экспорт за пределы РФ
+	RetirementReasonWriteOff = "write_off" // Списание: порча, утрата, уничтожение
+)
+
+// Константы для товарных групп (коды групп в API Честного ЗНАКа)
+const (
+	ProductGroupMilk    = "milk"   // Молочная продукция
+	ProductGroupShoes   = "shoes"  // Обувь
+	ProductGroupClothes = "lp"     // Одежда и товары легкой промышленности
+	ProductGroupWater   = "water"  // Упакованная вода
+	ProductGroupTires   = "tires"  // Шины
+	ProductGroupPerfume = "perfum" // Духи и туалетная вода
+	ProductGroupPhoto   = "photo"  // Фототовары
+)
+
+// ProductGroupNames - названия товарных групп
+var ProductGroupNames = map[string]string{
+	ProductGroupMilk:    "Молочная продукция",
+	ProductGroupShoes:   "Обувь",
+	ProductGroupClothes: "Одежда",
+	ProductGroupWater:   "Упакованная вода",
+	ProductGroupTires:   "Шины",
+	ProductGroupPerfume: "Парфюмерия",
+	ProductGroupPhoto:   "Фототовары",
+}
+
+// IsValidProductGroup проверяет, поддерживается ли товарная группа
+func IsValidProductGroup(group string) bool {
+	_, ok := ProductGroupNames[group]
+	return ok
+}
+
+// Константы для ролей участников организации
+const (
+	OrgRoleOwner      = "owner"
+	OrgRoleAccountant = "accountant"
+	OrgRoleOperator   = "operator"
+	OrgRoleViewer     = "viewer"
+)
+
+// Константы для разрешений ролей
+const (
+	PermOrganizationView = "organization.view"
+	PermMembersManage    = "members.manage"
+	PermOrdersView       = "orders.view"
+	PermOrdersCreate     = "orders.create"
+	PermOrdersCancel     = "orders.cancel"
+	PermPaymentsView     = "payments.view"
+	PermPaymentsCreate   = "payments.create"
+	PermPaymentsRefund   = "payments.refund"
+	PermKIZRequest       = "kiz.request"
+)
+
+// DefaultRolePermissions задает разрешения ролей по умолчанию
+var DefaultRolePermissions = map[string][]string{
+	OrgRoleOwner: {
+		PermOrganizationView, PermMembersManage,
+		PermOrdersView, PermOrdersCreate, PermOrdersCancel,
+		PermPaymentsView, PermPaymentsCreate, PermPaymentsRefund,
+		PermKIZRequest,
+	},
+	OrgRoleAccountant: {
+		PermOrganizationView,
+		PermOrdersView,
+		PermPaymentsView, PermPaymentsCreate,
+	},
+	OrgRoleOperator: {
+		PermOrganizationView,
+		PermOrdersView, PermOrdersCreate, PermOrdersCancel,
+		PermKIZRequest,
+	},
+	OrgRoleViewer: {
+		PermOrganizationView,
+		PermOrdersView,
+		PermPaymentsView,
+	},
+}
+
 // User представляет пользователя системы
 type User struct {
-	ID           int       `json:"id"`
-	FirstName    string    `json:"first_name"`
-	LastName     string    `json:"last_name"`
-	MiddleName   string    `json:"middle_name,omitempty"`
-	INN          string    `json:"inn"`                   // ИНН организации
-	TelegramID   int64     `json:"telegram_id"`           // Уникальный ID в Telegram
-	Email        string    `json:"email"`                 // Электронная почта
-	Username     string    `json:"username"`              // Логин в системе
-	IsAdmin      bool      `json:"is_admin"`              // Права администратора
-	RegisteredAt time.Time `json:"registered_at"`         // Дата регистрации
-	LastActive   time.Time `json:"last_active,omitempty"` // Время последней активности
-	APIKey       string    `json:"api_key,omitempty"`     // API ключ для программного доступа
+	ID           int       `json:"id" xml:"id"`
+	FirstName    string    `json:"first_name" xml:"first_name"`
+	LastName     string    `json:"last_name" xml:"last_name"`
+	MiddleName   string    `json:"middle_name,omitempty" xml:"middle_name,omitempty"`
+	INN          string    `json:"inn" xml:"inn"`                                     // ИНН организации
+	TelegramID   int64     `json:"telegram_id" xml:"telegram_id"`                     // Уникальный ID в Telegram
+	Email        string    `json:"email" xml:"email"`                                 // Электронная почта
+	Username     string    `json:"username" xml:"username"`                           // Логин в системе
+	IsAdmin      bool      `json:"is_admin" xml:"is_admin"`                           // Права администратора
+	RegisteredAt time.Time `json:"registered_at" xml:"registered_at"`                 // Дата регистрации
+	LastActive   time.Time `json:"last_active,omitempty" xml:"last_active,omitempty"` // Время последней активности
+	APIKey       string    `json:"api_key,omitempty" xml:"api_key,omitempty"`         // API ключ для программного доступа
+
+	OrganizationName string `json:"organization_name,omitempty" xml:"organization_name,omitempty"` // Наименование организации по ИНН
 }
 
 // Validate проверяет корректность данных пользователя
@@ -54,6 +230,10 @@ func (u *User) Validate() error {
 		return errors.New("ИНН не может быть пустым")
 	}
 
+	if err := ValidateINN(u.INN); err != nil {
+		return err
+	}
+
 	if u.Email != "" && !strings.Contains(u.Email, "@") {
 		return errors.New("некорректный формат email")
 	}
@@ -61,6 +241,75 @@ func (u *User) Validate() error {
 	return nil
 }
 
+// Весовые коэффициенты для расчета контрольных цифр ИНН
+var (
+	innWeights10   = []int{2, 4, 10, 3, 5, 9, 4, 6, 8}
+	innWeights12n1 = []int{7, 2, 4, 10, 3, 5, 9, 4, 6, 8}
+	innWeights12n2 = []int{3, 7, 2, 4, 10, 3, 5, 9, 4, 6, 8}
+)
+
+// ValidateINN проверяет длину и контрольные цифры ИНН юридического лица (10 цифр)
+// или физического лица / ИП (12 цифр)
+func ValidateINN(inn string) error {
+	if len(inn) != 10 && len(inn) != 12 {
+		return fmt.Errorf("ИНН %q должен содержать 10 или 12 цифр", inn)
+	}
+
+	digits := make([]int, len(inn))
+	for i := 0; i < len(inn); i++ {
+		if inn[i] < '0' || inn[i] > '9' {
+			return fmt.Errorf("ИНН %q должен состоять только из цифр", inn)
+		}
+		digits[i] = int(inn[i] - '0')
+	}
+
+	if len(inn) == 10 {
+		if innChecksum(digits, innWeights10) != digits[9] {
+			return fmt.Errorf("неверная контрольная цифра ИНН %q", inn)
+		}
+		return nil
+	}
+
+	if innChecksum(digits, innWeights12n1) != digits[10] ||
+		innChecksum(digits, innWeights12n2) != digits[11] {
+		return fmt.Errorf("неверные контрольные цифры ИНН %q", inn)
+	}
+
+	return nil
+}
+
+// innChecksum рассчитывает контрольную цифру ИНН по весовым коэффициентам
+func innChecksum(digits []int, weights []int) int {
+	sum := 0
+	for i, w := range weights {
+		sum += digits[i] * w
+	}
+	return sum % 11 % 10
+}
+
+// Имя пользователя Telegram: от 5 до 32 латинских букв, цифр и подчеркиваний, начиная с буквы
+var telegramUsernamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{4,31}$`)
+
+// NormalizeTelegramUsername приводит имя пользователя Telegram, указанное как @name,
+// t.me/name или https://t.me/name, к виду name
+func NormalizeTelegramUsername(username string) string {
+	username = strings.TrimSpace(username)
+	for _, prefix := range []string{"https://", "http://"} {
+		username = strings.TrimPrefix(username, prefix)
+	}
+	username = strings.TrimPrefix(username, "t.me/")
+	return strings.TrimPrefix(username, "@")
+}
+
+// ValidateTelegramUsername проверяет имя пользователя Telegram в любом из видов,
+// которые принимает NormalizeTelegramUsername
+func ValidateTelegramUsername(username string) error {
+	if !telegramUsernamePattern.MatchString(NormalizeTelegramUsername(username)) {
+		return fmt.Errorf("некорректное имя пользователя Telegram %q", username)
+	}
+	return nil
+}
+
 // FullName возвращает полное имя пользователя
 func (u *User) FullName() string {
 	parts := []string{}
@@ -80,12 +329,491 @@ func (u *User) FullName() string {
 	return strings.Join(parts, " ")
 }
 
+// NotificationPreferences задает, какие письма получает пользователь
+type NotificationPreferences struct {
+	UserID          int       `json:"user_id" xml:"user_id"`
+	KIZFiles        bool      `json:"kiz_files" xml:"kiz_files"`               // Файлы с кодами маркировки
+	PaymentReceipts bool      `json:"payment_receipts" xml:"payment_receipts"` // Квитанции об оплате
+	Failures        bool      `json:"failures" xml:"failures"`                 // Уведомления об ошибках
+	Announcements   bool      `json:"announcements" xml:"announcements"`       // Рассылка объявлений в Telegram
+	UpdatedAt       time.Time `json:"updated_at,omitempty" xml:"updated_at,omitempty"`
+}
+
+// DefaultNotificationPreferences возвращает настройки уведомлений по умолчанию: все письма
+// включены, рассылка объявлений - только по согласию пользователя
+func DefaultNotificationPreferences(userID int) NotificationPreferences {
+	return NotificationPreferences{
+		UserID:          userID,
+		KIZFiles:        true,
+		PaymentReceipts: true,
+		Failures:        true,
+	}
+}
+
+// Результаты привязки кодов к сборочным заданиям Wildberries
+const (
+	WBBindingStatusBound   = "bound"   // Код привязан к сборочному заданию
+	WBBindingStatusFailed  = "failed"  // Wildberries отклонил код
+	WBBindingStatusSkipped = "skipped" // Для товара задания нет доступного кода
+)
+
+// WildberriesSettings - подключение пользователя к API Wildberries. Токен возвращается
+// замаскированным.
+type WildberriesSettings struct {
+	Configured bool       `json:"configured" xml:"configured"`
+	Token      string     `json:"token,omitempty" xml:"token,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty" xml:"updated_at,omitempty"`
+}
+
+// WBBinding - результат привязки кода маркировки к сборочному заданию поставки Wildberries
+type WBBinding struct {
+	ID             int64     `json:"id" xml:"id"`
+	UserID         int       `json:"user_id" xml:"user_id"`
+	OrganizationID int       `json:"organization_id,omitempty" xml:"organization_id,omitempty"`
+	SupplyID       string    `json:"supply_id" xml:"supply_id"`
+	OrderID        int64     `json:"order_id" xml:"order_id"`
+	Barcode        string    `json:"barcode,omitempty" xml:"barcode,omitempty"`
+	GTIN           string    `json:"gtin,omitempty" xml:"gtin,omitempty"`
+	Code           string    `json:"code,omitempty" xml:"code,omitempty"`
+	Status         string    `json:"status" xml:"status"`
+	Error          string    `json:"error,omitempty" xml:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at" xml:"created_at"`
+}
+
+// Статусы передачи кодов маркировки в отправление Ozon
+const (
+	OzonSubmissionStatusPending  = "pending"  // Ozon проверяет коды
+	OzonSubmissionStatusAccepted = "accepted" // Коды приняты, отправление можно собирать
+	OzonSubmissionStatusRejected = "rejected" // Коды не прошли проверку Ozon
+	OzonSubmissionStatusFailed   = "failed"   // Ozon не принял запрос передачи кодов
+)
+
+// OzonSettings - подключение пользователя к Ozon Seller API. API-ключ возвращается
+// замаскированным.
+type OzonSettings struct {
+	Configured bool       `json:"configured" xml:"configured"`
+	ClientID   string     `json:"client_id,omitempty" xml:"client_id,omitempty"`
+	APIKey     string     `json:"api_key,omitempty" xml:"api_key,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty" xml:"updated_at,omitempty"`
+}
+
+// OzonSKUMapping - соответствие товара Ozon (SKU) GTIN кодов маркировки. Соответствия
+// организации общие для ее участников.
+type OzonSKUMapping struct {
+	ID             int       `json:"id" xml:"id"`
+	UserID         int       `json:"user_id" xml:"user_id"`
+	OrganizationID int       `json:"organization_id,omitempty" xml:"organization_id,omitempty"`
+	SKU            int64     `json:"sku" xml:"sku"`
+	GTIN           string    `json:"gtin" xml:"gtin"`
+	CreatedAt      time.Time `json:"created_at" xml:"created_at"`
+}
+
+// OzonSubmissionCode - код, переданный для экземпляра товара отправления, и результат его проверки
+type OzonSubmissionCode struct {
+	SKU         int64    `json:"sku" xml:"sku"`
+	GTIN        string   `json:"gtin" xml:"gtin"`
+	Code        string   `json:"code" xml:"code"`
+	CheckStatus string   `json:"check_status,omitempty" xml:"check_status,omitempty"`
+	Errors      []string `json:"errors,omitempty" xml:"errors>error,omitempty"`
+}
+
+// OzonSubmission - передача кодов маркировки в отправление FBS Ozon
+type OzonSubmission struct {
+	ID             int                  `json:"id" xml:"id"`
+	UserID         int                  `json:"user_id" xml:"user_id"`
+	OrganizationID int                  `json:"organization_id,omitempty" xml:"organization_id,omitempty"`
+	PostingNumber  string               `json:"posting_number" xml:"posting_number"`
+	Status         string               `json:"status" xml:"status"`
+	Codes          []OzonSubmissionCode `json:"codes" xml:"codes>code"`
+	Error          string               `json:"error,omitempty" xml:"error,omitempty"`
+	CreatedAt      time.Time            `json:"created_at" xml:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at" xml:"updated_at"`
+}
+
+// Статусы УПД, отправленного покупателю через оператора ЭДО
+const (
+	UPDStatusSent      = "sent"      // Документ принят оператором ЭДО
+	UPDStatusDelivered = "delivered" // Документ доставлен покупателю и ожидает подписи
+	UPDStatusAccepted  = "accepted"  // Покупатель подписал документ
+	UPDStatusRejected  = "rejected"  // Покупатель отказал в подписи
+)
+
+// UPDItem - строка УПД: товар GTIN и коды маркировки переданных единиц. Цена включает НДС.
+type UPDItem struct {
+	GTIN     string   `json:"gtin" xml:"gtin"`
+	Name     string   `json:"name" xml:"name"`
+	Quantity int      `json:"quantity" xml:"quantity"`
+	Price    float64  `json:"price" xml:"price"`
+	VATRate  string   `json:"vat_rate" xml:"vat_rate"`
+	Codes    []string `json:"codes" xml:"codes>code"`
+}
+
+// UPDDocument - универсальный передаточный документ на оптовую отгрузку маркированных
+// товаров, отправленный покупателю через оператора ЭДО
+type UPDDocument struct {
+	ID             int        `json:"id" xml:"id"`
+	UserID         int        `json:"user_id" xml:"user_id"`                               // Автор документа
+	OrganizationID int        `json:"organization_id" xml:"organization_id"`               // Организация-продавец
+	Number         string     `json:"number" xml:"number"`                                 // Номер УПД
+	Date           time.Time  `json:"date" xml:"date"`                                     // Дата УПД
+	BuyerINN       string     `json:"buyer_inn" xml:"buyer_inn"`                           // ИНН покупателя
+	BuyerKPP       string     `json:"buyer_kpp,omitempty" xml:"buyer_kpp,omitempty"`       // КПП покупателя
+	BuyerName      string     `json:"buyer_name" xml:"buyer_name"`                         // Наименование покупателя
+	Items          []UPDItem  `json:"items" xml:"items>item"`                              // Строки документа
+	Total          float64    `json:"total" xml:"total"`                                   // Сумма с НДС
+	Provider       string     `json:"provider" xml:"provider"`                             // Оператор ЭДО
+	ExternalID     string     `json:"external_id" xml:"external_id"`                       // ID документа у оператора
+	FileName       string     `json:"file_name" xml:"file_name"`                           // Имя файла УПД
+	Status         string     `json:"status" xml:"status"`                                 // Статус документооборота
+	Comment        string     `json:"comment,omitempty" xml:"comment,omitempty"`           // Причина отказа покупателя
+	CreatedAt      time.Time  `json:"created_at" xml:"created_at"`                         // Дата отправки
+	ProcessedAt    *time.Time `json:"processed_at,omitempty" xml:"processed_at,omitempty"` // Дата подписи или отказа покупателя
+	UpdatedAt      time.Time  `json:"updated_at" xml:"updated_at"`                         // Дата последнего обновления
+}
+
+// IsFinal проверяет, получен ли ответ покупателя на документ
+func (d *UPDDocument) IsFinal() bool {
+	return d.Status == UPDStatusAccepted || d.Status == UPDStatusRejected
+}
+
+// Статусы входящего УПД, полученного от поставщика
+const (
+	IncomingUPDStatusNew      = "new"      // Документ получен и ожидает приемки
+	IncomingUPDStatusAccepted = "accepted" // Товары приняты, титул покупателя подписан
+	IncomingUPDStatusRejected = "rejected" // Отказано в подписи документа
+)
+
+// IncomingUPDProviderUpload - поставщик входящего УПД, загруженного пользователем вручную,
+// а не полученного через оператора ЭДО
+const IncomingUPDProviderUpload = "upload"
+
+// IncomingUPD - УПД, полученный организацией от поставщика через оператора ЭДО
+type IncomingUPD struct {
+	ID             int        `json:"id" xml:"id"`
+	OrganizationID int        `json:"organization_id" xml:"organization_id"`                      // Организация-покупатель
+	Provider       string     `json:"provider" xml:"provider"`                                    // Оператор ЭДО или upload
+	ExternalID     string     `json:"external_id" xml:"external_id"`                              // ID документа у оператора
+	FileName       string     `json:"file_name" xml:"file_name"`                                  // Имя файла УПД
+	Number         string     `json:"number" xml:"number"`                                        // Номер УПД
+	Date           time.Time  `json:"date" xml:"date"`                                            // Дата УПД
+	SellerINN      string     `json:"seller_inn" xml:"seller_inn"`                                // ИНН поставщика
+	SellerKPP      string     `json:"seller_kpp,omitempty" xml:"seller_kpp,omitempty"`            // КПП поставщика
+	SellerName     string     `json:"seller_name" xml:"seller_name"`                              // Наименование поставщика
+	Items          []UPDItem  `json:"items" xml:"items>item"`                                     // Строки документа с кодами маркировки
+	Total          float64    `json:"total" xml:"total"`                                          // Сумма с НДС
+	Status         string     `json:"status" xml:"status"`                                        // Статус приемки
+	Comment        string     `json:"comment,omitempty" xml:"comment,omitempty"`                  // Причина отказа в подписи
+	AcceptanceIDs  []string   `json:"acceptance_ids,omitempty" xml:"acceptance_ids>id,omitempty"` // Документы приемки в Честном ЗНАКе
+	ProcessedBy    int        `json:"processed_by,omitempty" xml:"processed_by,omitempty"`        // Пользователь, принявший или отклонивший документ
+	ProcessedAt    *time.Time `json:"processed_at,omitempty" xml:"processed_at,omitempty"`        // Дата приемки или отказа
+	CreatedAt      time.Time  `json:"created_at" xml:"created_at"`                                // Дата получения
+	UpdatedAt      time.Time  `json:"updated_at" xml:"updated_at"`                                // Дата последнего обновления
+}
+
+// Codes возвращает коды маркировки всех строк документа
+func (d *IncomingUPD) Codes() []string {
+	var codes []string
+	for _, item := range d.Items {
+		codes = append(codes, item.Codes...)
+	}
+	return codes
+}
+
+// Периодичность отчетов об использовании сервиса
+const (
+	ReportFrequencyOff    = "off"
+	ReportFrequencyDaily  = "daily"
+	ReportFrequencyWeekly = "weekly"
+)
+
+// ReportSettings задает периодичность отчетов пользователя и каналы их доставки
+type ReportSettings struct {
+	UserID    int       `json:"user_id" xml:"user_id"`
+	Frequency string    `json:"frequency" xml:"frequency"`
+	Telegram  bool      `json:"telegram" xml:"telegram"`
+	Email     bool      `json:"email" xml:"email"`
+	UpdatedAt time.Time `json:"updated_at,omitempty" xml:"updated_at,omitempty"`
+}
+
+// ReportSummary - показатели пользователя за период отчета
+type ReportSummary struct {
+	KIZRequests        int     `json:"kiz_requests" xml:"kiz_requests"`               // Запросы кодов
+	CodesOrdered       int     `json:"codes_ordered" xml:"codes_ordered"`             // Полученные коды
+	Payments           int     `json:"payments" xml:"payments"`                       // Проведенные платежи
+	AmountSpent        float64 `json:"amount_spent" xml:"amount_spent"`               // Сумма проведенных платежей
+	DocumentsSubmitted int     `json:"documents_submitted" xml:"documents_submitted"` // Документы, отправленные в Честный ЗНАК
+	DocumentsRejected  int     `json:"documents_rejected" xml:"documents_rejected"`   // Документы, отклоненные Честным ЗНАКом
+	FailedRequests     int     `json:"failed_requests" xml:"failed_requests"`         // Запросы кодов, завершившиеся ошибкой
+}
+
+// Report - отчет пользователя за период [PeriodStart, PeriodEnd)
+type Report struct {
+	ID          int           `json:"id" xml:"id"`
+	UserID      int           `json:"user_id" xml:"user_id"`
+	Frequency   string        `json:"frequency" xml:"frequency"`
+	PeriodStart time.Time     `json:"period_start" xml:"period_start"`
+	PeriodEnd   time.Time     `json:"period_end" xml:"period_end"`
+	Summary     ReportSummary `json:"summary" xml:"summary"`
+	CreatedAt   time.Time     `json:"created_at" xml:"created_at"`
+}
+
+// LabelSettings - шаблон этикеток и поля, которые пользователь выбрал по умолчанию
+// для PDF с кодами маркировки
+type LabelSettings struct {
+	UserID    int       `json:"user_id" xml:"user_id"`
+	Template  string    `json:"template" xml:"template"`
+	Fields    []string  `json:"fields" xml:"fields>field"`
+	UpdatedAt time.Time `json:"updated_at,omitempty" xml:"updated_at,omitempty"`
+}
+
+// APIKey описывает API ключ пользователя. Сам ключ не хранится, только его хэш
+type APIKey struct {
+	ID         int        `json:"id" xml:"id"`
+	UserID     int        `json:"user_id" xml:"user_id"`
+	Prefix     string     `json:"prefix" xml:"prefix"`                                 // Первые символы ключа для его опознания
+	Label      string     `json:"label,omitempty" xml:"label,omitempty"`               // Название ключа, заданное пользователем
+	CreatedAt  time.Time  `json:"created_at" xml:"created_at"`                         // Дата создания
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" xml:"last_used_at,omitempty"` // Время последнего использования
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" xml:"expires_at,omitempty"`     // Срок действия; не задан для бессрочных ключей
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" xml:"revoked_at,omitempty"`     // Время отзыва
+}
+
+// IsActive сообщает, действует ли ключ в момент now
+func (k *APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// Виды попыток, ограничиваемых защитой от подбора
+const (
+	AuthScopeAPIKey       = "api_key"      // Авторизация по API ключу
+	AuthScopeRegistration = "registration" // Регистрация нового пользователя
+	AuthScopeTelegramID   = "telegram_id"  // Запрос без API ключа по telegram_id
+)
+
+// AuthFailure - счетчик неудачных попыток с адреса клиента и его блокировка
+type AuthFailure struct {
+	Scope       string     `json:"scope" xml:"scope"`
+	IP          string     `json:"ip" xml:"ip"`
+	Failures    int        `json:"failures" xml:"failures"`         // Попыток в текущем окне
+	Lockouts    int        `json:"lockouts" xml:"lockouts"`         // Число блокировок подряд; определяет срок следующей
+	WindowStart time.Time  `json:"window_start" xml:"window_start"` // Начало окна подсчета попыток
+	LockedUntil *time.Time `json:"locked_until,omitempty" xml:"locked_until,omitempty"`
+}
+
+// Session - сеанс работы с API: действующий API ключ и устройство, с которого он
+// использовался последним
+type Session struct {
+	ID         int        `json:"id" xml:"id"` // ID API ключа
+	Prefix     string     `json:"prefix" xml:"prefix"`
+	Label      string     `json:"label,omitempty" xml:"label,omitempty"`
+	IP         string     `json:"ip,omitempty" xml:"ip,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty" xml:"user_agent,omitempty"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty" xml:"last_seen_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" xml:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" xml:"expires_at,omitempty"`
+	Current    bool       `json:"current" xml:"current"` // Ключ, с которым выполнен запрос
+}
+
+// Impersonation - сеанс имперсонации: администратор поддержки вызывает API от имени
+// пользователя по временному токену. Сам токен не хранится, только его хэш
+type Impersonation struct {
+	ID          int        `json:"id" xml:"id"`
+	AdminUserID int        `json:"admin_user_id" xml:"admin_user_id"`
+	UserID      int        `json:"user_id" xml:"user_id"`
+	Reason      string     `json:"reason" xml:"reason"`           // Причина, например номер обращения в поддержку
+	AllowWrite  bool       `json:"allow_write" xml:"allow_write"` // Разрешены изменяющие запросы; иначе только чтение
+	CreatedAt   time.Time  `json:"created_at" xml:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at" xml:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" xml:"revoked_at,omitempty"`
+}
+
+// Операции, требующие подтверждения в Telegram
+const (
+	ConfirmationActionRefund       = "payment_refund" // Возврат платежа
+	ConfirmationActionAPIKeyRotate = "api_key_rotate" // Ротация API ключа
+	ConfirmationActionOrder        = "order_create"   // Заказ на крупную сумму
+	ConfirmationActionSchedule     = "order_schedule" // Расписание заказов на крупную сумму
+)
+
+// Статусы подтверждения операции
+const (
+	ConfirmationStatusPending  = "pending"  // Ожидает кода
+	ConfirmationStatusApproved = "approved" // Подтверждено, операцию можно повторить
+	ConfirmationStatusUsed     = "used"     // Операция выполнена
+	ConfirmationStatusRejected = "rejected" // Отклонено пользователем или исчерпаны попытки ввода кода
+	ConfirmationStatusExpired  = "expired"  // Срок действия истек; в БД не хранится
+)
+
+// Confirmation - подтверждение операции одноразовым кодом, отправленным ботом в Telegram
+type Confirmation struct {
+	ID          int        `json:"id" xml:"id"`
+	UserID      int        `json:"-" xml:"-"`
+	Action      string     `json:"action" xml:"action"`
+	Subject     string     `json:"-" xml:"-"`                     // Параметры операции, с которыми она должна быть повторена
+	Description string     `json:"description" xml:"description"` // Описание операции для пользователя
+	Status      string     `json:"status" xml:"status"`
+	Attempts    int        `json:"attempts" xml:"attempts"` // Число неверно введенных кодов
+	ExpiresAt   time.Time  `json:"expires_at" xml:"expires_at"`
+	ApprovedAt  *time.Time `json:"approved_at,omitempty" xml:"approved_at,omitempty"`
+	UsedAt      *time.Time `json:"used_at,omitempty" xml:"used_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at" xml:"created_at"`
+}
+
+// Organization представляет юридическое лицо или ИП, от имени которого работает пользователь
+type Organization struct {
+	ID        int       `json:"id" xml:"id"`
+	INN       string    `json:"inn" xml:"inn"`                       // ИНН организации
+	Name      string    `json:"name,omitempty" xml:"name,omitempty"` // Наименование организации
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`         // Дата создания
+	Role      string    `json:"role,omitempty" xml:"role,omitempty"` // Роль текущего пользователя в организации
+	Requisites
+}
+
+// Validate проверяет корректность данных организации
+func (o *Organization) Validate() error {
+	return ValidateINN(o.INN)
+}
+
+// Partner - партнер (агентство), ведущий маркировку для своих клиентов. Клиенты партнера -
+// организации-субаккаунты, созданные партнером; партнер состоит в них владельцем.
+type Partner struct {
+	ID           int       `json:"id" xml:"id"`
+	UserID       int       `json:"user_id" xml:"user_id"`
+	TelegramID   int64     `json:"telegram_id,omitempty" xml:"telegram_id,omitempty"`
+	Name         string    `json:"name" xml:"name"`
+	RevenueShare float64   `json:"revenue_share" xml:"revenue_share"` // Доля партнера в оплатах клиентов, процентов
+	Accounts     int       `json:"accounts" xml:"accounts"`           // Число субаккаунтов
+	CreatedAt    time.Time `json:"created_at" xml:"created_at"`
+}
+
+// Validate проверяет корректность данных партнера
+func (p *Partner) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("наименование партнера не может быть пустым")
+	}
+	if p.RevenueShare < 0 || p.RevenueShare > 100 {
+		return errors.New("доля партнера должна быть от 0 до 100 процентов")
+	}
+	return nil
+}
+
+// PartnerAccount - субаккаунт партнера: организация клиента
+type PartnerAccount struct {
+	Organization
+	Members int `json:"members" xml:"members"` // Участников организации, включая партнера
+	Orders  int `json:"orders" xml:"orders"`   // Заказов организации
+}
+
+// PartnerBillingLine - проведенные платежи субаккаунта за период в одной валюте
+type PartnerBillingLine struct {
+	OrganizationID int         `json:"organization_id" xml:"organization_id"`
+	INN            string      `json:"inn" xml:"inn"`
+	Name           string      `json:"name,omitempty" xml:"name,omitempty"`
+	Currency       string      `json:"currency" xml:"currency"`
+	Payments       int         `json:"payments" xml:"payments"`
+	Paid           money.Money `json:"paid" xml:"paid"`
+	Share          money.Money `json:"share" xml:"share"` // Вознаграждение партнера
+}
+
+// PartnerBillingTotal - итог оплат клиентов партнера в одной валюте
+type PartnerBillingTotal struct {
+	Currency string      `json:"currency" xml:"currency"`
+	Payments int         `json:"payments" xml:"payments"`
+	Paid     money.Money `json:"paid" xml:"paid"`
+	Share    money.Money `json:"share" xml:"share"`
+}
+
+// PartnerBilling - сводные оплаты клиентов партнера за период [From, To] и вознаграждение партнера
+type PartnerBilling struct {
+	From         time.Time             `json:"from" xml:"from"`
+	To           time.Time             `json:"to" xml:"to"`
+	RevenueShare float64               `json:"revenue_share" xml:"revenue_share"`
+	Lines        []PartnerBillingLine  `json:"lines" xml:"lines>line"`
+	Totals       []PartnerBillingTotal `json:"totals" xml:"totals>total"`
+}
+
+// Requisites - реквизиты организации для счетов на оплату
+type Requisites struct {
+	KPP         string `json:"kpp,omitempty" xml:"kpp,omitempty"`                   // КПП; у ИП не заполняется
+	Address     string `json:"address,omitempty" xml:"address,omitempty"`           // Юридический адрес
+	BankName    string `json:"bank_name,omitempty" xml:"bank_name,omitempty"`       // Наименование банка
+	BIK         string `json:"bik,omitempty" xml:"bik,omitempty"`                   // БИК банка
+	BankAccount string `json:"bank_account,omitempty" xml:"bank_account,omitempty"` // Расчетный счет
+	CorrAccount string `json:"corr_account,omitempty" xml:"corr_account,omitempty"` // Корреспондентский счет банка
+}
+
+// Validate проверяет формат заполненных реквизитов
+func (r *Requisites) Validate() error {
+	for _, field := range []struct {
+		name, value string
+		length      int
+	}{
+		{"КПП", r.KPP, 9},
+		{"БИК", r.BIK, 9},
+		{"Расчетный счет", r.BankAccount, 20},
+		{"Корреспондентский счет", r.CorrAccount, 20},
+	} {
+		if field.value != "" && !isDigits(field.value, field.length) {
+			return fmt.Errorf("%s должен содержать %d цифр", field.name, field.length)
+		}
+	}
+	return nil
+}
+
+// Проверка, что строка состоит ровно из length цифр
+func isDigits(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// OrganizationMember представляет участие пользователя в организации
+type OrganizationMember struct {
+	OrganizationID int       `json:"organization_id" xml:"organization_id"`
+	UserID         int       `json:"user_id" xml:"user_id"`
+	TelegramID     int64     `json:"telegram_id,omitempty" xml:"telegram_id,omitempty"`
+	Role           string    `json:"role" xml:"role"`             // Роль участника
+	CreatedAt      time.Time `json:"created_at" xml:"created_at"` // Дата добавления
+}
+
+// IsValidOrgRole проверяет, является ли роль участника организации допустимой
+func IsValidOrgRole(role string) bool {
+	switch role {
+	case OrgRoleOwner, OrgRoleAccountant, OrgRoleOperator, OrgRoleViewer:
+		return true
+	}
+	return false
+}
+
 // OrderItem представляет товарную позицию в заказе
 type OrderItem struct {
-	ID       int     `json:"id"`
-	GTIN     string  `json:"gtin"`            // Глобальный номер товара
-	Quantity int     `json:"quantity"`        // Количество
-	Price    float64 `json:"price,omitempty"` // Цена за единицу
+	ID           int     `json:"id" xml:"id"`
+	GTIN         string  `json:"gtin" xml:"gtin"`                                       // Глобальный номер товара
+	Quantity     int     `json:"quantity" xml:"quantity"`                               // Количество
+	Price        float64 `json:"price,omitempty" xml:"price,omitempty"`                 // Цена за единицу
+	ProductName  string  `json:"product_name,omitempty" xml:"product_name,omitempty"`   // Наименование из Национального каталога
+	ProductGroup string  `json:"product_group,omitempty" xml:"product_group,omitempty"` // Товарная группа
+
+	// Плата Честного ЗНАКа за код и маржа позиции: (цена - плата) * количество.
+	// Не заполняются у позиций, созданных до учета маржи.
+	FeeCost *float64 `json:"fee_cost,omitempty" xml:"fee_cost,omitempty"`
+	Margin  *float64 `json:"margin,omitempty" xml:"margin,omitempty"`
+}
+
+// SetCost запоминает плату Честного ЗНАКа за код и рассчитывает маржу позиции по ее цене
+func (oi *OrderItem) SetCost(feeCost float64) {
+	margin := math.Round((oi.Price-feeCost)*float64(oi.Quantity)*100) / 100
+	oi.FeeCost = &feeCost
+	oi.Margin = &margin
 }
 
 // Validate проверяет корректность товарной позиции
@@ -94,6 +822,10 @@ func (oi *OrderItem) Validate() error {
 		return errors.New("GTIN не может быть пустым")
 	}
 
+	if err := ValidateGTIN(oi.GTIN); err != nil {
+		return err
+	}
+
 	if oi.Quantity <= 0 {
 		return errors.New("количество должно быть положительным числом")
 	}
@@ -101,16 +833,119 @@ func (oi *OrderItem) Validate() error {
 	return nil
 }
 
+// ValidateGTIN проверяет длину и контрольную цифру GTIN (GTIN-8, 12, 13 или 14)
+func ValidateGTIN(gtin string) error {
+	switch len(gtin) {
+	case 8, 12, 13, 14:
+	default:
+		return fmt.Errorf("GTIN %q должен содержать 8, 12, 13 или 14 цифр", gtin)
+	}
+
+	sum := 0
+	for i := len(gtin) - 1; i >= 0; i-- {
+		c := gtin[i]
+		if c < '0' || c > '9' {
+			return fmt.Errorf("GTIN %q должен состоять только из цифр", gtin)
+		}
+		if i == len(gtin)-1 {
+			continue
+		}
+
+		digit := int(c - '0')
+		// Веса 3 и 1 чередуются, начиная с позиции слева от контрольной цифры
+		if (len(gtin)-1-i)%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+
+	expected := (10 - sum%10) % 10
+	if actual := int(gtin[len(gtin)-1] - '0'); actual != expected {
+		return fmt.Errorf("неверная контрольная цифра GTIN %q: ожидалась %d, получена %d", gtin, expected, actual)
+	}
+
+	return nil
+}
+
+// NormalizeGTIN дополняет GTIN ведущими нулями до 14 цифр, как того требует Честный ЗНАК
+func NormalizeGTIN(gtin string) string {
+	if len(gtin) >= 14 {
+		return gtin
+	}
+	return strings.Repeat("0", 14-len(gtin)) + gtin
+}
+
 // Order представляет заказ пользователя
 type Order struct {
-	ID          int         `json:"id"`
-	UserID      int         `json:"user_id"`              // Ссылка на пользователя
-	Items       []OrderItem `json:"items"`                // Список товаров
-	TotalAmount float64     `json:"total_amount"`         // Общая сумма
-	Status      string      `json:"status"`               // Статус заказа
-	PaymentID   string      `json:"payment_id"`           // ID платежа
-	CreatedAt   time.Time   `json:"created_at"`           // Дата создания
-	UpdatedAt   time.Time   `json:"updated_at,omitempty"` // Дата последнего обновления
+	ID             int         `json:"id" xml:"id"`
+	UserID         int         `json:"user_id" xml:"user_id"`                                     // Ссылка на пользователя
+	OrganizationID int         `json:"organization_id,omitempty" xml:"organization_id,omitempty"` // Организация, от имени которой сделан заказ
+	ProductGroup   string      `json:"product_group,omitempty" xml:"product_group,omitempty"`     // Товарная группа
+	Items          []OrderItem `json:"items" xml:"items>item"`                                    // Список товаров
+	TotalAmount    float64     `json:"total_amount" xml:"total_amount"`                           // Общая сумма
+	Status         string      `json:"status" xml:"status"`                                       // Статус заказа
+	PaymentID      string      `json:"payment_id" xml:"payment_id"`                               // ID платежа
+	CreatedAt      time.Time   `json:"created_at" xml:"created_at"`                               // Дата создания
+	UpdatedAt      time.Time   `json:"updated_at,omitempty" xml:"updated_at,omitempty"`           // Дата последнего обновления
+	Version        int         `json:"version" xml:"version"`                                     // Версия, увеличивается при смене статуса
+}
+
+// OrderTemplate - сохраненный набор позиций для повторяющихся заказов
+type OrderTemplate struct {
+	ID             int         `json:"id" xml:"id"`
+	UserID         int         `json:"user_id" xml:"user_id"`
+	OrganizationID int         `json:"organization_id,omitempty" xml:"organization_id,omitempty"` // Организация, от имени которой делается заказ
+	Name           string      `json:"name" xml:"name"`
+	ProductGroup   string      `json:"product_group,omitempty" xml:"product_group,omitempty"`
+	Items          []OrderLine `json:"items" xml:"items>item"`
+	CreatedAt      time.Time   `json:"created_at" xml:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at" xml:"updated_at"`
+}
+
+// OrderLine - GTIN и количество кодов позиции шаблона заказа, расписания или корзины
+type OrderLine struct {
+	GTIN     string `json:"gtin" xml:"gtin"`
+	Quantity int    `json:"quantity" xml:"quantity"`
+}
+
+// Статусы расписания заказов
+const (
+	OrderScheduleStatusActive = "active"
+	OrderScheduleStatusPaused = "paused"
+)
+
+// OrderSchedule - расписание повторяющихся заказов. В моменты, заданные выражением cron
+// в часовом поясе пользователя, создается заказ, оплачивается с бонусного баланса
+// и по нему запрашиваются коды маркировки.
+type OrderSchedule struct {
+	ID             int         `json:"id" xml:"id"`
+	UserID         int         `json:"user_id" xml:"user_id"`
+	OrganizationID int         `json:"organization_id,omitempty" xml:"organization_id,omitempty"` // Организация, от имени которой делается заказ
+	Name           string      `json:"name" xml:"name"`
+	Cron           string      `json:"cron" xml:"cron"`
+	ProductGroup   string      `json:"product_group,omitempty" xml:"product_group,omitempty"`
+	Items          []OrderLine `json:"items" xml:"items>item"`
+	Status         string      `json:"status" xml:"status"`
+	NextRunAt      *time.Time  `json:"next_run_at,omitempty" xml:"next_run_at,omitempty"`     // Не заполняется у приостановленного расписания
+	LastRunAt      *time.Time  `json:"last_run_at,omitempty" xml:"last_run_at,omitempty"`     // Время последнего запуска
+	LastOrderID    int         `json:"last_order_id,omitempty" xml:"last_order_id,omitempty"` // Заказ, созданный последним запуском
+	LastError      string      `json:"last_error,omitempty" xml:"last_error,omitempty"`       // Ошибка последнего запуска
+	CreatedAt      time.Time   `json:"created_at" xml:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at" xml:"updated_at"`
+	Version        int         `json:"version" xml:"version"` // Версия, увеличивается при каждом изменении
+}
+
+// Cart - корзина пользователя: позиции будущего заказа, сохраняемые между запросами.
+// Цены и итоги рассчитываются по текущему тарифу при каждом чтении корзины.
+type Cart struct {
+	UserID         int         `json:"user_id" xml:"user_id"`
+	OrganizationID int         `json:"organization_id,omitempty" xml:"organization_id,omitempty"` // Организация, от имени которой будет сделан заказ
+	ProductGroup   string      `json:"product_group,omitempty" xml:"product_group,omitempty"`
+	Lines          []OrderLine `json:"-" xml:"-"`              // Сохраненные позиции
+	Items          []OrderItem `json:"items" xml:"items>item"` // Позиции с ценами по тарифу
+	TotalCodes     int         `json:"total_codes" xml:"total_codes"`
+	TotalAmount    float64     `json:"total_amount" xml:"total_amount"`
+	UpdatedAt      *time.Time  `json:"updated_at,omitempty" xml:"updated_at,omitempty"` // Не заполняется у пустой корзины
 }
 
 // Validate проверяет корректность заказа
@@ -123,6 +958,10 @@ func (o *Order) Validate() error {
 		return errors.New("заказ должен содержать хотя бы один товар")
 	}
 
+	if o.ProductGroup != "" && !IsValidProductGroup(o.ProductGroup) {
+		return fmt.Errorf("неизвестная товарная группа %q", o.ProductGroup)
+	}
+
 	for i, item := range o.Items {
 		if err := item.Validate(); err != nil {
 			return errors.New(
@@ -137,6 +976,29 @@ func (o *Order) Validate() error {
 	return nil
 }
 
+// ResolveProductGroup определяет товарную группу заказа по позициям, если она не указана,
+// и проверяет, что все позиции относятся к группе заказа. Позиции без группы не проверяются.
+func (o *Order) ResolveProductGroup() error {
+	for _, item := range o.Items {
+		if item.ProductGroup == "" {
+			continue
+		}
+		if o.ProductGroup == "" {
+			o.ProductGroup = item.ProductGroup
+			continue
+		}
+		if item.ProductGroup != o.ProductGroup {
+			return fmt.Errorf("товар с GTIN %s относится к товарной группе %q, а заказ - к группе %q",
+				item.GTIN, item.ProductGroup, o.ProductGroup)
+		}
+	}
+
+	if o.ProductGroup != "" && !IsValidProductGroup(o.ProductGroup) {
+		return fmt.Errorf("товарная группа %q не поддерживается", o.ProductGroup)
+	}
+	return nil
+}
+
 // IsValidStatus проверяет, является ли статус заказа допустимым
 func (o *Order) IsValidStatus(status string) bool {
 	validStatuses := []string{
@@ -171,16 +1033,286 @@ func (o *Order) CalculateTotal() float64 {
 	return total
 }
 
+// Tariff - стоимость одного кода маркировки для товарной группы
+type Tariff struct {
+	ProductGroup string    `json:"product_group" xml:"product_group"`
+	UnitPrice    float64   `json:"unit_price" xml:"unit_price"` // Цена кода, руб.
+	UpdatedAt    time.Time `json:"updated_at" xml:"updated_at"`
+
+	// Плата Честного ЗНАКа за код, руб.; если не указана при изменении тарифа,
+	// сохраняется прежняя
+	FeeCost *float64 `json:"fee_cost,omitempty" xml:"fee_cost,omitempty"`
+}
+
+// Validate проверяет корректность тарифа
+func (t *Tariff) Validate() error {
+	if !IsValidProductGroup(t.ProductGroup) {
+		return fmt.Errorf("неизвестная товарная группа %q", t.ProductGroup)
+	}
+	if t.UnitPrice <= 0 {
+		return errors.New("стоимость кода должна быть положительным числом")
+	}
+	if t.FeeCost != nil && *t.FeeCost < 0 {
+		return errors.New("плата за код не может быть отрицательной")
+	}
+	return nil
+}
+
+// Метрики квот тарифного плана
+const (
+	QuotaCodes    = "codes"    // Коды маркировки за календарный месяц
+	QuotaRequests = "requests" // Запросы к API по API ключу за сутки
+)
+
+// Plan - тарифный план с квотами на коды маркировки и запросы к API. Нулевая квота
+// не ограничивает потребление.
+type Plan struct {
+	Name          string    `json:"name" xml:"name"`
+	Title         string    `json:"title" xml:"title"`
+	MonthlyCodes  int64     `json:"monthly_codes" xml:"monthly_codes"`
+	DailyRequests int64     `json:"daily_requests" xml:"daily_requests"`
+	UpdatedAt     time.Time `json:"updated_at" xml:"updated_at"`
+}
+
+// DefaultPlans - тарифные планы, создаваемые при миграции. Квоты существующих планов
+// не изменяются, чтобы сохранить настроенные администратором значения.
+var DefaultPlans = []Plan{
+	{Name: "start", Title: "Старт", MonthlyCodes: 10000, DailyRequests: 10000},
+	{Name: "business", Title: "Бизнес", MonthlyCodes: 100000, DailyRequests: 100000},
+	{Name: "enterprise", Title: "Корпоративный"},
+}
+
+// Validate проверяет корректность тарифного плана
+func (p *Plan) Validate() error {
+	if p.Name == "" || p.Title == "" {
+		return errors.New("необходимо указать код name и название title плана")
+	}
+	if p.MonthlyCodes < 0 || p.DailyRequests < 0 {
+		return errors.New("квоты плана не могут быть отрицательными")
+	}
+	return nil
+}
+
+// Quota - потребление по метрике тарифного плана за текущий период
+type Quota struct {
+	Metric    string    `json:"metric" xml:"metric"`       // codes или requests
+	Period    string    `json:"period" xml:"period"`       // month или day
+	Limit     int64     `json:"limit" xml:"limit"`         // 0 - без ограничения
+	Used      int64     `json:"used" xml:"used"`           // Потреблено с начала периода
+	Remaining *int64    `json:"remaining" xml:"remaining"` // Остаток; null - без ограничения
+	ResetsAt  time.Time `json:"resets_at" xml:"resets_at"` // Начало следующего периода
+}
+
+// Usage - тарифный план пользователя и потребление по его квотам
+type Usage struct {
+	Plan   *Plan   `json:"plan"` // null - план не назначен, потребление не ограничено
+	Quotas []Quota `json:"quotas"`
+}
+
+// Статусы фискализации платежа
+const (
+	FiscalStatusPending    = "pending"    // Чек ожидает регистрации в онлайн-кассе
+	FiscalStatusRegistered = "registered" // Чек зарегистрирован, реквизиты получены
+	FiscalStatusFailed     = "failed"     // Попытки регистрации исчерпаны
+)
+
+// FiscalReceipt - кассовый чек по платежу (54-ФЗ)
+type FiscalReceipt struct {
+	ID                      int        `json:"id" xml:"id"`
+	PaymentID               int        `json:"payment_id" xml:"payment_id"`
+	Provider                string     `json:"provider" xml:"provider"`                                                       // Оператор фискальных данных
+	Status                  string     `json:"status" xml:"status"`                                                           // Статус фискализации
+	Attempts                int        `json:"attempts" xml:"attempts"`                                                       // Число неудачных попыток регистрации
+	Error                   string     `json:"error,omitempty" xml:"error,omitempty"`                                         // Последняя ошибка регистрации
+	FiscalDocumentNumber    string     `json:"fiscal_document_number,omitempty" xml:"fiscal_document_number,omitempty"`       // ФД
+	FiscalDocumentAttribute string     `json:"fiscal_document_attribute,omitempty" xml:"fiscal_document_attribute,omitempty"` // ФПД
+	FNNumber                string     `json:"fn_number,omitempty" xml:"fn_number,omitempty"`                                 // Номер фискального накопителя
+	ReceiptNumber           string     `json:"receipt_number,omitempty" xml:"receipt_number,omitempty"`                       // Номер чека в смене
+	ShiftNumber             string     `json:"shift_number,omitempty" xml:"shift_number,omitempty"`                           // Номер смены
+	RegistrationNumber      string     `json:"registration_number,omitempty" xml:"registration_number,omitempty"`             // Регистрационный номер ККТ
+	FNSSite                 string     `json:"fns_site,omitempty" xml:"fns_site,omitempty"`                                   // Сайт ФНС для проверки чека
+	RegisteredAt            *time.Time `json:"registered_at,omitempty" xml:"registered_at,omitempty"`                         // Время регистрации чека
+	CreatedAt               time.Time  `json:"created_at" xml:"created_at"`
+
+	ExternalID string `json:"-" xml:"-"` // Идентификатор текущей попытки регистрации
+	ProviderID string `json:"-" xml:"-"` // Идентификатор чека у оператора
+}
+
+// Каналы доставки сообщений outbox
+const (
+	OutboxChannelWebhook  = "webhook"
+	OutboxChannelTelegram = "telegram"
+	OutboxChannelEmail    = "email"
+)
+
+// Статусы сообщений outbox
+const (
+	OutboxStatusPending = "pending" // Ожидает доставки
+	OutboxStatusSent    = "sent"    // Доставлено
+	OutboxStatusDead    = "dead"    // Попытки доставки исчерпаны
+)
+
+// OutboxMessage - уведомление, записанное в одной транзакции с изменением состояния
+// и доставляемое фоновой задачей
+type OutboxMessage struct {
+	ID        int             `json:"id" xml:"id"`
+	Channel   string          `json:"channel" xml:"channel"`
+	UserID    int             `json:"user_id,omitempty" xml:"user_id,omitempty"` // Получатель сообщения Telegram и письма
+	Payload   json.RawMessage `json:"payload" xml:"payload"`
+	Status    string          `json:"status" xml:"status"`
+	Attempts  int             `json:"attempts" xml:"attempts"`
+	Error     string          `json:"error,omitempty" xml:"error,omitempty"` // Последняя ошибка доставки
+	CreatedAt time.Time       `json:"created_at" xml:"created_at"`
+	SentAt    *time.Time      `json:"sent_at,omitempty" xml:"sent_at,omitempty"`
+}
+
+// Уровни важности объявлений
+const (
+	AnnouncementLevelInfo     = "info"     // Новости сервиса, например новые товарные группы
+	AnnouncementLevelWarning  = "warning"  // Плановые работы, перебои Честного ЗНАКа
+	AnnouncementLevelCritical = "critical" // Сервис или Честный ЗНАК недоступны
+)
+
+// Announcement - объявление для пользователей, которое показывается клиентами с StartsAt
+// до EndsAt и при Broadcast рассылается в Telegram пользователям, согласившимся на рассылку
+type Announcement struct {
+	ID              int        `json:"id" xml:"id"`
+	Title           string     `json:"title" xml:"title"`
+	Text            string     `json:"text" xml:"text"`
+	Level           string     `json:"level" xml:"level"`
+	StartsAt        time.Time  `json:"starts_at" xml:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at,omitempty" xml:"ends_at,omitempty"` // Без даты окончания объявление действует до снятия
+	Broadcast       bool       `json:"broadcast" xml:"broadcast"`
+	BroadcastCount  int        `json:"broadcast_count,omitempty" xml:"broadcast_count,omitempty"`     // Сколько сообщений поставлено в очередь
+	BroadcastDoneAt *time.Time `json:"broadcast_done_at,omitempty" xml:"broadcast_done_at,omitempty"` // Рассылка поставлена в очередь всем получателям
+	CreatedBy       int        `json:"created_by,omitempty" xml:"created_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at" xml:"created_at"`
+}
+
+// Статусы обращений в поддержку
+const (
+	SupportTicketStatusOpen       = "open"        // Обращение создано и ожидает рассмотрения
+	SupportTicketStatusInProgress = "in_progress" // Поддержка разбирается с проблемой
+	SupportTicketStatusResolved   = "resolved"    // Проблема решена или обращение закрыто
+)
+
+// SupportTicket - обращение пользователя в поддержку, при необходимости привязанное
+// к запросу КИЗ или платежу
+type SupportTicket struct {
+	ID          int       `json:"id" xml:"id"`
+	UserID      int       `json:"user_id" xml:"user_id"`
+	RequestID   int       `json:"request_id,omitempty" xml:"request_id,omitempty"` // Запрос КИЗ, с которым возникла проблема
+	PaymentID   int       `json:"payment_id,omitempty" xml:"payment_id,omitempty"` // Платеж, с которым возникла проблема
+	Description string    `json:"description" xml:"description"`
+	Status      string    `json:"status" xml:"status"`
+	Reply       string    `json:"reply,omitempty" xml:"reply,omitempty"` // Последний ответ поддержки
+	CreatedAt   time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" xml:"updated_at"`
+}
+
+// Статусы компонентов сервиса на странице статуса
+const (
+	ComponentStatusOK       = "ok"       // Компонент работает
+	ComponentStatusDegraded = "degraded" // Компонент работает с ограничениями или задержками
+	ComponentStatusError    = "error"    // Компонент недоступен
+	ComponentStatusDisabled = "disabled" // Компонент не настроен
+)
+
+// ComponentStatus - состояние компонента сервиса на странице статуса
+type ComponentStatus struct {
+	Component string    `json:"component" xml:"component"`
+	Status    string    `json:"status" xml:"status"`                       // ok, degraded, error или disabled
+	Backlog   int       `json:"backlog,omitempty" xml:"backlog,omitempty"` // Число ожидающих задач для очередей
+	CheckedAt time.Time `json:"checked_at" xml:"checked_at"`               // Время последней проверки
+	ChangedAt time.Time `json:"changed_at" xml:"changed_at"`               // Время последней смены статуса
+}
+
+// StatusIncident - период, когда компонент сервиса был недоступен или работал с ограничениями
+type StatusIncident struct {
+	ID         int        `json:"id" xml:"id"`
+	Component  string     `json:"component" xml:"component"`
+	Status     string     `json:"status" xml:"status"` // Худший статус за время инцидента: degraded или error
+	Message    string     `json:"message,omitempty" xml:"message,omitempty"`
+	StartedAt  time.Time  `json:"started_at" xml:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty" xml:"resolved_at,omitempty"` // Пусто, пока инцидент продолжается
+}
+
+// Статусы выгрузки данных пользователя
+const (
+	DataExportStatusPending = "pending" // Архив формируется
+	DataExportStatusReady   = "ready"   // Архив готов к скачиванию
+	DataExportStatusFailed  = "failed"  // Архив сформировать не удалось
+)
+
+// DataExport - выгрузка данных пользователя по его запросу
+type DataExport struct {
+	ID          int        `json:"id" xml:"id"`
+	UserID      int        `json:"user_id" xml:"user_id"`
+	Status      string     `json:"status" xml:"status"`
+	Error       string     `json:"error,omitempty" xml:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at" xml:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" xml:"completed_at,omitempty"`
+
+	FilePath string `json:"-" xml:"-"` // Путь к ZIP-архиву
+}
+
+// Статусы счетов на оплату банковским переводом
+const (
+	InvoiceStatusIssued    = "issued"    // Выставлен, ожидает оплаты
+	InvoiceStatusPaid      = "paid"      // Оплачен, оплата подтверждена администратором
+	InvoiceStatusCancelled = "cancelled" // Отменен вместе с заказом
+)
+
+// Invoice - счет на оплату заказа банковским переводом
+type Invoice struct {
+	ID                 int         `json:"id" xml:"id"`
+	Number             string      `json:"number" xml:"number"`                                                 // Номер счета
+	OrderID            int         `json:"order_id" xml:"order_id"`                                             // Оплачиваемый заказ
+	OrganizationID     int         `json:"organization_id,omitempty" xml:"organization_id,omitempty"`           // Организация-плательщик
+	UserID             int         `json:"user_id" xml:"user_id"`                                               // Пользователь, выставивший счет
+	PaymentID          int         `json:"payment_id,omitempty" xml:"payment_id,omitempty"`                     // Платеж, созданный при подтверждении оплаты
+	Amount             money.Money `json:"amount" xml:"amount"`                                                 // Сумма к оплате
+	Status             string      `json:"status" xml:"status"`                                                 // Статус счета
+	DueDate            time.Time   `json:"due_date" xml:"due_date"`                                             // Срок оплаты
+	PaymentOrderNumber string      `json:"payment_order_number,omitempty" xml:"payment_order_number,omitempty"` // Номер платежного поручения
+	PaidAt             *time.Time  `json:"paid_at,omitempty" xml:"paid_at,omitempty"`                           // Дата оплаты
+	CreatedAt          time.Time   `json:"created_at" xml:"created_at"`                                         // Дата выставления
+}
+
 // Payment представляет платежную операцию
 type Payment struct {
-	ID            int        `json:"id"`
-	OrderID       int        `json:"order_id"`               // Связанный заказ
-	Amount        float64    `json:"amount"`                 // Сумма платежа
-	Status        string     `json:"status"`                 // Статус платежа
-	TransactionID string     `json:"transaction_id"`         // ID транзакции
-	CreatedAt     time.Time  `json:"created_at"`             // Дата создания платежа
-	CompletedAt   *time.Time `json:"completed_at,omitempty"` // Дата завершения платежа
-	Currency      string     `json:"currency,omitempty"`     // Валюта платежа
+	ID            int         `json:"id" xml:"id"`
+	OrderID       int         `json:"order_id" xml:"order_id"`                               // Связанный заказ
+	Amount        money.Money `json:"amount" xml:"amount"`                                   // Сумма платежа
+	Status        string      `json:"status" xml:"status"`                                   // Статус платежа
+	TransactionID string      `json:"transaction_id" xml:"transaction_id"`                   // ID транзакции
+	CreatedAt     time.Time   `json:"created_at" xml:"created_at"`                           // Дата создания платежа
+	CompletedAt   *time.Time  `json:"completed_at,omitempty" xml:"completed_at,omitempty"`   // Дата завершения платежа
+	Currency      string      `json:"currency,omitempty" xml:"currency,omitempty"`           // Валюта платежа, совпадает с Amount.Currency
+	UserID        int         `json:"user_id,omitempty" xml:"user_id,omitempty"`             // Плательщик
+	ReviewReason  string      `json:"review_reason,omitempty" xml:"review_reason,omitempty"` // Причина, по которой платеж требует проверки администратором
+	Provider      string      `json:"provider,omitempty" xml:"provider,omitempty"`           // Платежный провайдер
+
+	// Сумма, зачисленная провайдером в валюте расчетов; для Stripe может отличаться от валюты платежа
+	SettlementCurrency string       `json:"settlement_currency,omitempty" xml:"settlement_currency,omitempty"`
+	SettlementAmount   *money.Money `json:"settlement_amount,omitempty" xml:"settlement_amount,omitempty"`
+
+	// Номер счета на оплату заказа; заполняется в списке платежей
+	InvoiceNumber string `json:"invoice_number,omitempty" xml:"invoice_number,omitempty"`
+
+	// Версия платежа, увеличивается при смене статуса
+	Version int `json:"version" xml:"version"`
+
+	// Заказы пакетного платежа с долей суммы каждого
+	Orders []PaymentOrder `json:"orders,omitempty" xml:"orders>order,omitempty"`
+}
+
+// PaymentOrder - доля пакетного платежа, приходящаяся на заказ, и сумма, возвращенная
+// по заказу
+type PaymentOrder struct {
+	OrderID  int         `json:"order_id" xml:"order_id"`
+	Amount   money.Money `json:"amount" xml:"amount"`
+	Refunded money.Money `json:"refunded" xml:"refunded"`
 }
 
 // Validate проверяет корректность данных платежа
@@ -189,7 +1321,7 @@ func (p *Payment) Validate() error {
 		return errors.New("ID заказа должен быть положительным числом")
 	}
 
-	if p.Amount <= 0 {
+	if !p.Amount.IsPositive() {
 		return errors.New("сумма платежа должна быть положительным числом")
 	}
 
@@ -220,3 +1352,156 @@ func (p *Payment) IsValidStatus(status string) bool {
 func (p *Payment) IsCompleted() bool {
 	return p.Status == PaymentStatusCompleted
 }
+
+// Виды операций по бонусному балансу пользователя
+const (
+	BalanceKindReferralBonus = "referral_bonus" // Бонус за первый платеж приглашенного пользователя
+	BalanceKindOrderPayment  = "order_payment"  // Оплата заказа с баланса
+)
+
+// Referral - пользователь, зарегистрировавшийся по реферальной ссылке. Данные приглашенного
+// пользователя не раскрываются пригласившему.
+type Referral struct {
+	RegisteredAt time.Time    `json:"registered_at" xml:"registered_at"`
+	PaidAt       *time.Time   `json:"paid_at,omitempty" xml:"paid_at,omitempty"` // Дата первого платежа
+	Bonus        *money.Money `json:"bonus,omitempty" xml:"bonus,omitempty"`     // Начисленный бонус
+}
+
+// ReferralStats - реферальная ссылка пользователя и приглашенные им пользователи
+type ReferralStats struct {
+	Code         string      `json:"code" xml:"code"`
+	Link         string      `json:"link,omitempty" xml:"link,omitempty"`
+	Bonus        money.Money `json:"bonus" xml:"bonus"`                                     // Бонус за первый платеж приглашенного
+	BonusPercent float64     `json:"bonus_percent,omitempty" xml:"bonus_percent,omitempty"` // и процент от первого платежа в рублях
+	Invited      int         `json:"invited" xml:"invited"`                                 // Зарегистрировались по ссылке
+	Paid         int         `json:"paid" xml:"paid"`                                       // Оплатили хотя бы один платеж
+	BonusTotal   money.Money `json:"bonus_total" xml:"bonus_total"`                         // Начислено бонусов за все время
+	Balance      money.Money `json:"balance" xml:"balance"`                                 // Текущий бонусный баланс
+	Referrals    []Referral  `json:"referrals" xml:"referrals>referral"`                    // Последние приглашенные
+}
+
+// Invitation - приглашение клиента, загруженного администратором. Аккаунт клиента создается
+// при регистрации по приглашению: ИНН и email берутся из приглашения, если не указаны.
+type Invitation struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id,omitempty"` // Созданный заранее пользователь без аккаунта Telegram
+	INN        string     `json:"inn"`
+	Email      string     `json:"email,omitempty"`
+	Username   string     `json:"telegram,omitempty"`   // Имя пользователя Telegram без @
+	PartnerID  int        `json:"partner_id,omitempty"` // Партнер, субаккаунтом которого станет организация клиента
+	CreatedBy  int        `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedBy int        `json:"accepted_by,omitempty"` // Зарегистрировавшийся пользователь
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
+
+// IntroductionDocument представляет документ ввода в оборот товаров заказа
+type IntroductionDocument struct {
+	ID                int        `json:"id" xml:"id"`
+	OrderID           int        `json:"order_id" xml:"order_id"`                                         // Заказ, по кодам которого сформирован документ
+	OrganizationID    int        `json:"organization_id,omitempty" xml:"organization_id,omitempty"`       // Организация-участник оборота
+	UserID            int        `json:"user_id" xml:"user_id"`                                           // Автор документа
+	ParticipantINN    string     `json:"participant_inn" xml:"participant_inn"`                           // ИНН участника оборота
+	ProductGroup      string     `json:"product_group,omitempty" xml:"product_group,omitempty"`           // Товарная группа заказа
+	ProductionType    string     `json:"production_type" xml:"production_type"`                           // Произведен или ввезен
+	ProductionDate    time.Time  `json:"production_date" xml:"production_date"`                           // Дата производства или ввоза
+	DeclarationNumber string     `json:"declaration_number,omitempty" xml:"declaration_number,omitempty"` // Номер декларации на товары (для ввоза)
+	DeclarationDate   *time.Time `json:"declaration_date,omitempty" xml:"declaration_date,omitempty"`     // Дата декларации на товары (для ввоза)
+	Codes             []string   `json:"codes" xml:"codes>code"`                                          // Коды маркировки
+	Status            string     `json:"status" xml:"status"`                                             // Статус документа
+	ExternalID        string     `json:"external_id,omitempty" xml:"external_id,omitempty"`               // ID документа в Честном ЗНАКе
+	Error             string     `json:"error,omitempty" xml:"error,omitempty"`                           // Причина отклонения
+	Ticket            string     `json:"ticket,omitempty" xml:"ticket,omitempty"`                         // Квитанция Честного ЗНАКа о результате обработки
+	CreatedAt         time.Time  `json:"created_at" xml:"created_at"`                                     // Дата создания
+	SubmittedAt       *time.Time `json:"submitted_at,omitempty" xml:"submitted_at,omitempty"`             // Дата отправки в Честный ЗНАК
+	ProcessedAt       *time.Time `json:"processed_at,omitempty" xml:"processed_at,omitempty"`             // Дата получения результата обработки
+	UpdatedAt         time.Time  `json:"updated_at" xml:"updated_at"`                                     // Дата последнего обновления
+}
+
+// Validate проверяет корректность документа ввода в оборот
+func (d *IntroductionDocument) Validate() error {
+	if d.OrderID <= 0 {
+		return errors.New("ID заказа должен быть положительным числом")
+	}
+
+	switch d.ProductionType {
+	case ProductionTypeProduced:
+	case ProductionTypeImported:
+		if d.DeclarationNumber == "" || d.DeclarationDate == nil {
+			return errors.New("для ввезенных товаров необходимо указать номер и дату декларации")
+		}
+	default:
+		return fmt.Errorf("способ производства должен быть %q или %q", ProductionTypeProduced, ProductionTypeImported)
+	}
+
+	if d.ProductionDate.IsZero() {
+		return errors.New("дата производства не может быть пустой")
+	}
+
+	if d.ProductionDate.After(time.Now()) {
+		return errors.New("дата производства не может быть в будущем")
+	}
+
+	if len(d.Codes) == 0 {
+		return errors.New("документ должен содержать хотя бы один код маркировки")
+	}
+
+	return nil
+}
+
+// IsFinal проверяет, получен ли окончательный результат обработки документа
+func (d *IntroductionDocument) IsFinal() bool {
+	return d.Status == DocumentStatusAccepted || d.Status == DocumentStatusRejected
+}
+
+// RetirementDocument представляет документ вывода кодов маркировки из оборота
+type RetirementDocument struct {
+	ID                    int        `json:"id" xml:"id"`
+	OrganizationID        int        `json:"organization_id,omitempty" xml:"organization_id,omitempty"`                 // Организация-участник оборота
+	UserID                int        `json:"user_id" xml:"user_id"`                                                     // Автор документа
+	ParticipantINN        string     `json:"participant_inn" xml:"participant_inn"`                                     // ИНН участника оборота
+	ProductGroup          string     `json:"product_group,omitempty" xml:"product_group,omitempty"`                     // Товарная группа кодов
+	Reason                string     `json:"reason" xml:"reason"`                                                       // Причина вывода из оборота
+	ActionDate            time.Time  `json:"action_date" xml:"action_date"`                                             // Дата вывода из оборота
+	PrimaryDocumentNumber string     `json:"primary_document_number,omitempty" xml:"primary_document_number,omitempty"` // Номер первичного документа (чека, декларации, акта)
+	PrimaryDocumentDate   *time.Time `json:"primary_document_date,omitempty" xml:"primary_document_date,omitempty"`     // Дата первичного документа
+	Codes                 []string   `json:"codes" xml:"codes>code"`                                                    // Коды маркировки
+	Status                string     `json:"status" xml:"status"`                                                       // Статус документа
+	ExternalID            string     `json:"external_id,omitempty" xml:"external_id,omitempty"`                         // ID документа в Честном ЗНАКе
+	Error                 string     `json:"error,omitempty" xml:"error,omitempty"`                                     // Причина отклонения
+	Ticket                string     `json:"ticket,omitempty" xml:"ticket,omitempty"`                                   // Квитанция Честного ЗНАКа о результате обработки
+	CreatedAt             time.Time  `json:"created_at" xml:"created_at"`                                               // Дата создания
+	SubmittedAt           *time.Time `json:"submitted_at,omitempty" xml:"submitted_at,omitempty"`                       // Дата отправки в Честный ЗНАК
+	ProcessedAt           *time.Time `json:"processed_at,omitempty" xml:"processed_at,omitempty"`                       // Дата получения результата обработки
+	UpdatedAt             time.Time  `json:"updated_at" xml:"updated_at"`                                               // Дата последнего обновления
+}
+
+// Validate проверяет корректность документа вывода из оборота
+func (d *RetirementDocument) Validate() error {
+	switch d.Reason {
+	case RetirementReasonRetail, RetirementReasonExport:
+		// Продажа и экспорт подтверждаются чеком или декларацией
+		if d.PrimaryDocumentNumber == "" || d.PrimaryDocumentDate == nil {
+			return errors.New("для продажи и экспорта необходимо указать номер и дату первичного документа")
+		}
+	case RetirementReasonWriteOff:
+	default:
+		return fmt.Errorf("причина вывода из оборота должна быть %q, %q или %q",
+			RetirementReasonRetail, RetirementReasonExport, RetirementReasonWriteOff)
+	}
+
+	if d.ActionDate.IsZero() {
+		return errors.New("дата вывода из оборота не может быть пустой")
+	}
+
+	if d.ActionDate.After(time.Now()) {
+		return errors.New("дата вывода из оборота не может быть в будущем")
+	}
+
+	if len(d.Codes) == 0 {
+		return errors.New("документ должен содержать хотя бы один код маркировки")
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateGTIN(t *testing.T) {
+	tests := []struct {
+		gtin    string
+		wantErr bool
+	}{
+		{"04607177964089", false},
+		{"4607177964089", false},
+		{"96385074", false},
+		{"036000291452", false},
+		{"04607177964088", true},
+		{"460717796408", true},
+		{"0460717796408X", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateGTIN(tt.gtin)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateGTIN(%q) = %v, ожидалась ошибка: %v", tt.gtin, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNormalizeGTIN(t *testing.T) {
+	if got := NormalizeGTIN("4607177964089"); got != "04607177964089" {
+		t.Errorf("Ожидался GTIN 04607177964089, получен %s", got)
+	}
+
+	if got := NormalizeGTIN("04607177964089"); got != "04607177964089" {
+		t.Errorf("Ожидался GTIN без изменений, получен %s", got)
+	}
+}
+
+func TestOrderItemValidate(t *testing.T) {
+	item := OrderItem{GTIN: "04607177964088", Quantity: 1}
+	if err := item.Validate(); err == nil {
+		t.Error("Ожидалась ошибка для GTIN с неверной контрольной цифрой")
+	}
+
+	item.GTIN = "04607177964089"
+	if err := item.Validate(); err != nil {
+		t.Errorf("Неожиданная ошибка: %v", err)
+	}
+}
+
+func TestValidateINN(t *testing.T) {
+	tests := []struct {
+		inn     string
+		wantErr bool
+	}{
+		{"7707083893", false},
+		{"500100732259", false},
+		{"7707083894", true},
+		{"500100732258", true},
+		{"77070838", true},
+		{"77070838AB", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateINN(tt.inn)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateINN(%q) = %v, ожидалась ошибка: %v", tt.inn, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateTelegramUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		wantErr  bool
+	}{
+		{"ivan_petrov", false},
+		{"@ivan_petrov", false},
+		{"https://t.me/ivan_petrov", false},
+		{"t.me/ivan_petrov", false},
+		{"ivan", true},
+		{"1ivan_petrov", true},
+		{"ivan-petrov", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateTelegramUsername(tt.username)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateTelegramUsername(%q) = %v, ожидалась ошибка: %v", tt.username, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAPIKeyIsActive(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		key  APIKey
+		want bool
+	}{
+		{"бессрочный", APIKey{}, true},
+		{"период перекрытия", APIKey{ExpiresAt: &future}, true},
+		{"истек", APIKey{ExpiresAt: &past}, false},
+		{"отозван", APIKey{ExpiresAt: &future, RevokedAt: &past}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.key.IsActive(now); got != tt.want {
+			t.Errorf("%s: IsActive() = %v, ожидалось %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIntroductionDocumentValidate(t *testing.T) {
+	yesterday := time.Now().AddDate(0, 0, -1)
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	codes := []string{"010460012345678921abc"}
+
+	tests := []struct {
+		name    string
+		doc     IntroductionDocument
+		wantErr bool
+	}{
+		{"произведен", IntroductionDocument{OrderID: 1, ProductionType: ProductionTypeProduced, ProductionDate: yesterday, Codes: codes}, false},
+		{"ввезен", IntroductionDocument{OrderID: 1, ProductionType: ProductionTypeImported, ProductionDate: yesterday,
+			DeclarationNumber: "10702010/010124/0000001", DeclarationDate: &yesterday, Codes: codes}, false},
+		{"ввезен без декларации", IntroductionDocument{OrderID: 1, ProductionType: ProductionTypeImported, ProductionDate: yesterday, Codes: codes}, true},
+		{"неизвестный способ", IntroductionDocument{OrderID: 1, ProductionType: "other", ProductionDate: yesterday, Codes: codes}, true},
+		{"дата в будущем", IntroductionDocument{OrderID: 1, ProductionType: ProductionTypeProduced, ProductionDate: tomorrow, Codes: codes}, true},
+		{"без кодов", IntroductionDocument{OrderID: 1, ProductionType: ProductionTypeProduced, ProductionDate: yesterday}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.doc.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, ожидалась ошибка: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRetirementDocumentValidate(t *testing.T) {
+	yesterday := time.Now().AddDate(0, 0, -1)
+	codes := []string{"010460012345678921abc"}
+
+	tests := []struct {
+		name    string
+		doc     RetirementDocument
+		wantErr bool
+	}{
+		{"продажа", RetirementDocument{Reason: RetirementReasonRetail, ActionDate: yesterday,
+			PrimaryDocumentNumber: "15", PrimaryDocumentDate: &yesterday, Codes: codes}, false},
+		{"продажа без чека", RetirementDocument{Reason: RetirementReasonRetail, ActionDate: yesterday, Codes: codes}, true},
+		{"списание", RetirementDocument{Reason: RetirementReasonWriteOff, ActionDate: yesterday, Codes: codes}, false},
+		{"неизвестная причина", RetirementDocument{Reason: "gift", ActionDate: yesterday, Codes: codes}, true},
+		{"без даты", RetirementDocument{Reason: RetirementReasonWriteOff, Codes: codes}, true},
+		{"без кодов", RetirementDocument{Reason: RetirementReasonWriteOff, ActionDate: yesterday}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.doc.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, ожидалась ошибка: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestOrderResolveProductGroup(t *testing.T) {
+	order := Order{Items: []OrderItem{
+		{GTIN: "04607177964089"},
+		{GTIN: "04600000000015", ProductGroup: ProductGroupMilk},
+	}}
+	if err := order.ResolveProductGroup(); err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+	if order.ProductGroup != ProductGroupMilk {
+		t.Errorf("Ожидалась товарная группа %s, получена %q", ProductGroupMilk, order.ProductGroup)
+	}
+
+	order.Items = append(order.Items, OrderItem{GTIN: "04600000000022", ProductGroup: ProductGroupShoes})
+	if err := order.ResolveProductGroup(); err == nil {
+		t.Error("Ожидалась ошибка для товаров разных товарных групп")
+	}
+
+	order = Order{ProductGroup: "furniture", Items: []OrderItem{{GTIN: "04607177964089"}}}
+	if err := order.ResolveProductGroup(); err == nil {
+		t.Error("Ожидалась ошибка для неизвестной товарной группы")
+	}
+}
+
+func TestRequisitesValidate(t *testing.T) {
+	valid := Requisites{KPP: "770701001", BIK: "044525225",
+		BankAccount: "40702810400000012345", CorrAccount: "30101810400000000225"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Неожиданная ошибка для корректных реквизитов: %v", err)
+	}
+	if err := (&Requisites{}).Validate(); err != nil {
+		t.Errorf("Незаполненные реквизиты должны проходить проверку: %v", err)
+	}
+
+	for _, invalid := range []Requisites{
+		{KPP: "77070100"},
+		{BIK: "04452522A"},
+		{BankAccount: "4070281040000001234"},
+		{CorrAccount: "301018104000000002251"},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Ожидалась ошибка для реквизитов %+v", invalid)
+		}
+	}
+}
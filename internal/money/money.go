@@ -0,0 +1,243 @@
+// Package money хранит денежные суммы в минимальных единицах валюты (копейках, центах),
+// чтобы суммы в подписях платежей, чеках и учете не искажались округлением float64.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RUB - валюта по умолчанию: суммы без указанной валюты считаются рублями
+const RUB = "RUB"
+
+// Валюты, в которых число знаков после запятой отличается от двух (ISO 4217)
+var exponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Наибольшая сумма в минимальных единицах, точно представимая в float64
+const maxExactMinor = 1 << 53
+
+// Money - денежная сумма в минимальных единицах валюты Currency
+type Money struct {
+	Minor    int64
+	Currency string // Код валюты ISO 4217; пустой код означает рубли
+}
+
+// Exponent возвращает число знаков после запятой в сумме валюты currency
+func Exponent(currency string) int {
+	if exponent, ok := exponents[strings.ToUpper(currency)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// New создает сумму из минимальных единиц валюты
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: strings.ToUpper(currency)}
+}
+
+// Rubles создает сумму в рублях из копеек
+func Rubles(kopecks int64) Money {
+	return Money{Minor: kopecks, Currency: RUB}
+}
+
+// FromFloat переводит сумму в основных единицах валюты, округляя до минимальной единицы
+// (половина округляется от нуля). Используется на границе с API, передающими суммы
+// числами с плавающей точкой.
+func FromFloat(amount float64, currency string) Money {
+	return New(int64(math.Round(amount*math.Pow10(Exponent(currency)))), currency)
+}
+
+// Parse разбирает десятичную запись суммы в основных единицах валюты: "150", "150.5",
+// "-0.01", "1500,00". Разбор точный; запись с ненулевыми цифрами дальше минимальной
+// единицы валюты отклоняется, незначащие нули ("150.000000") допускаются.
+func Parse(value, currency string) (Money, error) {
+	exponent := Exponent(currency)
+	text := strings.TrimSpace(value)
+
+	negative := false
+	switch {
+	case strings.HasPrefix(text, "-"):
+		negative, text = true, text[1:]
+	case strings.HasPrefix(text, "+"):
+		text = text[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(strings.Replace(text, ",", ".", 1), ".")
+	if whole == "" && fraction == "" || !digits(whole) || !digits(fraction) {
+		return Money{}, fmt.Errorf("некорректная сумма %q", value)
+	}
+	if len(fraction) > exponent {
+		if strings.Trim(fraction[exponent:], "0") != "" {
+			return Money{}, fmt.Errorf("сумма %q точнее минимальной единицы валюты %s", value, currencyOrDefault(currency))
+		}
+		fraction = fraction[:exponent]
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	if whole == "" {
+		whole = "0"
+	}
+	minor, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil || minor > maxExactMinor {
+		return Money{}, fmt.Errorf("сумма %q слишком велика", value)
+	}
+	if negative {
+		minor = -minor
+	}
+	return New(minor, currency), nil
+}
+
+func digits(value string) bool {
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func currencyOrDefault(currency string) string {
+	if currency == "" {
+		return RUB
+	}
+	return strings.ToUpper(currency)
+}
+
+// Code возвращает код валюты суммы; для суммы без валюты - RUB
+func (m Money) Code() string {
+	return currencyOrDefault(m.Currency)
+}
+
+// String возвращает сумму в основных единицах с числом знаков валюты: "150.00", "-0.50", "1500"
+func (m Money) String() string {
+	exponent := Exponent(m.Currency)
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	text := strconv.FormatInt(minor, 10)
+	if exponent == 0 {
+		return sign + text
+	}
+	if len(text) <= exponent {
+		text = strings.Repeat("0", exponent-len(text)+1) + text
+	}
+	return sign + text[:len(text)-exponent] + "." + text[len(text)-exponent:]
+}
+
+// Float64 возвращает сумму в основных единицах для API, принимающих числа с плавающей точкой
+func (m Money) Float64() float64 {
+	return float64(m.Minor) / math.Pow10(Exponent(m.Currency))
+}
+
+// IsZero сообщает, что сумма равна нулю
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// IsPositive сообщает, что сумма больше нуля
+func (m Money) IsPositive() bool {
+	return m.Minor > 0
+}
+
+// Equal сообщает, что суммы совпадают вместе с валютой
+func (m Money) Equal(other Money) bool {
+	return m.Minor == other.Minor && m.Code() == other.Code()
+}
+
+// Add возвращает сумму двух сумм в одной валюте
+func (m Money) Add(other Money) Money {
+	m.mustMatch(other)
+	return Money{Minor: m.Minor + other.Minor, Currency: m.Currency}
+}
+
+// Sub возвращает разность двух сумм в одной валюте
+func (m Money) Sub(other Money) Money {
+	m.mustMatch(other)
+	return Money{Minor: m.Minor - other.Minor, Currency: m.Currency}
+}
+
+// Mul возвращает сумму, умноженную на целое количество
+func (m Money) Mul(quantity int64) Money {
+	return Money{Minor: m.Minor * quantity, Currency: m.Currency}
+}
+
+// Сложение сумм в разных валютах - ошибка программы, а не данных
+func (m Money) mustMatch(other Money) {
+	if m.Code() != other.Code() {
+		panic(fmt.Sprintf("money: операция над суммами в разных валютах %s и %s", m.Code(), other.Code()))
+	}
+}
+
+// MarshalJSON записывает сумму числом в основных единицах: 150.00
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON читает сумму из числа или строки в основных единицах. Валюта берется
+// из текущего значения, по умолчанию - рубли.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "null" {
+		return nil
+	}
+	if strings.ContainsAny(text, "eE") {
+		return errors.New("сумма не может быть записана в экспоненциальной форме")
+	}
+	value, err := Parse(text, m.Code())
+	if err != nil {
+		return err
+	}
+	*m = value
+	return nil
+}
+
+// MarshalText записывает сумму в основных единицах: 150.00. Используется в ответах XML.
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText читает сумму в основных единицах. Валюта берется из текущего значения,
+// по умолчанию - рубли.
+func (m *Money) UnmarshalText(text []byte) error {
+	return m.UnmarshalJSON(text)
+}
+
+// Scan читает сумму из столбца DECIMAL. Валюта берется из текущего значения, по умолчанию -
+// рубли; для сумм в разных валютах столбец читается в строку и разбирается Parse.
+func (m *Money) Scan(src any) error {
+	var text string
+	switch value := src.(type) {
+	case []byte:
+		text = string(value)
+	case string:
+		text = value
+	case int64:
+		text = strconv.FormatInt(value, 10)
+	case float64:
+		*m = FromFloat(value, m.Code())
+		return nil
+	default:
+		return fmt.Errorf("неподдерживаемый тип суммы %T", src)
+	}
+	value, err := Parse(text, m.Code())
+	if err != nil {
+		return err
+	}
+	*m = value
+	return nil
+}
+
+// Value записывает сумму в столбец DECIMAL десятичной строкой
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
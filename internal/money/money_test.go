@@ -0,0 +1,211 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExponent(t *testing.T) {
+	tests := map[string]int{"RUB": 2, "": 2, "usd": 2, "EUR": 2, "JPY": 0, "krw": 0, "KWD": 3, "BHD": 3}
+	for currency, want := range tests {
+		if got := Exponent(currency); got != want {
+			t.Errorf("Exponent(%q) = %d, ожидалось %d", currency, got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		minor    int64
+	}{
+		{"150", "RUB", 15000},
+		{"150.5", "RUB", 15050},
+		{"150.05", "RUB", 15005},
+		{"150,05", "RUB", 15005},
+		{"150.000000", "RUB", 15000},
+		{"0.01", "", 1},
+		{".5", "USD", 50},
+		{"5.", "USD", 500},
+		{"-0.01", "RUB", -1},
+		{"+12.30", "EUR", 1230},
+		{" 99.99 ", "RUB", 9999},
+		{"1500", "JPY", 1500},
+		{"1500.00", "JPY", 1500},
+		{"1.234", "KWD", 1234},
+		{"0.1", "KWD", 100},
+		{"90071992547409.91", "RUB", 9007199254740991},
+	}
+	for _, tt := range tests {
+		m, err := Parse(tt.value, tt.currency)
+		if err != nil {
+			t.Errorf("Parse(%q, %q) вернул ошибку: %v", tt.value, tt.currency, err)
+			continue
+		}
+		if m.Minor != tt.minor || m.Code() != currencyOrDefault(tt.currency) {
+			t.Errorf("Parse(%q, %q) = %+v, ожидалось %d", tt.value, tt.currency, m, tt.minor)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+	}{
+		{"", "RUB"},
+		{".", "RUB"},
+		{"-", "RUB"},
+		{"abc", "RUB"},
+		{"1.2.3", "RUB"},
+		{"1e3", "RUB"},
+		{"--1", "RUB"},
+		{"150.001", "RUB"},
+		{"1500.5", "JPY"},
+		{"1.2345", "KWD"},
+		{"99999999999999999999", "RUB"},
+		{"90071992547409.93", "RUB"},
+	}
+	for _, tt := range tests {
+		if m, err := Parse(tt.value, tt.currency); err == nil {
+			t.Errorf("Parse(%q, %q) = %+v, ожидалась ошибка", tt.value, tt.currency, m)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Rubles(15000), "150.00"},
+		{Rubles(15005), "150.05"},
+		{Rubles(5), "0.05"},
+		{Rubles(0), "0.00"},
+		{Rubles(-50), "-0.50"},
+		{Rubles(-15000), "-150.00"},
+		{Money{Minor: 1999}, "19.99"},
+		{New(1500, "jpy"), "1500"},
+		{New(-7, "JPY"), "-7"},
+		{New(1234, "KWD"), "1.234"},
+		{New(5, "KWD"), "0.005"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, ожидалось %q", tt.money, got, tt.want)
+		}
+		if parsed, err := Parse(tt.want, tt.money.Currency); err != nil || parsed.Minor != tt.money.Minor {
+			t.Errorf("Parse(%q) не совпадает с исходной суммой %+v: %+v, %v", tt.want, tt.money, parsed, err)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		minor    int64
+	}{
+		{150, "RUB", 15000},
+		{0.1 + 0.2, "RUB", 30},
+		{19.99, "USD", 1999},
+		{1.005, "RUB", 100}, // 1.005 в float64 меньше 1.005
+		{0.125, "RUB", 13},
+		{-0.125, "RUB", -13},
+		{1500.4, "JPY", 1500},
+		{1500.5, "JPY", 1501},
+		{1.2345, "KWD", 1235},
+	}
+	for _, tt := range tests {
+		if m := FromFloat(tt.amount, tt.currency); m.Minor != tt.minor {
+			t.Errorf("FromFloat(%v, %q) = %d, ожидалось %d", tt.amount, tt.currency, m.Minor, tt.minor)
+		}
+	}
+	if got := Rubles(15005).Float64(); got != 150.05 {
+		t.Errorf("Float64() = %v", got)
+	}
+	if got := New(1500, "JPY").Float64(); got != 1500 {
+		t.Errorf("Float64() = %v", got)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	price := Rubles(1999)
+	if total := price.Mul(3); total.Minor != 5997 || total.Code() != RUB {
+		t.Errorf("Mul() = %+v", total)
+	}
+	if sum := price.Add(Rubles(1)); !sum.Equal(Rubles(2000)) {
+		t.Errorf("Add() = %+v", sum)
+	}
+	if diff := price.Sub(Rubles(2000)); diff.Minor != -1 || diff.IsPositive() {
+		t.Errorf("Sub() = %+v", diff)
+	}
+	if !(Money{}).IsZero() || !Rubles(1).IsPositive() {
+		t.Error("неверная проверка знака суммы")
+	}
+	if !(Money{Minor: 100}).Equal(Rubles(100)) {
+		t.Error("сумма без валюты должна совпадать с суммой в рублях")
+	}
+	if Rubles(100).Equal(New(100, "USD")) {
+		t.Error("суммы в разных валютах не должны совпадать")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("ожидалась паника при сложении сумм в разных валютах")
+		}
+	}()
+	Rubles(100).Add(New(100, "USD"))
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Amount Money `json:"amount"`
+	}{Rubles(15050)})
+	if err != nil || string(data) != `{"amount":150.50}` {
+		t.Errorf("json.Marshal() = %s, %v", data, err)
+	}
+
+	var value struct {
+		Amount Money `json:"amount"`
+	}
+	for input, minor := range map[string]int64{`{"amount": 150.5}`: 15050, `{"amount": "0.01"}`: 1, `{"amount": 7}`: 700} {
+		if err := json.Unmarshal([]byte(input), &value); err != nil || value.Amount.Minor != minor {
+			t.Errorf("json.Unmarshal(%s) = %+v, %v", input, value.Amount, err)
+		}
+	}
+	for _, input := range []string{`{"amount": 1e3}`, `{"amount": 0.001}`, `{"amount": true}`} {
+		if err := json.Unmarshal([]byte(input), &value); err == nil {
+			t.Errorf("json.Unmarshal(%s) должен вернуть ошибку", input)
+		}
+	}
+
+	yen := struct {
+		Amount Money `json:"amount"`
+	}{Amount: Money{Currency: "JPY"}}
+	if err := json.Unmarshal([]byte(`{"amount": 1500}`), &yen); err != nil || yen.Amount.Minor != 1500 || yen.Amount.Currency != "JPY" {
+		t.Errorf("json.Unmarshal() в иенах = %+v, %v", yen.Amount, err)
+	}
+}
+
+func TestSQL(t *testing.T) {
+	var m Money
+	if err := m.Scan([]byte("150.05")); err != nil || !m.Equal(Rubles(15005)) {
+		t.Errorf("Scan([]byte) = %+v, %v", m, err)
+	}
+	m = Money{Currency: "JPY"}
+	if err := m.Scan("1500.00"); err != nil || !m.Equal(New(1500, "JPY")) {
+		t.Errorf("Scan(string) в иенах = %+v, %v", m, err)
+	}
+	m = Money{}
+	if err := m.Scan(int64(12)); err != nil || m.Minor != 1200 {
+		t.Errorf("Scan(int64) = %+v, %v", m, err)
+	}
+	if err := m.Scan(nil); err == nil {
+		t.Error("ожидалась ошибка для NULL")
+	}
+	if value, err := Rubles(15005).Value(); err != nil || value != "150.05" {
+		t.Errorf("Value() = %v, %v", value, err)
+	}
+}
@@ -0,0 +1,478 @@
+package oms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"project-znak/internal/tracing"
+)
+
+// Товарные группы СУЗ
+const (
+	GroupMilk    = "milk"   // Молочная продукция
+	GroupShoes   = "shoes"  // Обувь
+	GroupClothes = "lp"     // Одежда и товары легкой промышленности
+	GroupWater   = "water"  // Упакованная вода
+	GroupTires   = "tires"  // Шины
+	GroupPerfume = "perfum" // Духи и туалетная вода
+)
+
+// DefaultTemplates - шаблоны кодов маркировки по умолчанию для товарных групп.
+// Для остальных групп шаблон задается в настройках.
+var DefaultTemplates = map[string]int{
+	GroupMilk:    20,
+	GroupShoes:   1,
+	GroupClothes: 10,
+	GroupWater:   27,
+	GroupTires:   7,
+	GroupPerfume: 5,
+}
+
+// ErrRejected возвращается, если СУЗ отклонила заказ кодов
+var ErrRejected = errors.New("СУЗ отклонила заказ")
+
+// APIError - ошибка в ответе СУЗ с телом ответа
+type APIError struct {
+	StatusCode int
+	Message    string
+	Payload    []byte
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("СУЗ вернула ошибку: %d, %s", e.StatusCode, e.Message)
+}
+
+// Permanent сообщает, что запрос отклонен по существу и повторять его без изменений
+// бессмысленно. Ошибки сервера, превышение лимита и таймаут считаются временными.
+func (e *APIError) Permanent() bool {
+	if e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests {
+		return false
+	}
+	return e.StatusCode >= 400 && e.StatusCode < 500
+}
+
+// Состояния буфера кодов маркировки
+const (
+	BufferPending   = "PENDING"   // Коды еще генерируются
+	BufferActive    = "ACTIVE"    // Коды доступны для получения
+	BufferExhausted = "EXHAUSTED" // Все коды получены
+	BufferRejected  = "REJECTED"  // Заказ отклонен
+	BufferClosed    = "CLOSED"    // Буфер закрыт
+)
+
+// Значения по умолчанию для опроса буфера и получения кодов
+const (
+	defaultPollInterval = 2 * time.Second
+	defaultChunkSize    = 1000
+)
+
+// ProductGroup - настройки подключения к СУЗ для товарной группы
+type ProductGroup struct {
+	ClientToken string // Токен устройства (clientToken)
+	TemplateID  int    // Шаблон кода маркировки
+}
+
+// Signer подписывает тело запроса ЭЦП участника оборота
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// OrderProduct - количество кодов, заказываемых для GTIN
+type OrderProduct struct {
+	GTIN     string
+	Quantity int
+}
+
+// Buffer - состояние буфера кодов маркировки заказа по GTIN
+type Buffer struct {
+	OrderID         string `json:"orderId"`
+	GTIN            string `json:"gtin"`
+	Status          string `json:"bufferStatus"`
+	TotalCodes      int    `json:"totalCodes"`
+	AvailableCodes  int    `json:"availableCodes"`
+	LeftInBuffer    int    `json:"leftInBuffer"`
+	RejectionReason string `json:"rejectionReason"`
+}
+
+// Товар в теле запроса создания заказа
+type orderProduct struct {
+	GTIN             string `json:"gtin"`
+	Quantity         int    `json:"quantity"`
+	SerialNumberType string `json:"serialNumberType"`
+	TemplateID       int    `json:"templateId"`
+	CISType          string `json:"cisType"`
+}
+
+// Тело запроса создания заказа
+type orderRequest struct {
+	ProductGroup string         `json:"productGroup"`
+	Products     []orderProduct `json:"products"`
+}
+
+// Ответ на создание заказа
+type orderResponse struct {
+	OrderID string `json:"orderId"`
+}
+
+// Ответ на запрос кодов из буфера
+type codesResponse struct {
+	Codes   []string `json:"codes"`
+	BlockID string   `json:"blockId"`
+}
+
+// Ответ СУЗ с ошибкой
+type errorResponse struct {
+	GlobalErrors []struct {
+		Error string `json:"error"`
+	} `json:"globalErrors"`
+}
+
+// Client выполняет запросы к API станции управления заказами (СУЗ) на эмиссию кодов маркировки
+type Client struct {
+	baseURL      string
+	omsID        string
+	groups       map[string]ProductGroup
+	signer       Signer
+	httpClient   *http.Client
+	pollInterval time.Duration
+	chunkSize    int
+}
+
+// NewClient создает клиент СУЗ. Клиент работает только с товарными группами, для которых
+// задан токен устройства; если шаблон группы не указан, используется шаблон по умолчанию.
+// Если signer не задан, запросы отправляются без подписи; если transport не задан,
+// используется http.DefaultTransport.
+func NewClient(baseURL, omsID string, groups map[string]ProductGroup, signer Signer, timeout time.Duration, transport http.RoundTripper) *Client {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	configured := make(map[string]ProductGroup)
+	for name, group := range groups {
+		if group.ClientToken == "" {
+			continue
+		}
+		if group.TemplateID == 0 {
+			group.TemplateID = DefaultTemplates[name]
+		}
+		configured[name] = group
+	}
+
+	return &Client{
+		baseURL:      strings.TrimRight(baseURL, "/") + "/",
+		omsID:        omsID,
+		groups:       configured,
+		signer:       signer,
+		httpClient:   &http.Client{Timeout: timeout, Transport: tracing.WrapTransport("oms", transport)},
+		pollInterval: defaultPollInterval,
+		chunkSize:    defaultChunkSize,
+	}
+}
+
+// Enabled сообщает, настроено ли подключение к СУЗ хотя бы для одной товарной группы
+func (c *Client) Enabled() bool {
+	return c != nil && c.omsID != "" && len(c.groups) > 0
+}
+
+// SupportsGroup сообщает, настроено ли подключение для товарной группы
+func (c *Client) SupportsGroup(group string) bool {
+	if !c.Enabled() {
+		return false
+	}
+	_, ok := c.groups[group]
+	return ok
+}
+
+// Ping проверяет доступность API СУЗ. Запрос не подписывается и не требует токена: успешным
+// считается любой ответ сервера, кроме ошибки 5xx.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса к СУЗ: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &APIError{StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+	return nil
+}
+
+// CreateOrder создает заказ на эмиссию кодов маркировки и возвращает его идентификатор
+func (c *Client) CreateOrder(ctx context.Context, group string, products []OrderProduct) (string, error) {
+	settings, err := c.group(group)
+	if err != nil {
+		return "", err
+	}
+	if settings.TemplateID == 0 {
+		return "", fmt.Errorf("шаблон кода маркировки для товарной группы %q не задан", group)
+	}
+
+	request := orderRequest{ProductGroup: group}
+	for _, product := range products {
+		request.Products = append(request.Products, orderProduct{
+			GTIN:             product.GTIN,
+			Quantity:         product.Quantity,
+			SerialNumberType: "OPERATOR",
+			TemplateID:       settings.TemplateID,
+			CISType:          "UNIT",
+		})
+	}
+
+	var result orderResponse
+	if err := c.do(ctx, http.MethodPost, "order", nil, settings, request, &result); err != nil {
+		return "", err
+	}
+	if result.OrderID == "" {
+		return "", fmt.Errorf("СУЗ не вернула идентификатор заказа")
+	}
+	return result.OrderID, nil
+}
+
+// BufferStatus возвращает состояние буфера кодов заказа по GTIN
+func (c *Client) BufferStatus(ctx context.Context, group, orderID, gtin string) (*Buffer, error) {
+	settings, err := c.group(group)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffers []Buffer
+	query := url.Values{"orderId": {orderID}, "gtin": {gtin}}
+	if err := c.do(ctx, http.MethodGet, "order/status", query, settings, nil, &buffers); err != nil {
+		return nil, err
+	}
+	for i := range buffers {
+		if buffers[i].GTIN == gtin {
+			return &buffers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("СУЗ не вернула буфер заказа %s для GTIN %s", orderID, gtin)
+}
+
+// Codes получает из буфера очередную порцию кодов маркировки
+func (c *Client) Codes(ctx context.Context, group, orderID, gtin string, quantity int) ([]string, error) {
+	settings, err := c.group(group)
+	if err != nil {
+		return nil, err
+	}
+
+	var result codesResponse
+	query := url.Values{"orderId": {orderID}, "gtin": {gtin}, "quantity": {fmt.Sprint(quantity)}}
+	if err := c.do(ctx, http.MethodGet, "codes", query, settings, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Codes, nil
+}
+
+// CloseBuffer закрывает буфер кодов заказа по GTIN; неполученные коды становятся недоступны
+func (c *Client) CloseBuffer(ctx context.Context, group, orderID, gtin string) error {
+	settings, err := c.group(group)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"orderId": {orderID}, "gtin": {gtin}}
+	return c.do(ctx, http.MethodPost, "buffer/close", query, settings, nil, nil)
+}
+
+// WaitBuffer опрашивает буфер, пока коды не станут доступны. Возвращает ошибку,
+// если заказ отклонен, буфер закрыт или контекст отменен.
+func (c *Client) WaitBuffer(ctx context.Context, group, orderID, gtin string) (*Buffer, error) {
+	for {
+		buffer, err := c.BufferStatus(ctx, group, orderID, gtin)
+		if err != nil {
+			return nil, err
+		}
+
+		switch buffer.Status {
+		case BufferActive:
+			return buffer, nil
+		case BufferRejected:
+			return nil, fmt.Errorf("%w %s: %s", ErrRejected, orderID, buffer.RejectionReason)
+		case BufferExhausted, BufferClosed:
+			return nil, fmt.Errorf("буфер заказа %s для GTIN %s недоступен: %s", orderID, gtin, buffer.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("коды заказа %s не сформированы: %w", orderID, ctx.Err())
+		case <-time.After(c.pollInterval):
+		}
+	}
+}
+
+// Emission - ход эмиссии кодов по заказу, сохраненный Checkpoint
+type Emission struct {
+	OrderID string              // Созданный заказ; пусто - заказ еще не создан
+	Codes   map[string][]string // Полученные коды по GTIN
+	Closed  map[string]bool     // GTIN, буфер которых закрыт
+}
+
+// Checkpoint сохраняет ход эмиссии после каждого шага, чтобы после перезапуска процесса
+// продолжить ее ResumeCodes, не заказывая коды повторно. Ошибка сохранения прерывает эмиссию.
+type Checkpoint interface {
+	// OrderCreated вызывается после создания заказа
+	OrderCreated(ctx context.Context, orderID string) error
+	// CodesReceived вызывается с каждой полученной порцией кодов GTIN; offset - число
+	// кодов GTIN, полученных до этой порции
+	CodesReceived(ctx context.Context, gtin string, offset int, codes []string) error
+	// BufferClosed вызывается после закрытия буфера GTIN
+	BufferClosed(ctx context.Context, gtin string) error
+}
+
+// EmitCodes выполняет эмиссию кодов: создает заказ, дожидается готовности буфера по каждому
+// GTIN, получает коды порциями и закрывает буфер. Коды возвращаются в порядке товаров.
+// Если progress не nil, он вызывается с приращениями числа выпущенных кодов (буфер GTIN
+// готов) и полученных кодов (после каждой порции).
+func (c *Client) EmitCodes(ctx context.Context, group string, products []OrderProduct,
+	progress func(emitted, downloaded int)) ([]string, error) {
+	return c.ResumeCodes(ctx, group, products, Emission{}, nil, progress)
+}
+
+// ResumeCodes продолжает эмиссию кодов с сохраненного состояния state: заказ создается,
+// только если он еще не создан, коды запрашиваются только сверх уже полученных, а закрытые
+// буферы не закрываются повторно. Полученные ранее коды сразу учитываются в progress.
+// Если checkpoint не nil, каждый шаг эмиссии сохраняется в нем.
+func (c *Client) ResumeCodes(ctx context.Context, group string, products []OrderProduct, state Emission,
+	checkpoint Checkpoint, progress func(emitted, downloaded int)) ([]string, error) {
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+
+	orderID := state.OrderID
+	if orderID == "" {
+		var err error
+		if orderID, err = c.CreateOrder(ctx, group, products); err != nil {
+			return nil, err
+		}
+		if checkpoint != nil {
+			if err := checkpoint.OrderCreated(ctx, orderID); err != nil {
+				return nil, fmt.Errorf("ошибка сохранения заказа %s: %w", orderID, err)
+			}
+		}
+	}
+
+	var codes []string
+	for _, product := range products {
+		saved := state.Codes[product.GTIN]
+		codes = append(codes, saved...)
+		received := len(saved)
+		if received < product.Quantity {
+			if _, err := c.WaitBuffer(ctx, group, orderID, product.GTIN); err != nil {
+				return nil, err
+			}
+		}
+		progress(product.Quantity, received)
+
+		for received < product.Quantity {
+			chunk, err := c.Codes(ctx, group, orderID, product.GTIN, min(c.chunkSize, product.Quantity-received))
+			if err != nil {
+				return nil, err
+			}
+			if len(chunk) == 0 {
+				return nil, fmt.Errorf("СУЗ не вернула коды заказа %s для GTIN %s", orderID, product.GTIN)
+			}
+			if checkpoint != nil {
+				if err := checkpoint.CodesReceived(ctx, product.GTIN, received, chunk); err != nil {
+					return nil, fmt.Errorf("ошибка сохранения кодов заказа %s: %w", orderID, err)
+				}
+			}
+			codes = append(codes, chunk...)
+			received += len(chunk)
+			progress(0, len(chunk))
+		}
+
+		if state.Closed[product.GTIN] {
+			continue
+		}
+		if err := c.CloseBuffer(ctx, group, orderID, product.GTIN); err != nil {
+			return nil, err
+		}
+		if checkpoint != nil {
+			if err := checkpoint.BufferClosed(ctx, product.GTIN); err != nil {
+				return nil, fmt.Errorf("ошибка сохранения заказа %s: %w", orderID, err)
+			}
+		}
+	}
+
+	return codes, nil
+}
+
+// Настройки товарной группы
+func (c *Client) group(name string) (ProductGroup, error) {
+	if !c.Enabled() {
+		return ProductGroup{}, fmt.Errorf("подключение к СУЗ не настроено")
+	}
+	settings, ok := c.groups[name]
+	if !ok {
+		return ProductGroup{}, fmt.Errorf("подключение к СУЗ для товарной группы %q не настроено", name)
+	}
+	return settings, nil
+}
+
+// Выполнение запроса к API СУЗ. Тело запроса подписывается, если задан signer.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, settings ProductGroup, in, out any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("omsId", c.omsID)
+
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("ошибка формирования запроса: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("clientToken", settings.ClientToken)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+		if c.signer != nil {
+			signature, err := c.signer.Sign(body)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("X-Signature", base64.StdEncoding.EncodeToString(signature))
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса к СУЗ: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		var apiErr errorResponse
+		if json.Unmarshal(data, &apiErr) == nil && len(apiErr.GlobalErrors) > 0 {
+			return &APIError{StatusCode: resp.StatusCode, Message: apiErr.GlobalErrors[0].Error, Payload: data}
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: "тело: " + string(data), Payload: data}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("ошибка декодирования ответа СУЗ: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package oms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEmitCodes(t *testing.T) {
+	const gtin = "04600000000015"
+	var statusChecks, issued int
+	var closed bool
+	var request orderRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("omsId") != "oms-1" || r.Header.Get("clientToken") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/order":
+			json.NewDecoder(r.Body).Decode(&request)
+			json.NewEncoder(w).Encode(orderResponse{OrderID: "order-1"})
+		case "/order/status":
+			status := BufferPending
+			if statusChecks++; statusChecks > 1 {
+				status = BufferActive
+			}
+			json.NewEncoder(w).Encode([]Buffer{{OrderID: "order-1", GTIN: gtin, Status: status}})
+		case "/codes":
+			quantity, _ := strconv.Atoi(r.URL.Query().Get("quantity"))
+			var codes []string
+			for i := 0; i < quantity; i++ {
+				issued++
+				codes = append(codes, fmt.Sprintf("CODE%d", issued))
+			}
+			json.NewEncoder(w).Encode(codesResponse{Codes: codes})
+		case "/buffer/close":
+			closed = true
+			w.Write([]byte("{}"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "oms-1", map[string]ProductGroup{GroupMilk: {ClientToken: "token"}}, nil, time.Second, nil)
+	client.pollInterval = time.Millisecond
+	client.chunkSize = 2
+
+	var emitted, downloaded, calls int
+	codes, err := client.EmitCodes(context.Background(), GroupMilk, []OrderProduct{{GTIN: gtin, Quantity: 5}},
+		func(e, d int) {
+			emitted, downloaded, calls = emitted+e, downloaded+d, calls+1
+		})
+	if err != nil {
+		t.Fatalf("EmitCodes() вернул ошибку: %v", err)
+	}
+	if emitted != 5 || downloaded != 5 || calls != 4 {
+		t.Errorf("ход эмиссии: выпущено %d, получено %d за %d вызовов, ожидалось 5, 5 и 4", emitted, downloaded, calls)
+	}
+
+	if len(codes) != 5 {
+		t.Errorf("получено %d кодов, ожидалось 5", len(codes))
+	}
+	if request.ProductGroup != GroupMilk || len(request.Products) != 1 || request.Products[0].TemplateID != DefaultTemplates[GroupMilk] {
+		t.Errorf("неверный запрос создания заказа: %+v", request)
+	}
+	if statusChecks != 2 {
+		t.Errorf("буфер проверен %d раз, ожидалось 2", statusChecks)
+	}
+	if !closed {
+		t.Error("буфер не закрыт после получения кодов")
+	}
+}
+
+// Checkpoint, записывающий шаги эмиссии
+type recordedCheckpoint struct {
+	offsets []int
+	closed  []string
+}
+
+func (c *recordedCheckpoint) OrderCreated(context.Context, string) error { return nil }
+
+func (c *recordedCheckpoint) CodesReceived(_ context.Context, _ string, offset int, _ []string) error {
+	c.offsets = append(c.offsets, offset)
+	return nil
+}
+
+func (c *recordedCheckpoint) BufferClosed(_ context.Context, gtin string) error {
+	c.closed = append(c.closed, gtin)
+	return nil
+}
+
+func TestResumeCodes(t *testing.T) {
+	const gtin, closedGTIN = "04600000000015", "04600000000022"
+	var ordered bool
+	var requested []int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/order":
+			ordered = true
+			json.NewEncoder(w).Encode(orderResponse{OrderID: "order-2"})
+		case "/order/status":
+			json.NewEncoder(w).Encode([]Buffer{{OrderID: "order-1", GTIN: gtin, Status: BufferActive}})
+		case "/codes":
+			quantity, _ := strconv.Atoi(r.URL.Query().Get("quantity"))
+			requested = append(requested, quantity)
+			codes := make([]string, quantity)
+			for i := range codes {
+				codes[i] = fmt.Sprintf("NEW%d", i)
+			}
+			json.NewEncoder(w).Encode(codesResponse{Codes: codes})
+		case "/buffer/close":
+			if r.URL.Query().Get("gtin") != gtin {
+				t.Errorf("повторно закрыт буфер GTIN %s", r.URL.Query().Get("gtin"))
+			}
+			w.Write([]byte("{}"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "oms-1", map[string]ProductGroup{GroupMilk: {ClientToken: "token"}}, nil, time.Second, nil)
+	client.chunkSize = 2
+
+	state := Emission{
+		OrderID: "order-1",
+		Codes:   map[string][]string{closedGTIN: {"OLD1"}, gtin: {"OLD2", "OLD3"}},
+		Closed:  map[string]bool{closedGTIN: true},
+	}
+	checkpoint := &recordedCheckpoint{}
+	var downloaded int
+	codes, err := client.ResumeCodes(context.Background(), GroupMilk,
+		[]OrderProduct{{GTIN: closedGTIN, Quantity: 1}, {GTIN: gtin, Quantity: 5}}, state, checkpoint,
+		func(_, d int) { downloaded += d })
+	if err != nil {
+		t.Fatalf("ResumeCodes() вернул ошибку: %v", err)
+	}
+
+	if ordered {
+		t.Error("при продолжении эмиссии создан новый заказ")
+	}
+	if len(requested) != 2 || requested[0] != 2 || requested[1] != 1 {
+		t.Errorf("запрошены порции кодов %v, ожидалось [2 1]", requested)
+	}
+	if len(codes) != 6 || codes[0] != "OLD1" || codes[1] != "OLD2" || codes[3] != "NEW0" {
+		t.Errorf("получены коды %v", codes)
+	}
+	if downloaded != 6 {
+		t.Errorf("учтено %d полученных кодов, ожидалось 6", downloaded)
+	}
+	if len(checkpoint.offsets) != 2 || checkpoint.offsets[0] != 2 || checkpoint.offsets[1] != 4 {
+		t.Errorf("сохранены порции со смещениями %v, ожидалось [2 4]", checkpoint.offsets)
+	}
+	if len(checkpoint.closed) != 1 || checkpoint.closed[0] != gtin {
+		t.Errorf("сохранено закрытие буферов %v", checkpoint.closed)
+	}
+}
+
+func TestWaitBufferRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]Buffer{{GTIN: "04600000000015", Status: BufferRejected, RejectionReason: "неверный GTIN"}})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "oms-1", map[string]ProductGroup{GroupShoes: {ClientToken: "token"}}, nil, time.Second, nil)
+	if _, err := client.WaitBuffer(context.Background(), GroupShoes, "order-1", "04600000000015"); !errors.Is(err, ErrRejected) {
+		t.Errorf("ожидалась ошибка ErrRejected для отклоненного заказа, получено: %v", err)
+	}
+}
+
+func TestUnconfiguredGroup(t *testing.T) {
+	client := NewClient("http://localhost", "oms-1", map[string]ProductGroup{GroupMilk: {ClientToken: "token"}, GroupWater: {}}, nil, time.Second, nil)
+
+	if !client.SupportsGroup(GroupMilk) {
+		t.Error("группа milk должна поддерживаться")
+	}
+	if client.SupportsGroup(GroupWater) {
+		t.Error("группа water без токена не должна поддерживаться")
+	}
+}
+
+func TestPing(t *testing.T) {
+	status := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "oms-1", map[string]ProductGroup{GroupShoes: {ClientToken: "token"}}, nil, time.Second, nil)
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("ответ 404 означает, что СУЗ доступна, получена ошибка: %v", err)
+	}
+
+	status = http.StatusBadGateway
+	var apiErr *APIError
+	if err := client.Ping(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("ожидалась ошибка 502, получено: %v", err)
+	}
+}
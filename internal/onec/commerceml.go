@@ -0,0 +1,220 @@
+package onec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Хозяйственные операции документов CommerceML
+const (
+	OperationOrder   = "Заказ товара"
+	OperationPayment = "Выплата безналичных денег"
+	OperationSale    = "Продажа товара"
+	OperationRetail  = "Отчет о розничных продажах"
+)
+
+// Реквизиты строки товара с кодом маркировки. Коды содержат разделитель GS, недопустимый
+// в XML, поэтому выгружаются в Base64; при загрузке принимается и код без кодирования.
+const (
+	requisiteCode       = "КодМаркировки"
+	requisiteCodeBase64 = "КодМаркировкиBase64"
+)
+
+type commerceInfo struct {
+	XMLName   xml.Name   `xml:"КоммерческаяИнформация"`
+	Version   string     `xml:"ВерсияСхемы,attr"`
+	CreatedAt string     `xml:"ДатаФормирования,attr"`
+	Documents []document `xml:"Документ"`
+}
+
+type document struct {
+	ID         string      `xml:"Ид"`
+	Number     string      `xml:"Номер"`
+	Date       string      `xml:"Дата"`
+	Operation  string      `xml:"ХозОперация"`
+	Role       string      `xml:"Роль"`
+	Currency   string      `xml:"Валюта"`
+	Rate       string      `xml:"Курс"`
+	Amount     string      `xml:"Сумма"`
+	Parties    []party     `xml:"Контрагенты>Контрагент,omitempty"`
+	Basis      string      `xml:"Основание,omitempty"`
+	Products   []product   `xml:"Товары>Товар,omitempty"`
+	Requisites []requisite `xml:"ЗначенияРеквизитов>ЗначениеРеквизита,omitempty"`
+}
+
+type party struct {
+	ID   string `xml:"Ид"`
+	Name string `xml:"Наименование"`
+	Role string `xml:"Роль"`
+	INN  string `xml:"ИНН,omitempty"`
+	KPP  string `xml:"КПП,omitempty"`
+}
+
+type product struct {
+	ID         string      `xml:"Ид"`
+	Barcode    string      `xml:"Штрихкод,omitempty"`
+	Name       string      `xml:"Наименование"`
+	Price      string      `xml:"ЦенаЗаЕдиницу"`
+	Quantity   int         `xml:"Количество"`
+	Amount     string      `xml:"Сумма"`
+	Requisites []requisite `xml:"ЗначенияРеквизитов>ЗначениеРеквизита,omitempty"`
+}
+
+type requisite struct {
+	Name  string `xml:"Наименование"`
+	Value string `xml:"Значение"`
+}
+
+// WriteCommerceML записывает заказы и платежи в формате CommerceML 2.10. Заказы выгружаются
+// документами «Заказ товара» с кодами маркировки в реквизитах строк, платежи - документами
+// «Выплата безналичных денег» с номером заказа в основании.
+func WriteCommerceML(w io.Writer, exchange *Exchange) error {
+	info := commerceInfo{
+		Version:   "2.10",
+		CreatedAt: exchange.CreatedAt.Format("2006-01-02T15:04:05"),
+	}
+
+	// Стороны без реквизитов (личные данные пользователя, незаданный продавец) не выгружаются
+	var parties []party
+	for _, p := range []struct {
+		Party
+		role string
+	}{{exchange.Seller, "Продавец"}, {exchange.Buyer, "Покупатель"}} {
+		if p.INN != "" {
+			parties = append(parties, party{ID: p.INN, Name: p.Name, Role: p.role, INN: p.INN, KPP: p.KPP})
+		}
+	}
+
+	for _, order := range exchange.Orders {
+		doc := document{
+			ID:         "order-" + strconv.Itoa(order.Number),
+			Number:     strconv.Itoa(order.Number),
+			Date:       order.Date.Format("2006-01-02"),
+			Operation:  OperationOrder,
+			Role:       "Покупатель",
+			Currency:   "RUB",
+			Rate:       "1",
+			Amount:     xmlAmount(order.Amount),
+			Parties:    parties,
+			Requisites: []requisite{{Name: "Статус заказа", Value: order.Status}},
+		}
+		for _, item := range order.Items {
+			p := product{
+				ID:       item.GTIN,
+				Barcode:  item.GTIN,
+				Name:     item.Name,
+				Price:    xmlAmount(item.Price),
+				Quantity: item.Quantity,
+				Amount:   xmlAmount(item.Price * float64(item.Quantity)),
+			}
+			if p.Name == "" {
+				p.Name = "GTIN " + item.GTIN
+			}
+			for _, code := range item.Codes {
+				p.Requisites = append(p.Requisites, requisite{
+					Name:  requisiteCodeBase64,
+					Value: base64.StdEncoding.EncodeToString([]byte(code)),
+				})
+			}
+			doc.Products = append(doc.Products, p)
+		}
+		info.Documents = append(info.Documents, doc)
+	}
+
+	for _, payment := range exchange.Payments {
+		doc := document{
+			ID:        "payment-" + strconv.Itoa(payment.Number),
+			Number:    strconv.Itoa(payment.Number),
+			Date:      payment.Date.Format("2006-01-02"),
+			Operation: OperationPayment,
+			Role:      "Покупатель",
+			Currency:  payment.Currency,
+			Rate:      "1",
+			Amount:    xmlAmount(payment.Amount),
+			Parties:   parties,
+			Requisites: []requisite{
+				{Name: "Статус платежа", Value: payment.Status},
+				{Name: "ID транзакции", Value: payment.TransactionID},
+			},
+		}
+		if payment.OrderNumber > 0 {
+			doc.Basis = "order-" + strconv.Itoa(payment.OrderNumber)
+		}
+		info.Documents = append(info.Documents, doc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(info); err != nil {
+		return fmt.Errorf("ошибка формирования CommerceML: %w", err)
+	}
+	return nil
+}
+
+// Разбор документов продажи CommerceML; документы других операций пропускаются
+func parseCommerceMLSales(data []byte) ([]RetailSale, error) {
+	var info commerceInfo
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.EqualFold(charset, "utf-8") {
+			return input, nil
+		}
+		return nil, fmt.Errorf("неподдерживаемая кодировка %s, ожидается UTF-8", charset)
+	}
+	if err := decoder.Decode(&info); err != nil {
+		return nil, fmt.Errorf("ошибка чтения CommerceML: %w", err)
+	}
+
+	var sales []RetailSale
+	index := make(map[string]int)
+	for _, doc := range info.Documents {
+		if doc.Operation != OperationSale && doc.Operation != OperationRetail {
+			continue
+		}
+		number := strings.TrimSpace(doc.Number)
+		if number == "" {
+			return nil, fmt.Errorf("документ %q: не указан номер", doc.ID)
+		}
+		date, err := parseDate(strings.TrimSpace(doc.Date))
+		if err != nil {
+			return nil, fmt.Errorf("документ %s: %w", number, err)
+		}
+
+		var codes []string
+		for _, p := range doc.Products {
+			for _, r := range p.Requisites {
+				switch r.Name {
+				case requisiteCode:
+					codes = append(codes, strings.TrimSpace(r.Value))
+				case requisiteCodeBase64:
+					code, err := base64.StdEncoding.DecodeString(strings.TrimSpace(r.Value))
+					if err != nil {
+						return nil, fmt.Errorf("документ %s: некорректный код маркировки в Base64", number)
+					}
+					codes = append(codes, string(code))
+				}
+			}
+		}
+		if len(codes) > 0 {
+			sales = addSale(sales, index, number, date, codes...)
+		}
+	}
+	if len(sales) == 0 {
+		return nil, errors.New("в файле нет документов продажи с кодами маркировки")
+	}
+	return sales, nil
+}
+
+// Сумма CommerceML с десятичной точкой
+func xmlAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
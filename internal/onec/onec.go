@@ -0,0 +1,269 @@
+package onec
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Форматы обмена с 1С
+const (
+	FormatCommerceML = "commerceml" // XML CommerceML 2.10
+	FormatCSV        = "csv"        // ZIP-архив с файлами CSV
+)
+
+// Наибольшее число строк загружаемого отчета о розничных продажах
+const maxRetailRows = 100000
+
+// Party - сторона обмена: продавец кодов маркировки или покупатель
+type Party struct {
+	Name string
+	INN  string
+	KPP  string
+}
+
+// Item - строка заказа. Codes - коды маркировки, выданные по заказу для GTIN строки.
+type Item struct {
+	GTIN     string
+	Name     string
+	Quantity int
+	Price    float64
+	Codes    []string
+}
+
+// Order - заказ кодов маркировки
+type Order struct {
+	Number int
+	Date   time.Time
+	Status string
+	Amount float64
+	Items  []Item
+}
+
+// Payment - платеж по заказу
+type Payment struct {
+	Number        int
+	OrderNumber   int
+	Date          time.Time
+	Amount        float64
+	Currency      string
+	Status        string
+	TransactionID string
+}
+
+// Code - выданный код маркировки
+type Code struct {
+	Code        string
+	GTIN        string
+	Status      string
+	RequestID   int
+	OrderNumber int
+	IssuedAt    time.Time
+}
+
+// Exchange - данные выгрузки за период
+type Exchange struct {
+	Seller    Party
+	Buyer     Party
+	CreatedAt time.Time
+	Orders    []Order
+	Payments  []Payment
+	Codes     []Code
+}
+
+// RetailSale - чек розничной продажи с проданными кодами маркировки
+type RetailSale struct {
+	Number string
+	Date   time.Time
+	Codes  []string
+}
+
+// WriteCSV записывает ZIP-архив с файлами orders.csv, payments.csv и codes.csv.
+// Файлы в кодировке UTF-8 с BOM и разделителем ";", как их открывают 1С и Excel;
+// даты в формате ДД.ММ.ГГГГ, суммы с десятичной запятой.
+func WriteCSV(w io.Writer, exchange *Exchange) error {
+	archive := zip.NewWriter(w)
+
+	orders := [][]string{{"Номер заказа", "Дата", "Статус", "GTIN", "Наименование", "Количество", "Цена", "Сумма"}}
+	for _, order := range exchange.Orders {
+		for _, item := range order.Items {
+			orders = append(orders, []string{
+				strconv.Itoa(order.Number), formatDate(order.Date), order.Status, item.GTIN, item.Name,
+				strconv.Itoa(item.Quantity), formatAmount(item.Price), formatAmount(item.Price * float64(item.Quantity)),
+			})
+		}
+	}
+
+	payments := [][]string{{"Номер платежа", "Номер заказа", "Дата", "Сумма", "Валюта", "Статус", "ID транзакции"}}
+	for _, payment := range exchange.Payments {
+		payments = append(payments, []string{
+			strconv.Itoa(payment.Number), formatNumber(payment.OrderNumber), formatDate(payment.Date),
+			formatAmount(payment.Amount), payment.Currency, payment.Status, payment.TransactionID,
+		})
+	}
+
+	codes := [][]string{{"Код маркировки", "GTIN", "Статус", "Номер запроса", "Номер заказа", "Дата выдачи"}}
+	for _, code := range exchange.Codes {
+		codes = append(codes, []string{
+			code.Code, code.GTIN, code.Status, strconv.Itoa(code.RequestID),
+			formatNumber(code.OrderNumber), formatDate(code.IssuedAt),
+		})
+	}
+
+	for _, file := range []struct {
+		name    string
+		records [][]string
+	}{
+		{"orders.csv", orders},
+		{"payments.csv", payments},
+		{"codes.csv", codes},
+	} {
+		if err := writeCSVFile(archive, file.name, file.records); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func writeCSVFile(archive *zip.Writer, name string, records [][]string) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла %s: %w", name, err)
+	}
+	if _, err := io.WriteString(file, "\uFEFF"); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	writer.Comma = ';'
+	writer.UseCRLF = true
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("ошибка записи файла %s: %w", name, err)
+	}
+	return nil
+}
+
+// ParseRetailSales разбирает отчет о розничных продажах, выгруженный из 1С, в формате
+// CommerceML или CSV. Формат определяется по содержимому. Коды одного чека объединяются.
+func ParseRetailSales(data []byte) ([]RetailSale, error) {
+	data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '<' {
+		return parseCommerceMLSales(data)
+	}
+	return parseCSVSales(data)
+}
+
+// Разбор CSV с колонками «Номер чека», «Дата чека» и «Код маркировки» в любом порядке;
+// разделитель ";" или ","
+func parseCSVSales(data []byte) ([]RetailSale, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = ';'
+	if line, _, _ := bytes.Cut(data, []byte("\n")); !bytes.Contains(line, []byte(";")) {
+		reader.Comma = ','
+	}
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("файл продаж пуст")
+	} else if err != nil {
+		return nil, fmt.Errorf("ошибка чтения CSV: %w", err)
+	}
+	columns := map[string]int{"номер чека": -1, "дата чека": -1, "код маркировки": -1}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; ok {
+			columns[name] = i
+		}
+	}
+	for name, index := range columns {
+		if index < 0 {
+			return nil, fmt.Errorf("в файле продаж нет колонки %q", name)
+		}
+	}
+
+	var sales []RetailSale
+	index := make(map[string]int)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("ошибка чтения CSV: %w", err)
+		}
+		if row > maxRetailRows+1 {
+			return nil, fmt.Errorf("файл продаж содержит более %d строк", maxRetailRows)
+		}
+		field := func(name string) string {
+			if i := columns[name]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		number, code := field("номер чека"), field("код маркировки")
+		if number == "" && code == "" {
+			continue
+		}
+		if number == "" || code == "" {
+			return nil, fmt.Errorf("строка %d: необходимо указать номер чека и код маркировки", row)
+		}
+		date, err := parseDate(field("дата чека"))
+		if err != nil {
+			return nil, fmt.Errorf("строка %d: %w", row, err)
+		}
+		sales = addSale(sales, index, number, date, code)
+	}
+	if len(sales) == 0 {
+		return nil, errors.New("в файле продаж нет чеков")
+	}
+	return sales, nil
+}
+
+// Добавление кода к чеку; чеки различаются номером и датой
+func addSale(sales []RetailSale, index map[string]int, number string, date time.Time, codes ...string) []RetailSale {
+	key := number + "|" + date.Format("2006-01-02")
+	i, ok := index[key]
+	if !ok {
+		i = len(sales)
+		index[key] = i
+		sales = append(sales, RetailSale{Number: number, Date: date})
+	}
+	sales[i].Codes = append(sales[i].Codes, codes...)
+	return sales
+}
+
+// Даты 1С: ДД.ММ.ГГГГ, ДД.ММ.ГГГГ ЧЧ:ММ:СС или ГГГГ-ММ-ДД, в том числе с временем
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range []string{"02.01.2006", "02.01.2006 15:04:05", "02.01.2006 15:04", "2006-01-02", "2006-01-02T15:04:05"} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("некорректная дата чека %q", value)
+}
+
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.Format("02.01.2006")
+}
+
+// Сумма с десятичной запятой: 1234,50
+func formatAmount(amount float64) string {
+	return strings.Replace(strconv.FormatFloat(amount, 'f', 2, 64), ".", ",", 1)
+}
+
+// Номер связанного документа; 0 - связи нет
+func formatNumber(number int) string {
+	if number == 0 {
+		return ""
+	}
+	return strconv.Itoa(number)
+}
@@ -0,0 +1,121 @@
+package onec
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testExchange() *Exchange {
+	return &Exchange{
+		Seller:    Party{Name: "ООО Знак", INN: "7707083893"},
+		Buyer:     Party{Name: "ИП Иванов", INN: "500100732259"},
+		CreatedAt: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		Orders: []Order{{
+			Number: 15,
+			Date:   time.Date(2026, 9, 30, 10, 0, 0, 0, time.UTC),
+			Status: "paid",
+			Amount: 12.5,
+			Items: []Item{{
+				GTIN: "04607123456789", Name: "Молоко", Quantity: 25, Price: 0.5,
+				Codes: []string{"0104607123456789215abc\x1d93XYZ"},
+			}},
+		}},
+		Payments: []Payment{{Number: 7, OrderNumber: 15, Date: time.Date(2026, 9, 30, 11, 0, 0, 0, time.UTC),
+			Amount: 12.5, Currency: "RUB", Status: "completed", TransactionID: "42"}},
+		Codes: []Code{{Code: "0104607123456789215abc\x1d93XYZ", GTIN: "04607123456789", Status: "issued",
+			RequestID: 3, OrderNumber: 15, IssuedAt: time.Date(2026, 9, 30, 12, 0, 0, 0, time.UTC)}},
+	}
+}
+
+func TestWriteCommerceML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCommerceML(&buf, testExchange()); err != nil {
+		t.Fatalf("ошибка формирования: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<КоммерческаяИнформация ВерсияСхемы="2.10" ДатаФормирования="2026-10-01T12:00:00">`,
+		"<ХозОперация>Заказ товара</ХозОперация>",
+		"<ХозОперация>Выплата безналичных денег</ХозОперация>",
+		"<Основание>order-15</Основание>",
+		"<Сумма>12.50</Сумма>",
+		"<Значение>MDEwNDYwNzEyMzQ1Njc4OTIxNWFiYx05M1hZWg==</Значение>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("в CommerceML нет %q", want)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, testExchange()); err != nil {
+		t.Fatalf("ошибка формирования: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ошибка чтения архива: %v", err)
+	}
+	if len(archive.File) != 3 {
+		t.Fatalf("в архиве %d файлов, ожидалось 3", len(archive.File))
+	}
+	file, _ := archive.File[0].Open()
+	data, _ := io.ReadAll(file)
+	want := "\uFEFFНомер заказа;Дата;Статус;GTIN;Наименование;Количество;Цена;Сумма\r\n" +
+		"15;30.09.2026;paid;04607123456789;Молоко;25;0,50;12,50\r\n"
+	if string(data) != want {
+		t.Errorf("orders.csv = %q, ожидалось %q", data, want)
+	}
+}
+
+func TestParseRetailSalesCSV(t *testing.T) {
+	data := "\uFEFFДата чека;Номер чека;Код маркировки\n" +
+		"30.09.2026;101;code1\n" +
+		"30.09.2026 15:04:05;101;code2\n" +
+		";;\n" +
+		"01.10.2026;102;code3\n"
+	sales, err := ParseRetailSales([]byte(data))
+	if err != nil {
+		t.Fatalf("ошибка разбора: %v", err)
+	}
+	if len(sales) != 2 {
+		t.Fatalf("чеков %d, ожидалось 2", len(sales))
+	}
+	if sales[0].Number != "101" || len(sales[0].Codes) != 2 || sales[0].Date.Day() != 30 {
+		t.Errorf("неверный первый чек: %+v", sales[0])
+	}
+
+	if _, err := ParseRetailSales([]byte("Номер чека,Код маркировки\n101,code1\n")); err == nil {
+		t.Error("файл без колонки даты должен отклоняться")
+	}
+}
+
+func TestParseRetailSalesCommerceML(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<КоммерческаяИнформация ВерсияСхемы="2.10">
+  <Документ>
+    <Номер>15</Номер><Дата>2026-09-30</Дата><ХозОперация>Заказ товара</ХозОперация>
+  </Документ>
+  <Документ>
+    <Номер>R-1</Номер><Дата>2026-10-01</Дата><ХозОперация>Отчет о розничных продажах</ХозОперация>
+    <Товары><Товар><ЗначенияРеквизитов>
+      <ЗначениеРеквизита><Наименование>КодМаркировки</Наименование><Значение>plain</Значение></ЗначениеРеквизита>
+      <ЗначениеРеквизита><Наименование>КодМаркировкиBase64</Наименование><Значение>YWJjHTkz</Значение></ЗначениеРеквизита>
+    </ЗначенияРеквизитов></Товар></Товары>
+  </Документ>
+</КоммерческаяИнформация>`
+	sales, err := ParseRetailSales([]byte(data))
+	if err != nil {
+		t.Fatalf("ошибка разбора: %v", err)
+	}
+	if len(sales) != 1 || sales[0].Number != "R-1" {
+		t.Fatalf("неверные чеки: %+v", sales)
+	}
+	if codes := sales[0].Codes; len(codes) != 2 || codes[0] != "plain" || codes[1] != "abc\x1d93" {
+		t.Errorf("неверные коды: %q", codes)
+	}
+}
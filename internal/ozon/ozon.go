@@ -0,0 +1,223 @@
+package ozon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"project-znak/internal/tracing"
+)
+
+// Статусы проверки экземпляров отправления
+const (
+	StatusShipAvailable       = "ship_available"        // Коды приняты, отправление можно собирать
+	StatusShipNotAvailable    = "ship_not_available"    // Коды не прошли проверку
+	StatusValidationInProcess = "validation_in_process" // Коды проверяются
+)
+
+// ErrUnauthorized возвращается, если Ozon отклонил Client-Id или API-ключ продавца
+var ErrUnauthorized = errors.New("Client-Id или API-ключ Ozon недействительны")
+
+// ErrNotFound возвращается, если отправление не найдено
+var ErrNotFound = errors.New("отправление не найдено в Ozon")
+
+// APIError - ошибка, возвращенная Ozon Seller API
+type APIError struct {
+	StatusCode int
+	Code       int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Ozon вернул ошибку %d: %s", e.StatusCode, e.Message)
+}
+
+// Credentials - ключ Seller API продавца
+type Credentials struct {
+	ClientID string
+	APIKey   string
+}
+
+// Product - товар отправления FBS
+type Product struct {
+	SKU      int64  `json:"sku"`
+	OfferID  string `json:"offer_id"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+// Posting - отправление FBS
+type Posting struct {
+	PostingNumber string    `json:"posting_number"`
+	Status        string    `json:"status"`
+	Products      []Product `json:"products"`
+}
+
+// ProductMarks - коды маркировки экземпляров одного товара отправления
+type ProductMarks struct {
+	SKU   int64
+	Marks []string
+}
+
+// ExemplarCheck - результат проверки кода маркировки экземпляра
+type ExemplarCheck struct {
+	SKU         int64    `json:"sku"`
+	Mark        string   `json:"mark"`
+	CheckStatus string   `json:"check_status"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// ExemplarStatus - состояние проверки кодов отправления
+type ExemplarStatus struct {
+	Status    string          `json:"status"`
+	Exemplars []ExemplarCheck `json:"exemplars"`
+}
+
+// Client выполняет запросы к Ozon Seller API. Ключ API передается в каждом запросе:
+// он принадлежит продавцу, а не сервису.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient создает клиент Ozon Seller API
+func NewClient(baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout, Transport: tracing.Transport("ozon")},
+	}
+}
+
+// Enabled сообщает, настроен ли адрес Ozon Seller API
+func (c *Client) Enabled() bool {
+	return c != nil && c.baseURL != ""
+}
+
+// Posting возвращает отправление FBS с товарами
+func (c *Client) Posting(ctx context.Context, creds Credentials, postingNumber string) (*Posting, error) {
+	var response struct {
+		Result Posting `json:"result"`
+	}
+	if err := c.do(ctx, creds, "/v3/posting/fbs/get", map[string]string{"posting_number": postingNumber}, &response); err != nil {
+		return nil, err
+	}
+	return &response.Result, nil
+}
+
+// Экземпляр товара в запросе передачи кодов
+type exemplar struct {
+	MandatoryMark string `json:"mandatory_mark"`
+	IsGTDAbsent   bool   `json:"is_gtd_absent"`
+	IsRNPTAbsent  bool   `json:"is_rnpt_absent"`
+}
+
+// Товар в запросе передачи кодов
+type exemplarProduct struct {
+	ProductID int64      `json:"product_id"`
+	Exemplars []exemplar `json:"exemplars"`
+}
+
+// SetExemplars передает коды маркировки экземпляров отправления на проверку. Номер ГТД
+// и РНПТ не передаются: коды выпущены для товаров, произведенных в России.
+func (c *Client) SetExemplars(ctx context.Context, creds Credentials, postingNumber string, products []ProductMarks) error {
+	request := struct {
+		PostingNumber string            `json:"posting_number"`
+		Products      []exemplarProduct `json:"products"`
+	}{PostingNumber: postingNumber}
+	for _, product := range products {
+		item := exemplarProduct{ProductID: product.SKU}
+		for _, mark := range product.Marks {
+			item.Exemplars = append(item.Exemplars, exemplar{MandatoryMark: mark, IsGTDAbsent: true, IsRNPTAbsent: true})
+		}
+		request.Products = append(request.Products, item)
+	}
+	return c.do(ctx, creds, "/v5/fbs/posting/product/exemplar/set", request, nil)
+}
+
+// ExemplarStatus возвращает состояние проверки кодов отправления
+func (c *Client) ExemplarStatus(ctx context.Context, creds Credentials, postingNumber string) (*ExemplarStatus, error) {
+	var response struct {
+		Status   string `json:"status"`
+		Products []struct {
+			ProductID int64 `json:"product_id"`
+			Exemplars []struct {
+				MandatoryMark     string   `json:"mandatory_mark"`
+				CheckStatus       string   `json:"mandatory_mark_check_status"`
+				MandatoryMarkErrs []string `json:"mandatory_mark_error_codes"`
+			} `json:"exemplars"`
+		} `json:"products"`
+	}
+	if err := c.do(ctx, creds, "/v4/fbs/posting/product/exemplar/status", map[string]string{"posting_number": postingNumber}, &response); err != nil {
+		return nil, err
+	}
+
+	status := &ExemplarStatus{Status: response.Status, Exemplars: []ExemplarCheck{}}
+	for _, product := range response.Products {
+		for _, e := range product.Exemplars {
+			status.Exemplars = append(status.Exemplars, ExemplarCheck{
+				SKU:         product.ProductID,
+				Mark:        e.MandatoryMark,
+				CheckStatus: e.CheckStatus,
+				Errors:      e.MandatoryMarkErrs,
+			})
+		}
+	}
+	return status, nil
+}
+
+// Выполнение POST-запроса к API; ответ декодируется в result, если он не nil
+func (c *Client) do(ctx context.Context, creds Credentials, path string, body, result any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации запроса: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Client-Id", creds.ClientID)
+	req.Header.Set("Api-Key", creds.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса к Ozon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var payload struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &payload) == nil && payload.Message != "" {
+			apiErr.Code, apiErr.Message = payload.Code, payload.Message
+		} else {
+			apiErr.Message = string(data)
+		}
+		return apiErr
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("ошибка декодирования ответа: %w", err)
+	}
+	return nil
+}
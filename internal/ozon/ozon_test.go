@@ -0,0 +1,72 @@
+package ozon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSubmitExemplars(t *testing.T) {
+	var set struct {
+		PostingNumber string            `json:"posting_number"`
+		Products      []exemplarProduct `json:"products"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Client-Id") != "123" || r.Header.Get("Api-Key") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v3/posting/fbs/get":
+			w.Write([]byte(`{"result":{"posting_number":"1-2-3","status":"awaiting_packaging",` +
+				`"products":[{"sku":555,"offer_id":"A-1","name":"Молоко","quantity":2}]}}`))
+		case "/v5/fbs/posting/product/exemplar/set":
+			json.NewDecoder(r.Body).Decode(&set)
+			w.Write([]byte(`{}`))
+		case "/v4/fbs/posting/product/exemplar/status":
+			w.Write([]byte(`{"posting_number":"1-2-3","status":"ship_not_available","products":[{"product_id":555,` +
+				`"exemplars":[{"mandatory_mark":"CODE1","mandatory_mark_check_status":"passed"},` +
+				`{"mandatory_mark":"CODE2","mandatory_mark_check_status":"failed","mandatory_mark_error_codes":["ALREADY_USED"]}]}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":5,"message":"posting not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, time.Second)
+	ctx := context.Background()
+	creds := Credentials{ClientID: "123", APIKey: "key"}
+
+	posting, err := client.Posting(ctx, creds, "1-2-3")
+	if err != nil {
+		t.Fatalf("Posting() вернул ошибку: %v", err)
+	}
+	if len(posting.Products) != 1 || posting.Products[0].SKU != 555 || posting.Products[0].Quantity != 2 {
+		t.Fatalf("неверное отправление: %+v", posting)
+	}
+
+	if err := client.SetExemplars(ctx, creds, "1-2-3", []ProductMarks{{SKU: 555, Marks: []string{"CODE1", "CODE2"}}}); err != nil {
+		t.Fatalf("SetExemplars() вернул ошибку: %v", err)
+	}
+	if set.PostingNumber != "1-2-3" || len(set.Products) != 1 || len(set.Products[0].Exemplars) != 2 ||
+		set.Products[0].Exemplars[1].MandatoryMark != "CODE2" || !set.Products[0].Exemplars[1].IsGTDAbsent {
+		t.Errorf("неверный запрос передачи кодов: %+v", set)
+	}
+
+	status, err := client.ExemplarStatus(ctx, creds, "1-2-3")
+	if err != nil {
+		t.Fatalf("ExemplarStatus() вернул ошибку: %v", err)
+	}
+	if status.Status != StatusShipNotAvailable || len(status.Exemplars) != 2 || status.Exemplars[1].Errors[0] != "ALREADY_USED" {
+		t.Errorf("неверный статус проверки: %+v", status)
+	}
+
+	if _, err := client.Posting(ctx, Credentials{ClientID: "123", APIKey: "wrong"}, "1-2-3"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("ожидалась ошибка ErrUnauthorized, получено %v", err)
+	}
+}
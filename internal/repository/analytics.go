@@ -0,0 +1,312 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Дневные сводки для аналитики. Из них же создаются материализованные представления
+// analytics_revenue_daily и analytics_codes_daily.
+const (
+	revenueDailyQuery = `SELECT completed_at::date AS day, COUNT(*) AS payments, SUM(amount) AS amount
+		FROM payments
+		WHERE status = 'completed' AND completed_at IS NOT NULL
+		GROUP BY 1`
+	codesDailyQuery = `SELECT c.created_at::date AS day, COALESCE(r.product_group, '') AS product_group, COUNT(*) AS codes
+		FROM kiz_codes c JOIN kiz_requests r ON r.id = c.request_id
+		GROUP BY 1, 2`
+)
+
+// AnalyticsFilter - период аналитики [From, To) и шаг временных рядов
+type AnalyticsFilter struct {
+	From     time.Time
+	To       time.Time
+	Interval string // day, week или month
+	Top      int    // Число пользователей в рейтинге
+	// Брать дневные сводки из материализованных представлений вместо исходных таблиц
+	Materialized bool
+}
+
+// RevenuePoint - проведенные платежи за интервал
+type RevenuePoint struct {
+	Period   time.Time `json:"period" xml:"period"`
+	Payments int       `json:"payments" xml:"payments"`
+	Amount   float64   `json:"amount" xml:"amount"`
+}
+
+// CodesPoint - коды, выданные за интервал по товарной группе
+type CodesPoint struct {
+	Period       time.Time `json:"period" xml:"period"`
+	ProductGroup string    `json:"product_group" xml:"product_group"`
+	Codes        int       `json:"codes" xml:"codes"`
+}
+
+// MarginPoint - стоимость, плата Честного ЗНАКа и маржа кодов по заказам, оплаченным
+// за интервал, по товарной группе. Позиции, созданные до учета маржи, не учитываются.
+type MarginPoint struct {
+	Period       time.Time `json:"period" xml:"period"`
+	ProductGroup string    `json:"product_group" xml:"product_group"`
+	Codes        int       `json:"codes" xml:"codes"`
+	Amount       float64   `json:"amount" xml:"amount"`
+	FeeCost      float64   `json:"fee_cost" xml:"fee_cost"`
+	Margin       float64   `json:"margin" xml:"margin"`
+}
+
+// TopUser - пользователь в рейтинге по сумме платежей и числу кодов за период
+type TopUser struct {
+	UserID           int     `json:"user_id" xml:"user_id"`
+	TelegramID       int64   `json:"telegram_id,omitempty" xml:"telegram_id,omitempty"`
+	OrganizationName string  `json:"organization_name,omitempty" xml:"organization_name,omitempty"`
+	Codes            int     `json:"codes" xml:"codes"`
+	Amount           float64 `json:"amount" xml:"amount"`
+}
+
+// OperationStats - число операций с Честным ЗНАКом за период, доля ошибок и среднее время
+// обработки. Source: kiz - запросы кодов, introduction и retirement - документы.
+type OperationStats struct {
+	Source            string  `json:"source" xml:"source"`
+	Total             int     `json:"total" xml:"total"`
+	Failed            int     `json:"failed" xml:"failed"`
+	ErrorRate         float64 `json:"error_rate" xml:"error_rate"`
+	AvgProcessingSecs float64 `json:"avg_processing_seconds" xml:"avg_processing_seconds"`
+}
+
+// ErrorStat - число ошибок Честного ЗНАКа с одинаковым текстом
+type ErrorStat struct {
+	Source string `json:"source" xml:"source"`
+	Error  string `json:"error" xml:"error"`
+	Count  int    `json:"count" xml:"count"`
+}
+
+// Analytics - сводные показатели сервиса за период
+type Analytics struct {
+	Revenue    []RevenuePoint   `json:"revenue" xml:"revenue>point"`
+	Codes      []CodesPoint     `json:"codes" xml:"codes>code"`
+	Margin     []MarginPoint    `json:"margin" xml:"margin>point"`
+	TopUsers   []TopUser        `json:"top_users" xml:"top_users>user"`
+	Operations []OperationStats `json:"operations" xml:"operations>operation"`
+	Errors     []ErrorStat      `json:"errors" xml:"errors>error"`
+}
+
+// Наибольшее число строк в разбивке ошибок
+const analyticsErrorsLimit = 20
+
+// Analytics подсчитывает показатели сервиса за период фильтра
+func (r *Repository) Analytics(ctx context.Context, filter AnalyticsFilter) (*Analytics, error) {
+	revenueSource, codesSource := "("+revenueDailyQuery+")", "("+codesDailyQuery+")"
+	if filter.Materialized {
+		revenueSource, codesSource = "analytics_revenue_daily", "analytics_codes_daily"
+	}
+
+	analytics := Analytics{
+		Revenue:    []RevenuePoint{},
+		Codes:      []CodesPoint{},
+		Margin:     []MarginPoint{},
+		TopUsers:   []TopUser{},
+		Operations: []OperationStats{},
+		Errors:     []ErrorStat{},
+	}
+
+	rows, err := r.readQuery(ctx, `
+		SELECT date_trunc($3::text, d.day::timestamp), SUM(d.payments), SUM(d.amount)
+		FROM `+revenueSource+` d
+		WHERE d.day >= $1 AND d.day < $2
+		GROUP BY 1
+		ORDER BY 1
+	`, filter.From, filter.To, filter.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета выручки: %w", err)
+	}
+	for rows.Next() {
+		var point RevenuePoint
+		if err := rows.Scan(&point.Period, &point.Payments, &point.Amount); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка подсчета выручки: %w", err)
+		}
+		analytics.Revenue = append(analytics.Revenue, point)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета выручки: %w", err)
+	}
+
+	rows, err = r.readQuery(ctx, `
+		SELECT date_trunc($3::text, d.day::timestamp), d.product_group, SUM(d.codes)
+		FROM `+codesSource+` d
+		WHERE d.day >= $1 AND d.day < $2
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`, filter.From, filter.To, filter.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета кодов: %w", err)
+	}
+	for rows.Next() {
+		var point CodesPoint
+		if err := rows.Scan(&point.Period, &point.ProductGroup, &point.Codes); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка подсчета кодов: %w", err)
+		}
+		analytics.Codes = append(analytics.Codes, point)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета кодов: %w", err)
+	}
+
+	// Заказ относится к интервалу, в котором проведен его первый платеж
+	rows, err = r.readQuery(ctx, `
+		WITH paid AS (
+			SELECT order_id, MIN(completed_at) AS paid_at
+			FROM payments
+			WHERE status = 'completed' AND order_id IS NOT NULL
+			GROUP BY order_id
+		)
+		SELECT date_trunc($3::text, p.paid_at), COALESCE(i.product_group, o.product_group, ''),
+			SUM(i.quantity), SUM(i.price * i.quantity), SUM(i.fee_cost * i.quantity), SUM(i.margin)
+		FROM paid p
+		JOIN orders o ON o.id = p.order_id
+		JOIN order_items i ON i.order_id = o.id
+		WHERE p.paid_at >= $1 AND p.paid_at < $2 AND i.margin IS NOT NULL
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`, filter.From, filter.To, filter.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета маржи: %w", err)
+	}
+	for rows.Next() {
+		var point MarginPoint
+		if err := rows.Scan(&point.Period, &point.ProductGroup, &point.Codes, &point.Amount,
+			&point.FeeCost, &point.Margin); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка подсчета маржи: %w", err)
+		}
+		analytics.Margin = append(analytics.Margin, point)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета маржи: %w", err)
+	}
+
+	rows, err = r.readQuery(ctx, `
+		WITH codes AS (
+			SELECT r.user_id, COUNT(*) AS codes
+			FROM kiz_codes c JOIN kiz_requests r ON r.id = c.request_id
+			WHERE c.created_at >= $1 AND c.created_at < $2
+			GROUP BY r.user_id
+		), spent AS (
+			SELECT user_id, SUM(amount) AS amount
+			FROM payments
+			WHERE status = 'completed' AND completed_at >= $1 AND completed_at < $2
+			GROUP BY user_id
+		)
+		SELECT u.id, COALESCE(u.telegram_id, 0), COALESCE(u.organization_name, ''),
+			COALESCE(c.codes, 0), COALESCE(s.amount, 0)
+		FROM users u
+		LEFT JOIN codes c ON c.user_id = u.id
+		LEFT JOIN spent s ON s.user_id = u.id
+		WHERE c.codes IS NOT NULL OR s.amount IS NOT NULL
+		ORDER BY COALESCE(s.amount, 0) DESC, COALESCE(c.codes, 0) DESC, u.id
+		LIMIT $3
+	`, filter.From, filter.To, filter.Top)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета рейтинга пользователей: %w", err)
+	}
+	for rows.Next() {
+		var user TopUser
+		if err := rows.Scan(&user.UserID, &user.TelegramID, &user.OrganizationName, &user.Codes, &user.Amount); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка подсчета рейтинга пользователей: %w", err)
+		}
+		analytics.TopUsers = append(analytics.TopUsers, user)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета рейтинга пользователей: %w", err)
+	}
+
+	// Время обработки запроса кодов - от запроса до сохранения результата,
+	// документа - от отправки до получения результата проверки
+	rows, err = r.readQuery(ctx, `
+		SELECT 'kiz', COUNT(*), COUNT(*) FILTER (WHERE r.status IN ('failed', 'dead')),
+			COALESCE(AVG(EXTRACT(EPOCH FROM res.created_at - r.request_time)) FILTER (WHERE r.status = 'completed'), 0)
+		FROM kiz_requests r
+		LEFT JOIN kiz_results res ON res.request_id = r.id
+		WHERE r.request_time >= $1 AND r.request_time < $2
+		UNION ALL
+		SELECT 'introduction', COUNT(*), COUNT(*) FILTER (WHERE status = 'rejected'),
+			COALESCE(AVG(EXTRACT(EPOCH FROM processed_at - submitted_at)) FILTER (WHERE processed_at IS NOT NULL), 0)
+		FROM introduction_documents
+		WHERE submitted_at >= $1 AND submitted_at < $2
+		UNION ALL
+		SELECT 'retirement', COUNT(*), COUNT(*) FILTER (WHERE status = 'rejected'),
+			COALESCE(AVG(EXTRACT(EPOCH FROM processed_at - submitted_at)) FILTER (WHERE processed_at IS NOT NULL), 0)
+		FROM retirement_documents
+		WHERE submitted_at >= $1 AND submitted_at < $2
+	`, filter.From, filter.To)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета операций: %w", err)
+	}
+	for rows.Next() {
+		var stats OperationStats
+		if err := rows.Scan(&stats.Source, &stats.Total, &stats.Failed, &stats.AvgProcessingSecs); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка подсчета операций: %w", err)
+		}
+		if stats.Total > 0 {
+			stats.ErrorRate = float64(stats.Failed) / float64(stats.Total)
+		}
+		analytics.Operations = append(analytics.Operations, stats)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета операций: %w", err)
+	}
+
+	rows, err = r.readQuery(ctx, `
+		SELECT source, error, COUNT(*)
+		FROM (
+			SELECT 'kiz' AS source, COALESCE(NULLIF(error, ''), 'Без описания') AS error
+			FROM kiz_requests
+			WHERE status IN ('failed', 'dead') AND failed_at >= $1 AND failed_at < $2
+			UNION ALL
+			SELECT 'introduction', COALESCE(NULLIF(error, ''), 'Без описания')
+			FROM introduction_documents
+			WHERE status = 'rejected' AND processed_at >= $1 AND processed_at < $2
+			UNION ALL
+			SELECT 'retirement', COALESCE(NULLIF(error, ''), 'Без описания')
+			FROM retirement_documents
+			WHERE status = 'rejected' AND processed_at >= $1 AND processed_at < $2
+		) e
+		GROUP BY source, error
+		ORDER BY COUNT(*) DESC, source, error
+		LIMIT $3
+	`, filter.From, filter.To, analyticsErrorsLimit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета ошибок: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var stat ErrorStat
+		if err := rows.Scan(&stat.Source, &stat.Error, &stat.Count); err != nil {
+			return nil, fmt.Errorf("ошибка подсчета ошибок: %w", err)
+		}
+		analytics.Errors = append(analytics.Errors, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета ошибок: %w", err)
+	}
+
+	return &analytics, nil
+}
+
+// RefreshAnalyticsViews пересчитывает материализованные представления дневных сводок,
+// не блокируя чтение из них
+func (r *Repository) RefreshAnalyticsViews(ctx context.Context) error {
+	for _, view := range []string{"analytics_revenue_daily", "analytics_codes_daily"} {
+		if _, err := r.db.ExecContext(ctx, "REFRESH MATERIALIZED VIEW CONCURRENTLY "+view); err != nil {
+			return fmt.Errorf("ошибка обновления представления %s: %w", view, err)
+		}
+	}
+	return nil
+}
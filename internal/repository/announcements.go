@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+const announcementColumns = `id, title, text, level, starts_at, ends_at, broadcast, broadcast_count,
+	broadcast_done_at, COALESCE(created_by, 0), created_at`
+
+func scanAnnouncement(scan func(dest ...any) error) (*models.Announcement, error) {
+	var announcement models.Announcement
+	var endsAt, doneAt sql.NullTime
+	if err := scan(&announcement.ID, &announcement.Title, &announcement.Text, &announcement.Level,
+		&announcement.StartsAt, &endsAt, &announcement.Broadcast, &announcement.BroadcastCount,
+		&doneAt, &announcement.CreatedBy, &announcement.CreatedAt); err != nil {
+		return nil, err
+	}
+	announcement.EndsAt = timePtr(endsAt)
+	announcement.BroadcastDoneAt = timePtr(doneAt)
+	return &announcement, nil
+}
+
+func (r *Repository) queryAnnouncements(ctx context.Context, query string, args ...any) ([]models.Announcement, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+announcementColumns+" FROM announcements "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	announcements := []models.Announcement{}
+	for rows.Next() {
+		announcement, err := scanAnnouncement(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		announcements = append(announcements, *announcement)
+	}
+	return announcements, rows.Err()
+}
+
+// CreateAnnouncement сохраняет объявление и заполняет его ID и время создания
+func (r *Repository) CreateAnnouncement(ctx context.Context, announcement *models.Announcement) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO announcements (title, text, level, starts_at, ends_at, broadcast, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0))
+		RETURNING id, created_at
+	`, announcement.Title, announcement.Text, announcement.Level, announcement.StartsAt, announcement.EndsAt,
+		announcement.Broadcast, announcement.CreatedBy).Scan(&announcement.ID, &announcement.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения объявления: %w", err)
+	}
+	return nil
+}
+
+// Announcements возвращает последние объявления, включая завершенные и запланированные
+func (r *Repository) Announcements(ctx context.Context, limit int) ([]models.Announcement, error) {
+	return r.queryAnnouncements(ctx, "ORDER BY id DESC LIMIT $1", limit)
+}
+
+// ActiveAnnouncements возвращает объявления, действующие в момент now, новые первыми
+func (r *Repository) ActiveAnnouncements(ctx context.Context, now time.Time) ([]models.Announcement, error) {
+	return r.queryAnnouncements(ctx, `
+		WHERE starts_at <= $1 AND (ends_at IS NULL OR ends_at > $1)
+		ORDER BY starts_at DESC, id DESC`, now)
+}
+
+// EndAnnouncement снимает действующее или запланированное объявление и останавливает его
+// рассылку. Возвращает ErrNotFound, если объявление не найдено или уже завершено.
+func (r *Repository) EndAnnouncement(ctx context.Context, id int) (*models.Announcement, error) {
+	announcement, err := scanAnnouncement(r.db.QueryRowContext(ctx, `
+		UPDATE announcements SET ends_at = $2, broadcast_done_at = COALESCE(broadcast_done_at, $2)
+		WHERE id = $1 AND (ends_at IS NULL OR ends_at > $2)
+		RETURNING `+announcementColumns, id, time.Now()).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return announcement, err
+}
+
+// PendingAnnouncementBroadcasts возвращает действующие в момент now объявления, рассылка
+// которых поставлена в очередь не всем получателям
+func (r *Repository) PendingAnnouncementBroadcasts(ctx context.Context, now time.Time) ([]models.Announcement, error) {
+	return r.queryAnnouncements(ctx, `
+		WHERE broadcast AND broadcast_done_at IS NULL
+			AND starts_at <= $1 AND (ends_at IS NULL OR ends_at > $1)
+		ORDER BY id`, now)
+}
+
+// EnqueueAnnouncementBroadcast ставит в outbox рассылку объявления следующим limit получателям:
+// пользователям с аккаунтом Telegram, согласившимся на рассылку объявлений, по возрастанию ID.
+// Сообщения формирует build. Когда получатели заканчиваются, рассылка отмечается завершенной.
+// Возвращает число получателей порции.
+func (r *Repository) EnqueueAnnouncementBroadcast(ctx context.Context, announcementID, limit int,
+	build func(userIDs []int) ([]models.OutboxMessage, error)) (int, error) {
+	var sent int
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var cursor int
+		err := tx.QueryRowContext(ctx, `
+			SELECT broadcast_cursor FROM announcements
+			WHERE id = $1 AND broadcast_done_at IS NULL
+			FOR UPDATE
+		`, announcementID).Scan(&cursor)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+			SELECT u.id FROM users u
+			JOIN notification_preferences p ON p.user_id = u.id
+			WHERE u.id > $1 AND p.announcements AND u.telegram_id IS NOT NULL AND u.deleted_at IS NULL
+			ORDER BY u.id
+			LIMIT $2
+		`, cursor, limit)
+		if err != nil {
+			return err
+		}
+		var userIDs []int
+		for rows.Next() {
+			var userID int
+			if err := rows.Scan(&userID); err != nil {
+				rows.Close()
+				return err
+			}
+			userIDs = append(userIDs, userID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(userIDs) > 0 {
+			if err := writeOutbox(ctx, tx, func() ([]models.OutboxMessage, error) { return build(userIDs) }); err != nil {
+				return err
+			}
+			cursor = userIDs[len(userIDs)-1]
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE announcements SET broadcast_cursor = $2, broadcast_count = broadcast_count + $3,
+				broadcast_done_at = CASE WHEN $4 THEN NOW() END
+			WHERE id = $1
+		`, announcementID, cursor, len(userIDs), len(userIDs) < limit)
+		sent = len(userIDs)
+		return err
+	})
+	return sent, err
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+// APIExchange - запись архива запросов к Честному ЗНАКу и СУЗ. Тела запроса и ответа
+// передаются строками; если хотя бы одно из них не в UTF-8, оба передаются в base64
+// и Encoding равно "base64". Заголовки в ответах XML не передаются.
+type APIExchange struct {
+	ID              int         `json:"id" xml:"id"`
+	System          string      `json:"system" xml:"system"`
+	SubjectType     string      `json:"subject_type,omitempty" xml:"subject_type,omitempty"`
+	SubjectID       int         `json:"subject_id,omitempty" xml:"subject_id,omitempty"`
+	Method          string      `json:"method" xml:"method"`
+	URL             string      `json:"url" xml:"url"`
+	RequestHeaders  http.Header `json:"request_headers,omitempty" xml:"-"`
+	RequestBody     string      `json:"request_body,omitempty" xml:"request_body,omitempty"`
+	StatusCode      int         `json:"status_code" xml:"status_code"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty" xml:"-"`
+	ResponseBody    string      `json:"response_body,omitempty" xml:"response_body,omitempty"`
+	Encoding        string      `json:"encoding,omitempty" xml:"encoding,omitempty"`
+	Truncated       bool        `json:"truncated" xml:"truncated"`
+	Error           string      `json:"error,omitempty" xml:"error,omitempty"`
+	DurationMS      int64       `json:"duration_ms" xml:"duration_ms"`
+	CreatedAt       time.Time   `json:"created_at" xml:"created_at"`
+}
+
+// NewAPIExchange - запрос и ответ для сохранения в архиве
+type NewAPIExchange struct {
+	System          string
+	SubjectType     string
+	SubjectID       int
+	Method          string
+	URL             string
+	RequestHeaders  http.Header
+	RequestBody     []byte
+	StatusCode      int
+	ResponseHeaders http.Header
+	ResponseBody    []byte
+	Truncated       bool
+	Error           string
+	Duration        time.Duration
+	CreatedAt       time.Time
+}
+
+// APIExchangeFilter - условия выборки архива запросов; пустые поля не ограничивают выборку
+type APIExchangeFilter struct {
+	System      string
+	SubjectType string
+	SubjectID   int
+	From        *time.Time
+	To          *time.Time
+	Limit       int
+	Offset      int
+}
+
+// InsertAPIExchange сохраняет запрос и ответ в архиве
+func (r *Repository) InsertAPIExchange(ctx context.Context, exchange NewAPIExchange) error {
+	requestHeaders, err := json.Marshal(exchange.RequestHeaders)
+	if err != nil {
+		return err
+	}
+	responseHeaders, err := json.Marshal(exchange.ResponseHeaders)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO api_exchanges (system, subject_type, subject_id, method, url, request_headers, request_body,
+			status_code, response_headers, response_body, truncated, error, duration_ms, created_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, 0), $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), $13, $14)
+	`, exchange.System, exchange.SubjectType, exchange.SubjectID, exchange.Method, exchange.URL,
+		string(requestHeaders), exchange.RequestBody, exchange.StatusCode, string(responseHeaders), exchange.ResponseBody,
+		exchange.Truncated, exchange.Error, exchange.Duration.Milliseconds(), exchange.CreatedAt.UTC())
+	return err
+}
+
+// ListAPIExchanges возвращает записи архива по фильтру, начиная с последних
+func (r *Repository) ListAPIExchanges(ctx context.Context, filter APIExchangeFilter) ([]APIExchange, error) {
+	query := `
+		SELECT id, system, COALESCE(subject_type, ''), COALESCE(subject_id, 0), method, url, request_headers,
+			request_body, status_code, response_headers, response_body, truncated, COALESCE(error, ''),
+			duration_ms, created_at
+		FROM api_exchanges
+		WHERE 1 = 1`
+	var args []any
+
+	if filter.System != "" {
+		args = append(args, filter.System)
+		query += fmt.Sprintf(" AND system = $%d", len(args))
+	}
+	if filter.SubjectType != "" {
+		args = append(args, filter.SubjectType)
+		query += fmt.Sprintf(" AND subject_type = $%d", len(args))
+	}
+	if filter.SubjectID > 0 {
+		args = append(args, filter.SubjectID)
+		query += fmt.Sprintf(" AND subject_id = $%d", len(args))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT %d OFFSET %d", filter.Limit, filter.Offset)
+
+	rows, err := r.readQuery(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exchanges := []APIExchange{}
+	for rows.Next() {
+		var exchange APIExchange
+		var requestHeaders, responseHeaders sql.NullString
+		var requestBody, responseBody []byte
+		if err := rows.Scan(&exchange.ID, &exchange.System, &exchange.SubjectType, &exchange.SubjectID,
+			&exchange.Method, &exchange.URL, &requestHeaders, &requestBody, &exchange.StatusCode,
+			&responseHeaders, &responseBody, &exchange.Truncated, &exchange.Error, &exchange.DurationMS,
+			&exchange.CreatedAt); err != nil {
+			return nil, err
+		}
+		if requestHeaders.Valid {
+			json.Unmarshal([]byte(requestHeaders.String), &exchange.RequestHeaders)
+		}
+		if responseHeaders.Valid {
+			json.Unmarshal([]byte(responseHeaders.String), &exchange.ResponseHeaders)
+		}
+		if utf8.Valid(requestBody) && utf8.Valid(responseBody) {
+			exchange.RequestBody, exchange.ResponseBody = string(requestBody), string(responseBody)
+		} else {
+			exchange.Encoding = "base64"
+			exchange.RequestBody = base64.StdEncoding.EncodeToString(requestBody)
+			exchange.ResponseBody = base64.StdEncoding.EncodeToString(responseBody)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges, rows.Err()
+}
+
+// DeleteAPIExchanges удаляет до limit записей архива, сохраненных раньше before.
+// Возвращает число удаленных записей.
+func (r *Repository) DeleteAPIExchanges(ctx context.Context, before time.Time, limit int) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM api_exchanges
+		WHERE id IN (SELECT id FROM api_exchanges WHERE created_at < $1 ORDER BY id LIMIT $2)
+	`, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+const apiKeyColumns = "id, user_id, key_hash, prefix, COALESCE(label, ''), created_at, last_used_at, expires_at, revoked_at"
+
+// ActiveAPIKey - данные действующего API ключа, достаточные для авторизации
+type ActiveAPIKey struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeyRotation - результат замены API ключа
+type APIKeyRotation struct {
+	Previous     models.APIKey  // Прежний ключ с новым сроком действия
+	PreviousHash string         // Хэш прежнего ключа для сброса кэша
+	Key          *models.APIKey // Новый ключ
+}
+
+// ActiveAPIKeyByHash возвращает действующий (не отозванный и не истекший) ключ по хэшу
+func (r *Repository) ActiveAPIKeyByHash(ctx context.Context, keyHash string) (*ActiveAPIKey, error) {
+	var key ActiveAPIKey
+	var expiresAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, expires_at FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`, keyHash).Scan(&key.ID, &key.UserID, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	key.ExpiresAt = timePtr(expiresAt)
+	return &key, nil
+}
+
+// TouchAPIKey обновляет время последнего использования ключа, адрес и User-Agent клиента
+// и время активности владельца ключа
+func (r *Repository) TouchAPIKey(ctx context.Context, keyID, userID int, at time.Time, ip, userAgent string) error {
+	if _, err := r.db.ExecContext(ctx, `
+		UPDATE api_keys SET last_used_at = $1, last_ip = NULLIF($3, ''), last_user_agent = NULLIF($4, '')
+		WHERE id = $2
+	`, at, keyID, ip, userAgent); err != nil {
+		return fmt.Errorf("ошибка обновления времени использования API ключа: %w", err)
+	}
+	if err := r.TouchUser(ctx, userID, at); err != nil {
+		return fmt.Errorf("ошибка обновления времени активности: %w", err)
+	}
+	return nil
+}
+
+// CreateAPIKey сохраняет API ключ по его хэшу и заполняет ID и время создания
+func (r *Repository) CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error {
+	return insertAPIKey(ctx, r.db, key, keyHash)
+}
+
+func insertAPIKey(ctx context.Context, q QueryRower, key *models.APIKey, keyHash string) error {
+	err := q.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, key_hash, prefix, label, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		RETURNING id, created_at
+	`, key.UserID, keyHash, key.Prefix, key.Label, key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения API ключа: %w", err)
+	}
+	return nil
+}
+
+// HasActiveAPIKey проверяет наличие у пользователя действующих API ключей
+func (r *Repository) HasActiveAPIKey(ctx context.Context, userID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM api_keys
+			WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		)
+	`, userID).Scan(&exists)
+	return exists, err
+}
+
+// Чтение API ключа из строки результата запроса
+func scanAPIKey(scan func(dest ...any) error) (models.APIKey, string, error) {
+	var key models.APIKey
+	var keyHash string
+	var lastUsedAt, expiresAt, revokedAt sql.NullTime
+	err := scan(&key.ID, &key.UserID, &keyHash, &key.Prefix, &key.Label, &key.CreatedAt, &lastUsedAt, &expiresAt, &revokedAt)
+	key.LastUsedAt = timePtr(lastUsedAt)
+	key.ExpiresAt = timePtr(expiresAt)
+	key.RevokedAt = timePtr(revokedAt)
+	return key, keyHash, err
+}
+
+// ListAPIKeys возвращает ключи пользователя, включая отозванные и истекшие
+func (r *Repository) ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, _, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RotateAPIKey сокращает срок действия действующего ключа до now+overlap и сохраняет
+// новый ключ с тем же названием. Новый ключ передается уже заполненным, кроме названия.
+func (r *Repository) RotateAPIKey(ctx context.Context, userID, keyID int, overlap time.Duration, next *models.APIKey, nextHash string) (*APIKeyRotation, error) {
+	rotation := &APIKeyRotation{Key: next}
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		rotation.Previous, rotation.PreviousHash, err = scanAPIKey(tx.QueryRowContext(ctx,
+			"SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1 AND user_id = $2 FOR UPDATE",
+			keyID, userID,
+		).Scan)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if !rotation.Previous.IsActive(now) {
+			return ErrAPIKeyInactive
+		}
+
+		// Срок действия прежнего ключа только сокращается
+		expiresAt := now.Add(overlap)
+		if rotation.Previous.ExpiresAt == nil || expiresAt.Before(*rotation.Previous.ExpiresAt) {
+			if _, err := tx.ExecContext(ctx, "UPDATE api_keys SET expires_at = $1 WHERE id = $2", expiresAt, keyID); err != nil {
+				return fmt.Errorf("ошибка изменения срока действия ключа: %w", err)
+			}
+			rotation.Previous.ExpiresAt = &expiresAt
+		}
+
+		next.UserID = userID
+		next.Label = rotation.Previous.Label
+		return insertAPIKey(ctx, tx, next, nextHash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rotation, nil
+}
+
+// RevokeAPIKey отзывает ключ пользователя и возвращает его вместе с хэшем.
+// Повторный отзыв не меняет время отзыва.
+func (r *Repository) RevokeAPIKey(ctx context.Context, userID, keyID int) (*models.APIKey, string, error) {
+	key := models.APIKey{UserID: userID}
+	var keyHash string
+	var revokedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1 AND user_id = $2
+		RETURNING id, key_hash, prefix, COALESCE(label, ''), revoked_at
+	`, keyID, userID).Scan(&key.ID, &keyHash, &key.Prefix, &key.Label, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+	key.RevokedAt = timePtr(revokedAt)
+	return &key, keyHash, nil
+}
+
+// Sessions возвращает действующие API ключи пользователя с устройством, с которого
+// каждый ключ использовался последним
+func (r *Repository) Sessions(ctx context.Context, userID int) ([]models.Session, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, prefix, COALESCE(label, ''), COALESCE(last_ip, ''), COALESCE(last_user_agent, ''),
+			last_used_at, created_at, expires_at
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY last_used_at DESC NULLS LAST, id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		var lastSeenAt, expiresAt sql.NullTime
+		if err := rows.Scan(&session.ID, &session.Prefix, &session.Label, &session.IP, &session.UserAgent,
+			&lastSeenAt, &session.CreatedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		session.LastSeenAt = timePtr(lastSeenAt)
+		session.ExpiresAt = timePtr(expiresAt)
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeOtherAPIKeys отзывает все действующие ключи пользователя, кроме exceptID,
+// и возвращает ID и хэши отозванных ключей
+func (r *Repository) RevokeOtherAPIKeys(ctx context.Context, userID, exceptID int, at time.Time) ([]int, []string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE api_keys SET revoked_at = $3
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $3)
+		RETURNING id, key_hash
+	`, userID, exceptID, at)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var keyIDs []int
+	var keyHashes []string
+	for rows.Next() {
+		var keyID int
+		var keyHash string
+		if err := rows.Scan(&keyID, &keyHash); err != nil {
+			return nil, nil, err
+		}
+		keyIDs = append(keyIDs, keyID)
+		keyHashes = append(keyHashes, keyHash)
+	}
+	return keyIDs, keyHashes, rows.Err()
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditEntry - запись журнала аудита
+type AuditEntry struct {
+	ID             int             `json:"id" xml:"id"`
+	ActorUserID    int             `json:"actor_user_id,omitempty" xml:"actor_user_id,omitempty"`
+	TelegramID     int64           `json:"telegram_id,omitempty" xml:"telegram_id,omitempty"`
+	Action         string          `json:"action" xml:"action"`
+	EntityType     string          `json:"entity_type" xml:"entity_type"`
+	EntityID       string          `json:"entity_id" xml:"entity_id"`
+	IP             string          `json:"ip,omitempty" xml:"ip,omitempty"`
+	ImpersonatorID int             `json:"impersonator_id,omitempty" xml:"impersonator_id,omitempty"` // Администратор, действовавший от имени ActorUserID
+	Before         json.RawMessage `json:"before,omitempty" xml:"before,omitempty"`
+	After          json.RawMessage `json:"after,omitempty" xml:"after,omitempty"`
+	CreatedAt      time.Time       `json:"created_at" xml:"created_at"`
+}
+
+// AuditFilter - условия выборки журнала аудита; пустые поля не ограничивают выборку
+type AuditFilter struct {
+	ActorUserID    string
+	TelegramID     string
+	Action         string
+	EntityType     string
+	EntityID       string
+	ImpersonatorID string
+	From           *time.Time
+	To             *time.Time
+	Limit          int
+	Offset         int
+}
+
+// InsertAudit добавляет запись в журнал аудита. Значения before и after
+// передаются в JSON; nil сохраняется как NULL.
+func (r *Repository) InsertAudit(ctx context.Context, entry AuditEntry) error {
+	var before, after []byte
+	if len(entry.Before) > 0 {
+		before = entry.Before
+	}
+	if len(entry.After) > 0 {
+		after = entry.After
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO audit_log (actor_user_id, telegram_id, action, entity_type, entity_id, ip, before_data, after_data,
+			impersonator_id)
+		VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, $4, $5, NULLIF($6, ''), $7, $8, NULLIF($9, 0))
+	`, entry.ActorUserID, entry.TelegramID, entry.Action, entry.EntityType, entry.EntityID, entry.IP, before, after,
+		entry.ImpersonatorID)
+	return err
+}
+
+// ListAudit возвращает записи журнала аудита по фильтру, начиная с последних
+func (r *Repository) ListAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	query := `
+		SELECT id, COALESCE(actor_user_id, 0), COALESCE(telegram_id, 0), action, entity_type, entity_id,
+			COALESCE(ip, ''), COALESCE(impersonator_id, 0), before_data, after_data, created_at
+		FROM audit_log
+		WHERE 1 = 1`
+	var args []any
+
+	for _, f := range []struct {
+		value  string
+		column string
+	}{
+		{filter.ActorUserID, "actor_user_id"},
+		{filter.TelegramID, "telegram_id"},
+		{filter.Action, "action"},
+		{filter.EntityType, "entity_type"},
+		{filter.EntityID, "entity_id"},
+		{filter.ImpersonatorID, "impersonator_id"},
+	} {
+		if f.value != "" {
+			args = append(args, f.value)
+			query += fmt.Sprintf(" AND %s = $%d", f.column, len(args))
+		}
+	}
+
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT %d OFFSET %d", filter.Limit, filter.Offset)
+
+	rows, err := r.readQuery(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&entry.ID, &entry.ActorUserID, &entry.TelegramID, &entry.Action,
+			&entry.EntityType, &entry.EntityID, &entry.IP, &entry.ImpersonatorID, &before, &after, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.Before = before
+		entry.After = after
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+const authFailureColumns = "scope, ip, failures, lockouts, window_start, locked_until"
+
+func scanAuthFailure(scan func(dest ...any) error, failure *models.AuthFailure) error {
+	var lockedUntil sql.NullTime
+	if err := scan(&failure.Scope, &failure.IP, &failure.Failures, &failure.Lockouts, &failure.WindowStart,
+		&lockedUntil); err != nil {
+		return err
+	}
+	failure.LockedUntil = timePtr(lockedUntil)
+	return nil
+}
+
+// AuthLockedUntil возвращает время окончания блокировки адреса или nil, если адрес
+// не заблокирован в момент now
+func (r *Repository) AuthLockedUntil(ctx context.Context, scope, ip string, now time.Time) (*time.Time, error) {
+	var lockedUntil time.Time
+	err := r.db.QueryRowContext(ctx,
+		"SELECT locked_until FROM auth_failures WHERE scope = $1 AND ip = $2 AND locked_until > $3",
+		scope, ip, now).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &lockedUntil, nil
+}
+
+// UpdateAuthFailure блокирует счетчик попыток адреса, создавая его с началом окна now,
+// передает его в update и сохраняет изменения
+func (r *Repository) UpdateAuthFailure(ctx context.Context, scope, ip string, now time.Time,
+	update func(*models.AuthFailure)) (*models.AuthFailure, error) {
+	var failure models.AuthFailure
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO auth_failures (scope, ip, window_start) VALUES ($1, $2, $3)
+			ON CONFLICT (scope, ip) DO NOTHING
+		`, scope, ip, now); err != nil {
+			return err
+		}
+		if err := scanAuthFailure(tx.QueryRowContext(ctx,
+			"SELECT "+authFailureColumns+" FROM auth_failures WHERE scope = $1 AND ip = $2 FOR UPDATE",
+			scope, ip).Scan, &failure); err != nil {
+			return err
+		}
+
+		update(&failure)
+
+		_, err := tx.ExecContext(ctx, `
+			UPDATE auth_failures SET failures = $3, lockouts = $4, window_start = $5, locked_until = $6
+			WHERE scope = $1 AND ip = $2
+		`, scope, ip, failure.Failures, failure.Lockouts, failure.WindowStart, failure.LockedUntil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &failure, nil
+}
+
+// AuthLockouts возвращает адреса, заблокированные в момент now
+func (r *Repository) AuthLockouts(ctx context.Context, now time.Time) ([]models.AuthFailure, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+authFailureColumns+` FROM auth_failures
+		WHERE locked_until > $1
+		ORDER BY locked_until DESC
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockouts := []models.AuthFailure{}
+	for rows.Next() {
+		var failure models.AuthFailure
+		if err := scanAuthFailure(rows.Scan, &failure); err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, failure)
+	}
+	return lockouts, rows.Err()
+}
+
+// DeleteAuthFailures удаляет счетчики и блокировки адреса. Возвращает ErrNotFound,
+// если счетчиков нет.
+func (r *Repository) DeleteAuthFailures(ctx context.Context, ip string) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM auth_failures WHERE ip = $1", ip)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
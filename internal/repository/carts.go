@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+// Cart возвращает сохраненные позиции корзины пользователя. Если корзины нет,
+// возвращается ErrNotFound.
+func (r *Repository) Cart(ctx context.Context, userID int) (*models.Cart, error) {
+	cart := models.Cart{UserID: userID}
+	var items []byte
+	var updatedAt time.Time
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(organization_id, 0), COALESCE(product_group, ''), items, updated_at
+		FROM carts
+		WHERE user_id = $1
+	`, userID).Scan(&cart.OrganizationID, &cart.ProductGroup, &items, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(items, &cart.Lines); err != nil {
+		return nil, fmt.Errorf("ошибка разбора позиций корзины: %w", err)
+	}
+	cart.UpdatedAt = &updatedAt
+	return &cart, nil
+}
+
+// SaveCart сохраняет позиции корзины пользователя и заполняет время изменения
+func (r *Repository) SaveCart(ctx context.Context, cart *models.Cart) error {
+	items, err := json.Marshal(cart.Lines)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации позиций корзины: %w", err)
+	}
+
+	var updatedAt time.Time
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO carts (user_id, organization_id, product_group, items)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET organization_id = EXCLUDED.organization_id,
+			product_group = EXCLUDED.product_group,
+			items = EXCLUDED.items,
+			updated_at = NOW()
+		RETURNING updated_at
+	`, cart.UserID, cart.OrganizationID, cart.ProductGroup, items).Scan(&updatedAt); err != nil {
+		return err
+	}
+	cart.UpdatedAt = &updatedAt
+	return nil
+}
+
+// DeleteCart удаляет корзину пользователя; отсутствие корзины не считается ошибкой
+func (r *Repository) DeleteCart(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM carts WHERE user_id = $1", userID)
+	return err
+}
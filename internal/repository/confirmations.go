@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"project-znak/internal/models"
+)
+
+const confirmationColumns = `id, user_id, action, subject, description, status, attempts, expires_at,
+	approved_at, used_at, created_at`
+
+func scanConfirmation(scan func(dest ...any) error, confirmation *models.Confirmation, extra ...any) error {
+	var approvedAt, usedAt sql.NullTime
+	dest := []any{&confirmation.ID, &confirmation.UserID, &confirmation.Action, &confirmation.Subject,
+		&confirmation.Description, &confirmation.Status, &confirmation.Attempts, &confirmation.ExpiresAt,
+		&approvedAt, &usedAt, &confirmation.CreatedAt}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	confirmation.ApprovedAt = timePtr(approvedAt)
+	confirmation.UsedAt = timePtr(usedAt)
+	return nil
+}
+
+// CreateConfirmation сохраняет ожидающее подтверждение операции в одной транзакции
+// с сообщением outbox, содержащим код
+func (r *Repository) CreateConfirmation(ctx context.Context, confirmation *models.Confirmation, codeHash string,
+	outbox func(*models.Confirmation) ([]models.OutboxMessage, error)) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO confirmations (user_id, action, subject, description, code_hash, status, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, created_at
+		`, confirmation.UserID, confirmation.Action, confirmation.Subject, confirmation.Description, codeHash,
+			confirmation.Status, confirmation.ExpiresAt).Scan(&confirmation.ID, &confirmation.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return writeOutbox(ctx, tx, func() ([]models.OutboxMessage, error) { return outbox(confirmation) })
+	})
+}
+
+// Confirmation возвращает подтверждение операции пользователя
+func (r *Repository) Confirmation(ctx context.Context, id, userID int) (*models.Confirmation, error) {
+	var confirmation models.Confirmation
+	err := scanConfirmation(r.db.QueryRowContext(ctx,
+		"SELECT "+confirmationColumns+" FROM confirmations WHERE id = $1 AND user_id = $2",
+		id, userID).Scan, &confirmation)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &confirmation, nil
+}
+
+// UpdateConfirmation блокирует подтверждение пользователя, передает его вместе с хэшем кода
+// в update и сохраняет измененные update статус, число попыток и время подтверждения
+// и использования. Возвращает ErrNotFound, если подтверждения нет.
+func (r *Repository) UpdateConfirmation(ctx context.Context, id, userID int,
+	update func(confirmation *models.Confirmation, codeHash string)) (*models.Confirmation, error) {
+	var confirmation models.Confirmation
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var codeHash string
+		err := scanConfirmation(tx.QueryRowContext(ctx,
+			"SELECT "+confirmationColumns+", code_hash FROM confirmations WHERE id = $1 AND user_id = $2 FOR UPDATE",
+			id, userID).Scan, &confirmation, &codeHash)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		update(&confirmation, codeHash)
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE confirmations SET status = $2, attempts = $3, approved_at = $4, used_at = $5
+			WHERE id = $1
+		`, confirmation.ID, confirmation.Status, confirmation.Attempts, confirmation.ApprovedAt, confirmation.UsedAt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &confirmation, nil
+}
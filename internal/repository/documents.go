@@ -0,0 +1,325 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+const documentColumns = `id, order_id, COALESCE(organization_id, 0), user_id, participant_inn,
+	COALESCE(product_group, ''), production_type,
+	production_date, COALESCE(declaration_number, ''), declaration_date, codes, status,
+	COALESCE(external_id, ''), COALESCE(error, ''), COALESCE(ticket, ''), created_at, submitted_at,
+	processed_at, updated_at`
+
+// DocumentResult - результат обработки документа в Честном ЗНАКе
+type DocumentResult struct {
+	Status  string
+	Error   string
+	Ticket  string
+	Receipt *DocumentReceipt // Сохраненная подписанная квитанция; nil - не получена
+}
+
+// Условие доступа к документу ($2 - ID пользователя): заказ документа доступен пользователю
+const documentAccessCondition = `order_id IN (SELECT id FROM orders WHERE ` + orderAccessCondition + `)`
+
+// Чтение документа ввода в оборот из строки результата запроса
+func scanIntroductionDocument(scan func(dest ...any) error, doc *models.IntroductionDocument) error {
+	var codes []byte
+	var declarationDate, submittedAt, processedAt sql.NullTime
+	if err := scan(&doc.ID, &doc.OrderID, &doc.OrganizationID, &doc.UserID, &doc.ParticipantINN,
+		&doc.ProductGroup, &doc.ProductionType,
+		&doc.ProductionDate, &doc.DeclarationNumber, &declarationDate, &codes, &doc.Status,
+		&doc.ExternalID, &doc.Error, &doc.Ticket, &doc.CreatedAt, &submittedAt,
+		&processedAt, &doc.UpdatedAt); err != nil {
+		return err
+	}
+
+	doc.DeclarationDate = timePtr(declarationDate)
+	doc.SubmittedAt = timePtr(submittedAt)
+	doc.ProcessedAt = timePtr(processedAt)
+	if err := json.Unmarshal(codes, &doc.Codes); err != nil {
+		return fmt.Errorf("ошибка чтения кодов документа: %w", err)
+	}
+	return nil
+}
+
+// OrderParticipant возвращает ИНН и организацию участника оборота и товарную группу
+// по заказу, доступному пользователю: ИНН организации заказа, а для личного заказа -
+// ИНН автора заказа
+func (r *Repository) OrderParticipant(ctx context.Context, orderID, userID int) (string, int, string, error) {
+	var inn, productGroup string
+	var organizationID int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(org.inn, u.inn), COALESCE(o.organization_id, 0), COALESCE(o.product_group, '')
+		FROM orders o
+		JOIN users u ON u.id = o.user_id
+		LEFT JOIN organizations org ON org.id = o.organization_id
+		WHERE o.id = $1 AND o.id IN (SELECT id FROM orders WHERE `+orderAccessCondition+`)
+	`, orderID, userID).Scan(&inn, &organizationID, &productGroup)
+	if err == sql.ErrNoRows {
+		return "", 0, "", ErrNotFound
+	}
+	return inn, organizationID, productGroup, err
+}
+
+// OrderKIZCodes возвращает коды маркировки, полученные по неотмененным запросам КИЗ заказа
+func (r *Repository) OrderKIZCodes(ctx context.Context, orderID int) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT res.kiz_data
+		FROM kiz_requests req
+		JOIN kiz_results res ON res.request_id = req.id
+		WHERE req.order_id = $1 AND req.status <> 'cancelled' AND res.kiz_data IS NOT NULL
+		ORDER BY res.id
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var kizs []string
+		if err := json.Unmarshal(data, &kizs); err != nil {
+			return nil, fmt.Errorf("ошибка чтения кодов маркировки: %w", err)
+		}
+		codes = append(codes, kizs...)
+	}
+
+	return codes, rows.Err()
+}
+
+// CreateIntroductionDocument сохраняет черновик документа ввода в оборот. Для заказа
+// допускается один документ, не отклоненный Честным ЗНАКом.
+func (r *Repository) CreateIntroductionDocument(ctx context.Context, doc *models.IntroductionDocument) error {
+	codes, err := json.Marshal(doc.Codes)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации кодов: %w", err)
+	}
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		// Блокировка заказа исключает одновременное создание двух документов
+		if _, err := tx.ExecContext(ctx, "SELECT 1 FROM orders WHERE id = $1 FOR UPDATE", doc.OrderID); err != nil {
+			return fmt.Errorf("ошибка блокировки заказа: %w", err)
+		}
+
+		var exists bool
+		if err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS(SELECT 1 FROM introduction_documents WHERE order_id = $1 AND status <> $2)",
+			doc.OrderID, models.DocumentStatusRejected,
+		).Scan(&exists); err != nil {
+			return fmt.Errorf("ошибка проверки документов заказа: %w", err)
+		}
+		if exists {
+			return ErrDocumentExists
+		}
+
+		return tx.QueryRowContext(ctx, `
+			INSERT INTO introduction_documents (order_id, organization_id, user_id, participant_inn, product_group,
+				production_type, production_date, declaration_number, declaration_date, codes, status)
+			VALUES ($1, NULLIF($2, 0), $3, $4, NULLIF($5, ''), $6, $7, NULLIF($8, ''), $9, $10, $11)
+			RETURNING id, created_at, updated_at
+		`, doc.OrderID, doc.OrganizationID, doc.UserID, doc.ParticipantINN, doc.ProductGroup,
+			doc.ProductionType, doc.ProductionDate, doc.DeclarationNumber, doc.DeclarationDate, codes, doc.Status,
+		).Scan(&doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
+	})
+}
+
+// IntroductionDocument возвращает документ ввода в оборот, доступный пользователю
+func (r *Repository) IntroductionDocument(ctx context.Context, documentID, userID int) (*models.IntroductionDocument, error) {
+	var doc models.IntroductionDocument
+	err := scanIntroductionDocument(r.db.QueryRowContext(ctx,
+		"SELECT "+documentColumns+" FROM introduction_documents WHERE id = $1 AND "+documentAccessCondition,
+		documentID, userID,
+	).Scan, &doc)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ListIntroductionDocuments возвращает документы ввода в оборот, доступные пользователю,
+// начиная с последних. Если указан заказ, выбираются только его документы.
+func (r *Repository) ListIntroductionDocuments(ctx context.Context, userID, orderID, limit int) ([]models.IntroductionDocument, error) {
+	query := "SELECT " + documentColumns + " FROM introduction_documents WHERE ($1 = 0 OR order_id = $1) AND " +
+		documentAccessCondition + " ORDER BY created_at DESC LIMIT $3"
+
+	rows, err := r.db.QueryContext(ctx, query, orderID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.IntroductionDocument{}
+	for rows.Next() {
+		var doc models.IntroductionDocument
+		if err := scanIntroductionDocument(rows.Scan, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, rows.Err()
+}
+
+// DocumentOrganizationID возвращает организацию документа; 0, если документ личный или не найден
+func (r *Repository) DocumentOrganizationID(ctx context.Context, documentID int) (int, error) {
+	var organizationID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, "SELECT organization_id FROM introduction_documents WHERE id = $1", documentID).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return int(organizationID.Int64), err
+}
+
+// BeginDocumentSubmission переводит черновик в статус отправленного, чтобы документ
+// не был отправлен повторно параллельным запросом
+func (r *Repository) BeginDocumentSubmission(ctx context.Context, documentID int) error {
+	return r.beginSubmission(ctx, "introduction_documents", documentID)
+}
+
+// CancelDocumentSubmission возвращает документ в черновики после неудачной отправки
+func (r *Repository) CancelDocumentSubmission(ctx context.Context, documentID int) error {
+	return r.cancelSubmission(ctx, "introduction_documents", documentID)
+}
+
+// SetDocumentExternalID сохраняет идентификатор отправленного документа в Честном ЗНАКе
+func (r *Repository) SetDocumentExternalID(ctx context.Context, documentID int, externalID string) error {
+	return r.setExternalID(ctx, "introduction_documents", documentID, externalID)
+}
+
+// UpdateDocumentStatus сохраняет результат обработки отправленного документа в Честном ЗНАКе.
+// Заказ принятого документа считается выполненным; уведомления messages записываются
+// в outbox в той же транзакции. Возвращает false, если результат уже был сохранен ранее.
+func (r *Repository) UpdateDocumentStatus(ctx context.Context, documentID int, result DocumentResult,
+	messages []models.OutboxMessage) (bool, error) {
+	var updated bool
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		if updated, err = updateSubmissionStatus(ctx, tx, "introduction_documents", documentID, result); err != nil || !updated {
+			return err
+		}
+		if err := insertOutbox(ctx, tx, messages); err != nil {
+			return err
+		}
+		if result.Status != models.DocumentStatusAccepted {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE orders SET status = $1, updated_at = NOW(), version = version + 1
+			WHERE id = (SELECT order_id FROM introduction_documents WHERE id = $2) AND status NOT IN ($1, $3, $4)
+		`, models.OrderStatusCompleted, documentID, models.OrderStatusCancelled, models.OrderStatusRefunded); err != nil {
+			return fmt.Errorf("ошибка обновления заказа: %w", err)
+		}
+		return nil
+	})
+	return updated, err
+}
+
+// PostponeDocumentCheck откладывает следующую проверку статуса документа
+func (r *Repository) PostponeDocumentCheck(ctx context.Context, documentID int, base, max time.Duration) error {
+	return r.postponeStatusCheck(ctx, "introduction_documents", documentID, base, max)
+}
+
+// Общие операции отправки для таблиц документов Честного ЗНАКа. Имя таблицы
+// передается только из констант репозитория.
+
+// Перевод черновика в статус отправленного
+func (r *Repository) beginSubmission(ctx context.Context, table string, documentID int) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE `+table+` SET status = $1, submitted_at = NOW(), updated_at = NOW()
+		WHERE id = $2 AND status = $3
+	`, models.DocumentStatusSubmitted, documentID, models.DocumentStatusDraft)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrDocumentNotDraft
+	}
+	return nil
+}
+
+// Возврат в черновики документа, не принятого к отправке
+func (r *Repository) cancelSubmission(ctx context.Context, table string, documentID int) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE `+table+` SET status = $1, submitted_at = NULL, updated_at = NOW()
+		WHERE id = $2 AND status = $3 AND external_id IS NULL
+	`, models.DocumentStatusDraft, documentID, models.DocumentStatusSubmitted)
+	return err
+}
+
+// Сохранение идентификатора документа в Честном ЗНАКе
+func (r *Repository) setExternalID(ctx context.Context, table string, documentID int, externalID string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE "+table+" SET external_id = $1, updated_at = NOW() WHERE id = $2",
+		externalID, documentID,
+	)
+	return err
+}
+
+// Сохранение результата обработки отправленного документа
+func updateSubmissionStatus(ctx context.Context, tx *sql.Tx, table string, documentID int, result DocumentResult) (bool, error) {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE `+table+` SET status = $1, error = NULLIF($2, ''), ticket = NULLIF($3, ''),
+			processed_at = NOW(), next_status_check_at = NULL, updated_at = NOW()
+		WHERE id = $4 AND status = $5
+	`, result.Status, result.Error, result.Ticket, documentID, models.DocumentStatusSubmitted)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows > 0, err
+}
+
+// Перенос следующей проверки статуса документа, который еще обрабатывается. Интервал
+// удваивается с каждой проверкой, начиная с base, но не превышает max.
+func (r *Repository) postponeStatusCheck(ctx context.Context, table string, documentID int, base, max time.Duration) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE `+table+` SET status_checks = status_checks + 1,
+			next_status_check_at = NOW() + make_interval(secs => LEAST($2 * power(2, LEAST(status_checks, 20)), $3))
+		WHERE id = $1
+	`, documentID, base.Seconds(), max.Seconds())
+	return err
+}
+
+// Условие выбора отправленных документов ($1 - статус отправленного документа),
+// для которых наступило время проверки статуса
+const pendingCondition = `status = $1 AND external_id IS NOT NULL
+	AND (next_status_check_at IS NULL OR next_status_check_at <= NOW())`
+
+// PendingIntroductionDocuments возвращает отправленные документы, для которых наступило
+// время проверки результата обработки
+func (r *Repository) PendingIntroductionDocuments(ctx context.Context, limit int) ([]models.IntroductionDocument, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+documentColumns+" FROM introduction_documents WHERE "+pendingCondition+" ORDER BY submitted_at LIMIT $2",
+		models.DocumentStatusSubmitted, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []models.IntroductionDocument
+	for rows.Next() {
+		var doc models.IntroductionDocument
+		if err := scanIntroductionDocument(rows.Scan, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, rows.Err()
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+// Данные обмена: данные организации или, без организации, пользователя.
+// Параметры: $1 - пользователь, $2 - организация (0 - данные пользователя).
+const exchangeScopeCondition = `(CASE WHEN $2 > 0 THEN organization_id = $2 ELSE user_id = $1 END)`
+
+// ExchangeFilter - условия выборки данных для обмена с 1С за период [From, To).
+// Если указана организация, выбираются ее данные, иначе - данные пользователя.
+type ExchangeFilter struct {
+	UserID         int
+	OrganizationID int
+	From           time.Time
+	To             time.Time
+	Limit          int
+}
+
+// ExchangeCode - выданный код маркировки с заказом, по которому он получен
+type ExchangeCode struct {
+	models.KIZCode
+	OrderID int
+}
+
+// ExchangeOrders возвращает заказы за период вместе с позициями
+func (r *Repository) ExchangeOrders(ctx context.Context, filter ExchangeFilter) ([]models.Order, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE `+exchangeScopeCondition+` AND created_at >= $3 AND created_at < $4
+		ORDER BY created_at, id
+		LIMIT $5
+	`, filter.UserID, filter.OrganizationID, filter.From, filter.To, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	index := make(map[int]int)
+	var ids []int
+	for rows.Next() {
+		var order models.Order
+		if err := scanOrder(rows.Scan, &order); err != nil {
+			return nil, err
+		}
+		order.Items = []models.OrderItem{}
+		index[order.ID] = len(orders)
+		ids = append(ids, order.ID)
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return orders, nil
+	}
+
+	itemRows, err := r.db.QueryContext(ctx, `
+		SELECT order_id, id, gtin, quantity, COALESCE(price, 0), COALESCE(product_name, ''), COALESCE(product_group, '')
+		FROM order_items
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, id
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса позиций заказов: %w", err)
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var orderID int
+		var item models.OrderItem
+		if err := itemRows.Scan(&orderID, &item.ID, &item.GTIN, &item.Quantity, &item.Price,
+			&item.ProductName, &item.ProductGroup); err != nil {
+			return nil, fmt.Errorf("ошибка чтения позиции заказа: %w", err)
+		}
+		order := &orders[index[orderID]]
+		order.Items = append(order.Items, item)
+	}
+	return orders, itemRows.Err()
+}
+
+// ExchangePayments возвращает платежи за период
+func (r *Repository) ExchangePayments(ctx context.Context, filter ExchangeFilter) ([]models.Payment, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+paymentColumns+`
+		FROM payments p
+		WHERE `+exchangeScopeCondition+` AND p.created_at >= $3 AND p.created_at < $4
+		ORDER BY p.created_at, p.id
+		LIMIT $5
+	`, filter.UserID, filter.OrganizationID, filter.From, filter.To, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []models.Payment{}
+	for rows.Next() {
+		var payment models.Payment
+		if err := scanPayment(rows.Scan, &payment); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// ExchangeCodes возвращает коды маркировки, выданные за период
+func (r *Repository) ExchangeCodes(ctx context.Context, filter ExchangeFilter) ([]ExchangeCode, error) {
+	return r.queryExchangeCodes(ctx, `
+		SELECT kc.code, kc.gtin, kc.request_id, kc.status, kc.created_at, COALESCE(req.order_id, 0)
+		FROM kiz_codes kc
+		JOIN kiz_requests req ON req.id = kc.request_id
+		WHERE `+inventoryScopeCondition+`
+		  AND kc.created_at >= $3 AND kc.created_at < $4
+		ORDER BY kc.id
+		LIMIT $5
+	`, filter.UserID, filter.OrganizationID, filter.From, filter.To, filter.Limit)
+}
+
+// OrderCodes возвращает коды маркировки, выданные по запросам КИЗ указанных заказов
+func (r *Repository) OrderCodes(ctx context.Context, orderIDs []int) ([]ExchangeCode, error) {
+	return r.queryExchangeCodes(ctx, `
+		SELECT kc.code, kc.gtin, kc.request_id, kc.status, kc.created_at, req.order_id
+		FROM kiz_codes kc
+		JOIN kiz_requests req ON req.id = kc.request_id
+		WHERE req.order_id = ANY($1)
+		ORDER BY kc.id
+	`, orderIDs)
+}
+
+func (r *Repository) queryExchangeCodes(ctx context.Context, query string, args ...any) ([]ExchangeCode, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := []ExchangeCode{}
+	for rows.Next() {
+		var code ExchangeCode
+		if err := rows.Scan(&code.Code, &code.GTIN, &code.RequestID, &code.Status, &code.CreatedAt, &code.OrderID); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+const dataExportColumns = "id, user_id, status, COALESCE(error, ''), created_at, completed_at, COALESCE(file_path, '')"
+
+func scanDataExport(scan func(dest ...any) error, export *models.DataExport) error {
+	var completedAt sql.NullTime
+	if err := scan(&export.ID, &export.UserID, &export.Status, &export.Error, &export.CreatedAt,
+		&completedAt, &export.FilePath); err != nil {
+		return err
+	}
+	export.CompletedAt = timePtr(completedAt)
+	return nil
+}
+
+// CreateDataExport создает запрос на выгрузку данных пользователя
+func (r *Repository) CreateDataExport(ctx context.Context, userID int) (*models.DataExport, error) {
+	var export models.DataExport
+	err := scanDataExport(r.db.QueryRowContext(ctx, `
+		INSERT INTO data_exports (user_id, status) VALUES ($1, $2)
+		RETURNING `+dataExportColumns,
+		userID, models.DataExportStatusPending,
+	).Scan, &export)
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// LatestDataExport возвращает последнюю выгрузку данных пользователя
+func (r *Repository) LatestDataExport(ctx context.Context, userID int) (*models.DataExport, error) {
+	var export models.DataExport
+	err := scanDataExport(r.db.QueryRowContext(ctx,
+		"SELECT "+dataExportColumns+" FROM data_exports WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT 1",
+		userID,
+	).Scan, &export)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// CompleteDataExport сохраняет путь к готовому архиву
+func (r *Repository) CompleteDataExport(ctx context.Context, exportID int, filePath string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE data_exports SET status = $2, file_path = $3, completed_at = $4 WHERE id = $1",
+		exportID, models.DataExportStatusReady, filePath, at,
+	)
+	return err
+}
+
+// FailDataExport фиксирует ошибку формирования архива
+func (r *Repository) FailDataExport(ctx context.Context, exportID int, message string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE data_exports SET status = $2, error = $3, completed_at = $4 WHERE id = $1",
+		exportID, models.DataExportStatusFailed, message, at,
+	)
+	return err
+}
+
+// UserPayments возвращает платежи пользователя, начиная с последних
+func (r *Repository) UserPayments(ctx context.Context, userID, limit int) ([]models.Payment, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+paymentColumns+`
+		FROM payments p
+		WHERE p.user_id = $1
+		ORDER BY p.created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []models.Payment{}
+	for rows.Next() {
+		var payment models.Payment
+		if err := scanPayment(rows.Scan, &payment); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+)
+
+// FiscalPayment - данные платежа для формирования кассового чека
+type FiscalPayment struct {
+	Amount money.Money
+	Email  string
+	Items  []models.OrderItem // Позиции оплаченного заказа; пусто для платежа без заказа
+}
+
+const fiscalReceiptColumns = `f.id, f.payment_id, f.provider, f.status, f.attempts, COALESCE(f.error, ''),
+	COALESCE(f.fiscal_document_number, ''), COALESCE(f.fiscal_document_attribute, ''), COALESCE(f.fn_number, ''),
+	COALESCE(f.receipt_number, ''), COALESCE(f.shift_number, ''), COALESCE(f.registration_number, ''),
+	COALESCE(f.fns_site, ''), f.registered_at, f.created_at, COALESCE(f.external_id, ''), COALESCE(f.provider_id, '')`
+
+func scanFiscalReceipt(scan func(dest ...any) error, receipt *models.FiscalReceipt) error {
+	var registeredAt sql.NullTime
+	if err := scan(&receipt.ID, &receipt.PaymentID, &receipt.Provider, &receipt.Status, &receipt.Attempts,
+		&receipt.Error, &receipt.FiscalDocumentNumber, &receipt.FiscalDocumentAttribute, &receipt.FNNumber,
+		&receipt.ReceiptNumber, &receipt.ShiftNumber, &receipt.RegistrationNumber, &receipt.FNSSite,
+		&registeredAt, &receipt.CreatedAt, &receipt.ExternalID, &receipt.ProviderID); err != nil {
+		return err
+	}
+	receipt.RegisteredAt = timePtr(registeredAt)
+	return nil
+}
+
+// Выборка чеков по условию
+func (r *Repository) queryFiscalReceipts(ctx context.Context, query string, args ...any) ([]models.FiscalReceipt, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+fiscalReceiptColumns+" FROM fiscal_receipts f "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipts := []models.FiscalReceipt{}
+	for rows.Next() {
+		var receipt models.FiscalReceipt
+		if err := scanFiscalReceipt(rows.Scan, &receipt); err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, rows.Err()
+}
+
+// CreateFiscalReceipt ставит чек по проведенному платежу в очередь на регистрацию.
+// Повторный вызов для того же платежа не меняет данных.
+func (r *Repository) CreateFiscalReceipt(ctx context.Context, paymentID int, provider string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO fiscal_receipts (payment_id, provider, status)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (payment_id) DO NOTHING
+	`, paymentID, provider, models.FiscalStatusPending)
+	return err
+}
+
+// DueFiscalReceipts возвращает незарегистрированные чеки, для которых наступило время попытки
+func (r *Repository) DueFiscalReceipts(ctx context.Context, limit int) ([]models.FiscalReceipt, error) {
+	return r.queryFiscalReceipts(ctx,
+		"WHERE f.status = $1 AND f.next_attempt_at <= NOW() ORDER BY f.next_attempt_at LIMIT $2",
+		models.FiscalStatusPending, limit)
+}
+
+// ListFiscalReceipts возвращает чеки с указанным статусом (все, если статус пуст), новые первыми
+func (r *Repository) ListFiscalReceipts(ctx context.Context, status string, limit int) ([]models.FiscalReceipt, error) {
+	return r.queryFiscalReceipts(ctx,
+		"WHERE $1 = '' OR f.status = $1 ORDER BY f.created_at DESC LIMIT $2",
+		status, limit)
+}
+
+// PaymentFiscalReceipt возвращает чек по платежу, доступному пользователю: платеж сделан
+// им самим или от имени организации, в которой он состоит
+func (r *Repository) PaymentFiscalReceipt(ctx context.Context, paymentID, userID int) (*models.FiscalReceipt, error) {
+	var receipt models.FiscalReceipt
+	err := scanFiscalReceipt(r.db.QueryRowContext(ctx, `
+		SELECT `+fiscalReceiptColumns+`
+		FROM fiscal_receipts f
+		JOIN payments p ON p.id = f.payment_id
+		WHERE f.payment_id = $1 AND (p.user_id = $2 OR p.organization_id IN
+			(SELECT organization_id FROM organization_members WHERE user_id = $2))
+	`, paymentID, userID).Scan, &receipt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &receipt, err
+}
+
+// PaymentOrganizationID возвращает организацию платежа; 0, если платеж личный или не найден
+func (r *Repository) PaymentOrganizationID(ctx context.Context, paymentID int) (int, error) {
+	var organizationID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, "SELECT organization_id FROM payments WHERE id = $1", paymentID).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return int(organizationID.Int64), err
+}
+
+// FiscalPaymentData возвращает сумму платежа, email плательщика и позиции оплаченного заказа
+func (r *Repository) FiscalPaymentData(ctx context.Context, paymentID int) (*FiscalPayment, error) {
+	var payment FiscalPayment
+	var orderID int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT p.amount, COALESCE(u.email, ''), COALESCE(p.order_id, 0)
+		FROM payments p
+		LEFT JOIN users u ON u.id = p.user_id
+		WHERE p.id = $1
+	`, paymentID).Scan(&payment.Amount, &payment.Email, &orderID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if orderID == 0 {
+		return &payment, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, gtin, quantity, COALESCE(price, 0), COALESCE(product_name, ''), COALESCE(product_group, '')
+		FROM order_items
+		WHERE order_id = $1
+		ORDER BY id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса позиций заказа: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.OrderItem
+		if err := rows.Scan(&item.ID, &item.GTIN, &item.Quantity, &item.Price,
+			&item.ProductName, &item.ProductGroup); err != nil {
+			return nil, fmt.Errorf("ошибка чтения позиции заказа: %w", err)
+		}
+		payment.Items = append(payment.Items, item)
+	}
+	return &payment, rows.Err()
+}
+
+// SetFiscalProviderID сохраняет идентификаторы чека, переданного в онлайн-кассу
+func (r *Repository) SetFiscalProviderID(ctx context.Context, receiptID int, externalID, providerID string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE fiscal_receipts SET external_id = $2, provider_id = $3, updated_at = NOW() WHERE id = $1",
+		receiptID, externalID, providerID,
+	)
+	return err
+}
+
+// FailFiscalAttempt фиксирует неудачную попытку регистрации чека. Следующая попытка
+// откладывается на интервал, удваивающийся с каждой попыткой начиная с base, но не больше
+// max. Если reset, чек будет передан в кассу заново с новым идентификатором. После
+// maxAttempts попыток чек получает статус failed. Возвращает true, если попытки исчерпаны.
+func (r *Repository) FailFiscalAttempt(ctx context.Context, receiptID int, message string, reset bool,
+	base, max time.Duration, maxAttempts int) (bool, error) {
+	var status string
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE fiscal_receipts SET
+			attempts = attempts + 1,
+			error = $2,
+			external_id = CASE WHEN $3 THEN NULL ELSE external_id END,
+			provider_id = CASE WHEN $3 THEN NULL ELSE provider_id END,
+			status = CASE WHEN attempts + 1 >= $6 THEN $7 ELSE status END,
+			next_attempt_at = NOW() + make_interval(secs => LEAST($4 * power(2, LEAST(attempts, 20)), $5)),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING status
+	`, receiptID, message, reset, base.Seconds(), max.Seconds(), maxAttempts, models.FiscalStatusFailed).Scan(&status)
+	return status == models.FiscalStatusFailed, err
+}
+
+// SaveFiscalDocument сохраняет реквизиты зарегистрированного чека
+func (r *Repository) SaveFiscalDocument(ctx context.Context, receipt *models.FiscalReceipt) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE fiscal_receipts SET status = $2, error = NULL,
+			fiscal_document_number = $3, fiscal_document_attribute = $4, fn_number = $5,
+			receipt_number = $6, shift_number = $7, registration_number = $8, fns_site = $9,
+			registered_at = $10, updated_at = NOW()
+		WHERE id = $1
+	`, receipt.ID, models.FiscalStatusRegistered, receipt.FiscalDocumentNumber, receipt.FiscalDocumentAttribute,
+		receipt.FNNumber, receipt.ReceiptNumber, receipt.ShiftNumber, receipt.RegistrationNumber,
+		receipt.FNSSite, receipt.RegisteredAt)
+	return err
+}
+
+// RetryFiscalReceipt возвращает в очередь чек, попытки регистрации которого исчерпаны.
+// Возвращает ErrNotFound, если такого чека нет.
+func (r *Repository) RetryFiscalReceipt(ctx context.Context, paymentID int) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE fiscal_receipts SET status = $2, attempts = 0, external_id = NULL, provider_id = NULL,
+			next_attempt_at = NOW(), updated_at = NOW()
+		WHERE payment_id = $1 AND status = $3
+	`, paymentID, models.FiscalStatusPending, models.FiscalStatusFailed)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
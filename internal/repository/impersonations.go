@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+const impersonationColumns = `id, admin_user_id, user_id, reason, allow_write, created_at, expires_at, revoked_at`
+
+func scanImpersonation(scan func(dest ...any) error) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	var revokedAt sql.NullTime
+	if err := scan(&impersonation.ID, &impersonation.AdminUserID, &impersonation.UserID, &impersonation.Reason,
+		&impersonation.AllowWrite, &impersonation.CreatedAt, &impersonation.ExpiresAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	impersonation.RevokedAt = timePtr(revokedAt)
+	return &impersonation, nil
+}
+
+// CreateImpersonation сохраняет сеанс имперсонации с хэшем токена
+func (r *Repository) CreateImpersonation(ctx context.Context, impersonation *models.Impersonation, tokenHash string) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO impersonations (admin_user_id, user_id, token_hash, reason, allow_write, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, impersonation.AdminUserID, impersonation.UserID, tokenHash, impersonation.Reason, impersonation.AllowWrite,
+		impersonation.ExpiresAt).Scan(&impersonation.ID, &impersonation.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения сеанса имперсонации: %w", err)
+	}
+	return nil
+}
+
+// ActiveImpersonationByHash возвращает действующий (не отозванный и не истекший) сеанс
+// имперсонации по хэшу токена или ErrNotFound
+func (r *Repository) ActiveImpersonationByHash(ctx context.Context, tokenHash string) (*models.Impersonation, error) {
+	impersonation, err := scanImpersonation(r.db.QueryRowContext(ctx, `
+		SELECT `+impersonationColumns+` FROM impersonations
+		WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > $2
+	`, tokenHash, time.Now()).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return impersonation, err
+}
+
+// Impersonations возвращает последние сеансы имперсонации, включая завершенные
+func (r *Repository) Impersonations(ctx context.Context, limit int) ([]models.Impersonation, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+impersonationColumns+` FROM impersonations
+		ORDER BY id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	impersonations := []models.Impersonation{}
+	for rows.Next() {
+		impersonation, err := scanImpersonation(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		impersonations = append(impersonations, *impersonation)
+	}
+	return impersonations, rows.Err()
+}
+
+// RevokeImpersonation завершает действующий сеанс имперсонации и возвращает его.
+// Возвращает ErrNotFound, если сеанс не найден или уже завершен.
+func (r *Repository) RevokeImpersonation(ctx context.Context, id int) (*models.Impersonation, error) {
+	impersonation, err := scanImpersonation(r.db.QueryRowContext(ctx, `
+		UPDATE impersonations SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > $2
+		RETURNING `+impersonationColumns, id, time.Now()).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return impersonation, err
+}
@@ -0,0 +1,307 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"project-znak/internal/models"
+)
+
+// Коды, относящиеся к остатку: коды запросов организации или, без организации, запросов
+// пользователя. Параметры: $1 - пользователь, $2 - организация (0 - личный остаток).
+const inventoryScopeCondition = `(CASE WHEN $2 > 0 THEN req.organization_id = $2 ELSE req.user_id = $1 END)`
+
+// Доступ к резерву: резерв пользователя или организации, в которой он состоит
+const reservationAccessCondition = `(user_id = $2 OR organization_id IN
+	(SELECT organization_id FROM organization_members WHERE user_id = $2))`
+
+// ReservationItem - количество кодов GTIN, резервируемых для отгрузки
+type ReservationItem struct {
+	GTIN  string
+	Count int
+}
+
+// StockChange - изменение числа доступных кодов GTIN в результате резервирования или
+// использования кодов
+type StockChange struct {
+	GTIN   string
+	Before int
+	After  int
+}
+
+// Inventory возвращает остатки кодов по GTIN пользователя или организации
+func (r *Repository) Inventory(ctx context.Context, userID, organizationID int) ([]models.InventoryItem, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT c.gtin,
+			COUNT(*) FILTER (WHERE c.status = $3),
+			COUNT(*) FILTER (WHERE c.status = $4),
+			COUNT(*) FILTER (WHERE c.status IN ($5, $6, $7) AND req.status <> $9),
+			COUNT(*) FILTER (WHERE c.status = $8),
+			COUNT(*) FILTER (WHERE c.status = $6 AND req.status = $9)
+		FROM kiz_codes c
+		JOIN kiz_requests req ON req.id = c.request_id
+		WHERE `+inventoryScopeCondition+`
+		GROUP BY c.gtin
+		ORDER BY c.gtin
+	`, userID, organizationID, models.KIZCodeStatusIssued, models.KIZCodeStatusReserved,
+		models.KIZCodeStatusUsed, models.KIZCodeStatusIntroduced, models.KIZCodeStatusRetired,
+		models.KIZCodeStatusSpoiled, models.KIZRequestStatusReceived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.InventoryItem{}
+	for rows.Next() {
+		var item models.InventoryItem
+		if err := rows.Scan(&item.GTIN, &item.Available, &item.Reserved, &item.Used, &item.Spoiled, &item.Received); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// CreateReservation резервирует доступные коды для отгрузки, начиная с полученных раньше.
+// Если кодов какого-либо GTIN недостаточно, резерв не создается и возвращается
+// ErrInsufficientCodes. Сообщения outbox, сформированные по изменению остатков, сохраняются
+// в той же транзакции.
+func (r *Repository) CreateReservation(ctx context.Context, reservation *models.KIZReservation, items []ReservationItem,
+	outbox func([]StockChange) ([]models.OutboxMessage, error)) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO kiz_reservations (user_id, organization_id, reference, status)
+			VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4)
+			RETURNING id, created_at
+		`, reservation.UserID, reservation.OrganizationID, reservation.Reference, models.ReservationStatusActive,
+		).Scan(&reservation.ID, &reservation.CreatedAt); err != nil {
+			return fmt.Errorf("ошибка создания резерва: %w", err)
+		}
+
+		taken := make(map[string]int, len(items))
+		for _, item := range items {
+			rows, err := tx.QueryContext(ctx, `
+				UPDATE kiz_codes SET status = $5, reservation_id = $6, updated_at = NOW()
+				WHERE id IN (
+					SELECT c.id FROM kiz_codes c
+					JOIN kiz_requests req ON req.id = c.request_id
+					WHERE `+inventoryScopeCondition+` AND c.gtin = $3 AND c.status = $7
+					ORDER BY c.id
+					LIMIT $4
+					FOR UPDATE OF c SKIP LOCKED
+				)
+				RETURNING code, gtin, request_id, status, created_at
+			`, reservation.UserID, reservation.OrganizationID, item.GTIN, item.Count,
+				models.KIZCodeStatusReserved, reservation.ID, models.KIZCodeStatusIssued)
+			if err != nil {
+				return fmt.Errorf("ошибка резервирования кодов: %w", err)
+			}
+			codes, err := scanKIZCodes(rows)
+			if err != nil {
+				return fmt.Errorf("ошибка резервирования кодов: %w", err)
+			}
+			if len(codes) < item.Count {
+				return fmt.Errorf("%w: GTIN %s, доступно %d", ErrInsufficientCodes, item.GTIN, len(codes))
+			}
+			reservation.Codes = append(reservation.Codes, codes...)
+			taken[item.GTIN] += len(codes)
+		}
+		reservation.Status = models.ReservationStatusActive
+
+		changes, err := stockChanges(ctx, tx, reservation.UserID, reservation.OrganizationID, taken)
+		if err != nil {
+			return err
+		}
+		return writeOutbox(ctx, tx, func() ([]models.OutboxMessage, error) { return outbox(changes) })
+	})
+}
+
+// Reservation возвращает резерв, доступный пользователю, с его кодами
+func (r *Repository) Reservation(ctx context.Context, reservationID, userID int) (*models.KIZReservation, error) {
+	reservation := models.KIZReservation{ID: reservationID}
+	var releasedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT user_id, COALESCE(organization_id, 0), COALESCE(reference, ''), status, created_at, released_at
+		FROM kiz_reservations
+		WHERE id = $1 AND `+reservationAccessCondition,
+		reservationID, userID,
+	).Scan(&reservation.UserID, &reservation.OrganizationID, &reservation.Reference, &reservation.Status,
+		&reservation.CreatedAt, &releasedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	reservation.ReleasedAt = timePtr(releasedAt)
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT code, gtin, request_id, status, created_at
+		FROM kiz_codes WHERE reservation_id = $1 ORDER BY id
+	`, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Codes, err = scanKIZCodes(rows); err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// ReservationOrganizationID возвращает организацию резерва; 0, если резерв личный или не найден
+func (r *Repository) ReservationOrganizationID(ctx context.Context, reservationID int) (int, error) {
+	var organizationID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, "SELECT organization_id FROM kiz_reservations WHERE id = $1", reservationID).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return int(organizationID.Int64), err
+}
+
+// ReleaseReservation снимает резерв: неиспользованные коды возвращаются в остаток,
+// использованные остаются связанными с резервом. Возвращает ErrNotFound, если резерв
+// не найден или уже снят.
+func (r *Repository) ReleaseReservation(ctx context.Context, reservationID, userID int) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE kiz_reservations SET status = $3, released_at = NOW()
+			WHERE id = $1 AND status = $4 AND `+reservationAccessCondition,
+			reservationID, userID, models.ReservationStatusReleased, models.ReservationStatusActive)
+		if err != nil {
+			return fmt.Errorf("ошибка снятия резерва: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return ErrNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE kiz_codes SET status = $2, reservation_id = NULL, updated_at = NOW()
+			WHERE reservation_id = $1 AND status = $3
+		`, reservationID, models.KIZCodeStatusIssued, models.KIZCodeStatusReserved); err != nil {
+			return fmt.Errorf("ошибка возврата кодов в остаток: %w", err)
+		}
+		return nil
+	})
+}
+
+// MarkKIZCodes отмечает доступные или зарезервированные коды остатка использованными или
+// испорченными и возвращает измененные коды. Коды вне остатка и в других статусах
+// не изменяются.
+func (r *Repository) MarkKIZCodes(ctx context.Context, userID, organizationID int, codes []string, status string,
+	outbox func([]StockChange) ([]models.OutboxMessage, error)) ([]models.KIZCode, error) {
+	var marked []models.KIZCode
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT c.code, c.gtin, c.request_id, c.status, c.created_at FROM kiz_codes c
+			JOIN kiz_requests req ON req.id = c.request_id
+			WHERE `+inventoryScopeCondition+` AND c.code = ANY($3) AND c.status IN ($4, $5)
+			ORDER BY c.id
+			FOR UPDATE OF c
+		`, userID, organizationID, codes, models.KIZCodeStatusIssued, models.KIZCodeStatusReserved)
+		if err != nil {
+			return fmt.Errorf("ошибка изменения статуса кодов: %w", err)
+		}
+		if marked, err = scanKIZCodes(rows); err != nil {
+			return fmt.Errorf("ошибка изменения статуса кодов: %w", err)
+		}
+
+		found := make([]string, len(marked))
+		for i := range marked {
+			found[i] = marked[i].Code
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE kiz_codes SET status = $1, updated_at = NOW() WHERE code = ANY($2)", status, found,
+		); err != nil {
+			return fmt.Errorf("ошибка изменения статуса кодов: %w", err)
+		}
+
+		// Остаток уменьшают только коды, которые не были зарезервированы
+		taken := make(map[string]int)
+		for i := range marked {
+			if marked[i].Status == models.KIZCodeStatusIssued {
+				taken[marked[i].GTIN]++
+			}
+			marked[i].Status = status
+		}
+
+		changes, err := stockChanges(ctx, tx, userID, organizationID, taken)
+		if err != nil {
+			return err
+		}
+		return writeOutbox(ctx, tx, func() ([]models.OutboxMessage, error) { return outbox(changes) })
+	})
+	if err != nil {
+		return nil, err
+	}
+	return marked, nil
+}
+
+// LastKIZRequestForGTIN возвращает последний выполненный запрос пользователя или организации,
+// по которому получены коды GTIN
+func (r *Repository) LastKIZRequestForGTIN(ctx context.Context, userID, organizationID int, gtin string) (*KIZRequestRecord, error) {
+	requests, err := queryKIZRequests(ctx, r.db.QueryContext, `
+		WHERE (CASE WHEN $2 > 0 THEN r.organization_id = $2 ELSE r.user_id = $1 END)
+		  AND r.status = $4
+		  AND EXISTS (SELECT 1 FROM kiz_codes c WHERE c.request_id = r.id AND c.gtin = $3)
+		ORDER BY r.request_time DESC LIMIT 1
+	`, userID, organizationID, gtin, models.KIZRequestStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, ErrNotFound
+	}
+	return &requests[0], nil
+}
+
+// Остатки GTIN после изменения в транзакции; taken - число кодов, выбывших из остатка
+func stockChanges(ctx context.Context, tx *sql.Tx, userID, organizationID int, taken map[string]int) ([]StockChange, error) {
+	if len(taken) == 0 {
+		return nil, nil
+	}
+	gtins := make([]string, 0, len(taken))
+	for gtin := range taken {
+		gtins = append(gtins, gtin)
+	}
+	sort.Strings(gtins)
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT g.gtin, (
+			SELECT COUNT(*) FROM kiz_codes c
+			JOIN kiz_requests req ON req.id = c.request_id
+			WHERE `+inventoryScopeCondition+` AND c.gtin = g.gtin AND c.status = $4
+		)
+		FROM unnest($3::text[]) AS g(gtin)
+		ORDER BY g.gtin
+	`, userID, organizationID, gtins, models.KIZCodeStatusIssued)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета остатков: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []StockChange
+	for rows.Next() {
+		var change StockChange
+		if err := rows.Scan(&change.GTIN, &change.After); err != nil {
+			return nil, fmt.Errorf("ошибка подсчета остатков: %w", err)
+		}
+		change.Before = change.After + taken[change.GTIN]
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// Чтение кодов из результата запроса; rows закрывается
+func scanKIZCodes(rows *sql.Rows) ([]models.KIZCode, error) {
+	defer rows.Close()
+	codes := []models.KIZCode{}
+	for rows.Next() {
+		var code models.KIZCode
+		if err := rows.Scan(&code.Code, &code.GTIN, &code.RequestID, &code.Status, &code.CreatedAt); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
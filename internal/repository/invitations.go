@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+// CreateInvitation сохраняет приглашение с хэшем кода tokenHash и заполняет его ID и CreatedAt
+func (r *Repository) CreateInvitation(ctx context.Context, invitation *models.Invitation, tokenHash string) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO user_invitations (token_hash, user_id, inn, email, username, partner_id, created_by, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, 0), NULLIF($7, 0), $8)
+		RETURNING id, created_at
+	`, tokenHash, invitation.UserID, invitation.INN, invitation.Email, invitation.Username, invitation.PartnerID,
+		invitation.CreatedBy, invitation.ExpiresAt,
+	).Scan(&invitation.ID, &invitation.CreatedAt)
+}
+
+// CreateInvitedUser создает пользователя без аккаунта Telegram, его организацию и приглашение
+// с хэшем кода tokenHash. Пользователь становится владельцем организации, а если в приглашении
+// указан партнер, организация становится субаккаунтом партнера. Возвращает
+// ErrOrganizationExists, если организация с таким ИНН уже есть.
+func (r *Repository) CreateInvitedUser(ctx context.Context, user *models.User, invitation *models.Invitation, tokenHash string) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO users (inn, email, organization_name, username)
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
+			RETURNING id, created_at, last_active
+		`, user.INN, user.Email, user.OrganizationName, user.Username,
+		).Scan(&user.ID, &user.RegisteredAt, &user.LastActive)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения пользователя: %w", err)
+		}
+
+		var organizationID int
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO organizations (inn, name, partner_id)
+			VALUES ($1, NULLIF($2, ''), NULLIF($3, 0))
+			ON CONFLICT (inn) DO NOTHING
+			RETURNING id
+		`, user.INN, user.OrganizationName, invitation.PartnerID).Scan(&organizationID)
+		if err == sql.ErrNoRows {
+			return ErrOrganizationExists
+		} else if err != nil {
+			return fmt.Errorf("ошибка сохранения организации: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO organization_members (organization_id, user_id, role)
+			VALUES ($1, $2, $3)
+		`, organizationID, user.ID, models.OrgRoleOwner); err != nil {
+			return fmt.Errorf("ошибка добавления владельца организации: %w", err)
+		}
+
+		invitation.UserID = user.ID
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO user_invitations (token_hash, user_id, inn, email, username, partner_id, created_by, expires_at)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, 0), NULLIF($7, 0), $8)
+			RETURNING id, created_at
+		`, tokenHash, invitation.UserID, invitation.INN, invitation.Email, invitation.Username, invitation.PartnerID,
+			invitation.CreatedBy, invitation.ExpiresAt,
+		).Scan(&invitation.ID, &invitation.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения приглашения: %w", err)
+		}
+		return nil
+	})
+}
+
+// UnboundUserByINN возвращает ID созданного по приглашению пользователя с ИНН, к которому
+// еще не привязан аккаунт Telegram, или 0, если такого нет
+func (r *Repository) UnboundUserByINN(ctx context.Context, inn string) (int, error) {
+	var userID int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT u.id FROM users u
+		JOIN user_invitations i ON i.user_id = u.id
+		WHERE u.inn = $1 AND u.telegram_id IS NULL AND u.deleted_at IS NULL
+		ORDER BY u.id LIMIT 1
+	`, inn).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return userID, err
+}
+
+// BindInvitation привязывает аккаунт Telegram к созданному по приглашению пользователю
+// и отмечает приглашение использованным. Возвращает наименование организации пользователя;
+// ErrConflict, если приглашение уже использовано или аккаунт уже привязан.
+func (r *Repository) BindInvitation(ctx context.Context, invitation *models.Invitation, telegramID int64) (string, error) {
+	var organizationName string
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+		result, err := tx.ExecContext(ctx, `
+			UPDATE user_invitations SET accepted_by = user_id, accepted_at = $1
+			WHERE id = $2 AND accepted_at IS NULL
+		`, now, invitation.ID)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rows == 0 {
+			return ErrConflict
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			UPDATE users SET telegram_id = $1, last_active = $2
+			WHERE id = $3 AND telegram_id IS NULL AND deleted_at IS NULL
+			RETURNING COALESCE(organization_name, '')
+		`, telegramID, now, invitation.UserID).Scan(&organizationName)
+		if err == sql.ErrNoRows {
+			return ErrConflict
+		}
+		return err
+	})
+	return organizationName, err
+}
+
+// PendingInvitation возвращает неиспользованное приглашение с хэшем кода tokenHash,
+// действующее в момент now; ErrNotFound, если такого нет
+func (r *Repository) PendingInvitation(ctx context.Context, tokenHash string, now time.Time) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, COALESCE(user_id, 0), inn, COALESCE(email, ''), COALESCE(username, ''), COALESCE(partner_id, 0),
+			COALESCE(created_by, 0), created_at, expires_at
+		FROM user_invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > $2
+	`, tokenHash, now).Scan(&invitation.ID, &invitation.UserID, &invitation.INN, &invitation.Email, &invitation.Username,
+		&invitation.PartnerID, &invitation.CreatedBy, &invitation.CreatedAt, &invitation.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// HasPendingInvitation сообщает, есть ли для ИНН неиспользованное приглашение, действующее в момент now
+func (r *Repository) HasPendingInvitation(ctx context.Context, inn string, now time.Time) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM user_invitations WHERE inn = $1 AND accepted_at IS NULL AND expires_at > $2
+		)
+	`, inn, now).Scan(&exists)
+	return exists, err
+}
+
+// AcceptInvitation отмечает приглашение использованным пользователем userID. Возвращает false,
+// если приглашение уже использовано параллельной регистрацией.
+func (r *Repository) AcceptInvitation(ctx context.Context, invitationID, userID int) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE user_invitations SET accepted_by = $1, accepted_at = $2
+		WHERE id = $3 AND accepted_at IS NULL
+	`, userID, time.Now(), invitationID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+const invoiceColumns = `id, number, order_id, COALESCE(organization_id, 0), user_id, COALESCE(payment_id, 0),
+	amount, status, due_date, COALESCE(payment_order_number, ''), paid_at, created_at`
+
+func scanInvoice(scan func(dest ...any) error, invoice *models.Invoice) error {
+	var paidAt sql.NullTime
+	if err := scan(&invoice.ID, &invoice.Number, &invoice.OrderID, &invoice.OrganizationID, &invoice.UserID,
+		&invoice.PaymentID, &invoice.Amount, &invoice.Status, &invoice.DueDate, &invoice.PaymentOrderNumber,
+		&paidAt, &invoice.CreatedAt); err != nil {
+		return err
+	}
+	invoice.PaidAt = timePtr(paidAt)
+	return nil
+}
+
+// IssueInvoice выставляет счет на оплату заказа и переводит заказ в ожидание оплаты.
+// Номер счета имеет вид ГГГГ-NNNNN. Если по заказу уже выставлен неоплаченный счет,
+// invoice заполняется его данными и возвращается false. Возвращает ErrOrderNotPayable,
+// если заказ отменен или уже оплачен.
+func (r *Repository) IssueInvoice(ctx context.Context, invoice *models.Invoice) (bool, error) {
+	created := false
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var status string
+		if err := tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", invoice.OrderID).Scan(&status); err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		if status != models.OrderStatusCreated && status != models.OrderStatusPending {
+			return ErrOrderNotPayable
+		}
+
+		err := scanInvoice(tx.QueryRowContext(ctx,
+			"SELECT "+invoiceColumns+" FROM invoices WHERE order_id = $1 AND status = $2",
+			invoice.OrderID, models.InvoiceStatusIssued,
+		).Scan, invoice)
+		if err == nil {
+			return nil
+		} else if err != sql.ErrNoRows {
+			return fmt.Errorf("ошибка проверки счетов заказа: %w", err)
+		}
+
+		if err := tx.QueryRowContext(ctx, `
+			WITH seq AS (SELECT nextval(pg_get_serial_sequence('invoices', 'id')) AS id)
+			INSERT INTO invoices (id, number, order_id, organization_id, user_id, amount, status, due_date)
+			SELECT id, to_char(NOW(), 'YYYY') || '-' || lpad(id::text, 5, '0'), $1, NULLIF($2, 0), $3, $4, $5, $6
+			FROM seq
+			RETURNING id, number, created_at
+		`, invoice.OrderID, invoice.OrganizationID, invoice.UserID, invoice.Amount,
+			models.InvoiceStatusIssued, invoice.DueDate,
+		).Scan(&invoice.ID, &invoice.Number, &invoice.CreatedAt); err != nil {
+			return fmt.Errorf("ошибка создания счета: %w", err)
+		}
+		invoice.Status = models.InvoiceStatusIssued
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE orders SET status = $1, updated_at = NOW(), version = version + 1 WHERE id = $2 AND status = $3",
+			models.OrderStatusPending, invoice.OrderID, models.OrderStatusCreated,
+		); err != nil {
+			return fmt.Errorf("ошибка обновления заказа: %w", err)
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+// Invoice возвращает счет по ID
+func (r *Repository) Invoice(ctx context.Context, invoiceID int) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := scanInvoice(r.db.QueryRowContext(ctx,
+		"SELECT "+invoiceColumns+" FROM invoices WHERE id = $1", invoiceID,
+	).Scan, &invoice)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &invoice, err
+}
+
+// OrderInvoice возвращает последний неотмененный счет заказа
+func (r *Repository) OrderInvoice(ctx context.Context, orderID int) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := scanInvoice(r.db.QueryRowContext(ctx,
+		"SELECT "+invoiceColumns+" FROM invoices WHERE order_id = $1 AND status != $2 ORDER BY created_at DESC LIMIT 1",
+		orderID, models.InvoiceStatusCancelled,
+	).Scan, &invoice)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &invoice, err
+}
+
+// ListInvoices возвращает счета с указанным статусом (все, если статус пуст), новые первыми
+func (r *Repository) ListInvoices(ctx context.Context, status string, limit int) ([]models.Invoice, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+invoiceColumns+" FROM invoices WHERE $1 = '' OR status = $1 ORDER BY created_at DESC LIMIT $2",
+		status, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := []models.Invoice{}
+	for rows.Next() {
+		var invoice models.Invoice
+		if err := scanInvoice(rows.Scan, &invoice); err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, invoice)
+	}
+	return invoices, rows.Err()
+}
+
+// PayInvoice отмечает выставленный счет оплаченным по платежному поручению: создает
+// проведенный платеж на сумму счета и переводит заказ в статус оплаченного.
+// Возвращает ErrInvoiceNotIssued, если счет уже оплачен или отменен.
+func (r *Repository) PayInvoice(ctx context.Context, invoiceID int, paymentOrderNumber string, at time.Time,
+	outbox func(*models.Invoice) ([]models.OutboxMessage, error)) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		err := scanInvoice(tx.QueryRowContext(ctx,
+			"SELECT "+invoiceColumns+" FROM invoices WHERE id = $1 FOR UPDATE", invoiceID,
+		).Scan, &invoice)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		if invoice.Status != models.InvoiceStatusIssued {
+			return ErrInvoiceNotIssued
+		}
+
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO payments (user_id, order_id, organization_id, amount, status, completed_at, provider)
+			VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7)
+			RETURNING id
+		`, invoice.UserID, invoice.OrderID, invoice.OrganizationID, invoice.Amount,
+			models.PaymentStatusCompleted, at, models.PaymentProviderInvoice,
+		).Scan(&invoice.PaymentID); err != nil {
+			return fmt.Errorf("ошибка создания платежа: %w", err)
+		}
+		if err := writePaymentLedger(ctx, tx, invoice.PaymentID, at); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE invoices SET status = $1, payment_id = $2, payment_order_number = $3, paid_at = $4
+			WHERE id = $5
+		`, models.InvoiceStatusPaid, invoice.PaymentID, paymentOrderNumber, at, invoiceID); err != nil {
+			return fmt.Errorf("ошибка обновления счета: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE orders SET status = $1, updated_at = NOW(), version = version + 1 WHERE id = $2 AND status IN ($3, $4)",
+			models.OrderStatusPaid, invoice.OrderID, models.OrderStatusCreated, models.OrderStatusPending,
+		); err != nil {
+			return fmt.Errorf("ошибка обновления заказа: %w", err)
+		}
+
+		invoice.Status = models.InvoiceStatusPaid
+		invoice.PaymentOrderNumber = paymentOrderNumber
+		invoice.PaidAt = &at
+		return writeOutbox(ctx, tx, func() ([]models.OutboxMessage, error) { return outbox(&invoice) })
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
@@ -0,0 +1,412 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"project-znak/internal/labels"
+	"project-znak/internal/models"
+)
+
+// KIZRequestRecord - сохраненный запрос кодов маркировки с результатом
+type KIZRequestRecord struct {
+	ID             int             `json:"id" xml:"id"`
+	UserID         int             `json:"user_id,omitempty" xml:"user_id,omitempty"`
+	TelegramID     int64           `json:"telegram_id" xml:"telegram_id"`
+	INN            string          `json:"inn" xml:"inn"`
+	OrderID        int             `json:"order_id,omitempty" xml:"order_id,omitempty"`
+	OrganizationID int             `json:"organization_id,omitempty" xml:"organization_id,omitempty"`
+	ProductGroup   string          `json:"product_group,omitempty" xml:"product_group,omitempty"`
+	RequestTime    time.Time       `json:"request_time" xml:"request_time"`
+	Status         string          `json:"status" xml:"status"`
+	RequestData    json.RawMessage `json:"request_data,omitempty" xml:"request_data,omitempty"`
+	FilePath       string          `json:"file_path,omitempty" xml:"file_path,omitempty"`
+	KIZData        json.RawMessage `json:"kiz_data,omitempty" xml:"kiz_data,omitempty"`
+
+	// Последняя ошибка запроса: причина, ответ Честного ЗНАКа или СУЗ и время
+	Error        string     `json:"error,omitempty" xml:"error,omitempty"`
+	ErrorPayload string     `json:"error_payload,omitempty" xml:"error_payload,omitempty"`
+	Attempts     int        `json:"attempts,omitempty" xml:"attempts,omitempty"`
+	FailedAt     *time.Time `json:"failed_at,omitempty" xml:"failed_at,omitempty"`
+
+	// Ход выполнения: запрошено, выпущено и получено кодов, сформировано файлов
+	CodesRequested  int `json:"codes_requested" xml:"codes_requested"`
+	CodesEmitted    int `json:"codes_emitted" xml:"codes_emitted"`
+	CodesDownloaded int `json:"codes_downloaded" xml:"codes_downloaded"`
+	FilesGenerated  int `json:"files_generated" xml:"files_generated"`
+
+	// Сообщение Telegram, в котором доставлен файл с кодами
+	TelegramMessageID int64 `json:"telegram_message_id,omitempty" xml:"telegram_message_id,omitempty"`
+
+	// Версия запроса, увеличивается при смене статуса
+	Version int `json:"version" xml:"version"`
+
+	// Время последнего изменения статуса, хода выполнения или доставки
+	UpdatedAt time.Time `json:"updated_at" xml:"updated_at"`
+}
+
+// NewKIZRequest - данные нового запроса кодов маркировки
+type NewKIZRequest struct {
+	UserID         int
+	TelegramID     int64
+	INN            string
+	OrderID        int
+	OrganizationID int
+	ProductGroup   string
+	RequestTime    time.Time
+	RequestData    any // Параметры запроса, сохраняемые в request_data
+	CodesRequested int
+}
+
+// CreateKIZRequest сохраняет запрос кодов маркировки и возвращает его ID
+func (r *Repository) CreateKIZRequest(ctx context.Context, request NewKIZRequest) (int, error) {
+	var requestData []byte
+	if request.RequestData != nil {
+		var err error
+		if requestData, err = json.Marshal(request.RequestData); err != nil {
+			return 0, fmt.Errorf("ошибка сериализации запроса: %w", err)
+		}
+	}
+
+	var requestID int
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO kiz_requests (user_id, telegram_id, inn, product_group, request_time, order_id, organization_id,
+			request_data, codes_requested, heartbeat_at, updated_at)
+		VALUES (NULLIF($1, 0), $2, $3, NULLIF($4, ''), $5, NULLIF($6, 0), NULLIF($7, 0), $8, $9, NOW(), NOW())
+		RETURNING id
+	`, request.UserID, request.TelegramID, request.INN, request.ProductGroup, request.RequestTime, request.OrderID,
+		request.OrganizationID, requestData, request.CodesRequested).Scan(&requestID)
+	return requestID, err
+}
+
+// SaveKIZResult сохраняет полученные коды маркировки и файл с ними, отмечая запрос выполненным.
+// Каждый код также записывается в kiz_codes; коды, уже выданные ранее по этому или другому
+// запросу, не записываются повторно и возвращаются как дубликаты.
+func (r *Repository) SaveKIZResult(ctx context.Context, requestID int, kizs []string, filePath string) ([]string, error) {
+	kizData, err := json.Marshal(kizs)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации кодов: %w", err)
+	}
+
+	var duplicates []string
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO kiz_results (request_id, kiz_data, file_path) VALUES ($1, $2, $3)",
+			requestID, kizData, filePath,
+		); err != nil {
+			return fmt.Errorf("ошибка сохранения кодов: %w", err)
+		}
+
+		gtins := make([]string, len(kizs))
+		for i, code := range kizs {
+			gtins[i] = labels.GTINFromCode(code)
+		}
+		rows, err := tx.QueryContext(ctx, `
+			INSERT INTO kiz_codes (code, gtin, request_id, status)
+			SELECT code, gtin, $3, $4 FROM unnest($1::text[], $2::text[]) AS c(code, gtin)
+			ON CONFLICT (code) DO NOTHING
+			RETURNING code
+		`, kizs, gtins, requestID, models.KIZCodeStatusIssued)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения кодов: %w", err)
+		}
+		inserted := make(map[string]bool, len(kizs))
+		for rows.Next() {
+			var code string
+			if err := rows.Scan(&code); err != nil {
+				rows.Close()
+				return fmt.Errorf("ошибка сохранения кодов: %w", err)
+			}
+			inserted[code] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("ошибка сохранения кодов: %w", err)
+		}
+		// Код, повторяющийся внутри запроса, записывается один раз, остальные вхождения - дубликаты
+		for _, code := range kizs {
+			if inserted[code] {
+				delete(inserted, code)
+				continue
+			}
+			duplicates = append(duplicates, code)
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE kiz_requests SET status = $2, version = version + 1, updated_at = NOW() WHERE id = $1 AND status = $3",
+			requestID, models.KIZRequestStatusCompleted, models.KIZRequestStatusPending,
+		); err != nil {
+			return fmt.Errorf("ошибка обновления запроса: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return duplicates, nil
+}
+
+// IssuedKIZCodes возвращает коды из списка, выданные по запросам пользователя или
+// организаций, в которых он состоит
+func (r *Repository) IssuedKIZCodes(ctx context.Context, userID int, codes []string) ([]models.KIZCode, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT c.code, c.gtin, c.request_id, c.status, c.created_at
+		FROM kiz_codes c
+		JOIN kiz_requests req ON req.id = c.request_id
+		WHERE c.code = ANY($1)
+		  AND (req.user_id = $2 OR req.organization_id IN
+			(SELECT organization_id FROM organization_members WHERE user_id = $2))
+		ORDER BY c.id
+	`, codes, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanKIZCodes(rows)
+}
+
+// SetKIZCodeStatuses обновляет статусы выданных кодов; statuses[i] - статус codes[i]
+func (r *Repository) SetKIZCodeStatuses(ctx context.Context, codes, statuses []string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE kiz_codes c SET status = s.status
+		FROM unnest($1::text[], $2::text[]) AS s(code, status)
+		WHERE c.code = s.code AND c.status <> s.status
+	`, codes, statuses)
+	return err
+}
+
+// SaveKIZDelivery сохраняет идентификатор сообщения Telegram, в котором доставлен файл с кодами
+func (r *Repository) SaveKIZDelivery(ctx context.Context, requestID int, messageID int64) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE kiz_results SET telegram_message_id = $2 WHERE request_id = $1",
+			requestID, messageID,
+		); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE kiz_requests SET updated_at = NOW() WHERE id = $1", requestID)
+		return err
+	})
+}
+
+const kizRequestColumns = `r.id, COALESCE(r.user_id, 0), r.telegram_id, r.inn, COALESCE(r.order_id, 0),
+	COALESCE(r.organization_id, 0), COALESCE(r.product_group, ''), r.request_time, r.status, r.request_data,
+	COALESCE(r.error, ''), COALESCE(r.error_payload, ''), r.attempts, r.failed_at, res.file_path, r.version,
+	r.codes_requested, r.codes_emitted, r.codes_downloaded, r.files_generated, r.updated_at`
+
+func scanKIZRequest(scan func(dest ...any) error, req *KIZRequestRecord, extra ...any) error {
+	var requestData []byte
+	var filePath sql.NullString
+	var failedAt, updatedAt sql.NullTime
+	dest := []any{&req.ID, &req.UserID, &req.TelegramID, &req.INN, &req.OrderID, &req.OrganizationID,
+		&req.ProductGroup, &req.RequestTime, &req.Status, &requestData,
+		&req.Error, &req.ErrorPayload, &req.Attempts, &failedAt, &filePath, &req.Version,
+		&req.CodesRequested, &req.CodesEmitted, &req.CodesDownloaded, &req.FilesGenerated, &updatedAt}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	req.RequestData = requestData
+	req.FilePath = filePath.String
+	req.FailedAt = timePtr(failedAt)
+	req.UpdatedAt = req.RequestTime
+	if updatedAt.Valid {
+		req.UpdatedAt = updatedAt.Time
+	}
+	return nil
+}
+
+// Выборка запросов по условию через query: на основном пуле или на реплике
+func queryKIZRequests(ctx context.Context, query queryFunc, condition string, args ...any) ([]KIZRequestRecord, error) {
+	rows, err := query(ctx, `
+		SELECT `+kizRequestColumns+`
+		FROM kiz_requests r
+		LEFT JOIN kiz_results res ON r.id = res.request_id
+		`+condition, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []KIZRequestRecord
+	for rows.Next() {
+		var req KIZRequestRecord
+		if err := scanKIZRequest(rows.Scan, &req); err != nil {
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+
+	return requests, rows.Err()
+}
+
+// ListKIZRequests возвращает последние запросы пользователя с указанным telegram_id
+func (r *Repository) ListKIZRequests(ctx context.Context, telegramID int64, limit int) ([]KIZRequestRecord, error) {
+	return queryKIZRequests(ctx, r.readQuery, "WHERE r.telegram_id = $1 ORDER BY r.request_time DESC LIMIT $2", telegramID, limit)
+}
+
+// ListFailedKIZRequests возвращает запросы с ошибкой в указанном статусе (failed или dead;
+// оба, если статус пуст), последние ошибки первыми
+func (r *Repository) ListFailedKIZRequests(ctx context.Context, status string, limit int) ([]KIZRequestRecord, error) {
+	return queryKIZRequests(ctx, r.readQuery,
+		"WHERE r.status IN ($1, $2) AND ($3 = '' OR r.status = $3) ORDER BY r.failed_at DESC LIMIT $4",
+		models.KIZRequestStatusFailed, models.KIZRequestStatusDead, status, limit)
+}
+
+// UserKIZRequests возвращает запросы из списка ids, сделанные пользователем или от имени
+// организаций, в которых он состоит. Запросы, не найденные или недоступные пользователю,
+// в ответ не включаются.
+func (r *Repository) UserKIZRequests(ctx context.Context, userID int, ids []int) ([]KIZRequestRecord, error) {
+	return queryKIZRequests(ctx, r.readQuery, `WHERE r.id = ANY($1)
+		AND (r.user_id = $2 OR r.organization_id IN
+			(SELECT organization_id FROM organization_members WHERE user_id = $2))
+		ORDER BY r.id`, ids, userID)
+}
+
+// KIZRequestSummary возвращает запрос кодов маркировки без полученных кодов или ErrNotFound.
+// Запрос выполняется на основном пуле: ход выполнения не должен отставать.
+func (r *Repository) KIZRequestSummary(ctx context.Context, requestID int) (*KIZRequestRecord, error) {
+	requests, err := queryKIZRequests(ctx, r.db.QueryContext, "WHERE r.id = $1", requestID)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, ErrNotFound
+	}
+	return &requests[0], nil
+}
+
+// UserKIZRequestSummary возвращает запрос кодов маркировки без полученных кодов, сделанный
+// пользователем или от имени его организации, или ErrNotFound, если запрос не найден или
+// недоступен пользователю. Запрос выполняется на основном пуле, как KIZRequestSummary.
+func (r *Repository) UserKIZRequestSummary(ctx context.Context, userID, requestID int) (*KIZRequestRecord, error) {
+	requests, err := queryKIZRequests(ctx, r.db.QueryContext, `WHERE r.id = $1
+		AND (r.user_id = $2 OR r.organization_id IN
+			(SELECT organization_id FROM organization_members WHERE user_id = $2))`, requestID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, ErrNotFound
+	}
+	return &requests[0], nil
+}
+
+// KIZRequest возвращает запрос кодов маркировки с результатом
+func (r *Repository) KIZRequest(ctx context.Context, requestID int) (*KIZRequestRecord, error) {
+	return r.queryKIZRequestResult(ctx, "WHERE r.id = $1", requestID)
+}
+
+// UserKIZRequest возвращает запрос кодов маркировки с результатом, сделанный пользователем
+// или от имени его организации, или ErrNotFound, если запрос не найден или недоступен пользователю
+func (r *Repository) UserKIZRequest(ctx context.Context, userID, requestID int) (*KIZRequestRecord, error) {
+	return r.queryKIZRequestResult(ctx, `WHERE r.id = $1
+		AND (r.user_id = $2 OR r.organization_id IN
+			(SELECT organization_id FROM organization_members WHERE user_id = $2))`, requestID, userID)
+}
+
+// Выборка одного запроса с результатом по условию
+func (r *Repository) queryKIZRequestResult(ctx context.Context, condition string, args ...any) (*KIZRequestRecord, error) {
+	var req KIZRequestRecord
+	var kizData []byte
+
+	err := scanKIZRequest(r.db.QueryRowContext(ctx, `
+		SELECT `+kizRequestColumns+`, res.kiz_data, COALESCE(res.telegram_message_id, 0)
+		FROM kiz_requests r
+		LEFT JOIN kiz_results res ON r.id = res.request_id
+		`+condition, args...).Scan, &req, &kizData, &req.TelegramMessageID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	req.KIZData = kizData
+	return &req, nil
+}
+
+// KIZProgress - ход выполнения запроса КИЗ
+type KIZProgress struct {
+	CodesEmitted    int
+	CodesDownloaded int
+	FilesGenerated  int
+}
+
+// SaveKIZProgress сохраняет ход выполнения запроса КИЗ, пока запрос выполняется
+func (r *Repository) SaveKIZProgress(ctx context.Context, requestID int, progress KIZProgress) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE kiz_requests SET codes_emitted = $2, codes_downloaded = $3, files_generated = $4, updated_at = NOW()
+		WHERE id = $1 AND status = $5
+	`, requestID, progress.CodesEmitted, progress.CodesDownloaded, progress.FilesGenerated, models.KIZRequestStatusPending)
+	return err
+}
+
+// KIZRequestOrganizationID возвращает организацию запроса КИЗ; 0, если запрос личный или не найден
+func (r *Repository) KIZRequestOrganizationID(ctx context.Context, requestID int) (int, error) {
+	var organizationID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, "SELECT organization_id FROM kiz_requests WHERE id = $1", requestID).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return int(organizationID.Int64), err
+}
+
+// FailKIZRequest сохраняет ошибку выполнения запроса и ответ внешнего API. Запрос получает
+// статус dead, если ошибка неустранима (permanent) или сделано maxAttempts попыток, иначе
+// failed. Возвращает новый статус запроса.
+func (r *Repository) FailKIZRequest(ctx context.Context, requestID int, message, payload string,
+	permanent bool, maxAttempts int) (string, error) {
+	var status string
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE kiz_requests SET
+			attempts = attempts + 1,
+			error = $2,
+			error_payload = NULLIF($3, ''),
+			failed_at = NOW(),
+			status = CASE WHEN $4 OR attempts + 1 >= $5 THEN $6 ELSE $7 END,
+			version = version + 1,
+			updated_at = NOW()
+		WHERE id = $1 AND status = $8
+		RETURNING status
+	`, requestID, message, payload, permanent, maxAttempts,
+		models.KIZRequestStatusDead, models.KIZRequestStatusFailed, models.KIZRequestStatusPending).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return status, err
+}
+
+// RetryKIZRequest возвращает запрос с ошибкой в статус pending для повторного выполнения;
+// ход выполнения начинается заново.
+// Запрос в статусе dead повторяется, только если allowDead. Если version > 0, запрос
+// обновляется только в этой версии. Возвращает ErrNotFound, если запрос не найден или
+// его статус не допускает повтора, и ErrConflict, если запрос изменен после чтения.
+func (r *Repository) RetryKIZRequest(ctx context.Context, requestID, version int, allowDead bool) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE kiz_requests SET status = $2, codes_emitted = 0, codes_downloaded = 0, files_generated = 0,
+			version = version + 1, heartbeat_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND (status = $3 OR ($4 AND status = $5)) AND ($6 = 0 OR version = $6)
+	`, requestID, models.KIZRequestStatusPending, models.KIZRequestStatusFailed, allowDead, models.KIZRequestStatusDead,
+		version)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		if version == 0 {
+			return ErrNotFound
+		}
+		var current int
+		err := r.db.QueryRowContext(ctx, "SELECT version FROM kiz_requests WHERE id = $1", requestID).Scan(&current)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		if current != version {
+			return ErrConflict
+		}
+		return ErrNotFound
+	}
+	return nil
+}
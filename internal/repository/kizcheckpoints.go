@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+// KIZBatchCheckpoint - контрольная точка эмиссии партии запроса КИЗ
+type KIZBatchCheckpoint struct {
+	Batch      int
+	Products   json.RawMessage     // Заказанные товары партии
+	OMSOrderID string              // Заказ СУЗ; пусто - коды заказаны в Честном ЗНАКе
+	Closed     []string            // GTIN, буфер которых закрыт
+	Completed  bool                // Все коды партии получены
+	Codes      map[string][]string // Полученные коды по GTIN в порядке получения
+}
+
+// KIZCheckpoints возвращает контрольные точки эмиссии партий запроса КИЗ по номерам партий
+func (r *Repository) KIZCheckpoints(ctx context.Context, requestID int) (map[int]*KIZBatchCheckpoint, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT batch, products, COALESCE(oms_order_id, ''), closed_gtins, completed
+		FROM kiz_request_batches
+		WHERE request_id = $1
+	`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := make(map[int]*KIZBatchCheckpoint)
+	for rows.Next() {
+		var batch KIZBatchCheckpoint
+		var products, closed []byte
+		if err := rows.Scan(&batch.Batch, &products, &batch.OMSOrderID, &closed, &batch.Completed); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(closed, &batch.Closed); err != nil {
+			return nil, fmt.Errorf("ошибка разбора закрытых буферов партии %d: %w", batch.Batch, err)
+		}
+		batch.Products = products
+		batch.Codes = make(map[string][]string)
+		batches[batch.Batch] = &batch
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	chunks, err := r.db.QueryContext(ctx, `
+		SELECT batch, gtin, codes
+		FROM kiz_request_chunks
+		WHERE request_id = $1
+		ORDER BY batch, gtin, start_offset
+	`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer chunks.Close()
+
+	for chunks.Next() {
+		var batch int
+		var gtin string
+		var data []byte
+		if err := chunks.Scan(&batch, &gtin, &data); err != nil {
+			return nil, err
+		}
+		var codes []string
+		if err := json.Unmarshal(data, &codes); err != nil {
+			return nil, fmt.Errorf("ошибка разбора кодов партии %d: %w", batch, err)
+		}
+		if checkpoint := batches[batch]; checkpoint != nil {
+			checkpoint.Codes[gtin] = append(checkpoint.Codes[gtin], codes...)
+		}
+	}
+
+	return batches, chunks.Err()
+}
+
+// SaveKIZBatchOrder сохраняет заказ СУЗ партии запроса КИЗ. Полученные ранее порции кодов
+// партии удаляются: они относятся к прежнему заказу.
+func (r *Repository) SaveKIZBatchOrder(ctx context.Context, requestID, batch int, products []byte, omsOrderID string) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"DELETE FROM kiz_request_chunks WHERE request_id = $1 AND batch = $2", requestID, batch); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO kiz_request_batches (request_id, batch, products, oms_order_id)
+			VALUES ($1, $2, $3, NULLIF($4, ''))
+			ON CONFLICT (request_id, batch) DO UPDATE SET
+				products = EXCLUDED.products,
+				oms_order_id = EXCLUDED.oms_order_id,
+				closed_gtins = '[]',
+				completed = FALSE,
+				updated_at = NOW()
+		`, requestID, batch, products, omsOrderID)
+		return err
+	})
+}
+
+// SaveKIZChunk сохраняет порцию кодов GTIN партии, полученную после offset кодов
+func (r *Repository) SaveKIZChunk(ctx context.Context, requestID, batch int, gtin string, offset int, codes []string) error {
+	data, err := json.Marshal(codes)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации кодов: %w", err)
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO kiz_request_chunks (request_id, batch, gtin, start_offset, codes)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (request_id, batch, gtin, start_offset) DO UPDATE SET codes = EXCLUDED.codes
+	`, requestID, batch, gtin, offset, data)
+	return err
+}
+
+// SaveKIZBatchClosed сохраняет список GTIN партии, буфер которых закрыт
+func (r *Repository) SaveKIZBatchClosed(ctx context.Context, requestID, batch int, closed []string) error {
+	data, err := json.Marshal(closed)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации GTIN: %w", err)
+	}
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE kiz_request_batches SET closed_gtins = $3, updated_at = NOW()
+		WHERE request_id = $1 AND batch = $2
+	`, requestID, batch, data)
+	return err
+}
+
+// CompleteKIZBatch сохраняет все коды партии, полученные одним запросом, и отмечает партию
+// выполненной
+func (r *Repository) CompleteKIZBatch(ctx context.Context, requestID, batch int, products []byte, codes []string) error {
+	data, err := json.Marshal(codes)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации кодов: %w", err)
+	}
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO kiz_request_batches (request_id, batch, products, completed)
+			VALUES ($1, $2, $3, TRUE)
+			ON CONFLICT (request_id, batch) DO UPDATE SET
+				products = EXCLUDED.products, completed = TRUE, updated_at = NOW()
+		`, requestID, batch, products); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			"DELETE FROM kiz_request_chunks WHERE request_id = $1 AND batch = $2", requestID, batch); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO kiz_request_chunks (request_id, batch, gtin, start_offset, codes)
+			VALUES ($1, $2, '', 0, $3)
+		`, requestID, batch, data)
+		return err
+	})
+}
+
+// DeleteKIZCheckpoints удаляет контрольные точки эмиссии запроса КИЗ
+func (r *Repository) DeleteKIZCheckpoints(ctx context.Context, requestID int) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM kiz_request_chunks WHERE request_id = $1", requestID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM kiz_request_batches WHERE request_id = $1", requestID)
+		return err
+	})
+}
+
+// TouchKIZRequest подтверждает, что запрос КИЗ выполняется
+func (r *Repository) TouchKIZRequest(ctx context.Context, requestID int) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE kiz_requests SET heartbeat_at = NOW() WHERE id = $1 AND status = $2",
+		requestID, models.KIZRequestStatusPending)
+	return err
+}
+
+// ClaimStaleKIZRequest захватывает для продолжения запрос КИЗ в статусе pending, выполнение
+// которого не подтверждалось дольше staleAfter, и подтверждает его выполнение. Возвращает
+// ErrNotFound, если таких запросов нет.
+func (r *Repository) ClaimStaleKIZRequest(ctx context.Context, staleAfter time.Duration) (*KIZRequestRecord, error) {
+	var requestID int
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE kiz_requests SET heartbeat_at = NOW()
+		WHERE id = (
+			SELECT id FROM kiz_requests
+			WHERE status = $1 AND COALESCE(heartbeat_at, request_time) < NOW() + make_interval(secs => $2)
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`, models.KIZRequestStatusPending, -staleAfter.Seconds()).Scan(&requestID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return r.KIZRequestSummary(ctx, requestID)
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"project-znak/internal/models"
+)
+
+// LabelSettings возвращает шаблон этикеток пользователя. Если пользователь
+// не выбирал шаблон, возвращается ErrNotFound.
+func (r *Repository) LabelSettings(ctx context.Context, userID int) (models.LabelSettings, error) {
+	settings := models.LabelSettings{UserID: userID}
+	var fields []byte
+	err := r.db.QueryRowContext(ctx, `
+		SELECT template, fields, updated_at
+		FROM label_settings
+		WHERE user_id = $1
+	`, userID).Scan(&settings.Template, &fields, &settings.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return settings, ErrNotFound
+	} else if err != nil {
+		return settings, err
+	}
+
+	if err := json.Unmarshal(fields, &settings.Fields); err != nil {
+		return settings, fmt.Errorf("ошибка разбора полей этикетки: %w", err)
+	}
+	return settings, nil
+}
+
+// SaveLabelSettings сохраняет шаблон этикеток пользователя и заполняет время изменения
+func (r *Repository) SaveLabelSettings(ctx context.Context, settings *models.LabelSettings) error {
+	fields, err := json.Marshal(settings.Fields)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации полей этикетки: %w", err)
+	}
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO label_settings (user_id, template, fields)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET template = EXCLUDED.template,
+			fields = EXCLUDED.fields,
+			updated_at = NOW()
+		RETURNING updated_at
+	`, settings.UserID, settings.Template, fields).Scan(&settings.UpdatedAt)
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AcquireLease захватывает аренду name для владельца owner на срок ttl или продлевает ее,
+// если owner уже владеет арендой. Аренду другого владельца можно захватить только после
+// истечения ее срока. Сроки отсчитываются по часам БД, чтобы расхождение часов экземпляров
+// не влияло на выбор владельца. Возвращает false, если аренда принадлежит другому владельцу.
+func (r *Repository) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	var holder string
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO leases (name, owner, acquired_at, expires_at)
+		VALUES ($1, $2, NOW(), NOW() + make_interval(secs => $3))
+		ON CONFLICT (name) DO UPDATE SET
+			owner = EXCLUDED.owner,
+			acquired_at = CASE WHEN leases.owner = EXCLUDED.owner THEN leases.acquired_at ELSE EXCLUDED.acquired_at END,
+			expires_at = EXCLUDED.expires_at
+		WHERE leases.owner = EXCLUDED.owner OR leases.expires_at < NOW()
+		RETURNING owner
+	`, name, owner, ttl.Seconds()).Scan(&holder)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return holder == owner, nil
+}
+
+// ReleaseLease освобождает аренду, если ею владеет owner, чтобы ее сразу мог захватить
+// другой экземпляр
+func (r *Repository) ReleaseLease(ctx context.Context, name, owner string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM leases WHERE name = $1 AND owner = $2", name, owner)
+	return err
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"project-znak/internal/models"
+)
+
+// UserMerge - итог объединения пользователей
+type UserMerge struct {
+	Moved      map[string]int64 // Число перенесенных записей по таблицам
+	KeyHashes  []string         // Хэши перенесенных API ключей для сброса кэша
+	TelegramID int64            // telegram_id объединенного пользователя, 0 - не привязан
+}
+
+// Таблицы, записи которых переносятся к объединенному пользователю целиком
+var mergeTables = []struct{ table, column string }{
+	{"orders", "user_id"},
+	{"payments", "user_id"},
+	{"invoices", "user_id"},
+	{"balance_transactions", "user_id"},
+	{"kiz_requests", "user_id"},
+	{"kiz_reservations", "user_id"},
+	{"introduction_documents", "user_id"},
+	{"retirement_documents", "user_id"},
+	{"upd_documents", "user_id"},
+	{"incoming_upd_documents", "processed_by"},
+	{"wildberries_bindings", "user_id"},
+	{"ozon_submissions", "user_id"},
+	{"confirmations", "user_id"},
+	{"data_exports", "user_id"},
+	{"outbox", "user_id"},
+	{"user_invitations", "created_by"},
+	{"user_invitations", "accepted_by"},
+	{"order_templates", "user_id"},
+	{"order_schedules", "user_id"},
+	{"support_tickets", "user_id"},
+}
+
+// Настройки, которые хранятся по одной записи на пользователя: переносятся, только если
+// у объединенного пользователя их нет
+var mergeSettings = []string{
+	"notification_preferences",
+	"report_settings",
+	"label_settings",
+	"wildberries_tokens",
+	"ozon_credentials",
+	"carts",
+}
+
+// MergeUsers переносит заказы, платежи, бонусный баланс, документы, запросы КИЗ, API ключи,
+// настройки и членство в организациях пользователя sourceID к пользователю targetID и удаляет
+// sourceID. Незаполненные поля профиля targetID заполняются данными sourceID. Если
+// useSourceTelegram, к объединенному пользователю привязывается аккаунт Telegram sourceID.
+// Возвращает ErrNotFound, если одного из пользователей нет или он удален, и
+// ErrMergePartners, если оба пользователя - партнеры.
+func (r *Repository) MergeUsers(ctx context.Context, sourceID, targetID int, useSourceTelegram bool) (*UserMerge, error) {
+	merge := &UserMerge{Moved: make(map[string]int64)}
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		lock := func(userID int, telegramID *sql.NullInt64, referralCode *sql.NullString) error {
+			err := tx.QueryRowContext(ctx, `
+				SELECT telegram_id, referral_code FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+			`, userID).Scan(telegramID, referralCode)
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+		var sourceTelegram, targetTelegram sql.NullInt64
+		var sourceReferral, targetReferral sql.NullString
+		if err := lock(sourceID, &sourceTelegram, &sourceReferral); err != nil {
+			return err
+		}
+		if err := lock(targetID, &targetTelegram, &targetReferral); err != nil {
+			return err
+		}
+
+		var partners int
+		if err := tx.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM partners WHERE user_id IN ($1, $2)", sourceID, targetID).Scan(&partners); err != nil {
+			return fmt.Errorf("ошибка проверки партнеров: %w", err)
+		}
+		if partners > 1 {
+			return ErrMergePartners
+		}
+
+		exec := func(name, query string) error {
+			result, err := tx.ExecContext(ctx, query, sourceID, targetID)
+			if err != nil {
+				return fmt.Errorf("ошибка объединения пользователей (%s): %w", name, err)
+			}
+			if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+				merge.Moved[name] += rows
+			}
+			return nil
+		}
+
+		for _, t := range mergeTables {
+			if err := exec(t.table, fmt.Sprintf("UPDATE %s SET %s = $2 WHERE %s = $1", t.table, t.column, t.column)); err != nil {
+				return err
+			}
+		}
+		for _, table := range mergeSettings {
+			if err := exec(table, fmt.Sprintf(`
+				UPDATE %s SET user_id = $2
+				WHERE user_id = $1 AND NOT EXISTS (SELECT 1 FROM %s WHERE user_id = $2)
+			`, table, table)); err != nil {
+				return err
+			}
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE api_keys SET user_id = $2 WHERE user_id = $1 RETURNING key_hash
+		`, sourceID, targetID)
+		if err != nil {
+			return fmt.Errorf("ошибка переноса API ключей: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var keyHash string
+			if err := rows.Scan(&keyHash); err != nil {
+				return fmt.Errorf("ошибка переноса API ключей: %w", err)
+			}
+			merge.KeyHashes = append(merge.KeyHashes, keyHash)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("ошибка переноса API ключей: %w", err)
+		}
+		rows.Close()
+		if len(merge.KeyHashes) > 0 {
+			merge.Moved["api_keys"] = int64(len(merge.KeyHashes))
+		}
+
+		// Владелец организации остается владельцем после объединения; приглашение одного
+		// из пользователей другим теряет смысл
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE organization_members SET role = $3
+			WHERE user_id = $2 AND role <> $3 AND organization_id IN (
+				SELECT organization_id FROM organization_members WHERE user_id = $1 AND role = $3)
+		`, sourceID, targetID, models.OrgRoleOwner); err != nil {
+			return fmt.Errorf("ошибка объединения ролей в организациях: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM referrals
+			WHERE (referrer_id = $1 AND referred_id = $2) OR (referrer_id = $2 AND referred_id = $1)
+		`, sourceID, targetID); err != nil {
+			return fmt.Errorf("ошибка объединения приглашений: %w", err)
+		}
+
+		steps := []struct{ name, query string }{
+			{"organization_members", `
+				INSERT INTO organization_members (organization_id, user_id, role, created_at)
+				SELECT organization_id, $2, role, created_at FROM organization_members WHERE user_id = $1
+				ON CONFLICT DO NOTHING`},
+			{"partners", `UPDATE partners SET user_id = $2 WHERE user_id = $1`},
+			{"referrals", `UPDATE referrals SET referrer_id = $2 WHERE referrer_id = $1`},
+			{"referrals", `
+				UPDATE referrals SET referred_id = $2
+				WHERE referred_id = $1 AND NOT EXISTS (SELECT 1 FROM referrals WHERE referred_id = $2)`},
+			{"usage_counters", `
+				INSERT INTO usage_counters (user_id, metric, period_start, used)
+				SELECT $2, metric, period_start, used FROM usage_counters WHERE user_id = $1
+				ON CONFLICT (user_id, metric, period_start) DO UPDATE SET used = usage_counters.used + excluded.used`},
+			{"reports", `
+				UPDATE reports SET user_id = $2
+				WHERE user_id = $1 AND NOT EXISTS (SELECT 1 FROM reports t
+					WHERE t.user_id = $2 AND t.frequency = reports.frequency AND t.period_start = reports.period_start)`},
+			{"ozon_sku_mappings", `
+				UPDATE ozon_sku_mappings SET user_id = $2
+				WHERE user_id = $1 AND (organization_id IS NOT NULL OR NOT EXISTS (SELECT 1 FROM ozon_sku_mappings t
+					WHERE t.user_id = $2 AND t.organization_id IS NULL AND t.sku = ozon_sku_mappings.sku))`},
+		}
+		for _, step := range steps {
+			if err := exec(step.name, step.query); err != nil {
+				return err
+			}
+		}
+
+		// Незаполненные поля профиля берутся у присоединяемого пользователя
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE users SET
+				email = COALESCE(NULLIF(email, ''), (SELECT email FROM users WHERE id = $1)),
+				first_name = COALESCE(first_name, (SELECT first_name FROM users WHERE id = $1)),
+				last_name = COALESCE(last_name, (SELECT last_name FROM users WHERE id = $1)),
+				middle_name = COALESCE(middle_name, (SELECT middle_name FROM users WHERE id = $1)),
+				username = COALESCE(username, (SELECT username FROM users WHERE id = $1)),
+				organization_name = COALESCE(organization_name, (SELECT organization_name FROM users WHERE id = $1)),
+				plan = COALESCE(plan, (SELECT plan FROM users WHERE id = $1)),
+				language = COALESCE(language, (SELECT language FROM users WHERE id = $1)),
+				timezone = COALESCE(timezone, (SELECT timezone FROM users WHERE id = $1)),
+				is_admin = is_admin OR (SELECT is_admin FROM users WHERE id = $1)
+			WHERE id = $2
+		`, sourceID, targetID); err != nil {
+			return fmt.Errorf("ошибка объединения профилей: %w", err)
+		}
+
+		// Оставшиеся записи присоединяемого пользователя - настройки и членство, которые уже
+		// есть у объединенного, - удаляются вместе с ним
+		for _, query := range []string{
+			"DELETE FROM ozon_sku_mappings WHERE user_id = $1",
+			"DELETE FROM users WHERE id = $1",
+		} {
+			if _, err := tx.ExecContext(ctx, query, sourceID); err != nil {
+				return fmt.Errorf("ошибка удаления присоединенного пользователя: %w", err)
+			}
+		}
+
+		telegramID, referralCode := targetTelegram, targetReferral
+		if useSourceTelegram && sourceTelegram.Valid {
+			telegramID = sourceTelegram
+		}
+		if !referralCode.Valid {
+			referralCode = sourceReferral
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE users SET telegram_id = $1, referral_code = $2 WHERE id = $3
+		`, telegramID, referralCode, targetID); err != nil {
+			return fmt.Errorf("ошибка привязки аккаунта Telegram: %w", err)
+		}
+		merge.TelegramID = telegramID.Int64
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE kiz_requests SET telegram_id = $1, updated_at = NOW() WHERE user_id = $2", merge.TelegramID, targetID); err != nil {
+			return fmt.Errorf("ошибка обновления запросов КИЗ: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merge, nil
+}
@@ -0,0 +1,959 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"project-znak/internal/models"
+)
+
+// Migrate создает таблицы и индексы, если их нет, переносит данные прежних версий схемы
+// и заполняет роли по умолчанию
+func (r *Repository) Migrate(ctx context.Context) error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS users (
+			id SERIAL PRIMARY KEY,
+			telegram_id BIGINT UNIQUE,
+			inn TEXT NOT NULL,
+			email TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			last_active TIMESTAMP NOT NULL DEFAULT NOW(),
+			api_key TEXT UNIQUE,
+			organization_name TEXT,
+			is_admin BOOLEAN NOT NULL DEFAULT FALSE
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			key_hash TEXT UNIQUE NOT NULL,
+			prefix TEXT NOT NULL,
+			label TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			last_used_at TIMESTAMP,
+			expires_at TIMESTAMP,
+			revoked_at TIMESTAMP
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS notification_preferences (
+			user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			kiz_files BOOLEAN NOT NULL DEFAULT TRUE,
+			payment_receipts BOOLEAN NOT NULL DEFAULT TRUE,
+			failures BOOLEAN NOT NULL DEFAULT TRUE,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS wildberries_tokens (
+			user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			token TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS wildberries_bindings (
+			id BIGSERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id),
+			organization_id INT REFERENCES organizations(id),
+			supply_id TEXT NOT NULL,
+			order_id BIGINT NOT NULL,
+			barcode TEXT,
+			gtin TEXT,
+			code TEXT,
+			status TEXT NOT NULL,
+			error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS ozon_credentials (
+			user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			client_id TEXT NOT NULL,
+			api_key TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS ozon_sku_mappings (
+			id SERIAL PRIMARY KEY,
+			user_id INT REFERENCES users(id) ON DELETE SET NULL,
+			organization_id INT REFERENCES organizations(id) ON DELETE CASCADE,
+			sku BIGINT NOT NULL,
+			gtin TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS ozon_submissions (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id),
+			organization_id INT REFERENCES organizations(id),
+			posting_number TEXT NOT NULL,
+			status TEXT NOT NULL,
+			codes JSONB NOT NULL,
+			error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS upd_documents (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id),
+			organization_id INT NOT NULL REFERENCES organizations(id),
+			number TEXT NOT NULL,
+			document_date DATE NOT NULL,
+			buyer_inn TEXT NOT NULL,
+			buyer_kpp TEXT,
+			buyer_name TEXT NOT NULL,
+			items JSONB NOT NULL,
+			total NUMERIC(12,2) NOT NULL,
+			provider TEXT NOT NULL,
+			external_id TEXT NOT NULL,
+			file_name TEXT NOT NULL,
+			content BYTEA NOT NULL,
+			signature BYTEA NOT NULL,
+			status TEXT NOT NULL,
+			comment TEXT,
+			status_checks INT NOT NULL DEFAULT 0,
+			next_status_check_at TIMESTAMP,
+			processed_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS incoming_upd_documents (
+			id SERIAL PRIMARY KEY,
+			organization_id INT NOT NULL REFERENCES organizations(id),
+			provider TEXT NOT NULL,
+			external_id TEXT NOT NULL,
+			file_name TEXT NOT NULL,
+			content BYTEA NOT NULL,
+			number TEXT NOT NULL,
+			document_date DATE NOT NULL,
+			seller_inn TEXT NOT NULL,
+			seller_kpp TEXT,
+			seller_name TEXT NOT NULL,
+			items JSONB NOT NULL,
+			total NUMERIC(12,2) NOT NULL,
+			status TEXT NOT NULL DEFAULT 'new',
+			comment TEXT,
+			acceptance_ids JSONB,
+			processed_by INT REFERENCES users(id),
+			processed_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE (provider, external_id)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS report_settings (
+			user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			frequency TEXT NOT NULL DEFAULT 'off',
+			telegram BOOLEAN NOT NULL DEFAULT TRUE,
+			email BOOLEAN NOT NULL DEFAULT TRUE,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS reports (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			frequency TEXT NOT NULL,
+			period_start TIMESTAMP NOT NULL,
+			period_end TIMESTAMP NOT NULL,
+			summary JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE (user_id, frequency, period_start)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS label_settings (
+			user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			template TEXT NOT NULL,
+			fields JSONB NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS organizations (
+			id SERIAL PRIMARY KEY,
+			inn TEXT UNIQUE NOT NULL,
+			name TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS organization_members (
+			organization_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role TEXT NOT NULL DEFAULT 'viewer',
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (organization_id, user_id)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS roles (
+			name TEXT PRIMARY KEY,
+			description TEXT
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS role_permissions (
+			role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+			permission TEXT NOT NULL,
+			PRIMARY KEY (role, permission)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			actor_user_id INT,
+			telegram_id BIGINT,
+			action TEXT NOT NULL,
+			entity_type TEXT NOT NULL,
+			entity_id TEXT NOT NULL,
+			ip TEXT,
+			before_data JSONB,
+			after_data JSONB,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		// Журнал аудита доступен только для добавления записей
+		`CREATE OR REPLACE FUNCTION audit_log_immutable() RETURNS TRIGGER AS $$
+		BEGIN
+			RAISE EXCEPTION 'журнал аудита доступен только для добавления записей';
+		END;
+		$$ LANGUAGE plpgsql;`,
+		`DROP TRIGGER IF EXISTS audit_log_no_modify ON audit_log;`,
+		`CREATE TRIGGER audit_log_no_modify BEFORE UPDATE OR DELETE ON audit_log
+			FOR EACH ROW EXECUTE FUNCTION audit_log_immutable();`,
+
+		`CREATE TABLE IF NOT EXISTS orders (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id),
+			total_amount DECIMAL(10,2) NOT NULL,
+			status TEXT NOT NULL DEFAULT 'created',
+			payment_id TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS order_items (
+			id SERIAL PRIMARY KEY,
+			order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+			gtin VARCHAR(14) NOT NULL,
+			quantity INT NOT NULL,
+			price DECIMAL(10,2),
+			product_name TEXT,
+			product_group TEXT
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS kiz_requests (
+			id SERIAL PRIMARY KEY,
+			user_id INT REFERENCES users(id),
+			telegram_id BIGINT NOT NULL,
+			inn TEXT NOT NULL,
+			request_time TIMESTAMP NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			request_data JSONB
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS kiz_results (
+			id SERIAL PRIMARY KEY,
+			request_id INT REFERENCES kiz_requests(id),
+			kiz_data JSONB,
+			file_path TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS kiz_codes (
+			id BIGSERIAL PRIMARY KEY,
+			code TEXT UNIQUE NOT NULL,
+			gtin TEXT NOT NULL,
+			request_id INT NOT NULL REFERENCES kiz_requests(id),
+			status TEXT NOT NULL DEFAULT 'issued',
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS kiz_reservations (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id),
+			organization_id INT REFERENCES organizations(id),
+			reference TEXT,
+			status TEXT NOT NULL DEFAULT 'active',
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			released_at TIMESTAMP
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS payments (
+			id SERIAL PRIMARY KEY,
+			user_id INT REFERENCES users(id),
+			amount DECIMAL(10,2) NOT NULL,
+			currency TEXT NOT NULL DEFAULT 'RUB',
+			status TEXT NOT NULL DEFAULT 'pending',
+			robokassa_id TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			completed_at TIMESTAMP
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS introduction_documents (
+			id SERIAL PRIMARY KEY,
+			order_id INT NOT NULL REFERENCES orders(id),
+			organization_id INT REFERENCES organizations(id),
+			user_id INT NOT NULL REFERENCES users(id),
+			participant_inn TEXT NOT NULL,
+			production_type TEXT NOT NULL,
+			production_date DATE NOT NULL,
+			declaration_number TEXT,
+			declaration_date DATE,
+			codes JSONB NOT NULL,
+			status TEXT NOT NULL DEFAULT 'draft',
+			external_id TEXT,
+			error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			submitted_at TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS retirement_documents (
+			id SERIAL PRIMARY KEY,
+			organization_id INT REFERENCES organizations(id),
+			user_id INT NOT NULL REFERENCES users(id),
+			participant_inn TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			action_date DATE NOT NULL,
+			primary_document_number TEXT,
+			primary_document_date DATE,
+			codes JSONB NOT NULL,
+			status TEXT NOT NULL DEFAULT 'draft',
+			external_id TEXT,
+			error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			submitted_at TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS invoices (
+			id SERIAL PRIMARY KEY,
+			number TEXT UNIQUE NOT NULL,
+			order_id INT NOT NULL REFERENCES orders(id),
+			organization_id INT REFERENCES organizations(id),
+			user_id INT NOT NULL REFERENCES users(id),
+			payment_id INT REFERENCES payments(id),
+			amount DECIMAL(10,2) NOT NULL,
+			status TEXT NOT NULL DEFAULT 'issued',
+			due_date DATE NOT NULL,
+			payment_order_number TEXT,
+			paid_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS fiscal_receipts (
+			id SERIAL PRIMARY KEY,
+			payment_id INT UNIQUE NOT NULL REFERENCES payments(id),
+			provider TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			external_id TEXT,
+			provider_id TEXT,
+			attempts INT NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			error TEXT,
+			fiscal_document_number TEXT,
+			fiscal_document_attribute TEXT,
+			fn_number TEXT,
+			receipt_number TEXT,
+			shift_number TEXT,
+			registration_number TEXT,
+			fns_site TEXT,
+			registered_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS data_exports (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			status TEXT NOT NULL DEFAULT 'pending',
+			file_path TEXT,
+			error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			completed_at TIMESTAMP
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id BIGSERIAL PRIMARY KEY,
+			channel TEXT NOT NULL,
+			user_id INT,
+			payload JSONB NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			sent_at TIMESTAMP
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS tariffs (
+			product_group TEXT PRIMARY KEY,
+			unit_price DECIMAL(10,2) NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS partners (
+			id SERIAL PRIMARY KEY,
+			user_id INT UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			revenue_share DECIMAL(5,2) NOT NULL DEFAULT 0,
+			last_report_period DATE,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS referrals (
+			id SERIAL PRIMARY KEY,
+			referrer_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			referred_id INT UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			first_payment_id INT REFERENCES payments(id) ON DELETE SET NULL,
+			paid_at TIMESTAMP,
+			bonus_amount DECIMAL(12,2),
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		// Операции по бонусному балансу; (kind, reference) исключает повторное начисление
+		`CREATE TABLE IF NOT EXISTS balance_transactions (
+			id BIGSERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			amount DECIMAL(12,2) NOT NULL,
+			currency TEXT NOT NULL DEFAULT 'RUB',
+			kind TEXT NOT NULL,
+			reference TEXT NOT NULL,
+			description TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE (kind, reference)
+		);`,
+
+		// Неудачные попытки авторизации и регистрации по адресам клиентов
+		`CREATE TABLE IF NOT EXISTS auth_failures (
+			scope VARCHAR(20) NOT NULL,
+			ip TEXT NOT NULL,
+			failures INT NOT NULL DEFAULT 0,
+			lockouts INT NOT NULL DEFAULT 0,
+			window_start TIMESTAMP NOT NULL,
+			locked_until TIMESTAMP,
+			PRIMARY KEY (scope, ip)
+		);`,
+
+		// Подтверждения операций кодом из Telegram; код хранится только в виде хэша
+		`CREATE TABLE IF NOT EXISTS confirmations (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			action VARCHAR(50) NOT NULL,
+			subject TEXT NOT NULL,
+			description TEXT NOT NULL,
+			code_hash VARCHAR(64) NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			expires_at TIMESTAMP NOT NULL,
+			approved_at TIMESTAMP,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS plans (
+			name TEXT PRIMARY KEY,
+			title TEXT NOT NULL,
+			monthly_codes BIGINT NOT NULL DEFAULT 0,
+			daily_requests BIGINT NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		// Потребление по квотам тарифного плана: счетчик метрики за период с начала period_start
+		`CREATE TABLE IF NOT EXISTS usage_counters (
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			metric TEXT NOT NULL,
+			period_start TIMESTAMP NOT NULL,
+			used BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (user_id, metric, period_start)
+		);`,
+
+		// Архив запросов к Честному ЗНАКу и СУЗ и ответов на них: тела и заголовки
+		// с подписью в том виде, в котором они переданы по сети
+		`CREATE TABLE IF NOT EXISTS api_exchanges (
+			id BIGSERIAL PRIMARY KEY,
+			system TEXT NOT NULL,
+			subject_type TEXT,
+			subject_id INT,
+			method TEXT NOT NULL,
+			url TEXT NOT NULL,
+			request_headers JSONB,
+			request_body BYTEA,
+			status_code INT NOT NULL DEFAULT 0,
+			response_headers JSONB,
+			response_body BYTEA,
+			truncated BOOLEAN NOT NULL DEFAULT FALSE,
+			error TEXT,
+			duration_ms INT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		// Подписанные квитанции Честного ЗНАКа о результате обработки документов в исходном виде
+		`CREATE TABLE IF NOT EXISTS document_receipts (
+			id BIGSERIAL PRIMARY KEY,
+			document_type TEXT NOT NULL,
+			document_id INT NOT NULL,
+			ticket TEXT NOT NULL,
+			content BYTEA NOT NULL,
+			content_type TEXT NOT NULL,
+			sha256 TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE (document_type, document_id)
+		);`,
+
+		// Приглашения клиентов, загруженных администратором; хранится хэш кода приглашения
+		`CREATE TABLE IF NOT EXISTS user_invitations (
+			id SERIAL PRIMARY KEY,
+			token_hash TEXT UNIQUE NOT NULL,
+			inn TEXT NOT NULL,
+			email TEXT,
+			username TEXT,
+			partner_id INT REFERENCES partners(id) ON DELETE SET NULL,
+			created_by INT REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMP NOT NULL,
+			accepted_by INT REFERENCES users(id) ON DELETE SET NULL,
+			accepted_at TIMESTAMP
+		);`,
+
+		// Шаблоны заказов: GTIN и количество кодов для повторяющихся заказов
+		`CREATE TABLE IF NOT EXISTS order_templates (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			organization_id INT REFERENCES organizations(id) ON DELETE SET NULL,
+			name TEXT NOT NULL,
+			product_group TEXT,
+			items JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		// Корзины пользователей: позиции будущего заказа
+		`CREATE TABLE IF NOT EXISTS carts (
+			user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			organization_id INT REFERENCES organizations(id) ON DELETE SET NULL,
+			product_group TEXT,
+			items JSONB NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		// Расписания повторяющихся заказов; next_run_at пуст у приостановленных
+		`CREATE TABLE IF NOT EXISTS order_schedules (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			organization_id INT REFERENCES organizations(id) ON DELETE SET NULL,
+			name TEXT NOT NULL,
+			cron TEXT NOT NULL,
+			product_group TEXT,
+			items JSONB NOT NULL,
+			status TEXT NOT NULL DEFAULT 'active',
+			next_run_at TIMESTAMP,
+			last_run_at TIMESTAMP,
+			last_order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+			last_error TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			version INT NOT NULL DEFAULT 1
+		);`,
+
+		// Аренды для координации экземпляров сервиса: фоновые задачи выполняет владелец
+		// аренды leader, пока продлевает ее до expires_at
+		`CREATE TABLE IF NOT EXISTS leases (
+			name TEXT PRIMARY KEY,
+			owner TEXT NOT NULL,
+			acquired_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMP NOT NULL
+		);`,
+
+		// Сеансы имперсонации: администратор поддержки вызывает API от имени пользователя
+		// по временному токену; хранится только хэш токена
+		`CREATE TABLE IF NOT EXISTS impersonations (
+			id SERIAL PRIMARY KEY,
+			admin_user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash TEXT UNIQUE NOT NULL,
+			reason TEXT NOT NULL,
+			allow_write BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP
+		);`,
+		// Администратор, выполнивший операцию от имени пользователя
+		`ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS impersonator_id INT;`,
+
+		// Объявления для пользователей. Рассылка в Telegram ставится в outbox порциями
+		// по возрастанию ID пользователя; broadcast_cursor - последний ID, которому она поставлена
+		`CREATE TABLE IF NOT EXISTS announcements (
+			id SERIAL PRIMARY KEY,
+			title TEXT NOT NULL,
+			text TEXT NOT NULL,
+			level TEXT NOT NULL DEFAULT 'info',
+			starts_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			ends_at TIMESTAMP,
+			broadcast BOOLEAN NOT NULL DEFAULT FALSE,
+			broadcast_cursor INT NOT NULL DEFAULT 0,
+			broadcast_count INT NOT NULL DEFAULT 0,
+			broadcast_done_at TIMESTAMP,
+			created_by INT REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+		// Согласие на рассылку объявлений в Telegram
+		`ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS announcements BOOLEAN NOT NULL DEFAULT FALSE;`,
+
+		// Обращения пользователей в поддержку
+		`CREATE TABLE IF NOT EXISTS support_tickets (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			kiz_request_id INT REFERENCES kiz_requests(id) ON DELETE SET NULL,
+			payment_id INT REFERENCES payments(id) ON DELETE SET NULL,
+			description TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'open',
+			reply TEXT,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		// Состояние компонентов для страницы статуса: последний результат проверки
+		// и инциденты - периоды, когда компонент был недоступен или работал с ограничениями
+		`CREATE TABLE IF NOT EXISTS status_components (
+			component TEXT PRIMARY KEY,
+			status TEXT NOT NULL,
+			backlog INT NOT NULL DEFAULT 0,
+			checked_at TIMESTAMP NOT NULL,
+			changed_at TIMESTAMP NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS status_incidents (
+			id SERIAL PRIMARY KEY,
+			component TEXT NOT NULL,
+			status TEXT NOT NULL,
+			message TEXT,
+			started_at TIMESTAMP NOT NULL,
+			resolved_at TIMESTAMP
+		);`,
+
+		// Связи платежей и запросов КИЗ с заказами
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS order_id INT REFERENCES orders(id) ON DELETE SET NULL;`,
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS order_id INT REFERENCES orders(id) ON DELETE SET NULL;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS organization_name TEXT;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;`,
+		// Поля профиля пользователя (ФИО и имя пользователя Telegram)
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS first_name TEXT;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS last_name TEXT;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS middle_name TEXT;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS username TEXT;`,
+		`ALTER TABLE order_items ADD COLUMN IF NOT EXISTS product_name TEXT;`,
+		`ALTER TABLE order_items ADD COLUMN IF NOT EXISTS product_group TEXT;`,
+		// Привязка заказов, платежей и запросов КИЗ к организациям
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations(id);`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations(id);`,
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS organization_id INT REFERENCES organizations(id);`,
+		// Квитанции Честного ЗНАКа и состояние опроса статусов отправленных документов
+		`ALTER TABLE introduction_documents ADD COLUMN IF NOT EXISTS ticket TEXT;`,
+		`ALTER TABLE introduction_documents ADD COLUMN IF NOT EXISTS processed_at TIMESTAMP;`,
+		`ALTER TABLE introduction_documents ADD COLUMN IF NOT EXISTS status_checks INT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE introduction_documents ADD COLUMN IF NOT EXISTS next_status_check_at TIMESTAMP;`,
+		`ALTER TABLE retirement_documents ADD COLUMN IF NOT EXISTS ticket TEXT;`,
+		`ALTER TABLE retirement_documents ADD COLUMN IF NOT EXISTS processed_at TIMESTAMP;`,
+		`ALTER TABLE retirement_documents ADD COLUMN IF NOT EXISTS status_checks INT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE retirement_documents ADD COLUMN IF NOT EXISTS next_status_check_at TIMESTAMP;`,
+		// Товарные группы заказов, запросов КИЗ и документов
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS product_group TEXT;`,
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS product_group TEXT;`,
+		`ALTER TABLE introduction_documents ADD COLUMN IF NOT EXISTS product_group TEXT;`,
+		`ALTER TABLE retirement_documents ADD COLUMN IF NOT EXISTS product_group TEXT;`,
+
+		// Сообщение Telegram, в котором пользователю доставлен файл с кодами
+		`ALTER TABLE kiz_results ADD COLUMN IF NOT EXISTS telegram_message_id BIGINT;`,
+
+		// Сверка платежей с Robokassa
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS reconciled_at TIMESTAMP;`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS needs_review BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS review_reason TEXT;`,
+
+		// Платежный провайдер, сессия оплаты Stripe и сумма в валюте расчетов; платежи,
+		// созданные при подтверждении оплаты по счету, отмечаются отдельным провайдером
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT 'robokassa';`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS external_id TEXT;`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS settlement_currency TEXT;`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS settlement_amount DECIMAL(12,2);`,
+		`UPDATE payments SET provider = 'invoice'
+			WHERE provider = 'robokassa' AND id IN (SELECT payment_id FROM invoices WHERE payment_id IS NOT NULL);`,
+
+		// Реквизиты организаций для счетов на оплату
+		`ALTER TABLE organizations ADD COLUMN IF NOT EXISTS kpp TEXT;`,
+		`ALTER TABLE organizations ADD COLUMN IF NOT EXISTS address TEXT;`,
+		`ALTER TABLE organizations ADD COLUMN IF NOT EXISTS bank_name TEXT;`,
+		`ALTER TABLE organizations ADD COLUMN IF NOT EXISTS bik TEXT;`,
+		`ALTER TABLE organizations ADD COLUMN IF NOT EXISTS bank_account TEXT;`,
+		`ALTER TABLE organizations ADD COLUMN IF NOT EXISTS corr_account TEXT;`,
+
+		// Удаление аккаунтов: обезличенный пользователь хранится до окончания срока хранения
+		// финансовых документов, вместо telegram_id сохраняется его хэш
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS telegram_id_hash TEXT;`,
+		`ALTER TABLE users ALTER COLUMN telegram_id DROP NOT NULL;`,
+		// По истечении срока хранения пользователь окончательно обезличивается, но запись
+		// сохраняется: на нее ссылаются заказы и счета
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS purged_at TIMESTAMP;`,
+
+		// Субаккаунты партнеров: организации клиентов, созданные партнером
+		`ALTER TABLE organizations ADD COLUMN IF NOT EXISTS partner_id INT REFERENCES partners(id) ON DELETE SET NULL;`,
+
+		// Реферальный код пользователя; выдается при первом запросе реферальной ссылки
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS referral_code TEXT UNIQUE;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS plan TEXT REFERENCES plans(name);`,
+		// Язык сообщений API и Telegram-бота, выбранный пользователем
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS language TEXT;`,
+		// Часовой пояс IANA для отображения времени пользователю, например Europe/Moscow
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone TEXT;`,
+
+		// Пользователь, созданный вместе с приглашением; аккаунт Telegram привязывается к нему
+		// при регистрации по приглашению
+		`ALTER TABLE user_invitations ADD COLUMN IF NOT EXISTS user_id INT REFERENCES users(id) ON DELETE CASCADE;`,
+
+		// Устройство, с которого API ключ использовался последним
+		`ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS last_ip TEXT;`,
+		`ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS last_user_agent TEXT;`,
+
+		// Ошибки запросов КИЗ: причина, ответ Честного ЗНАКа и число попыток
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS error TEXT;`,
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS error_payload TEXT;`,
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS failed_at TIMESTAMP;`,
+
+		// Ход выполнения запроса КИЗ: запрошено, выпущено и получено кодов, сформировано файлов.
+		// Для выполненных ранее запросов заполняется по сохраненным кодам.
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS codes_requested INT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS codes_emitted INT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS codes_downloaded INT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS files_generated INT NOT NULL DEFAULT 0;`,
+		`UPDATE kiz_requests SET codes_requested = (SELECT COUNT(*) FROM kiz_codes c WHERE c.request_id = kiz_requests.id)
+			WHERE status IN ('completed', 'received') AND codes_requested = 0;`,
+		`UPDATE kiz_requests SET codes_emitted = codes_requested, codes_downloaded = codes_requested,
+			files_generated = CASE WHEN status = 'completed' THEN 1 ELSE 0 END
+			WHERE status IN ('completed', 'received') AND codes_requested > 0 AND codes_downloaded = 0;`,
+
+		// Резерв кодов для отгрузки и время изменения статуса кода
+		`ALTER TABLE kiz_codes ADD COLUMN IF NOT EXISTS reservation_id INT REFERENCES kiz_reservations(id);`,
+		`ALTER TABLE kiz_codes ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;`,
+
+		// Цена, плата Честного ЗНАКа за код и маржа позиции заказа. В базах, созданных до
+		// появления цены в order_items, колонки price нет.
+		`ALTER TABLE order_items ADD COLUMN IF NOT EXISTS price DECIMAL(10,2);`,
+		`ALTER TABLE order_items ADD COLUMN IF NOT EXISTS fee_cost DECIMAL(10,2);`,
+		`ALTER TABLE order_items ADD COLUMN IF NOT EXISTS margin DECIMAL(12,2);`,
+		`ALTER TABLE tariffs ADD COLUMN IF NOT EXISTS fee_cost DECIMAL(10,2);`,
+
+		// Версия строки для оптимистической блокировки: увеличивается при каждой смене статуса
+		`ALTER TABLE orders ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;`,
+		`ALTER TABLE payments ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;`,
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;`,
+
+		// Контрольные точки эмиссии кодов по партиям запроса КИЗ: заказ СУЗ, закрытые буферы
+		// и полученные порции кодов. После сбоя эмиссия продолжается с них без повторного
+		// заказа кодов; после выполнения запроса контрольные точки удаляются.
+		`CREATE TABLE IF NOT EXISTS kiz_request_batches (
+			request_id INT NOT NULL REFERENCES kiz_requests(id) ON DELETE CASCADE,
+			batch INT NOT NULL,
+			products JSONB NOT NULL,
+			oms_order_id TEXT,
+			closed_gtins JSONB NOT NULL DEFAULT '[]',
+			completed BOOLEAN NOT NULL DEFAULT FALSE,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (request_id, batch)
+		);`,
+		`CREATE TABLE IF NOT EXISTS kiz_request_chunks (
+			request_id INT NOT NULL,
+			batch INT NOT NULL,
+			gtin TEXT NOT NULL,
+			start_offset INT NOT NULL,
+			codes JSONB NOT NULL,
+			PRIMARY KEY (request_id, batch, gtin, start_offset),
+			FOREIGN KEY (request_id, batch) REFERENCES kiz_request_batches(request_id, batch) ON DELETE CASCADE
+		);`,
+		// Время последнего подтверждения, что запрос КИЗ выполняется; запрос в статусе pending
+		// без подтверждений продолжает ведущий экземпляр
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMP;`,
+		// Время последнего изменения запроса КИЗ, которое видно в его статусе: статус, ход
+		// выполнения, ошибка, доставка файла. Подтверждения выполнения его не изменяют.
+		`ALTER TABLE kiz_requests ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;`,
+		`UPDATE kiz_requests SET updated_at = COALESCE(failed_at, request_time) WHERE updated_at IS NULL;`,
+
+		// Пакетные платежи: один платеж оплачивает несколько заказов, сумма делится между ними.
+		// Доля заказа хранится в минимальных единицах валюты платежа.
+		`CREATE TABLE IF NOT EXISTS payment_orders (
+			payment_id INT NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+			order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+			amount BIGINT NOT NULL,
+			PRIMARY KEY (payment_id, order_id)
+		);`,
+		// Журнал платежей по заказам: поступления при проведении платежа и возвраты. Записи
+		// только добавляются; остаток заказа в платеже - сумма его записей.
+		`CREATE TABLE IF NOT EXISTS payment_ledger (
+			id SERIAL PRIMARY KEY,
+			payment_id INT NOT NULL REFERENCES payments(id),
+			order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+			kind TEXT NOT NULL,
+			amount DECIMAL(12,2) NOT NULL,
+			currency TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+		// Записи журнала для платежей, проведенных до его появления
+		`INSERT INTO payment_ledger (payment_id, order_id, kind, amount, currency, created_at)
+			SELECT id, order_id, 'payment', amount, currency, COALESCE(completed_at, created_at)
+			FROM payments p
+			WHERE status IN ('completed', 'refunded')
+			  AND NOT EXISTS (SELECT 1 FROM payment_ledger l WHERE l.payment_id = p.id);`,
+		`INSERT INTO payment_ledger (payment_id, order_id, kind, amount, currency, created_at)
+			SELECT id, order_id, 'refund', -amount, currency, COALESCE(completed_at, created_at)
+			FROM payments p
+			WHERE status = 'refunded'
+			  AND NOT EXISTS (SELECT 1 FROM payment_ledger l WHERE l.payment_id = p.id AND l.kind = 'refund');`,
+
+		// Перенос выданных ранее кодов из kiz_results в kiz_codes; из повторяющихся кодов
+		// сохраняется выданный первым
+		`INSERT INTO kiz_codes (code, gtin, request_id, created_at)
+			SELECT code, CASE WHEN code ~ '^01[0-9]{14}' THEN substr(code, 3, 14) ELSE '' END,
+				res.request_id, res.created_at
+			FROM kiz_results res
+			CROSS JOIN LATERAL jsonb_array_elements_text(res.kiz_data) AS code
+			WHERE res.request_id IS NOT NULL AND jsonb_typeof(res.kiz_data) = 'array'
+			  AND NOT EXISTS (SELECT 1 FROM kiz_codes c WHERE c.request_id = res.request_id)
+			ORDER BY res.id
+			ON CONFLICT (code) DO NOTHING;`,
+
+		// Дневные сводки для аналитики; обновляются фоновой задачей, если она включена
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS analytics_revenue_daily AS ` + revenueDailyQuery + `;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_analytics_revenue_daily ON analytics_revenue_daily(day);`,
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS analytics_codes_daily AS ` + codesDailyQuery + `;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_analytics_codes_daily ON analytics_codes_daily(day, product_group);`,
+
+		// Перенос API ключей из users в api_keys: сохраняется только хэш ключа
+		`INSERT INTO api_keys (user_id, key_hash, prefix, label)
+			SELECT id, encode(sha256(convert_to(api_key, 'UTF8')), 'hex'), left(api_key, 8), 'default'
+			FROM users WHERE api_key IS NOT NULL
+			ON CONFLICT (key_hash) DO NOTHING;`,
+		`UPDATE users SET api_key = NULL WHERE api_key IS NOT NULL;`,
+
+		// Организации для пользователей, зарегистрированных до появления организаций
+		`INSERT INTO organizations (inn, name)
+			SELECT DISTINCT ON (inn) inn, organization_name FROM users ORDER BY inn, created_at
+			ON CONFLICT (inn) DO NOTHING;`,
+		`INSERT INTO organization_members (organization_id, user_id, role)
+			SELECT DISTINCT ON (o.id) o.id, u.id, 'owner'
+			FROM users u JOIN organizations o ON o.inn = u.inn
+			WHERE NOT EXISTS (SELECT 1 FROM organization_members m WHERE m.organization_id = o.id)
+			ORDER BY o.id, u.created_at
+			ON CONFLICT DO NOTHING;`,
+
+		`CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_users_deleted ON users(deleted_at) WHERE deleted_at IS NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_support_tickets_user ON support_tickets(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_status_incidents_open ON status_incidents(component) WHERE resolved_at IS NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_orders_user ON orders(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_orders_organization ON orders(organization_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_organization_members_user ON organization_members(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_organizations_partner ON organizations(partner_id) WHERE partner_id IS NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_payments_organization ON payments(organization_id, completed_at) WHERE status = 'completed';`,
+		`CREATE INDEX IF NOT EXISTS idx_referrals_referrer ON referrals(referrer_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_balance_transactions_user ON balance_transactions(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_confirmations_user ON confirmations(user_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_auth_failures_locked ON auth_failures(locked_until) WHERE locked_until IS NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity_type, entity_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_api_exchanges_subject ON api_exchanges(subject_type, subject_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_api_exchanges_created ON api_exchanges(created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_user_invitations_inn ON user_invitations(inn) WHERE accepted_at IS NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_payments_order ON payments(order_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_orders_order ON payment_orders(order_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_ledger_payment ON payment_ledger(payment_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_payment_ledger_order ON payment_ledger(order_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_payments_completed ON payments(completed_at) WHERE status = 'completed';`,
+		`CREATE INDEX IF NOT EXISTS idx_payments_transaction ON payments(provider, robokassa_id) WHERE robokassa_id IS NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_kiz_requests_order ON kiz_requests(order_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_kiz_codes_request ON kiz_codes(request_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_kiz_codes_reservation ON kiz_codes(reservation_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_kiz_codes_available ON kiz_codes(gtin, id) WHERE status = 'issued';`,
+		`CREATE INDEX IF NOT EXISTS idx_kiz_requests_failed ON kiz_requests(failed_at) WHERE status IN ('failed', 'dead');`,
+		`CREATE INDEX IF NOT EXISTS idx_invoices_order ON invoices(order_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(next_attempt_at) WHERE status = 'pending';`,
+		`CREATE INDEX IF NOT EXISTS idx_data_exports_user ON data_exports(user_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_wildberries_bindings_supply ON wildberries_bindings(supply_id, created_at);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_ozon_sku_mappings_organization ON ozon_sku_mappings(organization_id, sku) WHERE organization_id IS NOT NULL;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_ozon_sku_mappings_user ON ozon_sku_mappings(user_id, sku) WHERE organization_id IS NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_ozon_submissions_posting ON ozon_submissions(posting_number);`,
+		`CREATE INDEX IF NOT EXISTS idx_upd_documents_organization ON upd_documents(organization_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_upd_documents_status ON upd_documents(status, next_status_check_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_incoming_upd_documents_organization ON incoming_upd_documents(organization_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_fiscal_receipts_status ON fiscal_receipts(status, next_attempt_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_introduction_documents_order ON introduction_documents(order_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_introduction_documents_status ON introduction_documents(status);`,
+		`CREATE INDEX IF NOT EXISTS idx_retirement_documents_user ON retirement_documents(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_retirement_documents_status ON retirement_documents(status);`,
+		`CREATE INDEX IF NOT EXISTS idx_order_templates_user ON order_templates(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_order_schedules_user ON order_schedules(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_order_schedules_due ON order_schedules(next_run_at) WHERE status = 'active';`,
+	}
+
+	if r.sqlite {
+		queries = sqliteMigrations(queries)
+	}
+	for _, query := range queries {
+		if _, err := r.db.ExecContext(ctx, query); err != nil && !(r.sqlite && sqliteDuplicateColumn(err)) {
+			return fmt.Errorf("ошибка создания таблицы: %w", err)
+		}
+	}
+
+	if err := r.seedRolePermissions(ctx); err != nil {
+		return err
+	}
+	return r.seedPlans(ctx)
+}
+
+// Заполнение ролей и разрешений по умолчанию. Уже существующие записи не изменяются,
+// чтобы сохранить разрешения, настроенные вручную.
+func (r *Repository) seedRolePermissions(ctx context.Context) error {
+	descriptions := map[string]string{
+		models.OrgRoleOwner:      "Владелец организации",
+		models.OrgRoleAccountant: "Бухгалтер",
+		models.OrgRoleOperator:   "Оператор",
+		models.OrgRoleViewer:     "Наблюдатель",
+	}
+
+	for role, permissions := range models.DefaultRolePermissions {
+		if _, err := r.db.ExecContext(ctx,
+			"INSERT INTO roles (name, description) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING",
+			role, descriptions[role],
+		); err != nil {
+			return fmt.Errorf("ошибка создания роли %s: %w", role, err)
+		}
+
+		var seeded bool
+		if err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM role_permissions WHERE role = $1)", role).Scan(&seeded); err != nil {
+			return fmt.Errorf("ошибка проверки разрешений роли %s: %w", role, err)
+		}
+		if seeded {
+			continue
+		}
+
+		for _, permission := range permissions {
+			if _, err := r.db.ExecContext(ctx,
+				"INSERT INTO role_permissions (role, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+				role, permission,
+			); err != nil {
+				return fmt.Errorf("ошибка назначения разрешения %s роли %s: %w", permission, role, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Создание тарифных планов по умолчанию; квоты существующих планов не изменяются
+func (r *Repository) seedPlans(ctx context.Context) error {
+	for _, plan := range models.DefaultPlans {
+		if _, err := r.db.ExecContext(ctx, `
+			INSERT INTO plans (name, title, monthly_codes, daily_requests)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (name) DO NOTHING
+		`, plan.Name, plan.Title, plan.MonthlyCodes, plan.DailyRequests); err != nil {
+			return fmt.Errorf("ошибка создания тарифного плана %s: %w", plan.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"project-znak/internal/models"
+)
+
+// NotificationPreferences возвращает настройки уведомлений пользователя;
+// при их отсутствии возвращаются настройки по умолчанию
+func (r *Repository) NotificationPreferences(ctx context.Context, userID int) (models.NotificationPreferences, error) {
+	prefs := models.DefaultNotificationPreferences(userID)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT kiz_files, payment_receipts, failures, announcements, updated_at
+		FROM notification_preferences
+		WHERE user_id = $1
+	`, userID).Scan(&prefs.KIZFiles, &prefs.PaymentReceipts, &prefs.Failures, &prefs.Announcements, &prefs.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return prefs, nil
+	}
+	return prefs, err
+}
+
+// SaveNotificationPreferences сохраняет настройки уведомлений и заполняет время изменения
+func (r *Repository) SaveNotificationPreferences(ctx context.Context, prefs *models.NotificationPreferences) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO notification_preferences (user_id, kiz_files, payment_receipts, failures, announcements)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET kiz_files = EXCLUDED.kiz_files,
+			payment_receipts = EXCLUDED.payment_receipts,
+			failures = EXCLUDED.failures,
+			announcements = EXCLUDED.announcements,
+			updated_at = NOW()
+		RETURNING updated_at
+	`, prefs.UserID, prefs.KIZFiles, prefs.PaymentReceipts, prefs.Failures, prefs.Announcements).Scan(&prefs.UpdatedAt)
+}
@@ -0,0 +1,310 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+)
+
+// Условие доступа к заказу ($2 - ID пользователя): заказ создан пользователем
+// или принадлежит организации, в которой он состоит
+const orderAccessCondition = `(user_id = $2 OR organization_id IN
+	(SELECT organization_id FROM organization_members WHERE user_id = $2))`
+
+const orderColumns = `id, user_id, COALESCE(organization_id, 0), COALESCE(product_group, ''), total_amount, status,
+	COALESCE(payment_id, ''), created_at, updated_at, version`
+
+// OrderPaymentRef - платеж, связанный с заказом
+type OrderPaymentRef struct {
+	ID          int         `json:"id" xml:"id"`
+	Amount      money.Money `json:"amount" xml:"amount"`
+	Status      string      `json:"status" xml:"status"`
+	CreatedAt   time.Time   `json:"created_at" xml:"created_at"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty" xml:"completed_at,omitempty"`
+}
+
+// OrderKIZRequestRef - запрос КИЗ, связанный с заказом
+type OrderKIZRequestRef struct {
+	ID          int       `json:"id" xml:"id"`
+	Status      string    `json:"status" xml:"status"`
+	RequestTime time.Time `json:"request_time" xml:"request_time"`
+	FilePath    string    `json:"file_path,omitempty" xml:"file_path,omitempty"`
+}
+
+// OrderDetails - заказ вместе с позициями, платежами и запросами КИЗ
+type OrderDetails struct {
+	models.Order
+	Payments    []OrderPaymentRef    `json:"payments" xml:"payments>payment"`
+	KIZRequests []OrderKIZRequestRef `json:"kiz_requests" xml:"kiz_requests>kiz_request"`
+}
+
+// OrderFilter - условия выборки списка заказов. Если указана организация,
+// выбираются ее заказы, иначе - личные заказы пользователя.
+type OrderFilter struct {
+	UserID         int
+	OrganizationID int
+	Status         string
+	Limit          int
+}
+
+// Чтение заказа из строки результата запроса
+func scanOrder(scan func(dest ...any) error, order *models.Order) error {
+	return scan(&order.ID, &order.UserID, &order.OrganizationID, &order.ProductGroup, &order.TotalAmount, &order.Status,
+		&order.PaymentID, &order.CreatedAt, &order.UpdatedAt, &order.Version)
+}
+
+// CreateOrder сохраняет заказ и его позиции в одной транзакции
+func (r *Repository) CreateOrder(ctx context.Context, order *models.Order) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO orders (user_id, organization_id, product_group, total_amount, status)
+			VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4, $5)
+			RETURNING id, created_at, updated_at, version
+		`, order.UserID, order.OrganizationID, order.ProductGroup, order.TotalAmount, order.Status).Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt, &order.Version)
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения заказа: %w", err)
+		}
+
+		for i := range order.Items {
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO order_items (order_id, gtin, quantity, price, product_name, product_group, fee_cost, margin)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				RETURNING id
+			`, order.ID, order.Items[i].GTIN, order.Items[i].Quantity, order.Items[i].Price,
+				order.Items[i].ProductName, order.Items[i].ProductGroup, order.Items[i].FeeCost,
+				order.Items[i].Margin).Scan(&order.Items[i].ID)
+			if err != nil {
+				return fmt.Errorf("ошибка сохранения позиции заказа: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListOrders возвращает заказы по фильтру, начиная с последних
+func (r *Repository) ListOrders(ctx context.Context, filter OrderFilter) ([]models.Order, error) {
+	query := "SELECT " + orderColumns + " FROM orders"
+	var args []any
+	if filter.OrganizationID > 0 {
+		query += " WHERE organization_id = $1"
+		args = append(args, filter.OrganizationID)
+	} else {
+		query += " WHERE user_id = $1"
+		args = append(args, filter.UserID)
+	}
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT %d", filter.Limit)
+
+	rows, err := r.readQuery(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		var order models.Order
+		if err := scanOrder(rows.Scan, &order); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// OrderOrganizationID возвращает организацию заказа; 0, если заказ личный или не найден
+func (r *Repository) OrderOrganizationID(ctx context.Context, orderID int) (int, error) {
+	var organizationID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, "SELECT organization_id FROM orders WHERE id = $1", orderID).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return int(organizationID.Int64), err
+}
+
+// AccessibleOrder возвращает статус и организацию заказа, доступного пользователю
+func (r *Repository) AccessibleOrder(ctx context.Context, orderID, userID int) (string, int, error) {
+	var status string
+	var organizationID int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT status, COALESCE(organization_id, 0) FROM orders WHERE id = $1 AND "+orderAccessCondition,
+		orderID, userID,
+	).Scan(&status, &organizationID)
+	if err == sql.ErrNoRows {
+		return "", 0, ErrNotFound
+	}
+	return status, organizationID, err
+}
+
+// OrderDetails загружает заказ, доступный пользователю, вместе со связанными данными
+func (r *Repository) OrderDetails(ctx context.Context, orderID, userID int) (*OrderDetails, error) {
+	var details OrderDetails
+	err := scanOrder(r.db.QueryRowContext(ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE id = $1 AND "+orderAccessCondition,
+		orderID, userID,
+	).Scan, &details.Order)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	itemRows, err := r.db.QueryContext(ctx, `
+		SELECT id, gtin, quantity, COALESCE(price, 0), COALESCE(product_name, ''), COALESCE(product_group, ''),
+			fee_cost, margin
+		FROM order_items
+		WHERE order_id = $1
+		ORDER BY id
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса позиций заказа: %w", err)
+	}
+	defer itemRows.Close()
+
+	details.Items = []models.OrderItem{}
+	for itemRows.Next() {
+		var item models.OrderItem
+		var feeCost, margin sql.NullFloat64
+		if err := itemRows.Scan(&item.ID, &item.GTIN, &item.Quantity, &item.Price,
+			&item.ProductName, &item.ProductGroup, &feeCost, &margin); err != nil {
+			return nil, fmt.Errorf("ошибка чтения позиции заказа: %w", err)
+		}
+		item.FeeCost = floatPtr(feeCost)
+		item.Margin = floatPtr(margin)
+		details.Items = append(details.Items, item)
+	}
+
+	paymentRows, err := r.db.QueryContext(ctx, `
+		SELECT id, amount, currency, status, created_at, completed_at
+		FROM payments
+		WHERE order_id = $1
+		ORDER BY created_at
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса платежей заказа: %w", err)
+	}
+	defer paymentRows.Close()
+
+	details.Payments = []OrderPaymentRef{}
+	for paymentRows.Next() {
+		var payment OrderPaymentRef
+		var amount, currency string
+		var completedAt sql.NullTime
+		if err := paymentRows.Scan(&payment.ID, &amount, &currency, &payment.Status,
+			&payment.CreatedAt, &completedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения платежа: %w", err)
+		}
+		if payment.Amount, err = money.Parse(amount, currency); err != nil {
+			return nil, fmt.Errorf("ошибка чтения суммы платежа %d: %w", payment.ID, err)
+		}
+		payment.CompletedAt = timePtr(completedAt)
+		details.Payments = append(details.Payments, payment)
+	}
+
+	kizRows, err := r.db.QueryContext(ctx, `
+		SELECT r.id, r.status, r.request_time, res.file_path
+		FROM kiz_requests r
+		LEFT JOIN kiz_results res ON r.id = res.request_id
+		WHERE r.order_id = $1
+		ORDER BY r.request_time
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса КИЗ заказа: %w", err)
+	}
+	defer kizRows.Close()
+
+	details.KIZRequests = []OrderKIZRequestRef{}
+	for kizRows.Next() {
+		var ref OrderKIZRequestRef
+		var filePath sql.NullString
+		if err := kizRows.Scan(&ref.ID, &ref.Status, &ref.RequestTime, &filePath); err != nil {
+			return nil, fmt.Errorf("ошибка чтения запроса КИЗ: %w", err)
+		}
+		ref.FilePath = filePath.String
+		details.KIZRequests = append(details.KIZRequests, ref)
+	}
+
+	return &details, nil
+}
+
+// CancelOrder отменяет заказ: меняет статус, отменяет ожидающие платежи и неоплаченные счета и освобождает
+// зарезервированные под заказ запросы КИЗ. Если version > 0, заказ отменяется только в этой
+// версии, иначе возвращается ErrConflict. Возвращает предыдущий статус заказа.
+func (r *Repository) CancelOrder(ctx context.Context, orderID, userID, version int) (string, error) {
+	var status string
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var current int
+		err := tx.QueryRowContext(ctx,
+			"SELECT status, version FROM orders WHERE id = $1 AND "+orderAccessCondition+" FOR UPDATE",
+			orderID, userID,
+		).Scan(&status, &current)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if version > 0 && version != current {
+			return ErrConflict
+		}
+
+		if status != models.OrderStatusCreated && status != models.OrderStatusPending {
+			return ErrOrderNotCancellable
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE orders SET status = $1, updated_at = NOW(), version = version + 1 WHERE id = $2",
+			models.OrderStatusCancelled, orderID,
+		); err != nil {
+			return fmt.Errorf("ошибка обновления заказа: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE payments SET status = $1, version = version + 1 WHERE order_id = $2 AND status = $3",
+			models.PaymentStatusCancelled, orderID, models.PaymentStatusPending,
+		); err != nil {
+			return fmt.Errorf("ошибка отмены платежей: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE invoices SET status = $1 WHERE order_id = $2 AND status = $3",
+			models.InvoiceStatusCancelled, orderID, models.InvoiceStatusIssued,
+		); err != nil {
+			return fmt.Errorf("ошибка отмены счетов: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE kiz_requests SET status = 'cancelled', version = version + 1, updated_at = NOW() WHERE order_id = $1 AND status = 'pending'",
+			orderID,
+		); err != nil {
+			return fmt.Errorf("ошибка освобождения КИЗ: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// OrderProductGroup возвращает товарную группу заказа, доступного пользователю
+func (r *Repository) OrderProductGroup(ctx context.Context, orderID, userID int) (string, error) {
+	var group string
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COALESCE(product_group, '') FROM orders WHERE id = $1 AND "+orderAccessCondition,
+		orderID, userID,
+	).Scan(&group)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return group, err
+}
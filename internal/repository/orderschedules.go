@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+const orderScheduleColumns = `id, user_id, COALESCE(organization_id, 0), name, cron, COALESCE(product_group, ''), items,
+	status, next_run_at, last_run_at, COALESCE(last_order_id, 0), COALESCE(last_error, ''), created_at, updated_at, version`
+
+// Чтение расписания заказов из строки результата запроса
+func scanOrderSchedule(scan func(dest ...any) error, schedule *models.OrderSchedule) error {
+	var items []byte
+	var nextRunAt, lastRunAt sql.NullTime
+	if err := scan(&schedule.ID, &schedule.UserID, &schedule.OrganizationID, &schedule.Name, &schedule.Cron,
+		&schedule.ProductGroup, &items, &schedule.Status, &nextRunAt, &lastRunAt, &schedule.LastOrderID,
+		&schedule.LastError, &schedule.CreatedAt, &schedule.UpdatedAt, &schedule.Version); err != nil {
+		return err
+	}
+	schedule.NextRunAt = timePtr(nextRunAt)
+	schedule.LastRunAt = timePtr(lastRunAt)
+	if err := json.Unmarshal(items, &schedule.Items); err != nil {
+		return fmt.Errorf("ошибка разбора позиций расписания заказов: %w", err)
+	}
+	return nil
+}
+
+// CreateOrderSchedule сохраняет расписание заказов и заполняет его ID, время создания и версию
+func (r *Repository) CreateOrderSchedule(ctx context.Context, schedule *models.OrderSchedule) error {
+	items, err := json.Marshal(schedule.Items)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации позиций расписания заказов: %w", err)
+	}
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO order_schedules (user_id, organization_id, name, cron, product_group, items, status, next_run_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4, NULLIF($5, ''), $6, $7, $8)
+		RETURNING id, created_at, updated_at, version
+	`, schedule.UserID, schedule.OrganizationID, schedule.Name, schedule.Cron, schedule.ProductGroup, items,
+		schedule.Status, schedule.NextRunAt,
+	).Scan(&schedule.ID, &schedule.CreatedAt, &schedule.UpdatedAt, &schedule.Version)
+}
+
+// UpdateOrderSchedule изменяет параметры и время следующего запуска расписания пользователя.
+// Если version > 0, расписание изменяется только в этой версии, иначе возвращается ErrConflict.
+// Возвращает ErrNotFound, если расписания нет или оно принадлежит другому пользователю.
+func (r *Repository) UpdateOrderSchedule(ctx context.Context, schedule *models.OrderSchedule, version int) error {
+	items, err := json.Marshal(schedule.Items)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации позиций расписания заказов: %w", err)
+	}
+
+	err = scanOrderSchedule(r.db.QueryRowContext(ctx, `
+		UPDATE order_schedules
+		SET organization_id = NULLIF($3, 0), name = $4, cron = $5, product_group = NULLIF($6, ''), items = $7,
+			status = $8, next_run_at = $9, updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND user_id = $2 AND ($10 = 0 OR version = $10)
+		RETURNING `+orderScheduleColumns,
+		schedule.ID, schedule.UserID, schedule.OrganizationID, schedule.Name, schedule.Cron, schedule.ProductGroup,
+		items, schedule.Status, schedule.NextRunAt, version,
+	).Scan, schedule)
+	if err == sql.ErrNoRows {
+		return r.orderScheduleConflict(ctx, schedule.ID, schedule.UserID)
+	}
+	return err
+}
+
+// Причина, по которой расписание не изменено: ErrConflict, если оно есть, но в другой версии
+func (r *Repository) orderScheduleConflict(ctx context.Context, scheduleID, userID int) error {
+	if _, err := r.OrderSchedule(ctx, scheduleID, userID); err != nil {
+		return err
+	}
+	return ErrConflict
+}
+
+// OrderSchedule возвращает расписание заказов пользователя или ErrNotFound
+func (r *Repository) OrderSchedule(ctx context.Context, scheduleID, userID int) (*models.OrderSchedule, error) {
+	var schedule models.OrderSchedule
+	err := scanOrderSchedule(r.db.QueryRowContext(ctx,
+		"SELECT "+orderScheduleColumns+" FROM order_schedules WHERE id = $1 AND user_id = $2",
+		scheduleID, userID,
+	).Scan, &schedule)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// ListOrderSchedules возвращает расписания заказов пользователя по названию
+func (r *Repository) ListOrderSchedules(ctx context.Context, userID int) ([]models.OrderSchedule, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+orderScheduleColumns+" FROM order_schedules WHERE user_id = $1 ORDER BY name, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []models.OrderSchedule{}
+	for rows.Next() {
+		var schedule models.OrderSchedule
+		if err := scanOrderSchedule(rows.Scan, &schedule); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// DeleteOrderSchedule удаляет расписание заказов пользователя
+func (r *Repository) DeleteOrderSchedule(ctx context.Context, scheduleID, userID int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM order_schedules WHERE id = $1 AND user_id = $2", scheduleID, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DueOrderSchedules возвращает активные расписания, время запуска которых наступило к now,
+// начиная с самых просроченных. Расписания удаленных пользователей не возвращаются.
+func (r *Repository) DueOrderSchedules(ctx context.Context, now time.Time, limit int) ([]models.OrderSchedule, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+orderScheduleColumns+`
+		FROM order_schedules
+		WHERE status = $1 AND next_run_at <= $2
+			AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+		ORDER BY next_run_at
+		LIMIT $3
+	`, models.OrderScheduleStatusActive, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []models.OrderSchedule
+	for rows.Next() {
+		var schedule models.OrderSchedule
+		if err := scanOrderSchedule(rows.Scan, &schedule); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// ClaimOrderSchedule отмечает запуск расписания и переносит следующий запуск на nextRunAt.
+// Расписание изменяется только в прочитанной версии, поэтому одновременно работающие
+// экземпляры сервиса не выполнят один запуск дважды; иначе возвращается ErrConflict.
+func (r *Repository) ClaimOrderSchedule(ctx context.Context, schedule *models.OrderSchedule, runAt time.Time, nextRunAt *time.Time) error {
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE order_schedules
+		SET last_run_at = $3, next_run_at = $4, version = version + 1
+		WHERE id = $1 AND version = $2 AND status = $5
+		RETURNING version
+	`, schedule.ID, schedule.Version, runAt, nextRunAt, models.OrderScheduleStatusActive).Scan(&schedule.Version)
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	} else if err != nil {
+		return err
+	}
+	schedule.LastRunAt, schedule.NextRunAt = &runAt, nextRunAt
+	return nil
+}
+
+// FinishOrderSchedule сохраняет результат запуска расписания: созданный заказ и ошибку
+func (r *Repository) FinishOrderSchedule(ctx context.Context, scheduleID, orderID int, lastError string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE order_schedules
+		SET last_order_id = COALESCE(NULLIF($2, 0), last_order_id), last_error = NULLIF($3, '')
+		WHERE id = $1
+	`, scheduleID, orderID, lastError)
+	return err
+}
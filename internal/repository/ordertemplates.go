@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"project-znak/internal/models"
+)
+
+const orderTemplateColumns = `id, user_id, COALESCE(organization_id, 0), name, COALESCE(product_group, ''), items,
+	created_at, updated_at`
+
+// Чтение шаблона заказа из строки результата запроса
+func scanOrderTemplate(scan func(dest ...any) error, template *models.OrderTemplate) error {
+	var items []byte
+	if err := scan(&template.ID, &template.UserID, &template.OrganizationID, &template.Name, &template.ProductGroup,
+		&items, &template.CreatedAt, &template.UpdatedAt); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(items, &template.Items); err != nil {
+		return fmt.Errorf("ошибка разбора позиций шаблона заказа: %w", err)
+	}
+	return nil
+}
+
+// CreateOrderTemplate сохраняет шаблон заказа и заполняет его ID и время создания
+func (r *Repository) CreateOrderTemplate(ctx context.Context, template *models.OrderTemplate) error {
+	items, err := json.Marshal(template.Items)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации позиций шаблона заказа: %w", err)
+	}
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO order_templates (user_id, organization_id, name, product_group, items)
+		VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, ''), $5)
+		RETURNING id, created_at, updated_at
+	`, template.UserID, template.OrganizationID, template.Name, template.ProductGroup, items,
+	).Scan(&template.ID, &template.CreatedAt, &template.UpdatedAt)
+}
+
+// UpdateOrderTemplate изменяет шаблон заказа пользователя. Возвращает ErrNotFound, если
+// шаблона нет или он принадлежит другому пользователю.
+func (r *Repository) UpdateOrderTemplate(ctx context.Context, template *models.OrderTemplate) error {
+	items, err := json.Marshal(template.Items)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации позиций шаблона заказа: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, `
+		UPDATE order_templates
+		SET organization_id = NULLIF($3, 0), name = $4, product_group = NULLIF($5, ''), items = $6, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING created_at, updated_at
+	`, template.ID, template.UserID, template.OrganizationID, template.Name, template.ProductGroup, items,
+	).Scan(&template.CreatedAt, &template.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// OrderTemplate возвращает шаблон заказа пользователя или ErrNotFound
+func (r *Repository) OrderTemplate(ctx context.Context, templateID, userID int) (*models.OrderTemplate, error) {
+	var template models.OrderTemplate
+	err := scanOrderTemplate(r.db.QueryRowContext(ctx,
+		"SELECT "+orderTemplateColumns+" FROM order_templates WHERE id = $1 AND user_id = $2",
+		templateID, userID,
+	).Scan, &template)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// ListOrderTemplates возвращает шаблоны заказов пользователя по названию
+func (r *Repository) ListOrderTemplates(ctx context.Context, userID int) ([]models.OrderTemplate, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+orderTemplateColumns+" FROM order_templates WHERE user_id = $1 ORDER BY name, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []models.OrderTemplate{}
+	for rows.Next() {
+		var template models.OrderTemplate
+		if err := scanOrderTemplate(rows.Scan, &template); err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// DeleteOrderTemplate удаляет шаблон заказа пользователя
+func (r *Repository) DeleteOrderTemplate(ctx context.Context, templateID, userID int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM order_templates WHERE id = $1 AND user_id = $2", templateID, userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"project-znak/internal/models"
+)
+
+// Role - роль участника организации с ее разрешениями
+type Role struct {
+	Name        string   `json:"name" xml:"name"`
+	Description string   `json:"description,omitempty" xml:"description,omitempty"`
+	Permissions []string `json:"permissions" xml:"permissions>permission"`
+}
+
+// OrganizationRole возвращает роль пользователя в организации
+func (r *Repository) OrganizationRole(ctx context.Context, organizationID, userID int) (string, error) {
+	var role string
+	err := r.db.QueryRowContext(ctx,
+		"SELECT role FROM organization_members WHERE organization_id = $1 AND user_id = $2",
+		organizationID, userID,
+	).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotOrganizationMember
+	}
+	return role, err
+}
+
+// DefaultOrganizationID возвращает организацию пользователя: в первую очередь ту,
+// ИНН которой совпадает с ИНН пользователя. Возвращает 0, если пользователь
+// не состоит ни в одной организации.
+func (r *Repository) DefaultOrganizationID(ctx context.Context, userID int) (int, error) {
+	var organizationID int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT m.organization_id
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.organization_id
+		JOIN users u ON u.id = m.user_id
+		WHERE m.user_id = $1
+		ORDER BY (o.inn = u.inn) DESC, m.created_at
+		LIMIT 1
+	`, userID).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return organizationID, err
+}
+
+// MemberOrganizationINN возвращает ИНН организации, если пользователь в ней состоит
+func (r *Repository) MemberOrganizationINN(ctx context.Context, organizationID, userID int) (string, error) {
+	var inn string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT o.inn
+		FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE o.id = $1 AND m.user_id = $2
+	`, organizationID, userID).Scan(&inn)
+	if err == sql.ErrNoRows {
+		return "", ErrNotOrganizationMember
+	}
+	return inn, err
+}
+
+// MemberOrganizationIDByINN возвращает ID организации с указанным ИНН, в которой состоит
+// пользователь, или 0, если такой нет
+func (r *Repository) MemberOrganizationIDByINN(ctx context.Context, inn string, userID int) (int, error) {
+	var organizationID int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT o.id
+		FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE o.inn = $1 AND m.user_id = $2
+	`, inn, userID).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return organizationID, err
+}
+
+// CreateOrganization создает организацию с пользователем в роли владельца.
+// Если организация с таким ИНН уже существует, возвращает 0 и ничего не меняет.
+func (r *Repository) CreateOrganization(ctx context.Context, userID int, inn, name string) (int, error) {
+	var organizationID int
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO organizations (inn, name)
+			VALUES ($1, NULLIF($2, ''))
+			ON CONFLICT (inn) DO NOTHING
+			RETURNING id
+		`, inn, name).Scan(&organizationID)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("ошибка сохранения организации: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO organization_members (organization_id, user_id, role)
+			VALUES ($1, $2, $3)
+		`, organizationID, userID, models.OrgRoleOwner)
+		if err != nil {
+			return fmt.Errorf("ошибка добавления владельца организации: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return organizationID, nil
+}
+
+// ListOrganizations возвращает организации пользователя с его ролью в каждой из них
+func (r *Repository) ListOrganizations(ctx context.Context, userID int) ([]models.Organization, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT o.id, o.inn, COALESCE(o.name, ''), o.created_at, m.role
+		FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = $1
+		ORDER BY o.created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	organizations := []models.Organization{}
+	for rows.Next() {
+		var org models.Organization
+		if err := rows.Scan(&org.ID, &org.INN, &org.Name, &org.CreatedAt, &org.Role); err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, org)
+	}
+
+	return organizations, rows.Err()
+}
+
+// Organization возвращает организацию по ID
+func (r *Repository) Organization(ctx context.Context, organizationID int) (*models.Organization, error) {
+	var org models.Organization
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, inn, COALESCE(name, ''), created_at,
+			COALESCE(kpp, ''), COALESCE(address, ''), COALESCE(bank_name, ''),
+			COALESCE(bik, ''), COALESCE(bank_account, ''), COALESCE(corr_account, '')
+		FROM organizations WHERE id = $1
+	`, organizationID,
+	).Scan(&org.ID, &org.INN, &org.Name, &org.CreatedAt,
+		&org.KPP, &org.Address, &org.BankName, &org.BIK, &org.BankAccount, &org.CorrAccount)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &org, err
+}
+
+// SaveOrganizationRequisites сохраняет реквизиты организации
+func (r *Repository) SaveOrganizationRequisites(ctx context.Context, organizationID int, requisites models.Requisites) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE organizations
+		SET kpp = NULLIF($2, ''), address = NULLIF($3, ''), bank_name = NULLIF($4, ''),
+			bik = NULLIF($5, ''), bank_account = NULLIF($6, ''), corr_account = NULLIF($7, '')
+		WHERE id = $1
+	`, organizationID, requisites.KPP, requisites.Address, requisites.BankName,
+		requisites.BIK, requisites.BankAccount, requisites.CorrAccount)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// OrganizationMembers возвращает участников организации
+func (r *Repository) OrganizationMembers(ctx context.Context, organizationID int) ([]models.OrganizationMember, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT m.organization_id, m.user_id, COALESCE(u.telegram_id, 0), m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1
+		ORDER BY m.created_at
+	`, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.OrganizationMember{}
+	for rows.Next() {
+		var member models.OrganizationMember
+		if err := rows.Scan(&member.OrganizationID, &member.UserID, &member.TelegramID,
+			&member.Role, &member.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// SaveOrganizationMember добавляет участника организации или меняет его роль
+// и заполняет время вступления. Возвращает ErrNotFound, если организации нет.
+func (r *Repository) SaveOrganizationMember(ctx context.Context, member *models.OrganizationMember) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO organization_members (organization_id, user_id, role)
+		SELECT id, $2, $3 FROM organizations WHERE id = $1
+		ON CONFLICT (organization_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING created_at
+	`, member.OrganizationID, member.UserID, member.Role).Scan(&member.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// HasPermission проверяет наличие разрешения у роли пользователя в организации
+func (r *Repository) HasPermission(ctx context.Context, userID, organizationID int, permission string) (bool, error) {
+	var allowed bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM organization_members m
+			JOIN role_permissions p ON p.role = m.role
+			WHERE m.organization_id = $1 AND m.user_id = $2 AND p.permission = $3
+		)
+	`, organizationID, userID, permission).Scan(&allowed)
+	return allowed, err
+}
+
+// ListRoles возвращает роли и их разрешения
+func (r *Repository) ListRoles(ctx context.Context) ([]*Role, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT r.name, COALESCE(r.description, ''), COALESCE(p.permission, '')
+		FROM roles r
+		LEFT JOIN role_permissions p ON p.role = r.name
+		ORDER BY r.name, p.permission
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		var name, description, permission string
+		if err := rows.Scan(&name, &description, &permission); err != nil {
+			return nil, err
+		}
+		if len(roles) == 0 || roles[len(roles)-1].Name != name {
+			roles = append(roles, &Role{Name: name, Description: description, Permissions: []string{}})
+		}
+		if permission != "" {
+			roles[len(roles)-1].Permissions = append(roles[len(roles)-1].Permissions, permission)
+		}
+	}
+
+	return roles, rows.Err()
+}
+
+// OrganizationExists сообщает, зарегистрирована ли организация с ИНН
+func (r *Repository) OrganizationExists(ctx context.Context, inn string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM organizations WHERE inn = $1)`, inn).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+const outboxColumns = `id, channel, COALESCE(user_id, 0), payload, status, attempts, COALESCE(error, ''),
+	created_at, sent_at`
+
+func scanOutboxMessage(scan func(dest ...any) error, message *models.OutboxMessage) error {
+	var sentAt sql.NullTime
+	if err := scan(&message.ID, &message.Channel, &message.UserID, &message.Payload, &message.Status,
+		&message.Attempts, &message.Error, &message.CreatedAt, &sentAt); err != nil {
+		return err
+	}
+	message.SentAt = timePtr(sentAt)
+	return nil
+}
+
+// Запись сообщений outbox в транзакции изменения состояния: сообщения сохраняются,
+// только если изменение зафиксировано
+func insertOutbox(ctx context.Context, tx *sql.Tx, messages []models.OutboxMessage) error {
+	for _, message := range messages {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO outbox (channel, user_id, payload) VALUES ($1, NULLIF($2, 0), $3)",
+			message.Channel, message.UserID, []byte(message.Payload),
+		); err != nil {
+			return fmt.Errorf("ошибка записи уведомления в outbox: %w", err)
+		}
+	}
+	return nil
+}
+
+// Запись сообщений, сформированных build; build может быть nil
+func writeOutbox(ctx context.Context, tx *sql.Tx, build func() ([]models.OutboxMessage, error)) error {
+	if build == nil {
+		return nil
+	}
+	messages, err := build()
+	if err != nil {
+		return fmt.Errorf("ошибка формирования уведомлений: %w", err)
+	}
+	return insertOutbox(ctx, tx, messages)
+}
+
+// Выборка сообщений по условию
+func (r *Repository) queryOutbox(ctx context.Context, query string, args ...any) ([]models.OutboxMessage, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+outboxColumns+" FROM outbox "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []models.OutboxMessage{}
+	for rows.Next() {
+		var message models.OutboxMessage
+		if err := scanOutboxMessage(rows.Scan, &message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// ClaimOutboxMessages захватывает недоставленные сообщения, для которых наступило время
+// попытки, и возвращает их в порядке записи. Следующая попытка захваченных сообщений
+// откладывается на lease: за это время их не захватит другой экземпляр сервиса, а если
+// доставка прервется, сообщения будут доставлены повторно по истечении lease.
+func (r *Repository) ClaimOutboxMessages(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE outbox SET next_attempt_at = NOW() + make_interval(secs => $3)
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE status = $1 AND next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+outboxColumns,
+		models.OutboxStatusPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []models.OutboxMessage{}
+	for rows.Next() {
+		var message models.OutboxMessage
+		if err := scanOutboxMessage(rows.Scan, &message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages, nil
+}
+
+// ListOutboxMessages возвращает сообщения с указанным статусом (все, если статус пуст), новые первыми
+func (r *Repository) ListOutboxMessages(ctx context.Context, status string, limit int) ([]models.OutboxMessage, error) {
+	return r.queryOutbox(ctx,
+		"WHERE $1 = '' OR status = $1 ORDER BY id DESC LIMIT $2",
+		status, limit)
+}
+
+// MarkOutboxSent отмечает сообщение доставленным
+func (r *Repository) MarkOutboxSent(ctx context.Context, messageID int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE outbox SET status = $2, sent_at = $3, error = NULL WHERE id = $1",
+		messageID, models.OutboxStatusSent, at)
+	return err
+}
+
+// FailOutboxAttempt фиксирует неудачную попытку доставки. Следующая попытка откладывается
+// на интервал, удваивающийся с каждой попыткой начиная с base, но не больше max. После
+// maxAttempts попыток сообщение получает статус dead. Возвращает true, если попытки исчерпаны.
+func (r *Repository) FailOutboxAttempt(ctx context.Context, messageID int, message string,
+	base, max time.Duration, maxAttempts int) (bool, error) {
+	var status string
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE outbox SET
+			attempts = attempts + 1,
+			error = $2,
+			status = CASE WHEN attempts + 1 >= $5 THEN $6 ELSE status END,
+			next_attempt_at = NOW() + make_interval(secs => LEAST($3 * power(2, LEAST(attempts, 20)), $4))
+		WHERE id = $1
+		RETURNING status
+	`, messageID, message, base.Seconds(), max.Seconds(), maxAttempts, models.OutboxStatusDead).Scan(&status)
+	return status == models.OutboxStatusDead, err
+}
+
+// RetryOutboxMessage возвращает в очередь сообщение, попытки доставки которого исчерпаны.
+// Возвращает ErrNotFound, если такого сообщения нет.
+func (r *Repository) RetryOutboxMessage(ctx context.Context, messageID int) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE outbox SET status = $2, attempts = 0, next_attempt_at = NOW()
+		WHERE id = $1 AND status = $3
+	`, messageID, models.OutboxStatusPending, models.OutboxStatusDead)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+// Соответствия SKU Ozon организации или, без организации, личные соответствия пользователя.
+// Параметры: $1 - пользователь, $2 - организация (0 - личные соответствия).
+const ozonMappingScopeCondition = `(CASE WHEN $2 > 0 THEN organization_id = $2 ELSE user_id = $1 AND organization_id IS NULL END)`
+
+// OzonCredentials - ключ Ozon Seller API пользователя
+type OzonCredentials struct {
+	ClientID  string
+	APIKey    string
+	UpdatedAt time.Time
+}
+
+// OzonCredentials возвращает ключ Ozon Seller API пользователя
+func (r *Repository) OzonCredentials(ctx context.Context, userID int) (*OzonCredentials, error) {
+	var creds OzonCredentials
+	err := r.db.QueryRowContext(ctx,
+		"SELECT client_id, api_key, updated_at FROM ozon_credentials WHERE user_id = $1", userID,
+	).Scan(&creds.ClientID, &creds.APIKey, &creds.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+// SaveOzonCredentials сохраняет ключ Ozon Seller API пользователя и заполняет время изменения
+func (r *Repository) SaveOzonCredentials(ctx context.Context, userID int, creds *OzonCredentials) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO ozon_credentials (user_id, client_id, api_key)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET client_id = EXCLUDED.client_id, api_key = EXCLUDED.api_key, updated_at = NOW()
+		RETURNING updated_at
+	`, userID, creds.ClientID, creds.APIKey).Scan(&creds.UpdatedAt)
+}
+
+// DeleteOzonCredentials удаляет ключ Ozon Seller API пользователя
+func (r *Repository) DeleteOzonCredentials(ctx context.Context, userID int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM ozon_credentials WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// OzonMappings возвращает соответствия SKU Ozon и GTIN организации или пользователя
+func (r *Repository) OzonMappings(ctx context.Context, userID, organizationID int) ([]models.OzonSKUMapping, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, COALESCE(user_id, 0), COALESCE(organization_id, 0), sku, gtin, created_at
+		FROM ozon_sku_mappings
+		WHERE `+ozonMappingScopeCondition+`
+		ORDER BY sku
+	`, userID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mappings := []models.OzonSKUMapping{}
+	for rows.Next() {
+		var m models.OzonSKUMapping
+		if err := rows.Scan(&m.ID, &m.UserID, &m.OrganizationID, &m.SKU, &m.GTIN, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, rows.Err()
+}
+
+// SaveOzonMapping сохраняет соответствие SKU и GTIN, заменяя прежнее соответствие этого SKU
+func (r *Repository) SaveOzonMapping(ctx context.Context, mapping *models.OzonSKUMapping) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"DELETE FROM ozon_sku_mappings WHERE "+ozonMappingScopeCondition+" AND sku = $3",
+			mapping.UserID, mapping.OrganizationID, mapping.SKU); err != nil {
+			return fmt.Errorf("ошибка замены соответствия: %w", err)
+		}
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO ozon_sku_mappings (user_id, organization_id, sku, gtin)
+			VALUES ($1, NULLIF($2, 0), $3, $4)
+			RETURNING id, created_at
+		`, mapping.UserID, mapping.OrganizationID, mapping.SKU, mapping.GTIN).Scan(&mapping.ID, &mapping.CreatedAt); err != nil {
+			return fmt.Errorf("ошибка сохранения соответствия: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteOzonMapping удаляет соответствие SKU организации или пользователя
+func (r *Repository) DeleteOzonMapping(ctx context.Context, userID, organizationID int, sku int64) error {
+	result, err := r.db.ExecContext(ctx,
+		"DELETE FROM ozon_sku_mappings WHERE "+ozonMappingScopeCondition+" AND sku = $3",
+		userID, organizationID, sku)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const ozonSubmissionColumns = `id, user_id, COALESCE(organization_id, 0), posting_number, status, codes,
+	COALESCE(error, ''), created_at, updated_at`
+
+func scanOzonSubmission(scan func(dest ...any) error, submission *models.OzonSubmission) error {
+	var codes []byte
+	if err := scan(&submission.ID, &submission.UserID, &submission.OrganizationID, &submission.PostingNumber,
+		&submission.Status, &codes, &submission.Error, &submission.CreatedAt, &submission.UpdatedAt); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(codes, &submission.Codes); err != nil {
+		return fmt.Errorf("ошибка чтения кодов передачи: %w", err)
+	}
+	return nil
+}
+
+// CreateOzonSubmission сохраняет передачу кодов в отправление Ozon
+func (r *Repository) CreateOzonSubmission(ctx context.Context, submission *models.OzonSubmission) error {
+	codes, err := json.Marshal(submission.Codes)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации кодов: %w", err)
+	}
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO ozon_submissions (user_id, organization_id, posting_number, status, codes, error)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, NULLIF($6, ''))
+		RETURNING id, created_at, updated_at
+	`, submission.UserID, submission.OrganizationID, submission.PostingNumber, submission.Status, codes, submission.Error,
+	).Scan(&submission.ID, &submission.CreatedAt, &submission.UpdatedAt)
+}
+
+// UpdateOzonSubmission сохраняет статус и результаты проверки кодов передачи
+func (r *Repository) UpdateOzonSubmission(ctx context.Context, submission *models.OzonSubmission) error {
+	codes, err := json.Marshal(submission.Codes)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации кодов: %w", err)
+	}
+	return r.db.QueryRowContext(ctx, `
+		UPDATE ozon_submissions SET status = $2, codes = $3, error = NULLIF($4, ''), updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`, submission.ID, submission.Status, codes, submission.Error).Scan(&submission.UpdatedAt)
+}
+
+// OzonSubmission возвращает передачу кодов пользователя или организации, в которой он состоит
+func (r *Repository) OzonSubmission(ctx context.Context, submissionID, userID int) (*models.OzonSubmission, error) {
+	var submission models.OzonSubmission
+	err := scanOzonSubmission(r.db.QueryRowContext(ctx, `
+		SELECT `+ozonSubmissionColumns+`
+		FROM ozon_submissions
+		WHERE id = $1 AND `+reservationAccessCondition,
+		submissionID, userID).Scan, &submission)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &submission, nil
+}
+
+// OzonSubmissions возвращает последние передачи кодов организации или личные передачи пользователя
+func (r *Repository) OzonSubmissions(ctx context.Context, userID, organizationID int, limit int) ([]models.OzonSubmission, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+ozonSubmissionColumns+`
+		FROM ozon_submissions
+		WHERE `+ozonMappingScopeCondition+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, userID, organizationID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	submissions := []models.OzonSubmission{}
+	for rows.Next() {
+		var submission models.OzonSubmission
+		if err := scanOzonSubmission(rows.Scan, &submission); err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, submission)
+	}
+	return submissions, rows.Err()
+}
+
+// OzonSubmissionOrganizationID возвращает организацию передачи кодов; 0, если передача
+// личная или не найдена
+func (r *Repository) OzonSubmissionOrganizationID(ctx context.Context, submissionID int) (int, error) {
+	var organizationID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, "SELECT organization_id FROM ozon_submissions WHERE id = $1", submissionID).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return int(organizationID.Int64), err
+}
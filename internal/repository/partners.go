@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+)
+
+const partnerColumns = `p.id, p.user_id, COALESCE(u.telegram_id, 0), p.name, p.revenue_share, p.created_at,
+	(SELECT COUNT(*) FROM organizations o WHERE o.partner_id = p.id)`
+
+func scanPartner(scan func(dest ...any) error, partner *models.Partner) error {
+	return scan(&partner.ID, &partner.UserID, &partner.TelegramID, &partner.Name, &partner.RevenueShare,
+		&partner.CreatedAt, &partner.Accounts)
+}
+
+// SavePartner создает партнера или меняет наименование и долю существующего партнера
+func (r *Repository) SavePartner(ctx context.Context, partner *models.Partner) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO partners (user_id, name, revenue_share)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET name = $2, revenue_share = $3, updated_at = NOW()
+		RETURNING id, created_at
+	`, partner.UserID, partner.Name, partner.RevenueShare).Scan(&partner.ID, &partner.CreatedAt)
+}
+
+// PartnerByUser возвращает партнера, которым является пользователь
+func (r *Repository) PartnerByUser(ctx context.Context, userID int) (*models.Partner, error) {
+	var partner models.Partner
+	err := scanPartner(r.db.QueryRowContext(ctx, `
+		SELECT `+partnerColumns+`
+		FROM partners p JOIN users u ON u.id = p.user_id
+		WHERE p.user_id = $1 AND u.deleted_at IS NULL
+	`, userID).Scan, &partner)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &partner, nil
+}
+
+// ListPartners возвращает всех партнеров
+func (r *Repository) ListPartners(ctx context.Context) ([]models.Partner, error) {
+	return r.queryPartners(ctx, `
+		SELECT `+partnerColumns+`
+		FROM partners p JOIN users u ON u.id = p.user_id
+		ORDER BY p.created_at
+	`)
+}
+
+// DuePartners возвращает партнеров, которым еще не отправлен отчет о вознаграждении
+// за месяц, начинающийся с period
+func (r *Repository) DuePartners(ctx context.Context, period time.Time, limit int) ([]models.Partner, error) {
+	return r.queryPartners(ctx, `
+		SELECT `+partnerColumns+`
+		FROM partners p JOIN users u ON u.id = p.user_id
+		WHERE u.deleted_at IS NULL AND (p.last_report_period IS NULL OR p.last_report_period < $1)
+		ORDER BY p.id
+		LIMIT $2
+	`, period, limit)
+}
+
+func (r *Repository) queryPartners(ctx context.Context, query string, args ...any) ([]models.Partner, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partners := []models.Partner{}
+	for rows.Next() {
+		var partner models.Partner
+		if err := scanPartner(rows.Scan, &partner); err != nil {
+			return nil, err
+		}
+		partners = append(partners, partner)
+	}
+	return partners, rows.Err()
+}
+
+// MarkPartnerReported отмечает отправку отчета о вознаграждении за месяц period в одной
+// транзакции с уведомлениями outbox. Возвращает ErrNotFound, если отчет уже отправлен.
+func (r *Repository) MarkPartnerReported(ctx context.Context, partnerID int, period time.Time,
+	outbox func() ([]models.OutboxMessage, error)) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE partners SET last_report_period = $2
+			WHERE id = $1 AND (last_report_period IS NULL OR last_report_period < $2)
+		`, partnerID, period)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return ErrNotFound
+		}
+		return writeOutbox(ctx, tx, outbox)
+	})
+}
+
+// CreatePartnerOrganization создает организацию клиента партнера; пользователь партнера
+// становится ее владельцем. Возвращает 0, если организация с таким ИНН уже существует.
+func (r *Repository) CreatePartnerOrganization(ctx context.Context, partnerID, userID int, inn, name string) (int, error) {
+	var organizationID int
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO organizations (inn, name, partner_id)
+			VALUES ($1, NULLIF($2, ''), $3)
+			ON CONFLICT (inn) DO NOTHING
+			RETURNING id
+		`, inn, name, partnerID).Scan(&organizationID)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("ошибка сохранения организации: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO organization_members (organization_id, user_id, role)
+			VALUES ($1, $2, $3)
+		`, organizationID, userID, models.OrgRoleOwner); err != nil {
+			return fmt.Errorf("ошибка добавления владельца организации: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return organizationID, nil
+}
+
+// PartnerAccounts возвращает субаккаунты партнера с числом участников и заказов
+func (r *Repository) PartnerAccounts(ctx context.Context, partnerID int) ([]models.PartnerAccount, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT o.id, o.inn, COALESCE(o.name, ''), o.created_at,
+			(SELECT COUNT(*) FROM organization_members m WHERE m.organization_id = o.id),
+			(SELECT COUNT(*) FROM orders ord WHERE ord.organization_id = o.id)
+		FROM organizations o
+		WHERE o.partner_id = $1
+		ORDER BY o.created_at
+	`, partnerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.PartnerAccount{}
+	for rows.Next() {
+		var account models.PartnerAccount
+		if err := rows.Scan(&account.ID, &account.INN, &account.Name, &account.CreatedAt,
+			&account.Members, &account.Orders); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// PartnerBilling возвращает проведенные за период [from, to) платежи субаккаунтов партнера
+// по организациям и валютам. Доля партнера не заполняется.
+func (r *Repository) PartnerBilling(ctx context.Context, partnerID int, from, to time.Time) ([]models.PartnerBillingLine, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT o.id, o.inn, COALESCE(o.name, ''), p.currency, COUNT(*), SUM(p.amount)
+		FROM payments p
+		JOIN organizations o ON o.id = p.organization_id
+		WHERE o.partner_id = $1 AND p.status = $2 AND p.completed_at >= $3 AND p.completed_at < $4
+		GROUP BY o.id, o.inn, o.name, p.currency
+		ORDER BY o.inn, p.currency
+	`, partnerID, models.PaymentStatusCompleted, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []models.PartnerBillingLine{}
+	for rows.Next() {
+		var line models.PartnerBillingLine
+		var paid string
+		if err := rows.Scan(&line.OrganizationID, &line.INN, &line.Name, &line.Currency, &line.Payments, &paid); err != nil {
+			return nil, err
+		}
+		if line.Paid, err = money.Parse(paid, line.Currency); err != nil {
+			return nil, fmt.Errorf("ошибка чтения суммы платежей организации %d: %w", line.OrganizationID, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
@@ -0,0 +1,332 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+)
+
+// Чтение из БД или из транзакции
+type queryer interface {
+	QueryRower
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// Запись журнала платежей
+type ledgerEntry struct {
+	OrderID int // 0 - платеж без заказа
+	Kind    string
+	Amount  money.Money
+}
+
+// CreateBatchPayment сохраняет ожидающий оплаты пакетный платеж провайдера provider на
+// сумму долей заказов orders и возвращает его ID. Платеж не привязан к одному заказу:
+// доли заказов сохраняются в payment_orders и при проведении платежа записываются в журнал.
+// Возвращает ErrPaymentExceedsBalance, если доля больше неоплаченного остатка заказа.
+func (r *Repository) CreateBatchPayment(ctx context.Context, userID, organizationID int, orders []models.PaymentOrder,
+	amount money.Money, provider string) (int, error) {
+	var paymentID int
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		// Остатки проверяются под блокировкой заказов: два платежа не оплатят заказ дважды
+		for _, order := range orders {
+			balance, err := orderBalance(ctx, tx, order.OrderID, true)
+			if err != nil {
+				return err
+			}
+			if order.Amount.Minor > balance.Minor {
+				return fmt.Errorf("заказ %d: %w", order.OrderID, ErrPaymentExceedsBalance)
+			}
+		}
+
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO payments (user_id, organization_id, amount, currency, provider, status)
+			VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6)
+			RETURNING id
+		`, userID, organizationID, amount, amount.Code(), provider, models.PaymentStatusPending).Scan(&paymentID); err != nil {
+			return fmt.Errorf("ошибка создания платежа: %w", err)
+		}
+		for _, order := range orders {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO payment_orders (payment_id, order_id, amount) VALUES ($1, $2, $3)",
+				paymentID, order.OrderID, order.Amount.Minor,
+			); err != nil {
+				return fmt.Errorf("ошибка сохранения заказа %d платежа: %w", order.OrderID, err)
+			}
+		}
+		return nil
+	})
+	return paymentID, err
+}
+
+// OrderBalance возвращает неоплаченный остаток заказа в рублях: сумму заказа за вычетом
+// поступлений и возвратов по журналу платежей и платежей, ожидающих оплаты. Возвращает
+// ErrNotFound, если заказ не найден.
+func (r *Repository) OrderBalance(ctx context.Context, orderID int) (money.Money, error) {
+	return orderBalance(ctx, r.db, orderID, false)
+}
+
+// Неоплаченный остаток заказа; lock блокирует строку заказа до конца транзакции. Суммы
+// складываются в Go, как и в журнале платежа. Платежи в другой валюте не учитываются:
+// заказ оценивается в рублях.
+func orderBalance(ctx context.Context, q queryer, orderID int, lock bool) (money.Money, error) {
+	query := "SELECT total_amount FROM orders WHERE id = $1"
+	if lock {
+		query += " FOR UPDATE"
+	}
+	balance := money.New(0, money.RUB)
+	if err := q.QueryRowContext(ctx, query, orderID).Scan(&balance); err == sql.ErrNoRows {
+		return money.Money{}, ErrNotFound
+	} else if err != nil {
+		return money.Money{}, err
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT amount FROM payment_ledger WHERE order_id = $1 AND currency = $2
+		UNION ALL
+		SELECT amount FROM payments WHERE order_id = $1 AND currency = $2 AND status = $3
+	`, orderID, money.RUB, models.PaymentStatusPending)
+	if err != nil {
+		return money.Money{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		paid := money.New(0, money.RUB)
+		if err := rows.Scan(&paid); err != nil {
+			return money.Money{}, fmt.Errorf("ошибка чтения платежа по заказу %d: %w", orderID, err)
+		}
+		balance = balance.Sub(paid)
+	}
+	if err := rows.Err(); err != nil {
+		return money.Money{}, err
+	}
+
+	var pending int64
+	if err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(po.amount), 0)
+		FROM payment_orders po JOIN payments p ON p.id = po.payment_id
+		WHERE po.order_id = $1 AND p.currency = $2 AND p.status = $3
+	`, orderID, money.RUB, models.PaymentStatusPending).Scan(&pending); err != nil {
+		return money.Money{}, err
+	}
+	return balance.Sub(money.New(pending, money.RUB)), nil
+}
+
+// PaymentOrders возвращает заказы пакетного платежа с долей суммы и суммой возвратов по
+// каждому заказу; пустой список, если платеж оплачивает один заказ
+func (r *Repository) PaymentOrders(ctx context.Context, paymentID int) ([]models.PaymentOrder, error) {
+	return paymentOrders(ctx, r.db, paymentID)
+}
+
+// Заказы пакетного платежа: доли из payment_orders, возвраты - из журнала платежей
+func paymentOrders(ctx context.Context, q queryer, paymentID int) ([]models.PaymentOrder, error) {
+	var currency string
+	if err := q.QueryRowContext(ctx, "SELECT currency FROM payments WHERE id = $1", paymentID).Scan(&currency); err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx,
+		"SELECT order_id, amount FROM payment_orders WHERE payment_id = $1 ORDER BY order_id", paymentID)
+	if err != nil {
+		return nil, err
+	}
+	var orders []models.PaymentOrder
+	for rows.Next() {
+		order := models.PaymentOrder{Refunded: money.New(0, currency)}
+		var amount int64
+		if err := rows.Scan(&order.OrderID, &amount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		order.Amount = money.New(amount, currency)
+		orders = append(orders, order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(orders) == 0 {
+		return orders, err
+	}
+
+	entries, err := paymentLedger(ctx, q, paymentID, currency)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Kind != models.PaymentLedgerRefund {
+			continue
+		}
+		for i := range orders {
+			if orders[i].OrderID == entry.OrderID {
+				orders[i].Refunded = orders[i].Refunded.Sub(entry.Amount)
+			}
+		}
+	}
+	return orders, nil
+}
+
+// Записи журнала по платежу. Суммы складываются в Go: SQLite хранит DECIMAL числом
+// с плавающей точкой, и сумма в SQL может накопить ошибку округления.
+func paymentLedger(ctx context.Context, q queryer, paymentID int, currency string) ([]ledgerEntry, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT COALESCE(order_id, 0), kind, amount FROM payment_ledger WHERE payment_id = $1 ORDER BY id", paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []ledgerEntry
+	for rows.Next() {
+		var entry ledgerEntry
+		var amount string
+		if err := rows.Scan(&entry.OrderID, &entry.Kind, &amount); err != nil {
+			return nil, err
+		}
+		if entry.Amount, err = money.Parse(amount, currency); err != nil {
+			return nil, fmt.Errorf("ошибка чтения суммы в журнале платежа %d: %w", paymentID, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Остатки платежа по заказам: сумма поступлений и возвратов по каждому заказу в журнале
+func ledgerBalances(entries []ledgerEntry, currency string) map[int]money.Money {
+	balances := make(map[int]money.Money)
+	for _, entry := range entries {
+		balance, ok := balances[entry.OrderID]
+		if !ok {
+			balance = money.New(0, currency)
+		}
+		balances[entry.OrderID] = balance.Add(entry.Amount)
+	}
+	return balances
+}
+
+// Запись проведенного платежа в журнал: по записи на долю каждого заказа пакетного
+// платежа или одна запись на сумму платежа
+func writePaymentLedger(ctx context.Context, tx *sql.Tx, paymentID int, at time.Time) error {
+	orders, err := paymentOrders(ctx, tx, paymentID)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения заказов платежа: %w", err)
+	}
+	for _, order := range orders {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO payment_ledger (payment_id, order_id, kind, amount, currency, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, paymentID, order.OrderID, models.PaymentLedgerPayment, order.Amount, order.Amount.Code(), at); err != nil {
+			return fmt.Errorf("ошибка записи платежа в журнал: %w", err)
+		}
+	}
+	if len(orders) > 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO payment_ledger (payment_id, order_id, kind, amount, currency, created_at)
+		SELECT id, order_id, $2, amount, currency, $3 FROM payments WHERE id = $1
+	`, paymentID, models.PaymentLedgerPayment, at); err != nil {
+		return fmt.Errorf("ошибка записи платежа в журнал: %w", err)
+	}
+	return nil
+}
+
+// Запись возврата остатка платежа по всем заказам в журнал при полном возврате платежа
+func writeRefundLedger(ctx context.Context, tx *sql.Tx, paymentID int, currency string, at time.Time) error {
+	entries, err := paymentLedger(ctx, tx, paymentID, currency)
+	if err != nil {
+		return err
+	}
+	balances := ledgerBalances(entries, currency)
+	for _, orderID := range slices.Sorted(maps.Keys(balances)) {
+		balance := balances[orderID]
+		if !balance.IsPositive() {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO payment_ledger (payment_id, order_id, kind, amount, currency, created_at)
+			VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6)
+		`, paymentID, orderID, models.PaymentLedgerRefund, money.New(-balance.Minor, currency), currency, at); err != nil {
+			return fmt.Errorf("ошибка записи возврата в журнал: %w", err)
+		}
+	}
+	return nil
+}
+
+// RefundPaymentOrder записывает в журнал возврат суммы amount по заказу пакетного платежа.
+// Если после возврата остаток платежа равен нулю, платеж отмечается возвращенным (refunded
+// = true). Возвращает ErrNotFound, если платеж или заказ в нем не найден, ErrConflict, если
+// платеж уже не проведен, и ErrRefundExceedsBalance, если сумма больше остатка по заказу.
+func (r *Repository) RefundPaymentOrder(ctx context.Context, paymentID, orderID int, amount money.Money,
+	at time.Time) (order *models.PaymentOrder, refunded bool, err error) {
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		var status, currency string
+		if err := tx.QueryRowContext(ctx,
+			"SELECT status, currency FROM payments WHERE id = $1 FOR UPDATE", paymentID,
+		).Scan(&status, &currency); err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		if status != models.PaymentStatusCompleted {
+			return ErrConflict
+		}
+
+		orders, err := paymentOrders(ctx, tx, paymentID)
+		if err != nil {
+			return err
+		}
+		for i := range orders {
+			if orders[i].OrderID == orderID {
+				order = &orders[i]
+			}
+		}
+		if order == nil {
+			return ErrNotFound
+		}
+
+		entries, err := paymentLedger(ctx, tx, paymentID, currency)
+		if err != nil {
+			return err
+		}
+		balances := ledgerBalances(entries, currency)
+		if amount.Minor > balances[orderID].Minor {
+			return ErrRefundExceedsBalance
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO payment_ledger (payment_id, order_id, kind, amount, currency, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, paymentID, orderID, models.PaymentLedgerRefund, money.New(-amount.Minor, currency), currency, at); err != nil {
+			return fmt.Errorf("ошибка записи возврата в журнал: %w", err)
+		}
+		order.Refunded = order.Refunded.Add(amount)
+
+		var remaining int64
+		for id, balance := range balances {
+			if id == orderID {
+				balance = balance.Sub(amount)
+			}
+			remaining += balance.Minor
+		}
+		if remaining > 0 {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE payments SET status = $2, version = version + 1 WHERE id = $1",
+			paymentID, models.PaymentStatusRefunded,
+		); err != nil {
+			return fmt.Errorf("ошибка обновления платежа: %w", err)
+		}
+		refunded = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return order, refunded, nil
+}
@@ -0,0 +1,421 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+)
+
+// CompletedPayment - данные проведенного или отмененного платежа для квитанции и уведомлений
+type CompletedPayment struct {
+	UserID  int
+	OrderID int
+	Amount  money.Money
+}
+
+// CreatePayment сохраняет ожидающий оплаты платеж через провайдера provider и возвращает его ID
+func (r *Repository) CreatePayment(ctx context.Context, userID, orderID, organizationID int, amount money.Money,
+	provider string) (int, error) {
+	var paymentID int
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO payments (user_id, order_id, organization_id, amount, currency, provider, status)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), $4, $5, $6, $7)
+		RETURNING id
+	`, userID, orderID, organizationID, amount, amount.Code(), provider, models.PaymentStatusPending).Scan(&paymentID)
+	return paymentID, err
+}
+
+// SetPaymentExternalID сохраняет идентификатор платежа у провайдера (сессию оплаты Stripe)
+func (r *Repository) SetPaymentExternalID(ctx context.Context, paymentID int, externalID string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE payments SET external_id = $2 WHERE id = $1", paymentID, externalID)
+	return err
+}
+
+// SetPaymentProvider переводит ожидающий оплаты платеж на другого провайдера
+func (r *Repository) SetPaymentProvider(ctx context.Context, paymentID int, provider string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE payments SET provider = $2, external_id = NULL WHERE id = $1", paymentID, provider)
+	return err
+}
+
+const paymentColumns = `p.id, COALESCE(p.user_id, 0), COALESCE(p.order_id, 0), p.amount, p.currency, p.status,
+	COALESCE(p.robokassa_id, ''), p.created_at, p.completed_at, COALESCE(p.review_reason, ''), p.provider,
+	COALESCE(p.settlement_currency, ''), p.settlement_amount, p.version`
+
+func scanPayment(scan func(dest ...any) error, payment *models.Payment, extra ...any) error {
+	var amount string
+	var completedAt sql.NullTime
+	var settlementAmount sql.NullString
+	dest := []any{&payment.ID, &payment.UserID, &payment.OrderID, &amount, &payment.Currency,
+		&payment.Status, &payment.TransactionID, &payment.CreatedAt, &completedAt, &payment.ReviewReason,
+		&payment.Provider, &payment.SettlementCurrency, &settlementAmount, &payment.Version}
+	if err := scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	var err error
+	if payment.Amount, err = money.Parse(amount, payment.Currency); err != nil {
+		return fmt.Errorf("ошибка чтения суммы платежа %d: %w", payment.ID, err)
+	}
+	payment.CompletedAt = timePtr(completedAt)
+	if settlementAmount.Valid {
+		settlement, err := money.Parse(settlementAmount.String, payment.SettlementCurrency)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения суммы расчетов платежа %d: %w", payment.ID, err)
+		}
+		payment.SettlementAmount = &settlement
+	}
+	return nil
+}
+
+// Чтение суммы и валюты платежа из RETURNING amount, currency
+func scanCompletedPayment(row *sql.Row, payment *CompletedPayment) error {
+	var amount, currency string
+	if err := row.Scan(&payment.UserID, &payment.OrderID, &amount, &currency); err != nil {
+		return err
+	}
+	var err error
+	payment.Amount, err = money.Parse(amount, currency)
+	return err
+}
+
+// PaymentFilter - условия выборки платежей пользователя или организации; пустые поля
+// не ограничивают выборку. From и To ограничивают дату создания платежа: [From, To).
+type PaymentFilter struct {
+	UserID         int
+	OrganizationID int
+	Status         string
+	From           *time.Time
+	To             *time.Time
+	Limit          int
+	Offset         int
+}
+
+// ListPayments возвращает платежи по фильтру, начиная с последних, с номером счета:
+// счета, по которому проведен платеж, или последнего счета на оплату его заказа
+func (r *Repository) ListPayments(ctx context.Context, filter PaymentFilter) ([]models.Payment, error) {
+	query := `
+		SELECT ` + paymentColumns + `, COALESCE(
+			(SELECT i.number FROM invoices i WHERE i.payment_id = p.id LIMIT 1),
+			(SELECT i.number FROM invoices i WHERE i.order_id = p.order_id ORDER BY i.id DESC LIMIT 1),
+			'')
+		FROM payments p`
+	var args []any
+	if filter.OrganizationID > 0 {
+		query += " WHERE p.organization_id = $1"
+		args = append(args, filter.OrganizationID)
+	} else {
+		query += " WHERE p.user_id = $1"
+		args = append(args, filter.UserID)
+	}
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += fmt.Sprintf(" AND p.status = $%d", len(args))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		query += fmt.Sprintf(" AND p.created_at >= $%d", len(args))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		query += fmt.Sprintf(" AND p.created_at < $%d", len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY p.created_at DESC, p.id DESC LIMIT %d OFFSET %d", filter.Limit, filter.Offset)
+
+	rows, err := r.readQuery(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []models.Payment{}
+	for rows.Next() {
+		var payment models.Payment
+		if err := scanPayment(rows.Scan, &payment, &payment.InvoiceNumber); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// UserPayment возвращает платеж пользователя с указанным telegram_id
+func (r *Repository) UserPayment(ctx context.Context, paymentID int, telegramID int64) (*models.Payment, error) {
+	var payment models.Payment
+	err := scanPayment(r.db.QueryRowContext(ctx, `
+		SELECT `+paymentColumns+`
+		FROM payments p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.id = $1 AND u.telegram_id = $2
+	`, paymentID, telegramID).Scan, &payment)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// Payment возвращает платеж по ID
+func (r *Repository) Payment(ctx context.Context, paymentID int) (*models.Payment, error) {
+	var payment models.Payment
+	err := scanPayment(r.db.QueryRowContext(ctx,
+		"SELECT "+paymentColumns+" FROM payments p WHERE p.id = $1", paymentID,
+	).Scan, &payment)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// PaymentIDByTransaction возвращает ID платежа по идентификатору транзакции провайдера
+func (r *Repository) PaymentIDByTransaction(ctx context.Context, provider, transactionID string) (int, error) {
+	var paymentID int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT id FROM payments WHERE provider = $1 AND robokassa_id = $2",
+		provider, transactionID,
+	).Scan(&paymentID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return paymentID, err
+}
+
+// SetPaymentSettlement сохраняет сумму, зачисленную провайдером в валюте расчетов
+func (r *Repository) SetPaymentSettlement(ctx context.Context, paymentID int, settlement money.Money) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE payments SET settlement_currency = $2, settlement_amount = $3 WHERE id = $1",
+		paymentID, settlement.Code(), settlement,
+	)
+	return err
+}
+
+// RefundPayment отмечает проведенный платеж возвращенным и записывает в журнал платежей
+// возврат остатка по каждому заказу. Возвращает ErrNotFound, если платеж не проведен или
+// уже возвращен.
+func (r *Repository) RefundPayment(ctx context.Context, paymentID int, at time.Time) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		var currency string
+		err := tx.QueryRowContext(ctx,
+			"UPDATE payments SET status = $2, version = version + 1 WHERE id = $1 AND status = $3 RETURNING currency",
+			paymentID, models.PaymentStatusRefunded, models.PaymentStatusCompleted,
+		).Scan(&currency)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		return writeRefundLedger(ctx, tx, paymentID, currency, at)
+	})
+}
+
+// CompletePayment отмечает ожидающий платеж проведенным и в той же транзакции записывает
+// его в журнал платежей по заказам, а в outbox - уведомления, сформированные outbox по данным платежа. Если version > 0, платеж
+// обновляется только в этой версии. Возвращает ErrNotFound, если платеж не найден или уже
+// проведен, и ErrConflict, если ожидающий платеж изменен после чтения.
+func (r *Repository) CompletePayment(ctx context.Context, paymentID, version int, transactionID string, at time.Time,
+	outbox func(*CompletedPayment) ([]models.OutboxMessage, error)) (*CompletedPayment, error) {
+	var payment CompletedPayment
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		err := scanCompletedPayment(tx.QueryRowContext(ctx, `
+			UPDATE payments
+			SET status = $1, completed_at = $2, robokassa_id = $3, version = version + 1
+			WHERE id = $4 AND status = $5 AND ($6 = 0 OR version = $6)
+			RETURNING COALESCE(user_id, 0), COALESCE(order_id, 0), amount, currency
+		`, models.PaymentStatusCompleted, at, transactionID, paymentID, models.PaymentStatusPending, version,
+		), &payment)
+		if err == sql.ErrNoRows {
+			return pendingPaymentConflict(ctx, tx, paymentID, version)
+		} else if err != nil {
+			return err
+		}
+		if err := writePaymentLedger(ctx, tx, paymentID, at); err != nil {
+			return err
+		}
+		return writeOutbox(ctx, tx, func() ([]models.OutboxMessage, error) { return outbox(&payment) })
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// PendingPayments возвращает ожидающие оплаты платежи провайдера provider (всех провайдеров,
+// если он пуст), созданные раньше createdBefore, которые не сверялись после checkedBefore.
+// Платежи, отмеченные для проверки администратором, не возвращаются.
+func (r *Repository) PendingPayments(ctx context.Context, provider string, createdBefore, checkedBefore time.Time, limit int) ([]models.Payment, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, COALESCE(user_id, 0), COALESCE(order_id, 0), amount, currency, provider, created_at, version
+		FROM payments
+		WHERE status = $1 AND NOT needs_review AND created_at < $2
+		  AND (reconciled_at IS NULL OR reconciled_at < $3)
+		  AND ($5 = '' OR provider = $5)
+		ORDER BY reconciled_at NULLS FIRST, created_at
+		LIMIT $4
+	`, models.PaymentStatusPending, createdBefore, checkedBefore, limit, provider)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []models.Payment
+	for rows.Next() {
+		payment := models.Payment{Status: models.PaymentStatusPending}
+		var amount string
+		if err := rows.Scan(&payment.ID, &payment.UserID, &payment.OrderID, &amount,
+			&payment.Currency, &payment.Provider, &payment.CreatedAt, &payment.Version); err != nil {
+			return nil, err
+		}
+		if payment.Amount, err = money.Parse(amount, payment.Currency); err != nil {
+			return nil, fmt.Errorf("ошибка чтения суммы платежа %d: %w", payment.ID, err)
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// MarkPaymentReconciled запоминает время сверки платежа с Robokassa
+func (r *Repository) MarkPaymentReconciled(ctx context.Context, paymentID int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE payments SET reconciled_at = $2 WHERE id = $1", paymentID, at)
+	return err
+}
+
+// ClosePendingPayment переводит ожидающий платеж в статус status (отменен или возвращен).
+// Если version > 0, платеж обновляется только в этой версии. Возвращает ErrNotFound,
+// если платеж уже не ожидает оплаты, и ErrConflict, если он изменен после чтения.
+func (r *Repository) ClosePendingPayment(ctx context.Context, paymentID, version int, status string) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE payments SET status = $2, version = version + 1 WHERE id = $1 AND status = $3 AND ($4 = 0 OR version = $4)",
+		paymentID, status, models.PaymentStatusPending, version,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return pendingPaymentConflict(ctx, r.db, paymentID, version)
+	}
+	return nil
+}
+
+// Причина, по которой платеж не обновлен условием "ожидает оплаты в версии version":
+// ErrConflict, если платеж по-прежнему ожидает оплаты, но его версия изменилась,
+// иначе ErrNotFound
+func pendingPaymentConflict(ctx context.Context, q QueryRower, paymentID, version int) error {
+	if version == 0 {
+		return ErrNotFound
+	}
+	var current int
+	err := q.QueryRowContext(ctx,
+		"SELECT version FROM payments WHERE id = $1 AND status = $2",
+		paymentID, models.PaymentStatusPending,
+	).Scan(&current)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if current != version {
+		return ErrConflict
+	}
+	return ErrNotFound
+}
+
+// FlagPaymentForReview отмечает платеж для проверки администратором
+func (r *Repository) FlagPaymentForReview(ctx context.Context, paymentID int, reason string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE payments SET needs_review = TRUE, review_reason = $2 WHERE id = $1",
+		paymentID, reason,
+	)
+	return err
+}
+
+// PaymentsForReview возвращает платежи, отмеченные для проверки администратором
+func (r *Repository) PaymentsForReview(ctx context.Context, limit int) ([]models.Payment, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+paymentColumns+`
+		FROM payments p
+		WHERE p.needs_review
+		ORDER BY p.created_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []models.Payment
+	for rows.Next() {
+		var payment models.Payment
+		if err := scanPayment(rows.Scan, &payment); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// ExpirePayment отменяет неоплаченный платеж. Если у заказа платежа не осталось других
+// ожидающих или проведенных платежей и выставленных счетов, заказ возвращается в статус
+// "создан", а запросы КИЗ, зарезервированные под заказ, освобождаются. Уведомления,
+// сформированные outbox, записываются в той же транзакции. Если version > 0, платеж
+// отменяется только в этой версии. Возвращает ErrNotFound, если платеж уже не ожидает
+// оплаты, и ErrConflict, если он изменен после чтения.
+func (r *Repository) ExpirePayment(ctx context.Context, paymentID, version int,
+	outbox func(*CompletedPayment) ([]models.OutboxMessage, error)) (*CompletedPayment, error) {
+	var payment CompletedPayment
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		err := scanCompletedPayment(tx.QueryRowContext(ctx, `
+			UPDATE payments SET status = $1, version = version + 1
+			WHERE id = $2 AND status = $3 AND ($4 = 0 OR version = $4)
+			RETURNING COALESCE(user_id, 0), COALESCE(order_id, 0), amount, currency
+		`, models.PaymentStatusCancelled, paymentID, models.PaymentStatusPending, version,
+		), &payment)
+		if err == sql.ErrNoRows {
+			return pendingPaymentConflict(ctx, tx, paymentID, version)
+		} else if err != nil {
+			return err
+		}
+		if err := writeOutbox(ctx, tx, func() ([]models.OutboxMessage, error) { return outbox(&payment) }); err != nil {
+			return err
+		}
+		if payment.OrderID == 0 {
+			return nil
+		}
+
+		var active bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM payments WHERE order_id = $1 AND status IN ($2, $3))
+				OR EXISTS (SELECT 1 FROM invoices WHERE order_id = $1 AND status = $4)
+		`, payment.OrderID, models.PaymentStatusPending, models.PaymentStatusCompleted, models.InvoiceStatusIssued,
+		).Scan(&active); err != nil {
+			return fmt.Errorf("ошибка проверки платежей заказа: %w", err)
+		}
+		if active {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE orders SET status = $1, updated_at = NOW(), version = version + 1 WHERE id = $2 AND status = $3",
+			models.OrderStatusCreated, payment.OrderID, models.OrderStatusPending,
+		); err != nil {
+			return fmt.Errorf("ошибка обновления заказа: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE kiz_requests SET status = 'cancelled', version = version + 1, updated_at = NOW() WHERE order_id = $1 AND status = 'pending'",
+			payment.OrderID,
+		); err != nil {
+			return fmt.Errorf("ошибка освобождения КИЗ: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+const planColumns = "name, title, monthly_codes, daily_requests, updated_at"
+
+func scanPlan(scan func(dest ...any) error, plan *models.Plan) error {
+	return scan(&plan.Name, &plan.Title, &plan.MonthlyCodes, &plan.DailyRequests, &plan.UpdatedAt)
+}
+
+// Plans возвращает все тарифные планы
+func (r *Repository) Plans(ctx context.Context) ([]models.Plan, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+planColumns+" FROM plans ORDER BY monthly_codes = 0, monthly_codes, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plans []models.Plan
+	for rows.Next() {
+		var plan models.Plan
+		if err := scanPlan(rows.Scan, &plan); err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, rows.Err()
+}
+
+// Plan возвращает тарифный план по коду
+func (r *Repository) Plan(ctx context.Context, name string) (*models.Plan, error) {
+	var plan models.Plan
+	err := scanPlan(r.db.QueryRowContext(ctx, "SELECT "+planColumns+" FROM plans WHERE name = $1", name).Scan, &plan)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// SetPlan создает или изменяет тарифный план
+func (r *Repository) SetPlan(ctx context.Context, plan *models.Plan) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO plans (name, title, monthly_codes, daily_requests)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE
+		SET title = EXCLUDED.title, monthly_codes = EXCLUDED.monthly_codes,
+			daily_requests = EXCLUDED.daily_requests, updated_at = NOW()
+		RETURNING updated_at
+	`, plan.Name, plan.Title, plan.MonthlyCodes, plan.DailyRequests).Scan(&plan.UpdatedAt)
+}
+
+// UserPlan возвращает код тарифного плана пользователя; пустая строка - план не назначен
+func (r *Repository) UserPlan(ctx context.Context, userID int) (string, error) {
+	var plan sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		"SELECT plan FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&plan)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return plan.String, err
+}
+
+// SetUserPlan назначает пользователю тарифный план; пустой код снимает план
+func (r *Repository) SetUserPlan(ctx context.Context, userID int, plan string) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET plan = NULLIF($2, '') WHERE id = $1 AND deleted_at IS NULL", userID, plan)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ConsumeUsage увеличивает счетчик метрики пользователя за период на amount, если
+// потребление не превысит limit (0 - без ограничения). Возвращает новое значение
+// счетчика и false, если квота исчерпана; в этом случае счетчик не изменяется.
+func (r *Repository) ConsumeUsage(ctx context.Context, userID int, metric string, periodStart time.Time, amount, limit int64) (int64, bool, error) {
+	var used int64
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO usage_counters (user_id, metric, period_start, used)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, metric, period_start) DO UPDATE
+		SET used = usage_counters.used + EXCLUDED.used
+		WHERE $5::BIGINT = 0 OR usage_counters.used + EXCLUDED.used <= $5
+		RETURNING used
+	`, userID, metric, periodStart, amount, limit).Scan(&used)
+	if err == sql.ErrNoRows {
+		used, err = r.Usage(ctx, userID, metric, periodStart)
+		return used, false, err
+	}
+	return used, err == nil, err
+}
+
+// ReleaseUsage уменьшает счетчик метрики за период на amount, например после ошибки
+// запроса кодов, учтенных до обращения к Честному ЗНАКу
+func (r *Repository) ReleaseUsage(ctx context.Context, userID int, metric string, periodStart time.Time, amount int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE usage_counters SET used = GREATEST(used - $4, 0)
+		WHERE user_id = $1 AND metric = $2 AND period_start = $3
+	`, userID, metric, periodStart, amount)
+	return err
+}
+
+// Usage возвращает значение счетчика метрики пользователя за период
+func (r *Repository) Usage(ctx context.Context, userID int, metric string, periodStart time.Time) (int64, error) {
+	var used int64
+	err := r.db.QueryRowContext(ctx,
+		"SELECT used FROM usage_counters WHERE user_id = $1 AND metric = $2 AND period_start = $3",
+		userID, metric, periodStart).Scan(&used)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return used, err
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// DocumentReceipt - подписанная квитанция Честного ЗНАКа о результате обработки документа
+type DocumentReceipt struct {
+	ID           int
+	DocumentType string // introduction или retirement
+	DocumentID   int
+	Ticket       string // Идентификатор квитанции в Честном ЗНАКе
+	Content      []byte
+	ContentType  string
+	SHA256       string // Хэш содержимого в шестнадцатеричном виде
+	CreatedAt    time.Time
+}
+
+// SaveDocumentReceipt сохраняет квитанцию по документу и заполняет ID, SHA256 и CreatedAt.
+// Ранее сохраненная квитанция документа не заменяется: receipt заполняется ее данными.
+func (r *Repository) SaveDocumentReceipt(ctx context.Context, receipt *DocumentReceipt) error {
+	digest := sha256.Sum256(receipt.Content)
+	receipt.SHA256 = hex.EncodeToString(digest[:])
+	if _, err := r.db.ExecContext(ctx, `
+		INSERT INTO document_receipts (document_type, document_id, ticket, content, content_type, sha256)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (document_type, document_id) DO NOTHING
+	`, receipt.DocumentType, receipt.DocumentID, receipt.Ticket, receipt.Content, receipt.ContentType, receipt.SHA256); err != nil {
+		return err
+	}
+
+	saved, err := r.DocumentReceipt(ctx, receipt.DocumentType, receipt.DocumentID)
+	if err != nil {
+		return err
+	}
+	*receipt = *saved
+	return nil
+}
+
+// DocumentReceipt возвращает квитанцию по документу; ErrNotFound, если она не сохранена
+func (r *Repository) DocumentReceipt(ctx context.Context, documentType string, documentID int) (*DocumentReceipt, error) {
+	receipt := DocumentReceipt{DocumentType: documentType, DocumentID: documentID}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, ticket, content, content_type, sha256, created_at
+		FROM document_receipts
+		WHERE document_type = $1 AND document_id = $2
+	`, documentType, documentID).Scan(&receipt.ID, &receipt.Ticket, &receipt.Content, &receipt.ContentType,
+		&receipt.SHA256, &receipt.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
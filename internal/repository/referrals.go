@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+)
+
+// Число последних приглашенных пользователей в статистике
+const referralListLimit = 50
+
+// ReferralCredit - начисление пригласившему за первый платеж приглашенного пользователя
+type ReferralCredit struct {
+	ReferralID int
+	ReferrerID int
+	Bonus      money.Money
+}
+
+// ReferralCode возвращает реферальный код пользователя. Если кода еще нет, сохраняется code.
+func (r *Repository) ReferralCode(ctx context.Context, userID int, code string) (string, error) {
+	var referralCode string
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE users SET referral_code = COALESCE(referral_code, $2)
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING referral_code
+	`, userID, code).Scan(&referralCode)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return referralCode, err
+}
+
+// CreateReferral связывает пользователя с пригласившим его владельцем реферального кода
+// и возвращает ID пригласившего. Возвращает ErrNotFound, если код не найден, принадлежит
+// самому пользователю или пользователь уже был приглашен.
+func (r *Repository) CreateReferral(ctx context.Context, referredID int, code string) (int, error) {
+	var referrerID int
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO referrals (referrer_id, referred_id)
+		SELECT id, $2 FROM users
+		WHERE referral_code = $1 AND id <> $2 AND deleted_at IS NULL
+		ON CONFLICT (referred_id) DO NOTHING
+		RETURNING referrer_id
+	`, code, referredID).Scan(&referrerID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return referrerID, err
+}
+
+// CreditReferralBonus отмечает первый платеж приглашенного пользователя и начисляет
+// пригласившему бонус на баланс в одной транзакции с уведомлениями outbox. Нулевой бонус
+// не начисляется. Возвращает ErrNotFound, если пользователь не был приглашен или его
+// первый платеж уже учтен.
+func (r *Repository) CreditReferralBonus(ctx context.Context, referredID, paymentID int, bonus money.Money, at time.Time,
+	outbox func(*ReferralCredit) ([]models.OutboxMessage, error)) (*ReferralCredit, error) {
+	credit := ReferralCredit{Bonus: bonus}
+	var bonusAmount *money.Money
+	if bonus.IsPositive() {
+		bonusAmount = &bonus
+	}
+
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			UPDATE referrals SET first_payment_id = $2, paid_at = $3, bonus_amount = $4
+			WHERE referred_id = $1 AND paid_at IS NULL
+			RETURNING id, referrer_id
+		`, referredID, paymentID, at, bonusAmount).Scan(&credit.ReferralID, &credit.ReferrerID)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if bonusAmount != nil {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO balance_transactions (user_id, amount, currency, kind, reference, description, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				ON CONFLICT (kind, reference) DO NOTHING
+			`, credit.ReferrerID, bonus, bonus.Code(), models.BalanceKindReferralBonus,
+				strconv.Itoa(credit.ReferralID), "Бонус за приглашенного пользователя", at); err != nil {
+				return fmt.Errorf("ошибка начисления бонуса: %w", err)
+			}
+		}
+		return writeOutbox(ctx, tx, func() ([]models.OutboxMessage, error) { return outbox(&credit) })
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &credit, nil
+}
+
+// UserBalance возвращает бонусный баланс пользователя в рублях
+func (r *Repository) UserBalance(ctx context.Context, userID int) (money.Money, error) {
+	balance := money.Rubles(0)
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COALESCE(SUM(amount), 0) FROM balance_transactions WHERE user_id = $1 AND currency = $2",
+		userID, money.RUB,
+	).Scan(&balance)
+	return balance, err
+}
+
+// PayOrderFromBalance оплачивает заказ с бонусного баланса пользователя: списывает сумму
+// заказа, создает проведенный платеж и переводит заказ в статус оплаченного. Возвращает ID
+// платежа; ErrInsufficientBalance, если баланса не хватает, и ErrOrderNotPayable, если заказ
+// отменен или уже оплачен.
+func (r *Repository) PayOrderFromBalance(ctx context.Context, orderID, userID int, at time.Time) (int, error) {
+	var paymentID int
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		// Блокировка пользователя исключает одновременное списание с одного баланса
+		if _, err := tx.ExecContext(ctx, "SELECT id FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+			return fmt.Errorf("ошибка блокировки баланса: %w", err)
+		}
+
+		var status string
+		var organizationID int
+		amount := money.Rubles(0)
+		err := tx.QueryRowContext(ctx,
+			"SELECT status, COALESCE(organization_id, 0), total_amount FROM orders WHERE id = $1 FOR UPDATE", orderID,
+		).Scan(&status, &organizationID, &amount)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		if status != models.OrderStatusCreated && status != models.OrderStatusPending {
+			return ErrOrderNotPayable
+		}
+
+		balance := money.Rubles(0)
+		if err := tx.QueryRowContext(ctx,
+			"SELECT COALESCE(SUM(amount), 0) FROM balance_transactions WHERE user_id = $1 AND currency = $2",
+			userID, money.RUB,
+		).Scan(&balance); err != nil {
+			return fmt.Errorf("ошибка получения баланса: %w", err)
+		}
+		if balance.Minor < amount.Minor {
+			return ErrInsufficientBalance
+		}
+
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO payments (user_id, order_id, organization_id, amount, status, completed_at, provider)
+			VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7)
+			RETURNING id
+		`, userID, orderID, organizationID, amount, models.PaymentStatusCompleted, at, models.PaymentProviderBalance,
+		).Scan(&paymentID); err != nil {
+			return fmt.Errorf("ошибка создания платежа: %w", err)
+		}
+		if err := writePaymentLedger(ctx, tx, paymentID, at); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO balance_transactions (user_id, amount, currency, kind, reference, description, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, userID, money.Rubles(-amount.Minor), money.RUB, models.BalanceKindOrderPayment,
+			strconv.Itoa(orderID), fmt.Sprintf("Оплата заказа №%d", orderID), at); err != nil {
+			return fmt.Errorf("ошибка списания с баланса: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE orders SET status = $1, updated_at = NOW(), version = version + 1 WHERE id = $2",
+			models.OrderStatusPaid, orderID,
+		); err != nil {
+			return fmt.Errorf("ошибка обновления заказа: %w", err)
+		}
+		return nil
+	})
+	return paymentID, err
+}
+
+// ReferralStats возвращает число приглашенных пользователем, число оплативших, сумму
+// начисленных бонусов и последних приглашенных
+func (r *Repository) ReferralStats(ctx context.Context, userID int) (*models.ReferralStats, error) {
+	stats := models.ReferralStats{BonusTotal: money.Rubles(0), Referrals: []models.Referral{}}
+	if err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(paid_at), COALESCE(SUM(bonus_amount), 0)
+		FROM referrals WHERE referrer_id = $1
+	`, userID).Scan(&stats.Invited, &stats.Paid, &stats.BonusTotal); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT created_at, paid_at, bonus_amount
+		FROM referrals WHERE referrer_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, userID, referralListLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var referral models.Referral
+		var paidAt sql.NullTime
+		var bonus sql.NullString
+		if err := rows.Scan(&referral.RegisteredAt, &paidAt, &bonus); err != nil {
+			return nil, err
+		}
+		referral.PaidAt = timePtr(paidAt)
+		if bonus.Valid {
+			amount, err := money.Parse(bonus.String, money.RUB)
+			if err != nil {
+				return nil, fmt.Errorf("ошибка чтения бонуса: %w", err)
+			}
+			referral.Bonus = &amount
+		}
+		stats.Referrals = append(stats.Referrals, referral)
+	}
+	return &stats, rows.Err()
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Сколько реплика не используется после ошибки соединения с ней
+const replicaRetryInterval = 30 * time.Second
+
+// Реплика для запросов чтения. После ошибки соединения запросы на replicaRetryInterval
+// переключаются на основной пул.
+type replica struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	downUntil time.Time
+
+	fallbacks atomic.Int64
+}
+
+// Выполнение запроса, возвращающего строки: *sql.DB.QueryContext или Repository.readQuery
+type queryFunc func(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+
+// PoolStats - метрики пула соединений с БД
+type PoolStats struct {
+	Name string // primary или replica
+	sql.DBStats
+	Available bool  // Реплика используется для чтения; для основного пула всегда true
+	Fallbacks int64 // Число запросов чтения, переключенных с реплики на основной пул
+}
+
+// SetReplica подключает реплику, на которой выполняются тяжелые запросы чтения: истории,
+// выписки и аналитика. Данные на реплике могут отставать от основного сервера, поэтому
+// чтения, за которыми следует изменение, всегда выполняются на основном пуле.
+func (r *Repository) SetReplica(db *sql.DB) {
+	r.replica = &replica{db: db}
+}
+
+// PoolStats возвращает метрики основного пула и, если подключена, реплики
+func (r *Repository) PoolStats() []PoolStats {
+	stats := []PoolStats{{Name: "primary", DBStats: r.db.Stats(), Available: true}}
+	if r.replica != nil {
+		stats = append(stats, PoolStats{
+			Name:      "replica",
+			DBStats:   r.replica.db.Stats(),
+			Available: r.replica.available(time.Now()),
+			Fallbacks: r.replica.fallbacks.Load(),
+		})
+	}
+	return stats
+}
+
+// Запрос чтения на реплике, если она подключена и доступна. При ошибке соединения
+// с репликой запрос повторяется на основном пуле.
+func (r *Repository) readQuery(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if r.replica != nil && r.replica.available(time.Now()) {
+		rows, err := r.replica.db.QueryContext(ctx, query, args...)
+		if err == nil || !r.replica.failed(ctx, err) {
+			return rows, err
+		}
+	}
+	return r.db.QueryContext(ctx, query, args...)
+}
+
+// Запрос одной строки на реплике с переключением на основной пул, как в readQuery
+func (r *Repository) readQueryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	if r.replica != nil && r.replica.available(time.Now()) {
+		row := r.replica.db.QueryRowContext(ctx, query, args...)
+		if err := row.Err(); err == nil || !r.replica.failed(ctx, err) {
+			return row
+		}
+	}
+	return r.db.QueryRowContext(ctx, query, args...)
+}
+
+func (rep *replica) available(now time.Time) bool {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return !now.Before(rep.downUntil)
+}
+
+// Проверка ошибки запроса к реплике. Если реплика недоступна, она исключается из чтения
+// на replicaRetryInterval и возвращается true: запрос нужно повторить на основном пуле.
+func (rep *replica) failed(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || !replicaUnavailable(err) {
+		return false
+	}
+	rep.mu.Lock()
+	rep.downUntil = time.Now().Add(replicaRetryInterval)
+	rep.mu.Unlock()
+	rep.fallbacks.Add(1)
+	return true
+}
+
+// Ошибка соединения с сервером, а не ошибка самого запроса: сервер недоступен, соединение
+// разорвано, сервер останавливается (класс 57P) или отменил запрос из-за конфликта
+// с восстановлением реплики (40001)
+func replicaUnavailable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code[:2] == "08" || pgErr.Code[:3] == "57P"
+	}
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) || errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+// ReportSettings возвращает настройки отчетов пользователя; без сохраненных настроек
+// отчеты отключены, а доставка включена во все каналы
+func (r *Repository) ReportSettings(ctx context.Context, userID int) (models.ReportSettings, error) {
+	settings := models.ReportSettings{
+		UserID:    userID,
+		Frequency: models.ReportFrequencyOff,
+		Telegram:  true,
+		Email:     true,
+	}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT frequency, telegram, email, updated_at
+		FROM report_settings
+		WHERE user_id = $1
+	`, userID).Scan(&settings.Frequency, &settings.Telegram, &settings.Email, &settings.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	return settings, err
+}
+
+// SaveReportSettings сохраняет настройки отчетов и заполняет время изменения
+func (r *Repository) SaveReportSettings(ctx context.Context, settings *models.ReportSettings) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO report_settings (user_id, frequency, telegram, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET frequency = EXCLUDED.frequency,
+			telegram = EXCLUDED.telegram,
+			email = EXCLUDED.email,
+			updated_at = NOW()
+		RETURNING updated_at
+	`, settings.UserID, settings.Frequency, settings.Telegram, settings.Email).Scan(&settings.UpdatedAt)
+}
+
+// ReportTimezones возвращает часовые пояса пользователей с указанной периодичностью
+// отчетов; пустая строка - пользователи, не выбравшие часовой пояс
+func (r *Repository) ReportTimezones(ctx context.Context, frequency string) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT COALESCE(u.timezone, '')
+		FROM report_settings s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.frequency = $1 AND u.deleted_at IS NULL
+		ORDER BY 1
+	`, frequency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var timezones []string
+	for rows.Next() {
+		var timezone string
+		if err := rows.Scan(&timezone); err != nil {
+			return nil, err
+		}
+		timezones = append(timezones, timezone)
+	}
+	return timezones, rows.Err()
+}
+
+// DueReportUsers возвращает настройки пользователей часового пояса timezone с указанной
+// периодичностью отчетов, которым еще не сформирован отчет за период, начинающийся в periodStart
+func (r *Repository) DueReportUsers(ctx context.Context, frequency, timezone string, periodStart time.Time, limit int) ([]models.ReportSettings, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT s.user_id, s.frequency, s.telegram, s.email, s.updated_at
+		FROM report_settings s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.frequency = $1 AND u.deleted_at IS NULL AND COALESCE(u.timezone, '') = $2
+			AND NOT EXISTS (
+				SELECT 1 FROM reports rp
+				WHERE rp.user_id = s.user_id AND rp.frequency = s.frequency AND rp.period_start = $3
+			)
+		ORDER BY s.user_id
+		LIMIT $4
+	`, frequency, timezone, periodStart, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.ReportSettings
+	for rows.Next() {
+		var settings models.ReportSettings
+		if err := rows.Scan(&settings.UserID, &settings.Frequency, &settings.Telegram, &settings.Email, &settings.UpdatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, settings)
+	}
+	return users, rows.Err()
+}
+
+// ReportSummary подсчитывает показатели пользователя за период [from, to)
+func (r *Repository) ReportSummary(ctx context.Context, userID int, from, to time.Time) (models.ReportSummary, error) {
+	var summary models.ReportSummary
+	err := r.readQueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM kiz_requests
+				WHERE user_id = $1 AND request_time >= $2 AND request_time < $3),
+			(SELECT COUNT(*) FROM kiz_codes c JOIN kiz_requests kr ON kr.id = c.request_id
+				WHERE kr.user_id = $1 AND c.created_at >= $2 AND c.created_at < $3),
+			(SELECT COUNT(*) FROM kiz_requests
+				WHERE user_id = $1 AND status IN ($4, $5) AND failed_at >= $2 AND failed_at < $3),
+			(SELECT COUNT(*) FROM payments
+				WHERE user_id = $1 AND status = $6 AND completed_at >= $2 AND completed_at < $3),
+			(SELECT COALESCE(SUM(amount), 0) FROM payments
+				WHERE user_id = $1 AND status = $6 AND completed_at >= $2 AND completed_at < $3),
+			(SELECT COUNT(*) FROM introduction_documents
+				WHERE user_id = $1 AND submitted_at >= $2 AND submitted_at < $3)
+			+ (SELECT COUNT(*) FROM retirement_documents
+				WHERE user_id = $1 AND submitted_at >= $2 AND submitted_at < $3),
+			(SELECT COUNT(*) FROM introduction_documents
+				WHERE user_id = $1 AND status = $7 AND processed_at >= $2 AND processed_at < $3)
+			+ (SELECT COUNT(*) FROM retirement_documents
+				WHERE user_id = $1 AND status = $7 AND processed_at >= $2 AND processed_at < $3)
+	`, userID, from, to,
+		models.KIZRequestStatusFailed, models.KIZRequestStatusDead,
+		models.PaymentStatusCompleted, models.DocumentStatusRejected,
+	).Scan(
+		&summary.KIZRequests, &summary.CodesOrdered, &summary.FailedRequests,
+		&summary.Payments, &summary.AmountSpent,
+		&summary.DocumentsSubmitted, &summary.DocumentsRejected,
+	)
+	return summary, err
+}
+
+// SaveReport сохраняет отчет и уведомления о нем в одной транзакции. Если отчет за этот
+// период уже сформирован, возвращается ErrNotFound и уведомления не создаются.
+func (r *Repository) SaveReport(ctx context.Context, report *models.Report, outbox func() ([]models.OutboxMessage, error)) error {
+	summary, err := json.Marshal(report.Summary)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации отчета: %w", err)
+	}
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO reports (user_id, frequency, period_start, period_end, summary)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (user_id, frequency, period_start) DO NOTHING
+			RETURNING id, created_at
+		`, report.UserID, report.Frequency, report.PeriodStart, report.PeriodEnd, summary).Scan(&report.ID, &report.CreatedAt)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения отчета: %w", err)
+		}
+		return writeOutbox(ctx, tx, outbox)
+	})
+}
+
+// ListReports возвращает последние отчеты пользователя
+func (r *Repository) ListReports(ctx context.Context, userID, limit int) ([]models.Report, error) {
+	rows, err := r.readQuery(ctx, `
+		SELECT id, user_id, frequency, period_start, period_end, summary, created_at
+		FROM reports
+		WHERE user_id = $1
+		ORDER BY period_start DESC, id DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []models.Report{}
+	for rows.Next() {
+		var report models.Report
+		if err := scanReport(rows.Scan, &report); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+// Report возвращает отчет пользователя по ID
+func (r *Repository) Report(ctx context.Context, userID, reportID int) (*models.Report, error) {
+	var report models.Report
+	err := scanReport(r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, frequency, period_start, period_end, summary, created_at
+		FROM reports
+		WHERE id = $1 AND user_id = $2
+	`, reportID, userID).Scan, &report)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func scanReport(scan func(dest ...any) error, report *models.Report) error {
+	var summary []byte
+	if err := scan(&report.ID, &report.UserID, &report.Frequency, &report.PeriodStart, &report.PeriodEnd,
+		&summary, &report.CreatedAt); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(summary, &report.Summary); err != nil {
+		return fmt.Errorf("ошибка чтения отчета: %w", err)
+	}
+	return nil
+}
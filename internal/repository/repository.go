@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Ошибки поиска данных
+var (
+	ErrNotFound              = errors.New("запись не найдена")
+	ErrNotOrganizationMember = errors.New("пользователь не состоит в организации")
+	ErrOrderNotCancellable   = errors.New("заказ не может быть отменен в текущем статусе")
+	ErrOrderNotPayable       = errors.New("заказ не может быть оплачен в текущем статусе")
+	ErrInsufficientBalance   = errors.New("недостаточно средств на бонусном балансе")
+	ErrInvoiceNotIssued      = errors.New("счет уже оплачен или отменен")
+	ErrAPIKeyInactive        = errors.New("API ключ отозван или истек")
+	ErrDocumentExists        = errors.New("для заказа уже создан документ ввода в оборот")
+	ErrDocumentNotDraft      = errors.New("документ уже отправлен")
+	ErrCodesRetired          = errors.New("коды уже выведены из оборота")
+	ErrInsufficientCodes     = errors.New("недостаточно доступных кодов")
+	ErrSoleOwner             = errors.New("пользователь - единственный владелец организации с участниками")
+	ErrConflict              = errors.New("запись изменена другим запросом")
+	ErrOrganizationExists    = errors.New("организация с таким ИНН уже зарегистрирована")
+	ErrMergePartners         = errors.New("оба пользователя являются партнерами")
+	ErrRefundExceedsBalance  = errors.New("сумма возврата больше остатка по заказу")
+	ErrPaymentExceedsBalance = errors.New("сумма платежа больше неоплаченного остатка заказа")
+)
+
+// QueryRower - общий интерфейс *sql.DB и *sql.Tx для запросов, возвращающих одну строку
+type QueryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Repository - доступ к данным сервиса в PostgreSQL или, для локальной разработки, в SQLite
+type Repository struct {
+	db      *sql.DB
+	replica *replica // Реплика для тяжелых запросов чтения; nil, если не подключена
+	sqlite  bool     // БД открыта через OpenSQLite
+}
+
+// New создает репозиторий поверх открытого соединения
+func New(db *sql.DB) *Repository {
+	return &Repository{db: db, sqlite: isSQLite(db)}
+}
+
+// Open открывает пул соединений с БД и проверяет подключение. Если задан password,
+// пароль запрашивается перед каждым новым соединением: после ротации пароля новые
+// соединения открываются с новым паролем, старые закрываются по истечении срока жизни.
+func Open(ctx context.Context, dsn string, password func() string) (*sql.DB, error) {
+	db, err := openDB(dsn, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка проверки соединения: %w", err)
+	}
+
+	return db, nil
+}
+
+// OpenReplica открывает пул соединений с репликой без проверки подключения: недоступная
+// при запуске реплика подключится позже, а до этого чтение выполняется на основном пуле
+func OpenReplica(dsn string, password func() string) (*sql.DB, error) {
+	return openDB(dsn, password)
+}
+
+// Открытие пула соединений с трассировкой запросов и паролем из password
+func openDB(dsn string, password func() string) (*sql.DB, error) {
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к БД: %w", err)
+	}
+	connConfig.Tracer = queryTracer{}
+	// Колонки TIMESTAMP хранят время UTC: NOW() и CURRENT_DATE сеанса должны совпадать
+	// со временем сервиса независимо от часового пояса сервера БД
+	connConfig.RuntimeParams["timezone"] = "UTC"
+
+	var options []stdlib.OptionOpenDB
+	if password != nil {
+		options = append(options, stdlib.OptionBeforeConnect(func(_ context.Context, config *pgx.ConnConfig) error {
+			config.Password = password()
+			return nil
+		}))
+	}
+	db := stdlib.OpenDB(*connConfig, options...)
+
+	// Установка параметров соединения
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	return db, nil
+}
+
+// Ping проверяет соединение с БД
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// Выполнение функции в транзакции. Транзакция подтверждается, если fn не вернула ошибку.
+func (r *Repository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return nil
+}
+
+// Преобразование sql.NullTime в указатель
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// Преобразование sql.NullFloat64 в указатель
+func floatPtr(f sql.NullFloat64) *float64 {
+	if !f.Valid {
+		return nil
+	}
+	return &f.Float64
+}
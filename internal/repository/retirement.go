@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+const retirementColumns = `id, COALESCE(organization_id, 0), user_id, participant_inn,
+	COALESCE(product_group, ''), reason, action_date,
+	COALESCE(primary_document_number, ''), primary_document_date, codes, status,
+	COALESCE(external_id, ''), COALESCE(error, ''), COALESCE(ticket, ''), created_at, submitted_at,
+	processed_at, updated_at`
+
+// Условие доступа к документу вывода из оборота ($2 - ID пользователя): документ создан
+// пользователем или принадлежит организации, в которой он состоит
+const retirementAccessCondition = `(user_id = $2 OR organization_id IN
+	(SELECT organization_id FROM organization_members WHERE user_id = $2))`
+
+// KIZCodeRef - полученный код маркировки с участником оборота, для которого он выпущен,
+// и товарной группой запроса
+type KIZCodeRef struct {
+	Code           string
+	INN            string
+	OrganizationID int
+	ProductGroup   string
+}
+
+// Чтение документа вывода из оборота из строки результата запроса
+func scanRetirementDocument(scan func(dest ...any) error, doc *models.RetirementDocument) error {
+	var codes []byte
+	var primaryDocumentDate, submittedAt, processedAt sql.NullTime
+	if err := scan(&doc.ID, &doc.OrganizationID, &doc.UserID, &doc.ParticipantINN,
+		&doc.ProductGroup, &doc.Reason, &doc.ActionDate,
+		&doc.PrimaryDocumentNumber, &primaryDocumentDate, &codes, &doc.Status,
+		&doc.ExternalID, &doc.Error, &doc.Ticket, &doc.CreatedAt, &submittedAt,
+		&processedAt, &doc.UpdatedAt); err != nil {
+		return err
+	}
+
+	doc.PrimaryDocumentDate = timePtr(primaryDocumentDate)
+	doc.SubmittedAt = timePtr(submittedAt)
+	doc.ProcessedAt = timePtr(processedAt)
+	if err := json.Unmarshal(codes, &doc.Codes); err != nil {
+		return fmt.Errorf("ошибка чтения кодов документа: %w", err)
+	}
+	return nil
+}
+
+// AccessibleKIZCodes возвращает коды маркировки из сохраненных результатов запросов КИЗ,
+// доступных пользователю: все коды указанных запросов и отдельно перечисленные коды
+func (r *Repository) AccessibleKIZCodes(ctx context.Context, userID int, requestIDs []int, codes []string) ([]KIZCodeRef, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT code, req.inn, COALESCE(req.organization_id, 0), COALESCE(req.product_group, '')
+		FROM kiz_requests req
+		JOIN kiz_results res ON res.request_id = req.id
+		CROSS JOIN LATERAL jsonb_array_elements_text(res.kiz_data) AS code
+		WHERE req.status <> 'cancelled'
+		  AND (req.id = ANY($1) OR code = ANY($3))
+		  AND (req.user_id = $2 OR req.organization_id IN
+			(SELECT organization_id FROM organization_members WHERE user_id = $2))
+		ORDER BY res.id
+	`, requestIDs, userID, codes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refs []KIZCodeRef
+	for rows.Next() {
+		var ref KIZCodeRef
+		if err := rows.Scan(&ref.Code, &ref.INN, &ref.OrganizationID, &ref.ProductGroup); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+
+	return refs, rows.Err()
+}
+
+// Коды из списка, уже включенные в неотклоненные документы вывода из оборота
+func retiredCodes(ctx context.Context, tx *sql.Tx, codes []string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT code
+		FROM retirement_documents d
+		CROSS JOIN LATERAL jsonb_array_elements_text(d.codes) AS code
+		WHERE d.status <> $1 AND code = ANY($2)
+	`, models.DocumentStatusRejected, codes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var retired []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		retired = append(retired, code)
+	}
+
+	return retired, rows.Err()
+}
+
+// CreateRetirementDocument сохраняет черновик документа вывода из оборота. Если часть кодов
+// уже включена в другой неотклоненный документ, возвращается ErrCodesRetired и список этих кодов.
+func (r *Repository) CreateRetirementDocument(ctx context.Context, doc *models.RetirementDocument) ([]string, error) {
+	codes, err := json.Marshal(doc.Codes)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации кодов: %w", err)
+	}
+
+	var retired []string
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		// Документы вывода из оборота создаются последовательно, чтобы один код
+		// не попал в два документа
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('retirement_documents'))"); err != nil {
+			return fmt.Errorf("ошибка блокировки: %w", err)
+		}
+
+		if retired, err = retiredCodes(ctx, tx, doc.Codes); err != nil {
+			return fmt.Errorf("ошибка проверки кодов: %w", err)
+		}
+		if len(retired) > 0 {
+			return ErrCodesRetired
+		}
+
+		return tx.QueryRowContext(ctx, `
+			INSERT INTO retirement_documents (organization_id, user_id, participant_inn, product_group, reason,
+				action_date, primary_document_number, primary_document_date, codes, status)
+			VALUES (NULLIF($1, 0), $2, $3, NULLIF($4, ''), $5, $6, NULLIF($7, ''), $8, $9, $10)
+			RETURNING id, created_at, updated_at
+		`, doc.OrganizationID, doc.UserID, doc.ParticipantINN, doc.ProductGroup, doc.Reason, doc.ActionDate,
+			doc.PrimaryDocumentNumber, doc.PrimaryDocumentDate, codes, doc.Status,
+		).Scan(&doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
+	})
+	return retired, err
+}
+
+// RetirementDocument возвращает документ вывода из оборота, доступный пользователю
+func (r *Repository) RetirementDocument(ctx context.Context, documentID, userID int) (*models.RetirementDocument, error) {
+	var doc models.RetirementDocument
+	err := scanRetirementDocument(r.db.QueryRowContext(ctx,
+		"SELECT "+retirementColumns+" FROM retirement_documents WHERE id = $1 AND "+retirementAccessCondition,
+		documentID, userID,
+	).Scan, &doc)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ListRetirementDocuments возвращает документы вывода из оборота, доступные пользователю, начиная с последних
+func (r *Repository) ListRetirementDocuments(ctx context.Context, userID, limit int) ([]models.RetirementDocument, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+retirementColumns+" FROM retirement_documents WHERE "+retirementAccessCondition+
+			" ORDER BY created_at DESC LIMIT $1",
+		limit, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.RetirementDocument{}
+	for rows.Next() {
+		var doc models.RetirementDocument
+		if err := scanRetirementDocument(rows.Scan, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, rows.Err()
+}
+
+// RetirementDocumentOrganizationID возвращает организацию документа; 0, если документ личный или не найден
+func (r *Repository) RetirementDocumentOrganizationID(ctx context.Context, documentID int) (int, error) {
+	var organizationID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, "SELECT organization_id FROM retirement_documents WHERE id = $1", documentID).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return int(organizationID.Int64), err
+}
+
+// BeginRetirementSubmission переводит черновик в статус отправленного
+func (r *Repository) BeginRetirementSubmission(ctx context.Context, documentID int) error {
+	return r.beginSubmission(ctx, "retirement_documents", documentID)
+}
+
+// CancelRetirementSubmission возвращает документ в черновики после неудачной отправки
+func (r *Repository) CancelRetirementSubmission(ctx context.Context, documentID int) error {
+	return r.cancelSubmission(ctx, "retirement_documents", documentID)
+}
+
+// SetRetirementExternalID сохраняет идентификатор отправленного документа в Честном ЗНАКе
+func (r *Repository) SetRetirementExternalID(ctx context.Context, documentID int, externalID string) error {
+	return r.setExternalID(ctx, "retirement_documents", documentID, externalID)
+}
+
+// UpdateRetirementStatus сохраняет результат обработки отправленного документа и записывает
+// уведомления messages в outbox. Возвращает false, если результат уже был сохранен ранее.
+func (r *Repository) UpdateRetirementStatus(ctx context.Context, documentID int, result DocumentResult,
+	messages []models.OutboxMessage) (bool, error) {
+	var updated bool
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		if updated, err = updateSubmissionStatus(ctx, tx, "retirement_documents", documentID, result); err != nil || !updated {
+			return err
+		}
+		return insertOutbox(ctx, tx, messages)
+	})
+	return updated, err
+}
+
+// PostponeRetirementCheck откладывает следующую проверку статуса документа
+func (r *Repository) PostponeRetirementCheck(ctx context.Context, documentID int, base, max time.Duration) error {
+	return r.postponeStatusCheck(ctx, "retirement_documents", documentID, base, max)
+}
+
+// PendingRetirementDocuments возвращает отправленные документы, для которых наступило
+// время проверки результата обработки
+func (r *Repository) PendingRetirementDocuments(ctx context.Context, limit int) ([]models.RetirementDocument, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+retirementColumns+" FROM retirement_documents WHERE "+pendingCondition+" ORDER BY submitted_at LIMIT $2",
+		models.DocumentStatusSubmitted, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []models.RetirementDocument
+	for rows.Next() {
+		var doc models.RetirementDocument
+		if err := scanRetirementDocument(rows.Scan, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, rows.Err()
+}
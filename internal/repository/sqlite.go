@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// Имя драйвера database/sql для SQLite с переводом запросов PostgreSQL
+const sqliteDriverName = "znak-sqlite"
+
+// Формат времени в БД SQLite: UTC без зоны, как у strftime. Строки в этом формате
+// сравниваются в том же порядке, что и моменты времени.
+const sqliteTimeLayout = "2006-01-02 15:04:05.999999999"
+
+// Текущее время в формате sqliteTimeLayout: замена NOW() в запросах
+const sqliteNow = "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+
+// Сколько соединение ждет освобождения БД, занятой транзакцией другого соединения
+const sqliteBusyTimeout = 5 * time.Second
+
+func init() {
+	sql.Register(sqliteDriverName, sqliteDriver{})
+}
+
+// OpenSQLite открывает БД SQLite в файле path или в памяти (":memory:"). SQLite
+// предназначена для локальной разработки и демонстрации: запросы репозитория написаны
+// для PostgreSQL и переводятся драйвером (см. sqliteQuery), а аналитика, нумерация
+// счетов и вывод кодов из оборота работают только в PostgreSQL.
+func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	// Транзакции сразу захватывают блокировку записи: так SQLite заменяет SELECT ... FOR UPDATE
+	params := fmt.Sprintf("_txlock=immediate&_pragma=busy_timeout(%d)&_pragma=foreign_keys(1)",
+		sqliteBusyTimeout.Milliseconds())
+	dsn := "file:" + path + "?" + params + "&_pragma=journal_mode(WAL)"
+	if path == ":memory:" {
+		// Все соединения пула должны видеть одну БД в памяти
+		dsn = fmt.Sprintf("file:/znak-%d?vfs=memdb&%s", time.Now().UnixNano(), params)
+	}
+
+	db, err := sql.Open(sqliteDriverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к БД: %w", err)
+	}
+	db.SetMaxOpenConns(4)
+	// Память memdb освобождается при закрытии последнего соединения
+	db.SetMaxIdleConns(4)
+	db.SetConnMaxLifetime(0)
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка проверки соединения: %w", err)
+	}
+	return db, nil
+}
+
+// Подключение репозитория к SQLite
+func isSQLite(db *sql.DB) bool {
+	_, ok := db.Driver().(sqliteDriver)
+	return ok
+}
+
+// Драйвер SQLite, который переводит запросы PostgreSQL и параметры запросов
+type sqliteDriver struct{}
+
+func (sqliteDriver) Open(name string) (driver.Conn, error) {
+	conn, err := (&sqlite.Driver{}).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{conn}, nil
+}
+
+// Соединение modernc.org/sqlite; реализует также ConnBeginTx, ConnPrepareContext,
+// ExecerContext, QueryerContext и Pinger
+type sqliteConn struct {
+	driver.Conn
+}
+
+func (c *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, sqliteQuery(query))
+}
+
+func (c *sqliteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *sqliteConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, sqliteQuery(query), args)
+}
+
+func (c *sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, sqliteQuery(query), args)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteRows{rows}, nil
+}
+
+// CheckNamedValue приводит параметры к типам SQLite: срезы (параметры = ANY($n) и unnest)
+// передаются массивом JSON, время - строкой в формате sqliteTimeLayout
+func (c *sqliteConn) CheckNamedValue(arg *driver.NamedValue) error {
+	if value := reflect.ValueOf(arg.Value); value.Kind() == reflect.Slice && value.Type().Elem().Kind() != reflect.Uint8 {
+		data, err := json.Marshal(arg.Value)
+		if err != nil {
+			return err
+		}
+		arg.Value = string(data)
+		return nil
+	}
+
+	value, err := driver.DefaultParameterConverter.ConvertValue(arg.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := value.(time.Time); ok {
+		value = t.UTC().Format(sqliteTimeLayout)
+	}
+	arg.Value = value
+	return nil
+}
+
+// Строки результата. Драйвер возвращает время строкой, если колонка не объявлена
+// как TIMESTAMP (выражения, RETURNING); такие строки преобразуются во время.
+type sqliteRows struct {
+	driver.Rows
+}
+
+// Время в формате sqliteTimeLayout
+var sqliteTimePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(\.\d+)?$`)
+
+func (r sqliteRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+	for i, value := range dest {
+		if s, ok := value.(string); ok && sqliteTimePattern.MatchString(s) {
+			if t, err := time.Parse(sqliteTimeLayout, s); err == nil {
+				dest[i] = t
+			}
+		}
+	}
+	return nil
+}
+
+// Переведенные запросы: текст запроса PostgreSQL -> текст запроса SQLite
+var sqliteQueries sync.Map
+
+// Выражения PostgreSQL, которые переводятся в SQLite
+var (
+	sqliteCastPattern      = regexp.MustCompile(`::\w+(\[\])?`)
+	sqliteAnyPattern       = regexp.MustCompile(`= ANY\((\$\d+)\)`)
+	sqliteUnnestPattern    = regexp.MustCompile(`unnest\(([^)]*)\) AS (\w+)\(([^)]*)\)(\s+ON CONFLICT)?`)
+	sqliteForUpdatePattern = regexp.MustCompile(`\s+FOR UPDATE(\s+OF\s+\w+)?(\s+SKIP LOCKED)?`)
+	sqliteUpdateAlias      = regexp.MustCompile(`UPDATE (\w+) (\w+) SET`)
+)
+
+// Перевод запроса PostgreSQL в SQLite. Параметры $n SQLite поддерживает сама; переводятся
+// приведения типов, NOW() и make_interval, LEAST и GREATEST, = ANY($n) и unnest по массивам
+// JSON, псевдонимы в UPDATE. FOR UPDATE и рекомендательные блокировки не нужны: транзакции
+// SQLite выполняются по одной.
+func sqliteQuery(query string) string {
+	if translated, ok := sqliteQueries.Load(query); ok {
+		return translated.(string)
+	}
+
+	translated := query
+	if strings.Contains(translated, "pg_advisory_xact_lock") {
+		translated = "SELECT 1"
+	}
+	translated = sqliteCastPattern.ReplaceAllString(translated, "")
+	translated = sqliteIntervals(translated)
+	translated = strings.ReplaceAll(translated, "NOW()", sqliteNow)
+	translated = strings.ReplaceAll(translated, "LEAST(", "MIN(")
+	translated = strings.ReplaceAll(translated, "GREATEST(", "MAX(")
+	translated = sqliteAnyPattern.ReplaceAllString(translated, "IN (SELECT value FROM json_each($1))")
+	translated = sqliteUnnestPattern.ReplaceAllStringFunc(translated, sqliteUnnest)
+	translated = sqliteForUpdatePattern.ReplaceAllString(translated, "")
+	translated = sqliteUpdateAlias.ReplaceAllString(translated, "UPDATE $1 AS $2 SET")
+
+	sqliteQueries.Store(query, translated)
+	return translated
+}
+
+// NOW() + make_interval(secs => x) -> strftime(..., 'now', x || ' seconds')
+func sqliteIntervals(query string) string {
+	const prefix = "NOW() + make_interval(secs => "
+	for {
+		start := strings.Index(query, prefix)
+		if start < 0 {
+			return query
+		}
+		exprStart := start + len(prefix)
+		end, depth := exprStart, 1
+		for ; end < len(query) && depth > 0; end++ {
+			switch query[end] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+		}
+		expr := query[exprStart : end-1]
+		query = query[:start] + "strftime('%Y-%m-%d %H:%M:%f', 'now', (" + expr + ") || ' seconds')" + query[end:]
+	}
+}
+
+// unnest($1, $2) AS t(a, b) -> подзапрос по элементам массивов JSON с одинаковыми индексами
+func sqliteUnnest(match string) string {
+	parts := sqliteUnnestPattern.FindStringSubmatch(match)
+	arrays := strings.Split(parts[1], ",")
+	columns := strings.Split(parts[3], ",")
+
+	var selects, from []string
+	for i, array := range arrays {
+		table := fmt.Sprintf("a%d", i)
+		selects = append(selects, fmt.Sprintf("%s.value AS %s", table, strings.TrimSpace(columns[i])))
+		source := fmt.Sprintf("json_each(%s) %s", strings.TrimSpace(array), table)
+		if i > 0 {
+			source = "JOIN " + source + " ON " + table + ".key = a0.key"
+		}
+		from = append(from, source)
+	}
+	subquery := "(SELECT " + strings.Join(selects, ", ") + " FROM " + strings.Join(from, " ") + ") AS " + parts[2]
+	if parts[4] != "" {
+		// В INSERT ... SELECT перед ON CONFLICT SQLite требует WHERE
+		subquery += " WHERE true" + parts[4]
+	}
+	return subquery
+}
+
+// Выражения схемы PostgreSQL, которые переводятся в SQLite
+var (
+	sqliteSerialPattern    = regexp.MustCompile(`\b(BIG)?SERIAL PRIMARY KEY`)
+	sqliteUniqueColumn     = regexp.MustCompile(`^ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+) (.*) UNIQUE;$`)
+	sqliteUnsupportedStmts = []string{"FUNCTION", "TRIGGER", "MATERIALIZED VIEW", "analytics_", "ALTER COLUMN",
+		"DISTINCT ON", "LATERAL", "encode("}
+)
+
+// Перевод миграций в SQLite. Пропускаются функции и триггеры, материализованные
+// представления аналитики и переносы данных из старых версий схемы: в новой БД SQLite
+// переносить нечего. Повторное добавление колонки возвращает ошибку, которую Migrate
+// пропускает (sqliteDuplicateColumn).
+func sqliteMigrations(queries []string) []string {
+	var translated []string
+	for _, query := range queries {
+		if containsAny(query, sqliteUnsupportedStmts) {
+			continue
+		}
+		query = sqliteSerialPattern.ReplaceAllString(query, "INTEGER PRIMARY KEY AUTOINCREMENT")
+		query = strings.ReplaceAll(query, "JSONB", "TEXT")
+		query = strings.ReplaceAll(query, "BYTEA", "BLOB")
+		query = strings.ReplaceAll(query, "DEFAULT NOW()", "DEFAULT ("+sqliteNow+")")
+
+		// SQLite не добавляет колонки с UNIQUE: уникальность обеспечивает индекс
+		if parts := sqliteUniqueColumn.FindStringSubmatch(query); parts != nil {
+			translated = append(translated,
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", parts[1], parts[2], parts[3]),
+				fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_%s ON %s(%s);", parts[1], parts[2], parts[1], parts[2]))
+			continue
+		}
+		translated = append(translated, strings.ReplaceAll(query, "ADD COLUMN IF NOT EXISTS", "ADD COLUMN"))
+	}
+	return translated
+}
+
+// Ошибка повторного добавления колонки при миграции SQLite
+func sqliteDuplicateColumn(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "duplicate column name")
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+// StatusComponents возвращает последний результат проверки компонентов сервиса
+func (r *Repository) StatusComponents(ctx context.Context) ([]models.ComponentStatus, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT component, status, backlog, checked_at, changed_at
+		FROM status_components
+		ORDER BY component
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	components := []models.ComponentStatus{}
+	for rows.Next() {
+		var component models.ComponentStatus
+		if err := rows.Scan(&component.Component, &component.Status, &component.Backlog,
+			&component.CheckedAt, &component.ChangedAt); err != nil {
+			return nil, err
+		}
+		components = append(components, component)
+	}
+	return components, rows.Err()
+}
+
+// RecordComponentStatus сохраняет результат проверки компонента. Статус degraded или error
+// открывает инцидент (или повышает статус открытого до error), остальные статусы закрывают
+// открытый инцидент. Возвращает открытый или закрытый при этой проверке инцидент; nil, если
+// инцидент не открывался и не закрывался.
+func (r *Repository) RecordComponentStatus(ctx context.Context, status models.ComponentStatus, message string) (*models.StatusIncident, error) {
+	failing := status.Status == models.ComponentStatusDegraded || status.Status == models.ComponentStatusError
+
+	var changed *models.StatusIncident
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var previous string
+		err := tx.QueryRowContext(ctx, "SELECT status FROM status_components WHERE component = $1 FOR UPDATE",
+			status.Component).Scan(&previous)
+		switch {
+		case err == sql.ErrNoRows:
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO status_components (component, status, backlog, checked_at, changed_at)
+				VALUES ($1, $2, $3, $4, $4)
+			`, status.Component, status.Status, status.Backlog, status.CheckedAt)
+		case err == nil:
+			_, err = tx.ExecContext(ctx, `
+				UPDATE status_components SET status = $2, backlog = $3, checked_at = $4,
+					changed_at = CASE WHEN status = $2 THEN changed_at ELSE $4 END
+				WHERE component = $1
+			`, status.Component, status.Status, status.Backlog, status.CheckedAt)
+		}
+		if err != nil {
+			return err
+		}
+
+		incident := models.StatusIncident{Component: status.Component, Status: status.Status, Message: message}
+		if !failing {
+			err = tx.QueryRowContext(ctx, `
+				UPDATE status_incidents SET resolved_at = $2
+				WHERE component = $1 AND resolved_at IS NULL
+				RETURNING id, status, COALESCE(message, ''), started_at
+			`, status.Component, status.CheckedAt).Scan(&incident.ID, &incident.Status, &incident.Message, &incident.StartedAt)
+			if err == sql.ErrNoRows {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			incident.ResolvedAt = &status.CheckedAt
+			changed = &incident
+			return nil
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			UPDATE status_incidents SET status = $2, message = $3
+			WHERE component = $1 AND resolved_at IS NULL AND status <> $4
+		`, status.Component, status.Status, message, models.ComponentStatusError)
+		if err != nil {
+			return err
+		}
+		var open bool
+		if n, _ := result.RowsAffected(); n == 0 {
+			err = tx.QueryRowContext(ctx,
+				"SELECT EXISTS (SELECT 1 FROM status_incidents WHERE component = $1 AND resolved_at IS NULL)",
+				status.Component).Scan(&open)
+			if err != nil {
+				return err
+			}
+		} else {
+			open = true
+		}
+		if open {
+			return nil
+		}
+
+		incident.StartedAt = status.CheckedAt
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO status_incidents (component, status, message, started_at)
+			VALUES ($1, $2, NULLIF($3, ''), $4)
+			RETURNING id
+		`, status.Component, status.Status, message, status.CheckedAt).Scan(&incident.ID); err != nil {
+			return err
+		}
+		changed = &incident
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// StatusIncidents возвращает инциденты, продолжающиеся или закрытые после since, новые первыми
+func (r *Repository) StatusIncidents(ctx context.Context, since time.Time, limit int) ([]models.StatusIncident, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, component, status, COALESCE(message, ''), started_at, resolved_at
+		FROM status_incidents
+		WHERE resolved_at IS NULL OR resolved_at >= $1
+		ORDER BY started_at DESC, id DESC
+		LIMIT $2
+	`, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []models.StatusIncident{}
+	for rows.Next() {
+		var incident models.StatusIncident
+		var resolvedAt sql.NullTime
+		if err := rows.Scan(&incident.ID, &incident.Component, &incident.Status, &incident.Message,
+			&incident.StartedAt, &resolvedAt); err != nil {
+			return nil, err
+		}
+		incident.ResolvedAt = timePtr(resolvedAt)
+		incidents = append(incidents, incident)
+	}
+	return incidents, rows.Err()
+}
+
+// KIZBacklog возвращает число запросов КИЗ, ожидающих получения кодов, и время самого
+// раннего из них
+func (r *Repository) KIZBacklog(ctx context.Context) (int, *time.Time, error) {
+	return r.backlog(ctx, "kiz_requests", "request_time", "status = $1", models.KIZRequestStatusPending)
+}
+
+// OutboxBacklog возвращает число недоставленных уведомлений и самое раннее время, к которому
+// должно было быть отправлено уведомление, чья попытка доставки к моменту now просрочена
+func (r *Repository) OutboxBacklog(ctx context.Context, now time.Time) (int, *time.Time, error) {
+	count, _, err := r.backlog(ctx, "outbox", "next_attempt_at", "status = $1", models.OutboxStatusPending)
+	if err != nil || count == 0 {
+		return count, nil, err
+	}
+	_, overdue, err := r.backlog(ctx, "outbox", "next_attempt_at", "status = $1 AND next_attempt_at <= $2",
+		models.OutboxStatusPending, now)
+	return count, overdue, err
+}
+
+// Число записей таблицы по условию и наименьшее значение столбца времени среди них. Время
+// читается отдельным запросом с сортировкой: агрегат MIN в SQLite теряет тип столбца.
+func (r *Repository) backlog(ctx context.Context, table, timeColumn, where string, args ...any) (int, *time.Time, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+" WHERE "+where, args...).Scan(&count); err != nil {
+		return 0, nil, err
+	}
+	if count == 0 {
+		return 0, nil, nil
+	}
+	var oldest time.Time
+	err := r.db.QueryRowContext(ctx,
+		"SELECT "+timeColumn+" FROM "+table+" WHERE "+where+" ORDER BY "+timeColumn+" LIMIT 1", args...).Scan(&oldest)
+	if err == sql.ErrNoRows {
+		return count, nil, nil
+	} else if err != nil {
+		return 0, nil, err
+	}
+	return count, &oldest, nil
+}
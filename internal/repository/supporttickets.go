@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"project-znak/internal/models"
+)
+
+const supportTicketColumns = `id, user_id, COALESCE(kiz_request_id, 0), COALESCE(payment_id, 0), description,
+	status, COALESCE(reply, ''), created_at, updated_at`
+
+func scanSupportTicket(scan func(dest ...any) error) (*models.SupportTicket, error) {
+	var ticket models.SupportTicket
+	if err := scan(&ticket.ID, &ticket.UserID, &ticket.RequestID, &ticket.PaymentID, &ticket.Description,
+		&ticket.Status, &ticket.Reply, &ticket.CreatedAt, &ticket.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &ticket, nil
+}
+
+func (r *Repository) querySupportTickets(ctx context.Context, query string, args ...any) ([]models.SupportTicket, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+supportTicketColumns+" FROM support_tickets "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []models.SupportTicket{}
+	for rows.Next() {
+		ticket, err := scanSupportTicket(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, *ticket)
+	}
+	return tickets, rows.Err()
+}
+
+// CreateSupportTicket сохраняет обращение в поддержку и заполняет его ID, статус и время создания
+func (r *Repository) CreateSupportTicket(ctx context.Context, ticket *models.SupportTicket) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO support_tickets (user_id, kiz_request_id, payment_id, description)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), $4)
+		RETURNING id, status, created_at, updated_at
+	`, ticket.UserID, ticket.RequestID, ticket.PaymentID, ticket.Description).Scan(
+		&ticket.ID, &ticket.Status, &ticket.CreatedAt, &ticket.UpdatedAt)
+}
+
+// CountOpenSupportTickets возвращает число нерешенных обращений пользователя
+func (r *Repository) CountOpenSupportTickets(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM support_tickets WHERE user_id = $1 AND status <> $2",
+		userID, models.SupportTicketStatusResolved).Scan(&count)
+	return count, err
+}
+
+// SupportTicket возвращает обращение в поддержку; userID = 0 - обращение любого пользователя
+func (r *Repository) SupportTicket(ctx context.Context, userID, ticketID int) (*models.SupportTicket, error) {
+	ticket, err := scanSupportTicket(r.db.QueryRowContext(ctx,
+		"SELECT "+supportTicketColumns+" FROM support_tickets WHERE id = $1 AND ($2 = 0 OR user_id = $2)",
+		ticketID, userID).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return ticket, err
+}
+
+// UserSupportTickets возвращает обращения пользователя, новые первыми
+func (r *Repository) UserSupportTickets(ctx context.Context, userID, limit int) ([]models.SupportTicket, error) {
+	return r.querySupportTickets(ctx, "WHERE user_id = $1 ORDER BY id DESC LIMIT $2", userID, limit)
+}
+
+// SupportTickets возвращает обращения с указанным статусом (все, если статус пуст), новые первыми
+func (r *Repository) SupportTickets(ctx context.Context, status string, limit int) ([]models.SupportTicket, error) {
+	return r.querySupportTickets(ctx, "WHERE $1 = '' OR status = $1 ORDER BY id DESC LIMIT $2", status, limit)
+}
+
+// UpdateSupportTicket меняет статус обращения и ответ поддержки (пустой ответ сохраняет прежний)
+// и записывает в outbox уведомления пользователя, сформированные build. Возвращает обращение
+// после изменения или ErrNotFound.
+func (r *Repository) UpdateSupportTicket(ctx context.Context, ticketID int, status, reply string,
+	build func(ticket *models.SupportTicket) ([]models.OutboxMessage, error)) (*models.SupportTicket, error) {
+	var ticket *models.SupportTicket
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		ticket, err = scanSupportTicket(tx.QueryRowContext(ctx, `
+			UPDATE support_tickets SET status = $2, reply = COALESCE(NULLIF($3, ''), reply), updated_at = NOW()
+			WHERE id = $1
+			RETURNING `+supportTicketColumns, ticketID, status, reply).Scan)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		return writeOutbox(ctx, tx, func() ([]models.OutboxMessage, error) { return build(ticket) })
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
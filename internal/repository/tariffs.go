@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"project-znak/internal/models"
+)
+
+// Tariffs возвращает тарифы всех товарных групп
+func (r *Repository) Tariffs(ctx context.Context) ([]models.Tariff, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+tariffColumns+" FROM tariffs ORDER BY product_group")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tariffs []models.Tariff
+	for rows.Next() {
+		var tariff models.Tariff
+		if err := scanTariff(rows.Scan, &tariff); err != nil {
+			return nil, err
+		}
+		tariffs = append(tariffs, tariff)
+	}
+
+	return tariffs, rows.Err()
+}
+
+const tariffColumns = "product_group, unit_price, updated_at, fee_cost"
+
+func scanTariff(scan func(dest ...any) error, tariff *models.Tariff) error {
+	var feeCost sql.NullFloat64
+	if err := scan(&tariff.ProductGroup, &tariff.UnitPrice, &tariff.UpdatedAt, &feeCost); err != nil {
+		return err
+	}
+	tariff.FeeCost = floatPtr(feeCost)
+	return nil
+}
+
+// Tariff возвращает тариф товарной группы: стоимость кода и плату Честного ЗНАКа за код,
+// если она задана
+func (r *Repository) Tariff(ctx context.Context, productGroup string) (*models.Tariff, error) {
+	var tariff models.Tariff
+	err := scanTariff(r.db.QueryRowContext(ctx,
+		"SELECT "+tariffColumns+" FROM tariffs WHERE product_group = $1", productGroup).Scan, &tariff)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &tariff, nil
+}
+
+// SetTariff создает или изменяет тариф товарной группы
+func (r *Repository) SetTariff(ctx context.Context, tariff *models.Tariff) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO tariffs (product_group, unit_price, fee_cost)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (product_group) DO UPDATE
+		SET unit_price = EXCLUDED.unit_price, fee_cost = EXCLUDED.fee_cost, updated_at = NOW()
+		RETURNING updated_at
+	`, tariff.ProductGroup, tariff.UnitPrice, tariff.FeeCost).Scan(&tariff.UpdatedAt)
+}
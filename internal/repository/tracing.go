@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"project-znak/internal/tracing"
+)
+
+// Трассировка запросов к БД: для каждого SQL-запроса создается спан в контексте
+// вызывающей операции
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation, _, _ := strings.Cut(strings.TrimSpace(data.SQL), " ")
+	ctx, _ = tracing.Start(ctx, "db "+strings.ToUpper(operation),
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.statement", data.SQL),
+	)
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	tracing.End(trace.SpanFromContext(ctx), data.Err)
+}
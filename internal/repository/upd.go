@@ -0,0 +1,358 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"project-znak/internal/labels"
+	"project-znak/internal/models"
+)
+
+// Доступ к УПД: документы организаций, в которых состоит пользователь ($2)
+const updAccessCondition = `organization_id IN (SELECT organization_id FROM organization_members WHERE user_id = $2)`
+
+const updColumns = `id, user_id, organization_id, number, document_date, buyer_inn, COALESCE(buyer_kpp, ''),
+	buyer_name, items, total, provider, external_id, file_name, status, COALESCE(comment, ''),
+	created_at, processed_at, updated_at`
+
+func scanUPDDocument(scan func(dest ...any) error, doc *models.UPDDocument) error {
+	var items []byte
+	var processedAt sql.NullTime
+	if err := scan(&doc.ID, &doc.UserID, &doc.OrganizationID, &doc.Number, &doc.Date, &doc.BuyerINN, &doc.BuyerKPP,
+		&doc.BuyerName, &items, &doc.Total, &doc.Provider, &doc.ExternalID, &doc.FileName, &doc.Status, &doc.Comment,
+		&doc.CreatedAt, &processedAt, &doc.UpdatedAt); err != nil {
+		return err
+	}
+	doc.ProcessedAt = timePtr(processedAt)
+	if err := json.Unmarshal(items, &doc.Items); err != nil {
+		return fmt.Errorf("ошибка чтения строк УПД: %w", err)
+	}
+	return nil
+}
+
+// Выборка УПД по условию
+func (r *Repository) queryUPDDocuments(ctx context.Context, query string, args ...any) ([]models.UPDDocument, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+updColumns+" FROM upd_documents "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.UPDDocument{}
+	for rows.Next() {
+		var doc models.UPDDocument
+		if err := scanUPDDocument(rows.Scan, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// CreateUPDDocument сохраняет отправленный УПД вместе с подписанным файлом
+func (r *Repository) CreateUPDDocument(ctx context.Context, doc *models.UPDDocument, content, signature []byte) error {
+	items, err := json.Marshal(doc.Items)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации строк УПД: %w", err)
+	}
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO upd_documents (user_id, organization_id, number, document_date, buyer_inn, buyer_kpp, buyer_name,
+			items, total, provider, external_id, file_name, content, signature, status)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id, created_at, updated_at
+	`, doc.UserID, doc.OrganizationID, doc.Number, doc.Date, doc.BuyerINN, doc.BuyerKPP, doc.BuyerName,
+		items, doc.Total, doc.Provider, doc.ExternalID, doc.FileName, content, signature, doc.Status,
+	).Scan(&doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
+}
+
+// UPDDocument возвращает УПД организации, в которой состоит пользователь
+func (r *Repository) UPDDocument(ctx context.Context, documentID, userID int) (*models.UPDDocument, error) {
+	docs, err := r.queryUPDDocuments(ctx, "WHERE id = $1 AND "+updAccessCondition, documentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &docs[0], nil
+}
+
+// UPDDocuments возвращает последние УПД организации
+func (r *Repository) UPDDocuments(ctx context.Context, organizationID, limit int) ([]models.UPDDocument, error) {
+	return r.queryUPDDocuments(ctx, "WHERE organization_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2",
+		organizationID, limit)
+}
+
+// UPDFile возвращает имя, содержимое и подпись файла УПД, доступного пользователю
+func (r *Repository) UPDFile(ctx context.Context, documentID, userID int) (string, []byte, []byte, error) {
+	var name string
+	var content, signature []byte
+	err := r.db.QueryRowContext(ctx,
+		"SELECT file_name, content, signature FROM upd_documents WHERE id = $1 AND "+updAccessCondition,
+		documentID, userID,
+	).Scan(&name, &content, &signature)
+	if err == sql.ErrNoRows {
+		return "", nil, nil, ErrNotFound
+	}
+	return name, content, signature, err
+}
+
+// UPDOrganizationID возвращает организацию УПД; 0, если документ не найден
+func (r *Repository) UPDOrganizationID(ctx context.Context, documentID int) (int, error) {
+	var organizationID int
+	err := r.db.QueryRowContext(ctx, "SELECT organization_id FROM upd_documents WHERE id = $1", documentID).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return organizationID, err
+}
+
+// PendingUPDDocuments возвращает УПД без ответа покупателя, для которых наступило
+// время проверки состояния
+func (r *Repository) PendingUPDDocuments(ctx context.Context, limit int) ([]models.UPDDocument, error) {
+	return r.queryUPDDocuments(ctx, `
+		WHERE status IN ($1, $2) AND (next_status_check_at IS NULL OR next_status_check_at <= NOW())
+		ORDER BY created_at LIMIT $3
+	`, models.UPDStatusSent, models.UPDStatusDelivered, limit)
+}
+
+// UpdateUPDStatus сохраняет состояние документооборота УПД. Ответ покупателя сохраняется
+// один раз: документ с окончательным статусом не изменяется и возвращается false.
+// Уведомления сохраняются в outbox в той же транзакции.
+func (r *Repository) UpdateUPDStatus(ctx context.Context, doc *models.UPDDocument, messages []models.OutboxMessage) (bool, error) {
+	var updated bool
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var processedAt sql.NullTime
+		err := tx.QueryRowContext(ctx, `
+			UPDATE upd_documents SET status = $2, comment = NULLIF($3, ''),
+				processed_at = CASE WHEN $2 IN ($4, $5) THEN NOW() END,
+				next_status_check_at = CASE WHEN $2 IN ($4, $5) THEN NULL ELSE next_status_check_at END,
+				updated_at = NOW()
+			WHERE id = $1 AND status IN ($6, $7)
+			RETURNING processed_at, updated_at
+		`, doc.ID, doc.Status, doc.Comment, models.UPDStatusAccepted, models.UPDStatusRejected,
+			models.UPDStatusSent, models.UPDStatusDelivered,
+		).Scan(&processedAt, &doc.UpdatedAt)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		updated = true
+		doc.ProcessedAt = timePtr(processedAt)
+		return insertOutbox(ctx, tx, messages)
+	})
+	return updated, err
+}
+
+// PostponeUPDCheck откладывает следующую проверку состояния УПД
+func (r *Repository) PostponeUPDCheck(ctx context.Context, documentID int, base, max time.Duration) error {
+	return r.postponeStatusCheck(ctx, "upd_documents", documentID, base, max)
+}
+
+// ReceivedCodes - коды одной товарной группы, принятые организацией от поставщика
+type ReceivedCodes struct {
+	ProductGroup string
+	Codes        []string
+}
+
+const incomingUPDColumns = `id, organization_id, provider, external_id, file_name, number, document_date,
+	seller_inn, COALESCE(seller_kpp, ''), seller_name, items, total, status, COALESCE(comment, ''),
+	acceptance_ids, COALESCE(processed_by, 0), processed_at, created_at, updated_at`
+
+func scanIncomingUPD(scan func(dest ...any) error, doc *models.IncomingUPD) error {
+	var items, acceptanceIDs []byte
+	var processedAt sql.NullTime
+	if err := scan(&doc.ID, &doc.OrganizationID, &doc.Provider, &doc.ExternalID, &doc.FileName, &doc.Number, &doc.Date,
+		&doc.SellerINN, &doc.SellerKPP, &doc.SellerName, &items, &doc.Total, &doc.Status, &doc.Comment,
+		&acceptanceIDs, &doc.ProcessedBy, &processedAt, &doc.CreatedAt, &doc.UpdatedAt); err != nil {
+		return err
+	}
+	doc.ProcessedAt = timePtr(processedAt)
+	if err := json.Unmarshal(items, &doc.Items); err != nil {
+		return fmt.Errorf("ошибка чтения строк УПД: %w", err)
+	}
+	if len(acceptanceIDs) > 0 {
+		if err := json.Unmarshal(acceptanceIDs, &doc.AcceptanceIDs); err != nil {
+			return fmt.Errorf("ошибка чтения документов приемки: %w", err)
+		}
+	}
+	return nil
+}
+
+// Выборка входящих УПД по условию
+func (r *Repository) queryIncomingUPDs(ctx context.Context, query string, args ...any) ([]models.IncomingUPD, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+incomingUPDColumns+" FROM incoming_upd_documents "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []models.IncomingUPD{}
+	for rows.Next() {
+		var doc models.IncomingUPD
+		if err := scanIncomingUPD(rows.Scan, &doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// SaveIncomingUPD сохраняет полученный от поставщика УПД вместе с файлом. Документ,
+// уже сохраненный ранее, не изменяется, и возвращается false.
+func (r *Repository) SaveIncomingUPD(ctx context.Context, doc *models.IncomingUPD, content []byte) (bool, error) {
+	items, err := json.Marshal(doc.Items)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сериализации строк УПД: %w", err)
+	}
+	err = r.db.QueryRowContext(ctx, `
+		INSERT INTO incoming_upd_documents (organization_id, provider, external_id, file_name, content, number,
+			document_date, seller_inn, seller_kpp, seller_name, items, total, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12, $13)
+		ON CONFLICT (provider, external_id) DO NOTHING
+		RETURNING id, created_at, updated_at
+	`, doc.OrganizationID, doc.Provider, doc.ExternalID, doc.FileName, content, doc.Number,
+		doc.Date, doc.SellerINN, doc.SellerKPP, doc.SellerName, items, doc.Total, doc.Status,
+	).Scan(&doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// IncomingUPD возвращает входящий УПД организации, в которой состоит пользователь
+func (r *Repository) IncomingUPD(ctx context.Context, documentID, userID int) (*models.IncomingUPD, error) {
+	docs, err := r.queryIncomingUPDs(ctx, "WHERE id = $1 AND "+updAccessCondition, documentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &docs[0], nil
+}
+
+// IncomingUPDs возвращает последние входящие УПД организации; без статуса - во всех статусах
+func (r *Repository) IncomingUPDs(ctx context.Context, organizationID int, status string, limit int) ([]models.IncomingUPD, error) {
+	return r.queryIncomingUPDs(ctx, `
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id DESC LIMIT $3
+	`, organizationID, status, limit)
+}
+
+// IncomingUPDFile возвращает имя и содержимое файла входящего УПД, доступного пользователю
+func (r *Repository) IncomingUPDFile(ctx context.Context, documentID, userID int) (string, []byte, error) {
+	var name string
+	var content []byte
+	err := r.db.QueryRowContext(ctx,
+		"SELECT file_name, content FROM incoming_upd_documents WHERE id = $1 AND "+updAccessCondition,
+		documentID, userID,
+	).Scan(&name, &content)
+	if err == sql.ErrNoRows {
+		return "", nil, ErrNotFound
+	}
+	return name, content, err
+}
+
+// IncomingUPDOrganizationID возвращает организацию входящего УПД; 0, если документ не найден
+func (r *Repository) IncomingUPDOrganizationID(ctx context.Context, documentID int) (int, error) {
+	var organizationID int
+	err := r.db.QueryRowContext(ctx, "SELECT organization_id FROM incoming_upd_documents WHERE id = $1",
+		documentID).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return organizationID, err
+}
+
+// SetIncomingUPDStatus сохраняет ответ на входящий УПД: приемку или отказ в подписи.
+// Ответ сохраняется один раз: если документ уже обработан, возвращается false.
+func (r *Repository) SetIncomingUPDStatus(ctx context.Context, doc *models.IncomingUPD) (bool, error) {
+	var processedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE incoming_upd_documents SET status = $2, comment = NULLIF($3, ''), processed_by = $4,
+			processed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = $5
+		RETURNING processed_at, updated_at
+	`, doc.ID, doc.Status, doc.Comment, doc.ProcessedBy, models.IncomingUPDStatusNew,
+	).Scan(&processedAt, &doc.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	doc.ProcessedAt = timePtr(processedAt)
+	return true, nil
+}
+
+// SaveIncomingUPDAcceptance сохраняет документы приемки в Честном ЗНАКе и добавляет
+// принятые коды в остаток организации-покупателя INN: для каждой товарной группы
+// создается запрос КИЗ в статусе received с кодами, введенными в оборот. Коды, уже
+// учтенные в сервисе, повторно не записываются. Возвращает false, если приемка
+// документа уже сохранена. Уведомления сохраняются в outbox в той же транзакции.
+func (r *Repository) SaveIncomingUPDAcceptance(ctx context.Context, doc *models.IncomingUPD, inn string,
+	received []ReceivedCodes, messages []models.OutboxMessage) (bool, error) {
+	acceptanceIDs, err := json.Marshal(doc.AcceptanceIDs)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сериализации документов приемки: %w", err)
+	}
+	requestData, err := json.Marshal(map[string]int{"incoming_upd_id": doc.ID})
+	if err != nil {
+		return false, fmt.Errorf("ошибка сериализации запроса: %w", err)
+	}
+
+	var saved bool
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE incoming_upd_documents SET acceptance_ids = $2, updated_at = NOW()
+			WHERE id = $1 AND status = $3 AND acceptance_ids IS NULL
+		`, doc.ID, acceptanceIDs, models.IncomingUPDStatusAccepted)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+		saved = true
+
+		for _, group := range received {
+			codes, err := json.Marshal(group.Codes)
+			if err != nil {
+				return fmt.Errorf("ошибка сериализации кодов: %w", err)
+			}
+			var requestID int
+			if err := tx.QueryRowContext(ctx, `
+				INSERT INTO kiz_requests (user_id, telegram_id, inn, product_group, request_time, organization_id,
+					status, request_data, codes_requested, codes_emitted, codes_downloaded)
+				SELECT id, telegram_id, $2, NULLIF($3, ''), NOW(), $4, $5, $6, $7, $7, $7 FROM users WHERE id = $1
+				RETURNING id
+			`, doc.ProcessedBy, inn, group.ProductGroup, doc.OrganizationID, models.KIZRequestStatusReceived,
+				requestData, len(group.Codes)).Scan(&requestID); err != nil {
+				return fmt.Errorf("ошибка сохранения запроса: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO kiz_results (request_id, kiz_data) VALUES ($1, $2)", requestID, codes,
+			); err != nil {
+				return fmt.Errorf("ошибка сохранения кодов: %w", err)
+			}
+
+			gtins := make([]string, len(group.Codes))
+			for i, code := range group.Codes {
+				gtins[i] = labels.GTINFromCode(code)
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO kiz_codes (code, gtin, request_id, status)
+				SELECT code, gtin, $3, $4 FROM unnest($1::text[], $2::text[]) AS c(code, gtin)
+				ON CONFLICT (code) DO NOTHING
+			`, group.Codes, gtins, requestID, models.KIZCodeStatusIntroduced); err != nil {
+				return fmt.Errorf("ошибка сохранения кодов: %w", err)
+			}
+		}
+		return insertOutbox(ctx, tx, messages)
+	})
+	return saved, err
+}
@@ -0,0 +1,325 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+// UserIDByTelegram возвращает ID пользователя по telegram_id или 0, если пользователь не найден
+func (r *Repository) UserIDByTelegram(ctx context.Context, telegramID int64) (int, error) {
+	var userID int
+	err := r.db.QueryRowContext(ctx, "SELECT id FROM users WHERE telegram_id = $1", telegramID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return userID, err
+}
+
+// UserByTelegram возвращает пользователя по telegram_id
+func (r *Repository) UserByTelegram(ctx context.Context, telegramID int64) (*models.User, error) {
+	var user models.User
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, telegram_id, inn, COALESCE(email, ''), created_at, last_active,
+			COALESCE(organization_name, ''), COALESCE(first_name, ''), COALESCE(last_name, ''),
+			COALESCE(middle_name, ''), COALESCE(username, ''), is_admin
+		FROM users WHERE telegram_id = $1
+	`, telegramID).Scan(
+		&user.ID,
+		&user.TelegramID,
+		&user.INN,
+		&user.Email,
+		&user.RegisteredAt,
+		&user.LastActive,
+		&user.OrganizationName,
+		&user.FirstName,
+		&user.LastName,
+		&user.MiddleName,
+		&user.Username,
+		&user.IsAdmin,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &user, err
+}
+
+// CreateUser сохраняет нового пользователя и заполняет его ID
+func (r *Repository) CreateUser(ctx context.Context, user *models.User) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO users (telegram_id, inn, email, organization_name, first_name, last_name, middle_name, username)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''))
+		RETURNING id, created_at, last_active
+	`, user.TelegramID, user.INN, user.Email, user.OrganizationName,
+		user.FirstName, user.LastName, user.MiddleName, user.Username,
+	).Scan(&user.ID, &user.RegisteredAt, &user.LastActive)
+}
+
+// UpdateUserRegistration обновляет данные пользователя при повторной регистрации.
+// Пустые наименование организации и поля профиля не затирают сохраненные значения.
+func (r *Repository) UpdateUserRegistration(ctx context.Context, user *models.User) error {
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE users SET inn = $1, email = $2, last_active = $3,
+			organization_name = COALESCE(NULLIF($4, ''), organization_name),
+			first_name = COALESCE(NULLIF($5, ''), first_name),
+			last_name = COALESCE(NULLIF($6, ''), last_name),
+			middle_name = COALESCE(NULLIF($7, ''), middle_name),
+			username = COALESCE(NULLIF($8, ''), username)
+		WHERE telegram_id = $9 RETURNING id
+	`, user.INN, user.Email, time.Now(), user.OrganizationName,
+		user.FirstName, user.LastName, user.MiddleName, user.Username, user.TelegramID,
+	).Scan(&user.ID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// UserEmail возвращает email пользователя; пустая строка, если он не указан
+func (r *Repository) UserEmail(ctx context.Context, userID int) (string, error) {
+	var email string
+	err := r.db.QueryRowContext(ctx, "SELECT COALESCE(email, '') FROM users WHERE id = $1", userID).Scan(&email)
+	return email, err
+}
+
+// UserTelegramID возвращает telegram_id пользователя; ErrNotFound, если аккаунт Telegram
+// еще не привязан
+func (r *Repository) UserTelegramID(ctx context.Context, userID int) (int64, error) {
+	var telegramID int64
+	err := r.db.QueryRowContext(ctx,
+		"SELECT telegram_id FROM users WHERE id = $1 AND telegram_id IS NOT NULL AND deleted_at IS NULL", userID).Scan(&telegramID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return telegramID, err
+}
+
+// IsAdmin проверяет, является ли пользователь администратором системы
+func (r *Repository) IsAdmin(ctx context.Context, userID int) (bool, error) {
+	var admin bool
+	err := r.db.QueryRowContext(ctx, "SELECT is_admin FROM users WHERE id = $1", userID).Scan(&admin)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return admin, err
+}
+
+// SetAdmin выдает или отзывает права администратора системы
+func (r *Repository) SetAdmin(ctx context.Context, userID int, admin bool) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET is_admin = $2 WHERE id = $1", userID, admin)
+	return err
+}
+
+// TouchUser обновляет время последней активности пользователя
+func (r *Repository) TouchUser(ctx context.Context, userID int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET last_active = $1 WHERE id = $2", at, userID)
+	return err
+}
+
+// EraseUser удаляет аккаунт пользователя: отзывает API ключи, удаляет настройки и членство
+// в организациях и обезличивает профиль. Заказы, платежи, счета и документы сохраняются
+// до безвозвратного удаления. Возвращает хэши отозванных ключей для сброса кэша.
+// Возвращает ErrSoleOwner, если в организации пользователя других владельцев нет,
+// а участники есть.
+func (r *Repository) EraseUser(ctx context.Context, userID int, telegramHash string, at time.Time) ([]string, error) {
+	var keyHashes []string
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRowContext(ctx,
+			"SELECT id FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", userID).Scan(&id)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		var soleOwner bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM organization_members m
+				WHERE m.user_id = $1 AND m.role = $2
+					AND EXISTS (SELECT 1 FROM organization_members o
+						WHERE o.organization_id = m.organization_id AND o.user_id <> $1)
+					AND NOT EXISTS (SELECT 1 FROM organization_members o
+						WHERE o.organization_id = m.organization_id AND o.user_id <> $1 AND o.role = $2)
+			)
+		`, userID, models.OrgRoleOwner).Scan(&soleOwner); err != nil {
+			return fmt.Errorf("ошибка проверки владельцев организаций: %w", err)
+		}
+		if soleOwner {
+			return ErrSoleOwner
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2), last_ip = NULL, last_user_agent = NULL
+			WHERE user_id = $1
+			RETURNING key_hash
+		`, userID, at)
+		if err != nil {
+			return fmt.Errorf("ошибка отзыва API ключей: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var keyHash string
+			if err := rows.Scan(&keyHash); err != nil {
+				return fmt.Errorf("ошибка отзыва API ключей: %w", err)
+			}
+			keyHashes = append(keyHashes, keyHash)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("ошибка отзыва API ключей: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE users SET telegram_id = NULL, telegram_id_hash = $2, email = NULL, first_name = NULL,
+				last_name = NULL, middle_name = NULL, username = NULL, api_key = NULL, referral_code = NULL,
+				deleted_at = $3
+			WHERE id = $1
+		`, userID, telegramHash, at); err != nil {
+			return fmt.Errorf("ошибка обезличивания пользователя: %w", err)
+		}
+
+		queries := []string{
+			"UPDATE kiz_requests SET telegram_id = 0, updated_at = NOW() WHERE user_id = $1",
+			"DELETE FROM notification_preferences WHERE user_id = $1",
+			"DELETE FROM label_settings WHERE user_id = $1",
+			"DELETE FROM report_settings WHERE user_id = $1",
+			"DELETE FROM reports WHERE user_id = $1",
+			"DELETE FROM wildberries_tokens WHERE user_id = $1",
+			"DELETE FROM ozon_credentials WHERE user_id = $1",
+			"DELETE FROM ozon_sku_mappings WHERE user_id = $1 AND organization_id IS NULL",
+			"DELETE FROM order_templates WHERE user_id = $1",
+			"DELETE FROM order_schedules WHERE user_id = $1",
+			"DELETE FROM carts WHERE user_id = $1",
+			"DELETE FROM organization_members WHERE user_id = $1",
+			"DELETE FROM data_exports WHERE user_id = $1",
+			"DELETE FROM support_tickets WHERE user_id = $1",
+			"DELETE FROM outbox WHERE user_id = $1",
+		}
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+				return fmt.Errorf("ошибка обезличивания пользователя: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keyHashes, nil
+}
+
+// DeletedUsers возвращает ID пользователей, удаленных раньше before и еще не обезличенных
+// окончательно
+func (r *Repository) DeletedUsers(ctx context.Context, before time.Time, limit int) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id FROM users WHERE deleted_at < $1 AND purged_at IS NULL ORDER BY deleted_at LIMIT $2", before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// PurgeUser окончательно обезличивает удаленного пользователя: удаляет его документы
+// с квитанциями, запросы КИЗ и резервы, стирает хэш telegram_id и настройки. Заказы, платежи,
+// журнал платежей, чеки и счета сохраняются как финансовые документы: платежи отвязываются
+// от пользователя, а заказы и счета ссылаются на обезличенную запись, в которой остаются
+// только реквизиты покупателя (ИНН и название организации).
+func (r *Repository) PurgeUser(ctx context.Context, userID int) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		queries := []string{
+			`DELETE FROM document_receipts WHERE document_type = 'introduction'
+				AND document_id IN (SELECT id FROM introduction_documents WHERE user_id = $1)`,
+			`DELETE FROM document_receipts WHERE document_type = 'retirement'
+				AND document_id IN (SELECT id FROM retirement_documents WHERE user_id = $1)`,
+			`DELETE FROM introduction_documents WHERE user_id = $1`,
+			`DELETE FROM retirement_documents WHERE user_id = $1`,
+			`DELETE FROM wildberries_bindings WHERE user_id = $1`,
+			`DELETE FROM ozon_submissions WHERE user_id = $1`,
+			`DELETE FROM upd_documents WHERE user_id = $1`,
+			`UPDATE incoming_upd_documents SET processed_by = NULL WHERE processed_by = $1`,
+			`UPDATE kiz_codes SET reservation_id = NULL
+				WHERE reservation_id IN (SELECT id FROM kiz_reservations WHERE user_id = $1)`,
+			`DELETE FROM kiz_reservations WHERE user_id = $1`,
+			`DELETE FROM kiz_request_chunks WHERE request_id IN (SELECT id FROM kiz_requests WHERE user_id = $1)`,
+			`DELETE FROM kiz_request_batches WHERE request_id IN (SELECT id FROM kiz_requests WHERE user_id = $1)`,
+			`DELETE FROM kiz_codes WHERE request_id IN (SELECT id FROM kiz_requests WHERE user_id = $1)`,
+			`DELETE FROM kiz_results WHERE request_id IN (SELECT id FROM kiz_requests WHERE user_id = $1)`,
+			`DELETE FROM kiz_requests WHERE user_id = $1`,
+			`UPDATE payments SET user_id = NULL WHERE user_id = $1`,
+			`UPDATE users SET telegram_id_hash = NULL, language = NULL, timezone = NULL, purged_at = NOW()
+				WHERE id = $1 AND deleted_at IS NOT NULL`,
+		}
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+				return fmt.Errorf("ошибка удаления данных пользователя: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// UserLanguage возвращает код языка пользователя; пустая строка - язык не выбран
+func (r *Repository) UserLanguage(ctx context.Context, userID int) (string, error) {
+	var language sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		"SELECT language FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&language)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return language.String, err
+}
+
+// SetUserLanguage сохраняет язык пользователя; пустой код сбрасывает выбор
+func (r *Repository) SetUserLanguage(ctx context.Context, userID int, language string) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET language = NULLIF($2, '') WHERE id = $1 AND deleted_at IS NULL", userID, language)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UserTimezone возвращает часовой пояс пользователя; пустая строка - пояс не выбран
+func (r *Repository) UserTimezone(ctx context.Context, userID int) (string, error) {
+	var timezone sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		"SELECT timezone FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&timezone)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return timezone.String, err
+}
+
+// SetUserTimezone сохраняет часовой пояс пользователя; пустое значение сбрасывает выбор
+func (r *Repository) SetUserTimezone(ctx context.Context, userID int, timezone string) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET timezone = NULLIF($2, '') WHERE id = $1 AND deleted_at IS NULL", userID, timezone)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
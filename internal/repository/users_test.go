@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+)
+
+// Окончательное обезличивание сохраняет финансовые документы пользователя и не затрагивает
+// пакетный платеж другого пользователя, оплатившего заказ удаленного
+func TestPurgeUserKeepsFinancialRecords(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userID := newTestUser(t, repo, 1101)
+	otherID := newTestUser(t, repo, 1102)
+
+	order := models.Order{UserID: userID, TotalAmount: 300, Status: models.OrderStatusCreated}
+	otherOrder := models.Order{UserID: otherID, TotalAmount: 200, Status: models.OrderStatusCreated}
+	for _, order := range []*models.Order{&order, &otherOrder} {
+		if err := repo.CreateOrder(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paymentID, err := repo.CreatePayment(ctx, userID, order.ID, 0, money.New(10000, money.RUB), models.PaymentProviderRobokassa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batchID, err := repo.CreateBatchPayment(ctx, otherID, 0, []models.PaymentOrder{
+		{OrderID: order.ID, Amount: money.New(20000, money.RUB)},
+		{OrderID: otherOrder.ID, Amount: money.New(20000, money.RUB)},
+	}, money.New(40000, money.RUB), models.PaymentProviderRobokassa)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deletedAt := time.Now().Add(-time.Hour)
+	if _, err := repo.EraseUser(ctx, userID, "hash", deletedAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.PurgeUser(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	if rowVersion(t, repo, "orders", order.ID) != order.Version {
+		t.Error("Заказ удаленного пользователя не должен изменяться")
+	}
+	var paymentUserID sql.NullInt64
+	if err := repo.db.QueryRowContext(ctx, "SELECT user_id FROM payments WHERE id = $1", paymentID).Scan(&paymentUserID); err != nil {
+		t.Fatalf("Платеж удаленного пользователя должен сохраниться: %v", err)
+	}
+	if paymentUserID.Valid {
+		t.Errorf("Платеж должен быть отвязан от пользователя, user_id = %d", paymentUserID.Int64)
+	}
+	orders, err := repo.PaymentOrders(ctx, batchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 {
+		t.Errorf("Доли пакетного платежа другого пользователя должны сохраниться: %+v", orders)
+	}
+
+	var hash sql.NullString
+	var purgedAt sql.NullTime
+	if err := repo.db.QueryRowContext(ctx, "SELECT telegram_id_hash, purged_at FROM users WHERE id = $1", userID).
+		Scan(&hash, &purgedAt); err != nil {
+		t.Fatal(err)
+	}
+	if hash.Valid || !purgedAt.Valid {
+		t.Errorf("Хэш telegram_id должен быть стерт, а пользователь отмечен обезличенным: %v, %v", hash, purgedAt)
+	}
+	if ids, err := repo.DeletedUsers(ctx, time.Now(), 10); err != nil || len(ids) != 0 {
+		t.Errorf("Обезличенный пользователь не должен обрабатываться повторно: %v, %v", ids, err)
+	}
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+)
+
+// Репозиторий на временной базе SQLite с созданными таблицами
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	ctx := context.Background()
+	db, err := OpenSQLite(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := New(db)
+	if err := repo.Migrate(ctx); err != nil {
+		t.Fatalf("Ошибка создания таблиц: %v", err)
+	}
+	return repo
+}
+
+// Пользователь для записей теста
+func newTestUser(t *testing.T, repo *Repository, telegramID int64) int {
+	t.Helper()
+	user := models.User{TelegramID: telegramID, INN: "7707083893"}
+	if err := repo.CreateUser(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+// Версия записи в таблице table
+func rowVersion(t *testing.T, repo *Repository, table string, id int) int {
+	t.Helper()
+	var version int
+	if err := repo.db.QueryRowContext(context.Background(), "SELECT version FROM "+table+" WHERE id = $1", id).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestCancelOrderVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userID := newTestUser(t, repo, 1001)
+
+	order := models.Order{UserID: userID, TotalAmount: 300, Status: models.OrderStatusCreated}
+	if err := repo.CreateOrder(ctx, &order); err != nil {
+		t.Fatal(err)
+	}
+	if order.Version != 1 {
+		t.Fatalf("Новый заказ должен иметь версию 1, получена %d", order.Version)
+	}
+
+	if _, err := repo.CancelOrder(ctx, order.ID, userID, order.Version+1); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Отмена в чужой версии: получено %v, ожидалось %v", err, ErrConflict)
+	}
+	status, err := repo.CancelOrder(ctx, order.ID, userID, order.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != models.OrderStatusCreated {
+		t.Errorf("Предыдущий статус %s, ожидался %s", status, models.OrderStatusCreated)
+	}
+	if version := rowVersion(t, repo, "orders", order.ID); version != order.Version+1 {
+		t.Errorf("Версия после отмены %d, ожидалась %d", version, order.Version+1)
+	}
+	if _, err := repo.CancelOrder(ctx, order.ID, userID, 0); !errors.Is(err, ErrOrderNotCancellable) {
+		t.Errorf("Повторная отмена: получено %v, ожидалось %v", err, ErrOrderNotCancellable)
+	}
+}
+
+func TestPendingPaymentVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userID := newTestUser(t, repo, 1002)
+
+	paymentID, err := repo.CreatePayment(ctx, userID, 0, 0, money.New(15000, money.RUB), models.PaymentProviderRobokassa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noOutbox := func(*CompletedPayment) ([]models.OutboxMessage, error) { return nil, nil }
+
+	tests := []struct {
+		name    string
+		update  func() error
+		wantErr error
+	}{
+		{
+			name:    "отмена в чужой версии",
+			update:  func() error { return repo.ClosePendingPayment(ctx, paymentID, 2, models.PaymentStatusCancelled) },
+			wantErr: ErrConflict,
+		},
+		{
+			name: "проведение в чужой версии",
+			update: func() error {
+				_, err := repo.CompletePayment(ctx, paymentID, 2, "tx-1", time.Now(), noOutbox)
+				return err
+			},
+			wantErr: ErrConflict,
+		},
+		{
+			name: "проведение в текущей версии",
+			update: func() error {
+				_, err := repo.CompletePayment(ctx, paymentID, 1, "tx-1", time.Now(), noOutbox)
+				return err
+			},
+		},
+		{
+			name: "повторное проведение",
+			update: func() error {
+				_, err := repo.CompletePayment(ctx, paymentID, 1, "tx-1", time.Now(), noOutbox)
+				return err
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "отмена проведенного платежа",
+			update:  func() error { return repo.ClosePendingPayment(ctx, paymentID, 0, models.PaymentStatusCancelled) },
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		if err := tt.update(); !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: получено %v, ожидалось %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if version := rowVersion(t, repo, "payments", paymentID); version != 2 {
+		t.Errorf("Версия проведенного платежа %d, ожидалась 2", version)
+	}
+}
+
+func TestRetryKIZRequestVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	userID := newTestUser(t, repo, 1003)
+
+	requestID, err := repo.CreateKIZRequest(ctx, NewKIZRequest{UserID: userID, TelegramID: 1003, INN: "7707083893",
+		RequestTime: time.Now(), CodesRequested: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RetryKIZRequest(ctx, requestID, 0, false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Повтор выполняемого запроса: получено %v, ожидалось %v", err, ErrNotFound)
+	}
+	if _, err := repo.db.ExecContext(ctx, "UPDATE kiz_requests SET status = $2 WHERE id = $1",
+		requestID, models.KIZRequestStatusFailed); err != nil {
+		t.Fatal(err)
+	}
+
+	version := rowVersion(t, repo, "kiz_requests", requestID)
+	if err := repo.RetryKIZRequest(ctx, requestID, version+1, false); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Повтор в чужой версии: получено %v, ожидалось %v", err, ErrConflict)
+	}
+	if err := repo.RetryKIZRequest(ctx, requestID, version, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := rowVersion(t, repo, "kiz_requests", requestID); got != version+1 {
+		t.Errorf("Версия после повтора %d, ожидалась %d", got, version+1)
+	}
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+// WildberriesToken возвращает токен API Wildberries пользователя и время его изменения
+func (r *Repository) WildberriesToken(ctx context.Context, userID int) (string, time.Time, error) {
+	var token string
+	var updatedAt time.Time
+	err := r.db.QueryRowContext(ctx,
+		"SELECT token, updated_at FROM wildberries_tokens WHERE user_id = $1", userID,
+	).Scan(&token, &updatedAt)
+	if err == sql.ErrNoRows {
+		return "", time.Time{}, ErrNotFound
+	}
+	return token, updatedAt, err
+}
+
+// SaveWildberriesToken сохраняет токен API Wildberries пользователя и возвращает время изменения
+func (r *Repository) SaveWildberriesToken(ctx context.Context, userID int, token string) (time.Time, error) {
+	var updatedAt time.Time
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO wildberries_tokens (user_id, token)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET token = EXCLUDED.token, updated_at = NOW()
+		RETURNING updated_at
+	`, userID, token).Scan(&updatedAt)
+	return updatedAt, err
+}
+
+// DeleteWildberriesToken удаляет токен API Wildberries пользователя
+func (r *Repository) DeleteWildberriesToken(ctx context.Context, userID int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM wildberries_tokens WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveWBBindings сохраняет результаты привязки кодов и заполняет их ID и время создания
+func (r *Repository) SaveWBBindings(ctx context.Context, bindings []models.WBBinding) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		for i := range bindings {
+			b := &bindings[i]
+			if err := tx.QueryRowContext(ctx, `
+				INSERT INTO wildberries_bindings (user_id, organization_id, supply_id, order_id, barcode, gtin, code, status, error)
+				VALUES ($1, NULLIF($2, 0), $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, NULLIF($9, ''))
+				RETURNING id, created_at
+			`, b.UserID, b.OrganizationID, b.SupplyID, b.OrderID, b.Barcode, b.GTIN, b.Code, b.Status, b.Error,
+			).Scan(&b.ID, &b.CreatedAt); err != nil {
+				return fmt.Errorf("ошибка сохранения результата привязки: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// WBBindings возвращает последние результаты привязки кодов организации или, если она
+// не указана, личные результаты пользователя; пустой supplyID не ограничивает выборку
+func (r *Repository) WBBindings(ctx context.Context, userID, organizationID int, supplyID string, limit int) ([]models.WBBinding, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, COALESCE(organization_id, 0), supply_id, order_id, COALESCE(barcode, ''),
+			COALESCE(gtin, ''), COALESCE(code, ''), status, COALESCE(error, ''), created_at
+		FROM wildberries_bindings
+		WHERE (CASE WHEN $2 > 0 THEN organization_id = $2 ELSE user_id = $1 AND organization_id IS NULL END)
+			AND ($3 = '' OR supply_id = $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, userID, organizationID, supplyID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bindings := []models.WBBinding{}
+	for rows.Next() {
+		var b models.WBBinding
+		if err := rows.Scan(&b.ID, &b.UserID, &b.OrganizationID, &b.SupplyID, &b.OrderID, &b.Barcode,
+			&b.GTIN, &b.Code, &b.Status, &b.Error, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, rows.Err()
+}
@@ -0,0 +1,225 @@
+package robokassa
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"project-znak/internal/money"
+	"project-znak/internal/tracing"
+)
+
+// Адрес XML-интерфейса Robokassa
+const defaultBaseURL = "https://auth.robokassa.ru/Merchant/WebService/Service.asmx"
+
+// ErrNotFound возвращается, если счет не найден в Robokassa: покупатель не перешел к оплате
+var ErrNotFound = errors.New("счет не найден в Robokassa")
+
+// Состояния операции OpState
+const (
+	StateInitiated = 5   // Операция инициализирована, деньги не получены
+	StateCancelled = 10  // Операция отменена, деньги не получены
+	StateReceiving = 50  // Деньги получены, идет зачисление магазину
+	StateRefunded  = 60  // Деньги возвращены покупателю после зачисления
+	StateSuspended = 80  // Исполнение операции приостановлено
+	StateCompleted = 100 // Операция выполнена, деньги зачислены магазину
+)
+
+// Код результата "счет не найден"
+const resultInvoiceNotFound = 3
+
+// Operation - состояние операции оплаты счета
+type Operation struct {
+	State     int
+	StateDate time.Time
+	OutSum    money.Money // Сумма, зачисленная магазину
+	OpKey     string      // Идентификатор операции в Robokassa
+}
+
+// Ответ OpStateExt
+type opStateResponse struct {
+	Result struct {
+		Code        int    `xml:"Code"`
+		Description string `xml:"Description"`
+	} `xml:"Result"`
+	State struct {
+		Code      int    `xml:"Code"`
+		StateDate string `xml:"StateDate"`
+	} `xml:"State"`
+	Info struct {
+		OutSum string `xml:"OutSum"`
+	} `xml:"Info"`
+	OpKey string `xml:"OpKey"`
+}
+
+// Health - доступность XML-интерфейса по результатам последних запросов
+type Health struct {
+	LastSuccess time.Time // Время последнего успешного запроса
+	LastFailure time.Time // Время последней ошибки
+	Error       string    // Текст последней ошибки
+	Failures    int       // Ошибок подряд после последнего успешного запроса
+}
+
+// Client запрашивает состояние платежей через XML-интерфейс Robokassa
+type Client struct {
+	baseURL    string
+	login      string
+	httpClient *http.Client
+
+	mu       sync.RWMutex
+	password string
+	health   Health
+}
+
+// NewClient создает клиент XML-интерфейса. Если адрес не задан, используется адрес Robokassa.
+func NewClient(baseURL, login, password string, timeout time.Duration) *Client {
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		login:      login,
+		password:   password,
+		httpClient: &http.Client{Timeout: timeout, Transport: tracing.Transport("robokassa")},
+	}
+}
+
+// Enabled сообщает, заданы ли логин и пароль магазина
+func (c *Client) Enabled() bool {
+	return c != nil && c.login != "" && c.currentPassword() != ""
+}
+
+// SetPassword заменяет пароль магазина после ротации секретов
+func (c *Client) SetPassword(password string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.password = password
+}
+
+func (c *Client) currentPassword() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.password
+}
+
+// Health возвращает доступность XML-интерфейса по результатам последних запросов
+func (c *Client) Health() Health {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.health
+}
+
+// Учет результата запроса. Ненайденный счет означает, что интерфейс доступен;
+// запросы, прерванные отменой контекста, не учитываются.
+func (c *Client) record(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil || errors.Is(err, ErrNotFound) {
+		c.health.LastSuccess = time.Now()
+		c.health.Failures = 0
+		return
+	}
+	c.health.LastFailure = time.Now()
+	c.health.Error = err.Error()
+	c.health.Failures++
+}
+
+// OpState возвращает состояние оплаты счета с номером invoiceID. Запрос подписывается
+// так же, как ссылка на оплату: SHA-1 от строки MerchantLogin:InvoiceID:Пароль.
+func (c *Client) OpState(ctx context.Context, invoiceID int) (*Operation, error) {
+	operation, err := c.opState(ctx, invoiceID)
+	c.record(err)
+	return operation, err
+}
+
+func (c *Client) opState(ctx context.Context, invoiceID int) (*Operation, error) {
+	signature := fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%s:%d:%s", c.login, invoiceID, c.currentPassword()))))
+	query := url.Values{
+		"MerchantLogin": {c.login},
+		"InvoiceID":     {strconv.Itoa(invoiceID)},
+		"Signature":     {signature},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/OpStateExt?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к Robokassa: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("Robokassa вернула ошибку: %d, тело: %s", resp.StatusCode, string(body))
+	}
+
+	var result opStateResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования ответа Robokassa: %w", err)
+	}
+	if result.Result.Code == resultInvoiceNotFound {
+		return nil, ErrNotFound
+	}
+	if result.Result.Code != 0 {
+		return nil, fmt.Errorf("Robokassa вернула ошибку %d: %s", result.Result.Code, result.Result.Description)
+	}
+
+	operation := &Operation{State: result.State.Code, OpKey: result.OpKey}
+	if result.Info.OutSum != "" {
+		if operation.OutSum, err = money.Parse(result.Info.OutSum, money.RUB); err != nil {
+			return nil, fmt.Errorf("некорректная сумма в ответе Robokassa: %q", result.Info.OutSum)
+		}
+	}
+	if result.State.StateDate != "" {
+		operation.StateDate, _ = time.Parse(time.RFC3339Nano, result.State.StateDate)
+	}
+	return operation, nil
+}
+
+// ResultSignature возвращает подпись уведомления ResultURL: SHA-1 от строки
+// OutSum:InvId:Пароль#2, к которой добавляются пользовательские параметры Shp_
+// в виде :Shp_имя=значение в алфавитном порядке имен
+func ResultSignature(outSum, invID, password string, params map[string]string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var base strings.Builder
+	fmt.Fprintf(&base, "%s:%s:%s", outSum, invID, password)
+	for _, name := range names {
+		fmt.Fprintf(&base, ":%s=%s", name, params[name])
+	}
+	return fmt.Sprintf("%x", sha1.Sum([]byte(base.String())))
+}
+
+// VerifyResult проверяет подпись уведомления ResultURL. Robokassa передает подпись
+// в верхнем регистре, поэтому регистр не учитывается.
+func VerifyResult(signature, outSum, invID, password string, params map[string]string) bool {
+	if password == "" {
+		return false
+	}
+	expected := ResultSignature(outSum, invID, password, params)
+	return subtle.ConstantTimeCompare([]byte(strings.ToLower(signature)), []byte(expected)) == 1
+}
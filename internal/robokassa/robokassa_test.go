@@ -0,0 +1,94 @@
+package robokassa
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"project-znak/internal/money"
+)
+
+func TestOpState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		want := fmt.Sprintf("%x", sha1.Sum([]byte("shop:"+query.Get("InvoiceID")+":secret")))
+		if r.URL.Path != "/OpStateExt" || query.Get("MerchantLogin") != "shop" || query.Get("Signature") != want {
+			t.Errorf("неверный запрос: %s", r.URL)
+		}
+
+		if query.Get("InvoiceID") == "404" {
+			w.Write([]byte(`<OperationStateResponse><Result><Code>3</Code><Description>Invoice not found</Description></Result></OperationStateResponse>`))
+			return
+		}
+		w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<OperationStateResponse xmlns="http://merchant.roboxchange.com/WebService/">
+  <Result><Code>0</Code></Result>
+  <State><Code>100</Code><RequestDate>2025-03-01T10:00:00.0000000+03:00</RequestDate><StateDate>2025-03-01T09:58:00.0000000+03:00</StateDate></State>
+  <Info><IncCurrLabel>BANKOCEAN2R</IncCurrLabel><IncSum>150.000000</IncSum><OutCurrLabel>BANKOCEAN2R</OutCurrLabel><OutSum>150.000000</OutSum></Info>
+  <OpKey>op-42</OpKey>
+</OperationStateResponse>`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "shop", "secret", time.Second)
+
+	operation, err := client.OpState(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("OpState() вернул ошибку: %v", err)
+	}
+	if operation.State != StateCompleted || !operation.OutSum.Equal(money.Rubles(15000)) || operation.OpKey != "op-42" || operation.StateDate.IsZero() {
+		t.Errorf("неверное состояние операции: %+v", operation)
+	}
+
+	if _, err := client.OpState(context.Background(), 404); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ожидалась ошибка ErrNotFound, получено: %v", err)
+	}
+	if health := client.Health(); health.LastSuccess.IsZero() || health.Failures != 0 {
+		t.Errorf("неверное состояние интерфейса: %+v", health)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "shop", "secret", time.Second)
+	for i := 0; i < 2; i++ {
+		if _, err := client.OpState(context.Background(), 42); err == nil {
+			t.Fatal("ожидалась ошибка при недоступности Robokassa")
+		}
+	}
+	health := client.Health()
+	if health.Failures != 2 || health.LastFailure.IsZero() || !health.LastSuccess.IsZero() || health.Error == "" {
+		t.Errorf("неверное состояние интерфейса: %+v", health)
+	}
+}
+
+func TestVerifyResult(t *testing.T) {
+	params := map[string]string{"Shp_TransactionId": "tx-1", "Shp_A": "1"}
+	signature := ResultSignature("150.00", "42", "password2", params)
+	if signature != fmt.Sprintf("%x", sha1.Sum([]byte("150.00:42:password2:Shp_A=1:Shp_TransactionId=tx-1"))) {
+		t.Errorf("неверная подпись: %s", signature)
+	}
+
+	if !VerifyResult(strings.ToUpper(signature), "150.00", "42", "password2", params) {
+		t.Error("подпись в верхнем регистре не принята")
+	}
+	if VerifyResult(signature, "1.00", "42", "password2", params) {
+		t.Error("принята подпись с другой суммой")
+	}
+	if VerifyResult(signature, "150.00", "42", "password1", params) {
+		t.Error("принята подпись с другим паролем")
+	}
+	if VerifyResult(signature, "150.00", "42", "", params) {
+		t.Error("принята подпись без пароля")
+	}
+}
@@ -0,0 +1,319 @@
+package sandbox
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"project-znak/internal/chestnyznak"
+)
+
+// Код маркировки, выданный песочницей
+type code struct {
+	gtin           string
+	status         string
+	ownerINN       string
+	productGroup   string
+	emissionDate   time.Time
+	introducedDate time.Time
+}
+
+// Документ, отправленный в Честный ЗНАК
+type document struct {
+	documentType string
+	ownerINN     string
+	codes        []string
+	readyAt      time.Time // Время окончания обработки
+	errors       []string  // Ошибки проверки; непусто - документ будет отклонен
+	applied      bool      // Статусы кодов изменены по результату обработки
+}
+
+// Поля документов, по которым песочница меняет статусы кодов
+type documentBody struct {
+	DocumentType   string   `json:"document_type"`
+	ParticipantINN string   `json:"participant_inn"`
+	ReceiverINN    string   `json:"trade_participant_inn_receiver"`
+	Cises          []string `json:"cises"`
+	Products       []struct {
+		UIT string `json:"uit_code"`
+	} `json:"products"`
+}
+
+// API Честного ЗНАКа: проверка доступности, запрос КИЗ, отправка и состояние документов,
+// квитанции, сведения о кодах. Подписанные запросы проверяются по сертификату из заголовка X-Certificate.
+func (s *Server) chestnyZnakHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("HEAD /{$}", func(w http.ResponseWriter, r *http.Request) {
+		if !s.failTransport(r.Context(), w, s.fault(ServiceChestnyZnak, "ping")) {
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	mux.HandleFunc("POST /kizs", s.signed("kizs", s.handleKIZs))
+	mux.HandleFunc("POST /documents", s.signed("documents", s.handleSubmitDocument))
+	mux.HandleFunc("GET /documents/{id}", s.signed("document_status", s.handleDocumentStatus))
+	mux.HandleFunc("GET /documents/{id}/ticket", s.signed("document_ticket", s.handleDocumentTicket))
+	mux.HandleFunc("POST /cises/info", s.signed("cises", s.handleCodesInfo))
+	return mux
+}
+
+// Обработчик операции Честного ЗНАКа с подписанными данными: телом запроса или,
+// для запросов без тела, идентификатором документа
+type signedHandler func(w http.ResponseWriter, r *http.Request, body []byte, reject bool)
+
+// Проверка подписи и правил сбоя перед обработкой операции
+func (s *Server) signed(operation string, next signedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Ошибка чтения запроса", http.StatusBadRequest)
+			return
+		}
+		data := body
+		if r.Method == http.MethodGet {
+			data = []byte(r.PathValue("id"))
+		}
+		if err := verifySignature(r, data); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		mode := s.fault(ServiceChestnyZnak, operation)
+		if s.failTransport(r.Context(), w, mode) {
+			return
+		}
+		next(w, r, body, mode == FaultReject)
+	}
+}
+
+// Проверка подписи SHA-256 данных по сертификату. Подписи ГОСТ не проверяются:
+// стандартная библиотека не поддерживает эти алгоритмы.
+func verifySignature(r *http.Request, data []byte) error {
+	signature, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Signature"))
+	if err != nil || len(signature) == 0 {
+		return fmt.Errorf("отсутствует или некорректна подпись X-Signature")
+	}
+	certData, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Certificate"))
+	if err != nil {
+		return fmt.Errorf("некорректный сертификат X-Certificate")
+	}
+	cert, err := x509.ParseCertificate(certData)
+	if err != nil {
+		return fmt.Errorf("некорректный сертификат X-Certificate: %v", err)
+	}
+
+	var algorithm x509.SignatureAlgorithm
+	switch cert.PublicKeyAlgorithm {
+	case x509.RSA:
+		algorithm = x509.SHA256WithRSA
+	case x509.ECDSA:
+		algorithm = x509.ECDSAWithSHA256
+	case x509.Ed25519:
+		algorithm = x509.PureEd25519
+	default:
+		return nil
+	}
+	if err := cert.CheckSignature(algorithm, data, signature); err != nil {
+		return fmt.Errorf("подпись не соответствует сертификату: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) handleKIZs(w http.ResponseWriter, r *http.Request, body []byte, reject bool) {
+	var req struct {
+		GTINData     []chestnyznak.GTINData `json:"gtin_data"`
+		INN          string                 `json:"inn"`
+		ProductGroup string                 `json:"product_group"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || len(req.GTINData) == 0 {
+		http.Error(w, "Некорректный запрос КИЗ", http.StatusBadRequest)
+		return
+	}
+	if reject {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":  "error",
+			"message": "Запрос КИЗ отклонен: участник оборота не зарегистрирован в товарной группе",
+		})
+		return
+	}
+
+	productGroup := r.URL.Query().Get("pg")
+	if productGroup == "" {
+		productGroup = req.ProductGroup
+	}
+	now := time.Now()
+	s.mu.Lock()
+	kizs := make([]string, 0)
+	for _, data := range req.GTINData {
+		for i := 0; i < data.Count; i++ {
+			cis := newCode(data.GTIN)
+			s.codes[cis] = &code{gtin: data.GTIN, status: chestnyznak.CodeStatusEmitted, ownerINN: req.INN,
+				productGroup: productGroup, emissionDate: now}
+			kizs = append(kizs, cis)
+		}
+	}
+	s.mu.Unlock()
+
+	s.logger.Printf("Выдано %d КИЗ для ИНН %s", len(kizs), req.INN)
+	writeJSON(w, http.StatusOK, map[string]any{"status": "success", "kizs": kizs})
+}
+
+// Документ принимается к обработке; результат проверки доступен через Config.ProcessingDelay.
+// Документ с кодами, неизвестными песочнице, и документ в режиме reject отклоняются.
+func (s *Server) handleSubmitDocument(w http.ResponseWriter, r *http.Request, body []byte, reject bool) {
+	var req documentBody
+	if err := json.Unmarshal(body, &req); err != nil || req.DocumentType == "" {
+		http.Error(w, "Некорректный документ", http.StatusBadRequest)
+		return
+	}
+
+	doc := &document{
+		documentType: req.DocumentType,
+		ownerINN:     req.ParticipantINN,
+		codes:        req.Cises,
+		readyAt:      time.Now().Add(s.cfg.ProcessingDelay),
+	}
+	if req.DocumentType == chestnyznak.DocumentTypeAcceptGoods {
+		doc.ownerINN = req.ReceiverINN
+	}
+	for _, product := range req.Products {
+		doc.codes = append(doc.codes, product.UIT)
+	}
+	if reject {
+		doc.errors = append(doc.errors, "Документ отклонен: сведения о товаре не соответствуют данным каталога")
+	}
+
+	s.mu.Lock()
+	for _, cis := range doc.codes {
+		if _, ok := s.codes[cis]; !ok {
+			doc.errors = append(doc.errors, fmt.Sprintf("Код маркировки %s не найден", cis))
+		}
+	}
+	id := s.nextID("doc")
+	s.documents[id] = doc
+	s.mu.Unlock()
+
+	s.logger.Printf("Принят документ %s %s: %d кодов", id, doc.documentType, len(doc.codes))
+	writeJSON(w, http.StatusOK, map[string]any{"status": "success", "document_id": id})
+}
+
+// Состояние документа. При первом запросе после окончания обработки принятый документ
+// меняет статусы кодов: ввод в оборот - INTRODUCED, вывод из оборота - RETIRED, приемка -
+// владельца кодов.
+func (s *Server) handleDocumentStatus(w http.ResponseWriter, r *http.Request, _ []byte, reject bool) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.documents[id]
+	if !ok {
+		http.Error(w, "Документ не найден", http.StatusNotFound)
+		return
+	}
+	if reject {
+		// Отказ при запросе состояния - ошибка обработки документа на стороне Честного ЗНАКа
+		doc.errors = append(doc.errors, "Ошибка обработки документа")
+		doc.readyAt = time.Now()
+	}
+
+	resp := map[string]any{"status": "success", "document_status": chestnyznak.DocumentStateInProgress}
+	switch {
+	case time.Now().Before(doc.readyAt):
+	case len(doc.errors) > 0:
+		resp["document_status"] = chestnyznak.DocumentStateCheckedErr
+		resp["errors"] = doc.errors
+	default:
+		if !doc.applied {
+			s.applyDocument(doc)
+			doc.applied = true
+		}
+		resp["document_status"] = chestnyznak.DocumentStateCheckedOK
+		resp["ticket"] = "ticket-" + id
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Квитанция о принятии документа в формате XML. Вместо подписи ГОСТ песочница передает
+// хэш SHA-256 содержимого квитанции.
+func (s *Server) handleDocumentTicket(w http.ResponseWriter, r *http.Request, _ []byte, reject bool) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	doc, ok := s.documents[id]
+	ready := ok && !time.Now().Before(doc.readyAt) && len(doc.errors) == 0
+	s.mu.Unlock()
+	if !ok || reject {
+		http.Error(w, "Документ не найден", http.StatusNotFound)
+		return
+	}
+	if !ready {
+		http.Error(w, "Квитанция еще не сформирована", http.StatusNotFound)
+		return
+	}
+
+	content := fmt.Sprintf(`<ticket id="ticket-%s" document_id="%s" document_type="%s" status="%s" processed_at="%s">`,
+		id, id, doc.documentType, chestnyznak.DocumentStateCheckedOK, doc.readyAt.UTC().Format(time.RFC3339))
+	digest := sha256.Sum256([]byte(content))
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n%s<signature>%s</signature></ticket>\n",
+		content, base64.StdEncoding.EncodeToString(digest[:]))
+}
+
+// Изменение статусов кодов по принятому документу
+func (s *Server) applyDocument(doc *document) {
+	now := time.Now()
+	for _, cis := range doc.codes {
+		c := s.codes[cis]
+		if c == nil {
+			continue
+		}
+		switch doc.documentType {
+		case chestnyznak.DocumentTypeIntroduceGoods, chestnyznak.DocumentTypeGoodsImport:
+			c.status = chestnyznak.CodeStatusIntroduced
+			c.introducedDate = now
+		case chestnyznak.DocumentTypeRetirement:
+			c.status = chestnyznak.CodeStatusRetired
+		case chestnyznak.DocumentTypeAcceptGoods:
+			c.ownerINN = doc.ownerINN
+		}
+	}
+}
+
+func (s *Server) handleCodesInfo(w http.ResponseWriter, _ *http.Request, body []byte, reject bool) {
+	var codes []string
+	if err := json.Unmarshal(body, &codes); err != nil {
+		http.Error(w, "Ожидается массив кодов маркировки", http.StatusBadRequest)
+		return
+	}
+	if reject {
+		writeJSON(w, http.StatusOK, map[string]any{"status": "error", "message": "Сведения о кодах недоступны"})
+		return
+	}
+
+	s.mu.Lock()
+	cises := make([]chestnyznak.CodeInfo, 0, len(codes))
+	for _, cis := range codes {
+		c, ok := s.codes[strings.TrimSpace(cis)]
+		if !ok {
+			continue
+		}
+		info := chestnyznak.CodeInfo{
+			CIS:          cis,
+			GTIN:         c.gtin,
+			Status:       c.status,
+			OwnerINN:     c.ownerINN,
+			ProductGroup: c.productGroup,
+			EmissionDate: c.emissionDate.Format(time.RFC3339),
+		}
+		if !c.introducedDate.IsZero() {
+			info.IntroducedDate = c.introducedDate.Format(time.RFC3339)
+		}
+		cises = append(cises, info)
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{"status": "success", "cises": cises})
+}
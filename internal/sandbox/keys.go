@@ -0,0 +1,54 @@
+package sandbox
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WriteKeys создает в каталоге dir ключ RSA в формате PKCS#8 (sandbox.key) и самоподписанный
+// сертификат (sandbox.crt) для хранилища KEYSTORE_DRIVER=pem, если их еще нет. Песочница
+// проверяет подпись запросов по сертификату, переданному сервисом.
+func WriteKeys(dir string) (keyPath, certPath string, err error) {
+	keyPath, certPath = filepath.Join(dir, "sandbox.key"), filepath.Join(dir, "sandbox.crt")
+	if _, err := os.Stat(certPath); err == nil {
+		return keyPath, certPath, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", "", err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "Песочница Project-Znak", Organization: []string{"ООО «Песочница»"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o644); err != nil {
+		return "", "", err
+	}
+	return keyPath, certPath, nil
+}
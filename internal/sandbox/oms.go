@@ -0,0 +1,211 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/oms"
+)
+
+// Заказ кодов маркировки в СУЗ
+type omsOrder struct {
+	productGroup string
+	buffers      map[string]*omsBuffer // GTIN -> буфер
+}
+
+// Буфер кодов заказа по GTIN
+type omsBuffer struct {
+	total     int
+	issued    int
+	readyAt   time.Time // Время формирования кодов
+	closed    bool
+	rejection string // Причина отклонения; непусто - заказ отклонен
+	blocks    int
+}
+
+// Состояние буфера в ответе СУЗ
+func (b *omsBuffer) status(now time.Time) string {
+	switch {
+	case b.rejection != "":
+		return oms.BufferRejected
+	case b.closed:
+		return oms.BufferClosed
+	case now.Before(b.readyAt):
+		return oms.BufferPending
+	case b.issued >= b.total:
+		return oms.BufferExhausted
+	default:
+		return oms.BufferActive
+	}
+}
+
+// API СУЗ: создание заказа, состояние буфера, получение кодов и закрытие буфера.
+// Запросы без omsId или clientToken отклоняются.
+func (s *Server) omsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /order", s.omsOperation("order", s.handleOMSOrder))
+	mux.HandleFunc("GET /order/status", s.omsOperation("status", s.handleOMSStatus))
+	mux.HandleFunc("GET /codes", s.omsOperation("codes", s.handleOMSCodes))
+	mux.HandleFunc("POST /buffer/close", s.omsOperation("close", s.handleOMSClose))
+	return mux
+}
+
+// Обработчик операции СУЗ; reject - отказ по существу по правилу сбоя
+type omsHandlerFunc func(w http.ResponseWriter, r *http.Request, reject bool)
+
+func (s *Server) omsOperation(operation string, next omsHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("omsId") == "" || r.Header.Get("clientToken") == "" {
+			writeOMSError(w, http.StatusUnauthorized, "Не указан omsId или clientToken")
+			return
+		}
+		mode := s.fault(ServiceOMS, operation)
+		if s.failTransport(r.Context(), w, mode) {
+			return
+		}
+		next(w, r, mode == FaultReject)
+	}
+}
+
+// Заказ принимается; коды формируются через Config.ProcessingDelay. В режиме reject
+// буферы заказа переходят в состояние REJECTED.
+func (s *Server) handleOMSOrder(w http.ResponseWriter, r *http.Request, reject bool) {
+	var req struct {
+		ProductGroup string `json:"productGroup"`
+		Products     []struct {
+			GTIN     string `json:"gtin"`
+			Quantity int    `json:"quantity"`
+		} `json:"products"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Products) == 0 {
+		writeOMSError(w, http.StatusBadRequest, "Некорректный заказ")
+		return
+	}
+
+	order := &omsOrder{productGroup: req.ProductGroup, buffers: make(map[string]*omsBuffer)}
+	readyAt := time.Now().Add(s.cfg.ProcessingDelay)
+	for _, product := range req.Products {
+		if product.Quantity <= 0 {
+			writeOMSError(w, http.StatusBadRequest, "Количество кодов должно быть положительным")
+			return
+		}
+		buffer := &omsBuffer{total: product.Quantity, readyAt: readyAt}
+		if reject {
+			buffer.rejection = "Заказ отклонен: GTIN не найден в каталоге"
+		}
+		order.buffers[product.GTIN] = buffer
+	}
+
+	s.mu.Lock()
+	id := s.nextID("order")
+	s.orders[id] = order
+	s.mu.Unlock()
+
+	s.logger.Printf("Принят заказ СУЗ %s: %d GTIN", id, len(order.buffers))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"orderId":                   id,
+		"expectedCompleteTimestamp": readyAt.UnixMilli(),
+	})
+}
+
+func (s *Server) handleOMSStatus(w http.ResponseWriter, r *http.Request, reject bool) {
+	orderID, gtin := r.URL.Query().Get("orderId"), r.URL.Query().Get("gtin")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buffer := s.omsBuffer(orderID, gtin)
+	if buffer == nil {
+		writeOMSError(w, http.StatusNotFound, "Заказ не найден")
+		return
+	}
+	if reject && buffer.rejection == "" {
+		buffer.rejection = "Заказ отклонен при формировании кодов"
+	}
+
+	writeJSON(w, http.StatusOK, []oms.Buffer{{
+		OrderID:         orderID,
+		GTIN:            gtin,
+		Status:          buffer.status(time.Now()),
+		TotalCodes:      buffer.total,
+		AvailableCodes:  buffer.total - buffer.issued,
+		LeftInBuffer:    buffer.total - buffer.issued,
+		RejectionReason: buffer.rejection,
+	}})
+}
+
+// Выдача порции кодов из активного буфера. Коды регистрируются в песочнице Честного ЗНАКа
+// как эмитированные, чтобы их можно было ввести в оборот.
+func (s *Server) handleOMSCodes(w http.ResponseWriter, r *http.Request, reject bool) {
+	query := r.URL.Query()
+	quantity, err := strconv.Atoi(query.Get("quantity"))
+	if err != nil || quantity <= 0 {
+		writeOMSError(w, http.StatusBadRequest, "Некорректное количество кодов")
+		return
+	}
+	if reject {
+		writeOMSError(w, http.StatusBadRequest, "Получение кодов отклонено")
+		return
+	}
+
+	orderID, gtin := query.Get("orderId"), query.Get("gtin")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buffer := s.omsBuffer(orderID, gtin)
+	if buffer == nil {
+		writeOMSError(w, http.StatusNotFound, "Заказ не найден")
+		return
+	}
+	if status := buffer.status(time.Now()); status != oms.BufferActive {
+		writeOMSError(w, http.StatusBadRequest, "Буфер кодов недоступен: "+status)
+		return
+	}
+
+	now := time.Now()
+	codes := make([]string, 0, quantity)
+	for i := 0; i < quantity && buffer.issued < buffer.total; i++ {
+		cis := newCode(gtin)
+		s.codes[cis] = &code{gtin: gtin, status: chestnyznak.CodeStatusEmitted,
+			productGroup: s.orders[orderID].productGroup, emissionDate: now}
+		codes = append(codes, cis)
+		buffer.issued++
+	}
+	buffer.blocks++
+	writeJSON(w, http.StatusOK, map[string]any{
+		"codes":   codes,
+		"blockId": orderID + "-" + gtin + "-" + strconv.Itoa(buffer.blocks),
+	})
+}
+
+func (s *Server) handleOMSClose(w http.ResponseWriter, r *http.Request, reject bool) {
+	if reject {
+		writeOMSError(w, http.StatusBadRequest, "Закрытие буфера отклонено")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buffer := s.omsBuffer(r.URL.Query().Get("orderId"), r.URL.Query().Get("gtin"))
+	if buffer == nil {
+		writeOMSError(w, http.StatusNotFound, "Заказ не найден")
+		return
+	}
+	buffer.closed = true
+	w.WriteHeader(http.StatusOK)
+}
+
+// Буфер заказа по GTIN; nil, если не найден. Вызывается под s.mu.
+func (s *Server) omsBuffer(orderID, gtin string) *omsBuffer {
+	order, ok := s.orders[orderID]
+	if !ok {
+		return nil
+	}
+	return order.buffers[gtin]
+}
+
+// Ошибка в формате СУЗ
+func writeOMSError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"globalErrors": []map[string]string{{"error": message}},
+	})
+}
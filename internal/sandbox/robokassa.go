@@ -0,0 +1,170 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-znak/internal/robokassa"
+)
+
+// Счет, по которому покупатель перешел на страницу оплаты
+type invoice struct {
+	outSum    string
+	state     int
+	stateDate time.Time
+	opKey     string
+}
+
+// Ответ OpStateExt
+type opStateResponse struct {
+	XMLName xml.Name `xml:"OperationStateResponse"`
+	Result  struct {
+		Code        int    `xml:"Code"`
+		Description string `xml:"Description,omitempty"`
+	} `xml:"Result"`
+	State *opState `xml:"State,omitempty"`
+	Info  *opInfo  `xml:"Info,omitempty"`
+	OpKey string   `xml:"OpKey,omitempty"`
+}
+
+type opState struct {
+	Code      int    `xml:"Code"`
+	StateDate string `xml:"StateDate"`
+}
+
+type opInfo struct {
+	OutSum string `xml:"OutSum"`
+}
+
+// Robokassa: страница оплаты Merchant/Index.aspx и XML-интерфейс OpStateExt
+func (s *Server) robokassaHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /Merchant/Index.aspx", s.handleRobokassaPayment)
+	mux.HandleFunc("GET /OpStateExt", s.handleOpState)
+	return mux
+}
+
+// Страница оплаты сразу проводит оплату счета и отправляет уведомление ResultURL, подписанное
+// паролем #2. В режиме reject операции payment счет отменяется; при сбое операции result
+// уведомление не отправляется, и платеж может быть проведен только сверкой через OpState.
+func (s *Server) handleRobokassaPayment(w http.ResponseWriter, r *http.Request) {
+	mode := s.fault(ServiceRobokassa, "payment")
+	if s.failTransport(r.Context(), w, mode) {
+		return
+	}
+
+	query := r.URL.Query()
+	invID, err := strconv.Atoi(query.Get("InvId"))
+	outSum := query.Get("OutSum")
+	if err != nil || outSum == "" || query.Get("SignatureValue") == "" {
+		http.Error(w, "Некорректные параметры платежа", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	inv := &invoice{outSum: outSum, state: robokassa.StateCompleted, stateDate: time.Now(), opKey: s.nextID("op")}
+	if mode == FaultReject {
+		inv.state = robokassa.StateCancelled
+	}
+	s.invoices[invID] = inv
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if inv.state == robokassa.StateCancelled {
+		s.logger.Printf("Счет %d отменен", invID)
+		fmt.Fprintf(w, "Оплата счета %d отклонена банком\n", invID)
+		return
+	}
+
+	s.logger.Printf("Счет %d оплачен: %s", invID, outSum)
+	fmt.Fprintf(w, "Счет %d оплачен: %s\n", invID, outSum)
+	if mode := s.fault(ServiceRobokassa, "result"); mode != "" {
+		fmt.Fprintln(w, "Уведомление ResultURL не отправлено (сбой result)")
+		return
+	}
+	answer, err := s.sendResult(r.Context(), invID, inv)
+	if err != nil {
+		s.logger.Printf("Ошибка уведомления по счету %d: %v", invID, err)
+		fmt.Fprintf(w, "Ошибка уведомления ResultURL: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "Ответ ResultURL: %s\n", answer)
+}
+
+// Отправка уведомления ResultURL. Сервис должен ответить OK<InvId>.
+func (s *Server) sendResult(ctx context.Context, invID int, inv *invoice) (string, error) {
+	invIDText := strconv.Itoa(invID)
+	params := map[string]string{"Shp_TransactionId": inv.opKey}
+	form := url.Values{
+		"OutSum":         {inv.outSum},
+		"InvId":          {invIDText},
+		"SignatureValue": {strings.ToUpper(robokassa.ResultSignature(inv.outSum, invIDText, s.cfg.Password2, params))},
+	}
+	for name, value := range params {
+		form.Set(name, value)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.ResultURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	answer := strings.TrimSpace(string(body))
+	if resp.StatusCode != http.StatusOK || answer != "OK"+invIDText {
+		return "", fmt.Errorf("неожиданный ответ %d: %s", resp.StatusCode, answer)
+	}
+	return answer, nil
+}
+
+// Состояние оплаты счета. Счет, по которому покупатель не переходил на страницу оплаты,
+// и любой счет в режиме reject считаются ненайденными.
+func (s *Server) handleOpState(w http.ResponseWriter, r *http.Request) {
+	mode := s.fault(ServiceRobokassa, "opstate")
+	if s.failTransport(r.Context(), w, mode) {
+		return
+	}
+
+	var resp opStateResponse
+	invID, err := strconv.Atoi(r.URL.Query().Get("InvoiceID"))
+	if err != nil || r.URL.Query().Get("MerchantLogin") == "" || r.URL.Query().Get("Signature") == "" {
+		resp.Result.Code = 1
+		resp.Result.Description = "Некорректные параметры запроса"
+		writeXML(w, resp)
+		return
+	}
+
+	s.mu.Lock()
+	inv, ok := s.invoices[invID]
+	s.mu.Unlock()
+	if !ok || mode == FaultReject {
+		resp.Result.Code = 3
+		resp.Result.Description = "Счет не найден"
+		writeXML(w, resp)
+		return
+	}
+
+	resp.State = &opState{Code: inv.state, StateDate: inv.stateDate.Format(time.RFC3339)}
+	resp.Info = &opInfo{OutSum: inv.outSum}
+	resp.OpKey = inv.opKey
+	writeXML(w, resp)
+}
+
+func writeXML(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,249 @@
+// Package sandbox имитирует API Честного ЗНАКа, СУЗ и Robokassa в объеме, который использует
+// сервис, чтобы проверять фоновую обработку запросов, документов и платежей локально.
+// Сбои внешних систем (таймауты, превышение лимита, ошибки сервера, отказы по существу)
+// задаются правилами Fault при запуске или через управляющий API.
+package sandbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Имитируемые системы
+const (
+	ServiceChestnyZnak = "chestnyznak"
+	ServiceOMS         = "oms"
+	ServiceRobokassa   = "robokassa"
+)
+
+// Режимы сбоя
+const (
+	FaultTimeout  = "timeout"  // Ответ задерживается на Config.TimeoutDelay, затем 504
+	FaultThrottle = "throttle" // 429 с заголовком Retry-After
+	FaultError    = "error"    // 500
+	FaultReject   = "reject"   // Отказ по существу: отклоненный запрос, документ или платеж
+)
+
+// Fault - правило сбоя для операции имитируемой системы. Операции Честного ЗНАКа: ping, kizs,
+// documents, document_status, cises; СУЗ: order, status, codes, close; Robokassa: payment,
+// result (уведомление ResultURL не отправляется), opstate.
+type Fault struct {
+	Service   string `json:"service"`
+	Operation string `json:"operation,omitempty"` // Пусто - все операции системы
+	Mode      string `json:"mode"`
+	Count     int    `json:"count,omitempty"` // Сколько запросов затрагивает правило; 0 - все
+}
+
+// ParseFault разбирает правило в формате система.операция=режим*число, например
+// chestnyznak.kizs=throttle*3 или oms=error. Операция и число необязательны.
+func ParseFault(spec string) (Fault, error) {
+	target, mode, ok := strings.Cut(spec, "=")
+	if !ok {
+		return Fault{}, fmt.Errorf("правило сбоя %q: ожидается система.операция=режим*число", spec)
+	}
+	var fault Fault
+	fault.Service, fault.Operation, _ = strings.Cut(target, ".")
+	fault.Mode, _, _ = strings.Cut(mode, "*")
+	if _, count, ok := strings.Cut(mode, "*"); ok {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return Fault{}, fmt.Errorf("правило сбоя %q: некорректное число запросов %q", spec, count)
+		}
+		fault.Count = n
+	}
+	return fault, fault.validate()
+}
+
+func (f Fault) validate() error {
+	switch f.Service {
+	case ServiceChestnyZnak, ServiceOMS, ServiceRobokassa:
+	default:
+		return fmt.Errorf("неизвестная система %q: ожидается chestnyznak, oms или robokassa", f.Service)
+	}
+	switch f.Mode {
+	case FaultTimeout, FaultThrottle, FaultError, FaultReject:
+	default:
+		return fmt.Errorf("неизвестный режим сбоя %q: ожидается timeout, throttle, error или reject", f.Mode)
+	}
+	if f.Count < 0 {
+		return fmt.Errorf("число запросов не может быть отрицательным")
+	}
+	return nil
+}
+
+// Config - настройки песочницы
+type Config struct {
+	ResultURL       string        // Адрес уведомлений ResultURL сервиса
+	Password2       string        // Пароль #2 Robokassa для подписи уведомлений
+	ProcessingDelay time.Duration // Время обработки документа и формирования буфера кодов СУЗ
+	TimeoutDelay    time.Duration // Задержка ответа в режиме timeout
+}
+
+// Server - песочница внешних систем
+type Server struct {
+	cfg        Config
+	logger     *log.Logger
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	faults    []*Fault
+	seq       int
+	codes     map[string]*code
+	documents map[string]*document
+	orders    map[string]*omsOrder
+	invoices  map[int]*invoice
+}
+
+// New создает песочницу
+func New(cfg Config, logger *log.Logger) *Server {
+	return &Server{
+		cfg:        cfg,
+		logger:     logger,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		codes:      make(map[string]*code),
+		documents:  make(map[string]*document),
+		orders:     make(map[string]*omsOrder),
+		invoices:   make(map[int]*invoice),
+	}
+}
+
+// Handler возвращает обработчик запросов: API Честного ЗНАКа по пути /chestnyznak/,
+// СУЗ - /oms/, Robokassa - /robokassa/, управление сбоями - /sandbox/faults
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/chestnyznak/", http.StripPrefix("/chestnyznak", s.chestnyZnakHandler()))
+	mux.Handle("/oms/", http.StripPrefix("/oms", s.omsHandler()))
+	mux.Handle("/robokassa/", http.StripPrefix("/robokassa", s.robokassaHandler()))
+	mux.HandleFunc("/sandbox/faults", s.faultsHandler())
+	return mux
+}
+
+// AddFault добавляет правило сбоя. Правила проверяются в порядке добавления.
+func (s *Server) AddFault(fault Fault) error {
+	if err := fault.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault)
+	return nil
+}
+
+// Faults возвращает действующие правила сбоя с оставшимся числом запросов
+func (s *Server) Faults() []Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	faults := make([]Fault, len(s.faults))
+	for i, fault := range s.faults {
+		faults[i] = *fault
+	}
+	return faults
+}
+
+// ClearFaults удаляет все правила сбоя
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Режим сбоя для операции; пусто, если сбоя нет. Правило с ограниченным числом
+// запросов удаляется, когда запросы исчерпаны.
+func (s *Server) fault(service, operation string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, fault := range s.faults {
+		if fault.Service != service || (fault.Operation != "" && fault.Operation != operation) {
+			continue
+		}
+		if fault.Count > 0 {
+			fault.Count--
+			if fault.Count == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		s.logger.Printf("Сбой %s.%s: %s", service, operation, fault.Mode)
+		return fault.Mode
+	}
+	return ""
+}
+
+// Ответ в режимах сбоя timeout, throttle и error. Возвращает false для режима reject
+// и при отсутствии сбоя: отказ по существу формирует обработчик операции.
+func (s *Server) failTransport(ctx context.Context, w http.ResponseWriter, mode string) bool {
+	switch mode {
+	case FaultTimeout:
+		select {
+		case <-ctx.Done():
+		case <-time.After(s.cfg.TimeoutDelay):
+		}
+		http.Error(w, "Превышено время ожидания ответа", http.StatusGatewayTimeout)
+	case FaultThrottle:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Превышен лимит запросов", http.StatusTooManyRequests)
+	case FaultError:
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+	default:
+		return false
+	}
+	return true
+}
+
+// Управление правилами сбоя: GET - список, POST - добавление правила, DELETE - удаление всех правил
+func (s *Server) faultsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var fault Fault
+			if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+				http.Error(w, "Некорректное правило: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := s.AddFault(fault); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			s.ClearFaults()
+		default:
+			http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"faults": s.Faults()})
+	}
+}
+
+// Очередной идентификатор объекта песочницы с префиксом
+func (s *Server) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s-%06d", prefix, s.seq)
+}
+
+// Алфавит серийных номеров кодов маркировки
+const serialAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Новый код маркировки GTIN в формате GS1: 01 + GTIN + 21 + серийный номер
+func newCode(gtin string) string {
+	serial := make([]byte, 13)
+	for i := range serial {
+		n, _ := rand.Int(rand.Reader, big.NewInt(int64(len(serialAlphabet))))
+		serial[i] = serialAlphabet[n.Int64()]
+	}
+	return "01" + gtin + "21" + string(serial)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,245 @@
+package sandbox
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/keystore"
+	"project-znak/internal/oms"
+	"project-znak/internal/robokassa"
+)
+
+func newTestSandbox(t *testing.T, cfg Config) (*Server, string) {
+	sb := New(cfg, log.New(io.Discard, "", 0))
+	server := httptest.NewServer(sb.Handler())
+	t.Cleanup(server.Close)
+	return sb, server.URL
+}
+
+// Хранилище с ключом ECDSA и самоподписанным сертификатом во временном каталоге
+func testKeystore(t *testing.T) keystore.Keystore {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	keyPath, certPath := filepath.Join(dir, "key.pem"), filepath.Join(dir, "cert.pem")
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o600)
+	keys, err := keystore.OpenPEM(keyPath, certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestParseFault(t *testing.T) {
+	fault, err := ParseFault("chestnyznak.kizs=throttle*3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fault != (Fault{Service: ServiceChestnyZnak, Operation: "kizs", Mode: FaultThrottle, Count: 3}) {
+		t.Errorf("Неверное правило: %+v", fault)
+	}
+
+	fault, err = ParseFault("oms=error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fault != (Fault{Service: ServiceOMS, Mode: FaultError}) {
+		t.Errorf("Неверное правило без операции и числа: %+v", fault)
+	}
+
+	for _, spec := range []string{"oms", "edo=error", "oms=slow", "oms=error*x"} {
+		if _, err := ParseFault(spec); err == nil {
+			t.Errorf("Правило %q должно быть отклонено", spec)
+		}
+	}
+}
+
+func TestChestnyZnakDocuments(t *testing.T) {
+	sb, url := newTestSandbox(t, Config{})
+	client := chestnyznak.NewClient(url+"/chestnyznak", testKeystore(t), 5*time.Second, nil)
+	ctx := context.Background()
+
+	sb.AddFault(Fault{Service: ServiceChestnyZnak, Operation: "kizs", Mode: FaultThrottle, Count: 1})
+	_, err := client.RequestKIZs(ctx, "7707083893", "milk", []chestnyznak.GTINData{{GTIN: "04601234567893", Count: 2}})
+	var apiErr *chestnyznak.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Permanent() {
+		t.Fatalf("Ожидалась временная ошибка 429, получено: %v", err)
+	}
+	if len(sb.Faults()) != 0 {
+		t.Errorf("Правило с исчерпанным числом запросов должно быть удалено: %+v", sb.Faults())
+	}
+
+	codes, err := client.RequestKIZs(ctx, "7707083893", "milk", []chestnyznak.GTINData{{GTIN: "04601234567893", Count: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 2 || !strings.HasPrefix(codes[0], "010460123456789321") {
+		t.Fatalf("Неверные коды: %v", codes)
+	}
+
+	documentID, err := client.SubmitDocument(ctx, "milk", chestnyznak.IntroductionDocument{
+		DocumentType:   chestnyznak.DocumentTypeIntroduceGoods,
+		ParticipantINN: "7707083893",
+		Products:       []chestnyznak.DocumentProduct{{UIT: codes[0]}, {UIT: codes[1]}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := client.DocumentStatus(ctx, "milk", documentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != chestnyznak.DocumentStateCheckedOK || status.Ticket == "" {
+		t.Errorf("Документ должен быть принят: %+v", status)
+	}
+	receipt, err := client.DocumentReceipt(ctx, "milk", documentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.ContentType != "application/xml" || !strings.Contains(string(receipt.Content), status.Ticket) {
+		t.Errorf("Квитанция должна содержать идентификатор %s: %s", status.Ticket, receipt.Content)
+	}
+	info, err := client.CodesInfo(ctx, codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info) != 2 || info[0].Status != chestnyznak.CodeStatusIntroduced {
+		t.Errorf("Коды должны быть введены в оборот: %+v", info)
+	}
+
+	sb.AddFault(Fault{Service: ServiceChestnyZnak, Operation: "documents", Mode: FaultReject, Count: 1})
+	documentID, err = client.SubmitDocument(ctx, "milk", chestnyznak.RetirementDocument{
+		DocumentType:   chestnyznak.DocumentTypeRetirement,
+		ParticipantINN: "7707083893",
+		Codes:          codes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err = client.DocumentStatus(ctx, "milk", documentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != chestnyznak.DocumentStateCheckedErr || len(status.Errors) == 0 {
+		t.Errorf("Документ должен быть отклонен: %+v", status)
+	}
+
+	sb.AddFault(Fault{Service: ServiceChestnyZnak, Operation: "kizs", Mode: FaultReject})
+	_, err = client.RequestKIZs(ctx, "7707083893", "milk", []chestnyznak.GTINData{{GTIN: "04601234567893", Count: 1}})
+	if !errors.As(err, &apiErr) || !apiErr.Permanent() {
+		t.Errorf("Ожидался отказ по существу, получено: %v", err)
+	}
+}
+
+func TestChestnyZnakSignature(t *testing.T) {
+	_, url := newTestSandbox(t, Config{})
+	req, _ := http.NewRequest(http.MethodPost, url+"/chestnyznak/kizs", strings.NewReader(`{}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Запрос без подписи должен быть отклонен, получен код %d", resp.StatusCode)
+	}
+}
+
+func TestOMSEmitCodes(t *testing.T) {
+	sb, url := newTestSandbox(t, Config{})
+	client := oms.NewClient(url+"/oms", "oms-1", map[string]oms.ProductGroup{"milk": {ClientToken: "token"}}, nil, 5*time.Second, nil)
+	ctx := context.Background()
+
+	codes, err := client.EmitCodes(ctx, "milk", []oms.OrderProduct{{GTIN: "04601234567893", Quantity: 3}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 3 {
+		t.Fatalf("Ожидалось 3 кода, получено %d", len(codes))
+	}
+	if _, ok := sb.codes[codes[0]]; !ok {
+		t.Error("Коды СУЗ должны быть известны Честному ЗНАКу")
+	}
+
+	sb.AddFault(Fault{Service: ServiceOMS, Operation: "order", Mode: FaultReject, Count: 1})
+	_, err = client.EmitCodes(ctx, "milk", []oms.OrderProduct{{GTIN: "04601234567893", Quantity: 1}}, nil)
+	if !errors.Is(err, oms.ErrRejected) {
+		t.Errorf("Ожидался отказ СУЗ, получено: %v", err)
+	}
+}
+
+func TestRobokassaPayment(t *testing.T) {
+	const password2 = "secret2"
+	var verified bool
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		params := map[string]string{"Shp_TransactionId": r.FormValue("Shp_TransactionId")}
+		verified = robokassa.VerifyResult(r.FormValue("SignatureValue"), r.FormValue("OutSum"), r.FormValue("InvId"), password2, params)
+		io.WriteString(w, "OK"+r.FormValue("InvId"))
+	}))
+	defer service.Close()
+
+	sb, url := newTestSandbox(t, Config{ResultURL: service.URL, Password2: password2})
+	client := robokassa.NewClient(url+"/robokassa", "shop", "secret1", 5*time.Second)
+	ctx := context.Background()
+
+	if _, err := client.OpState(ctx, 1); !errors.Is(err, robokassa.ErrNotFound) {
+		t.Errorf("Счет без перехода к оплате не должен быть найден: %v", err)
+	}
+
+	resp, err := http.Get(url + "/robokassa/Merchant/Index.aspx?MerchantLogin=shop&OutSum=150.00&InvId=1&SignatureValue=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !verified {
+		t.Error("Подпись уведомления ResultURL должна проверяться паролем #2")
+	}
+
+	operation, err := client.OpState(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if operation.State != robokassa.StateCompleted || operation.OutSum.String() != "150.00" {
+		t.Errorf("Неверное состояние оплаты: %+v", operation)
+	}
+
+	sb.AddFault(Fault{Service: ServiceRobokassa, Operation: "opstate", Mode: FaultError, Count: 1})
+	if _, err := client.OpState(ctx, 1); err == nil {
+		t.Error("Ожидалась ошибка OpState по правилу сбоя")
+	}
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"project-znak/internal/repository"
+)
+
+// ListAudit возвращает записи журнала аудита по фильтру
+func (s *Service) ListAudit(ctx context.Context, filter repository.AuditFilter) ([]repository.AuditEntry, error) {
+	entries, err := s.repo.ListAudit(ctx, filter)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса журнала аудита: %w", err))
+	}
+	return entries, nil
+}
+
+// DBStats возвращает метрики пулов соединений с БД: основного и реплики, если она подключена
+func (s *Service) DBStats() []repository.PoolStats {
+	return s.repo.PoolStats()
+}
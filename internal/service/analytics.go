@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"project-znak/internal/repository"
+)
+
+// Ограничения запроса аналитики
+const (
+	analyticsDefaultDays = 30
+	analyticsMaxDays     = 366
+	analyticsDefaultTop  = 10
+)
+
+// AnalyticsRequest - период аналитики в днях (включительно) и шаг временных рядов.
+// По умолчанию - последние 30 дней с шагом в день.
+type AnalyticsRequest struct {
+	From     string `json:"from" validate:"date"`
+	To       string `json:"to" validate:"date"`
+	Interval string `json:"interval" validate:"oneof=day week month"`
+	Top      int    `json:"top" validate:"max=100"`
+}
+
+// Analytics возвращает выручку, выданные коды и маржу по товарным группам, рейтинг пользователей,
+// долю ошибок и время обработки операций с Честным ЗНАКом за период
+func (s *Service) Analytics(ctx context.Context, request AnalyticsRequest) (*repository.Analytics, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if request.To != "" {
+		to, _ = time.ParseInLocation(documentDateLayout, request.To, time.Local)
+	}
+	from := to.AddDate(0, 0, 1-analyticsDefaultDays)
+	if request.From != "" {
+		from, _ = time.ParseInLocation(documentDateLayout, request.From, time.Local)
+	}
+	if from.After(to) {
+		return nil, NewError(KindInvalid, "Начало периода позже его окончания", nil)
+	}
+	if to.Sub(from) >= analyticsMaxDays*24*time.Hour {
+		return nil, NewError(KindInvalid, fmt.Sprintf("Период аналитики не может превышать %d дней", analyticsMaxDays), nil)
+	}
+
+	filter := repository.AnalyticsFilter{
+		From:         from,
+		To:           to.AddDate(0, 0, 1),
+		Interval:     request.Interval,
+		Top:          request.Top,
+		Materialized: s.analyticsMaterialized,
+	}
+	if filter.Interval == "" {
+		filter.Interval = "day"
+	}
+	if filter.Top <= 0 {
+		filter.Top = analyticsDefaultTop
+	}
+
+	// Запросы по исходным таблицам тяжелые, поэтому результат недолго кэшируется
+	cacheKey := fmt.Sprintf("analytics:%s:%s:%s:%d", from.Format(documentDateLayout), to.Format(documentDateLayout),
+		filter.Interval, filter.Top)
+	var analytics repository.Analytics
+	if s.cache.Get(ctx, cacheKey, &analytics) {
+		return &analytics, nil
+	}
+
+	result, err := s.repo.Analytics(ctx, filter)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", err)
+	}
+	s.cache.Set(ctx, cacheKey, result, analyticsCacheTTL)
+	return result, nil
+}
+
+// RunAnalyticsRefresh обновляет материализованные представления аналитики раз в interval
+func (s *Service) RunAnalyticsRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			if err := s.repo.RefreshAnalyticsViews(ctx); err != nil {
+				s.logger.Printf("Ошибка обновления аналитики: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// Число объявлений в списке администратора
+const announcementListLimit = 100
+
+// AnnouncementRequest - запрос на создание объявления
+type AnnouncementRequest struct {
+	Title     string     `json:"title" validate:"required,max=200"`
+	Text      string     `json:"text" validate:"required,max=3000"`
+	Level     string     `json:"level,omitempty" validate:"oneof=info warning critical"` // По умолчанию info
+	StartsAt  *time.Time `json:"starts_at,omitempty"`                                    // По умолчанию - сразу
+	EndsAt    *time.Time `json:"ends_at,omitempty"`                                      // Без даты - до снятия
+	Broadcast bool       `json:"broadcast,omitempty"`                                    // Разослать в Telegram
+}
+
+// CreateAnnouncement создает объявление. С broadcast объявление с начала его действия
+// рассылается в Telegram пользователям, согласившимся на рассылку объявлений.
+func (s *Service) CreateAnnouncement(ctx context.Context, actor Actor, request AnnouncementRequest) (*models.Announcement, error) {
+	request.Title = strings.TrimSpace(request.Title)
+	request.Text = strings.TrimSpace(request.Text)
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	announcement := &models.Announcement{
+		Title:     request.Title,
+		Text:      request.Text,
+		Level:     request.Level,
+		StartsAt:  time.Now(),
+		EndsAt:    request.EndsAt,
+		Broadcast: request.Broadcast,
+		CreatedBy: actor.UserID,
+	}
+	if announcement.Level == "" {
+		announcement.Level = models.AnnouncementLevelInfo
+	}
+	if request.StartsAt != nil {
+		announcement.StartsAt = *request.StartsAt
+	}
+	if announcement.EndsAt != nil && !announcement.EndsAt.After(announcement.StartsAt) {
+		return nil, NewError(KindInvalid, "Дата окончания объявления должна быть позже даты начала", nil)
+	}
+
+	if err := s.repo.CreateAnnouncement(ctx, announcement); err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "announcement", announcement.ID, nil, announcement)
+	return announcement, nil
+}
+
+// ListAnnouncements возвращает последние объявления, включая завершенные и запланированные
+func (s *Service) ListAnnouncements(ctx context.Context) ([]models.Announcement, error) {
+	announcements, err := s.repo.Announcements(ctx, announcementListLimit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса объявлений: %w", err))
+	}
+	return announcements, nil
+}
+
+// ActiveAnnouncements возвращает действующие объявления для показа в клиентах
+func (s *Service) ActiveAnnouncements(ctx context.Context) ([]models.Announcement, error) {
+	announcements, err := s.repo.ActiveAnnouncements(ctx, time.Now())
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса объявлений: %w", err))
+	}
+	return announcements, nil
+}
+
+// EndAnnouncement снимает объявление и останавливает его рассылку. Сообщения, уже
+// поставленные в очередь, доставляются.
+func (s *Service) EndAnnouncement(ctx context.Context, actor Actor, id int) (*models.Announcement, error) {
+	announcement, err := s.repo.EndAnnouncement(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Действующее объявление не найдено", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка снятия объявления: %w", err))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionDelete, "announcement", id, nil, map[string]any{"ends_at": announcement.EndsAt})
+	return announcement, nil
+}
+
+// Текст объявления в Telegram
+func announcementMessage(announcement models.Announcement) string {
+	return announcement.Title + "\n\n" + announcement.Text
+}
+
+// BroadcastAnnouncements ставит в outbox очередную порцию рассылки каждого действующего
+// объявления: не более batch сообщений на объявление. Возвращает число поставленных сообщений.
+func (s *Service) BroadcastAnnouncements(ctx context.Context, batch int) int {
+	if !s.telegram.Enabled() {
+		return 0
+	}
+
+	announcements, err := s.repo.PendingAnnouncementBroadcasts(ctx, time.Now())
+	if err != nil {
+		s.logger.Printf("Ошибка получения объявлений для рассылки: %v", err)
+		return 0
+	}
+
+	queued := 0
+	for _, announcement := range announcements {
+		text := announcementMessage(announcement)
+		n, err := s.repo.EnqueueAnnouncementBroadcast(ctx, announcement.ID, batch,
+			func(userIDs []int) ([]models.OutboxMessage, error) {
+				b := s.outbox()
+				for _, userID := range userIDs {
+					b.telegram(userID, text)
+				}
+				return b.build()
+			})
+		if err != nil {
+			s.logger.Printf("Ошибка рассылки объявления %d: %v", announcement.ID, err)
+			continue
+		}
+		queued += n
+	}
+	return queued
+}
+
+// RunAnnouncementBroadcast рассылает объявления порциями по batch сообщений с указанным
+// интервалом до отмены контекста. Порции ограничивают нагрузку на Telegram и не задерживают
+// в outbox остальные уведомления.
+func (s *Service) RunAnnouncementBroadcast(ctx context.Context, interval time.Duration, batch int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			if queued := s.BroadcastAnnouncements(ctx, batch); queued > 0 {
+				s.logger.Printf("Поставлено в очередь сообщений с объявлениями: %d", queued)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
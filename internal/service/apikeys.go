@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+const (
+	// DefaultAPIKeyRotationOverlap - время, в течение которого прежний ключ действует после ротации, если не указано иное
+	DefaultAPIKeyRotationOverlap = 24 * time.Hour
+	// MaxAPIKeyRotationOverlap - максимальное время действия прежнего ключа после ротации
+	MaxAPIKeyRotationOverlap = 30 * 24 * time.Hour
+	// Число символов ключа, сохраняемых для его опознания в списке
+	apiKeyPrefixLength = 8
+)
+
+// APIKeyCreateRequest - запрос на создание API ключа
+type APIKeyCreateRequest struct {
+	Label     string `json:"label" validate:"max=100"`                 // Название ключа, не больше 100 символов
+	ExpiresIn string `json:"expires_in,omitempty" validate:"duration"` // Срок действия, например "720h"; пусто - бессрочный
+}
+
+// APIKeyRotation - результат ротации API ключа
+type APIKeyRotation struct {
+	Previous models.APIKey  // Прежний ключ с новым сроком действия
+	Key      *models.APIKey // Новый ключ
+	APIKey   string         // Значение нового ключа
+}
+
+// Генерация значения API ключа
+func generateAPIKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", b), nil
+}
+
+// Хэш API ключа, под которым ключ хранится в БД
+func hashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// Ключ кэша для API ключа; сам ключ в Redis не хранится
+func apiKeyCacheKey(keyHash string) string {
+	return "apikey:" + keyHash
+}
+
+// Новый API ключ без сохранения в БД
+func newAPIKey(userID int, label string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	apiKey, err := generateAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("ошибка генерации API ключа: %w", err)
+	}
+	return &models.APIKey{
+		UserID:    userID,
+		Prefix:    apiKey[:apiKeyPrefixLength],
+		Label:     label,
+		ExpiresAt: expiresAt,
+	}, apiKey, nil
+}
+
+// Создание нового API ключа пользователя. Ключ возвращается один раз,
+// в БД сохраняются только его хэш и префикс.
+func (s *Service) issueAPIKey(ctx context.Context, userID int, label string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	key, apiKey, err := newAPIKey(userID, label, expiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.repo.CreateAPIKey(ctx, key, hashAPIKey(apiKey)); err != nil {
+		return nil, "", err
+	}
+	return key, apiKey, nil
+}
+
+// ClientInfo - адрес и User-Agent клиента, использующего API ключ
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// AuthenticateAPIKey возвращает ID владельца API ключа и ID ключа с обновлением времени
+// последнего использования ключа, устройства клиента и активности пользователя. Возвращает
+// нули, если ключ недействителен, отозван или истек, и ошибку, если адрес клиента
+// заблокирован после многократного ввода неверных ключей.
+func (s *Service) AuthenticateAPIKey(ctx context.Context, apiKey string, client ClientInfo) (userID, keyID int, err error) {
+	var key repository.ActiveAPIKey
+	keyHash := hashAPIKey(apiKey)
+	cacheKey := apiKeyCacheKey(keyHash)
+	if !s.cache.Get(ctx, cacheKey, &key) {
+		// Ключ из кэша уже проверен, блокировка проверяется только перед запросом к БД
+		if err := s.checkAuthLock(ctx, models.AuthScopeAPIKey, client.IP); err != nil {
+			return 0, 0, err
+		}
+		found, err := s.repo.ActiveAPIKeyByHash(ctx, keyHash)
+		if errors.Is(err, repository.ErrNotFound) {
+			return 0, 0, s.recordAuthAttempt(ctx, models.AuthScopeAPIKey, client.IP, s.authGuard.MaxFailures)
+		} else if err != nil {
+			s.logger.Printf("Ошибка проверки API ключа: %v", err)
+			return 0, 0, nil
+		}
+		key = *found
+		s.cache.Set(ctx, cacheKey, key, apiKeyCacheTTL)
+	}
+
+	// Ключ из кэша мог истечь после сохранения в кэш
+	if key.ExpiresAt != nil && !time.Now().Before(*key.ExpiresAt) {
+		s.cache.Delete(ctx, cacheKey)
+		return 0, 0, nil
+	}
+
+	// Обновление времени использования, при наличии кэша - не чаще lastActiveInterval
+	// для каждого адреса клиента
+	if s.cache.SetOnce(ctx, fmt.Sprintf("apikey:%d:used:%s", key.ID, client.IP), lastActiveInterval) {
+		if err := s.repo.TouchAPIKey(ctx, key.ID, key.UserID, time.Now(), client.IP, client.UserAgent); err != nil {
+			s.logger.Print(err)
+		}
+	}
+
+	return key.UserID, key.ID, nil
+}
+
+// ListAPIKeys возвращает API ключи пользователя, включая отозванные и истекшие
+func (s *Service) ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	keys, err := s.repo.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения API ключей: %w", err))
+	}
+	return keys, nil
+}
+
+// CreateAPIKey создает API ключ пользователя. Значение ключа возвращается один раз.
+func (s *Service) CreateAPIKey(ctx context.Context, actor Actor, request APIKeyCreateRequest) (*models.APIKey, string, error) {
+	request.Label = strings.TrimSpace(request.Label)
+	if err := ValidateRequest(request); err != nil {
+		return nil, "", err
+	}
+
+	var expiresAt *time.Time
+	if request.ExpiresIn != "" {
+		expiresIn, _ := time.ParseDuration(request.ExpiresIn)
+		t := time.Now().Add(expiresIn)
+		expiresAt = &t
+	}
+
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, apiKey, err := s.issueAPIKey(ctx, userID, request.Label, expiresAt)
+	if err != nil {
+		return nil, "", NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка создания API ключа: %w", err))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "api_key", key.ID, nil, key)
+
+	return key, apiKey, nil
+}
+
+// RotateAPIKey создает новый ключ с тем же названием взамен действующего.
+// Прежний ключ действует еще overlap, чтобы клиенты успели перейти на новый.
+func (s *Service) RotateAPIKey(ctx context.Context, actor Actor, userID, keyID int, overlap time.Duration) (*APIKeyRotation, error) {
+	if overlap < 0 || overlap > MaxAPIKeyRotationOverlap {
+		return nil, NewError(KindInvalid, fmt.Sprintf("Некорректный период перекрытия, допускается от 0 до %v", MaxAPIKeyRotationOverlap), nil)
+	}
+
+	if err := s.requireConfirmation(ctx, userID, models.ConfirmationActionAPIKeyRotate, fmt.Sprintf("api_key:%d:%v", keyID, overlap),
+		fmt.Sprintf("ротация API ключа №%d, прежний ключ действует еще %v", keyID, overlap)); err != nil {
+		return nil, err
+	}
+
+	next, apiKey, err := newAPIKey(userID, "", nil)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", err)
+	}
+
+	rotation, err := s.repo.RotateAPIKey(ctx, userID, keyID, overlap, next, hashAPIKey(apiKey))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Ключ не найден", nil)
+	} else if errors.Is(err, repository.ErrAPIKeyInactive) {
+		return nil, NewError(KindConflict, "Ключ отозван или истек", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка ротации API ключа: %w", err))
+	}
+
+	// Закэшированный прежний ключ должен получить новый срок действия
+	s.cache.Delete(ctx, apiKeyCacheKey(rotation.PreviousHash))
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "api_key", rotation.Previous.ID, nil, map[string]any{
+		"expires_at": rotation.Previous.ExpiresAt,
+		"rotated_to": rotation.Key.ID,
+	})
+	s.recordAudit(ctx, actor, AuditActionCreate, "api_key", rotation.Key.ID, nil, rotation.Key)
+
+	return &APIKeyRotation{Previous: rotation.Previous, Key: rotation.Key, APIKey: apiKey}, nil
+}
+
+// RevokeAPIKey отзывает API ключ; отозванный ключ перестает действовать сразу
+func (s *Service) RevokeAPIKey(ctx context.Context, actor Actor, userID, keyID int) (*models.APIKey, error) {
+	key, keyHash, err := s.repo.RevokeAPIKey(ctx, userID, keyID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Ключ не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка отзыва API ключа: %w", err))
+	}
+
+	s.cache.Delete(ctx, apiKeyCacheKey(keyHash))
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "api_key", key.ID, nil, map[string]any{
+		"revoked_at": key.RevokedAt,
+	})
+
+	return key, nil
+}
+
+// AuthenticateTelegramID определяет пользователя запроса без API ключа по telegram_id.
+// Неизвестный telegram_id учитывается как неудачная попытка, как и неверный API ключ:
+// перебор telegram_id с одного адреса приводит к блокировке адреса. Возвращает 0, если
+// пользователь не найден.
+func (s *Service) AuthenticateTelegramID(ctx context.Context, telegramID int64, client ClientInfo) (int, error) {
+	if err := s.checkAuthLock(ctx, models.AuthScopeTelegramID, client.IP); err != nil {
+		return 0, err
+	}
+	userID, err := s.UserIDByTelegram(ctx, telegramID)
+	if err != nil {
+		return 0, err
+	}
+	if userID == 0 {
+		return 0, s.recordAuthAttempt(ctx, models.AuthScopeTelegramID, client.IP, s.authGuard.MaxFailures)
+	}
+	return userID, nil
+}
+
+// ListSessions возвращает сеансы пользователя - действующие API ключи с устройством,
+// с которого ключ использовался последним. currentKeyID - ключ текущего запроса.
+func (s *Service) ListSessions(ctx context.Context, userID, currentKeyID int) ([]models.Session, error) {
+	sessions, err := s.repo.Sessions(ctx, userID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения сеансов: %w", err))
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentKeyID
+	}
+	return sessions, nil
+}
+
+// RevokeOtherSessions отзывает все действующие API ключи пользователя, кроме ключа
+// текущего запроса, и возвращает число отозванных ключей
+func (s *Service) RevokeOtherSessions(ctx context.Context, actor Actor, userID, currentKeyID int) (int, error) {
+	if currentKeyID == 0 {
+		return 0, NewError(KindInvalid, "Не указан API ключ текущего сеанса", nil)
+	}
+	now := time.Now()
+	keyIDs, keyHashes, err := s.repo.RevokeOtherAPIKeys(ctx, userID, currentKeyID, now)
+	if err != nil {
+		return 0, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка отзыва API ключей: %w", err))
+	}
+
+	for _, keyHash := range keyHashes {
+		s.cache.Delete(ctx, apiKeyCacheKey(keyHash))
+	}
+	for _, keyID := range keyIDs {
+		s.recordAudit(ctx, actor, AuditActionUpdate, "api_key", keyID, nil, map[string]any{
+			"revoked_at": now,
+		})
+	}
+	return len(keyIDs), nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// Адрес клиента, который не блокируется защитой от подбора
+func (s *Service) authTrusted(ip string) bool {
+	return ip == "" || slices.Contains(s.authGuard.TrustedIPs, ip)
+}
+
+// Срок очередной блокировки: Lockout, удваиваемый с каждой блокировкой подряд, но не больше MaxLockout
+func (s *Service) authLockoutDuration(lockouts int) time.Duration {
+	duration := s.authGuard.Lockout
+	for i := 1; i < lockouts && duration < s.authGuard.MaxLockout; i++ {
+		duration *= 2
+	}
+	return min(duration, s.authGuard.MaxLockout)
+}
+
+// Ошибка для заблокированного адреса
+func authLockedError(lockedUntil time.Time) error {
+	return &Error{
+		Kind:       KindTooManyRequests,
+		Code:       ErrorCodeTooManyAttempts,
+		Message:    "Слишком много неудачных попыток, повторите позже",
+		RetryAfter: time.Until(lockedUntil),
+	}
+}
+
+// Проверка блокировки адреса клиента. Ошибка БД не блокирует клиента и только
+// записывается в журнал.
+func (s *Service) checkAuthLock(ctx context.Context, scope, ip string) error {
+	if s.authTrusted(ip) {
+		return nil
+	}
+	lockedUntil, err := s.repo.AuthLockedUntil(ctx, scope, ip, time.Now())
+	if err != nil {
+		s.logger.Printf("Ошибка проверки блокировки адреса %s: %v", ip, err)
+		return nil
+	}
+	if lockedUntil != nil {
+		return authLockedError(*lockedUntil)
+	}
+	return nil
+}
+
+// Учет неудачной попытки авторизации или регистрации с адреса клиента. После limit попыток за окно AUTH_FAILURE_WINDOW адрес
+// блокируется; блокировка записывается в журнал аудита, и возвращается ошибка блокировки.
+// Счетчик блокировок сбрасывается, если с окончания последней прошло больше MaxLockout.
+func (s *Service) recordAuthAttempt(ctx context.Context, scope, ip string, limit int) error {
+	if s.authTrusted(ip) {
+		return nil
+	}
+
+	now := time.Now()
+	locked := false
+	failure, err := s.repo.UpdateAuthFailure(ctx, scope, ip, now, func(f *models.AuthFailure) {
+		if f.LockedUntil != nil && now.Sub(*f.LockedUntil) > s.authGuard.MaxLockout {
+			f.Lockouts = 0
+		}
+		if now.Sub(f.WindowStart) >= s.authGuard.Window {
+			f.Failures = 0
+			f.WindowStart = now
+		}
+		f.Failures++
+		if f.Failures < limit {
+			return
+		}
+
+		f.Lockouts++
+		lockedUntil := now.Add(s.authLockoutDuration(f.Lockouts))
+		f.LockedUntil = &lockedUntil
+		f.Failures = 0
+		f.WindowStart = now
+		locked = true
+	})
+	if err != nil {
+		s.logger.Printf("Ошибка учета неудачной попытки с адреса %s: %v", ip, err)
+		return nil
+	}
+	if !locked {
+		return nil
+	}
+
+	s.logger.Printf("Адрес %s заблокирован до %s (%s, блокировка №%d)",
+		ip, failure.LockedUntil.Format(time.RFC3339), scope, failure.Lockouts)
+	s.recordAudit(ctx, Actor{IP: ip}, AuditActionCreate, "auth_lockout", ip, nil, failure)
+	return authLockedError(*failure.LockedUntil)
+}
+
+// AuthLockouts возвращает адреса, заблокированные защитой от подбора
+func (s *Service) AuthLockouts(ctx context.Context) ([]models.AuthFailure, error) {
+	lockouts, err := s.repo.AuthLockouts(ctx, time.Now())
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса блокировок: %w", err))
+	}
+	return lockouts, nil
+}
+
+// Unlock снимает блокировку адреса и сбрасывает его счетчики попыток
+func (s *Service) Unlock(ctx context.Context, actor Actor, ip string) error {
+	if ip == "" {
+		return NewError(KindInvalid, "Не указан адрес", nil)
+	}
+
+	err := s.repo.DeleteAuthFailures(ctx, ip)
+	if errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Адрес не заблокирован", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка снятия блокировки: %w", err))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionDelete, "auth_lockout", ip, nil, nil)
+	return nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"project-znak/internal/config"
+)
+
+func TestAuthLockoutDuration(t *testing.T) {
+	s := &Service{authGuard: config.AuthGuardConfig{Lockout: time.Minute, MaxLockout: 5 * time.Minute}}
+	tests := []struct {
+		lockouts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := s.authLockoutDuration(tt.lockouts); got != tt.want {
+			t.Errorf("блокировка №%d: получено %v, ожидалось %v", tt.lockouts, got, tt.want)
+		}
+	}
+}
+
+func TestAuthTrusted(t *testing.T) {
+	s := &Service{authGuard: config.AuthGuardConfig{TrustedIPs: []string{"192.0.2.10"}}}
+	for ip, want := range map[string]bool{"": true, "192.0.2.10": true, "192.0.2.11": false} {
+		if got := s.authTrusted(ip); got != want {
+			t.Errorf("адрес %q: получено %v, ожидалось %v", ip, got, want)
+		}
+	}
+}
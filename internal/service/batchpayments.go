@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+	"project-znak/internal/repository"
+)
+
+// BatchPaymentRequest - запрос на создание пакетного платежа: партнер одним платежом
+// оплачивает заказы нескольких клиентов. Сумма платежа - сумма долей заказов. Заказы
+// оцениваются в рублях, поэтому пакетный платеж принимается только в рублях.
+type BatchPaymentRequest struct {
+	TelegramID     int64               `json:"telegram_id"`
+	Orders         []BatchPaymentOrder `json:"orders" validate:"required,max=100"`
+	OrganizationID int                 `json:"organization_id,omitempty"`
+	ReturnURL      string              `json:"return_url,omitempty"`
+}
+
+// BatchPaymentOrder - заказ пакетного платежа и оплачиваемая по нему сумма. Без суммы
+// оплачивается весь неоплаченный остаток заказа.
+type BatchPaymentOrder struct {
+	OrderID int          `json:"order_id" validate:"required,min=1"`
+	Amount  *money.Money `json:"amount,omitempty"`
+}
+
+// PaymentOrderRefund - запрос на возврат по заказу пакетного платежа. Без суммы
+// возвращается весь остаток по заказу.
+type PaymentOrderRefund struct {
+	Amount float64 `json:"amount,omitempty" validate:"min=0"`
+}
+
+// CreateBatchPayment создает один платеж на несколько заказов и формирует ссылку на оплату.
+// Все заказы должны быть доступны пользователю и не отменены, а доля каждого заказа - не
+// больше его неоплаченного остатка; без суммы оплачивается весь остаток. Платеж оплачивается
+// от имени выбранной организации пользователя. При проведении платежа сумма делится между
+// заказами в журнале платежей.
+func (s *Service) CreateBatchPayment(ctx context.Context, actor Actor, request BatchPaymentRequest) (*PaymentResult, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	userID, err := s.UserIDByTelegram(ctx, request.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+	if userID == 0 {
+		return nil, NewError(KindNotFound, "Пользователь не найден", nil)
+	}
+
+	orders := make([]models.PaymentOrder, 0, len(request.Orders))
+	orderIDs := make([]int, 0, len(request.Orders))
+	total := money.New(0, money.RUB)
+	for _, item := range request.Orders {
+		for _, orderID := range orderIDs {
+			if orderID == item.OrderID {
+				return nil, NewError(KindInvalid, fmt.Sprintf("Заказ №%d указан в платеже дважды", item.OrderID), nil)
+			}
+		}
+
+		status, _, err := s.repo.AccessibleOrder(ctx, item.OrderID, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, NewError(KindNotFound, fmt.Sprintf("Заказ №%d не найден", item.OrderID), nil)
+		} else if err != nil {
+			return nil, fmt.Errorf("ошибка получения заказа: %w", err)
+		}
+		if status == models.OrderStatusCancelled {
+			return nil, NewError(KindConflict, fmt.Sprintf("Заказ №%d отменен", item.OrderID), nil)
+		}
+
+		balance, err := s.repo.OrderBalance(ctx, item.OrderID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения остатка заказа: %w", err)
+		}
+		amount := balance
+		if item.Amount != nil {
+			amount = *item.Amount
+		}
+		switch {
+		case !balance.IsPositive():
+			return nil, NewError(KindConflict, fmt.Sprintf("Заказ №%d уже оплачен", item.OrderID), nil)
+		case !amount.IsPositive():
+			return nil, NewError(KindInvalid, fmt.Sprintf("Сумма по заказу №%d должна быть больше нуля", item.OrderID), nil)
+		case amount.Minor > balance.Minor:
+			return nil, NewError(KindInvalid, fmt.Sprintf("Сумма по заказу №%d больше неоплаченного остатка: %s %s",
+				item.OrderID, balance, balance.Code()), nil)
+		}
+
+		orders = append(orders, models.PaymentOrder{OrderID: item.OrderID, Amount: amount, Refunded: money.New(0, money.RUB)})
+		orderIDs = append(orderIDs, item.OrderID)
+		total = total.Add(amount)
+	}
+
+	currency, route, err := s.paymentRoute(money.RUB, total.Float64(), userID, request.ReturnURL != "")
+	if err != nil {
+		return nil, err
+	}
+	provider := route[0]
+	if request.ReturnURL == "" {
+		request.ReturnURL = s.payment.StripeReturnURL
+	}
+
+	organizationID, err := s.organizationForOperation(ctx, userID, request.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PaymentResult{}
+	result.PaymentID, err = s.repo.CreateBatchPayment(ctx, userID, organizationID, orders, total, provider)
+	if errors.Is(err, repository.ErrPaymentExceedsBalance) {
+		return nil, NewError(KindConflict, "Заказ оплачен другим платежом", err)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка создания платежа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "payment", result.PaymentID, nil, map[string]any{
+		"amount":          total.String(),
+		"currency":        currency,
+		"provider":        provider,
+		"order_ids":       orderIDs,
+		"organization_id": organizationID,
+		"status":          models.PaymentStatusPending,
+	})
+
+	if result.RedirectURL, err = s.paymentRedirectURL(ctx, result.PaymentID, total, route, request.ReturnURL); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RefundPaymentOrder возвращает покупателю часть проведенного пакетного платежа Stripe,
+// приходящуюся на заказ orderID: сумму из запроса или весь остаток по заказу. Когда по всем
+// заказам платежа возвращено все, платеж отмечается возвращенным.
+func (s *Service) RefundPaymentOrder(ctx context.Context, actor Actor, paymentID, orderID int,
+	request PaymentOrderRefund) (*models.Payment, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	payment, err := s.repo.Payment(ctx, paymentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Платеж не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", err)
+	}
+	switch {
+	case payment.Provider != models.PaymentProviderStripe:
+		return nil, NewError(KindConflict, "Возврат поддерживается только для платежей Stripe", nil)
+	case payment.Status != models.PaymentStatusCompleted:
+		return nil, NewError(KindConflict, "Вернуть можно только проведенный платеж", nil)
+	case !s.stripe.Enabled():
+		return nil, NewError(KindUnavailable, "Прием платежей Stripe не настроен", nil)
+	}
+
+	if payment.Orders, err = s.repo.PaymentOrders(ctx, paymentID); err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", err)
+	}
+	var order *models.PaymentOrder
+	for i := range payment.Orders {
+		if payment.Orders[i].OrderID == orderID {
+			order = &payment.Orders[i]
+		}
+	}
+	if order == nil {
+		return nil, NewError(KindNotFound, fmt.Sprintf("Заказ №%d не оплачен этим платежом", orderID), nil)
+	}
+
+	currency := payment.Amount.Code()
+	remaining := order.Amount.Sub(order.Refunded)
+	amount := remaining
+	if request.Amount > 0 {
+		if amount, err = paymentAmount(request.Amount, currency); err != nil {
+			return nil, err
+		}
+	}
+	if !remaining.IsPositive() {
+		return nil, NewError(KindConflict, fmt.Sprintf("Сумма по заказу №%d уже возвращена", orderID), nil)
+	}
+	if amount.Minor > remaining.Minor {
+		return nil, NewError(KindInvalid, fmt.Sprintf("Сумма возврата больше остатка по заказу: %s %s", remaining, currency), nil)
+	}
+
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireConfirmation(ctx, userID, models.ConfirmationActionRefund,
+		fmt.Sprintf("payment:%d:order:%d:%s", paymentID, orderID, amount),
+		fmt.Sprintf("возврат по заказу №%d платежа №%d на сумму %s %s", orderID, paymentID, amount, currency)); err != nil {
+		return nil, err
+	}
+
+	// Ключ идемпотентности зависит от уже возвращенной суммы: повтор после сбоя записи в БД
+	// не возвращает сумму в Stripe повторно
+	key := fmt.Sprintf("order-%d-%d-%d", orderID, order.Refunded.Minor, amount.Minor)
+	if _, err := s.stripe.RefundPart(ctx, payment.TransactionID, amount, key); err != nil {
+		return nil, NewError(KindUnavailable, "Ошибка возврата платежа в Stripe", err)
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	refundedOrder, refunded, err := s.repo.RefundPaymentOrder(ctx, paymentID, orderID, amount, time.Now())
+	if errors.Is(err, repository.ErrConflict) || errors.Is(err, repository.ErrRefundExceedsBalance) {
+		s.logger.Printf("Возврат %s %s по заказу %d платежа %d проведен в Stripe, но не записан: %v",
+			amount, currency, orderID, paymentID, err)
+		return nil, NewError(KindConflict, "Платеж изменен другим запросом", err)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка обновления платежа", err)
+	}
+
+	before := map[string]string{"order_id": fmt.Sprint(orderID), "refunded": order.Refunded.String()}
+	after := map[string]string{"order_id": fmt.Sprint(orderID), "refunded": refundedOrder.Refunded.String()}
+	if refunded {
+		before["status"] = models.PaymentStatusCompleted
+		after["status"] = models.PaymentStatusRefunded
+		payment.Status = models.PaymentStatusRefunded
+		payment.Version++
+	}
+	s.recordAudit(ctx, actor, AuditActionUpdate, "payment", paymentID, before, after)
+
+	*order = *refundedOrder
+	return payment, nil
+}
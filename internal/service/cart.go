@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// Наибольшее число позиций корзины
+const cartMaxItems = 100
+
+// CartRequest - замена корзины целиком. Если организация не указана, заказ будет сделан
+// от имени организации пользователя по умолчанию.
+type CartRequest struct {
+	TelegramID     int64              `json:"telegram_id"`
+	OrganizationID int                `json:"organization_id,omitempty"`
+	ProductGroup   string             `json:"product_group,omitempty" validate:"product_group"`
+	Items          []OrderItemRequest `json:"items" validate:"max=100,dive"`
+}
+
+// CartItemRequest - добавление кодов в корзину: количество прибавляется к позиции
+// с тем же GTIN
+type CartItemRequest struct {
+	TelegramID int64  `json:"telegram_id"`
+	GTIN       string `json:"gtin" validate:"required,gtin"`
+	Quantity   int    `json:"quantity" validate:"required,min=1"`
+}
+
+// CheckoutResult - заказ, созданный из корзины, и платеж по нему. Если платеж создать
+// не удалось, заказ сохраняется и оплачивается отдельно, а причина передается в PaymentErr.
+type CheckoutResult struct {
+	Order       *models.Order
+	PaymentID   int
+	RedirectURL string
+	PaymentErr  error
+}
+
+// GetCart возвращает корзину пользователя с ценами по текущему тарифу; пустую,
+// если пользователь ничего не добавлял
+func (s *Service) GetCart(ctx context.Context, userID int) (*models.Cart, error) {
+	cart, err := s.loadCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.priceCart(ctx, cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// ReplaceCart заменяет организацию, товарную группу и позиции корзины
+func (s *Service) ReplaceCart(ctx context.Context, actor Actor, request CartRequest) (*models.Cart, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	return s.updateCart(ctx, actor, func(cart *models.Cart) error {
+		cart.OrganizationID = request.OrganizationID
+		cart.ProductGroup = request.ProductGroup
+		cart.Lines = nil
+		for _, item := range request.Items {
+			addCartLine(cart, item.GTIN, item.Quantity)
+		}
+		return nil
+	})
+}
+
+// AddCartItem добавляет коды товара в корзину
+func (s *Service) AddCartItem(ctx context.Context, actor Actor, request CartItemRequest) (*models.Cart, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	return s.updateCart(ctx, actor, func(cart *models.Cart) error {
+		addCartLine(cart, request.GTIN, request.Quantity)
+		return nil
+	})
+}
+
+// RemoveCartItem удаляет позицию корзины с указанным GTIN
+func (s *Service) RemoveCartItem(ctx context.Context, actor Actor, gtin string) (*models.Cart, error) {
+	gtin = models.NormalizeGTIN(gtin)
+	return s.updateCart(ctx, actor, func(cart *models.Cart) error {
+		for i, line := range cart.Lines {
+			if line.GTIN == gtin {
+				cart.Lines = append(cart.Lines[:i], cart.Lines[i+1:]...)
+				return nil
+			}
+		}
+		return NewError(KindNotFound, "Товара нет в корзине", nil)
+	})
+}
+
+// ClearCart удаляет все позиции корзины
+func (s *Service) ClearCart(ctx context.Context, actor Actor) error {
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteCart(ctx, userID); err != nil {
+		return NewError(KindInternal, "Ошибка очистки корзины", err)
+	}
+	return nil
+}
+
+// CartOrganizationID возвращает организацию, от имени которой будет сделан заказ по
+// корзине: выбранную в корзине или организацию пользователя по умолчанию
+func (s *Service) CartOrganizationID(ctx context.Context, userID int) (int, error) {
+	cart, err := s.repo.Cart(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return s.RequestOrganizationID(ctx, userID, 0)
+	} else if err != nil {
+		return 0, err
+	}
+	return s.RequestOrganizationID(ctx, userID, cart.OrganizationID)
+}
+
+// CheckoutCart создает заказ из корзины и платеж Robokassa на его сумму и очищает корзину.
+// Заказ на сумму от порога требует подтверждения, как CreateOrder; до подтверждения
+// корзина сохраняется.
+func (s *Service) CheckoutCart(ctx context.Context, actor Actor) (*CheckoutResult, error) {
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	cart, err := s.loadCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(cart.Lines) == 0 {
+		return nil, NewError(KindInvalid, "Корзина пуста", nil)
+	}
+
+	order, err := s.prepareOrder(ctx, userID, cartOrderRequest(cart))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.placeOrder(ctx, actor, order); err != nil {
+		return nil, err
+	}
+	if err := s.repo.DeleteCart(ctx, userID); err != nil {
+		s.logger.Printf("Ошибка очистки корзины пользователя %d после заказа %d: %v", userID, order.ID, err)
+	}
+
+	// Платеж создается, только если пользователю разрешено оплачивать заказы организации:
+	// оператор оформляет заказ, а оплачивает его бухгалтер
+	result := &CheckoutResult{Order: order}
+	if err := s.Authorize(ctx, userID, order.OrganizationID, models.PermPaymentsCreate); err != nil {
+		result.PaymentErr = err
+		return result, nil
+	}
+	telegramID := actor.TelegramID
+	if telegramID == 0 {
+		if telegramID, err = s.repo.UserTelegramID(ctx, userID); err != nil {
+			result.PaymentErr = NewError(KindInternal, "Ошибка создания платежа", fmt.Errorf("ошибка получения telegram_id: %w", err))
+			return result, nil
+		}
+	}
+	payment, err := s.CreatePayment(ctx, actor, PaymentRequest{
+		TelegramID: telegramID,
+		Amount:     order.TotalAmount,
+		OrderID:    order.ID,
+	})
+	if err != nil {
+		result.PaymentErr = err
+		return result, nil
+	}
+	result.PaymentID, result.RedirectURL = payment.PaymentID, payment.RedirectURL
+	return result, nil
+}
+
+// Сохраненная корзина пользователя; пустая, если ее нет
+func (s *Service) loadCart(ctx context.Context, userID int) (*models.Cart, error) {
+	cart, err := s.repo.Cart(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return &models.Cart{UserID: userID}, nil
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения корзины: %w", err))
+	}
+	return cart, nil
+}
+
+// Изменение корзины пользователя. Позиции проверяются и оцениваются до сохранения, как при
+// создании заказа, поэтому в корзину не попадают товары другой группы или не найденные
+// в Национальном каталоге. Корзина без позиций удаляется.
+func (s *Service) updateCart(ctx context.Context, actor Actor, change func(cart *models.Cart) error) (*models.Cart, error) {
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	cart, err := s.loadCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := change(cart); err != nil {
+		return nil, err
+	}
+	if len(cart.Lines) > cartMaxItems {
+		return nil, NewError(KindInvalid, fmt.Sprintf("В корзине может быть не больше %d позиций", cartMaxItems), nil)
+	}
+	if err := s.priceCart(ctx, cart); err != nil {
+		return nil, err
+	}
+
+	if len(cart.Lines) == 0 {
+		err = s.repo.DeleteCart(ctx, userID)
+		cart.UpdatedAt = nil
+	} else {
+		err = s.repo.SaveCart(ctx, cart)
+	}
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка сохранения корзины", err)
+	}
+	return cart, nil
+}
+
+// Расчет цен и итогов корзины по тарифу товарной группы
+func (s *Service) priceCart(ctx context.Context, cart *models.Cart) error {
+	cart.Items = []models.OrderItem{}
+	cart.TotalCodes, cart.TotalAmount = 0, 0
+	if len(cart.Lines) == 0 {
+		return nil
+	}
+
+	order, err := s.prepareOrder(ctx, cart.UserID, cartOrderRequest(cart))
+	if err != nil {
+		return err
+	}
+	cart.Items = order.Items
+	cart.TotalAmount = order.TotalAmount
+	for _, item := range order.Items {
+		cart.TotalCodes += item.Quantity
+	}
+	return nil
+}
+
+// Запрос на создание заказа с позициями корзины
+func cartOrderRequest(cart *models.Cart) OrderCreateRequest {
+	request := OrderCreateRequest{OrganizationID: cart.OrganizationID, ProductGroup: cart.ProductGroup}
+	for _, line := range cart.Lines {
+		request.Items = append(request.Items, OrderItemRequest{GTIN: line.GTIN, Quantity: line.Quantity})
+	}
+	return request
+}
+
+// Добавление кодов в позицию корзины с тем же GTIN или в новую позицию
+func addCartLine(cart *models.Cart, gtin string, quantity int) {
+	gtin = models.NormalizeGTIN(gtin)
+	for i := range cart.Lines {
+		if cart.Lines[i].GTIN == gtin {
+			cart.Lines[i].Quantity += quantity
+			return
+		}
+	}
+	cart.Lines = append(cart.Lines, models.OrderLine{GTIN: gtin, Quantity: quantity})
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"project-znak/internal/chestnyznak"
+)
+
+// Число дней до окончания действия сертификата ЭЦП, при достижении которого
+// администраторы получают предупреждение; по убыванию
+var certificateAlertDays = []int{30, 14, 3}
+
+// Ошибка обращения к Честному ЗНАКу для клиента. Истекший сертификат ЭЦП возвращается
+// с отдельным кодом: запрос можно повторить после замены сертификата.
+func chestnyZnakError(message string, err error) *Error {
+	if errors.Is(err, chestnyznak.ErrCertificateExpired) {
+		return &Error{
+			Kind:    KindUnavailable,
+			Code:    ErrorCodeCertificateExpired,
+			Message: "Срок действия сертификата ЭЦП истек, запросы в Честный ЗНАК временно невозможны",
+			Err:     err,
+		}
+	}
+	return NewError(KindInternal, message, err)
+}
+
+// CertificateExpiry возвращает дату окончания действия сертификата ЭЦП; false, если
+// ЭЦП не настроена
+func (s *Service) CertificateExpiry() (time.Time, bool) {
+	cert := s.chestnyZnak.Certificate()
+	if cert == nil {
+		return time.Time{}, false
+	}
+	return cert.NotAfter, true
+}
+
+// RunCertificateMonitor периодически проверяет срок действия сертификата ЭЦП до отмены
+// контекста. За 30, 14 и 3 дня до окончания срока и после его истечения предупреждение
+// записывается в журнал и отправляется в Telegram-чат администраторов, каждое - один раз
+// за время работы сервиса. Если ЭЦП не настроена, сразу завершается.
+func (s *Service) RunCertificateMonitor(ctx context.Context, interval time.Duration) {
+	if _, ok := s.CertificateExpiry(); !ok {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Наименьший порог, о котором уже отправлено предупреждение
+	alerted := math.MaxInt
+	for {
+		if s.IsLeader() {
+			alerted = s.checkCertificateExpiry(ctx, time.Now(), alerted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Проверка срока действия сертификата. Предупреждение отправляется, если достигнут порог
+// меньше alerted; возвращает новый наименьший порог. Истекшему сертификату соответствует порог 0.
+func (s *Service) checkCertificateExpiry(ctx context.Context, now time.Time, alerted int) int {
+	notAfter, ok := s.CertificateExpiry()
+	if !ok {
+		return alerted
+	}
+
+	threshold, reached := certificateThreshold(notAfter.Sub(now))
+	if !reached || threshold >= alerted {
+		return alerted
+	}
+
+	var text string
+	if threshold == 0 {
+		text = fmt.Sprintf("Срок действия сертификата ЭЦП для Честного ЗНАКа истек %s. "+
+			"Запросы кодов маркировки и отправка документов невозможны до замены сертификата.",
+			notAfter.Format("02.01.2006"))
+	} else {
+		text = fmt.Sprintf("Сертификат ЭЦП для Честного ЗНАКа действует до %s, осталось дней: %d. "+
+			"Замените сертификат до окончания срока.",
+			notAfter.Format("02.01.2006"), int(notAfter.Sub(now).Hours()/24))
+	}
+	s.logger.Printf("Предупреждение: %s", text)
+
+	if s.telegram.Enabled() && s.adminChatID != 0 {
+		if err := s.telegram.SendMessage(ctx, s.adminChatID, text); err != nil {
+			s.logger.Printf("Ошибка отправки предупреждения в чат администраторов: %v", err)
+			// Предупреждение будет отправлено при следующей проверке
+			return alerted
+		}
+	}
+	return threshold
+}
+
+// Порог предупреждения для оставшегося срока действия: наименьший из certificateAlertDays,
+// не меньший оставшегося числа дней, или 0 для истекшего сертификата
+func certificateThreshold(left time.Duration) (int, bool) {
+	if left <= 0 {
+		return 0, true
+	}
+	threshold, reached := 0, false
+	for _, days := range certificateAlertDays {
+		if left <= time.Duration(days)*24*time.Hour {
+			threshold, reached = days, true
+		}
+	}
+	return threshold, reached
+}
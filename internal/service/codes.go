@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/models"
+)
+
+// Наибольшее число кодов в одном запросе статуса
+const maxCodeStatusCodes = 100
+
+// CodeStatus - состояние кода маркировки по данным Честного ЗНАКа
+type CodeStatus struct {
+	chestnyznak.CodeInfo
+	CheckedAt time.Time `json:"checked_at" xml:"checked_at"` // Время получения сведений из Честного ЗНАКа
+}
+
+// Статусы Честного ЗНАКа, меняющие статус выданного кода
+var codeStatuses = map[string]string{
+	chestnyznak.CodeStatusIntroduced: models.KIZCodeStatusIntroduced,
+	chestnyznak.CodeStatusWrittenOff: models.KIZCodeStatusRetired,
+	chestnyznak.CodeStatusRetired:    models.KIZCodeStatusRetired,
+}
+
+// GetCodeStatus возвращает состояние кода маркировки, выданного по запросу пользователя
+// или его организаций
+func (s *Service) GetCodeStatus(ctx context.Context, userID int, code string) (*CodeStatus, error) {
+	statuses, err := s.CodeStatuses(ctx, userID, []string{code})
+	if err != nil {
+		return nil, err
+	}
+	if len(statuses) == 0 {
+		return nil, NewError(KindNotFound, "Код маркировки не найден среди выданных", nil)
+	}
+	return &statuses[0], nil
+}
+
+// CodeStatuses возвращает состояние кодов маркировки, выданных по запросам пользователя
+// или его организаций. Коды, не найденные среди выданных или в Честном ЗНАКе, в ответ
+// не включаются. Полученные статусы сохраняются для выданных кодов.
+func (s *Service) CodeStatuses(ctx context.Context, userID int, codes []string) ([]CodeStatus, error) {
+	if len(codes) == 0 {
+		return nil, NewError(KindInvalid, "Необходимо указать коды маркировки", nil)
+	}
+	if len(codes) > maxCodeStatusCodes {
+		return nil, NewError(KindInvalid, fmt.Sprintf("Можно запросить статус не более %d кодов за запрос", maxCodeStatusCodes), nil)
+	}
+
+	issued, err := s.repo.IssuedKIZCodes(ctx, userID, codes)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса кодов: %w", err))
+	}
+
+	statuses := make(map[string]CodeStatus, len(issued))
+	var uncached []models.KIZCode
+	for _, code := range issued {
+		var status CodeStatus
+		if s.cache.Get(ctx, codeStatusCacheKey(code.Code), &status) {
+			statuses[code.Code] = status
+			continue
+		}
+		uncached = append(uncached, code)
+	}
+
+	if len(uncached) > 0 {
+		fetched, err := s.fetchCodeStatuses(ctx, uncached)
+		if err != nil {
+			return nil, chestnyZnakError("Ошибка запроса статуса кодов в Честном ЗНАКе", err)
+		}
+		for _, status := range fetched {
+			statuses[status.CIS] = status
+			s.cache.Set(ctx, codeStatusCacheKey(status.CIS), status, codeStatusCacheTTL)
+		}
+		s.syncKIZCodeStatuses(ctx, uncached, fetched)
+	}
+
+	// Порядок ответа соответствует порядку запроса, повторяющиеся коды выводятся один раз
+	result := []CodeStatus{}
+	for _, code := range codes {
+		if status, ok := statuses[code]; ok {
+			result = append(result, status)
+			delete(statuses, code)
+		}
+	}
+	return result, nil
+}
+
+// Запрос сведений о кодах в Честном ЗНАКе. Без ЭЦП статус определяется по сохраненному
+// статусу выданного кода, как и тестовые коды при запросе КИЗ.
+func (s *Service) fetchCodeStatuses(ctx context.Context, codes []models.KIZCode) ([]CodeStatus, error) {
+	now := time.Now()
+	if !s.chestnyZnak.Enabled() {
+		statuses := make([]CodeStatus, len(codes))
+		for i, code := range codes {
+			status := chestnyznak.CodeStatusEmitted
+			switch code.Status {
+			case models.KIZCodeStatusIntroduced:
+				status = chestnyznak.CodeStatusIntroduced
+			case models.KIZCodeStatusRetired:
+				status = chestnyznak.CodeStatusRetired
+			}
+			statuses[i] = CodeStatus{
+				CodeInfo:  chestnyznak.CodeInfo{CIS: code.Code, GTIN: code.GTIN, Status: status},
+				CheckedAt: now,
+			}
+		}
+		return statuses, nil
+	}
+
+	cises := make([]string, len(codes))
+	for i, code := range codes {
+		cises[i] = code.Code
+	}
+	infos, err := s.chestnyZnak.CodesInfo(ctx, cises)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]CodeStatus, len(infos))
+	for i, info := range infos {
+		statuses[i] = CodeStatus{CodeInfo: info, CheckedAt: now}
+	}
+	return statuses, nil
+}
+
+// Сохранение статусов выданных кодов, изменившихся по данным Честного ЗНАКа
+func (s *Service) syncKIZCodeStatuses(ctx context.Context, issued []models.KIZCode, fetched []CodeStatus) {
+	current := make(map[string]string, len(issued))
+	for _, code := range issued {
+		current[code.Code] = code.Status
+	}
+
+	var codes, statuses []string
+	for _, status := range fetched {
+		local, ok := codeStatuses[status.Status]
+		if !ok || current[status.CIS] == local {
+			continue
+		}
+		if _, issued := current[status.CIS]; !issued {
+			continue
+		}
+		codes = append(codes, status.CIS)
+		statuses = append(statuses, local)
+	}
+	if len(codes) == 0 {
+		return
+	}
+	if err := s.repo.SetKIZCodeStatuses(ctx, codes, statuses); err != nil {
+		s.logger.Printf("Ошибка обновления статусов кодов маркировки: %v", err)
+	}
+}
+
+// Ключ кэша статуса кода маркировки
+func codeStatusCacheKey(code string) string {
+	return "cis:" + code
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/telegram"
+)
+
+// Число цифр кода подтверждения
+const confirmationCodeDigits = 6
+
+const confirmationKey contextKey = "confirmation"
+
+// ConfirmationToken - подтверждение, с которым клиент повторяет операцию: ID подтверждения
+// и код из Telegram. Код не нужен, если операция уже подтверждена кнопкой в боте.
+type ConfirmationToken struct {
+	ID   int
+	Code string
+}
+
+// ConfirmationCodeRequest - код подтверждения, введенный пользователем
+type ConfirmationCodeRequest struct {
+	TelegramID int64  `json:"telegram_id"`
+	Code       string `json:"code" validate:"required"`
+}
+
+// WithConfirmation сохраняет в контексте подтверждение, переданное клиентом с запросом
+func WithConfirmation(ctx context.Context, token ConfirmationToken) context.Context {
+	return context.WithValue(ctx, confirmationKey, token)
+}
+
+// Подтверждение, переданное клиентом с запросом; ID = 0, если его нет
+func confirmationFromContext(ctx context.Context) ConfirmationToken {
+	token, _ := ctx.Value(confirmationKey).(ConfirmationToken)
+	return token
+}
+
+// Генерация кода подтверждения из цифр
+func generateConfirmationCode() (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(confirmationCodeDigits), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", confirmationCodeDigits, n), nil
+}
+
+// Хэш кода подтверждения, под которым код хранится в БД
+func hashConfirmationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Подтверждение операции кодом из Telegram. Если клиент не передал подтверждение, создается
+// новое, пользователю отправляется код и возвращается ошибка KindConfirmationRequired.
+// Переданное подтверждение должно относиться к той же операции с теми же параметрами
+// (subject) и используется один раз. Без Telegram-бота подтверждение не запрашивается.
+func (s *Service) requireConfirmation(ctx context.Context, userID int, action, subject, description string) error {
+	if !s.telegram.Enabled() {
+		return nil
+	}
+
+	token := confirmationFromContext(ctx)
+	if token.ID == 0 {
+		return s.createConfirmation(ctx, userID, action, subject, description)
+	}
+
+	now := time.Now()
+	var checkErr error
+	confirmation, err := s.repo.UpdateConfirmation(ctx, token.ID, userID, func(c *models.Confirmation, codeHash string) {
+		if c.Action != action || c.Subject != subject {
+			checkErr = confirmationInvalid("Подтверждение выдано для другой операции")
+			return
+		}
+		if c.Status == models.ConfirmationStatusPending && token.Code != "" {
+			if checkErr = s.checkConfirmationCode(c, codeHash, token.Code, now); checkErr != nil {
+				return
+			}
+		}
+		if c.Status != models.ConfirmationStatusApproved || !now.Before(c.ExpiresAt) {
+			checkErr = confirmationStatusError(c, now)
+			return
+		}
+		c.Status = models.ConfirmationStatusUsed
+		c.UsedAt = &now
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return confirmationInvalid("Подтверждение не найдено")
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка проверки подтверждения: %w", err))
+	}
+	if checkErr != nil {
+		return checkErr
+	}
+
+	s.recordAudit(ctx, Actor{UserID: userID}, AuditActionUpdate, "confirmation", confirmation.ID,
+		map[string]string{"status": models.ConfirmationStatusApproved},
+		map[string]string{"status": models.ConfirmationStatusUsed})
+	return nil
+}
+
+// Создание подтверждения с отправкой кода в Telegram
+func (s *Service) createConfirmation(ctx context.Context, userID int, action, subject, description string) error {
+	code, err := generateConfirmationCode()
+	if err != nil {
+		return NewError(KindInternal, "Ошибка при обработке запроса", err)
+	}
+
+	confirmation := models.Confirmation{
+		UserID:      userID,
+		Action:      action,
+		Subject:     subject,
+		Description: description,
+		Status:      models.ConfirmationStatusPending,
+		ExpiresAt:   time.Now().Add(s.confirmation.TTL),
+	}
+	loc := s.UserLocation(ctx, userID)
+	err = s.repo.CreateConfirmation(ctx, &confirmation, hashConfirmationCode(code),
+		func(c *models.Confirmation) ([]models.OutboxMessage, error) {
+			return s.outbox().
+				telegram(userID, confirmationText(c, code, loc),
+					telegram.Button{Text: "Подтвердить", CallbackData: fmt.Sprintf("confirm:%d:%s", c.ID, code)},
+					telegram.Button{Text: "Отклонить", CallbackData: fmt.Sprintf("reject:%d:%s", c.ID, code)}).
+				build()
+		})
+	if err != nil {
+		return NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка создания подтверждения: %w", err))
+	}
+
+	return &Error{
+		Kind:         KindConfirmationRequired,
+		Message:      "Операцию необходимо подтвердить кодом, отправленным в Telegram",
+		Code:         ErrorCodeConfirmationRequired,
+		Confirmation: &confirmation,
+	}
+}
+
+// Текст сообщения с кодом подтверждения; срок действия кода - по часовому поясу пользователя
+func confirmationText(confirmation *models.Confirmation, code string, loc *time.Location) string {
+	return fmt.Sprintf("Подтвердите операцию: %s.\n\nКод подтверждения: %s\nКод действует до %s.\n\n"+
+		"Если вы не выполняли эту операцию, нажмите «Отклонить» и смените API ключи.",
+		confirmation.Description, code, confirmation.ExpiresAt.In(loc).Format("02.01.2006 15:04"))
+}
+
+// Проверка кода ожидающего подтверждения. Верный код подтверждает операцию, неверный
+// увеличивает число попыток; после исчерпания попыток подтверждение отклоняется.
+func (s *Service) checkConfirmationCode(c *models.Confirmation, codeHash, code string, now time.Time) error {
+	if c.Status != models.ConfirmationStatusPending || !now.Before(c.ExpiresAt) {
+		return confirmationStatusError(c, now)
+	}
+	if hashConfirmationCode(code) != codeHash {
+		c.Attempts++
+		if c.Attempts >= s.confirmation.MaxAttempts {
+			c.Status = models.ConfirmationStatusRejected
+			return confirmationInvalid("Неверный код подтверждения, попытки исчерпаны")
+		}
+		return confirmationInvalid("Неверный код подтверждения")
+	}
+	c.Status = models.ConfirmationStatusApproved
+	c.ApprovedAt = &now
+	return nil
+}
+
+// Ошибка для подтверждения, которое нельзя использовать
+func confirmationStatusError(c *models.Confirmation, now time.Time) error {
+	switch {
+	case c.Status == models.ConfirmationStatusUsed:
+		return confirmationInvalid("Подтверждение уже использовано")
+	case c.Status == models.ConfirmationStatusRejected:
+		return confirmationInvalid("Операция отклонена")
+	case !now.Before(c.ExpiresAt):
+		return confirmationInvalid("Срок действия подтверждения истек")
+	default:
+		return confirmationInvalid("Операция еще не подтверждена")
+	}
+}
+
+func confirmationInvalid(message string) error {
+	return &Error{Kind: KindForbidden, Message: message, Code: ErrorCodeConfirmationInvalid}
+}
+
+// Статус подтверждения для клиента с учетом срока действия
+func confirmationView(c *models.Confirmation, now time.Time) *models.Confirmation {
+	if (c.Status == models.ConfirmationStatusPending || c.Status == models.ConfirmationStatusApproved) &&
+		!now.Before(c.ExpiresAt) {
+		c.Status = models.ConfirmationStatusExpired
+	}
+	return c
+}
+
+// Confirmation возвращает подтверждение пользователя, чтобы клиент мог дождаться
+// подтверждения операции в Telegram
+func (s *Service) Confirmation(ctx context.Context, userID, id int) (*models.Confirmation, error) {
+	confirmation, err := s.repo.Confirmation(ctx, id, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Подтверждение не найдено", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения подтверждения: %w", err))
+	}
+	return confirmationView(confirmation, time.Now()), nil
+}
+
+// ApproveConfirmation подтверждает операцию кодом (approve = true) или отклоняет ее.
+// Вызывается ботом по кнопке под сообщением с кодом или клиентом после ввода кода.
+func (s *Service) ApproveConfirmation(ctx context.Context, actor Actor, id int, request ConfirmationCodeRequest, approve bool) (*models.Confirmation, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var checkErr error
+	confirmation, err := s.repo.UpdateConfirmation(ctx, id, userID, func(c *models.Confirmation, codeHash string) {
+		if checkErr = s.checkConfirmationCode(c, codeHash, request.Code, now); checkErr == nil && !approve {
+			c.Status = models.ConfirmationStatusRejected
+			c.ApprovedAt = nil
+		}
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Подтверждение не найдено", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка подтверждения операции: %w", err))
+	}
+	if checkErr != nil {
+		return nil, checkErr
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "confirmation", confirmation.ID,
+		map[string]string{"status": models.ConfirmationStatusPending},
+		map[string]string{"status": confirmation.Status})
+	return confirmationView(confirmation, now), nil
+}
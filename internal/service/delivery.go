@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"project-znak/internal/labels"
+)
+
+// Ограничение времени доставки файла в Telegram
+const deliveryTimeout = time.Minute
+
+// Доставка PDF с кодами маркировки в чат пользователя через Bot API. Если отправить файл
+// не удалось, пользователю отправляется ссылка на скачивание. Ошибки только логируются.
+func (s *Service) deliverKIZFile(userID int, chatID int64, result KIZResult) {
+	if !s.telegram.Enabled() || chatID <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	caption := fmt.Sprintf("Коды маркировки по запросу №%d", result.RequestID)
+	data, err := os.ReadFile(result.FilePath)
+	if err == nil {
+		var messageID int64
+		messageID, err = s.telegram.SendDocument(ctx, chatID, filepath.Base(result.FilePath), data, s.localize(ctx, userID, caption))
+		if err == nil {
+			if result.RequestID > 0 {
+				if err := s.repo.SaveKIZDelivery(ctx, result.RequestID, messageID); err != nil {
+					s.logger.Printf("Ошибка сохранения сообщения Telegram для запроса КИЗ %d: %v", result.RequestID, err)
+				}
+			}
+			return
+		}
+	}
+	s.logger.Printf("Ошибка отправки файла КИЗ по запросу %d в Telegram: %v", result.RequestID, err)
+
+	text := caption + ": файл не удалось отправить в Telegram."
+	if link := s.kizDownloadLink(result.RequestID, time.Now()); link != "" {
+		text += " Скачать: " + link
+	}
+	if err := s.telegram.SendMessage(ctx, chatID, s.localize(ctx, userID, text)); err != nil {
+		s.logger.Printf("Ошибка отправки ссылки на файл КИЗ по запросу %d в Telegram: %v", result.RequestID, err)
+	}
+}
+
+// Ссылка на скачивание PDF с кодами запроса, подписанная HMAC-SHA256. Возвращает
+// пустую строку, если адрес сервиса или ключ подписи не заданы.
+func (s *Service) kizDownloadLink(requestID int, now time.Time) string {
+	if s.downloads.BaseURL == "" || s.downloads.Secret == "" || requestID <= 0 {
+		return ""
+	}
+
+	expires := now.Add(s.downloads.LinkTTL).Unix()
+	query := url.Values{
+		"id":        {strconv.Itoa(requestID)},
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {s.downloadSignature(requestID, expires)},
+	}
+	return s.downloads.BaseURL + "/api/requests/download?" + query.Encode()
+}
+
+// Подпись ссылки на скачивание
+func (s *Service) downloadSignature(requestID int, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.downloads.Secret))
+	fmt.Fprintf(mac, "%d:%d", requestID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DownloadKIZFile проверяет подпись и срок действия ссылки на скачивание и возвращает
+// PDF с кодами запроса
+func (s *Service) DownloadKIZFile(ctx context.Context, requestID int, expires int64, signature string) ([]byte, error) {
+	if s.downloads.Secret == "" {
+		return nil, NewError(KindNotFound, "Скачивание файлов по ссылке отключено", nil)
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.downloadSignature(requestID, expires))) {
+		return nil, NewError(KindForbidden, "Неверная подпись ссылки", nil)
+	}
+	if time.Now().Unix() > expires {
+		return nil, NewError(KindForbidden, "Срок действия ссылки истек", nil)
+	}
+
+	return s.KIZLabels(ctx, KIZLabelsRequest{RequestID: requestID, Format: labels.FormatPDF})
+}
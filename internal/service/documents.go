@@ -0,0 +1,419 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/transport"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Формат дат в запросах и документах ввода в оборот
+const documentDateLayout = "2006-01-02"
+
+// Количество документов, состояние которых проверяется за один проход опроса
+const documentPollBatch = 50
+
+// Наибольший интервал между проверками статуса документа, который еще обрабатывается
+const documentPollMaxDelay = time.Hour
+
+// IntroductionDocumentRequest - запрос на создание документа ввода в оборот по кодам заказа
+type IntroductionDocumentRequest struct {
+	TelegramID        int64  `json:"telegram_id"`
+	OrderID           int    `json:"order_id" validate:"required,min=1"`
+	ProductionType    string `json:"production_type" validate:"required,oneof=produced imported"`
+	ProductionDate    string `json:"production_date" validate:"required,date"`   // ГГГГ-ММ-ДД
+	DeclarationNumber string `json:"declaration_number,omitempty"`               // Для ввезенных товаров
+	DeclarationDate   string `json:"declaration_date,omitempty" validate:"date"` // Для ввезенных товаров, ГГГГ-ММ-ДД
+}
+
+// CreateIntroductionDocument формирует черновик документа ввода в оборот
+// из кодов маркировки, полученных по заказу
+func (s *Service) CreateIntroductionDocument(ctx context.Context, actor Actor, request IntroductionDocumentRequest) (*models.IntroductionDocument, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := models.IntroductionDocument{
+		OrderID:           request.OrderID,
+		UserID:            userID,
+		ProductionType:    request.ProductionType,
+		DeclarationNumber: strings.TrimSpace(request.DeclarationNumber),
+		Status:            models.DocumentStatusDraft,
+	}
+
+	// Формат дат проверен ValidateRequest
+	doc.ProductionDate, _ = time.Parse(documentDateLayout, request.ProductionDate)
+	if request.DeclarationDate != "" {
+		declarationDate, _ := time.Parse(documentDateLayout, request.DeclarationDate)
+		doc.DeclarationDate = &declarationDate
+	}
+
+	doc.ParticipantINN, doc.OrganizationID, doc.ProductGroup, err = s.repo.OrderParticipant(ctx, request.OrderID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Заказ не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения участника оборота: %w", err))
+	}
+
+	if doc.Codes, err = s.repo.OrderKIZCodes(ctx, request.OrderID); err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения кодов заказа: %w", err))
+	}
+	if len(doc.Codes) == 0 {
+		return nil, NewError(KindConflict, "По заказу не получены коды маркировки", nil)
+	}
+
+	if err := doc.Validate(); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	if err := s.repo.CreateIntroductionDocument(ctx, &doc); errors.Is(err, repository.ErrDocumentExists) {
+		return nil, NewError(KindConflict, "Для заказа уже создан документ ввода в оборот", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка создания документа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "introduction_document", doc.ID, nil, doc)
+
+	return &doc, nil
+}
+
+// ListIntroductionDocuments возвращает документы ввода в оборот, доступные пользователю
+func (s *Service) ListIntroductionDocuments(ctx context.Context, userID, orderID, limit int) ([]models.IntroductionDocument, error) {
+	docs, err := s.repo.ListIntroductionDocuments(ctx, userID, orderID, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса документов: %w", err))
+	}
+	return docs, nil
+}
+
+// GetIntroductionDocument возвращает документ ввода в оборот. Для отправленного документа
+// предварительно запрашивается результат его обработки в Честном ЗНАКе.
+func (s *Service) GetIntroductionDocument(ctx context.Context, userID, documentID int) (*models.IntroductionDocument, error) {
+	doc, err := s.introductionDocument(ctx, userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.Status == models.DocumentStatusSubmitted && doc.ExternalID != "" {
+		if err := s.refreshDocumentStatus(ctx, doc); err != nil {
+			s.logger.Printf("Ошибка получения статуса документа %d: %v", doc.ID, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// DocumentOrganizationID возвращает организацию документа; 0, если документ личный или не найден
+func (s *Service) DocumentOrganizationID(ctx context.Context, documentID int) (int, error) {
+	return s.repo.DocumentOrganizationID(ctx, documentID)
+}
+
+// SubmitIntroductionDocument подписывает черновик документа и отправляет его в Честный ЗНАК.
+// Если ЭЦП не настроена, документ считается принятым без отправки.
+func (s *Service) SubmitIntroductionDocument(ctx context.Context, actor Actor, userID, documentID int) (*models.IntroductionDocument, error) {
+	doc, err := s.introductionDocument(ctx, userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.BeginDocumentSubmission(ctx, doc.ID); errors.Is(err, repository.ErrDocumentNotDraft) {
+		return nil, NewError(KindConflict, "Документ уже отправлен", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка отправки документа", err)
+	}
+
+	externalID, err := s.sendIntroductionDocument(ctx, doc)
+	if err != nil {
+		if err := s.repo.CancelDocumentSubmission(context.WithoutCancel(ctx), doc.ID); err != nil {
+			s.logger.Printf("Ошибка возврата документа %d в черновики: %v", doc.ID, err)
+		}
+		go s.notifyFailure(doc.UserID, "Ввод в оборот", fmt.Sprintf("не удалось отправить документ №%d в Честный ЗНАК", doc.ID))
+		return nil, chestnyZnakError("Ошибка отправки документа в Честный ЗНАК", err)
+	}
+
+	// Документ уже принят Честным ЗНАКом, поэтому сохранение не зависит от отмены запроса
+	ctx = context.WithoutCancel(ctx)
+	if err := s.repo.SetDocumentExternalID(ctx, doc.ID, externalID); err != nil {
+		return nil, NewError(KindInternal, "Ошибка сохранения документа", fmt.Errorf("документ %d отправлен как %s: %w", doc.ID, externalID, err))
+	}
+
+	now := time.Now()
+	doc.Status = models.DocumentStatusSubmitted
+	doc.ExternalID = externalID
+	doc.SubmittedAt = &now
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "introduction_document", doc.ID,
+		map[string]string{"status": models.DocumentStatusDraft},
+		map[string]string{"status": doc.Status, "external_id": externalID})
+
+	if !s.chestnyZnak.Enabled() {
+		if err := s.setDocumentResult(ctx, doc, repository.DocumentResult{Status: models.DocumentStatusAccepted}); err != nil {
+			s.logger.Printf("Ошибка обновления статуса документа %d: %v", doc.ID, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// IntroductionDocumentReceipt формирует PDF-квитанцию о принятии документа Честным ЗНАКом
+func (s *Service) IntroductionDocumentReceipt(ctx context.Context, userID, documentID int) ([]byte, error) {
+	doc, err := s.GetIntroductionDocument(ctx, userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Status != models.DocumentStatusAccepted {
+		return nil, NewError(KindConflict, "Квитанция доступна после принятия документа Честным ЗНАКом", nil)
+	}
+
+	receipt, err := generateDocumentReceipt(doc, s.UserLocation(ctx, userID))
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка генерации PDF", err)
+	}
+	return receipt, nil
+}
+
+// RunDocumentStatusPolling периодически запрашивает результат обработки отправленных
+// документов до отмены контекста. Первая проверка выполняется сразу, чтобы после
+// перезапуска сервиса продолжить опрос документов, отправленных ранее.
+func (s *Service) RunDocumentStatusPolling(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			s.pollDocumentStatuses(ctx, interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Проверка состояния отправленных документов, для которых наступило время проверки.
+// Проверка документа, который еще обрабатывается или статус которого не удалось получить,
+// откладывается с увеличивающимся интервалом.
+func (s *Service) pollDocumentStatuses(ctx context.Context, interval time.Duration) {
+	if !s.chestnyZnak.Enabled() {
+		return
+	}
+
+	docs, err := s.repo.PendingIntroductionDocuments(ctx, documentPollBatch)
+	if err != nil {
+		s.logger.Printf("Ошибка получения отправленных документов: %v", err)
+		return
+	}
+
+	for i := range docs {
+		if err := s.refreshDocumentStatus(ctx, &docs[i]); err != nil {
+			s.logger.Printf("Ошибка получения статуса документа %d: %v", docs[i].ID, err)
+		}
+		if docs[i].Status != models.DocumentStatusSubmitted {
+			continue
+		}
+		if err := s.repo.PostponeDocumentCheck(ctx, docs[i].ID, interval, documentPollMaxDelay); err != nil {
+			s.logger.Printf("Ошибка переноса проверки документа %d: %v", docs[i].ID, err)
+		}
+	}
+
+	retirements, err := s.repo.PendingRetirementDocuments(ctx, documentPollBatch)
+	if err != nil {
+		s.logger.Printf("Ошибка получения отправленных документов вывода из оборота: %v", err)
+		return
+	}
+
+	for i := range retirements {
+		if err := s.refreshRetirementStatus(ctx, &retirements[i]); err != nil {
+			s.logger.Printf("Ошибка получения статуса документа вывода из оборота %d: %v", retirements[i].ID, err)
+		}
+		if retirements[i].Status != models.DocumentStatusSubmitted {
+			continue
+		}
+		if err := s.repo.PostponeRetirementCheck(ctx, retirements[i].ID, interval, documentPollMaxDelay); err != nil {
+			s.logger.Printf("Ошибка переноса проверки документа вывода из оборота %d: %v", retirements[i].ID, err)
+		}
+	}
+}
+
+// Получение документа, доступного пользователю
+func (s *Service) introductionDocument(ctx context.Context, userID, documentID int) (*models.IntroductionDocument, error) {
+	doc, err := s.repo.IntroductionDocument(ctx, documentID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Документ не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения документа: %w", err))
+	}
+	return doc, nil
+}
+
+// Отправка документа в Честный ЗНАК. Если ЭЦП не настроена, возвращается тестовый идентификатор.
+func (s *Service) sendIntroductionDocument(ctx context.Context, doc *models.IntroductionDocument) (string, error) {
+	if !s.chestnyZnak.Enabled() {
+		return fmt.Sprintf("TEST-%d", doc.ID), nil
+	}
+	ctx = transport.WithSubject(ctx, "introduction_document", doc.ID)
+	return s.chestnyZnak.SubmitDocument(ctx, doc.ProductGroup, buildIntroductionDocument(doc))
+}
+
+// Формирование документа ввода в оборот в формате API Честного ЗНАКа
+func buildIntroductionDocument(doc *models.IntroductionDocument) chestnyznak.IntroductionDocument {
+	productionDate := doc.ProductionDate.Format(documentDateLayout)
+	document := chestnyznak.IntroductionDocument{
+		DocumentType:   chestnyznak.DocumentTypeIntroduceGoods,
+		ParticipantINN: doc.ParticipantINN,
+		ProductGroup:   doc.ProductGroup,
+		ProductionDate: productionDate,
+	}
+
+	if doc.ProductionType == models.ProductionTypeImported {
+		document.DocumentType = chestnyznak.DocumentTypeGoodsImport
+		document.DeclarationNumber = doc.DeclarationNumber
+		document.DeclarationDate = doc.DeclarationDate.Format(documentDateLayout)
+	}
+
+	for _, code := range doc.Codes {
+		document.Products = append(document.Products, chestnyznak.DocumentProduct{
+			UIT:            code,
+			ProductionDate: productionDate,
+		})
+	}
+
+	return document
+}
+
+// Запрос результата обработки документа в Честном ЗНАКе. Документ, который еще
+// обрабатывается, не изменяется.
+func (s *Service) refreshDocumentStatus(ctx context.Context, doc *models.IntroductionDocument) error {
+	if !s.chestnyZnak.Enabled() {
+		return nil
+	}
+
+	state, err := s.chestnyZnak.DocumentStatus(transport.WithSubject(ctx, "introduction_document", doc.ID), doc.ProductGroup, doc.ExternalID)
+	if err != nil {
+		return err
+	}
+
+	if result, ok := documentResult(state); ok {
+		result.Receipt = s.resultReceipt(ctx, documentTypeIntroduction, doc.ID, doc.ProductGroup, doc.ExternalID, result.Ticket)
+		return s.setDocumentResult(ctx, doc, result)
+	}
+	return nil
+}
+
+// Результат обработки документа по его состоянию в Честном ЗНАКе; ok = false,
+// если документ еще обрабатывается
+func documentResult(state *chestnyznak.DocumentStatus) (result repository.DocumentResult, ok bool) {
+	result.Ticket = state.Ticket
+	switch state.State {
+	case chestnyznak.DocumentStateCheckedOK, chestnyznak.DocumentStateProcessed:
+		result.Status = models.DocumentStatusAccepted
+		return result, true
+	case chestnyznak.DocumentStateCheckedErr, chestnyznak.DocumentStateFailed:
+		result.Status = models.DocumentStatusRejected
+		result.Error = strings.Join(state.Errors, "; ")
+		if result.Error == "" {
+			result.Error = "документ не прошел проверку"
+		}
+		return result, true
+	}
+	return repository.DocumentResult{}, false
+}
+
+// Сохранение результата обработки документа с записью в журнал аудита
+// и уведомлением автора. Заказ принятого документа переводится в выполненные.
+func (s *Service) setDocumentResult(ctx context.Context, doc *models.IntroductionDocument, result repository.DocumentResult) error {
+	messages, err := s.documentResultMessages(documentEvent{
+		DocumentType: documentTypeIntroduction,
+		DocumentID:   doc.ID,
+		OrderID:      doc.OrderID,
+		ExternalID:   doc.ExternalID,
+		Status:       result.Status,
+		Error:        result.Error,
+		Ticket:       result.Ticket,
+	}.withReceipt(result.Receipt), doc.UserID)
+	if err != nil {
+		return err
+	}
+	updated, err := s.repo.UpdateDocumentStatus(ctx, doc.ID, result, messages)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения статуса документа: %w", err)
+	}
+
+	before := doc.Status
+	now := time.Now()
+	doc.Status = result.Status
+	doc.Error = result.Error
+	doc.Ticket = result.Ticket
+	doc.ProcessedAt = &now
+	if !updated {
+		// Результат уже сохранен параллельной проверкой
+		return nil
+	}
+
+	s.recordAudit(ctx, Actor{}, AuditActionUpdate, "introduction_document", doc.ID,
+		map[string]string{"status": before},
+		map[string]string{"status": result.Status, "error": result.Error, "ticket": result.Ticket})
+
+	return nil
+}
+
+// Генерация PDF-квитанции о вводе товаров в оборот; время отправки - в часовом поясе loc
+func generateDocumentReceipt(doc *models.IntroductionDocument, loc *time.Location) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Arial", "B", 16)
+	pdf.Cell(40, 10, fmt.Sprintf("Квитанция о вводе в оборот №%d", doc.ID))
+	pdf.Ln(12)
+
+	pdf.SetFont("Arial", "", 12)
+	lines := []string{
+		"Документ в Честном ЗНАКе: " + doc.ExternalID,
+		"ИНН участника оборота: " + doc.ParticipantINN,
+		fmt.Sprintf("Заказ: №%d", doc.OrderID),
+		"Дата производства: " + doc.ProductionDate.Format("02.01.2006"),
+	}
+	if name, ok := models.ProductGroupNames[doc.ProductGroup]; ok {
+		lines = append(lines, "Товарная группа: "+name)
+	}
+	if doc.ProductionType == models.ProductionTypeImported {
+		lines = append(lines, fmt.Sprintf("Декларация на товары: %s от %s",
+			doc.DeclarationNumber, doc.DeclarationDate.Format("02.01.2006")))
+	}
+	if doc.SubmittedAt != nil {
+		lines = append(lines, "Дата отправки: "+doc.SubmittedAt.In(loc).Format("02.01.2006 15:04"))
+	}
+	lines = append(lines, fmt.Sprintf("Количество кодов: %d", len(doc.Codes)))
+
+	for _, line := range lines {
+		pdf.Cell(0, 10, line)
+		pdf.Ln(8)
+	}
+
+	pdf.Ln(4)
+	for i, code := range doc.Codes {
+		pdf.Cell(0, 10, fmt.Sprintf("%d. %s", i+1, code))
+		pdf.Ln(8)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("ошибка создания PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
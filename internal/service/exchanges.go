@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"project-znak/internal/repository"
+	"project-znak/internal/transport"
+)
+
+const (
+	// Время на сохранение запроса в архиве; запрос к внешней системе к этому моменту уже выполнен
+	archiveSaveTimeout = 5 * time.Second
+	// Число записей архива, удаляемых за один запрос
+	archiveCleanupBatch = 1000
+)
+
+// ArchiveExchanges возвращает функцию сохранения запросов к Честному ЗНАКу и СУЗ в архиве
+// для transport.Archive. Ошибка сохранения не прерывает запрос и только записывается в журнал.
+func ArchiveExchanges(repo *repository.Repository, logger *log.Logger) func(context.Context, transport.Exchange) {
+	return func(ctx context.Context, exchange transport.Exchange) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), archiveSaveTimeout)
+		defer cancel()
+
+		err := repo.InsertAPIExchange(ctx, repository.NewAPIExchange{
+			System:          exchange.System,
+			SubjectType:     exchange.SubjectType,
+			SubjectID:       exchange.SubjectID,
+			Method:          exchange.Method,
+			URL:             exchange.URL,
+			RequestHeaders:  exchange.RequestHeaders,
+			RequestBody:     exchange.RequestBody,
+			StatusCode:      exchange.StatusCode,
+			ResponseHeaders: exchange.ResponseHeaders,
+			ResponseBody:    exchange.ResponseBody,
+			Truncated:       exchange.Truncated,
+			Error:           exchange.Error,
+			Duration:        exchange.Duration,
+			CreatedAt:       exchange.StartedAt,
+		})
+		if err != nil {
+			logger.Printf("Ошибка сохранения запроса %s %s в архиве: %v", exchange.Method, exchange.URL, err)
+		}
+	}
+}
+
+// ListAPIExchanges возвращает записи архива запросов к внешним системам по фильтру
+func (s *Service) ListAPIExchanges(ctx context.Context, filter repository.APIExchangeFilter) ([]repository.APIExchange, error) {
+	exchanges, err := s.repo.ListAPIExchanges(ctx, filter)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса архива запросов: %w", err))
+	}
+	return exchanges, nil
+}
+
+// RunArchiveCleanup периодически удаляет записи архива запросов старше retention
+func (s *Service) RunArchiveCleanup(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			s.cleanupArchive(ctx, retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Удаление записей архива с истекшим сроком хранения пакетами по archiveCleanupBatch
+func (s *Service) cleanupArchive(ctx context.Context, retention time.Duration) {
+	before := time.Now().Add(-retention)
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := s.repo.DeleteAPIExchanges(ctx, before, archiveCleanupBatch)
+		if err != nil {
+			s.logger.Printf("Ошибка очистки архива запросов: %v", err)
+			return
+		}
+		total += deleted
+		if deleted < archiveCleanupBatch {
+			break
+		}
+	}
+	if total > 0 {
+		s.logger.Printf("Из архива запросов удалено записей: %d", total)
+	}
+}
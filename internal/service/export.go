@@ -0,0 +1,287 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"project-znak/internal/mailer"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+const (
+	// Срок, в течение которого готовый архив можно скачать
+	dataExportTTL = 24 * time.Hour
+	// Ограничение времени формирования архива; незавершенная за это время выгрузка
+	// формируется заново
+	dataExportTimeout = 30 * time.Minute
+	// Наибольшее число записей каждого вида в выгрузке
+	maxExportRecords = 10000
+)
+
+// Данные письма о готовности выгрузки
+type dataExportEmail struct {
+	ExportID  int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Профиль пользователя в выгрузке
+type exportProfile struct {
+	User          *models.User          `json:"user"`
+	Organizations []models.Organization `json:"organizations"`
+}
+
+// Документы пользователя в выгрузке
+type exportDocuments struct {
+	Introduction []models.IntroductionDocument `json:"introduction"`
+	Retirement   []models.RetirementDocument   `json:"retirement"`
+}
+
+// ExportUserData возвращает готовый ZIP-архив с данными пользователя. Если архива нет
+// или срок его хранения истек, запускает формирование нового архива и возвращает
+// выгрузку в статусе pending без данных; о готовности пользователь получает уведомление.
+func (s *Service) ExportUserData(ctx context.Context, actor Actor, userID int) (*models.DataExport, []byte, error) {
+	latest, err := s.repo.LatestDataExport(ctx, userID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса выгрузки: %w", err))
+	}
+
+	if latest != nil {
+		switch {
+		case latest.Status == models.DataExportStatusReady && time.Since(*latest.CompletedAt) < dataExportTTL:
+			data, err := os.ReadFile(latest.FilePath)
+			if err == nil {
+				return latest, data, nil
+			}
+			// Архив мог быть удален очисткой временных файлов; тогда формируется заново
+			if !errors.Is(err, os.ErrNotExist) {
+				return nil, nil, NewError(KindInternal, "Ошибка чтения архива", err)
+			}
+		case latest.Status == models.DataExportStatusPending && time.Since(latest.CreatedAt) < dataExportTimeout:
+			return latest, nil, nil
+		}
+	}
+
+	export, err := s.repo.CreateDataExport(ctx, userID)
+	if err != nil {
+		return nil, nil, NewError(KindInternal, "Ошибка создания выгрузки", err)
+	}
+	s.recordAudit(ctx, actor, AuditActionCreate, "data_export", export.ID, nil,
+		map[string]string{"status": export.Status})
+
+	go s.buildDataExport(*export)
+	return export, nil, nil
+}
+
+// Формирование архива с уведомлением пользователя о результате
+func (s *Service) buildDataExport(export models.DataExport) {
+	ctx, cancel := context.WithTimeout(context.Background(), dataExportTimeout)
+	defer cancel()
+
+	path, err := s.writeDataExport(ctx, export)
+	now := time.Now()
+	if err != nil {
+		s.logger.Printf("Ошибка формирования выгрузки %d пользователя %d: %v", export.ID, export.UserID, err)
+		if err := s.repo.FailDataExport(ctx, export.ID, err.Error(), now); err != nil {
+			s.logger.Printf("Ошибка сохранения статуса выгрузки %d: %v", export.ID, err)
+		}
+		s.notifyFailure(export.UserID, "Выгрузка данных", "не удалось сформировать архив")
+		return
+	}
+
+	if err := s.repo.CompleteDataExport(ctx, export.ID, path, now); err != nil {
+		s.logger.Printf("Ошибка сохранения статуса выгрузки %d: %v", export.ID, err)
+		return
+	}
+	s.notifyDataExportReady(ctx, export, now.Add(dataExportTTL))
+}
+
+// Запись ZIP-архива с данными пользователя во временную директорию
+func (s *Service) writeDataExport(ctx context.Context, export models.DataExport) (string, error) {
+	if err := os.MkdirAll(s.tempDir, 0755); err != nil {
+		return "", fmt.Errorf("ошибка создания временной директории: %w", err)
+	}
+	path := filepath.Join(s.tempDir, fmt.Sprintf("export_%d_%d.zip", export.UserID, export.ID))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания архива: %w", err)
+	}
+
+	zw := zip.NewWriter(file)
+	err = s.collectUserData(ctx, export.UserID, zw)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// Сбор данных пользователя: профиль, заказы, платежи, запросы КИЗ и документы в JSON,
+// а также сформированные файлы - PDF с кодами, счета и квитанции о вводе в оборот
+func (s *Service) collectUserData(ctx context.Context, userID int, zw *zip.Writer) error {
+	telegramID, err := s.repo.UserTelegramID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса пользователя: %w", err)
+	}
+	user, err := s.repo.UserByTelegram(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса пользователя: %w", err)
+	}
+	organizations, err := s.repo.ListOrganizations(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса организаций: %w", err)
+	}
+	if err := writeZipJSON(zw, "profile.json", exportProfile{User: user, Organizations: organizations}); err != nil {
+		return err
+	}
+
+	orders, err := s.repo.ListOrders(ctx, repository.OrderFilter{UserID: userID, Limit: maxExportRecords})
+	if err != nil {
+		return fmt.Errorf("ошибка запроса заказов: %w", err)
+	}
+	details := make([]*repository.OrderDetails, 0, len(orders))
+	invoices := []models.Invoice{}
+	for _, order := range orders {
+		detail, err := s.repo.OrderDetails(ctx, order.ID, userID)
+		if err != nil {
+			return fmt.Errorf("ошибка запроса заказа %d: %w", order.ID, err)
+		}
+		details = append(details, detail)
+
+		inv, data, err := s.InvoicePDF(ctx, userID, order.ID)
+		var serviceErr *Error
+		if errors.As(err, &serviceErr) && serviceErr.Kind == KindNotFound {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("ошибка формирования счета по заказу %d: %w", order.ID, err)
+		}
+		invoices = append(invoices, *inv)
+		if err := writeZipFile(zw, "invoices/invoice_"+inv.Number+".pdf", data); err != nil {
+			return err
+		}
+	}
+	if err := writeZipJSON(zw, "orders.json", details); err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "invoices.json", invoices); err != nil {
+		return err
+	}
+
+	payments, err := s.repo.UserPayments(ctx, userID, maxExportRecords)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса платежей: %w", err)
+	}
+	if err := writeZipJSON(zw, "payments.json", payments); err != nil {
+		return err
+	}
+
+	requests, err := s.repo.ListKIZRequests(ctx, telegramID, maxExportRecords)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса КИЗ: %w", err)
+	}
+	for i := range requests {
+		// Файлы с кодами, еще не удаленные очисткой, включаются в архив
+		if requests[i].FilePath != "" {
+			if data, err := os.ReadFile(requests[i].FilePath); err == nil {
+				if err := writeZipFile(zw, fmt.Sprintf("kiz/request_%d.pdf", requests[i].ID), data); err != nil {
+					return err
+				}
+			}
+			requests[i].FilePath = ""
+		}
+	}
+	if err := writeZipJSON(zw, "kiz_requests.json", requests); err != nil {
+		return err
+	}
+
+	tickets, err := s.repo.UserSupportTickets(ctx, userID, maxExportRecords)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса обращений: %w", err)
+	}
+	if err := writeZipJSON(zw, "support_tickets.json", tickets); err != nil {
+		return err
+	}
+
+	var documents exportDocuments
+	if documents.Introduction, err = s.repo.ListIntroductionDocuments(ctx, userID, 0, maxExportRecords); err != nil {
+		return fmt.Errorf("ошибка запроса документов ввода в оборот: %w", err)
+	}
+	if documents.Retirement, err = s.repo.ListRetirementDocuments(ctx, userID, maxExportRecords); err != nil {
+		return fmt.Errorf("ошибка запроса документов вывода из оборота: %w", err)
+	}
+	loc := s.UserLocation(ctx, userID)
+	for i := range documents.Introduction {
+		doc := &documents.Introduction[i]
+		if doc.Status != models.DocumentStatusAccepted {
+			continue
+		}
+		data, err := generateDocumentReceipt(doc, loc)
+		if err != nil {
+			return fmt.Errorf("ошибка формирования квитанции по документу %d: %w", doc.ID, err)
+		}
+		if err := writeZipFile(zw, fmt.Sprintf("documents/receipt_%d.pdf", doc.ID), data); err != nil {
+			return err
+		}
+	}
+	return writeZipJSON(zw, "documents.json", documents)
+}
+
+// Запись значения в архив в формате JSON
+func writeZipJSON(zw *zip.Writer, name string, value any) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("ошибка записи %s в архив: %w", name, err)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("ошибка записи %s в архив: %w", name, err)
+	}
+	return nil
+}
+
+// Запись файла в архив
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.Create(name)
+	if err == nil {
+		_, err = w.Write(data)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка записи %s в архив: %w", name, err)
+	}
+	return nil
+}
+
+// Уведомление о готовности архива в Telegram и по email. Письмо отправляется независимо
+// от настроек уведомлений: выгрузку пользователь запросил сам.
+func (s *Service) notifyDataExportReady(ctx context.Context, export models.DataExport, expiresAt time.Time) {
+	if s.telegram.Enabled() {
+		text := fmt.Sprintf("Архив с вашими данными по запросу №%d готов. Скачать его можно до %s запросом GET /api/users/me/export.",
+			export.ID, expiresAt.In(s.UserLocation(ctx, export.UserID)).Format("02.01.2006 15:04"))
+		if telegramID, err := s.repo.UserTelegramID(ctx, export.UserID); err != nil {
+			s.logger.Printf("Ошибка получения telegram_id пользователя %d: %v", export.UserID, err)
+		} else if err := s.telegram.SendMessage(ctx, telegramID, s.localize(ctx, export.UserID, text)); err != nil {
+			s.logger.Printf("Ошибка отправки сообщения пользователю %d: %v", export.UserID, err)
+		}
+	}
+
+	s.sendNotification(ctx, export.UserID,
+		func(models.NotificationPreferences) bool { return true },
+		"Выгрузка данных готова",
+		mailer.TemplateDataExport,
+		dataExportEmail{ExportID: export.ID, CreatedAt: export.CreatedAt, ExpiresAt: expiresAt})
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"project-znak/internal/fiscal"
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+	"project-znak/internal/repository"
+)
+
+// Число чеков, обрабатываемых за один проход
+const fiscalBatch = 50
+
+// Задержка перед повторной регистрацией чека; удваивается с каждой попыткой
+const (
+	fiscalRetryDelay    = time.Minute
+	fiscalRetryMaxDelay = 6 * time.Hour
+)
+
+// Наименование позиции чека, если позиции заказа не совпадают с суммой платежа
+const fiscalDefaultItemName = "Оплата услуг"
+
+// Постановка чека по проведенному платежу в очередь фискализации. Ошибка не отменяет
+// проведение платежа и только записывается в журнал.
+func (s *Service) enqueueFiscalReceipt(ctx context.Context, paymentID int) {
+	if s.fiscal == nil {
+		return
+	}
+	if err := s.repo.CreateFiscalReceipt(ctx, paymentID, s.fiscal.Name()); err != nil {
+		s.logger.Printf("Ошибка постановки чека по платежу %d в очередь: %v", paymentID, err)
+	}
+}
+
+// RunFiscalization периодически регистрирует чеки по проведенным платежам в онлайн-кассе
+// до отмены контекста. Если касса не настроена, сразу завершается.
+func (s *Service) RunFiscalization(ctx context.Context, interval time.Duration) {
+	if s.fiscal == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			s.processFiscalReceipts(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Обработка чеков, для которых наступило время очередной попытки
+func (s *Service) processFiscalReceipts(ctx context.Context) {
+	receipts, err := s.repo.DueFiscalReceipts(ctx, fiscalBatch)
+	if err != nil {
+		s.logger.Printf("Ошибка получения чеков для фискализации: %v", err)
+		return
+	}
+
+	for i := range receipts {
+		if err := s.fiscalize(ctx, &receipts[i]); err != nil {
+			s.logger.Printf("Ошибка фискализации платежа %d: %v", receipts[i].PaymentID, err)
+		}
+	}
+}
+
+// Передача чека в кассу и получение его реквизитов. Чек, еще не обработанный кассой,
+// проверяется при следующем проходе без учета попытки.
+func (s *Service) fiscalize(ctx context.Context, receipt *models.FiscalReceipt) error {
+	if receipt.ProviderID == "" {
+		payment, err := s.repo.FiscalPaymentData(ctx, receipt.PaymentID)
+		if err != nil {
+			return s.failFiscalAttempt(ctx, receipt, fmt.Errorf("ошибка получения данных платежа: %w", err), false)
+		}
+
+		// Идентификатор сохраняется до отправки: при обрыве связи чек передается повторно
+		// с тем же идентификатором и не регистрируется дважды
+		if receipt.ExternalID == "" {
+			receipt.ExternalID = fmt.Sprintf("payment-%d-%d", receipt.PaymentID, receipt.Attempts+1)
+			if err := s.repo.SetFiscalProviderID(ctx, receipt.ID, receipt.ExternalID, ""); err != nil {
+				return fmt.Errorf("ошибка сохранения идентификатора чека: %w", err)
+			}
+		}
+
+		providerID, err := s.fiscal.Register(ctx, fiscalReceipt(receipt.ExternalID, payment))
+		if err != nil {
+			return s.failFiscalAttempt(ctx, receipt, err, false)
+		}
+		if err := s.repo.SetFiscalProviderID(ctx, receipt.ID, receipt.ExternalID, providerID); err != nil {
+			return fmt.Errorf("ошибка сохранения идентификатора чека: %w", err)
+		}
+		receipt.ProviderID = providerID
+	}
+
+	doc, err := s.fiscal.Status(ctx, receipt.ProviderID)
+	if errors.Is(err, fiscal.ErrPending) {
+		return nil
+	} else if err != nil {
+		return s.failFiscalAttempt(ctx, receipt, err, errors.Is(err, fiscal.ErrRejected))
+	}
+
+	receipt.Status = models.FiscalStatusRegistered
+	receipt.FiscalDocumentNumber = doc.FiscalDocumentNumber
+	receipt.FiscalDocumentAttribute = doc.FiscalDocumentAttribute
+	receipt.FNNumber = doc.FNNumber
+	receipt.ReceiptNumber = doc.ReceiptNumber
+	receipt.ShiftNumber = doc.ShiftNumber
+	receipt.RegistrationNumber = doc.RegistrationNumber
+	receipt.FNSSite = doc.FNSSite
+	receipt.RegisteredAt = &doc.RegisteredAt
+	if err := s.repo.SaveFiscalDocument(ctx, receipt); err != nil {
+		return fmt.Errorf("ошибка сохранения реквизитов чека: %w", err)
+	}
+
+	s.recordAudit(ctx, Actor{}, AuditActionUpdate, "fiscal_receipt", receipt.PaymentID,
+		map[string]string{"status": models.FiscalStatusPending},
+		map[string]string{"status": models.FiscalStatusRegistered, "fiscal_document_number": doc.FiscalDocumentNumber})
+	return nil
+}
+
+// Учет неудачной попытки регистрации. Отклоненный кассой чек передается заново
+// с новым идентификатором. Возвращает исходную ошибку.
+func (s *Service) failFiscalAttempt(ctx context.Context, receipt *models.FiscalReceipt, cause error, reset bool) error {
+	failed, err := s.repo.FailFiscalAttempt(ctx, receipt.ID, cause.Error(), reset,
+		fiscalRetryDelay, fiscalRetryMaxDelay, s.fiscalMaxAttempts)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения попытки фискализации: %w (%v)", err, cause)
+	}
+	if failed {
+		s.logger.Printf("Попытки регистрации чека по платежу %d исчерпаны", receipt.PaymentID)
+	}
+	return cause
+}
+
+// Формирование чека прихода. Позиции берутся из заказа, если их сумма совпадает
+// с суммой платежа; иначе чек содержит одну позицию на всю сумму.
+func fiscalReceipt(externalID string, payment *repository.FiscalPayment) fiscal.Receipt {
+	receipt := fiscal.Receipt{
+		ExternalID: externalID,
+		Email:      payment.Email,
+		Total:      payment.Amount.Float64(),
+	}
+
+	// Суммы позиций считаются в копейках, чтобы сравнение с суммой платежа было точным
+	var items []fiscal.Item
+	total := money.Rubles(0)
+	for _, item := range payment.Items {
+		price := money.FromFloat(item.Price, money.RUB)
+		sum := price.Mul(int64(item.Quantity))
+		name := item.ProductName
+		if name == "" {
+			name = "Коды маркировки " + item.GTIN
+		}
+		items = append(items, fiscal.Item{Name: name, Price: price.Float64(), Quantity: float64(item.Quantity), Sum: sum.Float64()})
+		total = total.Add(sum)
+	}
+
+	if len(items) > 0 && total.Equal(payment.Amount) {
+		receipt.Items = items
+	} else {
+		amount := payment.Amount.Float64()
+		receipt.Items = []fiscal.Item{{Name: fiscalDefaultItemName, Price: amount, Quantity: 1, Sum: amount}}
+	}
+	return receipt
+}
+
+// PaymentReceipt возвращает чек по платежу пользователя или его организации
+func (s *Service) PaymentReceipt(ctx context.Context, userID, paymentID int) (*models.FiscalReceipt, error) {
+	receipt, err := s.repo.PaymentFiscalReceipt(ctx, paymentID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Чек по платежу не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса чека: %w", err))
+	}
+	return receipt, nil
+}
+
+// PaymentOrganizationID возвращает организацию, от имени которой сделан платеж; 0 для личного платежа
+func (s *Service) PaymentOrganizationID(ctx context.Context, paymentID int) (int, error) {
+	organizationID, err := s.repo.PaymentOrganizationID(ctx, paymentID)
+	if err != nil {
+		return 0, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса платежа: %w", err))
+	}
+	return organizationID, nil
+}
+
+// ListFiscalReceipts возвращает чеки с указанным статусом; все чеки, если статус не задан
+func (s *Service) ListFiscalReceipts(ctx context.Context, status string, limit int) ([]models.FiscalReceipt, error) {
+	switch status {
+	case "", models.FiscalStatusPending, models.FiscalStatusRegistered, models.FiscalStatusFailed:
+	default:
+		return nil, NewError(KindInvalid, "Недопустимый статус чека", nil)
+	}
+
+	receipts, err := s.repo.ListFiscalReceipts(ctx, status, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса чеков: %w", err))
+	}
+	return receipts, nil
+}
+
+// RetryFiscalReceipt возвращает в очередь чек, попытки регистрации которого исчерпаны
+func (s *Service) RetryFiscalReceipt(ctx context.Context, actor Actor, paymentID int) error {
+	if s.fiscal == nil {
+		return NewError(KindConflict, "Онлайн-касса не настроена", nil)
+	}
+
+	err := s.repo.RetryFiscalReceipt(ctx, paymentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Чек с исчерпанными попытками регистрации не найден", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка повторной фискализации", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "fiscal_receipt", paymentID,
+		map[string]string{"status": models.FiscalStatusFailed},
+		map[string]string{"status": models.FiscalStatusPending})
+	return nil
+}
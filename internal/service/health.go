@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Статусы проверки готовности
+const (
+	HealthStatusOK       = "ok"       // Зависимость доступна
+	HealthStatusDegraded = "degraded" // Недоступна необязательная зависимость, сервис работает с ограничениями
+	HealthStatusError    = "error"    // Зависимость недоступна
+	HealthStatusDisabled = "disabled" // Зависимость не настроена
+	HealthStatusStarting = "starting" // Сервис ожидает зависимости при запуске
+)
+
+// Ограничение времени одной проверки
+const healthCheckTimeout = 3 * time.Second
+
+// HealthCheck - результат проверки зависимости
+type HealthCheck struct {
+	Name      string  `json:"name" xml:"name"`
+	Status    string  `json:"status" xml:"status"`
+	Critical  bool    `json:"critical" xml:"critical"`                   // Без зависимости сервис не может обслуживать запросы
+	LatencyMS float64 `json:"latency_ms" xml:"latency_ms"`               // Время проверки в миллисекундах
+	Message   string  `json:"message,omitempty" xml:"message,omitempty"` // Описание ошибки или предупреждение
+}
+
+// HealthReport - результат проверки готовности сервиса
+type HealthReport struct {
+	Status string        `json:"status"` // ok, degraded или error
+	Checks []HealthCheck `json:"checks"`
+}
+
+// Ready сообщает, что все обязательные зависимости доступны
+func (r HealthReport) Ready() bool {
+	return r.Status != HealthStatusError
+}
+
+// Проверка зависимости; возвращает статус disabled, если зависимость не настроена
+type healthProbe struct {
+	name     string
+	critical bool
+	check    func(ctx context.Context) (status, message string)
+}
+
+// Readiness проверяет зависимости сервиса: БД, Redis, API Честного ЗНАКа, директорию
+// временных файлов и срок действия сертификата ЭЦП. Проверки выполняются параллельно.
+// Сервис не готов, если недоступна обязательная зависимость; при недоступности
+// необязательной отчет получает статус degraded.
+func (s *Service) Readiness(ctx context.Context) HealthReport {
+	probes := []healthProbe{
+		{"database", true, func(ctx context.Context) (string, string) {
+			return probeResult(s.repo.Ping(ctx))
+		}},
+		{"storage", true, s.checkStorage},
+		{"redis", false, func(ctx context.Context) (string, string) {
+			if !s.cache.Enabled() {
+				return HealthStatusDisabled, ""
+			}
+			return probeResult(s.cache.Ping(ctx))
+		}},
+		{"chestnyznak_api", false, func(ctx context.Context) (string, string) {
+			if !s.chestnyZnak.Enabled() {
+				return HealthStatusDisabled, ""
+			}
+			return probeResult(s.chestnyZnak.Ping(ctx))
+		}},
+		{"certificate", false, func(context.Context) (string, string) {
+			return s.checkCertificate(time.Now())
+		}},
+	}
+
+	report := HealthReport{Status: HealthStatusOK, Checks: make([]HealthCheck, len(probes))}
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		go func(i int, probe healthProbe) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			status, message := probe.check(ctx)
+			report.Checks[i] = HealthCheck{
+				Name:      probe.name,
+				Status:    status,
+				Critical:  probe.critical,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+				Message:   message,
+			}
+		}(i, probe)
+	}
+	wg.Wait()
+
+	for _, check := range report.Checks {
+		if check.Status != HealthStatusError {
+			continue
+		}
+		s.logger.Printf("Проверка готовности %s не пройдена: %s", check.Name, check.Message)
+		if check.Critical {
+			report.Status = HealthStatusError
+		} else if report.Status == HealthStatusOK {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	return report
+}
+
+func probeResult(err error) (string, string) {
+	if err != nil {
+		return HealthStatusError, err.Error()
+	}
+	return HealthStatusOK, ""
+}
+
+// Проверка записи во временную директорию, где хранятся файлы с кодами и выгрузки
+func (s *Service) checkStorage(context.Context) (string, string) {
+	if err := os.MkdirAll(s.tempDir, 0755); err != nil {
+		return HealthStatusError, fmt.Sprintf("ошибка создания временной директории: %v", err)
+	}
+	file, err := os.CreateTemp(s.tempDir, ".health-*")
+	if err != nil {
+		return HealthStatusError, fmt.Sprintf("временная директория недоступна для записи: %v", err)
+	}
+	_, err = file.Write([]byte("ok"))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	os.Remove(file.Name())
+	return probeResult(err)
+}
+
+// Проверка срока действия сертификата ЭЦП для запросов к Честному ЗНАКу
+func (s *Service) checkCertificate(now time.Time) (string, string) {
+	cert := s.chestnyZnak.Certificate()
+	if cert == nil {
+		return HealthStatusDisabled, ""
+	}
+	switch {
+	case now.Before(cert.NotBefore):
+		return HealthStatusError, "сертификат действует с " + cert.NotBefore.Format("02.01.2006")
+	case now.After(cert.NotAfter):
+		return HealthStatusError, "срок действия сертификата истек " + cert.NotAfter.Format("02.01.2006")
+	case cert.NotAfter.Sub(now) < time.Duration(certificateAlertDays[0])*24*time.Hour:
+		return HealthStatusOK, "сертификат действует до " + cert.NotAfter.Format("02.01.2006") + ", требуется замена"
+	}
+	return HealthStatusOK, "сертификат действует до " + cert.NotAfter.Format("02.01.2006")
+}
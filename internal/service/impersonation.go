@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+const (
+	// DefaultImpersonationTTL - срок действия токена имперсонации, если не указан иной
+	DefaultImpersonationTTL = 30 * time.Minute
+	// MaxImpersonationTTL - наибольший срок действия токена имперсонации
+	MaxImpersonationTTL = 4 * time.Hour
+	// Префикс токена имперсонации, отличающий его от API ключа
+	impersonationTokenPrefix = "imp_"
+	// Число сеансов имперсонации в списке
+	impersonationListLimit = 100
+)
+
+const impersonationKey contextKey = "impersonation"
+
+// ImpersonationRequest - запрос на имперсонацию пользователя с указанным telegram_id
+type ImpersonationRequest struct {
+	TelegramID int64  `json:"telegram_id" validate:"required,min=1"`
+	Reason     string `json:"reason" validate:"required,max=500"`       // Причина, например номер обращения
+	ExpiresIn  string `json:"expires_in,omitempty" validate:"duration"` // Срок действия токена; по умолчанию 30m
+	AllowWrite bool   `json:"allow_write,omitempty"`                    // Разрешить изменяющие запросы
+}
+
+// WithImpersonation сохраняет в контексте сеанс имперсонации, в котором выполняется запрос
+func WithImpersonation(ctx context.Context, impersonation *models.Impersonation) context.Context {
+	return context.WithValue(ctx, impersonationKey, impersonation)
+}
+
+// ImpersonationFromContext возвращает сеанс имперсонации запроса или nil, если запрос
+// выполняется от имени самого пользователя
+func ImpersonationFromContext(ctx context.Context) *models.Impersonation {
+	impersonation, _ := ctx.Value(impersonationKey).(*models.Impersonation)
+	return impersonation
+}
+
+// StartImpersonation выдает администратору временный токен для вызова API от имени
+// пользователя. Токен возвращается один раз и действует только вместе с API ключом
+// выдавшего его администратора. Имперсонация администраторов не допускается, чтобы
+// токен не расширял права поддержки.
+func (s *Service) StartImpersonation(ctx context.Context, actor Actor, request ImpersonationRequest) (*models.Impersonation, string, error) {
+	request.Reason = strings.TrimSpace(request.Reason)
+	if err := ValidateRequest(request); err != nil {
+		return nil, "", err
+	}
+
+	ttl := DefaultImpersonationTTL
+	if request.ExpiresIn != "" {
+		ttl, _ = time.ParseDuration(request.ExpiresIn)
+	}
+	if ttl <= 0 || ttl > MaxImpersonationTTL {
+		return nil, "", NewError(KindInvalid,
+			fmt.Sprintf("Срок действия токена должен быть больше нуля и не больше %s", MaxImpersonationTTL), nil)
+	}
+
+	userID, err := s.UserIDByTelegram(ctx, request.TelegramID)
+	if err != nil {
+		return nil, "", err
+	}
+	if userID == 0 {
+		return nil, "", NewError(KindNotFound, "Пользователь не найден", nil)
+	}
+	if userID == actor.UserID {
+		return nil, "", NewError(KindInvalid, "Нельзя выполнить вход от имени самого себя", nil)
+	}
+	admin, err := s.repo.IsAdmin(ctx, userID)
+	if err != nil {
+		return nil, "", NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка проверки прав администратора: %w", err))
+	}
+	if admin {
+		return nil, "", NewError(KindForbidden, "Вход от имени администратора не допускается", nil)
+	}
+
+	token, err := generateAPIKey()
+	if err != nil {
+		return nil, "", NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка генерации токена: %w", err))
+	}
+	token = impersonationTokenPrefix + token
+	impersonation := &models.Impersonation{
+		AdminUserID: actor.UserID,
+		UserID:      userID,
+		Reason:      request.Reason,
+		AllowWrite:  request.AllowWrite,
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	if err := s.repo.CreateImpersonation(ctx, impersonation, hashAPIKey(token)); err != nil {
+		return nil, "", NewError(KindInternal, "Ошибка при сохранении данных", err)
+	}
+
+	s.logger.Printf("Администратор %d начал сеанс имперсонации %d пользователя %d до %s: %s",
+		actor.UserID, impersonation.ID, userID, impersonation.ExpiresAt.Format(time.RFC3339), impersonation.Reason)
+	s.recordAudit(ctx, actor, AuditActionCreate, "impersonation", impersonation.ID, nil, impersonation)
+	return impersonation, token, nil
+}
+
+// AuthenticateImpersonation возвращает действующий сеанс имперсонации по токену, выданному
+// администратору adminUserID. Возвращает ошибку KindForbidden, если токен недействителен,
+// выдан другому администратору или администратор лишился своих прав.
+func (s *Service) AuthenticateImpersonation(ctx context.Context, adminUserID int, token string) (*models.Impersonation, error) {
+	denied := NewError(KindForbidden, "Токен имперсонации недействителен или истек", nil)
+	if !strings.HasPrefix(token, impersonationTokenPrefix) {
+		return nil, denied
+	}
+
+	impersonation, err := s.repo.ActiveImpersonationByHash(ctx, hashAPIKey(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, denied
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка проверки прав доступа", fmt.Errorf("ошибка проверки токена имперсонации: %w", err))
+	}
+	if impersonation.AdminUserID != adminUserID {
+		return nil, denied
+	}
+
+	admin, err := s.repo.IsAdmin(ctx, adminUserID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка проверки прав доступа", fmt.Errorf("ошибка проверки прав администратора: %w", err))
+	}
+	if !admin {
+		return nil, denied
+	}
+	return impersonation, nil
+}
+
+// RecordImpersonatedRequest записывает в журнал аудита запрос, выполненный в сеансе
+// имперсонации, с кодом ответа
+func (s *Service) RecordImpersonatedRequest(ctx context.Context, impersonation *models.Impersonation, ip, method, path string, status int) {
+	s.recordAudit(ctx, Actor{UserID: impersonation.AdminUserID, IP: ip}, AuditActionImpersonate,
+		"impersonation", impersonation.ID, nil, map[string]any{
+			"user_id": impersonation.UserID,
+			"method":  method,
+			"path":    path,
+			"status":  status,
+		})
+}
+
+// ListImpersonations возвращает последние сеансы имперсонации
+func (s *Service) ListImpersonations(ctx context.Context) ([]models.Impersonation, error) {
+	impersonations, err := s.repo.Impersonations(ctx, impersonationListLimit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса сеансов имперсонации: %w", err))
+	}
+	return impersonations, nil
+}
+
+// StopImpersonation досрочно завершает сеанс имперсонации
+func (s *Service) StopImpersonation(ctx context.Context, actor Actor, id int) (*models.Impersonation, error) {
+	impersonation, err := s.repo.RevokeImpersonation(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Действующий сеанс имперсонации не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка завершения сеанса имперсонации: %w", err))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionDelete, "impersonation", id,
+		map[string]any{"expires_at": impersonation.ExpiresAt}, map[string]any{"revoked_at": impersonation.RevokedAt})
+	return impersonation, nil
+}
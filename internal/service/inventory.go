@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// ReservationItem - количество кодов GTIN для резерва
+type ReservationItem struct {
+	GTIN  string `json:"gtin" validate:"required,gtin"`
+	Count int    `json:"count" validate:"required,min=1"`
+}
+
+// ReservationRequest - запрос резерва кодов для отгрузки. Коды резервируются из остатка
+// организации или, если она не указана, из личного остатка пользователя.
+type ReservationRequest struct {
+	TelegramID     int64             `json:"telegram_id"`
+	OrganizationID int               `json:"organization_id,omitempty"`
+	Reference      string            `json:"reference,omitempty"` // Номер отгрузки или заказа покупателя
+	Items          []ReservationItem `json:"items" validate:"required,max=100,dive"`
+}
+
+// MarkCodesRequest - отметка кодов использованными (нанесенными на товар) или испорченными
+type MarkCodesRequest struct {
+	TelegramID     int64    `json:"telegram_id"`
+	OrganizationID int      `json:"organization_id,omitempty"`
+	Status         string   `json:"status" validate:"required,oneof=used spoiled"`
+	Codes          []string `json:"codes" validate:"required,max=1000,dive,required"`
+}
+
+// ReorderRequest - повтор последнего запроса кодов GTIN из остатка. Если число кодов
+// не указано, запрашивается столько же, сколько в последнем запросе.
+type ReorderRequest struct {
+	TelegramID     int64  `json:"telegram_id" validate:"required,min=1"`
+	OrganizationID int    `json:"organization_id,omitempty"`
+	GTIN           string `json:"gtin" validate:"required,gtin"`
+	Count          int    `json:"count,omitempty" validate:"min=1"`
+}
+
+// Проверка доступа к остатку организации; 0 - личный остаток пользователя
+func (s *Service) checkInventoryAccess(ctx context.Context, userID, organizationID int) error {
+	if organizationID == 0 {
+		return nil
+	}
+	if _, err := s.repo.OrganizationRole(ctx, organizationID, userID); errors.Is(err, repository.ErrNotOrganizationMember) {
+		return NewError(KindForbidden, "Пользователь не состоит в указанной организации", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка проверки участия в организации: %w", err))
+	}
+	return nil
+}
+
+// Inventory возвращает остатки кодов по GTIN: доступные, зарезервированные, использованные
+// и испорченные. Остаток организации доступен всем ее участникам, без указания
+// организации возвращаются коды запросов пользователя.
+func (s *Service) Inventory(ctx context.Context, userID, organizationID int) ([]models.InventoryItem, error) {
+	if err := s.checkInventoryAccess(ctx, userID, organizationID); err != nil {
+		return nil, err
+	}
+	items, err := s.repo.Inventory(ctx, userID, organizationID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса остатков: %w", err))
+	}
+	return items, nil
+}
+
+// CreateReservation резервирует коды из остатка для отгрузки
+func (s *Service) CreateReservation(ctx context.Context, actor Actor, request ReservationRequest) (*models.KIZReservation, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkInventoryAccess(ctx, userID, request.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	items := make([]repository.ReservationItem, len(request.Items))
+	for i, item := range request.Items {
+		items[i] = repository.ReservationItem{GTIN: item.GTIN, Count: item.Count}
+	}
+	reservation := models.KIZReservation{
+		UserID:         userID,
+		OrganizationID: request.OrganizationID,
+		Reference:      strings.TrimSpace(request.Reference),
+	}
+	err = s.repo.CreateReservation(ctx, &reservation, items, func(changes []repository.StockChange) ([]models.OutboxMessage, error) {
+		return s.lowStockMessages(userID, request.OrganizationID, changes)
+	})
+	if errors.Is(err, repository.ErrInsufficientCodes) {
+		return nil, NewError(KindConflict, "Недостаточно доступных кодов для резерва", err)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка резервирования кодов", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "kiz_reservation", reservation.ID, nil, map[string]any{
+		"organization_id": request.OrganizationID,
+		"reference":       reservation.Reference,
+		"items":           request.Items,
+	})
+	return &reservation, nil
+}
+
+// GetReservation возвращает резерв с его кодами
+func (s *Service) GetReservation(ctx context.Context, userID, reservationID int) (*models.KIZReservation, error) {
+	reservation, err := s.repo.Reservation(ctx, reservationID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Резерв не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения резерва: %w", err))
+	}
+	return reservation, nil
+}
+
+// ReservationOrganizationID возвращает организацию резерва; 0, если резерв личный или не найден
+func (s *Service) ReservationOrganizationID(ctx context.Context, reservationID int) (int, error) {
+	return s.repo.ReservationOrganizationID(ctx, reservationID)
+}
+
+// ReleaseReservation снимает резерв и возвращает неиспользованные коды в остаток
+func (s *Service) ReleaseReservation(ctx context.Context, actor Actor, userID, reservationID int) (*models.KIZReservation, error) {
+	if err := s.repo.ReleaseReservation(ctx, reservationID, userID); errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Резерв не найден или уже снят", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка снятия резерва", err)
+	}
+	s.recordAudit(ctx, actor, AuditActionUpdate, "kiz_reservation", reservationID,
+		map[string]string{"status": models.ReservationStatusActive},
+		map[string]string{"status": models.ReservationStatusReleased})
+
+	return s.GetReservation(ctx, userID, reservationID)
+}
+
+// MarkCodes отмечает доступные или зарезервированные коды остатка использованными или
+// испорченными. Возвращает измененные коды; коды вне остатка или уже использованные
+// не изменяются.
+func (s *Service) MarkCodes(ctx context.Context, actor Actor, request MarkCodesRequest) ([]models.KIZCode, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkInventoryAccess(ctx, userID, request.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	status := models.KIZCodeStatusUsed
+	if request.Status == "spoiled" {
+		status = models.KIZCodeStatusSpoiled
+	}
+	marked, err := s.repo.MarkKIZCodes(ctx, userID, request.OrganizationID, request.Codes, status,
+		func(changes []repository.StockChange) ([]models.OutboxMessage, error) {
+			return s.lowStockMessages(userID, request.OrganizationID, changes)
+		})
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка изменения статуса кодов", err)
+	}
+
+	if len(marked) > 0 {
+		codes := make([]string, len(marked))
+		for i, code := range marked {
+			codes[i] = code.Code
+		}
+		// Коды относятся к разным запросам, поэтому запись журнала не привязана к одному объекту
+		s.recordAudit(ctx, actor, AuditActionUpdate, "kiz_codes", "", nil, map[string]any{
+			"organization_id": request.OrganizationID,
+			"status":          status,
+			"codes":           codes,
+		})
+	}
+	return marked, nil
+}
+
+// ReorderKIZs повторяет последний выполненный запрос кодов GTIN с теми же ИНН, товарной
+// группой и параметрами этикеток
+func (s *Service) ReorderKIZs(ctx context.Context, actor Actor, request ReorderRequest) (*KIZResult, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkInventoryAccess(ctx, userID, request.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	record, err := s.repo.LastKIZRequestForGTIN(ctx, userID, request.OrganizationID, request.GTIN)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Коды с этим GTIN ранее не запрашивались", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка поиска запроса КИЗ: %w", err))
+	}
+
+	var data kizRequestData
+	if len(record.RequestData) > 0 {
+		if err := json.Unmarshal(record.RequestData, &data); err != nil {
+			return nil, NewError(KindInternal, "Ошибка чтения параметров запроса", err)
+		}
+	}
+	count := request.Count
+	if count == 0 {
+		for _, gtin := range data.GTINs {
+			if gtin == request.GTIN {
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return nil, NewError(KindInvalid, "Укажите число кодов: в последнем запросе оно не сохранено", nil)
+	}
+
+	gtins := make([]string, count)
+	for i := range gtins {
+		gtins[i] = request.GTIN
+	}
+	return s.RequestKIZs(ctx, actor, KIZRequest{
+		TelegramID:     request.TelegramID,
+		GTINs:          gtins,
+		INN:            record.INN,
+		OrganizationID: record.OrganizationID,
+		ProductGroup:   record.ProductGroup,
+		LabelTemplate:  data.Template,
+		LabelFields:    data.Fields,
+		Batch:          data.Batch,
+	})
+}
+
+// Резерв кодов для передачи маркетплейсу: counts - число кодов по GTIN. Возвращает
+// коды по GTIN и ID резерва; 0, если резервировать нечего.
+func (s *Service) reserveCodes(ctx context.Context, userID, organizationID int, reference string, counts map[string]int) (map[string][]string, int, error) {
+	var items []repository.ReservationItem
+	for gtin, count := range counts {
+		if count > 0 {
+			items = append(items, repository.ReservationItem{GTIN: gtin, Count: count})
+		}
+	}
+	if len(items) == 0 {
+		return nil, 0, nil
+	}
+
+	reservation := models.KIZReservation{UserID: userID, OrganizationID: organizationID, Reference: reference}
+	err := s.repo.CreateReservation(ctx, &reservation, items, func(changes []repository.StockChange) ([]models.OutboxMessage, error) {
+		return s.lowStockMessages(userID, organizationID, changes)
+	})
+	if errors.Is(err, repository.ErrInsufficientCodes) {
+		return nil, 0, NewError(KindConflict, "Недостаточно доступных кодов", err)
+	} else if err != nil {
+		return nil, 0, NewError(KindInternal, "Ошибка резервирования кодов", err)
+	}
+
+	codes := make(map[string][]string)
+	for _, code := range reservation.Codes {
+		codes[code.GTIN] = append(codes[code.GTIN], code.Code)
+	}
+	return codes, reservation.ID, nil
+}
+
+// Завершение резерва после передачи кодов маркетплейсу: принятые коды отмечаются
+// использованными до снятия резерва, чтобы не вернуться в остаток, остальные
+// возвращаются в остаток
+func (s *Service) settleReservation(ctx context.Context, userID, organizationID, reservationID int, used []string) error {
+	if reservationID == 0 {
+		return nil
+	}
+	if len(used) > 0 {
+		if _, err := s.repo.MarkKIZCodes(ctx, userID, organizationID, used, models.KIZCodeStatusUsed,
+			func([]repository.StockChange) ([]models.OutboxMessage, error) { return nil, nil }); err != nil {
+			return NewError(KindInternal, "Коды переданы, но не отмечены использованными", err)
+		}
+	}
+	if err := s.repo.ReleaseReservation(ctx, reservationID, userID); err != nil {
+		s.logger.Printf("Ошибка снятия резерва %d: %v", reservationID, err)
+	}
+	return nil
+}
+
+// Предупреждения в Telegram о GTIN, остаток которых опустился ниже порога в результате
+// изменения; повторно предупреждение отправляется только после пополнения остатка
+func (s *Service) lowStockMessages(userID, organizationID int, changes []repository.StockChange) ([]models.OutboxMessage, error) {
+	if s.inventoryLowStock == 0 {
+		return nil, nil
+	}
+
+	builder := s.outbox()
+	for _, change := range changes {
+		if change.After >= s.inventoryLowStock || change.Before < s.inventoryLowStock {
+			continue
+		}
+		text := fmt.Sprintf("Заканчиваются коды маркировки GTIN %s: осталось %d.\n"+
+			"Повторить последний запрос кодов: /reorder_%s", change.GTIN, change.After, change.GTIN)
+		if organizationID > 0 {
+			text += fmt.Sprintf("_%d", organizationID)
+		}
+		builder.telegram(userID, text)
+	}
+	return builder.build()
+}
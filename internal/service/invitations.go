@@ -0,0 +1,399 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"project-znak/internal/mailer"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/validate"
+	"project-znak/internal/xlsx"
+)
+
+// Префикс параметра start в ссылке на бота, по которому бот узнает код приглашения
+const invitationStartPrefix = "inv_"
+
+// Ограничения импорта пользователей
+const (
+	invitationTTL     = 30 * 24 * time.Hour // Срок действия приглашения
+	userImportMaxRows = 1000                // Наибольшее число строк в загружаемом файле
+)
+
+// Названия колонок файла импорта пользователей без учета регистра
+var userImportColumns = map[string]string{
+	"инн":               "inn",
+	"inn":               "inn",
+	"email":             "email",
+	"e-mail":            "email",
+	"почта":             "email",
+	"электронная почта": "email",
+	"telegram":          "telegram",
+	"телеграм":          "telegram",
+	"username":          "telegram",
+}
+
+// UserImportResult - итог обработки строки файла импорта: созданное приглашение
+// или причина, по которой оно не создано
+type UserImportResult struct {
+	Row          int             `json:"row" xml:"row"`
+	INN          string          `json:"inn" xml:"inn"`
+	Email        string          `json:"email,omitempty" xml:"email,omitempty"`
+	Telegram     string          `json:"telegram,omitempty" xml:"telegram,omitempty"`
+	UserID       int             `json:"user_id,omitempty" xml:"user_id,omitempty"`
+	InvitationID int             `json:"invitation_id,omitempty" xml:"invitation_id,omitempty"`
+	Code         string          `json:"code,omitempty" xml:"code,omitempty"` // Код приглашения для регистрации в боте
+	Link         string          `json:"link,omitempty" xml:"link,omitempty"`
+	EmailSent    bool            `json:"email_sent,omitempty" xml:"email_sent,omitempty"`
+	Error        string          `json:"error,omitempty" xml:"error,omitempty"`
+	Errors       validate.Errors `json:"errors,omitempty" xml:"errors,omitempty"`
+}
+
+// Строка файла импорта, проверяемая по тегам validate
+type userImportEntry struct {
+	INN      string `json:"inn" validate:"required,inn"`
+	Email    string `json:"email" validate:"email"`
+	Telegram string `json:"telegram" validate:"telegram_username"`
+}
+
+// Данные письма с приглашением
+type invitationEmail struct {
+	INN         string
+	PartnerName string
+	Link        string
+	ExpiresAt   time.Time
+}
+
+// ImportUsers создает пользователей с организациями и приглашения для них из файла CSV или
+// XLSX с колонками «ИНН», «Email» и «Telegram». Аккаунт Telegram привязывается к пользователю,
+// когда тот открывает бота по ссылке или регистрируется с кодом приглашения. Если указан партнер,
+// организации приглашенных становятся его субаккаунтами. Строки обрабатываются
+// независимо: ошибка одной строки не отменяет приглашения остальных.
+func (s *Service) ImportUsers(ctx context.Context, actor Actor, data []byte, partnerTelegramID int64) ([]UserImportResult, error) {
+	createdBy, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	var partner *models.Partner
+	if partnerTelegramID != 0 {
+		partnerUserID, err := s.UserIDByTelegram(ctx, partnerTelegramID)
+		if err != nil {
+			return nil, err
+		}
+		if partnerUserID != 0 {
+			partner, err = s.repo.PartnerByUser(ctx, partnerUserID)
+		}
+		if partnerUserID == 0 || errors.Is(err, repository.ErrNotFound) {
+			return nil, NewError(KindNotFound, "Партнер не найден", nil)
+		} else if err != nil {
+			return nil, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка получения партнера: %w", err))
+		}
+	}
+
+	results, err := parseUserImport(data)
+	if err != nil {
+		return nil, NewError(KindInvalid, "Некорректный файл пользователей", err)
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool, len(results))
+	for i := range results {
+		result := &results[i]
+		if ctx.Err() != nil {
+			result.Error = "Строка не обработана: загрузка прервана"
+			continue
+		}
+
+		err := ValidateRequest(userImportEntry{INN: result.INN, Email: result.Email, Telegram: result.Telegram})
+		var serviceErr *Error
+		if errors.As(err, &serviceErr) {
+			result.Error, result.Errors = serviceErr.Message, serviceErr.Fields
+			continue
+		}
+		if seen[result.INN] {
+			result.Error = "ИНН повторяется в файле"
+			continue
+		}
+		seen[result.INN] = true
+
+		invitation := models.Invitation{
+			INN:       result.INN,
+			Email:     result.Email,
+			Username:  models.NormalizeTelegramUsername(result.Telegram),
+			CreatedBy: createdBy,
+			ExpiresAt: now.Add(invitationTTL),
+		}
+		if partner != nil {
+			invitation.PartnerID = partner.ID
+		}
+		code, err := s.createInvitation(ctx, actor, &invitation, now)
+		switch {
+		case err == nil:
+		case errors.As(err, &serviceErr):
+			result.Error = serviceErr.Message
+			if serviceErr.Kind == KindInternal {
+				s.logger.Printf("Ошибка импорта пользователя с ИНН %s: %v", result.INN, err)
+			}
+			continue
+		default:
+			result.Error = err.Error()
+			continue
+		}
+
+		result.UserID = invitation.UserID
+		result.InvitationID = invitation.ID
+		result.Code = invitationStartPrefix + code
+		if s.referral.BotUsername != "" {
+			result.Link = fmt.Sprintf("https://t.me/%s?start=%s", s.referral.BotUsername, result.Code)
+		}
+		if invitation.Email != "" && result.Link != "" && s.mailer.Enabled() {
+			data := invitationEmail{INN: invitation.INN, Link: result.Link, ExpiresAt: invitation.ExpiresAt}
+			if partner != nil {
+				data.PartnerName = partner.Name
+			}
+			if err := s.sendInvitationEmail(invitation.Email, data); err != nil {
+				s.logger.Printf("Ошибка отправки приглашения на %s: %v", invitation.Email, err)
+			} else {
+				result.EmailSent = true
+			}
+		}
+	}
+	return results, nil
+}
+
+// Создание пользователя с организацией и приглашения для ИНН, по которому еще нет
+// организации и действующего приглашения. Если пользователь уже создан прежним приглашением,
+// срок которого истек, ему выдается новое. Возвращает код приглашения; в БД хранится
+// только его хэш.
+func (s *Service) createInvitation(ctx context.Context, actor Actor, invitation *models.Invitation, now time.Time) (string, error) {
+	pending, err := s.repo.HasPendingInvitation(ctx, invitation.INN, now)
+	if err != nil {
+		return "", NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка проверки приглашений: %w", err))
+	}
+	if pending {
+		return "", NewError(KindConflict, "Для организации с таким ИНН уже есть действующее приглашение", nil)
+	}
+	exists, err := s.repo.OrganizationExists(ctx, invitation.INN)
+	if err != nil {
+		return "", NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка проверки организации: %w", err))
+	}
+	if exists {
+		if invitation.UserID, err = s.repo.UnboundUserByINN(ctx, invitation.INN); err != nil {
+			return "", NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка проверки пользователя: %w", err))
+		}
+		if invitation.UserID == 0 {
+			return "", NewError(KindConflict, "Организация с таким ИНН уже зарегистрирована", nil)
+		}
+	}
+
+	code, err := generateInvitationCode()
+	if err != nil {
+		return "", NewError(KindInternal, "Ошибка при обработке запроса", err)
+	}
+	if invitation.UserID != 0 {
+		if err := s.repo.CreateInvitation(ctx, invitation, hashInvitationCode(code)); err != nil {
+			return "", NewError(KindInternal, "Ошибка создания приглашения", err)
+		}
+		s.recordAudit(ctx, actor, AuditActionCreate, "invitation", invitation.ID, nil, invitation)
+		return code, nil
+	}
+
+	organizationName, err := s.lookupOrganizationName(ctx, invitation.INN)
+	if err != nil {
+		return "", NewError(KindInvalid, err.Error(), nil)
+	}
+	user := models.User{
+		INN:              invitation.INN,
+		Email:            invitation.Email,
+		OrganizationName: organizationName,
+		Username:         invitation.Username,
+	}
+	err = s.repo.CreateInvitedUser(ctx, &user, invitation, hashInvitationCode(code))
+	if errors.Is(err, repository.ErrOrganizationExists) {
+		return "", NewError(KindConflict, "Организация с таким ИНН уже зарегистрирована", nil)
+	} else if err != nil {
+		return "", NewError(KindInternal, "Ошибка создания приглашения", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "user", user.ID, nil, map[string]string{
+		"inn":               user.INN,
+		"email":             user.Email,
+		"organization_name": organizationName,
+	})
+	s.recordAudit(ctx, actor, AuditActionCreate, "invitation", invitation.ID, nil, invitation)
+	return code, nil
+}
+
+// Отправка письма с приглашением на адрес из файла импорта
+func (s *Service) sendInvitationEmail(to string, data invitationEmail) error {
+	html, err := mailer.Render(mailer.TemplateInvitation, data, s.defaultTimezone)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(mailer.Message{To: to, Subject: "Приглашение в Project Znak", HTML: html})
+}
+
+// Генерация кода приглашения
+func generateInvitationCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Хэш кода приглашения, под которым приглашение хранится в БД
+func hashInvitationCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimPrefix(strings.TrimSpace(code), invitationStartPrefix))))
+	return hex.EncodeToString(sum[:])
+}
+
+// pendingInvitation возвращает действующее приглашение по коду или параметру start ссылки
+func (s *Service) pendingInvitation(ctx context.Context, code string) (*models.Invitation, error) {
+	invitation, err := s.repo.PendingInvitation(ctx, hashInvitationCode(code), time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindInvalid, "Приглашение не найдено или истек срок его действия", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка получения приглашения: %w", err))
+	}
+	return invitation, nil
+}
+
+// Регистрация по приглашению с созданным заранее пользователем: к пользователю привязывается
+// аккаунт Telegram и выдается API ключ
+func (s *Service) registerInvited(ctx context.Context, actor Actor, invitation *models.Invitation, telegramID int64) (*RegistrationResult, error) {
+	existingID, err := s.UserIDByTelegram(ctx, telegramID)
+	if err != nil {
+		return nil, err
+	}
+	if existingID != 0 {
+		return nil, NewError(KindConflict, "Аккаунт Telegram уже зарегистрирован, приглашение предназначено для нового пользователя", nil)
+	}
+
+	organizationName, err := s.repo.BindInvitation(ctx, invitation, telegramID)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, NewError(KindInvalid, "Приглашение не найдено или истек срок его действия", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка привязки аккаунта Telegram: %w", err))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "user", invitation.UserID, nil, map[string]any{
+		"telegram_id": telegramID,
+	})
+	s.recordAudit(ctx, actor, AuditActionUpdate, "invitation", invitation.ID, nil, map[string]any{
+		"accepted_by": invitation.UserID,
+	})
+
+	result := &RegistrationResult{UserID: invitation.UserID, OrganizationName: organizationName}
+	key, apiKey, err := s.issueAPIKey(ctx, invitation.UserID, "default", nil)
+	if err != nil {
+		s.logger.Printf("Ошибка создания API ключа: %v", err)
+	} else {
+		s.recordAudit(ctx, actor, AuditActionCreate, "api_key", key.ID, nil, key)
+		result.APIKey = apiKey
+	}
+	return result, nil
+}
+
+// Отметка приглашения использованным. Ошибка не отменяет регистрацию и только
+// записывается в журнал.
+func (s *Service) acceptInvitation(ctx context.Context, actor Actor, invitation *models.Invitation, userID int) {
+	accepted, err := s.repo.AcceptInvitation(ctx, invitation.ID, userID)
+	if err != nil {
+		s.logger.Printf("Ошибка закрытия приглашения %d: %v", invitation.ID, err)
+		return
+	}
+	if !accepted {
+		s.logger.Printf("Приглашение %d уже использовано", invitation.ID)
+		return
+	}
+	s.recordAudit(ctx, actor, AuditActionUpdate, "invitation", invitation.ID, nil, map[string]any{
+		"accepted_by": userID,
+	})
+}
+
+// Чтение строк таблицы из файла XLSX (первый лист) или CSV (разделитель ";" или ",",
+// кодировка UTF-8, BOM допускается). Читается не более maxRows строк.
+func readTable(data []byte, maxRows int) ([][]string, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		rows, err := xlsx.Read(data)
+		if err != nil {
+			return nil, err
+		}
+		return rows[:min(len(rows), maxRows)], nil
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = ';'
+	if line, _, _ := bytes.Cut(data, []byte("\n")); !bytes.Contains(line, []byte(";")) {
+		reader.Comma = ','
+	}
+	reader.FieldsPerRecord = -1
+	var records [][]string
+	for len(records) < maxRows {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("ошибка чтения CSV: %w", err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Разбор файла импорта пользователей. Книга XLSX определяется по сигнатуре ZIP-архива,
+// остальное разбирается как CSV с разделителем ";" или ",".
+func parseUserImport(data []byte) ([]UserImportResult, error) {
+	records, err := readTable(data, userImportMaxRows+2)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("файл пуст")
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		if column, ok := userImportColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			if _, dup := columns[column]; !dup {
+				columns[column] = i
+			}
+		}
+	}
+	if _, ok := columns["inn"]; !ok {
+		return nil, errors.New(`в файле нет колонки "ИНН"`)
+	}
+
+	var results []UserImportResult
+	for i, record := range records[1:] {
+		if i >= userImportMaxRows {
+			return nil, fmt.Errorf("файл содержит более %d строк", userImportMaxRows)
+		}
+		field := func(name string) string {
+			if index, ok := columns[name]; ok && index < len(record) {
+				return strings.TrimSpace(record[index])
+			}
+			return ""
+		}
+		result := UserImportResult{Row: i + 2, INN: field("inn"), Email: field("email"), Telegram: field("telegram")}
+		if result.INN == "" && result.Email == "" && result.Telegram == "" {
+			continue
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil, errors.New("в файле нет строк с данными")
+	}
+	return results, nil
+}
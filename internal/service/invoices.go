@@ -0,0 +1,197 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"project-znak/internal/invoice"
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+	"project-znak/internal/repository"
+	"project-znak/internal/tracing"
+)
+
+// InvoicePaidRequest - подтверждение оплаты счета администратором
+type InvoicePaidRequest struct {
+	PaymentOrderNumber string `json:"payment_order_number" validate:"required,max=32"`
+}
+
+// Оплата по счету доступна, если заданы ИНН и расчетный счет поставщика
+func (s *Service) invoicesEnabled() bool {
+	return s.invoice.INN != "" && s.invoice.BankAccount != ""
+}
+
+// IssueInvoice выставляет организации счет на оплату заказа банковским переводом.
+// Если по заказу уже выставлен неоплаченный счет, возвращается он.
+func (s *Service) IssueInvoice(ctx context.Context, actor Actor, orderID int) (*models.Invoice, error) {
+	if !s.invoicesEnabled() {
+		return nil, NewError(KindInvalid, "Оплата по счету не настроена", nil)
+	}
+
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := s.GetOrder(ctx, userID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if details.OrganizationID == 0 {
+		return nil, NewError(KindInvalid, "Счет выставляется только по заказу организации", nil)
+	}
+
+	now := time.Now()
+	inv := models.Invoice{
+		OrderID:        orderID,
+		OrganizationID: details.OrganizationID,
+		UserID:         userID,
+		Amount:         money.FromFloat(details.TotalAmount, money.RUB),
+		DueDate:        time.Date(now.Year(), now.Month(), now.Day()+s.invoice.DueDays, 0, 0, 0, 0, now.Location()),
+	}
+
+	created, err := s.repo.IssueInvoice(ctx, &inv)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Заказ не найден", nil)
+	} else if errors.Is(err, repository.ErrOrderNotPayable) {
+		return nil, NewError(KindConflict, "Заказ не может быть оплачен в текущем статусе", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка выставления счета", err)
+	}
+
+	if created {
+		s.recordAudit(ctx, actor, AuditActionCreate, "invoice", inv.ID, nil, inv)
+	}
+	return &inv, nil
+}
+
+// InvoicePDF возвращает последний выставленный по заказу счет и его PDF
+func (s *Service) InvoicePDF(ctx context.Context, userID, orderID int) (*models.Invoice, []byte, error) {
+	details, err := s.GetOrder(ctx, userID, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inv, err := s.repo.OrderInvoice(ctx, orderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, NewError(KindNotFound, "Счет по заказу не выставлен", nil)
+	} else if err != nil {
+		return nil, nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения счета: %w", err))
+	}
+
+	buyer, err := s.repo.Organization(ctx, inv.OrganizationID)
+	if err != nil {
+		return nil, nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения организации: %w", err))
+	}
+
+	data, err := s.renderInvoice(ctx, inv, details.Items, buyer)
+	if err != nil {
+		return nil, nil, NewError(KindInternal, "Ошибка генерации PDF", err)
+	}
+	return inv, data, nil
+}
+
+// Формирование PDF счета по позициям заказа
+func (s *Service) renderInvoice(ctx context.Context, inv *models.Invoice, items []models.OrderItem, buyer *models.Organization) (_ []byte, err error) {
+	_, span := tracing.Start(ctx, "invoice.render_pdf", attribute.String("invoice.number", inv.Number))
+	defer func() { tracing.End(span, err) }()
+
+	document := invoice.Invoice{
+		Number:  inv.Number,
+		Date:    inv.CreatedAt,
+		DueDate: inv.DueDate,
+		Seller: invoice.Party{
+			Name:        s.invoice.SellerName,
+			INN:         s.invoice.INN,
+			KPP:         s.invoice.KPP,
+			Address:     s.invoice.Address,
+			BankName:    s.invoice.BankName,
+			BIK:         s.invoice.BIK,
+			BankAccount: s.invoice.BankAccount,
+			CorrAccount: s.invoice.CorrAccount,
+		},
+		Buyer: invoice.Party{
+			Name:    buyer.Name,
+			INN:     buyer.INN,
+			KPP:     buyer.KPP,
+			Address: buyer.Address,
+		},
+		VATRate: s.invoice.VATRate,
+	}
+	if document.Buyer.Name == "" {
+		document.Buyer.Name = "Организация"
+	}
+
+	for _, item := range items {
+		name := item.ProductName
+		if name == "" {
+			name = "GTIN " + item.GTIN
+		}
+		document.Items = append(document.Items, invoice.Item{
+			Name:     "Коды маркировки: " + name,
+			Quantity: item.Quantity,
+			Price:    item.Price,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := invoice.Render(&buf, &document); err != nil {
+		return nil, fmt.Errorf("ошибка создания PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// MarkInvoicePaid отмечает счет оплаченным по платежному поручению: создает проведенный
+// платеж, переводит заказ в статус оплаченного и отправляет квитанцию
+func (s *Service) MarkInvoicePaid(ctx context.Context, actor Actor, invoiceID int, request InvoicePaidRequest) (*models.Invoice, error) {
+	request.PaymentOrderNumber = strings.TrimSpace(request.PaymentOrderNumber)
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	number := request.PaymentOrderNumber
+
+	now := time.Now()
+	inv, err := s.repo.PayInvoice(ctx, invoiceID, number, now, func(inv *models.Invoice) ([]models.OutboxMessage, error) {
+		return s.paymentReceiptMessages(inv.UserID, paymentReceiptEmail{
+			PaymentID:   inv.PaymentID,
+			OrderID:     inv.OrderID,
+			Amount:      inv.Amount,
+			CompletedAt: now,
+		})
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Счет не найден", nil)
+	} else if errors.Is(err, repository.ErrInvoiceNotIssued) {
+		return nil, NewError(KindConflict, "Счет уже оплачен или отменен", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка подтверждения оплаты", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "invoice", invoiceID,
+		map[string]string{"status": models.InvoiceStatusIssued},
+		map[string]any{"status": models.InvoiceStatusPaid, "payment_order_number": number, "payment_id": inv.PaymentID})
+	s.enqueueFiscalReceipt(ctx, inv.PaymentID)
+	s.creditReferralBonus(ctx, actor, inv.UserID, inv.PaymentID, inv.Amount)
+	return inv, nil
+}
+
+// ListInvoices возвращает счета с указанным статусом; все счета, если статус не задан
+func (s *Service) ListInvoices(ctx context.Context, status string, limit int) ([]models.Invoice, error) {
+	switch status {
+	case "", models.InvoiceStatusIssued, models.InvoiceStatusPaid, models.InvoiceStatusCancelled:
+	default:
+		return nil, NewError(KindInvalid, "Недопустимый статус счета", nil)
+	}
+
+	invoices, err := s.repo.ListInvoices(ctx, status, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса счетов: %w", err))
+	}
+	return invoices, nil
+}
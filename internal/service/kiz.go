@@ -0,0 +1,686 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/labels"
+	"project-znak/internal/models"
+	"project-znak/internal/oms"
+	"project-znak/internal/repository"
+	"project-znak/internal/tracing"
+	"project-znak/internal/transport"
+)
+
+// Время хранения PDF с кодами маркировки после формирования
+const kizFileLifetime = time.Hour
+
+// Число попыток запроса кодов, после которого запрос получает статус dead
+const kizMaxAttempts = 5
+
+// Параметры запроса КИЗ, сохраняемые в request_data для этикеток и повтора запроса
+type kizRequestData struct {
+	kizLabelData
+	GTINs []string `json:"gtins,omitempty"`
+}
+
+// KIZRequest - запрос кодов маркировки. Каждое вхождение GTIN в списке - один код.
+type KIZRequest struct {
+	TelegramID     int64    `json:"telegram_id" validate:"required,min=1"`
+	GTINs          []string `json:"gtins" validate:"required,dive,required,gtin"`
+	INN            string   `json:"inn" validate:"required_without=organization_id,inn"`
+	OrderID        int      `json:"order_id,omitempty"`
+	OrganizationID int      `json:"organization_id,omitempty"`
+	ProductGroup   string   `json:"product_group,omitempty" validate:"product_group"`   // Товарная группа СУЗ: milk, shoes, lp, water...
+	LabelTemplate  string   `json:"label_template,omitempty" validate:"label_template"` // Шаблон этикеток; по умолчанию - шаблон пользователя
+	LabelFields    []string `json:"label_fields,omitempty" validate:"dive,label_field"` // Поля этикетки: code, gtin, name, batch, date
+	Batch          string   `json:"batch,omitempty"`                                    // Номер партии для этикеток
+	LabelDate      string   `json:"label_date,omitempty" validate:"date"`               // Дата производства для этикеток, ГГГГ-ММ-ДД; по умолчанию - текущая
+}
+
+// KIZResult - результат запроса КИЗ
+type KIZResult struct {
+	RequestID int
+	KIZs      []string
+	FilePath  string
+}
+
+// RequestKIZs запрашивает коды маркировки: проверяет параметры и организацию,
+// сохраняет запрос, получает коды из API Честного ЗНАКа и формирует PDF
+func (s *Service) RequestKIZs(ctx context.Context, actor Actor, request KIZRequest) (*KIZResult, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	// Определение организации, от имени которой запрашиваются КИЗ
+	userID, organizationID, err := s.resolveKIZOrganization(ctx, &request)
+	if errors.Is(err, repository.ErrNotOrganizationMember) {
+		return nil, NewError(KindForbidden, "Пользователь не состоит в указанной организации", nil)
+	} else if err != nil {
+		return nil, fmt.Errorf("ошибка выбора организации: %w", err)
+	}
+	// Право проверяется по организации, выбранной для запроса: она определяется и по ИНН,
+	// а запрос КИЗ выполняют также расписания заказов и пополнение остатка
+	if organizationID > 0 {
+		if err := s.Authorize(ctx, userID, organizationID, models.PermKIZRequest); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := models.ValidateINN(request.INN); err != nil {
+		return nil, NewError(KindInvalid, "Некорректный ИНН", err)
+	}
+
+	if err := validateLabelOptions(request.LabelTemplate, request.LabelFields); err != nil {
+		return nil, err
+	}
+	// Дата на этикетке по умолчанию - текущий день в часовом поясе пользователя
+	labelDate := time.Now().In(s.UserLocation(ctx, userID))
+	if request.LabelDate != "" {
+		labelDate, _ = time.Parse(documentDateLayout, request.LabelDate)
+	}
+
+	if err := s.resolveKIZProductGroup(ctx, userID, &request); err != nil {
+		return nil, err
+	}
+
+	// Коды учитываются в квоте тарифного плана до обращения к Честному ЗНАКу
+	if _, err := s.consumeQuota(ctx, userID, models.QuotaCodes, len(request.GTINs)); err != nil {
+		return nil, err
+	}
+
+	// Запрос сохраняется до обращения к Честному ЗНАКу, чтобы его можно было повторить при ошибке
+	requestID, err := s.repo.CreateKIZRequest(ctx, repository.NewKIZRequest{
+		UserID:         userID,
+		TelegramID:     request.TelegramID,
+		INN:            request.INN,
+		OrderID:        request.OrderID,
+		OrganizationID: organizationID,
+		ProductGroup:   request.ProductGroup,
+		RequestTime:    time.Now(),
+		RequestData: kizRequestData{
+			kizLabelData: kizLabelData{
+				Template: request.LabelTemplate,
+				Fields:   request.LabelFields,
+				Batch:    request.Batch,
+				Date:     labelDate.Format(documentDateLayout),
+			},
+			GTINs: request.GTINs,
+		},
+		CodesRequested: len(request.GTINs),
+	})
+	if err != nil {
+		s.logger.Printf("Ошибка записи в БД: %v", err)
+		// Продолжаем выполнение, это не критическая ошибка
+	} else {
+		s.recordAudit(ctx, actor, AuditActionCreate, "kiz_request", requestID, nil, map[string]any{
+			"inn":             request.INN,
+			"gtins":           request.GTINs,
+			"order_id":        request.OrderID,
+			"organization_id": organizationID,
+			"product_group":   request.ProductGroup,
+		})
+	}
+
+	result, err := s.fulfillKIZRequest(ctx, userID, requestID, request, labelDate)
+	if err != nil && len(result.KIZs) == 0 {
+		s.releaseQuota(ctx, userID, models.QuotaCodes, len(request.GTINs))
+	}
+	return result, err
+}
+
+// Получение кодов по сохраненному запросу, формирование PDF и отправка файла пользователю.
+// Ход выполнения сохраняется в запросе по мере получения кодов, ход эмиссии - в контрольных
+// точках, с которых запрос продолжается после ошибки или сбоя процесса. При ошибке запрос
+// отмечается неудачным; результат с номером запроса возвращается вместе с ошибкой, чтобы
+// запрос можно было повторить.
+func (s *Service) fulfillKIZRequest(ctx context.Context, userID, requestID int, request KIZRequest, labelDate time.Time) (*KIZResult, error) {
+	stop := s.kizHeartbeat(requestID)
+	defer stop()
+
+	result := &KIZResult{RequestID: requestID}
+	progress := s.newKIZProgress(ctx, requestID)
+	checkpoints, err := s.loadKIZCheckpoints(ctx, requestID)
+	if err == nil {
+		result.KIZs, err = s.orderKIZs(transport.WithSubject(ctx, "kiz_request", requestID), request, checkpoints, progress)
+	}
+	progress.flush()
+	if err != nil {
+		s.failKIZRequest(ctx, requestID, err)
+		go s.notifyFailure(userID, "Запрос кодов маркировки", "не удалось получить коды в Честном ЗНАКе")
+		return result, chestnyZnakError("Ошибка запроса кодов маркировки", err)
+	}
+
+	// Генерация PDF
+	tmpl, fields := s.kizLabelOptions(ctx, userID, request)
+	result.FilePath, err = s.generateKIZPDF(ctx, tmpl, fields, s.kizLabels(ctx, result.KIZs, request.Batch, labelDate))
+	if err != nil {
+		s.failKIZRequest(ctx, requestID, err)
+		go s.notifyFailure(userID, "Запрос кодов маркировки", "не удалось сформировать файл с кодами")
+		return result, NewError(KindInternal, "Ошибка генерации PDF", err)
+	}
+	progress.fileGenerated()
+
+	// Сохранение кодов для последующего ввода товаров в оборот
+	if result.RequestID > 0 {
+		duplicates, err := s.repo.SaveKIZResult(ctx, result.RequestID, result.KIZs, result.FilePath)
+		if err != nil {
+			s.logger.Printf("Ошибка сохранения кодов маркировки запроса %d: %v", result.RequestID, err)
+		} else {
+			s.kizEvents.publish(result.RequestID)
+			if len(duplicates) > 0 {
+				s.alertKIZDuplicates(ctx, result.RequestID, duplicates)
+			}
+			if err := s.repo.DeleteKIZCheckpoints(ctx, result.RequestID); err != nil {
+				s.logger.Printf("Ошибка удаления контрольных точек запроса КИЗ %d: %v", result.RequestID, err)
+			}
+		}
+	}
+
+	go s.notifyKIZReady(userID, request.INN, *result)
+	go s.deliverKIZFile(userID, request.TelegramID, *result)
+
+	return result, nil
+}
+
+// Предупреждение о кодах, уже выданных ранее. Честный ЗНАК не должен выдавать код
+// повторно, поэтому дубликат означает ошибку на его стороне или повтор заказа.
+func (s *Service) alertKIZDuplicates(ctx context.Context, requestID int, duplicates []string) {
+	text := fmt.Sprintf("В ответе на запрос КИЗ %d получено уже выданных ранее кодов: %d. Первый из них: %s",
+		requestID, len(duplicates), duplicates[0])
+	s.logger.Printf("Предупреждение: %s", text)
+
+	if s.telegram.Enabled() && s.adminChatID != 0 {
+		if err := s.telegram.SendMessage(context.WithoutCancel(ctx), s.adminChatID, text); err != nil {
+			s.logger.Printf("Ошибка отправки предупреждения в чат администраторов: %v", err)
+		}
+	}
+}
+
+// Сохранение ошибки запроса с ответом Честного ЗНАКа или СУЗ. Отказ API по существу
+// переводит запрос в статус dead: повторять его без изменений бессмысленно.
+func (s *Service) failKIZRequest(ctx context.Context, requestID int, cause error) {
+	if requestID == 0 {
+		return
+	}
+
+	var payload []byte
+	var czErr *chestnyznak.APIError
+	var omsErr *oms.APIError
+	permanent := errors.Is(cause, oms.ErrRejected)
+	switch {
+	case errors.As(cause, &czErr):
+		payload, permanent = czErr.Payload, czErr.Permanent()
+	case errors.As(cause, &omsErr):
+		payload, permanent = omsErr.Payload, omsErr.Permanent()
+	}
+
+	status, err := s.repo.FailKIZRequest(context.WithoutCancel(ctx), requestID, cause.Error(), string(payload),
+		permanent, kizMaxAttempts)
+	if err != nil {
+		s.logger.Printf("Ошибка сохранения ошибки запроса КИЗ %d: %v (%v)", requestID, err, cause)
+		return
+	}
+	s.kizEvents.publish(requestID)
+	s.recordAudit(ctx, Actor{}, AuditActionUpdate, "kiz_request", requestID,
+		map[string]string{"status": models.KIZRequestStatusPending},
+		map[string]string{"status": status, "error": cause.Error()})
+}
+
+// RetryKIZRequest повторяет запрос кодов маркировки, завершившийся ошибкой. Пользователь
+// может повторить свой запрос в статусе failed; администратор (force) - любой запрос
+// с ошибкой, в том числе отклоненный. Эмиссия продолжается с контрольных точек; отклоненный
+// запрос выполняется заново.
+func (s *Service) RetryKIZRequest(ctx context.Context, actor Actor, userID, requestID int, force bool) (*KIZResult, error) {
+	record, err := s.repo.KIZRequest(ctx, requestID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && !force && record.UserID != userID) {
+		return nil, NewError(KindNotFound, "Запрос не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса КИЗ: %w", err))
+	}
+
+	switch record.Status {
+	case models.KIZRequestStatusCompleted:
+		return nil, NewError(KindConflict, "Коды по запросу уже получены", nil)
+	case models.KIZRequestStatusPending:
+		return nil, NewError(KindConflict, "Запрос еще выполняется", nil)
+	case models.KIZRequestStatusReceived:
+		return nil, NewError(KindConflict, "Коды приняты от поставщика по УПД и не запрашиваются повторно", nil)
+	case models.KIZRequestStatusDead:
+		if !force {
+			return nil, NewError(KindConflict, "Запрос отклонен и не может быть повторен; создайте новый запрос", nil)
+		}
+	}
+
+	request, labelDate, err := s.kizRequestFromRecord(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+
+	// Повтор администратором не учитывается в квоте пользователя
+	if !force {
+		if _, err := s.consumeQuota(ctx, record.UserID, models.QuotaCodes, len(request.GTINs)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.RetryKIZRequest(ctx, requestID, record.Version, force); errors.Is(err, repository.ErrNotFound) {
+		err = NewError(KindConflict, "Запрос уже повторяется", nil)
+	} else if errors.Is(err, repository.ErrConflict) {
+		err = versionConflict("Запрос изменен другим запросом")
+	} else if err != nil {
+		err = NewError(KindInternal, "Ошибка повтора запроса", err)
+	}
+	if err != nil {
+		if !force {
+			s.releaseQuota(ctx, record.UserID, models.QuotaCodes, len(request.GTINs))
+		}
+		return nil, err
+	}
+	s.kizEvents.publish(requestID)
+	s.recordAudit(ctx, actor, AuditActionUpdate, "kiz_request", requestID,
+		map[string]string{"status": record.Status},
+		map[string]string{"status": models.KIZRequestStatusPending})
+
+	// Заказ отклоненного запроса не продолжается
+	if record.Status == models.KIZRequestStatusDead {
+		if err := s.repo.DeleteKIZCheckpoints(ctx, requestID); err != nil {
+			s.logger.Printf("Ошибка удаления контрольных точек запроса КИЗ %d: %v", requestID, err)
+		}
+	}
+
+	result, err := s.fulfillKIZRequest(ctx, record.UserID, requestID, request, labelDate)
+	if err != nil && len(result.KIZs) == 0 && !force {
+		s.releaseQuota(ctx, record.UserID, models.QuotaCodes, len(request.GTINs))
+	}
+	return result, err
+}
+
+// Параметры сохраненного запроса КИЗ и дата на этикетке
+func (s *Service) kizRequestFromRecord(ctx context.Context, record *repository.KIZRequestRecord) (KIZRequest, time.Time, error) {
+	var data kizRequestData
+	if len(record.RequestData) > 0 {
+		if err := json.Unmarshal(record.RequestData, &data); err != nil {
+			return KIZRequest{}, time.Time{}, NewError(KindInternal, "Ошибка чтения параметров запроса", err)
+		}
+	}
+	if len(data.GTINs) == 0 {
+		return KIZRequest{}, time.Time{}, NewError(KindConflict, "В запросе не сохранены GTIN; создайте новый запрос", nil)
+	}
+	labelDate, err := time.Parse(documentDateLayout, data.Date)
+	if err != nil {
+		labelDate = time.Now().In(s.UserLocation(ctx, record.UserID))
+	}
+
+	return KIZRequest{
+		TelegramID:     record.TelegramID,
+		GTINs:          data.GTINs,
+		INN:            record.INN,
+		OrderID:        record.OrderID,
+		OrganizationID: record.OrganizationID,
+		ProductGroup:   record.ProductGroup,
+		LabelTemplate:  data.Template,
+		LabelFields:    data.Fields,
+		Batch:          data.Batch,
+		LabelDate:      data.Date,
+	}, labelDate, nil
+}
+
+// ListFailedKIZRequests возвращает запросы КИЗ с ошибкой: failed, dead или оба, если статус не задан
+func (s *Service) ListFailedKIZRequests(ctx context.Context, status string, limit int) ([]repository.KIZRequestRecord, error) {
+	switch status {
+	case "", models.KIZRequestStatusFailed, models.KIZRequestStatusDead:
+	default:
+		return nil, NewError(KindInvalid, "Недопустимый статус запроса", nil)
+	}
+
+	requests, err := s.repo.ListFailedKIZRequests(ctx, status, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса КИЗ с ошибками: %w", err))
+	}
+	return requests, nil
+}
+
+// KIZRequestOrganizationID возвращает организацию, от имени которой сделан запрос КИЗ; 0 для личного запроса
+func (s *Service) KIZRequestOrganizationID(ctx context.Context, requestID int) (int, error) {
+	organizationID, err := s.repo.KIZRequestOrganizationID(ctx, requestID)
+	if err != nil {
+		return 0, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса КИЗ: %w", err))
+	}
+	return organizationID, nil
+}
+
+// Наибольшее число кодов в одном запросе проверки выдачи
+const maxKIZLookupCodes = 100
+
+// LookupKIZCodes возвращает сведения о кодах из списка, выданных по запросам пользователя
+// или его организаций. Коды, не найденные среди выданных, в ответ не включаются.
+func (s *Service) LookupKIZCodes(ctx context.Context, userID int, codes []string) ([]models.KIZCode, error) {
+	if len(codes) == 0 {
+		return nil, NewError(KindInvalid, "Необходимо указать коды маркировки", nil)
+	}
+	if len(codes) > maxKIZLookupCodes {
+		return nil, NewError(KindInvalid, fmt.Sprintf("Можно проверить не более %d кодов за запрос", maxKIZLookupCodes), nil)
+	}
+
+	issued, err := s.repo.IssuedKIZCodes(ctx, userID, codes)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса кодов: %w", err))
+	}
+	return issued, nil
+}
+
+// Получение кодов маркировки. Если указана товарная группа и настроена СУЗ, коды
+// эмитируются через СУЗ; иначе запрашиваются в API Честного ЗНАКа. Большие запросы
+// разбиваются на несколько заказов. Если ЭЦП не настроена, возвращаются тестовые коды.
+// Ход эмиссии каждого заказа сохраняется в checkpoints и продолжается с них; выпущенные
+// и полученные коды учитываются в progress.
+func (s *Service) orderKIZs(ctx context.Context, request KIZRequest, checkpoints *kizCheckpoints,
+	progress *kizProgress) ([]string, error) {
+	var gtinData []chestnyznak.GTINData
+	index := make(map[string]int)
+	for _, gtin := range request.GTINs {
+		gtin = models.NormalizeGTIN(gtin)
+		if i, ok := index[gtin]; ok {
+			gtinData[i].Count++
+			continue
+		}
+		index[gtin] = len(gtinData)
+		gtinData = append(gtinData, chestnyznak.GTINData{GTIN: gtin, Count: 1})
+	}
+
+	if request.ProductGroup != "" && s.oms.SupportsGroup(request.ProductGroup) {
+		return s.orderKIZBatches(ctx, gtinData, func(ctx context.Context, i int, batch []chestnyznak.GTINData) ([]string, error) {
+			return s.emitKIZs(ctx, request.ProductGroup, batch, checkpoints.batch(i, batch), progress.add)
+		})
+	}
+
+	if !s.chestnyZnak.Enabled() {
+		kizs := []string{"KIZ123456", "KIZ789012"}
+		progress.add(len(kizs), len(kizs))
+		return kizs, nil
+	}
+
+	// API Честного ЗНАКа возвращает коды заказа сразу после выпуска
+	return s.orderKIZBatches(ctx, gtinData, func(ctx context.Context, i int, batch []chestnyznak.GTINData) ([]string, error) {
+		checkpoint := checkpoints.batch(i, batch)
+		if kizs, ok := checkpoint.completed(); ok {
+			progress.add(len(kizs), len(kizs))
+			return kizs, nil
+		}
+		kizs, err := s.chestnyZnak.RequestKIZs(ctx, request.INN, request.ProductGroup, batch)
+		progress.add(len(kizs), len(kizs))
+		if err == nil {
+			checkpoint.complete(ctx, kizs)
+		}
+		return kizs, err
+	})
+}
+
+// Эмиссия кодов маркировки через СУЗ с контрольной точки checkpoint (nil - ход эмиссии
+// не сохраняется). Ожидание готовности кодов ограничено настройкой OMS_EMIT_TIMEOUT.
+// Выпущенные и полученные коды передаются в progress.
+func (s *Service) emitKIZs(ctx context.Context, group string, gtinData []chestnyznak.GTINData,
+	checkpoint *kizBatchCheckpoint, progress func(emitted, downloaded int)) ([]string, error) {
+	if s.omsEmitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.omsEmitTimeout)
+		defer cancel()
+	}
+
+	products := make([]oms.OrderProduct, len(gtinData))
+	for i, data := range gtinData {
+		products[i] = oms.OrderProduct{GTIN: data.GTIN, Quantity: data.Count}
+	}
+
+	if checkpoint == nil {
+		return s.oms.EmitCodes(ctx, group, products, progress)
+	}
+	return s.oms.ResumeCodes(ctx, group, products, checkpoint.emission(), checkpoint, progress)
+}
+
+// Определение и проверка товарной группы запроса КИЗ. Если группа не указана, используется
+// группа заказа. GTIN должны относиться к выбранной группе по данным Национального каталога.
+func (s *Service) resolveKIZProductGroup(ctx context.Context, userID int, request *KIZRequest) error {
+	if request.ProductGroup == "" && request.OrderID > 0 && userID > 0 {
+		group, err := s.repo.OrderProductGroup(ctx, request.OrderID, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return NewError(KindNotFound, "Заказ не найден", nil)
+		} else if err != nil {
+			return NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения заказа: %w", err))
+		}
+		request.ProductGroup = group
+	}
+	if request.ProductGroup == "" {
+		return nil
+	}
+
+	if !models.IsValidProductGroup(request.ProductGroup) {
+		return NewError(KindInvalid, "Неизвестная товарная группа", nil)
+	}
+	if s.oms.Enabled() && !s.oms.SupportsGroup(request.ProductGroup) {
+		return NewError(KindInvalid, "Эмиссия кодов для товарной группы не настроена", nil)
+	}
+
+	checked := make(map[string]bool)
+	for _, gtin := range request.GTINs {
+		if gtin = models.NormalizeGTIN(gtin); checked[gtin] {
+			continue
+		}
+		checked[gtin] = true
+
+		product, err := s.lookupProduct(ctx, gtin)
+		if err != nil {
+			return NewError(KindInvalid, err.Error(), nil)
+		}
+		if product != nil && product.ProductGroup != "" && product.ProductGroup != request.ProductGroup {
+			return NewError(KindInvalid, fmt.Sprintf("Товар с GTIN %s не относится к товарной группе %s", gtin, request.ProductGroup), nil)
+		}
+	}
+	return nil
+}
+
+// Определение пользователя и организации для запроса КИЗ. Если организация указана явно,
+// проверяется участие в ней и подставляется ее ИНН; иначе организация ищется по ИНН запроса.
+func (s *Service) resolveKIZOrganization(ctx context.Context, request *KIZRequest) (int, int, error) {
+	userID, err := s.repo.UserIDByTelegram(ctx, request.TelegramID)
+	if err != nil || userID == 0 {
+		if request.OrganizationID > 0 {
+			return 0, 0, repository.ErrNotOrganizationMember
+		}
+		return 0, 0, err
+	}
+
+	if request.OrganizationID > 0 {
+		inn, err := s.repo.MemberOrganizationINN(ctx, request.OrganizationID, userID)
+		if err != nil {
+			return userID, 0, err
+		}
+		request.INN = inn
+		return userID, request.OrganizationID, nil
+	}
+
+	organizationID, err := s.repo.MemberOrganizationIDByINN(ctx, request.INN, userID)
+	return userID, organizationID, err
+}
+
+// Данные этикеток для кодов маркировки. Наименование товара берется из Национального
+// каталога, если он подключен.
+func (s *Service) kizLabels(ctx context.Context, kizs []string, batch string, date time.Time) []labels.Label {
+	names := make(map[string]string)
+	result := make([]labels.Label, len(kizs))
+	for i, kiz := range kizs {
+		gtin := labels.GTINFromCode(kiz)
+		if _, ok := names[gtin]; !ok && gtin != "" {
+			if product, err := s.lookupProduct(ctx, gtin); err == nil && product != nil {
+				names[gtin] = product.Name
+			} else {
+				names[gtin] = ""
+			}
+		}
+		result[i] = labels.Label{
+			Code:  kiz,
+			GTIN:  gtin,
+			Name:  names[gtin],
+			Batch: batch,
+			Date:  date.Format("02.01.2006"),
+		}
+	}
+	return result
+}
+
+// Генерация PDF с этикетками кодов маркировки во временной директории
+func (s *Service) generateKIZPDF(ctx context.Context, tmpl labels.Template, fields []string, items []labels.Label) (_ string, err error) {
+	_, span := tracing.Start(ctx, "labels.render_pdf", attribute.Int("labels.count", len(items)))
+	defer func() { tracing.End(span, err) }()
+
+	// Создание директории для временных файлов, если не существует
+	if err := os.MkdirAll(s.tempDir, 0755); err != nil {
+		return "", fmt.Errorf("ошибка создания директории: %w", err)
+	}
+
+	// Использование временной директории и уникального имени файла
+	filename := filepath.Join(s.tempDir, fmt.Sprintf("kizs_%d.pdf", time.Now().UnixNano()))
+	file, err := os.Create(filename)
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания PDF: %w", err)
+	}
+	if err := labels.Render(file, tmpl, fields, items); err != nil {
+		file.Close()
+		os.Remove(filename)
+		return "", fmt.Errorf("ошибка создания PDF: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("ошибка создания PDF: %w", err)
+	}
+
+	// Планирование удаления файла через некоторое время
+	go func(fname string) {
+		time.Sleep(kizFileLifetime)
+		os.Remove(fname)
+	}(filename)
+
+	return filename, nil
+}
+
+// ListKIZRequests возвращает последние запросы КИЗ пользователя
+func (s *Service) ListKIZRequests(ctx context.Context, telegramID int64, limit int) ([]repository.KIZRequestRecord, error) {
+	requests, err := s.repo.ListKIZRequests(ctx, telegramID, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса истории: %w", err))
+	}
+	return requests, nil
+}
+
+// GetKIZRequest возвращает запрос КИЗ с результатом, сделанный пользователем userID или от
+// имени его организации. Запрос другого пользователя не найден.
+func (s *Service) GetKIZRequest(ctx context.Context, userID, requestID int) (*repository.KIZRequestRecord, error) {
+	return kizRequestResult(s.repo.UserKIZRequest(ctx, userID, requestID))
+}
+
+// Запрос КИЗ из репозитория с ошибкой сервисного слоя
+func kizRequestResult(request *repository.KIZRequestRecord, err error) (*repository.KIZRequestRecord, error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Запрос не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения статуса: %w", err))
+	}
+	return request, nil
+}
+
+// Наибольшее число запросов в одном запросе статусов
+const maxKIZStatusRequests = 100
+
+// KIZRequestStatuses возвращает состояние и ход выполнения запросов КИЗ из списка, сделанных пользователем
+// или от имени его организаций, в порядке списка. Запросы, не найденные или недоступные
+// пользователю, в ответ не включаются.
+func (s *Service) KIZRequestStatuses(ctx context.Context, userID int, requestIDs []int) ([]KIZRequestStatus, error) {
+	if len(requestIDs) == 0 {
+		return nil, NewError(KindInvalid, "Необходимо указать id запросов", nil)
+	}
+	if len(requestIDs) > maxKIZStatusRequests {
+		return nil, NewError(KindInvalid, fmt.Sprintf("Можно получить статус не более %d запросов за раз", maxKIZStatusRequests), nil)
+	}
+	for _, id := range requestIDs {
+		if id <= 0 {
+			return nil, NewError(KindInvalid, "Некорректный id запроса", nil)
+		}
+	}
+
+	records, err := s.repo.UserKIZRequests(ctx, userID, requestIDs)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса статусов КИЗ: %w", err))
+	}
+
+	byID := make(map[int]*repository.KIZRequestRecord, len(records))
+	for i := range records {
+		byID[records[i].ID] = &records[i]
+	}
+	statuses := []KIZRequestStatus{}
+	for _, id := range requestIDs {
+		record, ok := byID[id]
+		if !ok {
+			continue
+		}
+		// Повторяющийся id включается в ответ один раз
+		delete(byID, id)
+		statuses = append(statuses, s.StatusOfKIZRequest(record))
+	}
+	return statuses, nil
+}
+
+// CleanupTempFiles удаляет из временной директории файлы старше ttl
+func (s *Service) CleanupTempFiles(ttl time.Duration) {
+	s.logger.Println("Очистка временных файлов...")
+	files, err := filepath.Glob(filepath.Join(s.tempDir, "*"))
+	if err != nil {
+		s.logger.Printf("Ошибка поиска файлов: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			s.logger.Printf("Ошибка получения информации о файле %s: %v", file, err)
+			continue
+		}
+
+		if now.Sub(info.ModTime()) > ttl {
+			if err := os.Remove(file); err != nil {
+				s.logger.Printf("Ошибка удаления файла %s: %v", file, err)
+			} else {
+				s.logger.Printf("Удален файл: %s", file)
+			}
+		}
+	}
+}
+
+// RunTempCleanup периодически очищает временную директорию до отмены контекста
+func (s *Service) RunTempCleanup(ctx context.Context, interval, ttl time.Duration) {
+	if err := os.MkdirAll(s.tempDir, 0755); err != nil {
+		s.logger.Printf("Ошибка создания временной директории: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.IsLeader() {
+				s.CleanupTempFiles(ttl)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/config"
+	"project-znak/internal/tracing"
+)
+
+// Разбиение запроса кодов на заказы в пределах ограничений Честного ЗНАКа и СУЗ: не более
+// MaxCodes кодов и MaxProducts различных GTIN в заказе, не более MaxGTINCodes кодов одного
+// GTIN. Остаток кодов GTIN переносится в следующий заказ, поэтому GTIN не повторяется
+// внутри заказа. Нулевые ограничения не действуют.
+func splitKIZOrder(gtinData []chestnyznak.GTINData, limits config.KIZOrderConfig) [][]chestnyznak.GTINData {
+	var batches [][]chestnyznak.GTINData
+	var batch []chestnyznak.GTINData
+	batchCodes := 0
+	flush := func() {
+		if len(batch) > 0 {
+			batches = append(batches, batch)
+		}
+		batch, batchCodes = nil, 0
+	}
+
+	for _, data := range gtinData {
+		remaining := data.Count
+		for remaining > 0 {
+			if (limits.MaxProducts > 0 && len(batch) >= limits.MaxProducts) ||
+				(limits.MaxCodes > 0 && batchCodes >= limits.MaxCodes) {
+				flush()
+			}
+
+			count := remaining
+			if limits.MaxGTINCodes > 0 {
+				count = min(count, limits.MaxGTINCodes)
+			}
+			if limits.MaxCodes > 0 {
+				count = min(count, limits.MaxCodes-batchCodes)
+			}
+			batch = append(batch, chestnyznak.GTINData{GTIN: data.GTIN, Count: count})
+			batchCodes += count
+			remaining -= count
+
+			if remaining > 0 {
+				flush()
+			}
+		}
+	}
+	flush()
+	return batches
+}
+
+// Получение кодов несколькими заказами, если запрос превышает ограничения размера заказа.
+// Заказы выполняются параллельно, не более KIZ_ORDER_CONCURRENCY одновременно; коды
+// объединяются в порядке заказов. При ошибке одного заказа остальные отменяются, а запрос
+// считается неудачным целиком. order получает номер заказа, начиная с 0.
+func (s *Service) orderKIZBatches(ctx context.Context, gtinData []chestnyznak.GTINData,
+	order func(ctx context.Context, i int, gtinData []chestnyznak.GTINData) ([]string, error)) ([]string, error) {
+	batches := splitKIZOrder(gtinData, s.kizOrders)
+	if len(batches) <= 1 {
+		return order(ctx, 0, gtinData)
+	}
+	s.logger.Printf("Запрос КИЗ разбит на %d заказов", len(batches))
+
+	results := make([][]string, len(batches))
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(max(s.kizOrders.Concurrency, 1))
+	for i, batch := range batches {
+		group.Go(func() (err error) {
+			codes := 0
+			for _, data := range batch {
+				codes += data.Count
+			}
+			ctx, span := tracing.Start(ctx, "kiz.order_batch",
+				attribute.Int("kiz.batch", i+1), attribute.Int("kiz.batches", len(batches)), attribute.Int("kiz.count", codes))
+			defer func() { tracing.End(span, err) }()
+
+			results[i], err = order(ctx, i, batch)
+			if err != nil {
+				return fmt.Errorf("заказ %d из %d: %w", i+1, len(batches), err)
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	var kizs []string
+	for _, codes := range results {
+		kizs = append(kizs, codes...)
+	}
+	return kizs, nil
+}
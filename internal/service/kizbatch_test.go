@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/config"
+)
+
+func TestSplitKIZOrder(t *testing.T) {
+	type batch = []chestnyznak.GTINData
+	tests := []struct {
+		name   string
+		data   batch
+		limits config.KIZOrderConfig
+		want   []batch
+	}{
+		{
+			name: "без ограничений",
+			data: batch{{GTIN: "A", Count: 5}, {GTIN: "B", Count: 3}},
+			want: []batch{{{GTIN: "A", Count: 5}, {GTIN: "B", Count: 3}}},
+		},
+		{
+			name:   "остаток GTIN переносится в следующий заказ",
+			data:   batch{{GTIN: "A", Count: 5}, {GTIN: "B", Count: 3}},
+			limits: config.KIZOrderConfig{MaxCodes: 4},
+			want:   []batch{{{GTIN: "A", Count: 4}}, {{GTIN: "A", Count: 1}, {GTIN: "B", Count: 3}}},
+		},
+		{
+			name:   "ровно по ограничению",
+			data:   batch{{GTIN: "A", Count: 4}, {GTIN: "B", Count: 4}},
+			limits: config.KIZOrderConfig{MaxCodes: 4},
+			want:   []batch{{{GTIN: "A", Count: 4}}, {{GTIN: "B", Count: 4}}},
+		},
+		{
+			name:   "кодов одного GTIN",
+			data:   batch{{GTIN: "A", Count: 5}},
+			limits: config.KIZOrderConfig{MaxGTINCodes: 2},
+			want:   []batch{{{GTIN: "A", Count: 2}}, {{GTIN: "A", Count: 2}}, {{GTIN: "A", Count: 1}}},
+		},
+		{
+			name:   "различных GTIN",
+			data:   batch{{GTIN: "A", Count: 1}, {GTIN: "B", Count: 1}, {GTIN: "C", Count: 1}},
+			limits: config.KIZOrderConfig{MaxProducts: 2},
+			want:   []batch{{{GTIN: "A", Count: 1}, {GTIN: "B", Count: 1}}, {{GTIN: "C", Count: 1}}},
+		},
+		{
+			name:   "несколько ограничений",
+			data:   batch{{GTIN: "A", Count: 4}, {GTIN: "B", Count: 2}},
+			limits: config.KIZOrderConfig{MaxCodes: 5, MaxGTINCodes: 3},
+			want:   []batch{{{GTIN: "A", Count: 3}}, {{GTIN: "A", Count: 1}, {GTIN: "B", Count: 2}}},
+		},
+		{
+			name:   "GTIN без кодов пропускается",
+			data:   batch{{GTIN: "A", Count: 0}, {GTIN: "B", Count: 2}},
+			limits: config.KIZOrderConfig{MaxCodes: 4},
+			want:   []batch{{{GTIN: "B", Count: 2}}},
+		},
+		{
+			name:   "пустой запрос",
+			limits: config.KIZOrderConfig{MaxCodes: 4},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := splitKIZOrder(tt.data, tt.limits); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: получено %v, ожидалось %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrderKIZBatches(t *testing.T) {
+	s := &Service{
+		logger:    log.New(io.Discard, "", 0),
+		kizOrders: config.KIZOrderConfig{MaxCodes: 2, Concurrency: 2},
+	}
+	data := []chestnyznak.GTINData{{GTIN: "A", Count: 3}, {GTIN: "B", Count: 2}}
+
+	var mu sync.Mutex
+	var orders []int
+	kizs, err := s.orderKIZBatches(context.Background(), data,
+		func(ctx context.Context, i int, batch []chestnyznak.GTINData) ([]string, error) {
+			mu.Lock()
+			orders = append(orders, i)
+			mu.Unlock()
+			var codes []string
+			for _, d := range batch {
+				for range d.Count {
+					codes = append(codes, d.GTIN)
+				}
+			}
+			return codes, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(orders)
+	if want := []string{"A", "A", "A", "B", "B"}; !slices.Equal(kizs, want) || !slices.Equal(orders, []int{0, 1, 2}) {
+		t.Errorf("Коды %v объединены не в порядке заказов или не все заказы выполнены: %v", kizs, orders)
+	}
+
+	failure := errors.New("заказ отклонен")
+	_, err = s.orderKIZBatches(context.Background(), data,
+		func(ctx context.Context, i int, batch []chestnyznak.GTINData) ([]string, error) {
+			if i == 1 {
+				return nil, failure
+			}
+			return []string{"code"}, nil
+		})
+	if !errors.Is(err, failure) {
+		t.Errorf("Ошибка заказа должна завершать запрос целиком, получено: %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/models"
+	"project-znak/internal/oms"
+	"project-znak/internal/repository"
+)
+
+// Время без подтверждения выполнения, после которого запрос КИЗ в статусе pending считается
+// прерванным сбоем процесса и продолжается ведущим экземпляром
+const kizStaleAfter = 2 * time.Minute
+
+// Интервал подтверждения выполнения запроса КИЗ
+const kizHeartbeatInterval = 30 * time.Second
+
+// Контрольные точки эмиссии партий запроса КИЗ. Заказ СУЗ, полученные порции кодов и
+// закрытые буферы сохраняются по мере эмиссии, поэтому после сбоя запрос продолжается
+// с того же заказа, а не заказывает и не оплачивает коды повторно.
+type kizCheckpoints struct {
+	s         *Service
+	requestID int
+	saved     map[int]*repository.KIZBatchCheckpoint
+}
+
+// Загрузка контрольных точек запроса; без номера запроса ход эмиссии не сохраняется
+func (s *Service) loadKIZCheckpoints(ctx context.Context, requestID int) (*kizCheckpoints, error) {
+	checkpoints := &kizCheckpoints{s: s, requestID: requestID}
+	if requestID == 0 {
+		return checkpoints, nil
+	}
+	saved, err := s.repo.KIZCheckpoints(ctx, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения контрольных точек запроса КИЗ %d: %w", requestID, err)
+	}
+	checkpoints.saved = saved
+	return checkpoints, nil
+}
+
+// Контрольная точка партии с номером i. Сохраненная точка используется, только если
+// партия состоит из тех же товаров: при изменении ограничений заказа партии разбиваются
+// иначе, и прежний заказ не продолжается.
+func (c *kizCheckpoints) batch(i int, gtinData []chestnyznak.GTINData) *kizBatchCheckpoint {
+	if c.requestID == 0 {
+		return nil
+	}
+	products, _ := json.Marshal(gtinData)
+	batch := &kizBatchCheckpoint{checkpoints: c, batch: i, products: products}
+
+	saved := c.saved[i]
+	if saved == nil {
+		return batch
+	}
+	var savedProducts []chestnyznak.GTINData
+	if err := json.Unmarshal(saved.Products, &savedProducts); err != nil || !slices.Equal(savedProducts, gtinData) {
+		c.s.logger.Printf("Партия %d запроса КИЗ %d изменилась после сбоя, заказ %s не продолжается",
+			i+1, c.requestID, saved.OMSOrderID)
+		return batch
+	}
+	batch.saved = saved
+	batch.closed = slices.Clone(saved.Closed)
+	return batch
+}
+
+// Контрольная точка партии запроса КИЗ; реализует oms.Checkpoint
+type kizBatchCheckpoint struct {
+	checkpoints *kizCheckpoints
+	batch       int
+	products    []byte
+	saved       *repository.KIZBatchCheckpoint
+	closed      []string
+}
+
+// Сохраненный ход эмиссии партии через СУЗ
+func (b *kizBatchCheckpoint) emission() oms.Emission {
+	if b == nil || b.saved == nil || b.saved.OMSOrderID == "" {
+		return oms.Emission{}
+	}
+	closed := make(map[string]bool, len(b.closed))
+	for _, gtin := range b.closed {
+		closed[gtin] = true
+	}
+	return oms.Emission{OrderID: b.saved.OMSOrderID, Codes: b.saved.Codes, Closed: closed}
+}
+
+// Коды партии, полученные из API Честного ЗНАКа до сбоя
+func (b *kizBatchCheckpoint) completed() ([]string, bool) {
+	if b == nil || b.saved == nil || !b.saved.Completed {
+		return nil, false
+	}
+	return b.saved.Codes[""], true
+}
+
+// Сохранение кодов партии, полученных из API Честного ЗНАКа. Коды уже получены, поэтому
+// ошибка сохранения только записывается в журнал.
+func (b *kizBatchCheckpoint) complete(ctx context.Context, codes []string) {
+	if b == nil {
+		return
+	}
+	c := b.checkpoints
+	if err := c.s.repo.CompleteKIZBatch(context.WithoutCancel(ctx), c.requestID, b.batch, b.products, codes); err != nil {
+		c.s.logger.Printf("Ошибка сохранения кодов партии %d запроса КИЗ %d: %v", b.batch+1, c.requestID, err)
+	}
+}
+
+// OrderCreated сохраняет заказ СУЗ партии. Шаги эмиссии сохраняются и после отмены ctx:
+// полученные коды не должны теряться при таймауте.
+func (b *kizBatchCheckpoint) OrderCreated(ctx context.Context, orderID string) error {
+	b.closed = nil
+	return b.checkpoints.s.repo.SaveKIZBatchOrder(context.WithoutCancel(ctx), b.checkpoints.requestID, b.batch,
+		b.products, orderID)
+}
+
+// CodesReceived сохраняет порцию полученных кодов GTIN
+func (b *kizBatchCheckpoint) CodesReceived(ctx context.Context, gtin string, offset int, codes []string) error {
+	return b.checkpoints.s.repo.SaveKIZChunk(context.WithoutCancel(ctx), b.checkpoints.requestID, b.batch,
+		gtin, offset, codes)
+}
+
+// BufferClosed сохраняет закрытие буфера GTIN
+func (b *kizBatchCheckpoint) BufferClosed(ctx context.Context, gtin string) error {
+	b.closed = append(b.closed, gtin)
+	return b.checkpoints.s.repo.SaveKIZBatchClosed(context.WithoutCancel(ctx), b.checkpoints.requestID, b.batch,
+		b.closed)
+}
+
+// Подтверждение выполнения запроса КИЗ каждые kizHeartbeatInterval до вызова stop. Запрос
+// без подтверждений дольше kizStaleAfter продолжает ведущий экземпляр.
+func (s *Service) kizHeartbeat(requestID int) (stop func()) {
+	if requestID == 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(kizHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := s.repo.TouchKIZRequest(ctx, requestID); err != nil {
+					s.logger.Printf("Ошибка подтверждения выполнения запроса КИЗ %d: %v", requestID, err)
+				}
+				cancel()
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// ResumeStaleKIZRequests продолжает запросы КИЗ, выполнение которых прервано сбоем процесса:
+// запросы в статусе pending без подтверждения выполнения дольше kizStaleAfter. Эмиссия
+// продолжается с контрольных точек. Возвращает число продолженных запросов.
+func (s *Service) ResumeStaleKIZRequests(ctx context.Context) int {
+	resumed := 0
+	for ctx.Err() == nil {
+		record, err := s.repo.ClaimStaleKIZRequest(ctx, kizStaleAfter)
+		if errors.Is(err, repository.ErrNotFound) {
+			break
+		} else if err != nil {
+			s.logger.Printf("Ошибка поиска прерванных запросов КИЗ: %v", err)
+			break
+		}
+
+		resumed++
+		s.logger.Printf("Продолжение прерванного запроса КИЗ %d", record.ID)
+		request, labelDate, err := s.kizRequestFromRecord(ctx, record)
+		if err != nil {
+			s.failKIZRequest(ctx, record.ID, err)
+			continue
+		}
+		// Неудачный запрос не учитывается в квоте, как и при первом выполнении
+		result, err := s.fulfillKIZRequest(ctx, record.UserID, record.ID, request, labelDate)
+		if err != nil {
+			s.logger.Printf("Ошибка продолжения запроса КИЗ %d: %v", record.ID, err)
+			if len(result.KIZs) == 0 {
+				s.releaseQuota(ctx, record.UserID, models.QuotaCodes, len(request.GTINs))
+			}
+		}
+	}
+	return resumed
+}
+
+// RunKIZRecovery продолжает прерванные запросы КИЗ с указанным интервалом до отмены контекста
+func (s *Service) RunKIZRecovery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			if resumed := s.ResumeStaleKIZRequests(ctx); resumed > 0 {
+				s.logger.Printf("Продолжено прерванных запросов КИЗ: %d", resumed)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Интервал проверки хода выполнения в БД при ожидании изменения запроса КИЗ. Шина событий
+// видит только изменения этого экземпляра; запрос, который выполняет другой экземпляр или
+// который отменен вместе с заказом, проверяется по БД.
+const kizWaitPollInterval = 2 * time.Second
+
+// kizEvents - шина событий изменения запросов КИЗ внутри процесса. Обработчик запроса
+// публикует событие после сохранения статуса или хода выполнения, ожидающие клиенты
+// получают его без опроса БД.
+type kizEvents struct {
+	mu      sync.Mutex
+	waiters map[int]*kizWaiters
+}
+
+// Подписчики на изменения одного запроса: канал закрывается при изменении
+type kizWaiters struct {
+	changed chan struct{}
+	count   int
+}
+
+// subscribe возвращает канал, который закрывается при следующем изменении запроса, и функцию
+// отмены подписки
+func (e *kizEvents) subscribe(requestID int) (<-chan struct{}, func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.waiters == nil {
+		e.waiters = make(map[int]*kizWaiters)
+	}
+	waiters := e.waiters[requestID]
+	if waiters == nil {
+		waiters = &kizWaiters{changed: make(chan struct{})}
+		e.waiters[requestID] = waiters
+	}
+	waiters.count++
+
+	return waiters.changed, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		waiters.count--
+		if waiters.count == 0 && e.waiters[requestID] == waiters {
+			delete(e.waiters, requestID)
+		}
+	}
+}
+
+// publish сообщает подписчикам об изменении запроса
+func (e *kizEvents) publish(requestID int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if waiters := e.waiters[requestID]; waiters != nil {
+		close(waiters.changed)
+		delete(e.waiters, requestID)
+	}
+}
+
+// WaitKIZRequestProgress ждет изменения хода выполнения запроса КИЗ относительно known не
+// дольше wait и возвращает текущее состояние. Завершенный запрос возвращается сразу:
+// его ход выполнения больше не изменится.
+func (s *Service) WaitKIZRequestProgress(ctx context.Context, userID, requestID int, known KIZRequestStatus,
+	wait time.Duration) (*KIZRequestStatus, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	ticker := time.NewTicker(kizWaitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Подписка до чтения состояния: изменение между чтением и ожиданием не теряется
+		changed, unsubscribe := s.kizEvents.subscribe(requestID)
+		status, err := s.KIZRequestProgress(ctx, userID, requestID)
+		if err != nil || status.Done() || status.ChangedFrom(known) {
+			unsubscribe()
+			return status, err
+		}
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+		case <-timer.C:
+			unsubscribe()
+			return status, nil
+		case <-ctx.Done():
+			unsubscribe()
+			return status, nil
+		}
+		unsubscribe()
+	}
+}
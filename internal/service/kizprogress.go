@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// Наименьший интервал между сохранениями хода выполнения запроса КИЗ
+const kizProgressInterval = time.Second
+
+// kizProgress накапливает ход выполнения запроса КИЗ по заказам, выполняемым параллельно,
+// и сохраняет его не чаще раза в kizProgressInterval. Ошибки сохранения только логируются.
+type kizProgress struct {
+	s         *Service
+	ctx       context.Context
+	requestID int
+
+	mu       sync.Mutex
+	progress repository.KIZProgress
+	savedAt  time.Time
+}
+
+// Ход выполнения сохраняется и после отмены ctx, чтобы остался виден при ошибке по таймауту
+func (s *Service) newKIZProgress(ctx context.Context, requestID int) *kizProgress {
+	return &kizProgress{s: s, ctx: context.WithoutCancel(ctx), requestID: requestID, savedAt: time.Now()}
+}
+
+// add учитывает выпущенные и полученные коды
+func (p *kizProgress) add(emitted, downloaded int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.CodesEmitted += emitted
+	p.progress.CodesDownloaded += downloaded
+	if time.Since(p.savedAt) >= kizProgressInterval {
+		p.save()
+	}
+}
+
+// fileGenerated учитывает сформированный файл и сохраняет ход выполнения
+func (p *kizProgress) fileGenerated() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.FilesGenerated++
+	p.save()
+}
+
+// flush сохраняет накопленный ход выполнения
+func (p *kizProgress) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.save()
+}
+
+func (p *kizProgress) save() {
+	p.savedAt = time.Now()
+	if p.requestID <= 0 {
+		return
+	}
+	if err := p.s.repo.SaveKIZProgress(p.ctx, p.requestID, p.progress); err != nil {
+		p.s.logger.Printf("Ошибка сохранения хода выполнения запроса КИЗ %d: %v", p.requestID, err)
+		return
+	}
+	p.s.kizEvents.publish(p.requestID)
+}
+
+// KIZRequestStatus - состояние и ход выполнения запроса КИЗ
+type KIZRequestStatus struct {
+	RequestID       int       `json:"request_id" xml:"request_id"`
+	Status          string    `json:"status" xml:"status"`
+	RequestTime     time.Time `json:"request_time" xml:"request_time"`
+	CodesRequested  int       `json:"codes_requested" xml:"codes_requested"`
+	CodesEmitted    int       `json:"codes_emitted" xml:"codes_emitted"`
+	CodesReceived   int       `json:"codes_received" xml:"codes_received"`
+	FilesGenerated  int       `json:"files_generated" xml:"files_generated"`
+	Progress        int       `json:"progress" xml:"progress"`             // Доля полученных кодов, процентов
+	FileAvailable   bool      `json:"file_available" xml:"file_available"` // Этикетки можно выгрузить по полученным кодам
+	ProgressMessage string    `json:"progress_message" xml:"progress_message"`
+	Error           string    `json:"error,omitempty" xml:"error,omitempty"`
+	Attempts        int       `json:"attempts,omitempty" xml:"attempts,omitempty"`
+}
+
+// Done сообщает, что запрос больше не выполняется: коды получены или запрос завершился ошибкой
+func (status KIZRequestStatus) Done() bool {
+	return status.Status != models.KIZRequestStatusPending
+}
+
+// ChangedFrom сообщает об изменении статуса, хода выполнения или ошибки запроса
+// по сравнению с before
+func (status KIZRequestStatus) ChangedFrom(before KIZRequestStatus) bool {
+	return before.Status != status.Status || before.CodesEmitted != status.CodesEmitted ||
+		before.CodesReceived != status.CodesReceived || before.FilesGenerated != status.FilesGenerated ||
+		before.Error != status.Error
+}
+
+// KIZRequestProgress возвращает состояние и ход выполнения запроса КИЗ пользователя userID.
+// Запрос другого пользователя не найден. Данные читаются с основного пула, чтобы ход
+// выполнения не отставал на время репликации.
+func (s *Service) KIZRequestProgress(ctx context.Context, userID, requestID int) (*KIZRequestStatus, error) {
+	record, err := s.repo.UserKIZRequestSummary(ctx, userID, requestID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Запрос не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения статуса: %w", err))
+	}
+	status := s.StatusOfKIZRequest(record)
+	return &status, nil
+}
+
+// StatusOfKIZRequest возвращает состояние и ход выполнения запроса КИЗ по сохраненной записи
+func (s *Service) StatusOfKIZRequest(record *repository.KIZRequestRecord) KIZRequestStatus {
+	status := KIZRequestStatus{
+		RequestID:      record.ID,
+		Status:         record.Status,
+		RequestTime:    record.RequestTime,
+		CodesRequested: record.CodesRequested,
+		CodesEmitted:   record.CodesEmitted,
+		CodesReceived:  record.CodesDownloaded,
+		FilesGenerated: record.FilesGenerated,
+		FileAvailable:  record.Status == models.KIZRequestStatusCompleted || record.Status == models.KIZRequestStatusReceived,
+		Error:          record.Error,
+		Attempts:       record.Attempts,
+	}
+
+	// Запросы, сохраненные до учета хода выполнения: число кодов - по списку GTIN
+	if status.CodesRequested == 0 && len(record.RequestData) > 0 {
+		var data kizRequestData
+		if err := json.Unmarshal(record.RequestData, &data); err != nil {
+			s.logger.Printf("Ошибка разбора параметров запроса КИЗ %d: %v", record.ID, err)
+		}
+		status.CodesRequested = len(data.GTINs)
+	}
+
+	switch {
+	case status.FileAvailable:
+		status.Progress = 100
+	case status.CodesRequested > 0:
+		status.Progress = min(100, status.CodesReceived*100/status.CodesRequested)
+	}
+	status.ProgressMessage = kizProgressMessage(status)
+	return status
+}
+
+// Описание хода выполнения запроса для пользователя
+func kizProgressMessage(status KIZRequestStatus) string {
+	if status.Status == models.KIZRequestStatusPending && status.CodesRequested > 0 &&
+		status.CodesReceived >= status.CodesRequested {
+		return "Коды получены, формируется файл"
+	}
+	return fmt.Sprintf("%s из %s кодов получено", formatCount(status.CodesReceived), formatCount(status.CodesRequested))
+}
+
+// Запись числа с разделением разрядов пробелом: 34 500
+func formatCount(n int) string {
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	digits := strconv.Itoa(n)
+	var out []byte
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, ' ')
+		}
+		out = append(out, digits[i])
+	}
+	return string(out)
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"project-znak/internal/labels"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/tracing"
+)
+
+// LabelSettingsRequest - запрос на изменение шаблона этикеток пользователя.
+// Незаполненные поля не меняются.
+type LabelSettingsRequest struct {
+	TelegramID int64    `json:"telegram_id"`
+	Template   string   `json:"template,omitempty" validate:"label_template"`
+	Fields     []string `json:"fields,omitempty" validate:"dive,label_field"`
+}
+
+// ListLabelTemplates возвращает предопределенные шаблоны этикеток
+func (s *Service) ListLabelTemplates() []labels.Template {
+	return labels.Templates()
+}
+
+// LabelSettings возвращает шаблон этикеток пользователя; если пользователь
+// его не выбирал, возвращается шаблон по умолчанию
+func (s *Service) LabelSettings(ctx context.Context, userID int) (models.LabelSettings, error) {
+	settings, err := s.repo.LabelSettings(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return defaultLabelSettings(userID), nil
+	} else if err != nil {
+		return settings, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения шаблона этикеток: %w", err))
+	}
+	return settings, nil
+}
+
+// UpdateLabelSettings меняет шаблон этикеток и поля, выводимые на этикетке по умолчанию
+func (s *Service) UpdateLabelSettings(ctx context.Context, actor Actor, request LabelSettingsRequest) (models.LabelSettings, error) {
+	if err := ValidateRequest(request); err != nil {
+		return models.LabelSettings{}, err
+	}
+	if err := validateLabelOptions(request.Template, request.Fields); err != nil {
+		return models.LabelSettings{}, err
+	}
+
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return models.LabelSettings{}, err
+	}
+
+	before, err := s.LabelSettings(ctx, userID)
+	if err != nil {
+		return before, err
+	}
+
+	settings := before
+	if request.Template != "" {
+		settings.Template = request.Template
+	}
+	if len(request.Fields) > 0 {
+		settings.Fields = request.Fields
+	}
+
+	if err := s.repo.SaveLabelSettings(ctx, &settings); err != nil {
+		return settings, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка сохранения шаблона этикеток: %w", err))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "label_settings", userID, before, settings)
+
+	return settings, nil
+}
+
+// Шаблон этикеток по умолчанию
+func defaultLabelSettings(userID int) models.LabelSettings {
+	return models.LabelSettings{
+		UserID:   userID,
+		Template: labels.DefaultTemplate,
+		Fields:   labels.DefaultFields,
+	}
+}
+
+// Проверка имени шаблона и полей этикетки; пустые значения допустимы
+func validateLabelOptions(template string, fields []string) error {
+	if template != "" {
+		if _, ok := labels.Lookup(template); !ok {
+			return NewError(KindInvalid, "Неизвестный шаблон этикеток", nil)
+		}
+	}
+	if err := labels.ValidateFields(fields); err != nil {
+		return NewError(KindInvalid, err.Error(), nil)
+	}
+	return nil
+}
+
+// Шаблон и поля этикеток для запроса КИЗ: значения из запроса, затем шаблон пользователя
+func (s *Service) kizLabelOptions(ctx context.Context, userID int, request KIZRequest) (labels.Template, []string) {
+	settings := defaultLabelSettings(userID)
+	if userID > 0 {
+		saved, err := s.LabelSettings(ctx, userID)
+		if err != nil {
+			s.logger.Printf("Ошибка получения шаблона этикеток пользователя %d: %v", userID, err)
+		} else {
+			settings = saved
+		}
+	}
+
+	name, fields := settings.Template, settings.Fields
+	if request.LabelTemplate != "" {
+		name = request.LabelTemplate
+	}
+	if len(request.LabelFields) > 0 {
+		fields = request.LabelFields
+	}
+
+	tmpl, ok := labels.Lookup(name)
+	if !ok {
+		tmpl, _ = labels.Lookup(labels.DefaultTemplate)
+	}
+	return tmpl, fields
+}
+
+// Параметры этикеток, сохраняемые вместе с запросом КИЗ для повторной выгрузки
+type kizLabelData struct {
+	Template string   `json:"label_template,omitempty"`
+	Fields   []string `json:"label_fields,omitempty"`
+	Batch    string   `json:"batch,omitempty"`
+	Date     string   `json:"label_date,omitempty"`
+}
+
+// KIZLabelsRequest - запрос выгрузки этикеток для кодов запроса КИЗ. Незаполненные
+// параметры берутся из запроса КИЗ, настроек пользователя и настроек принтера по умолчанию.
+type KIZLabelsRequest struct {
+	UserID    int // Владелец запроса; 0 - без проверки владельца, для ссылок с подписью
+	RequestID int
+	Format    string         // pdf, zpl или epl
+	Template  string         // Шаблон этикеток; для zpl и epl задает размер этикетки
+	Fields    []string       // Поля этикетки
+	Printer   labels.Printer // Параметры печати для zpl и epl
+}
+
+// KIZLabels формирует этикетки с кодами выполненного запроса КИЗ в указанном формате
+func (s *Service) KIZLabels(ctx context.Context, request KIZLabelsRequest) ([]byte, error) {
+	if request.Format == "" {
+		request.Format = labels.FormatPDF
+	}
+	if request.Format != labels.FormatPDF && request.Format != labels.FormatZPL && request.Format != labels.FormatEPL {
+		return nil, NewError(KindInvalid, "Неизвестный формат этикеток", nil)
+	}
+	if err := validateLabelOptions(request.Template, request.Fields); err != nil {
+		return nil, err
+	}
+
+	var record *repository.KIZRequestRecord
+	var err error
+	if request.UserID != 0 {
+		record, err = s.GetKIZRequest(ctx, request.UserID, request.RequestID)
+	} else {
+		record, err = kizRequestResult(s.repo.KIZRequest(ctx, request.RequestID))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var kizs []string
+	if len(record.KIZData) > 0 {
+		if err := json.Unmarshal(record.KIZData, &kizs); err != nil {
+			return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка разбора кодов запроса %d: %w", record.ID, err))
+		}
+	}
+	if len(kizs) == 0 {
+		return nil, NewError(KindConflict, "Коды маркировки по запросу еще не получены", nil)
+	}
+
+	// Параметры этикеток, указанные при запросе КИЗ
+	var saved kizLabelData
+	if len(record.RequestData) > 0 {
+		if err := json.Unmarshal(record.RequestData, &saved); err != nil {
+			s.logger.Printf("Ошибка разбора параметров запроса КИЗ %d: %v", record.ID, err)
+		}
+	}
+	date := record.RequestTime
+	if parsed, err := time.Parse(documentDateLayout, saved.Date); err == nil {
+		date = parsed
+	}
+
+	options := KIZRequest{LabelTemplate: saved.Template, LabelFields: saved.Fields}
+	if request.Template != "" {
+		options.LabelTemplate = request.Template
+	}
+	if len(request.Fields) > 0 {
+		options.LabelFields = request.Fields
+	}
+	tmpl, fields := s.kizLabelOptions(ctx, record.UserID, options)
+	items := s.kizLabels(ctx, kizs, saved.Batch, date)
+
+	// Размер термоэтикетки берется из шаблона, если он задает одну этикетку на странице
+	defaults := s.printer.WithDefaults(labels.DefaultPrinter)
+	if tmpl.Columns == 1 && tmpl.Rows == 1 {
+		defaults.Width, defaults.Height = tmpl.PageWidth, tmpl.PageHeight
+	}
+	printer := request.Printer.WithDefaults(defaults)
+	if request.Format != labels.FormatPDF {
+		if err := printer.Validate(); err != nil {
+			return nil, NewError(KindInvalid, err.Error(), nil)
+		}
+	}
+
+	_, span := tracing.Start(ctx, "labels.render",
+		attribute.String("labels.format", request.Format), attribute.Int("labels.count", len(items)))
+	var buf bytes.Buffer
+	switch request.Format {
+	case labels.FormatZPL:
+		err = labels.RenderZPL(&buf, printer, fields, items)
+	case labels.FormatEPL:
+		err = labels.RenderEPL(&buf, printer, fields, items)
+	default:
+		err = labels.Render(&buf, tmpl, fields, items)
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка формирования этикеток", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"project-znak/internal/i18n"
+	"project-znak/internal/repository"
+)
+
+// Время хранения языка пользователя в кэше
+const languageCacheTTL = 10 * time.Minute
+
+// Ключ кэша языка пользователя
+func languageCacheKey(userID int) string {
+	return fmt.Sprintf("language:user:%d", userID)
+}
+
+// UserLanguage возвращает язык сообщений пользователя: выбранный им или язык по умолчанию.
+// Ошибка БД не мешает ответу и только записывается в журнал.
+func (s *Service) UserLanguage(ctx context.Context, userID int) i18n.Language {
+	if userID == 0 {
+		return i18n.Default
+	}
+
+	var code string
+	if !s.cache.Get(ctx, languageCacheKey(userID), &code) {
+		var err error
+		code, err = s.repo.UserLanguage(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return i18n.Default
+		} else if err != nil {
+			s.logger.Printf("Ошибка получения языка пользователя %d: %v", userID, err)
+			return i18n.Default
+		}
+		s.cache.Set(ctx, languageCacheKey(userID), code, languageCacheTTL)
+	}
+
+	if lang, ok := i18n.Supported(code); ok {
+		return lang
+	}
+	return i18n.Default
+}
+
+// SetUserLanguage сохраняет язык сообщений пользователя; пустой код возвращает язык
+// по умолчанию. Возвращает язык, который будет использоваться.
+func (s *Service) SetUserLanguage(ctx context.Context, actor Actor, code string) (i18n.Language, error) {
+	lang, ok := i18n.Supported(code)
+	if code != "" && !ok {
+		return "", NewError(KindInvalid, fmt.Sprintf("Неизвестный язык %q", code), nil)
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return "", err
+	}
+
+	before, err := s.repo.UserLanguage(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", NewError(KindNotFound, "Пользователь не найден", nil)
+	} else if err != nil {
+		return "", NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса языка пользователя: %w", err))
+	}
+	if err := s.repo.SetUserLanguage(ctx, userID, string(lang)); errors.Is(err, repository.ErrNotFound) {
+		return "", NewError(KindNotFound, "Пользователь не найден", nil)
+	} else if err != nil {
+		return "", NewError(KindInternal, "Ошибка сохранения языка", err)
+	}
+	s.cache.Delete(ctx, languageCacheKey(userID))
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "user", userID,
+		map[string]string{"language": before}, map[string]string{"language": string(lang)})
+	if lang == "" {
+		return i18n.Default, nil
+	}
+	return lang, nil
+}
+
+// Перевод сообщения в Telegram на язык пользователя
+func (s *Service) localize(ctx context.Context, userID int, text string) string {
+	return i18n.Translate(s.UserLanguage(ctx, userID), text)
+}
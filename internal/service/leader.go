@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// Имя аренды, владелец которой выполняет фоновые задачи
+const leaderLease = "leader"
+
+// ElectLeader захватывает или продлевает аренду ведущего экземпляра сервиса. Ведущий
+// экземпляр выполняет фоновые задачи: опрос документов, сверку платежей, доставку outbox,
+// отчеты, расписания и очистку; остальные экземпляры только обрабатывают запросы. Экземпляр
+// остается ведущим до истечения аренды, отсчитанной от начала последнего успешного продления,
+// поэтому при потере связи с БД он прекращает задачи не позже, чем аренду захватит другой.
+// Если срок аренды не задан, экземпляр всегда ведущий.
+func (s *Service) ElectLeader(ctx context.Context) bool {
+	if s.leaderTTL <= 0 {
+		return true
+	}
+
+	start := time.Now()
+	wasLeader := s.IsLeader()
+	leader, err := s.repo.AcquireLease(ctx, leaderLease, s.instanceID, s.leaderTTL)
+	if err != nil {
+		s.logger.Printf("Ошибка продления аренды ведущего экземпляра: %v", err)
+		return s.IsLeader()
+	}
+
+	if leader {
+		s.leaderUntil.Store(start.Add(s.leaderTTL).UnixNano())
+	} else {
+		s.leaderUntil.Store(0)
+	}
+	if leader != wasLeader {
+		if leader {
+			s.logger.Printf("Экземпляр %s стал ведущим и выполняет фоновые задачи", s.instanceID)
+		} else {
+			s.logger.Printf("Экземпляр %s больше не ведущий, фоновые задачи выполняет другой экземпляр", s.instanceID)
+		}
+	}
+	return leader
+}
+
+// IsLeader сообщает, выполняет ли этот экземпляр сервиса фоновые задачи
+func (s *Service) IsLeader() bool {
+	return s.leaderTTL <= 0 || time.Now().UnixNano() < s.leaderUntil.Load()
+}
+
+// RunLeaderElection продлевает или пытается захватить аренду ведущего экземпляра три раза
+// за срок аренды до отмены контекста. При остановке аренда освобождается, чтобы ее сразу
+// захватил другой экземпляр.
+func (s *Service) RunLeaderElection(ctx context.Context) {
+	if s.leaderTTL <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.leaderTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.resignLeader()
+			return
+		case <-ticker.C:
+			s.ElectLeader(ctx)
+		}
+	}
+}
+
+// Освобождение аренды ведущего экземпляра при остановке
+func (s *Service) resignLeader() {
+	if !s.IsLeader() {
+		return
+	}
+	s.leaderUntil.Store(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.repo.ReleaseLease(ctx, leaderLease, s.instanceID); err != nil {
+		s.logger.Printf("Ошибка освобождения аренды ведущего экземпляра: %v", err)
+		return
+	}
+	s.logger.Printf("Экземпляр %s освободил аренду ведущего экземпляра", s.instanceID)
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"project-znak/internal/repository"
+)
+
+// UserMergeRequest - запрос на объединение пользователя, зарегистрированного повторно,
+// с основным: данные SourceUserID переносятся к TargetUserID, а SourceUserID удаляется
+type UserMergeRequest struct {
+	SourceUserID int `json:"source_user_id" validate:"required,min=1"`
+	TargetUserID int `json:"target_user_id" validate:"required,min=1"`
+
+	// Привязать к объединенному пользователю аккаунт Telegram присоединяемого,
+	// например если пользователь сменил аккаунт
+	UseSourceTelegram bool `json:"use_source_telegram,omitempty"`
+}
+
+// UserMergeResult - итог объединения пользователей
+type UserMergeResult struct {
+	UserID     int              `json:"user_id"`
+	TelegramID int64            `json:"telegram_id,omitempty"`
+	Moved      map[string]int64 `json:"moved"` // Число перенесенных записей по таблицам
+}
+
+// MergeUsers объединяет двух пользователей: заказы, платежи, бонусный баланс, документы,
+// запросы КИЗ, API ключи, настройки и членство в организациях присоединяемого пользователя
+// переносятся к основному, а присоединяемый удаляется. Объединение записывается в журнал
+// аудита для обоих пользователей.
+func (s *Service) MergeUsers(ctx context.Context, actor Actor, request UserMergeRequest) (*UserMergeResult, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	if request.SourceUserID == request.TargetUserID {
+		return nil, NewError(KindInvalid, "Нельзя объединить пользователя с самим собой", nil)
+	}
+
+	merge, err := s.repo.MergeUsers(ctx, request.SourceUserID, request.TargetUserID, request.UseSourceTelegram)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Пользователь не найден", nil)
+	} else if errors.Is(err, repository.ErrMergePartners) {
+		return nil, NewError(KindConflict, "Оба пользователя являются партнерами, объединение невозможно", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка объединения пользователей", err)
+	}
+
+	// Перенесенные ключи указывают в кэше на удаленного пользователя, а настройки
+	// основного могли быть дополнены настройками присоединенного
+	for _, keyHash := range merge.KeyHashes {
+		s.cache.Delete(ctx, apiKeyCacheKey(keyHash))
+	}
+	for _, userID := range []int{request.SourceUserID, request.TargetUserID} {
+		s.cache.Delete(ctx, languageCacheKey(userID))
+		s.cache.Delete(ctx, timezoneCacheKey(userID))
+		s.cache.Delete(ctx, planCacheKey(userID))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionMerge, "user", request.TargetUserID,
+		map[string]any{"source_user_id": request.SourceUserID},
+		map[string]any{"telegram_id": merge.TelegramID, "moved": merge.Moved})
+	s.recordAudit(ctx, actor, AuditActionMerge, "user", request.SourceUserID, nil,
+		map[string]any{"merged_into": request.TargetUserID})
+
+	return &UserMergeResult{UserID: request.TargetUserID, TelegramID: merge.TelegramID, Moved: merge.Moved}, nil
+}
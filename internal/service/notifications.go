@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"project-znak/internal/mailer"
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+	"project-znak/internal/repository"
+)
+
+// Данные письма с кодами маркировки
+type kizReadyEmail struct {
+	RequestID int
+	INN       string
+	KIZs      []string
+}
+
+// Данные уведомления об ошибке
+type failureEmail struct {
+	Operation string
+	Reason    string
+	Time      time.Time
+}
+
+// Виды документов в событиях о результате обработки
+const (
+	documentTypeIntroduction = "introduction"
+	documentTypeRetirement   = "retirement"
+)
+
+// Названия операций с документами для уведомлений пользователя
+var documentOperations = map[string]string{
+	documentTypeIntroduction: "Ввод в оборот",
+	documentTypeRetirement:   "Вывод из оборота",
+}
+
+// Данные события о результате обработки документа Честным ЗНАКом
+type documentEvent struct {
+	DocumentType string `json:"document_type"`
+	DocumentID   int    `json:"document_id"`
+	OrderID      int    `json:"order_id,omitempty"`
+	ExternalID   string `json:"external_id"`
+	Status       string `json:"status"`
+	Error        string `json:"error,omitempty"`
+	Ticket       string `json:"ticket,omitempty"`
+	// Подписанная квитанция, сохраненная сервисом: ID и хэш SHA-256 содержимого
+	ReceiptID     int    `json:"receipt_id,omitempty"`
+	ReceiptSHA256 string `json:"receipt_sha256,omitempty"`
+}
+
+// Событие с данными сохраненной квитанции; receipt = nil - квитанция не получена
+func (e documentEvent) withReceipt(receipt *repository.DocumentReceipt) documentEvent {
+	if receipt != nil {
+		e.ReceiptID, e.ReceiptSHA256 = receipt.ID, receipt.SHA256
+	}
+	return e
+}
+
+// Отправка письма пользователю, если у него указан email и включен данный вид уведомлений.
+// Ошибки отправки только логируются.
+func (s *Service) sendNotification(ctx context.Context, userID int, enabled func(models.NotificationPreferences) bool,
+	subject, templateName string, data any, attachments ...mailer.Attachment) {
+	if err := s.sendEmail(ctx, userID, enabled, subject, templateName, data, attachments...); err != nil {
+		s.logger.Printf("Ошибка отправки письма пользователю %d: %v", userID, err)
+	}
+}
+
+// Отправка письма пользователю. Письмо не отправляется без ошибки, если почта не настроена,
+// у пользователя нет email или данный вид уведомлений отключен.
+func (s *Service) sendEmail(ctx context.Context, userID int, enabled func(models.NotificationPreferences) bool,
+	subject, templateName string, data any, attachments ...mailer.Attachment) error {
+	if !s.mailer.Enabled() || userID == 0 {
+		return nil
+	}
+
+	email, err := s.repo.UserEmail(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка получения email: %w", err)
+	}
+	if email == "" {
+		return nil
+	}
+
+	prefs, err := s.repo.NotificationPreferences(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка получения настроек уведомлений: %w", err)
+	}
+	if !enabled(prefs) {
+		return nil
+	}
+
+	html, err := mailer.Render(templateName, data, s.UserLocation(ctx, userID))
+	if err != nil {
+		return fmt.Errorf("ошибка формирования письма: %w", err)
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:          email,
+		Subject:     subject,
+		HTML:        html,
+		Attachments: attachments,
+	})
+}
+
+// Отправка файла с кодами маркировки
+func (s *Service) notifyKIZReady(userID int, inn string, result KIZResult) {
+	var attachments []mailer.Attachment
+	if data, err := os.ReadFile(result.FilePath); err == nil {
+		attachments = append(attachments, mailer.Attachment{
+			Filename:    filepath.Base(result.FilePath),
+			ContentType: "application/pdf",
+			Data:        data,
+		})
+	} else {
+		s.logger.Printf("Ошибка чтения файла КИЗ %s: %v", result.FilePath, err)
+	}
+
+	s.sendNotification(context.Background(), userID,
+		func(p models.NotificationPreferences) bool { return p.KIZFiles },
+		fmt.Sprintf("Коды маркировки по запросу №%d", result.RequestID),
+		mailer.TemplateKIZReady,
+		kizReadyEmail{RequestID: result.RequestID, INN: inn, KIZs: result.KIZs},
+		attachments...)
+}
+
+// Отправка уведомления о неудачной операции
+func (s *Service) notifyFailure(userID int, operation, reason string) {
+	s.sendNotification(context.Background(), userID,
+		func(p models.NotificationPreferences) bool { return p.Failures },
+		"Ошибка: "+operation,
+		mailer.TemplateFailure,
+		failureEmail{Operation: operation, Reason: reason, Time: time.Now()})
+}
+
+// Событие вебхука об изменении статуса платежа
+type paymentEvent struct {
+	PaymentID int         `json:"payment_id"`
+	OrderID   int         `json:"order_id,omitempty"`
+	Amount    money.Money `json:"amount"`
+	Currency  string      `json:"currency"`
+	Status    string      `json:"status"`
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/onec"
+	"project-znak/internal/repository"
+)
+
+// Ограничения обмена с 1С
+const (
+	oneCMaxDays    = 366
+	oneCMaxRecords = 10000 // Наибольшее число заказов, платежей или кодов в выгрузке
+	oneCMaxSales   = 100   // Наибольшее число чеков в загружаемом отчете о розничных продажах
+)
+
+// OneCExportRequest - выгрузка для 1С за период в днях (включительно). Без организации
+// выгружаются данные пользователя.
+type OneCExportRequest struct {
+	OrganizationID int
+	From           string `validate:"required,date"`
+	To             string `validate:"required,date"`
+	Format         string `validate:"oneof=commerceml csv"` // commerceml (по умолчанию) или csv
+}
+
+// RetailSaleResult - итог загрузки чека розничной продажи: документ вывода из оборота
+// или причина, по которой он не создан
+type RetailSaleResult struct {
+	Number     string `json:"number" xml:"number"`
+	Date       string `json:"date" xml:"date"`
+	Codes      int    `json:"codes" xml:"codes"`
+	DocumentID int    `json:"document_id,omitempty" xml:"document_id,omitempty"`
+	Error      string `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+// ExportOneC формирует выгрузку заказов, платежей и кодов маркировки за период в формате
+// CommerceML или архив CSV
+func (s *Service) ExportOneC(ctx context.Context, userID int, request OneCExportRequest) ([]byte, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	if err := s.checkInventoryAccess(ctx, userID, request.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	// Формат дат проверен ValidateRequest
+	from, _ := time.ParseInLocation(documentDateLayout, request.From, time.Local)
+	to, _ := time.ParseInLocation(documentDateLayout, request.To, time.Local)
+	if from.After(to) {
+		return nil, NewError(KindInvalid, "Начало периода позже его окончания", nil)
+	}
+	if to.Sub(from) >= oneCMaxDays*24*time.Hour {
+		return nil, NewError(KindInvalid, fmt.Sprintf("Период выгрузки не может превышать %d дней", oneCMaxDays), nil)
+	}
+	filter := repository.ExchangeFilter{
+		UserID:         userID,
+		OrganizationID: request.OrganizationID,
+		From:           from,
+		To:             to.AddDate(0, 0, 1),
+		Limit:          oneCMaxRecords + 1,
+	}
+
+	exchange := onec.Exchange{
+		Seller:    onec.Party{Name: s.invoice.SellerName, INN: s.invoice.INN, KPP: s.invoice.KPP},
+		CreatedAt: time.Now(),
+	}
+	if request.OrganizationID > 0 {
+		org, err := s.repo.Organization(ctx, request.OrganizationID)
+		if err != nil {
+			return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения организации: %w", err))
+		}
+		exchange.Buyer = onec.Party{Name: org.Name, INN: org.INN, KPP: org.KPP}
+	}
+
+	orders, err := s.repo.ExchangeOrders(ctx, filter)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса заказов: %w", err))
+	}
+	payments, err := s.repo.ExchangePayments(ctx, filter)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса платежей: %w", err))
+	}
+
+	// В CommerceML коды выгружаются в строках заказов, в CSV - отдельным файлом за период
+	var codes []repository.ExchangeCode
+	if request.Format == onec.FormatCSV {
+		codes, err = s.repo.ExchangeCodes(ctx, filter)
+	} else if len(orders) > 0 {
+		orderIDs := make([]int, len(orders))
+		for i, order := range orders {
+			orderIDs[i] = order.ID
+		}
+		codes, err = s.repo.OrderCodes(ctx, orderIDs)
+	}
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса кодов: %w", err))
+	}
+	if len(orders) > oneCMaxRecords || len(payments) > oneCMaxRecords || len(codes) > oneCMaxRecords {
+		return nil, NewError(KindInvalid, fmt.Sprintf("За период больше %d записей, уменьшите период выгрузки", oneCMaxRecords), nil)
+	}
+
+	exchange.Orders = oneCOrders(orders, codes)
+	for _, payment := range payments {
+		exchange.Payments = append(exchange.Payments, onec.Payment{
+			Number:        payment.ID,
+			OrderNumber:   payment.OrderID,
+			Date:          payment.CreatedAt,
+			Amount:        payment.Amount.Float64(),
+			Currency:      payment.Currency,
+			Status:        payment.Status,
+			TransactionID: payment.TransactionID,
+		})
+	}
+	if request.Format == onec.FormatCSV {
+		for _, code := range codes {
+			exchange.Codes = append(exchange.Codes, onec.Code{
+				Code:        code.Code,
+				GTIN:        code.GTIN,
+				Status:      code.Status,
+				RequestID:   code.RequestID,
+				OrderNumber: code.OrderID,
+				IssuedAt:    code.CreatedAt,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if request.Format == onec.FormatCSV {
+		err = onec.WriteCSV(&buf, &exchange)
+	} else {
+		err = onec.WriteCommerceML(&buf, &exchange)
+	}
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка формирования выгрузки", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Заказы выгрузки с кодами, распределенными по строкам заказа по GTIN
+func oneCOrders(orders []models.Order, codes []repository.ExchangeCode) []onec.Order {
+	type key struct {
+		orderID int
+		gtin    string
+	}
+	byItem := make(map[key][]string)
+	for _, code := range codes {
+		k := key{code.OrderID, code.GTIN}
+		byItem[k] = append(byItem[k], code.Code)
+	}
+
+	result := make([]onec.Order, len(orders))
+	for i, order := range orders {
+		result[i] = onec.Order{
+			Number: order.ID,
+			Date:   order.CreatedAt,
+			Status: order.Status,
+			Amount: order.TotalAmount,
+		}
+		for _, item := range order.Items {
+			k := key{order.ID, item.GTIN}
+			result[i].Items = append(result[i].Items, onec.Item{
+				GTIN:     item.GTIN,
+				Name:     item.ProductName,
+				Quantity: item.Quantity,
+				Price:    item.Price,
+				Codes:    byItem[k],
+			})
+			// Коды GTIN, повторяющегося в нескольких строках, выгружаются в первой из них
+			delete(byItem, k)
+		}
+	}
+	return result
+}
+
+// ImportRetailSales загружает отчет о розничных продажах из 1С (CommerceML или CSV) и для
+// каждого чека создает документ вывода из оборота с причиной «продажа». Чеки обрабатываются
+// независимо: ошибка одного чека не отменяет документы остальных.
+func (s *Service) ImportRetailSales(ctx context.Context, actor Actor, data []byte) ([]RetailSaleResult, error) {
+	if _, err := s.actorUserID(ctx, actor); err != nil {
+		return nil, err
+	}
+	sales, err := onec.ParseRetailSales(data)
+	if err != nil {
+		return nil, NewError(KindInvalid, "Некорректный файл продаж", err)
+	}
+	if len(sales) > oneCMaxSales {
+		return nil, NewError(KindInvalid, fmt.Sprintf("Файл содержит %d чеков, за одну загрузку можно передать не более %d", len(sales), oneCMaxSales), nil)
+	}
+
+	results := make([]RetailSaleResult, len(sales))
+	for i, sale := range sales {
+		date := sale.Date.Format(documentDateLayout)
+		results[i] = RetailSaleResult{Number: sale.Number, Date: date, Codes: len(sale.Codes)}
+		if ctx.Err() != nil {
+			results[i].Error = "Чек не обработан: загрузка прервана"
+			continue
+		}
+
+		doc, err := s.CreateRetirementDocument(ctx, actor, RetirementRequest{
+			TelegramID:            actor.TelegramID,
+			Reason:                models.RetirementReasonRetail,
+			ActionDate:            date,
+			PrimaryDocumentNumber: sale.Number,
+			PrimaryDocumentDate:   date,
+			Codes:                 sale.Codes,
+		})
+		var serviceErr *Error
+		switch {
+		case err == nil:
+			results[i].DocumentID = doc.ID
+		case errors.As(err, &serviceErr):
+			results[i].Error = serviceErr.Message
+			if serviceErr.Kind == KindInternal {
+				s.logger.Printf("Ошибка загрузки чека %s: %v", sale.Number, err)
+			}
+		default:
+			results[i].Error = err.Error()
+		}
+	}
+	return results, nil
+}
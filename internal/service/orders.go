@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"project-znak/internal/catalog"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// Стоимость одного кода маркировки для товарных групп без тарифа, руб.
+const kizUnitPrice = 100.0
+
+// Плата Честного ЗНАКа за один код маркировки для групп, где она не указана в тарифе,
+// руб. с НДС
+const kizFeeCost = 0.6
+
+// OrderCreateRequest - запрос на создание заказа. Если товарная группа не указана,
+// она определяется по карточкам товаров в Национальном каталоге.
+type OrderCreateRequest struct {
+	TelegramID     int64              `json:"telegram_id"`
+	OrganizationID int                `json:"organization_id,omitempty"`
+	ProductGroup   string             `json:"product_group,omitempty" validate:"product_group"`
+	Items          []OrderItemRequest `json:"items" validate:"required"`
+}
+
+// OrderItemRequest - позиция заказа в запросе
+type OrderItemRequest struct {
+	GTIN     string `json:"gtin" validate:"required,gtin"`
+	Quantity int    `json:"quantity" validate:"required,min=1"`
+}
+
+// CreateOrder создает заказ пользователя от имени организации
+func (s *Service) CreateOrder(ctx context.Context, actor Actor, request OrderCreateRequest) (*models.Order, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := s.prepareOrder(ctx, userID, request)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.placeOrder(ctx, actor, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// Заказ пользователя с позициями, дополненными данными Национального каталога, и ценами
+// по тарифу товарной группы; заказ не сохраняется
+func (s *Service) prepareOrder(ctx context.Context, userID int, request OrderCreateRequest) (*models.Order, error) {
+	organizationID, err := s.organizationForOperation(ctx, userID, request.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	order := models.Order{
+		UserID:         userID,
+		OrganizationID: organizationID,
+		ProductGroup:   request.ProductGroup,
+		Status:         models.OrderStatusCreated,
+	}
+	for _, item := range request.Items {
+		order.Items = append(order.Items, models.OrderItem{
+			GTIN:     item.GTIN,
+			Quantity: item.Quantity,
+			Price:    kizUnitPrice,
+		})
+	}
+	order.TotalAmount = order.CalculateTotal()
+
+	if err := order.Validate(); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	if err := s.enrichOrderItems(ctx, order.Items); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	if err := order.ResolveProductGroup(); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	// Стоимость кодов и плата Честного ЗНАКа определяются тарифом товарной группы
+	tariff, err := s.tariff(ctx, order.ProductGroup)
+	if err != nil {
+		return nil, err
+	}
+	for i := range order.Items {
+		order.Items[i].Price = tariff.UnitPrice
+		order.Items[i].SetCost(*tariff.FeeCost)
+	}
+	order.TotalAmount = order.CalculateTotal()
+	return &order, nil
+}
+
+// Сохранение заказа; заказ на сумму от порога требует подтверждения
+func (s *Service) placeOrder(ctx context.Context, actor Actor, order *models.Order) error {
+	if s.confirmation.OrderThreshold > 0 && order.TotalAmount >= s.confirmation.OrderThreshold {
+		if err := s.requireConfirmation(ctx, order.UserID, models.ConfirmationActionOrder, orderSubject(order),
+			fmt.Sprintf("заказ кодов маркировки на сумму %.2f ₽, позиций: %d", order.TotalAmount, len(order.Items))); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.CreateOrder(ctx, order); err != nil {
+		return NewError(KindInternal, "Ошибка создания заказа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "order", order.ID, nil, order)
+	return nil
+}
+
+// Параметры заказа для подтверждения: повторный запрос должен заказывать те же коды
+func orderSubject(order *models.Order) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d|%s", order.OrganizationID, order.ProductGroup)
+	for _, item := range order.Items {
+		fmt.Fprintf(hash, "|%s:%d", item.GTIN, item.Quantity)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Приведение GTIN к 14 цифрам и дополнение позиций данными Национального каталога.
+// Отсутствие товара в каталоге считается ошибкой, недоступность каталога - нет.
+func (s *Service) enrichOrderItems(ctx context.Context, items []models.OrderItem) error {
+	for i := range items {
+		items[i].GTIN = models.NormalizeGTIN(items[i].GTIN)
+
+		product, err := s.lookupProduct(ctx, items[i].GTIN)
+		if err != nil {
+			return err
+		}
+		if product == nil {
+			continue
+		}
+
+		items[i].ProductName = product.Name
+		items[i].ProductGroup = product.ProductGroup
+	}
+
+	return nil
+}
+
+// Карточка товара из Национального каталога с кэшированием. Возвращает nil, если каталог
+// отключен или недоступен, и ошибку, если товар в каталоге не найден.
+func (s *Service) lookupProduct(ctx context.Context, gtin string) (*catalog.Product, error) {
+	if !s.catalog.Enabled() {
+		return nil, nil
+	}
+
+	var product catalog.Product
+	cacheKey := "gtin:" + gtin
+	if s.cache.Get(ctx, cacheKey, &product) {
+		return &product, nil
+	}
+
+	found, err := s.catalog.Lookup(ctx, gtin)
+	if errors.Is(err, catalog.ErrNotFound) {
+		return nil, fmt.Errorf("товар с GTIN %s не найден в Национальном каталоге", gtin)
+	} else if err != nil {
+		s.logger.Printf("Ошибка запроса к Национальному каталогу для GTIN %s: %v", gtin, err)
+		return nil, nil
+	}
+	s.cache.Set(ctx, cacheKey, *found, catalogCacheTTL)
+	return found, nil
+}
+
+// ListOrders возвращает заказы пользователя. Заказы организации доступны всем
+// ее участникам, без указания организации возвращаются только личные заказы.
+func (s *Service) ListOrders(ctx context.Context, userID, organizationID int, status string, limit int) ([]models.Order, error) {
+	if organizationID > 0 {
+		if _, err := s.repo.OrganizationRole(ctx, organizationID, userID); errors.Is(err, repository.ErrNotOrganizationMember) {
+			return nil, NewError(KindForbidden, "Пользователь не состоит в указанной организации", nil)
+		} else if err != nil {
+			return nil, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка проверки участия в организации: %w", err))
+		}
+	}
+
+	orders, err := s.repo.ListOrders(ctx, repository.OrderFilter{
+		UserID:         userID,
+		OrganizationID: organizationID,
+		Status:         status,
+		Limit:          limit,
+	})
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса заказов: %w", err))
+	}
+	return orders, nil
+}
+
+// GetOrder возвращает заказ с позициями, платежами и запросами КИЗ
+func (s *Service) GetOrder(ctx context.Context, userID, orderID int) (*repository.OrderDetails, error) {
+	details, err := s.repo.OrderDetails(ctx, orderID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Заказ не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения заказа: %w", err))
+	}
+	return details, nil
+}
+
+// CancelOrder отменяет заказ вместе с ожидающими платежами, неоплаченными счетами и запросами КИЗ.
+// Если version > 0, заказ отменяется, только если его версия не изменилась с момента чтения клиентом.
+func (s *Service) CancelOrder(ctx context.Context, actor Actor, userID, orderID, version int) error {
+	previousStatus, err := s.repo.CancelOrder(ctx, orderID, userID, version)
+	if errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Заказ не найден", nil)
+	} else if errors.Is(err, repository.ErrConflict) {
+		return versionConflict("Заказ изменен другим запросом")
+	} else if errors.Is(err, repository.ErrOrderNotCancellable) {
+		return NewError(KindConflict, "Заказ не может быть отменен в текущем статусе", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка отмены заказа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "order", orderID,
+		map[string]string{"status": previousStatus},
+		map[string]string{"status": models.OrderStatusCancelled})
+
+	return nil
+}
@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project-znak/internal/cron"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// Число расписаний заказов, выполняемых за одну проверку
+const orderScheduleBatch = 100
+
+// Операция в уведомлениях об ошибке заказа по расписанию
+const orderScheduleOperation = "Заказ по расписанию"
+
+// OrderScheduleRequest - запрос на создание или изменение расписания заказов. Расписание
+// задается выражением cron из пяти полей в часовом поясе пользователя, например
+// "0 9 * * MON" - каждый понедельник в 9:00. Если организация не указана, заказы
+// делаются от имени организации пользователя по умолчанию.
+type OrderScheduleRequest struct {
+	TelegramID     int64              `json:"telegram_id"`
+	OrganizationID int                `json:"organization_id,omitempty"`
+	Name           string             `json:"name" validate:"required,max=100"`
+	Cron           string             `json:"cron" validate:"required,max=100"`
+	ProductGroup   string             `json:"product_group,omitempty" validate:"product_group"`
+	Items          []OrderItemRequest `json:"items" validate:"required,max=100,dive"`
+	Version        int                `json:"version,omitempty"` // Версия для изменения; 0 - без проверки
+}
+
+// CreateOrderSchedule сохраняет расписание заказов пользователя. Расписание на сумму от
+// порога подтверждения требует подтверждения, как заказ на эту сумму.
+func (s *Service) CreateOrderSchedule(ctx context.Context, actor Actor, request OrderScheduleRequest) (*models.OrderSchedule, error) {
+	schedule, err := s.orderSchedule(ctx, actor, request)
+	if err != nil {
+		return nil, err
+	}
+	schedule.Status = models.OrderScheduleStatusActive
+	if schedule.NextRunAt, err = s.nextOrderScheduleRun(ctx, schedule, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateOrderSchedule(ctx, schedule); err != nil {
+		return nil, NewError(KindInternal, "Ошибка сохранения расписания заказов", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "order_schedule", schedule.ID, nil, schedule)
+	return schedule, nil
+}
+
+// UpdateOrderSchedule заменяет название, расписание, организацию и позиции расписания
+// заказов. Следующий запуск активного расписания пересчитывается.
+func (s *Service) UpdateOrderSchedule(ctx context.Context, actor Actor, scheduleID int, request OrderScheduleRequest) (*models.OrderSchedule, error) {
+	schedule, err := s.orderSchedule(ctx, actor, request)
+	if err != nil {
+		return nil, err
+	}
+	before, err := s.GetOrderSchedule(ctx, schedule.UserID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.ID = scheduleID
+	schedule.Status = before.Status
+	if schedule.Status == models.OrderScheduleStatusActive {
+		if schedule.NextRunAt, err = s.nextOrderScheduleRun(ctx, schedule, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.saveOrderSchedule(ctx, schedule, request.Version); err != nil {
+		return nil, err
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "order_schedule", scheduleID, before, schedule)
+	return schedule, nil
+}
+
+// Расписание заказов по запросу. Выражение cron и позиции проверяются, а стоимость заказа
+// рассчитывается по текущему тарифу, чтобы ошибки обнаружились до первого запуска.
+func (s *Service) orderSchedule(ctx context.Context, actor Actor, request OrderScheduleRequest) (*models.OrderSchedule, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		return nil, NewError(KindInvalid, "Не указано название расписания", nil)
+	}
+	expr := strings.Join(strings.Fields(request.Cron), " ")
+	if _, err := cron.Parse(expr); err != nil {
+		return nil, NewError(KindInvalid, "Некорректное расписание cron", err)
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &models.OrderSchedule{
+		UserID:         userID,
+		OrganizationID: request.OrganizationID,
+		Name:           name,
+		Cron:           expr,
+		ProductGroup:   request.ProductGroup,
+	}
+	for _, item := range request.Items {
+		schedule.Items = append(schedule.Items, models.OrderLine{
+			GTIN:     models.NormalizeGTIN(item.GTIN),
+			Quantity: item.Quantity,
+		})
+	}
+
+	order, err := s.prepareOrder(ctx, userID, scheduleOrderRequest(schedule))
+	if err != nil {
+		return nil, err
+	}
+	if s.confirmation.OrderThreshold > 0 && order.TotalAmount >= s.confirmation.OrderThreshold {
+		if err := s.requireConfirmation(ctx, userID, models.ConfirmationActionSchedule, orderSubject(order)+"|"+expr,
+			fmt.Sprintf("расписание заказов «%s» (%s) на сумму %.2f ₽ за запуск", name, expr, order.TotalAmount)); err != nil {
+			return nil, err
+		}
+	}
+	return schedule, nil
+}
+
+// Время следующего запуска расписания после now в часовом поясе пользователя, в UTC
+func (s *Service) nextOrderScheduleRun(ctx context.Context, schedule *models.OrderSchedule, now time.Time) (*time.Time, error) {
+	expr, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return nil, NewError(KindInvalid, "Некорректное расписание cron", err)
+	}
+	next := expr.Next(now.In(s.UserLocation(ctx, schedule.UserID)))
+	if next.IsZero() {
+		return nil, NewError(KindInvalid, "Расписание не срабатывает в ближайшие пять лет", nil)
+	}
+	next = next.UTC()
+	return &next, nil
+}
+
+// Сохранение изменений расписания с проверкой версии
+func (s *Service) saveOrderSchedule(ctx context.Context, schedule *models.OrderSchedule, version int) error {
+	err := s.repo.UpdateOrderSchedule(ctx, schedule, version)
+	if errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Расписание заказов не найдено", nil)
+	} else if errors.Is(err, repository.ErrConflict) {
+		return versionConflict("Расписание заказов изменено другим запросом")
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка сохранения расписания заказов", err)
+	}
+	return nil
+}
+
+// ListOrderSchedules возвращает расписания заказов пользователя
+func (s *Service) ListOrderSchedules(ctx context.Context, userID int) ([]models.OrderSchedule, error) {
+	schedules, err := s.repo.ListOrderSchedules(ctx, userID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса расписаний заказов: %w", err))
+	}
+	return schedules, nil
+}
+
+// GetOrderSchedule возвращает расписание заказов пользователя
+func (s *Service) GetOrderSchedule(ctx context.Context, userID, scheduleID int) (*models.OrderSchedule, error) {
+	schedule, err := s.repo.OrderSchedule(ctx, scheduleID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Расписание заказов не найдено", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения расписания заказов: %w", err))
+	}
+	return schedule, nil
+}
+
+// DeleteOrderSchedule удаляет расписание заказов пользователя
+func (s *Service) DeleteOrderSchedule(ctx context.Context, actor Actor, userID, scheduleID int) error {
+	before, err := s.GetOrderSchedule(ctx, userID, scheduleID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteOrderSchedule(ctx, scheduleID, userID); errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Расписание заказов не найдено", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка удаления расписания заказов", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionDelete, "order_schedule", scheduleID, before, nil)
+	return nil
+}
+
+// PauseOrderSchedule приостанавливает расписание заказов: запуски не выполняются до возобновления
+func (s *Service) PauseOrderSchedule(ctx context.Context, actor Actor, userID, scheduleID int) (*models.OrderSchedule, error) {
+	return s.setOrderScheduleStatus(ctx, actor, userID, scheduleID, models.OrderScheduleStatusPaused)
+}
+
+// ResumeOrderSchedule возобновляет приостановленное расписание заказов. Запуски, пропущенные
+// за время паузы, не выполняются: следующий запуск рассчитывается от текущего времени.
+func (s *Service) ResumeOrderSchedule(ctx context.Context, actor Actor, userID, scheduleID int) (*models.OrderSchedule, error) {
+	return s.setOrderScheduleStatus(ctx, actor, userID, scheduleID, models.OrderScheduleStatusActive)
+}
+
+// Смена статуса расписания заказов
+func (s *Service) setOrderScheduleStatus(ctx context.Context, actor Actor, userID, scheduleID int, status string) (*models.OrderSchedule, error) {
+	schedule, err := s.GetOrderSchedule(ctx, userID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Status == status {
+		if status == models.OrderScheduleStatusPaused {
+			return nil, NewError(KindConflict, "Расписание заказов уже приостановлено", nil)
+		}
+		return nil, NewError(KindConflict, "Расписание заказов уже активно", nil)
+	}
+
+	before := *schedule
+	schedule.Status = status
+	schedule.NextRunAt = nil
+	if status == models.OrderScheduleStatusActive {
+		if schedule.NextRunAt, err = s.nextOrderScheduleRun(ctx, schedule, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.saveOrderSchedule(ctx, schedule, before.Version); err != nil {
+		return nil, err
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "order_schedule", scheduleID,
+		map[string]string{"status": before.Status},
+		map[string]string{"status": status})
+	return schedule, nil
+}
+
+// OrderScheduleOrganizationID возвращает организацию, от имени которой делаются заказы
+// по расписанию: указанную в расписании или организацию пользователя по умолчанию.
+// Возвращает 0, если расписание не найдено.
+func (s *Service) OrderScheduleOrganizationID(ctx context.Context, userID, scheduleID int) (int, error) {
+	schedule, err := s.repo.OrderSchedule(ctx, scheduleID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return s.RequestOrganizationID(ctx, userID, schedule.OrganizationID)
+}
+
+// RunOrderScheduler раз в interval выполняет расписания заказов, время запуска которых
+// наступило: создает заказ, оплачивает его с бонусного баланса и запрашивает коды
+// маркировки. Коды отправляются пользователю так же, как при запросе через API.
+func (s *Service) RunOrderScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			s.runOrderSchedules(ctx, time.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Выполнение наступивших запусков. Следующий запуск рассчитывается от текущего времени,
+// поэтому запуски, пропущенные во время остановки сервиса, выполняются один раз.
+func (s *Service) runOrderSchedules(ctx context.Context, now time.Time) {
+	schedules, err := s.repo.DueOrderSchedules(ctx, now, orderScheduleBatch)
+	if err != nil {
+		s.logger.Printf("Ошибка получения расписаний заказов: %v", err)
+		return
+	}
+
+	for i := range schedules {
+		if ctx.Err() != nil {
+			return
+		}
+		schedule := &schedules[i]
+
+		next, err := s.nextOrderScheduleRun(ctx, schedule, now)
+		if err != nil {
+			next = nil
+		}
+		if err := s.repo.ClaimOrderSchedule(ctx, schedule, now, next); errors.Is(err, repository.ErrConflict) {
+			// Расписание изменено или уже выполняется другим экземпляром сервиса
+			continue
+		} else if err != nil {
+			s.logger.Printf("Ошибка запуска расписания заказов %d: %v", schedule.ID, err)
+			continue
+		}
+
+		orderID, err := s.runOrderSchedule(ctx, schedule)
+		lastError := ""
+		if err != nil {
+			lastError = AsError(err).Message
+			s.logger.Printf("Ошибка заказа по расписанию %d: %v", schedule.ID, err)
+		}
+		if err := s.repo.FinishOrderSchedule(ctx, schedule.ID, orderID, lastError); err != nil {
+			s.logger.Printf("Ошибка сохранения результата расписания заказов %d: %v", schedule.ID, err)
+		}
+	}
+}
+
+// Запуск расписания: заказ, оплата с баланса и запрос кодов маркировки от имени владельца
+// расписания. Возвращает ID созданного заказа, в том числе вместе с ошибкой оплаты или
+// запроса кодов. Об ошибках до запроса кодов пользователь получает уведомление; об ошибке
+// запроса кодов уведомляет RequestKIZs.
+func (s *Service) runOrderSchedule(ctx context.Context, schedule *models.OrderSchedule) (int, error) {
+	actor := Actor{UserID: schedule.UserID}
+	fail := func(orderID int, err error) (int, error) {
+		reason := fmt.Sprintf("расписание «%s»: %s", schedule.Name, AsError(err).Message)
+		go s.notifyFailure(schedule.UserID, orderScheduleOperation, reason)
+		return orderID, err
+	}
+
+	// Права проверяются при каждом запуске: роль пользователя в организации могла измениться
+	if err := s.Authorize(ctx, schedule.UserID, schedule.OrganizationID, models.PermOrdersCreate); err != nil {
+		return fail(0, err)
+	}
+	order, err := s.prepareOrder(ctx, schedule.UserID, scheduleOrderRequest(schedule))
+	if err != nil {
+		return fail(0, err)
+	}
+	// Подтверждение крупной суммы запрашивается при создании расписания
+	if err := s.repo.CreateOrder(ctx, order); err != nil {
+		return fail(0, NewError(KindInternal, "Ошибка создания заказа", err))
+	}
+	s.recordAudit(ctx, actor, AuditActionCreate, "order", order.ID, nil, order)
+
+	if err := s.Authorize(ctx, schedule.UserID, order.OrganizationID, models.PermPaymentsCreate); err != nil {
+		return fail(order.ID, err)
+	}
+	if err := s.payOrderFromBalance(ctx, actor, order); err != nil {
+		return fail(order.ID, err)
+	}
+
+	telegramID, err := s.repo.UserTelegramID(ctx, schedule.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fail(order.ID, NewError(KindInvalid, "Для получения кодов привяжите аккаунт Telegram", nil))
+	} else if err != nil {
+		return fail(order.ID, NewError(KindInternal, "Ошибка запроса кодов маркировки", err))
+	}
+	request := KIZRequest{
+		TelegramID:     telegramID,
+		OrderID:        order.ID,
+		OrganizationID: order.OrganizationID,
+		ProductGroup:   order.ProductGroup,
+	}
+	for _, item := range order.Items {
+		for i := 0; i < item.Quantity; i++ {
+			request.GTINs = append(request.GTINs, item.GTIN)
+		}
+	}
+	result, err := s.RequestKIZs(ctx, actor, request)
+	if err != nil && (result == nil || result.RequestID == 0) {
+		// Ошибка до обращения к Честному ЗНАКу: RequestKIZs о ней не уведомляет
+		return fail(order.ID, err)
+	}
+	return order.ID, err
+}
+
+// Оплата заказа с бонусного баланса пользователя
+func (s *Service) payOrderFromBalance(ctx context.Context, actor Actor, order *models.Order) error {
+	paymentID, err := s.repo.PayOrderFromBalance(ctx, order.ID, order.UserID, time.Now())
+	if errors.Is(err, repository.ErrInsufficientBalance) {
+		return NewError(KindConflict, fmt.Sprintf("Недостаточно средств на бонусном балансе для оплаты заказа №%d", order.ID), nil)
+	} else if errors.Is(err, repository.ErrOrderNotPayable) {
+		return NewError(KindConflict, "Заказ уже оплачен или отменен", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка оплаты заказа с баланса", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "payment", paymentID, nil, map[string]any{
+		"order_id": order.ID,
+		"amount":   order.TotalAmount,
+		"provider": models.PaymentProviderBalance,
+	})
+	s.recordAudit(ctx, actor, AuditActionUpdate, "order", order.ID,
+		map[string]string{"status": order.Status},
+		map[string]string{"status": models.OrderStatusPaid})
+	order.Status = models.OrderStatusPaid
+	return nil
+}
+
+// Запрос на создание заказа с позициями расписания
+func scheduleOrderRequest(schedule *models.OrderSchedule) OrderCreateRequest {
+	request := OrderCreateRequest{OrganizationID: schedule.OrganizationID, ProductGroup: schedule.ProductGroup}
+	for _, line := range schedule.Items {
+		request.Items = append(request.Items, OrderItemRequest{GTIN: line.GTIN, Quantity: line.Quantity})
+	}
+	return request
+}
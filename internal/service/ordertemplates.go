@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// OrderTemplateRequest - запрос на создание или изменение шаблона заказа. Если организация
+// не указана, заказ по шаблону делается от имени организации пользователя по умолчанию.
+type OrderTemplateRequest struct {
+	TelegramID     int64              `json:"telegram_id"`
+	OrganizationID int                `json:"organization_id,omitempty"`
+	Name           string             `json:"name" validate:"required,max=100"`
+	ProductGroup   string             `json:"product_group,omitempty" validate:"product_group"`
+	Items          []OrderItemRequest `json:"items" validate:"required,max=100,dive"`
+}
+
+// CreateOrderTemplate сохраняет шаблон заказа пользователя
+func (s *Service) CreateOrderTemplate(ctx context.Context, actor Actor, request OrderTemplateRequest) (*models.OrderTemplate, error) {
+	template, err := s.orderTemplate(ctx, actor, request)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateOrderTemplate(ctx, template); err != nil {
+		return nil, NewError(KindInternal, "Ошибка сохранения шаблона заказа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "order_template", template.ID, nil, template)
+	return template, nil
+}
+
+// UpdateOrderTemplate заменяет название, организацию и позиции шаблона заказа
+func (s *Service) UpdateOrderTemplate(ctx context.Context, actor Actor, templateID int, request OrderTemplateRequest) (*models.OrderTemplate, error) {
+	template, err := s.orderTemplate(ctx, actor, request)
+	if err != nil {
+		return nil, err
+	}
+	before, err := s.GetOrderTemplate(ctx, template.UserID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	template.ID = templateID
+	if err := s.repo.UpdateOrderTemplate(ctx, template); errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Шаблон заказа не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка сохранения шаблона заказа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "order_template", templateID, before, template)
+	return template, nil
+}
+
+// Шаблон заказа по запросу с проверкой позиций и участия пользователя в организации
+func (s *Service) orderTemplate(ctx context.Context, actor Actor, request OrderTemplateRequest) (*models.OrderTemplate, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		return nil, NewError(KindInvalid, "Не указано название шаблона", nil)
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if request.OrganizationID > 0 {
+		if _, err := s.organizationForOperation(ctx, userID, request.OrganizationID); err != nil {
+			return nil, err
+		}
+	}
+
+	template := &models.OrderTemplate{
+		UserID:         userID,
+		OrganizationID: request.OrganizationID,
+		Name:           name,
+		ProductGroup:   request.ProductGroup,
+	}
+	for _, item := range request.Items {
+		template.Items = append(template.Items, models.OrderLine{
+			GTIN:     models.NormalizeGTIN(item.GTIN),
+			Quantity: item.Quantity,
+		})
+	}
+	return template, nil
+}
+
+// ListOrderTemplates возвращает шаблоны заказов пользователя
+func (s *Service) ListOrderTemplates(ctx context.Context, userID int) ([]models.OrderTemplate, error) {
+	templates, err := s.repo.ListOrderTemplates(ctx, userID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса шаблонов заказов: %w", err))
+	}
+	return templates, nil
+}
+
+// GetOrderTemplate возвращает шаблон заказа пользователя
+func (s *Service) GetOrderTemplate(ctx context.Context, userID, templateID int) (*models.OrderTemplate, error) {
+	template, err := s.repo.OrderTemplate(ctx, templateID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Шаблон заказа не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения шаблона заказа: %w", err))
+	}
+	return template, nil
+}
+
+// DeleteOrderTemplate удаляет шаблон заказа пользователя
+func (s *Service) DeleteOrderTemplate(ctx context.Context, actor Actor, userID, templateID int) error {
+	before, err := s.GetOrderTemplate(ctx, userID, templateID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteOrderTemplate(ctx, templateID, userID); errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Шаблон заказа не найден", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка удаления шаблона заказа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionDelete, "order_template", templateID, before, nil)
+	return nil
+}
+
+// OrderTemplateOrganizationID возвращает организацию, от имени которой делается заказ по
+// шаблону: указанную в шаблоне или организацию пользователя по умолчанию. Возвращает 0,
+// если шаблон не найден.
+func (s *Service) OrderTemplateOrganizationID(ctx context.Context, userID, templateID int) (int, error) {
+	template, err := s.repo.OrderTemplate(ctx, templateID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return s.RequestOrganizationID(ctx, userID, template.OrganizationID)
+}
+
+// OrderFromTemplate создает заказ по шаблону. Цены рассчитываются по текущему тарифу.
+func (s *Service) OrderFromTemplate(ctx context.Context, actor Actor, templateID int) (*models.Order, error) {
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	template, err := s.GetOrderTemplate(ctx, userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	request := OrderCreateRequest{OrganizationID: template.OrganizationID, ProductGroup: template.ProductGroup}
+	for _, item := range template.Items {
+		request.Items = append(request.Items, OrderItemRequest{GTIN: item.GTIN, Quantity: item.Quantity})
+	}
+	return s.orderCopy(ctx, actor, userID, request)
+}
+
+// Reorder создает новый заказ с позициями, товарной группой и организацией заказа orderID.
+// Цены рассчитываются по текущему тарифу; новый заказ ожидает оплаты, как созданный
+// через CreateOrder. Повторить можно заказ в любом статусе.
+func (s *Service) Reorder(ctx context.Context, actor Actor, orderID int) (*models.Order, error) {
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	source, err := s.GetOrder(ctx, userID, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	request := OrderCreateRequest{OrganizationID: source.OrganizationID, ProductGroup: source.ProductGroup}
+	for _, item := range source.Items {
+		request.Items = append(request.Items, OrderItemRequest{GTIN: item.GTIN, Quantity: item.Quantity})
+	}
+	return s.orderCopy(ctx, actor, userID, request)
+}
+
+// Создание заказа с позициями шаблона или прежнего заказа
+func (s *Service) orderCopy(ctx context.Context, actor Actor, userID int, request OrderCreateRequest) (*models.Order, error) {
+	order, err := s.prepareOrder(ctx, userID, request)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.placeOrder(ctx, actor, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"project-znak/internal/models"
+	"project-znak/internal/telegram"
+)
+
+// Наибольшее число строк файла заказа
+const orderUploadMaxRows = 1000
+
+// Наибольший размер файла заказа, загружаемого из Telegram
+const orderUploadMaxFileSize = 10 << 20 // 10MB
+
+// Названия колонок файла заказа
+var orderUploadColumns = map[string]string{
+	"gtin":       "gtin",
+	"гтин":       "gtin",
+	"код товара": "gtin",
+	"count":      "count",
+	"quantity":   "count",
+	"количество": "count",
+	"кол-во":     "count",
+}
+
+// OrderUploadRequest - параметры заказа по файлу со списком GTIN. Файл передается
+// в запросе или идентификатором file_id документа, отправленного пользователем боту.
+// Без PreviewID файл только проверяется, с PreviewID из ответа проверки создается заказ.
+type OrderUploadRequest struct {
+	TelegramID     int64  `json:"telegram_id"`
+	OrganizationID int    `json:"organization_id,omitempty"`
+	ProductGroup   string `json:"product_group,omitempty" validate:"product_group"`
+	FileID         string `json:"file_id,omitempty"`    // file_id документа в Telegram
+	PreviewID      string `json:"preview_id,omitempty"` // Идентификатор проверенного файла
+}
+
+// OrderUploadError - ошибка строки файла заказа
+type OrderUploadError struct {
+	Row   int    `json:"row" xml:"row"` // Номер строки файла, начиная с 1
+	GTIN  string `json:"gtin,omitempty" xml:"gtin,omitempty"`
+	Error string `json:"error" xml:"error"`
+}
+
+// OrderPreview - результат проверки файла заказа: позиции с ценами по тарифу и итоги.
+// PreviewID не заполняется, если в файле есть ошибки: такой заказ создать нельзя.
+type OrderPreview struct {
+	PreviewID    string             `json:"preview_id,omitempty" xml:"preview_id,omitempty"`
+	ProductGroup string             `json:"product_group,omitempty" xml:"product_group,omitempty"`
+	Items        []models.OrderItem `json:"items" xml:"items>item"`
+	Errors       []OrderUploadError `json:"errors,omitempty" xml:"errors>error,omitempty"`
+	TotalCodes   int                `json:"total_codes" xml:"total_codes"`
+	TotalAmount  float64            `json:"total_amount" xml:"total_amount"`
+}
+
+// PreviewOrderUpload проверяет файл CSV или XLSX со списком GTIN и количеством кодов и
+// рассчитывает стоимость заказа по тарифу. Ошибки строк возвращаются в Errors, заказ не создается.
+func (s *Service) PreviewOrderUpload(ctx context.Context, actor Actor, request OrderUploadRequest, data []byte) (*OrderPreview, error) {
+	preview, _, err := s.checkOrderUpload(ctx, actor, request, data)
+	return preview, err
+}
+
+// ConfirmOrderUpload создает заказ по файлу, проверенному PreviewOrderUpload. Если файл,
+// параметры заказа или цены изменились после проверки, возвращается конфликт.
+func (s *Service) ConfirmOrderUpload(ctx context.Context, actor Actor, request OrderUploadRequest, data []byte) (*models.Order, error) {
+	if request.PreviewID == "" {
+		return nil, NewError(KindInvalid, "Не указан идентификатор проверки файла", nil)
+	}
+	preview, order, err := s.checkOrderUpload(ctx, actor, request, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(preview.Errors) > 0 {
+		return nil, NewError(KindInvalid, "В файле есть ошибки, исправьте их и проверьте файл повторно", nil)
+	}
+	if preview.PreviewID != request.PreviewID {
+		return nil, NewError(KindConflict, "Файл, параметры заказа или цены изменились после проверки, проверьте файл повторно", nil)
+	}
+
+	if err := s.placeOrder(ctx, actor, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// Разбор и проверка файла заказа. Заказ возвращается, только если в файле нет ошибок.
+func (s *Service) checkOrderUpload(ctx context.Context, actor Actor, request OrderUploadRequest, data []byte) (*OrderPreview, *models.Order, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, nil, err
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(data) == 0 && request.FileID != "" {
+		if data, err = s.downloadTelegramFile(ctx, request.FileID); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil, NewError(KindInvalid, "Файл не передан", nil)
+	}
+	items, rows, rowErrors, err := parseOrderUpload(data)
+	if err != nil {
+		return nil, nil, NewError(KindInvalid, "Некорректный файл заказа", err)
+	}
+
+	// Товары, не найденные в Национальном каталоге, отмечаются ошибками строк
+	var valid []OrderItemRequest
+	for i, item := range items {
+		if _, err := s.lookupProduct(ctx, models.NormalizeGTIN(item.GTIN)); err != nil {
+			rowErrors = append(rowErrors, OrderUploadError{Row: rows[i], GTIN: item.GTIN, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, item)
+	}
+
+	preview := &OrderPreview{Items: []models.OrderItem{}, Errors: rowErrors}
+	if len(valid) == 0 {
+		if len(rowErrors) == 0 {
+			return nil, nil, NewError(KindInvalid, "В файле нет строк с GTIN", nil)
+		}
+		return preview, nil, nil
+	}
+
+	order, err := s.prepareOrder(ctx, userID, OrderCreateRequest{
+		OrganizationID: request.OrganizationID,
+		ProductGroup:   request.ProductGroup,
+		Items:          valid,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	preview.ProductGroup = order.ProductGroup
+	preview.Items = order.Items
+	preview.TotalAmount = order.TotalAmount
+	for _, item := range order.Items {
+		preview.TotalCodes += item.Quantity
+	}
+	if len(rowErrors) > 0 {
+		return preview, nil, nil
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%.2f", orderSubject(order), order.TotalAmount)))
+	preview.PreviewID = hex.EncodeToString(hash[:16])
+	return preview, order, nil
+}
+
+// Скачивание файла, отправленного пользователем боту
+func (s *Service) downloadTelegramFile(ctx context.Context, fileID string) ([]byte, error) {
+	if !s.telegram.Enabled() {
+		return nil, NewError(KindUnavailable, "Бот Telegram не настроен", nil)
+	}
+	_, data, err := s.telegram.DownloadFile(ctx, fileID, orderUploadMaxFileSize)
+	if errors.Is(err, telegram.ErrFileTooLarge) {
+		return nil, NewError(KindInvalid, fmt.Sprintf("Файл больше %d МБ", orderUploadMaxFileSize>>20), nil)
+	} else if err != nil {
+		return nil, NewError(KindUnavailable, "Не удалось получить файл из Telegram", err)
+	}
+	return data, nil
+}
+
+// Разбор файла заказа: колонки gtin и count (количество кодов, по умолчанию 1). Первая
+// строка - заголовок, если в ней нет GTIN; без заголовка GTIN - в первой колонке,
+// количество - во второй. Повторяющиеся GTIN объединяются в одну позицию. Возвращает
+// позиции, номера их первых строк и ошибки строк.
+func parseOrderUpload(data []byte) ([]OrderItemRequest, []int, []OrderUploadError, error) {
+	records, err := readTable(data, orderUploadMaxRows+2)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, nil, errors.New("файл пуст")
+	}
+
+	columns := map[string]int{"gtin": 0, "count": 1}
+	start := 0
+	if first := records[0]; len(first) > 0 && !isDigits(strings.TrimSpace(first[0])) {
+		columns = make(map[string]int)
+		for i, name := range first {
+			if column, ok := orderUploadColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+				if _, dup := columns[column]; !dup {
+					columns[column] = i
+				}
+			}
+		}
+		if _, ok := columns["gtin"]; !ok {
+			return nil, nil, nil, errors.New(`в файле нет колонки "gtin"`)
+		}
+		start = 1
+	}
+	if len(records)-start > orderUploadMaxRows {
+		return nil, nil, nil, fmt.Errorf("файл содержит более %d строк", orderUploadMaxRows)
+	}
+
+	var items []OrderItemRequest
+	var rows []int
+	var rowErrors []OrderUploadError
+	index := make(map[string]int)
+	for i, record := range records[start:] {
+		row := start + i + 1
+		field := func(name string) string {
+			if column, ok := columns[name]; ok && column < len(record) {
+				return strings.TrimSpace(record[column])
+			}
+			return ""
+		}
+		gtin, count := field("gtin"), field("count")
+		if gtin == "" && count == "" {
+			continue
+		}
+
+		if err := models.ValidateGTIN(gtin); err != nil {
+			rowErrors = append(rowErrors, OrderUploadError{Row: row, GTIN: gtin, Error: err.Error()})
+			continue
+		}
+		quantity := 1
+		if count != "" {
+			if quantity, err = strconv.Atoi(count); err != nil || quantity <= 0 {
+				rowErrors = append(rowErrors, OrderUploadError{Row: row, GTIN: gtin, Error: "количество должно быть положительным числом"})
+				continue
+			}
+		}
+
+		normalized := models.NormalizeGTIN(gtin)
+		if j, ok := index[normalized]; ok {
+			items[j].Quantity += quantity
+			continue
+		}
+		index[normalized] = len(items)
+		items = append(items, OrderItemRequest{GTIN: gtin, Quantity: quantity})
+		rows = append(rows, row)
+	}
+	return items, rows, rowErrors, nil
+}
+
+// Состоит ли строка только из цифр
+func isDigits(value string) bool {
+	return value != "" && strings.IndexFunc(value, func(c rune) bool { return c < '0' || c > '9' }) < 0
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// OrganizationCreateRequest - запрос на создание организации
+type OrganizationCreateRequest struct {
+	TelegramID int64  `json:"telegram_id"`
+	INN        string `json:"inn" validate:"required,inn"`
+}
+
+// OrganizationMemberRequest - запрос на добавление участника организации
+type OrganizationMemberRequest struct {
+	TelegramID       int64  `json:"telegram_id"`
+	MemberTelegramID int64  `json:"member_telegram_id" validate:"required,min=1"`
+	Role             string `json:"role" validate:"required,org_role"`
+}
+
+// OrganizationDetails - организация со списком участников
+type OrganizationDetails struct {
+	models.Organization
+	Members []models.OrganizationMember `json:"members" xml:"members>member"`
+}
+
+// Выбор организации для операции: явно указанная (с проверкой участия)
+// или организация, которой пользователь владеет по собственному ИНН.
+// Возвращает 0, если пользователь не состоит ни в одной организации.
+func (s *Service) resolveOrganizationID(ctx context.Context, userID, requestedID int) (int, error) {
+	if requestedID > 0 {
+		if _, err := s.repo.OrganizationRole(ctx, requestedID, userID); err != nil {
+			return 0, err
+		}
+		return requestedID, nil
+	}
+	return s.repo.DefaultOrganizationID(ctx, userID)
+}
+
+// Выбор организации с преобразованием ошибок в ошибки сервиса
+func (s *Service) organizationForOperation(ctx context.Context, userID, requestedID int) (int, error) {
+	organizationID, err := s.resolveOrganizationID(ctx, userID, requestedID)
+	if errors.Is(err, repository.ErrNotOrganizationMember) {
+		return 0, NewError(KindForbidden, "Пользователь не состоит в указанной организации", nil)
+	} else if err != nil {
+		return 0, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка выбора организации: %w", err))
+	}
+	return organizationID, nil
+}
+
+// RequestOrganizationID определяет организацию, в рамках которой пользователь выполняет запрос.
+// Возвращает 0, если организация не определена или пользователь в ней не состоит.
+func (s *Service) RequestOrganizationID(ctx context.Context, userID, requestedID int) (int, error) {
+	organizationID, err := s.resolveOrganizationID(ctx, userID, requestedID)
+	if errors.Is(err, repository.ErrNotOrganizationMember) {
+		return 0, nil
+	}
+	return organizationID, err
+}
+
+// OrderOrganizationID возвращает организацию заказа; 0, если заказ личный или не найден
+func (s *Service) OrderOrganizationID(ctx context.Context, orderID int) (int, error) {
+	return s.repo.OrderOrganizationID(ctx, orderID)
+}
+
+// AuthorizeOrganization проверяет разрешение пользователя в организации. Пользователи,
+// не состоящие в организации, не ограничиваются: доступ к данным проверяет сама операция.
+// Администратору разрешено все.
+func (s *Service) AuthorizeOrganization(ctx context.Context, userID, organizationID int, permission string) (bool, error) {
+	if _, err := s.repo.OrganizationRole(ctx, organizationID, userID); errors.Is(err, repository.ErrNotOrganizationMember) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	allowed, err := s.repo.HasPermission(ctx, userID, organizationID, permission)
+	if err == nil && !allowed {
+		allowed, err = s.repo.IsAdmin(ctx, userID)
+	}
+	return allowed, err
+}
+
+// Authorize проверяет разрешение пользователя в явно указанной организации
+// или в его организации по умолчанию
+func (s *Service) Authorize(ctx context.Context, userID, requestedOrganizationID int, permission string) error {
+	organizationID, err := s.RequestOrganizationID(ctx, userID, requestedOrganizationID)
+	if err != nil {
+		return NewError(KindInternal, "Ошибка проверки прав доступа", fmt.Errorf("ошибка определения организации: %w", err))
+	}
+	if organizationID == 0 {
+		return nil
+	}
+
+	allowed, err := s.AuthorizeOrganization(ctx, userID, organizationID, permission)
+	if err != nil {
+		return NewError(KindInternal, "Ошибка проверки прав доступа", fmt.Errorf("ошибка проверки разрешения %s: %w", permission, err))
+	}
+	if !allowed {
+		return NewError(KindForbidden, "Недостаточно прав для выполнения операции", nil)
+	}
+	return nil
+}
+
+// ListOrganizations возвращает организации пользователя
+func (s *Service) ListOrganizations(ctx context.Context, userID int) ([]models.Organization, error) {
+	organizations, err := s.repo.ListOrganizations(ctx, userID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса организаций: %w", err))
+	}
+	return organizations, nil
+}
+
+// CreateOrganization создает организацию. Создатель становится ее владельцем.
+func (s *Service) CreateOrganization(ctx context.Context, actor Actor, request OrganizationCreateRequest) (*models.Organization, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	org := models.Organization{INN: request.INN, Role: models.OrgRoleOwner}
+	if err := org.Validate(); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	if org.Name, err = s.lookupOrganizationName(ctx, org.INN); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	org.ID, err = s.repo.CreateOrganization(ctx, userID, org.INN, org.Name)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка создания организации", err)
+	}
+
+	// Участников уже зарегистрированной организации добавляет ее владелец
+	if org.ID == 0 {
+		return nil, NewError(KindConflict, "Организация с таким ИНН уже зарегистрирована, обратитесь к ее владельцу", nil)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "organization", org.ID, nil, org)
+
+	return &org, nil
+}
+
+// GetOrganization возвращает организацию пользователя со списком участников
+func (s *Service) GetOrganization(ctx context.Context, userID, organizationID int) (*OrganizationDetails, error) {
+	var details OrganizationDetails
+	role, err := s.repo.OrganizationRole(ctx, organizationID, userID)
+	if errors.Is(err, repository.ErrNotOrganizationMember) {
+		return nil, NewError(KindNotFound, "Организация не найдена", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка проверки участия в организации: %w", err))
+	}
+
+	org, err := s.repo.Organization(ctx, organizationID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения организации: %w", err))
+	}
+	details.Organization = *org
+	details.Role = role
+
+	if details.Members, err = s.repo.OrganizationMembers(ctx, organizationID); err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса участников: %w", err))
+	}
+
+	return &details, nil
+}
+
+// UpdateRequisites сохраняет реквизиты организации, указываемые в счетах на оплату.
+// Разрешение проверяется транспортом, здесь отсекаются пользователи, не состоящие в организации.
+func (s *Service) UpdateRequisites(ctx context.Context, actor Actor, organizationID int, requisites models.Requisites) (*models.Organization, error) {
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.OrganizationRole(ctx, organizationID, userID); errors.Is(err, repository.ErrNotOrganizationMember) {
+		return nil, NewError(KindNotFound, "Организация не найдена", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка проверки участия в организации: %w", err))
+	}
+
+	if err := requisites.Validate(); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	org, err := s.repo.Organization(ctx, organizationID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Организация не найдена", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения организации: %w", err))
+	}
+
+	before := org.Requisites
+	if err := s.repo.SaveOrganizationRequisites(ctx, organizationID, requisites); err != nil {
+		return nil, NewError(KindInternal, "Ошибка сохранения реквизитов", err)
+	}
+	org.Requisites = requisites
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "organization", organizationID, before, requisites)
+
+	return org, nil
+}
+
+// AddOrganizationMember добавляет участника организации или меняет его роль.
+// Разрешение на управление участниками проверяется транспортом, здесь отсекаются
+// пользователи, не состоящие в организации.
+func (s *Service) AddOrganizationMember(ctx context.Context, actor Actor, organizationID int, request OrganizationMemberRequest) (*models.OrganizationMember, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	userID := actor.UserID
+	if userID == 0 {
+		var err error
+		if userID, err = s.UserIDByTelegram(ctx, request.TelegramID); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := s.repo.OrganizationRole(ctx, organizationID, userID); errors.Is(err, repository.ErrNotOrganizationMember) {
+		return nil, NewError(KindNotFound, "Организация не найдена", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка проверки участия в организации: %w", err))
+	}
+
+	memberID, err := s.UserIDByTelegram(ctx, request.MemberTelegramID)
+	if err != nil {
+		return nil, err
+	}
+	if memberID == 0 {
+		return nil, NewError(KindNotFound, "Добавляемый пользователь не зарегистрирован", nil)
+	}
+
+	return s.saveMember(ctx, actor, organizationID, memberID, request.MemberTelegramID, request.Role, "Ошибка добавления участника")
+}
+
+// AssignRole назначает роль участнику организации по решению администратора
+func (s *Service) AssignRole(ctx context.Context, actor Actor, organizationID int, memberTelegramID int64, role string) (*models.OrganizationMember, error) {
+	if !models.IsValidOrgRole(role) {
+		return nil, NewError(KindInvalid, "Недопустимая роль участника", nil)
+	}
+
+	memberID, err := s.UserIDByTelegram(ctx, memberTelegramID)
+	if err != nil {
+		return nil, err
+	}
+	if memberID == 0 {
+		return nil, NewError(KindNotFound, "Пользователь не найден", nil)
+	}
+
+	return s.saveMember(ctx, actor, organizationID, memberID, memberTelegramID, role, "Ошибка назначения роли")
+}
+
+// Сохранение участника организации с записью в журнал аудита
+func (s *Service) saveMember(ctx context.Context, actor Actor, organizationID, memberID int, memberTelegramID int64,
+	role, failureMessage string) (*models.OrganizationMember, error) {
+	previousRole, err := s.repo.OrganizationRole(ctx, organizationID, memberID)
+	if err != nil && !errors.Is(err, repository.ErrNotOrganizationMember) {
+		return nil, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка проверки участия в организации: %w", err))
+	}
+
+	member := models.OrganizationMember{
+		OrganizationID: organizationID,
+		UserID:         memberID,
+		TelegramID:     memberTelegramID,
+		Role:           role,
+	}
+	if err := s.repo.SaveOrganizationMember(ctx, &member); errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Организация не найдена", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, failureMessage, err)
+	}
+
+	entityID := fmt.Sprintf("%d:%d", member.OrganizationID, member.UserID)
+	if previousRole == "" {
+		s.recordAudit(ctx, actor, AuditActionCreate, "organization_member", entityID, nil, member)
+	} else {
+		s.recordAudit(ctx, actor, AuditActionUpdate, "organization_member", entityID,
+			map[string]string{"role": previousRole}, map[string]string{"role": member.Role})
+	}
+
+	return &member, nil
+}
+
+// ListRoles возвращает роли и их разрешения
+func (s *Service) ListRoles(ctx context.Context) ([]*repository.Role, error) {
+	roles, err := s.repo.ListRoles(ctx)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса ролей: %w", err))
+	}
+	return roles, nil
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"project-znak/internal/i18n"
+	"project-znak/internal/mailer"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/telegram"
+	"project-znak/internal/webhook"
+)
+
+// Число сообщений outbox, доставляемых за один проход
+const outboxBatch = 100
+
+// Срок, на который захватываются сообщения outbox: если доставка прервется, например при
+// остановке экземпляра сервиса, сообщения будут доставлены повторно по его истечении
+const outboxClaimLease = 5 * time.Minute
+
+// Задержка перед повторной доставкой сообщения; удваивается с каждой попыткой
+const (
+	outboxRetryDelay    = 30 * time.Second
+	outboxRetryMaxDelay = time.Hour
+)
+
+// Сообщение Telegram в outbox
+type outboxTelegram struct {
+	Text    string            `json:"text"`
+	Buttons []telegram.Button `json:"buttons,omitempty"`
+}
+
+// Письмо в outbox. Данные шаблона хранятся в JSON и при доставке разбираются в тип,
+// зарегистрированный для шаблона в outboxEmailData.
+type outboxEmail struct {
+	Preference string          `json:"preference,omitempty"` // Вид уведомления в настройках; пусто - отправляется всегда
+	Subject    string          `json:"subject"`
+	Template   string          `json:"template"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Событие вебхука в outbox; данные передаются получателю без изменений
+type outboxWebhook struct {
+	Type       string          `json:"event"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Виды уведомлений в настройках пользователя, которые могут отключать письма из outbox
+var outboxPreferences = map[string]func(models.NotificationPreferences) bool{
+	"":                 func(models.NotificationPreferences) bool { return true },
+	"payment_receipts": func(p models.NotificationPreferences) bool { return p.PaymentReceipts },
+	"failures":         func(p models.NotificationPreferences) bool { return p.Failures },
+}
+
+// Типы данных шаблонов писем, отправляемых через outbox
+var outboxEmailData = map[string]func() any{
+	mailer.TemplatePaymentReceipt: func() any { return &paymentReceiptEmail{} },
+	mailer.TemplateFailure:        func() any { return &failureEmail{} },
+	mailer.TemplateReport:         func() any { return &reportEmail{} },
+}
+
+// Построитель сообщений outbox; каналы, которые не настроены, пропускаются
+type outboxBuilder struct {
+	s        *Service
+	messages []models.OutboxMessage
+	err      error
+}
+
+func (s *Service) outbox() *outboxBuilder {
+	return &outboxBuilder{s: s}
+}
+
+func (b *outboxBuilder) add(channel string, userID int, payload any) {
+	if b.err != nil {
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		b.err = fmt.Errorf("ошибка формирования уведомления %s: %w", channel, err)
+		return
+	}
+	b.messages = append(b.messages, models.OutboxMessage{Channel: channel, UserID: userID, Payload: data})
+}
+
+func (b *outboxBuilder) webhook(eventType string, data any) *outboxBuilder {
+	if b.s.webhook.Enabled() {
+		b.add(models.OutboxChannelWebhook, 0, webhook.Event{Type: eventType, OccurredAt: time.Now(), Data: data})
+	}
+	return b
+}
+
+func (b *outboxBuilder) telegram(userID int, text string, buttons ...telegram.Button) *outboxBuilder {
+	if b.s.telegram.Enabled() && userID > 0 {
+		b.add(models.OutboxChannelTelegram, userID, outboxTelegram{Text: text, Buttons: buttons})
+	}
+	return b
+}
+
+func (b *outboxBuilder) email(userID int, preference, subject, templateName string, data any) *outboxBuilder {
+	if !b.s.mailer.Enabled() || userID == 0 || b.err != nil {
+		return b
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		b.err = fmt.Errorf("ошибка формирования письма: %w", err)
+		return b
+	}
+	b.add(models.OutboxChannelEmail, userID, outboxEmail{
+		Preference: preference,
+		Subject:    subject,
+		Template:   templateName,
+		Data:       raw,
+	})
+	return b
+}
+
+func (b *outboxBuilder) build() ([]models.OutboxMessage, error) {
+	return b.messages, b.err
+}
+
+// Уведомления о проведенном платеже: квитанция на email
+func (s *Service) paymentReceiptMessages(userID int, receipt paymentReceiptEmail) ([]models.OutboxMessage, error) {
+	return s.outbox().
+		email(userID, "payment_receipts", fmt.Sprintf("Квитанция об оплате №%d", receipt.PaymentID),
+			mailer.TemplatePaymentReceipt, receipt).
+		build()
+}
+
+// Уведомления об отмене платежа, не оплаченного в срок: событие вебхука payment.expired
+// и сообщение в Telegram с предложением повторить оплату
+func (s *Service) paymentExpiredMessages(paymentID int, payment *repository.CompletedPayment) ([]models.OutboxMessage, error) {
+	text := fmt.Sprintf("Платеж №%d на сумму %s %s не был оплачен вовремя и отменен.", paymentID, payment.Amount, payment.Amount.Code())
+	if payment.OrderID > 0 {
+		text += fmt.Sprintf(" Чтобы оплатить заказ №%d, создайте новый платеж.", payment.OrderID)
+	} else {
+		text += " Чтобы повторить оплату, создайте новый платеж."
+	}
+
+	return s.outbox().
+		webhook("payment.expired", paymentEvent{
+			PaymentID: paymentID,
+			OrderID:   payment.OrderID,
+			Amount:    payment.Amount,
+			Currency:  payment.Amount.Code(),
+			Status:    models.PaymentStatusCancelled,
+		}).
+		telegram(payment.UserID, text).
+		build()
+}
+
+// Уведомления о результате обработки документа: событие вебхука, сообщение в Telegram
+// и письмо об отклонении
+func (s *Service) documentResultMessages(event documentEvent, userID int) ([]models.OutboxMessage, error) {
+	operation := documentOperations[event.DocumentType]
+	b := s.outbox().webhook("document."+event.Status, event)
+
+	if event.Status != models.DocumentStatusRejected {
+		return b.telegram(userID, fmt.Sprintf("%s: документ №%d принят Честным ЗНАКом", operation, event.DocumentID)).build()
+	}
+
+	reason := fmt.Sprintf("документ №%d отклонен Честным ЗНАКом: %s", event.DocumentID, event.Error)
+	return b.
+		telegram(userID, fmt.Sprintf("%s: %s", operation, reason)).
+		email(userID, "failures", "Ошибка: "+operation, mailer.TemplateFailure,
+			failureEmail{Operation: operation, Reason: reason, Time: time.Now()}).
+		build()
+}
+
+// RunOutboxDispatcher периодически доставляет уведомления из outbox до отмены контекста
+func (s *Service) RunOutboxDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			s.dispatchOutbox(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Доставка сообщений, для которых наступило время очередной попытки
+func (s *Service) dispatchOutbox(ctx context.Context) {
+	messages, err := s.repo.ClaimOutboxMessages(ctx, outboxBatch, outboxClaimLease)
+	if err != nil {
+		s.logger.Printf("Ошибка получения уведомлений из outbox: %v", err)
+		return
+	}
+
+	for i := range messages {
+		message := &messages[i]
+		if err := s.deliverOutboxMessage(ctx, message); err != nil {
+			dead, failErr := s.repo.FailOutboxAttempt(ctx, message.ID, err.Error(),
+				outboxRetryDelay, outboxRetryMaxDelay, s.outboxMaxAttempts)
+			if failErr != nil {
+				s.logger.Printf("Ошибка сохранения попытки доставки уведомления %d: %v (%v)", message.ID, failErr, err)
+			} else if dead {
+				s.logger.Printf("Попытки доставки уведомления %d исчерпаны: %v", message.ID, err)
+			}
+			continue
+		}
+		if err := s.repo.MarkOutboxSent(ctx, message.ID, time.Now()); err != nil {
+			s.logger.Printf("Ошибка сохранения статуса уведомления %d: %v", message.ID, err)
+		}
+	}
+}
+
+// Доставка сообщения в его канал. Сообщение удаленному пользователю считается доставленным.
+func (s *Service) deliverOutboxMessage(ctx context.Context, message *models.OutboxMessage) error {
+	switch message.Channel {
+	case models.OutboxChannelWebhook:
+		if !s.webhook.Enabled() {
+			return errors.New("вебхук не настроен")
+		}
+		var event outboxWebhook
+		if err := json.Unmarshal(message.Payload, &event); err != nil {
+			return fmt.Errorf("ошибка разбора события: %w", err)
+		}
+		return s.webhook.Send(ctx, webhook.Event{Type: event.Type, OccurredAt: event.OccurredAt, Data: event.Data})
+
+	case models.OutboxChannelTelegram:
+		if !s.telegram.Enabled() {
+			return errors.New("Telegram не настроен")
+		}
+		var payload outboxTelegram
+		if err := json.Unmarshal(message.Payload, &payload); err != nil {
+			return fmt.Errorf("ошибка разбора сообщения: %w", err)
+		}
+		telegramID, err := s.repo.UserTelegramID(ctx, message.UserID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("ошибка получения telegram_id: %w", err)
+		}
+		// Текст сообщения переводится на язык получателя при доставке
+		lang := s.UserLanguage(ctx, message.UserID)
+		for i := range payload.Buttons {
+			payload.Buttons[i].Text = i18n.Translate(lang, payload.Buttons[i].Text)
+		}
+		return s.telegram.SendMessage(ctx, telegramID, i18n.Translate(lang, payload.Text), payload.Buttons...)
+
+	case models.OutboxChannelEmail:
+		if !s.mailer.Enabled() {
+			return errors.New("почта не настроена")
+		}
+		var payload outboxEmail
+		if err := json.Unmarshal(message.Payload, &payload); err != nil {
+			return fmt.Errorf("ошибка разбора письма: %w", err)
+		}
+		enabled, ok := outboxPreferences[payload.Preference]
+		if !ok {
+			return fmt.Errorf("неизвестный вид уведомления %q", payload.Preference)
+		}
+		newData, ok := outboxEmailData[payload.Template]
+		if !ok {
+			return fmt.Errorf("неизвестный шаблон письма %q", payload.Template)
+		}
+		data := newData()
+		if err := json.Unmarshal(payload.Data, data); err != nil {
+			return fmt.Errorf("ошибка разбора данных письма: %w", err)
+		}
+		return s.sendEmail(ctx, message.UserID, enabled, payload.Subject, payload.Template, data)
+	}
+	return fmt.Errorf("неизвестный канал %q", message.Channel)
+}
+
+// ListOutboxMessages возвращает уведомления с указанным статусом; все, если статус не задан
+func (s *Service) ListOutboxMessages(ctx context.Context, status string, limit int) ([]models.OutboxMessage, error) {
+	switch status {
+	case "", models.OutboxStatusPending, models.OutboxStatusSent, models.OutboxStatusDead:
+	default:
+		return nil, NewError(KindInvalid, "Недопустимый статус уведомления", nil)
+	}
+
+	messages, err := s.repo.ListOutboxMessages(ctx, status, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса outbox: %w", err))
+	}
+	return messages, nil
+}
+
+// RetryOutboxMessage возвращает в очередь уведомление, попытки доставки которого исчерпаны
+func (s *Service) RetryOutboxMessage(ctx context.Context, actor Actor, messageID int) error {
+	err := s.repo.RetryOutboxMessage(ctx, messageID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Недоставленное уведомление не найдено", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка повторной доставки", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "outbox", messageID,
+		map[string]string{"status": models.OutboxStatusDead},
+		map[string]string{"status": models.OutboxStatusPending})
+	return nil
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"project-znak/internal/models"
+	"project-znak/internal/ozon"
+	"project-znak/internal/repository"
+)
+
+// OzonCredentialsRequest - подключение ключа Ozon Seller API
+type OzonCredentialsRequest struct {
+	ClientID string `json:"client_id" validate:"required,max=64"`
+	APIKey   string `json:"api_key" validate:"required,max=256"`
+}
+
+// OzonMappingRequest - соответствие товара Ozon (SKU) GTIN кодов маркировки.
+// Без организации соответствие личное.
+type OzonMappingRequest struct {
+	TelegramID     int64  `json:"telegram_id"`
+	OrganizationID int    `json:"organization_id,omitempty"`
+	SKU            int64  `json:"sku" validate:"required,min=1"`
+	GTIN           string `json:"gtin" validate:"required,gtin"`
+}
+
+// OzonSubmitRequest - передача кодов из остатка в отправление FBS Ozon.
+// Коды берутся из остатка организации или, если она не указана, из личного остатка.
+type OzonSubmitRequest struct {
+	TelegramID     int64  `json:"telegram_id"`
+	OrganizationID int    `json:"organization_id,omitempty"`
+	PostingNumber  string `json:"posting_number" validate:"required,max=64"`
+}
+
+// OzonSettings возвращает состояние подключения пользователя к Ozon
+func (s *Service) OzonSettings(ctx context.Context, userID int) (models.OzonSettings, error) {
+	creds, err := s.repo.OzonCredentials(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.OzonSettings{}, nil
+	} else if err != nil {
+		return models.OzonSettings{}, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения ключа Ozon: %w", err))
+	}
+	return ozonSettings(creds), nil
+}
+
+// SaveOzonCredentials сохраняет ключ Ozon Seller API пользователя
+func (s *Service) SaveOzonCredentials(ctx context.Context, actor Actor, request OzonCredentialsRequest) (models.OzonSettings, error) {
+	if err := ValidateRequest(request); err != nil {
+		return models.OzonSettings{}, err
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return models.OzonSettings{}, err
+	}
+
+	creds := repository.OzonCredentials{
+		ClientID: strings.TrimSpace(request.ClientID),
+		APIKey:   strings.TrimSpace(request.APIKey),
+	}
+	if err := s.repo.SaveOzonCredentials(ctx, userID, &creds); err != nil {
+		return models.OzonSettings{}, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка сохранения ключа Ozon: %w", err))
+	}
+
+	settings := ozonSettings(&creds)
+	s.recordAudit(ctx, actor, AuditActionUpdate, "ozon_credentials", userID, nil, map[string]string{
+		"client_id": settings.ClientID,
+		"api_key":   settings.APIKey,
+	})
+	return settings, nil
+}
+
+// DeleteOzonCredentials отключает пользователя от Ozon
+func (s *Service) DeleteOzonCredentials(ctx context.Context, actor Actor, userID int) error {
+	if err := s.repo.DeleteOzonCredentials(ctx, userID); errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Ключ Ozon не подключен", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка удаления ключа Ozon: %w", err))
+	}
+	s.recordAudit(ctx, actor, AuditActionDelete, "ozon_credentials", userID, nil, nil)
+	return nil
+}
+
+// OzonMappings возвращает соответствия SKU Ozon и GTIN организации или личные соответствия
+func (s *Service) OzonMappings(ctx context.Context, userID, organizationID int) ([]models.OzonSKUMapping, error) {
+	if err := s.checkInventoryAccess(ctx, userID, organizationID); err != nil {
+		return nil, err
+	}
+	mappings, err := s.repo.OzonMappings(ctx, userID, organizationID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения соответствий Ozon: %w", err))
+	}
+	return mappings, nil
+}
+
+// SaveOzonMapping сохраняет соответствие SKU Ozon и GTIN, заменяя прежнее для этого SKU
+func (s *Service) SaveOzonMapping(ctx context.Context, actor Actor, request OzonMappingRequest) (*models.OzonSKUMapping, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkInventoryAccess(ctx, userID, request.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	mapping := models.OzonSKUMapping{
+		UserID:         userID,
+		OrganizationID: request.OrganizationID,
+		SKU:            request.SKU,
+		GTIN:           request.GTIN,
+	}
+	if err := s.repo.SaveOzonMapping(ctx, &mapping); err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", err)
+	}
+	s.recordAudit(ctx, actor, AuditActionUpdate, "ozon_sku_mapping", mapping.ID, nil, mapping)
+	return &mapping, nil
+}
+
+// DeleteOzonMapping удаляет соответствие SKU Ozon
+func (s *Service) DeleteOzonMapping(ctx context.Context, actor Actor, userID, organizationID int, sku int64) error {
+	if err := s.checkInventoryAccess(ctx, userID, organizationID); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteOzonMapping(ctx, userID, organizationID, sku); errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Соответствие SKU не найдено", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка удаления соответствия Ozon: %w", err))
+	}
+	s.recordAudit(ctx, actor, AuditActionDelete, "ozon_sku_mapping", sku, map[string]any{
+		"organization_id": organizationID,
+		"sku":             sku,
+	}, nil)
+	return nil
+}
+
+// SubmitOzonPosting передает коды маркировки из остатка в отправление FBS Ozon.
+// Отправление заполняется целиком: для каждого экземпляра товара берется код GTIN,
+// указанного в соответствии SKU. Переданные коды отмечаются использованными, результат
+// проверки Ozon отслеживается по передаче.
+func (s *Service) SubmitOzonPosting(ctx context.Context, actor Actor, request OzonSubmitRequest) (*models.OzonSubmission, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	if !s.ozon.Enabled() {
+		return nil, NewError(KindUnavailable, "Интеграция с Ozon не настроена", nil)
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkInventoryAccess(ctx, userID, request.OrganizationID); err != nil {
+		return nil, err
+	}
+	creds, err := s.ozonCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	posting, err := s.ozon.Posting(ctx, creds, request.PostingNumber)
+	if err != nil {
+		return nil, ozonError("Ошибка получения отправления Ozon", err)
+	}
+	if len(posting.Products) == 0 {
+		return nil, NewError(KindNotFound, "В отправлении нет товаров", nil)
+	}
+
+	mappings, err := s.repo.OzonMappings(ctx, userID, request.OrganizationID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения соответствий Ozon: %w", err))
+	}
+	gtins := make(map[int64]string, len(mappings))
+	for _, mapping := range mappings {
+		gtins[mapping.SKU] = mapping.GTIN
+	}
+	wanted := make(map[string]int)
+	var unmapped []string
+	for _, product := range posting.Products {
+		gtin, ok := gtins[product.SKU]
+		if !ok {
+			unmapped = append(unmapped, fmt.Sprint(product.SKU))
+			continue
+		}
+		wanted[gtin] += product.Quantity
+	}
+	if len(unmapped) > 0 {
+		return nil, NewError(KindInvalid, "Не указан GTIN для SKU Ozon: "+strings.Join(unmapped, ", "), nil)
+	}
+
+	codes, reservationID, err := s.reserveCodes(ctx, userID, request.OrganizationID, "Ozon "+request.PostingNumber, wanted)
+	if err != nil {
+		return nil, err
+	}
+
+	submission := models.OzonSubmission{
+		UserID:         userID,
+		OrganizationID: request.OrganizationID,
+		PostingNumber:  request.PostingNumber,
+		Status:         models.OzonSubmissionStatusPending,
+	}
+	marks := make([]ozon.ProductMarks, len(posting.Products))
+	for i, product := range posting.Products {
+		gtin := gtins[product.SKU]
+		marks[i] = ozon.ProductMarks{SKU: product.SKU, Marks: codes[gtin][:product.Quantity]}
+		codes[gtin] = codes[gtin][product.Quantity:]
+		for _, code := range marks[i].Marks {
+			submission.Codes = append(submission.Codes, models.OzonSubmissionCode{SKU: product.SKU, GTIN: gtin, Code: code})
+		}
+	}
+
+	// Коды, не принятые Ozon, возвращаются в остаток
+	var used []string
+	if err := s.ozon.SetExemplars(ctx, creds, request.PostingNumber, marks); err != nil {
+		submission.Status, submission.Error = models.OzonSubmissionStatusFailed, err.Error()
+	} else {
+		for _, code := range submission.Codes {
+			used = append(used, code.Code)
+		}
+	}
+	if err := s.settleReservation(ctx, userID, request.OrganizationID, reservationID, used); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateOzonSubmission(ctx, &submission); err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка сохранения передачи кодов Ozon: %w", err))
+	}
+	s.recordAudit(ctx, actor, AuditActionCreate, "ozon_submission", submission.ID, nil, map[string]any{
+		"organization_id": request.OrganizationID,
+		"posting_number":  request.PostingNumber,
+		"status":          submission.Status,
+		"codes":           len(submission.Codes),
+	})
+	return &submission, nil
+}
+
+// GetOzonSubmission возвращает передачу кодов; результат проверки ожидающей передачи
+// запрашивается в Ozon
+func (s *Service) GetOzonSubmission(ctx context.Context, userID, submissionID int) (*models.OzonSubmission, error) {
+	submission, err := s.repo.OzonSubmission(ctx, submissionID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Передача кодов не найдена", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения передачи кодов Ozon: %w", err))
+	}
+	if submission.Status != models.OzonSubmissionStatusPending || !s.ozon.Enabled() {
+		return submission, nil
+	}
+
+	// Статус запрашивается с ключом пользователя, передавшего коды
+	creds, err := s.ozonCredentials(ctx, submission.UserID)
+	if err != nil {
+		s.logger.Printf("Статус передачи кодов Ozon %d не обновлен: %v", submission.ID, err)
+		return submission, nil
+	}
+	status, err := s.ozon.ExemplarStatus(ctx, creds, submission.PostingNumber)
+	if err != nil {
+		return nil, ozonError("Ошибка получения статуса проверки кодов в Ozon", err)
+	}
+	if !applyOzonStatus(submission, status) {
+		return submission, nil
+	}
+	if err := s.repo.UpdateOzonSubmission(ctx, submission); err != nil {
+		s.logger.Printf("Ошибка сохранения статуса передачи кодов Ozon %d: %v", submission.ID, err)
+	}
+	return submission, nil
+}
+
+// OzonSubmissionOrganizationID возвращает организацию передачи кодов; 0, если передача
+// личная или не найдена
+func (s *Service) OzonSubmissionOrganizationID(ctx context.Context, submissionID int) (int, error) {
+	return s.repo.OzonSubmissionOrganizationID(ctx, submissionID)
+}
+
+// ListOzonSubmissions возвращает последние передачи кодов организации или личные передачи
+func (s *Service) ListOzonSubmissions(ctx context.Context, userID, organizationID, limit int) ([]models.OzonSubmission, error) {
+	if err := s.checkInventoryAccess(ctx, userID, organizationID); err != nil {
+		return nil, err
+	}
+	submissions, err := s.repo.OzonSubmissions(ctx, userID, organizationID, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения передач кодов Ozon: %w", err))
+	}
+	return submissions, nil
+}
+
+// Ключ Ozon Seller API пользователя
+func (s *Service) ozonCredentials(ctx context.Context, userID int) (ozon.Credentials, error) {
+	creds, err := s.repo.OzonCredentials(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ozon.Credentials{}, NewError(KindInvalid, "Подключите ключ Ozon Seller API", nil)
+	} else if err != nil {
+		return ozon.Credentials{}, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка получения ключа Ozon: %w", err))
+	}
+	return ozon.Credentials{ClientID: creds.ClientID, APIKey: creds.APIKey}, nil
+}
+
+// Перенос результата проверки Ozon в передачу; возвращает false, если проверка
+// еще не завершена
+func applyOzonStatus(submission *models.OzonSubmission, status *ozon.ExemplarStatus) bool {
+	switch status.Status {
+	case ozon.StatusShipAvailable:
+		submission.Status = models.OzonSubmissionStatusAccepted
+	case ozon.StatusShipNotAvailable:
+		submission.Status = models.OzonSubmissionStatusRejected
+	default:
+		return false
+	}
+
+	checks := make(map[string]ozon.ExemplarCheck, len(status.Exemplars))
+	for _, check := range status.Exemplars {
+		checks[check.Mark] = check
+	}
+	for i := range submission.Codes {
+		if check, ok := checks[submission.Codes[i].Code]; ok {
+			submission.Codes[i].CheckStatus, submission.Codes[i].Errors = check.CheckStatus, check.Errors
+		}
+	}
+	return true
+}
+
+// Ошибка обращения к Ozon: отклоненный ключ и неизвестное отправление - ошибки
+// запроса пользователя, остальные ошибки - недоступность внешнего сервиса
+func ozonError(message string, err error) error {
+	if errors.Is(err, ozon.ErrUnauthorized) {
+		return NewError(KindInvalid, "Ozon отклонил ключ Seller API: проверьте Client-Id и API-ключ", err)
+	}
+	if errors.Is(err, ozon.ErrNotFound) {
+		return NewError(KindNotFound, "Отправление не найдено в Ozon", err)
+	}
+	return NewError(KindUnavailable, message, err)
+}
+
+// Настройки подключения с замаскированным API-ключом
+func ozonSettings(creds *repository.OzonCredentials) models.OzonSettings {
+	updatedAt := creds.UpdatedAt
+	return models.OzonSettings{
+		Configured: true,
+		ClientID:   creds.ClientID,
+		APIKey:     maskToken(creds.APIKey),
+		UpdatedAt:  &updatedAt,
+	}
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+	"project-znak/internal/repository"
+)
+
+// Наибольший период сводки оплат клиентов партнера
+const partnerBillingMaxDays = 366
+
+// Число отчетов о вознаграждении, формируемых за одну проверку
+const partnerReportBatch = 100
+
+// PartnerRequest - запрос администратора на подключение партнера или изменение его условий
+type PartnerRequest struct {
+	TelegramID   int64   `json:"telegram_id" validate:"required,min=1"`
+	Name         string  `json:"name" validate:"required"`
+	RevenueShare float64 `json:"revenue_share"` // Доля партнера в оплатах клиентов, процентов
+}
+
+// PartnerBillingRequest - сводка оплат клиентов партнера за период в днях (включительно)
+type PartnerBillingRequest struct {
+	From string `validate:"required,date"`
+	To   string `validate:"required,date"`
+}
+
+// SavePartner подключает пользователя как партнера или меняет наименование и долю партнера
+func (s *Service) SavePartner(ctx context.Context, actor Actor, request PartnerRequest) (*models.Partner, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	userID, err := s.UserIDByTelegram(ctx, request.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+	if userID == 0 {
+		return nil, NewError(KindNotFound, "Пользователь не найден", nil)
+	}
+
+	partner := models.Partner{UserID: userID, Name: strings.TrimSpace(request.Name), RevenueShare: request.RevenueShare}
+	if err := partner.Validate(); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	before, err := s.repo.PartnerByUser(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		before = nil
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка получения партнера: %w", err))
+	}
+
+	if err := s.repo.SavePartner(ctx, &partner); err != nil {
+		return nil, NewError(KindInternal, "Ошибка сохранения партнера", err)
+	}
+
+	action := AuditActionCreate
+	if before != nil {
+		action = AuditActionUpdate
+	}
+	s.recordAudit(ctx, actor, action, "partner", partner.ID, before, partner)
+
+	saved, err := s.repo.PartnerByUser(ctx, userID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения партнера: %w", err))
+	}
+	return saved, nil
+}
+
+// ListPartners возвращает всех партнеров
+func (s *Service) ListPartners(ctx context.Context) ([]models.Partner, error) {
+	partners, err := s.repo.ListPartners(ctx)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса партнеров: %w", err))
+	}
+	return partners, nil
+}
+
+// Партнер, которым является пользователь; остальным пользователям операции партнера недоступны
+func (s *Service) partnerForUser(ctx context.Context, userID int) (*models.Partner, error) {
+	partner, err := s.repo.PartnerByUser(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindForbidden, "Операция доступна только партнерам", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка получения партнера: %w", err))
+	}
+	return partner, nil
+}
+
+// PartnerAccounts возвращает субаккаунты партнера
+func (s *Service) PartnerAccounts(ctx context.Context, userID int) ([]models.PartnerAccount, error) {
+	partner, err := s.partnerForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := s.repo.PartnerAccounts(ctx, partner.ID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса субаккаунтов: %w", err))
+	}
+	return accounts, nil
+}
+
+// CreatePartnerAccount создает субаккаунт партнера - организацию клиента. Партнер становится
+// ее владельцем: заказы, платежи и участники организации управляются обычными методами API
+// с указанием organization_id.
+func (s *Service) CreatePartnerAccount(ctx context.Context, actor Actor, request OrganizationCreateRequest) (*models.Organization, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	partner, err := s.partnerForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	org := models.Organization{INN: request.INN, Role: models.OrgRoleOwner}
+	if err := org.Validate(); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+	if org.Name, err = s.lookupOrganizationName(ctx, org.INN); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	org.ID, err = s.repo.CreatePartnerOrganization(ctx, partner.ID, userID, org.INN, org.Name)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка создания организации", err)
+	}
+	if org.ID == 0 {
+		return nil, NewError(KindConflict, "Организация с таким ИНН уже зарегистрирована, обратитесь к ее владельцу", nil)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "organization", org.ID, nil, map[string]any{
+		"inn":        org.INN,
+		"name":       org.Name,
+		"partner_id": partner.ID,
+	})
+	return &org, nil
+}
+
+// PartnerBilling возвращает проведенные за период платежи субаккаунтов партнера
+// и вознаграждение партнера по каждой организации и валюте
+func (s *Service) PartnerBilling(ctx context.Context, userID int, request PartnerBillingRequest) (*models.PartnerBilling, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	partner, err := s.partnerForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Формат дат проверен ValidateRequest; границы дней - по часовому поясу партнера
+	loc := s.UserLocation(ctx, userID)
+	from, _ := time.ParseInLocation(documentDateLayout, request.From, loc)
+	to, _ := time.ParseInLocation(documentDateLayout, request.To, loc)
+	if from.After(to) {
+		return nil, NewError(KindInvalid, "Начало периода позже его окончания", nil)
+	}
+	if to.Sub(from) >= partnerBillingMaxDays*24*time.Hour {
+		return nil, NewError(KindInvalid, fmt.Sprintf("Период не может превышать %d дней", partnerBillingMaxDays), nil)
+	}
+
+	billing, err := s.partnerBilling(ctx, partner, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", err)
+	}
+	return billing, nil
+}
+
+// Сводка оплат клиентов партнера за период [from, to). Вознаграждение считается
+// от суммы платежей организации в каждой валюте.
+func (s *Service) partnerBilling(ctx context.Context, partner *models.Partner, from, to time.Time) (*models.PartnerBilling, error) {
+	lines, err := s.repo.PartnerBilling(ctx, partner.ID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса платежей клиентов партнера: %w", err)
+	}
+
+	billing := &models.PartnerBilling{
+		From:         from,
+		To:           to.AddDate(0, 0, -1),
+		RevenueShare: partner.RevenueShare,
+		Lines:        lines,
+		Totals:       []models.PartnerBillingTotal{},
+	}
+	totals := make(map[string]int)
+	for i := range billing.Lines {
+		line := &billing.Lines[i]
+		line.Share = money.FromFloat(line.Paid.Float64()*partner.RevenueShare/100, line.Currency)
+
+		index, ok := totals[line.Currency]
+		if !ok {
+			index = len(billing.Totals)
+			totals[line.Currency] = index
+			billing.Totals = append(billing.Totals, models.PartnerBillingTotal{
+				Currency: line.Currency,
+				Paid:     money.New(0, line.Currency),
+				Share:    money.New(0, line.Currency),
+			})
+		}
+		total := &billing.Totals[index]
+		total.Payments += line.Payments
+		total.Paid = total.Paid.Add(line.Paid)
+		total.Share = total.Share.Add(line.Share)
+	}
+	return billing, nil
+}
+
+// Отправка партнерам отчетов о вознаграждении за прошедший календарный месяц. Месяц
+// определяется по часовому поясу по умолчанию, его границы - по часовому поясу партнера.
+// Отчет за месяц отправляется один раз; партнеры, не вошедшие в пачку, получат отчет при
+// следующей проверке.
+func (s *Service) generatePartnerReports(ctx context.Context, now time.Time) {
+	now = now.In(s.defaultTimezone)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+
+	partners, err := s.repo.DuePartners(ctx, start, partnerReportBatch)
+	if err != nil {
+		s.logger.Printf("Ошибка получения партнеров для отчетов: %v", err)
+		return
+	}
+
+	for _, partner := range partners {
+		loc := s.UserLocation(ctx, partner.UserID)
+		from := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, loc)
+		billing, err := s.partnerBilling(ctx, &partner, from, from.AddDate(0, 1, 0))
+		if err != nil {
+			s.logger.Printf("Ошибка подсчета вознаграждения партнера %d: %v", partner.ID, err)
+			continue
+		}
+
+		err = s.repo.MarkPartnerReported(ctx, partner.ID, start, func() ([]models.OutboxMessage, error) {
+			return s.outbox().telegram(partner.UserID, partnerReportText(billing)).build()
+		})
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			s.logger.Printf("Ошибка отправки отчета партнеру %d: %v", partner.ID, err)
+		}
+	}
+}
+
+// Текст отчета о вознаграждении для Telegram
+func partnerReportText(billing *models.PartnerBilling) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "Отчет о вознаграждении за %s\n\n", billing.From.Format("01.2006"))
+	if len(billing.Totals) == 0 {
+		text.WriteString("Оплат от клиентов за месяц не было.")
+		return text.String()
+	}
+
+	organizations := make(map[int]bool)
+	for _, line := range billing.Lines {
+		organizations[line.OrganizationID] = true
+	}
+	fmt.Fprintf(&text, "Клиентов с оплатами: %d\n", len(organizations))
+	for _, total := range billing.Totals {
+		fmt.Fprintf(&text, "Платежей: %d на сумму %s %s, вознаграждение %s %s (%g%%)\n",
+			total.Payments, total.Paid, total.Currency, total.Share, total.Currency, billing.RevenueShare)
+	}
+	text.WriteString("\nПодробности по клиентам - в /api/partners/billing")
+	return text.String()
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+)
+
+func TestPartnerReportText(t *testing.T) {
+	from := time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		billing models.PartnerBilling
+		want    []string
+	}{
+		{
+			name:    "без оплат",
+			billing: models.PartnerBilling{From: from, RevenueShare: 10},
+			want:    []string{"Отчет о вознаграждении за 09.2026", "Оплат от клиентов за месяц не было."},
+		},
+		{
+			name: "оплаты в двух валютах",
+			billing: models.PartnerBilling{
+				From:         from,
+				RevenueShare: 12.5,
+				Lines: []models.PartnerBillingLine{
+					{OrganizationID: 1, Currency: money.RUB},
+					{OrganizationID: 2, Currency: money.RUB},
+					{OrganizationID: 2, Currency: "USD"},
+				},
+				Totals: []models.PartnerBillingTotal{
+					{Currency: money.RUB, Payments: 3, Paid: money.New(200000, money.RUB), Share: money.New(25000, money.RUB)},
+					{Currency: "USD", Payments: 1, Paid: money.New(1000, "USD"), Share: money.New(125, "USD")},
+				},
+			},
+			want: []string{
+				"Клиентов с оплатами: 2",
+				"Платежей: 3 на сумму 2000.00 RUB, вознаграждение 250.00 RUB (12.5%)",
+				"Платежей: 1 на сумму 10.00 USD, вознаграждение 1.25 USD (12.5%)",
+				"/api/partners/billing",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := partnerReportText(&tt.billing)
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("в отчете нет %q:\n%s", want, text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,724 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+	"project-znak/internal/repository"
+	"project-znak/internal/robokassa"
+	"project-znak/internal/stripe"
+)
+
+// Наибольшее число платежей, обрабатываемых за одну сверку или проверку срока оплаты
+const paymentReconcileBatch = 50
+
+// Число ошибок подряд, после которого платежный провайдер считается недоступным
+const paymentProviderFailureThreshold = 3
+
+// Число платежей в списке по умолчанию и наибольшее число платежей в списке и в выписке
+const (
+	paymentListDefaultLimit = 50
+	paymentListMaxLimit     = 1000
+	paymentStatementMaxRows = 10000
+)
+
+// PaymentRequest - запрос на создание платежа
+type PaymentRequest struct {
+	TelegramID     int64   `json:"telegram_id"`
+	Amount         float64 `json:"amount" validate:"required,gt=0"`
+	OrderID        int     `json:"order_id,omitempty"`
+	OrganizationID int     `json:"organization_id,omitempty"`
+	ReturnURL      string  `json:"return_url,omitempty"`
+	Currency       string  `json:"currency,omitempty"` // Код валюты ISO 4217, по умолчанию RUB
+}
+
+// PaymentListRequest - фильтр истории платежей пользователя или организации.
+// Период задается датами создания платежа (включительно).
+type PaymentListRequest struct {
+	OrganizationID int
+	Status         string
+	From           string `validate:"date"`
+	To             string `validate:"date"`
+	Limit          int
+	Offset         int
+}
+
+// PaymentResult - созданный платеж и ссылка на оплату
+type PaymentResult struct {
+	PaymentID   int
+	RedirectURL string
+}
+
+// RobokassaCallback - параметры уведомления Robokassa о проведенном платеже
+type RobokassaCallback struct {
+	InvID          string
+	OutSum         string
+	SignatureValue string
+	TransactionID  string
+	Params         map[string]string // Пользовательские параметры Shp_, входящие в подпись
+}
+
+// PaymentProviderHealth - доступность платежного провайдера по результатам сверки платежей
+type PaymentProviderHealth struct {
+	Name        string     `json:"name" xml:"name"`
+	Status      string     `json:"status" xml:"status"` // ok, degraded, error или disabled
+	LastSuccess *time.Time `json:"last_success,omitempty" xml:"last_success,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty" xml:"last_failure,omitempty"`
+	Failures    int        `json:"consecutive_failures" xml:"consecutive_failures"`
+	Message     string     `json:"message,omitempty" xml:"message,omitempty"` // Текст последней ошибки
+}
+
+// Данные квитанции об оплате
+type paymentReceiptEmail struct {
+	PaymentID   int
+	OrderID     int
+	Amount      money.Money
+	CompletedAt time.Time
+}
+
+// CreatePayment создает платеж пользователя и формирует ссылку на оплату. Платеж в рублях
+// оплачивается через Robokassa, в иностранной валюте - через Stripe Checkout; порядок
+// провайдеров задается маршрутами платежей.
+func (s *Service) CreatePayment(ctx context.Context, actor Actor, request PaymentRequest) (*PaymentResult, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	// Получение ID пользователя
+	userID, err := s.UserIDByTelegram(ctx, request.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+	if userID == 0 {
+		return nil, NewError(KindNotFound, "Пользователь не найден", nil)
+	}
+
+	currency, route, err := s.paymentRoute(request.Currency, request.Amount, userID, request.ReturnURL != "")
+	if err != nil {
+		return nil, err
+	}
+	amount, err := paymentAmount(request.Amount, currency)
+	if err != nil {
+		return nil, err
+	}
+	provider := route[0]
+	if request.ReturnURL == "" {
+		request.ReturnURL = s.payment.StripeReturnURL
+	}
+
+	// Платеж по заказу оплачивается от имени организации заказа
+	if request.OrderID > 0 {
+		orderStatus, orderOrganizationID, err := s.repo.AccessibleOrder(ctx, request.OrderID, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, NewError(KindNotFound, "Заказ не найден", nil)
+		} else if err != nil {
+			return nil, fmt.Errorf("ошибка получения заказа: %w", err)
+		}
+		if orderStatus == models.OrderStatusCancelled {
+			return nil, NewError(KindConflict, "Заказ отменен", nil)
+		}
+		if orderOrganizationID > 0 {
+			request.OrganizationID = orderOrganizationID
+		}
+	}
+
+	// Выбор организации-плательщика
+	organizationID, err := s.organizationForOperation(ctx, userID, request.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Создание записи о платеже
+	result := &PaymentResult{}
+	result.PaymentID, err = s.repo.CreatePayment(ctx, userID, request.OrderID, organizationID, amount, provider)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка создания платежа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "payment", result.PaymentID, nil, map[string]any{
+		"amount":          amount.String(),
+		"currency":        currency,
+		"provider":        provider,
+		"order_id":        request.OrderID,
+		"organization_id": organizationID,
+		"status":          models.PaymentStatusPending,
+	})
+
+	if result.RedirectURL, err = s.paymentRedirectURL(ctx, result.PaymentID, amount, route, request.ReturnURL); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Сумма платежа в валюте currency; сумма с долями меньше минимальной единицы валюты
+// отклоняется
+func paymentAmount(value float64, currency string) (money.Money, error) {
+	amount := money.FromFloat(value, currency)
+	if math.Abs(amount.Float64()-value) > 1e-9 {
+		return money.Money{}, NewError(KindInvalid, fmt.Sprintf("Сумма в валюте %s может содержать не больше %d знаков после запятой",
+			currency, money.Exponent(currency)), nil)
+	}
+	return amount, nil
+}
+
+// Ссылка на оплату созданного платежа. Провайдеры маршрута пробуются по порядку: если
+// сессию Stripe создать не удалось, платеж переводится на следующий провайдер, а когда
+// провайдеров не осталось - отменяется.
+func (s *Service) paymentRedirectURL(ctx context.Context, paymentID int, amount money.Money, route []string, returnURL string) (string, error) {
+	var checkoutErr error
+	for i, provider := range route {
+		if i > 0 {
+			s.logger.Printf("Платеж %d переводится на провайдера %s: %v", paymentID, provider, checkoutErr)
+			if err := s.repo.SetPaymentProvider(ctx, paymentID, provider); err != nil {
+				return "", NewError(KindInternal, "Ошибка создания платежа", err)
+			}
+		}
+		if provider != models.PaymentProviderStripe {
+			return s.robokassaPaymentURL(amount, paymentID), nil
+		}
+		redirectURL, err := s.stripeCheckout(ctx, paymentID, amount, returnURL)
+		if err == nil {
+			return redirectURL, nil
+		}
+		checkoutErr = err
+	}
+	if closeErr := s.closePayment(context.WithoutCancel(ctx), paymentID, 0, models.PaymentStatusFailed); closeErr != nil {
+		s.logger.Printf("Ошибка отмены платежа %d: %v", paymentID, closeErr)
+	}
+	return "", NewError(KindUnavailable, "Платежная система Stripe недоступна, попробуйте позже", checkoutErr)
+}
+
+// Маршрут платежа: валюта и провайдеры в порядке попыток. Порядок задается правилом
+// пользователя, правилом с наибольшим порогом суммы, не превышающим amount, или
+// PAYMENT_PROVIDERS. Из маршрута исключаются провайдеры, не принимающие валюту: рубли
+// принимает Robokassa, валюты из STRIPE_CURRENCIES - Stripe, которому нужен адрес
+// возврата (hasReturnURL или STRIPE_RETURN_URL). Недоступные провайдеры, у которых
+// paymentProviderFailureThreshold запросов подряд завершились ошибкой, пробуются последними.
+func (s *Service) paymentRoute(currency string, amount float64, userID int, hasReturnURL bool) (string, []string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = money.RUB
+	}
+
+	order, ok := s.payment.UserRoutes[userID]
+	if !ok {
+		order = s.payment.Providers
+		threshold := -1
+		for limit, providers := range s.payment.AmountRoutes {
+			if float64(limit) <= amount && limit > threshold {
+				order, threshold = providers, limit
+			}
+		}
+	}
+
+	var route []string
+	missingReturnURL := false
+	for _, provider := range order {
+		if !s.acceptsCurrency(provider, currency) || slices.Contains(route, provider) {
+			continue
+		}
+		if provider == models.PaymentProviderStripe && !hasReturnURL && s.payment.StripeReturnURL == "" {
+			missingReturnURL = true
+			continue
+		}
+		route = append(route, provider)
+	}
+	if len(route) == 0 {
+		if missingReturnURL {
+			return "", nil, NewError(KindInvalid, "Необходимо указать return_url", nil)
+		}
+		return "", nil, NewError(KindInvalid, fmt.Sprintf("Оплата в валюте %s не поддерживается", currency), nil)
+	}
+	slices.SortStableFunc(route, func(a, b string) int {
+		switch unavailableA, unavailableB := s.paymentProviderUnavailable(a), s.paymentProviderUnavailable(b); {
+		case unavailableA == unavailableB:
+			return 0
+		case unavailableA:
+			return 1
+		}
+		return -1
+	})
+	return currency, route, nil
+}
+
+// Принимает ли провайдер платежи в валюте currency
+func (s *Service) acceptsCurrency(provider, currency string) bool {
+	switch provider {
+	case models.PaymentProviderRobokassa:
+		return currency == money.RUB
+	case models.PaymentProviderStripe:
+		return s.stripe.Enabled() && slices.ContainsFunc(s.payment.StripeCurrencies, func(allowed string) bool {
+			return strings.EqualFold(allowed, currency)
+		})
+	}
+	return false
+}
+
+// Провайдер недоступен, если paymentProviderFailureThreshold запросов к нему подряд
+// завершились ошибкой
+func (s *Service) paymentProviderUnavailable(provider string) bool {
+	failures := 0
+	switch provider {
+	case models.PaymentProviderRobokassa:
+		if s.robokassa.Enabled() {
+			failures = s.robokassa.Health().Failures
+		}
+	case models.PaymentProviderStripe:
+		if s.stripe.Enabled() {
+			failures = s.stripe.Health().Failures
+		}
+	}
+	return failures >= paymentProviderFailureThreshold
+}
+
+// Создание сессии Stripe Checkout для платежа. Сессия действует в пределах срока оплаты,
+// но не меньше 30 минут и не больше 24 часов - ограничений Stripe.
+func (s *Service) stripeCheckout(ctx context.Context, paymentID int, amount money.Money, returnURL string) (string, error) {
+	ttl := min(max(s.payment.TTL, 31*time.Minute), 24*time.Hour)
+	session, err := s.stripe.CreateCheckoutSession(ctx, stripe.CheckoutParams{
+		PaymentID:   paymentID,
+		Amount:      amount,
+		Description: "Оплата услуг",
+		SuccessURL:  returnURL,
+		CancelURL:   returnURL,
+		ExpiresAt:   time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.SetPaymentExternalID(ctx, paymentID, session.ID); err != nil {
+		s.logger.Printf("Ошибка сохранения сессии Stripe платежа %d: %v", paymentID, err)
+	}
+	return session.URL, nil
+}
+
+// SetRobokassaPassword заменяет пароль магазина Robokassa после ротации секретов
+func (s *Service) SetRobokassaPassword(password string) {
+	s.paymentMu.Lock()
+	defer s.paymentMu.Unlock()
+	s.payment.RobokassaPassword = password
+	s.robokassa.SetPassword(password)
+}
+
+func (s *Service) robokassaPassword() string {
+	s.paymentMu.RLock()
+	defer s.paymentMu.RUnlock()
+	return s.payment.RobokassaPassword
+}
+
+// SetRobokassaResultPassword заменяет пароль #2 Robokassa, которым подписываются
+// уведомления ResultURL, после ротации секретов
+func (s *Service) SetRobokassaResultPassword(password string) {
+	s.paymentMu.Lock()
+	defer s.paymentMu.Unlock()
+	s.payment.RobokassaPassword2 = password
+}
+
+func (s *Service) robokassaResultPassword() string {
+	s.paymentMu.RLock()
+	defer s.paymentMu.RUnlock()
+	return s.payment.RobokassaPassword2
+}
+
+// Формирование URL для оплаты через Robokassa. Сумма в подписи и в ссылке записывается
+// одной строкой с копейками: расхождение в записи суммы делает подпись неверной.
+func (s *Service) robokassaPaymentURL(amount money.Money, paymentID int) string {
+	// Формирование подписи запроса
+	// merchantLogin:OutSum:InvId:Пароль
+	signature := fmt.Sprintf("%s:%s:%d:%s", s.payment.RobokassaLogin, amount, paymentID, s.robokassaPassword())
+	signatureHash := fmt.Sprintf("%x", sha1.Sum([]byte(signature)))
+
+	return fmt.Sprintf(
+		"%s?MerchantLogin=%s&OutSum=%s&InvId=%d&SignatureValue=%s&Desc=%s&Culture=ru",
+		s.payment.PaymentURL, s.payment.RobokassaLogin, amount, paymentID, signatureHash, "Оплата услуг",
+	)
+}
+
+// GetPayment возвращает платеж пользователя
+func (s *Service) GetPayment(ctx context.Context, paymentID int, telegramID int64) (*models.Payment, error) {
+	payment, err := s.repo.UserPayment(ctx, paymentID, telegramID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Платеж не найден", nil)
+	} else if err != nil {
+		return nil, fmt.Errorf("ошибка запроса статуса платежа: %w", err)
+	}
+	if payment.Orders, err = s.repo.PaymentOrders(ctx, paymentID); err != nil {
+		return nil, fmt.Errorf("ошибка получения заказов платежа: %w", err)
+	}
+	return payment, nil
+}
+
+// ListPayments возвращает историю платежей пользователя или, если указана организация,
+// платежи организации, доступные всем ее участникам
+func (s *Service) ListPayments(ctx context.Context, userID int, request PaymentListRequest) ([]models.Payment, error) {
+	if request.Limit <= 0 {
+		request.Limit = paymentListDefaultLimit
+	}
+	request.Limit = min(request.Limit, paymentListMaxLimit)
+	return s.listPayments(ctx, userID, request)
+}
+
+// PaymentStatement возвращает все платежи за период для выписки. Если платежей больше
+// paymentStatementMaxRows, выписку нужно запросить за более короткий период.
+func (s *Service) PaymentStatement(ctx context.Context, userID int, request PaymentListRequest) ([]models.Payment, error) {
+	request.Limit = paymentStatementMaxRows + 1
+	request.Offset = 0
+	payments, err := s.listPayments(ctx, userID, request)
+	if err != nil {
+		return nil, err
+	}
+	if len(payments) > paymentStatementMaxRows {
+		return nil, NewError(KindInvalid, fmt.Sprintf("Выписка не может содержать больше %d платежей, сократите период", paymentStatementMaxRows), nil)
+	}
+	return payments, nil
+}
+
+func (s *Service) listPayments(ctx context.Context, userID int, request PaymentListRequest) ([]models.Payment, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	if request.Status != "" && !(&models.Payment{}).IsValidStatus(request.Status) {
+		return nil, NewError(KindInvalid, "Некорректный статус платежа", nil)
+	}
+
+	filter := repository.PaymentFilter{
+		UserID:         userID,
+		OrganizationID: request.OrganizationID,
+		Status:         request.Status,
+		Limit:          request.Limit,
+		Offset:         max(request.Offset, 0),
+	}
+	// Формат дат проверен ValidateRequest; границы дней - по часовому поясу пользователя
+	loc := s.UserLocation(ctx, userID)
+	if request.From != "" {
+		from, _ := time.ParseInLocation(documentDateLayout, request.From, loc)
+		from = from.UTC()
+		filter.From = &from
+	}
+	if request.To != "" {
+		to, _ := time.ParseInLocation(documentDateLayout, request.To, loc)
+		to = to.AddDate(0, 0, 1).UTC()
+		filter.To = &to
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, NewError(KindInvalid, "Начало периода позже его окончания", nil)
+	}
+
+	if request.OrganizationID > 0 {
+		if _, err := s.repo.OrganizationRole(ctx, request.OrganizationID, userID); errors.Is(err, repository.ErrNotOrganizationMember) {
+			return nil, NewError(KindForbidden, "Пользователь не состоит в указанной организации", nil)
+		} else if err != nil {
+			return nil, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка проверки участия в организации: %w", err))
+		}
+	}
+
+	payments, err := s.repo.ListPayments(ctx, filter)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса платежей: %w", err))
+	}
+	return payments, nil
+}
+
+// CompletePayment проверяет подпись уведомления Robokassa паролем #2 и отмечает платеж
+// проведенным. Повторное уведомление по уже проведенному платежу не меняет данных.
+// Если сумма уведомления не совпадает с суммой платежа или оплата пришла по закрытому
+// платежу, платеж не проводится и отмечается для проверки администратором.
+func (s *Service) CompletePayment(ctx context.Context, actor Actor, callback RobokassaCallback) error {
+	// Валидация параметров
+	if callback.InvID == "" || callback.OutSum == "" || callback.SignatureValue == "" {
+		return NewError(KindInvalid, "Неверные параметры", nil)
+	}
+
+	// Проверка подписи
+	if !robokassa.VerifyResult(callback.SignatureValue, callback.OutSum, callback.InvID,
+		s.robokassaResultPassword(), callback.Params) {
+		s.logger.Printf("Неверная подпись уведомления Robokassa по счету %s", callback.InvID)
+		return NewError(KindForbidden, "Неверная подпись", nil)
+	}
+
+	paymentID, err := strconv.Atoi(callback.InvID)
+	if err != nil {
+		return NewError(KindInvalid, "Неверный ID платежа", err)
+	}
+	outSum, err := money.Parse(callback.OutSum, money.RUB)
+	if err != nil {
+		return NewError(KindInvalid, "Неверная сумма", err)
+	}
+
+	payment, err := s.repo.Payment(ctx, paymentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Платеж не найден", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка обновления платежа", err)
+	}
+	if payment.Provider != models.PaymentProviderRobokassa {
+		return NewError(KindInvalid, "Платеж не принимается через Robokassa", nil)
+	}
+
+	switch {
+	case payment.Status == models.PaymentStatusCompleted:
+		return nil
+	case payment.ReviewReason != "":
+		// Платеж уже отмечен для проверки администратором: повторное уведомление не меняет данных
+		return nil
+	case payment.Status != models.PaymentStatusPending:
+		s.logger.Printf("Оплата Robokassa поступила по платежу %d в статусе %s", paymentID, payment.Status)
+		return s.flagPayment(ctx, actor, paymentID,
+			fmt.Sprintf("Оплата Robokassa %s поступила по платежу в статусе %s", outSum, payment.Status))
+	case !outSum.Equal(payment.Amount):
+		s.logger.Printf("Сумма уведомления Robokassa %s не совпадает с суммой платежа %d: %s", outSum, paymentID, payment.Amount)
+		return s.flagPayment(ctx, actor, paymentID,
+			fmt.Sprintf("Сумма оплаты в Robokassa %s не совпадает с суммой платежа %s", outSum, payment.Amount))
+	}
+
+	return s.completePayment(ctx, actor, paymentID, payment.Version, callback.TransactionID, outSum.String())
+}
+
+// Проведение ожидающего платежа: отметка в БД, квитанция и запись аудита.
+// Повторное проведение уже проведенного платежа не меняет данных. Если version > 0,
+// платеж проводится только в прочитанной версии, иначе возвращается конфликт версий.
+func (s *Service) completePayment(ctx context.Context, actor Actor, paymentID, version int, transactionID, outSum string) error {
+	now := time.Now()
+	payment, err := s.repo.CompletePayment(ctx, paymentID, version, transactionID, now,
+		func(payment *repository.CompletedPayment) ([]models.OutboxMessage, error) {
+			return s.paymentReceiptMessages(payment.UserID, paymentReceiptEmail{
+				PaymentID:   paymentID,
+				OrderID:     payment.OrderID,
+				Amount:      payment.Amount,
+				CompletedAt: now,
+			})
+		})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	} else if errors.Is(err, repository.ErrConflict) {
+		return versionConflict("Платеж изменен другим запросом")
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка обновления платежа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "payment", paymentID,
+		map[string]string{"status": models.PaymentStatusPending},
+		map[string]string{"status": models.PaymentStatusCompleted, "out_sum": outSum})
+	// Чеки 54-ФЗ регистрируются только по платежам в рублях
+	if payment.Amount.Code() == money.RUB {
+		s.enqueueFiscalReceipt(ctx, paymentID)
+	}
+	s.creditReferralBonus(ctx, actor, payment.UserID, paymentID, payment.Amount)
+
+	return nil
+}
+
+// RunPaymentReconciliation периодически сверяет с Robokassa платежи, ожидающие оплаты
+// дольше after, до отмены контекста. Используется, если уведомление ResultURL не дошло.
+func (s *Service) RunPaymentReconciliation(ctx context.Context, interval, after time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			s.reconcilePayments(ctx, interval, after)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Сверка ожидающих платежей. Каждый платеж проверяется не чаще одного раза за interval.
+func (s *Service) reconcilePayments(ctx context.Context, interval, after time.Duration) {
+	if !s.robokassa.Enabled() {
+		return
+	}
+
+	now := time.Now()
+	payments, err := s.repo.PendingPayments(ctx, models.PaymentProviderRobokassa, now.Add(-after), now.Add(-interval), paymentReconcileBatch)
+	if err != nil {
+		s.logger.Printf("Ошибка получения ожидающих платежей: %v", err)
+		return
+	}
+
+	for _, payment := range payments {
+		if err := s.reconcilePayment(ctx, payment); err != nil {
+			s.logger.Printf("Ошибка сверки платежа %d: %v", payment.ID, err)
+		}
+		if err := s.repo.MarkPaymentReconciled(ctx, payment.ID, now); err != nil {
+			s.logger.Printf("Ошибка сохранения времени сверки платежа %d: %v", payment.ID, err)
+		}
+	}
+}
+
+// Сверка платежа по состоянию операции в Robokassa. Оплаченный платеж проводится так же,
+// как по уведомлению; при расхождении суммы платеж отмечается для проверки администратором.
+func (s *Service) reconcilePayment(ctx context.Context, payment models.Payment) error {
+	operation, err := s.robokassa.OpState(ctx, payment.ID)
+	if errors.Is(err, robokassa.ErrNotFound) {
+		// Покупатель не перешел к оплате: платеж отменяется по истечении срока оплаты
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	switch operation.State {
+	case robokassa.StateCompleted:
+		if !operation.OutSum.Equal(payment.Amount) {
+			return s.flagPayment(ctx, Actor{}, payment.ID,
+				fmt.Sprintf("Сумма оплаты в Robokassa %s не совпадает с суммой платежа %s", operation.OutSum, payment.Amount))
+		}
+		return s.completePayment(ctx, Actor{}, payment.ID, payment.Version, operation.OpKey, operation.OutSum.String())
+	case robokassa.StateCancelled:
+		return s.closePayment(ctx, payment.ID, payment.Version, models.PaymentStatusCancelled)
+	case robokassa.StateRefunded:
+		return s.closePayment(ctx, payment.ID, payment.Version, models.PaymentStatusRefunded)
+	}
+	return nil
+}
+
+// Отметка платежа для проверки администратором
+func (s *Service) flagPayment(ctx context.Context, actor Actor, paymentID int, reason string) error {
+	if err := s.repo.FlagPaymentForReview(ctx, paymentID, reason); err != nil {
+		return err
+	}
+	s.recordAudit(ctx, actor, AuditActionUpdate, "payment", paymentID, nil, map[string]any{
+		"needs_review":  true,
+		"review_reason": reason,
+	})
+	return nil
+}
+
+// Закрытие ожидающего платежа без оплаты; version > 0 - только в прочитанной версии
+func (s *Service) closePayment(ctx context.Context, paymentID, version int, status string) error {
+	err := s.repo.ClosePendingPayment(ctx, paymentID, version, status)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	} else if errors.Is(err, repository.ErrConflict) {
+		return versionConflict("Платеж изменен другим запросом")
+	} else if err != nil {
+		return err
+	}
+
+	s.recordAudit(ctx, Actor{}, AuditActionUpdate, "payment", paymentID,
+		map[string]string{"status": models.PaymentStatusPending},
+		map[string]string{"status": status})
+	return nil
+}
+
+// RunPaymentExpiration периодически отменяет платежи, не оплаченные за срок оплаты,
+// до отмены контекста
+func (s *Service) RunPaymentExpiration(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			s.expirePayments(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Отмена платежей, ожидающих оплаты дольше срока оплаты. Если настроена сверка
+// с Robokassa, перед отменой проверяется, не оплачен ли платеж; платеж, состояние
+// которого получить не удалось, не отменяется до следующей проверки. Оплата Stripe,
+// поступившая после отмены, отмечается для проверки администратором.
+func (s *Service) expirePayments(ctx context.Context) {
+	now := time.Now()
+	payments, err := s.repo.PendingPayments(ctx, "", now.Add(-s.payment.TTL), now, paymentReconcileBatch)
+	if err != nil {
+		s.logger.Printf("Ошибка получения просроченных платежей: %v", err)
+		return
+	}
+
+	for _, payment := range payments {
+		if payment.Provider == models.PaymentProviderRobokassa && s.robokassa.Enabled() {
+			if err := s.reconcilePayment(ctx, payment); err != nil {
+				s.logger.Printf("Ошибка сверки просроченного платежа %d: %v", payment.ID, err)
+				continue
+			}
+		}
+		if err := s.expirePayment(ctx, payment.ID, payment.Version); err != nil {
+			s.logger.Printf("Ошибка отмены просроченного платежа %d: %v", payment.ID, err)
+		}
+	}
+}
+
+// Отмена неоплаченного платежа с освобождением заказа и уведомлением пользователя;
+// version > 0 - только в прочитанной версии
+func (s *Service) expirePayment(ctx context.Context, paymentID, version int) error {
+	_, err := s.repo.ExpirePayment(ctx, paymentID, version, func(payment *repository.CompletedPayment) ([]models.OutboxMessage, error) {
+		return s.paymentExpiredMessages(paymentID, payment)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		// Платеж проведен или отменен при сверке
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	s.recordAudit(ctx, Actor{}, AuditActionUpdate, "payment", paymentID,
+		map[string]string{"status": models.PaymentStatusPending},
+		map[string]string{"status": models.PaymentStatusCancelled, "reason": "expired"})
+	return nil
+}
+
+// PaymentProviders возвращает доступность платежных провайдеров. Провайдер недоступен,
+// если paymentProviderFailureThreshold запросов подряд завершились ошибкой.
+func (s *Service) PaymentProviders() []PaymentProviderHealth {
+	providers := []PaymentProviderHealth{
+		{Name: models.PaymentProviderRobokassa, Status: HealthStatusDisabled},
+		{Name: models.PaymentProviderStripe, Status: HealthStatusDisabled},
+	}
+	if s.robokassa.Enabled() {
+		health := s.robokassa.Health()
+		providers[0].setHealth(health.LastSuccess, health.LastFailure, health.Error, health.Failures)
+	}
+	if s.stripe.Enabled() {
+		health := s.stripe.Health()
+		providers[1].setHealth(health.LastSuccess, health.LastFailure, health.Error, health.Failures)
+	}
+	return providers
+}
+
+func (p *PaymentProviderHealth) setHealth(lastSuccess, lastFailure time.Time, message string, failures int) {
+	p.Failures = failures
+	if !lastSuccess.IsZero() {
+		p.LastSuccess = &lastSuccess
+	}
+	if !lastFailure.IsZero() {
+		p.LastFailure = &lastFailure
+		p.Message = message
+	}
+	switch {
+	case failures >= paymentProviderFailureThreshold:
+		p.Status = HealthStatusError
+	case failures > 0:
+		p.Status = HealthStatusDegraded
+	default:
+		p.Status = HealthStatusOK
+	}
+}
+
+// ListPaymentsForReview возвращает платежи, отмеченные при сверке для проверки администратором
+func (s *Service) ListPaymentsForReview(ctx context.Context, limit int) ([]models.Payment, error) {
+	payments, err := s.repo.PaymentsForReview(ctx, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса платежей для проверки: %w", err))
+	}
+	return payments, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"project-znak/internal/config"
+	"project-znak/internal/money"
+	"project-znak/internal/stripe"
+)
+
+func TestPaymentRoute(t *testing.T) {
+	payment := config.PaymentConfig{
+		StripeCurrencies: []string{"USD", "RUB"},
+		Providers:        []string{"robokassa", "stripe"},
+		AmountRoutes:     map[int][]string{10000: {"stripe", "robokassa"}, 50000: {"robokassa"}},
+		UserRoutes:       map[int][]string{7: {"stripe"}},
+	}
+	tests := []struct {
+		name         string
+		currency     string
+		amount       float64
+		userID       int
+		returnURL    bool
+		stripe       bool
+		wantCurrency string
+		want         []string
+		wantErr      string
+	}{
+		{
+			name: "по умолчанию рубли", amount: 100, returnURL: true, stripe: true,
+			wantCurrency: money.RUB, want: []string{"robokassa", "stripe"},
+		},
+		{
+			name: "порог суммы", currency: "rub", amount: 10000, returnURL: true, stripe: true,
+			wantCurrency: money.RUB, want: []string{"stripe", "robokassa"},
+		},
+		{
+			name: "наибольший порог не больше суммы", amount: 60000, returnURL: true, stripe: true,
+			wantCurrency: money.RUB, want: []string{"robokassa"},
+		},
+		{
+			name: "правило пользователя важнее суммы", amount: 60000, userID: 7, returnURL: true, stripe: true,
+			wantCurrency: money.RUB, want: []string{"stripe"},
+		},
+		{
+			name: "валюту принимает только Stripe", currency: "USD", amount: 20000, returnURL: true, stripe: true,
+			wantCurrency: "USD", want: []string{"stripe"},
+		},
+		{
+			name: "без адреса возврата Stripe пропускается", amount: 10000, stripe: true,
+			wantCurrency: money.RUB, want: []string{"robokassa"},
+		},
+		{
+			name: "Stripe без адреса возврата", currency: "USD", amount: 10, stripe: true,
+			wantErr: "Необходимо указать return_url",
+		},
+		{
+			name: "Stripe не настроен", currency: "USD", amount: 10, returnURL: true,
+			wantErr: "Оплата в валюте USD не поддерживается",
+		},
+		{
+			name: "валюта не принимается", currency: "EUR", amount: 10, returnURL: true, stripe: true,
+			wantErr: "Оплата в валюте EUR не поддерживается",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{payment: payment}
+			if tt.stripe {
+				s.stripe = stripe.NewClient("", "sk_test", "whsec_test", time.Second)
+			}
+			currency, route, err := s.paymentRoute(tt.currency, tt.amount, tt.userID, tt.returnURL)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ошибка %v, ожидалась %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if currency != tt.wantCurrency || !reflect.DeepEqual(route, tt.want) {
+				t.Errorf("получено %s %v, ожидалось %s %v", currency, route, tt.wantCurrency, tt.want)
+			}
+		})
+	}
+}
+
+// Провайдер, у которого подряд завершились ошибкой paymentProviderFailureThreshold
+// запросов, переносится в конец маршрута
+func TestPaymentRouteUnavailableLast(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"unavailable"}}`, http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	s := &Service{
+		payment: config.PaymentConfig{StripeCurrencies: []string{"RUB"}, Providers: []string{"stripe", "robokassa"}},
+		stripe:  stripe.NewClient(upstream.URL, "sk_test", "whsec_test", time.Second),
+	}
+	for i := 0; i < paymentProviderFailureThreshold; i++ {
+		_, route, err := s.paymentRoute("RUB", 100, 0, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"stripe", "robokassa"}; !reflect.DeepEqual(route, want) {
+			t.Fatalf("попытка %d: получено %v, ожидалось %v", i, route, want)
+		}
+		_, err = s.stripe.CreateCheckoutSession(context.Background(), stripe.CheckoutParams{PaymentID: i + 1, Amount: money.New(100, money.RUB)})
+		if err == nil {
+			t.Fatal("ожидалась ошибка Stripe")
+		}
+	}
+	_, route, err := s.paymentRoute("RUB", 100, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"robokassa", "stripe"}; !reflect.DeepEqual(route, want) {
+		t.Errorf("получено %v, ожидалось %v", route, want)
+	}
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// Время хранения тарифного плана пользователя в кэше; изменение плана или его квот
+// применяется к запросам других экземпляров сервиса не позже чем через это время
+const planCacheTTL = time.Minute
+
+// Периоды квот тарифного плана
+const (
+	quotaPeriodMonth = "month"
+	quotaPeriodDay   = "day"
+)
+
+// Ключ кэша тарифного плана пользователя
+func planCacheKey(userID int) string {
+	return fmt.Sprintf("plan:user:%d", userID)
+}
+
+// Начало текущего и следующего периода квоты
+func quotaPeriod(period string, now time.Time) (start, end time.Time) {
+	if period == quotaPeriodMonth {
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0)
+	}
+	start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// Квота плана по метрике: лимит и период
+func planQuota(plan *models.Plan, metric string) (limit int64, period string) {
+	if metric == models.QuotaCodes {
+		return plan.MonthlyCodes, quotaPeriodMonth
+	}
+	return plan.DailyRequests, quotaPeriodDay
+}
+
+// Потребление по метрике за период
+func newQuota(metric, period string, limit, used int64, resetsAt time.Time) models.Quota {
+	quota := models.Quota{Metric: metric, Period: period, Limit: limit, Used: used, ResetsAt: resetsAt}
+	if limit > 0 {
+		remaining := max(limit-used, 0)
+		quota.Remaining = &remaining
+	}
+	return quota
+}
+
+// Тарифный план пользователя: назначенный или план по умолчанию. Возвращает nil, если
+// план не назначен и план по умолчанию не задан или не найден.
+func (s *Service) userPlan(ctx context.Context, userID int) (*models.Plan, error) {
+	var plan models.Plan
+	if s.cache.Get(ctx, planCacheKey(userID), &plan) {
+		if plan.Name == "" {
+			return nil, nil
+		}
+		return &plan, nil
+	}
+
+	name, err := s.repo.UserPlan(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("ошибка запроса тарифного плана пользователя: %w", err)
+	}
+	if name == "" {
+		name = s.defaultPlan
+	}
+
+	var found *models.Plan
+	if name != "" {
+		found, err = s.repo.Plan(ctx, name)
+		if errors.Is(err, repository.ErrNotFound) {
+			s.logger.Printf("Тарифный план %s пользователя %d не найден, потребление не ограничивается", name, userID)
+		} else if err != nil {
+			return nil, fmt.Errorf("ошибка запроса тарифного плана %s: %w", name, err)
+		}
+	}
+	if found != nil {
+		plan = *found
+	}
+	s.cache.Set(ctx, planCacheKey(userID), plan, planCacheTTL)
+	return found, nil
+}
+
+// UserPlanName возвращает код тарифного плана пользователя с учетом плана по умолчанию
+// или пустую строку, если план не действует
+func (s *Service) UserPlanName(ctx context.Context, userID int) (string, error) {
+	plan, err := s.userPlan(ctx, userID)
+	if err != nil || plan == nil {
+		return "", err
+	}
+	return plan.Name, nil
+}
+
+// Учет потребления amount по метрике тарифного плана пользователя. Если квота будет
+// превышена, потребление не учитывается и возвращается ошибка с остатком квоты.
+// Возвращает состояние квоты после учета; пользователи без плана не ограничиваются,
+// их потребление не учитывается, а состояние квоты равно nil.
+func (s *Service) consumeQuota(ctx context.Context, userID int, metric string, amount int) (*models.Quota, error) {
+	if userID == 0 {
+		return nil, nil
+	}
+	plan, err := s.userPlan(ctx, userID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка проверки квоты тарифного плана", err)
+	}
+	if plan == nil {
+		return nil, nil
+	}
+
+	limit, period := planQuota(plan, metric)
+	start, end := quotaPeriod(period, time.Now())
+	used, ok := int64(0), false
+	if limit > 0 && int64(amount) > limit {
+		// Запрос больше квоты целиком: счетчик не изменяется
+		used, err = s.repo.Usage(ctx, userID, metric, start)
+	} else {
+		used, ok, err = s.repo.ConsumeUsage(ctx, userID, metric, start, int64(amount), limit)
+	}
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка учета квоты тарифного плана", err)
+	}
+	quota := newQuota(metric, period, limit, used, end)
+	if ok {
+		return &quota, nil
+	}
+
+	if metric == models.QuotaRequests {
+		return &quota, &Error{
+			Kind:       KindTooManyRequests,
+			Code:       ErrorCodeQuotaExceeded,
+			Message:    fmt.Sprintf("Исчерпана суточная квота запросов к API тарифного плана «%s»: %d из %d", plan.Title, used, limit),
+			RetryAfter: time.Until(end),
+			Quota:      &quota,
+		}
+	}
+	return &quota, &Error{
+		Kind: KindPaymentRequired,
+		Code: ErrorCodeQuotaExceeded,
+		Message: fmt.Sprintf("Исчерпана месячная квота кодов маркировки тарифного плана «%s»: запрошено %d, доступно %d из %d",
+			plan.Title, amount, *quota.Remaining, limit),
+		Quota: &quota,
+	}
+}
+
+// Возврат потребления, учтенного consumeQuota, если операция не выполнена
+func (s *Service) releaseQuota(ctx context.Context, userID int, metric string, amount int) {
+	if userID == 0 {
+		return
+	}
+	plan, err := s.userPlan(ctx, userID)
+	if err != nil || plan == nil {
+		return
+	}
+	_, period := planQuota(plan, metric)
+	start, _ := quotaPeriod(period, time.Now())
+	if err := s.repo.ReleaseUsage(context.WithoutCancel(ctx), userID, metric, start, int64(amount)); err != nil {
+		s.logger.Printf("Ошибка возврата квоты %s пользователя %d: %v", metric, userID, err)
+	}
+}
+
+// ConsumeRequestQuota учитывает запрос к API по API ключу в суточной квоте тарифного
+// плана пользователя и возвращает состояние квоты; nil - квота не действует.
+// Ошибка БД не блокирует запрос и только записывается в журнал.
+func (s *Service) ConsumeRequestQuota(ctx context.Context, userID int) (*models.Quota, error) {
+	quota, err := s.consumeQuota(ctx, userID, models.QuotaRequests, 1)
+	if serviceErr := AsError(err); err != nil && serviceErr.Kind == KindInternal {
+		s.logger.Printf("Ошибка учета запроса пользователя %d: %v", userID, err)
+		return nil, nil
+	}
+	return quota, err
+}
+
+// Usage возвращает тарифный план пользователя и потребление по квотам за текущие периоды
+func (s *Service) Usage(ctx context.Context, userID int) (*models.Usage, error) {
+	plan, err := s.userPlan(ctx, userID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", err)
+	}
+	usage := &models.Usage{Plan: plan, Quotas: []models.Quota{}}
+	if plan == nil {
+		return usage, nil
+	}
+
+	now := time.Now()
+	for _, metric := range []string{models.QuotaCodes, models.QuotaRequests} {
+		limit, period := planQuota(plan, metric)
+		start, end := quotaPeriod(period, now)
+		used, err := s.repo.Usage(ctx, userID, metric, start)
+		if err != nil {
+			return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса потребления: %w", err))
+		}
+		usage.Quotas = append(usage.Quotas, newQuota(metric, period, limit, used, end))
+	}
+	return usage, nil
+}
+
+// ListPlans возвращает тарифные планы
+func (s *Service) ListPlans(ctx context.Context) ([]models.Plan, error) {
+	plans, err := s.repo.Plans(ctx)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса тарифных планов: %w", err))
+	}
+	return plans, nil
+}
+
+// SetPlan создает или изменяет тарифный план. Новые квоты применяются не позже чем
+// через planCacheTTL.
+func (s *Service) SetPlan(ctx context.Context, actor Actor, plan models.Plan) (*models.Plan, error) {
+	if err := plan.Validate(); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	before, err := s.repo.Plan(ctx, plan.Name)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса тарифного плана: %w", err))
+	}
+	if err := s.repo.SetPlan(ctx, &plan); err != nil {
+		return nil, NewError(KindInternal, "Ошибка сохранения тарифного плана", err)
+	}
+
+	if before == nil {
+		s.recordAudit(ctx, actor, AuditActionCreate, "plan", plan.Name, nil, plan)
+	} else {
+		s.recordAudit(ctx, actor, AuditActionUpdate, "plan", plan.Name, before, plan)
+	}
+	return &plan, nil
+}
+
+// SetUserPlan назначает тарифный план пользователю с указанным telegram_id;
+// пустой код плана снимает назначенный план
+func (s *Service) SetUserPlan(ctx context.Context, actor Actor, telegramID int64, planName string) error {
+	userID, err := s.UserIDByTelegram(ctx, telegramID)
+	if err != nil {
+		return err
+	}
+	if userID == 0 {
+		return NewError(KindNotFound, "Пользователь не найден", nil)
+	}
+	if planName != "" {
+		if _, err := s.repo.Plan(ctx, planName); errors.Is(err, repository.ErrNotFound) {
+			return NewError(KindInvalid, fmt.Sprintf("Неизвестный тарифный план %q", planName), nil)
+		} else if err != nil {
+			return NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса тарифного плана: %w", err))
+		}
+	}
+
+	before, err := s.repo.UserPlan(ctx, userID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса тарифного плана пользователя: %w", err))
+	}
+	if err := s.repo.SetUserPlan(ctx, userID, planName); errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Пользователь не найден", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка назначения тарифного плана", err)
+	}
+	s.cache.Delete(ctx, planCacheKey(userID))
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "user", userID,
+		map[string]string{"plan": before}, map[string]string{"plan": planName})
+	return nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/transport"
+)
+
+// SignedIntroductionReceipt возвращает подписанную квитанцию Честного ЗНАКа о результате
+// обработки документа ввода в оборот в исходном виде
+func (s *Service) SignedIntroductionReceipt(ctx context.Context, userID, documentID int) (*repository.DocumentReceipt, error) {
+	doc, err := s.GetIntroductionDocument(ctx, userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.signedReceipt(ctx, documentTypeIntroduction, doc.ID, doc.Status, doc.ProductGroup, doc.ExternalID, doc.Ticket)
+}
+
+// SignedRetirementReceipt возвращает подписанную квитанцию Честного ЗНАКа о результате
+// обработки документа вывода из оборота в исходном виде
+func (s *Service) SignedRetirementReceipt(ctx context.Context, userID, documentID int) (*repository.DocumentReceipt, error) {
+	doc, err := s.GetRetirementDocument(ctx, userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.signedReceipt(ctx, documentTypeRetirement, doc.ID, doc.Status, doc.ProductGroup, doc.ExternalID, doc.Ticket)
+}
+
+// Квитанция по обработанному документу: сохраненная или, если ее не удалось получить
+// вместе с результатом обработки, запрошенная повторно
+func (s *Service) signedReceipt(ctx context.Context, documentType string, documentID int, status, productGroup, externalID, ticket string) (*repository.DocumentReceipt, error) {
+	if status != models.DocumentStatusAccepted && status != models.DocumentStatusRejected {
+		return nil, NewError(KindConflict, "Квитанция доступна после обработки документа Честным ЗНАКом", nil)
+	}
+	if ticket == "" {
+		return nil, NewError(KindNotFound, "Честный ЗНАК не выдал квитанцию по документу", nil)
+	}
+
+	receipt, err := s.repo.DocumentReceipt(ctx, documentType, documentID)
+	if err == nil {
+		return receipt, nil
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса квитанции документа: %w", err))
+	}
+	if !s.chestnyZnak.Enabled() {
+		return nil, NewError(KindNotFound, "Честный ЗНАК не выдал квитанцию по документу", nil)
+	}
+
+	receipt, err = s.fetchDocumentReceipt(ctx, documentType, documentID, productGroup, externalID, ticket)
+	if err != nil {
+		return nil, chestnyZnakError("Ошибка получения квитанции из Честного ЗНАКа", err)
+	}
+	return receipt, nil
+}
+
+// Запрос подписанной квитанции о результате обработки документа и ее сохранение
+func (s *Service) fetchDocumentReceipt(ctx context.Context, documentType string, documentID int, productGroup, externalID, ticket string) (*repository.DocumentReceipt, error) {
+	signed, err := s.chestnyZnak.DocumentReceipt(transport.WithSubject(ctx, documentType+"_document", documentID), productGroup, externalID)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := &repository.DocumentReceipt{
+		DocumentType: documentType,
+		DocumentID:   documentID,
+		Ticket:       ticket,
+		Content:      signed.Content,
+		ContentType:  signed.ContentType,
+	}
+	if err := s.repo.SaveDocumentReceipt(ctx, receipt); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения квитанции: %w", err)
+	}
+	return receipt, nil
+}
+
+// Квитанция к результату обработки документа. Ошибка получения квитанции не задерживает
+// сохранение результата: она записывается в журнал, а квитанция запрашивается повторно
+// при выгрузке.
+func (s *Service) resultReceipt(ctx context.Context, documentType string, documentID int, productGroup, externalID, ticket string) *repository.DocumentReceipt {
+	if ticket == "" {
+		return nil
+	}
+	receipt, err := s.fetchDocumentReceipt(ctx, documentType, documentID, productGroup, externalID, ticket)
+	if err != nil {
+		s.logger.Printf("Ошибка получения квитанции по документу %s %d: %v", documentType, documentID, err)
+		return nil
+	}
+	return receipt
+}
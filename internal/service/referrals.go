@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/money"
+	"project-znak/internal/repository"
+)
+
+// Символы реферального кода: без похожих друг на друга 0/O и 1/I
+const referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Длина реферального кода
+const referralCodeLength = 8
+
+// Префикс параметра start в ссылке на бота, по которому бот узнает реферальный код
+const referralStartPrefix = "ref_"
+
+// Генерация реферального кода
+func generateReferralCode() (string, error) {
+	b := make([]byte, referralCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = referralCodeAlphabet[int(b[i])%len(referralCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// ReferralStats возвращает реферальную ссылку пользователя, приглашенных им пользователей
+// и бонусный баланс. Реферальный код выдается при первом запросе.
+func (s *Service) ReferralStats(ctx context.Context, userID int) (*models.ReferralStats, error) {
+	code, err := generateReferralCode()
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при обработке запроса", err)
+	}
+	code, err = s.repo.ReferralCode(ctx, userID, code)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Пользователь не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения реферального кода: %w", err))
+	}
+
+	stats, err := s.repo.ReferralStats(ctx, userID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса приглашенных пользователей: %w", err))
+	}
+	if stats.Balance, err = s.repo.UserBalance(ctx, userID); err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса баланса: %w", err))
+	}
+
+	stats.Code = code
+	if s.referral.BotUsername != "" {
+		stats.Link = fmt.Sprintf("https://t.me/%s?start=%s%s", s.referral.BotUsername, referralStartPrefix, code)
+	}
+	stats.Bonus = money.FromFloat(s.referral.Bonus, money.RUB)
+	stats.BonusPercent = s.referral.BonusPercent
+	return stats, nil
+}
+
+// Привязка нового пользователя к пригласившему по реферальному коду. Код принимается
+// как есть или в виде параметра start ссылки на бота. Неизвестный код не прерывает
+// регистрацию и только записывается в журнал.
+func (s *Service) linkReferral(ctx context.Context, actor Actor, userID int, code string) {
+	code = strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(code), referralStartPrefix))
+	if code == "" {
+		return
+	}
+
+	referrerID, err := s.repo.CreateReferral(ctx, userID, code)
+	if errors.Is(err, repository.ErrNotFound) {
+		s.logger.Printf("Реферальный код %q пользователя %d не найден", code, userID)
+		return
+	} else if err != nil {
+		s.logger.Printf("Ошибка сохранения приглашения пользователя %d: %v", userID, err)
+		return
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "referral", userID, nil, map[string]any{
+		"referrer_id": referrerID,
+		"code":        code,
+	})
+}
+
+// Бонус пригласившему за первый платеж: фиксированная сумма и процент от платежа в рублях
+func (s *Service) referralBonus(payment money.Money) money.Money {
+	bonus := money.FromFloat(s.referral.Bonus, money.RUB)
+	if payment.Code() == money.RUB && s.referral.BonusPercent > 0 {
+		bonus = bonus.Add(money.FromFloat(payment.Float64()*s.referral.BonusPercent/100, money.RUB))
+	}
+	return bonus
+}
+
+// Учет первого платежа приглашенного пользователя: пригласившему начисляется бонус
+// и отправляется сообщение в Telegram. Ошибка не отменяет проведения платежа и только
+// записывается в журнал.
+func (s *Service) creditReferralBonus(ctx context.Context, actor Actor, userID, paymentID int, amount money.Money) {
+	if userID == 0 {
+		return
+	}
+
+	credit, err := s.repo.CreditReferralBonus(ctx, userID, paymentID, s.referralBonus(amount), time.Now(),
+		func(credit *repository.ReferralCredit) ([]models.OutboxMessage, error) {
+			if !credit.Bonus.IsPositive() {
+				return nil, nil
+			}
+			return s.outbox().
+				telegram(credit.ReferrerID, fmt.Sprintf(
+					"Приглашенный вами пользователь оплатил первый платеж. На ваш бонусный баланс начислено %s ₽.",
+					credit.Bonus)).
+				build()
+		})
+	if errors.Is(err, repository.ErrNotFound) {
+		return
+	} else if err != nil {
+		s.logger.Printf("Ошибка начисления реферального бонуса по платежу %d: %v", paymentID, err)
+		return
+	}
+	if !credit.Bonus.IsPositive() {
+		return
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "balance_transaction", credit.ReferralID, nil, map[string]any{
+		"user_id":    credit.ReferrerID,
+		"kind":       models.BalanceKindReferralBonus,
+		"amount":     credit.Bonus.String(),
+		"payment_id": paymentID,
+	})
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project-znak/internal/mailer"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// Число отчетов каждой периодичности, формируемых за одну проверку
+const reportBatch = 100
+
+// ReportSettingsRequest - запрос на изменение настроек отчетов. Незаполненные поля не меняются.
+type ReportSettingsRequest struct {
+	TelegramID int64  `json:"telegram_id"`
+	Frequency  string `json:"frequency,omitempty" validate:"oneof=off daily weekly"`
+	Telegram   *bool  `json:"telegram,omitempty"`
+	Email      *bool  `json:"email,omitempty"`
+}
+
+// Данные письма с отчетом; To - последний день периода
+type reportEmail struct {
+	Title   string
+	From    time.Time
+	To      time.Time
+	Summary models.ReportSummary
+}
+
+// ReportSettings возвращает настройки отчетов пользователя
+func (s *Service) ReportSettings(ctx context.Context, userID int) (models.ReportSettings, error) {
+	settings, err := s.repo.ReportSettings(ctx, userID)
+	if err != nil {
+		return settings, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения настроек отчетов: %w", err))
+	}
+	return settings, nil
+}
+
+// UpdateReportSettings меняет периодичность отчетов и каналы их доставки
+func (s *Service) UpdateReportSettings(ctx context.Context, actor Actor, request ReportSettingsRequest) (models.ReportSettings, error) {
+	if err := ValidateRequest(request); err != nil {
+		return models.ReportSettings{}, err
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return models.ReportSettings{}, err
+	}
+
+	before, err := s.repo.ReportSettings(ctx, userID)
+	if err != nil {
+		return before, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка получения настроек отчетов: %w", err))
+	}
+
+	settings := before
+	if request.Frequency != "" {
+		settings.Frequency = request.Frequency
+	}
+	if request.Telegram != nil {
+		settings.Telegram = *request.Telegram
+	}
+	if request.Email != nil {
+		settings.Email = *request.Email
+	}
+
+	if err := s.repo.SaveReportSettings(ctx, &settings); err != nil {
+		return settings, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка сохранения настроек отчетов: %w", err))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "report_settings", userID, before, settings)
+
+	return settings, nil
+}
+
+// ListReports возвращает последние сформированные отчеты пользователя
+func (s *Service) ListReports(ctx context.Context, userID, limit int) ([]models.Report, error) {
+	reports, err := s.repo.ListReports(ctx, userID, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения отчетов: %w", err))
+	}
+	return reports, nil
+}
+
+// GetReport возвращает отчет пользователя
+func (s *Service) GetReport(ctx context.Context, userID, reportID int) (*models.Report, error) {
+	report, err := s.repo.Report(ctx, userID, reportID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Отчет не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения отчета: %w", err))
+	}
+	return report, nil
+}
+
+// RunReportScheduler раз в interval формирует отчеты за последний завершившийся день
+// или неделю пользователям, включившим отчеты, и отправляет их в Telegram и на email,
+// а партнерам - отчеты о вознаграждении за прошедший месяц
+func (s *Service) RunReportScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			for _, frequency := range []string{models.ReportFrequencyDaily, models.ReportFrequencyWeekly} {
+				s.generateReports(ctx, frequency, time.Now())
+			}
+			s.generatePartnerReports(ctx, time.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Формирование отчетов за последний завершившийся период. Границы периода определяются
+// по часовому поясу пользователя и хранятся в UTC. Отчет за период формируется один раз;
+// пользователи, не вошедшие в пачку, получат отчет при следующей проверке.
+func (s *Service) generateReports(ctx context.Context, frequency string, now time.Time) {
+	timezones, err := s.repo.ReportTimezones(ctx, frequency)
+	if err != nil {
+		s.logger.Printf("Ошибка получения пользователей для отчетов: %v", err)
+		return
+	}
+
+	for _, timezone := range timezones {
+		loc := s.defaultTimezone
+		if timezone != "" {
+			if loc, err = loadLocation(timezone); err != nil {
+				s.logger.Printf("Ошибка загрузки часового пояса %s для отчетов: %v", timezone, err)
+				loc = s.defaultTimezone
+			}
+		}
+		start, end := reportPeriod(frequency, now.In(loc))
+		start, end = start.UTC(), end.UTC()
+
+		users, err := s.repo.DueReportUsers(ctx, frequency, timezone, start, reportBatch)
+		if err != nil {
+			s.logger.Printf("Ошибка получения пользователей для отчетов: %v", err)
+			return
+		}
+
+		for _, settings := range users {
+			summary, err := s.repo.ReportSummary(ctx, settings.UserID, start, end)
+			if err != nil {
+				s.logger.Printf("Ошибка подсчета отчета пользователя %d: %v", settings.UserID, err)
+				continue
+			}
+
+			report := models.Report{
+				UserID:      settings.UserID,
+				Frequency:   frequency,
+				PeriodStart: start,
+				PeriodEnd:   end,
+				Summary:     summary,
+			}
+			err = s.repo.SaveReport(ctx, &report, func() ([]models.OutboxMessage, error) {
+				return s.reportMessages(settings, report, loc)
+			})
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				s.logger.Printf("Ошибка сохранения отчета пользователя %d: %v", settings.UserID, err)
+			}
+		}
+	}
+}
+
+// Период отчета [start, end): предыдущий календарный день или предыдущая неделя
+// с понедельника по воскресенье
+func reportPeriod(frequency string, now time.Time) (time.Time, time.Time) {
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if frequency == models.ReportFrequencyWeekly {
+		end = end.AddDate(0, 0, -(int(end.Weekday())+6)%7)
+		return end.AddDate(0, 0, -7), end
+	}
+	return end.AddDate(0, 0, -1), end
+}
+
+// Уведомления с отчетом в выбранные пользователем каналы; даты периода - в часовом поясе loc
+func (s *Service) reportMessages(settings models.ReportSettings, report models.Report, loc *time.Location) ([]models.OutboxMessage, error) {
+	last := report.PeriodEnd.In(loc).AddDate(0, 0, -1)
+	title := "Отчет за " + last.Format("02.01.2006")
+	if report.Frequency == models.ReportFrequencyWeekly {
+		title = fmt.Sprintf("Отчет за неделю %s – %s", report.PeriodStart.In(loc).Format("02.01.2006"), last.Format("02.01.2006"))
+	}
+
+	builder := s.outbox()
+	if settings.Telegram {
+		builder.telegram(report.UserID, reportText(title, report.Summary))
+	}
+	if settings.Email {
+		builder.email(report.UserID, "", title, mailer.TemplateReport, reportEmail{
+			Title:   title,
+			From:    report.PeriodStart,
+			To:      last,
+			Summary: report.Summary,
+		})
+	}
+	return builder.build()
+}
+
+// Текст отчета для Telegram
+func reportText(title string, summary models.ReportSummary) string {
+	var text strings.Builder
+	text.WriteString(title + "\n\n")
+	fmt.Fprintf(&text, "Запросов кодов: %d", summary.KIZRequests)
+	if summary.FailedRequests > 0 {
+		fmt.Fprintf(&text, " (с ошибкой: %d)", summary.FailedRequests)
+	}
+	fmt.Fprintf(&text, "\nПолучено кодов: %d\n", summary.CodesOrdered)
+	fmt.Fprintf(&text, "Платежей: %d на сумму %.2f RUB\n", summary.Payments, summary.AmountSpent)
+	fmt.Fprintf(&text, "Отправлено документов: %d", summary.DocumentsSubmitted)
+	if summary.DocumentsRejected > 0 {
+		fmt.Fprintf(&text, " (отклонено: %d)", summary.DocumentsRejected)
+	}
+	return text.String()
+}
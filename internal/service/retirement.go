@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/transport"
+)
+
+// Причины вывода из оборота в формате API Честного ЗНАКа
+var retirementActions = map[string]string{
+	models.RetirementReasonRetail:   chestnyznak.RetirementActionRetail,
+	models.RetirementReasonExport:   chestnyznak.RetirementActionExport,
+	models.RetirementReasonWriteOff: chestnyznak.RetirementActionDamage,
+}
+
+// RetirementRequest - запрос на вывод кодов маркировки из оборота. Коды выбираются
+// из результатов запросов КИЗ: все коды указанных запросов и отдельно перечисленные коды.
+type RetirementRequest struct {
+	TelegramID            int64    `json:"telegram_id"`
+	Reason                string   `json:"reason" validate:"required,oneof=retail export write_off"`
+	ActionDate            string   `json:"action_date" validate:"required,date"`            // ГГГГ-ММ-ДД
+	PrimaryDocumentNumber string   `json:"primary_document_number,omitempty"`               // Номер чека, декларации или акта
+	PrimaryDocumentDate   string   `json:"primary_document_date,omitempty" validate:"date"` // ГГГГ-ММ-ДД
+	RequestIDs            []int    `json:"request_ids,omitempty" validate:"required_without=codes,dive,required,min=1"`
+	Codes                 []string `json:"codes,omitempty" validate:"required_without=request_ids,dive,required"`
+}
+
+// CreateRetirementDocument формирует документ вывода из оборота из полученных кодов
+// и отправляет его в Честный ЗНАК
+func (s *Service) CreateRetirementDocument(ctx context.Context, actor Actor, request RetirementRequest) (*models.RetirementDocument, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := models.RetirementDocument{
+		UserID:                userID,
+		Reason:                request.Reason,
+		PrimaryDocumentNumber: strings.TrimSpace(request.PrimaryDocumentNumber),
+		Status:                models.DocumentStatusDraft,
+	}
+
+	// Формат дат проверен ValidateRequest
+	doc.ActionDate, _ = time.Parse(documentDateLayout, request.ActionDate)
+	if request.PrimaryDocumentDate != "" {
+		primaryDocumentDate, _ := time.Parse(documentDateLayout, request.PrimaryDocumentDate)
+		doc.PrimaryDocumentDate = &primaryDocumentDate
+	}
+
+	if err := s.collectRetirementCodes(ctx, &doc, request); err != nil {
+		return nil, err
+	}
+
+	if err := doc.Validate(); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	retired, err := s.repo.CreateRetirementDocument(ctx, &doc)
+	if errors.Is(err, repository.ErrCodesRetired) {
+		return nil, NewError(KindConflict, "Коды уже включены в другой документ вывода из оборота",
+			fmt.Errorf("коды: %s", strings.Join(retired, ", ")))
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка создания документа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "retirement_document", doc.ID, nil, doc)
+
+	if err := s.submitRetirementDocument(ctx, actor, &doc); err != nil {
+		return nil, NewError(KindInternal, fmt.Sprintf("Документ №%d сохранен, но не отправлен в Честный ЗНАК", doc.ID), err)
+	}
+
+	return &doc, nil
+}
+
+// Выбор кодов документа из результатов запросов КИЗ, доступных пользователю. Все коды
+// должны быть выпущены для одного участника оборота и относиться к одной товарной группе.
+func (s *Service) collectRetirementCodes(ctx context.Context, doc *models.RetirementDocument, request RetirementRequest) error {
+	refs, err := s.repo.AccessibleKIZCodes(ctx, doc.UserID, request.RequestIDs, request.Codes)
+	if err != nil {
+		return NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения кодов: %w", err))
+	}
+
+	found := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		if found[ref.Code] {
+			continue
+		}
+		found[ref.Code] = true
+
+		if doc.ParticipantINN == "" {
+			doc.ParticipantINN = ref.INN
+			doc.OrganizationID = ref.OrganizationID
+			doc.ProductGroup = ref.ProductGroup
+		} else if ref.INN != doc.ParticipantINN {
+			return NewError(KindInvalid, "Коды выпущены для разных участников оборота", nil)
+		} else if ref.ProductGroup != doc.ProductGroup {
+			return NewError(KindInvalid, "Коды относятся к разным товарным группам", nil)
+		}
+		doc.Codes = append(doc.Codes, ref.Code)
+	}
+
+	for _, code := range request.Codes {
+		if !found[code] {
+			return NewError(KindNotFound, "Код маркировки не найден среди полученных кодов", fmt.Errorf("код %s", code))
+		}
+	}
+	if len(doc.Codes) == 0 {
+		return NewError(KindNotFound, "По указанным запросам не получены коды маркировки", nil)
+	}
+
+	return nil
+}
+
+// ListRetirementDocuments возвращает документы вывода из оборота, доступные пользователю
+func (s *Service) ListRetirementDocuments(ctx context.Context, userID, limit int) ([]models.RetirementDocument, error) {
+	docs, err := s.repo.ListRetirementDocuments(ctx, userID, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса документов: %w", err))
+	}
+	return docs, nil
+}
+
+// GetRetirementDocument возвращает документ вывода из оборота. Для отправленного документа
+// предварительно запрашивается результат его обработки в Честном ЗНАКе.
+func (s *Service) GetRetirementDocument(ctx context.Context, userID, documentID int) (*models.RetirementDocument, error) {
+	doc, err := s.retirementDocument(ctx, userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.Status == models.DocumentStatusSubmitted && doc.ExternalID != "" {
+		if err := s.refreshRetirementStatus(ctx, doc); err != nil {
+			s.logger.Printf("Ошибка получения статуса документа вывода из оборота %d: %v", doc.ID, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// RetirementDocumentOrganizationID возвращает организацию документа; 0, если документ личный или не найден
+func (s *Service) RetirementDocumentOrganizationID(ctx context.Context, documentID int) (int, error) {
+	return s.repo.RetirementDocumentOrganizationID(ctx, documentID)
+}
+
+// SubmitRetirementDocument повторно отправляет документ, который не удалось отправить при создании
+func (s *Service) SubmitRetirementDocument(ctx context.Context, actor Actor, userID, documentID int) (*models.RetirementDocument, error) {
+	doc, err := s.retirementDocument(ctx, userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.submitRetirementDocument(ctx, actor, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Получение документа, доступного пользователю
+func (s *Service) retirementDocument(ctx context.Context, userID, documentID int) (*models.RetirementDocument, error) {
+	doc, err := s.repo.RetirementDocument(ctx, documentID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Документ не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения документа: %w", err))
+	}
+	return doc, nil
+}
+
+// Подписание и отправка черновика в Честный ЗНАК. Если ЭЦП не настроена,
+// документ считается принятым без отправки.
+func (s *Service) submitRetirementDocument(ctx context.Context, actor Actor, doc *models.RetirementDocument) error {
+	if err := s.repo.BeginRetirementSubmission(ctx, doc.ID); errors.Is(err, repository.ErrDocumentNotDraft) {
+		return NewError(KindConflict, "Документ уже отправлен", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка отправки документа", err)
+	}
+
+	externalID := fmt.Sprintf("TEST-RETIREMENT-%d", doc.ID)
+	if s.chestnyZnak.Enabled() {
+		var err error
+		submitCtx := transport.WithSubject(ctx, "retirement_document", doc.ID)
+		if externalID, err = s.chestnyZnak.SubmitDocument(submitCtx, doc.ProductGroup, buildRetirementDocument(doc)); err != nil {
+			if err := s.repo.CancelRetirementSubmission(context.WithoutCancel(ctx), doc.ID); err != nil {
+				s.logger.Printf("Ошибка возврата документа вывода из оборота %d в черновики: %v", doc.ID, err)
+			}
+			go s.notifyFailure(doc.UserID, "Вывод из оборота", fmt.Sprintf("не удалось отправить документ №%d в Честный ЗНАК", doc.ID))
+			return chestnyZnakError("Ошибка отправки документа в Честный ЗНАК", err)
+		}
+	}
+
+	// Документ уже принят Честным ЗНАКом, поэтому сохранение не зависит от отмены запроса
+	ctx = context.WithoutCancel(ctx)
+	if err := s.repo.SetRetirementExternalID(ctx, doc.ID, externalID); err != nil {
+		return NewError(KindInternal, "Ошибка сохранения документа", fmt.Errorf("документ %d отправлен как %s: %w", doc.ID, externalID, err))
+	}
+
+	now := time.Now()
+	doc.Status = models.DocumentStatusSubmitted
+	doc.ExternalID = externalID
+	doc.SubmittedAt = &now
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "retirement_document", doc.ID,
+		map[string]string{"status": models.DocumentStatusDraft},
+		map[string]string{"status": doc.Status, "external_id": externalID})
+
+	if !s.chestnyZnak.Enabled() {
+		if err := s.setRetirementResult(ctx, doc, repository.DocumentResult{Status: models.DocumentStatusAccepted}); err != nil {
+			s.logger.Printf("Ошибка обновления статуса документа вывода из оборота %d: %v", doc.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// Формирование документа вывода из оборота в формате API Честного ЗНАКа
+func buildRetirementDocument(doc *models.RetirementDocument) chestnyznak.RetirementDocument {
+	document := chestnyznak.RetirementDocument{
+		DocumentType:          chestnyznak.DocumentTypeRetirement,
+		ParticipantINN:        doc.ParticipantINN,
+		ProductGroup:          doc.ProductGroup,
+		Action:                retirementActions[doc.Reason],
+		ActionDate:            doc.ActionDate.Format(documentDateLayout),
+		PrimaryDocumentNumber: doc.PrimaryDocumentNumber,
+		Codes:                 doc.Codes,
+	}
+	if doc.PrimaryDocumentDate != nil {
+		document.PrimaryDocumentDate = doc.PrimaryDocumentDate.Format(documentDateLayout)
+	}
+	return document
+}
+
+// Запрос результата обработки документа вывода из оборота
+func (s *Service) refreshRetirementStatus(ctx context.Context, doc *models.RetirementDocument) error {
+	if !s.chestnyZnak.Enabled() {
+		return nil
+	}
+
+	state, err := s.chestnyZnak.DocumentStatus(transport.WithSubject(ctx, "retirement_document", doc.ID), doc.ProductGroup, doc.ExternalID)
+	if err != nil {
+		return err
+	}
+
+	if result, ok := documentResult(state); ok {
+		result.Receipt = s.resultReceipt(ctx, documentTypeRetirement, doc.ID, doc.ProductGroup, doc.ExternalID, result.Ticket)
+		return s.setRetirementResult(ctx, doc, result)
+	}
+	return nil
+}
+
+// Сохранение результата обработки документа вывода из оборота с записью в журнал аудита
+// и уведомлением автора
+func (s *Service) setRetirementResult(ctx context.Context, doc *models.RetirementDocument, result repository.DocumentResult) error {
+	messages, err := s.documentResultMessages(documentEvent{
+		DocumentType: documentTypeRetirement,
+		DocumentID:   doc.ID,
+		ExternalID:   doc.ExternalID,
+		Status:       result.Status,
+		Error:        result.Error,
+		Ticket:       result.Ticket,
+	}.withReceipt(result.Receipt), doc.UserID)
+	if err != nil {
+		return err
+	}
+	updated, err := s.repo.UpdateRetirementStatus(ctx, doc.ID, result, messages)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения статуса документа: %w", err)
+	}
+
+	before := doc.Status
+	now := time.Now()
+	doc.Status = result.Status
+	doc.Error = result.Error
+	doc.Ticket = result.Ticket
+	doc.ProcessedAt = &now
+	if !updated {
+		// Результат уже сохранен параллельной проверкой
+		return nil
+	}
+
+	s.recordAudit(ctx, Actor{}, AuditActionUpdate, "retirement_document", doc.ID,
+		map[string]string{"status": before},
+		map[string]string{"status": result.Status, "error": result.Error, "ticket": result.Ticket})
+
+	return nil
+}
@@ -0,0 +1,407 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"project-znak/internal/cache"
+	"project-znak/internal/catalog"
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/config"
+	"project-znak/internal/dadata"
+	"project-znak/internal/edo"
+	"project-znak/internal/fiscal"
+	"project-znak/internal/labels"
+	"project-znak/internal/mailer"
+	"project-znak/internal/models"
+	"project-znak/internal/oms"
+	"project-znak/internal/ozon"
+	"project-znak/internal/repository"
+	"project-znak/internal/robokassa"
+	"project-znak/internal/stripe"
+	"project-znak/internal/telegram"
+	"project-znak/internal/validate"
+	"project-znak/internal/webhook"
+	"project-znak/internal/wildberries"
+)
+
+// Бизнес-логика сервиса, общая для REST и gRPC API
+
+// Время хранения данных в кэше
+const (
+	apiKeyCacheTTL     = 5 * time.Minute
+	catalogCacheTTL    = 24 * time.Hour
+	codeStatusCacheTTL = 5 * time.Minute
+	analyticsCacheTTL  = time.Minute
+	lastActiveInterval = time.Minute
+)
+
+// Действия, фиксируемые в журнале аудита
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+	AuditActionMerge  = "merge"
+	// Запрос к API, выполненный администратором от имени пользователя
+	AuditActionImpersonate = "impersonate"
+)
+
+// Options - внешние клиенты и настройки сервиса. Незаданные клиенты считаются отключенными.
+type Options struct {
+	Cache       *cache.Cache
+	Catalog     *catalog.Client
+	DaData      *dadata.Client
+	Mailer      *mailer.Client
+	ChestnyZnak *chestnyznak.Client
+	OMS         *oms.Client
+	Robokassa   *robokassa.Client
+	Stripe      *stripe.Client
+	Telegram    *telegram.Client
+	Webhook     *webhook.Client
+	Wildberries *wildberries.Client
+	Ozon        *ozon.Client
+	Payment     config.PaymentConfig
+	Downloads   config.DownloadConfig
+	Invoice     config.InvoiceConfig
+	Referral    config.ReferralConfig
+	Erasure     config.ErasureConfig
+	TempDir     string
+
+	// Подтверждение операций кодом из Telegram
+	Confirmation config.ConfirmationConfig
+
+	// Защита от подбора API ключей и массовой регистрации
+	AuthGuard config.AuthGuardConfig
+
+	// Наибольшее время ожидания кодов при эмиссии через СУЗ
+	OMSEmitTimeout time.Duration
+
+	// Ограничения размера заказа кодов; большие запросы разбиваются на несколько заказов
+	KIZOrders config.KIZOrderConfig
+
+	// Порог остатка кодов GTIN для предупреждения в Telegram; 0 - не предупреждать
+	InventoryLowStock int
+
+	// Тарифный план пользователей без назначенного плана; пусто - без квот
+	DefaultPlan string
+
+	// Часовой пояс для отображения времени пользователям, не выбравшим свой; nil - UTC
+	DefaultTimezone *time.Location
+
+	// Аналитика читает дневные сводки из материализованных представлений,
+	// которые обновляет RunAnalyticsRefresh
+	AnalyticsMaterialized bool
+
+	// Параметры печати этикеток ZPL/EPL по умолчанию
+	Printer labels.Printer
+
+	// Онлайн-касса для регистрации чеков по 54-ФЗ и число попыток регистрации чека
+	Fiscal            fiscal.Provider
+	FiscalMaxAttempts int
+
+	// Оператор ЭДО для отправки УПД покупателям
+	EDO edo.Provider
+
+	// Число попыток доставки уведомления из outbox
+	OutboxMaxAttempts int
+
+	// Telegram-чат администраторов для служебных предупреждений; 0 - не отправлять
+	AdminChatID int64
+
+	// Идентификатор экземпляра сервиса и срок аренды ведущего экземпляра, выполняющего
+	// фоновые задачи; 0 - экземпляр всегда ведущий
+	InstanceID string
+	LeaderTTL  time.Duration
+}
+
+// Service реализует операции с пользователями, организациями, заказами, платежами и КИЗ
+type Service struct {
+	repo        *repository.Repository
+	logger      *log.Logger
+	cache       *cache.Cache
+	catalog     *catalog.Client
+	dadata      *dadata.Client
+	mailer      *mailer.Client
+	chestnyZnak *chestnyznak.Client
+	oms         *oms.Client
+	robokassa   *robokassa.Client
+	stripe      *stripe.Client
+	telegram    *telegram.Client
+	webhook     *webhook.Client
+	wildberries *wildberries.Client
+	ozon        *ozon.Client
+	payment     config.PaymentConfig
+	paymentMu   sync.RWMutex // Защищает пароли Robokassa, заменяемые при ротации секретов
+	downloads   config.DownloadConfig
+	invoice     config.InvoiceConfig
+	referral    config.ReferralConfig
+	erasure     config.ErasureConfig
+	tempDir     string
+
+	confirmation config.ConfirmationConfig
+	authGuard    config.AuthGuardConfig
+
+	omsEmitTimeout    time.Duration
+	kizOrders         config.KIZOrderConfig
+	inventoryLowStock int
+	defaultPlan       string
+	defaultTimezone   *time.Location
+	printer           labels.Printer
+	fiscal            fiscal.Provider
+	fiscalMaxAttempts int
+	edo               edo.Provider
+	outboxMaxAttempts int
+	adminChatID       int64
+
+	kizEvents kizEvents // Изменения запросов КИЗ для ожидающих клиентов
+
+	instanceID  string
+	leaderTTL   time.Duration
+	leaderUntil atomic.Int64 // Время окончания аренды ведущего экземпляра, Unix time в наносекундах
+
+	analyticsMaterialized bool
+}
+
+// New создает сервис поверх репозитория
+func New(repo *repository.Repository, logger *log.Logger, opts Options) *Service {
+	if opts.TempDir == "" {
+		opts.TempDir = "./temp"
+	}
+	if opts.DefaultTimezone == nil {
+		opts.DefaultTimezone = time.UTC
+	}
+	return &Service{
+		repo:        repo,
+		logger:      logger,
+		cache:       opts.Cache,
+		catalog:     opts.Catalog,
+		dadata:      opts.DaData,
+		mailer:      opts.Mailer,
+		chestnyZnak: opts.ChestnyZnak,
+		oms:         opts.OMS,
+		robokassa:   opts.Robokassa,
+		stripe:      opts.Stripe,
+		telegram:    opts.Telegram,
+		webhook:     opts.Webhook,
+		wildberries: opts.Wildberries,
+		ozon:        opts.Ozon,
+		payment:     opts.Payment,
+		downloads:   opts.Downloads,
+		invoice:     opts.Invoice,
+		referral:    opts.Referral,
+		erasure:     opts.Erasure,
+		tempDir:     opts.TempDir,
+
+		confirmation: opts.Confirmation,
+		authGuard:    opts.AuthGuard,
+
+		omsEmitTimeout:    opts.OMSEmitTimeout,
+		kizOrders:         opts.KIZOrders,
+		inventoryLowStock: opts.InventoryLowStock,
+		defaultPlan:       opts.DefaultPlan,
+		defaultTimezone:   opts.DefaultTimezone,
+		printer:           opts.Printer,
+		fiscal:            opts.Fiscal,
+		fiscalMaxAttempts: opts.FiscalMaxAttempts,
+		edo:               opts.EDO,
+		outboxMaxAttempts: opts.OutboxMaxAttempts,
+		adminChatID:       opts.AdminChatID,
+
+		instanceID: opts.InstanceID,
+		leaderTTL:  opts.LeaderTTL,
+
+		analyticsMaterialized: opts.AnalyticsMaterialized,
+	}
+}
+
+// Kind - категория ошибки сервиса, по которой транспорт выбирает код ответа
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindNotFound
+	KindForbidden
+	KindConflict
+	KindUnavailable
+	KindConfirmationRequired // Операция выполнится после подтверждения кодом из Telegram
+	KindTooManyRequests      // Адрес клиента временно заблокирован или исчерпана суточная квота запросов
+	KindPaymentRequired      // Исчерпана квота тарифного плана, нужен другой план
+)
+
+// Коды ошибок, по которым клиент может отличить причину ошибки без разбора сообщения
+const (
+	ErrorCodeCertificateExpired   = "certificate_expired"   // Срок действия сертификата ЭЦП истек
+	ErrorCodeConfirmationRequired = "confirmation_required" // Операцию нужно подтвердить кодом из Telegram
+	ErrorCodeConfirmationInvalid  = "confirmation_invalid"  // Подтверждение не найдено, истекло или код неверен
+	ErrorCodeVersionConflict      = "version_conflict"      // Запись изменена другим запросом после чтения
+	ErrorCodeQuotaExceeded        = "quota_exceeded"        // Исчерпана квота тарифного плана
+	ErrorCodeTooManyAttempts      = "too_many_attempts"     // Адрес клиента заблокирован после неудачных попыток
+)
+
+// Через сколько клиенту предлагается повторить запрос после конфликта версий
+const versionConflictRetryAfter = time.Second
+
+// Error - ошибка сервиса: сообщение для клиента, категория и, при наличии, исходная ошибка
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+	Code    string          // Код ошибки для клиента; пусто, если причина определяется категорией
+	Fields  validate.Errors // Ошибки отдельных полей запроса
+
+	Confirmation *models.Confirmation // Созданное подтверждение для KindConfirmationRequired
+	RetryAfter   time.Duration        // Через сколько можно повторить запрос для KindTooManyRequests и конфликта версий
+	Quota        *models.Quota        // Исчерпанная квота тарифного плана
+}
+
+// NewError создает ошибку сервиса
+func NewError(kind Kind, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Detail возвращает описание исходной ошибки для клиента; для внутренних ошибок - пустую строку
+func (e *Error) Detail() string {
+	if e.Err != nil && e.Kind != KindInternal {
+		return e.Err.Error()
+	}
+	return ""
+}
+
+// Ошибка конфликта версий: запись изменена другим запросом между чтением и обновлением.
+// Клиенту нужно получить актуальные данные и повторить запрос.
+func versionConflict(message string) error {
+	return &Error{
+		Kind:       KindConflict,
+		Message:    message + ": получите актуальные данные и повторите запрос",
+		Code:       ErrorCodeVersionConflict,
+		Err:        repository.ErrConflict,
+		RetryAfter: versionConflictRetryAfter,
+	}
+}
+
+// AsError приводит ошибку к ошибке сервиса; неизвестные ошибки считаются внутренними
+func AsError(err error) *Error {
+	var serviceErr *Error
+	if errors.As(err, &serviceErr) {
+		return serviceErr
+	}
+	return NewError(KindInternal, "Ошибка при обработке запроса", err)
+}
+
+// Тип для ключей контекста, чтобы избежать коллизий
+type contextKey string
+
+const (
+	userIDKey   contextKey = "userID"
+	apiKeyIDKey contextKey = "apiKeyID"
+)
+
+// WithUserID сохраняет в контексте ID пользователя, авторизованного по API ключу
+func WithUserID(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext возвращает ID пользователя, авторизованного по API ключу, или 0
+func UserIDFromContext(ctx context.Context) int {
+	userID, _ := ctx.Value(userIDKey).(int)
+	return userID
+}
+
+// WithAPIKeyID сохраняет в контексте ID API ключа, по которому авторизован запрос
+func WithAPIKeyID(ctx context.Context, keyID int) context.Context {
+	return context.WithValue(ctx, apiKeyIDKey, keyID)
+}
+
+// APIKeyIDFromContext возвращает ID API ключа, по которому авторизован запрос, или 0
+func APIKeyIDFromContext(ctx context.Context) int {
+	keyID, _ := ctx.Value(apiKeyIDKey).(int)
+	return keyID
+}
+
+// Actor - инициатор изменения для журнала аудита. UserID заполняется
+// при авторизации по API ключу, иначе используется переданный telegram_id.
+type Actor struct {
+	UserID     int
+	TelegramID int64
+	IP         string
+}
+
+// Определение пользователя, выполняющего операцию: по API ключу или по telegram_id
+func (s *Service) actorUserID(ctx context.Context, actor Actor) (int, error) {
+	if actor.UserID > 0 {
+		return actor.UserID, nil
+	}
+	userID, err := s.repo.UserIDByTelegram(ctx, actor.TelegramID)
+	if err != nil {
+		return 0, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка получения пользователя: %w", err))
+	}
+	if userID == 0 {
+		return 0, NewError(KindNotFound, "Пользователь не найден", nil)
+	}
+	return userID, nil
+}
+
+// UserIDByTelegram возвращает ID пользователя по telegram_id или 0, если пользователь не найден
+func (s *Service) UserIDByTelegram(ctx context.Context, telegramID int64) (int, error) {
+	userID, err := s.repo.UserIDByTelegram(ctx, telegramID)
+	if err != nil {
+		return 0, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка получения пользователя: %w", err))
+	}
+	return userID, nil
+}
+
+// Запись изменения в журнал аудита.
+// Ошибка записи журнала не прерывает основную операцию. Запись выполняется
+// и после отмены запроса: изменение к этому моменту уже сохранено.
+func (s *Service) recordAudit(ctx context.Context, actor Actor, action, entityType string, entityID any, before, after any) {
+	entry := repository.AuditEntry{
+		ActorUserID: actor.UserID,
+		TelegramID:  actor.TelegramID,
+		Action:      action,
+		EntityType:  entityType,
+		EntityID:    fmt.Sprint(entityID),
+		IP:          actor.IP,
+	}
+	// Операции в сеансе имперсонации выполняются от имени пользователя, но фиксируется
+	// и администратор
+	if impersonation := ImpersonationFromContext(ctx); impersonation != nil {
+		entry.ImpersonatorID = impersonation.AdminUserID
+	}
+
+	var err error
+	if entry.Before, err = marshalAuditValue(before); err == nil {
+		if entry.After, err = marshalAuditValue(after); err == nil {
+			err = s.repo.InsertAudit(context.WithoutCancel(ctx), entry)
+		}
+	}
+
+	if err != nil {
+		s.logger.Printf("Ошибка записи в журнал аудита (%s %s %v): %v", action, entityType, entityID, err)
+	}
+}
+
+// Сериализация значения для журнала аудита; nil сохраняется как NULL
+func marshalAuditValue(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
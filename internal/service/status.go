@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"project-znak/internal/models"
+)
+
+// Компоненты страницы статуса; платежные провайдеры называются по имени провайдера
+const (
+	StatusComponentChestnyZnak   = "chestnyznak_api" // API Честного ЗНАКа
+	StatusComponentOMS           = "oms"             // Станция управления заказами (СУЗ)
+	StatusComponentKIZQueue      = "kiz_queue"       // Запросы КИЗ, ожидающие получения кодов
+	StatusComponentNotifications = "notifications"   // Уведомления в outbox
+)
+
+// Компоненты, без которых невозможен заказ кодов маркировки: их недоступность
+// означает недоступность сервиса
+var criticalStatusComponents = map[string]bool{
+	StatusComponentChestnyZnak: true,
+	StatusComponentOMS:         true,
+	StatusComponentKIZQueue:    true,
+}
+
+// Пороги ожидания в очередях: запрос КИЗ без кодов и просроченная доставка уведомления
+const (
+	kizBacklogDegraded          = 15 * time.Minute
+	kizBacklogError             = time.Hour
+	notificationBacklogDegraded = 5 * time.Minute
+	notificationBacklogError    = 30 * time.Minute
+)
+
+// Инциденты на странице статуса: за последнюю неделю, не более statusIncidentLimit
+const (
+	statusIncidentHistory = 7 * 24 * time.Hour
+	statusIncidentLimit   = 50
+)
+
+// ServiceStatus - состояние сервиса для публичной страницы статуса
+type ServiceStatus struct {
+	Status     string                   `json:"status"` // ok, degraded или error
+	Components []models.ComponentStatus `json:"components"`
+	Incidents  []models.StatusIncident  `json:"incidents"` // Текущие и недавние инциденты, новые первыми
+}
+
+// Проверка компонента для страницы статуса
+type statusProbe struct {
+	component string
+	message   string // Описание инцидента для пользователей
+	check     func(ctx context.Context, now time.Time) (status string, backlog int, detail string)
+}
+
+// Проверки компонентов страницы статуса
+func (s *Service) statusProbes() []statusProbe {
+	probes := []statusProbe{
+		{StatusComponentChestnyZnak, "API Честного ЗНАКа недоступен: заказ кодов и отправка документов задерживаются",
+			func(ctx context.Context, _ time.Time) (string, int, string) {
+				if !s.chestnyZnak.Enabled() {
+					return models.ComponentStatusDisabled, 0, ""
+				}
+				status, detail := probeResult(s.chestnyZnak.Ping(ctx))
+				return status, 0, detail
+			}},
+		{StatusComponentOMS, "Станция управления заказами недоступна: коды маркировки не выдаются",
+			func(ctx context.Context, _ time.Time) (string, int, string) {
+				if !s.oms.Enabled() {
+					return models.ComponentStatusDisabled, 0, ""
+				}
+				status, detail := probeResult(s.oms.Ping(ctx))
+				return status, 0, detail
+			}},
+		{StatusComponentKIZQueue, "Коды маркировки выдаются с задержкой",
+			func(ctx context.Context, now time.Time) (string, int, string) {
+				count, oldest, err := s.repo.KIZBacklog(ctx)
+				if err != nil {
+					return models.ComponentStatusError, 0, err.Error()
+				}
+				return backlogStatus(count, oldest, now, kizBacklogDegraded, kizBacklogError)
+			}},
+		{StatusComponentNotifications, "Уведомления доставляются с задержкой",
+			func(ctx context.Context, now time.Time) (string, int, string) {
+				count, overdue, err := s.repo.OutboxBacklog(ctx, now)
+				if err != nil {
+					return models.ComponentStatusError, 0, err.Error()
+				}
+				return backlogStatus(count, overdue, now, notificationBacklogDegraded, notificationBacklogError)
+			}},
+	}
+	for _, provider := range s.PaymentProviders() {
+		probes = append(probes, statusProbe{provider.Name,
+			fmt.Sprintf("Оплата через %s может быть недоступна", paymentProviderTitles[provider.Name]),
+			func(context.Context, time.Time) (string, int, string) {
+				return provider.Status, 0, provider.Message
+			}})
+	}
+	return probes
+}
+
+// Названия платежных провайдеров в описаниях инцидентов
+var paymentProviderTitles = map[string]string{
+	models.PaymentProviderRobokassa: "Robokassa",
+	models.PaymentProviderStripe:    "Stripe",
+}
+
+// Статус очереди по времени ожидания самой старой задачи
+func backlogStatus(count int, oldest *time.Time, now time.Time, degraded, failed time.Duration) (string, int, string) {
+	if oldest == nil {
+		return models.ComponentStatusOK, count, ""
+	}
+	wait := now.Sub(*oldest)
+	detail := fmt.Sprintf("в очереди %d, ожидание %s", count, wait.Round(time.Second))
+	switch {
+	case wait >= failed:
+		return models.ComponentStatusError, count, detail
+	case wait >= degraded:
+		return models.ComponentStatusDegraded, count, detail
+	}
+	return models.ComponentStatusOK, count, ""
+}
+
+// RefreshStatus проверяет компоненты сервиса и сохраняет результат для страницы статуса.
+// Открытие и закрытие инцидента записывается в журнал и отправляется в Telegram-чат
+// администраторов с подробностями ошибки.
+func (s *Service) RefreshStatus(ctx context.Context) {
+	probes := s.statusProbes()
+	now := time.Now()
+
+	type result struct {
+		status  string
+		backlog int
+		detail  string
+	}
+	results := make([]result, len(probes))
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		go func(i int, probe statusProbe) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			status, backlog, detail := probe.check(ctx, now)
+			results[i] = result{status, backlog, detail}
+		}(i, probe)
+	}
+	wg.Wait()
+
+	for i, probe := range probes {
+		incident, err := s.repo.RecordComponentStatus(ctx, models.ComponentStatus{
+			Component: probe.component,
+			Status:    results[i].status,
+			Backlog:   results[i].backlog,
+			CheckedAt: now,
+		}, probe.message)
+		if err != nil {
+			s.logger.Printf("Ошибка сохранения состояния компонента %s: %v", probe.component, err)
+			continue
+		}
+		if incident == nil {
+			continue
+		}
+
+		var text string
+		if incident.ResolvedAt == nil {
+			text = fmt.Sprintf("Инцидент №%d: %s - %s (%s)", incident.ID, probe.component, incident.Status, results[i].detail)
+		} else {
+			text = fmt.Sprintf("Инцидент №%d завершен: %s работает, длительность %s",
+				incident.ID, probe.component, incident.ResolvedAt.Sub(incident.StartedAt).Round(time.Second))
+		}
+		s.logger.Printf("%s", text)
+		if s.telegram.Enabled() && s.adminChatID != 0 {
+			if err := s.telegram.SendMessage(ctx, s.adminChatID, text); err != nil {
+				s.logger.Printf("Ошибка отправки уведомления об инциденте в чат администраторов: %v", err)
+			}
+		}
+	}
+}
+
+// RunStatusMonitor обновляет состояние компонентов для страницы статуса с указанным
+// интервалом до отмены контекста. Проверки выполняет ведущий экземпляр, остальные
+// экземпляры отдают сохраненный им результат.
+func (s *Service) RunStatusMonitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			s.RefreshStatus(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublicStatus возвращает состояние компонентов по последней проверке и инциденты за
+// последнюю неделю. Сервис недоступен (error), если недоступен компонент, необходимый для
+// заказа кодов; работает с ограничениями (degraded) при проблемах с любым другим компонентом.
+func (s *Service) PublicStatus(ctx context.Context) (*ServiceStatus, error) {
+	components, err := s.repo.StatusComponents(ctx)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса состояния компонентов: %w", err))
+	}
+	incidents, err := s.repo.StatusIncidents(ctx, time.Now().Add(-statusIncidentHistory), statusIncidentLimit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса инцидентов: %w", err))
+	}
+
+	status := &ServiceStatus{Status: models.ComponentStatusOK, Components: components, Incidents: incidents}
+	for _, component := range components {
+		switch {
+		case component.Status == models.ComponentStatusError && criticalStatusComponents[component.Component]:
+			status.Status = models.ComponentStatusError
+		case component.Status == models.ComponentStatusError || component.Status == models.ComponentStatusDegraded:
+			if status.Status == models.ComponentStatusOK {
+				status.Status = models.ComponentStatusDegraded
+			}
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/stripe"
+)
+
+// HandleStripeEvent проверяет подпись уведомления Stripe и применяет его к платежу:
+// оплаченная сессия проводит платеж, истекшая или неоплаченная отменяет его, полный
+// возврат списания отмечает платеж возвращенным. Остальные события пропускаются.
+func (s *Service) HandleStripeEvent(ctx context.Context, actor Actor, payload []byte, signature string) error {
+	if !s.stripe.Enabled() {
+		return NewError(KindNotFound, "Прием платежей Stripe не настроен", nil)
+	}
+
+	event, err := s.stripe.VerifyEvent(payload, signature, time.Now())
+	if errors.Is(err, stripe.ErrInvalidSignature) {
+		return NewError(KindForbidden, "Неверная подпись", nil)
+	} else if err != nil {
+		return NewError(KindInvalid, "Неверные параметры", err)
+	}
+
+	switch event.Type {
+	case stripe.EventCheckoutCompleted, stripe.EventCheckoutAsyncSucceeded:
+		session, err := event.Session()
+		if err != nil {
+			return NewError(KindInvalid, "Неверные параметры", err)
+		}
+		// При отложенной оплате (банковский перевод) деньги поступают позже
+		if session.PaymentStatus != stripe.PaymentStatusPaid {
+			return nil
+		}
+		return s.completeStripePayment(ctx, actor, session)
+
+	case stripe.EventCheckoutExpired, stripe.EventCheckoutAsyncFailed:
+		session, err := event.Session()
+		if err != nil {
+			return NewError(KindInvalid, "Неверные параметры", err)
+		}
+		paymentID, err := strconv.Atoi(session.ClientReferenceID)
+		if err != nil {
+			return NewError(KindInvalid, "Неверный ID платежа", err)
+		}
+		if err := s.expirePayment(ctx, paymentID, 0); err != nil {
+			return NewError(KindInternal, "Ошибка обновления платежа", err)
+		}
+
+	case stripe.EventChargeRefunded:
+		charge, err := event.Charge()
+		if err != nil {
+			return NewError(KindInvalid, "Неверные параметры", err)
+		}
+		if !charge.Refunded {
+			return nil
+		}
+		paymentID, err := s.repo.PaymentIDByTransaction(ctx, models.PaymentProviderStripe, charge.PaymentIntent)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return NewError(KindInternal, "Ошибка обновления платежа", err)
+		}
+		return s.markPaymentRefunded(ctx, actor, paymentID)
+	}
+	return nil
+}
+
+// Проведение платежа по оплаченной сессии Stripe. Если сумма или валюта сессии не совпадают
+// с платежом или оплата пришла по уже отмененному платежу, платеж отмечается для проверки
+// администратором. После проведения сохраняется сумма в валюте расчетов.
+func (s *Service) completeStripePayment(ctx context.Context, actor Actor, session *stripe.Session) error {
+	paymentID, err := strconv.Atoi(session.ClientReferenceID)
+	if err != nil {
+		return NewError(KindInvalid, "Неверный ID платежа", err)
+	}
+	payment, err := s.repo.Payment(ctx, paymentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Платеж не найден", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка обновления платежа", err)
+	}
+	if payment.Provider != models.PaymentProviderStripe {
+		return NewError(KindInvalid, "Платеж не принимается через Stripe", nil)
+	}
+
+	switch {
+	case payment.Status == models.PaymentStatusCompleted:
+		return nil
+	case payment.Status != models.PaymentStatusPending:
+		return s.flagPayment(ctx, actor, paymentID,
+			fmt.Sprintf("Оплата Stripe %s поступила по платежу в статусе %s", session.PaymentIntent, payment.Status))
+	case !session.Amount.Equal(payment.Amount):
+		return s.flagPayment(ctx, actor, paymentID,
+			fmt.Sprintf("Сумма оплаты в Stripe %s %s не совпадает с суммой платежа %s %s",
+				session.Amount, session.Amount.Code(), payment.Amount, payment.Amount.Code()))
+	}
+
+	if err := s.completePayment(ctx, actor, paymentID, payment.Version, session.PaymentIntent, session.Amount.String()); err != nil {
+		return err
+	}
+	s.recordSettlement(context.WithoutCancel(ctx), paymentID, session.PaymentIntent)
+	return nil
+}
+
+// Сохранение суммы платежа в валюте расчетов аккаунта Stripe. Ошибка не отменяет
+// проведения платежа и только записывается в журнал.
+func (s *Service) recordSettlement(ctx context.Context, paymentID int, paymentIntentID string) {
+	settlement, err := s.stripe.Settlement(ctx, paymentIntentID)
+	if err != nil {
+		s.logger.Printf("Ошибка получения суммы расчетов по платежу %d: %v", paymentID, err)
+		return
+	}
+	if err := s.repo.SetPaymentSettlement(ctx, paymentID, settlement.Amount); err != nil {
+		s.logger.Printf("Ошибка сохранения суммы расчетов по платежу %d: %v", paymentID, err)
+	}
+}
+
+// RefundPayment возвращает покупателю проведенный платеж Stripe и отмечает его возвращенным
+func (s *Service) RefundPayment(ctx context.Context, actor Actor, paymentID int) (*models.Payment, error) {
+	payment, err := s.repo.Payment(ctx, paymentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Платеж не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", err)
+	}
+	switch {
+	case payment.Provider != models.PaymentProviderStripe:
+		return nil, NewError(KindConflict, "Возврат поддерживается только для платежей Stripe", nil)
+	case payment.Status != models.PaymentStatusCompleted:
+		return nil, NewError(KindConflict, "Вернуть можно только проведенный платеж", nil)
+	case !s.stripe.Enabled():
+		return nil, NewError(KindUnavailable, "Прием платежей Stripe не настроен", nil)
+	}
+
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireConfirmation(ctx, userID, models.ConfirmationActionRefund, fmt.Sprintf("payment:%d", paymentID),
+		fmt.Sprintf("возврат платежа №%d на сумму %s %s", paymentID, payment.Amount, payment.Amount.Code())); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.stripe.Refund(ctx, payment.TransactionID); err != nil {
+		return nil, NewError(KindUnavailable, "Ошибка возврата платежа в Stripe", err)
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	if err := s.markPaymentRefunded(ctx, actor, paymentID); err != nil {
+		return nil, err
+	}
+	payment.Status = models.PaymentStatusRefunded
+	return payment, nil
+}
+
+// Отметка проведенного платежа возвращенным; повторная отметка не меняет данных
+func (s *Service) markPaymentRefunded(ctx context.Context, actor Actor, paymentID int) error {
+	err := s.repo.RefundPayment(ctx, paymentID, time.Now())
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка обновления платежа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "payment", paymentID,
+		map[string]string{"status": models.PaymentStatusCompleted},
+		map[string]string{"status": models.PaymentStatusRefunded})
+	return nil
+}
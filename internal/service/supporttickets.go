@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+const (
+	// Число нерешенных обращений пользователя, после которого новые не принимаются
+	maxOpenSupportTickets = 5
+	// Число обращений в списке
+	supportTicketListLimit = 100
+)
+
+// Названия статусов обращений в уведомлениях пользователя
+var supportTicketStatuses = map[string]string{
+	models.SupportTicketStatusOpen:       "открыто",
+	models.SupportTicketStatusInProgress: "в работе",
+	models.SupportTicketStatusResolved:   "решено",
+}
+
+// SupportTicketRequest - обращение пользователя в поддержку
+type SupportTicketRequest struct {
+	TelegramID  int64  `json:"telegram_id"`
+	RequestID   int    `json:"request_id,omitempty" validate:"min=1"` // Запрос КИЗ, с которым возникла проблема
+	PaymentID   int    `json:"payment_id,omitempty" validate:"min=1"` // Платеж, с которым возникла проблема
+	Description string `json:"description" validate:"required,max=4000"`
+}
+
+// SupportTicketUpdateRequest - изменение статуса обращения поддержкой с ответом пользователю
+type SupportTicketUpdateRequest struct {
+	Status string `json:"status" validate:"required,oneof=open in_progress resolved"`
+	Reply  string `json:"reply,omitempty" validate:"max=4000"`
+}
+
+// CreateSupportTicket сохраняет обращение пользователя и пересылает его в чат администраторов
+// со ссылками на данные запроса и платежа. Запрос КИЗ и платеж должны принадлежать пользователю.
+func (s *Service) CreateSupportTicket(ctx context.Context, actor Actor, request SupportTicketRequest) (*models.SupportTicket, error) {
+	request.Description = strings.TrimSpace(request.Description)
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket := &models.SupportTicket{
+		UserID:      userID,
+		RequestID:   request.RequestID,
+		PaymentID:   request.PaymentID,
+		Description: request.Description,
+	}
+	var kizRequest *repository.KIZRequestRecord
+	if ticket.RequestID > 0 {
+		kizRequest, err = s.repo.KIZRequestSummary(ctx, ticket.RequestID)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && kizRequest.UserID != userID) {
+			return nil, NewError(KindNotFound, "Запрос не найден", nil)
+		} else if err != nil {
+			return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения запроса КИЗ: %w", err))
+		}
+	}
+	var payment *models.Payment
+	if ticket.PaymentID > 0 {
+		payment, err = s.repo.Payment(ctx, ticket.PaymentID)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && payment.UserID != userID) {
+			return nil, NewError(KindNotFound, "Платеж не найден", nil)
+		} else if err != nil {
+			return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения платежа: %w", err))
+		}
+	}
+
+	open, err := s.repo.CountOpenSupportTickets(ctx, userID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка подсчета обращений: %w", err))
+	}
+	if open >= maxOpenSupportTickets {
+		return nil, NewError(KindConflict,
+			fmt.Sprintf("У вас уже есть %d нерешенных обращений: дождитесь ответа поддержки", open), nil)
+	}
+
+	if err := s.repo.CreateSupportTicket(ctx, ticket); err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка сохранения обращения: %w", err))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "support_ticket", ticket.ID, nil, ticket)
+	s.forwardSupportTicket(ctx, ticket, kizRequest, payment)
+	return ticket, nil
+}
+
+// Пересылка обращения в чат администраторов. Обращение уже сохранено и доступно в
+// /api/admin/support/tickets, поэтому ошибка отправки только записывается в журнал.
+func (s *Service) forwardSupportTicket(ctx context.Context, ticket *models.SupportTicket,
+	kizRequest *repository.KIZRequestRecord, payment *models.Payment) {
+	if !s.telegram.Enabled() || s.adminChatID == 0 {
+		return
+	}
+
+	lines := []string{
+		fmt.Sprintf("Обращение в поддержку №%d от пользователя %d", ticket.ID, ticket.UserID),
+		"",
+		ticket.Description,
+		"",
+		"Обращение: " + s.adminLink(fmt.Sprintf("/api/admin/support/tickets/%d", ticket.ID), nil),
+		"Действия пользователя: " + s.adminLink("/api/admin/audit", url.Values{"actor_user_id": {strconv.Itoa(ticket.UserID)}}),
+	}
+	if kizRequest != nil {
+		summary := fmt.Sprintf("Запрос КИЗ №%d: %s", kizRequest.ID, kizRequest.Status)
+		if kizRequest.Error != "" {
+			summary += ", " + kizRequest.Error
+		}
+		lines = append(lines, summary,
+			"Обмен с Честным ЗНАКом и СУЗ: "+s.adminLink("/api/admin/exchanges", url.Values{
+				"subject_type": {"kiz_request"},
+				"subject_id":   {strconv.Itoa(kizRequest.ID)},
+			}))
+	}
+	if payment != nil {
+		lines = append(lines,
+			fmt.Sprintf("Платеж №%d: %s %s, %s", payment.ID, payment.Amount, payment.Amount.Code(), payment.Status),
+			"История платежа: "+s.adminLink("/api/admin/audit", url.Values{
+				"entity_type": {"payment"},
+				"entity_id":   {strconv.Itoa(payment.ID)},
+			}))
+	}
+
+	if err := s.telegram.SendMessage(context.WithoutCancel(ctx), s.adminChatID, strings.Join(lines, "\n")); err != nil {
+		s.logger.Printf("Ошибка пересылки обращения %d в чат администраторов: %v", ticket.ID, err)
+	}
+}
+
+// Ссылка на административный эндпоинт; без адреса сервиса - путь
+func (s *Service) adminLink(path string, query url.Values) string {
+	link := s.downloads.BaseURL + path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
+
+// ListSupportTickets возвращает обращения пользователя, новые первыми
+func (s *Service) ListSupportTickets(ctx context.Context, userID int) ([]models.SupportTicket, error) {
+	tickets, err := s.repo.UserSupportTickets(ctx, userID, supportTicketListLimit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса обращений: %w", err))
+	}
+	return tickets, nil
+}
+
+// GetSupportTicket возвращает обращение пользователя userID; userID = 0 - любого пользователя
+func (s *Service) GetSupportTicket(ctx context.Context, userID, ticketID int) (*models.SupportTicket, error) {
+	ticket, err := s.repo.SupportTicket(ctx, userID, ticketID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Обращение не найдено", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения обращения: %w", err))
+	}
+	return ticket, nil
+}
+
+// ListAllSupportTickets возвращает обращения всех пользователей с указанным статусом для поддержки
+func (s *Service) ListAllSupportTickets(ctx context.Context, status string) ([]models.SupportTicket, error) {
+	if status != "" && supportTicketStatuses[status] == "" {
+		return nil, NewError(KindInvalid, "Неизвестный статус обращения", nil)
+	}
+	tickets, err := s.repo.SupportTickets(ctx, status, supportTicketListLimit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса обращений: %w", err))
+	}
+	return tickets, nil
+}
+
+// UpdateSupportTicket меняет статус обращения и сохраняет ответ поддержки. Пользователь
+// получает сообщение в Telegram о новом статусе и ответе.
+func (s *Service) UpdateSupportTicket(ctx context.Context, actor Actor, ticketID int, request SupportTicketUpdateRequest) (*models.SupportTicket, error) {
+	request.Reply = strings.TrimSpace(request.Reply)
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	before, err := s.GetSupportTicket(ctx, 0, ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket, err := s.repo.UpdateSupportTicket(ctx, ticketID, request.Status, request.Reply,
+		func(ticket *models.SupportTicket) ([]models.OutboxMessage, error) {
+			text := fmt.Sprintf("Обращение в поддержку №%d: %s", ticket.ID, supportTicketStatuses[ticket.Status])
+			if request.Reply != "" {
+				text += "\n\n" + request.Reply
+			}
+			return s.outbox().telegram(ticket.UserID, text).build()
+		})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Обращение не найдено", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка изменения обращения: %w", err))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "support_ticket", ticketID,
+		map[string]any{"status": before.Status, "reply": before.Reply},
+		map[string]any{"status": ticket.Status, "reply": ticket.Reply})
+	return ticket, nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// ListTariffs возвращает стоимость кода маркировки и плату Честного ЗНАКа за код для всех
+// товарных групп. Для групп без тарифа указываются значения по умолчанию.
+func (s *Service) ListTariffs(ctx context.Context) ([]models.Tariff, error) {
+	tariffs, err := s.repo.Tariffs(ctx)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса тарифов: %w", err))
+	}
+
+	configured := make(map[string]bool, len(tariffs))
+	for i := range tariffs {
+		configured[tariffs[i].ProductGroup] = true
+		if tariffs[i].FeeCost == nil {
+			tariffs[i].FeeCost = feeCostPtr(kizFeeCost)
+		}
+	}
+	for group := range models.ProductGroupNames {
+		if !configured[group] {
+			tariffs = append(tariffs, models.Tariff{ProductGroup: group, UnitPrice: kizUnitPrice, FeeCost: feeCostPtr(kizFeeCost)})
+		}
+	}
+	sort.Slice(tariffs, func(i, j int) bool { return tariffs[i].ProductGroup < tariffs[j].ProductGroup })
+
+	return tariffs, nil
+}
+
+// SetTariff устанавливает стоимость кода маркировки и плату Честного ЗНАКа за код для
+// товарной группы. Если плата не указана, сохраняется прежняя.
+func (s *Service) SetTariff(ctx context.Context, actor Actor, tariff models.Tariff) (*models.Tariff, error) {
+	if err := tariff.Validate(); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	before, err := s.tariff(ctx, tariff.ProductGroup)
+	if err != nil {
+		return nil, err
+	}
+	if tariff.FeeCost == nil {
+		tariff.FeeCost = before.FeeCost
+	}
+
+	if err := s.repo.SetTariff(ctx, &tariff); err != nil {
+		return nil, NewError(KindInternal, "Ошибка сохранения тарифа", err)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "tariff", tariff.ProductGroup,
+		map[string]float64{"unit_price": before.UnitPrice, "fee_cost": *before.FeeCost},
+		map[string]float64{"unit_price": tariff.UnitPrice, "fee_cost": *tariff.FeeCost})
+
+	return &tariff, nil
+}
+
+// Тариф товарной группы с заполненной платой за код; для группы без тарифа
+// и заказа без группы - стоимость и плата по умолчанию
+func (s *Service) tariff(ctx context.Context, productGroup string) (*models.Tariff, error) {
+	defaultTariff := &models.Tariff{ProductGroup: productGroup, UnitPrice: kizUnitPrice, FeeCost: feeCostPtr(kizFeeCost)}
+	if productGroup == "" {
+		return defaultTariff, nil
+	}
+
+	tariff, err := s.repo.Tariff(ctx, productGroup)
+	if errors.Is(err, repository.ErrNotFound) {
+		return defaultTariff, nil
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса тарифа: %w", err))
+	}
+	if tariff.FeeCost == nil {
+		tariff.FeeCost = feeCostPtr(kizFeeCost)
+	}
+	return tariff, nil
+}
+
+func feeCostPtr(cost float64) *float64 {
+	return &cost
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"project-znak/internal/repository"
+)
+
+// Время хранения часового пояса пользователя в кэше
+const timezoneCacheTTL = 10 * time.Minute
+
+// Ключ кэша часового пояса пользователя
+func timezoneCacheKey(userID int) string {
+	return fmt.Sprintf("timezone:user:%d", userID)
+}
+
+// Загруженные часовые пояса по имени: разбор базы часовых поясов при каждом
+// сообщении пользователю не нужен
+var locations sync.Map
+
+// Часовой пояс IANA по имени; "Local" и пустое имя не принимаются, так как зависят
+// от настроек сервера
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("неизвестный часовой пояс %q", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// UserLocation возвращает часовой пояс для отображения времени пользователю: выбранный
+// им или пояс по умолчанию. Ошибка БД не мешает ответу и только записывается в журнал.
+func (s *Service) UserLocation(ctx context.Context, userID int) *time.Location {
+	if userID == 0 {
+		return s.defaultTimezone
+	}
+
+	var name string
+	if !s.cache.Get(ctx, timezoneCacheKey(userID), &name) {
+		var err error
+		name, err = s.repo.UserTimezone(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return s.defaultTimezone
+		} else if err != nil {
+			s.logger.Printf("Ошибка получения часового пояса пользователя %d: %v", userID, err)
+			return s.defaultTimezone
+		}
+		s.cache.Set(ctx, timezoneCacheKey(userID), name, timezoneCacheTTL)
+	}
+
+	if name == "" {
+		return s.defaultTimezone
+	}
+	loc, err := loadLocation(name)
+	if err != nil {
+		s.logger.Printf("Ошибка загрузки часового пояса %s пользователя %d: %v", name, userID, err)
+		return s.defaultTimezone
+	}
+	return loc
+}
+
+// SetUserTimezone сохраняет часовой пояс пользователя, например "Asia/Yekaterinburg";
+// пустое имя возвращает пояс по умолчанию. Возвращает пояс, который будет использоваться.
+func (s *Service) SetUserTimezone(ctx context.Context, actor Actor, name string) (*time.Location, error) {
+	loc := s.defaultTimezone
+	if name != "" {
+		var err error
+		if loc, err = loadLocation(name); err != nil {
+			return nil, NewError(KindInvalid, fmt.Sprintf("Неизвестный часовой пояс %q", name), nil)
+		}
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := s.repo.UserTimezone(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Пользователь не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса часового пояса пользователя: %w", err))
+	}
+	if err := s.repo.SetUserTimezone(ctx, userID, name); errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Пользователь не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка сохранения часового пояса", err)
+	}
+	s.cache.Delete(ctx, timezoneCacheKey(userID))
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "user", userID,
+		map[string]string{"timezone": before}, map[string]string{"timezone": name})
+	return loc, nil
+}
@@ -0,0 +1,814 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"project-znak/internal/chestnyznak"
+	"project-znak/internal/edo"
+	"project-znak/internal/labels"
+	"project-znak/internal/mailer"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/transport"
+)
+
+// Число УПД, состояние которых проверяется за один проход
+const updPollBatch = 50
+
+// Наибольший интервал между проверками ответа покупателя на УПД
+const updPollMaxDelay = 6 * time.Hour
+
+// Наибольшее число кодов маркировки в одном УПД
+const updMaxCodes = 10000
+
+// Атрибуты владельца квалифицированного сертификата: фамилия, имя и отчество, должность
+var (
+	oidSurname   = asn1.ObjectIdentifier{2, 5, 4, 4}
+	oidGivenName = asn1.ObjectIdentifier{2, 5, 4, 42}
+	oidTitle     = asn1.ObjectIdentifier{2, 5, 4, 12}
+)
+
+// UPDItemRequest - строка УПД: товар и коды маркировки отгружаемых единиц; количество
+// равно числу кодов. Цена за единицу включает НДС.
+type UPDItemRequest struct {
+	GTIN    string   `json:"gtin" validate:"required,gtin"`
+	Name    string   `json:"name" validate:"required,max=1000"`
+	Price   float64  `json:"price" validate:"required,gt=0"`
+	VATRate string   `json:"vat_rate" validate:"required,oneof=none 0 10 20"`
+	Codes   []string `json:"codes" validate:"required,dive,required"`
+}
+
+// UPDRequest - УПД на оптовую отгрузку маркированных товаров покупателю. Продавец -
+// организация, коды которой отгружаются; дата по умолчанию - текущая.
+type UPDRequest struct {
+	TelegramID     int64            `json:"telegram_id"`
+	OrganizationID int              `json:"organization_id" validate:"required"`
+	Number         string           `json:"number" validate:"required,max=100"`
+	Date           string           `json:"date" validate:"date"`
+	BuyerINN       string           `json:"buyer_inn" validate:"required,inn"`
+	BuyerKPP       string           `json:"buyer_kpp" validate:"max=9"`
+	BuyerName      string           `json:"buyer_name" validate:"required,max=1000"`
+	BuyerAddress   string           `json:"buyer_address" validate:"max=1000"`
+	Items          []UPDItemRequest `json:"items" validate:"required,max=100"`
+}
+
+// Событие вебхука об ответе покупателя на УПД
+type updEvent struct {
+	DocumentID     int    `json:"document_id"`
+	OrganizationID int    `json:"organization_id"`
+	Number         string `json:"number"`
+	BuyerINN       string `json:"buyer_inn"`
+	Status         string `json:"status"`
+	Comment        string `json:"comment,omitempty"`
+}
+
+// CreateUPD формирует УПД со списком кодов маркировки, подписывает его ЭЦП и отправляет
+// покупателю через оператора ЭДО. Коды должны быть получены организацией-продавцом
+// и соответствовать GTIN своих строк.
+func (s *Service) CreateUPD(ctx context.Context, actor Actor, request UPDRequest) (*models.UPDDocument, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	if s.edo == nil {
+		return nil, NewError(KindUnavailable, "Отправка документов через ЭДО не настроена", nil)
+	}
+	if !s.chestnyZnak.Enabled() {
+		return nil, NewError(KindUnavailable, "ЭЦП для подписи документов не настроена", nil)
+	}
+
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkInventoryAccess(ctx, userID, request.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	org, err := s.repo.Organization(ctx, request.OrganizationID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Организация не найдена", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения организации: %w", err))
+	}
+	if org.Name == "" {
+		return nil, NewError(KindInvalid, "Укажите наименование организации в ее реквизитах", nil)
+	}
+
+	date := time.Now()
+	if request.Date != "" {
+		// Формат даты проверен ValidateRequest
+		day, _ := time.ParseInLocation(documentDateLayout, request.Date, time.Local)
+		date = time.Date(day.Year(), day.Month(), day.Day(), date.Hour(), date.Minute(), date.Second(), 0, time.Local)
+	}
+
+	doc := models.UPDDocument{
+		UserID:         userID,
+		OrganizationID: org.ID,
+		Number:         strings.TrimSpace(request.Number),
+		Date:           date,
+		BuyerINN:       request.BuyerINN,
+		BuyerKPP:       request.BuyerKPP,
+		BuyerName:      strings.TrimSpace(request.BuyerName),
+		Provider:       s.edo.Name(),
+		Status:         models.UPDStatusSent,
+	}
+	for _, item := range request.Items {
+		doc.Items = append(doc.Items, models.UPDItem{
+			GTIN:     item.GTIN,
+			Name:     strings.TrimSpace(item.Name),
+			Quantity: len(item.Codes),
+			Price:    item.Price,
+			VATRate:  item.VATRate,
+			Codes:    item.Codes,
+		})
+		doc.Total += item.Price * float64(len(item.Codes))
+	}
+	if err := s.checkUPDCodes(ctx, userID, org, doc.Items); err != nil {
+		return nil, err
+	}
+
+	upd := edo.UPD{
+		Number: doc.Number,
+		Date:   doc.Date,
+		Seller: edo.Party{Name: org.Name, INN: org.INN, KPP: org.KPP, Address: org.Address},
+		Buyer: edo.Party{Name: doc.BuyerName, INN: doc.BuyerINN, KPP: doc.BuyerKPP,
+			Address: strings.TrimSpace(request.BuyerAddress)},
+		Signatory: certificateSignatory(s.chestnyZnak.Certificate()),
+	}
+	for _, item := range doc.Items {
+		upd.Items = append(upd.Items, edo.Item{
+			GTIN: item.GTIN, Name: item.Name, Quantity: item.Quantity, Price: item.Price,
+			VATRate: item.VATRate, Codes: item.Codes,
+		})
+	}
+
+	if upd.Seller.ID, err = s.edo.Participant(ctx, org.INN, org.KPP); err != nil {
+		return nil, edoError("Организация-продавец не подключена к оператору ЭДО", err)
+	}
+	if upd.Buyer.ID, err = s.edo.Participant(ctx, doc.BuyerINN, doc.BuyerKPP); err != nil {
+		return nil, edoError("Покупатель не подключен к оператору ЭДО", err)
+	}
+
+	file, err := edo.Build(&upd, s.chestnyZnak)
+	if errors.Is(err, chestnyznak.ErrCertificateExpired) {
+		return nil, chestnyZnakError("Ошибка подписи УПД", err)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка формирования УПД", err)
+	}
+	doc.FileName = file.FileName
+
+	if doc.ExternalID, err = s.edo.Send(ctx, *file); err != nil {
+		return nil, NewError(KindUnavailable, "Оператор ЭДО не принял документ", err)
+	}
+
+	if err := s.repo.CreateUPDDocument(ctx, &doc, file.Content, file.Signature); err != nil {
+		return nil, NewError(KindInternal, "Документ отправлен покупателю, но не сохранен",
+			fmt.Errorf("УПД %s у оператора %s: %w", doc.ExternalID, doc.Provider, err))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "upd_document", doc.ID, nil, doc)
+	return &doc, nil
+}
+
+// Проверка кодов УПД: коды не повторяются, получены организацией-продавцом и относятся
+// к GTIN своих строк
+func (s *Service) checkUPDCodes(ctx context.Context, userID int, org *models.Organization, items []models.UPDItem) error {
+	var codes []string
+	seen := make(map[string]bool)
+	for _, item := range items {
+		for _, code := range item.Codes {
+			if seen[code] {
+				return NewError(KindInvalid, "Код маркировки указан в документе несколько раз", fmt.Errorf("код %s", code))
+			}
+			seen[code] = true
+			if labels.GTINFromCode(code) != item.GTIN {
+				return NewError(KindInvalid, fmt.Sprintf("Код маркировки не относится к товару GTIN %s", item.GTIN),
+					fmt.Errorf("код %s", code))
+			}
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) > updMaxCodes {
+		return NewError(KindInvalid, fmt.Sprintf("Документ может содержать не более %d кодов маркировки", updMaxCodes), nil)
+	}
+
+	refs, err := s.repo.AccessibleKIZCodes(ctx, userID, nil, codes)
+	if err != nil {
+		return NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения кодов: %w", err))
+	}
+	found := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		if ref.OrganizationID == org.ID && ref.INN == org.INN {
+			found[ref.Code] = true
+		}
+	}
+	for _, code := range codes {
+		if !found[code] {
+			return NewError(KindNotFound, "Код маркировки не найден среди кодов организации", fmt.Errorf("код %s", code))
+		}
+	}
+	return nil
+}
+
+// Подписант УПД по данным владельца сертификата ЭЦП
+func certificateSignatory(cert *x509.Certificate) edo.Signatory {
+	var signatory edo.Signatory
+	if cert == nil {
+		return signatory
+	}
+	for _, name := range cert.Subject.Names {
+		value, ok := name.Value.(string)
+		if !ok {
+			continue
+		}
+		switch {
+		case name.Type.Equal(oidSurname):
+			signatory.LastName = value
+		case name.Type.Equal(oidGivenName):
+			// Имя и отчество указываются в одном атрибуте через пробел
+			signatory.FirstName, signatory.MiddleName, _ = strings.Cut(value, " ")
+		case name.Type.Equal(oidTitle):
+			signatory.Position = value
+		}
+	}
+	return signatory
+}
+
+// Ошибка обращения к оператору ЭДО для клиента
+func edoError(notFound string, err error) *Error {
+	if errors.Is(err, edo.ErrParticipantNotFound) {
+		return NewError(KindInvalid, notFound, err)
+	}
+	return NewError(KindUnavailable, "Оператор ЭДО недоступен", err)
+}
+
+// GetUPD возвращает УПД организации, в которой состоит пользователь
+func (s *Service) GetUPD(ctx context.Context, userID, documentID int) (*models.UPDDocument, error) {
+	doc, err := s.repo.UPDDocument(ctx, documentID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Документ не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения УПД: %w", err))
+	}
+	return doc, nil
+}
+
+// UPDFile возвращает имя и содержимое подписанного файла УПД
+func (s *Service) UPDFile(ctx context.Context, userID, documentID int) (string, []byte, error) {
+	name, content, _, err := s.repo.UPDFile(ctx, documentID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", nil, NewError(KindNotFound, "Документ не найден", nil)
+	} else if err != nil {
+		return "", nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения файла УПД: %w", err))
+	}
+	return name, content, nil
+}
+
+// UPDOrganizationID возвращает организацию УПД; 0, если документ не найден
+func (s *Service) UPDOrganizationID(ctx context.Context, documentID int) (int, error) {
+	return s.repo.UPDOrganizationID(ctx, documentID)
+}
+
+// ListUPD возвращает последние УПД организации
+func (s *Service) ListUPD(ctx context.Context, userID, organizationID, limit int) ([]models.UPDDocument, error) {
+	if organizationID <= 0 {
+		return nil, NewError(KindInvalid, "Не указан ID организации", nil)
+	}
+	if err := s.checkInventoryAccess(ctx, userID, organizationID); err != nil {
+		return nil, err
+	}
+	docs, err := s.repo.UPDDocuments(ctx, organizationID, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения УПД: %w", err))
+	}
+	return docs, nil
+}
+
+// RunUPDStatusPolling периодически проверяет ответ покупателей на отправленные УПД
+// до отмены контекста. Если оператор ЭДО не настроен, сразу возвращается.
+func (s *Service) RunUPDStatusPolling(ctx context.Context, interval time.Duration) {
+	if s.edo == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			s.pollUPDStatuses(ctx, interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Проверка УПД без ответа покупателя; следующая проверка документа откладывается
+// с увеличивающимся интервалом
+func (s *Service) pollUPDStatuses(ctx context.Context, interval time.Duration) {
+	docs, err := s.repo.PendingUPDDocuments(ctx, updPollBatch)
+	if err != nil {
+		s.logger.Printf("Ошибка получения отправленных УПД: %v", err)
+		return
+	}
+
+	for i := range docs {
+		if err := s.refreshUPDStatus(ctx, &docs[i]); err != nil {
+			s.logger.Printf("Ошибка получения состояния УПД %d: %v", docs[i].ID, err)
+		}
+		if docs[i].IsFinal() {
+			continue
+		}
+		if err := s.repo.PostponeUPDCheck(ctx, docs[i].ID, interval, updPollMaxDelay); err != nil {
+			s.logger.Printf("Ошибка переноса проверки УПД %d: %v", docs[i].ID, err)
+		}
+	}
+}
+
+// Запрос состояния документа у оператора ЭДО и сохранение изменений с записью в журнал
+// аудита. Об ответе покупателя автор документа получает уведомление.
+func (s *Service) refreshUPDStatus(ctx context.Context, doc *models.UPDDocument) error {
+	// Документы, отправленные через другого оператора, не проверяются
+	if doc.Provider != s.edo.Name() {
+		return nil
+	}
+
+	status, err := s.edo.Status(ctx, doc.ExternalID)
+	if err != nil {
+		return err
+	}
+	if status.State == doc.Status {
+		return nil
+	}
+
+	before := doc.Status
+	doc.Status, doc.Comment = status.State, status.Comment
+	var messages []models.OutboxMessage
+	if doc.IsFinal() {
+		if messages, err = s.updResultMessages(doc); err != nil {
+			return err
+		}
+	}
+	updated, err := s.repo.UpdateUPDStatus(ctx, doc, messages)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения состояния УПД: %w", err)
+	}
+	if !updated {
+		return nil
+	}
+
+	s.recordAudit(ctx, Actor{}, AuditActionUpdate, "upd_document", doc.ID,
+		map[string]string{"status": before},
+		map[string]string{"status": doc.Status, "comment": doc.Comment})
+	return nil
+}
+
+// Уведомления об ответе покупателя на УПД: событие вебхука, сообщение в Telegram
+// и письмо об отказе в подписи
+func (s *Service) updResultMessages(doc *models.UPDDocument) ([]models.OutboxMessage, error) {
+	b := s.outbox().webhook("upd."+doc.Status, updEvent{
+		DocumentID:     doc.ID,
+		OrganizationID: doc.OrganizationID,
+		Number:         doc.Number,
+		BuyerINN:       doc.BuyerINN,
+		Status:         doc.Status,
+		Comment:        doc.Comment,
+	})
+
+	if doc.Status == models.UPDStatusAccepted {
+		return b.telegram(doc.UserID, fmt.Sprintf("УПД №%s подписан покупателем %s", doc.Number, doc.BuyerName)).build()
+	}
+
+	reason := fmt.Sprintf("покупатель %s отказал в подписи УПД №%s", doc.BuyerName, doc.Number)
+	if doc.Comment != "" {
+		reason += ": " + doc.Comment
+	}
+	return b.
+		telegram(doc.UserID, "Отгрузка по ЭДО: "+reason).
+		email(doc.UserID, "failures", "Ошибка: отгрузка по ЭДО", mailer.TemplateFailure,
+			failureEmail{Operation: "Отгрузка по ЭДО", Reason: reason, Time: time.Now()}).
+		build()
+}
+
+// RejectUPDRequest - отказ в подписи входящего УПД с указанием причины
+type RejectUPDRequest struct {
+	Comment string `json:"comment" validate:"required,max=1000"`
+}
+
+// Событие вебхука о приемке товаров по входящему УПД
+type incomingUPDEvent struct {
+	DocumentID     int      `json:"document_id"`
+	OrganizationID int      `json:"organization_id"`
+	Number         string   `json:"number"`
+	SellerINN      string   `json:"seller_inn"`
+	Codes          int      `json:"codes"`
+	AcceptanceIDs  []string `json:"acceptance_ids"`
+}
+
+// ListIncomingUPD возвращает входящие УПД организации. Если оператор ЭДО настроен,
+// предварительно загружаются новые документы, ожидающие подписи организации; при
+// недоступности оператора возвращаются ранее загруженные документы.
+func (s *Service) ListIncomingUPD(ctx context.Context, userID, organizationID int, status string, limit int) ([]models.IncomingUPD, error) {
+	if organizationID <= 0 {
+		return nil, NewError(KindInvalid, "Не указан ID организации", nil)
+	}
+	switch status {
+	case "", models.IncomingUPDStatusNew, models.IncomingUPDStatusAccepted, models.IncomingUPDStatusRejected:
+	default:
+		return nil, NewError(KindInvalid, "Недопустимый статус документа", nil)
+	}
+	if err := s.checkInventoryAccess(ctx, userID, organizationID); err != nil {
+		return nil, err
+	}
+
+	if s.edo != nil {
+		org, err := s.repo.Organization(ctx, organizationID)
+		if err != nil {
+			return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения организации: %w", err))
+		}
+		if err := s.syncIncomingUPD(ctx, org); err != nil {
+			s.logger.Printf("Ошибка загрузки входящих УПД организации %d: %v", organizationID, err)
+		}
+	}
+
+	docs, err := s.repo.IncomingUPDs(ctx, organizationID, status, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения входящих УПД: %w", err))
+	}
+	return docs, nil
+}
+
+// Загрузка новых входящих УПД организации от оператора ЭДО. Документы, которые не удалось
+// разобрать, адресованные другому покупателю или без кодов маркировки, пропускаются.
+func (s *Service) syncIncomingUPD(ctx context.Context, org *models.Organization) error {
+	incoming, err := s.edo.Incoming(ctx, edo.Party{Name: org.Name, INN: org.INN, KPP: org.KPP})
+	if err != nil {
+		return err
+	}
+
+	for _, file := range incoming {
+		received, err := edo.ParseUPD(file.Content)
+		if err != nil {
+			s.logger.Printf("Входящий УПД %s пропущен: %v", file.ID, err)
+			continue
+		}
+		if received.Buyer.INN != org.INN {
+			s.logger.Printf("Входящий УПД %s пропущен: покупатель %s вместо %s", file.ID, received.Buyer.INN, org.INN)
+			continue
+		}
+
+		doc := incomingUPD(org.ID, s.edo.Name(), file.ID, file.FileName, received)
+		if len(doc.Codes()) == 0 {
+			continue
+		}
+
+		if _, err := s.repo.SaveIncomingUPD(ctx, doc, file.Content); err != nil {
+			return fmt.Errorf("ошибка сохранения входящего УПД %s: %w", file.ID, err)
+		}
+	}
+	return nil
+}
+
+// Входящий УПД организации по разобранному титулу продавца
+func incomingUPD(organizationID int, provider, externalID, fileName string, received *edo.Received) *models.IncomingUPD {
+	doc := &models.IncomingUPD{
+		OrganizationID: organizationID,
+		Provider:       provider,
+		ExternalID:     externalID,
+		FileName:       fileName,
+		Number:         received.Number,
+		Date:           received.Date,
+		SellerINN:      received.Seller.INN,
+		SellerKPP:      received.Seller.KPP,
+		SellerName:     received.Seller.Name,
+		Status:         models.IncomingUPDStatusNew,
+	}
+	if doc.FileName == "" {
+		doc.FileName = received.FileID + ".xml"
+	}
+	for _, item := range received.Items {
+		doc.Items = append(doc.Items, models.UPDItem{
+			GTIN: item.GTIN, Name: item.Name, Quantity: item.Quantity, Price: item.Price,
+			VATRate: item.VATRate, Codes: item.Codes,
+		})
+		doc.Total += item.Price * float64(item.Quantity)
+	}
+	return doc
+}
+
+// UploadIncomingUPD загружает входящий УПД, полученный не через подключенного оператора
+// ЭДО: на бумаге, по почте или через другого оператора. Титул покупателя такого документа
+// подписывается вне сервиса, поэтому при приемке в Честный ЗНАК отправляется только
+// документ приемки. Повторная загрузка того же файла отклоняется.
+func (s *Service) UploadIncomingUPD(ctx context.Context, actor Actor, userID, organizationID int, fileName string, content []byte) (*models.IncomingUPD, error) {
+	if organizationID <= 0 {
+		return nil, NewError(KindInvalid, "Не указан ID организации", nil)
+	}
+	if err := s.checkInventoryAccess(ctx, userID, organizationID); err != nil {
+		return nil, err
+	}
+	org, err := s.repo.Organization(ctx, organizationID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения организации: %w", err))
+	}
+
+	received, err := edo.ParseUPD(content)
+	if err != nil {
+		return nil, NewError(KindInvalid, "Некорректный файл УПД", err)
+	}
+	if received.Buyer.INN != org.INN {
+		return nil, NewError(KindInvalid, "УПД выставлен другому покупателю", nil)
+	}
+	externalID := received.FileID
+	if externalID == "" {
+		sum := sha256.Sum256(content)
+		externalID = hex.EncodeToString(sum[:])
+	}
+	doc := incomingUPD(org.ID, models.IncomingUPDProviderUpload, externalID, filepath.Base(fileName), received)
+	if fileName == "" {
+		doc.FileName = externalID + ".xml"
+	}
+	if len(doc.Codes()) == 0 {
+		return nil, NewError(KindInvalid, "В УПД нет кодов маркировки", nil)
+	}
+
+	saved, err := s.repo.SaveIncomingUPD(ctx, doc, content)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка сохранения входящего УПД: %w", err))
+	}
+	if !saved {
+		return nil, NewError(KindConflict, "УПД уже загружен", nil)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionCreate, "incoming_upd_document", doc.ID, nil, doc)
+	return doc, nil
+}
+
+// GetIncomingUPD возвращает входящий УПД организации со строками и кодами маркировки
+func (s *Service) GetIncomingUPD(ctx context.Context, userID, documentID int) (*models.IncomingUPD, error) {
+	doc, err := s.repo.IncomingUPD(ctx, documentID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Документ не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения входящего УПД: %w", err))
+	}
+	return doc, nil
+}
+
+// IncomingUPDFile возвращает имя и содержимое файла входящего УПД
+func (s *Service) IncomingUPDFile(ctx context.Context, userID, documentID int) (string, []byte, error) {
+	name, content, err := s.repo.IncomingUPDFile(ctx, documentID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", nil, NewError(KindNotFound, "Документ не найден", nil)
+	} else if err != nil {
+		return "", nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения файла УПД: %w", err))
+	}
+	return name, content, nil
+}
+
+// IncomingUPDOrganizationID возвращает организацию входящего УПД; 0, если документ не найден
+func (s *Service) IncomingUPDOrganizationID(ctx context.Context, documentID int) (int, error) {
+	return s.repo.IncomingUPDOrganizationID(ctx, documentID)
+}
+
+// AcceptIncomingUPD принимает товары по входящему УПД: подписывает титул покупателя
+// и отправляет его поставщику через оператора ЭДО, отправляет документ приемки
+// в Честный ЗНАК и добавляет принятые коды в остаток организации. Если титул подписан,
+// но приемка не отправлена в Честный ЗНАК, повторный вызов отправляет только приемку.
+func (s *Service) AcceptIncomingUPD(ctx context.Context, actor Actor, userID, documentID int) (*models.IncomingUPD, error) {
+	if !s.chestnyZnak.Enabled() {
+		return nil, NewError(KindUnavailable, "ЭЦП для подписи документов не настроена", nil)
+	}
+
+	doc, err := s.GetIncomingUPD(ctx, userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if s.edo == nil && doc.Provider != models.IncomingUPDProviderUpload {
+		return nil, NewError(KindUnavailable, "Обмен документами через ЭДО не настроен", nil)
+	}
+	switch {
+	case doc.Status == models.IncomingUPDStatusRejected:
+		return nil, NewError(KindConflict, "В подписи документа отказано", nil)
+	case doc.Status == models.IncomingUPDStatusAccepted && len(doc.AcceptanceIDs) > 0:
+		return nil, NewError(KindConflict, "Товары по документу уже приняты", nil)
+	}
+
+	org, err := s.repo.Organization(ctx, doc.OrganizationID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения организации: %w", err))
+	}
+
+	if doc.Status == models.IncomingUPDStatusNew {
+		if err := s.signIncomingUPD(ctx, actor, userID, doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.submitUPDAcceptance(ctx, actor, org, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Подписание титула покупателя входящего УПД и отправка его поставщику. Загруженный
+// вручную документ только отмечается принятым: титул подписывается вне сервиса.
+func (s *Service) signIncomingUPD(ctx context.Context, actor Actor, userID int, doc *models.IncomingUPD) error {
+	if doc.Provider != models.IncomingUPDProviderUpload {
+		if err := s.sendUPDAcceptance(ctx, userID, doc); err != nil {
+			return err
+		}
+	}
+
+	// Титул уже отправлен поставщику, поэтому сохранение не зависит от отмены запроса
+	ctx = context.WithoutCancel(ctx)
+	doc.Status, doc.ProcessedBy = models.IncomingUPDStatusAccepted, userID
+	updated, err := s.repo.SetIncomingUPDStatus(ctx, doc)
+	if err != nil {
+		return NewError(KindInternal, "Титул покупателя отправлен, но не сохранен",
+			fmt.Errorf("входящий УПД %d: %w", doc.ID, err))
+	}
+	if !updated {
+		return NewError(KindConflict, "Документ уже обработан", nil)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "incoming_upd_document", doc.ID,
+		map[string]string{"status": models.IncomingUPDStatusNew},
+		map[string]string{"status": doc.Status})
+	return nil
+}
+
+// Формирование титула покупателя и отправка его поставщику через оператора ЭДО
+func (s *Service) sendUPDAcceptance(ctx context.Context, userID int, doc *models.IncomingUPD) error {
+	if doc.Provider != s.edo.Name() {
+		return NewError(KindConflict, "Документ получен через другого оператора ЭДО", nil)
+	}
+
+	_, content, err := s.IncomingUPDFile(ctx, userID, doc.ID)
+	if err != nil {
+		return err
+	}
+	received, err := edo.ParseUPD(content)
+	if err != nil {
+		return NewError(KindInternal, "Ошибка чтения УПД", err)
+	}
+
+	title, err := edo.BuildAcceptance(received, time.Now(), certificateSignatory(s.chestnyZnak.Certificate()), s.chestnyZnak)
+	if errors.Is(err, chestnyznak.ErrCertificateExpired) {
+		return chestnyZnakError("Ошибка подписи титула покупателя", err)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка формирования титула покупателя", err)
+	}
+	if err := s.edo.Accept(ctx, doc.ExternalID, *title); err != nil {
+		return NewError(KindUnavailable, "Оператор ЭДО не принял титул покупателя", err)
+	}
+	return nil
+}
+
+// Отправка документов приемки в Честный ЗНАК, по одному на товарную группу, и добавление
+// принятых кодов в остаток организации
+func (s *Service) submitUPDAcceptance(ctx context.Context, actor Actor, org *models.Organization, doc *models.IncomingUPD) error {
+	ctx = transport.WithSubject(ctx, "incoming_upd_document", doc.ID)
+	codes := doc.Codes()
+	groups := make(map[string][]string)
+	var received []repository.ReceivedCodes
+	for start := 0; start < len(codes); start += maxCodeStatusCodes {
+		end := min(start+maxCodeStatusCodes, len(codes))
+		infos, err := s.chestnyZnak.CodesInfo(ctx, codes[start:end])
+		if err != nil {
+			return chestnyZnakError("Ошибка запроса сведений о кодах в Честном ЗНАКе", err)
+		}
+		for _, info := range infos {
+			if _, ok := groups[info.ProductGroup]; !ok {
+				received = append(received, repository.ReceivedCodes{ProductGroup: info.ProductGroup})
+			}
+			groups[info.ProductGroup] = append(groups[info.ProductGroup], info.CIS)
+		}
+	}
+	found := 0
+	for i := range received {
+		received[i].Codes = groups[received[i].ProductGroup]
+		found += len(received[i].Codes)
+	}
+	if found != len(codes) {
+		return NewError(KindInvalid, "Часть кодов маркировки документа не найдена в Честном ЗНАКе",
+			fmt.Errorf("найдено %d из %d кодов", found, len(codes)))
+	}
+
+	now := time.Now()
+	var acceptanceIDs []string
+	for _, group := range received {
+		document := chestnyznak.AcceptanceDocument{
+			DocumentType:   chestnyznak.DocumentTypeAcceptGoods,
+			SenderINN:      doc.SellerINN,
+			ReceiverINN:    org.INN,
+			ProductGroup:   group.ProductGroup,
+			DocumentNumber: doc.Number,
+			TransferDate:   doc.Date.Format(documentDateLayout),
+			AcceptanceDate: now.Format(documentDateLayout),
+			TurnoverType:   "SELLING",
+		}
+		for _, code := range group.Codes {
+			document.Products = append(document.Products, chestnyznak.AcceptanceProduct{UIT: code, Accepted: true})
+		}
+
+		id, err := s.chestnyZnak.SubmitDocument(ctx, group.ProductGroup, document)
+		if err != nil {
+			go s.notifyFailure(doc.ProcessedBy, "Приемка по УПД",
+				fmt.Sprintf("не удалось отправить приемку по УПД №%s в Честный ЗНАК", doc.Number))
+			return chestnyZnakError("Титул покупателя подписан, но приемка не отправлена в Честный ЗНАК", err)
+		}
+		acceptanceIDs = append(acceptanceIDs, id)
+	}
+	doc.AcceptanceIDs = acceptanceIDs
+
+	messages, err := s.outbox().webhook("upd.received", incomingUPDEvent{
+		DocumentID:     doc.ID,
+		OrganizationID: doc.OrganizationID,
+		Number:         doc.Number,
+		SellerINN:      doc.SellerINN,
+		Codes:          len(codes),
+		AcceptanceIDs:  acceptanceIDs,
+	}).build()
+	if err != nil {
+		return NewError(KindInternal, "Ошибка формирования уведомлений", err)
+	}
+
+	// Приемка уже отправлена в Честный ЗНАК, поэтому сохранение не зависит от отмены запроса
+	ctx = context.WithoutCancel(ctx)
+	saved, err := s.repo.SaveIncomingUPDAcceptance(ctx, doc, org.INN, received, messages)
+	if err != nil {
+		return NewError(KindInternal, "Приемка отправлена в Честный ЗНАК, но не сохранена",
+			fmt.Errorf("входящий УПД %d, документы %s: %w", doc.ID, strings.Join(acceptanceIDs, ", "), err))
+	}
+	if !saved {
+		return NewError(KindConflict, "Товары по документу уже приняты", nil)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "incoming_upd_document", doc.ID, nil,
+		map[string]any{"acceptance_ids": acceptanceIDs})
+	return nil
+}
+
+// RejectIncomingUPD отказывает в подписи входящего УПД с указанием причины; отказ
+// отправляется поставщику через оператора ЭДО. Отказ по загруженному вручную документу
+// только сохраняется.
+func (s *Service) RejectIncomingUPD(ctx context.Context, actor Actor, userID, documentID int, request RejectUPDRequest) (*models.IncomingUPD, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	doc, err := s.GetIncomingUPD(ctx, userID, documentID)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Status != models.IncomingUPDStatusNew {
+		return nil, NewError(KindConflict, "Документ уже обработан", nil)
+	}
+
+	comment := strings.TrimSpace(request.Comment)
+	if doc.Provider != models.IncomingUPDProviderUpload {
+		switch {
+		case s.edo == nil:
+			return nil, NewError(KindUnavailable, "Обмен документами через ЭДО не настроен", nil)
+		case !s.chestnyZnak.Enabled():
+			return nil, NewError(KindUnavailable, "ЭЦП для подписи документов не настроена", nil)
+		case doc.Provider != s.edo.Name():
+			return nil, NewError(KindConflict, "Документ получен через другого оператора ЭДО", nil)
+		}
+		if err := s.edo.Reject(ctx, doc.ExternalID, comment, s.chestnyZnak); errors.Is(err, chestnyznak.ErrCertificateExpired) {
+			return nil, chestnyZnakError("Ошибка подписи отказа", err)
+		} else if err != nil {
+			return nil, NewError(KindUnavailable, "Оператор ЭДО не принял отказ в подписи", err)
+		}
+	}
+
+	// Отказ уже отправлен поставщику, поэтому сохранение не зависит от отмены запроса
+	ctx = context.WithoutCancel(ctx)
+	doc.Status, doc.Comment, doc.ProcessedBy = models.IncomingUPDStatusRejected, comment, userID
+	updated, err := s.repo.SetIncomingUPDStatus(ctx, doc)
+	if err != nil {
+		return nil, NewError(KindInternal, "Отказ отправлен поставщику, но не сохранен",
+			fmt.Errorf("входящий УПД %d: %w", doc.ID, err))
+	}
+	if !updated {
+		return nil, NewError(KindConflict, "Документ уже обработан", nil)
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "incoming_upd_document", doc.ID,
+		map[string]string{"status": models.IncomingUPDStatusNew},
+		map[string]string{"status": doc.Status, "comment": doc.Comment})
+	return doc, nil
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-znak/internal/dadata"
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+)
+
+// UserRegistrationRequest - запрос на регистрацию пользователя
+type UserRegistrationRequest struct {
+	TelegramID int64  `json:"telegram_id" validate:"required,min=1"`
+	INN        string `json:"inn" validate:"required_without=invitation,inn"`
+	Email      string `json:"email,omitempty" validate:"email"`
+
+	// Реферальный код или параметр start реферальной ссылки; учитывается при первой регистрации
+	ReferralCode string `json:"referral_code,omitempty"`
+
+	// Код приглашения или параметр start ссылки-приглашения; ИНН и email берутся из приглашения
+	Invitation string `json:"invitation,omitempty"`
+}
+
+// RegistrationResult - результат регистрации. APIKey заполняется,
+// только если пользователю выдан новый ключ.
+type RegistrationResult struct {
+	UserID           int
+	OrganizationName string
+	APIKey           string
+}
+
+// NotificationPreferencesRequest - запрос на изменение настроек уведомлений.
+// Незаполненные поля не меняются.
+type NotificationPreferencesRequest struct {
+	TelegramID      int64 `json:"telegram_id"`
+	KIZFiles        *bool `json:"kiz_files,omitempty"`
+	PaymentReceipts *bool `json:"payment_receipts,omitempty"`
+	Failures        *bool `json:"failures,omitempty"`
+	Announcements   *bool `json:"announcements,omitempty"` // Согласие на рассылку объявлений в Telegram
+}
+
+// RegisterUser регистрирует пользователя или обновляет его данные. При первой регистрации
+// по ИНН создается организация, а пользователю без действующих ключей выдается API ключ.
+// Регистрация по приглашению привязывает аккаунт Telegram к созданному при импорте пользователю.
+func (s *Service) RegisterUser(ctx context.Context, actor Actor, request UserRegistrationRequest) (*RegistrationResult, error) {
+	// Бот передает параметр start ссылки-приглашения так же, как реферальный
+	if request.Invitation == "" && strings.HasPrefix(strings.TrimSpace(request.ReferralCode), invitationStartPrefix) {
+		request.Invitation, request.ReferralCode = request.ReferralCode, ""
+	}
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+
+	var invitation *models.Invitation
+	if request.Invitation != "" {
+		var err error
+		if invitation, err = s.pendingInvitation(ctx, request.Invitation); err != nil {
+			return nil, err
+		}
+		if request.INN != "" && request.INN != invitation.INN {
+			return nil, NewError(KindInvalid, "ИНН не совпадает с ИНН из приглашения", nil)
+		}
+		if invitation.UserID != 0 {
+			return s.registerInvited(ctx, actor, invitation, request.TelegramID)
+		}
+		request.INN = invitation.INN
+		if request.Email == "" {
+			request.Email = invitation.Email
+		}
+	}
+
+	user := models.User{
+		TelegramID: request.TelegramID,
+		INN:        request.INN,
+		Email:      request.Email,
+	}
+	if invitation != nil {
+		user.Username = invitation.Username
+	}
+	if err := user.Validate(); err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+
+	// Проверка существования организации по ИНН
+	organizationName, err := s.lookupOrganizationName(ctx, request.INN)
+	if err != nil {
+		return nil, NewError(KindInvalid, err.Error(), nil)
+	}
+	user.OrganizationName = organizationName
+
+	// Данные пользователя до изменения для журнала аудита
+	var before map[string]string
+	previous, err := s.repo.UserByTelegram(ctx, request.TelegramID)
+	exists := err == nil
+	if errors.Is(err, repository.ErrNotFound) {
+		err = nil
+	} else if exists {
+		before = map[string]string{"inn": previous.INN, "email": previous.Email}
+	}
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка проверки пользователя: %w", err))
+	}
+
+	// Число регистраций новых пользователей с одного адреса ограничено
+	limited := !exists && s.authGuard.RegistrationLimit > 0
+	if limited {
+		if err := s.checkAuthLock(ctx, models.AuthScopeRegistration, actor.IP); err != nil {
+			return nil, err
+		}
+	}
+
+	action := AuditActionCreate
+	if exists {
+		action = AuditActionUpdate
+		err = s.repo.UpdateUserRegistration(ctx, &user)
+	} else {
+		err = s.repo.CreateUser(ctx, &user)
+	}
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка сохранения пользователя: %w", err))
+	}
+
+	s.recordAudit(ctx, actor, action, "user", user.ID, before, map[string]string{
+		"inn":               request.INN,
+		"email":             request.Email,
+		"organization_name": organizationName,
+	})
+
+	if !exists {
+		s.linkReferral(ctx, actor, user.ID, request.ReferralCode)
+	}
+	if limited {
+		// Регистрация уже выполнена, блокировка действует для следующих
+		if err := s.recordAuthAttempt(ctx, models.AuthScopeRegistration, actor.IP, s.authGuard.RegistrationLimit); err != nil {
+			s.logger.Printf("Регистрация пользователя %d выполнена, следующие регистрации с адреса %s ограничены: %v",
+				user.ID, actor.IP, err)
+		}
+	}
+
+	// Организация по ИНН создается при первой регистрации, зарегистрировавший становится ее владельцем.
+	// Организация приглашенного партнером пользователя становится субаккаунтом партнера.
+	if invitation != nil && invitation.PartnerID != 0 {
+		_, err = s.repo.CreatePartnerOrganization(ctx, invitation.PartnerID, user.ID, request.INN, organizationName)
+	} else {
+		_, err = s.repo.CreateOrganization(ctx, user.ID, request.INN, organizationName)
+	}
+	if err != nil {
+		s.logger.Printf("Ошибка создания организации пользователя: %v", err)
+	}
+	if invitation != nil {
+		s.acceptInvitation(ctx, actor, invitation, user.ID)
+	}
+
+	result := &RegistrationResult{UserID: user.ID, OrganizationName: organizationName}
+
+	// API ключ выдается, только если у пользователя нет действующих ключей:
+	// повторная регистрация не должна отключать существующие интеграции
+	hasKey, err := s.repo.HasActiveAPIKey(ctx, user.ID)
+	if err != nil {
+		s.logger.Printf("Ошибка проверки API ключей пользователя: %v", err)
+	} else if !hasKey {
+		key, apiKey, err := s.issueAPIKey(ctx, user.ID, "default", nil)
+		if err != nil {
+			s.logger.Printf("Ошибка создания API ключа: %v", err)
+		} else {
+			s.recordAudit(ctx, actor, AuditActionCreate, "api_key", key.ID, nil, key)
+			result.APIKey = apiKey
+		}
+	}
+
+	return result, nil
+}
+
+// Получение наименования организации по ИНН через DaData.
+// Возвращает ошибку, если организация не найдена или ликвидирована;
+// при недоступности сервиса регистрация продолжается без наименования.
+func (s *Service) lookupOrganizationName(ctx context.Context, inn string) (string, error) {
+	if !s.dadata.Enabled() {
+		return "", nil
+	}
+
+	party, err := s.dadata.FindByINN(ctx, inn)
+	if errors.Is(err, dadata.ErrNotFound) {
+		return "", fmt.Errorf("организация с ИНН %s не найдена", inn)
+	} else if err != nil {
+		s.logger.Printf("Ошибка проверки ИНН %s через DaData: %v", inn, err)
+		return "", nil
+	}
+
+	if party.Status == dadata.StatusLiquidated {
+		return "", fmt.Errorf("организация с ИНН %s ликвидирована", inn)
+	}
+
+	return party.Name, nil
+}
+
+// GetUser возвращает пользователя по telegram_id
+func (s *Service) GetUser(ctx context.Context, telegramID int64) (*models.User, error) {
+	user, err := s.repo.UserByTelegram(ctx, telegramID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindNotFound, "Пользователь не найден", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса пользователя: %w", err))
+	}
+	return user, nil
+}
+
+// IsAdmin проверяет, является ли пользователь администратором системы
+func (s *Service) IsAdmin(ctx context.Context, userID int) (bool, error) {
+	return s.repo.IsAdmin(ctx, userID)
+}
+
+// NotificationPreferences возвращает настройки уведомлений пользователя
+func (s *Service) NotificationPreferences(ctx context.Context, userID int) (models.NotificationPreferences, error) {
+	prefs, err := s.repo.NotificationPreferences(ctx, userID)
+	if err != nil {
+		return prefs, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения настроек уведомлений: %w", err))
+	}
+	return prefs, nil
+}
+
+// UpdateNotificationPreferences меняет указанные в запросе настройки уведомлений
+func (s *Service) UpdateNotificationPreferences(ctx context.Context, actor Actor, request NotificationPreferencesRequest) (models.NotificationPreferences, error) {
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return models.NotificationPreferences{}, err
+	}
+
+	before, err := s.repo.NotificationPreferences(ctx, userID)
+	if err != nil {
+		return before, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка получения настроек уведомлений: %w", err))
+	}
+
+	prefs := before
+	if request.KIZFiles != nil {
+		prefs.KIZFiles = *request.KIZFiles
+	}
+	if request.PaymentReceipts != nil {
+		prefs.PaymentReceipts = *request.PaymentReceipts
+	}
+	if request.Failures != nil {
+		prefs.Failures = *request.Failures
+	}
+	if request.Announcements != nil {
+		prefs.Announcements = *request.Announcements
+	}
+
+	if err := s.repo.SaveNotificationPreferences(ctx, &prefs); err != nil {
+		return prefs, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка сохранения настроек уведомлений: %w", err))
+	}
+
+	s.recordAudit(ctx, actor, AuditActionUpdate, "notification_preferences", userID, before, prefs)
+
+	return prefs, nil
+}
+
+// Число пользователей, окончательно обезличиваемых за один проход
+const userPurgeBatch = 50
+
+// Хэш telegram_id удаленного пользователя. Позволяет сопоставить обращение бывшего
+// пользователя с его финансовыми документами, не храня сам идентификатор.
+func (s *Service) telegramIDHash(telegramID int64) string {
+	mac := hmac.New(sha256.New, []byte(s.erasure.HashSecret))
+	mac.Write([]byte(strconv.FormatInt(telegramID, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeleteAccount удаляет аккаунт пользователя: отзывает API ключи и обезличивает профиль.
+// По окончании срока хранения фоновая задача окончательно обезличивает аккаунт,
+// сохраняя финансовые документы.
+func (s *Service) DeleteAccount(ctx context.Context, actor Actor, userID int) error {
+	telegramID, err := s.repo.UserTelegramID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Пользователь не найден", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса пользователя: %w", err))
+	}
+
+	now := time.Now()
+	keyHashes, err := s.repo.EraseUser(ctx, userID, s.telegramIDHash(telegramID), now)
+	if errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Пользователь не найден", nil)
+	} else if errors.Is(err, repository.ErrSoleOwner) {
+		return NewError(KindConflict, "Передайте права владельца организации другому участнику перед удалением аккаунта", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка удаления аккаунта", err)
+	}
+
+	for _, keyHash := range keyHashes {
+		s.cache.Delete(ctx, apiKeyCacheKey(keyHash))
+	}
+
+	// Персональные данные в журнал не записываются
+	s.recordAudit(ctx, actor, AuditActionDelete, "user", userID, nil,
+		map[string]any{"deleted_at": now, "purge_after": now.Add(s.erasure.Retention)})
+	return nil
+}
+
+// RunUserPurge периодически окончательно обезличивает аккаунты, срок хранения которых
+// после удаления истек, до отмены контекста
+func (s *Service) RunUserPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			s.purgeUsers(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Окончательное обезличивание аккаунтов с истекшим сроком хранения
+func (s *Service) purgeUsers(ctx context.Context) {
+	userIDs, err := s.repo.DeletedUsers(ctx, time.Now().Add(-s.erasure.Retention), userPurgeBatch)
+	if err != nil {
+		s.logger.Printf("Ошибка получения удаленных пользователей: %v", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		if err := s.repo.PurgeUser(ctx, userID); err != nil {
+			s.logger.Printf("Ошибка удаления данных пользователя %d: %v", userID, err)
+			continue
+		}
+		s.recordAudit(ctx, Actor{}, AuditActionDelete, "user", userID, nil, map[string]string{"status": "purged"})
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"project-znak/internal/labels"
+	"project-znak/internal/models"
+	"project-znak/internal/validate"
+)
+
+// Правила проверки полей запросов, зависящие от предметной области
+func init() {
+	validate.Register("inn", models.ValidateINN)
+	validate.Register("gtin", models.ValidateGTIN)
+	validate.Register("telegram_username", models.ValidateTelegramUsername)
+	validate.Register("product_group", func(group string) error {
+		if !models.IsValidProductGroup(group) {
+			return fmt.Errorf("неизвестная товарная группа %q", group)
+		}
+		return nil
+	})
+	validate.Register("org_role", func(role string) error {
+		if !models.IsValidOrgRole(role) {
+			return fmt.Errorf("допустимые значения: %s, %s, %s, %s",
+				models.OrgRoleOwner, models.OrgRoleAccountant, models.OrgRoleOperator, models.OrgRoleViewer)
+		}
+		return nil
+	})
+	validate.Register("label_template", func(name string) error {
+		if _, ok := labels.Lookup(name); !ok {
+			return fmt.Errorf("неизвестный шаблон этикеток %q", name)
+		}
+		return nil
+	})
+	validate.Register("label_field", func(field string) error {
+		return labels.ValidateFields([]string{field})
+	})
+}
+
+// ValidateRequest проверяет поля запроса по тегам validate. Ошибки полей возвращаются
+// списком в ошибке сервиса вида KindInvalid с общим сообщением.
+func ValidateRequest(request any) error {
+	err := validate.Struct(request)
+	var fields validate.Errors
+	if errors.As(err, &fields) {
+		return &Error{Kind: KindInvalid, Message: "Некорректные параметры запроса", Err: err, Fields: fields}
+	}
+	return err
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"project-znak/internal/models"
+	"project-znak/internal/repository"
+	"project-znak/internal/wildberries"
+)
+
+// Число одновременных запросов привязки кодов к сборочным заданиям Wildberries
+const wildberriesConcurrency = 4
+
+// WildberriesTokenRequest - подключение токена API Wildberries (категория «Маркетплейс»)
+type WildberriesTokenRequest struct {
+	Token string `json:"token" validate:"required,max=2048"`
+}
+
+// WBBindRequest - привязка кодов из остатка к сборочным заданиям поставки Wildberries.
+// Коды берутся из остатка организации или, если она не указана, из личного остатка.
+type WBBindRequest struct {
+	TelegramID     int64  `json:"telegram_id"`
+	OrganizationID int    `json:"organization_id,omitempty"`
+	SupplyID       string `json:"supply_id" validate:"required,max=64"`
+}
+
+// WBBindResult - итог привязки кодов к поставке
+type WBBindResult struct {
+	SupplyID string             `json:"supply_id" xml:"supply_id"`
+	Bound    int                `json:"bound" xml:"bound"`
+	Failed   int                `json:"failed" xml:"failed"`
+	Skipped  int                `json:"skipped" xml:"skipped"`
+	Bindings []models.WBBinding `json:"bindings" xml:"bindings>binding"`
+}
+
+// WildberriesSettings возвращает состояние подключения пользователя к Wildberries
+func (s *Service) WildberriesSettings(ctx context.Context, userID int) (models.WildberriesSettings, error) {
+	token, updatedAt, err := s.repo.WildberriesToken(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.WildberriesSettings{}, nil
+	} else if err != nil {
+		return models.WildberriesSettings{}, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения токена Wildberries: %w", err))
+	}
+	return models.WildberriesSettings{Configured: true, Token: maskToken(token), UpdatedAt: &updatedAt}, nil
+}
+
+// SaveWildberriesToken сохраняет токен API Wildberries пользователя
+func (s *Service) SaveWildberriesToken(ctx context.Context, actor Actor, request WildberriesTokenRequest) (models.WildberriesSettings, error) {
+	if err := ValidateRequest(request); err != nil {
+		return models.WildberriesSettings{}, err
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return models.WildberriesSettings{}, err
+	}
+
+	token := strings.TrimSpace(request.Token)
+	updatedAt, err := s.repo.SaveWildberriesToken(ctx, userID, token)
+	if err != nil {
+		return models.WildberriesSettings{}, NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка сохранения токена Wildberries: %w", err))
+	}
+
+	// Сам токен в журнал аудита не попадает
+	s.recordAudit(ctx, actor, AuditActionUpdate, "wildberries_token", userID, nil, map[string]string{"token": maskToken(token)})
+	return models.WildberriesSettings{Configured: true, Token: maskToken(token), UpdatedAt: &updatedAt}, nil
+}
+
+// DeleteWildberriesToken отключает пользователя от Wildberries
+func (s *Service) DeleteWildberriesToken(ctx context.Context, actor Actor, userID int) error {
+	if err := s.repo.DeleteWildberriesToken(ctx, userID); errors.Is(err, repository.ErrNotFound) {
+		return NewError(KindNotFound, "Токен Wildberries не подключен", nil)
+	} else if err != nil {
+		return NewError(KindInternal, "Ошибка при сохранении данных", fmt.Errorf("ошибка удаления токена Wildberries: %w", err))
+	}
+	s.recordAudit(ctx, actor, AuditActionDelete, "wildberries_token", userID, nil, nil)
+	return nil
+}
+
+// BindWildberriesSupply привязывает коды маркировки к сборочным заданиям поставки FBS.
+// Для каждого задания берется доступный код GTIN, соответствующего штрихкоду товара;
+// коды, принятые Wildberries, отмечаются использованными, остальные возвращаются в остаток.
+func (s *Service) BindWildberriesSupply(ctx context.Context, actor Actor, request WBBindRequest) (*WBBindResult, error) {
+	if err := ValidateRequest(request); err != nil {
+		return nil, err
+	}
+	if !s.wildberries.Enabled() {
+		return nil, NewError(KindUnavailable, "Интеграция с Wildberries не настроена", nil)
+	}
+	userID, err := s.actorUserID(ctx, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkInventoryAccess(ctx, userID, request.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	token, _, err := s.repo.WildberriesToken(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewError(KindInvalid, "Подключите токен API Wildberries", nil)
+	} else if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при обработке запроса", fmt.Errorf("ошибка получения токена Wildberries: %w", err))
+	}
+
+	orders, err := s.wildberries.SupplyOrders(ctx, token, request.SupplyID)
+	if err != nil {
+		return nil, wildberriesError("Ошибка получения сборочных заданий Wildberries", err)
+	}
+	if len(orders) == 0 {
+		return nil, NewError(KindNotFound, "В поставке нет сборочных заданий", nil)
+	}
+
+	bindings := make([]models.WBBinding, len(orders))
+	wanted := make(map[string]int)
+	for i, order := range orders {
+		bindings[i] = models.WBBinding{
+			UserID:         userID,
+			OrganizationID: request.OrganizationID,
+			SupplyID:       request.SupplyID,
+			OrderID:        order.ID,
+			Status:         models.WBBindingStatusSkipped,
+		}
+		for _, sku := range order.SKUs {
+			if gtin, ok := wildberries.BarcodeGTIN(sku); ok {
+				bindings[i].Barcode, bindings[i].GTIN = sku, gtin
+				wanted[gtin]++
+				break
+			}
+		}
+		if bindings[i].GTIN == "" {
+			bindings[i].Error = "Штрихкод товара не соответствует GTIN"
+		}
+	}
+
+	// Число кодов GTIN ограничивается доступным остатком, недостающие задания пропускаются
+	stock, err := s.repo.Inventory(ctx, userID, request.OrganizationID)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка запроса остатков: %w", err))
+	}
+	available := make(map[string]int, len(wanted))
+	for _, item := range stock {
+		if count := min(wanted[item.GTIN], item.Available); count > 0 {
+			available[item.GTIN] = count
+		}
+	}
+	codes, reservationID, err := s.reserveCodes(ctx, userID, request.OrganizationID, "Wildberries "+request.SupplyID, available)
+	if err != nil {
+		return nil, err
+	}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(wildberriesConcurrency)
+	for i := range bindings {
+		b := &bindings[i]
+		if b.GTIN == "" {
+			continue
+		}
+		if len(codes[b.GTIN]) == 0 {
+			b.Error = "Нет доступных кодов GTIN " + b.GTIN
+			continue
+		}
+		b.Code, codes[b.GTIN] = codes[b.GTIN][0], codes[b.GTIN][1:]
+		group.Go(func() error {
+			if err := s.wildberries.SetOrderCodes(groupCtx, token, b.OrderID, []string{b.Code}); err != nil {
+				b.Status, b.Error = models.WBBindingStatusFailed, err.Error()
+			} else {
+				b.Status = models.WBBindingStatusBound
+			}
+			return nil
+		})
+	}
+	group.Wait()
+
+	result := &WBBindResult{SupplyID: request.SupplyID, Bindings: bindings}
+	var bound []string
+	for _, b := range bindings {
+		switch b.Status {
+		case models.WBBindingStatusBound:
+			result.Bound++
+			bound = append(bound, b.Code)
+		case models.WBBindingStatusFailed:
+			result.Failed++
+		default:
+			result.Skipped++
+		}
+	}
+
+	if err := s.settleReservation(ctx, userID, request.OrganizationID, reservationID, bound); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveWBBindings(ctx, result.Bindings); err != nil {
+		s.logger.Printf("Ошибка сохранения результатов привязки поставки %s: %v", request.SupplyID, err)
+	}
+	s.recordAudit(ctx, actor, AuditActionCreate, "wildberries_supply", request.SupplyID, nil, map[string]any{
+		"organization_id": request.OrganizationID,
+		"bound":           result.Bound,
+		"failed":          result.Failed,
+		"skipped":         result.Skipped,
+	})
+	return result, nil
+}
+
+// WildberriesBindings возвращает последние результаты привязки кодов к поставкам
+func (s *Service) WildberriesBindings(ctx context.Context, userID, organizationID int, supplyID string, limit int) ([]models.WBBinding, error) {
+	if err := s.checkInventoryAccess(ctx, userID, organizationID); err != nil {
+		return nil, err
+	}
+	bindings, err := s.repo.WBBindings(ctx, userID, organizationID, supplyID, limit)
+	if err != nil {
+		return nil, NewError(KindInternal, "Ошибка при получении данных", fmt.Errorf("ошибка получения результатов привязки: %w", err))
+	}
+	return bindings, nil
+}
+
+// Ошибка обращения к Wildberries: отклоненный токен и неизвестная поставка - ошибки
+// запроса пользователя, остальные ошибки - недоступность внешнего сервиса
+func wildberriesError(message string, err error) error {
+	if errors.Is(err, wildberries.ErrUnauthorized) {
+		return NewError(KindInvalid, "Wildberries отклонил токен API: проверьте токен и его категорию «Маркетплейс»", err)
+	}
+	if errors.Is(err, wildberries.ErrNotFound) {
+		return NewError(KindNotFound, "Поставка не найдена в Wildberries", err)
+	}
+	return NewError(KindUnavailable, message, err)
+}
+
+// Маскирование токена для ответа и журнала: видны только последние 4 символа
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return "****"
+	}
+	return "****" + token[len(token)-4:]
+}
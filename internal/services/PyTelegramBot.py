@@ -2,9 +2,10 @@ import logging
 import psycopg2  # type: ignore
 from reportlab.lib.pagesizes import letter  # type: ignore
 from reportlab.pdfgen import canvas  # type: ignore
-from telegram import Update  # type: ignore
-from telegram.ext import Updater, CommandHandler, CallbackContext  # type: ignore
+from telegram import InlineKeyboardButton, InlineKeyboardMarkup, Update  # type: ignore
+from telegram.ext import Updater, CommandHandler, CallbackQueryHandler, CallbackContext  # type: ignore
 import requests  # type: ignore
+import io
 import os
 import json
 from typing import List, Dict, Optional, Any, Union
@@ -26,6 +27,206 @@ DB_CONFIG = {
 GO_SERVICE_URL = os.getenv('GO_SERVICE_URL', "http://localhost:8080")
 API_KIZS_ENDPOINT = "/api/v1/kizs"  # Обновленный эндпоинт в соответствии с Go-сервисом
 API_PAYMENTS_ENDPOINT = "/api/v1/payments"  # Обновленный эндпоинт
+API_DOCUMENTS_ENDPOINT = "/api/documents"  # Документы ввода в оборот
+API_CONFIRMATIONS_ENDPOINT = "/api/confirmations"  # Подтверждение операций кодом
+API_LANGUAGE_ENDPOINT = "/api/users/language"  # Язык сообщений пользователя
+API_ORDERS_ENDPOINT = "/api/orders"  # Заказы и повтор заказа
+API_ORDER_TEMPLATES_ENDPOINT = "/api/orders/templates"  # Шаблоны заказов
+API_CART_ENDPOINT = "/api/cart"  # Корзина, хранится на сервере
+API_ORDER_SCHEDULES_ENDPOINT = "/api/orders/schedules"  # Расписания заказов
+API_REQUESTS_ENDPOINT = "/api/requests"  # История запросов КИЗ
+API_REQUESTS_STATUS_BATCH_ENDPOINT = "/api/requests/status/batch"  # Статус нескольких запросов КИЗ
+
+# Число заказов в списке /orders
+RECENT_ORDERS_LIMIT = 5
+
+# Число запросов КИЗ в сводке /requests
+RECENT_REQUESTS_LIMIT = 10
+
+# Язык сообщений по умолчанию
+DEFAULT_LANGUAGE = "ru"
+
+# Тексты бота на поддерживаемых языках. Сообщения Go-сервиса переводятся на его стороне
+# по заголовку Accept-Language.
+TEXTS: Dict[str, Dict[str, str]] = {
+    "ru": {
+        "status_draft": "📝 черновик",
+        "status_submitted": "⏳ отправлен, ожидает проверки",
+        "status_accepted": "✅ принят",
+        "status_rejected": "❌ отклонен",
+        "unknown_error": "Неизвестная ошибка",
+        "error": "❌ Ошибка: {message}",
+        "connection_error": "🚫 Ошибка связи с сервером: {error}",
+        "connection_error_short": "🚫 Ошибка связи с сервером",
+        "format_error": "⚠️ Ошибка формата ответа сервера",
+        "unexpected_error": "⚠️ Произошла ошибка: {error}",
+        "requestkiz_usage": "Используйте: /requestkiz <gtin1> <кол-во1> [<gtin2> <кол-во2>...] [inn <ИНН>]",
+        "invalid_arguments": "Некорректный формат аргументов.",
+        "gtin_required": "Необходимо указать хотя бы один GTIN с количеством.",
+        "inn_required": "Необходимо указать ИНН (inn <номер>).",
+        "kizs_received": "✅ КИЗы получены",
+        "kizs_first": "\nПолучено {count} КИЗов. Первые 10:\n",
+        "kizs_list": "\nСписок КИЗ:\n",
+        "files": "\nФайлы: ",
+        "document": "Документ №{id} по заказу №{order_id}\nСтатус: {status}\nКодов маркировки: {codes}",
+        "document_reason": "\nПричина: {error}",
+        "introduce_usage": "Используйте: /introduce <ID заказа> produced <дата производства ГГГГ-ММ-ДД>\n"
+                           "или /introduce <ID заказа> imported <дата ввоза> <номер декларации> <дата декларации>",
+        "order_id_number": "⚠️ ID заказа должен быть числом",
+        "submit_hint": "\n\nДля отправки в Честный ЗНАК: /submitdoc {id}",
+        "submitdoc_usage": "Используйте: /submitdoc <ID документа>",
+        "submitting": "⏳ Подписание и отправка документа...",
+        "docstatus_hint": "\n\nПроверить статус: /docstatus {id}",
+        "docstatus_usage": "Используйте: /docstatus <ID документа>",
+        "invalid_button": "Некорректные данные кнопки",
+        "operation_confirmed": "✅ Операция подтверждена",
+        "operation_rejected": "❌ Операция отклонена",
+        "start": "👋 Здравствуйте, {name}!\n\n"
+                 "Я бот для работы с Честным ЗНАКом. Доступные команды:\n"
+                 "/requestkiz - запросить КИЗы\n"
+                 "/pay - создать платеж\n"
+                 "/introduce - создать документ ввода в оборот по заказу\n"
+                 "/submitdoc - отправить документ в Честный ЗНАК\n"
+                 "/docstatus - статус документа и квитанция\n"
+                 "/orders - последние заказы и их повтор\n"
+                 "/templates - заказ по шаблону\n"
+                 "/cart, /add, /remove, /checkout - корзина и оформление заказа\n"
+                 "/schedules - расписания заказов\n"
+                 "/requests - сводка последних запросов КИЗ\n"
+                 "/language - язык сообщений (ru, en)",
+        "pay_usage": "Используйте: /pay <сумма> <ID заказа>",
+        "amount_positive": "⚠️ Сумма должна быть положительным числом",
+        "creating_payment": "⏳ Создание платежа...",
+        "payment_url": "🔗 Ссылка для оплаты: {url}",
+        "payment_failed": "⚠️ Не удалось создать платеж. Пожалуйста, попробуйте позже.",
+        "amount_number": "⚠️ Сумма должна быть числом. Пример: /pay 100.50 order123",
+        "language_usage": "Используйте: /language <ru|en>",
+        "language_set": "✅ Сообщения будут приходить на русском языке",
+        "orders_empty": "У вас пока нет заказов",
+        "orders_title": "Последние заказы:\n",
+        "order_line": "№{id} от {date}: {amount} ₽, {status}",
+        "reorder_button": "🔁 Повторить №{id}",
+        "templates_empty": "Шаблонов заказов нет. Шаблон создается запросом POST /api/orders/templates",
+        "templates_title": "Шаблоны заказов:\n",
+        "template_line": "{name}: позиций {items}",
+        "template_button": "🛒 {name}",
+        "schedules_empty": "Расписаний заказов нет. Расписание создается запросом POST /api/orders/schedules",
+        "schedules_title": "Расписания заказов:\n",
+        "schedule_line": "{name} ({cron}): {status}, следующий запуск {next_run}",
+        "schedule_pause_button": "⏸ Приостановить «{name}»",
+        "schedule_resume_button": "▶️ Возобновить «{name}»",
+        "schedule_paused": "⏸ Расписание «{name}» приостановлено",
+        "schedule_resumed": "▶️ Расписание «{name}» возобновлено, следующий запуск {next_run}",
+        "requests_empty": "Запросов КИЗ еще не было",
+        "requests_title": "Последние запросы КИЗ:\n",
+        "request_line": "№{id} от {date}: {status}, кодов {received} из {requested} ({progress}%)",
+        "request_file": " 📄",
+        "order_created": "✅ Создан заказ №{id} на сумму {amount} ₽\nДля оплаты: /pay {amount} {id}",
+        "cart_empty": "🛒 Корзина пуста. Добавьте товар: /add <GTIN> <кол-во>",
+        "cart_line": "{gtin} {name}: {quantity} × {price} ₽",
+        "cart_total": "\nИтого: кодов {codes} на сумму {amount} ₽\nОформить заказ: /checkout",
+        "add_usage": "Используйте: /add <GTIN> <кол-во>",
+        "remove_usage": "Используйте: /remove <GTIN>",
+        "quantity_number": "⚠️ Количество должно быть положительным числом",
+        "checkout_created": "✅ Создан заказ №{id} на сумму {amount} ₽",
+        "checkout_pay": "\n🔗 Ссылка для оплаты: {url}",
+    },
+    "en": {
+        "status_draft": "📝 draft",
+        "status_submitted": "⏳ submitted, awaiting review",
+        "status_accepted": "✅ accepted",
+        "status_rejected": "❌ rejected",
+        "unknown_error": "Unknown error",
+        "error": "❌ Error: {message}",
+        "connection_error": "🚫 Server connection error: {error}",
+        "connection_error_short": "🚫 Server connection error",
+        "format_error": "⚠️ Invalid server response format",
+        "unexpected_error": "⚠️ An error occurred: {error}",
+        "requestkiz_usage": "Usage: /requestkiz <gtin1> <count1> [<gtin2> <count2>...] [inn <INN>]",
+        "invalid_arguments": "Invalid argument format.",
+        "gtin_required": "Specify at least one GTIN with a count.",
+        "inn_required": "Specify the INN (inn <number>).",
+        "kizs_received": "✅ Marking codes received",
+        "kizs_first": "\nReceived {count} marking codes. First 10:\n",
+        "kizs_list": "\nMarking codes:\n",
+        "files": "\nFiles: ",
+        "document": "Document #{id} for order #{order_id}\nStatus: {status}\nMarking codes: {codes}",
+        "document_reason": "\nReason: {error}",
+        "introduce_usage": "Usage: /introduce <order ID> produced <production date YYYY-MM-DD>\n"
+                           "or /introduce <order ID> imported <import date> <declaration number> <declaration date>",
+        "order_id_number": "⚠️ Order ID must be a number",
+        "submit_hint": "\n\nTo send to Chestny ZNAK: /submitdoc {id}",
+        "submitdoc_usage": "Usage: /submitdoc <document ID>",
+        "submitting": "⏳ Signing and sending the document...",
+        "docstatus_hint": "\n\nCheck the status: /docstatus {id}",
+        "docstatus_usage": "Usage: /docstatus <document ID>",
+        "invalid_button": "Invalid button data",
+        "operation_confirmed": "✅ Operation confirmed",
+        "operation_rejected": "❌ Operation rejected",
+        "start": "👋 Hello, {name}!\n\n"
+                 "I am a bot for working with Chestny ZNAK. Available commands:\n"
+                 "/requestkiz - request marking codes\n"
+                 "/pay - create a payment\n"
+                 "/introduce - create an introduction document for an order\n"
+                 "/submitdoc - send a document to Chestny ZNAK\n"
+                 "/docstatus - document status and receipt\n"
+                 "/orders - recent orders and reordering\n"
+                 "/templates - order from a template\n"
+                 "/cart, /add, /remove, /checkout - cart and checkout\n"
+                 "/schedules - order schedules\n"
+                 "/requests - recent marking code requests\n"
+                 "/language - message language (ru, en)",
+        "pay_usage": "Usage: /pay <amount> <order ID>",
+        "amount_positive": "⚠️ Amount must be a positive number",
+        "creating_payment": "⏳ Creating the payment...",
+        "payment_url": "🔗 Payment link: {url}",
+        "payment_failed": "⚠️ Failed to create the payment. Please try again later.",
+        "amount_number": "⚠️ Amount must be a number. Example: /pay 100.50 order123",
+        "language_usage": "Usage: /language <ru|en>",
+        "language_set": "✅ Messages will be sent in English",
+        "orders_empty": "You have no orders yet",
+        "orders_title": "Recent orders:\n",
+        "order_line": "#{id} of {date}: {amount} RUB, {status}",
+        "reorder_button": "🔁 Reorder #{id}",
+        "templates_empty": "No order templates. A template is created with POST /api/orders/templates",
+        "templates_title": "Order templates:\n",
+        "template_line": "{name}: {items} items",
+        "template_button": "🛒 {name}",
+        "schedules_empty": "No order schedules. A schedule is created with POST /api/orders/schedules",
+        "schedules_title": "Order schedules:\n",
+        "schedule_line": "{name} ({cron}): {status}, next run {next_run}",
+        "schedule_pause_button": "⏸ Pause \"{name}\"",
+        "schedule_resume_button": "▶️ Resume \"{name}\"",
+        "schedule_paused": "⏸ Schedule \"{name}\" paused",
+        "schedule_resumed": "▶️ Schedule \"{name}\" resumed, next run {next_run}",
+        "requests_empty": "No marking code requests yet",
+        "requests_title": "Recent marking code requests:\n",
+        "request_line": "#{id} of {date}: {status}, {received} of {requested} codes ({progress}%)",
+        "request_file": " 📄",
+        "order_created": "✅ Order #{id} created for {amount} RUB\nTo pay: /pay {amount} {id}",
+        "cart_empty": "🛒 The cart is empty. Add an item: /add <GTIN> <count>",
+        "cart_line": "{gtin} {name}: {quantity} × {price} RUB",
+        "cart_total": "\nTotal: {codes} codes for {amount} RUB\nPlace the order: /checkout",
+        "add_usage": "Usage: /add <GTIN> <count>",
+        "remove_usage": "Usage: /remove <GTIN>",
+        "quantity_number": "⚠️ Count must be a positive number",
+        "checkout_created": "✅ Order #{id} created for {amount} RUB",
+        "checkout_pay": "\n🔗 Payment link: {url}",
+    },
+}
+
+def user_language(update: Update, context: CallbackContext) -> str:
+    #"""Язык пользователя: выбранный командой /language или язык клиента Telegram."""
+    language = context.user_data.get("language") or (update.effective_user.language_code or "")[:2].lower()
+    return language if language in TEXTS else DEFAULT_LANGUAGE
+
+def tr(update: Update, context: CallbackContext, key: str, **kwargs: Any) -> str:
+    #"""Текст бота на языке пользователя."""
+    return TEXTS[user_language(update, context)][key].format(**kwargs)
+
+def api_headers(update: Update, context: CallbackContext) -> Dict[str, str]:
+    #"""Заголовки запроса к Go-сервису: сообщения ответа на языке пользователя."""
+    return {"Accept-Language": user_language(update, context)}
 
 def create_connection():
     #"""Создает соединение с базой данных PostgreSQL."""
@@ -71,7 +272,7 @@ def add_user(username: str, email: str, price: float) -> bool:
         if conn:
             conn.close()
 
-def create_payment(amount: float, order_id: str, telegram_id: int) -> Optional[str]:
+def create_payment(amount: float, order_id: str, telegram_id: int, headers: Dict[str, str]) -> Optional[str]:
     #"""Создает платеж через Go-сервис и возвращает URL для оплаты."""
     data = {"amount": amount, "order_id": order_id}
     try:
@@ -79,6 +280,7 @@ def create_payment(amount: float, order_id: str, telegram_id: int) -> Optional[s
             f"{GO_SERVICE_URL}{API_PAYMENTS_ENDPOINT}",
             json=data,
             params={"telegram_id": telegram_id},
+            headers=headers,
             timeout=10  # Добавлен таймаут
         )
         response.raise_for_status()
@@ -99,7 +301,7 @@ def create_payment(amount: float, order_id: str, telegram_id: int) -> Optional[s
 def request_kiz_command(update: Update, context: CallbackContext) -> None:
     #"""Обрабатывает команду /requestkiz для запроса КИЗ."""
     if len(context.args) < 2:
-        update.message.reply_text("Используйте: /requestkiz <gtin1> <кол-во1> [<gtin2> <кол-во2>...] [inn <ИНН>]")
+        update.message.reply_text(tr(update, context, "requestkiz_usage"))
         return
 
     # Парсинг аргументов
@@ -118,16 +320,16 @@ def request_kiz_command(update: Update, context: CallbackContext) -> None:
             gtin_data.append({"gtin": gtin, "count": count})
             i += 2
         except (ValueError, IndexError):
-            update.message.reply_text("Некорректный формат аргументов.")
+            update.message.reply_text(tr(update, context, "invalid_arguments"))
             return
 
     # Проверка наличия данных
     if not gtin_data:
-        update.message.reply_text("Необходимо указать хотя бы один GTIN с количеством.")
+        update.message.reply_text(tr(update, context, "gtin_required"))
         return
     
     if not inn:
-        update.message.reply_text("Необходимо указать ИНН (inn <номер>).")
+        update.message.reply_text(tr(update, context, "inn_required"))
         return
 
     # Отправка запроса в Go-сервис
@@ -136,79 +338,539 @@ def request_kiz_command(update: Update, context: CallbackContext) -> None:
             f"{GO_SERVICE_URL}{API_KIZS_ENDPOINT}",
             json={"gtin_data": gtin_data, "inn": inn},
             params={"telegram_id": telegram_id},
+            headers=api_headers(update, context),
             timeout=30  # Увеличенный таймаут для запроса КИЗ
         )
         response.raise_for_status()
         result = response.json()
         
         if result.get("status") == "success":
-            message = result.get("message", "✅ КИЗы получены")
+            message = result.get("message", tr(update, context, "kizs_received"))
             
             # Добавляем информацию о КИЗах в сообщение
             if "kizs" in result and result["kizs"]:
                 kizs_list = result["kizs"]
                 if len(kizs_list) > 10:
                     # Если список слишком длинный, показываем только первые 10 элементов
-                    message += f"\nПолучено {len(kizs_list)} КИЗов. Первые 10:\n" + "\n".join(kizs_list[:10]) + "\n..."
+                    message += tr(update, context, "kizs_first", count=len(kizs_list)) + "\n".join(kizs_list[:10]) + "\n..."
                 else:
-                    message += "\nСписок КИЗ:\n" + "\n".join(kizs_list)
+                    message += tr(update, context, "kizs_list") + "\n".join(kizs_list)
             
             # Добавляем информацию о файлах
             if "file_paths" in result and result["file_paths"]:
-                message += "\nФайлы: " + ", ".join(result["file_paths"])
+                message += tr(update, context, "files") + ", ".join(result["file_paths"])
             
             update.message.reply_text(message)
         else:
-            update.message.reply_text(f"❌ Ошибка: {result.get('message', 'Неизвестная ошибка')}")
+            update.message.reply_text(tr(update, context, "error", message=result.get("message", tr(update, context, "unknown_error"))))
     except requests.exceptions.RequestException as e:
         logger.error(f"Ошибка запроса КИЗ: {e}")
-        update.message.reply_text(f"🚫 Ошибка связи с сервером: {str(e)}")
+        update.message.reply_text(tr(update, context, "connection_error", error=e))
     except json.JSONDecodeError as e:
         logger.error(f"Ошибка декодирования JSON ответа: {e}")
-        update.message.reply_text("⚠️ Ошибка формата ответа сервера")
+        update.message.reply_text(tr(update, context, "format_error"))
     except Exception as e:
         logger.error(f"Непредвиденная ошибка: {e}")
-        update.message.reply_text(f"⚠️ Произошла ошибка: {str(e)}")
+        update.message.reply_text(tr(update, context, "unexpected_error", error=e))
+
+def format_document(update: Update, context: CallbackContext, document: Dict[str, Any]) -> str:
+    #"""Формирует описание документа ввода в оборот для сообщения."""
+    status = document.get("status", "")
+    texts = TEXTS[user_language(update, context)]
+    message = tr(update, context, "document",
+                 id=document.get("id"),
+                 order_id=document.get("order_id"),
+                 status=texts.get(f"status_{status}", status),
+                 codes=len(document.get("codes") or []))
+    if document.get("error"):
+        message += tr(update, context, "document_reason", error=document["error"])
+    return message
+
+def document_request(update: Update, context: CallbackContext, method: str, path: str,
+                     payload: Optional[Dict[str, Any]] = None) -> requests.Response:
+    #"""Выполняет запрос к API документов ввода в оборот."""
+    return requests.request(
+        method,
+        f"{GO_SERVICE_URL}{API_DOCUMENTS_ENDPOINT}{path}",
+        json=payload,
+        params={"telegram_id": update.effective_user.id},
+        headers=api_headers(update, context),
+        timeout=30
+    )
+
+def introduce_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /introduce для создания документа ввода в оборот."""
+    usage = tr(update, context, "introduce_usage")
+    if len(context.args) < 3:
+        update.message.reply_text(usage)
+        return
+
+    try:
+        payload = {
+            "telegram_id": update.effective_user.id,
+            "order_id": int(context.args[0]),
+            "production_type": context.args[1].lower(),
+            "production_date": context.args[2],
+        }
+    except ValueError:
+        update.message.reply_text(tr(update, context, "order_id_number"))
+        return
+
+    if payload["production_type"] == "imported":
+        if len(context.args) < 5:
+            update.message.reply_text(usage)
+            return
+        payload["declaration_number"] = context.args[3]
+        payload["declaration_date"] = context.args[4]
+
+    try:
+        response = document_request(update, context, "POST", "", payload)
+        result = response.json()
+        if result.get("status") != "success":
+            update.message.reply_text(tr(update, context, "error", message=result.get("message", tr(update, context, "unknown_error"))))
+            return
+
+        document = result["document"]
+        update.message.reply_text(
+            format_document(update, context, document) +
+            tr(update, context, "submit_hint", id=document["id"])
+        )
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка создания документа: {e}")
+        update.message.reply_text(tr(update, context, "connection_error", error=e))
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        update.message.reply_text(tr(update, context, "format_error"))
+
+def submit_document_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /submitdoc для отправки документа в Честный ЗНАК."""
+    if not context.args or not context.args[0].isdigit():
+        update.message.reply_text(tr(update, context, "submitdoc_usage"))
+        return
+
+    try:
+        update.message.reply_text(tr(update, context, "submitting"))
+        response = document_request(update, context, "POST", f"/{context.args[0]}/submit")
+        result = response.json()
+        if result.get("status") != "success":
+            update.message.reply_text(tr(update, context, "error", message=result.get("message", tr(update, context, "unknown_error"))))
+            return
+
+        update.message.reply_text(
+            format_document(update, context, result["document"]) +
+            tr(update, context, "docstatus_hint", id=context.args[0])
+        )
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка отправки документа: {e}")
+        update.message.reply_text(tr(update, context, "connection_error", error=e))
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        update.message.reply_text(tr(update, context, "format_error"))
+
+def document_status_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /docstatus: статус документа и квитанция о вводе в оборот."""
+    if not context.args or not context.args[0].isdigit():
+        update.message.reply_text(tr(update, context, "docstatus_usage"))
+        return
+
+    document_id = context.args[0]
+    try:
+        response = document_request(update, context, "GET", f"/{document_id}")
+        result = response.json()
+        if result.get("status") != "success":
+            update.message.reply_text(tr(update, context, "error", message=result.get("message", tr(update, context, "unknown_error"))))
+            return
+
+        document = result["document"]
+        update.message.reply_text(format_document(update, context, document))
+
+        # Для принятого документа отправляется квитанция
+        if document.get("status") == "accepted":
+            receipt = document_request(update, context, "GET", f"/{document_id}/receipt")
+            receipt.raise_for_status()
+            update.message.reply_document(
+                document=io.BytesIO(receipt.content),
+                filename=f"receipt_{document_id}.pdf"
+            )
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка получения документа: {e}")
+        update.message.reply_text(tr(update, context, "connection_error", error=e))
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        update.message.reply_text(tr(update, context, "format_error"))
+
+def confirmation_callback(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает кнопки «Подтвердить» и «Отклонить» под сообщением с кодом подтверждения."""
+    query = update.callback_query
+    try:
+        action, confirmation_id, code = query.data.split(":")
+    except ValueError:
+        query.answer(tr(update, context, "invalid_button"))
+        return
+
+    path = "approve" if action == "confirm" else "reject"
+    try:
+        response = requests.post(
+            f"{GO_SERVICE_URL}{API_CONFIRMATIONS_ENDPOINT}/{confirmation_id}/{path}",
+            json={"telegram_id": update.effective_user.id, "code": code},
+            headers=api_headers(update, context),
+            timeout=10
+        )
+        result = response.json()
+        if result.get("status") != "success":
+            query.answer(result.get("message", tr(update, context, "unknown_error")), show_alert=True)
+            return
+
+        query.answer()
+        status = tr(update, context, "operation_confirmed" if action == "confirm" else "operation_rejected")
+        query.edit_message_text(f"{status}\n\n{result['confirmation'].get('description', '')}")
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка подтверждения операции: {e}")
+        query.answer(tr(update, context, "connection_error_short"), show_alert=True)
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        query.answer(tr(update, context, "format_error"), show_alert=True)
+
+def orders_request(update: Update, context: CallbackContext, method: str, path: str,
+                   params: Optional[Dict[str, Any]] = None,
+                   payload: Optional[Dict[str, Any]] = None) -> Dict[str, Any]:
+    #"""Выполняет запрос к API заказов и корзины и возвращает ответ."""
+    response = requests.request(
+        method,
+        f"{GO_SERVICE_URL}{path}",
+        json=payload,
+        params={"telegram_id": update.effective_user.id, **(params or {})},
+        headers=api_headers(update, context),
+        timeout=30
+    )
+    return response.json()
+
+def orders_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /orders: последние заказы с кнопками повтора."""
+    try:
+        result = orders_request(update, context, "GET", API_ORDERS_ENDPOINT, {"limit": RECENT_ORDERS_LIMIT})
+        if result.get("status") != "success":
+            update.message.reply_text(tr(update, context, "error", message=result.get("message", tr(update, context, "unknown_error"))))
+            return
+
+        orders = result.get("orders") or []
+        if not orders:
+            update.message.reply_text(tr(update, context, "orders_empty"))
+            return
+
+        lines = [tr(update, context, "order_line",
+                    id=order["id"],
+                    date=order.get("created_at", "")[:10],
+                    amount=f"{order.get('total_amount', 0):.2f}",
+                    status=order.get("status", "")) for order in orders]
+        buttons = [[InlineKeyboardButton(tr(update, context, "reorder_button", id=order["id"]),
+                                         callback_data=f"reorder:{order['id']}")] for order in orders]
+        update.message.reply_text(tr(update, context, "orders_title") + "\n".join(lines),
+                                  reply_markup=InlineKeyboardMarkup(buttons))
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка получения заказов: {e}")
+        update.message.reply_text(tr(update, context, "connection_error", error=e))
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        update.message.reply_text(tr(update, context, "format_error"))
+
+def templates_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /templates: шаблоны заказов с кнопками заказа."""
+    try:
+        result = orders_request(update, context, "GET", API_ORDER_TEMPLATES_ENDPOINT)
+        if result.get("status") != "success":
+            update.message.reply_text(tr(update, context, "error", message=result.get("message", tr(update, context, "unknown_error"))))
+            return
+
+        templates = result.get("templates") or []
+        if not templates:
+            update.message.reply_text(tr(update, context, "templates_empty"))
+            return
+
+        lines = [tr(update, context, "template_line", name=template["name"], items=len(template.get("items") or []))
+                 for template in templates]
+        buttons = [[InlineKeyboardButton(tr(update, context, "template_button", name=template["name"]),
+                                         callback_data=f"template:{template['id']}")] for template in templates]
+        update.message.reply_text(tr(update, context, "templates_title") + "\n".join(lines),
+                                  reply_markup=InlineKeyboardMarkup(buttons))
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка получения шаблонов заказов: {e}")
+        update.message.reply_text(tr(update, context, "connection_error", error=e))
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        update.message.reply_text(tr(update, context, "format_error"))
+
+def order_callback(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает кнопки «Повторить» под списком заказов и кнопки заказа по шаблону."""
+    query = update.callback_query
+    try:
+        action, object_id = query.data.split(":")
+        int(object_id)
+    except ValueError:
+        query.answer(tr(update, context, "invalid_button"))
+        return
+
+    if action == "reorder":
+        path = f"{API_ORDERS_ENDPOINT}/{object_id}/reorder"
+    else:
+        path = f"{API_ORDER_TEMPLATES_ENDPOINT}/{object_id}/order"
+    try:
+        result = orders_request(update, context, "POST", path)
+        if result.get("status") != "success":
+            query.answer(result.get("message", tr(update, context, "unknown_error")), show_alert=True)
+            return
+
+        query.answer()
+        order = result["order"]
+        query.message.reply_text(tr(update, context, "order_created",
+                                    id=order["id"], amount=f"{order['total_amount']:.2f}"))
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка создания заказа: {e}")
+        query.answer(tr(update, context, "connection_error_short"), show_alert=True)
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        query.answer(tr(update, context, "format_error"), show_alert=True)
+
+def schedules_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /schedules: расписания заказов с кнопками паузы и возобновления."""
+    try:
+        result = orders_request(update, context, "GET", API_ORDER_SCHEDULES_ENDPOINT)
+        if result.get("status") != "success":
+            update.message.reply_text(tr(update, context, "error", message=result.get("message", tr(update, context, "unknown_error"))))
+            return
+
+        schedules = result.get("schedules") or []
+        if not schedules:
+            update.message.reply_text(tr(update, context, "schedules_empty"))
+            return
+
+        lines = [tr(update, context, "schedule_line",
+                    name=schedule["name"],
+                    cron=schedule["cron"],
+                    status=schedule.get("status", ""),
+                    next_run=(schedule.get("next_run_at") or "—")[:16].replace("T", " ")) for schedule in schedules]
+        buttons = []
+        for schedule in schedules:
+            action = "pause" if schedule.get("status") == "active" else "resume"
+            buttons.append([InlineKeyboardButton(tr(update, context, f"schedule_{action}_button", name=schedule["name"]),
+                                                 callback_data=f"schedule_{action}:{schedule['id']}")])
+        update.message.reply_text(tr(update, context, "schedules_title") + "\n".join(lines),
+                                  reply_markup=InlineKeyboardMarkup(buttons))
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка получения расписаний заказов: {e}")
+        update.message.reply_text(tr(update, context, "connection_error", error=e))
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        update.message.reply_text(tr(update, context, "format_error"))
+
+def schedule_callback(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает кнопки приостановки и возобновления под списком расписаний."""
+    query = update.callback_query
+    try:
+        action, schedule_id = query.data.split(":")
+        int(schedule_id)
+    except ValueError:
+        query.answer(tr(update, context, "invalid_button"))
+        return
+
+    action = action.removeprefix("schedule_")
+    try:
+        result = orders_request(update, context, "POST", f"{API_ORDER_SCHEDULES_ENDPOINT}/{schedule_id}/{action}")
+        if result.get("status") != "success":
+            query.answer(result.get("message", tr(update, context, "unknown_error")), show_alert=True)
+            return
+
+        query.answer()
+        schedule = result["schedule"]
+        if action == "pause":
+            query.message.reply_text(tr(update, context, "schedule_paused", name=schedule["name"]))
+        else:
+            query.message.reply_text(tr(update, context, "schedule_resumed", name=schedule["name"],
+                                        next_run=(schedule.get("next_run_at") or "—")[:16].replace("T", " ")))
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка изменения расписания заказов: {e}")
+        query.answer(tr(update, context, "connection_error_short"), show_alert=True)
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        query.answer(tr(update, context, "format_error"), show_alert=True)
+
+def requests_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /requests: сводка последних запросов КИЗ одним запросом статусов."""
+    try:
+        history = orders_request(update, context, "GET", API_REQUESTS_ENDPOINT, {"limit": RECENT_REQUESTS_LIMIT})
+        if history.get("status") != "success":
+            update.message.reply_text(tr(update, context, "error", message=history.get("message", tr(update, context, "unknown_error"))))
+            return
+
+        ids = [request["id"] for request in history.get("requests") or []]
+        if not ids:
+            update.message.reply_text(tr(update, context, "requests_empty"))
+            return
+
+        result = orders_request(update, context, "POST", API_REQUESTS_STATUS_BATCH_ENDPOINT, payload={"ids": ids})
+        if result.get("status") != "success":
+            update.message.reply_text(tr(update, context, "error", message=result.get("message", tr(update, context, "unknown_error"))))
+            return
+
+        lines = [tr(update, context, "request_line",
+                    id=request["request_id"],
+                    date=request.get("request_time", "")[:10],
+                    status=request.get("status", ""),
+                    received=request.get("codes_received", 0),
+                    requested=request.get("codes_requested", 0),
+                    progress=request.get("progress", 0))
+                 + (tr(update, context, "request_file") if request.get("file_available") else "")
+                 for request in result.get("requests") or []]
+        update.message.reply_text(tr(update, context, "requests_title") + "\n".join(lines))
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка получения статусов запросов КИЗ: {e}")
+        update.message.reply_text(tr(update, context, "connection_error", error=e))
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        update.message.reply_text(tr(update, context, "format_error"))
+
+def format_cart(update: Update, context: CallbackContext, cart: Dict[str, Any]) -> str:
+    #"""Формирует содержимое корзины для сообщения."""
+    items = cart.get("items") or []
+    if not items:
+        return tr(update, context, "cart_empty")
+    lines = [tr(update, context, "cart_line",
+                gtin=item["gtin"],
+                name=item.get("product_name", ""),
+                quantity=item["quantity"],
+                price=f"{item.get('price', 0):.2f}") for item in items]
+    return "\n".join(lines) + tr(update, context, "cart_total",
+                                 codes=cart.get("total_codes", 0),
+                                 amount=f"{cart.get('total_amount', 0):.2f}")
+
+def cart_reply(update: Update, context: CallbackContext, method: str, path: str,
+               payload: Optional[Dict[str, Any]] = None) -> None:
+    #"""Выполняет запрос к корзине и отвечает ее содержимым."""
+    try:
+        result = orders_request(update, context, method, path, payload=payload)
+        if result.get("status") != "success":
+            update.message.reply_text(tr(update, context, "error", message=result.get("message", tr(update, context, "unknown_error"))))
+            return
+        update.message.reply_text(format_cart(update, context, result["cart"]))
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка запроса корзины: {e}")
+        update.message.reply_text(tr(update, context, "connection_error", error=e))
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        update.message.reply_text(tr(update, context, "format_error"))
+
+def cart_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /cart: содержимое корзины с ценами."""
+    cart_reply(update, context, "GET", API_CART_ENDPOINT)
+
+def add_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /add: добавление кодов товара в корзину."""
+    if len(context.args) != 2:
+        update.message.reply_text(tr(update, context, "add_usage"))
+        return
+    if not context.args[1].isdigit() or int(context.args[1]) <= 0:
+        update.message.reply_text(tr(update, context, "quantity_number"))
+        return
+
+    cart_reply(update, context, "POST", f"{API_CART_ENDPOINT}/items", {
+        "telegram_id": update.effective_user.id,
+        "gtin": context.args[0],
+        "quantity": int(context.args[1]),
+    })
+
+def remove_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /remove: удаление товара из корзины."""
+    if len(context.args) != 1 or not context.args[0].isdigit():
+        update.message.reply_text(tr(update, context, "remove_usage"))
+        return
+    cart_reply(update, context, "DELETE", f"{API_CART_ENDPOINT}/items/{context.args[0]}")
+
+def checkout_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /checkout: заказ из корзины и ссылка на оплату."""
+    try:
+        result = orders_request(update, context, "POST", f"{API_CART_ENDPOINT}/checkout")
+        if result.get("status") != "success":
+            update.message.reply_text(tr(update, context, "error", message=result.get("message", tr(update, context, "unknown_error"))))
+            return
+
+        order = result["order"]
+        amount = f"{order['total_amount']:.2f}"
+        message = tr(update, context, "checkout_created", id=order["id"], amount=amount)
+        if result.get("redirect_url"):
+            message += tr(update, context, "checkout_pay", url=result["redirect_url"])
+        else:
+            # Платеж не создан: заказ оплачивается отдельно
+            message = tr(update, context, "order_created", id=order["id"], amount=amount) + "\n\n" + result.get("message", "")
+        update.message.reply_text(message)
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка оформления корзины: {e}")
+        update.message.reply_text(tr(update, context, "connection_error", error=e))
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        update.message.reply_text(tr(update, context, "format_error"))
 
 def start(update: Update, context: CallbackContext) -> None:
     #"""Обрабатывает команду /start."""
     user = update.effective_user
-    update.message.reply_text(
-        f"👋 Здравствуйте, {user.first_name}!\n\n"
-        "Я бот для работы с Честным ЗНАКом. Доступные команды:\n"
-        "/requestkiz - запросить КИЗы\n"
-        "/pay - создать платеж"
-    )
+    update.message.reply_text(tr(update, context, "start", name=user.first_name))
 
 def pay_command(update: Update, context: CallbackContext) -> None:
     #"""Обрабатывает команду /pay для создания платежа."""
     if not context.args or len(context.args) < 2:
-        update.message.reply_text("Используйте: /pay <сумма> <ID заказа>")
+        update.message.reply_text(tr(update, context, "pay_usage"))
         return
 
     try:
         amount = float(context.args[0])
         if amount <= 0:
-            update.message.reply_text("⚠️ Сумма должна быть положительным числом")
+            update.message.reply_text(tr(update, context, "amount_positive"))
             return
             
         order_id = context.args[1]
         telegram_id = update.effective_user.id
         
-        update.message.reply_text("⏳ Создание платежа...")
+        update.message.reply_text(tr(update, context, "creating_payment"))
         
-        payment_url = create_payment(amount, order_id, telegram_id)
+        payment_url = create_payment(amount, order_id, telegram_id, api_headers(update, context))
         if payment_url:
-            update.message.reply_text(f"🔗 Ссылка для оплаты: {payment_url}")
+            update.message.reply_text(tr(update, context, "payment_url", url=payment_url))
         else:
-            update.message.reply_text("⚠️ Не удалось создать платеж. Пожалуйста, попробуйте позже.")
+            update.message.reply_text(tr(update, context, "payment_failed"))
     except ValueError:
-        update.message.reply_text("⚠️ Сумма должна быть числом. Пример: /pay 100.50 order123")
+        update.message.reply_text(tr(update, context, "amount_number"))
     except IndexError:
-        update.message.reply_text("Используйте: /pay <сумма> <ID заказа>")
+        update.message.reply_text(tr(update, context, "pay_usage"))
     except Exception as e:
         logger.error(f"Ошибка в команде оплаты: {e}")
-        update.message.reply_text(f"⚠️ Произошла ошибка: {str(e)}")
+        update.message.reply_text(tr(update, context, "unexpected_error", error=e))
+
+def language_command(update: Update, context: CallbackContext) -> None:
+    #"""Обрабатывает команду /language: язык сообщений бота и уведомлений сервиса."""
+    if len(context.args) != 1 or context.args[0].lower() not in TEXTS:
+        update.message.reply_text(tr(update, context, "language_usage"))
+        return
+
+    language = context.args[0].lower()
+    try:
+        response = requests.post(
+            f"{GO_SERVICE_URL}{API_LANGUAGE_ENDPOINT}",
+            json={"telegram_id": update.effective_user.id, "language": language},
+            headers={"Accept-Language": language},
+            timeout=10
+        )
+        result = response.json()
+        if result.get("status") != "success":
+            update.message.reply_text(tr(update, context, "error", message=result.get("message", tr(update, context, "unknown_error"))))
+            return
+
+        context.user_data["language"] = language
+        update.message.reply_text(tr(update, context, "language_set"))
+    except requests.exceptions.RequestException as e:
+        logger.error(f"Ошибка изменения языка: {e}")
+        update.message.reply_text(tr(update, context, "connection_error", error=e))
+    except json.JSONDecodeError as e:
+        logger.error(f"Ошибка декодирования JSON ответа: {e}")
+        update.message.reply_text(tr(update, context, "format_error"))
 
 def main() -> None:
     #"""Запускает бота."""
@@ -225,6 +887,21 @@ def main() -> None:
         dp.add_handler(CommandHandler("start", start))
         dp.add_handler(CommandHandler("requestkiz", request_kiz_command))
         dp.add_handler(CommandHandler("pay", pay_command))
+        dp.add_handler(CommandHandler("introduce", introduce_command))
+        dp.add_handler(CommandHandler("submitdoc", submit_document_command))
+        dp.add_handler(CommandHandler("docstatus", document_status_command))
+        dp.add_handler(CommandHandler("language", language_command))
+        dp.add_handler(CommandHandler("orders", orders_command))
+        dp.add_handler(CommandHandler("templates", templates_command))
+        dp.add_handler(CommandHandler("cart", cart_command))
+        dp.add_handler(CommandHandler("add", add_command))
+        dp.add_handler(CommandHandler("remove", remove_command))
+        dp.add_handler(CommandHandler("checkout", checkout_command))
+        dp.add_handler(CommandHandler("schedules", schedules_command))
+        dp.add_handler(CommandHandler("requests", requests_command))
+        dp.add_handler(CallbackQueryHandler(confirmation_callback, pattern=r"^(confirm|reject):"))
+        dp.add_handler(CallbackQueryHandler(order_callback, pattern=r"^(reorder|template):"))
+        dp.add_handler(CallbackQueryHandler(schedule_callback, pattern=r"^schedule_(pause|resume):"))
         
         # Запуск бота
         updater.start_polling()
@@ -0,0 +1,416 @@
+package stripe
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"project-znak/internal/money"
+	"project-znak/internal/tracing"
+)
+
+// Адрес Stripe API
+const defaultBaseURL = "https://api.stripe.com"
+
+// Допустимое расхождение времени подписи уведомления с текущим временем
+const signatureTolerance = 5 * time.Minute
+
+// Типы событий, на которые подписывается вебхук
+const (
+	EventCheckoutCompleted      = "checkout.session.completed"
+	EventCheckoutAsyncSucceeded = "checkout.session.async_payment_succeeded"
+	EventCheckoutAsyncFailed    = "checkout.session.async_payment_failed"
+	EventCheckoutExpired        = "checkout.session.expired"
+	EventChargeRefunded         = "charge.refunded"
+)
+
+// Статус оплаты сессии, при котором деньги получены
+const PaymentStatusPaid = "paid"
+
+// ErrInvalidSignature возвращается, если подпись уведомления не совпадает или устарела
+var ErrInvalidSignature = errors.New("неверная подпись уведомления Stripe")
+
+// Валюты, суммы в которых передаются в Stripe без дробных единиц. Stripe ведет их
+// список отдельно от ISO 4217: ISK, например, передается в сотых долях, а MGA - целыми.
+var zeroDecimal = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true, "krw": true, "mga": true,
+	"pyg": true, "rwf": true, "ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// APIError - ошибка, возвращенная Stripe API
+type APIError struct {
+	StatusCode int
+	Type       string
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Stripe вернул ошибку %d: %s", e.StatusCode, e.Message)
+}
+
+// CheckoutParams - параметры сессии оплаты
+type CheckoutParams struct {
+	PaymentID   int
+	Amount      money.Money
+	Description string
+	SuccessURL  string
+	CancelURL   string
+	ExpiresAt   time.Time // Не раньше чем через 30 минут и не позже чем через 24 часа
+}
+
+// Session - сессия оплаты Stripe Checkout
+type Session struct {
+	ID                string      `json:"id"`
+	URL               string      `json:"url"`
+	ClientReferenceID string      `json:"client_reference_id"`
+	PaymentIntent     string      `json:"payment_intent"`
+	PaymentStatus     string      `json:"payment_status"`
+	Currency          string      `json:"currency"`
+	AmountTotal       int64       `json:"amount_total"`
+	Amount            money.Money `json:"-"` // Сумма в валюте сессии
+}
+
+// Charge - списание по платежу; приходит в уведомлении о возврате
+type Charge struct {
+	ID             string `json:"id"`
+	PaymentIntent  string `json:"payment_intent"`
+	Refunded       bool   `json:"refunded"` // Сумма списания возвращена полностью
+	AmountRefunded int64  `json:"amount_refunded"`
+	Currency       string `json:"currency"`
+}
+
+// Event - уведомление Stripe
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// Session возвращает сессию оплаты из уведомления checkout.session.*
+func (e *Event) Session() (*Session, error) {
+	var session Session
+	if err := json.Unmarshal(e.Data.Object, &session); err != nil {
+		return nil, fmt.Errorf("ошибка разбора сессии оплаты: %w", err)
+	}
+	session.Amount = FromMinorUnits(session.AmountTotal, session.Currency)
+	return &session, nil
+}
+
+// Charge возвращает списание из уведомления charge.*
+func (e *Event) Charge() (*Charge, error) {
+	var charge Charge
+	if err := json.Unmarshal(e.Data.Object, &charge); err != nil {
+		return nil, fmt.Errorf("ошибка разбора списания: %w", err)
+	}
+	return &charge, nil
+}
+
+// Settlement - сумма, зачисленная на баланс Stripe в валюте расчетов
+type Settlement struct {
+	Amount       money.Money
+	ExchangeRate float64 // Курс конвертации; 0, если валюта платежа совпадает с валютой расчетов
+}
+
+// Refund - возврат платежа
+type Refund struct {
+	ID     string `json:"id"`
+	Status string `json:"status"` // pending, succeeded, failed или canceled
+}
+
+// Health - доступность Stripe API по результатам последних запросов
+type Health struct {
+	LastSuccess time.Time
+	LastFailure time.Time
+	Error       string
+	Failures    int // Ошибок подряд после последнего успешного запроса
+}
+
+// Client выполняет запросы к Stripe API и проверяет подписи уведомлений
+type Client struct {
+	baseURL       string
+	secretKey     string
+	webhookSecret string
+	httpClient    *http.Client
+
+	mu     sync.Mutex
+	health Health
+}
+
+// NewClient создает клиент Stripe API. Если адрес не задан, используется адрес Stripe.
+func NewClient(baseURL, secretKey, webhookSecret string, timeout time.Duration) *Client {
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	return &Client{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		httpClient:    &http.Client{Timeout: timeout, Transport: tracing.Transport("stripe")},
+	}
+}
+
+// Enabled сообщает, задан ли секретный ключ Stripe
+func (c *Client) Enabled() bool {
+	return c != nil && c.secretKey != ""
+}
+
+// Health возвращает доступность Stripe API по результатам последних запросов
+func (c *Client) Health() Health {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.health
+}
+
+// Число знаков после запятой в суммах валюты currency, передаваемых в Stripe
+func exponent(currency string) int {
+	if zeroDecimal[strings.ToLower(currency)] {
+		return 0
+	}
+	return max(money.Exponent(currency), 2)
+}
+
+// ToMinorUnits переводит сумму в единицы, в которых ее принимает Stripe (центы, евроценты).
+// Дробная часть, которую Stripe не принимает, округляется.
+func ToMinorUnits(amount money.Money) int64 {
+	return rescale(amount.Minor, exponent(amount.Code())-money.Exponent(amount.Code()))
+}
+
+// FromMinorUnits переводит сумму из единиц Stripe в валюте currency
+func FromMinorUnits(amount int64, currency string) money.Money {
+	return money.New(rescale(amount, money.Exponent(currency)-exponent(currency)), currency)
+}
+
+// Сдвиг суммы на shift десятичных разрядов; при уменьшении половина округляется от нуля
+func rescale(amount int64, shift int) int64 {
+	for ; shift > 0; shift-- {
+		amount *= 10
+	}
+	for ; shift < 0; shift++ {
+		if amount < 0 {
+			amount = (amount - 5) / 10
+		} else {
+			amount = (amount + 5) / 10
+		}
+	}
+	return amount
+}
+
+// CreateCheckoutSession создает сессию оплаты на сумму платежа. Номер платежа передается
+// в client_reference_id и используется как ключ идемпотентности: повторный запрос
+// возвращает уже созданную сессию.
+func (c *Client) CreateCheckoutSession(ctx context.Context, params CheckoutParams) (*Session, error) {
+	currency := strings.ToLower(params.Amount.Code())
+	form := url.Values{
+		"mode":                                   {"payment"},
+		"client_reference_id":                    {strconv.Itoa(params.PaymentID)},
+		"success_url":                            {params.SuccessURL},
+		"cancel_url":                             {params.CancelURL},
+		"metadata[payment_id]":                   {strconv.Itoa(params.PaymentID)},
+		"line_items[0][quantity]":                {"1"},
+		"line_items[0][price_data][currency]":    {currency},
+		"line_items[0][price_data][unit_amount]": {strconv.FormatInt(ToMinorUnits(params.Amount), 10)},
+		"line_items[0][price_data][product_data][name]": {params.Description},
+		"payment_intent_data[metadata][payment_id]":     {strconv.Itoa(params.PaymentID)},
+	}
+	if !params.ExpiresAt.IsZero() {
+		form.Set("expires_at", strconv.FormatInt(params.ExpiresAt.Unix(), 10))
+	}
+
+	var session Session
+	if err := c.do(ctx, http.MethodPost, "/v1/checkout/sessions", form, fmt.Sprintf("payment-%d", params.PaymentID), &session); err != nil {
+		return nil, err
+	}
+	session.Amount = FromMinorUnits(session.AmountTotal, session.Currency)
+	return &session, nil
+}
+
+// Settlement возвращает сумму платежа, зачисленную на баланс в валюте расчетов
+// аккаунта Stripe, по балансовой операции последнего списания
+func (c *Client) Settlement(ctx context.Context, paymentIntentID string) (*Settlement, error) {
+	var intent struct {
+		LatestCharge *struct {
+			BalanceTransaction *struct {
+				Amount       int64   `json:"amount"`
+				Currency     string  `json:"currency"`
+				ExchangeRate float64 `json:"exchange_rate"`
+			} `json:"balance_transaction"`
+		} `json:"latest_charge"`
+	}
+	query := url.Values{"expand[]": {"latest_charge.balance_transaction"}}
+	if err := c.do(ctx, http.MethodGet, "/v1/payment_intents/"+url.PathEscape(paymentIntentID)+"?"+query.Encode(), nil, "", &intent); err != nil {
+		return nil, err
+	}
+	if intent.LatestCharge == nil || intent.LatestCharge.BalanceTransaction == nil {
+		return nil, errors.New("по платежу нет балансовой операции")
+	}
+
+	transaction := intent.LatestCharge.BalanceTransaction
+	return &Settlement{
+		Amount:       FromMinorUnits(transaction.Amount, transaction.Currency),
+		ExchangeRate: transaction.ExchangeRate,
+	}, nil
+}
+
+// Refund возвращает покупателю всю сумму платежа. Ключ идемпотентности защищает
+// от повторного возврата при повторе запроса.
+func (c *Client) Refund(ctx context.Context, paymentIntentID string) (*Refund, error) {
+	return c.refund(ctx, url.Values{"payment_intent": {paymentIntentID}}, "refund-"+paymentIntentID)
+}
+
+// RefundPart возвращает покупателю часть суммы платежа. Частичные возвраты одного платежа
+// различаются ключом key: повтор запроса с тем же ключом не возвращает сумму повторно.
+func (c *Client) RefundPart(ctx context.Context, paymentIntentID string, amount money.Money, key string) (*Refund, error) {
+	form := url.Values{
+		"payment_intent": {paymentIntentID},
+		"amount":         {strconv.FormatInt(ToMinorUnits(amount), 10)},
+	}
+	return c.refund(ctx, form, "refund-"+paymentIntentID+"-"+key)
+}
+
+func (c *Client) refund(ctx context.Context, form url.Values, idempotencyKey string) (*Refund, error) {
+	var refund Refund
+	if err := c.do(ctx, http.MethodPost, "/v1/refunds", form, idempotencyKey, &refund); err != nil {
+		return nil, err
+	}
+	if refund.Status == "failed" || refund.Status == "canceled" {
+		return nil, fmt.Errorf("возврат %s завершился со статусом %s", refund.ID, refund.Status)
+	}
+	return &refund, nil
+}
+
+// VerifyEvent проверяет подпись уведомления из заголовка Stripe-Signature и возвращает
+// событие. Подпись - HMAC-SHA256 от строки "метка_времени.тело" с секретом вебхука;
+// уведомления старше signatureTolerance отклоняются.
+func (c *Client) VerifyEvent(payload []byte, header string, now time.Time) (*Event, error) {
+	if c.webhookSecret == "" {
+		return nil, errors.New("секрет вебхука Stripe не задан")
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	if diff := now.Sub(time.Unix(unix, 0)); diff > signatureTolerance || diff < -signatureTolerance {
+		return nil, ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.webhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	valid := false
+	for _, signature := range signatures {
+		if decoded, err := hex.DecodeString(signature); err == nil && hmac.Equal(decoded, expected) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("ошибка разбора уведомления Stripe: %w", err)
+	}
+	return &event, nil
+}
+
+// Выполнение запроса к API с телом form; ответ декодируется в result
+func (c *Client) do(ctx context.Context, method, path string, form url.Values, idempotencyKey string, result any) error {
+	err := c.request(ctx, method, path, form, idempotencyKey, result)
+	c.record(err)
+	return err
+}
+
+// Учет результата запроса. Ответ API с ошибкой в запросе означает, что API доступен;
+// запросы, прерванные отменой контекста, не учитываются.
+func (c *Client) record(err error) {
+	var apiErr *APIError
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil || (errors.As(err, &apiErr) && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusTooManyRequests) {
+		c.health.LastSuccess = time.Now()
+		c.health.Failures = 0
+		return
+	}
+	c.health.LastFailure = time.Now()
+	c.health.Error = err.Error()
+	c.health.Failures++
+}
+
+func (c *Client) request(ctx context.Context, method, path string, form url.Values, idempotencyKey string, result any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.secretKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса к Stripe: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var payload struct {
+			Error struct {
+				Type    string `json:"type"`
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &payload) == nil && payload.Error.Message != "" {
+			apiErr.Type, apiErr.Code, apiErr.Message = payload.Error.Type, payload.Error.Code, payload.Error.Message
+		} else {
+			apiErr.Message = string(data)
+		}
+		return apiErr
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("ошибка декодирования ответа Stripe: %w", err)
+	}
+	return nil
+}
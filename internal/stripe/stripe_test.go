@@ -0,0 +1,144 @@
+package stripe
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"project-znak/internal/money"
+)
+
+func sign(secret, payload string, at time.Time) string {
+	timestamp := fmt.Sprint(at.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyEvent(t *testing.T) {
+	client := NewClient("", "sk_test", "whsec", time.Second)
+	payload := `{"id": "evt_1", "type": "checkout.session.completed", "data": {"object": {"id": "cs_1",
+		"client_reference_id": "42", "payment_intent": "pi_1", "payment_status": "paid", "currency": "eur", "amount_total": 1999}}}`
+	now := time.Now()
+
+	event, err := client.VerifyEvent([]byte(payload), sign("whsec", payload, now), now)
+	if err != nil {
+		t.Fatalf("VerifyEvent() вернул ошибку: %v", err)
+	}
+	session, err := event.Session()
+	if err != nil || event.Type != EventCheckoutCompleted || session.ClientReferenceID != "42" ||
+		session.PaymentIntent != "pi_1" || !session.Amount.Equal(money.New(1999, "EUR")) {
+		t.Errorf("неверное событие: %+v, %+v, %v", event, session, err)
+	}
+
+	if _, err := client.VerifyEvent([]byte(payload), sign("other", payload, now), now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("ожидалась ошибка подписи для другого секрета, получено: %v", err)
+	}
+	if _, err := client.VerifyEvent([]byte(payload), sign("whsec", payload, now.Add(-10*time.Minute)), now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("ожидалась ошибка подписи для устаревшего уведомления, получено: %v", err)
+	}
+	if _, err := client.VerifyEvent([]byte(payload+" "), sign("whsec", payload, now), now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("ожидалась ошибка подписи для измененного тела, получено: %v", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk_test" {
+			t.Errorf("запрос %s без ключа", r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/v1/checkout/sessions":
+			r.ParseForm()
+			if r.Header.Get("Idempotency-Key") != "payment-42" || r.PostForm.Get("client_reference_id") != "42" ||
+				r.PostForm.Get("line_items[0][price_data][currency]") != "jpy" ||
+				r.PostForm.Get("line_items[0][price_data][unit_amount]") != "1500" || r.PostForm.Get("mode") != "payment" {
+				t.Errorf("неверный запрос сессии: %v", r.PostForm)
+			}
+			w.Write([]byte(`{"id": "cs_1", "url": "https://checkout.stripe.com/c/pay/cs_1", "currency": "jpy", "amount_total": 1500}`))
+		case "/v1/payment_intents/pi_1":
+			if r.URL.Query().Get("expand[]") != "latest_charge.balance_transaction" {
+				t.Errorf("неверный запрос платежа: %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"id": "pi_1", "latest_charge": {"balance_transaction": {"amount": 912, "currency": "eur", "exchange_rate": 0.00608}}}`))
+		case "/v1/refunds":
+			r.ParseForm()
+			if r.PostForm.Get("payment_intent") == "pi_missing" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": {"type": "invalid_request_error", "code": "resource_missing", "message": "No such payment_intent"}}`))
+				return
+			}
+			if amount := r.PostForm.Get("amount"); amount != "" {
+				if amount != "500" || r.Header.Get("Idempotency-Key") != "refund-pi_1-order-7-1" {
+					t.Errorf("неверный запрос частичного возврата: %v, %s", r.PostForm, r.Header.Get("Idempotency-Key"))
+				}
+				w.Write([]byte(`{"id": "re_2", "status": "succeeded"}`))
+				return
+			}
+			w.Write([]byte(`{"id": "re_1", "status": "succeeded"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "sk_test", "whsec", time.Second)
+
+	session, err := client.CreateCheckoutSession(context.Background(), CheckoutParams{
+		PaymentID: 42, Amount: money.New(1500, "JPY"), Description: "Оплата услуг",
+		SuccessURL: "https://example.com", CancelURL: "https://example.com",
+	})
+	if err != nil || session.ID != "cs_1" || session.URL == "" || !session.Amount.Equal(money.New(1500, "JPY")) {
+		t.Fatalf("CreateCheckoutSession() = %+v, %v", session, err)
+	}
+
+	settlement, err := client.Settlement(context.Background(), "pi_1")
+	if err != nil || !settlement.Amount.Equal(money.New(912, "EUR")) || settlement.ExchangeRate != 0.00608 {
+		t.Errorf("Settlement() = %+v, %v", settlement, err)
+	}
+
+	if refund, err := client.Refund(context.Background(), "pi_1"); err != nil || refund.ID != "re_1" {
+		t.Errorf("Refund() = %+v, %v", refund, err)
+	}
+	if refund, err := client.RefundPart(context.Background(), "pi_1", money.New(500, "EUR"), "order-7-1"); err != nil || refund.ID != "re_2" {
+		t.Errorf("RefundPart() = %+v, %v", refund, err)
+	}
+	var apiErr *APIError
+	if _, err := client.Refund(context.Background(), "pi_missing"); !errors.As(err, &apiErr) || apiErr.Code != "resource_missing" {
+		t.Errorf("ожидалась ошибка API, получено: %v", err)
+	}
+	if health := client.Health(); health.Failures != 0 || health.LastSuccess.IsZero() {
+		t.Errorf("ошибка запроса не должна считаться недоступностью API: %+v", health)
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount money.Money
+		stripe int64
+	}{
+		{money.New(1999, "USD"), 1999},
+		{money.New(1500, "JPY"), 1500},
+		{money.New(1500, "ISK"), 150000}, // Stripe принимает ISK в сотых долях
+		{money.New(1234, "KWD"), 1234},
+		{money.New(12350, "MGA"), 124}, // а MGA - только целыми
+	}
+	for _, tt := range tests {
+		if got := ToMinorUnits(tt.amount); got != tt.stripe {
+			t.Errorf("ToMinorUnits(%s %s) = %d, ожидалось %d", tt.amount, tt.amount.Code(), got, tt.stripe)
+		}
+	}
+	if amount := FromMinorUnits(1999, "eur"); !amount.Equal(money.New(1999, "EUR")) {
+		t.Errorf("FromMinorUnits(1999, eur) = %+v", amount)
+	}
+	if amount := FromMinorUnits(150000, "isk"); !amount.Equal(money.New(1500, "ISK")) {
+		t.Errorf("FromMinorUnits(150000, isk) = %+v", amount)
+	}
+}
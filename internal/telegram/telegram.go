@@ -0,0 +1,178 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+// Адрес Bot API Telegram
+const defaultBaseURL = "https://api.telegram.org"
+
+// Client отправляет сообщения пользователям от имени бота через Bot API
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient создает клиент Bot API. Если токен не задан, клиент отключен.
+func NewClient(token string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    defaultBaseURL,
+		token:      token,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// Enabled сообщает, задан ли токен бота
+func (c *Client) Enabled() bool {
+	return c != nil && c.token != ""
+}
+
+// Button - кнопка под сообщением; при нажатии бот получает CallbackData
+type Button struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// Тело запроса sendMessage
+type sendMessageRequest struct {
+	ChatID      int64           `json:"chat_id"`
+	Text        string          `json:"text"`
+	ReplyMarkup *inlineKeyboard `json:"reply_markup,omitempty"`
+}
+
+// Кнопки под сообщением, по одной в строке
+type inlineKeyboard struct {
+	InlineKeyboard [][]Button `json:"inline_keyboard"`
+}
+
+// Ответ Bot API
+type apiResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Result      struct {
+		MessageID int64  `json:"message_id"`
+		FilePath  string `json:"file_path"` // Путь к файлу для скачивания (getFile)
+		FileSize  int64  `json:"file_size"`
+	} `json:"result"`
+}
+
+// ErrFileTooLarge - файл пользователя больше допустимого размера
+var ErrFileTooLarge = errors.New("файл слишком большой")
+
+// SendMessage отправляет текстовое сообщение в чат пользователя с кнопками под ним
+func (c *Client) SendMessage(ctx context.Context, chatID int64, text string, buttons ...Button) error {
+	request := sendMessageRequest{ChatID: chatID, Text: text}
+	if len(buttons) > 0 {
+		request.ReplyMarkup = &inlineKeyboard{}
+		for _, button := range buttons {
+			request.ReplyMarkup.InlineKeyboard = append(request.ReplyMarkup.InlineKeyboard, []Button{button})
+		}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("ошибка формирования запроса: %w", err)
+	}
+
+	_, err = c.call(ctx, "sendMessage", "application/json", bytes.NewReader(body))
+	return err
+}
+
+// SendDocument отправляет файл в чат пользователя и возвращает идентификатор сообщения
+func (c *Client) SendDocument(ctx context.Context, chatID int64, filename string, data []byte, caption string) (int64, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("chat_id", strconv.FormatInt(chatID, 10))
+	if caption != "" {
+		form.WriteField("caption", caption)
+	}
+	part, err := form.CreateFormFile("document", filename)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка формирования запроса: %w", err)
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return 0, fmt.Errorf("ошибка формирования запроса: %w", err)
+	}
+
+	result, err := c.call(ctx, "sendDocument", form.FormDataContentType(), &body)
+	if err != nil {
+		return 0, err
+	}
+	return result.Result.MessageID, nil
+}
+
+// DownloadFile скачивает файл, отправленный пользователем боту, по его file_id и возвращает
+// имя и содержимое файла. Файл больше maxSize байт не скачивается: возвращается ErrFileTooLarge.
+func (c *Client) DownloadFile(ctx context.Context, fileID string, maxSize int64) (string, []byte, error) {
+	body, err := json.Marshal(map[string]string{"file_id": fileID})
+	if err != nil {
+		return "", nil, fmt.Errorf("ошибка формирования запроса: %w", err)
+	}
+	file, err := c.call(ctx, "getFile", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", nil, err
+	}
+	if file.Result.FileSize > maxSize {
+		return "", nil, ErrFileTooLarge
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/file/bot"+c.token+"/"+file.Result.FilePath, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// Ошибка содержит URL с токеном бота
+		return "", nil, fmt.Errorf("ошибка скачивания файла Telegram")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("ошибка скачивания файла Telegram: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return "", nil, fmt.Errorf("ошибка скачивания файла Telegram: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return "", nil, ErrFileTooLarge
+	}
+	return path.Base(file.Result.FilePath), data, nil
+}
+
+// Вызов метода Bot API
+func (c *Client) call(ctx context.Context, method, contentType string, body io.Reader) (*apiResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/bot"+c.token+"/"+method, body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// Ошибка содержит URL с токеном бота
+		return nil, fmt.Errorf("ошибка запроса к Telegram Bot API")
+	}
+	defer resp.Body.Close()
+
+	var result apiResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1048576)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования ответа Telegram: %d", resp.StatusCode)
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("Telegram Bot API вернул ошибку: %s", result.Description)
+	}
+
+	return &result, nil
+}
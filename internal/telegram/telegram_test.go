@@ -0,0 +1,128 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendDocument(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottoken/sendDocument" {
+			w.Write([]byte(`{"ok":false,"description":"Not Found"}`))
+			return
+		}
+		if r.FormValue("chat_id") != "42" || r.FormValue("caption") != "Коды" {
+			t.Errorf("неверные параметры запроса: chat_id=%q caption=%q", r.FormValue("chat_id"), r.FormValue("caption"))
+		}
+		file, header, err := r.FormFile("document")
+		if err != nil {
+			t.Fatalf("в запросе нет файла: %v", err)
+		}
+		data, _ := io.ReadAll(file)
+		if header.Filename != "kizs.pdf" || string(data) != "%PDF" {
+			t.Errorf("неверный файл %q: %q", header.Filename, data)
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":7}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("token", time.Second)
+	client.baseURL = server.URL
+
+	messageID, err := client.SendDocument(context.Background(), 42, "kizs.pdf", []byte("%PDF"), "Коды")
+	if err != nil {
+		t.Fatalf("SendDocument() вернул ошибку: %v", err)
+	}
+	if messageID != 7 {
+		t.Errorf("message_id = %d, ожидалось 7", messageID)
+	}
+}
+
+func TestSendMessageButtons(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ChatID      int64  `json:"chat_id"`
+			Text        string `json:"text"`
+			ReplyMarkup struct {
+				InlineKeyboard [][]Button `json:"inline_keyboard"`
+			} `json:"reply_markup"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatalf("ошибка разбора запроса: %v", err)
+		}
+		keyboard := request.ReplyMarkup.InlineKeyboard
+		if request.ChatID != 42 || len(keyboard) != 2 || len(keyboard[0]) != 1 {
+			t.Fatalf("неверный запрос: %+v", request)
+		}
+		if keyboard[1][0] != (Button{Text: "Отклонить", CallbackData: "reject:1"}) {
+			t.Errorf("неверная кнопка: %+v", keyboard[1][0])
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("token", time.Second)
+	client.baseURL = server.URL
+
+	err := client.SendMessage(context.Background(), 42, "Подтвердите операцию",
+		Button{Text: "Подтвердить", CallbackData: "confirm:1"}, Button{Text: "Отклонить", CallbackData: "reject:1"})
+	if err != nil {
+		t.Fatalf("SendMessage() вернул ошибку: %v", err)
+	}
+}
+
+func TestSendMessageError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"ok":false,"description":"Forbidden: bot was blocked by the user"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("token", time.Second)
+	client.baseURL = server.URL
+
+	if err := client.SendMessage(context.Background(), 42, "текст"); err == nil {
+		t.Error("ожидалась ошибка для заблокированного бота")
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bottoken/getFile":
+			var request map[string]string
+			json.NewDecoder(r.Body).Decode(&request)
+			if request["file_id"] == "big" {
+				w.Write([]byte(`{"ok":true,"result":{"file_path":"documents/big.csv","file_size":100}}`))
+				return
+			}
+			w.Write([]byte(`{"ok":true,"result":{"file_path":"documents/file_1.csv","file_size":18}}`))
+		case "/file/bottoken/documents/file_1.csv":
+			w.Write([]byte("04600000000012;10\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("token", time.Second)
+	client.baseURL = server.URL
+
+	name, data, err := client.DownloadFile(context.Background(), "abc", 1024)
+	if err != nil {
+		t.Fatalf("DownloadFile() вернул ошибку: %v", err)
+	}
+	if name != "file_1.csv" || string(data) != "04600000000012;10\n" {
+		t.Errorf("неверный файл %q: %q", name, data)
+	}
+
+	if _, _, err := client.DownloadFile(context.Background(), "big", 50); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("ожидалась ошибка ErrFileTooLarge, получена %v", err)
+	}
+}
@@ -0,0 +1,12 @@
+// Package text содержит общие функции обработки строк.
+package text
+
+// Truncate обрезает строку до length символов (не байт), чтобы не разрезать многобайтовые
+// символы UTF-8
+func Truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length])
+}
@@ -0,0 +1,24 @@
+package text
+
+import "testing"
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s      string
+		length int
+		want   string
+	}{
+		{"", 5, ""},
+		{"abc", 5, "abc"},
+		{"abc", 3, "abc"},
+		{"abcdef", 3, "abc"},
+		{"Честный знак", 7, "Честный"},
+		{"abc", 0, ""},
+	}
+
+	for _, tt := range tests {
+		if got := Truncate(tt.s, tt.length); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, ожидалось %q", tt.s, tt.length, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Package tracing настраивает распределенную трассировку OpenTelemetry: экспорт спанов
+// по OTLP, передачу контекста трассировки во внешние запросы и создание спанов
+// в слоях сервиса.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Имя инструментирующей библиотеки в спанах сервиса
+const instrumentationName = "project-znak"
+
+// Config - параметры экспорта трассировок
+type Config struct {
+	Endpoint    string  // Адрес OTLP/HTTP коллектора, например http://otel-collector:4318
+	ServiceName string  // Имя сервиса в трассировках
+	SampleRatio float64 // Доля записываемых трассировок от 0 до 1
+}
+
+// Setup устанавливает глобальный провайдер трассировок с экспортом по OTLP/HTTP и
+// распространение контекста в формате W3C Trace Context. Если адрес коллектора не задан,
+// спаны не записываются, но контекст входящих запросов передается дальше.
+// Возвращает функцию, отправляющую накопленные спаны при остановке сервиса.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания экспортера OTLP: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start создает дочерний спан операции name
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End завершает спан, отмечая ошибку операции
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Transport возвращает http.RoundTripper, создающий спан для каждого запроса к внешней
+// системе system и передающий в запросе контекст трассировки
+func Transport(system string) http.RoundTripper {
+	return WrapTransport(system, http.DefaultTransport)
+}
+
+// WrapTransport добавляет трассировку запросов к внешней системе system в транспорт base
+func WrapTransport(system string, base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base,
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return system + " " + r.Method + " " + r.URL.Path
+		}),
+	)
+}
+
+// Handler оборачивает обработчик входящих HTTP-запросов: продолжает трассировку из
+// заголовков запроса и создает серверный спан
+func Handler(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+	)
+}
@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTransportPropagation(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+	}))
+	defer server.Close()
+
+	ctx, span := Start(context.Background(), "kiz.request")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/api/v3/codes", nil)
+	resp, err := (&http.Client{Transport: Transport("chestnyznak")}).Do(req)
+	if err != nil {
+		t.Fatalf("ошибка запроса: %v", err)
+	}
+	resp.Body.Close()
+	End(span, nil)
+
+	traceID := span.SpanContext().TraceID().String()
+	if !strings.Contains(traceparent, traceID) {
+		t.Errorf("контекст трассировки %s не передан в запросе: %q", traceID, traceparent)
+	}
+	var names []string
+	for _, ended := range recorder.Ended() {
+		names = append(names, ended.Name())
+	}
+	if len(names) != 2 || names[0] != "chestnyznak POST /api/v3/codes" {
+		t.Errorf("неверные спаны: %v", names)
+	}
+}
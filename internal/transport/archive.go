@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Наибольший размер тела запроса или ответа в архиве; остаток отбрасывается
+const maxArchivedBody = 4 << 20
+
+// Заголовки с секретами, которые не сохраняются в архиве
+var redactedHeaders = []string{"Authorization", "Cookie", "clientToken"}
+
+// Exchange - запрос к внешней системе и ответ на него в том виде, в котором они
+// переданы по сети: тело, подпись в заголовках и необработанный ответ
+type Exchange struct {
+	System          string // Внешняя система, например chestnyznak или oms
+	SubjectType     string // Объект, по которому выполнялся запрос, например kiz_request
+	SubjectID       int
+	Method          string
+	URL             string
+	RequestHeaders  http.Header
+	RequestBody     []byte
+	StatusCode      int // 0 - ответ не получен
+	ResponseHeaders http.Header
+	ResponseBody    []byte
+	Truncated       bool   // Тело запроса или ответа длиннее maxArchivedBody
+	Error           string // Ошибка соединения
+	StartedAt       time.Time
+	Duration        time.Duration
+}
+
+type subjectKey struct{}
+
+type subject struct {
+	kind string
+	id   int
+}
+
+// WithSubject связывает запросы к внешним системам, выполненные с контекстом ctx,
+// с объектом subjectType и его идентификатором
+func WithSubject(ctx context.Context, subjectType string, subjectID int) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject{kind: subjectType, id: subjectID})
+}
+
+// archiveTransport передает каждый запрос и ответ в save
+type archiveTransport struct {
+	system string
+	next   http.RoundTripper
+	save   func(context.Context, Exchange)
+}
+
+// Archive оборачивает транспорт next: каждый запрос к системе system, кроме проверок
+// доступности HEAD, вместе с ответом передается в save. Тело ответа читается целиком
+// до передачи клиенту. Заголовки с секретами не передаются.
+func Archive(system string, next http.RoundTripper, save func(context.Context, Exchange)) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &archiveTransport{system: system, next: next, save: save}
+}
+
+func (t *archiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+
+	exchange := Exchange{
+		System:         t.system,
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeaders: redact(req.Header),
+		StartedAt:      time.Now(),
+	}
+	if s, ok := req.Context().Value(subjectKey{}).(subject); ok {
+		exchange.SubjectType, exchange.SubjectID = s.kind, s.id
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		exchange.RequestBody = t.limit(&exchange, body)
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		exchange.Error = err.Error()
+		exchange.Duration = time.Since(exchange.StartedAt)
+		t.save(req.Context(), exchange)
+		return nil, err
+	}
+
+	body, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	exchange.StatusCode = resp.StatusCode
+	exchange.ResponseHeaders = redact(resp.Header)
+	exchange.ResponseBody = t.limit(&exchange, body)
+	if readErr != nil {
+		exchange.Error = readErr.Error()
+	}
+	exchange.Duration = time.Since(exchange.StartedAt)
+	t.save(req.Context(), exchange)
+	if readErr != nil {
+		return nil, readErr
+	}
+	return resp, nil
+}
+
+// Тело для архива не длиннее maxArchivedBody
+func (t *archiveTransport) limit(exchange *Exchange, body []byte) []byte {
+	if len(body) > maxArchivedBody {
+		exchange.Truncated = true
+		return body[:maxArchivedBody]
+	}
+	return body
+}
+
+// Копия заголовков без секретов
+func redact(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range redactedHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, "***")
+		}
+	}
+	return header
+}
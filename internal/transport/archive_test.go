@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"document":"1"}` {
+			t.Errorf("Сервер получил тело %q вместо исходного", body)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"id":"abc"}`)
+	}))
+	defer server.Close()
+
+	var saved []Exchange
+	client := &http.Client{Transport: Archive("chestnyznak", nil, func(ctx context.Context, exchange Exchange) {
+		saved = append(saved, exchange)
+	})}
+
+	ctx := WithSubject(context.Background(), "introduction_document", 7)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/documents", strings.NewReader(`{"document":"1"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Signature", "sig")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `{"id":"abc"}` {
+		t.Errorf("Клиент получил тело ответа %q вместо исходного", body)
+	}
+
+	if len(saved) != 1 {
+		t.Fatalf("Сохранено запросов: %d, ожидался 1", len(saved))
+	}
+	exchange := saved[0]
+	if exchange.System != "chestnyznak" || exchange.SubjectType != "introduction_document" || exchange.SubjectID != 7 {
+		t.Errorf("Неверная привязка запроса: %s %s %d", exchange.System, exchange.SubjectType, exchange.SubjectID)
+	}
+	if string(exchange.RequestBody) != `{"document":"1"}` || string(exchange.ResponseBody) != `{"id":"abc"}` {
+		t.Errorf("Неверные тела в архиве: %q, %q", exchange.RequestBody, exchange.ResponseBody)
+	}
+	if exchange.StatusCode != http.StatusAccepted {
+		t.Errorf("Код ответа в архиве %d, ожидался %d", exchange.StatusCode, http.StatusAccepted)
+	}
+	if got := exchange.RequestHeaders.Get("Authorization"); got != "***" {
+		t.Errorf("Заголовок Authorization должен быть скрыт, получено %q", got)
+	}
+	if got := exchange.RequestHeaders.Get("X-Signature"); got != "sig" {
+		t.Errorf("Подпись должна сохраняться в архиве, получено %q", got)
+	}
+	if req.Header.Get("Authorization") != "Bearer secret" {
+		t.Error("Скрытие заголовков не должно изменять исходный запрос")
+	}
+}
@@ -0,0 +1,73 @@
+// Package transport создает HTTP-транспорт для запросов к внешним системам с настройками
+// прокси-сервера и TLS: корневыми сертификатами, клиентским сертификатом и минимальной
+// версией протокола.
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// Config - параметры исходящих соединений
+type Config struct {
+	ProxyURL       string // Прокси-сервер http, https или socks5; если не задан, используются HTTPS_PROXY и NO_PROXY
+	CAFile         string // Корневые сертификаты PEM; если заданы, системные сертификаты не используются
+	ClientCertFile string // Клиентский сертификат PEM для взаимной аутентификации TLS
+	ClientKeyFile  string // Ключ клиентского сертификата PEM
+	MinTLSVersion  string // Минимальная версия TLS: 1.2 или 1.3; по умолчанию 1.2
+}
+
+// Версии TLS, допустимые в MinTLSVersion
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// New создает транспорт на основе http.DefaultTransport с настройками cfg
+func New(cfg Config) (*http.Transport, error) {
+	minVersion, ok := tlsVersions[cfg.MinTLSVersion]
+	if !ok {
+		return nil, fmt.Errorf("неподдерживаемая версия TLS: %s", cfg.MinTLSVersion)
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{MinVersion: minVersion}
+
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный адрес прокси-сервера: %w", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("неподдерживаемая схема прокси-сервера: %s", proxy.Scheme)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения корневых сертификатов: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("в файле %s нет сертификатов PEM", cfg.CAFile)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка загрузки клиентского сертификата: %w", err)
+		}
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	return t, nil
+}
@@ -0,0 +1,73 @@
+package transport
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRootCAs(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600)
+
+	if _, err := (&http.Client{Transport: mustNew(t, Config{})}).Get(server.URL); err == nil {
+		t.Error("Сертификат сервера не должен проверяться системными корневыми сертификатами")
+	}
+	resp, err := (&http.Client{Transport: mustNew(t, Config{CAFile: caFile})}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Сертификат сервера должен проверяться корневым сертификатом из CAFile: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	resp, err := (&http.Client{Transport: mustNew(t, Config{ProxyURL: proxy.URL})}).Get("http://api.crpt.example/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if proxied != "http://api.crpt.example/ping" {
+		t.Errorf("Запрос должен идти через прокси-сервер, получено: %q", proxied)
+	}
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	if mustNew(t, Config{}).TLSClientConfig.MinVersion != tls.VersionTLS12 {
+		t.Error("По умолчанию минимальная версия TLS должна быть 1.2")
+	}
+	if mustNew(t, Config{MinTLSVersion: "1.3"}).TLSClientConfig.MinVersion != tls.VersionTLS13 {
+		t.Error("Неверная минимальная версия TLS 1.3")
+	}
+	for _, cfg := range []Config{
+		{MinTLSVersion: "1.0"},
+		{ProxyURL: "ftp://proxy"},
+		{CAFile: "missing.pem"},
+		{ClientCertFile: "client.pem"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("Настройки %+v должны быть отклонены", cfg)
+		}
+	}
+}
+
+func mustNew(t *testing.T, cfg Config) *http.Transport {
+	t.Helper()
+	tr, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
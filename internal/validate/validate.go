@@ -0,0 +1,337 @@
+// Package validate проверяет поля структур запросов по тегам validate и возвращает
+// ошибки по каждому полю с кодом нарушенного правила.
+//
+// Правила в теге перечисляются через запятую и проверяются по порядку до первой ошибки:
+//
+//	Items []Item `json:"items" validate:"required,max=100,dive"`
+//	GTIN string  `json:"gtin" validate:"required,gtin"`
+//
+// Все правила, кроме required и required_without, пропускают пустые значения. Правила
+// после dive применяются к каждому элементу среза. Вложенные структуры и срезы структур
+// проверяются по их собственным тегам.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Коды встроенных правил
+const (
+	CodeRequired = "required" // Поле не заполнено
+	CodeMin      = "min"      // Значение, длина строки или число элементов меньше допустимого
+	CodeMax      = "max"      // Значение, длина строки или число элементов больше допустимого
+	CodeGT       = "gt"       // Значение не больше указанного
+	CodeOneOf    = "oneof"    // Значение не из списка допустимых
+	CodeEmail    = "email"    // Некорректный email
+	CodeDate     = "date"     // Дата не в формате ГГГГ-ММ-ДД
+	CodeDuration = "duration" // Некорректная длительность, например "720h"
+)
+
+// FieldError - ошибка значения поля запроса
+type FieldError struct {
+	Field   string `json:"field" xml:"field"`     // Путь к полю в JSON, например items[0].gtin
+	Code    string `json:"code" xml:"code"`       // Код нарушенного правила
+	Message string `json:"message" xml:"message"` // Описание ошибки
+}
+
+// Errors - ошибки полей запроса
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fieldErr := range e {
+		parts[i] = fieldErr.Field + ": " + fieldErr.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Правило проверки непустого значения; возвращает описание ошибки или пустую строку
+type rule func(value reflect.Value, param string) string
+
+var (
+	mu    sync.RWMutex
+	rules = map[string]rule{
+		CodeMin:      checkMin,
+		CodeMax:      checkMax,
+		CodeGT:       checkGT,
+		CodeOneOf:    checkOneOf,
+		CodeEmail:    stringRule(checkEmail),
+		CodeDate:     stringRule(checkDate),
+		CodeDuration: stringRule(checkDuration),
+	}
+)
+
+// Register добавляет правило для строковых полей с кодом name. Текст ошибки check
+// становится описанием ошибки поля. Правило с тем же кодом заменяется.
+func Register(name string, check func(value string) error) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules[name] = stringRule(check)
+}
+
+// Struct проверяет поля структуры (или указателя на нее) по тегам validate.
+// Возвращает Errors со всеми найденными ошибками или nil.
+func Struct(v any) error {
+	var errs Errors
+	errs.walk(reflect.ValueOf(v), "")
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Проверка полей структуры; path - путь к структуре в JSON
+func (e *Errors) walk(v reflect.Value, path string) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+		// Поля встроенной структуры находятся в JSON на одном уровне с полями внешней
+		if field.Anonymous && tag == "" {
+			e.walk(v.Field(i), path)
+			continue
+		}
+		name := jsonName(field)
+		if name == "-" {
+			continue
+		}
+		e.check(v, v.Field(i), joinPath(path, name), tag)
+	}
+}
+
+// Проверка значения по правилам тега; parent - структура, содержащая поле
+func (e *Errors) check(parent, value reflect.Value, path, tag string) {
+	items := splitTag(tag)
+	var dive bool
+	var elemTag string
+	for i, item := range items {
+		if item == "dive" {
+			dive, elemTag, items = true, strings.Join(items[i+1:], ","), items[:i]
+			break
+		}
+	}
+
+	empty := isEmpty(value)
+	for _, item := range items {
+		name, param, _ := strings.Cut(item, "=")
+		switch name {
+		case CodeRequired:
+			if empty {
+				e.add(path, CodeRequired, "обязательное поле")
+				return
+			}
+			continue
+		case "required_without":
+			// Поле обязательно, если не заполнено другое поле той же структуры
+			if empty && isEmpty(fieldByJSONName(parent, param)) {
+				e.add(path, CodeRequired, "обязательное поле, если не указано "+param)
+				return
+			}
+			continue
+		}
+		if empty {
+			continue
+		}
+
+		mu.RLock()
+		check, ok := rules[name]
+		mu.RUnlock()
+		if !ok {
+			panic(fmt.Sprintf("validate: неизвестное правило %q в поле %s", name, path))
+		}
+		if message := check(indirect(value), param); message != "" {
+			e.add(path, name, message)
+			return
+		}
+	}
+
+	value = indirect(value)
+	switch value.Kind() {
+	case reflect.Struct:
+		e.walk(value, path)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			elemPath := path + "[" + strconv.Itoa(i) + "]"
+			if dive {
+				e.check(value, value.Index(i), elemPath, elemTag)
+			} else {
+				e.walk(value.Index(i), elemPath)
+			}
+		}
+	}
+}
+
+func (e *Errors) add(field, code, message string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: message})
+}
+
+func splitTag(tag string) []string {
+	if tag == "" {
+		return nil
+	}
+	return strings.Split(tag, ",")
+}
+
+// Имя поля в JSON; для поля без тега json - имя поля структуры
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// Поле структуры по имени в JSON; нулевое значение, если поля нет
+func fieldByJSONName(v reflect.Value, name string) reflect.Value {
+	v = indirect(v)
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if jsonName(v.Type().Field(i)) == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+// Пустым считается нулевое значение, пустой срез и строка из одних пробелов
+func isEmpty(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func stringRule(check func(string) error) rule {
+	return func(value reflect.Value, _ string) string {
+		if value.Kind() != reflect.String {
+			return "ожидается строка"
+		}
+		if err := check(value.String()); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+}
+
+// Числовое значение поля и формат описания ошибки; для строк - число символов,
+// для срезов - число элементов
+func measure(value reflect.Value) (float64, string, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), "значение должно быть %s %s", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), "значение должно быть %s %s", true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), "значение должно быть %s %s", true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), "длина должна быть %s %s символов", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), "число элементов должно быть %s %s", true
+	}
+	return 0, "", false
+}
+
+func compare(value reflect.Value, param string, ok func(n, limit float64) bool, relation string) string {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: некорректный параметр правила %q", param))
+	}
+	n, format, measurable := measure(value)
+	if !measurable {
+		return "значение не поддерживает сравнение"
+	}
+	if ok(n, limit) {
+		return ""
+	}
+	return fmt.Sprintf(format, relation, param)
+}
+
+func checkMin(value reflect.Value, param string) string {
+	return compare(value, param, func(n, limit float64) bool { return n >= limit }, "не меньше")
+}
+
+func checkMax(value reflect.Value, param string) string {
+	return compare(value, param, func(n, limit float64) bool { return n <= limit }, "не больше")
+}
+
+func checkGT(value reflect.Value, param string) string {
+	return compare(value, param, func(n, limit float64) bool { return n > limit }, "больше")
+}
+
+func checkOneOf(value reflect.Value, param string) string {
+	allowed := strings.Fields(param)
+	actual := fmt.Sprint(value.Interface())
+	for _, option := range allowed {
+		if actual == option {
+			return ""
+		}
+	}
+	return "допустимые значения: " + strings.Join(allowed, ", ")
+}
+
+func checkEmail(value string) error {
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value {
+		return fmt.Errorf("некорректный формат email")
+	}
+	return nil
+}
+
+func checkDate(value string) error {
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return fmt.Errorf("ожидается дата в формате ГГГГ-ММ-ДД")
+	}
+	return nil
+}
+
+func checkDuration(value string) error {
+	if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+		return fmt.Errorf("ожидается положительная длительность, например \"720h\"")
+	}
+	return nil
+}
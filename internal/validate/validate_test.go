@@ -0,0 +1,95 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+)
+
+type testItem struct {
+	Code  string `json:"code" validate:"required"`
+	Count int    `json:"count" validate:"required,min=1"`
+}
+
+type testRequest struct {
+	Name   string     `json:"name" validate:"required,max=5"`
+	Email  string     `json:"email,omitempty" validate:"email"`
+	Kind   string     `json:"kind" validate:"oneof=a b"`
+	Date   string     `json:"date" validate:"date"`
+	Amount float64    `json:"amount" validate:"gt=0"`
+	IDs    []int      `json:"ids,omitempty" validate:"required_without=tags,dive,required,min=1"`
+	Tags   []string   `json:"tags,omitempty"`
+	Items  []testItem `json:"items"`
+}
+
+func TestStruct(t *testing.T) {
+	valid := testRequest{Name: "abc", Email: "user@example.com", Kind: "a", Date: "2025-02-01", Amount: 1, Tags: []string{"x"}}
+	if err := Struct(valid); err != nil {
+		t.Errorf("Неожиданная ошибка: %v", err)
+	}
+
+	invalid := testRequest{
+		Name:   "  ",
+		Email:  "user",
+		Kind:   "c",
+		Date:   "01.02.2025",
+		Amount: -1,
+		Items:  []testItem{{Code: "x"}},
+	}
+	err := Struct(&invalid)
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Ожидались ошибки полей, получено: %v", err)
+	}
+
+	want := map[string]string{
+		"name":           CodeRequired,
+		"email":          CodeEmail,
+		"kind":           CodeOneOf,
+		"date":           CodeDate,
+		"amount":         CodeGT,
+		"ids":            CodeRequired,
+		"items[0].count": CodeRequired,
+	}
+	if len(errs) != len(want) {
+		t.Errorf("Получено %d ошибок, ожидалось %d: %v", len(errs), len(want), errs)
+	}
+	for _, fieldErr := range errs {
+		if code, ok := want[fieldErr.Field]; !ok || code != fieldErr.Code {
+			t.Errorf("Неожиданная ошибка поля %s с кодом %s", fieldErr.Field, fieldErr.Code)
+		}
+	}
+}
+
+func TestStructDive(t *testing.T) {
+	err := Struct(testRequest{Name: "abcdef", IDs: []int{1, -1}})
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Ожидались две ошибки, получено: %v", err)
+	}
+	if errs[0].Field != "name" || errs[0].Code != CodeMax {
+		t.Errorf("Ожидалась ошибка длины name, получено: %+v", errs[0])
+	}
+	if errs[1].Field != "ids[1]" || errs[1].Code != CodeMin {
+		t.Errorf("Ожидалась ошибка ids[1], получено: %+v", errs[1])
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("test_digits", func(value string) error {
+		for _, c := range value {
+			if c < '0' || c > '9' {
+				return errors.New("допускаются только цифры")
+			}
+		}
+		return nil
+	})
+
+	request := struct {
+		Number string `json:"number" validate:"test_digits"`
+	}{Number: "12a"}
+	err := Struct(request)
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Code != "test_digits" || errs[0].Message != "допускаются только цифры" {
+		t.Errorf("Ожидалась ошибка правила test_digits, получено: %v", err)
+	}
+}
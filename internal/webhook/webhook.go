@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"project-znak/internal/tracing"
+)
+
+// Заголовок с HMAC-SHA256 подписью тела запроса
+const SignatureHeader = "X-Webhook-Signature"
+
+// Event - событие, отправляемое на адрес вебхука
+type Event struct {
+	Type       string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// Client отправляет события на внешний адрес с подписью общим секретом
+type Client struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+}
+
+// NewClient создает клиент вебхуков. Если адрес не задан, клиент отключен.
+func NewClient(url, secret string, timeout time.Duration) *Client {
+	return &Client{
+		url:        url,
+		secret:     secret,
+		httpClient: &http.Client{Timeout: timeout, Transport: tracing.Transport("webhook")},
+	}
+}
+
+// Enabled сообщает, задан ли адрес вебхука
+func (c *Client) Enabled() bool {
+	return c != nil && c.url != ""
+}
+
+// Sign вычисляет подпись тела запроса; получатель проверяет ее тем же секретом
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send отправляет событие. Успешным считается любой ответ с кодом 2xx.
+func (c *Client) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("ошибка формирования события: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.secret != "" {
+		req.Header.Set(SignatureHeader, Sign(c.secret, body))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки вебхука: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("получатель вебхука вернул ошибку: %d, тело: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendSignsBody(t *testing.T) {
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "secret", time.Second)
+	if err := client.Send(context.Background(), Event{Type: "document.accepted", Data: map[string]int{"id": 1}}); err != nil {
+		t.Fatalf("Send() вернул ошибку: %v", err)
+	}
+
+	if want := Sign("secret", body); signature != want {
+		t.Errorf("подпись = %q, ожидалась %q", signature, want)
+	}
+}
+
+func TestSendErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	if err := NewClient(server.URL, "", time.Second).Send(context.Background(), Event{Type: "test"}); err == nil {
+		t.Error("ожидалась ошибка при ответе 502")
+	}
+}
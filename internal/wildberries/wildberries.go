@@ -0,0 +1,156 @@
+package wildberries
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"project-znak/internal/tracing"
+)
+
+// ErrUnauthorized возвращается, если Wildberries отклонил токен API продавца
+var ErrUnauthorized = errors.New("токен API Wildberries недействителен или не имеет доступа к маркетплейсу")
+
+// ErrNotFound возвращается, если поставка или сборочное задание не найдены
+var ErrNotFound = errors.New("поставка или сборочное задание не найдены в Wildberries")
+
+// APIError - ошибка, возвращенная API Wildberries
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("Wildberries вернул ошибку %d: %s %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("Wildberries вернул ошибку %d: %s", e.StatusCode, e.Message)
+}
+
+// Order - сборочное задание поставки FBS
+type Order struct {
+	ID      int64    `json:"id"`
+	Article string   `json:"article"`
+	NmID    int64    `json:"nmId"`
+	SKUs    []string `json:"skus"` // Штрихкоды товара
+}
+
+// Client выполняет запросы к API маркетплейса Wildberries. Токен API передается
+// в каждом запросе: он принадлежит продавцу, а не сервису.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient создает клиент API маркетплейса Wildberries
+func NewClient(baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: timeout, Transport: tracing.Transport("wildberries")},
+	}
+}
+
+// Enabled сообщает, настроен ли адрес API Wildberries
+func (c *Client) Enabled() bool {
+	return c != nil && c.baseURL != ""
+}
+
+// SupplyOrders возвращает сборочные задания поставки
+func (c *Client) SupplyOrders(ctx context.Context, token, supplyID string) ([]Order, error) {
+	var response struct {
+		Orders []Order `json:"orders"`
+	}
+	if err := c.do(ctx, token, http.MethodGet, "/api/v3/supplies/"+url.PathEscape(supplyID)+"/orders", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Orders, nil
+}
+
+// SetOrderCodes привязывает коды маркировки к сборочному заданию
+func (c *Client) SetOrderCodes(ctx context.Context, token string, orderID int64, codes []string) error {
+	body := map[string][]string{"sgtins": codes}
+	return c.do(ctx, token, http.MethodPut, fmt.Sprintf("/api/v3/orders/%d/meta/sgtin", orderID), body, nil)
+}
+
+// Выполнение запроса к API; ответ декодируется в result, если он не nil
+func (c *Client) do(ctx context.Context, token, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("ошибка сериализации запроса: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса к Wildberries: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return ErrUnauthorized
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var payload struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &payload) == nil && (payload.Code != "" || payload.Message != "") {
+			apiErr.Code, apiErr.Message = payload.Code, payload.Message
+		} else {
+			apiErr.Message = string(data)
+		}
+		return apiErr
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("ошибка декодирования ответа: %w", err)
+	}
+	return nil
+}
+
+// BarcodeGTIN приводит штрихкод товара к GTIN-14 кода маркировки: EAN-13 дополняется
+// ведущим нулем. Для штрихкодов другого формата возвращается false.
+func BarcodeGTIN(barcode string) (string, bool) {
+	barcode = strings.TrimSpace(barcode)
+	for _, r := range barcode {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	switch len(barcode) {
+	case 13:
+		return "0" + barcode, true
+	case 14:
+		return barcode, true
+	}
+	return "", false
+}
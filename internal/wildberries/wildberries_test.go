@@ -0,0 +1,82 @@
+package wildberries
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSupplyOrdersAndCodes(t *testing.T) {
+	var bound map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v3/supplies/WB-GI-1/orders":
+			w.Write([]byte(`{"orders":[{"id":101,"article":"A-1","nmId":5,"skus":["4600000000015"]}]}`))
+		case r.Method == http.MethodPut && r.URL.Path == "/api/v3/orders/101/meta/sgtin":
+			json.NewDecoder(r.Body).Decode(&bound)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPut && r.URL.Path == "/api/v3/orders/102/meta/sgtin":
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"code":"FailedToUpdateMeta","message":"Не удалось обновить метаданные"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, time.Second)
+	ctx := context.Background()
+
+	orders, err := client.SupplyOrders(ctx, "token", "WB-GI-1")
+	if err != nil {
+		t.Fatalf("SupplyOrders() вернул ошибку: %v", err)
+	}
+	if len(orders) != 1 || orders[0].ID != 101 || len(orders[0].SKUs) != 1 {
+		t.Fatalf("неверные сборочные задания: %+v", orders)
+	}
+
+	if err := client.SetOrderCodes(ctx, "token", 101, []string{"CODE1"}); err != nil {
+		t.Fatalf("SetOrderCodes() вернул ошибку: %v", err)
+	}
+	if len(bound["sgtins"]) != 1 || bound["sgtins"][0] != "CODE1" {
+		t.Errorf("неверное тело запроса привязки: %v", bound)
+	}
+
+	var apiErr *APIError
+	if err := client.SetOrderCodes(ctx, "token", 102, []string{"CODE2"}); !errors.As(err, &apiErr) || apiErr.Code != "FailedToUpdateMeta" {
+		t.Errorf("ожидалась ошибка API с кодом FailedToUpdateMeta, получено %v", err)
+	}
+	if _, err := client.SupplyOrders(ctx, "wrong", "WB-GI-1"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("ожидалась ошибка ErrUnauthorized, получено %v", err)
+	}
+	if _, err := client.SupplyOrders(ctx, "token", "WB-GI-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ожидалась ошибка ErrNotFound, получено %v", err)
+	}
+}
+
+func TestBarcodeGTIN(t *testing.T) {
+	tests := []struct {
+		barcode string
+		gtin    string
+		ok      bool
+	}{
+		{"4600000000015", "04600000000015", true},
+		{"04600000000015", "04600000000015", true},
+		{"2000000000015X", "", false},
+		{"123456", "", false},
+	}
+	for _, tt := range tests {
+		gtin, ok := BarcodeGTIN(tt.barcode)
+		if gtin != tt.gtin || ok != tt.ok {
+			t.Errorf("BarcodeGTIN(%q) = %q, %v; ожидалось %q, %v", tt.barcode, gtin, ok, tt.gtin, tt.ok)
+		}
+	}
+}
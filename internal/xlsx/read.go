@@ -0,0 +1,206 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Наибольший размер распакованного файла книги: защита от архивов с большой степенью сжатия
+const maxPartSize = 64 << 20
+
+// Разметка книги, листа и общих строк, нужная для чтения значений
+type (
+	xmlWorkbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	xmlRelationships struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	xmlSharedStrings struct {
+		Items []xmlText `xml:"si"`
+	}
+	xmlText struct {
+		T    string `xml:"t"`
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	}
+	xmlSheet struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R  string   `xml:"r,attr"`
+				T  string   `xml:"t,attr"`
+				V  string   `xml:"v"`
+				Is *xmlText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+)
+
+// Текст строки: простой или из фрагментов с форматированием
+func (t xmlText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+// Read читает значения первого листа книги XLSX. Строки возвращаются по порядку
+// с учетом пропущенных; значения ячеек - в виде текста, числа и даты - так, как они
+// хранятся в книге, без применения формата.
+func Read(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("файл не является книгой XLSX: %w", err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[strings.TrimPrefix(file.Name, "/")] = file
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared xmlSharedStrings
+	if file, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodePart(file, &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	file, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("в книге нет листа %s", sheetPath)
+	}
+	var sheet xmlSheet
+	if err := decodePart(file, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		index := len(rows)
+		if row.R > 0 {
+			index = row.R - 1
+		}
+		for len(rows) <= index {
+			rows = append(rows, nil)
+		}
+
+		var values []string
+		for i, cell := range row.Cells {
+			column := i
+			if cell.R != "" {
+				if column, err = columnIndex(cell.R); err != nil {
+					return nil, err
+				}
+			}
+			for len(values) <= column {
+				values = append(values, "")
+			}
+
+			switch cell.T {
+			case "s":
+				n, err := strconv.Atoi(cell.V)
+				if err != nil || n < 0 || n >= len(shared.Items) {
+					return nil, fmt.Errorf("некорректная ссылка на строку в ячейке %s", cell.R)
+				}
+				values[column] = shared.Items[n].String()
+			case "inlineStr":
+				if cell.Is != nil {
+					values[column] = cell.Is.String()
+				}
+			default:
+				values[column] = cell.V
+			}
+		}
+		rows[index] = values
+	}
+	return rows, nil
+}
+
+// Путь к первому листу книги по описанию книги и его связям
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	var workbook xmlWorkbook
+	file, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", errors.New("в книге нет описания xl/workbook.xml")
+	}
+	if err := decodePart(file, &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("в книге нет листов")
+	}
+
+	var rels xmlRelationships
+	if file, ok := files["xl/_rels/workbook.xml.rels"]; ok {
+		if err := decodePart(file, &rels); err != nil {
+			return "", err
+		}
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "xl/worksheets/sheet1.xml", nil
+}
+
+// Разбор XML-файла книги
+func decodePart(file *zip.File, v any) error {
+	if file.UncompressedSize64 > maxPartSize {
+		return fmt.Errorf("файл %s книги слишком большой", file.Name)
+	}
+	f, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения %s: %w", file.Name, err)
+	}
+	defer f.Close()
+	if err := xml.NewDecoder(io.LimitReader(f, maxPartSize)).Decode(v); err != nil {
+		return fmt.Errorf("ошибка разбора %s: %w", file.Name, err)
+	}
+	return nil
+}
+
+// Номер столбца с нуля по адресу ячейки, например B7 - 1
+func columnIndex(ref string) (int, error) {
+	index := 0
+	for i, r := range ref {
+		if r >= 'A' && r <= 'Z' {
+			index = index*26 + int(r-'A'+1)
+			if index > 16384 {
+				break
+			}
+			continue
+		}
+		if i == 0 {
+			break
+		}
+		return index - 1, nil
+	}
+	return 0, fmt.Errorf("некорректный адрес ячейки %q", ref)
+}
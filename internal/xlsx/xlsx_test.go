@@ -0,0 +1,122 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	rows := [][]any{
+		{"Платеж", "Сумма", "Дата", "Комментарий"},
+		{42, 150.5, time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC), "<оплата & возврат>"},
+		{43, nil, nil, "без суммы"},
+	}
+	if err := Write(&buf, "Выписка: март", rows); err != nil {
+		t.Fatalf("Write() вернул ошибку: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("книга не является ZIP-архивом: %v", err)
+	}
+	files := make(map[string]string)
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatalf("ошибка чтения %s: %v", file.Name, err)
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		files[file.Name] = string(data)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("в книге нет файла %s", name)
+		}
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `name="Выписка_ март"`) {
+		t.Errorf("неверное имя листа: %s", files["xl/workbook.xml"])
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A2"><v>42</v></c>`,
+		`<c r="B2"><v>150.5</v></c>`,
+		`<c r="C2" t="inlineStr"><is><t>01.03.2026 12:30</t></is></c>`,
+		`&lt;оплата &amp; возврат&gt;`,
+		`<row r="3"><c r="A3"><v>43</v></c><c r="D3"`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("лист не содержит %s: %s", want, sheet)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for index, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(index); got != want {
+			t.Errorf("columnName(%d) = %s, ожидалось %s", index, got, want)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	var buf bytes.Buffer
+	rows := [][]any{
+		{"ИНН", "Email"},
+		{"7707083893", nil, "<a & b>"},
+		nil,
+		{12.5},
+	}
+	if err := Write(&buf, "Клиенты", rows); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Read(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Read() вернул ошибку: %v", err)
+	}
+	want := [][]string{{"ИНН", "Email"}, {"7707083893", "", "<a & b>"}, nil, {"12.5"}}
+	if len(got) != len(want) {
+		t.Fatalf("прочитано строк: %d, ожидалось %d: %q", len(got), len(want), got)
+	}
+	for i := range want {
+		if strings.Join(got[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("строка %d: %q, ожидалось %q", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestReadSharedStrings(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="A" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId3" Type="worksheet" Target="worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<si><t>ИНН</t></si><si><r><t>ivan@</t></r><r><t>example.com</t></r></si></sst>`,
+		"xl/worksheets/data.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c></row>` +
+			`<row r="2"><c r="A2"><v>7707083893</v></c><c r="C2" t="s"><v>1</v></c></row></sheetData></worksheet>`,
+	} {
+		f, _ := archive.Create(name)
+		io.WriteString(f, content)
+	}
+	archive.Close()
+
+	got, err := Read(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Read() вернул ошибку: %v", err)
+	}
+	if len(got) != 2 || got[0][0] != "ИНН" || len(got[1]) != 3 || got[1][0] != "7707083893" || got[1][2] != "ivan@example.com" {
+		t.Errorf("неверные значения: %q", got)
+	}
+}
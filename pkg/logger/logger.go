@@ -37,6 +37,16 @@ func Init(level string, file string) error {
 	return nil
 }
 
+// SetLevel меняет уровень логирования без пересоздания логгера
+func SetLevel(level string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	GetLogger().SetLevel(lvl)
+	return nil
+}
+
 // GetLogger возвращает инстанс логгера
 func GetLogger() *logrus.Logger {
 	if log == nil {
@@ -0,0 +1,138 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Теги, которыми помечаются события Sentry
+const (
+	TagRequestID = "request_id"
+	TagUserID    = "user_id"
+	TagRoute     = "route"
+)
+
+// SentryConfig - настройки отправки ошибок в Sentry. Без DSN ошибки не отправляются.
+type SentryConfig struct {
+	DSN         string
+	Environment string
+	Release     string  // Версия приложения, по ней в Sentry группируются события
+	SampleRate  float64 // Доля отправляемых событий, от 0 до 1
+}
+
+var sentryEnabled bool
+
+// InitSentry подключает отправку в Sentry записей журнала уровня error и выше, а также
+// ошибок и паник, переданных в ReportError и ReportPanic
+func InitSentry(cfg SentryConfig) error {
+	if cfg.DSN == "" {
+		return nil
+	}
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:         cfg.DSN,
+		Environment: cfg.Environment,
+		Release:     cfg.Release,
+		SampleRate:  cfg.SampleRate,
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка настройки Sentry: %w", err)
+	}
+	GetLogger().AddHook(sentryHook{})
+	sentryEnabled = true
+	return nil
+}
+
+// SentryEnabled сообщает, отправляются ли ошибки в Sentry
+func SentryEnabled() bool {
+	return sentryEnabled
+}
+
+// FlushSentry дожидается отправки накопленных событий, но не дольше timeout
+func FlushSentry(timeout time.Duration) {
+	if sentryEnabled {
+		sentry.Flush(timeout)
+	}
+}
+
+// WithSentryScope возвращает контекст с отдельной областью Sentry для запроса. Теги
+// области добавляются ко всем событиям, отправленным с этим контекстом.
+func WithSentryScope(ctx context.Context, tags map[string]string) context.Context {
+	if !sentryEnabled {
+		return ctx
+	}
+	hub := sentry.CurrentHub().Clone()
+	hub.Scope().SetTags(tags)
+	return sentry.SetHubOnContext(ctx, hub)
+}
+
+// SetTag добавляет тег в область Sentry контекста, например user_id после авторизации
+func SetTag(ctx context.Context, key, value string) {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.Scope().SetTag(key, value)
+	}
+}
+
+// ReportError отправляет ошибку в Sentry с тегами области контекста
+func ReportError(ctx context.Context, err error) {
+	if !sentryEnabled || err == nil {
+		return
+	}
+	contextHub(ctx).CaptureException(err)
+}
+
+// ReportPanic отправляет панику в Sentry с тегами области контекста. Вызывается из
+// отложенной функции, перехватившей панику, чтобы в событие попал стек вызовов.
+func ReportPanic(ctx context.Context, value any) {
+	if !sentryEnabled {
+		return
+	}
+	contextHub(ctx).RecoverWithContext(ctx, value)
+}
+
+func contextHub(ctx context.Context) *sentry.Hub {
+	if ctx != nil {
+		if hub := sentry.GetHubFromContext(ctx); hub != nil {
+			return hub
+		}
+	}
+	return sentry.CurrentHub()
+}
+
+// sentryHook отправляет записи журнала уровня error и выше в Sentry. Поля request_id,
+// user_id и route записи становятся тегами события.
+type sentryHook struct{}
+
+func (sentryHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.ErrorLevel, logrus.FatalLevel, logrus.PanicLevel}
+}
+
+func (sentryHook) Fire(entry *logrus.Entry) error {
+	hub := contextHub(entry.Context)
+	hub.WithScope(func(scope *sentry.Scope) {
+		for _, tag := range []string{TagRequestID, TagUserID, TagRoute} {
+			if value, ok := entry.Data[tag]; ok {
+				scope.SetTag(tag, fmt.Sprint(value))
+			}
+		}
+		if entry.Level == logrus.ErrorLevel {
+			scope.SetLevel(sentry.LevelError)
+		} else {
+			scope.SetLevel(sentry.LevelFatal)
+		}
+
+		if err, ok := entry.Data[logrus.ErrorKey].(error); ok {
+			hub.CaptureException(fmt.Errorf("%s: %w", entry.Message, err))
+			return
+		}
+		hub.CaptureMessage(entry.Message)
+	})
+	// Перед аварийным завершением процесса событие должно успеть отправиться
+	if entry.Level != logrus.ErrorLevel {
+		hub.Flush(2 * time.Second)
+	}
+	return nil
+}
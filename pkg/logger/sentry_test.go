@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Транспорт, сохраняющий события вместо отправки
+type recordTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *recordTransport) Flush(time.Duration) bool              { return true }
+func (t *recordTransport) FlushWithContext(context.Context) bool { return true }
+func (t *recordTransport) Configure(sentry.ClientOptions)        {}
+func (t *recordTransport) Close()                                {}
+func (t *recordTransport) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	t.events = append(t.events, event)
+	t.mu.Unlock()
+}
+
+func TestSentryHook(t *testing.T) {
+	transport := &recordTransport{}
+	if err := sentry.Init(sentry.ClientOptions{Dsn: "https://key@sentry.example.com/1", Release: "1.2.0", Transport: transport}); err != nil {
+		t.Fatal(err)
+	}
+	sentryEnabled = true
+	defer func() { sentryEnabled = false }()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	log.AddHook(sentryHook{})
+
+	ctx := WithSentryScope(context.Background(), map[string]string{TagRequestID: "req-1", TagRoute: "POST /api/kizs"})
+	SetTag(ctx, TagUserID, "42")
+	log.WithContext(ctx).WithError(errors.New("timeout")).Error("ошибка запроса к СУЗ")
+	log.Info("информационное сообщение")
+
+	if len(transport.events) != 1 {
+		t.Fatalf("ожидалось одно событие, получено %d", len(transport.events))
+	}
+	event := transport.events[0]
+	for tag, want := range map[string]string{TagRequestID: "req-1", TagUserID: "42", TagRoute: "POST /api/kizs"} {
+		if event.Tags[tag] != want {
+			t.Errorf("тег %s = %q, ожидалось %q", tag, event.Tags[tag], want)
+		}
+	}
+	if event.Release != "1.2.0" {
+		t.Errorf("версия события %q, ожидалась 1.2.0", event.Release)
+	}
+	if len(event.Exception) == 0 || event.Exception[len(event.Exception)-1].Value != "ошибка запроса к СУЗ: timeout" {
+		t.Errorf("в событии нет ошибки из записи журнала: %+v", event.Exception)
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// BodyLimit ограничивает размер тела запроса. Для путей из routes действует собственное
+// ограничение (путь, оканчивающийся на "/", задает ограничение для всех вложенных путей,
+// "*" заменяет один сегмент пути), для остальных - limit; нулевое значение отключает ограничение.
+//
+// Запрос с заголовком Content-Length больше ограничения сразу получает 413 в едином
+// формате ошибок. Тело без Content-Length читается через http.MaxBytesReader: чтение
+// сверх ограничения возвращает *http.MaxBytesError, и ответ 413 отправляет обработчик.
+func BodyLimit(limit int64, routes map[string]int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			maxSize := routeValue(r.URL.Path, limit, routes)
+			if maxSize <= 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > maxSize {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Connection", "close")
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				json.NewEncoder(w).Encode(map[string]string{
+					"status":  "error",
+					"message": TooLargeMessage(maxSize),
+				})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TooLargeMessage возвращает сообщение об ошибке для тела запроса больше limit байт
+func TooLargeMessage(limit int64) string {
+	switch {
+	case limit >= 1<<20 && limit%(1<<20) == 0:
+		return fmt.Sprintf("Размер запроса превышает %d МБ", limit>>20)
+	case limit >= 1<<10 && limit%(1<<10) == 0:
+		return fmt.Sprintf("Размер запроса превышает %d КБ", limit>>10)
+	default:
+		return fmt.Sprintf("Размер запроса превышает %d байт", limit)
+	}
+}
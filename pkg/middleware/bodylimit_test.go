@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	var readErr error
+	handler := BodyLimit(8, map[string]int64{"/upload": 1 << 20})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader("слишком длинное тело")))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("ожидался статус 413, получен %d", rec.Code)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body["message"] != "Размер запроса превышает 8 байт" {
+		t.Errorf("ответ не в едином формате ошибок: %v %v", body, err)
+	}
+
+	// Без Content-Length превышение обнаруживается при чтении тела
+	request := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader("слишком длинное тело"))
+	request.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	var tooLarge *http.MaxBytesError
+	if !errors.As(readErr, &tooLarge) || tooLarge.Limit != 8 {
+		t.Errorf("ожидалась ошибка *http.MaxBytesError, получена %v", readErr)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("слишком длинное тело")))
+	if rec.Code != http.StatusOK || readErr != nil {
+		t.Errorf("ограничение маршрута не применено: %d %v", rec.Code, readErr)
+	}
+}
+
+func TestTooLargeMessage(t *testing.T) {
+	tests := map[int64]string{
+		10 << 20: "Размер запроса превышает 10 МБ",
+		64 << 10: "Размер запроса превышает 64 КБ",
+		1500:     "Размер запроса превышает 1500 байт",
+	}
+	for limit, want := range tests {
+		if got := TooLargeMessage(limit); got != want {
+			t.Errorf("TooLargeMessage(%d) = %q, ожидалось %q", limit, got, want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+// Compression сжимает ответы методом gzip или deflate, если клиент поддерживает его
+// (заголовок Accept-Encoding). Сжимаются ответы не короче minSize байт с типом содержимого
+// из contentTypes; элемент вида text/* разрешает все подтипы. Ответы, уже имеющие
+// Content-Encoding, передаются без изменений.
+func Compression(minSize int, contentTypes []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, contentTypes: contentTypes}
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// Выбор метода сжатия по заголовку Accept-Encoding; gzip предпочтительнее deflate.
+// Возвращает пустую строку, если клиент не принимает ни один из них.
+func acceptedEncoding(header string) string {
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		quality[name] = q
+	}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if q, ok := quality[encoding]; ok {
+			if q > 0 {
+				return encoding
+			}
+			continue
+		}
+		if q, ok := quality["*"]; ok && q > 0 {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// Проверка типа содержимого по списку разрешенных; параметры типа (charset) не учитываются
+func compressibleType(contentType string, allowed []string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter накапливает начало ответа, пока не станет ясно, нужно ли его сжимать:
+// размер ответа достиг minSize или обработчик завершился
+type compressWriter struct {
+	http.ResponseWriter
+	encoding     string
+	minSize      int
+	contentTypes []string
+
+	status  int
+	buf     []byte
+	decided bool
+	writer  io.WriteCloser // Сжимающий поток; nil, если ответ передается без сжатия
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	// Информационные ответы передаются сразу и не завершают ответ
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.minSize {
+			return len(p), nil
+		}
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.writer != nil {
+		return cw.writer.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Выбор между сжатием и передачей без изменений, отправка заголовков и накопленных данных
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	compress := len(cw.buf) > 0 && len(cw.buf) >= cw.minSize &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusNotModified &&
+		header.Get("Content-Encoding") == "" &&
+		compressibleType(header.Get("Content-Type"), cw.contentTypes)
+
+	if compress {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		// Сжатое тело отличается от исходного побайтно: сильный валидатор становится слабым
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		if cw.encoding == "gzip" {
+			gz := gzipWriters.Get().(*gzip.Writer)
+			gz.Reset(cw.ResponseWriter)
+			cw.writer = gz
+		} else {
+			fl, _ := flate.NewWriter(cw.ResponseWriter, flate.DefaultCompression)
+			cw.writer = fl
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.writer != nil {
+		_, err = cw.writer.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Завершение ответа после возврата из обработчика
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.writer == nil {
+		return
+	}
+	cw.writer.Close()
+	if gz, ok := cw.writer.(*gzip.Writer); ok {
+		gz.Reset(io.Discard)
+		gzipWriters.Put(gz)
+	}
+}
+
+// Flush отправляет накопленное начало ответа и сжатые данные клиенту. Ответ, переданный
+// частично, сжимается, только если набрал minSize байт; иначе он передается без сжатия.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide()
+	}
+	if flusher, ok := cw.writer.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
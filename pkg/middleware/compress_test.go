@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	body := `{"codes":["` + strings.Repeat("0104601234567890215abcdef", 100) + `"]}`
+	types := []string{"application/json", "text/*"}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		encoding       string
+	}{
+		{"gzip", "gzip, deflate", "application/json; charset=utf-8", body, "gzip"},
+		{"deflate", "deflate, gzip;q=0", "application/json", body, "deflate"},
+		{"без поддержки клиента", "br", "application/json", body, ""},
+		{"тип не из списка", "gzip", "application/pdf", body, ""},
+		{"подтип по маске", "gzip", "text/csv", body, "gzip"},
+		{"короткий ответ", "gzip", "application/json", `{"status":"success"}`, ""},
+	}
+
+	for _, tt := range tests {
+		handler := Compression(256, types)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			w.Header().Set("ETag", `"v1"`)
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, tt.body[:len(tt.body)/2])
+			io.WriteString(w, tt.body[len(tt.body)/2:])
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/api/requests", nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s: Content-Encoding = %q, ожидалось %q", tt.name, got, tt.encoding)
+			continue
+		}
+		if etag := rec.Header().Get("ETag"); (tt.encoding != "") != (etag == `W/"v1"`) {
+			t.Errorf("%s: ETag = %s, сжатый ответ передается со слабым валидатором", tt.name, etag)
+		}
+		var reader io.Reader = rec.Body
+		switch tt.encoding {
+		case "gzip":
+			gz, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			reader = gz
+		case "deflate":
+			reader = flate.NewReader(rec.Body)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil || string(data) != tt.body {
+			t.Errorf("%s: тело ответа искажено: %v", tt.name, err)
+		}
+	}
+}
+
+func TestCompressionFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	var flushed string
+	handler := Compression(256, []string{"text/*"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: progress\ndata: {}\n\n")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush вернул ошибку: %v", err)
+		}
+		flushed = rec.Body.String()
+		io.WriteString(w, "event: done\ndata: {}\n\n")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/requests/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(rec, req)
+
+	if flushed != "event: progress\ndata: {}\n\n" || !rec.Flushed {
+		t.Errorf("начало ответа не передано при Flush: %q", flushed)
+	}
+	if rec.Header().Get("Content-Encoding") != "" || !strings.HasSuffix(rec.Body.String(), "event: done\ndata: {}\n\n") {
+		t.Errorf("ответ после Flush искажен: %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,256 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Границы корзин гистограммы времени ожидания в очереди, секунд
+var laneWaitBuckets = []float64{0.1, 0.5, 1, 2, 5, 10, 30}
+
+// Lane - полоса очереди ресурсоемких запросов со своим пулом обработчиков
+type Lane struct {
+	Name      string
+	Workers   int // Число одновременно обрабатываемых запросов, выделенное полосе
+	QueueSize int // Наибольшее число ожидающих запросов; 0 - запросы сверх лимита сразу отклоняются
+}
+
+// LaneStats - состояние полосы очереди для метрик
+type LaneStats struct {
+	Name        string
+	Workers     int       // Размер пула обработчиков полосы
+	Busy        int       // Занятые обработчики пула, в том числе запросами более приоритетных полос
+	Active      int       // Выполняемые запросы полосы, в том числе на обработчиках менее приоритетных полос
+	Queued      int       // Запросы, ожидающие обработчика
+	Admitted    int64     // Запросы, принятые в обработку
+	Rejected    int64     // Запросы, отклоненные при заполненной очереди
+	Abandoned   int64     // Запросы, не дождавшиеся обработчика до отмены запроса
+	WaitSeconds float64   // Суммарное время ожидания принятых запросов
+	WaitBuckets []float64 // Границы корзин гистограммы времени ожидания, секунд
+	WaitCounts  []int64   // Число принятых запросов, ожидавших не дольше границы корзины
+}
+
+// LaneQueue распределяет ресурсоемкие запросы по полосам с разным приоритетом. Полосы
+// перечисляются от самой приоритетной. Запрос полосы занимает свободный обработчик своей
+// или менее приоритетной полосы, поэтому приоритетные запросы обрабатываются первыми,
+// а обработчики приоритетной полосы остаются за ней. Освободившийся обработчик берет
+// запрос из самой приоритетной ожидающей полосы, которой он доступен; внутри полосы
+// очередь обходит ключи (пользователей) по кругу, чтобы один пользователь не занимал
+// все обработчики. Запрос ждет обработчика, пока не отменен его контекст.
+type LaneQueue struct {
+	classify func(r *http.Request) (lane, key string)
+
+	mu    sync.Mutex
+	lanes []*laneState
+	index map[string]int
+}
+
+type laneState struct {
+	Lane
+	free    int                  // Свободные обработчики пула
+	active  int                  // Выполняемые запросы полосы
+	keys    []string             // Ключи с ожидающими запросами в порядке обхода
+	waiters map[string][]*waiter // Ожидающие запросы по ключам
+	queued  int
+
+	admitted, rejected, abandoned int64
+	waitSeconds                   float64
+	waitCounts                    []int64
+}
+
+// Ожидающий запрос; в ready передается индекс полосы выделенного обработчика
+type waiter struct {
+	ready chan int
+}
+
+// NewLaneQueue создает очередь с полосами lanes. classify определяет полосу и ключ
+// справедливого распределения запроса; запросы неизвестной полосы попадают в последнюю,
+// наименее приоритетную полосу. Если classify не задан, все запросы - в последней полосе.
+func NewLaneQueue(lanes []Lane, classify func(r *http.Request) (lane, key string)) *LaneQueue {
+	q := &LaneQueue{classify: classify, index: make(map[string]int, len(lanes))}
+	for i, lane := range lanes {
+		q.lanes = append(q.lanes, &laneState{
+			Lane:       lane,
+			free:       lane.Workers,
+			waiters:    make(map[string][]*waiter),
+			waitCounts: make([]int64, len(laneWaitBuckets)),
+		})
+		q.index[lane.Name] = i
+	}
+	return q
+}
+
+// Middleware выполняет запросы по очереди. Запросы сверх размера очереди полосы
+// и не дождавшиеся обработчика получают ответ 503 с заголовком Retry-After.
+func (q *LaneQueue) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lane, key := len(q.lanes)-1, ""
+		if q.classify != nil {
+			name, k := q.classify(r)
+			if i, ok := q.index[name]; ok {
+				lane = i
+			}
+			key = k
+		}
+
+		worker, ok := q.acquire(r, lane, key)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status":  "error",
+				"message": "Сервис перегружен, повторите запрос позже",
+			})
+			return
+		}
+		defer q.release(lane, worker)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Занятие обработчика для запроса полосы lane. Возвращает индекс полосы обработчика.
+func (q *LaneQueue) acquire(r *http.Request, lane int, key string) (int, bool) {
+	start := time.Now()
+	q.mu.Lock()
+	for i := lane; i < len(q.lanes); i++ {
+		if q.lanes[i].free > 0 {
+			q.lanes[i].free--
+			q.admit(lane, 0)
+			q.mu.Unlock()
+			return i, true
+		}
+	}
+
+	state := q.lanes[lane]
+	if state.queued >= state.QueueSize {
+		state.rejected++
+		q.mu.Unlock()
+		return 0, false
+	}
+	wt := &waiter{ready: make(chan int, 1)}
+	if len(state.waiters[key]) == 0 {
+		state.keys = append(state.keys, key)
+	}
+	state.waiters[key] = append(state.waiters[key], wt)
+	state.queued++
+	q.mu.Unlock()
+
+	select {
+	case worker := <-wt.ready:
+		q.mu.Lock()
+		q.admit(lane, time.Since(start))
+		q.mu.Unlock()
+		return worker, true
+	case <-r.Context().Done():
+		q.mu.Lock()
+		removed := state.remove(key, wt)
+		state.abandoned++
+		q.mu.Unlock()
+		if !removed {
+			// Обработчик выделен одновременно с отменой: передаем его следующему запросу
+			q.release(-1, <-wt.ready)
+		}
+		return 0, false
+	}
+}
+
+// Учет запроса, принятого в обработку после ожидания wait
+func (q *LaneQueue) admit(lane int, wait time.Duration) {
+	state := q.lanes[lane]
+	state.active++
+	state.admitted++
+	seconds := wait.Seconds()
+	state.waitSeconds += seconds
+	for i, bound := range laneWaitBuckets {
+		if seconds <= bound {
+			state.waitCounts[i]++
+		}
+	}
+}
+
+// Освобождение обработчика полосы worker после запроса полосы lane (-1 - запрос не выполнялся).
+// Обработчик передается ожидающему запросу самой приоритетной полосы, которой он доступен.
+func (q *LaneQueue) release(lane, worker int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if lane >= 0 {
+		q.lanes[lane].active--
+	}
+	for i := 0; i <= worker; i++ {
+		if wt := q.lanes[i].next(); wt != nil {
+			wt.ready <- worker
+			return
+		}
+	}
+	q.lanes[worker].free++
+}
+
+// Следующий ожидающий запрос полосы: первый запрос очередного ключа по кругу
+func (l *laneState) next() *waiter {
+	if len(l.keys) == 0 {
+		return nil
+	}
+	key := l.keys[0]
+	queue := l.waiters[key]
+	wt := queue[0]
+	l.keys = l.keys[1:]
+	if len(queue) > 1 {
+		l.waiters[key] = queue[1:]
+		l.keys = append(l.keys, key)
+	} else {
+		delete(l.waiters, key)
+	}
+	l.queued--
+	return wt
+}
+
+// Удаление ожидающего запроса; false - запроса уже нет в очереди
+func (l *laneState) remove(key string, wt *waiter) bool {
+	queue := l.waiters[key]
+	for i, w := range queue {
+		if w != wt {
+			continue
+		}
+		queue = append(queue[:i:i], queue[i+1:]...)
+		l.queued--
+		if len(queue) > 0 {
+			l.waiters[key] = queue
+			return true
+		}
+		delete(l.waiters, key)
+		for j, k := range l.keys {
+			if k == key {
+				l.keys = append(l.keys[:j:j], l.keys[j+1:]...)
+				break
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Stats возвращает состояние полос очереди
+func (q *LaneQueue) Stats() []LaneStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := make([]LaneStats, 0, len(q.lanes))
+	for _, l := range q.lanes {
+		stats = append(stats, LaneStats{
+			Name:        l.Name,
+			Workers:     l.Workers,
+			Busy:        l.Workers - l.free,
+			Active:      l.active,
+			Queued:      l.queued,
+			Admitted:    l.admitted,
+			Rejected:    l.rejected,
+			Abandoned:   l.abandoned,
+			WaitSeconds: l.waitSeconds,
+			WaitBuckets: laneWaitBuckets,
+			WaitCounts:  append([]int64(nil), l.waitCounts...),
+		})
+	}
+	return stats
+}
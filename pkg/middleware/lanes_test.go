@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Очередь из двух полос; обработчик сообщает имя запроса из X-Name и ждет разрешения завершиться
+type laneTest struct {
+	queue    *LaneQueue
+	handler  http.Handler
+	started  chan string
+	mu       sync.Mutex
+	releases map[string]chan struct{}
+}
+
+func newLaneTest(lanes []Lane) *laneTest {
+	lt := &laneTest{started: make(chan string, 16), releases: make(map[string]chan struct{})}
+	lt.queue = NewLaneQueue(lanes, func(r *http.Request) (string, string) {
+		return r.Header.Get("X-Lane"), r.Header.Get("X-User")
+	})
+	lt.handler = lt.queue.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get("X-Name")
+		lt.started <- name
+		<-lt.release(name)
+	}))
+	return lt
+}
+
+func (lt *laneTest) release(name string) chan struct{} {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if lt.releases[name] == nil {
+		lt.releases[name] = make(chan struct{})
+	}
+	return lt.releases[name]
+}
+
+// Отправка запроса в отдельной горутине; ответ передается в канал
+func (lt *laneTest) send(ctx context.Context, name, lane, user string) chan int {
+	r := httptest.NewRequest(http.MethodPost, "/api/kizs", nil).WithContext(ctx)
+	r.Header.Set("X-Name", name)
+	r.Header.Set("X-Lane", lane)
+	r.Header.Set("X-User", user)
+	code := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		lt.handler.ServeHTTP(rec, r)
+		code <- rec.Code
+	}()
+	return code
+}
+
+func (lt *laneTest) expectStarted(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case name := <-lt.started:
+		if name != want {
+			t.Fatalf("начал выполняться запрос %s, ожидался %s", name, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("запрос %s не начал выполняться", want)
+	}
+}
+
+// Ожидание, пока в полосе lane не окажется queued ожидающих запросов
+func (lt *laneTest) waitQueued(t *testing.T, lane, queued int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for lt.queue.Stats()[lane].Queued != queued {
+		if time.Now().After(deadline) {
+			t.Fatalf("в полосе %d не дождались %d ожидающих запросов", lane, queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLaneQueuePriority(t *testing.T) {
+	lt := newLaneTest([]Lane{{Name: "premium", Workers: 1, QueueSize: 10}, {Name: "standard", Workers: 1, QueueSize: 10}})
+	ctx := context.Background()
+
+	lt.send(ctx, "s1", "standard", "a")
+	lt.expectStarted(t, "s1")
+	lt.send(ctx, "p1", "premium", "b")
+	lt.expectStarted(t, "p1")
+
+	// Обработчик приоритетной полосы недоступен обычным запросам
+	lt.send(ctx, "s2", "standard", "a")
+	lt.waitQueued(t, 1, 1)
+	lt.send(ctx, "p2", "premium", "b")
+	lt.waitQueued(t, 0, 1)
+
+	// Освободившийся обработчик обычной полосы достается приоритетному запросу
+	close(lt.release("s1"))
+	lt.expectStarted(t, "p2")
+	close(lt.release("p1"))
+	close(lt.release("p2"))
+	lt.expectStarted(t, "s2")
+	close(lt.release("s2"))
+
+	stats := lt.queue.Stats()
+	if stats[0].Admitted != 2 || stats[1].Admitted != 2 {
+		t.Errorf("принято запросов: %d и %d, ожидалось по 2", stats[0].Admitted, stats[1].Admitted)
+	}
+	if stats[0].WaitCounts[len(stats[0].WaitCounts)-1] != 2 {
+		t.Errorf("гистограмма ожидания приоритетной полосы: %v", stats[0].WaitCounts)
+	}
+}
+
+func TestLaneQueueFairShare(t *testing.T) {
+	lt := newLaneTest([]Lane{{Name: "standard", Workers: 1, QueueSize: 10}})
+	ctx := context.Background()
+
+	lt.send(ctx, "a1", "standard", "a")
+	lt.expectStarted(t, "a1")
+	lt.send(ctx, "a2", "standard", "a")
+	lt.waitQueued(t, 0, 1)
+	lt.send(ctx, "a3", "standard", "a")
+	lt.waitQueued(t, 0, 2)
+	lt.send(ctx, "b1", "standard", "b")
+	lt.waitQueued(t, 0, 3)
+
+	// Пользователь b обслуживается, не дожидаясь всех запросов пользователя a
+	for _, step := range [][2]string{{"a1", "a2"}, {"a2", "b1"}, {"b1", "a3"}} {
+		close(lt.release(step[0]))
+		lt.expectStarted(t, step[1])
+	}
+	close(lt.release("a3"))
+}
+
+func TestLaneQueueRejected(t *testing.T) {
+	lt := newLaneTest([]Lane{{Name: "standard", Workers: 1, QueueSize: 1}})
+
+	lt.send(context.Background(), "a1", "standard", "a")
+	lt.expectStarted(t, "a1")
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := lt.send(ctx, "a2", "standard", "a")
+	lt.waitQueued(t, 0, 1)
+
+	if code := <-lt.send(context.Background(), "a3", "standard", "a"); code != http.StatusServiceUnavailable {
+		t.Errorf("запрос сверх размера очереди: ожидался статус 503, получен %d", code)
+	}
+	cancel()
+	if code := <-waiting; code != http.StatusServiceUnavailable {
+		t.Errorf("отмененный ожидающий запрос: ожидался статус 503, получен %d", code)
+	}
+	close(lt.release("a1"))
+
+	stats := lt.queue.Stats()[0]
+	if stats.Rejected != 1 || stats.Abandoned != 1 || stats.Queued != 0 {
+		t.Errorf("статистика полосы: отклонено %d, не дождались %d, в очереди %d; ожидалось 1, 1, 0",
+			stats.Rejected, stats.Abandoned, stats.Queued)
+	}
+}
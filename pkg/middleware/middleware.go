@@ -1,59 +1,256 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 )
 
 // RateLimiter ограничивает количество запросов
 func RateLimiter(rps int, burst int) func(http.Handler) http.Handler {
-	limiter := rate.NewLimiter(rate.Limit(rps), burst)
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !limiter.Allow() {
-				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-				return
-			}
+	return NewLimiter(rps, burst).Middleware
+}
+
+// Limiter ограничивает количество запросов; лимиты можно менять во время работы
+type Limiter struct {
+	limiter *rate.Limiter
+}
+
+// NewLimiter создает ограничение rps запросов в секунду с допустимым всплеском burst
+func NewLimiter(rps int, burst int) *Limiter {
+	return &Limiter{limiter: rate.NewLimiter(rate.Limit(rps), burst)}
+}
+
+// SetLimit заменяет лимиты без сброса накопленных запросов
+func (l *Limiter) SetLimit(rps int, burst int) {
+	l.limiter.SetLimit(rate.Limit(rps))
+	l.limiter.SetBurst(burst)
+}
+
+// Заголовки с состоянием ограничения частоты запросов
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"     // Наибольший всплеск запросов
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining" // Сколько запросов можно отправить сразу
+	HeaderRateLimitReset     = "X-RateLimit-Reset"     // Unix-время полного восстановления лимита
+)
+
+// RateLimitState - состояние ограничения частоты запросов в теле ответа 429
+type RateLimitState struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// Middleware передает состояние лимита в заголовках X-RateLimit-* каждого ответа и
+// отклоняет запросы сверх лимита с кодом 429 и заголовком Retry-After
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		allowed := l.limiter.AllowN(now, 1)
+		state, retryAfter := l.state(now)
+
+		w.Header().Set(HeaderRateLimitLimit, strconv.Itoa(state.Limit))
+		w.Header().Set(HeaderRateLimitRemaining, strconv.Itoa(state.Remaining))
+		w.Header().Set(HeaderRateLimitReset, strconv.FormatInt(state.ResetsAt.Unix(), 10))
+		if allowed {
 			next.ServeHTTP(w, r)
+			return
+		}
+
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":      "error",
+			"message":     "Слишком много запросов",
+			"code":        "rate_limited",
+			"retry_after": seconds,
+			"rate_limit":  state,
 		})
+	})
+}
+
+// Состояние лимита на момент now и время до появления следующего запроса в лимите
+func (l *Limiter) state(now time.Time) (RateLimitState, time.Duration) {
+	tokens := l.limiter.TokensAt(now)
+	burst := l.limiter.Burst()
+	rps := float64(l.limiter.Limit())
+	state := RateLimitState{
+		Limit:     burst,
+		Remaining: max(int(tokens), 0),
+		ResetsAt:  now.Truncate(time.Second),
+	}
+	if rps <= 0 {
+		return state, 0
+	}
+	if missing := float64(burst) - tokens; missing > 0 {
+		state.ResetsAt = now.Add(time.Duration(missing / rps * float64(time.Second))).Truncate(time.Second).Add(time.Second)
+	}
+	var retryAfter time.Duration
+	if tokens < 1 {
+		retryAfter = time.Duration((1 - tokens) / rps * float64(time.Second))
+	}
+	return state, retryAfter
+}
+
+// ConcurrencyLimit ограничивает число одновременно обрабатываемых запросов. Запросы сверх
+// лимита сразу отклоняются с кодом 503, чтобы ресурсоемкие маршруты не перегружали сервис
+// независимо от ограничения частоты запросов. Один лимит можно применить к нескольким
+// маршрутам, тогда они делят его между собой. Очередь с приоритетами - LaneQueue.
+func ConcurrencyLimit(limit int) func(http.Handler) http.Handler {
+	return NewLaneQueue([]Lane{{Name: "default", Workers: limit}}, nil).Middleware
+}
+
+// Длина префикса API ключа в журнале доступа; префикс опознает ключ, не раскрывая его
+const apiKeyPrefixLength = 8
+
+// AccessInfo - сведения о пользователе и маршруте запроса для журнала доступа.
+// Middleware и обработчики дополняют их по мере обработки запроса.
+type AccessInfo struct {
+	mu         sync.Mutex
+	userID     int
+	telegramID int64
+	route      string // Шаблон маршрута, например /api/orders/
+}
+
+type accessInfoKey struct{}
+
+// AccessInfoFromContext возвращает сведения для журнала доступа текущего запроса или nil
+func AccessInfoFromContext(ctx context.Context) *AccessInfo {
+	info, _ := ctx.Value(accessInfoKey{}).(*AccessInfo)
+	return info
+}
+
+// SetUser запоминает пользователя запроса; нулевые значения не заменяют уже известные
+func (a *AccessInfo) SetUser(userID int, telegramID int64) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if userID > 0 {
+		a.userID = userID
+	}
+	if telegramID > 0 {
+		a.telegramID = telegramID
 	}
 }
 
-// LoggingMiddleware логирует запросы
+// SetRoute запоминает шаблон маршрута запроса
+func (a *AccessInfo) SetRoute(pattern string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.route = pattern
+}
+
+type clientIPKey struct{}
+
+// WithClientIP сохраняет в контексте адрес клиента, определенный с учетом доверенных прокси
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP возвращает адрес клиента, сохраненный WithClientIP, а без него - адрес соединения
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// RequestID возвращает идентификатор запроса: заголовок X-Request-ID, а если его нет -
+// идентификатор трассировки
+func RequestID(r *http.Request) string {
+	if requestID := r.Header.Get("X-Request-ID"); requestID != "" {
+		return requestID
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+// LoggingMiddleware записывает в журнал доступа одну структурированную запись на запрос:
+// шаблон маршрута, статус, размер ответа, длительность, адрес клиента (ClientIP), пользователя
+// и префикс API ключа.
+// Записи имеют уровень info и не выводятся при более высоком уровне журнала.
 func LoggingMiddleware(logger *logrus.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !logger.IsLevelEnabled(logrus.InfoLevel) {
+				next.ServeHTTP(w, r)
+				return
+			}
 			start := time.Now()
 
-			// Создаем ResponseWriter для отслеживания статуса
+			// Создаем ResponseWriter для отслеживания статуса и размера ответа
 			rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			info := &AccessInfo{}
 
-			next.ServeHTTP(rw, r)
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), accessInfoKey{}, info)))
 
-			duration := time.Since(start)
+			apiKeyPrefix := r.Header.Get("X-API-Key")
+			if len(apiKeyPrefix) > apiKeyPrefixLength {
+				apiKeyPrefix = apiKeyPrefix[:apiKeyPrefixLength]
+			}
+			info.mu.Lock()
+			route, userID, telegramID := info.route, info.userID, info.telegramID
+			info.mu.Unlock()
+			if route == "" {
+				route = "unmatched"
+			}
 
 			logger.WithFields(logrus.Fields{
-				"method":     r.Method,
-				"path":       r.URL.Path,
-				"status":     rw.statusCode,
-				"duration":   duration,
-				"ip":         r.RemoteAddr,
-				"user_agent": r.UserAgent(),
+				"method":         r.Method,
+				"route":          route,
+				"status":         rw.statusCode,
+				"bytes":          rw.bytes,
+				"duration_ms":    float64(time.Since(start).Microseconds()) / 1000,
+				"ip":             ClientIP(r),
+				"user_agent":     r.UserAgent(),
+				"user_id":        userID,
+				"telegram_id":    telegramID,
+				"api_key_prefix": apiKeyPrefix,
+				"request_id":     RequestID(r),
 			}).Info("HTTP request")
 		})
 	}
 }
 
-// responseWriter для отслеживания статуса ответа
+// responseWriter для отслеживания статуса и размера ответа
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(p)
+	rw.bytes += n
+	return n, err
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	handler := LoggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := AccessInfoFromContext(r.Context())
+		info.SetRoute("/api/orders/")
+		info.SetUser(42, 0)
+		info.SetUser(0, 100500)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/orders/15/cancel", nil)
+	req.Header.Set("X-API-Key", "zn_abcdefghijklmnop")
+	req.Header.Set("X-Request-ID", "req-1")
+	req = req.WithContext(WithClientIP(req.Context(), "198.51.100.1"))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("запись журнала не в формате JSON: %v: %s", err, out.String())
+	}
+	want := map[string]any{
+		"route":          "/api/orders/",
+		"status":         float64(http.StatusCreated),
+		"bytes":          float64(len("created")),
+		"user_id":        float64(42),
+		"telegram_id":    float64(100500),
+		"api_key_prefix": "zn_abcde",
+		"request_id":     "req-1",
+		"ip":             "198.51.100.1",
+	}
+	for field, value := range want {
+		if entry[field] != value {
+			t.Errorf("поле %s = %v, ожидалось %v", field, entry[field], value)
+		}
+	}
+}
+
+func TestLoggingMiddlewareDisabled(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.SetLevel(logrus.WarnLevel)
+
+	LoggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AccessInfoFromContext(r.Context()).SetRoute("/api/orders")
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+
+	if out.Len() != 0 {
+		t.Errorf("при уровне warn запросы не должны записываться: %s", out.String())
+	}
+}
+
+func TestLimiterHeaders(t *testing.T) {
+	handler := NewLimiter(1, 2).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, remaining := range []string{"1", "0"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("запрос %d отклонен с кодом %d", i+1, rec.Code)
+		}
+		if rec.Header().Get(HeaderRateLimitLimit) != "2" || rec.Header().Get(HeaderRateLimitRemaining) != remaining ||
+			rec.Header().Get(HeaderRateLimitReset) == "" {
+			t.Errorf("запрос %d: неверные заголовки лимита %v", i+1, rec.Header())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("запрос сверх лимита: код %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	var body struct {
+		Status     string         `json:"status"`
+		Code       string         `json:"code"`
+		RetryAfter int            `json:"retry_after"`
+		RateLimit  RateLimitState `json:"rate_limit"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("ответ 429 не в формате JSON: %v: %s", err, rec.Body.String())
+	}
+	if body.Status != "error" || body.Code != "rate_limited" || body.RetryAfter != 1 ||
+		body.RateLimit.Limit != 2 || body.RateLimit.Remaining != 0 || body.RateLimit.ResetsAt.IsZero() {
+		t.Errorf("неверное тело ответа 429: %+v", body)
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"project-znak/pkg/logger"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PanicReporter получает сведения о панике в обработчике: запрос, значение паники
+// и стек вызовов
+type PanicReporter func(r *http.Request, value any, stack []byte)
+
+// Recovery перехватывает панику в обработчике, записывает в журнал стек вызовов
+// с параметрами запроса и отвечает 500 в едином формате ошибок. Если задан report,
+// сведения о панике дополнительно передаются в него.
+func Recovery(logger *log.Logger, report PanicReporter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &recoveryWriter{ResponseWriter: w}
+			defer func() {
+				value := recover()
+				if value == nil {
+					return
+				}
+				// Прерывание ответа средствами net/http не является ошибкой
+				if err, ok := value.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(value)
+				}
+
+				stack := debug.Stack()
+				traceID := ""
+				if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+					traceID = sc.TraceID().String()
+				}
+				logger.Printf("Паника при обработке запроса %s %s (клиент %s, trace_id %s): %v\n%s",
+					r.Method, r.URL.Path, r.RemoteAddr, traceID, value, stack)
+				if report != nil {
+					report(r, value, stack)
+				}
+
+				// Если ответ уже начат, статус изменить нельзя
+				if rw.wroteHeader {
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{
+					"status":  "error",
+					"message": "Внутренняя ошибка сервера",
+				})
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// SentryReporter отправляет панику в Sentry с тегами области запроса, созданной SentryScope.
+// Клиент Sentry должен быть предварительно настроен через logger.InitSentry.
+func SentryReporter(r *http.Request, value any, stack []byte) {
+	logger.ReportPanic(r.Context(), value)
+}
+
+// SentryScope создает для запроса отдельную область Sentry с тегами request_id (см. RequestID)
+// и route. Обработчики дополняют область через logger.SetTag.
+func SentryScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !logger.SentryEnabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := logger.WithSentryScope(r.Context(), map[string]string{
+			logger.TagRequestID: RequestID(r),
+			logger.TagRoute:     r.Method + " " + r.URL.Path,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// recoveryWriter отслеживает, был ли уже отправлен статус ответа
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *recoveryWriter) WriteHeader(code int) {
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recoveryWriter) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(p)
+}
+
+func (rw *recoveryWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	var logs bytes.Buffer
+	var reported any
+	handler := Recovery(log.New(&logs, "", 0), func(r *http.Request, value any, stack []byte) {
+		reported = value
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("сбой обработчика")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/kizs", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("ожидался статус 500, получен %d", rec.Code)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body["status"] != "error" {
+		t.Errorf("ответ не в едином формате ошибок: %v %v", body, err)
+	}
+	if reported != "сбой обработчика" {
+		t.Errorf("паника не передана в отчет: %v", reported)
+	}
+	if !strings.Contains(logs.String(), "GET /api/kizs") || !strings.Contains(logs.String(), "goroutine") {
+		t.Errorf("в журнале нет запроса или стека вызовов: %s", logs.String())
+	}
+}
+
+func TestRecoveryAfterResponseStarted(t *testing.T) {
+	handler := Recovery(log.New(&bytes.Buffer{}, "", 0), nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("сбой после начала ответа")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusAccepted || rec.Body.Len() != 0 {
+		t.Errorf("начатый ответ не должен изменяться: %d %q", rec.Code, rec.Body.String())
+	}
+}
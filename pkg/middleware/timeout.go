@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout ограничивает время обработки запроса. Для путей из routes действует собственное
+// ограничение (путь, оканчивающийся на "/", задает ограничение для всех вложенных путей,
+// "*" заменяет один сегмент пути), для остальных - timeout; нулевое значение отключает ограничение. По истечении времени
+// контекст запроса отменяется, а клиент получает 504 в едином формате ошибок.
+//
+// Обработчик выполняется в отдельной горутине, ответ накапливается в памяти и
+// отправляется после его завершения, поэтому для потоковых ответов ограничение
+// следует отключать.
+func Timeout(timeout time.Duration, routes map[string]time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := routeValue(r.URL.Path, timeout, routes)
+			if limit <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), limit)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if value := recover(); value != nil {
+						if err, ok := value.(error); !ok || !errors.Is(err, http.ErrAbortHandler) {
+							value = fmt.Sprintf("%v\n\n%s", value, debug.Stack())
+						}
+						panicked <- value
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case value := <-panicked:
+				panic(value)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for key, values := range tw.header {
+					dst[key] = values
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.body.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					// Клиент закрыл соединение, отвечать некому
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusGatewayTimeout)
+				json.NewEncoder(w).Encode(map[string]string{
+					"status":  "error",
+					"message": "Превышено время обработки запроса",
+				})
+			}
+		})
+	}
+}
+
+// Ограничение для пути: точное совпадение, затем шаблон с "*" на месте сегмента пути
+// (/api/requests/*/status), затем самый длинный префикс, иначе fallback
+func routeValue[T any](requestPath string, fallback T, routes map[string]T) T {
+	if value, ok := routes[requestPath]; ok {
+		return value
+	}
+	for route, value := range routes {
+		if strings.Contains(route, "*") {
+			if matched, _ := path.Match(route, requestPath); matched {
+				return value
+			}
+		}
+	}
+	longest := ""
+	for route := range routes {
+		if strings.HasSuffix(route, "/") && strings.HasPrefix(requestPath, route) && len(route) > len(longest) {
+			longest = route
+		}
+	}
+	if longest != "" {
+		return routes[longest]
+	}
+	return fallback
+}
+
+// timeoutWriter накапливает ответ обработчика до его завершения или истечения времени
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = code
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.body.Write(p)
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.Write([]byte("поздний ответ"))
+	})
+	handler := Timeout(20*time.Millisecond, map[string]time.Duration{"/api/requests/download": 0})(slow)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/kizs", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("ожидался статус 504, получен %d", rec.Code)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body["status"] != "error" {
+		t.Errorf("ответ не в едином формате ошибок: %v %v", body, err)
+	}
+
+	fast := Timeout(time.Second, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+	rec = httptest.NewRecorder()
+	fast.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/orders", nil))
+	if rec.Code != http.StatusCreated || rec.Body.String() != `{"status":"success"}` || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("ответ обработчика передан с искажениями: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	routes := map[string]time.Duration{"/api/kizs": time.Minute, "/docs/": 0, "/api/requests/*/status": 0}
+	tests := []struct {
+		path string
+		want time.Duration
+	}{
+		{"/api/kizs", time.Minute},
+		{"/docs/index.html", 0},
+		{"/api/orders", 10 * time.Second},
+		{"/api/requests/42/status", 0},
+		{"/api/requests/42/retry", 10 * time.Second},
+		{"/api/requests/42/status/extra", 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := routeValue(tt.path, 10*time.Second, routes); got != tt.want {
+			t.Errorf("routeValue(%q) = %v, ожидалось %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := ConcurrencyLimit(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/kizs", nil))
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/kizs", nil))
+	close(release)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("запрос сверх лимита: ожидался статус 503, получен %d", rec.Code)
+	}
+}